@@ -91,6 +91,8 @@ func writeConfig(c *config) error {
 
 type config struct {
 	Host string `json:"host"`
+	// OCMEndpoint is the URL of the ocmd http service, used by the OCM invite commands.
+	OCMEndpoint string `json:"ocm_endpoint,omitempty"`
 }
 
 func read(r *bufio.Reader) (string, error) {
@@ -36,6 +36,12 @@ var configureCommand = func() *command {
 		}
 
 		c := &config{Host: text}
+
+		fmt.Print("ocm endpoint (optional, e.g. https://localhost:20080/ocm): ")
+		if c.OCMEndpoint, err = read(reader); err != nil {
+			return err
+		}
+
 		if err := writeConfig(c); err != nil {
 			panic(err)
 		}
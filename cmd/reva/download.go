@@ -28,16 +28,18 @@ import (
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/pkg/errors"
 )
 
 func downloadCommand() *command {
 	cmd := newCommand("download")
-	cmd.Description = func() string { return "download a remote file into the local filesystem" }
+	cmd.Description = func() string { return "download a remote file or folder into the local filesystem" }
 	cmd.Usage = func() string { return "Usage: download [-flags] <remote_file> <local_file>" }
+	recursiveFlag := cmd.Bool("r", false, "download a folder recursively")
+	parallelFlag := cmd.Int("j", 4, "number of parallel transfers when downloading a folder")
 	cmd.Action = func() error {
 		if cmd.NArg() < 2 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		remote := cmd.Args()[0]
@@ -48,6 +50,10 @@ func downloadCommand() *command {
 			return err
 		}
 
+		if *recursiveFlag {
+			return downloadDir(getAuthContext(), client, remote, local, *parallelFlag)
+		}
+
 		ref := &provider.Reference{
 			Spec: &provider.Reference_Path{Path: remote},
 		}
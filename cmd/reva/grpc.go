@@ -51,8 +51,22 @@ func getClient() (gateway.GatewayAPIClient, error) {
 	return gateway.NewGatewayAPIClient(conn), nil
 }
 
+var (
+	// conn is reused by the commands run from the shell.
+	conn     *grpc.ClientConn
+	connHost string
+)
+
 func getConn() (*grpc.ClientConn, error) {
-	return grpc.Dial(conf.Host, grpc.WithInsecure())
+	if conn != nil && connHost == conf.Host {
+		return conn, nil
+	}
+	c, err := grpc.Dial(conf.Host, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	conn, connHost = c, conf.Host
+	return conn, nil
 }
 
 func formatError(status *rpc.Status) error {
@@ -0,0 +1,72 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/pkg/errors"
+)
+
+func impersonateCommand() *command {
+	cmd := newCommand("impersonate")
+	cmd.Description = func() string { return "act as another user, for admins" }
+	cmd.Usage = func() string { return "Usage: impersonate <user id>" }
+
+	cmd.Action = func() error {
+		if cmd.NArg() != 1 {
+			return errors.New(cmd.Usage())
+		}
+
+		token, err := readToken()
+		if err != nil {
+			fmt.Println("the token file cannot be readed from file ", getTokenFile())
+			fmt.Println("make sure you have login before with \"reva login\"")
+			return err
+		}
+
+		client, err := getClient()
+		if err != nil {
+			return err
+		}
+
+		req := &gateway.AuthenticateRequest{
+			Type:         "impersonate",
+			ClientId:     cmd.Args()[0],
+			ClientSecret: token,
+		}
+
+		res, err := client.Authenticate(context.Background(), req)
+		if err != nil {
+			return err
+		}
+
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return formatError(res.Status)
+		}
+
+		writeToken(res.Token)
+		fmt.Printf("OK, acting as %s until the next login\n", res.User.Username)
+		return nil
+	}
+	return cmd
+}
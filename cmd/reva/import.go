@@ -19,12 +19,11 @@
 package main
 
 import (
-	"fmt"
 	"log"
-	"os"
 	"path"
 
 	"github.com/cs3org/reva/pkg/storage/migrate"
+	"github.com/pkg/errors"
 )
 
 func importCommand() *command {
@@ -36,8 +35,7 @@ func importCommand() *command {
 
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 		exportPath := cmd.Args()[0]
 
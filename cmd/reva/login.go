@@ -27,6 +27,7 @@ import (
 	registry "github.com/cs3org/go-cs3apis/cs3/auth/registry/v1beta1"
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/pkg/errors"
 )
 
 var loginCommand = func() *command {
@@ -63,8 +64,7 @@ var loginCommand = func() *command {
 
 		var authType, username, password string
 		if cmd.NArg() != 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		} else {
 			authType = cmd.Args()[0]
 			reader := bufio.NewReader(os.Stdin)
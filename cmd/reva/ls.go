@@ -25,6 +25,9 @@ import (
 
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/golang/protobuf/proto"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
 )
 
 func lsCommand() *command {
@@ -36,8 +39,7 @@ func lsCommand() *command {
 
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		fn := cmd.Args()[0]
@@ -62,6 +64,28 @@ func lsCommand() *command {
 		}
 
 		infos := res.Infos
+		switch outputFormat {
+		case formatJSON:
+			msgs := make([]proto.Message, 0, len(infos))
+			for _, info := range infos {
+				msgs = append(msgs, info)
+			}
+			return printJSONList(msgs)
+		case formatTable:
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Type", "Size", "Modified", "Id", "Path"})
+			for _, info := range infos {
+				p := info.Path
+				if !*fullFlag {
+					p = path.Base(info.Path)
+				}
+				t.AppendRow(table.Row{info.Type, info.Size, formatTimestamp(info.Mtime), info.GetId().GetStorageId() + ":" + info.GetId().GetOpaqueId(), p})
+			}
+			t.Render()
+			return nil
+		}
+
 		for _, info := range infos {
 			p := info.Path
 			if !*fullFlag {
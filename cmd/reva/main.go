@@ -19,6 +19,8 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
@@ -30,21 +32,30 @@ var (
 	gitCommit, buildDate, version, goVersion string
 )
 
-func main() {
+// errUnknownCommand is returned by runCommand when no command has the name given.
+var errUnknownCommand = errors.New("unknown command")
 
-	cmds := []*command{
+func commands() []*command {
+	return []*command{
 		versionCommand(),
 		configureCommand(),
 		loginCommand(),
 		whoamiCommand(),
+		impersonateCommand(),
 		importCommand(),
+		migrateCommand(),
 		lsCommand(),
 		statCommand(),
 		uploadCommand(),
 		downloadCommand(),
+		syncCommand(),
 		rmCommand(),
 		moveCommand(),
 		mkdirCommand(),
+		ocmProviderListCommand(),
+		ocmInviteGenerateCommand(),
+		ocmInviteForwardCommand(),
+		ocmRemoteUserFindCommand(),
 		ocmShareCreateCommand(),
 		ocmShareListCommand(),
 		ocmShareRemoveCommand(),
@@ -63,46 +74,69 @@ func main() {
 		shareListReceivedCommand(),
 		shareUpdateReceivedCommand(),
 	}
+}
 
-	mainUsage := createMainUsage(cmds)
+func main() {
+	mainUsage := createMainUsage(commands())
 
-	// Verify that a subcommand has been provided
-	// os.Arg[0] is the main command
-	// os.Arg[1] will be the subcommand
-	if len(os.Args) < 2 {
+	format := flag.String("format", formatPlain, "the output format of the listings: plain, table or json")
+	flag.Usage = func() {
+		fmt.Printf("Usage: reva [-format plain|table|json] [command]\n\n")
 		fmt.Println(mainUsage)
+	}
+	flag.Parse()
+	if err := setOutputFormat(*format); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
+	args := flag.Args()
 
 	// Verify a configuration file exists.
 	// If if does not, create one
 	c, err := readConfig()
-	if err != nil && os.Args[1] != "configure" {
+	if err != nil && (len(args) == 0 || args[0] != "configure") {
 		fmt.Println("reva is not initialized, run \"reva configure\"")
 		os.Exit(1)
-	} else if os.Args[1] != "configure" {
+	} else if len(args) == 0 || args[0] != "configure" {
 		conf = c
 	}
 
+	// Without a subcommand, run the interactive shell
+	if len(args) == 0 {
+		if err := runShell(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Run command
-	action := os.Args[1]
+	err = runCommand(commands(), args)
+	if err == errUnknownCommand {
+		fmt.Println(mainUsage)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// runCommand runs the command named by the first argument with the others.
+func runCommand(cmds []*command, args []string) error {
 	for _, v := range cmds {
-		if v.Name == action {
-			if err := v.Parse(os.Args[2:]); err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+		if v.Name == args[0] {
+			err := v.Parse(args[1:])
+			if err == flag.ErrHelp {
+				return nil
 			}
-			err := v.Action()
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				return err
 			}
-			os.Exit(0)
+			return v.Action()
 		}
 	}
-
-	fmt.Println(mainUsage)
-	os.Exit(1)
+	return errUnknownCommand
 }
 
 func createMainUsage(cmds []*command) string {
@@ -0,0 +1,92 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/cs3org/reva/pkg/storage/migrate"
+	"github.com/pkg/errors"
+)
+
+func migrateCommand() *command {
+	cmd := newCommand("migrate")
+	cmd.Description = func() string { return "migrate a tree between storage providers" }
+	cmd.Usage = func() string { return "Usage: migrate [-flags] <source_folder> <target_folder>" }
+	stateFlag := cmd.String("state", "", "file recording the progress, to resume an interrupted migration")
+	metadataFlag := cmd.Bool("metadata", true, "migrate the arbitrary metadata and modification times")
+	versionsFlag := cmd.Bool("versions", true, "migrate the file versions")
+	sharesFlag := cmd.Bool("shares", true, "migrate the shares and public links")
+	reportFlag := cmd.String("report", "", "file to write the report to, in json")
+	cmd.Action = func() error {
+		if cmd.NArg() < 2 {
+			return errors.New(cmd.Usage())
+		}
+
+		ctx := getAuthContext()
+		client, err := getClient()
+		if err != nil {
+			return err
+		}
+
+		report, err := migrate.MigrateTree(ctx, client, &migrate.Options{
+			Source:    cmd.Args()[0],
+			Target:    cmd.Args()[1],
+			StateFile: *stateFlag,
+			Metadata:  *metadataFlag,
+			Versions:  *versionsFlag,
+			Shares:    *sharesFlag,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Migrated %d folders, %d files (%d bytes), %d versions, %d shares and %d public links\n",
+			report.Folders, report.Files, report.Bytes, report.Versions, report.Shares, len(report.Links))
+		if report.Resumed > 0 {
+			fmt.Printf("%d files were already migrated\n", report.Resumed)
+		}
+		for _, l := range report.Links {
+			fmt.Printf("public link %s: %s replaced by %s\n", l.Path, l.OldToken, l.NewToken)
+		}
+		for _, i := range report.Skipped {
+			fmt.Printf("skipped %s: %s\n", i.Path, i.Reason)
+		}
+		for _, i := range report.Failed {
+			fmt.Printf("failed %s: %s\n", i.Path, i.Reason)
+		}
+
+		if *reportFlag != "" {
+			b, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(*reportFlag, b, 0644); err != nil {
+				return err
+			}
+		}
+		if len(report.Failed) > 0 {
+			return fmt.Errorf("%d resources could not be migrated", len(report.Failed))
+		}
+		return nil
+	}
+	return cmd
+}
@@ -19,11 +19,9 @@
 package main
 
 import (
-	"fmt"
-	"os"
-
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func mkdirCommand() *command {
@@ -32,8 +30,7 @@ func mkdirCommand() *command {
 	cmd.Usage = func() string { return "Usage: mkdir [-flags] <container_name>" }
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		fn := cmd.Args()[0]
@@ -19,11 +19,9 @@
 package main
 
 import (
-	"fmt"
-	"os"
-
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func moveCommand() *command {
@@ -32,8 +30,7 @@ func moveCommand() *command {
 	cmd.Usage = func() string { return "Usage: mv [-flags] <source> <destination>" }
 	cmd.Action = func() error {
 		if cmd.NArg() < 2 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		src := cmd.Args()[0]
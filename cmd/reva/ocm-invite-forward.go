@@ -0,0 +1,56 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+func ocmInviteForwardCommand() *command {
+	cmd := newCommand("ocm-invite-forward")
+	cmd.Description = func() string { return "accept an OCM invite token generated on a remote provider" }
+	cmd.Usage = func() string { return "Usage: ocm-invite-forward [-flags] <token>" }
+	providerDomain := cmd.String("provider", "", "the domain of the provider that generated the token")
+	cmd.Action = func() error {
+		if cmd.NArg() < 1 {
+			return errors.New(cmd.Usage())
+		}
+
+		if *providerDomain == "" {
+			fmt.Println("provider cannot be empty: use -provider flag")
+			return errors.New(cmd.Usage())
+		}
+
+		form := url.Values{
+			"token":          {cmd.Args()[0]},
+			"providerDomain": {*providerDomain},
+		}
+		if err := ocmdRequest(http.MethodPost, "/invites/forward", form, nil); err != nil {
+			return err
+		}
+
+		fmt.Println("Invite accepted")
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,43 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cs3org/reva/pkg/ocm/invite"
+)
+
+func ocmInviteGenerateCommand() *command {
+	cmd := newCommand("ocm-invite-generate")
+	cmd.Description = func() string { return "generate an OCM invite token for remote users" }
+	cmd.Usage = func() string { return "Usage: ocm-invite-generate [-flags]" }
+	cmd.Action = func() error {
+		tkn := &invite.Token{}
+		if err := ocmdRequest(http.MethodPost, "/invites", nil, tkn); err != nil {
+			return err
+		}
+
+		fmt.Printf("Token: %s\n", tkn.Token)
+		fmt.Printf("Expiration: %s\n", tkn.Expiration)
+		return nil
+	}
+	return cmd
+}
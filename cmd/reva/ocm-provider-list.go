@@ -0,0 +1,51 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"net/http"
+	"os"
+
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/jedib0t/go-pretty/table"
+)
+
+func ocmProviderListCommand() *command {
+	cmd := newCommand("ocm-provider-list")
+	cmd.Description = func() string { return "list the trusted OCM providers" }
+	cmd.Usage = func() string { return "Usage: ocm-provider-list [-flags]" }
+	cmd.Action = func() error {
+		providers := []*ocm.ProviderInfo{}
+		if err := ocmdRequest(http.MethodGet, "/providers", nil, &providers); err != nil {
+			return err
+		}
+
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Domain", "ApiVersion", "ApiEndpoint", "WebdavEndpoint"})
+		for _, p := range providers {
+			t.AppendRows([]table.Row{
+				{p.Domain, p.ApiVersion, p.ApiEndpoint, p.WebdavEndpoint},
+			})
+		}
+		t.Render()
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,57 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/jedib0t/go-pretty/table"
+)
+
+func ocmRemoteUserFindCommand() *command {
+	cmd := newCommand("ocm-remote-user-find")
+	cmd.Description = func() string { return "find the remote users that accepted your OCM invites" }
+	cmd.Usage = func() string { return "Usage: ocm-remote-user-find [-flags] [query]" }
+	cmd.Action = func() error {
+		var query string
+		if cmd.NArg() > 0 {
+			query = cmd.Args()[0]
+		}
+
+		users := []*userpb.User{}
+		if err := ocmdRequest(http.MethodGet, "/invites/remote-users", url.Values{"search": {query}}, &users); err != nil {
+			return err
+		}
+
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Idp", "OpaqueId", "Mail", "DisplayName"})
+		for _, u := range users {
+			t.AppendRows([]table.Row{
+				{u.Id.Idp, u.Id.OpaqueId, u.Mail, u.DisplayName},
+			})
+		}
+		t.Render()
+		return nil
+	}
+	return cmd
+}
@@ -37,19 +37,17 @@ func ocmShareCreateCommand() *command {
 	cmd.Usage = func() string { return "Usage: ocm-share create [-flags] <path>" }
 	grantType := cmd.String("type", "user", "grantee type (user or group)")
 	grantee := cmd.String("grantee", "", "the grantee")
-	idp := cmd.String("idp", "", "the idp of the grantee, default to same idp as the user triggering the action")
+	idp := cmd.String("idp", "", "the idp of the grantee, default to same idp as the user triggering the action, the provider domain for remote users found with ocm-remote-user-find")
 	rol := cmd.String("rol", "viewer", "the permission for the share (viewer or editor)")
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		// validate flags
 		if *grantee == "" {
 			fmt.Println("grantee cannot be empty: use -grantee flag")
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		fn := cmd.Args()[0]
@@ -20,10 +20,10 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func ocmShareUpdateReceivedCommand() *command {
@@ -33,15 +33,13 @@ func ocmShareUpdateReceivedCommand() *command {
 	state := cmd.String("state", "pending", "the state of the share (pending, accepted or rejected)")
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		// validate flags
 		if *state != "pending" && *state != "accepted" && *state != "rejected" {
 			fmt.Println("invalid state: state must be pending, accepted or rejected")
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		id := cmd.Args()[0]
@@ -20,10 +20,10 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func ocmShareUpdateCommand() *command {
@@ -33,15 +33,13 @@ func ocmShareUpdateCommand() *command {
 	rol := cmd.String("rol", "viewer", "the permission for the share (viewer or editor)")
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		// validate flags
 		if *rol != viewerPermission && *rol != editorPermission {
 			fmt.Println("invalid rol: rol must be viewer or editor")
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		id := cmd.Args()[0]
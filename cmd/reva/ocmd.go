@@ -0,0 +1,79 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/pkg/errors"
+)
+
+// ocmdRequest sends an authenticated request to the ocmd http service and
+// decodes its json response into v, if not nil.
+func ocmdRequest(method, p string, form url.Values, v interface{}) error {
+	if conf.OCMEndpoint == "" {
+		return errors.New("the ocm endpoint is not configured, run \"reva configure\"")
+	}
+	u := strings.TrimSuffix(conf.OCMEndpoint, "/") + p
+	var body io.Reader
+	if method == http.MethodGet {
+		if len(form) > 0 {
+			u += "?" + form.Encode()
+		}
+	} else {
+		body = strings.NewReader(form.Encode())
+	}
+	ctx := getAuthContext()
+	req, err := rhttp.NewRequest(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	res, err := rhttp.GetHTTPClient(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		apiErr := struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}{}
+		data, _ := ioutil.ReadAll(res.Body)
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("error: code=%s msg=%q", apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("error: %s", res.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
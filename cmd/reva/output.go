@@ -0,0 +1,83 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// formatPlain is the historical output of each command.
+	formatPlain = "plain"
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// outputFormat is the format the listing commands print their results in.
+var outputFormat = formatPlain
+
+func setOutputFormat(f string) error {
+	switch f {
+	case formatPlain, formatTable, formatJSON:
+		outputFormat = f
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %s: the format must be plain, table or json", f)
+	}
+}
+
+// printJSON prints a message as indented JSON.
+func printJSON(msg proto.Message) error {
+	m := jsonpb.Marshaler{Indent: "  "}
+	return m.Marshal(os.Stdout, msg)
+}
+
+// printJSONList prints messages as an indented JSON array.
+func printJSONList(msgs []proto.Message) error {
+	m := jsonpb.Marshaler{Indent: "  "}
+	items := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		s, err := m.MarshalToString(msg)
+		if err != nil {
+			return err
+		}
+		items = append(items, "  "+strings.Replace(s, "\n", "\n  ", -1))
+	}
+	if len(items) == 0 {
+		fmt.Println("[]")
+		return nil
+	}
+	fmt.Printf("[\n%s\n]\n", strings.Join(items, ",\n"))
+	return nil
+}
+
+// formatTimestamp formats a timestamp in the local time zone, for the tables.
+func formatTimestamp(ts *types.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return time.Unix(int64(ts.Seconds), 0).String()
+}
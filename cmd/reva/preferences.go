@@ -20,10 +20,10 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	preferences "github.com/cs3org/go-cs3apis/cs3/preferences/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/pkg/errors"
 )
 
 var preferencesCommand = func() *command {
@@ -34,8 +34,7 @@ var preferencesCommand = func() *command {
 	cmd.Action = func() error {
 
 		if cmd.NArg() < 2 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		subcommand := cmd.Args()[0]
@@ -51,8 +50,7 @@ var preferencesCommand = func() *command {
 		switch subcommand {
 		case "set":
 			if cmd.NArg() < 3 {
-				fmt.Println(cmd.Usage())
-				os.Exit(1)
+				return errors.New(cmd.Usage())
 			}
 			value := cmd.Args()[2]
 			req := &preferences.SetKeyRequest{
@@ -86,8 +84,7 @@ var preferencesCommand = func() *command {
 			fmt.Println(res.Val)
 
 		default:
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 		return nil
 	}
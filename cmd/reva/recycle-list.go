@@ -24,6 +24,9 @@ import (
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/golang/protobuf/proto"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
 )
 
 func recycleListCommand() *command {
@@ -33,8 +36,7 @@ func recycleListCommand() *command {
 
 	cmd.Action = func() error {
 		if cmd.NArg() < 0 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		client, err := getClient()
@@ -55,6 +57,24 @@ func recycleListCommand() *command {
 		}
 
 		items := res.RecycleItems
+		switch outputFormat {
+		case formatJSON:
+			msgs := make([]proto.Message, 0, len(items))
+			for _, item := range items {
+				msgs = append(msgs, item)
+			}
+			return printJSONList(msgs)
+		case formatTable:
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Key", "Type", "Size", "Deleted", "Path"})
+			for _, item := range items {
+				t.AppendRow(table.Row{item.Key, item.Type, item.Size, formatTimestamp(item.DeletionTime), item.Path})
+			}
+			t.Render()
+			return nil
+		}
+
 		for _, item := range items {
 			fmt.Printf("%+v\n", item)
 		}
@@ -19,11 +19,9 @@
 package main
 
 import (
-	"fmt"
-	"os"
-
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func recyclePurgeCommand() *command {
@@ -33,8 +31,7 @@ func recyclePurgeCommand() *command {
 
 	cmd.Action = func() error {
 		if cmd.NArg() < 0 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		client, err := getClient()
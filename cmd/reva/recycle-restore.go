@@ -19,11 +19,9 @@
 package main
 
 import (
-	"fmt"
-	"os"
-
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func recycleRestoreCommand() *command {
@@ -33,8 +31,7 @@ func recycleRestoreCommand() *command {
 
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		key := cmd.Args()[0]
@@ -19,11 +19,9 @@
 package main
 
 import (
-	"fmt"
-	"os"
-
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	storageproviderv1beta1pb "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func rmCommand() *command {
@@ -32,8 +30,7 @@ func rmCommand() *command {
 	cmd.Usage = func() string { return "Usage: rm [-flags] <file_name>" }
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		fn := cmd.Args()[0]
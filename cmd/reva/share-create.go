@@ -41,15 +41,13 @@ func shareCreateCommand() *command {
 	rol := cmd.String("rol", "viewer", "the permission for the share (viewer or editor)")
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		// validate flags
 		if *grantee == "" {
 			fmt.Println("grantee cannot be empty: use -grantee flag")
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		fn := cmd.Args()[0]
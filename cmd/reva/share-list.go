@@ -27,6 +27,7 @@ import (
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/golang/protobuf/proto"
 	"github.com/jedib0t/go-pretty/table"
 )
 
@@ -72,6 +73,14 @@ func shareListCommand() *command {
 			return formatError(shareRes.Status)
 		}
 
+		if outputFormat == formatJSON {
+			msgs := make([]proto.Message, 0, len(shareRes.Shares))
+			for _, s := range shareRes.Shares {
+				msgs = append(msgs, s)
+			}
+			return printJSONList(msgs)
+		}
+
 		t := table.NewWriter()
 		t.SetOutputMirror(os.Stdout)
 		t.AppendHeader(table.Row{"#", "Owner.Idp", "Owner.OpaqueId", "ResourceId", "Permissions", "Type", "Grantee.Idp", "Grantee.OpaqueId", "Created", "Updated"})
@@ -20,10 +20,10 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func shareRemoveCommand() *command {
@@ -32,8 +32,7 @@ func shareRemoveCommand() *command {
 	cmd.Usage = func() string { return "Usage: share-remove [-flags] <share_id>" }
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		id := cmd.Args()[0]
@@ -0,0 +1,256 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	gouser "os/user"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/peterh/liner"
+)
+
+const shellUsage = `
+Shell commands:
+help              prints this help
+format <format>   sets the output format of the listings: plain, table or json
+exit              leaves the shell`
+
+func getHistoryFile() string {
+	user, err := gouser.Current()
+	if err != nil {
+		panic(err)
+	}
+
+	return path.Join(user.HomeDir, ".reva-history")
+}
+
+// runShell runs the commands read from the terminal until exit, with the
+// tab completion of the commands, of their flags and of the remote paths, and
+// with a history kept across sessions.
+func runShell() error {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetWordCompleter(complete)
+
+	if f, err := os.Open(getHistoryFile()); err == nil {
+		_, _ = line.ReadHistory(f)
+		f.Close()
+	}
+	defer func() {
+		if f, err := os.OpenFile(getHistoryFile(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err == nil {
+			_, _ = line.WriteHistory(f)
+			f.Close()
+		}
+	}()
+
+	for {
+		input, err := line.Prompt("reva> ")
+		if err == liner.ErrPromptAborted {
+			continue
+		}
+		if err == io.EOF {
+			fmt.Println()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := splitArgs(input)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		line.AppendHistory(input)
+
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			fmt.Println(createMainUsage(commands()) + "\n" + shellUsage)
+			continue
+		case "format":
+			if len(args) != 2 {
+				fmt.Println("Usage: format <plain|table|json>")
+			} else if err := setOutputFormat(args[1]); err != nil {
+				fmt.Println(err)
+			}
+			continue
+		}
+
+		if err := runCommand(commands(), args); err == errUnknownCommand {
+			fmt.Printf("unknown command %s, type help for the list of commands\n", args[0])
+		} else if err != nil {
+			fmt.Println(err)
+		}
+
+		if args[0] == "configure" {
+			if c, err := readConfig(); err == nil {
+				conf = c
+			}
+		}
+	}
+}
+
+// splitArgs splits a line into arguments separated by spaces. The spaces in
+// quotes or escaped with a backslash are kept in the arguments.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg, escaped := false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated argument: %s", arg.String())
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// complete completes the word under the cursor: the command name for the first
+// word, a flag of the command for the words starting with a dash and a remote
+// path for the words starting with a slash.
+func complete(line string, pos int) (head string, completions []string, tail string) {
+	head, tail = line[:pos], line[pos:]
+	start := 0
+	for i := 0; i < len(head); i++ {
+		switch head[i] {
+		case '\\':
+			i++
+		case ' ':
+			start = i + 1
+		}
+	}
+	word := head[start:]
+	head = head[:start]
+
+	fields := strings.Fields(head)
+	switch {
+	case len(fields) == 0:
+		names := []string{"exit", "format", "help"}
+		for _, cmd := range commands() {
+			names = append(names, cmd.Name)
+		}
+		completions = withPrefix(names, word)
+	case strings.HasPrefix(word, "-"):
+		for _, cmd := range commands() {
+			if cmd.Name == fields[0] {
+				names := []string{}
+				cmd.VisitAll(func(f *flag.Flag) { names = append(names, "-"+f.Name) })
+				completions = withPrefix(names, word)
+			}
+		}
+	case fields[0] == "format":
+		completions = withPrefix([]string{formatPlain, formatTable, formatJSON}, word)
+	case strings.HasPrefix(word, "/"):
+		completions = completePath(word)
+	}
+	return head, completions, tail
+}
+
+func withPrefix(words []string, prefix string) []string {
+	matches := []string{}
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			matches = append(matches, w)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completePath lists the container of a remote path to complete its last
+// element, the containers are completed with a trailing slash.
+func completePath(word string) []string {
+	unescaped, err := splitArgs(word)
+	if err != nil || len(unescaped) != 1 {
+		return nil
+	}
+	fn := unescaped[0]
+	dir, prefix := fn[:strings.LastIndex(fn, "/")+1], fn[strings.LastIndex(fn, "/")+1:]
+
+	client, err := getClient()
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(getAuthContext(), 5*time.Second)
+	defer cancel()
+	res, err := client.ListContainer(ctx, &provider.ListContainerRequest{
+		Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: dir}},
+	})
+	if err != nil || res.Status.Code != rpc.Code_CODE_OK {
+		return nil
+	}
+
+	matches := []string{}
+	for _, info := range res.Infos {
+		name := path.Base(info.Path)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		match := strings.Replace(dir+name, " ", "\\ ", -1)
+		if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+			match += "/"
+		}
+		matches = append(matches, match)
+	}
+	sort.Strings(matches)
+	return matches
+}
@@ -0,0 +1,49 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	for line, want := range map[string][]string{
+		"ls -l /home":              {"ls", "-l", "/home"},
+		"  mkdir   /home/a  ":      {"mkdir", "/home/a"},
+		`upload "my file" /home/f`: {"upload", "my file", "/home/f"},
+		`stat /home/my\ file`:      {"stat", "/home/my file"},
+		`rm '/home/it\s'`:          {"rm", `/home/it\s`},
+		`mkdir ""`:                 {"mkdir", ""},
+		"":                         nil,
+	} {
+		got, err := splitArgs(line)
+		if err != nil {
+			t.Errorf("%q: %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %q, want %q", line, got, want)
+		}
+	}
+
+	if _, err := splitArgs(`ls "/home`); err == nil {
+		t.Error("unterminated quote accepted")
+	}
+}
@@ -24,6 +24,8 @@ import (
 
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
 )
 
 func statCommand() *command {
@@ -32,8 +34,7 @@ func statCommand() *command {
 	cmd.Usage = func() string { return "Usage: stat [-flags] <file_name>" }
 	cmd.Action = func() error {
 		if cmd.NArg() < 1 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		fn := cmd.Args()[0]
@@ -57,6 +58,27 @@ func statCommand() *command {
 			return formatError(res.Status)
 		}
 
+		switch outputFormat {
+		case formatJSON:
+			return printJSON(res.Info)
+		case formatTable:
+			info := res.Info
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendRows([]table.Row{
+				{"Path", info.Path},
+				{"Id", info.GetId().GetStorageId() + ":" + info.GetId().GetOpaqueId()},
+				{"Type", info.Type},
+				{"Size", info.Size},
+				{"Modified", formatTimestamp(info.Mtime)},
+				{"Etag", info.Etag},
+				{"MimeType", info.MimeType},
+				{"Owner", info.GetOwner().GetIdp() + ":" + info.GetOwner().GetOpaqueId()},
+			})
+			t.Render()
+			return nil
+		}
+
 		fmt.Println(res.Info)
 		return nil
 	}
@@ -0,0 +1,221 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/cheggaaa/pb"
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+	"github.com/pkg/errors"
+)
+
+func syncCommand() *command {
+	cmd := newCommand("sync")
+	cmd.Description = func() string { return "synchronize a local folder to a remote folder" }
+	cmd.Usage = func() string { return "Usage: sync [-flags] <local_folder> <remote_folder>" }
+	parallelFlag := cmd.Int("j", 4, "number of parallel transfers")
+	deleteFlag := cmd.Bool("delete", false, "delete remote files and folders not present locally")
+	checksumFlag := cmd.Bool("checksum", false, "compare files by checksum instead of size and modification time")
+	dryRunFlag := cmd.Bool("n", false, "only print what would be done")
+	cmd.Action = func() error {
+		if cmd.NArg() < 2 {
+			return errors.New(cmd.Usage())
+		}
+
+		local := cmd.Args()[0]
+		remote := cmd.Args()[1]
+
+		ctx := getAuthContext()
+		client, err := getClient()
+		if err != nil {
+			return err
+		}
+
+		dirs, files, err := walkLocal(local)
+		if err != nil {
+			return err
+		}
+
+		root, err := stat(ctx, client, remote)
+		if err != nil {
+			return err
+		}
+		entries := map[string]*provider.ResourceInfo{}
+		if root != nil {
+			if root.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+				return fmt.Errorf("%s is not a folder", remote)
+			}
+			remote = root.Path
+			if _, entries, err = walkRemote(ctx, client, remote); err != nil {
+				return err
+			}
+		}
+
+		// the local files and folders, to find the remote ones to delete
+		seen := map[string]bool{}
+		var mkdirs []string
+		for _, d := range dirs {
+			seen[d] = true
+			info, ok := entries[d]
+			if !ok {
+				mkdirs = append(mkdirs, d)
+				continue
+			}
+			if info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+				return fmt.Errorf("%s is a folder locally but not remotely", d)
+			}
+		}
+
+		var uploads []*localFile
+		var total int64
+		for _, f := range files {
+			seen[f.rel] = true
+			upload, err := needsUpload(f, entries[f.rel], *checksumFlag)
+			if err != nil {
+				return err
+			}
+			if upload {
+				uploads = append(uploads, f)
+				total += f.size
+			}
+		}
+
+		var deletes []string
+		if *deleteFlag {
+			deletes = toDelete(entries, seen)
+		}
+
+		fmt.Printf("%d folders to create, %d files to upload (%d bytes), %d to delete\n", len(mkdirs), len(uploads), total, len(deletes))
+		if *dryRunFlag {
+			for _, d := range mkdirs {
+				fmt.Printf("mkdir %s\n", path.Join(remote, d))
+			}
+			for _, f := range uploads {
+				fmt.Printf("upload %s\n", path.Join(remote, f.rel))
+			}
+			for _, d := range deletes {
+				fmt.Printf("delete %s\n", path.Join(remote, d))
+			}
+			return nil
+		}
+
+		if err := ensureContainer(ctx, client, remote); err != nil {
+			return err
+		}
+		for _, d := range mkdirs {
+			if err := ensureContainer(ctx, client, path.Join(remote, d)); err != nil {
+				return err
+			}
+		}
+
+		jobs := make([]func(bar *pb.ProgressBar) error, 0, len(uploads))
+		for _, f := range uploads {
+			f := f
+			jobs = append(jobs, func(bar *pb.ProgressBar) error {
+				return uploadFile(ctx, client, f, path.Join(remote, f.rel), bar)
+			})
+		}
+		if err := transfers(*parallelFlag, total, jobs); err != nil {
+			return err
+		}
+
+		for _, d := range deletes {
+			if err := remove(ctx, client, path.Join(remote, d)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return cmd
+}
+
+// needsUpload tells whether the local file differs from the remote one. Files
+// are compared by size and modification time, or by checksum if the remote
+// one is known.
+func needsUpload(f *localFile, info *provider.ResourceInfo, byChecksum bool) (bool, error) {
+	if info == nil {
+		return true, nil
+	}
+	if info.Type != provider.ResourceType_RESOURCE_TYPE_FILE {
+		return false, fmt.Errorf("%s is a file locally but not remotely", f.rel)
+	}
+	if uint64(f.size) != info.Size {
+		return true, nil
+	}
+	if byChecksum {
+		if xs := checksums.FromResourceInfo(info); xs != "" {
+			h, err := localChecksum(f.path)
+			if err != nil {
+				return false, err
+			}
+			return h.Verify(xs) != nil, nil
+		}
+	}
+	return f.mtime.After(mtime(info.Mtime)), nil
+}
+
+// toDelete returns the remote entries not present locally, leaving out the
+// ones below folders deleted as a whole.
+func toDelete(entries map[string]*provider.ResourceInfo, seen map[string]bool) []string {
+	var rels []string
+	for rel := range entries {
+		if !seen[rel] {
+			rels = append(rels, rel)
+		}
+	}
+	sort.Strings(rels)
+
+	var deletes []string
+	deleted := map[string]bool{}
+	for _, rel := range rels {
+		if !hasDeletedParent(rel, deleted) {
+			deletes = append(deletes, rel)
+			deleted[rel] = true
+		}
+	}
+	return deletes
+}
+
+func hasDeletedParent(rel string, deleted map[string]bool) bool {
+	for p := path.Dir(rel); p != "."; p = path.Dir(p) {
+		if deleted[p] {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(ctx context.Context, client gateway.GatewayAPIClient, fn string) error {
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+	res, err := client.Delete(ctx, &provider.DeleteRequest{Ref: ref})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return formatError(res.Status)
+	}
+	return nil
+}
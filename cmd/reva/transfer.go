@@ -0,0 +1,381 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb"
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+)
+
+// localFile is a file found walking a local directory.
+type localFile struct {
+	path string
+	// rel is the slash separated path relative to the walked directory.
+	rel   string
+	size  int64
+	mtime time.Time
+}
+
+// walkLocal returns the folders, parents first, and the regular files below
+// root, other files such as symlinks are skipped.
+func walkLocal(root string) ([]string, []*localFile, error) {
+	var dirs []string
+	var files []*localFile
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case fi.IsDir():
+			if rel != "." {
+				dirs = append(dirs, rel)
+			}
+		case fi.Mode().IsRegular():
+			files = append(files, &localFile{path: p, rel: rel, size: fi.Size(), mtime: fi.ModTime()})
+		}
+		return nil
+	})
+	return dirs, files, err
+}
+
+// walkRemote returns the folders, parents first, and the files below the
+// remote folder, keyed by their path relative to it.
+func walkRemote(ctx context.Context, client gateway.GatewayAPIClient, root string) ([]*provider.ResourceInfo, map[string]*provider.ResourceInfo, error) {
+	var dirs []*provider.ResourceInfo
+	entries := map[string]*provider.ResourceInfo{}
+	folders := []string{root}
+	for len(folders) > 0 {
+		fn := folders[0]
+		folders = folders[1:]
+
+		ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+		res, err := client.ListContainer(ctx, &provider.ListContainerRequest{Ref: ref})
+		if err != nil {
+			return nil, nil, err
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return nil, nil, formatError(res.Status)
+		}
+		for _, info := range res.Infos {
+			entries[relPath(root, info.Path)] = info
+			if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+				dirs = append(dirs, info)
+				folders = append(folders, info.Path)
+			}
+		}
+	}
+	return dirs, entries, nil
+}
+
+// relPath returns the path of fn relative to the root folder.
+func relPath(root, fn string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(fn, root), "/")
+}
+
+// stat returns the info of the remote resource, or nil if it does not exist.
+func stat(ctx context.Context, client gateway.GatewayAPIClient, fn string) (*provider.ResourceInfo, error) {
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+	res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil {
+		return nil, err
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+		return res.Info, nil
+	case rpc.Code_CODE_NOT_FOUND:
+		return nil, nil
+	default:
+		return nil, formatError(res.Status)
+	}
+}
+
+// ensureContainer creates the remote folder if it does not exist.
+func ensureContainer(ctx context.Context, client gateway.GatewayAPIClient, fn string) error {
+	info, err := stat(ctx, client, fn)
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		if info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+			return fmt.Errorf("%s exists and is not a folder", fn)
+		}
+		return nil
+	}
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+	res, err := client.CreateContainer(ctx, &provider.CreateContainerRequest{Ref: ref})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return formatError(res.Status)
+	}
+	return nil
+}
+
+// localChecksum returns the checksums of the local file in the TYPE:sum
+// format of the OC-Checksum header.
+func localChecksum(fn string) (*checksums.Hasher, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	h := checksums.NewHasher()
+	if _, err := io.Copy(h, fd); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// uploadFile uploads the local file through the datagateway. The data server
+// verifies the SHA1 checksum sent along and rejects corrupted content.
+func uploadFile(ctx context.Context, client gateway.GatewayAPIClient, f *localFile, target string, bar *pb.ProgressBar) error {
+	h, err := localChecksum(f.path)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: target}}
+	res, err := client.InitiateFileUpload(ctx, &provider.InitiateFileUploadRequest{Ref: ref})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return formatError(res.Status)
+	}
+
+	httpReq, err := rhttp.NewRequest(ctx, http.MethodPut, res.UploadEndpoint, bar.NewProxyReader(fd))
+	if err != nil {
+		return err
+	}
+	httpReq.ContentLength = f.size
+	httpReq.Header.Set("X-Reva-Transfer", res.Token)
+	httpReq.Header.Set("OC-Checksum", checksums.SHA1+":"+h.Sum(checksums.SHA1))
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+
+	switch httpRes.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusBadRequest:
+		return fmt.Errorf("%s: rejected by the data server, the checksum does not match", target)
+	default:
+		return fmt.Errorf("%s: upload failed: %s", target, httpRes.Status)
+	}
+}
+
+// downloadFile downloads the remote file to a temporary file next to the
+// target and moves it in place once its checksum has been verified.
+func downloadFile(ctx context.Context, client gateway.GatewayAPIClient, info *provider.ResourceInfo, target string, bar *pb.ProgressBar) error {
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: info.Path}}
+	res, err := client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{Ref: ref})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return formatError(res.Status)
+	}
+
+	httpReq, err := rhttp.NewRequest(ctx, http.MethodGet, res.DownloadEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("X-Reva-Transfer", res.Token)
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: download failed: %s", info.Path, httpRes.Status)
+	}
+
+	tmp := target + ".reva-part"
+	fd, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	h := checksums.NewHasher()
+	_, err = io.Copy(io.MultiWriter(fd, h), bar.NewProxyReader(httpRes.Body))
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if xs := checksums.FromResourceInfo(info); xs != "" {
+			err = h.Verify(xs)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%s: %v", info.Path, err)
+	}
+
+	if info.Mtime != nil {
+		t := mtime(info.Mtime)
+		if err := os.Chtimes(tmp, t, t); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, target)
+}
+
+// transfers runs the jobs on n parallel workers, showing the progress of
+// the total bytes transferred. All the jobs are run even if some fail.
+func transfers(n int, total int64, jobs []func(bar *pb.ProgressBar) error) error {
+	if n < 1 {
+		n = 1
+	}
+	bar := pb.New64(total).SetUnits(pb.U_BYTES)
+	bar.Start()
+
+	ch := make(chan func(bar *pb.ProgressBar) error)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range ch {
+				if err := job(bar); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		ch <- job
+	}
+	close(ch)
+	wg.Wait()
+	bar.Finish()
+
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d transfers failed", len(errs), len(jobs))
+	}
+	return nil
+}
+
+// uploadDir uploads the local folder recursively into the remote folder.
+func uploadDir(ctx context.Context, client gateway.GatewayAPIClient, local, remote string, parallel int) error {
+	dirs, files, err := walkLocal(local)
+	if err != nil {
+		return err
+	}
+	if err := ensureContainer(ctx, client, remote); err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if err := ensureContainer(ctx, client, path.Join(remote, d)); err != nil {
+			return err
+		}
+	}
+
+	var total int64
+	jobs := make([]func(bar *pb.ProgressBar) error, 0, len(files))
+	for _, f := range files {
+		f := f
+		total += f.size
+		jobs = append(jobs, func(bar *pb.ProgressBar) error {
+			return uploadFile(ctx, client, f, path.Join(remote, f.rel), bar)
+		})
+	}
+	fmt.Printf("Uploading %d files, %d bytes\n", len(files), total)
+	return transfers(parallel, total, jobs)
+}
+
+// downloadDir downloads the remote folder recursively into the local folder.
+func downloadDir(ctx context.Context, client gateway.GatewayAPIClient, remote, local string, parallel int) error {
+	root, err := stat(ctx, client, remote)
+	if err != nil {
+		return err
+	}
+	if root == nil || root.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return fmt.Errorf("%s is not a folder", remote)
+	}
+	dirs, entries, err := walkRemote(ctx, client, root.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(local, 0755); err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(local, filepath.FromSlash(relPath(root.Path, d.Path))), 0755); err != nil {
+			return err
+		}
+	}
+
+	var total int64
+	var jobs []func(bar *pb.ProgressBar) error
+	for rel, info := range entries {
+		if info.Type != provider.ResourceType_RESOURCE_TYPE_FILE {
+			continue
+		}
+		info, target := info, filepath.Join(local, filepath.FromSlash(rel))
+		total += int64(info.Size)
+		jobs = append(jobs, func(bar *pb.ProgressBar) error {
+			return downloadFile(ctx, client, info, target, bar)
+		})
+	}
+	fmt.Printf("Downloading %d files, %d bytes\n", len(jobs), total)
+	return transfers(parallel, total, jobs)
+}
+
+// mtime returns the modification time of the remote resource.
+func mtime(ts *types.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(ts.Seconds), int64(ts.Nanos))
+}
@@ -33,24 +33,34 @@ import (
 	"github.com/cs3org/reva/internal/grpc/services/storageprovider"
 	"github.com/cs3org/reva/pkg/crypto"
 	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/pkg/errors"
 )
 
 func uploadCommand() *command {
 	cmd := newCommand("upload")
-	cmd.Description = func() string { return "upload a local file to the remote server" }
+	cmd.Description = func() string { return "upload a local file or folder to the remote server" }
 	cmd.Usage = func() string { return "Usage: upload [-flags] <file_name> <remote_target>" }
 	xsFlag := cmd.String("xs", "negotiate", "compute checksum")
+	recursiveFlag := cmd.Bool("r", false, "upload a folder recursively")
+	parallelFlag := cmd.Int("j", 4, "number of parallel transfers when uploading a folder")
 	cmd.Action = func() error {
 		ctx := getAuthContext()
 
 		if cmd.NArg() < 2 {
-			fmt.Println(cmd.Usage())
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 
 		fn := cmd.Args()[0]
 		target := cmd.Args()[1]
 
+		if *recursiveFlag {
+			client, err := getClient()
+			if err != nil {
+				return err
+			}
+			return uploadDir(ctx, client, fn, target, *parallelFlag)
+		}
+
 		fd, err := os.Open(fn)
 		if err != nil {
 			return err
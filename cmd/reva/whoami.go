@@ -20,10 +20,10 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/pkg/errors"
 )
 
 func whoamiCommand() *command {
@@ -33,8 +33,7 @@ func whoamiCommand() *command {
 
 	cmd.Action = func() error {
 		if cmd.NArg() != 0 {
-			cmd.PrintDefaults()
-			os.Exit(1)
+			return errors.New(cmd.Usage())
 		}
 		var token string
 		if *tokenFlag != "" {
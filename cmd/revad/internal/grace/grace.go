@@ -19,6 +19,7 @@
 package grace
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -44,8 +45,24 @@ type Watcher struct {
 	ss        map[string]Server
 	pidFile   string
 	childPIDs []int
+	reload    func() error
+	// drainTimeout is the time given to the requests and streams in
+	// flight to end on a graceful shutdown.
+	drainTimeout time.Duration
+	// flushers are called on exit, once the servers stopped.
+	flushers []func(context.Context) error
 }
 
+// defaultDrainTimeout is the drain timeout when none is configured.
+const defaultDrainTimeout = 10 * time.Second
+
+// flushTimeout is the time the flushers are given on exit.
+const flushTimeout = 5 * time.Second
+
+// abortTimeout is the time the servers are given to abort what is still in
+// flight once the drain timeout is reached.
+const abortTimeout = 10 * time.Second
+
 // Option represent an option.
 type Option func(w *Watcher)
 
@@ -63,6 +80,30 @@ func WithPIDFile(fn string) Option {
 	}
 }
 
+// WithReloader sets the function called on SIGHUP to reload the configuration
+// in place. Without it a child process is forked instead.
+func WithReloader(fn func() error) Option {
+	return func(w *Watcher) {
+		w.reload = fn
+	}
+}
+
+// WithDrainTimeout sets the time given to the requests and streams in flight
+// to end on a graceful shutdown, before they are aborted.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(w *Watcher) {
+		w.drainTimeout = d
+	}
+}
+
+// WithFlusher adds a function called on exit, once the servers stopped, to
+// flush what is still buffered, like the spans of the traces.
+func WithFlusher(fn func(context.Context) error) Option {
+	return func(w *Watcher) {
+		w.flushers = append(w.flushers, fn)
+	}
+}
+
 // NewWatcher creates a Watcher.
 func NewWatcher(opts ...Option) *Watcher {
 	w := &Watcher{
@@ -76,12 +117,17 @@ func NewWatcher(opts ...Option) *Watcher {
 		opt(w)
 	}
 
+	if w.drainTimeout <= 0 {
+		w.drainTimeout = defaultDrainTimeout
+	}
+
 	return w
 }
 
 // Exit exists the current process cleaning up
 // exisiting pid files.
 func (w *Watcher) Exit(errc int) {
+	w.flush()
 	err := w.clean()
 	if err != nil {
 		w.log.Warn().Err(err).Msg("error removing pid file")
@@ -91,6 +137,16 @@ func (w *Watcher) Exit(errc int) {
 	os.Exit(errc)
 }
 
+func (w *Watcher) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	for _, fn := range w.flushers {
+		if err := fn(ctx); err != nil {
+			w.log.Warn().Err(err).Msg("error flushing on exit")
+		}
+	}
+}
+
 func (w *Watcher) clean() error {
 	// only remove PID file if the PID has been written by us
 	filePID, err := w.readPID()
@@ -224,7 +280,8 @@ func (w *Watcher) GetListeners(servers map[string]Server) (map[string]net.Listen
 			err = errors.Wrap(err, "error finding parent process")
 			return nil, err
 		}
-		err = p.Kill()
+		// the parent drains the requests it is serving before exiting
+		err = p.Signal(syscall.SIGQUIT)
 		if err != nil {
 			w.log.Error().Err(err).Msgf("error killing parent process with ppid:%d", w.ppid)
 			err = errors.Wrap(err, "error killing parent process")
@@ -257,16 +314,30 @@ type Server interface {
 	Address() string
 }
 
-// TrapSignals captures the OS signal.
+// TrapSignals captures the OS signal. SIGQUIT and SIGTERM, sent by systemd to
+// stop a service, shut the servers down gracefully, SIGINT aborts all the
+// connections at once.
 func (w *Watcher) TrapSignals() {
 	signalCh := make(chan os.Signal, 1024)
-	signal.Notify(signalCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT)
+	signal.Notify(signalCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 	for {
 		s := <-signalCh
 		w.log.Info().Msgf("%v signal received", s)
 
 		switch s {
 		case syscall.SIGHUP:
+			if w.reload != nil {
+				w.log.Info().Msg("reloading configuration...")
+				w.notify("RELOADING=1")
+				if err := w.reload(); err != nil {
+					w.log.Error().Err(err).Msg("error reloading configuration, previous configuration is still in use")
+				} else {
+					w.log.Info().Msg("configuration reloaded")
+				}
+				w.notify("READY=1")
+				continue
+			}
+
 			w.log.Info().Msg("preparing for a hot-reload, forking child process...")
 
 			// Fork a child process.
@@ -279,51 +350,82 @@ func (w *Watcher) TrapSignals() {
 				w.childPIDs = append(w.childPIDs, p.Pid)
 			}
 
-		case syscall.SIGQUIT:
-			w.log.Info().Msg("preparing for a graceful shutdown with deadline of 10 seconds")
-			go func() {
-				count := 10
-				for range time.Tick(time.Second) {
-					w.log.Info().Msgf("shuting down in %d seconds", count-1)
-					count--
-					if count <= 0 {
-						w.log.Info().Msg("deadline reached before draining active conns, hard stoping ...")
-						for _, s := range w.ss {
-							err := s.Stop()
-							if err != nil {
-								w.log.Error().Err(err).Msg("error stoping server")
-							}
-							w.log.Info().Msgf("fd to %s:%s abruptly closed", s.Network(), s.Address())
-						}
-						w.Exit(1)
-					}
-				}
-			}()
-			for _, s := range w.ss {
-				w.log.Info().Msgf("fd to %s:%s gracefully closed ", s.Network(), s.Address())
-				err := s.GracefulStop()
-				if err != nil {
-					w.log.Error().Err(err).Msg("error stoping server")
-					w.log.Info().Msg("exit with error code 1")
-					w.Exit(1)
-				}
-			}
-			w.log.Info().Msg("exit with error code 0")
-			w.Exit(0)
-		case syscall.SIGINT, syscall.SIGTERM:
+		case syscall.SIGQUIT, syscall.SIGTERM:
+			w.shutdown()
+		case syscall.SIGINT:
 			w.log.Info().Msg("preparing for hard shutdown, aborting all conns")
-			for _, s := range w.ss {
-				w.log.Info().Msgf("fd to %s:%s abruptly closed", s.Network(), s.Address())
-				err := s.Stop()
-				if err != nil {
-					w.log.Error().Err(err).Msg("error stoping server")
-				}
-			}
+			w.stop()
 			w.Exit(0)
 		}
 	}
 }
 
+// shutdown stops the servers from accepting connections and waits for the
+// requests and streams in flight to end. The ones still running after the
+// drain timeout are aborted.
+func (w *Watcher) shutdown() {
+	w.log.Info().Msgf("preparing for a graceful shutdown with deadline of %s", w.drainTimeout)
+	// a forked child has taken over the service otherwise
+	if len(w.childPIDs) == 0 {
+		w.notify(fmt.Sprintf("STOPPING=1\nEXTEND_TIMEOUT_USEC=%d", (w.drainTimeout+abortTimeout)/time.Microsecond))
+	}
+
+	done := make(chan error, len(w.ss))
+	for _, s := range w.ss {
+		go func(s Server) {
+			err := s.GracefulStop()
+			if err == nil {
+				w.log.Info().Msgf("fd to %s:%s gracefully closed", s.Network(), s.Address())
+			}
+			done <- err
+		}(s)
+	}
+
+	deadline := time.After(w.drainTimeout)
+	code := 0
+	for range w.ss {
+		select {
+		case err := <-done:
+			if err != nil {
+				w.log.Error().Err(err).Msg("error stoping server")
+				code = 1
+			}
+		case <-deadline:
+			w.log.Info().Msg("deadline reached before draining active conns, hard stoping ...")
+			w.stop()
+			w.Exit(1)
+		}
+	}
+	w.log.Info().Msgf("exit with error code %d", code)
+	w.Exit(code)
+}
+
+// stop aborts the connections of all the servers.
+func (w *Watcher) stop() {
+	for _, s := range w.ss {
+		if err := s.Stop(); err != nil {
+			w.log.Error().Err(err).Msg("error stoping server")
+		}
+		w.log.Info().Msgf("fd to %s:%s abruptly closed", s.Network(), s.Address())
+	}
+}
+
+// Ready tells the service manager that the servers accept connections. The
+// child forked for a hot reload becomes the main process of the service.
+func (w *Watcher) Ready() {
+	state := "READY=1"
+	if w.graceful {
+		state = fmt.Sprintf("MAINPID=%d\n%s", os.Getpid(), state)
+	}
+	w.notify(state)
+}
+
+func (w *Watcher) notify(state string) {
+	if err := notify(state); err != nil {
+		w.log.Warn().Err(err).Msg("error notifying the service manager")
+	}
+}
+
 func getListenerFile(ln net.Listener) (*os.File, error) {
 	switch t := ln.(type) {
 	case *net.TCPListener:
@@ -52,7 +52,7 @@ func main() {
 	handleVersionFlag()
 	handleSignalFlag()
 
-	confs, err := getConfigs()
+	files, confs, err := getConfigs()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error reading the configuration file(s): %s\n", err.Error())
 		os.Exit(1)
@@ -71,7 +71,7 @@ func main() {
 		os.Exit(0)
 	}
 
-	runConfigs(confs)
+	runConfigs(files, confs)
 }
 
 func handleVersionFlag() {
@@ -126,13 +126,13 @@ func handleSignalFlag() {
 	}
 }
 
-func getConfigs() ([]map[string]interface{}, error) {
+func getConfigs() ([]string, []map[string]interface{}, error) {
 	var confs []string
 	// give priority to read from dev-dir
 	if *dirFlag != "" {
 		cfgs, err := getConfigsFromDir(*dirFlag)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		confs = append(confs, cfgs...)
 	} else {
@@ -147,10 +147,10 @@ func getConfigs() ([]map[string]interface{}, error) {
 
 	configs, err := readConfigs(confs)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return configs, nil
+	return confs, configs, nil
 }
 
 func getConfigsFromDir(dir string) (confs []string, err error) {
@@ -188,21 +188,21 @@ func readConfigs(files []string) ([]map[string]interface{}, error) {
 	return confs, nil
 }
 
-func runConfigs(confs []map[string]interface{}) {
+func runConfigs(files []string, confs []map[string]interface{}) {
 	if len(confs) == 1 {
-		runSingle(confs[0])
+		runSingle(files[0], confs[0])
 		return
 	}
 
 	runMultiple(confs)
 }
 
-func runSingle(conf map[string]interface{}) {
+func runSingle(file string, conf map[string]interface{}) {
 	if *pidFlag == "" {
 		*pidFlag = getPidfile()
 	}
 
-	runtime.Run(conf, *pidFlag)
+	runtime.Run(conf, *pidFlag, file)
 }
 
 func getPidfile() string {
@@ -218,7 +218,8 @@ func runMultiple(confs []map[string]interface{}) {
 		wg.Add(1)
 		pidfile := getPidfile()
 		go func(wg *sync.WaitGroup, conf map[string]interface{}) {
-			runtime.Run(conf, pidfile)
+			// configuration reloads are only supported for a single configuration.
+			runtime.Run(conf, pidfile, "")
 			wg.Done()
 		}(&wg, conf)
 	}
@@ -27,13 +27,36 @@ import (
 	_ "github.com/cs3org/reva/internal/http/interceptors/auth/tokenwriter/loader"
 	_ "github.com/cs3org/reva/internal/http/interceptors/loader"
 	_ "github.com/cs3org/reva/internal/http/services/loader"
+	_ "github.com/cs3org/reva/pkg/accounting/manager/loader"
+	_ "github.com/cs3org/reva/pkg/activity/manager/loader"
+	_ "github.com/cs3org/reva/pkg/antivirus/scanner/loader"
+	_ "github.com/cs3org/reva/pkg/appauth/manager/loader"
+	_ "github.com/cs3org/reva/pkg/audit/sink/loader"
 	_ "github.com/cs3org/reva/pkg/auth/manager/loader"
+	_ "github.com/cs3org/reva/pkg/auth/mfa/store/loader"
 	_ "github.com/cs3org/reva/pkg/auth/registry/loader"
+	_ "github.com/cs3org/reva/pkg/auth/throttle/store/loader"
+	_ "github.com/cs3org/reva/pkg/discovery/registry/loader"
+	_ "github.com/cs3org/reva/pkg/events/publisher/loader"
+	_ "github.com/cs3org/reva/pkg/group/manager/loader"
+	_ "github.com/cs3org/reva/pkg/metadata/extractor/loader"
+	_ "github.com/cs3org/reva/pkg/notification/sender/loader"
+	_ "github.com/cs3org/reva/pkg/ocm/invite/manager/loader"
 	_ "github.com/cs3org/reva/pkg/ocm/provider/authorizer/loader"
 	_ "github.com/cs3org/reva/pkg/ocm/share/manager/loader"
+	_ "github.com/cs3org/reva/pkg/postprocessing/step/loader"
+	_ "github.com/cs3org/reva/pkg/preferences/manager/loader"
+	_ "github.com/cs3org/reva/pkg/preview/cache/loader"
 	_ "github.com/cs3org/reva/pkg/publicshare/manager/loader"
+	_ "github.com/cs3org/reva/pkg/search/index/loader"
+	_ "github.com/cs3org/reva/pkg/secrets/loader"
 	_ "github.com/cs3org/reva/pkg/share/manager/loader"
+	_ "github.com/cs3org/reva/pkg/spaces/manager/loader"
+	_ "github.com/cs3org/reva/pkg/storage/chunking/loader"
+	_ "github.com/cs3org/reva/pkg/storage/encryption/keys/loader"
+	_ "github.com/cs3org/reva/pkg/storage/favorite/loader"
 	_ "github.com/cs3org/reva/pkg/storage/fs/loader"
+	_ "github.com/cs3org/reva/pkg/storage/locks/loader"
 	_ "github.com/cs3org/reva/pkg/storage/registry/loader"
 	_ "github.com/cs3org/reva/pkg/token/manager/loader"
 	_ "github.com/cs3org/reva/pkg/user/manager/loader"
@@ -19,58 +19,97 @@
 package runtime
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
-	"contrib.go.opencensus.io/exporter/jaeger"
+	"github.com/cs3org/reva/cmd/revad/internal/config"
 	"github.com/cs3org/reva/cmd/revad/internal/grace"
+	"github.com/cs3org/reva/pkg/discovery"
+	"github.com/cs3org/reva/pkg/discovery/registry/registry"
 	"github.com/cs3org/reva/pkg/logger"
+	"github.com/cs3org/reva/pkg/metrics"
 	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/secrets"
 	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"go.opencensus.io/plugin/ocgrpc"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats/view"
-	"go.opencensus.io/trace"
+	octrace "go.opencensus.io/trace"
 )
 
-// Run runs a reva server with the given config file and pid file.
-func Run(mainConf map[string]interface{}, pidFile string) {
+// Run runs a reva server with the given config and pid file.
+// If confFile is not empty the configuration is read again from it
+// when the process receives a SIGHUP.
+func Run(mainConf map[string]interface{}, pidFile, confFile string) {
+	resolver := resolveSecretsOrDie(mainConf)
 	parseSharedConfOrDie(mainConf["shared"])
 	coreConf := parseCoreConfOrDie(mainConf["core"])
 	logConf := parseLogConfOrDie(mainConf["log"])
 
-	run(mainConf, coreConf, logConf, pidFile)
+	run(mainConf, coreConf, logConf, resolver, pidFile, confFile)
 }
 
 type coreConf struct {
 	MaxCPUs            string `mapstructure:"max_cpus"`
 	TracingEnabled     bool   `mapstructure:"tracing_enabled"`
+	TracingExporter    string `mapstructure:"tracing_exporter"`
 	TracingEndpoint    string `mapstructure:"tracing_endpoint"`
 	TracingCollector   string `mapstructure:"tracing_collector"`
 	TracingServiceName string `mapstructure:"tracing_service_name"`
+	TracingInsecure    bool   `mapstructure:"tracing_insecure"`
+	// GRPCPool configures the pool of the connections to other services.
+	GRPCPool map[string]interface{} `mapstructure:"grpc_pool"`
+	// ServiceRegistry configures the registry the grpc services register
+	// to and the discovery:/// endpoints are resolved with.
+	ServiceRegistry map[string]interface{} `mapstructure:"service_registry"`
+	// DrainTimeout is the time in seconds the requests and streams in
+	// flight are given to end on a graceful shutdown, 10 by default.
+	DrainTimeout int `mapstructure:"drain_timeout"`
 }
 
-func run(mainConf map[string]interface{}, coreConf *coreConf, logConf *logConf, filename string) {
+type serviceRegistryConf struct {
+	Driver  string                            `mapstructure:"driver"`
+	Drivers map[string]map[string]interface{} `mapstructure:"drivers"`
+	// ResolveInterval is the time in seconds between two resolutions of
+	// the addresses of a service.
+	ResolveInterval int `mapstructure:"resolve_interval"`
+}
+
+func run(mainConf map[string]interface{}, coreConf *coreConf, logConf *logConf, resolver *secrets.Resolver, filename, confFile string) {
 	logger := initLogger(logConf)
 
 	host, _ := os.Hostname()
 	logger.Info().Msgf("host info: %s", host)
 
-	initTracing(coreConf, logger)
+	flushTraces := initTracing(coreConf, logger)
 	initCPUCount(coreConf, logger)
+	initGRPCPool(coreConf, logger)
+	initServiceRegistry(coreConf, logger)
 
 	servers := initServers(mainConf, logger)
-	watcher, err := initWatcher(logger, filename)
+	opts := []grace.Option{grace.WithDrainTimeout(time.Duration(coreConf.DrainTimeout) * time.Second)}
+	if flushTraces != nil {
+		opts = append(opts, grace.WithFlusher(flushTraces))
+	}
+	if confFile != "" {
+		opts = append(opts, grace.WithReloader(newReloader(confFile, mainConf, resolver, servers, logger)))
+	}
+	watcher, err := initWatcher(logger, filename, opts...)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -88,8 +127,8 @@ func initListeners(watcher *grace.Watcher, servers map[string]grace.Server, log
 	return listeners
 }
 
-func initWatcher(log *zerolog.Logger, filename string) (*grace.Watcher, error) {
-	watcher, err := handlePIDFlag(log, filename)
+func initWatcher(log *zerolog.Logger, filename string, opts ...grace.Option) (*grace.Watcher, error) {
+	watcher, err := handlePIDFlag(log, filename, opts...)
 	// TODO(labkode): maybe pidfile can be created later on? like once a server is going to be created?
 	if err != nil {
 		log.Error().Err(err).Msg("error creating grace watcher")
@@ -126,11 +165,54 @@ func initServers(mainConf map[string]interface{}, log *zerolog.Logger) map[strin
 	return servers
 }
 
-func initTracing(conf *coreConf, log *zerolog.Logger) {
-	if err := setupOpenCensus(conf); err != nil {
-		log.Error().Err(err).Msg("error configuring open census stats and tracing")
+// initTracing returns the function flushing the buffered spans, nil if the
+// tracing is disabled.
+func initTracing(conf *coreConf, log *zerolog.Logger) func(context.Context) error {
+	if err := setupOpenCensus(); err != nil {
+		log.Error().Err(err).Msg("error configuring open census stats")
 		os.Exit(1)
 	}
+	flush, err := setupOpenTelemetry(conf)
+	if err != nil {
+		log.Error().Err(err).Msg("error configuring open telemetry tracing")
+		os.Exit(1)
+	}
+	return flush
+}
+
+func initGRPCPool(conf *coreConf, log *zerolog.Logger) {
+	if err := pool.Configure(conf.GRPCPool); err != nil {
+		log.Error().Err(err).Msg("error configuring grpc connection pool")
+		os.Exit(1)
+	}
+}
+
+func initServiceRegistry(conf *coreConf, log *zerolog.Logger) {
+	if len(conf.ServiceRegistry) == 0 {
+		return
+	}
+	if err := setupServiceRegistry(conf.ServiceRegistry); err != nil {
+		log.Error().Err(err).Msg("error configuring service registry")
+		os.Exit(1)
+	}
+	log.Info().Msg("service registry configured")
+}
+
+func setupServiceRegistry(m map[string]interface{}) error {
+	c := &serviceRegistryConf{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return errors.Wrap(err, "error decoding service registry config")
+	}
+	f, ok := registry.NewFuncs[c.Driver]
+	if !ok {
+		return fmt.Errorf("driver %s not found for service registry", c.Driver)
+	}
+	r, err := f(c.Drivers[c.Driver])
+	if err != nil {
+		return err
+	}
+	discovery.Init(r, time.Duration(c.ResolveInterval)*time.Second)
+	return nil
 }
 
 func initCPUCount(conf *coreConf, log *zerolog.Logger) {
@@ -152,9 +234,10 @@ func initLogger(conf *logConf) *zerolog.Logger {
 	return log
 }
 
-func handlePIDFlag(l *zerolog.Logger, pidFile string) (*grace.Watcher, error) {
+func handlePIDFlag(l *zerolog.Logger, pidFile string, extra ...grace.Option) (*grace.Watcher, error) {
 	var opts []grace.Option
 	opts = append(opts, grace.WithPIDFile(pidFile))
+	opts = append(opts, extra...)
 	opts = append(opts, grace.WithLogger(l.With().Str("pkg", "grace").Logger()))
 	w := grace.NewWatcher(opts...)
 	err := w.WritePID()
@@ -182,9 +265,67 @@ func start(mainConf map[string]interface{}, servers map[string]grace.Server, lis
 			}
 		}()
 	}
+	watcher.Ready()
 	watcher.TrapSignals()
 }
 
+// reloadable is implemented by the servers that can apply
+// a new configuration without being restarted.
+type reloadable interface {
+	Reload(conf interface{}) error
+}
+
+// newReloader returns the function run on SIGHUP. It reads the
+// configuration file again and reloads the servers whose section
+// changed; the other servers are left untouched.
+func newReloader(confFile string, mainConf map[string]interface{}, resolver *secrets.Resolver, servers map[string]grace.Server, log *zerolog.Logger) func() error {
+	current := mainConf
+	return func() error {
+		fd, err := os.Open(confFile)
+		if err != nil {
+			return errors.Wrap(err, "error opening config file")
+		}
+		defer fd.Close()
+
+		newConf, err := config.Read(fd)
+		if err != nil {
+			return errors.Wrap(err, "error reading config file")
+		}
+		// the secrets are fetched again, rotated ones are picked up by the
+		// reloaded servers
+		if err := resolver.Resolve(context.Background(), newConf); err != nil {
+			return errors.Wrap(err, "error resolving secrets")
+		}
+
+		for _, k := range []string{"core", "log", "shared", "secrets"} {
+			if !reflect.DeepEqual(current[k], newConf[k]) {
+				log.Warn().Msgf("changes to the %s section require a restart and have been ignored", k)
+			}
+		}
+
+		for _, k := range []string{"http", "grpc"} {
+			if isEnabled(k, current) != isEnabled(k, newConf) {
+				log.Warn().Msgf("enabling or disabling the %s server requires a restart, ignoring it", k)
+				continue
+			}
+			if reflect.DeepEqual(current[k], newConf[k]) {
+				log.Info().Msgf("%s config unchanged", k)
+				continue
+			}
+			s, ok := servers[k].(reloadable)
+			if !ok {
+				continue
+			}
+			if err := s.Reload(newConf[k]); err != nil {
+				return errors.Wrapf(err, "error reloading %s server", k)
+			}
+			log.Info().Msgf("%s server reloaded", k)
+			current[k] = newConf[k]
+		}
+		return nil
+	}
+}
+
 func newLogger(conf *logConf) (*zerolog.Logger, error) {
 	// TODO(labkode): use debug level rather than info as default until reaching a stable version.
 	// Helps having smaller development files.
@@ -245,7 +386,9 @@ func getHTTPServer(conf interface{}, l *zerolog.Logger) (*rhttp.Server, error) {
 	return s, nil
 }
 
-func setupOpenCensus(conf *coreConf) error {
+// setupOpenCensus registers the metric views, opencensus is only used for
+// the metrics, the traces are recorded with opentelemetry.
+func setupOpenCensus() error {
 	if err := view.Register(ochttp.DefaultServerViews...); err != nil {
 		return err
 	}
@@ -254,15 +397,33 @@ func setupOpenCensus(conf *coreConf) error {
 		return err
 	}
 
+	if err := view.Register(metrics.DefaultViews...); err != nil {
+		return err
+	}
+
+	octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.NeverSample()})
+	return nil
+}
+
+func setupOpenTelemetry(conf *coreConf) (func(context.Context) error, error) {
 	if !conf.TracingEnabled {
-		return nil
+		return nil, nil
+	}
+
+	if conf.TracingExporter == "" {
+		conf.TracingExporter = "jaeger"
 	}
 
 	if conf.TracingEndpoint == "" {
-		conf.TracingEndpoint = "localhost:6831"
+		switch conf.TracingExporter {
+		case "otlp":
+			conf.TracingEndpoint = "localhost:4318"
+		default:
+			conf.TracingEndpoint = "localhost:6831"
+		}
 	}
 
-	if conf.TracingCollector == "" {
+	if conf.TracingCollector == "" && conf.TracingExporter == "jaeger" {
 		conf.TracingCollector = "http://localhost:14268/api/traces"
 	}
 
@@ -270,20 +431,13 @@ func setupOpenCensus(conf *coreConf) error {
 		conf.TracingServiceName = "revad"
 	}
 
-	je, err := jaeger.NewExporter(jaeger.Options{
-		AgentEndpoint:     conf.TracingEndpoint,
-		CollectorEndpoint: conf.TracingCollector,
-		ServiceName:       conf.TracingServiceName,
+	return trace.Init(&trace.Options{
+		Exporter:    conf.TracingExporter,
+		ServiceName: conf.TracingServiceName,
+		Endpoint:    conf.TracingEndpoint,
+		Collector:   conf.TracingCollector,
+		Insecure:    conf.TracingInsecure,
 	})
-
-	if err != nil {
-		return err
-	}
-
-	// register it as a trace exporter
-	trace.RegisterExporter(je)
-	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
-	return nil
 }
 
 //  adjustCPU parses string cpu and sets GOMAXPROCS
@@ -335,6 +489,22 @@ func parseCoreConfOrDie(v interface{}) *coreConf {
 	return c
 }
 
+// resolveSecretsOrDie replaces the references to secrets in the
+// configuration with the secrets of the stores of the secrets section.
+func resolveSecretsOrDie(mainConf map[string]interface{}) *secrets.Resolver {
+	m, _ := mainConf["secrets"].(map[string]interface{})
+	resolver, err := secrets.New(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating secret stores: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if err := resolver.Resolve(context.Background(), mainConf); err != nil {
+		fmt.Fprintf(os.Stderr, "error resolving secrets: %s\n", err.Error())
+		os.Exit(1)
+	}
+	return resolver
+}
+
 func parseSharedConfOrDie(v interface{}) {
 	if err := sharedconf.Decode(v); err != nil {
 		fmt.Fprintf(os.Stderr, "error decoding shared config: %s\n", err.Error())
@@ -22,16 +22,15 @@ import (
 	"context"
 
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/rs/zerolog"
-	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
 )
 
 // NewUnary returns a new unary interceptor that creates the application context.
 func NewUnary(log zerolog.Logger) grpc.UnaryServerInterceptor {
 	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		span := trace.FromContext(ctx)
-		sub := log.With().Str("traceid", span.SpanContext().TraceID.String()).Logger()
+		sub := log.With().Str("traceid", trace.GetTraceID(ctx)).Logger()
 		ctx = appctx.WithLogger(ctx, &sub)
 		res, err := handler(ctx, req)
 		return res, err
@@ -43,8 +42,7 @@ func NewUnary(log zerolog.Logger) grpc.UnaryServerInterceptor {
 // that creates the application context.
 func NewStream(log zerolog.Logger) grpc.StreamServerInterceptor {
 	interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		span := trace.FromContext(ss.Context())
-		sub := log.With().Str("traceid", span.SpanContext().TraceID.String()).Logger()
+		sub := log.With().Str("traceid", trace.GetTraceID(ss.Context())).Logger()
 		ctx := appctx.WithLogger(ss.Context(), &sub)
 		wrapped := newWrappedServerStream(ctx, ss)
 		err := handler(srv, wrapped)
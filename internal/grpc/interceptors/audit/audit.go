@@ -0,0 +1,214 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/audit"
+	"github.com/cs3org/reva/pkg/audit/sink/registry"
+	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// the audit log wraps the other interceptors to record their rejections too
+	defaultPriority = 100
+)
+
+func init() {
+	rgrpc.RegisterUnaryInterceptor("audit", NewUnary)
+	rgrpc.RegisterStreamInterceptor("audit", NewStream)
+}
+
+type config struct {
+	Priority int                               `mapstructure:"priority"`
+	Sink     string                            `mapstructure:"sink"`
+	Sinks    map[string]map[string]interface{} `mapstructure:"sinks"`
+	// RedactFields are the record fields left out, among user, idp, resource and client_ip.
+	RedactFields []string `mapstructure:"redact_fields"`
+}
+
+func newLogger(m map[string]interface{}) (*audit.Logger, int, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, 0, errors.Wrap(err, "audit: error decoding conf")
+	}
+	if conf.Priority == 0 {
+		conf.Priority = defaultPriority
+	}
+	if conf.Sink == "" {
+		conf.Sink = "file"
+	}
+
+	f, ok := registry.NewFuncs[conf.Sink]
+	if !ok {
+		return nil, 0, fmt.Errorf("audit: sink not found: %s", conf.Sink)
+	}
+	sink, err := f(conf.Sinks[conf.Sink])
+	if err != nil {
+		return nil, 0, err
+	}
+	return audit.NewLogger(sink, conf.RedactFields, nil), conf.Priority, nil
+}
+
+// NewUnary returns a new unary interceptor recording the calls in the audit log.
+func NewUnary(m map[string]interface{}) (grpc.UnaryServerInterceptor, int, error) {
+	logger, prio, err := newLogger(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		res, err := handler(ctx, req)
+		rec := newRecord(ctx, info.FullMethod, req)
+		setOutcome(rec, res, err)
+		if err := logger.Log(rec); err != nil {
+			appctx.GetLogger(ctx).Error().Err(err).Msg("audit: error writing audit record")
+		}
+		return res, err
+	}
+	return interceptor, prio, nil
+}
+
+// NewStream returns a new server stream interceptor recording the calls in the audit log.
+func NewStream(m map[string]interface{}) (grpc.StreamServerInterceptor, int, error) {
+	logger, prio, err := newLogger(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		rec := newRecord(ss.Context(), info.FullMethod, nil)
+		setOutcome(rec, nil, err)
+		if err := logger.Log(rec); err != nil {
+			appctx.GetLogger(ss.Context()).Error().Err(err).Msg("audit: error writing audit record")
+		}
+		return err
+	}
+	return interceptor, prio, nil
+}
+
+func newRecord(ctx context.Context, method string, req interface{}) *audit.Record {
+	rec := &audit.Record{
+		Time:     time.Now().UTC(),
+		Protocol: "grpc",
+		Action:   method,
+		Resource: resource(req),
+	}
+	if u, ok := user.ContextGetUser(ctx); ok {
+		rec.User = u.Username
+		rec.Idp = u.Id.GetIdp()
+		if by := user.Impersonator(u); by != nil {
+			rec.Impersonator = by.Username
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		rec.ClientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(rec.ClientIP); err == nil {
+			rec.ClientIP = host
+		}
+	}
+	return rec
+}
+
+// setOutcome sets the outcome from the grpc error or, as the CS3 services
+// report their errors in the response, from the CS3 status.
+func setOutcome(rec *audit.Record, res interface{}, err error) {
+	if err != nil {
+		code := status.Code(err)
+		rec.Status = code.String()
+		rec.Outcome = audit.OutcomeFailure
+		if code == codes.PermissionDenied || code == codes.Unauthenticated {
+			rec.Outcome = audit.OutcomeDenied
+		}
+		return
+	}
+
+	code := rpc.Code_CODE_OK
+	if r, ok := res.(interface{ GetStatus() *rpc.Status }); ok && r.GetStatus() != nil {
+		code = r.GetStatus().Code
+	}
+	rec.Status = code.String()
+	switch code {
+	case rpc.Code_CODE_OK:
+		rec.Outcome = audit.OutcomeSuccess
+	case rpc.Code_CODE_PERMISSION_DENIED, rpc.Code_CODE_UNAUTHENTICATED:
+		rec.Outcome = audit.OutcomeDenied
+	default:
+		rec.Outcome = audit.OutcomeFailure
+	}
+}
+
+// The requests carrying the references of the resources they act on.
+type (
+	refRequest    interface{ GetRef() *provider.Reference }
+	sourceRequest interface{ GetSource() *provider.Reference }
+	shareRequest  interface {
+		GetRef() *collaboration.ShareReference
+	}
+	publicRequest interface {
+		GetRef() *link.PublicShareReference
+	}
+	resourceRequest interface{ GetResourceInfo() *provider.ResourceInfo }
+)
+
+// resource describes the resource a request acts on, if it has a known reference.
+func resource(req interface{}) string {
+	switch r := req.(type) {
+	case refRequest:
+		return reference(r.GetRef())
+	case sourceRequest:
+		return reference(r.GetSource())
+	case shareRequest:
+		if id := r.GetRef().GetId(); id != nil {
+			return "share:" + id.OpaqueId
+		}
+	case publicRequest:
+		if id := r.GetRef().GetId(); id != nil {
+			return "publicshare:" + id.OpaqueId
+		}
+	case resourceRequest:
+		return r.GetResourceInfo().GetPath()
+	}
+	return ""
+}
+
+func reference(ref *provider.Reference) string {
+	if p := ref.GetPath(); p != "" {
+		return p
+	}
+	if id := ref.GetId(); id != nil {
+		return id.StorageId + ":" + id.OpaqueId
+	}
+	return ""
+}
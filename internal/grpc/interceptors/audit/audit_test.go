@@ -0,0 +1,70 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package audit
+
+import (
+	"testing"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/audit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestResource(t *testing.T) {
+	tests := []struct {
+		req      interface{}
+		expected string
+	}{
+		{&provider.StatRequest{Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: "/home/file.txt"}}}, "/home/file.txt"},
+		{&provider.DeleteRequest{Ref: &provider.Reference{Spec: &provider.Reference_Id{Id: &provider.ResourceId{StorageId: "s", OpaqueId: "o"}}}}, "s:o"},
+		{&provider.MoveRequest{Source: &provider.Reference{Spec: &provider.Reference_Path{Path: "/home/a"}}}, "/home/a"},
+		{&collaboration.RemoveShareRequest{Ref: &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: &collaboration.ShareId{OpaqueId: "1"}}}}, "share:1"},
+		{&provider.GetHomeRequest{}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := resource(tt.req); got != tt.expected {
+			t.Errorf("resource(%T): got %q, expected %q", tt.req, got, tt.expected)
+		}
+	}
+}
+
+func TestSetOutcome(t *testing.T) {
+	tests := []struct {
+		res      interface{}
+		err      error
+		expected string
+	}{
+		{&provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil, audit.OutcomeSuccess},
+		{&provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_PERMISSION_DENIED}}, nil, audit.OutcomeDenied},
+		{&provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_NOT_FOUND}}, nil, audit.OutcomeFailure},
+		{nil, status.Error(codes.Unauthenticated, "no token"), audit.OutcomeDenied},
+	}
+
+	for _, tt := range tests {
+		rec := &audit.Record{}
+		setOutcome(rec, tt.res, tt.err)
+		if rec.Outcome != tt.expected {
+			t.Errorf("got outcome %s for %v, expected %s", rec.Outcome, rec.Status, tt.expected)
+		}
+	}
+}
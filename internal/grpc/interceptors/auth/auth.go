@@ -24,13 +24,15 @@ import (
 
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/scope"
 	"github.com/cs3org/reva/pkg/token"
 	tokenmgr "github.com/cs3org/reva/pkg/token/manager/registry"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/cs3org/reva/pkg/user"
 	"github.com/cs3org/reva/pkg/utils"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
-	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -81,12 +83,12 @@ func NewUnary(m map[string]interface{}, unprotected []string) (grpc.UnaryServerI
 		log := appctx.GetLogger(ctx)
 
 		if utils.Skip(info.FullMethod, unprotected) {
-			span.AddAttributes(trace.BoolAttribute("auth_enabled", false))
+			span.SetAttributes(attribute.Bool("auth_enabled", false))
 			log.Debug().Str("method", info.FullMethod).Msg("skipping auth")
 			return handler(ctx, req)
 		}
 
-		span.AddAttributes(trace.BoolAttribute("auth_enabled", true))
+		span.SetAttributes(attribute.Bool("auth_enabled", true))
 
 		tkn, ok := token.ContextGetToken(ctx)
 
@@ -102,13 +104,21 @@ func NewUnary(m map[string]interface{}, unprotected []string) (grpc.UnaryServerI
 			return nil, status.Errorf(codes.Unauthenticated, "auth: core access token is invalid")
 		}
 
+		if sc := scope.Get(u); !scope.AllowsMethod(sc, info.FullMethod) {
+			log.Warn().Str("method", info.FullMethod).Str("scope", sc).Msg("method not allowed with the scope of the token")
+			return nil, status.Errorf(codes.PermissionDenied, "auth: method not allowed with a %s token", sc)
+		}
+
+		if !scope.AllowsRequest(u, req) {
+			log.Warn().Str("method", info.FullMethod).Msg("request on a resource the token is not limited to")
+			return nil, status.Errorf(codes.PermissionDenied, "auth: token limited to another resource")
+		}
+
 		// store user and core access token in context.
-		span.AddAttributes(
-			trace.StringAttribute("id.idp", u.Id.Idp),
-			trace.StringAttribute("id.opaque_id", u.Id.OpaqueId),
-			trace.StringAttribute("username", u.Username),
-			trace.StringAttribute("token", tkn))
-		span.AddAttributes(trace.StringAttribute("user", u.String()), trace.StringAttribute("token", tkn))
+		span.SetAttributes(
+			attribute.String("id.idp", u.Id.Idp),
+			attribute.String("id.opaque_id", u.Id.OpaqueId),
+			attribute.String("username", u.Username))
 
 		ctx = user.ContextSetUser(ctx, u)
 		ctx = token.ContextSetToken(ctx, tkn)
@@ -168,6 +178,17 @@ func NewStream(m map[string]interface{}, unprotected []string) (grpc.StreamServe
 			return status.Errorf(codes.Unauthenticated, "auth: claims are invalid")
 		}
 
+		if sc := scope.Get(u); !scope.AllowsMethod(sc, info.FullMethod) {
+			log.Warn().Str("method", info.FullMethod).Str("scope", sc).Msg("method not allowed with the scope of the token")
+			return status.Errorf(codes.PermissionDenied, "auth: method not allowed with a %s token", sc)
+		}
+
+		// the requests of a stream cannot be checked against the resource
+		if scope.Resource(u) != nil {
+			log.Warn().Str("method", info.FullMethod).Msg("stream not allowed with a token limited to a resource")
+			return status.Errorf(codes.PermissionDenied, "auth: stream not allowed with a token limited to a resource")
+		}
+
 		// store user and core access token in context.
 		ctx = user.ContextSetUser(ctx, u)
 		ctx = token.ContextSetToken(ctx, tkn)
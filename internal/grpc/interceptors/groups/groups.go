@@ -0,0 +1,126 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package groups
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cs3org/reva/pkg/group/resolver"
+	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const (
+	// the groups are resolved once the callers are authenticated, before
+	// the policies are evaluated against them
+	defaultPriority = 200
+)
+
+// the calls resolving the groups themselves
+var skipped = map[string]bool{
+	"/cs3.gateway.v1beta1.GatewayAPI/GetUserGroups":    true,
+	"/cs3.identity.user.v1beta1.UserAPI/GetUserGroups": true,
+}
+
+func init() {
+	rgrpc.RegisterUnaryInterceptor("groups", NewUnary)
+	rgrpc.RegisterStreamInterceptor("groups", NewStream)
+}
+
+type config struct {
+	Priority        int `mapstructure:"priority"`
+	resolver.Config `mapstructure:",squash"`
+}
+
+var (
+	mu sync.Mutex
+	// resolvers are shared by the unary and stream interceptors and kept
+	// across reloads, so that they keep a single cache and subscription.
+	resolvers = map[string]*resolver.Resolver{}
+)
+
+func getResolver(m map[string]interface{}) (*resolver.Resolver, int, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, 0, errors.Wrap(err, "groups: error decoding conf")
+	}
+	if conf.Priority == 0 {
+		conf.Priority = defaultPriority
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	k := fmt.Sprintf("%+v", conf.Config)
+	if r, ok := resolvers[k]; ok {
+		return r, conf.Priority, nil
+	}
+	r, err := resolver.New(&conf.Config)
+	if err != nil {
+		return nil, 0, err
+	}
+	resolvers[k] = r
+	return r, conf.Priority, nil
+}
+
+// NewUnary returns a new unary interceptor that sets the current groups of
+// the user in the context.
+func NewUnary(m map[string]interface{}) (grpc.UnaryServerInterceptor, int, error) {
+	r, prio, err := getResolver(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !skipped[info.FullMethod] {
+			ctx = r.ContextWithGroups(ctx)
+		}
+		return handler(ctx, req)
+	}
+	return interceptor, prio, nil
+}
+
+// NewStream returns a new server stream interceptor that sets the current
+// groups of the user in the context.
+func NewStream(m map[string]interface{}) (grpc.StreamServerInterceptor, int, error) {
+	r, prio, err := getResolver(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := r.ContextWithGroups(ss.Context())
+		return handler(srv, newWrappedServerStream(ctx, ss))
+	}
+	return interceptor, prio, nil
+}
+
+func newWrappedServerStream(ctx context.Context, ss grpc.ServerStream) *wrappedServerStream {
+	return &wrappedServerStream{ServerStream: ss, newCtx: ctx}
+}
+
+type wrappedServerStream struct {
+	grpc.ServerStream
+	newCtx context.Context
+}
+
+func (ss *wrappedServerStream) Context() context.Context {
+	return ss.newCtx
+}
@@ -0,0 +1,176 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package maintenance implements an interceptor putting the services of the
+// server, like a storage provider or the gateway, in read-only or maintenance
+// mode. The mode is changed at runtime by reloading the configuration.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/maintenance"
+	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+const (
+	defaultPriority = 250
+)
+
+func init() {
+	rgrpc.RegisterUnaryInterceptor("maintenance", NewUnary)
+	rgrpc.RegisterStreamInterceptor("maintenance", NewStream)
+}
+
+type config struct {
+	Priority int `mapstructure:"priority"`
+	// Mode is read_only, maintenance or empty to serve all the calls.
+	Mode string `mapstructure:"mode"`
+	// APIs are the full names of the gRPC services put in the mode, like
+	// cs3.storage.provider.v1beta1.ProviderAPI. All the CS3 APIs when empty.
+	APIs []string `mapstructure:"apis"`
+	// ReadMethods are the prefixes of the names of the methods still
+	// served in read-only mode.
+	ReadMethods []string `mapstructure:"read_methods"`
+	// RetryAfter is the number of seconds after which the clients are told
+	// to retry.
+	RetryAfter int    `mapstructure:"retry_after"`
+	Message    string `mapstructure:"message"`
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "maintenance: error decoding conf")
+	}
+	if c.Priority == 0 {
+		c.Priority = defaultPriority
+	}
+	if c.Mode != "" && c.Mode != maintenance.ModeReadOnly && c.Mode != maintenance.ModeMaintenance {
+		return nil, fmt.Errorf("maintenance: unknown mode %q", c.Mode)
+	}
+	if len(c.ReadMethods) == 0 {
+		c.ReadMethods = maintenance.DefaultReadMethods
+	}
+	if c.RetryAfter == 0 {
+		c.RetryAfter = 300
+	}
+	if c.Message == "" {
+		if c.Mode == maintenance.ModeReadOnly {
+			c.Message = "the service is read-only for maintenance"
+		} else {
+			c.Message = "the service is under maintenance"
+		}
+	}
+	return c, nil
+}
+
+// refused tells if the call is refused, fullMethod being /<service>/<method>.
+func (c *config) refused(fullMethod string) bool {
+	api, method := splitMethod(fullMethod)
+	if len(c.APIs) == 0 {
+		if !strings.HasPrefix(api, "cs3.") {
+			return false
+		}
+	} else if !contains(c.APIs, api) {
+		return false
+	}
+	return maintenance.Refused(c.Mode, method, c.ReadMethods)
+}
+
+// refusal returns the response of the method of the service telling the call
+// is refused, built from the signature of the method as the CS3 responses
+// carry their status. A gRPC error is returned for the other services.
+func (c *config) refusal(ctx context.Context, srv interface{}, fullMethod string) (interface{}, error) {
+	_, method := splitMethod(fullMethod)
+	m := reflect.ValueOf(srv).MethodByName(method)
+	if !m.IsValid() || m.Type().NumOut() != 2 || m.Type().Out(0).Kind() != reflect.Ptr || m.Type().Out(0).Elem().Kind() != reflect.Struct {
+		return nil, grpcstatus.Error(codes.Unavailable, c.Message)
+	}
+	res := reflect.New(m.Type().Out(0).Elem())
+	st := res.Elem().FieldByName("Status")
+	if !st.IsValid() || st.Type() != reflect.TypeOf(&rpc.Status{}) {
+		return nil, grpcstatus.Error(codes.Unavailable, c.Message)
+	}
+	st.Set(reflect.ValueOf(status.NewUnavailable(ctx, c.Message)))
+	if o := res.Elem().FieldByName("Opaque"); o.IsValid() && o.Type() == reflect.TypeOf(&typespb.Opaque{}) {
+		o.Set(reflect.ValueOf(maintenance.RetryAfterToOpaque(c.RetryAfter)))
+	}
+	return res.Interface(), nil
+}
+
+func splitMethod(fullMethod string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(fullMethod, "/"), "/", 2)
+	if len(parts) != 2 {
+		return "", fullMethod
+	}
+	return parts[0], parts[1]
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewUnary returns a new unary interceptor refusing the calls
+// not allowed in the configured mode.
+func NewUnary(m map[string]interface{}) (grpc.UnaryServerInterceptor, int, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if c.refused(info.FullMethod) {
+			return c.refusal(ctx, info.Server, info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+	return interceptor, c.Priority, nil
+}
+
+// NewStream returns a new server stream interceptor refusing the calls
+// not allowed in the configured mode. The streams carry no status, so they
+// are refused with a gRPC error.
+func NewStream(m map[string]interface{}) (grpc.StreamServerInterceptor, int, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if c.refused(info.FullMethod) {
+			return grpcstatus.Error(codes.Unavailable, c.Message)
+		}
+		return handler(srv, ss)
+	}
+	return interceptor, c.Priority, nil
+}
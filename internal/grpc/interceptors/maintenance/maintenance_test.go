@@ -0,0 +1,109 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package maintenance
+
+import (
+	"context"
+	"testing"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/maintenance"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+type server struct{}
+
+func (s *server) Move(ctx context.Context, req *provider.MoveRequest) (*provider.MoveResponse, error) {
+	return &provider.MoveResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil
+}
+
+func (s *server) Stat(ctx context.Context, req *provider.StatRequest) (*provider.StatResponse, error) {
+	return &provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil
+}
+
+func call(t *testing.T, conf map[string]interface{}, fullMethod string) (interface{}, error) {
+	interceptor, _, err := NewUnary(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &grpc.UnaryServerInfo{Server: &server{}, FullMethod: fullMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if fullMethod == "/cs3.storage.provider.v1beta1.ProviderAPI/Stat" {
+			return (&server{}).Stat(ctx, nil)
+		}
+		return (&server{}).Move(ctx, nil)
+	}
+	return interceptor(context.Background(), nil, info, handler)
+}
+
+func TestUnary(t *testing.T) {
+	const (
+		move = "/cs3.storage.provider.v1beta1.ProviderAPI/Move"
+		stat = "/cs3.storage.provider.v1beta1.ProviderAPI/Stat"
+	)
+	tests := []struct {
+		name    string
+		conf    map[string]interface{}
+		method  string
+		refused bool
+	}{
+		{"no mode", map[string]interface{}{}, move, false},
+		{"read-only write", map[string]interface{}{"mode": "read_only"}, move, true},
+		{"read-only read", map[string]interface{}{"mode": "read_only"}, stat, false},
+		{"maintenance read", map[string]interface{}{"mode": "maintenance"}, stat, true},
+		{"other api", map[string]interface{}{"mode": "maintenance", "apis": []string{"cs3.gateway.v1beta1.GatewayAPI"}}, stat, false},
+	}
+	for _, tt := range tests {
+		res, err := call(t, tt.conf, tt.method)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var st *rpc.Status
+		var secs int
+		switch r := res.(type) {
+		case *provider.MoveResponse:
+			st, secs = r.Status, maintenance.RetryAfterFromOpaque(r.Opaque)
+		case *provider.StatResponse:
+			st, secs = r.Status, maintenance.RetryAfterFromOpaque(r.Opaque)
+		default:
+			t.Fatalf("%s: unexpected response %T", tt.name, res)
+		}
+		if refused := st.Code == rpc.Code_CODE_UNAVAILABLE; refused != tt.refused {
+			t.Errorf("%s: expected refused %v, got status %v", tt.name, tt.refused, st.Code)
+		}
+		if tt.refused && secs != 300 {
+			t.Errorf("%s: expected to retry after 300s, got %d", tt.name, secs)
+		}
+	}
+
+	if _, _, err := NewUnary(map[string]interface{}{"mode": "closed"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestUnaryNonCS3(t *testing.T) {
+	// the responses without status are refused with a gRPC error
+	_, err := call(t, map[string]interface{}{"mode": "maintenance", "apis": []string{"custom.API"}}, "/custom.API/Ping")
+	if grpcstatus.Code(err) != codes.Unavailable {
+		t.Errorf("expected an unavailable error, got %v", err)
+	}
+}
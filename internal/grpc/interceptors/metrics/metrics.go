@@ -0,0 +1,63 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package metrics
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// NewUnary returns a new unary interceptor that records call counts,
+// latencies and in-flight calls per service and method.
+func NewUnary() grpc.UnaryServerInterceptor {
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service, method := splitMethod(info.FullMethod)
+		call := metrics.StartGRPC(ctx, service, method)
+		res, err := handler(ctx, req)
+		call.End(status.Code(err).String())
+		return res, err
+	}
+	return interceptor
+}
+
+// NewStream returns a new server stream interceptor that records call counts,
+// latencies and in-flight streams per service and method.
+func NewStream() grpc.StreamServerInterceptor {
+	interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		service, method := splitMethod(info.FullMethod)
+		call := metrics.StartGRPC(ss.Context(), service, method)
+		err := handler(srv, ss)
+		call.End(status.Code(err).String())
+		return err
+	}
+	return interceptor
+}
+
+// splitMethod splits /cs3.gateway.v1beta1.GatewayAPI/Stat into its service and method parts.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
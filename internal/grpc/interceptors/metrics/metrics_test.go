@@ -0,0 +1,127 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/metrics"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// row returns the data of the row of the view with the tags.
+func row(t *testing.T, name string, tags ...tag.Tag) view.AggregationData {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+next:
+	for _, r := range rows {
+		if len(r.Tags) != len(tags) {
+			continue
+		}
+		for i := range tags {
+			if r.Tags[i] != tags[i] {
+				continue next
+			}
+		}
+		return r.Data
+	}
+	t.Fatalf("no row of %s with tags %v in %v", name, tags, rows)
+	return nil
+}
+
+func register(t *testing.T) {
+	if err := view.Register(metrics.DefaultViews...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { view.Unregister(metrics.DefaultViews...) })
+}
+
+type serverStream struct {
+	grpc.ServerStream
+}
+
+func (serverStream) Context() context.Context { return context.Background() }
+
+func TestUnary(t *testing.T) {
+	register(t)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/cs3.gateway.v1beta1.GatewayAPI/Stat"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	if _, err := NewUnary()(context.Background(), nil, info, handler); status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	service := tag.Tag{Key: metrics.KeyService, Value: "cs3.gateway.v1beta1.GatewayAPI"}
+	method := tag.Tag{Key: metrics.KeyMethod, Value: "Stat"}
+	code := tag.Tag{Key: metrics.KeyCode, Value: "NotFound"}
+	// the tags of the rows are sorted by key
+	if d := row(t, "grpc/server/requests", code, method, service).(*view.CountData); d.Value != 1 {
+		t.Errorf("got %d requests, expected 1", d.Value)
+	}
+	if d := row(t, "grpc/server/latency", method, service).(*view.DistributionData); d.Count != 1 {
+		t.Errorf("got %d latencies, expected 1", d.Count)
+	}
+	if d := row(t, "grpc/server/in_flight", method, service).(*view.LastValueData); d.Value != 0 {
+		t.Errorf("got %v calls in flight, expected 0", d.Value)
+	}
+}
+
+func TestStream(t *testing.T) {
+	register(t)
+
+	info := &grpc.StreamServerInfo{FullMethod: "/cs3.gateway.v1beta1.GatewayAPI/ListContainerStream"}
+	handler := func(srv interface{}, ss grpc.ServerStream) error { return nil }
+	if err := NewStream()(nil, serverStream{}, info, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	service := tag.Tag{Key: metrics.KeyService, Value: "cs3.gateway.v1beta1.GatewayAPI"}
+	method := tag.Tag{Key: metrics.KeyMethod, Value: "ListContainerStream"}
+	code := tag.Tag{Key: metrics.KeyCode, Value: "OK"}
+	if d := row(t, "grpc/server/requests", code, method, service).(*view.CountData); d.Value != 1 {
+		t.Errorf("got %d requests, expected 1", d.Value)
+	}
+	if d := row(t, "grpc/server/latency", method, service).(*view.DistributionData); d.Count != 1 {
+		t.Errorf("got %d latencies, expected 1", d.Count)
+	}
+}
+
+func TestSplitMethod(t *testing.T) {
+	tests := []struct {
+		fullMethod, service, method string
+	}{
+		{"/cs3.gateway.v1beta1.GatewayAPI/Stat", "cs3.gateway.v1beta1.GatewayAPI", "Stat"},
+		{"Stat", "unknown", "Stat"},
+	}
+	for _, tt := range tests {
+		if service, method := splitMethod(tt.fullMethod); service != tt.service || method != tt.method {
+			t.Errorf("splitMethod(%q) = %q, %q, expected %q, %q", tt.fullMethod, service, method, tt.service, tt.method)
+		}
+	}
+}
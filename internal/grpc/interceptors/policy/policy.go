@@ -0,0 +1,167 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/policy"
+	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// the policies are evaluated once the callers are authenticated and rate limited
+	defaultPriority = 400
+)
+
+func init() {
+	rgrpc.RegisterUnaryInterceptor("policy", NewUnary)
+	rgrpc.RegisterStreamInterceptor("policy", NewStream)
+}
+
+type config struct {
+	Priority      int `mapstructure:"priority"`
+	policy.Config `mapstructure:",squash"`
+}
+
+func newEngine(m map[string]interface{}) (*policy.Engine, int, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, 0, errors.Wrap(err, "policy: error decoding conf")
+	}
+	if conf.Priority == 0 {
+		conf.Priority = defaultPriority
+	}
+	e, err := policy.New(context.Background(), &conf.Config)
+	if err != nil {
+		return nil, 0, err
+	}
+	return e, conf.Priority, nil
+}
+
+// authorize returns a PermissionDenied error if the policies do not allow
+// the call.
+func authorize(ctx context.Context, e *policy.Engine, method string, req interface{}) error {
+	log := appctx.GetLogger(ctx)
+	in := newInput(ctx, method, req)
+	allowed, err := e.Allow(ctx, in)
+	if err != nil {
+		log.Error().Err(err).Str("method", method).Msg("policy: error evaluating policies")
+		return status.Errorf(codes.Internal, "policy: error evaluating policies")
+	}
+	if !allowed {
+		log.Warn().Str("method", method).Str("path", in.Path).Msg("policy: call denied")
+		return status.Errorf(codes.PermissionDenied, "policy: %s denied", method)
+	}
+	return nil
+}
+
+// NewUnary returns a new unary interceptor that rejects the calls denied
+// by the policies.
+func NewUnary(m map[string]interface{}) (grpc.UnaryServerInterceptor, int, error) {
+	e, prio, err := newEngine(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authorize(ctx, e, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	return interceptor, prio, nil
+}
+
+// NewStream returns a new server stream interceptor that rejects the calls
+// denied by the policies.
+func NewStream(m map[string]interface{}) (grpc.StreamServerInterceptor, int, error) {
+	e, prio, err := newEngine(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(ss.Context(), e, info.FullMethod, nil); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+	return interceptor, prio, nil
+}
+
+// The requests carrying the path of the resources they act on.
+type (
+	refRequest      interface{ GetRef() *provider.Reference }
+	sourceRequest   interface{ GetSource() *provider.Reference }
+	resourceRequest interface{ GetResourceInfo() *provider.ResourceInfo }
+	opaqueRequest   interface{ GetOpaque() *types.Opaque }
+)
+
+func newInput(ctx context.Context, method string, req interface{}) *policy.Input {
+	in := &policy.Input{
+		Protocol: "grpc",
+		Method:   method,
+	}
+	if u, ok := user.ContextGetUser(ctx); ok {
+		in.User = policy.NewUser(u)
+	}
+
+	switch r := req.(type) {
+	case refRequest:
+		in.Path = r.GetRef().GetPath()
+	case sourceRequest:
+		in.Path = r.GetSource().GetPath()
+	case resourceRequest:
+		in.Path = r.GetResourceInfo().GetPath()
+	}
+
+	switch r := req.(type) {
+	case *collaboration.CreateShareRequest:
+		in.ShareType = policy.ShareTypeUser
+		if r.GetGrant().GetGrantee().GetType() == provider.GranteeType_GRANTEE_TYPE_GROUP {
+			in.ShareType = policy.ShareTypeGroup
+		}
+	case *link.CreatePublicShareRequest:
+		in.ShareType = policy.ShareTypePublicLink
+	case *ocm.CreateOCMShareRequest:
+		in.ShareType = policy.ShareTypeOCM
+	}
+
+	if r, ok := req.(opaqueRequest); ok && in.ShareType != "" {
+		if e := r.GetOpaque().GetMap()["role"]; e != nil {
+			role := map[string]string{}
+			if err := json.Unmarshal(e.Value, &role); err == nil {
+				in.Role = role["name"]
+			}
+		}
+	}
+	return in
+}
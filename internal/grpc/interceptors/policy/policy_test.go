@@ -0,0 +1,70 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package policy
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/policy"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func TestNewInput(t *testing.T) {
+	ctx := user.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{Idp: "cernbox.cern.ch", OpaqueId: "einstein"},
+		Username: "einstein",
+		Groups:   []string{"staff"},
+	})
+
+	in := newInput(ctx, "/cs3.sharing.collaboration.v1beta1.CollaborationAPI/CreateShare", &collaboration.CreateShareRequest{
+		Opaque: &types.Opaque{Map: map[string]*types.OpaqueEntry{
+			"role": {Decoder: "json", Value: []byte(`{"name":"editor"}`)},
+		}},
+		ResourceInfo: &provider.ResourceInfo{Path: "/home/photos"},
+		Grant: &collaboration.ShareGrant{
+			Grantee: &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_GROUP},
+		},
+	})
+	if in.Path != "/home/photos" || in.ShareType != policy.ShareTypeGroup || in.Role != "editor" {
+		t.Errorf("unexpected input for a group share: %+v", in)
+	}
+	if in.User == nil || in.User.Username != "einstein" || in.User.Groups[0] != "staff" {
+		t.Errorf("unexpected user in the input: %+v", in.User)
+	}
+
+	in = newInput(context.Background(), "/cs3.sharing.link.v1beta1.LinkAPI/CreatePublicShare", &link.CreatePublicShareRequest{
+		ResourceInfo: &provider.ResourceInfo{Path: "/home/report.pdf"},
+	})
+	if in.ShareType != policy.ShareTypePublicLink || in.User != nil {
+		t.Errorf("unexpected input for an anonymous public link: %+v", in)
+	}
+
+	in = newInput(ctx, "/cs3.storage.provider.v1beta1.ProviderAPI/Delete", &provider.DeleteRequest{
+		Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: "/home/a.txt"}},
+	})
+	if in.Path != "/home/a.txt" || in.ShareType != "" {
+		t.Errorf("unexpected input for a delete: %+v", in)
+	}
+}
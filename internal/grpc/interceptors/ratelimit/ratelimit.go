@@ -0,0 +1,129 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ratelimit
+
+import (
+	"context"
+	"net"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/ratelimit"
+	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultPriority = 300
+)
+
+func init() {
+	rgrpc.RegisterUnaryInterceptor("ratelimit", NewUnary)
+	rgrpc.RegisterStreamInterceptor("ratelimit", NewStream)
+}
+
+type config struct {
+	Priority int `mapstructure:"priority"`
+	// IPRate is the number of calls per second allowed per peer address, 0 disables it.
+	IPRate  float64 `mapstructure:"ip_rate"`
+	IPBurst int     `mapstructure:"ip_burst"`
+	// UserRate is the number of calls per second allowed per authenticated user, 0 disables it.
+	UserRate  float64 `mapstructure:"user_rate"`
+	UserBurst int     `mapstructure:"user_burst"`
+}
+
+type limiters struct {
+	ip   *ratelimit.Limiter
+	user *ratelimit.Limiter
+}
+
+func newLimiters(m map[string]interface{}) (*limiters, int, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, 0, errors.Wrap(err, "ratelimit: error decoding conf")
+	}
+	if conf.Priority == 0 {
+		conf.Priority = defaultPriority
+	}
+	l := &limiters{
+		ip:   ratelimit.New(conf.IPRate, conf.IPBurst),
+		user: ratelimit.New(conf.UserRate, conf.UserBurst),
+	}
+	return l, conf.Priority, nil
+}
+
+// allow returns a ResourceExhausted error if the caller exceeded its rate.
+func (l *limiters) allow(ctx context.Context, method string) error {
+	log := appctx.GetLogger(ctx)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip := p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		if !l.ip.Allow(ip) {
+			log.Warn().Str("ip", ip).Str("method", method).Msg("ratelimit: peer exceeded call rate")
+			return status.Errorf(codes.ResourceExhausted, "ratelimit: too many calls from %s", ip)
+		}
+	}
+
+	if u, ok := user.ContextGetUser(ctx); ok && u.Id != nil {
+		if !l.user.Allow(u.Id.Idp + "!" + u.Id.OpaqueId) {
+			log.Warn().Str("user", u.Username).Str("method", method).Msg("ratelimit: user exceeded call rate")
+			return status.Errorf(codes.ResourceExhausted, "ratelimit: too many calls for user %s", u.Username)
+		}
+	}
+	return nil
+}
+
+// NewUnary returns a new unary interceptor that rejects
+// callers exceeding the configured rates.
+func NewUnary(m map[string]interface{}) (grpc.UnaryServerInterceptor, int, error) {
+	l, prio, err := newLimiters(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	return interceptor, prio, nil
+}
+
+// NewStream returns a new server stream interceptor that rejects
+// callers exceeding the configured rates.
+func NewStream(m map[string]interface{}) (grpc.StreamServerInterceptor, int, error) {
+	l, prio, err := newLimiters(m)
+	if err != nil {
+		return nil, 0, err
+	}
+	interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.allow(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+	return interceptor, prio, nil
+}
@@ -20,33 +20,37 @@ package recovery
 
 import (
 	"context"
-
 	"runtime/debug"
 
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/trace"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// NewUnary returns a server interceptor that adds telemetry to
-// grpc calls.
+// NewUnary returns a server interceptor that converts the panics of the
+// handlers into CODE_INTERNAL errors.
 func NewUnary() grpc.UnaryServerInterceptor {
 	interceptor := grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(recoveryFunc))
 	return interceptor
 }
 
-// NewStream returns a streaming server inteceptor that adds telemetry to
-// streaming grpc calls.
+// NewStream returns a streaming server interceptor that converts the panics
+// of the handlers into CODE_INTERNAL errors.
 func NewStream() grpc.StreamServerInterceptor {
 	interceptor := grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(recoveryFunc))
 	return interceptor
 }
 
+// recoveryFunc logs the panic with the stack of the goroutine and answers
+// with CODE_INTERNAL. The panic value is not sent to the client, which gets
+// the trace to look it up in the logs instead.
 func recoveryFunc(ctx context.Context, p interface{}) (err error) {
 	stack := debug.Stack()
+	method, _ := grpc.Method(ctx)
 	log := appctx.GetLogger(ctx)
-	log.Error().Str("stack", string(stack)).Msgf("%+v", p)
-	return status.Errorf(codes.Internal, "%s", p)
+	log.Error().Str("method", method).Str("stack", string(stack)).Msgf("recovered from panic: %+v", p)
+	return status.Errorf(codes.Internal, "internal error, trace: %s", trace.GetTraceID(ctx))
 }
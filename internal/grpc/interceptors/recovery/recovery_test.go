@@ -0,0 +1,58 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package recovery
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnary(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/cs3.gateway.v1beta1.GatewayAPI/Stat"}
+	_, err := NewUnary()(context.Background(), nil, info, handler)
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("expected an internal error, got %v", err)
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+}
+
+func (s testStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestStream(t *testing.T) {
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		panic("boom")
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/cs3.gateway.v1beta1.GatewayAPI/ListContainerStream"}
+	err := NewStream()(nil, testStream{}, info, handler)
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("expected an internal error, got %v", err)
+	}
+}
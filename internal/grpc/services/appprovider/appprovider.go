@@ -25,6 +25,8 @@ import (
 	providerpb "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
 	"github.com/cs3org/reva/pkg/app"
 	"github.com/cs3org/reva/pkg/app/provider/demo"
+	"github.com/cs3org/reva/pkg/app/provider/wopi"
+	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/rgrpc"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/mitchellh/mapstructure"
@@ -43,6 +45,7 @@ type service struct {
 type config struct {
 	Driver string                 `mapstructure:"driver"`
 	Demo   map[string]interface{} `mapstructure:"demo"`
+	Wopi   map[string]interface{} `mapstructure:"wopi"`
 }
 
 // New creates a new StorageRegistryService
@@ -88,17 +91,23 @@ func getProvider(c *config) (app.Provider, error) {
 	switch c.Driver {
 	case "demo":
 		return demo.New(c.Demo)
+	case "wopi":
+		return wopi.New(c.Wopi)
 	default:
 		return nil, fmt.Errorf("driver not found: %s", c.Driver)
 	}
 }
 
 func (s *service) Open(ctx context.Context, req *providerpb.OpenRequest) (*providerpb.OpenResponse, error) {
-	iframeLocation, err := s.provider.GetIFrame(ctx, req.ResourceInfo.Id, req.AccessToken)
+	iframeLocation, err := s.provider.GetIFrame(ctx, req.ResourceInfo, req.AccessToken)
 	if err != nil {
 		err := errors.Wrap(err, "appprovidersvc: error calling GetIFrame")
+		st := status.NewInternal(ctx, err, "error getting app's iframe")
+		if _, ok := errors.Cause(err).(errtypes.IsNotSupported); ok {
+			st = status.NewUnimplemented(ctx, err, "no app available for the resource")
+		}
 		res := &providerpb.OpenResponse{
-			Status: status.NewInternal(ctx, err, "error getting app's iframe"),
+			Status: st,
 		}
 		return res, nil
 	}
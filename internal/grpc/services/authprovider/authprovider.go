@@ -26,6 +26,9 @@ import (
 	"github.com/cs3org/reva/pkg/appctx"
 	"github.com/cs3org/reva/pkg/auth"
 	"github.com/cs3org/reva/pkg/auth/manager/registry"
+	"github.com/cs3org/reva/pkg/auth/throttle"
+	"github.com/cs3org/reva/pkg/group"
+	groupregistry "github.com/cs3org/reva/pkg/group/manager/registry"
 	"github.com/cs3org/reva/pkg/rgrpc"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/mitchellh/mapstructure"
@@ -40,11 +43,18 @@ func init() {
 type config struct {
 	AuthManager  string                            `mapstructure:"auth_manager"`
 	AuthManagers map[string]map[string]interface{} `mapstructure:"auth_managers"`
+	// GroupManager optionally resolves the groups of authenticated users.
+	GroupManager  string                            `mapstructure:"group_manager"`
+	GroupManagers map[string]map[string]interface{} `mapstructure:"group_managers"`
+	// Throttle delays the logins of a user following failed attempts.
+	Throttle map[string]interface{} `mapstructure:"throttle"`
 }
 
 type service struct {
-	authmgr auth.Manager
-	conf    *config
+	authmgr   auth.Manager
+	groupmgr  group.Manager
+	throttler *throttle.Throttler
+	conf      *config
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -66,6 +76,16 @@ func getAuthManager(manager string, m map[string]map[string]interface{}) (auth.M
 	return nil, fmt.Errorf("authsvc: driver %s not found for auth manager", manager)
 }
 
+func getGroupManager(manager string, m map[string]map[string]interface{}) (group.Manager, error) {
+	if manager == "" {
+		return nil, nil
+	}
+	if f, ok := groupregistry.NewFuncs[manager]; ok {
+		return f(m[manager])
+	}
+	return nil, fmt.Errorf("authsvc: driver %s not found for group manager", manager)
+}
+
 // New returns a new AuthProviderServiceServer.
 func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 	c, err := parseConfig(m)
@@ -78,7 +98,17 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		return nil, err
 	}
 
-	svc := &service{conf: c, authmgr: authManager}
+	groupManager, err := getGroupManager(c.GroupManager, c.GroupManagers)
+	if err != nil {
+		return nil, err
+	}
+
+	throttler, err := throttle.New(c.Throttle)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &service{conf: c, authmgr: authManager, groupmgr: groupManager, throttler: throttler}
 
 	return svc, nil
 }
@@ -100,8 +130,24 @@ func (s *service) Authenticate(ctx context.Context, req *provider.AuthenticateRe
 	username := req.ClientId
 	password := req.ClientSecret
 
+	key := throttle.UserKey(username)
+	wait, err := s.throttler.Wait(ctx, key)
+	if err != nil {
+		log.Error().Err(err).Msg("authsvc: error checking failed login attempts")
+	}
+	if wait > 0 {
+		err := fmt.Errorf("authsvc: login of %s throttled for %s", username, wait)
+		res := &provider.AuthenticateResponse{
+			Status: status.NewResourceExhausted(ctx, err, "too many failed login attempts"),
+		}
+		return res, nil
+	}
+
 	u, err := s.authmgr.Authenticate(ctx, username, password)
 	if err != nil {
+		if err := s.throttler.Fail(ctx, key); err != nil {
+			log.Error().Err(err).Msg("authsvc: error counting failed login attempt")
+		}
 		err = errors.Wrap(err, "authsvc: error in Authenticate")
 		res := &provider.AuthenticateResponse{
 			Status: status.NewUnauthenticated(ctx, err, "error authenticating user"),
@@ -109,6 +155,22 @@ func (s *service) Authenticate(ctx context.Context, req *provider.AuthenticateRe
 		return res, nil
 	}
 
+	if s.groupmgr != nil {
+		groups, err := s.groupmgr.GetUserGroups(ctx, u.Id)
+		if err != nil {
+			err = errors.Wrap(err, "authsvc: error resolving user groups")
+			res := &provider.AuthenticateResponse{
+				Status: status.NewInternal(ctx, err, "error resolving user groups"),
+			}
+			return res, nil
+		}
+		u.Groups = groups
+	}
+
+	if err := s.throttler.Reset(ctx, key); err != nil {
+		log.Error().Err(err).Msg("authsvc: error resetting failed login attempts")
+	}
+
 	log.Info().Msgf("user %s authenticated", u.String())
 	res := &provider.AuthenticateResponse{
 		Status: status.NewOK(ctx),
@@ -25,9 +25,11 @@ import (
 	registry "github.com/cs3org/go-cs3apis/cs3/app/registry/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	storageprovider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/auth/scope"
 	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/user"
 	"github.com/pkg/errors"
 )
 
@@ -35,12 +37,7 @@ func (s *svc) Open(ctx context.Context, req *providerpb.OpenRequest) (*providerp
 	provider, err := s.findAppProvider(ctx, req.ResourceInfo)
 	if err != nil {
 		err = errors.Wrap(err, "gateway: error calling findAppProvider")
-		var st *rpc.Status
-		if _, ok := err.(errtypes.IsNotFound); ok {
-			st = status.NewNotFound(ctx, "app provider not found")
-		} else {
-			st = status.NewInternal(ctx, err, "error searching for app provider")
-		}
+		st := status.NewStatusFromErrType(ctx, "error searching for app provider", err)
 
 		return &providerpb.OpenResponse{
 			Status: st,
@@ -55,6 +52,17 @@ func (s *svc) Open(ctx context.Context, req *providerpb.OpenRequest) (*providerp
 		}, nil
 	}
 
+	// the application only gets a token limited to reading and writing the file
+	if u, ok := user.ContextGetUser(ctx); ok && (scope.Get(u) == scope.Full || scope.Get(u) == scope.App) {
+		token, err := s.tokenmgr.MintToken(ctx, scope.WithResource(scope.WithScope(u, scope.App), req.ResourceInfo.GetId()))
+		if err != nil {
+			return &providerpb.OpenResponse{
+				Status: status.NewInternal(ctx, err, "error creating app access token"),
+			}, nil
+		}
+		req.AccessToken = token
+	}
+
 	res, err := c.Open(ctx, req)
 	if err != nil {
 		return nil, errors.Wrap(err, "gateway: error calling c.Open")
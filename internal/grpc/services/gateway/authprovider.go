@@ -26,7 +26,10 @@ import (
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	storageprovider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/mfa"
+	"github.com/cs3org/reva/pkg/auth/scope"
 	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
@@ -38,6 +41,10 @@ import (
 func (s *svc) Authenticate(ctx context.Context, req *gateway.AuthenticateRequest) (*gateway.AuthenticateResponse, error) {
 	log := appctx.GetLogger(ctx)
 
+	if req.Type == impersonationAuthType {
+		return s.impersonate(ctx, req)
+	}
+
 	// find auth provider
 	c, err := s.findAuthProvider(ctx, req.Type)
 	if err != nil {
@@ -59,6 +66,13 @@ func (s *svc) Authenticate(ctx context.Context, req *gateway.AuthenticateRequest
 		}, nil
 	}
 
+	// throttled logins are reported as such, so clients know to back off
+	if res.Status.Code == rpc.Code_CODE_RESOURCE_EXHAUSTED {
+		return &gateway.AuthenticateResponse{
+			Status: res.Status,
+		}, nil
+	}
+
 	if res.Status.Code != rpc.Code_CODE_OK {
 		err := status.NewErrorFromCode(res.Status.Code, "gateway")
 		log.Err(err).Msgf("error authenticating credentials to auth provider for type: %s", req.Type)
@@ -85,7 +99,44 @@ func (s *svc) Authenticate(ctx context.Context, req *gateway.AuthenticateRequest
 		}, nil
 	}
 
+	// the clients acting on behalf of the user can ask for a token limited to what they need
 	user := res.User
+	sc, err := scope.Narrow(scope.Get(user), string(req.Opaque.GetMap()["scope"].GetValue()))
+	if err != nil {
+		return &gateway.AuthenticateResponse{
+			Status: status.NewInvalidArg(ctx, err.Error()),
+		}, nil
+	}
+	if sc != scope.Get(user) {
+		user = scope.WithScope(user, sc)
+	}
+
+	// the password logins need the second factor of the users who enrolled
+	if s.mfa.Applies(req.Type) {
+		err := s.mfa.Check(ctx, res.User, string(req.Opaque.GetMap()[mfa.OpaqueKey].GetValue()))
+		switch err {
+		case nil:
+		case mfa.ErrEnrollmentRequired:
+			// the token only lets the user enroll
+			user = scope.WithScope(user, scope.Enroll)
+		case mfa.ErrCodeRequired:
+			return &gateway.AuthenticateResponse{
+				Status: status.NewUnauthenticated(ctx, err, "second factor required"),
+				Opaque: &types.Opaque{Map: map[string]*types.OpaqueEntry{
+					mfa.OpaqueKey: {Decoder: "plain", Value: []byte("required")},
+				}},
+			}, nil
+		default:
+			if _, ok := err.(errtypes.IsInvalidCredentials); ok {
+				return &gateway.AuthenticateResponse{
+					Status: status.NewUnauthenticated(ctx, err, "invalid second factor"),
+				}, nil
+			}
+			return &gateway.AuthenticateResponse{
+				Status: status.NewInternal(ctx, err, "error checking second factor"),
+			}, nil
+		}
+	}
 
 	token, err := s.tokenmgr.MintToken(ctx, user)
 	if err != nil {
@@ -99,7 +150,7 @@ func (s *svc) Authenticate(ctx context.Context, req *gateway.AuthenticateRequest
 	if s.c.DisableHomeCreationOnLogin {
 		gwRes := &gateway.AuthenticateResponse{
 			Status: status.NewOK(ctx),
-			User:   res.User,
+			User:   user,
 			Token:  token,
 		}
 		return gwRes, nil
@@ -130,7 +181,7 @@ func (s *svc) Authenticate(ctx context.Context, req *gateway.AuthenticateRequest
 
 	gwRes := &gateway.AuthenticateResponse{
 		Status: status.NewOK(ctx),
-		User:   res.User,
+		User:   user,
 		Token:  token,
 	}
 	return gwRes, nil
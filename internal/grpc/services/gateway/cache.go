@@ -0,0 +1,135 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/golang/protobuf/proto"
+)
+
+// statCache memoizes Stat and ListContainer responses per user. Every
+// mutation done by a user bumps its generation, which makes all the entries
+// cached for that user unreachable. Changes done by other users, e.g. in a
+// shared folder, become visible once the entries expire.
+type statCache struct {
+	sync.Mutex
+	ttl         time.Duration
+	size        int
+	entries     map[string]*cacheEntry
+	generations map[string]uint64
+}
+
+type cacheEntry struct {
+	msg     proto.Message
+	expires time.Time
+}
+
+// newStatCache returns nil, a disabled cache, if ttl is not positive.
+func newStatCache(size int, ttl time.Duration) *statCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &statCache{
+		ttl:         ttl,
+		size:        size,
+		entries:     map[string]*cacheEntry{},
+		generations: map[string]uint64{},
+	}
+}
+
+func userKey(ctx context.Context) (string, bool) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok || u.Id == nil {
+		return "", false
+	}
+	return u.Id.Idp + "!" + u.Id.OpaqueId, true
+}
+
+// key returns the cache key of a request. Requests without a user are not cached.
+func (c *statCache) key(ctx context.Context, method string, ref *provider.Reference, mdKeys []string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	uk, ok := userKey(ctx)
+	if !ok {
+		return "", false
+	}
+
+	c.Lock()
+	gen := c.generations[uk]
+	c.Unlock()
+
+	return fmt.Sprintf("%s|%s|%d|%s|%s", method, uk, gen, ref.String(), strings.Join(mdKeys, ",")), true
+}
+
+func (c *statCache) get(key string) (proto.Message, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	// callers modify the responses, never hand out the cached copy
+	return proto.Clone(e.msg), true
+}
+
+func (c *statCache) set(key string, msg proto.Message) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.size {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.size {
+			return
+		}
+	}
+	c.entries[key] = &cacheEntry{msg: proto.Clone(msg), expires: now.Add(c.ttl)}
+}
+
+// invalidate drops all the entries cached for the user in context.
+func (c *statCache) invalidate(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	uk, ok := userKey(ctx)
+	if !ok {
+		return
+	}
+
+	c.Lock()
+	c.generations[uk]++
+	c.Unlock()
+}
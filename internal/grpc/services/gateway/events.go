@@ -0,0 +1,77 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/events/publisher/registry"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func getPublisher(c *config) (events.Publisher, error) {
+	if c.EventsPublisher == "" {
+		return nil, nil
+	}
+	if f, ok := registry.NewFuncs[c.EventsPublisher]; ok {
+		return f(c.EventsPublishers[c.EventsPublisher])
+	}
+	return nil, fmt.Errorf("events publisher not found: %s", c.EventsPublisher)
+}
+
+// newEvent returns an event triggered by the user in ctx.
+func newEvent(ctx context.Context, t string) *events.Event {
+	var id *userpb.UserId
+	if u, ok := user.ContextGetUser(ctx); ok {
+		id = u.Id
+	}
+	return events.New(t, id)
+}
+
+// publish sends the event if a publisher is configured. The operation already
+// happened, so errors are only logged.
+func (s *svc) publish(ctx context.Context, e *events.Event) {
+	if s.publisher == nil {
+		return
+	}
+	if err := s.publisher.Publish(ctx, e); err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("type", e.Type).Msg("gateway: error publishing event")
+	}
+}
+
+// statID returns the id of the resource, for the events of the operations
+// referencing it by path. The operation already happened, so errors are only
+// logged and the event is published without the id.
+func statID(ctx context.Context, c provider.ProviderAPIClient, ref *provider.Reference) *provider.ResourceId {
+	if id := ref.GetId(); id != nil {
+		return id
+	}
+	res, err := c.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil || res.Status.Code != rpc.Code_CODE_OK {
+		appctx.GetLogger(ctx).Warn().Err(err).Str("path", ref.GetPath()).Msg("gateway: error getting the id of the resource of the event")
+		return nil
+	}
+	return res.Info.Id
+}
@@ -22,10 +22,17 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 
+	"github.com/cs3org/reva/pkg/appauth"
+	"github.com/cs3org/reva/pkg/auth/mfa"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/ocm/provider/lookup"
 	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/cs3org/reva/pkg/storage/jobs"
 	"github.com/cs3org/reva/pkg/token"
 	"github.com/cs3org/reva/pkg/token/manager/registry"
 	"github.com/mitchellh/mapstructure"
@@ -56,12 +63,48 @@ type config struct {
 	// ShareFolder is the location where to create shares in the recipient's storage provider.
 	ShareFolder   string                            `mapstructure:"share_folder"`
 	TokenManagers map[string]map[string]interface{} `mapstructure:"token_managers"`
+	// StatCacheTTL is the number of seconds Stat and ListContainer responses are cached, 0 disables the cache.
+	StatCacheTTL  int `mapstructure:"stat_cache_ttl"`
+	StatCacheSize int `mapstructure:"stat_cache_size"`
+	// EventsPublisher publishes the storage and share operations, none if empty.
+	EventsPublisher  string                            `mapstructure:"events_publisher"`
+	EventsPublishers map[string]map[string]interface{} `mapstructure:"events_publishers"`
+	// ImpersonationGroups are the groups whose members can act as another
+	// user, impersonation is disabled if empty.
+	ImpersonationGroups []string `mapstructure:"impersonation_groups"`
+	// ImpersonationScope limits the tokens of the impersonated users, read
+	// or full.
+	ImpersonationScope string `mapstructure:"impersonation_scope"`
+	// CreateHomeOnAccess creates the home of the users the first time they
+	// access the storage, for the users who did not log in through this
+	// gateway or when the home creation on login is disabled.
+	CreateHomeOnAccess bool `mapstructure:"create_home_on_access"`
+	// SignedURLs returns to the clients the URLs of the data servers signed
+	// with the transfer secret, instead of the datagateway. Resumable
+	// uploads still need an access token.
+	SignedURLs bool `mapstructure:"signed_urls"`
+	// MFA asks the users who enrolled a second factor for a code when they
+	// log in with a password. The ocs service enrolling the users must use
+	// the same store.
+	MFA map[string]interface{} `mapstructure:"mfa"`
+	// OCMLookup finds the users of the trusted OCM providers, to suggest
+	// them as recipients of the shares.
+	OCMLookup map[string]interface{} `mapstructure:"ocm_lookup"`
+	// JobManagerEndpoint is the service tracking the async operations,
+	// whose API the gateway serves too.
+	JobManagerEndpoint string `mapstructure:"jobmanagersvc"`
 }
 
 type svc struct {
 	c              *config
 	dataGatewayURL url.URL
 	tokenmgr       token.Manager
+	cache          *statCache
+	publisher      events.Publisher
+	mfa            *mfa.Manager
+	lookup         *lookup.Lookup
+	// homes holds the ids of the users whose home was created on access.
+	homes sync.Map
 }
 
 // New creates a new gateway svc that acts as a proxy for any grpc operation.
@@ -84,6 +127,17 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		c.TokenManager = "jwt"
 	}
 
+	if c.StatCacheSize == 0 {
+		c.StatCacheSize = 10000
+	}
+
+	if c.ImpersonationScope == "" {
+		c.ImpersonationScope = appauth.ScopeRead
+	}
+	if !appauth.ValidScope(c.ImpersonationScope) {
+		return nil, errors.New("invalid impersonation scope: " + c.ImpersonationScope)
+	}
+
 	// ensure DataGatewayEndpoint is a valid URI
 	if c.DataGatewayEndpoint == "" {
 		return nil, errors.New("datagateway is not defined")
@@ -99,10 +153,29 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		return nil, err
 	}
 
+	publisher, err := getPublisher(c)
+	if err != nil {
+		return nil, err
+	}
+
+	mfaManager, err := mfa.New(c.MFA)
+	if err != nil {
+		return nil, err
+	}
+
+	ocmLookup, err := lookup.New(c.OCMLookup)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &svc{
 		c:              c,
 		dataGatewayURL: *u,
 		tokenmgr:       tokenManager,
+		cache:          newStatCache(c.StatCacheSize, time.Duration(c.StatCacheTTL)*time.Second),
+		publisher:      publisher,
+		mfa:            mfaManager,
+		lookup:         ocmLookup,
 	}
 
 	return s, nil
@@ -110,9 +183,13 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 
 func (s *svc) Register(ss *grpc.Server) {
 	gateway.RegisterGatewayAPIServer(ss, s)
+	jobs.RegisterAPIServer(ss, s)
 }
 
 func (s *svc) Close() error {
+	if s.publisher != nil {
+		return s.publisher.Close()
+	}
 	return nil
 }
 
@@ -0,0 +1,133 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gateway
+
+import (
+	"context"
+	"strings"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/scope"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	tokenpkg "github.com/cs3org/reva/pkg/token"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+// impersonationAuthType is the auth type of the impersonation requests: the
+// client id is the id of the user to act as, given as <opaqueid>@<idp> or
+// <opaqueid>, and the client secret the access token of the admin.
+const impersonationAuthType = "impersonate"
+
+// impersonate mints a token for the user identified by the client id when
+// the access token given as client secret is a full token of a member of the
+// impersonation groups. The token carries the admin as impersonator, so that
+// both identities show up in the audit log, and is limited to the
+// impersonation scope.
+func (s *svc) impersonate(ctx context.Context, req *gateway.AuthenticateRequest) (*gateway.AuthenticateResponse, error) {
+	log := appctx.GetLogger(ctx)
+
+	if len(s.c.ImpersonationGroups) == 0 {
+		return &gateway.AuthenticateResponse{
+			Status: status.NewUnauthenticated(ctx, errors.New("gateway: impersonation is disabled"), "impersonation is disabled"),
+		}, nil
+	}
+
+	admin, err := s.tokenmgr.DismantleToken(ctx, req.ClientSecret)
+	if err != nil {
+		err = errors.Wrap(err, "gateway: error getting user from token")
+		return &gateway.AuthenticateResponse{
+			Status: status.NewUnauthenticated(ctx, err, "error dismantling token"),
+		}, nil
+	}
+
+	// only the full tokens of the admins can impersonate, not the scoped
+	// ones like the app passwords or the tokens given to the applications
+	if scope.Get(admin) != scope.Full || scope.Resource(admin) != nil {
+		err := errors.Errorf("gateway: a %s token of %s cannot impersonate users", scope.Get(admin), admin.Username)
+		return &gateway.AuthenticateResponse{
+			Status: status.NewPermissionDenied(ctx, err, "impersonation not allowed"),
+		}, nil
+	}
+
+	if user.Impersonator(admin) != nil || !s.canImpersonate(admin) {
+		err := errors.Errorf("gateway: user %s is not allowed to impersonate users", admin.Username)
+		return &gateway.AuthenticateResponse{
+			Status: status.NewPermissionDenied(ctx, err, "impersonation not allowed"),
+		}, nil
+	}
+
+	uid := &userpb.UserId{OpaqueId: req.ClientId}
+	if at := strings.LastIndex(req.ClientId, "@"); at >= 0 {
+		uid.OpaqueId = req.ClientId[:at]
+		uid.Idp = req.ClientId[at+1:]
+	}
+
+	// the user provider is called on behalf of the admin
+	ctx = tokenpkg.ContextSetToken(ctx, req.ClientSecret)
+	ctx = metadata.AppendToOutgoingContext(ctx, tokenpkg.TokenHeader, req.ClientSecret)
+	res, err := s.GetUser(ctx, &userpb.GetUserRequest{UserId: uid})
+	if err != nil {
+		return &gateway.AuthenticateResponse{
+			Status: status.NewInternal(ctx, err, "error getting user"),
+		}, nil
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		err := status.NewErrorFromCode(res.Status.Code, "gateway")
+		return &gateway.AuthenticateResponse{
+			Status: status.NewUnauthenticated(ctx, err, "error getting user to impersonate"),
+		}, nil
+	}
+
+	u := user.WithImpersonator(res.User, admin)
+	if s.c.ImpersonationScope != scope.Full {
+		u = scope.WithScope(u, s.c.ImpersonationScope)
+	}
+
+	token, err := s.tokenmgr.MintToken(ctx, u)
+	if err != nil {
+		err = errors.Wrap(err, "gateway: error in MintToken")
+		return &gateway.AuthenticateResponse{
+			Status: status.NewUnauthenticated(ctx, err, "error creating access token"),
+		}, nil
+	}
+
+	log.Info().Str("user", u.Username).Str("impersonator", admin.Username).Str("scope", s.c.ImpersonationScope).
+		Msg("gateway: user impersonated")
+	return &gateway.AuthenticateResponse{
+		Status: status.NewOK(ctx),
+		User:   u,
+		Token:  token,
+	}, nil
+}
+
+func (s *svc) canImpersonate(u *userpb.User) bool {
+	for _, g := range u.Groups {
+		for _, ig := range s.c.ImpersonationGroups {
+			if g == ig {
+				return true
+			}
+		}
+	}
+	return false
+}
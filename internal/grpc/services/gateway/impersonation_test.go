@@ -0,0 +1,62 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gateway
+
+import (
+	"context"
+	"testing"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/auth/scope"
+	"github.com/cs3org/reva/pkg/token/manager/jwt"
+)
+
+func TestImpersonateScopedTokens(t *testing.T) {
+	tokenmgr, err := jwt.New(map[string]interface{}{"secret": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &svc{
+		c:        &config{ImpersonationGroups: []string{"admins"}, ImpersonationScope: scope.Read},
+		tokenmgr: tokenmgr,
+	}
+	admin := &userpb.User{Id: &userpb.UserId{OpaqueId: "admin", Idp: "idp"}, Username: "admin", Groups: []string{"admins"}}
+
+	for name, u := range map[string]*userpb.User{
+		"mfa enrollment":     scope.WithScope(admin, scope.Enroll),
+		"read only password": scope.WithScope(admin, scope.Read),
+		"wopi":               scope.WithResource(scope.WithScope(admin, scope.App), &provider.ResourceId{StorageId: "home", OpaqueId: "file"}),
+	} {
+		ctx := context.Background()
+		token, err := tokenmgr.MintToken(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := s.impersonate(ctx, &gateway.AuthenticateRequest{Type: impersonationAuthType, ClientId: "einstein@idp", ClientSecret: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status.Code != rpc.Code_CODE_PERMISSION_DENIED || res.Token != "" {
+			t.Errorf("%s: impersonate() = %v, want permission denied", name, res.Status)
+		}
+	}
+}
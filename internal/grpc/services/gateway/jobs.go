@@ -0,0 +1,80 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gateway
+
+import (
+	"context"
+
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/storage/jobs"
+	"github.com/pkg/errors"
+)
+
+// The gateway forwards the API of the jobmanager service, so that the
+// services running async operations and the clients polling them only
+// need to know the gateway.
+
+func (s *svc) CreateJob(ctx context.Context, req *jobs.CreateJobRequest) (*jobs.JobResponse, error) {
+	return s.forwardJob(ctx, "CreateJob", func(c *jobs.Client) (*jobs.Info, error) {
+		return c.CreateJob(ctx, req.Total)
+	})
+}
+
+func (s *svc) GetJob(ctx context.Context, req *jobs.JobRequest) (*jobs.JobResponse, error) {
+	return s.forwardJob(ctx, "GetJob", func(c *jobs.Client) (*jobs.Info, error) {
+		return c.GetJob(ctx, req.ID)
+	})
+}
+
+func (s *svc) UpdateJob(ctx context.Context, req *jobs.UpdateJobRequest) (*jobs.JobResponse, error) {
+	return s.forwardJob(ctx, "UpdateJob", func(c *jobs.Client) (*jobs.Info, error) {
+		return c.UpdateJob(ctx, req)
+	})
+}
+
+func (s *svc) CancelJob(ctx context.Context, req *jobs.JobRequest) (*jobs.JobResponse, error) {
+	return s.forwardJob(ctx, "CancelJob", func(c *jobs.Client) (*jobs.Info, error) {
+		return c.CancelJob(ctx, req.ID)
+	})
+}
+
+func (s *svc) forwardJob(ctx context.Context, name string, call func(*jobs.Client) (*jobs.Info, error)) (*jobs.JobResponse, error) {
+	if s.c.JobManagerEndpoint == "" {
+		return &jobs.JobResponse{
+			Status: status.NewUnimplemented(ctx, nil, "gateway: no jobmanager configured"),
+		}, nil
+	}
+
+	c, err := pool.GetJobsClient(s.c.JobManagerEndpoint)
+	if err != nil {
+		err = errors.Wrap(err, "gateway: error calling GetJobsClient")
+		return &jobs.JobResponse{
+			Status: status.NewInternal(ctx, err, "error getting jobmanager client"),
+		}, nil
+	}
+
+	info, err := call(c)
+	if err != nil {
+		return &jobs.JobResponse{
+			Status: status.NewStatusFromErrType(ctx, "gateway: error calling "+name, err),
+		}, nil
+	}
+	return &jobs.JobResponse{Status: status.NewOK(ctx), Job: info}, nil
+}
@@ -24,7 +24,7 @@ import (
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
-	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/events"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 	"github.com/pkg/errors"
 )
@@ -43,6 +43,15 @@ func (s *svc) CreatePublicShare(ctx context.Context, req *link.CreatePublicShare
 		return nil, err
 	}
 
+	if res.Status.Code == rpc.Code_CODE_OK {
+		e := newEvent(ctx, events.TypeShareCreated)
+		e.ShareType = events.ShareTypePublicLink
+		e.ShareID = res.Share.GetId().GetOpaqueId()
+		e.Resource = res.Share.GetResourceId()
+		e.Path = req.ResourceInfo.GetPath()
+		s.publish(ctx, e)
+	}
+
 	// TODO(refs) commit to storage if configured
 	return res, nil
 }
@@ -51,9 +60,22 @@ func (s *svc) RemovePublicShare(ctx context.Context, req *link.RemovePublicShare
 	log := appctx.GetLogger(ctx)
 	log.Info().Msg("remove public share")
 
-	return &link.RemovePublicShareResponse{
-		Status: status.NewOK(ctx),
-	}, nil
+	pClient, err := pool.GetPublicShareProviderClient(s.c.PublicShareProviderEndpoint)
+	if err != nil {
+		log.Err(err).Msg("error connecting to a public share provider")
+		return &link.RemovePublicShareResponse{
+			Status: &rpc.Status{
+				Code: rpc.Code_CODE_INTERNAL,
+			},
+		}, nil
+	}
+
+	res, err := pClient.RemovePublicShare(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error calling RemovePublicShare")
+	}
+
+	return res, nil
 }
 
 func (s *svc) GetPublicShareByToken(ctx context.Context, req *link.GetPublicShareByTokenRequest) (*link.GetPublicShareByTokenResponse, error) {
@@ -70,7 +92,21 @@ func (s *svc) GetPublicShareByToken(ctx context.Context, req *link.GetPublicShar
 		}, nil
 	}
 
-	return pClient.GetPublicShareByToken(ctx, req)
+	res, err := pClient.GetPublicShareByToken(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// the requests recording a transfer return no share
+	if res.Status.Code == rpc.Code_CODE_OK && res.Share != nil {
+		e := newEvent(ctx, events.TypePublicLinkAccessed)
+		e.ShareType = events.ShareTypePublicLink
+		e.ShareID = res.Share.GetId().GetOpaqueId()
+		e.Resource = res.Share.GetResourceId()
+		s.publish(ctx, e)
+	}
+
+	return res, nil
 }
 
 func (s *svc) GetPublicShare(ctx context.Context, req *link.GetPublicShareRequest) (*link.GetPublicShareResponse, error) {
@@ -94,6 +130,15 @@ func (s *svc) ListPublicShares(ctx context.Context, req *link.ListPublicSharesRe
 	log := appctx.GetLogger(ctx)
 	log.Info().Msg("listing public shares")
 
+	if s.c.PublicShareProviderEndpoint == "" {
+		return &link.ListPublicSharesResponse{
+			Status: &rpc.Status{
+				Code:    rpc.Code_CODE_UNIMPLEMENTED,
+				Message: "no public share provider configured",
+			},
+		}, nil
+	}
+
 	pClient, err := pool.GetPublicShareProviderClient(s.c.PublicShareProviderEndpoint)
 	if err != nil {
 		log.Err(err).Msg("error connecting to a public share provider")
@@ -114,10 +159,22 @@ func (s *svc) ListPublicShares(ctx context.Context, req *link.ListPublicSharesRe
 
 func (s *svc) UpdatePublicShare(ctx context.Context, req *link.UpdatePublicShareRequest) (*link.UpdatePublicShareResponse, error) {
 	log := appctx.GetLogger(ctx)
-	log.Info().Msg("list public share")
+	log.Info().Msg("update public share")
 
-	res := &link.UpdatePublicShareResponse{
-		Status: status.NewOK(ctx),
+	pClient, err := pool.GetPublicShareProviderClient(s.c.PublicShareProviderEndpoint)
+	if err != nil {
+		log.Err(err).Msg("error connecting to a public share provider")
+		return &link.UpdatePublicShareResponse{
+			Status: &rpc.Status{
+				Code: rpc.Code_CODE_INTERNAL,
+			},
+		}, nil
 	}
+
+	res, err := pClient.UpdatePublicShare(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error calling UpdatePublicShare")
+	}
+
 	return res, nil
 }
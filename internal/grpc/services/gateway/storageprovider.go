@@ -21,6 +21,7 @@ package gateway
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
 	"strings"
@@ -30,10 +31,17 @@ import (
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	registry "github.com/cs3org/go-cs3apis/cs3/storage/registry/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/scope"
+	"github.com/cs3org/reva/pkg/events"
 	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/publicshare"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/signedurl"
+	"github.com/cs3org/reva/pkg/storage/journal"
+	"github.com/cs3org/reva/pkg/user"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 )
@@ -42,9 +50,25 @@ import (
 type transferClaims struct {
 	jwt.StandardClaims
 	Target string `json:"target"`
+	// PublicLink is the id of the public share the transfer is done for.
+	PublicLink string `json:"public_link,omitempty"`
 }
 
-func (s *svc) sign(ctx context.Context, target string) (string, error) {
+// publicLink returns the public share named in the opaque data of a
+// transfer request. Only the services serving the public links on behalf
+// of their owners can name one.
+func publicLink(ctx context.Context, o *types.Opaque) string {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok || scope.Get(u) != scope.PublicShare {
+		return ""
+	}
+	if e, ok := o.GetMap()[publicshare.OpaqueLink]; ok && e.Decoder == "plain" {
+		return string(e.Value)
+	}
+	return ""
+}
+
+func (s *svc) sign(ctx context.Context, target, link string) (string, error) {
 	ttl := time.Duration(s.c.TranserExpires) * time.Second
 	claims := transferClaims{
 		StandardClaims: jwt.StandardClaims{
@@ -52,7 +76,8 @@ func (s *svc) sign(ctx context.Context, target string) (string, error) {
 			Audience:  "reva",
 			IssuedAt:  time.Now().Unix(),
 		},
-		Target: target,
+		Target:     target,
+		PublicLink: link,
 	}
 
 	t := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), claims)
@@ -65,6 +90,17 @@ func (s *svc) sign(ctx context.Context, target string) (string, error) {
 	return tkn, nil
 }
 
+// signURL signs the target for the user in the context, for the clients to
+// transfer the data directly with the data server.
+func (s *svc) signURL(ctx context.Context, method, target string) (string, error) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		return "", errtypes.UserRequired("gateway: no user in context")
+	}
+	ttl := time.Duration(s.c.TranserExpires) * time.Second
+	return signedurl.Sign(method, target, u, s.c.TransferSharedSecret, time.Now().Add(ttl))
+}
+
 func (s *svc) CreateHome(ctx context.Context, req *provider.CreateHomeRequest) (*provider.CreateHomeResponse, error) {
 	log := appctx.GetLogger(ctx)
 
@@ -211,6 +247,17 @@ func (s *svc) initiateFileDownload(ctx context.Context, req *provider.InitiateFi
 		return res, nil
 	}
 
+	if s.c.SignedURLs && res.Status.GetCode() == rpc.Code_CODE_OK {
+		signed, err := s.signURL(ctx, http.MethodGet, res.DownloadEndpoint)
+		if err != nil {
+			return &gateway.InitiateFileDownloadResponse{
+				Status: status.NewInternal(ctx, err, "error signing download url"),
+			}, nil
+		}
+		res.DownloadEndpoint = signed
+		return res, nil
+	}
+
 	// sign the download location and pass it to the data gateway
 	u, err := url.Parse(res.DownloadEndpoint)
 	if err != nil {
@@ -221,7 +268,7 @@ func (s *svc) initiateFileDownload(ctx context.Context, req *provider.InitiateFi
 
 	// TODO(labkode): calculate signature of the whole request? we only sign the URI now. Maybe worth https://tools.ietf.org/html/draft-cavage-http-signatures-11
 	target := u.String()
-	token, err := s.sign(ctx, target)
+	token, err := s.sign(ctx, target, publicLink(ctx, req.Opaque))
 	if err != nil {
 		return &gateway.InitiateFileDownloadResponse{
 			Status: status.NewInternal(ctx, err, "error creating signature for download"),
@@ -313,6 +360,7 @@ func (s *svc) InitiateFileUpload(ctx context.Context, req *provider.InitiateFile
 }
 
 func (s *svc) initiateFileUpload(ctx context.Context, req *provider.InitiateFileUploadRequest) (*gateway.InitiateFileUploadResponse, error) {
+	defer s.cache.invalidate(ctx)
 	log := appctx.GetLogger(ctx)
 	c, err := s.find(ctx, req.Ref)
 	if err != nil {
@@ -352,6 +400,17 @@ func (s *svc) initiateFileUpload(ctx context.Context, req *provider.InitiateFile
 		return res, nil
 	}
 
+	if s.c.SignedURLs {
+		signed, err := s.signURL(ctx, http.MethodPut, res.UploadEndpoint)
+		if err != nil {
+			return &gateway.InitiateFileUploadResponse{
+				Status: status.NewInternal(ctx, err, "error signing upload url"),
+			}, nil
+		}
+		res.UploadEndpoint = signed
+		return res, nil
+	}
+
 	// sign the upload location and pass it to the data gateway
 	u, err := url.Parse(res.UploadEndpoint)
 	if err != nil {
@@ -362,7 +421,7 @@ func (s *svc) initiateFileUpload(ctx context.Context, req *provider.InitiateFile
 
 	// TODO(labkode): calculate signature of the url, we only sign the URI. At some points maybe worth https://tools.ietf.org/html/draft-cavage-http-signatures-11
 	target := u.String()
-	token, err := s.sign(ctx, target)
+	token, err := s.sign(ctx, target, publicLink(ctx, req.Opaque))
 	if err != nil {
 		return &gateway.InitiateFileUploadResponse{
 			Status: status.NewInternal(ctx, err, "error creating signature for download"),
@@ -461,6 +520,7 @@ func (s *svc) CreateContainer(ctx context.Context, req *provider.CreateContainer
 }
 
 func (s *svc) createContainer(ctx context.Context, req *provider.CreateContainerRequest) (*provider.CreateContainerResponse, error) {
+	defer s.cache.invalidate(ctx)
 	c, err := s.find(ctx, req.Ref)
 	if err != nil {
 		if _, ok := err.(errtypes.IsNotFound); ok {
@@ -582,6 +642,7 @@ func (s *svc) Delete(ctx context.Context, req *provider.DeleteRequest) (*provide
 }
 
 func (s *svc) delete(ctx context.Context, req *provider.DeleteRequest) (*provider.DeleteResponse, error) {
+	defer s.cache.invalidate(ctx)
 	c, err := s.find(ctx, req.Ref)
 	if err != nil {
 		if _, ok := err.(errtypes.IsNotFound); ok {
@@ -599,6 +660,13 @@ func (s *svc) delete(ctx context.Context, req *provider.DeleteRequest) (*provide
 		return nil, errors.Wrap(err, "gateway: error calling Delete")
 	}
 
+	if res.Status.Code == rpc.Code_CODE_OK {
+		e := newEvent(ctx, events.TypeFileDeleted)
+		e.Path = req.Ref.GetPath()
+		e.Resource = req.Ref.GetId()
+		s.publish(ctx, e)
+	}
+
 	return res, nil
 }
 
@@ -631,79 +699,87 @@ func (s *svc) Move(ctx context.Context, req *provider.MoveRequest) (*provider.Mo
 		return s.move(ctx, req)
 	}
 
-	// resolve references and check the ref points to the same base path, paranoia check.
-	if s.isShareChild(ctx, p) && s.isShareChild(ctx, dp) {
-		shareName, shareChild := s.splitShare(ctx, p)
-		dshareName, dshareChild := s.splitShare(ctx, dp)
-		log.Debug().Msgf("srcpath:%s dstpath:%s srcsharename:%s srcsharechild: %s dstsharename:%s dstsharechild:%s ", p, dp, shareName, shareChild, dshareName, dshareChild)
+	// resolve the children of the shares to their targets, the move is atomic
+	// when both sides end up on the same storage provider, which checks the
+	// permissions of the grants. The share folder and the mount points can
+	// not be moved in or out of it.
+	src, err := s.resolveShareChild(ctx, p)
+	if err != nil {
+		return &provider.MoveResponse{
+			Status: status.NewStatusFromErrType(ctx, "gateway: error moving", err),
+		}, nil
+	}
+	dst, err := s.resolveShareChild(ctx, dp)
+	if err != nil {
+		return &provider.MoveResponse{
+			Status: status.NewStatusFromErrType(ctx, "gateway: error moving", err),
+		}, nil
+	}
+	log.Debug().Msgf("gateway: move: srcpath:%s dstpath:%s resolved to src:%s dst:%s", p, dp, src, dst)
 
-		if shareName != dshareName {
-			err := errors.New("gateway: move: src and dst points to different targets")
-			return &provider.MoveResponse{
-				Status: status.NewInternal(ctx, err, "gateway: error moving"),
-			}, nil
+	req.Source = &provider.Reference{
+		Spec: &provider.Reference_Path{
+			Path: src,
+		},
+	}
+	req.Destination = &provider.Reference{
+		Spec: &provider.Reference_Path{
+			Path: dst,
+		},
+	}
+	return s.move(ctx, req)
+}
 
-		}
+// resolveShareChild returns the path in the target of the share of the
+// children of the received shares, the paths outside the share folder are
+// returned unchanged. The share folder itself and the mount points only
+// hold received shares and are refused.
+func (s *svc) resolveShareChild(ctx context.Context, p string) (string, error) {
+	if !s.inSharedFolder(ctx, p) {
+		return p, nil
+	}
+	if !s.isShareChild(ctx, p) {
+		return "", errtypes.PermissionDenied("gateway: not in a share: " + p)
+	}
 
-		ref := &provider.Reference{
+	shareName, shareChild := s.splitShare(ctx, p)
+	statReq := &provider.StatRequest{
+		Ref: &provider.Reference{
 			Spec: &provider.Reference_Path{
 				Path: shareName,
 			},
-		}
-
-		statReq := &provider.StatRequest{Ref: ref}
-		statRes, err := s.stat(ctx, statReq)
-		if err != nil {
-			return &provider.MoveResponse{
-				Status: status.NewInternal(ctx, err, "gateway: error moving"),
-			}, nil
-		}
-
-		if statRes.Status.Code != rpc.Code_CODE_OK {
-			err := status.NewErrorFromCode(statRes.Status.Code, "gateway")
-			log.Err(err).Msg("gateway: error moving")
-			return &provider.MoveResponse{
-				Status: status.NewInternal(ctx, err, "gateway: error moving"),
-			}, nil
-		}
-
-		if statRes.Info.Type != provider.ResourceType_RESOURCE_TYPE_REFERENCE {
-			err := errors.New(fmt.Sprintf("gateway: expected reference: got:%+v", statRes.Info))
-			log.Err(err).Msg("gateway: error deleting")
-			return &provider.MoveResponse{
-				Status: status.NewInternal(ctx, err, "gateway: error deleting"),
-			}, nil
-		}
-
-		ri, err := s.checkRef(ctx, statRes.Info)
-		if err != nil {
-			log.Err(err).Msg("gateway: error resolving reference")
-			return &provider.MoveResponse{
-				Status: status.NewInternal(ctx, err, "error moving"),
-			}, nil
-		}
+		},
+	}
+	statRes, err := s.stat(ctx, statReq)
+	if err != nil {
+		return "", errors.Wrap(err, "gateway: error stating share "+shareName)
+	}
 
-		src := &provider.Reference{
-			Spec: &provider.Reference_Path{
-				Path: path.Join(ri.Path, shareChild),
-			},
-		}
-		dst := &provider.Reference{
-			Spec: &provider.Reference_Path{
-				Path: path.Join(ri.Path, dshareChild),
-			},
-		}
+	switch statRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		return "", errtypes.NotFound(shareName)
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return "", errtypes.PermissionDenied(shareName)
+	default:
+		return "", status.NewErrorFromCode(statRes.Status.Code, "gateway")
+	}
 
-		req.Source = src
-		req.Destination = dst
+	if statRes.Info.Type != provider.ResourceType_RESOURCE_TYPE_REFERENCE {
+		return "", errors.New(fmt.Sprintf("gateway: expected reference: got:%+v", statRes.Info))
+	}
 
-		return s.move(ctx, req)
+	ri, err := s.checkRef(ctx, statRes.Info)
+	if err != nil {
+		return "", errors.Wrap(err, "gateway: error resolving reference")
 	}
 
-	panic("gateway: move called on unknown path:" + p)
+	// append child to target
+	return path.Join(ri.Path, shareChild), nil
 }
 
 func (s *svc) move(ctx context.Context, req *provider.MoveRequest) (*provider.MoveResponse, error) {
+	defer s.cache.invalidate(ctx)
 	srcP, err := s.findProvider(ctx, req.Source)
 	if err != nil {
 		if _, ok := err.(errtypes.IsNotFound); ok {
@@ -743,10 +819,24 @@ func (s *svc) move(ctx context.Context, req *provider.MoveRequest) (*provider.Mo
 		}, nil
 	}
 
-	return c.Move(ctx, req)
+	res, err := c.Move(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "gateway: error calling Move")
+	}
+
+	if res.Status.Code == rpc.Code_CODE_OK && s.publisher != nil {
+		e := newEvent(ctx, events.TypeFileRenamed)
+		e.OldPath = req.Source.GetPath()
+		e.Path = req.Destination.GetPath()
+		e.Resource = statID(ctx, c, req.Destination)
+		s.publish(ctx, e)
+	}
+
+	return res, nil
 }
 
 func (s *svc) SetArbitraryMetadata(ctx context.Context, req *provider.SetArbitraryMetadataRequest) (*provider.SetArbitraryMetadataResponse, error) {
+	defer s.cache.invalidate(ctx)
 	c, err := s.find(ctx, req.Ref)
 	if err != nil {
 		if _, ok := err.(errtypes.IsNotFound); ok {
@@ -768,6 +858,7 @@ func (s *svc) SetArbitraryMetadata(ctx context.Context, req *provider.SetArbitra
 }
 
 func (s *svc) UnsetArbitraryMetadata(ctx context.Context, req *provider.UnsetArbitraryMetadataRequest) (*provider.UnsetArbitraryMetadataResponse, error) {
+	defer s.cache.invalidate(ctx)
 	c, err := s.find(ctx, req.Ref)
 	if err != nil {
 		if _, ok := err.(errtypes.IsNotFound); ok {
@@ -802,7 +893,18 @@ func (s *svc) stat(ctx context.Context, req *provider.StatRequest) (*provider.St
 		}, nil
 	}
 
-	return c.Stat(ctx, req)
+	key, cacheable := s.cache.key(ctx, "stat", req.Ref, req.ArbitraryMetadataKeys)
+	if cacheable {
+		if res, ok := s.cache.get(key); ok {
+			return res.(*provider.StatResponse), nil
+		}
+	}
+
+	res, err := c.Stat(ctx, req)
+	if err == nil && cacheable && res.Status.Code == rpc.Code_CODE_OK {
+		s.cache.set(key, res)
+	}
+	return res, err
 }
 
 func (s *svc) Stat(ctx context.Context, req *provider.StatRequest) (*provider.StatResponse, error) {
@@ -1007,11 +1109,25 @@ func (s *svc) listContainer(ctx context.Context, req *provider.ListContainerRequ
 		}, nil
 	}
 
+	key, cacheable := s.cache.key(ctx, "listcontainer", req.Ref, req.ArbitraryMetadataKeys)
+	// the changes since a sync token are not cached
+	if _, ok := req.GetOpaque().GetMap()[journal.TokenOpaqueKey]; ok {
+		cacheable = false
+	}
+	if cacheable {
+		if res, ok := s.cache.get(key); ok {
+			return res.(*provider.ListContainerResponse), nil
+		}
+	}
+
 	res, err := c.ListContainer(ctx, req)
 	if err != nil {
 		return nil, errors.Wrap(err, "gateway: error calling ListContainer")
 	}
 
+	if cacheable && res.Status.Code == rpc.Code_CODE_OK {
+		s.cache.set(key, res)
+	}
 	return res, nil
 }
 
@@ -1027,6 +1143,13 @@ func (s *svc) ListContainer(ctx context.Context, req *provider.ListContainerRequ
 		return s.listContainer(ctx, req)
 	}
 
+	// the changes are only tracked by the storage providers themselves
+	if _, ok := req.GetOpaque().GetMap()[journal.TokenOpaqueKey]; ok {
+		return &provider.ListContainerResponse{
+			Status: status.NewUnimplemented(ctx, errtypes.NotSupported("changes"), "gateway: changes of the shares are not supported"),
+		}, nil
+	}
+
 	if s.isSharedFolder(ctx, p) {
 		// TODO(labkode): we need to generate a unique etag if any of the underlying share changes.
 		// the response will contain all the share names and we need to convert them to non resference types.
@@ -1305,6 +1428,7 @@ func (s *svc) ListFileVersions(ctx context.Context, req *provider.ListFileVersio
 }
 
 func (s *svc) RestoreFileVersion(ctx context.Context, req *provider.RestoreFileVersionRequest) (*provider.RestoreFileVersionResponse, error) {
+	defer s.cache.invalidate(ctx)
 	c, err := s.find(ctx, req.Ref)
 	if err != nil {
 		if _, ok := err.(errtypes.IsNotFound); ok {
@@ -1322,6 +1446,14 @@ func (s *svc) RestoreFileVersion(ctx context.Context, req *provider.RestoreFileV
 		return nil, errors.Wrap(err, "gateway: error calling RestoreFileVersion")
 	}
 
+	if res.Status.Code == rpc.Code_CODE_OK && s.publisher != nil {
+		e := newEvent(ctx, events.TypeVersionRestored)
+		e.Path = req.Ref.GetPath()
+		e.Version = req.Key
+		e.Resource = statID(ctx, c, req.Ref)
+		s.publish(ctx, e)
+	}
+
 	return res, nil
 }
 
@@ -1356,6 +1488,7 @@ func (s *svc) ListRecycle(ctx context.Context, req *gateway.ListRecycleRequest)
 }
 
 func (s *svc) RestoreRecycleItem(ctx context.Context, req *provider.RestoreRecycleItemRequest) (*provider.RestoreRecycleItemResponse, error) {
+	defer s.cache.invalidate(ctx)
 	c, err := s.find(ctx, req.Ref)
 	if err != nil {
 		if _, ok := err.(errtypes.IsNotFound); ok {
@@ -1400,9 +1533,33 @@ func (s *svc) PurgeRecycle(ctx context.Context, req *gateway.PurgeRecycleRequest
 	return res, nil
 }
 
+// GetQuota returns the quota of the storage holding the reference, or of the
+// home of the user when no reference is given.
 func (s *svc) GetQuota(ctx context.Context, req *gateway.GetQuotaRequest) (*provider.GetQuotaResponse, error) {
-	res := &provider.GetQuotaResponse{
-		Status: status.NewUnimplemented(ctx, nil, "GetQuota not yet implemented"),
+	ref := req.GetRef()
+	if ref == nil {
+		ref = &provider.Reference{
+			Spec: &provider.Reference_Path{Path: s.getHome(ctx)},
+		}
+	}
+
+	c, err := s.find(ctx, ref)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return &provider.GetQuotaResponse{
+				Status: status.NewNotFound(ctx, "storage provider not found"),
+			}, nil
+		}
+		return &provider.GetQuotaResponse{
+			Status: status.NewInternal(ctx, err, "error finding storage provider"),
+		}, nil
+	}
+
+	res, err := c.GetQuota(ctx, &provider.GetQuotaRequest{
+		Opaque: req.GetOpaque(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "gateway: error calling GetQuota")
 	}
 	return res, nil
 }
@@ -1430,9 +1587,34 @@ func (s *svc) find(ctx context.Context, ref *provider.Reference) (provider.Provi
 	if err != nil {
 		return nil, err
 	}
+	if s.c.CreateHomeOnAccess {
+		s.createHomeOnAccess(ctx)
+	}
 	return s.getStorageProviderClient(ctx, p)
 }
 
+// createHomeOnAccess creates the home of the user of the request the first
+// time the user is seen, and again after the creation failed.
+func (s *svc) createHomeOnAccess(ctx context.Context) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok || u.Id == nil {
+		return
+	}
+	key := u.Id.Idp + "!" + u.Id.OpaqueId
+	// CreateHome finds the home provider too, the key is stored first
+	if _, loaded := s.homes.LoadOrStore(key, true); loaded {
+		return
+	}
+	res, err := s.CreateHome(ctx, &provider.CreateHomeRequest{})
+	if err == nil && res.Status.Code != rpc.Code_CODE_OK {
+		err = status.NewErrorFromCode(res.Status.Code, "gateway")
+	}
+	if err != nil {
+		s.homes.Delete(key)
+		appctx.GetLogger(ctx).Warn().Err(err).Str("user", key).Msg("gateway: error creating home on access")
+	}
+}
+
 func (s *svc) getStorageProviderClient(ctx context.Context, p *registry.ProviderInfo) (provider.ProviderAPIClient, error) {
 	c, err := pool.GetStorageProviderServiceClient(p.Address)
 	if err != nil {
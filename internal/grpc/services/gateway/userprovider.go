@@ -22,6 +22,7 @@ import (
 	"context"
 
 	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/ocm/provider/lookup"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 	"github.com/pkg/errors"
@@ -44,6 +45,10 @@ func (s *svc) GetUser(ctx context.Context, req *user.GetUserRequest) (*user.GetU
 }
 
 func (s *svc) FindUsers(ctx context.Context, req *user.FindUsersRequest) (*user.FindUsersResponse, error) {
+	if _, ok := req.Opaque.GetMap()[lookup.OpaqueKey]; ok {
+		return s.findRemoteUsers(ctx, req)
+	}
+
 	c, err := pool.GetUserProviderServiceClient(s.c.UserProviderEndpoint)
 	if err != nil {
 		return &user.FindUsersResponse{
@@ -59,6 +64,26 @@ func (s *svc) FindUsers(ctx context.Context, req *user.FindUsersRequest) (*user.
 	return res, nil
 }
 
+// findRemoteUsers finds the users of the trusted OCM providers.
+func (s *svc) findRemoteUsers(ctx context.Context, req *user.FindUsersRequest) (*user.FindUsersResponse, error) {
+	if s.lookup == nil {
+		return &user.FindUsersResponse{
+			Status: status.NewUnimplemented(ctx, nil, "ocm lookup not configured"),
+		}, nil
+	}
+
+	users, err := s.lookup.FindUsers(ctx, req.Filter)
+	if err != nil {
+		return &user.FindUsersResponse{
+			Status: status.NewInternal(ctx, err, "error finding remote users"),
+		}, nil
+	}
+	return &user.FindUsersResponse{
+		Status: status.NewOK(ctx),
+		Users:  users,
+	}, nil
+}
+
 func (s *svc) GetUserGroups(ctx context.Context, req *user.GetUserGroupsRequest) (*user.GetUserGroupsResponse, error) {
 	c, err := pool.GetUserProviderServiceClient(s.c.UserProviderEndpoint)
 	if err != nil {
@@ -26,10 +26,14 @@ import (
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/events"
 	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/share"
+	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 )
 
@@ -51,6 +55,14 @@ func (s *svc) CreateShare(ctx context.Context, req *collaboration.CreateShareReq
 		return res, nil
 	}
 
+	e := newEvent(ctx, events.TypeShareCreated)
+	e.ShareType = events.ShareTypeUser
+	e.ShareID = res.Share.GetId().GetOpaqueId()
+	e.Resource = res.Share.GetResourceId()
+	e.Grantee = res.Share.GetGrantee()
+	e.Path = req.ResourceInfo.GetPath()
+	s.publish(ctx, e)
+
 	// if we don't need to commit we return earlier
 	if !s.c.CommitShareToStorageGrant && !s.c.CommitShareToStorageRef {
 		return res, nil
@@ -133,12 +145,13 @@ func (s *svc) RemoveShare(ctx context.Context, req *collaboration.RemoveShareReq
 	}
 
 	// if we don't need to commit we return earlier
-	if !s.c.CommitShareToStorageGrant && !s.c.CommitShareToStorageRef {
+	if res.Status.Code != rpc.Code_CODE_OK || (!s.c.CommitShareToStorageGrant && !s.c.CommitShareToStorageRef) {
 		return res, nil
 	}
 
 	// TODO(labkode): if both commits are enabled they could be done concurrently.
-	if s.c.CommitShareToStorageGrant {
+	// The disabled shares have no grant.
+	if s.c.CommitShareToStorageGrant && !disabled(share.GetPermissions().GetPermissions()) {
 		grantReq := &provider.RemoveGrantRequest{
 			Ref: &provider.Reference{
 				Spec: &provider.Reference_Id{
@@ -175,6 +188,16 @@ func (s *svc) RemoveShare(ctx context.Context, req *collaboration.RemoveShareReq
 		}
 	}
 
+	if s.c.CommitShareToStorageGrant {
+		// the reshares were removed with the share
+		s.commitReshares(ctx, res.Opaque, func(sh *collaboration.Share) error {
+			if disabled(sh.GetPermissions().GetPermissions()) {
+				return nil
+			}
+			return s.removeGrant(ctx, sh)
+		})
+	}
+
 	return res, nil
 }
 
@@ -220,6 +243,11 @@ func (s *svc) ListShares(ctx context.Context, req *collaboration.ListSharesReque
 	return res, nil
 }
 
+// UpdateShare updates the share and, when shares are committed to storage
+// grants, its grant and the ones of the restricted reshares. The share is
+// only updated once its grant is, and the grant is reverted if the share
+// can not be updated. The grants of the disabled shares, left without any
+// permission, are removed, and added back when they are enabled again.
 func (s *svc) UpdateShare(ctx context.Context, req *collaboration.UpdateShareRequest) (*collaboration.UpdateShareResponse, error) {
 	c, err := pool.GetUserShareProviderClient(s.c.UserShareProviderEndpoint)
 	if err != nil {
@@ -229,59 +257,144 @@ func (s *svc) UpdateShare(ctx context.Context, req *collaboration.UpdateShareReq
 		}, nil
 	}
 
-	res, err := c.UpdateShare(ctx, req)
+	p := req.Field.GetPermissions().GetPermissions()
+	if p == nil || !s.c.CommitShareToStorageGrant {
+		res, err := c.UpdateShare(ctx, req)
+		if err != nil {
+			return nil, errors.Wrap(err, "gateway: error calling UpdateShare")
+		}
+		return res, nil
+	}
+
+	getShareRes, err := c.GetShare(ctx, &collaboration.GetShareRequest{Ref: req.Ref})
 	if err != nil {
-		return nil, errors.Wrap(err, "gateway: error calling UpdateShare")
+		return nil, errors.Wrap(err, "gateway: error calling GetShare")
+	}
+	if getShareRes.Status.Code != rpc.Code_CODE_OK {
+		return &collaboration.UpdateShareResponse{
+			Status: getShareRes.Status,
+		}, nil
 	}
+	sh := getShareRes.Share
 
-	// if we don't need to commit we return earlier
-	if !s.c.CommitShareToStorageGrant && !s.c.CommitShareToStorageRef {
+	if err := s.commitGrant(ctx, sh, sh.GetPermissions().GetPermissions(), p); err != nil {
+		return &collaboration.UpdateShareResponse{
+			Status: status.NewInternal(ctx, err, "error updating storage grant"),
+		}, nil
+	}
+
+	res, err := c.UpdateShare(ctx, req)
+	if err != nil || res.Status.Code != rpc.Code_CODE_OK {
+		if rerr := s.commitGrant(ctx, sh, p, sh.GetPermissions().GetPermissions()); rerr != nil {
+			appctx.GetLogger(ctx).Error().Err(rerr).Str("share", sh.GetId().GetOpaqueId()).Msg("gateway: error reverting storage grant")
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "gateway: error calling UpdateShare")
+		}
 		return res, nil
 	}
 
-	// TODO(labkode): if both commits are enabled they could be done concurrently.
-	/*
-		if s.c.CommitShareToStorageGrant {
-			getShareReq := &collaboration.GetShareRequest{
-				Ref: req.Ref,
-			}
-			getShareRes, err := c.GetShare(ctx, getShareReq)
-			if err != nil {
-				return nil, errors.Wrap(err, "gateway: error calling GetShare")
-			}
+	// the reshares were restricted to the new permissions, they had
+	// permissions left before
+	s.commitReshares(ctx, res.Opaque, func(rs *collaboration.Share) error {
+		if disabled(rs.GetPermissions().GetPermissions()) {
+			return s.removeGrant(ctx, rs)
+		}
+		return s.updateGrant(ctx, rs, rs.GetPermissions().GetPermissions())
+	})
 
-			if getShareRes.Status.Code != rpc.Code_CODE_OK {
-				return &collaboration.UpdateShareResponse{
-					Status: status.NewInternal(ctx, status.NewErrorFromCode(getShareRes.Status.Code, "gateway"),
-						"error getting share when committing to the share"),
-				}, nil
-			}
+	return res, nil
+}
 
-			grantReq := &provider.UpdateGrantRequest{
-				Ref: &provider.Reference{
-					Spec: &provider.Reference_Id{
-						Id: getShareRes.Share.ResourceId,
-					},
-				},
-				Grant: &provider.Grant{
-					Grantee:     getShareRes.Share.Grantee,
-					Permissions: getShareRes.Share.Permissions.Permissions,
-				},
-			}
-				grantRes, err := s.UpdateGrant(ctx, grantReq)
-				if err != nil {
-					return nil, errors.Wrap(err, "gateway: error calling UpdateGrant")
-				}
-				if grantRes.Status.Code != rpc.Code_CODE_OK {
-					return &collaboration.UpdateShareResponse{
-						Status: status.NewInternal(ctx, status.NewErrorFromCode(grantRes.Status.Code, "gateway"),
-							"error updating storage grant"),
-					}, nil
-				}
+// commitReshares applies f to the reshares carried by the opaque data of a
+// response, logging the failures.
+func (s *svc) commitReshares(ctx context.Context, o *types.Opaque, f func(*collaboration.Share) error) {
+	log := appctx.GetLogger(ctx)
+	reshares, err := share.SharesFromOpaque(o)
+	if err != nil {
+		log.Error().Err(err).Msg("gateway: error decoding reshares")
+		return
+	}
+	for _, sh := range reshares {
+		if err := f(sh); err != nil {
+			log.Error().Err(err).Str("share", sh.GetId().GetOpaqueId()).Msg("gateway: error committing reshare to storage grant")
 		}
-	*/
+	}
+}
 
-	return res, nil
+// disabled tells if the permissions are the ones of a disabled share.
+func disabled(p *provider.ResourcePermissions) bool {
+	return proto.Equal(p, &provider.ResourcePermissions{})
+}
+
+// commitGrant changes the storage grant of the share from the permissions
+// old to p, removing it when the share is disabled and adding it back when
+// it is enabled again.
+func (s *svc) commitGrant(ctx context.Context, sh *collaboration.Share, old, p *provider.ResourcePermissions) error {
+	switch {
+	case disabled(old) && disabled(p):
+		return nil
+	case disabled(p):
+		return s.removeGrant(ctx, sh)
+	case disabled(old):
+		return s.addGrant(ctx, sh, p)
+	default:
+		return s.updateGrant(ctx, sh, p)
+	}
+}
+
+func (s *svc) addGrant(ctx context.Context, sh *collaboration.Share, p *provider.ResourcePermissions) error {
+	c, err := s.findByID(ctx, sh.ResourceId)
+	if err != nil {
+		return errors.Wrap(err, "gateway: error finding storage provider")
+	}
+	res, err := c.AddGrant(ctx, &provider.AddGrantRequest{
+		Ref:   &provider.Reference{Spec: &provider.Reference_Id{Id: sh.ResourceId}},
+		Grant: &provider.Grant{Grantee: sh.Grantee, Permissions: p},
+	})
+	if err != nil {
+		return errors.Wrap(err, "gateway: error calling AddGrant")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(res.Status.Code, "gateway")
+	}
+	return nil
+}
+
+func (s *svc) updateGrant(ctx context.Context, sh *collaboration.Share, p *provider.ResourcePermissions) error {
+	c, err := s.findByID(ctx, sh.ResourceId)
+	if err != nil {
+		return errors.Wrap(err, "gateway: error finding storage provider")
+	}
+	res, err := c.UpdateGrant(ctx, &provider.UpdateGrantRequest{
+		Ref:   &provider.Reference{Spec: &provider.Reference_Id{Id: sh.ResourceId}},
+		Grant: &provider.Grant{Grantee: sh.Grantee, Permissions: p},
+	})
+	if err != nil {
+		return errors.Wrap(err, "gateway: error calling UpdateGrant")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(res.Status.Code, "gateway")
+	}
+	return nil
+}
+
+func (s *svc) removeGrant(ctx context.Context, sh *collaboration.Share) error {
+	c, err := s.findByID(ctx, sh.ResourceId)
+	if err != nil {
+		return errors.Wrap(err, "gateway: error finding storage provider")
+	}
+	res, err := c.RemoveGrant(ctx, &provider.RemoveGrantRequest{
+		Ref:   &provider.Reference{Spec: &provider.Reference_Id{Id: sh.ResourceId}},
+		Grant: &provider.Grant{Grantee: sh.Grantee, Permissions: sh.GetPermissions().GetPermissions()},
+	})
+	if err != nil {
+		return errors.Wrap(err, "gateway: error calling RemoveGrant")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(res.Status.Code, "gateway")
+	}
+	return nil
 }
 
 // TODO(labkode): listing received shares just goes to the user share manager and gets the list of
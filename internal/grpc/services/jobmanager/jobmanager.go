@@ -0,0 +1,189 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package jobmanager tracks the async operations run by other services, like
+// the lazy copies and moves of ocdav. The services create a job, report its
+// progress and stop it when the job is cancelled, while the clients poll the
+// job through the gateway, whichever instance of the service runs it.
+package jobmanager
+
+import (
+	"context"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rgrpc"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/storage/janitor"
+	"github.com/cs3org/reva/pkg/storage/jobs"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+func init() {
+	rgrpc.Register("jobmanager", New)
+}
+
+type config struct {
+	Janitor struct {
+		// Jobs forgets the jobs which ended, after a day by default.
+		Jobs janitor.Config `mapstructure:"jobs"`
+		// Stale fails the jobs which did not report their progress for a
+		// minute by default, like the ones of a service that stopped.
+		Stale janitor.Config `mapstructure:"stale"`
+	} `mapstructure:"janitor"`
+}
+
+func (c *config) init() {
+	if c.Janitor.Jobs.Expiration == 0 {
+		c.Janitor.Jobs.Expiration = 86400
+	}
+	if c.Janitor.Stale.Expiration == 0 {
+		c.Janitor.Stale.Expiration = 60
+	}
+	if c.Janitor.Stale.Interval == 0 {
+		c.Janitor.Stale.Interval = 30
+	}
+}
+
+type service struct {
+	conf    *config
+	jobs    *jobs.Manager
+	janitor *janitor.Janitor
+}
+
+// New returns a new jobmanager service.
+func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "jobmanager: error decoding conf")
+	}
+	c.init()
+
+	s := &service{
+		conf:    c,
+		jobs:    jobs.NewManager(),
+		janitor: janitor.New(),
+	}
+	s.janitor.Add("jobmanager-jobs", c.Janitor.Jobs, s.jobs.Purge)
+	s.janitor.Add("jobmanager-stale", c.Janitor.Stale, s.jobs.Expire)
+	s.janitor.Start()
+	return s, nil
+}
+
+func (s *service) Close() error {
+	s.janitor.Stop()
+	return nil
+}
+
+func (s *service) UnprotectedEndpoints() []string {
+	return []string{}
+}
+
+func (s *service) Register(ss *grpc.Server) {
+	jobs.RegisterAPIServer(ss, s)
+}
+
+// owner identifies the user in the context as the owner of the jobs.
+func owner(ctx context.Context) (string, bool) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		return "", false
+	}
+	return ownerID(u.Id), true
+}
+
+func ownerID(id *userpb.UserId) string {
+	return id.GetIdp() + "!" + id.GetOpaqueId()
+}
+
+// getJob returns the job if it belongs to the user in the context. The jobs
+// of other users are not found, so that their ids cannot be probed.
+func (s *service) getJob(ctx context.Context, id string) (*jobs.Job, *jobs.JobResponse) {
+	o, ok := owner(ctx)
+	if !ok {
+		return nil, &jobs.JobResponse{
+			Status: status.NewUnauthenticated(ctx, errtypes.UserRequired("jobmanager"), "user not found in context"),
+		}
+	}
+	j, err := s.jobs.Get(id)
+	if err == nil && j.Info().Owner != o {
+		err = errtypes.NotFound(id)
+	}
+	if err != nil {
+		return nil, &jobs.JobResponse{
+			Status: status.NewStatusFromErrType(ctx, "jobmanager: error getting job "+id, err),
+		}
+	}
+	return j, nil
+}
+
+func (s *service) CreateJob(ctx context.Context, req *jobs.CreateJobRequest) (*jobs.JobResponse, error) {
+	o, ok := owner(ctx)
+	if !ok {
+		return &jobs.JobResponse{
+			Status: status.NewUnauthenticated(ctx, errtypes.UserRequired("jobmanager"), "user not found in context"),
+		}, nil
+	}
+	info := s.jobs.Add(o, req.Total).Info()
+	return &jobs.JobResponse{Status: status.NewOK(ctx), Job: &info}, nil
+}
+
+func (s *service) GetJob(ctx context.Context, req *jobs.JobRequest) (*jobs.JobResponse, error) {
+	j, res := s.getJob(ctx, req.ID)
+	if res != nil {
+		return res, nil
+	}
+	info := j.Info()
+	return &jobs.JobResponse{Status: status.NewOK(ctx), Job: &info}, nil
+}
+
+func (s *service) UpdateJob(ctx context.Context, req *jobs.UpdateJobRequest) (*jobs.JobResponse, error) {
+	if _, res := s.getJob(ctx, req.ID); res != nil {
+		return res, nil
+	}
+	j, err := s.jobs.Update(req.ID, req.Done, req.Status, req.Error, req.Result)
+	if err != nil {
+		return &jobs.JobResponse{
+			Status: status.NewStatusFromErrType(ctx, "jobmanager: error updating job "+req.ID, err),
+		}, nil
+	}
+	info := j.Info()
+	return &jobs.JobResponse{Status: status.NewOK(ctx), Job: &info}, nil
+}
+
+func (s *service) CancelJob(ctx context.Context, req *jobs.JobRequest) (*jobs.JobResponse, error) {
+	if _, res := s.getJob(ctx, req.ID); res != nil {
+		return res, nil
+	}
+	if err := s.jobs.Cancel(req.ID); err != nil {
+		return &jobs.JobResponse{
+			Status: status.NewStatusFromErrType(ctx, "jobmanager: error cancelling job "+req.ID, err),
+		}, nil
+	}
+	j, err := s.jobs.Get(req.ID)
+	if err != nil {
+		return &jobs.JobResponse{
+			Status: status.NewStatusFromErrType(ctx, "jobmanager: error getting job "+req.ID, err),
+		}, nil
+	}
+	info := j.Info()
+	return &jobs.JobResponse{Status: status.NewOK(ctx), Job: &info}, nil
+}
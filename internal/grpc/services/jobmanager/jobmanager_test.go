@@ -0,0 +1,167 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package jobmanager
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/jobs"
+	"github.com/cs3org/reva/pkg/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const userHeader = "x-test-user"
+
+// withUser sets the user named in the metadata, like the token interceptors
+// of revad do.
+func withUser(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(userHeader)) > 0 {
+		ctx = user.ContextSetUser(ctx, &userpb.User{Id: &userpb.UserId{Idp: "cernbox.cern.ch", OpaqueId: md.Get(userHeader)[0]}})
+	}
+	return handler(ctx, req)
+}
+
+func startJobManager(t *testing.T) *jobs.Client {
+	svc, err := New(map[string]interface{}{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = svc.Close() })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(withUser))
+	svc.Register(s)
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cc.Close() })
+	return jobs.NewClient(cc)
+}
+
+func as(username string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), userHeader, username)
+}
+
+// wait polls the job until it ends.
+func wait(t *testing.T, c *jobs.Client, ctx context.Context, id string) *jobs.Info {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		info, err := c.GetJob(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Ended.IsZero() {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job did not end")
+	return nil
+}
+
+func TestJobManager(t *testing.T) {
+	c := startJobManager(t)
+	einstein := as("einstein")
+
+	info, err := c.CreateJob(einstein, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	progressed := make(chan struct{})
+	finish := make(chan struct{})
+	c.Run(einstein, info, 10*time.Millisecond, func(ctx context.Context, j *jobs.Job) error {
+		j.Progress(4)
+		close(progressed)
+		<-finish
+		j.Progress(6)
+		j.SetResult("fileId", "42")
+		return nil
+	})
+	<-progressed
+	for i := 0; ; i++ {
+		current, err := c.GetJob(einstein, info.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current.Done == 4 {
+			break
+		}
+		if i == 200 {
+			t.Fatalf("progress not reported, got %+v", current)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the jobs of other users are not found
+	marie := as("marie")
+	if _, err := c.GetJob(marie, info.ID); !isNotFound(err) {
+		t.Errorf("GetJob() of another user = %v, expected not found", err)
+	}
+	if _, err := c.CancelJob(marie, info.ID); !isNotFound(err) {
+		t.Errorf("CancelJob() of another user = %v, expected not found", err)
+	}
+	if _, err := c.CreateJob(context.Background(), 1); err == nil {
+		t.Error("expected CreateJob() without user to fail")
+	}
+
+	close(finish)
+	if done := wait(t, c, einstein, info.ID); done.Status != jobs.Finished || done.Done != 10 || done.Result["fileId"] != "42" {
+		t.Errorf("unexpected job info %+v", done)
+	}
+
+	cancelled, err := c.CreateJob(einstein, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan error, 1)
+	c.Run(einstein, cancelled, 10*time.Millisecond, func(ctx context.Context, j *jobs.Job) error {
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return ctx.Err()
+	})
+	if _, err := c.CancelJob(einstein, cancelled.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the cancelled job was not stopped")
+	}
+	if done := wait(t, c, einstein, cancelled.ID); done.Status != jobs.Cancelled {
+		t.Errorf("expected the job to be cancelled, got %s", done.Status)
+	}
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(errtypes.IsNotFound)
+	return ok
+}
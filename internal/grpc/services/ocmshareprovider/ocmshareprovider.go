@@ -19,15 +19,31 @@
 package ocmshareprovider
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"path"
 
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/notification"
+	"github.com/cs3org/reva/pkg/notification/notifier"
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
 	"github.com/cs3org/reva/pkg/ocm/share"
 	"github.com/cs3org/reva/pkg/ocm/share/manager/registry"
+	"github.com/cs3org/reva/pkg/ocm/share/received"
 	"github.com/cs3org/reva/pkg/rgrpc"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/user"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
@@ -38,13 +54,22 @@ func init() {
 }
 
 type config struct {
-	Driver  string                            `mapstructure:"driver"`
-	Drivers map[string]map[string]interface{} `mapstructure:"drivers"`
+	Driver     string                            `mapstructure:"driver"`
+	Drivers    map[string]map[string]interface{} `mapstructure:"drivers"`
+	GatewaySvc string                            `mapstructure:"gatewaysvc"`
+	// Notifications configures the notifier telling the local users about
+	// the shares they receive, they are disabled when empty.
+	Notifications map[string]interface{} `mapstructure:"notifications"`
+	// OCMSecret authenticates the ocmd service storing the shares received
+	// from the remote providers, none are accepted when empty.
+	OCMSecret string `mapstructure:"ocm_secret"`
 }
 
 type service struct {
-	conf *config
-	sm   share.Manager
+	conf      *config
+	sm        share.Manager
+	notifier  *notifier.Notifier
+	discovery *discovery.Client
 }
 
 func getShareManager(c *config) (share.Manager, error) {
@@ -58,12 +83,16 @@ func (s *service) Close() error {
 	return nil
 }
 
+// UnprotectedEndpoints lets the ocmd service store the shares received from
+// the remote providers, which it authorizes itself. It authenticates with
+// the ocm_secret instead of a user.
 func (s *service) UnprotectedEndpoints() []string {
-	return []string{}
+	return []string{received.AddReceivedShareMethod}
 }
 
 func (s *service) Register(ss *grpc.Server) {
 	ocm.RegisterOcmAPIServer(ss, s)
+	received.RegisterAPIServer(ss, s)
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -88,20 +117,35 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		c.Driver = "json"
 	}
 
+	c.GatewaySvc = sharedconf.GetGatewaySVC(c.GatewaySvc)
+
 	sm, err := getShareManager(c)
 	if err != nil {
 		return nil, err
 	}
 
 	service := &service{
-		conf: c,
-		sm:   sm,
+		conf:      c,
+		sm:        sm,
+		discovery: discovery.NewClient(0),
+	}
+
+	if len(c.Notifications) > 0 {
+		if service.notifier, err = notifier.New(c.Notifications); err != nil {
+			return nil, err
+		}
 	}
 
 	return service, nil
 }
 
 func (s *service) CreateOCMShare(ctx context.Context, req *ocm.CreateOCMShareRequest) (*ocm.CreateOCMShareResponse, error) {
+	if _, ok := user.ContextGetUser(ctx); !ok {
+		return &ocm.CreateOCMShareResponse{
+			Status: status.NewUnauthenticated(ctx, errors.New("ocmshareprovider: no user in ctx"), "user required"),
+		}, nil
+	}
+
 	share, err := s.sm.Share(ctx, req.ResourceId, req.Grant)
 	if err != nil {
 		return &ocm.CreateOCMShareResponse{
@@ -109,6 +153,10 @@ func (s *service) CreateOCMShare(ctx context.Context, req *ocm.CreateOCMShareReq
 		}, nil
 	}
 
+	if s.notifier != nil {
+		s.notifyShareReceived(ctx, share)
+	}
+
 	res := &ocm.CreateOCMShareResponse{
 		Status: status.NewOK(ctx),
 		Share:  share,
@@ -116,6 +164,67 @@ func (s *service) CreateOCMShare(ctx context.Context, req *ocm.CreateOCMShareReq
 	return res, nil
 }
 
+// AddReceivedShare stores a share created on a remote provider, owned by
+// one of its users, for the ocmd service.
+func (s *service) AddReceivedShare(ctx context.Context, req *received.AddReceivedShareRequest) (*received.AddReceivedShareResponse, error) {
+	if !received.Authenticated(ctx, s.conf.OCMSecret) {
+		return &received.AddReceivedShareResponse{
+			Status: status.NewUnauthenticated(ctx, errors.New("ocmshareprovider: invalid ocm secret"), "ocm secret required"),
+		}, nil
+	}
+
+	remote := req.Remote
+	if req.Share.GetOwner() == nil || req.Share.GetGrantee().GetId() == nil {
+		return &received.AddReceivedShareResponse{
+			Status: status.NewInvalidArg(ctx, "owner and grantee are required"),
+		}, nil
+	}
+	if remote == nil || remote.WebDAVEndpoint == "" || remote.Token == "" {
+		return &received.AddReceivedShareResponse{
+			Status: status.NewInvalidArg(ctx, "webdav endpoint and token are required"),
+		}, nil
+	}
+
+	sh, err := s.sm.AddReceivedShare(ctx, &ocm.Share{
+		ResourceId:  req.Share.ResourceId,
+		Permissions: req.Share.Permissions,
+		Grantee:     req.Share.Grantee,
+		Owner:       req.Share.Owner,
+		Creator:     req.Share.Owner,
+	}, remote)
+	if err != nil {
+		return &received.AddReceivedShareResponse{
+			Status: status.NewStatusFromErrType(ctx, "error storing received share", err),
+		}, nil
+	}
+
+	return &received.AddReceivedShareResponse{
+		Status: status.NewOK(ctx),
+		Share:  sh,
+	}, nil
+}
+
+// remoteOpaque returns the access to the remote resources of the received
+// shares, keyed by share id.
+func (s *service) remoteOpaque(ctx context.Context, shares []*ocm.ReceivedShare) *types.Opaque {
+	m := map[string]*types.OpaqueEntry{}
+	for _, rs := range shares {
+		r, err := s.sm.GetRemoteShare(ctx, &ocm.ShareReference{Spec: &ocm.ShareReference_Id{Id: rs.Share.Id}})
+		if err != nil {
+			continue
+		}
+		val, err := json.Marshal(r)
+		if err != nil {
+			continue
+		}
+		m[rs.Share.Id.OpaqueId] = &types.OpaqueEntry{Decoder: "json", Value: val}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return &types.Opaque{Map: m}
+}
+
 func (s *service) RemoveOCMShare(ctx context.Context, req *ocm.RemoveOCMShareRequest) (*ocm.RemoveOCMShareResponse, error) {
 	err := s.sm.Unshare(ctx, req.Ref)
 	if err != nil {
@@ -183,24 +292,105 @@ func (s *service) ListReceivedOCMShares(ctx context.Context, req *ocm.ListReceiv
 	res := &ocm.ListReceivedOCMSharesResponse{
 		Status: status.NewOK(ctx),
 		Shares: shares,
+		Opaque: s.remoteOpaque(ctx, shares),
 	}
 	return res, nil
 }
 
 func (s *service) UpdateReceivedOCMShare(ctx context.Context, req *ocm.UpdateReceivedOCMShareRequest) (*ocm.UpdateReceivedOCMShareResponse, error) {
-	_, err := s.sm.UpdateReceivedShare(ctx, req.Ref, req.Field) // TODO(labkode): check what to update
+	current, err := s.sm.GetReceivedShare(ctx, req.Ref)
+	if err != nil {
+		return &ocm.UpdateReceivedOCMShareResponse{
+			Status: status.NewStatusFromErrType(ctx, "error getting received share", err),
+		}, nil
+	}
+	if err := share.CheckStateTransition(current.State, req.Field.GetState()); err != nil {
+		return &ocm.UpdateReceivedOCMShareResponse{
+			Status: status.NewInvalidArg(ctx, err.Error()),
+		}, nil
+	}
+
+	rs, err := s.sm.UpdateReceivedShare(ctx, req.Ref, req.Field)
 	if err != nil {
 		return &ocm.UpdateReceivedOCMShareResponse{
 			Status: status.NewInternal(ctx, err, "error updating received share"),
 		}, nil
 	}
 
+	if rs.State != current.State {
+		s.notifyRemote(ctx, rs)
+	}
+
 	res := &ocm.UpdateReceivedOCMShareResponse{
 		Status: status.NewOK(ctx),
 	}
 	return res, nil
 }
 
+// notifyRemote tells the provider a share was received from that the
+// grantee accepted or declined it, as the OCM notifications endpoint
+// expects. Failures are only logged, the remote provider has no say in the
+// state of the share. The notifications endpoint is the one advertised by
+// the remote provider, falling back to the one recorded with the share.
+func (s *service) notifyRemote(ctx context.Context, rs *ocm.ReceivedShare) {
+	log := appctx.GetLogger(ctx)
+	r, err := s.sm.GetRemoteShare(ctx, &ocm.ShareReference{Spec: &ocm.ShareReference_Id{Id: rs.Share.Id}})
+	if err != nil || r.OCMEndpoint == "" {
+		// a share of this provider, or of a provider we could not discover
+		return
+	}
+
+	var notificationType, message string
+	switch rs.State {
+	case ocm.ShareState_SHARE_STATE_ACCEPTED:
+		notificationType, message = "SHARE_ACCEPTED", "Recipient accepted the share"
+	case ocm.ShareState_SHARE_STATE_REJECTED:
+		notificationType, message = "SHARE_DECLINED", "Recipient declined the share"
+	default:
+		return
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"notificationType": notificationType,
+		"resourceType":     "file",
+		"providerId":       rs.Share.ResourceId.GetOpaqueId(),
+		"notification": map[string]string{
+			"sharedSecret": r.Token,
+			"message":      message,
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("ocmshareprovider: error encoding notification")
+		return
+	}
+
+	p, err := s.discovery.Discover(ctx, rs.Share.GetOwner().GetIdp())
+	if err != nil {
+		p = discovery.Assume(rs.Share.GetOwner().GetIdp(), r.OCMEndpoint)
+	}
+	endpoint, err := p.URL(discovery.EndpointNotifications)
+	if err != nil {
+		log.Warn().Err(err).Msg("ocmshareprovider: remote provider does not support notifications")
+		return
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Error().Err(err).Msg("ocmshareprovider: error creating notification request")
+		return
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(httpReq)
+	if err != nil {
+		log.Error().Err(err).Str("endpoint", endpoint).Msg("ocmshareprovider: error notifying remote provider")
+		return
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusCreated && httpRes.StatusCode != http.StatusOK {
+		log.Warn().Str("endpoint", endpoint).Str("status", httpRes.Status).Msg("ocmshareprovider: remote provider refused the notification")
+	}
+}
+
 func (s *service) GetReceivedOCMShare(ctx context.Context, req *ocm.GetReceivedOCMShareRequest) (*ocm.GetReceivedOCMShareResponse, error) {
 	log := appctx.GetLogger(ctx)
 
@@ -215,6 +405,50 @@ func (s *service) GetReceivedOCMShare(ctx context.Context, req *ocm.GetReceivedO
 	res := &ocm.GetReceivedOCMShareResponse{
 		Status: status.NewOK(ctx),
 		Share:  share,
+		Opaque: s.remoteOpaque(ctx, []*ocm.ReceivedShare{share}),
 	}
 	return res, nil
 }
+
+// notifyShareReceived tells the grantee of a new share about it, when it is a
+// user of this instance.
+func (s *service) notifyShareReceived(ctx context.Context, sh *ocm.Share) {
+	log := appctx.GetLogger(ctx)
+	if sh.Grantee.GetType() != provider.GranteeType_GRANTEE_TYPE_USER {
+		return
+	}
+
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		log.Error().Err(err).Msg("ocmshareprovider: error getting gateway client")
+		return
+	}
+	res, err := client.GetUser(ctx, &userpb.GetUserRequest{UserId: sh.Grantee.Id})
+	if err != nil {
+		log.Error().Err(err).Msg("ocmshareprovider: error looking up grantee")
+		return
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		// remote users are notified by their own provider
+		return
+	}
+
+	resource := sh.ResourceId.GetOpaqueId()
+	statRes, err := client.Stat(ctx, &provider.StatRequest{
+		Ref: &provider.Reference{Spec: &provider.Reference_Id{Id: sh.ResourceId}},
+	})
+	if err == nil && statRes.Status.Code == rpc.Code_CODE_OK {
+		resource = path.Base(statRes.Info.Path)
+	}
+
+	sharer := user.ContextMustGetUser(ctx)
+	d := &notification.Data{
+		Recipient: res.User,
+		Sharer:    sharer.DisplayName,
+		Resource:  resource,
+	}
+	if d.Sharer == "" {
+		d.Sharer = sharer.Username
+	}
+	s.notifier.NotifyInBackground(ctx, notification.EventOCMShareReceived, d)
+}
@@ -0,0 +1,86 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocmshareprovider
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/ocm/share"
+	_ "github.com/cs3org/reva/pkg/ocm/share/manager/memory"
+	"github.com/cs3org/reva/pkg/ocm/share/received"
+	"google.golang.org/grpc"
+)
+
+func TestAddReceivedShare(t *testing.T) {
+	for _, secret := range []string{"", "secret"} {
+		svc, err := New(map[string]interface{}{"driver": "memory", "ocm_secret": secret}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := grpc.NewServer()
+		svc.Register(srv)
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { _ = srv.Serve(lis) }()
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := &received.AddReceivedShareRequest{
+			Share: &ocm.Share{
+				ResourceId: &provider.ResourceId{StorageId: "cern.ch", OpaqueId: "42"},
+				Grantee: &provider.Grantee{
+					Type: provider.GranteeType_GRANTEE_TYPE_USER,
+					Id:   &userpb.UserId{OpaqueId: "einstein"},
+				},
+				Owner: &userpb.UserId{Idp: "cern.ch", OpaqueId: "marie"},
+			},
+			Remote: &share.RemoteShare{Name: "data", WebDAVEndpoint: "https://cern.ch/webdav", Token: "token"},
+		}
+
+		for _, s := range []string{"", "other", "secret"} {
+			res, err := received.NewClient(conn, s).AddReceivedShare(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := rpc.Code_CODE_UNAUTHENTICATED
+			if secret != "" && s == secret {
+				want = rpc.Code_CODE_OK
+			}
+			if res.Status.Code != want {
+				t.Errorf("ocm_secret %q, client secret %q: got %s, want %s", secret, s, res.Status.Code, want)
+			}
+			if want == rpc.Code_CODE_OK && res.Share.GetId().GetOpaqueId() == "" {
+				t.Error("expected the stored share to have an id")
+			}
+		}
+
+		conn.Close()
+		srv.Stop()
+	}
+}
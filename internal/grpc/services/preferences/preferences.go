@@ -20,15 +20,18 @@ package preferences
 
 import (
 	"context"
-	"sync"
+	"fmt"
 
 	"google.golang.org/grpc"
 
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
-	preferences "github.com/cs3org/go-cs3apis/cs3/preferences/v1beta1"
+	preferencespb "github.com/cs3org/go-cs3apis/cs3/preferences/v1beta1"
+	"github.com/cs3org/reva/pkg/preferences"
+	"github.com/cs3org/reva/pkg/preferences/manager/registry"
 	"github.com/cs3org/reva/pkg/rgrpc"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 )
 
@@ -40,17 +43,44 @@ func init() {
 	rgrpc.Register("preferences", New)
 }
 
-// m maps user to map of user preferences.
-// m = map[userToken]map[key]value
-var m = make(map[string]map[string]string)
+type config struct {
+	Driver  string                            `mapstructure:"driver"`
+	Drivers map[string]map[string]interface{} `mapstructure:"drivers"`
+}
 
-var mutex = &sync.Mutex{}
+func (c *config) init() {
+	if c.Driver == "" {
+		c.Driver = "memory"
+	}
+}
 
-type service struct{}
+type service struct {
+	conf *config
+	mgr  preferences.Manager
+}
 
-// New returns a new PreferencesServiceServer
+func getPreferencesManager(c *config) (preferences.Manager, error) {
+	if f, ok := registry.NewFuncs[c.Driver]; ok {
+		return f(c.Drivers[c.Driver])
+	}
+	return nil, fmt.Errorf("driver %s not found for preferences manager", c.Driver)
+}
+
+// New returns a new PreferencesServiceServer. The keys are namespaced like
+// app/config/key, the keys without namespace are in the core namespace.
 func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
-	service := &service{}
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "preferences: error decoding conf")
+	}
+	c.init()
+
+	mgr, err := getPreferencesManager(c)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &service{conf: c, mgr: mgr}
 	return service, nil
 }
 
@@ -63,7 +93,7 @@ func (s *service) UnprotectedEndpoints() []string {
 }
 
 func (s *service) Register(ss *grpc.Server) {
-	preferences.RegisterPreferencesAPIServer(ss, s)
+	preferencespb.RegisterPreferencesAPIServer(ss, s)
 }
 
 func getUser(ctx context.Context) (*userpb.User, error) {
@@ -75,60 +105,50 @@ func getUser(ctx context.Context) (*userpb.User, error) {
 	return u, nil
 }
 
-func (s *service) SetKey(ctx context.Context, req *preferences.SetKeyRequest) (*preferences.SetKeyResponse, error) {
-	key := req.Key
-	value := req.Val
-
-	u, err := getUser(ctx)
-	if err != nil {
+func (s *service) SetKey(ctx context.Context, req *preferencespb.SetKeyRequest) (*preferencespb.SetKeyResponse, error) {
+	if _, err := getUser(ctx); err != nil {
 		err = errors.Wrap(err, "preferences: failed to call getUser")
-		return &preferences.SetKeyResponse{
+		return &preferencespb.SetKeyResponse{
 			Status: status.NewUnauthenticated(ctx, err, "user not found or invalid"),
 		}, err
 	}
 
-	name := u.Username
+	namespace, key := preferences.SplitKey(req.Key)
+	if namespace == "" || key == "" {
+		return &preferencespb.SetKeyResponse{
+			Status: status.NewInvalidArg(ctx, "invalid key"),
+		}, nil
+	}
 
-	mutex.Lock()
-	defer mutex.Unlock()
-	if len(m[name]) == 0 {
-		m[name] = map[string]string{key: value}
-	} else {
-		usersettings := m[name]
-		usersettings[key] = value
+	if err := s.mgr.SetKey(ctx, namespace, key, req.Val); err != nil {
+		return &preferencespb.SetKeyResponse{
+			Status: status.NewInternal(ctx, err, "error setting key"),
+		}, nil
 	}
 
-	return &preferences.SetKeyResponse{
+	return &preferencespb.SetKeyResponse{
 		Status: status.NewOK(ctx),
 	}, nil
 }
 
-func (s *service) GetKey(ctx context.Context, req *preferences.GetKeyRequest) (*preferences.GetKeyResponse, error) {
-	key := req.Key
-	u, err := getUser(ctx)
-	if err != nil {
+func (s *service) GetKey(ctx context.Context, req *preferencespb.GetKeyRequest) (*preferencespb.GetKeyResponse, error) {
+	if _, err := getUser(ctx); err != nil {
 		err = errors.Wrap(err, "preferences: failed to call getUser")
-		return &preferences.GetKeyResponse{
+		return &preferencespb.GetKeyResponse{
 			Status: status.NewUnauthenticated(ctx, err, "user not found or invalid"),
 		}, err
 	}
 
-	name := u.Username
-
-	mutex.Lock()
-	defer mutex.Unlock()
-	if len(m[name]) != 0 {
-		if value, ok := m[name][key]; ok {
-			return &preferences.GetKeyResponse{
-				Status: status.NewOK(ctx),
-				Val:    value,
-			}, nil
-		}
+	namespace, key := preferences.SplitKey(req.Key)
+	value, err := s.mgr.GetKey(ctx, namespace, key)
+	if err != nil {
+		return &preferencespb.GetKeyResponse{
+			Status: status.NewStatusFromErrType(ctx, "error getting key", err),
+		}, nil
 	}
 
-	res := &preferences.GetKeyResponse{
-		Status: status.NewNotFound(ctx, "key not found"),
-		Val:    "",
-	}
-	return res, nil
+	return &preferencespb.GetKeyResponse{
+		Status: status.NewOK(ctx),
+		Val:    value,
+	}, nil
 }
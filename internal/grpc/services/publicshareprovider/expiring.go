@@ -0,0 +1,124 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package publicshareprovider
+
+import (
+	"context"
+	"time"
+
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/machine"
+	"github.com/cs3org/reva/pkg/notification"
+	"github.com/cs3org/reva/pkg/notification/notifier"
+	"github.com/cs3org/reva/pkg/publicshare"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// expiryWatcher periodically tells the owners of the public links about to
+// expire. The owners are looked up through the gateway with the machine
+// auth manager, as there is no user around.
+type expiryWatcher struct {
+	sm       publicshare.Manager
+	notifier *notifier.Notifier
+	conf     *config
+	quit     chan struct{}
+	// notified holds the expiration of the shares already notified, by token,
+	// so that the owners are notified again only when it changes.
+	notified map[string]uint64
+}
+
+func newExpiryWatcher(sm publicshare.Manager, n *notifier.Notifier, c *config) *expiryWatcher {
+	return &expiryWatcher{
+		sm:       sm,
+		notifier: n,
+		conf:     c,
+		quit:     make(chan struct{}),
+		notified: map[string]uint64{},
+	}
+}
+
+func (w *expiryWatcher) run() {
+	ticker := time.NewTicker(time.Duration(w.conf.ExpirationCheckInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+func (w *expiryWatcher) stop() {
+	close(w.quit)
+}
+
+func (w *expiryWatcher) check() {
+	ctx := appctx.WithLogger(context.Background(), &log.Logger)
+	before := time.Now().Add(time.Duration(w.conf.ExpirationNotice) * time.Second)
+	shares, err := w.sm.ListExpiringPublicShares(ctx, before)
+	if err != nil {
+		log.Error().Err(err).Msg("publicshareprovider: error listing expiring public shares")
+		return
+	}
+
+	notified := make(map[string]uint64, len(shares))
+	for _, s := range shares {
+		if exp, ok := w.notified[s.Token]; ok && exp == s.Expiration.Seconds {
+			notified[s.Token] = exp
+			continue
+		}
+		if err := w.notify(ctx, s); err != nil {
+			log.Error().Err(err).Str("share", s.Id.GetOpaqueId()).Msg("publicshareprovider: error notifying expiring public share")
+			continue
+		}
+		notified[s.Token] = s.Expiration.Seconds
+	}
+	w.notified = notified
+}
+
+func (w *expiryWatcher) notify(ctx context.Context, s *link.PublicShare) error {
+	if s.Owner == nil {
+		return nil
+	}
+
+	client, err := pool.GetGatewayServiceClient(w.conf.GatewaySvc)
+	if err != nil {
+		return errors.Wrap(err, "error getting gateway client")
+	}
+	_, owner, err := machine.Authenticate(ctx, client, machine.ClientID(s.Owner), w.conf.MachineSecret)
+	if err != nil {
+		return errors.Wrap(err, "error looking up share owner")
+	}
+
+	resource := s.DisplayName
+	if resource == "" {
+		resource = s.Token
+	}
+	return w.notifier.Notify(ctx, notification.EventPublicShareExpiring, &notification.Data{
+		Recipient:  owner,
+		Resource:   resource,
+		Token:      s.Token,
+		Expiration: time.Unix(int64(s.Expiration.Seconds), int64(s.Expiration.Nanos)),
+	})
+}
@@ -20,15 +20,21 @@ package publicshareprovider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/notification/notifier"
 	"github.com/cs3org/reva/pkg/publicshare"
 	"github.com/cs3org/reva/pkg/publicshare/manager/registry"
 	"github.com/cs3org/reva/pkg/rgrpc"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/sharedconf"
 	"github.com/cs3org/reva/pkg/user"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
@@ -42,11 +48,21 @@ func init() {
 type config struct {
 	Driver  string                            `mapstructure:"driver"`
 	Drivers map[string]map[string]interface{} `mapstructure:"drivers"`
+	// Notifications configures the notifier telling the owners about the
+	// public links about to expire, they are disabled when empty.
+	Notifications map[string]interface{} `mapstructure:"notifications"`
+	// ExpirationNotice is the number of seconds before the expiration of a
+	// public link when its owner is notified.
+	ExpirationNotice        int    `mapstructure:"expiration_notice"`
+	ExpirationCheckInterval int    `mapstructure:"expiration_check_interval"`
+	MachineSecret           string `mapstructure:"machine_secret"`
+	GatewaySvc              string `mapstructure:"gatewaysvc"`
 }
 
 type service struct {
-	conf *config
-	sm   publicshare.Manager
+	conf    *config
+	sm      publicshare.Manager
+	watcher *expiryWatcher
 }
 
 func getShareManager(c *config) (publicshare.Manager, error) {
@@ -58,6 +74,9 @@ func getShareManager(c *config) (publicshare.Manager, error) {
 
 // TODO(labkode): add ctx to Close.
 func (s *service) Close() error {
+	if s.watcher != nil {
+		s.watcher.stop()
+	}
 	return nil
 }
 func (s *service) UnprotectedEndpoints() []string {
@@ -95,6 +114,26 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		sm:   sm,
 	}
 
+	if len(c.Notifications) > 0 {
+		if c.MachineSecret == "" {
+			return nil, errors.New("publicshareprovider: machine_secret is required to notify the owners of the expiring public shares")
+		}
+		if c.ExpirationNotice == 0 {
+			c.ExpirationNotice = 86400
+		}
+		if c.ExpirationCheckInterval == 0 {
+			c.ExpirationCheckInterval = 3600
+		}
+		c.GatewaySvc = sharedconf.GetGatewaySVC(c.GatewaySvc)
+
+		n, err := notifier.New(c.Notifications)
+		if err != nil {
+			return nil, err
+		}
+		service.watcher = newExpiryWatcher(sm, n, c)
+		go service.watcher.run()
+	}
+
 	return service, nil
 }
 
@@ -107,9 +146,18 @@ func (s *service) CreatePublicShare(ctx context.Context, req *link.CreatePublicS
 		log.Error().Msg("error getting user from context")
 	}
 
+	if req.GetGrant() == nil {
+		return &link.CreatePublicShareResponse{
+			Status: status.NewInvalidArg(ctx, "missing grant"),
+		}, nil
+	}
+
 	share, err := s.sm.CreatePublicShare(ctx, u, req.ResourceInfo, req.Grant)
 	if err != nil {
-		log.Debug().Err(err).Str("createShare", "shares").Msg("error connecting to storage provider")
+		log.Err(err).Msg("error creating public share")
+		return &link.CreatePublicShareResponse{
+			Status: status.NewInternal(ctx, err, "error creating public share"),
+		}, nil
 	}
 
 	res := &link.CreatePublicShareResponse{
@@ -123,6 +171,13 @@ func (s *service) RemovePublicShare(ctx context.Context, req *link.RemovePublicS
 	log := appctx.GetLogger(ctx)
 	log.Info().Msg("remove public share")
 
+	u, _ := user.ContextGetUser(ctx)
+	if err := s.sm.RevokePublicShare(ctx, u, req.Ref); err != nil {
+		return &link.RemovePublicShareResponse{
+			Status: errStatus(ctx, err, "error removing public share"),
+		}, nil
+	}
+
 	return &link.RemovePublicShareResponse{
 		Status: status.NewOK(ctx),
 	}, nil
@@ -132,9 +187,32 @@ func (s *service) GetPublicShareByToken(ctx context.Context, req *link.GetPublic
 	log := appctx.GetLogger(ctx)
 	log.Info().Msg("getting public share by token")
 
-	found, err := s.sm.GetPublicShareByToken(ctx, req.GetToken())
+	// the password travels in the opaque as the request has no field for it
+	var password string
+	if e, ok := req.GetOpaque().GetMap()["password"]; ok {
+		password = string(e.Value)
+	}
+
+	n, transfer, err := publicshare.TransferFromOpaque(req.GetOpaque())
 	if err != nil {
-		return nil, err
+		return &link.GetPublicShareByTokenResponse{
+			Status: status.NewInvalidArg(ctx, err.Error()),
+		}, nil
+	}
+	if transfer {
+		if err := s.sm.RecordPublicShareTransfer(ctx, req.GetToken(), password, n); err != nil {
+			return &link.GetPublicShareByTokenResponse{
+				Status: errStatus(ctx, err, "error recording public share transfer"),
+			}, nil
+		}
+		return &link.GetPublicShareByTokenResponse{Status: status.NewOK(ctx)}, nil
+	}
+
+	found, err := s.sm.GetPublicShareByToken(ctx, req.GetToken(), password)
+	if err != nil {
+		return &link.GetPublicShareByTokenResponse{
+			Status: errStatus(ctx, err, "error getting public share by token"),
+		}, nil
 	}
 
 	return &link.GetPublicShareByTokenResponse{
@@ -147,9 +225,18 @@ func (s *service) GetPublicShare(ctx context.Context, req *link.GetPublicShareRe
 	log := appctx.GetLogger(ctx)
 	log.Info().Msg("get public share")
 
+	u, _ := user.ContextGetUser(ctx)
+	share, err := s.sm.GetPublicShare(ctx, u, req.Ref)
+	if err != nil {
+		return &link.GetPublicShareResponse{
+			Status: errStatus(ctx, err, "error getting public share"),
+		}, nil
+	}
+
 	return &link.GetPublicShareResponse{
 		Status: status.NewOK(ctx),
-		// Share:  share,
+		Opaque: s.statsOpaque(ctx, share),
+		Share:  share,
 	}, nil
 }
 
@@ -168,6 +255,7 @@ func (s *service) ListPublicShares(ctx context.Context, req *link.ListPublicShar
 
 	res := &link.ListPublicSharesResponse{
 		Status: status.NewOK(ctx),
+		Opaque: s.statsOpaque(ctx, shares...),
 		Share:  shares,
 	}
 	return res, nil
@@ -175,10 +263,84 @@ func (s *service) ListPublicShares(ctx context.Context, req *link.ListPublicShar
 
 func (s *service) UpdatePublicShare(ctx context.Context, req *link.UpdatePublicShareRequest) (*link.UpdatePublicShareResponse, error) {
 	log := appctx.GetLogger(ctx)
-	log.Info().Msg("list public share")
+	log.Info().Msg("update public share")
+	u, _ := user.ContextGetUser(ctx)
+
+	if _, ok := req.GetOpaque().GetMap()[publicshare.OpaqueRotateToken]; ok {
+		share, err := s.sm.RotatePublicShareToken(ctx, u, req.Ref)
+		if err != nil {
+			return &link.UpdatePublicShareResponse{
+				Status: errStatus(ctx, err, "error rotating public share token"),
+			}, nil
+		}
+		return &link.UpdatePublicShareResponse{
+			Status: status.NewOK(ctx),
+			Opaque: s.statsOpaque(ctx, share),
+			Share:  share,
+		}, nil
+	}
+
+	// the update travels in the opaque as the request has no field for it
+	e, ok := req.GetOpaque().GetMap()["update"]
+	if !ok {
+		return &link.UpdatePublicShareResponse{
+			Status: status.NewInvalidArg(ctx, "missing update"),
+		}, nil
+	}
+	update := &link.UpdatePublicShareRequest_Update{}
+	if err := json.Unmarshal(e.Value, update); err != nil {
+		return &link.UpdatePublicShareResponse{
+			Status: status.NewInvalidArg(ctx, "invalid update"),
+		}, nil
+	}
+
+	share, err := s.sm.UpdatePublicShare(ctx, u, req.Ref, update)
+	if err != nil {
+		return &link.UpdatePublicShareResponse{
+			Status: errStatus(ctx, err, "error updating public share"),
+		}, nil
+	}
 
 	res := &link.UpdatePublicShareResponse{
 		Status: status.NewOK(ctx),
+		Opaque: s.statsOpaque(ctx, share),
+		Share:  share,
 	}
 	return res, nil
 }
+
+// statsOpaque returns the opaque data carrying the statistics of the
+// shares. The statistics are only informative, they are omitted when they
+// can not be read.
+func (s *service) statsOpaque(ctx context.Context, shares ...*link.PublicShare) *types.Opaque {
+	ids := make([]string, 0, len(shares))
+	for _, share := range shares {
+		ids = append(ids, share.Id.GetOpaqueId())
+	}
+	stats, err := s.sm.GetPublicShareStats(ctx, ids)
+	if err != nil {
+		appctx.GetLogger(ctx).Warn().Err(err).Msg("error getting public share stats")
+		return nil
+	}
+	o, err := publicshare.StatsToOpaque(stats)
+	if err != nil {
+		appctx.GetLogger(ctx).Warn().Err(err).Msg("error encoding public share stats")
+		return nil
+	}
+	return o
+}
+
+func errStatus(ctx context.Context, err error, msg string) *rpc.Status {
+	switch err.(type) {
+	case errtypes.IsNotFound:
+		return status.NewNotFound(ctx, msg)
+	case errtypes.IsInvalidCredentials:
+		return status.NewUnauthenticated(ctx, err, msg)
+	case errtypes.IsPermissionDenied:
+		return status.NewPermissionDenied(ctx, err, msg)
+	case errtypes.IsNotSupported:
+		return status.NewInvalidArg(ctx, err.Error())
+	default:
+		return status.NewInternal(ctx, err, msg)
+	}
+}
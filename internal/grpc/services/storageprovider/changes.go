@@ -0,0 +1,100 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package storageprovider
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/journal"
+)
+
+// listChanges answers the ListContainer requests carrying a sync token with
+// the resources below the folder changed since the token, as the infos, and
+// the paths of the removed ones and the new token in the opaque data.
+func (s *service) listChanges(ctx context.Context, ref *provider.Reference, token string) *provider.ListContainerResponse {
+	j, ok := s.driver.(storage.ChangeJournal)
+	if !ok {
+		return &provider.ListContainerResponse{
+			Status: status.NewUnimplemented(ctx, errtypes.NotSupported("changes"), "storage driver does not record the changes"),
+		}
+	}
+
+	// the changes are relative to the path of the folder in the driver
+	md, err := s.storage.GetMD(ctx, ref)
+	if err != nil {
+		return &provider.ListContainerResponse{
+			Status: status.NewStatusFromErrType(ctx, "error statting folder", err),
+		}
+	}
+	changes, next, err := j.ListChanges(ctx, ref, token)
+	if err != nil {
+		return &provider.ListContainerResponse{
+			Status: status.NewStatusFromErrType(ctx, "error listing changes", err),
+		}
+	}
+
+	infos := []*provider.ResourceInfo{}
+	removed := []string{}
+	for _, c := range changes {
+		if c.Removed {
+			removed = append(removed, c.Path)
+			continue
+		}
+		cRef := &provider.Reference{Spec: &provider.Reference_Path{Path: path.Join(md.Path, c.Path)}}
+		info, err := s.storage.GetMD(ctx, cRef)
+		if err != nil {
+			// changed and then removed along with its folder
+			if _, ok := err.(errtypes.IsNotFound); ok {
+				removed = append(removed, c.Path)
+				continue
+			}
+			return &provider.ListContainerResponse{
+				Status: status.NewStatusFromErrType(ctx, "error statting changed resource", err),
+			}
+		}
+		if err := s.wrap(ctx, info); err != nil {
+			return &provider.ListContainerResponse{
+				Status: status.NewStatusFromErrType(ctx, "error wrapping path", err),
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	data, err := json.Marshal(removed)
+	if err != nil {
+		return &provider.ListContainerResponse{
+			Status: status.NewInternal(ctx, err, "error encoding removed resources"),
+		}
+	}
+	return &provider.ListContainerResponse{
+		Status: status.NewOK(ctx),
+		Infos:  infos,
+		Opaque: &typespb.Opaque{Map: map[string]*typespb.OpaqueEntry{
+			journal.TokenOpaqueKey:   {Decoder: "plain", Value: []byte(next)},
+			journal.RemovedOpaqueKey: {Decoder: "json", Value: data},
+		}},
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package storageprovider
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// createHome creates the home of the user in the context. A home created by
+// the call is provisioned with the initial quota and the content of the
+// skeleton folder, so that no out-of-band provisioning is needed.
+func (s *service) createHome(ctx context.Context) error {
+	if s.conf.HomeSkeleton == "" && s.conf.HomeQuota == 0 {
+		return s.storage.CreateHome(ctx)
+	}
+
+	root := &provider.Reference{Spec: &provider.Reference_Path{Path: "/"}}
+	_, err := s.storage.GetMD(ctx, root)
+	if _, notFound := errors.Cause(err).(errtypes.IsNotFound); err != nil && !notFound {
+		return err
+	}
+	exists := err == nil
+
+	if err := s.storage.CreateHome(ctx); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return s.provisionHome(ctx)
+}
+
+// provisionHome sets the initial quota of a new home and copies the skeleton
+// into it.
+func (s *service) provisionHome(ctx context.Context) error {
+	if s.conf.HomeQuota > 0 {
+		qs, ok := s.driver.(storage.HomeQuotaSetter)
+		if !ok {
+			return errtypes.NotSupported("storageprovider: the driver does not support setting the home quota")
+		}
+		if err := qs.SetHomeQuota(ctx, s.conf.HomeQuota); err != nil {
+			return errors.Wrap(err, "storageprovider: error setting home quota")
+		}
+	}
+
+	if s.conf.HomeSkeleton == "" {
+		return nil
+	}
+	log := appctx.GetLogger(ctx)
+	return filepath.Walk(s.conf.HomeSkeleton, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.conf.HomeSkeleton, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		fn := path.Join("/", filepath.ToSlash(rel))
+
+		switch {
+		case fi.IsDir():
+			if err := s.storage.CreateDir(ctx, fn); err != nil {
+				return errors.Wrap(err, "storageprovider: error creating skeleton folder "+fn)
+			}
+		case fi.Mode().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+			err = s.storage.Upload(ctx, ref, f)
+			f.Close()
+			if err != nil {
+				return errors.Wrap(err, "storageprovider: error uploading skeleton file "+fn)
+			}
+		default:
+			log.Warn().Str("path", p).Msg("storageprovider: skipping skeleton entry that is neither a file nor a folder")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package storageprovider
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	_ "github.com/cs3org/reva/pkg/storage/fs/local"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func TestCreateHomeProvisioning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reva-home-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	skeleton := filepath.Join(dir, "skeleton")
+	if err := os.MkdirAll(filepath.Join(skeleton, "Documents"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(skeleton, "Documents", "welcome.txt"), []byte("welcome"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &config{
+		Driver: "local",
+		Drivers: map[string]map[string]interface{}{
+			"local": {"root": filepath.Join(dir, "root"), "enable_home": true},
+		},
+		EnableHomeCreation: true,
+		HomeSkeleton:       skeleton,
+		HomeQuota:          1000,
+	}
+	fs, driver, err := getFS(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &service{conf: c, storage: fs, driver: driver}
+	ctx := user.ContextSetUser(context.Background(), &userpb.User{Username: "einstein"})
+
+	res, err := s.CreateHome(ctx, &provider.CreateHomeRequest{})
+	if err != nil || res.Status.Code != rpc.Code_CODE_OK {
+		t.Fatalf("CreateHome: %v %v", res.GetStatus(), err)
+	}
+
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: "/Documents/welcome.txt"}}
+	rc, err := fs.Download(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(b) != "welcome" {
+		t.Fatalf("skeleton file: %q %v", b, err)
+	}
+	total, _, err := fs.GetQuota(ctx)
+	if err != nil || total != 1000 {
+		t.Fatalf("quota: %d %v", total, err)
+	}
+
+	// an existing home is not provisioned again
+	if err := fs.Delete(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := s.CreateHome(ctx, &provider.CreateHomeRequest{}); err != nil || res.Status.Code != rpc.Code_CODE_OK {
+		t.Fatalf("CreateHome: %v %v", res.GetStatus(), err)
+	}
+	if _, err := fs.GetMD(ctx, ref); err == nil {
+		t.Fatal("skeleton copied into an existing home")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package storageprovider
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/locks"
+	"github.com/cs3org/reva/pkg/storage/locks/registry"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+func getLockManager(c *config) (locks.Manager, error) {
+	if c.LockManager == "" {
+		return nil, nil
+	}
+	f, ok := registry.NewFuncs[c.LockManager]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not found for lock manager", c.LockManager)
+	}
+	return f(c.LockManagers[c.LockManager])
+}
+
+// checkLocks returns an errtypes.Locked error if the resource, or with
+// children one below it, is locked by a lock the user did not create or
+// whose token is not in the opaque data of the request. The locks are kept
+// by path in the namespace of the gateway, like ocdav does.
+func (s *service) checkLocks(ctx context.Context, ref *provider.Reference, o *typespb.Opaque, children bool) error {
+	if s.locks == nil {
+		return nil
+	}
+
+	fn := ref.GetPath()
+	if fn == "" {
+		newRef, err := s.unwrap(ctx, ref)
+		if err != nil {
+			return err
+		}
+		md, err := s.storage.GetMD(ctx, newRef)
+		if err != nil {
+			if _, ok := err.(errtypes.IsNotFound); ok {
+				return nil
+			}
+			return err
+		}
+		fn = path.Join(s.mountPath, md.Path)
+	}
+
+	ls, err := s.locks.Locks(ctx, fn, children)
+	if err != nil || len(ls) == 0 {
+		return err
+	}
+	tokens, err := locks.TokensFromOpaque(o)
+	if err != nil {
+		return err
+	}
+	u, _ := ctxuser.ContextGetUser(ctx)
+	return locks.Check(ls, locks.UserID(u.GetId()), tokens)
+}
@@ -0,0 +1,77 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package storageprovider
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/locks"
+	"github.com/cs3org/reva/pkg/storage/locks/memory"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func TestCheckLocks(t *testing.T) {
+	lm, err := memory.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	einstein := &userpb.UserId{OpaqueId: "einstein", Idp: "cernbox.cern.ch"}
+	marie := &userpb.UserId{OpaqueId: "marie", Idp: "cernbox.cern.ch"}
+	ctx := context.Background()
+	if err := lm.Lock(ctx, &locks.Lock{Token: "t1", Root: "/home/docs", Infinite: true, UserID: locks.UserID(einstein)}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &service{mountPath: "/home", locks: lm}
+	withToken, err := locks.TokensToOpaque(nil, []string{"t1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+
+	tests := []struct {
+		name     string
+		user     *userpb.UserId
+		path     string
+		opaque   *typespb.Opaque
+		children bool
+		locked   bool
+	}{
+		{"owner with token", einstein, "/home/docs/a.txt", withToken, false, false},
+		{"owner without token", einstein, "/home/docs/a.txt", nil, false, true},
+		{"other user with token", marie, "/home/docs/a.txt", withToken, false, true},
+		{"parent", einstein, "/home", nil, false, false},
+		{"parent with children", einstein, "/home", nil, true, true},
+		{"unrelated", marie, "/home/other", nil, true, false},
+	}
+	for _, tt := range tests {
+		ctx := user.ContextSetUser(context.Background(), &userpb.User{Id: tt.user})
+		err := s.checkLocks(ctx, ref(tt.path), tt.opaque, tt.children)
+		if _, ok := err.(errtypes.IsLocked); ok != tt.locked {
+			t.Errorf("%s: got %v, locked %v", tt.name, err, tt.locked)
+		}
+	}
+}
@@ -21,22 +21,32 @@ package storageprovider
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
 	"strings"
+	"time"
 
-	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	registrypb "github.com/cs3org/go-cs3apis/cs3/storage/registry/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
 	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/rgrpc"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/conditions"
+	"github.com/cs3org/reva/pkg/storage/encryption"
 	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/storage/journal"
+	"github.com/cs3org/reva/pkg/storage/locks"
+	"github.com/cs3org/reva/pkg/storage/registry/etcd"
+	"github.com/cs3org/reva/pkg/storage/tracing"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
-	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 )
 
@@ -56,6 +66,28 @@ type config struct {
 	ExposeDataServer   bool                              `mapstructure:"expose_data_server"` // if true the client will be able to upload/download directly to it
 	EnableHomeCreation bool                              `mapstructure:"enable_home_creation"`
 	AvailableXS        map[string]uint32                 `mapstructure:"available_checksums"`
+	// Register is the configuration of the etcd registry the provider registers to.
+	Register map[string]interface{} `mapstructure:"register"`
+	// Encryption must match the one of the data providers of the storage
+	// for the sizes of the encrypted files to be reported right.
+	Encryption encryption.Config `mapstructure:"encryption"`
+	// HomeSkeleton is a local folder whose content is copied into the homes
+	// when they are created.
+	HomeSkeleton string `mapstructure:"home_skeleton"`
+	// HomeQuota is the quota in bytes set on the homes when they are created.
+	HomeQuota int `mapstructure:"home_quota"`
+	// PresignedURLs points the clients to URLs presigned by the storage
+	// backend, for the drivers supporting it, so the data does not go
+	// through the data servers. It is ignored with encryption.
+	PresignedURLs bool `mapstructure:"presigned_urls"`
+	// PresignedURLsExpires is the number of seconds the presigned URLs are
+	// valid for.
+	PresignedURLsExpires int `mapstructure:"presigned_urls_expires"`
+	// LockManager keeps the WebDAV locks, it must be the one of ocdav for
+	// the changes made through the other clients to respect the locks.
+	// Disabled if empty.
+	LockManager  string                            `mapstructure:"lock_manager"`
+	LockManagers map[string]map[string]interface{} `mapstructure:"lock_managers"`
 }
 
 type service struct {
@@ -65,9 +97,20 @@ type service struct {
 	tmpFolder          string
 	dataServerURL      *url.URL
 	availableXS        []*provider.ResourceChecksumPriority
+	registration       io.Closer
+	// driver is the storage driver before it is wrapped, for the optional
+	// interfaces the wrappers do not expose.
+	driver storage.FS
+	// locks is nil when the locks are not enforced.
+	locks locks.Manager
 }
 
 func (s *service) Close() error {
+	if s.registration != nil {
+		if err := s.registration.Close(); err != nil {
+			return err
+		}
+	}
 	return s.storage.Shutdown(context.Background())
 }
 
@@ -115,6 +158,10 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		c.AvailableXS = map[string]uint32{"md5": 100, "unset": 1000}
 	}
 
+	if c.PresignedURLsExpires == 0 {
+		c.PresignedURLsExpires = 300
+	}
+
 	// use os temporary folder if empty
 	tmpFolder := c.TmpFolder
 	if tmpFolder == "" {
@@ -128,7 +175,7 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 	mountPath := c.MountPath
 	mountID := c.MountID
 
-	fs, err := getFS(c)
+	fs, driver, err := getFS(c)
 	if err != nil {
 		return nil, err
 	}
@@ -149,14 +196,31 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		return nil, fmt.Errorf("no available checksum, please set in config")
 	}
 
+	lm, err := getLockManager(c)
+	if err != nil {
+		return nil, err
+	}
+
 	service := &service{
 		conf:          c,
 		storage:       fs,
+		driver:        driver,
 		tmpFolder:     tmpFolder,
 		mountPath:     mountPath,
 		mountID:       mountID,
 		dataServerURL: u,
 		availableXS:   xsTypes,
+		locks:         lm,
+	}
+
+	if c.Register != nil {
+		service.registration, err = etcd.Advertise(c.Register, &registrypb.ProviderInfo{
+			ProviderPath: mountPath,
+			ProviderId:   mountID,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "storageprovider: error registering provider")
+		}
 	}
 
 	return service, nil
@@ -167,17 +231,18 @@ func (s *service) SetArbitraryMetadata(ctx context.Context, req *provider.SetArb
 	if err != nil {
 		err := errors.Wrap(err, "storageprovidersvc: error unwrapping path")
 		return &provider.SetArbitraryMetadataResponse{
-			Status: status.NewInternal(ctx, err, "error setting arbitrary metadata"),
+			Status: status.NewStatusFromErrType(ctx, "error setting arbitrary metadata", err),
+		}, nil
+	}
+
+	if err := s.checkLocks(ctx, req.Ref, req.Opaque, false); err != nil {
+		return &provider.SetArbitraryMetadataResponse{
+			Status: status.NewStatusFromErrType(ctx, "error setting arbitrary metadata", err),
 		}, nil
 	}
 
 	if err := s.storage.SetArbitraryMetadata(ctx, newRef, req.ArbitraryMetadata); err != nil {
-		var st *rpc.Status
-		if _, ok := err.(errtypes.IsNotFound); ok {
-			st = status.NewNotFound(ctx, "ref not found when setting arbitrary metadata")
-		} else {
-			st = status.NewInternal(ctx, err, "error setting arbitrary metadata: "+req.Ref.String())
-		}
+		st := status.NewStatusFromErrType(ctx, "error setting arbitrary metadata: "+req.Ref.String(), err)
 		return &provider.SetArbitraryMetadataResponse{
 			Status: st,
 		}, nil
@@ -194,17 +259,18 @@ func (s *service) UnsetArbitraryMetadata(ctx context.Context, req *provider.Unse
 	if err != nil {
 		err := errors.Wrap(err, "storageprovidersvc: error unwrapping path")
 		return &provider.UnsetArbitraryMetadataResponse{
-			Status: status.NewInternal(ctx, err, "error unsetting arbitrary metadata"),
+			Status: status.NewStatusFromErrType(ctx, "error unsetting arbitrary metadata", err),
+		}, nil
+	}
+
+	if err := s.checkLocks(ctx, req.Ref, req.Opaque, false); err != nil {
+		return &provider.UnsetArbitraryMetadataResponse{
+			Status: status.NewStatusFromErrType(ctx, "error unsetting arbitrary metadata", err),
 		}, nil
 	}
 
 	if err := s.storage.UnsetArbitraryMetadata(ctx, newRef, req.ArbitraryMetadataKeys); err != nil {
-		var st *rpc.Status
-		if _, ok := err.(errtypes.IsNotFound); ok {
-			st = status.NewNotFound(ctx, "path not found when unsetting arbitrary metadata")
-		} else {
-			st = status.NewInternal(ctx, err, "error unsetting arbitrary metadata: "+req.Ref.String())
-		}
+		st := status.NewStatusFromErrType(ctx, "error unsetting arbitrary metadata: "+req.Ref.String(), err)
 		return &provider.UnsetArbitraryMetadataResponse{
 			Status: st,
 		}, nil
@@ -223,14 +289,36 @@ func (s *service) InitiateFileDownload(ctx context.Context, req *provider.Initia
 	// For example, https://data-server.example.org/home/docs/myfile.txt
 	// or ownclouds://data-server.example.org/home/docs/myfile.txt
 	log := appctx.GetLogger(ctx)
+	// a version of the file is requested through the opaque
+	var query string
+	if e, ok := req.GetOpaque().GetMap()["version"]; ok {
+		query = url.Values{"version": []string{string(e.Value)}}.Encode()
+	}
 	url := *s.dataServerURL
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.InitiateFileDownloadResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}, nil
 	}
+	if signer, ok := s.urlSigner(); ok && query == "" {
+		signed, err := signer.DownloadURL(ctx, newRef, s.presignedTTL())
+		if err == nil {
+			return &provider.InitiateFileDownloadResponse{
+				DownloadEndpoint: signed,
+				Status:           status.NewOK(ctx),
+				Expose:           true,
+			}, nil
+		}
+		// the transfers the driver does not presign go through the data server
+		if _, ok := err.(errtypes.IsNotSupported); !ok {
+			return &provider.InitiateFileDownloadResponse{
+				Status: status.NewStatusFromErrType(ctx, "error presigning download url", err),
+			}, nil
+		}
+	}
 	url.Path = path.Join("/", url.Path, newRef.GetPath())
+	url.RawQuery = query
 	log.Info().Str("data-server", url.String()).Str("fn", req.Ref.GetPath()).Msg("file download")
 	res := &provider.InitiateFileDownloadResponse{
 		DownloadEndpoint: url.String(),
@@ -247,9 +335,30 @@ func (s *service) InitiateFileUpload(ctx context.Context, req *provider.Initiate
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.InitiateFileUploadResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
+		}, nil
+	}
+	if err := s.checkLocks(ctx, req.Ref, req.Opaque, false); err != nil {
+		return &provider.InitiateFileUploadResponse{
+			Status: status.NewStatusFromErrType(ctx, "error initiating upload", err),
 		}, nil
 	}
+	if signer, ok := s.urlSigner(); ok {
+		signed, err := signer.UploadURL(ctx, newRef, s.presignedTTL())
+		if err == nil {
+			return &provider.InitiateFileUploadResponse{
+				UploadEndpoint:     signed,
+				Status:             status.NewOK(ctx),
+				AvailableChecksums: s.availableXS,
+				Expose:             true,
+			}, nil
+		}
+		if _, ok := err.(errtypes.IsNotSupported); !ok {
+			return &provider.InitiateFileUploadResponse{
+				Status: status.NewStatusFromErrType(ctx, "error presigning upload url", err),
+			}, nil
+		}
+	}
 	url.Path = path.Join("/", url.Path, newRef.GetPath())
 	log.Info().Str("data-server", url.String()).
 		Str("fn", req.Ref.GetPath()).
@@ -264,12 +373,35 @@ func (s *service) InitiateFileUpload(ctx context.Context, req *provider.Initiate
 	return res, nil
 }
 
+// urlSigner returns the driver presigning the transfer URLs, when enabled.
+// The encrypted files can only go through the data servers.
+func (s *service) urlSigner() (storage.URLSigner, bool) {
+	if !s.conf.PresignedURLs || s.conf.Encryption.KeyProvider != "" {
+		return nil, false
+	}
+	signer, ok := s.driver.(storage.URLSigner)
+	return signer, ok
+}
+
+func (s *service) presignedTTL() time.Duration {
+	return time.Duration(s.conf.PresignedURLsExpires) * time.Second
+}
+
 func (s *service) GetPath(ctx context.Context, req *provider.GetPathRequest) (*provider.GetPathResponse, error) {
-	// TODO(labkode): check that the storage ID is the same as the storage provider id.
+	if req.ResourceId == nil {
+		return &provider.GetPathResponse{
+			Status: status.NewInvalidArg(ctx, "resource id is required"),
+		}, nil
+	}
+	if sid := req.ResourceId.StorageId; sid != "" && s.mountID != "" && sid != s.mountID {
+		return &provider.GetPathResponse{
+			Status: status.NewNotFound(ctx, "resource id of another storage"),
+		}, nil
+	}
 	fn, err := s.storage.GetPathByID(ctx, req.ResourceId)
 	if err != nil {
 		return &provider.GetPathResponse{
-			Status: status.NewInternal(ctx, err, "error getting path by id"),
+			Status: status.NewStatusFromErrType(ctx, "error getting path by id", err),
 		}, nil
 	}
 
@@ -285,7 +417,7 @@ func (s *service) GetHome(ctx context.Context, req *provider.GetHomeRequest) (*p
 	/*
 		relativeHome, err := s.storage.GetHome(ctx)
 		if err != nil {
-			st := status.NewInternal(ctx, err, "error getting home")
+			st := status.NewStatusFromErrType(ctx, "error getting home", err)
 			return &provider.GetHomeResponse{
 				Status: st,
 			}, nil
@@ -314,8 +446,8 @@ func (s *service) CreateHome(ctx context.Context, req *provider.CreateHomeReques
 		}, nil
 
 	}
-	if err := s.storage.CreateHome(ctx); err != nil {
-		st := status.NewInternal(ctx, err, "error creating home")
+	if err := s.createHome(ctx); err != nil {
+		st := status.NewStatusFromErrType(ctx, "error creating home", err)
 		log.Err(err).Msg("storageprovider: error calling CreateHome of storage driver")
 		return &provider.CreateHomeResponse{
 			Status: st,
@@ -333,17 +465,18 @@ func (s *service) CreateContainer(ctx context.Context, req *provider.CreateConta
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.CreateContainerResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
+		}, nil
+	}
+
+	if err := s.checkLocks(ctx, req.Ref, req.Opaque, false); err != nil {
+		return &provider.CreateContainerResponse{
+			Status: status.NewStatusFromErrType(ctx, "error creating container: "+req.Ref.String(), err),
 		}, nil
 	}
 
 	if err := s.storage.CreateDir(ctx, newRef.GetPath()); err != nil {
-		var st *rpc.Status
-		if _, ok := err.(errtypes.IsNotFound); ok {
-			st = status.NewNotFound(ctx, "path not found when creating container")
-		} else {
-			st = status.NewInternal(ctx, err, "error creating container: "+req.Ref.String())
-		}
+		st := status.NewStatusFromErrType(ctx, "error creating container: "+req.Ref.String(), err)
 		return &provider.CreateContainerResponse{
 			Status: st,
 		}, nil
@@ -359,17 +492,25 @@ func (s *service) Delete(ctx context.Context, req *provider.DeleteRequest) (*pro
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.DeleteResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
+		}, nil
+	}
+
+	if err := s.checkLocks(ctx, req.Ref, req.Opaque, true); err != nil {
+		return &provider.DeleteResponse{
+			Status: status.NewStatusFromErrType(ctx, "error deleting file: "+req.Ref.String(), err),
+		}, nil
+	}
+
+	ctx, err = s.withPreconditions(ctx, req.Opaque, newRef)
+	if err != nil {
+		return &provider.DeleteResponse{
+			Status: status.NewStatusFromErrType(ctx, "error checking preconditions: "+req.Ref.String(), err),
 		}, nil
 	}
 
 	if err := s.storage.Delete(ctx, newRef); err != nil {
-		var st *rpc.Status
-		if _, ok := err.(errtypes.IsNotFound); ok {
-			st = status.NewNotFound(ctx, "file not found")
-		} else {
-			st = status.NewInternal(ctx, err, "error deleting file: "+req.Ref.String())
-		}
+		st := status.NewStatusFromErrType(ctx, "error deleting file: "+req.Ref.String(), err)
 		return &provider.DeleteResponse{
 			Status: st,
 		}, nil
@@ -385,19 +526,35 @@ func (s *service) Move(ctx context.Context, req *provider.MoveRequest) (*provide
 	sourceRef, err := s.unwrap(ctx, req.Source)
 	if err != nil {
 		return &provider.MoveResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping source path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping source path", err),
 		}, nil
 	}
 	targetRef, err := s.unwrap(ctx, req.Destination)
 	if err != nil {
 		return &provider.MoveResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping destination path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping destination path", err),
+		}, nil
+	}
+
+	for _, ref := range []*provider.Reference{req.Source, req.Destination} {
+		if err := s.checkLocks(ctx, ref, req.Opaque, true); err != nil {
+			return &provider.MoveResponse{
+				Status: status.NewStatusFromErrType(ctx, "error moving file", err),
+			}, nil
+		}
+	}
+
+	ctx, err = s.withPreconditions(ctx, req.Opaque, sourceRef)
+	if err != nil {
+		return &provider.MoveResponse{
+			Status: status.NewStatusFromErrType(ctx, "error checking preconditions", err),
 		}, nil
 	}
 
 	if err := s.storage.Move(ctx, sourceRef, targetRef); err != nil {
+		st := status.NewStatusFromErrType(ctx, "error moving file", err)
 		return &provider.MoveResponse{
-			Status: status.NewInternal(ctx, err, "error moving file"),
+			Status: st,
 		}, nil
 	}
 
@@ -407,29 +564,36 @@ func (s *service) Move(ctx context.Context, req *provider.MoveRequest) (*provide
 	return res, nil
 }
 
+// withPreconditions returns the context carrying the preconditions sent
+// in the opaque data of the request, for the driver to check them with the
+// change, after verifying them against the current state of the resource.
+func (s *service) withPreconditions(ctx context.Context, o *typespb.Opaque, ref *provider.Reference) (context.Context, error) {
+	p, err := conditions.FromOpaque(o)
+	if err != nil || p == nil {
+		return ctx, err
+	}
+	ctx = conditions.ContextSetPreconditions(ctx, p)
+	return ctx, conditions.Verify(ctx, s.storage, ref)
+}
+
 func (s *service) Stat(ctx context.Context, req *provider.StatRequest) (*provider.StatResponse, error) {
 	ctx, span := trace.StartSpan(ctx, "Stat")
 	defer span.End()
 
-	span.AddAttributes(
-		trace.StringAttribute("ref", req.Ref.String()),
+	span.SetAttributes(
+		attribute.String("ref", req.Ref.String()),
 	)
 
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.StatResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}, nil
 	}
 
 	md, err := s.storage.GetMD(ctx, newRef)
 	if err != nil {
-		var st *rpc.Status
-		if _, ok := err.(errtypes.IsNotFound); ok {
-			st = status.NewNotFound(ctx, "file not found")
-		} else {
-			st = status.NewInternal(ctx, err, "error stating file: "+req.Ref.String())
-		}
+		st := status.NewStatusFromErrType(ctx, "error stating file: "+req.Ref.String(), err)
 		return &provider.StatResponse{
 			Status: st,
 		}, nil
@@ -437,7 +601,7 @@ func (s *service) Stat(ctx context.Context, req *provider.StatRequest) (*provide
 
 	if err := s.wrap(ctx, md); err != nil {
 		return &provider.StatResponse{
-			Status: status.NewInternal(ctx, err, "error wrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error wrapping path", err),
 		}, nil
 	}
 	res := &provider.StatResponse{
@@ -454,7 +618,7 @@ func (s *service) ListContainerStream(req *provider.ListContainerStreamRequest,
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		res := &provider.ListContainerStreamResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}
 		if err := ss.Send(res); err != nil {
 			log.Error().Err(err).Msg("ListContainerStream: error sending response")
@@ -466,7 +630,7 @@ func (s *service) ListContainerStream(req *provider.ListContainerStreamRequest,
 	mds, err := s.storage.ListFolder(ctx, newRef)
 	if err != nil {
 		res := &provider.ListContainerStreamResponse{
-			Status: status.NewInternal(ctx, err, "error listing folder"),
+			Status: status.NewStatusFromErrType(ctx, "error listing folder", err),
 		}
 		if err := ss.Send(res); err != nil {
 			log.Error().Err(err).Msg("ListContainerStream: error sending response")
@@ -478,7 +642,7 @@ func (s *service) ListContainerStream(req *provider.ListContainerStreamRequest,
 	for _, md := range mds {
 		if err := s.wrap(ctx, md); err != nil {
 			res := &provider.ListContainerStreamResponse{
-				Status: status.NewInternal(ctx, err, "error wrapping path"),
+				Status: status.NewStatusFromErrType(ctx, "error wrapping path", err),
 			}
 			if err := ss.Send(res); err != nil {
 				log.Error().Err(err).Msg("ListContainerStream: error sending response")
@@ -503,14 +667,20 @@ func (s *service) ListContainer(ctx context.Context, req *provider.ListContainer
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.ListContainerResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}, nil
 	}
 
+	// the sync clients ask for the changes since their token
+	if e, ok := req.GetOpaque().GetMap()[journal.TokenOpaqueKey]; ok {
+		return s.listChanges(ctx, newRef, string(e.Value)), nil
+	}
+
 	mds, err := s.storage.ListFolder(ctx, newRef)
 	if err != nil {
+		st := status.NewStatusFromErrType(ctx, "error listing folder", err)
 		return &provider.ListContainerResponse{
-			Status: status.NewInternal(ctx, err, "error listing folder"),
+			Status: st,
 		}, nil
 	}
 
@@ -518,7 +688,7 @@ func (s *service) ListContainer(ctx context.Context, req *provider.ListContainer
 	for _, md := range mds {
 		if err := s.wrap(ctx, md); err != nil {
 			return &provider.ListContainerResponse{
-				Status: status.NewInternal(ctx, err, "error wrapping path"),
+				Status: status.NewStatusFromErrType(ctx, "error wrapping path", err),
 			}, nil
 		}
 		infos = append(infos, md)
@@ -534,14 +704,15 @@ func (s *service) ListFileVersions(ctx context.Context, req *provider.ListFileVe
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.ListFileVersionsResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}, nil
 	}
 
 	revs, err := s.storage.ListRevisions(ctx, newRef)
 	if err != nil {
+		st := status.NewStatusFromErrType(ctx, "error listing file versions", err)
 		return &provider.ListFileVersionsResponse{
-			Status: status.NewInternal(ctx, err, "error listing file versions"),
+			Status: st,
 		}, nil
 	}
 
@@ -556,13 +727,20 @@ func (s *service) RestoreFileVersion(ctx context.Context, req *provider.RestoreF
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.RestoreFileVersionResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
+		}, nil
+	}
+
+	if err := s.checkLocks(ctx, req.Ref, req.Opaque, false); err != nil {
+		return &provider.RestoreFileVersionResponse{
+			Status: status.NewStatusFromErrType(ctx, "error restoring version", err),
 		}, nil
 	}
 
 	if err := s.storage.RestoreRevision(ctx, newRef, req.Key); err != nil {
+		st := status.NewStatusFromErrType(ctx, "error restoring version", err)
 		return &provider.RestoreFileVersionResponse{
-			Status: status.NewInternal(ctx, err, "error restoring version"),
+			Status: st,
 		}, nil
 	}
 
@@ -579,7 +757,7 @@ func (s *service) ListRecycleStream(req *provider.ListRecycleStreamRequest, ss p
 	items, err := s.storage.ListRecycle(ctx)
 	if err != nil {
 		res := &provider.ListRecycleStreamResponse{
-			Status: status.NewInternal(ctx, err, "error listing recycle"),
+			Status: status.NewStatusFromErrType(ctx, "error listing recycle", err),
 		}
 		if err := ss.Send(res); err != nil {
 			log.Error().Err(err).Msg("ListRecycleStream: error sending response")
@@ -606,8 +784,9 @@ func (s *service) ListRecycle(ctx context.Context, req *provider.ListRecycleRequ
 	items, err := s.storage.ListRecycle(ctx)
 	// TODO(labkode): CRITICAL: fill recycle info with storage provider.
 	if err != nil {
+		st := status.NewStatusFromErrType(ctx, "error listing recycle bin", err)
 		return &provider.ListRecycleResponse{
-			Status: status.NewInternal(ctx, err, "error listing recycle bin"),
+			Status: st,
 		}, nil
 	}
 
@@ -621,8 +800,9 @@ func (s *service) ListRecycle(ctx context.Context, req *provider.ListRecycleRequ
 func (s *service) RestoreRecycleItem(ctx context.Context, req *provider.RestoreRecycleItemRequest) (*provider.RestoreRecycleItemResponse, error) {
 	// TODO(labkode): CRITICAL: fill recycle info with storage provider.
 	if err := s.storage.RestoreRecycleItem(ctx, req.Key); err != nil {
+		st := status.NewStatusFromErrType(ctx, "error restoring recycle bin item", err)
 		return &provider.RestoreRecycleItemResponse{
-			Status: status.NewInternal(ctx, err, "error restoring recycle bin item"),
+			Status: st,
 		}, nil
 	}
 
@@ -636,14 +816,15 @@ func (s *service) PurgeRecycle(ctx context.Context, req *provider.PurgeRecycleRe
 	// if a key was sent as opacque id purge only that item
 	if req.GetRef().GetId() != nil && req.GetRef().GetId().GetOpaqueId() != "" {
 		if err := s.storage.PurgeRecycleItem(ctx, req.GetRef().GetId().GetOpaqueId()); err != nil {
+			st := status.NewStatusFromErrType(ctx, "error purging recycle item", err)
 			return &provider.PurgeRecycleResponse{
-				Status: status.NewInternal(ctx, err, "error purging recycle item"),
+				Status: st,
 			}, nil
 		}
 	} else if err := s.storage.EmptyRecycle(ctx); err != nil {
 		// otherwise try emptying the whole recycle bin
 		return &provider.PurgeRecycleResponse{
-			Status: status.NewInternal(ctx, err, "error emptying recycle bin"),
+			Status: status.NewStatusFromErrType(ctx, "error emptying recycle bin", err),
 		}, nil
 	}
 
@@ -668,14 +849,15 @@ func (s *service) AddGrant(ctx context.Context, req *provider.AddGrantRequest) (
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.AddGrantResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}, nil
 	}
 
 	err = s.storage.AddGrant(ctx, newRef, req.Grant)
 	if err != nil {
+		st := status.NewStatusFromErrType(ctx, "error setting ACL", err)
 		return &provider.AddGrantResponse{
-			Status: status.NewInternal(ctx, err, "error setting ACL"),
+			Status: st,
 		}, nil
 	}
 
@@ -706,14 +888,14 @@ func (s *service) CreateReference(ctx context.Context, req *provider.CreateRefer
 	newRef, err := s.unwrap(ctx, ref)
 	if err != nil {
 		return &provider.CreateReferenceResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}, nil
 	}
 
 	if err := s.storage.CreateReference(ctx, newRef.GetPath(), u); err != nil {
 		log.Err(err).Msg("error calling CreateReference")
 		return &provider.CreateReferenceResponse{
-			Status: status.NewInternal(ctx, err, "error creating reference"),
+			Status: status.NewStatusFromErrType(ctx, "error creating reference", err),
 		}, nil
 	}
 
@@ -733,13 +915,14 @@ func (s *service) UpdateGrant(ctx context.Context, req *provider.UpdateGrantRequ
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.UpdateGrantResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}, nil
 	}
 
 	if err := s.storage.UpdateGrant(ctx, newRef, req.Grant); err != nil {
+		st := status.NewStatusFromErrType(ctx, "error updating ACL", err)
 		return &provider.UpdateGrantResponse{
-			Status: status.NewInternal(ctx, err, "error updating ACL"),
+			Status: st,
 		}, nil
 	}
 
@@ -760,13 +943,14 @@ func (s *service) RemoveGrant(ctx context.Context, req *provider.RemoveGrantRequ
 	newRef, err := s.unwrap(ctx, req.Ref)
 	if err != nil {
 		return &provider.RemoveGrantResponse{
-			Status: status.NewInternal(ctx, err, "error unwrapping path"),
+			Status: status.NewStatusFromErrType(ctx, "error unwrapping path", err),
 		}, nil
 	}
 
 	if err := s.storage.RemoveGrant(ctx, newRef, req.Grant); err != nil {
+		st := status.NewStatusFromErrType(ctx, "error removing ACL", err)
 		return &provider.RemoveGrantResponse{
-			Status: status.NewInternal(ctx, err, "error removing ACL"),
+			Status: st,
 		}, nil
 	}
 
@@ -779,8 +963,13 @@ func (s *service) RemoveGrant(ctx context.Context, req *provider.RemoveGrantRequ
 func (s *service) GetQuota(ctx context.Context, req *provider.GetQuotaRequest) (*provider.GetQuotaResponse, error) {
 	total, used, err := s.storage.GetQuota(ctx)
 	if err != nil {
+		if _, ok := err.(errtypes.IsNotSupported); ok {
+			return &provider.GetQuotaResponse{
+				Status: status.NewUnimplemented(ctx, err, "quota is not supported by the storage"),
+			}, nil
+		}
 		return &provider.GetQuotaResponse{
-			Status: status.NewInternal(ctx, err, "error getting quota"),
+			Status: status.NewStatusFromErrType(ctx, "error getting quota", err),
 		}, nil
 	}
 
@@ -792,11 +981,20 @@ func (s *service) GetQuota(ctx context.Context, req *provider.GetQuotaRequest) (
 	return res, nil
 }
 
-func getFS(c *config) (storage.FS, error) {
+// getFS returns the wrapped storage driver and the driver itself.
+func getFS(c *config) (storage.FS, storage.FS, error) {
 	if f, ok := registry.NewFuncs[c.Driver]; ok {
-		return f(c.Drivers[c.Driver])
+		driver, err := f(c.Drivers[c.Driver])
+		if err != nil {
+			return nil, nil, err
+		}
+		fs, err := encryption.Wrap(driver, c.Encryption)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tracing.New(fs, c.Driver), driver, nil
 	}
-	return nil, fmt.Errorf("driver not found: %s", c.Driver)
+	return nil, nil, fmt.Errorf("driver not found: %s", c.Driver)
 }
 
 func (s *service) unwrap(ctx context.Context, ref *provider.Reference) (*provider.Reference, error) {
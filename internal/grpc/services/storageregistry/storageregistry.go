@@ -21,6 +21,7 @@ package storageregistry
 import (
 	"context"
 	"fmt"
+	"io"
 
 	registrypb "github.com/cs3org/go-cs3apis/cs3/storage/registry/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
@@ -41,6 +42,9 @@ type service struct {
 }
 
 func (s *service) Close() error {
+	if c, ok := s.reg.(io.Closer); ok {
+		return c.Close()
+	}
 	return nil
 }
 
@@ -0,0 +1,160 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package userprovider
+
+import (
+	"context"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/cs3org/reva/pkg/user/provisioning"
+)
+
+// The provisioning API lets the admins manage all the users, and the other
+// users read and change their own account, except its quota and state.
+
+// caller returns the id of the user in ctx and tells if it is an admin.
+func (s *service) caller(ctx context.Context) (*userpb.UserId, bool) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		return nil, false
+	}
+	admin, err := s.isInGroup(ctx, u.Id, s.conf.AdminGroup)
+	if err != nil {
+		if _, notFound := err.(errtypes.IsNotFound); !notFound {
+			appctx.GetLogger(ctx).Error().Err(err).Msg("userprovidersvc: error checking admin group")
+		}
+		return u.Id, false
+	}
+	return u.Id, admin
+}
+
+func sameUser(a, b *userpb.UserId) bool {
+	return a != nil && b != nil && a.OpaqueId == b.OpaqueId && (a.Idp == "" || b.Idp == "" || a.Idp == b.Idp)
+}
+
+func (s *service) GetAccount(ctx context.Context, req *provisioning.GetAccountRequest) (*provisioning.GetAccountResponse, error) {
+	caller, admin := s.caller(ctx)
+	if !admin && req.UserID != nil && !sameUser(req.UserID, caller) {
+		return &provisioning.GetAccountResponse{Status: status.NewPermissionDenied(ctx, nil, "only admins can read other accounts")}, nil
+	}
+
+	var a *user.Account
+	var err error
+	if req.UserID != nil {
+		a, err = s.prov.GetAccount(ctx, req.UserID)
+	} else {
+		a, err = s.prov.GetAccountByUsername(ctx, req.Username)
+	}
+	if err == nil && !admin && !sameUser(a.User.Id, caller) {
+		err = errtypes.PermissionDenied(req.Username)
+	}
+	if err != nil {
+		return &provisioning.GetAccountResponse{Status: status.NewStatusFromErrType(ctx, "error getting account", err)}, nil
+	}
+	return &provisioning.GetAccountResponse{Status: status.NewOK(ctx), Account: a}, nil
+}
+
+func (s *service) CreateUser(ctx context.Context, req *provisioning.CreateUserRequest) (*provisioning.CreateUserResponse, error) {
+	if _, admin := s.caller(ctx); !admin {
+		return &provisioning.CreateUserResponse{Status: status.NewPermissionDenied(ctx, nil, "only admins can create users")}, nil
+	}
+	if req.User == nil || req.User.Username == "" || req.Password == "" {
+		return &provisioning.CreateUserResponse{Status: status.NewInvalidArg(ctx, "username and password are required")}, nil
+	}
+	if err := s.prov.CreateUser(ctx, req.User, req.Password); err != nil {
+		return &provisioning.CreateUserResponse{Status: status.NewStatusFromErrType(ctx, "error creating user", err)}, nil
+	}
+	return &provisioning.CreateUserResponse{Status: status.NewOK(ctx), User: req.User}, nil
+}
+
+func (s *service) UpdateAccount(ctx context.Context, req *provisioning.UpdateAccountRequest) (*provisioning.Response, error) {
+	if req.Account == nil || req.Account.User == nil {
+		return &provisioning.Response{Status: status.NewInvalidArg(ctx, "account is required")}, nil
+	}
+	caller, admin := s.caller(ctx)
+	self := sameUser(req.Account.User.Id, caller)
+	if !admin && !self {
+		return &provisioning.Response{Status: status.NewPermissionDenied(ctx, nil, "only admins can change other accounts")}, nil
+	}
+
+	old, err := s.prov.GetAccount(ctx, req.Account.User.Id)
+	if err != nil {
+		return &provisioning.Response{Status: status.NewStatusFromErrType(ctx, "error getting account", err)}, nil
+	}
+	switch {
+	case !admin && (req.Account.Quota != old.Quota || req.Account.Disabled != old.Disabled):
+		return &provisioning.Response{Status: status.NewPermissionDenied(ctx, nil, "only admins can change the quota and the state of accounts")}, nil
+	case self && req.Account.Disabled && !old.Disabled:
+		return &provisioning.Response{Status: status.NewPermissionDenied(ctx, nil, "users can not disable their own account")}, nil
+	}
+
+	if err := s.prov.UpdateAccount(ctx, req.Account); err != nil {
+		return &provisioning.Response{Status: status.NewStatusFromErrType(ctx, "error updating account", err)}, nil
+	}
+	return &provisioning.Response{Status: status.NewOK(ctx)}, nil
+}
+
+func (s *service) SetPassword(ctx context.Context, req *provisioning.SetPasswordRequest) (*provisioning.Response, error) {
+	if caller, admin := s.caller(ctx); !admin && !sameUser(req.UserID, caller) {
+		return &provisioning.Response{Status: status.NewPermissionDenied(ctx, nil, "only admins can set the password of other users")}, nil
+	}
+	if req.Password == "" {
+		return &provisioning.Response{Status: status.NewInvalidArg(ctx, "password is required")}, nil
+	}
+	if err := s.prov.SetPassword(ctx, req.UserID, req.Password); err != nil {
+		return &provisioning.Response{Status: status.NewStatusFromErrType(ctx, "error setting password", err)}, nil
+	}
+	return &provisioning.Response{Status: status.NewOK(ctx)}, nil
+}
+
+func (s *service) DeleteUser(ctx context.Context, req *provisioning.DeleteUserRequest) (*provisioning.Response, error) {
+	caller, admin := s.caller(ctx)
+	if !admin || sameUser(req.UserID, caller) {
+		return &provisioning.Response{Status: status.NewPermissionDenied(ctx, nil, "only admins can delete users, except themselves")}, nil
+	}
+	if err := s.prov.DeleteUser(ctx, req.UserID); err != nil {
+		return &provisioning.Response{Status: status.NewStatusFromErrType(ctx, "error deleting user", err)}, nil
+	}
+	return &provisioning.Response{Status: status.NewOK(ctx)}, nil
+}
+
+func (s *service) AddToGroup(ctx context.Context, req *provisioning.GroupRequest) (*provisioning.Response, error) {
+	return s.changeGroup(ctx, req, s.prov.AddToGroup)
+}
+
+func (s *service) RemoveFromGroup(ctx context.Context, req *provisioning.GroupRequest) (*provisioning.Response, error) {
+	return s.changeGroup(ctx, req, s.prov.RemoveFromGroup)
+}
+
+func (s *service) changeGroup(ctx context.Context, req *provisioning.GroupRequest, change func(context.Context, *userpb.UserId, string) error) (*provisioning.Response, error) {
+	if _, admin := s.caller(ctx); !admin {
+		return &provisioning.Response{Status: status.NewPermissionDenied(ctx, nil, "only admins can change the groups")}, nil
+	}
+	if req.Group == "" {
+		return &provisioning.Response{Status: status.NewInvalidArg(ctx, "group is required")}, nil
+	}
+	if err := change(ctx, req.UserID, req.Group); err != nil {
+		return &provisioning.Response{Status: status.NewStatusFromErrType(ctx, "error changing groups", err)}, nil
+	}
+	return &provisioning.Response{Status: status.NewOK(ctx)}, nil
+}
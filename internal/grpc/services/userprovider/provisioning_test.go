@@ -0,0 +1,225 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package userprovider
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/cs3org/reva/pkg/user/provisioning"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// testManager keeps the accounts in memory, by opaque id.
+type testManager struct {
+	mu       sync.Mutex
+	accounts map[string]*user.Account
+}
+
+func (m *testManager) GetUser(ctx context.Context, uid *userpb.UserId) (*userpb.User, error) {
+	a, err := m.GetAccount(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return a.User, nil
+}
+
+func (m *testManager) GetUserGroups(ctx context.Context, uid *userpb.UserId) ([]string, error) {
+	u, err := m.GetUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return u.Groups, nil
+}
+
+func (m *testManager) IsInGroup(ctx context.Context, uid *userpb.UserId, group string) (bool, error) {
+	groups, err := m.GetUserGroups(ctx, uid)
+	for _, g := range groups {
+		if g == group {
+			return true, nil
+		}
+	}
+	return false, err
+}
+
+func (m *testManager) FindUsers(ctx context.Context, query string) ([]*userpb.User, error) {
+	return nil, nil
+}
+
+func (m *testManager) GetAccount(ctx context.Context, uid *userpb.UserId) (*user.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[uid.GetOpaqueId()]
+	if !ok {
+		return nil, errtypes.NotFound(uid.GetOpaqueId())
+	}
+	c := *a
+	return &c, nil
+}
+
+func (m *testManager) GetAccountByUsername(ctx context.Context, username string) (*user.Account, error) {
+	return m.GetAccount(ctx, &userpb.UserId{OpaqueId: username})
+}
+
+func (m *testManager) CreateUser(ctx context.Context, u *userpb.User, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.accounts[u.Username]; ok {
+		return errtypes.AlreadyExists(u.Username)
+	}
+	u.Id = &userpb.UserId{OpaqueId: u.Username, Idp: "localhost"}
+	m.accounts[u.Username] = &user.Account{User: u}
+	return nil
+}
+
+func (m *testManager) UpdateAccount(ctx context.Context, a *user.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts[a.User.Id.OpaqueId] = a
+	return nil
+}
+
+func (m *testManager) SetPassword(ctx context.Context, uid *userpb.UserId, password string) error {
+	_, err := m.GetAccount(ctx, uid)
+	return err
+}
+
+func (m *testManager) DeleteUser(ctx context.Context, uid *userpb.UserId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.accounts, uid.GetOpaqueId())
+	return nil
+}
+
+func (m *testManager) AddToGroup(ctx context.Context, uid *userpb.UserId, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.accounts[uid.GetOpaqueId()]
+	a.User.Groups = append(a.User.Groups, group)
+	return nil
+}
+
+func (m *testManager) RemoveFromGroup(ctx context.Context, uid *userpb.UserId, group string) error {
+	return nil
+}
+
+// startProvisioning serves the provisioning API of a userprovider backed by
+// m, the calls are made as the user whose username is in the "user" metadata.
+func startProvisioning(t *testing.T, m *testManager) (*provisioning.Client, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	asUser := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if names := md.Get("user"); len(names) > 0 {
+			if u, err := m.GetUser(ctx, &userpb.UserId{OpaqueId: names[0]}); err == nil {
+				ctx = user.ContextSetUser(ctx, u)
+			}
+		}
+		return handler(ctx, req)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(asUser))
+	svc := &service{conf: &config{AdminGroup: "admin"}, usermgr: m, prov: m}
+	svc.Register(s)
+	go func() { _ = s.Serve(l) }()
+
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provisioning.NewClient(cc), func() {
+		cc.Close()
+		s.Stop()
+	}
+}
+
+func TestProvisioning(t *testing.T) {
+	m := &testManager{accounts: map[string]*user.Account{
+		"root": {User: &userpb.User{Id: &userpb.UserId{OpaqueId: "root", Idp: "localhost"}, Username: "root", Groups: []string{"admin"}}},
+	}}
+	c, stop := startProvisioning(t, m)
+	defer stop()
+	as := func(username string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "user", username)
+	}
+	denied := func(name string, err error) {
+		t.Helper()
+		if _, ok := err.(errtypes.IsPermissionDenied); !ok {
+			t.Errorf("%s: expected permission denied, got %v", name, err)
+		}
+	}
+
+	root := as("root")
+	marie := &userpb.User{Username: "marie", Mail: "marie@example.org"}
+	if err := c.CreateUser(root, marie, "secret"); err != nil || marie.Id.GetOpaqueId() != "marie" {
+		t.Fatalf("CreateUser() = %v, id %v", err, marie.Id)
+	}
+	if err := c.CreateUser(root, &userpb.User{Username: "marie"}, "secret"); err == nil {
+		t.Error("expected creating an existing user to fail")
+	} else if _, ok := err.(errtypes.IsAlreadyExists); !ok {
+		t.Errorf("expected already exists, got %v", err)
+	}
+	a, err := c.GetAccountByUsername(root, "marie")
+	if err != nil || a.User.Mail != "marie@example.org" {
+		t.Fatalf("GetAccountByUsername() = %v, %v", a, err)
+	}
+	a.Quota = 100
+	if err := c.UpdateAccount(root, a); err != nil {
+		t.Fatal(err)
+	}
+
+	// the users only read and change their own account, except the quota
+	ctx := as("marie")
+	denied("create", c.CreateUser(ctx, &userpb.User{Username: "albert"}, "secret"))
+	_, err = c.GetAccountByUsername(ctx, "root")
+	denied("get other", err)
+	a, err = c.GetAccount(ctx, marie.Id)
+	if err != nil || a.Quota != 100 {
+		t.Fatalf("GetAccount() = %v, %v", a, err)
+	}
+	a.Quota = 0
+	denied("change quota", c.UpdateAccount(ctx, a))
+	a.Quota, a.User.Mail = 100, "curie@example.org"
+	if err := c.UpdateAccount(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPassword(ctx, marie.Id, "new secret"); err != nil {
+		t.Fatal(err)
+	}
+	denied("set other password", c.SetPassword(ctx, &userpb.UserId{OpaqueId: "root"}, "new secret"))
+	denied("join group", c.AddToGroup(ctx, marie.Id, "admin"))
+	denied("delete", c.DeleteUser(ctx, marie.Id))
+
+	denied("delete self", c.DeleteUser(root, &userpb.UserId{OpaqueId: "root", Idp: "localhost"}))
+	if err := c.DeleteUser(root, marie.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetAccount(root, marie.Id); err == nil {
+		t.Error("expected the deleted user to be gone")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
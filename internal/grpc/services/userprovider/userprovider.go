@@ -23,10 +23,13 @@ import (
 	"fmt"
 
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/group"
+	groupregistry "github.com/cs3org/reva/pkg/group/manager/registry"
 	"github.com/cs3org/reva/pkg/rgrpc"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/user"
 	"github.com/cs3org/reva/pkg/user/manager/registry"
+	"github.com/cs3org/reva/pkg/user/provisioning"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
@@ -39,6 +42,12 @@ func init() {
 type config struct {
 	Driver  string                            `mapstructure:"driver"`
 	Drivers map[string]map[string]interface{} `mapstructure:"drivers"`
+	// GroupDriver optionally overrides the group memberships reported by the user driver.
+	GroupDriver  string                            `mapstructure:"group_driver"`
+	GroupDrivers map[string]map[string]interface{} `mapstructure:"group_drivers"`
+	// AdminGroup is the group of the users allowed to provision the others,
+	// when the driver supports provisioning.
+	AdminGroup string `mapstructure:"admin_group"`
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -47,6 +56,9 @@ func parseConfig(m map[string]interface{}) (*config, error) {
 		err = errors.Wrap(err, "error decoding conf")
 		return nil, err
 	}
+	if c.AdminGroup == "" {
+		c.AdminGroup = "admin"
+	}
 	return c, nil
 }
 
@@ -58,6 +70,17 @@ func getDriver(c *config) (user.Manager, error) {
 	return nil, fmt.Errorf("driver %s not found for user manager", c.Driver)
 }
 
+func getGroupDriver(c *config) (group.Manager, error) {
+	if c.GroupDriver == "" {
+		return nil, nil
+	}
+	if f, ok := groupregistry.NewFuncs[c.GroupDriver]; ok {
+		return f(c.GroupDrivers[c.GroupDriver])
+	}
+
+	return nil, fmt.Errorf("driver %s not found for group manager", c.GroupDriver)
+}
+
 // New returns a new UserProviderServiceServer.
 func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 	c, err := parseConfig(m)
@@ -70,13 +93,46 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		return nil, err
 	}
 
-	svc := &service{usermgr: userManager}
+	groupManager, err := getGroupDriver(c)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &service{conf: c, usermgr: userManager, groupmgr: groupManager}
+	svc.prov, _ = userManager.(user.Provisioner)
 
 	return svc, nil
 }
 
 type service struct {
-	usermgr user.Manager
+	conf     *config
+	usermgr  user.Manager
+	groupmgr group.Manager
+	// prov is the user manager if it supports provisioning, nil otherwise.
+	prov user.Provisioner
+}
+
+func (s *service) getUserGroups(ctx context.Context, uid *userpb.UserId) ([]string, error) {
+	if s.groupmgr != nil {
+		return s.groupmgr.GetUserGroups(ctx, uid)
+	}
+	return s.usermgr.GetUserGroups(ctx, uid)
+}
+
+func (s *service) isInGroup(ctx context.Context, uid *userpb.UserId, name string) (bool, error) {
+	if s.groupmgr == nil {
+		return s.usermgr.IsInGroup(ctx, uid, name)
+	}
+	groups, err := s.groupmgr.GetUserGroups(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	for _, g := range groups {
+		if g == name {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func (s *service) Close() error {
@@ -89,6 +145,9 @@ func (s *service) UnprotectedEndpoints() []string {
 
 func (s *service) Register(ss *grpc.Server) {
 	userpb.RegisterUserAPIServer(ss, s)
+	if s.prov != nil {
+		provisioning.RegisterAPIServer(ss, s)
+	}
 }
 
 func (s *service) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.GetUserResponse, error) {
@@ -102,6 +161,16 @@ func (s *service) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*use
 		return res, nil
 	}
 
+	if s.groupmgr != nil {
+		if user.Groups, err = s.groupmgr.GetUserGroups(ctx, user.Id); err != nil {
+			err = errors.Wrap(err, "userprovidersvc: error getting user groups")
+			res := &userpb.GetUserResponse{
+				Status: status.NewInternal(ctx, err, "error getting user groups"),
+			}
+			return res, nil
+		}
+	}
+
 	res := &userpb.GetUserResponse{
 		Status: status.NewOK(ctx),
 		User:   user,
@@ -127,7 +196,7 @@ func (s *service) FindUsers(ctx context.Context, req *userpb.FindUsersRequest) (
 }
 
 func (s *service) GetUserGroups(ctx context.Context, req *userpb.GetUserGroupsRequest) (*userpb.GetUserGroupsResponse, error) {
-	groups, err := s.usermgr.GetUserGroups(ctx, req.UserId)
+	groups, err := s.getUserGroups(ctx, req.UserId)
 	if err != nil {
 		err = errors.Wrap(err, "userprovidersvc: error getting user groups")
 		res := &userpb.GetUserGroupsResponse{
@@ -144,7 +213,7 @@ func (s *service) GetUserGroups(ctx context.Context, req *userpb.GetUserGroupsRe
 }
 
 func (s *service) IsInGroup(ctx context.Context, req *userpb.IsInGroupRequest) (*userpb.IsInGroupResponse, error) {
-	ok, err := s.usermgr.IsInGroup(ctx, req.UserId, req.Group)
+	ok, err := s.isInGroup(ctx, req.UserId, req.Group)
 	if err != nil {
 		err = errors.Wrap(err, "userprovidersvc: error checking if user belongs to group")
 		res := &userpb.IsInGroupResponse{
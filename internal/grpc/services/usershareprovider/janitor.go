@@ -0,0 +1,149 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package usershareprovider
+
+import (
+	"context"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/machine"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/share"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// What the janitor does with the expired shares.
+const (
+	expiredActionDelete  = "delete"
+	expiredActionDisable = "disable"
+)
+
+// janitor periodically removes or disables the expired shares. It goes
+// through the gateway on behalf of the share owners with the machine secret,
+// so that the storage grants are removed with the shares. Acting on the share
+// manager alone would leave the grants in place, without a share the owners
+// could revoke them with.
+type janitor struct {
+	sm       share.Manager
+	conf     *config
+	interval time.Duration
+	quit     chan struct{}
+}
+
+func newJanitor(sm share.Manager, c *config) *janitor {
+	return &janitor{
+		sm:       sm,
+		conf:     c,
+		interval: time.Duration(c.ExpirationCheckInterval) * time.Second,
+		quit:     make(chan struct{}),
+	}
+}
+
+func (j *janitor) run() {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			j.clean()
+		case <-j.quit:
+			return
+		}
+	}
+}
+
+func (j *janitor) stop() {
+	close(j.quit)
+}
+
+func (j *janitor) clean() {
+	ctx := appctx.WithLogger(context.Background(), &log.Logger)
+	shares, err := j.sm.ListExpiredShares(ctx, time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("usershareprovider: error listing expired shares")
+		return
+	}
+
+	for _, s := range shares {
+		if j.conf.ExpiredShareAction == expiredActionDisable && isDisabled(s) {
+			continue
+		}
+
+		if err := j.cleanShare(ctx, s); err != nil {
+			log.Error().Err(err).Str("share", s.Id.OpaqueId).Msg("usershareprovider: error cleaning expired share")
+			continue
+		}
+		log.Info().Str("share", s.Id.OpaqueId).Str("action", j.conf.ExpiredShareAction).Msg("usershareprovider: cleaned expired share")
+	}
+}
+
+func isDisabled(s *collaboration.Share) bool {
+	return proto.Equal(s.GetPermissions().GetPermissions(), &provider.ResourcePermissions{})
+}
+
+func disabledPermissions() *collaboration.SharePermissions {
+	return &collaboration.SharePermissions{Permissions: &provider.ResourcePermissions{}}
+}
+
+// cleanShare removes or disables the share through the gateway, which
+// removes the storage grants of the share and of its reshares.
+func (j *janitor) cleanShare(ctx context.Context, s *collaboration.Share) error {
+	client, err := pool.GetGatewayServiceClient(j.conf.GatewaySvc)
+	if err != nil {
+		return errors.Wrap(err, "error getting gateway client")
+	}
+
+	ctx, _, err = machine.Authenticate(ctx, client, machine.ClientID(s.Owner), j.conf.MachineSecret)
+	if err != nil {
+		return errors.Wrap(err, "error authenticating share owner")
+	}
+
+	ref := &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: s.Id}}
+	if j.conf.ExpiredShareAction != expiredActionDisable {
+		res, err := client.RemoveShare(ctx, &collaboration.RemoveShareRequest{Ref: ref})
+		if err != nil {
+			return errors.Wrap(err, "error removing share")
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return status.NewErrorFromCode(res.Status.Code, "usershareprovider")
+		}
+		return nil
+	}
+
+	res, err := client.UpdateShare(ctx, &collaboration.UpdateShareRequest{
+		Ref: ref,
+		Field: &collaboration.UpdateShareRequest_UpdateField{
+			Field: &collaboration.UpdateShareRequest_UpdateField_Permissions{Permissions: disabledPermissions()},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error disabling share")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(res.Status.Code, "usershareprovider")
+	}
+	return nil
+}
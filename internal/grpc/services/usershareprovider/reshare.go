@@ -0,0 +1,209 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package usershareprovider
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/share"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/pkg/errors"
+)
+
+// statResource returns the info of the resource as the storage reports it,
+// so that its owner is not taken from the client.
+func (s *service) statResource(ctx context.Context, id *provider.ResourceId) (*provider.ResourceInfo, error) {
+	if id == nil {
+		return nil, errtypes.NotFound("resource id missing")
+	}
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting gateway client")
+	}
+	ref := &provider.Reference{Spec: &provider.Reference_Id{Id: id}}
+	res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending stat request")
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+		return res.Info, nil
+	case rpc.Code_CODE_NOT_FOUND:
+		return nil, errtypes.NotFound(id.OpaqueId)
+	default:
+		return nil, status.NewErrorFromCode(res.Status.Code, "usershareprovider")
+	}
+}
+
+// reshareParent returns the received share a new share of the resource is
+// created from, nil when the user owns the resource. The received share must
+// allow resharing and grant at least the requested permissions. The resource
+// info must come from the storage, see statResource.
+func (s *service) reshareParent(ctx context.Context, u *userpb.User, md *provider.ResourceInfo, p *provider.ResourcePermissions) (*collaboration.Share, error) {
+	owner, err := share.Owner(md)
+	if err != nil {
+		return nil, err
+	}
+	if owner.Idp == u.Id.Idp && owner.OpaqueId == u.Id.OpaqueId {
+		return nil, nil
+	}
+
+	received, err := s.sm.ListReceivedShares(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = errtypes.PermissionDenied("resource not shared with the user")
+	for _, rs := range received {
+		if rs.State == collaboration.ShareState_SHARE_STATE_REJECTED {
+			continue
+		}
+		exp, err := s.sm.GetShareExpiration(ctx, rs.Share.Id)
+		if err != nil {
+			return nil, err
+		}
+		if share.Expired(exp, now) {
+			continue
+		}
+		ok, perr := s.isWithin(ctx, md.Id, rs.Share.ResourceId)
+		if perr != nil {
+			return nil, perr
+		}
+		if !ok {
+			continue
+		}
+
+		parent := rs.Share.GetPermissions().GetPermissions()
+		switch {
+		case !parent.GetAddGrant():
+			err = errtypes.PermissionDenied("the received share does not allow resharing")
+		case !share.IsSubset(p, parent):
+			err = errtypes.PermissionDenied("the permissions exceed the ones of the received share")
+		default:
+			return rs.Share, nil
+		}
+	}
+	return nil, err
+}
+
+// isWithin tells if the resource is the shared resource or below it.
+func (s *service) isWithin(ctx context.Context, id, shared *provider.ResourceId) (bool, error) {
+	if id.GetStorageId() == shared.GetStorageId() && id.GetOpaqueId() == shared.GetOpaqueId() {
+		return true, nil
+	}
+	if id.GetStorageId() != shared.GetStorageId() {
+		return false, nil
+	}
+
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		return false, errors.Wrap(err, "error getting gateway client")
+	}
+	p, err := getPath(ctx, client, id)
+	if err != nil {
+		return false, err
+	}
+	sp, err := getPath(ctx, client, shared)
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(p, strings.TrimSuffix(sp, "/")+"/"), nil
+}
+
+func getPath(ctx context.Context, client gateway.GatewayAPIClient, id *provider.ResourceId) (string, error) {
+	res, err := client.GetPath(ctx, &provider.GetPathRequest{ResourceId: id})
+	if err != nil {
+		return "", errors.Wrap(err, "error getting path")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return "", status.NewErrorFromCode(res.Status.Code, "usershareprovider")
+	}
+	return res.Path, nil
+}
+
+// asOwner returns a context acting as the owner of the share, who can
+// change all the reshares of the resource.
+func asOwner(ctx context.Context, s *collaboration.Share) context.Context {
+	return user.ContextSetUser(ctx, &userpb.User{Id: s.Owner})
+}
+
+// unshareChildren removes the reshares of the share recursively and
+// returns them.
+func unshareChildren(ctx context.Context, sm share.Manager, id *collaboration.ShareId) ([]*collaboration.Share, error) {
+	children, err := sm.ListChildShares(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []*collaboration.Share
+	for _, c := range children {
+		descendants, err := unshareChildren(ctx, sm, c.Id)
+		removed = append(removed, descendants...)
+		if err != nil {
+			return removed, err
+		}
+		ref := &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: c.Id}}
+		if err := sm.Unshare(asOwner(ctx, c), ref); err != nil {
+			return removed, err
+		}
+		removed = append(removed, c)
+	}
+	return removed, nil
+}
+
+// restrictChildren removes from the reshares of the share recursively the
+// permissions not granted by p, and returns the updated ones.
+func restrictChildren(ctx context.Context, sm share.Manager, id *collaboration.ShareId, p *provider.ResourcePermissions) ([]*collaboration.Share, error) {
+	children, err := sm.ListChildShares(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []*collaboration.Share
+	for _, c := range children {
+		if share.IsSubset(c.GetPermissions().GetPermissions(), p) {
+			continue
+		}
+		perms := share.Intersect(c.GetPermissions().GetPermissions(), p)
+		ref := &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: c.Id}}
+		us, err := sm.UpdateShare(asOwner(ctx, c), ref, &collaboration.SharePermissions{Permissions: perms})
+		if err != nil {
+			return updated, err
+		}
+		updated = append(updated, us)
+
+		descendants, err := restrictChildren(ctx, sm, c.Id, perms)
+		updated = append(updated, descendants...)
+		if err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package usershareprovider
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/share/manager/memory"
+	"github.com/cs3org/reva/pkg/user"
+	"google.golang.org/grpc"
+)
+
+// testGateway serves the stat by id of the resources it holds.
+type testGateway struct {
+	gateway.UnimplementedGatewayAPIServer
+	infos []*provider.ResourceInfo
+}
+
+func (g *testGateway) Stat(ctx context.Context, req *provider.StatRequest) (*provider.StatResponse, error) {
+	for _, info := range g.infos {
+		if id := req.Ref.GetId(); id.GetStorageId() == info.Id.StorageId && id.GetOpaqueId() == info.Id.OpaqueId {
+			return &provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, Info: info}, nil
+		}
+	}
+	return &provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_NOT_FOUND}}, nil
+}
+
+func startGateway(t *testing.T, g gateway.GatewayAPIServer) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	gateway.RegisterGatewayAPIServer(s, g)
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+	return l.Addr().String()
+}
+
+func TestCreateShareOwner(t *testing.T) {
+	einstein := &userpb.UserId{OpaqueId: "einstein", Idp: "localhost"}
+	marie := &userpb.UserId{OpaqueId: "marie", Idp: "localhost"}
+	richard := &userpb.UserId{OpaqueId: "richard", Idp: "localhost"}
+	id := func(opaqueID string) *provider.ResourceId {
+		return &provider.ResourceId{StorageId: "storage", OpaqueId: opaqueID}
+	}
+	g := &testGateway{infos: []*provider.ResourceInfo{
+		{Id: id("einstein-file"), Owner: einstein},
+		{Id: id("unknown-owner")},
+		{Id: id("marie-file"), Owner: marie},
+	}}
+
+	sm, err := memory.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &service{conf: &config{GatewaySvc: startGateway(t, g)}, sm: sm}
+	ctx := user.ContextSetUser(context.Background(), &userpb.User{Id: marie})
+
+	tests := []struct {
+		resource string
+		code     rpc.Code
+	}{
+		// the owner claimed by the client is ignored
+		{"einstein-file", rpc.Code_CODE_PERMISSION_DENIED},
+		{"unknown-owner", rpc.Code_CODE_PERMISSION_DENIED},
+		{"marie-file", rpc.Code_CODE_OK},
+		{"missing", rpc.Code_CODE_NOT_FOUND},
+	}
+	for _, tt := range tests {
+		res, err := s.CreateShare(ctx, &collaboration.CreateShareRequest{
+			ResourceInfo: &provider.ResourceInfo{Id: id(tt.resource), Owner: marie},
+			Grant: &collaboration.ShareGrant{
+				Grantee:     &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_USER, Id: richard},
+				Permissions: &collaboration.SharePermissions{Permissions: &provider.ResourcePermissions{Stat: true}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status.Code != tt.code {
+			t.Errorf("%s: got %v, expected %v", tt.resource, res.Status.Code, tt.code)
+		}
+		if tt.code == rpc.Code_CODE_OK && res.Share.Owner.OpaqueId != "marie" {
+			t.Errorf("%s: unexpected owner %v", tt.resource, res.Share.Owner)
+		}
+	}
+}
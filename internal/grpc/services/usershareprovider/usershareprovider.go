@@ -21,16 +21,28 @@ package usershareprovider
 import (
 	"context"
 	"fmt"
+	"path"
+	"time"
 
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/notification"
+	"github.com/cs3org/reva/pkg/notification/notifier"
 	"github.com/cs3org/reva/pkg/rgrpc"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 	"github.com/cs3org/reva/pkg/share"
 	"github.com/cs3org/reva/pkg/share/manager/registry"
+	"github.com/cs3org/reva/pkg/sharedconf"
 	"github.com/cs3org/reva/pkg/user"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 )
 
@@ -41,11 +53,26 @@ func init() {
 type config struct {
 	Driver  string                            `mapstructure:"driver"`
 	Drivers map[string]map[string]interface{} `mapstructure:"drivers"`
+	// ExpirationCheckInterval is the number of seconds between two cleanups
+	// of the expired shares, a negative value disabling them.
+	ExpirationCheckInterval int `mapstructure:"expiration_check_interval"`
+	// ExpiredShareAction is either delete or disable.
+	ExpiredShareAction string `mapstructure:"expired_share_action"`
+	// MachineSecret lets the cleanup act on behalf of the share owners
+	// through the gateway, so that the storage grants are removed too. The
+	// expired shares are not cleaned up without it.
+	MachineSecret string `mapstructure:"machine_secret"`
+	GatewaySvc    string `mapstructure:"gatewaysvc"`
+	// Notifications configures the notifier telling the users about the
+	// shares created with them, they are disabled when empty.
+	Notifications map[string]interface{} `mapstructure:"notifications"`
 }
 
 type service struct {
-	conf *config
-	sm   share.Manager
+	conf     *config
+	sm       share.Manager
+	janitor  *janitor
+	notifier *notifier.Notifier
 }
 
 func getShareManager(c *config) (share.Manager, error) {
@@ -57,6 +84,9 @@ func getShareManager(c *config) (share.Manager, error) {
 
 // TODO(labkode): add ctx to Close.
 func (s *service) Close() error {
+	if s.janitor != nil {
+		s.janitor.stop()
+	}
 	return nil
 }
 
@@ -90,6 +120,17 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		c.Driver = "json"
 	}
 
+	if c.ExpirationCheckInterval == 0 {
+		c.ExpirationCheckInterval = 60
+	}
+	if c.ExpiredShareAction == "" {
+		c.ExpiredShareAction = expiredActionDelete
+	}
+	if c.ExpiredShareAction != expiredActionDelete && c.ExpiredShareAction != expiredActionDisable {
+		return nil, fmt.Errorf("usershareprovider: unknown expired share action: %s", c.ExpiredShareAction)
+	}
+	c.GatewaySvc = sharedconf.GetGatewaySVC(c.GatewaySvc)
+
 	sm, err := getShareManager(c)
 	if err != nil {
 		return nil, err
@@ -100,6 +141,21 @@ func New(m map[string]interface{}, ss *grpc.Server) (rgrpc.Service, error) {
 		sm:   sm,
 	}
 
+	if len(c.Notifications) > 0 {
+		if service.notifier, err = notifier.New(c.Notifications); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.ExpirationCheckInterval > 0 {
+		if c.MachineSecret == "" {
+			log.Warn().Msg("usershareprovider: machine_secret not set, the expired shares are not cleaned up")
+		} else {
+			service.janitor = newJanitor(sm, c)
+			go service.janitor.run()
+		}
+	}
+
 	return service, nil
 }
 
@@ -110,87 +166,324 @@ func (s *service) CreateShare(ctx context.Context, req *collaboration.CreateShar
 		// use logged in user Idp as default.
 		req.Grant.Grantee.Id.Idp = u.Id.Idp
 	}
-	share, err := s.sm.Share(ctx, req.ResourceInfo, req.Grant)
+	exp, _, err := share.ExpirationFromOpaque(req.Opaque)
+	if err != nil {
+		return &collaboration.CreateShareResponse{
+			Status: status.NewInvalidArg(ctx, err.Error()),
+		}, nil
+	}
+	if share.Expired(exp, time.Now()) {
+		return &collaboration.CreateShareResponse{
+			Status: status.NewInvalidArg(ctx, "expiration is in the past"),
+		}, nil
+	}
+
+	md, err := s.statResource(ctx, req.ResourceInfo.GetId())
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return &collaboration.CreateShareResponse{
+				Status: status.NewNotFound(ctx, "resource not found"),
+			}, nil
+		}
+		return &collaboration.CreateShareResponse{
+			Status: status.NewInternal(ctx, err, "error getting resource info"),
+		}, nil
+	}
+
+	parent, err := s.reshareParent(ctx, u, md, req.Grant.GetPermissions().GetPermissions())
+	if err != nil {
+		if _, ok := err.(errtypes.IsPermissionDenied); ok {
+			return &collaboration.CreateShareResponse{
+				Status: status.NewPermissionDenied(ctx, err, "resharing not allowed"),
+			}, nil
+		}
+		return &collaboration.CreateShareResponse{
+			Status: status.NewInternal(ctx, err, "error checking received shares"),
+		}, nil
+	}
+
+	sh, err := s.sm.Share(ctx, md, req.Grant)
 	if err != nil {
 		return &collaboration.CreateShareResponse{
 			Status: status.NewInternal(ctx, err, "error creating share"),
 		}, nil
 	}
 
+	if parent != nil {
+		ref := &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: sh.Id}}
+		if err := s.sm.SetShareParent(ctx, ref, parent.Id); err != nil {
+			return &collaboration.CreateShareResponse{
+				Status: status.NewInternal(ctx, err, "error recording reshare"),
+			}, nil
+		}
+	}
+
+	if exp != nil {
+		ref := &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: sh.Id}}
+		if err := s.sm.SetShareExpiration(ctx, ref, exp); err != nil {
+			return &collaboration.CreateShareResponse{
+				Status: status.NewInternal(ctx, err, "error setting share expiration"),
+			}, nil
+		}
+	}
+
+	if s.notifier != nil {
+		s.notifyShareCreated(ctx, sh, md, exp)
+	}
+
 	res := &collaboration.CreateShareResponse{
 		Status: status.NewOK(ctx),
-		Share:  share,
+		Share:  sh,
+		Opaque: share.ExpirationToOpaque(exp),
 	}
 	return res, nil
 }
 
+// RemoveShare removes the share and its reshares, which are returned in the
+// opaque data of the response.
 func (s *service) RemoveShare(ctx context.Context, req *collaboration.RemoveShareRequest) (*collaboration.RemoveShareResponse, error) {
-	err := s.sm.Unshare(ctx, req.Ref)
+	sh, err := s.sm.GetShare(ctx, req.Ref)
+	if err != nil {
+		return &collaboration.RemoveShareResponse{
+			Status: status.NewInternal(ctx, err, "error getting share"),
+		}, nil
+	}
+
+	err = s.sm.Unshare(ctx, req.Ref)
 	if err != nil {
 		return &collaboration.RemoveShareResponse{
 			Status: status.NewInternal(ctx, err, "error removing share"),
 		}, nil
 	}
 
+	removed, err := unshareChildren(ctx, s.sm, sh.Id)
+	if err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("share", sh.Id.OpaqueId).Msg("usershareprovider: error removing reshares")
+	}
+	opaque, err := share.SharesToOpaque(removed)
+	if err != nil {
+		return &collaboration.RemoveShareResponse{
+			Status: status.NewInternal(ctx, err, "error encoding removed reshares"),
+		}, nil
+	}
+
 	return &collaboration.RemoveShareResponse{
 		Status: status.NewOK(ctx),
+		Opaque: opaque,
 	}, nil
 }
 
 func (s *service) GetShare(ctx context.Context, req *collaboration.GetShareRequest) (*collaboration.GetShareResponse, error) {
-	share, err := s.sm.GetShare(ctx, req.Ref)
+	sh, err := s.sm.GetShare(ctx, req.Ref)
 	if err != nil {
 		return &collaboration.GetShareResponse{
 			Status: status.NewInternal(ctx, err, "error getting share"),
 		}, nil
 	}
 
+	exp, err := s.sm.GetShareExpiration(ctx, sh.Id)
+	if err != nil {
+		return &collaboration.GetShareResponse{
+			Status: status.NewInternal(ctx, err, "error getting share expiration"),
+		}, nil
+	}
+
 	return &collaboration.GetShareResponse{
 		Status: status.NewOK(ctx),
-		Share:  share,
+		Share:  sh,
+		Opaque: share.ExpirationToOpaque(exp),
 	}, nil
 }
 
 func (s *service) ListShares(ctx context.Context, req *collaboration.ListSharesRequest) (*collaboration.ListSharesResponse, error) {
-	shares, err := s.sm.ListShares(ctx, req.Filters) // TODO(labkode): add filter to share manager
+	q, err := share.QueryFromOpaque(req.Opaque)
+	if err != nil {
+		return &collaboration.ListSharesResponse{
+			Status: status.NewInvalidArg(ctx, err.Error()),
+		}, nil
+	}
+
+	var shares []*collaboration.Share
+	if querier, ok := s.sm.(share.Querier); ok {
+		shares, err = querier.QueryShares(ctx, req.Filters, q)
+	} else {
+		shares, err = s.sm.ListShares(ctx, req.Filters)
+		if err == nil {
+			matching := make([]*collaboration.Share, 0, len(shares))
+			for _, sh := range shares {
+				if q.MatchShare(sh) {
+					matching = append(matching, sh)
+				}
+			}
+			start, end := q.Page(len(matching))
+			shares = matching[start:end]
+		}
+	}
 	if err != nil {
 		return &collaboration.ListSharesResponse{
 			Status: status.NewInternal(ctx, err, "error listing shares"),
 		}, nil
 	}
 
+	opaque, err := s.expirations(ctx, shares)
+	if err != nil {
+		return &collaboration.ListSharesResponse{
+			Status: status.NewInternal(ctx, err, "error getting share expirations"),
+		}, nil
+	}
+
 	res := &collaboration.ListSharesResponse{
 		Status: status.NewOK(ctx),
 		Shares: shares,
+		Opaque: opaque,
 	}
 	return res, nil
 }
 
 func (s *service) UpdateShare(ctx context.Context, req *collaboration.UpdateShareRequest) (*collaboration.UpdateShareResponse, error) {
-	_, err := s.sm.UpdateShare(ctx, req.Ref, req.Field.GetPermissions()) // TODO(labkode): check what to update
+	exp, setExp, err := share.ExpirationFromOpaque(req.Opaque)
 	if err != nil {
 		return &collaboration.UpdateShareResponse{
-			Status: status.NewInternal(ctx, err, "error updating share"),
+			Status: status.NewInvalidArg(ctx, err.Error()),
+		}, nil
+	}
+	if share.Expired(exp, time.Now()) {
+		return &collaboration.UpdateShareResponse{
+			Status: status.NewInvalidArg(ctx, "expiration is in the past"),
 		}, nil
 	}
 
+	// the expiration can be updated on its own
+	var opaque *typespb.Opaque
+	if p := req.Field.GetPermissions(); p != nil || !setExp {
+		if p != nil {
+			if err := s.checkReshare(ctx, req.Ref, p.GetPermissions()); err != nil {
+				if _, ok := err.(errtypes.IsPermissionDenied); ok {
+					return &collaboration.UpdateShareResponse{
+						Status: status.NewPermissionDenied(ctx, err, "permissions not allowed"),
+					}, nil
+				}
+				return &collaboration.UpdateShareResponse{
+					Status: status.NewInternal(ctx, err, "error checking parent share"),
+				}, nil
+			}
+		}
+
+		sh, err := s.sm.UpdateShare(ctx, req.Ref, p) // TODO(labkode): check what to update
+		if err != nil {
+			return &collaboration.UpdateShareResponse{
+				Status: status.NewInternal(ctx, err, "error updating share"),
+			}, nil
+		}
+
+		// the reshares can not grant more than the share they were created from
+		if p != nil {
+			updated, err := restrictChildren(ctx, s.sm, sh.Id, p.GetPermissions())
+			if err != nil {
+				appctx.GetLogger(ctx).Error().Err(err).Str("share", sh.Id.OpaqueId).Msg("usershareprovider: error restricting reshares")
+			}
+			if opaque, err = share.SharesToOpaque(updated); err != nil {
+				return &collaboration.UpdateShareResponse{
+					Status: status.NewInternal(ctx, err, "error encoding updated reshares"),
+				}, nil
+			}
+		}
+	}
+
+	if setExp {
+		if err := s.sm.SetShareExpiration(ctx, req.Ref, exp); err != nil {
+			return &collaboration.UpdateShareResponse{
+				Status: status.NewInternal(ctx, err, "error updating share expiration"),
+			}, nil
+		}
+	}
+
 	res := &collaboration.UpdateShareResponse{
 		Status: status.NewOK(ctx),
+		Opaque: opaque,
 	}
 	return res, nil
 }
 
+// checkReshare verifies that a reshare keeps within the permissions of the
+// share it was created from.
+func (s *service) checkReshare(ctx context.Context, ref *collaboration.ShareReference, p *provider.ResourcePermissions) error {
+	sh, err := s.sm.GetShare(ctx, ref)
+	if err != nil {
+		return err
+	}
+	parentID, err := s.sm.GetShareParent(ctx, sh.Id)
+	if err != nil || parentID == nil {
+		return err
+	}
+	parent, err := s.sm.GetShare(asOwner(ctx, sh), &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: parentID}})
+	if err != nil {
+		return err
+	}
+	if !share.IsSubset(p, parent.GetPermissions().GetPermissions()) {
+		return errtypes.PermissionDenied("the permissions exceed the ones of the parent share")
+	}
+	return nil
+}
+
 func (s *service) ListReceivedShares(ctx context.Context, req *collaboration.ListReceivedSharesRequest) (*collaboration.ListReceivedSharesResponse, error) {
-	shares, err := s.sm.ListReceivedShares(ctx) // TODO(labkode): check what to update
+	q, err := share.QueryFromOpaque(req.Opaque)
+	if err != nil {
+		return &collaboration.ListReceivedSharesResponse{
+			Status: status.NewInvalidArg(ctx, err.Error()),
+		}, nil
+	}
+
+	querier, pushdown := s.sm.(share.Querier)
+	var shares []*collaboration.ReceivedShare
+	if pushdown {
+		shares, err = querier.QueryReceivedShares(ctx, q)
+	} else {
+		shares, err = s.sm.ListReceivedShares(ctx)
+	}
 	if err != nil {
 		return &collaboration.ListReceivedSharesResponse{
 			Status: status.NewInternal(ctx, err, "error listing received shares"),
 		}, nil
 	}
 
+	// expired shares are hidden until they are cleaned up
+	now := time.Now()
+	active := make([]*collaboration.ReceivedShare, 0, len(shares))
+	for _, rs := range shares {
+		if !pushdown && !q.MatchReceivedShare(rs) {
+			continue
+		}
+		exp, err := s.sm.GetShareExpiration(ctx, rs.Share.Id)
+		if err != nil {
+			return &collaboration.ListReceivedSharesResponse{
+				Status: status.NewInternal(ctx, err, "error getting share expiration"),
+			}, nil
+		}
+		if !share.Expired(exp, now) {
+			active = append(active, rs)
+		}
+	}
+	if !pushdown {
+		start, end := q.Page(len(active))
+		active = active[start:end]
+	}
+	list := make([]*collaboration.Share, 0, len(active))
+	for _, rs := range active {
+		list = append(list, rs.Share)
+	}
+
+	opaque, err := s.expirations(ctx, list)
+	if err != nil {
+		return &collaboration.ListReceivedSharesResponse{
+			Status: status.NewInternal(ctx, err, "error getting share expirations"),
+		}, nil
+	}
+
 	res := &collaboration.ListReceivedSharesResponse{
 		Status: status.NewOK(ctx),
-		Shares: shares,
+		Shares: active,
+		Opaque: opaque,
 	}
 	return res, nil
 }
@@ -198,7 +491,7 @@ func (s *service) ListReceivedShares(ctx context.Context, req *collaboration.Lis
 func (s *service) GetReceivedShare(ctx context.Context, req *collaboration.GetReceivedShareRequest) (*collaboration.GetReceivedShareResponse, error) {
 	log := appctx.GetLogger(ctx)
 
-	share, err := s.sm.GetReceivedShare(ctx, req.Ref)
+	rs, err := s.sm.GetReceivedShare(ctx, req.Ref)
 	if err != nil {
 		log.Err(err).Msg("error getting received share")
 		return &collaboration.GetReceivedShareResponse{
@@ -206,9 +499,22 @@ func (s *service) GetReceivedShare(ctx context.Context, req *collaboration.GetRe
 		}, nil
 	}
 
+	exp, err := s.sm.GetShareExpiration(ctx, rs.Share.Id)
+	if err != nil {
+		return &collaboration.GetReceivedShareResponse{
+			Status: status.NewInternal(ctx, err, "error getting share expiration"),
+		}, nil
+	}
+	if share.Expired(exp, time.Now()) {
+		return &collaboration.GetReceivedShareResponse{
+			Status: status.NewNotFound(ctx, "share expired"),
+		}, nil
+	}
+
 	res := &collaboration.GetReceivedShareResponse{
 		Status: status.NewOK(ctx),
-		Share:  share,
+		Share:  rs,
+		Opaque: share.ExpirationToOpaque(exp),
 	}
 	return res, nil
 }
@@ -226,3 +532,56 @@ func (s *service) UpdateReceivedShare(ctx context.Context, req *collaboration.Up
 	}
 	return res, nil
 }
+
+// expirations returns the opaque data carrying the expirations of the shares.
+func (s *service) expirations(ctx context.Context, shares []*collaboration.Share) (*typespb.Opaque, error) {
+	exps := make(map[string]*typespb.Timestamp, len(shares))
+	for _, sh := range shares {
+		exp, err := s.sm.GetShareExpiration(ctx, sh.Id)
+		if err != nil {
+			return nil, err
+		}
+		exps[sh.Id.OpaqueId] = exp
+	}
+	return share.ExpirationsToOpaque(exps)
+}
+
+// notifyShareCreated tells the grantee of a new share about it.
+func (s *service) notifyShareCreated(ctx context.Context, sh *collaboration.Share, info *provider.ResourceInfo, exp *typespb.Timestamp) {
+	log := appctx.GetLogger(ctx)
+	if sh.Grantee.GetType() != provider.GranteeType_GRANTEE_TYPE_USER {
+		return
+	}
+
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		log.Error().Err(err).Msg("usershareprovider: error getting gateway client")
+		return
+	}
+	res, err := client.GetUser(ctx, &userpb.GetUserRequest{UserId: sh.Grantee.Id})
+	if err != nil {
+		log.Error().Err(err).Msg("usershareprovider: error looking up grantee")
+		return
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		log.Warn().Str("code", res.Status.Code.String()).Msg("usershareprovider: grantee not found, not notifying")
+		return
+	}
+
+	d := &notification.Data{
+		Recipient: res.User,
+		Sharer:    displayName(user.ContextMustGetUser(ctx)),
+		Resource:  path.Base(info.GetPath()),
+	}
+	if exp != nil {
+		d.Expiration = time.Unix(int64(exp.Seconds), 0)
+	}
+	s.notifier.NotifyInBackground(ctx, notification.EventShareCreated, d)
+}
+
+func displayName(u *userpb.User) string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
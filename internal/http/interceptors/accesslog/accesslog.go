@@ -0,0 +1,226 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package accesslog writes one line per HTTP request to an access log kept
+// apart from the application log.
+package accesslog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/rhttp/clientip"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+type config struct {
+	// Format is json or combined, for the Apache combined log format.
+	Format string `mapstructure:"format"`
+	File   string `mapstructure:"file"`
+	// MaxSize is the size in megabytes above which the file is rotated.
+	MaxSize int `mapstructure:"max_size"`
+	// MaxBackups is the number of rotated files kept, 0 keeps them all.
+	MaxBackups int `mapstructure:"max_backups"`
+	// MaxAge is the number of days rotated files are kept, 0 keeps them.
+	MaxAge   int  `mapstructure:"max_age"`
+	Compress bool `mapstructure:"compress"`
+	// TrustForwardedFor takes the client address from the last entry of the
+	// X-Forwarded-For header, only enable it behind a proxy that appends it.
+	TrustForwardedFor bool `mapstructure:"trust_forwarded_for"`
+}
+
+// Logger writes the access log.
+type Logger struct {
+	conf *config
+	mu   sync.Mutex
+	w    io.WriteCloser
+}
+
+// New returns a new access logger.
+func New(m map[string]interface{}) (*Logger, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, errors.Wrap(err, "accesslog: error decoding conf")
+	}
+
+	if conf.Format == "" {
+		conf.Format = "json"
+	}
+	if conf.Format != "json" && conf.Format != "combined" {
+		return nil, fmt.Errorf("accesslog: unknown format %s", conf.Format)
+	}
+	if conf.File == "" {
+		conf.File = "/var/log/revad/access.log"
+	}
+	if conf.MaxSize == 0 {
+		conf.MaxSize = 100
+	}
+
+	if err := os.MkdirAll(filepath.Dir(conf.File), 0700); err != nil {
+		return nil, errors.Wrap(err, "accesslog: error creating access log dir")
+	}
+	w := &lumberjack.Logger{
+		Filename:   conf.File,
+		MaxSize:    conf.MaxSize,
+		MaxBackups: conf.MaxBackups,
+		MaxAge:     conf.MaxAge,
+		Compress:   conf.Compress,
+	}
+	return newLogger(conf, w), nil
+}
+
+func newLogger(conf *config, w io.WriteCloser) *Logger {
+	return &Logger{conf: conf, w: w}
+}
+
+// Close closes the access log.
+func (l *Logger) Close() error {
+	return l.w.Close()
+}
+
+type ctxKey struct{}
+
+// entry is the line of a request, filled while it is served.
+type entry struct {
+	Time      string  `json:"time"`
+	Host      string  `json:"host"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	Duration  float64 `json:"duration_ms"`
+	User      string  `json:"user,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	Referer   string  `json:"referer,omitempty"`
+	TraceID   string  `json:"trace_id,omitempty"`
+
+	start time.Time
+}
+
+// Handler returns the middleware writing the line of each request. It must
+// wrap the auth middleware to log the rejected requests too, the user being
+// recorded by the one returned by UserHandler.
+func (l *Logger) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &entry{start: time.Now()}
+		ctx := context.WithValue(r.Context(), ctxKey{}, e)
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		h.ServeHTTP(rw, r.WithContext(ctx))
+
+		e.Host = clientip.Get(r, l.conf.TrustForwardedFor)
+		e.Method = r.Method
+		e.Path = r.URL.RequestURI()
+		e.Proto = r.Proto
+		e.Status = rw.status
+		e.Bytes = rw.size
+		e.Duration = float64(time.Since(e.start).Microseconds()) / 1000
+		e.UserAgent = r.UserAgent()
+		e.Referer = r.Referer()
+		if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			e.TraceID = sc.TraceID().String()
+		}
+		l.write(e)
+	})
+}
+
+// UserHandler returns the middleware recording the user of the request, it
+// must be wrapped by the auth middleware.
+func (l *Logger) UserHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e, ok := r.Context().Value(ctxKey{}).(*entry); ok {
+			if u, ok := user.ContextGetUser(r.Context()); ok {
+				e.User = u.Username
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (l *Logger) write(e *entry) {
+	var line []byte
+	switch l.conf.Format {
+	case "combined":
+		line = []byte(combined(e))
+	default:
+		e.Time = e.start.UTC().Format(time.RFC3339Nano)
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		line = append(data, '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// errors writing the access log must not fail the requests
+	_, _ = l.w.Write(line)
+}
+
+// combined formats the entry in the Apache combined log format.
+func combined(e *entry) string {
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = fmt.Sprintf("%d", e.Bytes)
+	}
+	return fmt.Sprintf("%s - %s [%s] %q %d %s %q %q\n",
+		e.Host, dash(e.User), e.start.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+e.Path+" "+e.Proto, e.Status, size, dash(e.Referer), dash(e.UserAgent))
+}
+
+// responseWriter remembers the status and size of the response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error { return nil }
+
+// serve sends a request through the access log, with a fake auth
+// middleware setting the user.
+func serve(t *testing.T, format string) string {
+	buf := &buffer{}
+	l := newLogger(&config{Format: format}, buf)
+
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})
+	auth := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := user.ContextSetUser(r.Context(), &userpb.User{Username: "einstein"})
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	h := l.Handler(auth(l.UserHandler(app)))
+
+	r := httptest.NewRequest(http.MethodPut, "/remote.php/webdav/file.txt?x=1", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", "test-client")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	return buf.String()
+}
+
+func TestJSON(t *testing.T) {
+	line := serve(t, "json")
+	e := &entry{}
+	if err := json.Unmarshal([]byte(line), e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Method != "PUT" || e.Path != "/remote.php/webdav/file.txt?x=1" || e.Status != 201 ||
+		e.Bytes != 5 || e.User != "einstein" || e.UserAgent != "test-client" || e.Host != "10.0.0.1" {
+		t.Fatalf("unexpected entry: %s", line)
+	}
+}
+
+func TestCombined(t *testing.T) {
+	line := serve(t, "combined")
+	if !strings.HasPrefix(line, "10.0.0.1 - einstein [") ||
+		!strings.HasSuffix(line, `] "PUT /remote.php/webdav/file.txt?x=1 HTTP/1.1" 201 5 "-" "test-client"`+"\n") {
+		t.Fatalf("unexpected line: %q", line)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New(map[string]interface{}{"format": "xml"}); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
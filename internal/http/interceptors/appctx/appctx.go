@@ -25,8 +25,8 @@ import (
 	"net/http"
 
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/rs/zerolog"
-	"go.opencensus.io/trace"
 )
 
 // New returns a new HTTP middleware that stores the log
@@ -44,8 +44,7 @@ func handler(log zerolog.Logger, h http.Handler) http.Handler {
 		ctx := r.Context()
 
 		// trace is set on the httpserver.go file as the outermost wraper handler.
-		span := trace.FromContext(ctx)
-		sub := log.With().Str("traceid", span.SpanContext().TraceID.String()).Logger()
+		sub := log.With().Str("traceid", trace.GetTraceID(ctx)).Logger()
 		ctx = appctx.WithLogger(ctx, &sub)
 
 		r = r.WithContext(ctx)
@@ -0,0 +1,140 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/audit"
+	"github.com/cs3org/reva/pkg/audit/sink/registry"
+	"github.com/cs3org/reva/pkg/rhttp/clientip"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+const (
+	// the audit log wraps the other middlewares to record their rejections too
+	defaultPriority = 100
+)
+
+func init() {
+	global.RegisterMiddleware("audit", New)
+}
+
+type config struct {
+	Priority int                               `mapstructure:"priority"`
+	Sink     string                            `mapstructure:"sink"`
+	Sinks    map[string]map[string]interface{} `mapstructure:"sinks"`
+	// RedactFields are the record fields left out, among user, idp, resource and client_ip.
+	RedactFields []string `mapstructure:"redact_fields"`
+	// RedactQueryParams are the query parameters masked in the resources,
+	// by default the ones carrying credentials.
+	RedactQueryParams []string `mapstructure:"redact_query_params"`
+	// TrustForwardedFor takes the client address from the last entry of the
+	// X-Forwarded-For header, only enable it behind a proxy that appends it.
+	TrustForwardedFor bool `mapstructure:"trust_forwarded_for"`
+}
+
+// New returns a new HTTP middleware recording the requests in the audit log.
+func New(m map[string]interface{}) (global.Middleware, int, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, 0, errors.Wrap(err, "audit: error decoding conf")
+	}
+
+	if conf.Priority == 0 {
+		conf.Priority = defaultPriority
+	}
+	if conf.Sink == "" {
+		conf.Sink = "file"
+	}
+
+	f, ok := registry.NewFuncs[conf.Sink]
+	if !ok {
+		return nil, 0, fmt.Errorf("audit: sink not found: %s", conf.Sink)
+	}
+	sink, err := f(conf.Sinks[conf.Sink])
+	if err != nil {
+		return nil, 0, err
+	}
+	logger := audit.NewLogger(sink, conf.RedactFields, conf.RedactQueryParams)
+
+	handler := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			h.ServeHTTP(rw, r)
+
+			rec := &audit.Record{
+				Time:     time.Now().UTC(),
+				Protocol: "http",
+				Action:   r.Method,
+				Resource: r.URL.RequestURI(),
+				Outcome:  outcome(rw.status),
+				Status:   strconv.Itoa(rw.status),
+				ClientIP: clientip.Get(r, conf.TrustForwardedFor),
+			}
+			if u, ok := user.ContextGetUser(r.Context()); ok {
+				rec.User = u.Username
+				rec.Idp = u.Id.GetIdp()
+				if by := user.Impersonator(u); by != nil {
+					rec.Impersonator = by.Username
+				}
+			}
+			if err := logger.Log(rec); err != nil {
+				appctx.GetLogger(r.Context()).Error().Err(err).Msg("audit: error writing audit record")
+			}
+		})
+	}
+
+	return handler, conf.Priority, nil
+}
+
+// statusWriter remembers the status of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func outcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return audit.OutcomeDenied
+	case status >= 400:
+		return audit.OutcomeFailure
+	default:
+		return audit.OutcomeSuccess
+	}
+}
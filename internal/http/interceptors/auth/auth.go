@@ -19,20 +19,29 @@
 package auth
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/internal/http/interceptors/auth/credential/registry"
 	tokenregistry "github.com/cs3org/reva/internal/http/interceptors/auth/token/registry"
 	tokenwriterregistry "github.com/cs3org/reva/internal/http/interceptors/auth/tokenwriter/registry"
 	"github.com/cs3org/reva/pkg/appctx"
 	"github.com/cs3org/reva/pkg/auth"
+	"github.com/cs3org/reva/pkg/auth/mfa"
+	"github.com/cs3org/reva/pkg/auth/scope"
+	"github.com/cs3org/reva/pkg/auth/throttle"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/clientip"
 	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/signedurl"
 	"github.com/cs3org/reva/pkg/sharedconf"
 	"github.com/cs3org/reva/pkg/token"
 	tokenmgr "github.com/cs3org/reva/pkg/token/manager/registry"
@@ -56,6 +65,31 @@ type config struct {
 	TokenManagers        map[string]map[string]interface{} `mapstructure:"token_managers"`
 	TokenWriter          string                            `mapstructure:"token_writer"`
 	TokenWriters         map[string]map[string]interface{} `mapstructure:"token_writers"`
+	// Throttle delays the basic auth logins following failed attempts,
+	// per user and per client address.
+	Throttle map[string]interface{} `mapstructure:"throttle"`
+	// TrustForwardedFor takes the client address from the last entry of the
+	// X-Forwarded-For header, only enable it behind a proxy that appends it.
+	TrustForwardedFor bool `mapstructure:"trust_forwarded_for"`
+	// TransferSharedSecret verifies the URLs signed by the gateway for the
+	// data servers, signed URLs are refused if empty.
+	TransferSharedSecret string `mapstructure:"transfer_shared_secret"`
+	// MFAEnrollPaths are the paths the users who have to enroll a second
+	// factor can access until they did.
+	MFAEnrollPaths []string `mapstructure:"mfa_enroll_paths"`
+	// UserAgentChallenges select the challenges sent to the clients by
+	// their User-Agent, the first matching wins. The other clients get
+	// those of the credential chain.
+	UserAgentChallenges []*userAgentRule `mapstructure:"user_agent_challenges"`
+	// LoginURL is where the "redirect" challenge sends the clients.
+	LoginURL string `mapstructure:"login_url"`
+	// ResourceTokenPaths are the paths the tokens limited to a single
+	// resource, like those of the applications, can access: the data
+	// services, which only serve the transfers initiated through the gateway.
+	ResourceTokenPaths []string `mapstructure:"resource_token_paths"`
+	// LogoutPath is where the clients POST to revoke their token, which
+	// the token manager must support. Disabled if empty.
+	LogoutPath string `mapstructure:"logout_path"`
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -93,20 +127,45 @@ func New(m map[string]interface{}, unprotected []string) (global.Middleware, err
 		conf.CredentialChain = []string{"basic", "bearer"}
 	}
 
-	credChain := []auth.CredentialStrategy{}
-	for i := range conf.CredentialChain {
-		f, ok := registry.NewCredentialFuncs[conf.CredentialChain[i]]
+	if len(conf.MFAEnrollPaths) == 0 {
+		conf.MFAEnrollPaths = []string{"/ocs/v1.php/cloud/mfa", "/ocs/v2.php/cloud/mfa"}
+	}
+
+	if len(conf.ResourceTokenPaths) == 0 {
+		conf.ResourceTokenPaths = []string{"/datagateway", "/data"}
+	}
+
+	credStrategies := map[string]auth.CredentialStrategy{}
+	getCredStrategy := func(name string) (auth.CredentialStrategy, error) {
+		if s, ok := credStrategies[name]; ok {
+			return s, nil
+		}
+		f, ok := registry.NewCredentialFuncs[name]
 		if !ok {
-			return nil, fmt.Errorf("credential strategy not found: %s", conf.CredentialChain[i])
+			return nil, fmt.Errorf("credential strategy not found: %s", name)
+		}
+		s, err := f(conf.CredentialStrategies[name])
+		if err != nil {
+			return nil, err
 		}
+		credStrategies[name] = s
+		return s, nil
+	}
 
-		credStrategy, err := f(conf.CredentialStrategies[conf.CredentialChain[i]])
+	credChain := []auth.CredentialStrategy{}
+	for i := range conf.CredentialChain {
+		credStrategy, err := getCredStrategy(conf.CredentialChain[i])
 		if err != nil {
 			return nil, err
 		}
 		credChain = append(credChain, credStrategy)
 	}
 
+	challenger, err := newChallenger(conf.UserAgentChallenges, conf.LoginURL, credChain, getCredStrategy)
+	if err != nil {
+		return nil, err
+	}
+
 	g, ok := tokenregistry.NewTokenFuncs[conf.TokenStrategy]
 	if !ok {
 		return nil, fmt.Errorf("token strategy not found: %s", conf.TokenStrategy)
@@ -137,6 +196,11 @@ func New(m map[string]interface{}, unprotected []string) (global.Middleware, err
 		return nil, err
 	}
 
+	throttler, err := throttle.New(conf.Throttle)
+	if err != nil {
+		return nil, err
+	}
+
 	chain := func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -158,6 +222,19 @@ func New(m map[string]interface{}, unprotected []string) (global.Middleware, err
 				return
 			}
 
+			// the URLs signed by the gateway carry the user they were signed for
+			if signedurl.IsSigned(r) {
+				u, err := signedurl.Verify(r, conf.TransferSharedSecret)
+				if err != nil {
+					log.Warn().Err(err).Msg("invalid signed url")
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				r = r.WithContext(user.ContextSetUser(ctx, u))
+				h.ServeHTTP(w, r)
+				return
+			}
+
 			// check for token
 			tkn := tokenStrategy.GetToken(r)
 			if tkn == "" {
@@ -177,19 +254,37 @@ func New(m map[string]interface{}, unprotected []string) (global.Middleware, err
 				if creds == nil {
 					// TODO read realm from forwarded for header?
 					// see https://github.com/stanvit/go-forwarded as middleware
-					// indicate all possible authentications to the client
-					for i := range credChain {
-						credChain[i].AddWWWAuthenticate(w, r, conf.Realm)
-					}
-					w.WriteHeader(http.StatusUnauthorized)
+					// indicate the authentications selected for the client
+					challenger.challenge(w, r, conf.Realm)
 					return
 				}
 
+				// only passwords can be guessed, the other credentials are tokens
+				var throttleKeys []string
+				if throttler != nil && creds.Type == "basic" {
+					throttleKeys = []string{throttle.UserKey(creds.ClientID), throttle.IPKey(clientip.Get(r, conf.TrustForwardedFor))}
+					wait, err := throttler.Wait(ctx, throttleKeys...)
+					if err != nil {
+						log.Error().Err(err).Msg("error checking failed login attempts")
+					}
+					if wait > 0 {
+						log.Warn().Str("user", creds.ClientID).Dur("wait", wait).Msg("login throttled after failed attempts")
+						w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+						w.WriteHeader(http.StatusTooManyRequests)
+						return
+					}
+				}
+
 				req := &gateway.AuthenticateRequest{
 					Type:         creds.Type,
 					ClientId:     creds.ClientID,
 					ClientSecret: creds.ClientSecret,
 				}
+				if code := r.Header.Get(mfa.Header); code != "" {
+					req.Opaque = &types.Opaque{Map: map[string]*types.OpaqueEntry{
+						mfa.OpaqueKey: {Decoder: "plain", Value: []byte(code)},
+					}}
+				}
 
 				log.Debug().Msgf("AuthenticateRequest: %+v against %s", req, conf.GatewaySvc)
 
@@ -207,13 +302,39 @@ func New(m map[string]interface{}, unprotected []string) (global.Middleware, err
 					return
 				}
 
+				if res.Status.Code == rpc.Code_CODE_RESOURCE_EXHAUSTED {
+					log.Warn().Str("user", creds.ClientID).Msg("login throttled by the auth provider")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+
+				// the password was right, the client has to ask the user for a code
+				if string(res.Opaque.GetMap()[mfa.OpaqueKey].GetValue()) == "required" {
+					log.Debug().Str("user", creds.ClientID).Msg("second factor required")
+					w.Header().Set(mfa.Header, "required")
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
 				if res.Status.Code != rpc.Code_CODE_OK {
 					err := status.NewErrorFromCode(res.Status.Code, "auth")
 					log.Err(err).Msg("error generating access token from credentials")
+					if len(throttleKeys) > 0 && res.Status.Code != rpc.Code_CODE_INTERNAL {
+						if err := throttler.Fail(ctx, throttleKeys...); err != nil {
+							log.Error().Err(err).Msg("error counting failed login attempt")
+						}
+					}
 					w.WriteHeader(http.StatusUnauthorized)
 					return
 				}
 
+				// the address keeps its failures, to slow down guessing across users
+				if len(throttleKeys) > 0 {
+					if err := throttler.Reset(ctx, throttleKeys[0]); err != nil {
+						log.Error().Err(err).Msg("error resetting failed login attempts")
+					}
+				}
+
 				log.Info().Msg("core access token generated")
 				// write token to response
 				tkn = res.Token
@@ -237,6 +358,33 @@ func New(m map[string]interface{}, unprotected []string) (global.Middleware, err
 				return
 			}
 
+			if conf.LogoutPath != "" && r.URL.Path == conf.LogoutPath && r.Method == http.MethodPost {
+				w.WriteHeader(logout(ctx, tokenManager, tkn))
+				return
+			}
+
+			// the users who have to enroll a second factor can only do that
+			if sc := scope.Get(u); sc == scope.Enroll {
+				if !utils.Skip(r.URL.Path, conf.MFAEnrollPaths) {
+					log.Warn().Str("path", r.URL.Path).Msg("second factor enrollment required")
+					w.Header().Set(mfa.Header, "enroll")
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+			} else if !scope.AllowsHTTPMethod(sc, r.Method) {
+				// scoped tokens, like the read only app passwords, are limited to some requests
+				log.Warn().Str("method", r.Method).Str("scope", sc).Msg("request not allowed with the scope of the token")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			// the resource cannot be told from the paths of the other services
+			if scope.Resource(u) != nil && !utils.Skip(r.URL.Path, conf.ResourceTokenPaths) {
+				log.Warn().Str("path", r.URL.Path).Msg("request not allowed with a token limited to a resource")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
 			// store user and core access token in context.
 			ctx = user.ContextSetUser(ctx, u)
 			ctx = token.ContextSetToken(ctx, tkn)
@@ -248,3 +396,19 @@ func New(m map[string]interface{}, unprotected []string) (global.Middleware, err
 	}
 	return chain, nil
 }
+
+// logout revokes the token and returns the status of the response.
+func logout(ctx context.Context, tm token.Manager, tkn string) int {
+	log := appctx.GetLogger(ctx)
+	r, ok := tm.(token.Revoker)
+	if !ok {
+		log.Error().Msg("the token manager cannot revoke tokens")
+		return http.StatusNotImplemented
+	}
+	if err := r.RevokeToken(ctx, tkn); err != nil {
+		log.Error().Err(err).Msg("error revoking token")
+		return http.StatusInternalServerError
+	}
+	log.Info().Msg("token revoked")
+	return http.StatusNoContent
+}
@@ -0,0 +1,65 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/token"
+)
+
+type manager struct{}
+
+func (manager) MintToken(ctx context.Context, u *userpb.User) (string, error) {
+	return "", nil
+}
+
+func (manager) DismantleToken(ctx context.Context, tkn string) (*userpb.User, error) {
+	return nil, nil
+}
+
+type revoker struct {
+	manager
+	revoked []string
+}
+
+func (r *revoker) RevokeToken(ctx context.Context, tkn string) error {
+	r.revoked = append(r.revoked, tkn)
+	return nil
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+
+	r := &revoker{}
+	if code := logout(ctx, r, "tkn"); code != http.StatusNoContent {
+		t.Errorf("got status %d, expected %d", code, http.StatusNoContent)
+	}
+	if len(r.revoked) != 1 || r.revoked[0] != "tkn" {
+		t.Errorf("expected the token to be revoked, got %v", r.revoked)
+	}
+
+	var m token.Manager = manager{}
+	if code := logout(ctx, m, "tkn"); code != http.StatusNotImplemented {
+		t.Errorf("got status %d, expected %d", code, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/auth"
+)
+
+// redirectChallenge sends the clients to the login url instead of
+// challenging them, for the browsers logging in with OIDC.
+const redirectChallenge = "redirect"
+
+// userAgentRule maps the clients whose User-Agent contains UserAgent,
+// ignoring case, to the credential strategies challenging them.
+type userAgentRule struct {
+	UserAgent  string   `mapstructure:"user_agent"`
+	Challenges []string `mapstructure:"challenges"`
+}
+
+type userAgentChallenge struct {
+	pattern    string
+	strategies []auth.CredentialStrategy
+	redirect   bool
+}
+
+// challenger answers the unauthenticated requests with the challenges
+// selected for their user agent, or with those of the whole chain.
+type challenger struct {
+	byUserAgent []userAgentChallenge
+	chain       []auth.CredentialStrategy
+	loginURL    string
+}
+
+func newChallenger(rules []*userAgentRule, loginURL string, chain []auth.CredentialStrategy, get func(string) (auth.CredentialStrategy, error)) (*challenger, error) {
+	c := &challenger{chain: chain, loginURL: loginURL}
+	for _, rule := range rules {
+		if rule.UserAgent == "" {
+			return nil, fmt.Errorf("user_agent is required in the user agent challenges")
+		}
+		uac := userAgentChallenge{pattern: strings.ToLower(rule.UserAgent)}
+		for _, name := range rule.Challenges {
+			if name == redirectChallenge {
+				if loginURL == "" {
+					return nil, fmt.Errorf("login_url is required to redirect the user agent %q", rule.UserAgent)
+				}
+				uac.redirect = true
+				continue
+			}
+			s, err := get(name)
+			if err != nil {
+				return nil, err
+			}
+			uac.strategies = append(uac.strategies, s)
+		}
+		c.byUserAgent = append(c.byUserAgent, uac)
+	}
+	return c, nil
+}
+
+func (c *challenger) match(r *http.Request) *userAgentChallenge {
+	ua := strings.ToLower(r.UserAgent())
+	for i := range c.byUserAgent {
+		if strings.Contains(ua, c.byUserAgent[i].pattern) {
+			return &c.byUserAgent[i]
+		}
+	}
+	return nil
+}
+
+// challenge writes the 401 response, or the redirection to the login
+// page for the page loads of the clients mapped to it.
+func (c *challenger) challenge(w http.ResponseWriter, r *http.Request, realm string) {
+	strategies := c.chain
+	if uac := c.match(r); uac != nil {
+		if uac.redirect && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			http.Redirect(w, r, c.loginURL, http.StatusFound)
+			return
+		}
+		strategies = uac.strategies
+	}
+	for i := range strategies {
+		strategies[i].AddWWWAuthenticate(w, r, realm)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
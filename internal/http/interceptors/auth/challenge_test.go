@@ -0,0 +1,96 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cs3org/reva/internal/http/interceptors/auth/credential/strategy/basic"
+	"github.com/cs3org/reva/internal/http/interceptors/auth/credential/strategy/bearer"
+	"github.com/cs3org/reva/pkg/auth"
+)
+
+func TestChallenge(t *testing.T) {
+	basicStrategy, _ := basic.New(nil)
+	bearerStrategy, _ := bearer.New(nil)
+	strategies := map[string]auth.CredentialStrategy{"basic": basicStrategy, "bearer": bearerStrategy}
+	get := func(name string) (auth.CredentialStrategy, error) { return strategies[name], nil }
+
+	c, err := newChallenger([]*userAgentRule{
+		{UserAgent: "mirall", Challenges: []string{"bearer"}},
+		{UserAgent: "Microsoft-WebDAV", Challenges: []string{"basic"}},
+		{UserAgent: "davfs2", Challenges: []string{"basic"}},
+		{UserAgent: "mozilla", Challenges: []string{"redirect"}},
+	}, "https://cloud.example.org/login", []auth.CredentialStrategy{basicStrategy, bearerStrategy}, get)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, userAgent string
+		code              int
+		challenges        []string
+	}{
+		{"PROPFIND", "Mozilla/5.0 (Windows) mirall/3.4.0", http.StatusUnauthorized, []string{`Bearer realm="cloud"`}},
+		{"PROPFIND", "Microsoft-WebDAV-MiniRedir/10.0.19043", http.StatusUnauthorized, []string{`Basic realm="cloud"`}},
+		{"GET", "Mozilla/5.0 (Macintosh) Firefox/118.0", http.StatusFound, nil},
+		{"PROPFIND", "Mozilla/5.0 (Macintosh) Firefox/118.0", http.StatusUnauthorized, nil},
+		{"GET", "Mozilla/5.0 (Linux) davfs2", http.StatusUnauthorized, []string{`Basic realm="cloud"`}},
+		{"GET", "curl/8.0", http.StatusUnauthorized, []string{`Basic realm="cloud"`, `Bearer realm="cloud"`}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/remote.php/webdav/", nil)
+		r.Header.Set("User-Agent", tt.userAgent)
+		w := httptest.NewRecorder()
+		c.challenge(w, r, "cloud")
+		if w.Code != tt.code {
+			t.Errorf("%s %s: got status %d, expected %d", tt.method, tt.userAgent, w.Code, tt.code)
+		}
+		if got := w.Header().Values("WWW-Authenticate"); !reflect.DeepEqual(got, tt.challenges) {
+			t.Errorf("%s %s: got challenges %v, expected %v", tt.method, tt.userAgent, got, tt.challenges)
+		}
+	}
+
+	if _, err := newChallenger([]*userAgentRule{{UserAgent: "mozilla", Challenges: []string{"redirect"}}}, "", nil, get); err == nil {
+		t.Error("expected an error redirecting without login url")
+	}
+}
+
+func TestParseUserAgentChallenges(t *testing.T) {
+	conf, err := parseConfig(map[string]interface{}{
+		"login_url": "https://cloud.example.org/login",
+		"user_agent_challenges": []map[string]interface{}{
+			{"user_agent": "mirall", "challenges": []interface{}{"bearer"}},
+			{"user_agent": "mozilla", "challenges": []interface{}{"redirect"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*userAgentRule{
+		{UserAgent: "mirall", Challenges: []string{"bearer"}},
+		{UserAgent: "mozilla", Challenges: []string{"redirect"}},
+	}
+	if !reflect.DeepEqual(conf.UserAgentChallenges, expected) {
+		t.Errorf("got rules %+v, expected %+v", conf.UserAgentChallenges, expected)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package negotiate
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cs3org/reva/internal/http/interceptors/auth/credential/registry"
+	"github.com/cs3org/reva/pkg/auth"
+)
+
+func init() {
+	registry.Register("negotiate", New)
+}
+
+type strategy struct{}
+
+// New returns a new auth strategy that checks for SPNEGO tokens, as sent by
+// Kerberos clients.
+// See https://tools.ietf.org/html/rfc4559
+func New(m map[string]interface{}) (auth.CredentialStrategy, error) {
+	return &strategy{}, nil
+}
+
+func (s *strategy) GetCredentials(w http.ResponseWriter, r *http.Request) (*auth.Credentials, error) {
+	hdr := r.Header.Get("Authorization")
+	if !strings.HasPrefix(hdr, "Negotiate ") {
+		return nil, fmt.Errorf("no negotiate auth provided")
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(hdr, "Negotiate "))
+	if token == "" {
+		return nil, fmt.Errorf("empty negotiate token")
+	}
+	return &auth.Credentials{Type: "negotiate", ClientSecret: token}, nil
+}
+
+func (s *strategy) AddWWWAuthenticate(w http.ResponseWriter, r *http.Request, realm string) {
+	// the realm is not part of the negotiate challenge
+	w.Header().Add("WWW-Authenticate", "Negotiate")
+}
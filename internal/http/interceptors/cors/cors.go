@@ -19,6 +19,10 @@
 package cors
 
 import (
+	"net/http"
+	"sort"
+	"strings"
+
 	"github.com/cs3org/reva/pkg/rhttp/global"
 	"github.com/mitchellh/mapstructure"
 	"github.com/rs/cors"
@@ -42,6 +46,9 @@ type config struct {
 	AllowedHeaders     []string `mapstructure:"allowed_headers"`
 	ExposedHeaders     []string `mapstructure:"exposed_headers"`
 	AllowedOrigins     []string `mapstructure:"allowed_origins"`
+	// Services overrides the options above for the requests below the given
+	// path prefixes, e.g. "ocs" or "data", the options not set are inherited.
+	Services map[string]map[string]interface{} `mapstructure:"services"`
 }
 
 // New creates a new CORS middleware.
@@ -61,16 +68,46 @@ func New(m map[string]interface{}) (global.Middleware, int, error) {
 	}
 
 	if len(conf.AllowedMethods) == 0 {
-		conf.AllowedMethods = []string{"OPTIONS", "GET", "PUT", "POST", "DELETE", "MKCOL", "PROPFIND", "PROPPATCH", "MOVE", "COPY", "REPORT", "SEARCH"}
+		conf.AllowedMethods = []string{"OPTIONS", "HEAD", "GET", "PUT", "POST", "PATCH", "DELETE", "MKCOL", "PROPFIND", "PROPPATCH", "MOVE", "COPY", "REPORT", "SEARCH", "LOCK", "UNLOCK"}
 	}
 
 	if len(conf.AllowedHeaders) == 0 {
-		conf.AllowedHeaders = []string{"Origin", "Accept", "Content-Type", "Depth", "Authorization", "Ocs-Apirequest", "If-None-Match", "If-Match", "Destination", "Overwrite", "X-Request-Id", "X-Requested-With"}
+		// the webdav, ocs, tus and data transfer headers
+		conf.AllowedHeaders = []string{"Origin", "Accept", "Content-Type", "Depth", "Authorization", "Ocs-Apirequest", "If-None-Match", "If-Match", "Destination", "Overwrite", "X-Request-Id", "X-Requested-With",
+			"Range", "If-Range", "Cache-Control", "If", "Lock-Token", "Timeout", "OC-Checksum", "OC-Total-Length", "X-OC-Mtime", "X-Access-Token", "X-Reva-Transfer",
+			"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset", "Upload-Defer-Length", "Upload-Checksum"}
+	}
+
+	if len(conf.ExposedHeaders) == 0 {
+		conf.ExposedHeaders = []string{"ETag", "OC-ETag", "OC-FileId", "OC-Checksum", "Content-Disposition", "Content-Range", "Accept-Ranges", "Location", "Lock-Token", "X-Access-Token",
+			"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length"}
+	}
+
+	h := &handler{fallback: newCors(conf)}
+	for prefix, sm := range conf.Services {
+		// a copy of the global options, the ones set for the service replace them
+		sc := *conf
+		dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{ZeroFields: true, Result: &sc})
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := dec.Decode(sm); err != nil {
+			return nil, 0, err
+		}
+		h.services = append(h.services, service{prefix: "/" + strings.Trim(prefix, "/"), cors: newCors(&sc)})
 	}
+	// the longest prefixes first, so that they win over their parents
+	sort.Slice(h.services, func(i, j int) bool {
+		return len(h.services[i].prefix) > len(h.services[j].prefix)
+	})
+
+	return h.Handler, conf.Priority, nil
+}
 
+func newCors(conf *config) *cors.Cors {
 	// TODO(jfd): use log from request context, otherwise fmt will be used to log,
 	// preventing us from pinging the log to eg jq
-	c := cors.New(cors.Options{
+	return cors.New(cors.Options{
 		AllowCredentials:   conf.AllowCredentials,
 		AllowedHeaders:     conf.AllowedHeaders,
 		AllowedMethods:     conf.AllowedMethods,
@@ -80,6 +117,32 @@ func New(m map[string]interface{}) (global.Middleware, int, error) {
 		OptionsPassthrough: conf.OptionsPassthrough,
 		Debug:              conf.Debug,
 	})
+}
+
+type service struct {
+	prefix string
+	cors   *cors.Cors
+}
 
-	return c.Handler, conf.Priority, nil
+type handler struct {
+	services []service
+	fallback *cors.Cors
+}
+
+// Handler applies the options of the service the request is for.
+func (h *handler) Handler(next http.Handler) http.Handler {
+	handlers := make(map[string]http.Handler, len(h.services))
+	for _, s := range h.services {
+		handlers[s.prefix] = s.cors.Handler(next)
+	}
+	fallback := h.fallback.Handler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range h.services {
+			if r.URL.Path == s.prefix || strings.HasPrefix(r.URL.Path, s.prefix+"/") || s.prefix == "/" {
+				handlers[s.prefix].ServeHTTP(w, r)
+				return
+			}
+		}
+		fallback.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,79 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServices(t *testing.T) {
+	m, _, err := New(map[string]interface{}{
+		"allowed_origins": []string{"https://web.example.org"},
+		"services": map[string]map[string]interface{}{
+			"data": {
+				"allowed_origins": []string{"*"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	h := m(next)
+
+	tests := []struct {
+		path   string
+		origin string
+		method string
+		want   string
+	}{
+		{"/remote.php/webdav/file.txt", "https://web.example.org", "PROPFIND", "https://web.example.org"},
+		{"/remote.php/webdav/file.txt", "https://evil.example.org", "PROPFIND", ""},
+		{"/data/tkn", "https://evil.example.org", "PUT", "*"},
+		{"/dataset", "https://evil.example.org", "PUT", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+		r.Header.Set("Origin", tt.origin)
+		r.Header.Set("Access-Control-Request-Method", tt.method)
+		r.Header.Set("Access-Control-Request-Headers", "Authorization, Depth")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: preflight answered %d, expected it not to reach the next handler", tt.path, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("%s from %s: got allowed origin %q, want %q", tt.path, tt.origin, got, tt.want)
+		}
+	}
+
+	// the actual requests carry the headers also when rejected
+	r := httptest.NewRequest("PROPFIND", "/remote.php/webdav/file.txt", nil)
+	r.Header.Set("Origin", "https://web.example.org")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("Access-Control-Allow-Origin") != "https://web.example.org" {
+		t.Errorf("got %d with allowed origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package limits
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	defaultPriority = 150
+)
+
+func init() {
+	global.RegisterMiddleware("limits", New)
+}
+
+type config struct {
+	Priority int `mapstructure:"priority"`
+	// MaxRequestSize is the size in bytes of the largest request body
+	// accepted, 0 disables the limit.
+	MaxRequestSize int64 `mapstructure:"max_request_size"`
+	// MaxPathLength is the length of the longest request path accepted, 0
+	// disables the limit.
+	MaxPathLength int `mapstructure:"max_path_length"`
+	// MaxPathDepth is the number of segments of the deepest request path
+	// accepted, 0 disables the limit.
+	MaxPathDepth int `mapstructure:"max_path_depth"`
+}
+
+// New returns a new HTTP middleware rejecting the requests with a body
+// larger than allowed with 413 Request Entity Too Large, and the ones with a
+// path too long or too deep with 414 Request-URI Too Long. The bodies
+// without a Content-Length are cut at the limit.
+func New(m map[string]interface{}) (global.Middleware, int, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, 0, err
+	}
+
+	if conf.Priority == 0 {
+		conf.Priority = defaultPriority
+	}
+
+	handler := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := appctx.GetLogger(r.Context())
+
+			if conf.MaxPathLength > 0 && len(r.URL.Path) > conf.MaxPathLength {
+				log.Warn().Int("length", len(r.URL.Path)).Msg("limits: request path too long")
+				w.WriteHeader(http.StatusRequestURITooLong)
+				return
+			}
+			if conf.MaxPathDepth > 0 && depth(r.URL.Path) > conf.MaxPathDepth {
+				log.Warn().Int("depth", depth(r.URL.Path)).Msg("limits: request path too deep")
+				w.WriteHeader(http.StatusRequestURITooLong)
+				return
+			}
+
+			if conf.MaxRequestSize > 0 {
+				if r.ContentLength > conf.MaxRequestSize {
+					log.Warn().Int64("size", r.ContentLength).Msg("limits: request body too large")
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, conf.MaxRequestSize)
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	return handler, conf.Priority, nil
+}
+
+// depth returns the number of segments of p.
+func depth(p string) int {
+	n := 0
+	for _, seg := range strings.Split(p, "/") {
+		if seg != "" {
+			n++
+		}
+	}
+	return n
+}
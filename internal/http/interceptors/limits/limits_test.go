@@ -0,0 +1,69 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package limits
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	m, _, err := New(map[string]interface{}{
+		"max_request_size": 10,
+		"max_path_length":  30,
+		"max_path_depth":   3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"/data/a/b", "0123456789", false, http.StatusOK},
+		{"/data/a/b", "0123456789a", false, http.StatusRequestEntityTooLarge},
+		{"/data/a/b", "0123456789a", true, http.StatusBadRequest},
+		{"/data/a/b/c", "", false, http.StatusRequestURITooLong},
+		{"/data/" + strings.Repeat("a", 30), "", false, http.StatusRequestURITooLong},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body))
+		if tt.chunked {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s with %d bytes: got %d, want %d", tt.path, len(tt.body), w.Code, tt.want)
+		}
+	}
+}
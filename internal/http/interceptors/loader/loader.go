@@ -20,7 +20,11 @@ package loader
 
 import (
 	// Load core HTTP middlewares.
+	_ "github.com/cs3org/reva/internal/http/interceptors/audit"
 	_ "github.com/cs3org/reva/internal/http/interceptors/cors"
+	_ "github.com/cs3org/reva/internal/http/interceptors/limits"
+	_ "github.com/cs3org/reva/internal/http/interceptors/policy"
 	_ "github.com/cs3org/reva/internal/http/interceptors/providerauthorizer"
+	_ "github.com/cs3org/reva/internal/http/interceptors/ratelimit"
 	// Add your own middlware.
 )
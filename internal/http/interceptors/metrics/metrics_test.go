@@ -0,0 +1,89 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/metrics"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// row returns the data of the row of the view with the tags.
+func row(t *testing.T, name string, tags ...tag.Tag) view.AggregationData {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+next:
+	for _, r := range rows {
+		if len(r.Tags) != len(tags) {
+			continue
+		}
+		for i := range tags {
+			if r.Tags[i] != tags[i] {
+				continue next
+			}
+		}
+		return r.Data
+	}
+	t.Fatalf("no row of %s with tags %v in %v", name, tags, rows)
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	if err := view.Register(metrics.DefaultViews...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(metrics.DefaultViews...)
+
+	h := New("ocdav")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PROPFIND" {
+			w.WriteHeader(http.StatusMultiStatus)
+			// only the first status code is recorded
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("data"))
+	}))
+	for _, method := range []string{"PROPFIND", "GET", "GET"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/remote.php/webdav/file", nil))
+	}
+
+	service := tag.Tag{Key: metrics.KeyService, Value: "ocdav"}
+	propfind := tag.Tag{Key: metrics.KeyMethod, Value: "PROPFIND"}
+	get := tag.Tag{Key: metrics.KeyMethod, Value: "GET"}
+	// the tags of the rows are sorted by key
+	if d := row(t, "http/server/requests", tag.Tag{Key: metrics.KeyCode, Value: "207"}, propfind, service).(*view.CountData); d.Value != 1 {
+		t.Errorf("got %d PROPFIND requests, expected 1", d.Value)
+	}
+	if d := row(t, "http/server/requests", tag.Tag{Key: metrics.KeyCode, Value: "200"}, get, service).(*view.CountData); d.Value != 2 {
+		t.Errorf("got %d GET requests, expected 2", d.Value)
+	}
+	if d := row(t, "http/server/latency", get, service).(*view.DistributionData); d.Count != 2 {
+		t.Errorf("got %d latencies, expected 2", d.Count)
+	}
+	if d := row(t, "http/server/in_flight", get, service).(*view.LastValueData); d.Value != 0 {
+		t.Errorf("got %v requests in flight, expected 0", d.Value)
+	}
+}
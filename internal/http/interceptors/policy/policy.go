@@ -0,0 +1,114 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package policy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/policy"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// the policies are evaluated once the clients are rate limited
+	defaultPriority = 400
+)
+
+func init() {
+	global.RegisterMiddleware("policy", New)
+}
+
+type config struct {
+	Priority      int `mapstructure:"priority"`
+	policy.Config `mapstructure:",squash"`
+}
+
+// ocsShareTypes maps the share types of the OCS API to the ones of the input.
+var ocsShareTypes = map[string]string{
+	"0": policy.ShareTypeUser,
+	"1": policy.ShareTypeGroup,
+	"3": policy.ShareTypePublicLink,
+	"6": policy.ShareTypeOCM,
+}
+
+// New returns a new HTTP middleware that rejects the requests denied by the
+// policies with 403 Forbidden.
+func New(m map[string]interface{}) (global.Middleware, int, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, 0, err
+	}
+	if conf.Priority == 0 {
+		conf.Priority = defaultPriority
+	}
+
+	e, err := policy.New(context.Background(), &conf.Config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	handler := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			log := appctx.GetLogger(ctx)
+
+			in := newInput(r)
+			allowed, err := e.Allow(ctx, in)
+			if err != nil {
+				log.Error().Err(err).Msg("policy: error evaluating policies")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				log.Warn().Str("method", r.Method).Str("path", in.Path).Msg("policy: request denied")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+	return handler, conf.Priority, nil
+}
+
+// newInput describes the request. The share type and role are read from
+// the query or the urlencoded form of the OCS share requests, the form is
+// left parsed for the handlers.
+func newInput(r *http.Request) *policy.Input {
+	in := &policy.Input{
+		Protocol: "http",
+		Method:   r.Method,
+		Path:     r.URL.Path,
+	}
+	if u, ok := user.ContextGetUser(r.Context()); ok {
+		in.User = policy.NewUser(u)
+	}
+
+	if strings.Contains(r.URL.Path, "/shares") {
+		if err := r.ParseForm(); err == nil {
+			in.ShareType = ocsShareTypes[r.Form.Get("shareType")]
+			in.Role = r.Form.Get("role")
+		}
+	}
+	return in
+}
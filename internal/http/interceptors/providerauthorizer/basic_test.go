@@ -0,0 +1,64 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package providerauthorizer
+
+import (
+	"context"
+	"testing"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"google.golang.org/grpc"
+)
+
+// basicGateway authenticates the users whose password is their username.
+type basicGateway struct {
+	gateway.GatewayAPIClient
+}
+
+func (g basicGateway) Authenticate(ctx context.Context, req *gateway.AuthenticateRequest, opts ...grpc.CallOption) (*gateway.AuthenticateResponse, error) {
+	if req.Type != "basic" || req.ClientSecret != req.ClientId {
+		return &gateway.AuthenticateResponse{Status: &rpc.Status{Code: rpc.Code_CODE_UNAUTHENTICATED}}, nil
+	}
+	return &gateway.AuthenticateResponse{
+		Status: &rpc.Status{Code: rpc.Code_CODE_OK},
+		User:   &userpb.User{Username: req.ClientId, Mail: req.ClientId + "@cernbox.cern.ch"},
+	}, nil
+}
+
+func TestAuthenticateDomain(t *testing.T) {
+	ctx := context.Background()
+	d, err := authenticateDomain(ctx, basicGateway{}, "cernbox", "cernbox")
+	if err != nil || d != "cernbox.cern.ch" {
+		t.Errorf("authenticateDomain() = %s, %v", d, err)
+	}
+	if d, err := authenticateDomain(ctx, basicGateway{}, "cernbox", "wrong"); err == nil {
+		t.Errorf("expected the wrong password to be refused, got %s", d)
+	}
+}
+
+func TestCredentialsKey(t *testing.T) {
+	if credentialsKey("cernbox", "secret") == credentialsKey("cernbox", "wrong") {
+		t.Error("expected the password to be part of the key")
+	}
+	if credentialsKey("a", "b\x00c") == credentialsKey("a\x00b", "c") {
+		t.Error("expected the username and password to be separated")
+	}
+}
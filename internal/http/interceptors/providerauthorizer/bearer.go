@@ -0,0 +1,99 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package providerauthorizer
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// bearerClaims are the claims of the signed bearer tokens sent by remote
+// providers. The provider is taken from the provider claim, or from the
+// host of the issuer.
+type bearerClaims struct {
+	jwt.StandardClaims
+	Provider string `json:"provider"`
+}
+
+func (c *bearerClaims) domain() string {
+	if d := normalizeDomain(c.Provider); d != "" {
+		return d
+	}
+	return normalizeDomain(c.Issuer)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+// bearerDomain returns the domain of the provider a bearer token comes from.
+// The provider named by the claims must have a secret, which the token must
+// be signed with, so that a provider cannot pass for another one.
+func bearerDomain(tkn string, secrets map[string]string) (string, error) {
+	claims := &bearerClaims{}
+	t, err := jwt.ParseWithClaims(tkn, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		d := claims.domain()
+		if d == "" {
+			return nil, errors.New("provider of the bearer token unknown")
+		}
+		secret, ok := secrets[d]
+		if !ok || secret == "" {
+			return nil, errors.Errorf("no bearer secret for provider %s", d)
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "invalid bearer token")
+	}
+	if !t.Valid {
+		return "", errors.New("invalid bearer token")
+	}
+	return claims.domain(), nil
+}
+
+// normalizeSecrets returns the bearer secrets by normalized domain.
+func normalizeSecrets(secrets map[string]string) map[string]string {
+	n := make(map[string]string, len(secrets))
+	for d, s := range secrets {
+		n[normalizeDomain(d)] = s
+	}
+	return n
+}
+
+// normalizeDomain turns the issuer URLs into domains.
+func normalizeDomain(d string) string {
+	d = strings.TrimSpace(d)
+	if strings.Contains(d, "://") {
+		if u, err := url.Parse(d); err == nil {
+			d = u.Hostname()
+		}
+	}
+	return strings.ToLower(d)
+}
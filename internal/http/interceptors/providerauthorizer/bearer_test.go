@@ -0,0 +1,80 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package providerauthorizer
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func sign(t *testing.T, claims *bearerClaims, secret string) string {
+	tkn, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tkn
+}
+
+func TestBearerDomain(t *testing.T) {
+	secrets := normalizeSecrets(map[string]string{"CERNBox.cern.ch": "cernbox-secret", "surfdrive.surf.nl": "surf-secret"})
+	issued := sign(t, &bearerClaims{StandardClaims: jwt.StandardClaims{Issuer: "https://CERNBox.cern.ch/ocm"}}, "cernbox-secret")
+	provided := sign(t, &bearerClaims{Provider: "surfdrive.surf.nl"}, "surf-secret")
+	forged := sign(t, &bearerClaims{Provider: "cernbox.cern.ch"}, "other")
+	impersonated := sign(t, &bearerClaims{Provider: "cernbox.cern.ch"}, "surf-secret")
+	unknown := sign(t, &bearerClaims{Provider: "unknown.org"}, "surf-secret")
+	anonymous := sign(t, &bearerClaims{}, "surf-secret")
+
+	tests := []struct {
+		name     string
+		token    string
+		secrets  map[string]string
+		expected string
+		fail     bool
+	}{
+		{name: "issuer claim", token: issued, secrets: secrets, expected: "cernbox.cern.ch"},
+		{name: "provider claim", token: provided, secrets: secrets, expected: "surfdrive.surf.nl"},
+		{name: "wrong signature", token: forged, secrets: secrets, fail: true},
+		{name: "secret of another provider", token: impersonated, secrets: secrets, fail: true},
+		{name: "provider without secret", token: unknown, secrets: secrets, fail: true},
+		{name: "signed token without provider", token: anonymous, secrets: secrets, fail: true},
+		{name: "opaque token", token: "cernbox.cern.ch", secrets: secrets, fail: true},
+		{name: "no secrets", token: provided, fail: true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/ocm/shares", nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+
+		tkn, ok := bearerToken(r)
+		if !ok {
+			t.Fatalf("%s: bearer token not found", tt.name)
+		}
+		d, err := bearerDomain(tkn, tt.secrets)
+		switch {
+		case tt.fail && err == nil:
+			t.Errorf("%s: expected an error, got %s", tt.name, d)
+		case !tt.fail && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case d != tt.expected:
+			t.Errorf("%s: got %q, expected %q", tt.name, d, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package providerauthorizer
+
+import (
+	"sync"
+	"time"
+)
+
+// domainCache remembers the provider domain of verified credentials for a
+// limited time.
+type domainCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	domain  string
+	expires time.Time
+}
+
+func newDomainCache(size int, ttl time.Duration) *domainCache {
+	return &domainCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]cacheEntry, size),
+	}
+}
+
+func (c *domainCache) get(key string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return e.domain, true
+}
+
+func (c *domainCache) set(key, domain string) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[key] = cacheEntry{domain: domain, expires: now.Add(c.ttl)}
+}
+
+// evict drops the expired entries or, if there are none, the one closest to expiring.
+// It must be called with the lock held.
+func (c *domainCache) evict(now time.Time) {
+	var oldest string
+	var oldestExpires time.Time
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldest == "" || e.expires.Before(oldestExpires) {
+			oldest, oldestExpires = k, e.expires
+		}
+	}
+	if len(c.entries) >= c.size {
+		delete(c.entries, oldest)
+	}
+}
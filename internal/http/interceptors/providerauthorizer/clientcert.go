@@ -0,0 +1,65 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package providerauthorizer
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/ocm/provider"
+	"github.com/pkg/errors"
+)
+
+// Whether the remote providers authenticate with a TLS client certificate.
+const (
+	clientCertOptional = "optional"
+	clientCertRequired = "required"
+)
+
+// certDomains returns the domains of the client certificate verified by the
+// server, taken from its DNS SANs or, without them, from its common name.
+func certDomains(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	if len(leaf.DNSNames) > 0 {
+		domains := make([]string, 0, len(leaf.DNSNames))
+		for _, d := range leaf.DNSNames {
+			domains = append(domains, strings.ToLower(d))
+		}
+		return domains
+	}
+	if leaf.Subject.CommonName != "" {
+		return []string{strings.ToLower(leaf.Subject.CommonName)}
+	}
+	return nil
+}
+
+// allowedDomain returns the first of the domains allowed by the authorizer.
+func allowedDomain(ctx context.Context, authorizer provider.Authorizer, domains []string) (string, error) {
+	for _, d := range domains {
+		if err := authorizer.IsProviderAllowed(ctx, d); err == nil {
+			return d, nil
+		}
+	}
+	return "", errors.New("none of the certificate domains is a trusted provider: " + strings.Join(domains, ", "))
+}
@@ -0,0 +1,91 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package providerauthorizer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+type listAuthorizer []string
+
+func (l listAuthorizer) IsProviderAllowed(ctx context.Context, domain string) error {
+	for _, d := range l {
+		if d == domain {
+			return nil
+		}
+	}
+	return errtypes.NotFound(domain)
+}
+
+func (l listAuthorizer) ListAllProviders(ctx context.Context) ([]*ocm.ProviderInfo, error) {
+	providers := make([]*ocm.ProviderInfo, 0, len(l))
+	for _, d := range l {
+		providers = append(providers, &ocm.ProviderInfo{Domain: d})
+	}
+	return providers, nil
+}
+
+func TestCertDomains(t *testing.T) {
+	tests := []struct {
+		cert     *x509.Certificate
+		expected []string
+	}{
+		{&x509.Certificate{DNSNames: []string{"OCM.cernbox.cern.ch", "cernbox.cern.ch"}, Subject: pkix.Name{CommonName: "ignored"}}, []string{"ocm.cernbox.cern.ch", "cernbox.cern.ch"}},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "surfdrive.surf.nl"}}, []string{"surfdrive.surf.nl"}},
+		{nil, nil},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "https://localhost/ocm/shares", nil)
+		if tt.cert != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+		}
+		if got := certDomains(r); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("got %v, expected %v", got, tt.expected)
+		}
+	}
+
+	// certificates presented but not verified are ignored
+	r := httptest.NewRequest("POST", "https://localhost/ocm/shares", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{DNSNames: []string{"cernbox.cern.ch"}}}}
+	if got := certDomains(r); got != nil {
+		t.Errorf("expected no domain for an unverified certificate, got %v", got)
+	}
+}
+
+func TestAllowedDomain(t *testing.T) {
+	authorizer := listAuthorizer{"cernbox.cern.ch"}
+	ctx := context.Background()
+
+	if d, err := allowedDomain(ctx, authorizer, []string{"ocm.cernbox.cern.ch", "cernbox.cern.ch"}); err != nil || d != "cernbox.cern.ch" {
+		t.Errorf("got %q %v, expected cernbox.cern.ch", d, err)
+	}
+	if _, err := allowedDomain(ctx, authorizer, []string{"evil.example.org"}); err == nil {
+		t.Error("expected an error for an untrusted provider")
+	}
+}
@@ -19,11 +19,16 @@
 package providerauthorizer
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
-	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
 	"github.com/cs3org/reva/pkg/ocm/provider"
 	"github.com/cs3org/reva/pkg/ocm/provider/authorizer/registry"
@@ -32,10 +37,14 @@ import (
 	"github.com/cs3org/reva/pkg/rhttp/router"
 	"github.com/cs3org/reva/pkg/sharedconf"
 	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
 )
 
 const (
 	defaultPriority = 200
+
+	defaultCacheSize = 1024
+	defaultCacheTTL  = 300
 )
 
 func init() {
@@ -47,6 +56,17 @@ type config struct {
 	Drivers    map[string]map[string]interface{} `mapstructure:"drivers"`
 	OCMPrefix  string                            `mapstructure:"ocm_prefix"`
 	GatewaySvc string
+	// CacheSize is the number of verified credentials whose domain is cached, a negative value disables the cache.
+	CacheSize int `mapstructure:"cache_size"`
+	// CacheTTL is the number of seconds a cached domain stays valid.
+	CacheTTL int `mapstructure:"cache_ttl"`
+	// BearerSecrets are the secrets the bearer tokens of the remote
+	// providers are signed with, by domain. The bearer tokens of the other
+	// providers are rejected.
+	BearerSecrets map[string]string `mapstructure:"bearer_secrets"`
+	// ClientCert is optional or required to authenticate the remote providers
+	// with the TLS client certificate verified by the http server.
+	ClientCert string `mapstructure:"client_cert"`
 }
 
 func getDriver(c *config) (provider.Authorizer, error) {
@@ -69,6 +89,19 @@ func New(m map[string]interface{}) (global.Middleware, int, error) {
 	if conf.OCMPrefix == "" {
 		conf.OCMPrefix = "ocm"
 	}
+	if conf.CacheSize == 0 {
+		conf.CacheSize = defaultCacheSize
+	}
+	if conf.CacheTTL == 0 {
+		conf.CacheTTL = defaultCacheTTL
+	}
+	switch conf.ClientCert {
+	case "", clientCertOptional, clientCertRequired:
+	default:
+		return nil, 0, fmt.Errorf("invalid client_cert: %s", conf.ClientCert)
+	}
+	conf.BearerSecrets = normalizeSecrets(conf.BearerSecrets)
+	cache := newDomainCache(conf.CacheSize, time.Duration(conf.CacheTTL)*time.Second)
 
 	authorizer, err := getDriver(conf)
 	if err != nil {
@@ -86,54 +119,103 @@ func New(m map[string]interface{}) (global.Middleware, int, error) {
 				return
 			}
 
-			username, _, ok := r.BasicAuth()
-			if !ok {
-				log.Error().Err(err).Msg("no basic auth provided")
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-
-			gatewayClient, err := pool.GetGatewayServiceClient(conf.GatewaySvc)
-			if err != nil {
-				log.Error().Err(err).Msg("error getting the grpc client")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
+			if conf.ClientCert != "" {
+				if domains := certDomains(r); len(domains) > 0 {
+					d, err := allowedDomain(ctx, authorizer, domains)
+					if err != nil {
+						log.Error().Err(err).Msg("client certificate of an untrusted provider")
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					log.Debug().Str("domain", d).Msg("provider authenticated with its client certificate")
+					h.ServeHTTP(w, r.WithContext(provider.ContextSetDomain(ctx, d)))
+					return
+				}
+				if conf.ClientCert == clientCertRequired {
+					log.Error().Msg("no verified client certificate provided")
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
 			}
 
-			userRes, err := gatewayClient.FindUsers(ctx, &userpb.FindUsersRequest{
-				Filter: username,
-			})
-			if err != nil {
-				log.Error().Err(err).Msg("error searching for the user")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
+			var domain string
+			if tkn, ok := bearerToken(r); ok {
+				d, err := bearerDomain(tkn, conf.BearerSecrets)
+				if err != nil {
+					log.Error().Err(err).Msg("error resolving the provider of the bearer token")
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				domain = d
+			} else {
+				username, password, ok := r.BasicAuth()
+				if !ok {
+					log.Error().Msg("no basic auth or bearer token provided")
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
 
-			var userAuth *userpb.User
-			for _, user := range userRes.GetUsers() {
-				if user.Username == username {
-					userAuth = user
-					break
+				// the credentials are part of the key, so that only the
+				// ones verified before are served from the cache
+				key := credentialsKey(username, password)
+				d, ok := cache.get(key)
+				if !ok {
+					client, err := pool.GetGatewayServiceClient(conf.GatewaySvc)
+					if err != nil {
+						log.Error().Err(err).Msg("error getting the gateway client")
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					d, err = authenticateDomain(ctx, client, username, password)
+					if err != nil {
+						log.Error().Err(err).Msg("error authenticating the provider")
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					cache.set(key, d)
 				}
-			}
-			domainSplit := strings.Split(userAuth.Mail, "@")
-			if len(domainSplit) != 2 {
-				log.Error().Err(err).Msg("user mail must contain domain")
-				w.WriteHeader(http.StatusBadRequest)
-				return
+				domain = d
 			}
 
-			err = authorizer.IsProviderAllowed(ctx, domainSplit[1])
-			if err != nil {
+			if err := authorizer.IsProviderAllowed(ctx, domain); err != nil {
 				log.Error().Err(err).Msg("provider not registered in OCM")
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
 
-			h.ServeHTTP(w, r)
+			h.ServeHTTP(w, r.WithContext(provider.ContextSetDomain(ctx, domain)))
 		})
 	}
 
 	return handler, defaultPriority, nil
 
 }
+
+// credentialsKey returns the cache key of the basic credentials, which does
+// not keep the password in memory.
+func credentialsKey(username, password string) string {
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	return username + ":" + hex.EncodeToString(sum[:])
+}
+
+// authenticateDomain authenticates the user with the basic credentials
+// through the gateway and returns the domain of its mail address.
+func authenticateDomain(ctx context.Context, client gateway.GatewayAPIClient, username, password string) (string, error) {
+	res, err := client.Authenticate(ctx, &gateway.AuthenticateRequest{
+		Type:         "basic",
+		ClientId:     username,
+		ClientSecret: password,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error authenticating the user")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return "", errors.New("invalid credentials for user: " + username)
+	}
+
+	domainSplit := strings.Split(res.User.GetMail(), "@")
+	if len(domainSplit) != 2 {
+		return "", errors.New("user mail must contain domain")
+	}
+	return domainSplit[1], nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/ratelimit"
+	"github.com/cs3org/reva/pkg/rhttp/clientip"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	defaultPriority = 300
+)
+
+func init() {
+	global.RegisterMiddleware("ratelimit", New)
+}
+
+type config struct {
+	Priority int `mapstructure:"priority"`
+	// IPRate is the number of requests per second allowed per client address, 0 disables it.
+	IPRate  float64 `mapstructure:"ip_rate"`
+	IPBurst int     `mapstructure:"ip_burst"`
+	// UserRate is the number of requests per second allowed per authenticated user, 0 disables it.
+	UserRate  float64 `mapstructure:"user_rate"`
+	UserBurst int     `mapstructure:"user_burst"`
+	// TrustForwardedFor takes the client address from the last entry of the
+	// X-Forwarded-For header, only enable it behind a proxy that appends it.
+	TrustForwardedFor bool `mapstructure:"trust_forwarded_for"`
+}
+
+// New returns a new HTTP middleware that rejects clients exceeding
+// the configured request rates with 429 Too Many Requests.
+func New(m map[string]interface{}) (global.Middleware, int, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, 0, err
+	}
+
+	if conf.Priority == 0 {
+		conf.Priority = defaultPriority
+	}
+
+	ipLimiter := ratelimit.New(conf.IPRate, conf.IPBurst)
+	userLimiter := ratelimit.New(conf.UserRate, conf.UserBurst)
+
+	handler := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			log := appctx.GetLogger(ctx)
+
+			ip := clientip.Get(r, conf.TrustForwardedFor)
+			if !ipLimiter.Allow(ip) {
+				log.Warn().Str("ip", ip).Msg("ratelimit: client address exceeded request rate")
+				tooManyRequests(w, ipLimiter)
+				return
+			}
+
+			if u, ok := user.ContextGetUser(ctx); ok && u.Id != nil {
+				key := u.Id.Idp + "!" + u.Id.OpaqueId
+				if !userLimiter.Allow(key) {
+					log.Warn().Str("user", u.Username).Msg("ratelimit: user exceeded request rate")
+					tooManyRequests(w, userLimiter)
+					return
+				}
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	return handler, conf.Priority, nil
+}
+
+func tooManyRequests(w http.ResponseWriter, l *ratelimit.Limiter) {
+	retry := int(math.Ceil(l.RetryAfter().Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
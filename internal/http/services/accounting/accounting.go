@@ -0,0 +1,304 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package accounting implements a service collecting periodically the usage
+// of the storage by the users, per storage provider, and serving reports of
+// it to the admins in JSON or CSV, for capacity planning and chargeback.
+package accounting
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/accounting"
+	"github.com/cs3org/reva/pkg/accounting/manager/registry"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	global.Register("accounting", New)
+}
+
+type config struct {
+	Prefix     string                            `mapstructure:"prefix"`
+	GatewaySvc string                            `mapstructure:"gatewaysvc"`
+	Driver     string                            `mapstructure:"driver"`
+	Drivers    map[string]map[string]interface{} `mapstructure:"drivers"`
+	// MachineSecret lets the service walk the files on behalf of their owners.
+	MachineSecret string `mapstructure:"machine_secret"`
+	// Users are the users, as <opaqueid>@<idp>, whose usage is collected
+	// every Interval seconds, below Root.
+	Users    []string `mapstructure:"users"`
+	Interval int      `mapstructure:"interval"`
+	Root     string   `mapstructure:"root"`
+	// AdminGroup is the group of the users allowed to get the reports.
+	AdminGroup string `mapstructure:"admin_group"`
+}
+
+type svc struct {
+	conf      *config
+	handler   http.Handler
+	mgr       accounting.Manager
+	collector *collector
+}
+
+// New returns a new accounting service.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "accounting"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.Driver == "" {
+		conf.Driver = "memory"
+	}
+	if conf.Interval == 0 {
+		conf.Interval = 86400
+	}
+	if conf.Root == "" {
+		conf.Root = "/home"
+	}
+	if conf.AdminGroup == "" {
+		conf.AdminGroup = "admin"
+	}
+
+	if conf.MachineSecret == "" && len(conf.Users) > 0 {
+		return nil, errors.New("accounting: machine_secret is required to collect the usage")
+	}
+
+	f, ok := registry.NewFuncs[conf.Driver]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not found for accounting manager", conf.Driver)
+	}
+	mgr, err := f(conf.Drivers[conf.Driver])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &svc{
+		conf:      conf,
+		mgr:       mgr,
+		collector: newCollector(mgr, conf),
+	}
+	s.collector.start()
+	s.setHandler()
+	return s, nil
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	s.collector.stop()
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Handler() http.Handler {
+	return s.handler
+}
+
+func (s *svc) Unprotected() []string {
+	return []string{}
+}
+
+func (s *svc) setHandler() {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var head string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+		if head != "report" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.doReport(w, r)
+	})
+}
+
+func (s *svc) isAdmin(u *userpb.User) bool {
+	for _, g := range u.Groups {
+		if g == s.conf.AdminGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// usageJSON is a usage in the reports.
+type usageJSON struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	StorageID  string    `json:"storage_id"`
+	Bytes      uint64    `json:"bytes"`
+	Files      uint64    `json:"files"`
+	Folders    uint64    `json:"folders"`
+	TrashBytes uint64    `json:"trash_bytes"`
+	TrashItems uint64    `json:"trash_items"`
+}
+
+// doReport answers GET report with the usages, the last ones of every user
+// unless history is set, per user or summed per storage with group=storage.
+// They are filtered with user=<opaqueid>@<idp>, storage=<id> and from and
+// to as RFC 3339 times, and exported with format=json or format=csv.
+func (s *svc) doReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok || !s.isAdmin(u) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	f := &accounting.Filter{StorageID: q.Get("storage")}
+	if uid := q.Get("user"); uid != "" {
+		f.User = parseUserID(uid)
+	}
+	var err error
+	if from := q.Get("from"); from != "" {
+		if f.From, err = time.Parse(time.RFC3339, from); err != nil {
+			http.Error(w, "invalid from time", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := q.Get("to"); to != "" {
+		if f.To, err = time.Parse(time.RFC3339, to); err != nil {
+			http.Error(w, "invalid to time", http.StatusBadRequest)
+			return
+		}
+	}
+	history, _ := strconv.ParseBool(q.Get("history"))
+	group := q.Get("group")
+	if group != "" && group != "user" && group != "storage" {
+		http.Error(w, "invalid group", http.StatusBadRequest)
+		return
+	}
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+
+	usages, err := s.mgr.List(ctx, f)
+	if err != nil {
+		log.Error().Err(err).Msg("accounting: error listing usages")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !history {
+		usages = accounting.Latest(usages)
+	}
+	if group == "storage" {
+		usages = accounting.ByStorage(usages)
+	}
+
+	if format == "csv" {
+		writeCSV(w, r, usages)
+		return
+	}
+
+	list := make([]*usageJSON, 0, len(usages))
+	for _, u := range usages {
+		list = append(list, &usageJSON{
+			Time:       u.Time.UTC(),
+			User:       formatUserID(u.User),
+			StorageID:  u.StorageID,
+			Bytes:      u.Bytes,
+			Files:      u.Files,
+			Folders:    u.Folders,
+			TrashBytes: u.TrashBytes,
+			TrashItems: u.TrashItems,
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{"usages": list})
+	if err != nil {
+		log.Error().Err(err).Msg("accounting: error encoding report")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		log.Error().Err(err).Msg("accounting: error writing report")
+	}
+}
+
+func writeCSV(w http.ResponseWriter, r *http.Request, usages []*accounting.Usage) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"time", "user", "storage_id", "bytes", "files", "folders", "trash_bytes", "trash_items"})
+	for _, u := range usages {
+		_ = cw.Write([]string{
+			u.Time.UTC().Format(time.RFC3339),
+			formatUserID(u.User),
+			u.StorageID,
+			strconv.FormatUint(u.Bytes, 10),
+			strconv.FormatUint(u.Files, 10),
+			strconv.FormatUint(u.Folders, 10),
+			strconv.FormatUint(u.TrashBytes, 10),
+			strconv.FormatUint(u.TrashItems, 10),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("accounting: error writing report")
+	}
+}
+
+// parseUserID parses a user given as <opaqueid>@<idp>.
+func parseUserID(s string) *userpb.UserId {
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		return &userpb.UserId{OpaqueId: s[:i], Idp: s[i+1:]}
+	}
+	return &userpb.UserId{OpaqueId: s}
+}
+
+func formatUserID(u *userpb.UserId) string {
+	if u == nil {
+		return ""
+	}
+	if u.Idp == "" {
+		return u.OpaqueId
+	}
+	return u.OpaqueId + "@" + u.Idp
+}
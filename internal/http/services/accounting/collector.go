@@ -0,0 +1,190 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package accounting
+
+import (
+	"context"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/accounting"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/machine"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// collector periodically walks the files of the configured users and
+// records their usage of every storage provider.
+type collector struct {
+	mgr  accounting.Manager
+	conf *config
+	quit chan struct{}
+}
+
+func newCollector(mgr accounting.Manager, c *config) *collector {
+	return &collector{
+		mgr:  mgr,
+		conf: c,
+		quit: make(chan struct{}),
+	}
+}
+
+func (c *collector) start() {
+	if len(c.conf.Users) > 0 {
+		go c.run()
+	}
+}
+
+func (c *collector) stop() {
+	close(c.quit)
+}
+
+func (c *collector) run() {
+	ticker := time.NewTicker(time.Duration(c.conf.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		c.collectAll()
+		select {
+		case <-ticker.C:
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// collectAll records a snapshot of the usage of all the users, taken at the
+// same time so that they can be summed per storage.
+func (c *collector) collectAll() {
+	ctx := appctx.WithLogger(context.Background(), &log.Logger)
+	now := time.Now().UTC()
+
+	var snapshot []*accounting.Usage
+	for _, u := range c.conf.Users {
+		usages, err := c.collect(ctx, u)
+		if err != nil {
+			log.Error().Err(err).Str("user", u).Msg("accounting: error collecting usage")
+			continue
+		}
+		for _, usage := range usages {
+			usage.Time = now
+			snapshot = append(snapshot, usage)
+		}
+	}
+	if len(snapshot) == 0 {
+		return
+	}
+	if err := c.mgr.Record(ctx, snapshot); err != nil {
+		log.Error().Err(err).Msg("accounting: error recording usage")
+	}
+}
+
+// collect walks the files of the user below the root and returns the usage
+// of every storage provider they are in. The shares received are skipped,
+// they count for their owners.
+func (c *collector) collect(ctx context.Context, u string) ([]*accounting.Usage, error) {
+	client, err := pool.GetGatewayServiceClient(c.conf.GatewaySvc)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting grpc client")
+	}
+	ctx, owner, err := machine.Authenticate(ctx, client, u, c.conf.MachineSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &provider.Reference{Spec: &provider.Reference_Path{Path: c.conf.Root}}
+	statRes, err := client.Stat(ctx, &provider.StatRequest{Ref: root})
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending grpc stat request")
+	}
+	if statRes.Status.Code != rpc.Code_CODE_OK {
+		return nil, status.NewErrorFromCode(statRes.Status.Code, "accounting")
+	}
+
+	usages := map[string]*accounting.Usage{}
+	usageOf := func(storageID string) *accounting.Usage {
+		usage, ok := usages[storageID]
+		if !ok {
+			usage = &accounting.Usage{User: owner.Id, StorageID: storageID}
+			usages[storageID] = usage
+		}
+		return usage
+	}
+	home := usageOf(statRes.Info.GetId().GetStorageId())
+
+	folders := []string{c.conf.Root}
+	for len(folders) > 0 {
+		select {
+		case <-c.quit:
+			return nil, errors.New("accounting: stopped")
+		default:
+		}
+
+		fn := folders[len(folders)-1]
+		folders = folders[:len(folders)-1]
+
+		res, err := client.ListContainer(ctx, &provider.ListContainerRequest{
+			Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: fn}},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error listing "+fn)
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			log.Warn().Str("path", fn).Str("code", res.Status.Code.String()).Msg("accounting: error listing folder")
+			continue
+		}
+		for _, info := range res.Infos {
+			switch info.Type {
+			case provider.ResourceType_RESOURCE_TYPE_CONTAINER:
+				usageOf(info.GetId().GetStorageId()).Folders++
+				folders = append(folders, info.Path)
+			case provider.ResourceType_RESOURCE_TYPE_FILE:
+				usage := usageOf(info.GetId().GetStorageId())
+				usage.Files++
+				usage.Bytes += info.Size
+			}
+		}
+	}
+
+	// the trash is the one of the storage of the root
+	trashRes, err := client.ListRecycle(ctx, &gateway.ListRecycleRequest{Ref: root})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing trash")
+	}
+	switch trashRes.Status.Code {
+	case rpc.Code_CODE_OK:
+		for _, item := range trashRes.RecycleItems {
+			home.TrashItems++
+			home.TrashBytes += item.Size
+		}
+	case rpc.Code_CODE_UNIMPLEMENTED:
+	default:
+		log.Warn().Str("code", trashRes.Status.Code.String()).Msg("accounting: error listing trash")
+	}
+
+	list := make([]*accounting.Usage, 0, len(usages))
+	for _, usage := range usages {
+		list = append(list, usage)
+	}
+	return list, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package activities implements a service recording the high-level actions
+// done on the files, like renaming, sharing or restoring a version, from the
+// events published on NATS. The activities are served by the activity
+// endpoint of the ocs service, which has to use the same store.
+package activities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cs3org/reva/pkg/activity"
+	"github.com/cs3org/reva/pkg/activity/manager/registry"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/mitchellh/mapstructure"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	global.Register("activities", New)
+}
+
+type config struct {
+	Prefix string `mapstructure:"prefix"`
+	// NatsURL is the NATS server the events are received from, see the nats events publisher.
+	NatsURL     string                            `mapstructure:"nats_url"`
+	NatsSubject string                            `mapstructure:"nats_subject"`
+	Driver      string                            `mapstructure:"driver"`
+	Drivers     map[string]map[string]interface{} `mapstructure:"drivers"`
+}
+
+type svc struct {
+	conf *config
+	mgr  activity.Manager
+	conn *nats.Conn
+}
+
+// New returns a new activities service.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "activities"
+	}
+	if conf.NatsSubject == "" {
+		conf.NatsSubject = "reva.events"
+	}
+
+	if conf.NatsURL == "" {
+		return nil, errors.New("activities: nats_url is required to receive the events")
+	}
+	if conf.Driver == "" {
+		return nil, errors.New("activities: driver is required to store the activities")
+	}
+
+	f, ok := registry.NewFuncs[conf.Driver]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not found for activity manager", conf.Driver)
+	}
+	mgr, err := f(conf.Drivers[conf.Driver])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &svc{conf: conf, mgr: mgr}
+	if err := s.subscribe(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *svc) subscribe() error {
+	conn, err := nats.Connect(s.conf.NatsURL, nats.Name("reva-activities"), nats.MaxReconnects(-1))
+	if err != nil {
+		return errors.Wrap(err, "activities: error connecting to "+s.conf.NatsURL)
+	}
+	for _, t := range activity.Types {
+		if _, err := conn.Subscribe(s.conf.NatsSubject+"."+t, s.handleMsg); err != nil {
+			conn.Close()
+			return errors.Wrap(err, "activities: error subscribing to events")
+		}
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *svc) handleMsg(msg *nats.Msg) {
+	ctx := appctx.WithLogger(context.Background(), &log.Logger)
+
+	e := &events.Event{}
+	if err := json.Unmarshal(msg.Data, e); err != nil {
+		log.Error().Err(err).Msg("activities: error decoding event")
+		return
+	}
+	a := activity.FromEvent(e)
+	if a == nil {
+		return
+	}
+	if err := s.mgr.Add(ctx, a); err != nil {
+		log.Error().Err(err).Str("event", e.ID).Msg("activities: error recording activity")
+	}
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+// Handler serves nothing, the activities are served by the ocs service.
+func (s *svc) Handler() http.Handler {
+	return http.NotFoundHandler()
+}
+
+func (s *svc) Unprotected() []string {
+	return []string{}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// archiveWriter writes the entries of an archive.
+type archiveWriter interface {
+	Dir(name string, mtime time.Time) error
+	File(name string, size int64, mtime time.Time, r io.Reader) error
+	Close() error
+}
+
+// formats maps the supported formats to their extension and mime type.
+var formats = map[string]struct {
+	ext, mime string
+}{
+	"zip": {".zip", "application/zip"},
+	"tar": {".tar.gz", "application/gzip"},
+}
+
+func newArchiveWriter(format string, w io.Writer) (archiveWriter, error) {
+	switch format {
+	case "zip":
+		return &zipWriter{w: zip.NewWriter(w)}, nil
+	case "tar":
+		gz := gzip.NewWriter(w)
+		return &tarWriter{gz: gz, w: tar.NewWriter(gz)}, nil
+	}
+	return nil, errors.New("archiver: unknown format " + format)
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z *zipWriter) Dir(name string, mtime time.Time) error {
+	_, err := z.w.CreateHeader(&zip.FileHeader{
+		Name:     name + "/",
+		Modified: mtime,
+	})
+	return err
+}
+
+func (z *zipWriter) File(name string, size int64, mtime time.Time, r io.Reader) error {
+	w, err := z.w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: mtime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.w.Close()
+}
+
+type tarWriter struct {
+	gz *gzip.Writer
+	w  *tar.Writer
+}
+
+func (t *tarWriter) Dir(name string, mtime time.Time) error {
+	return t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  mtime,
+	})
+}
+
+// File writes a file of the given size, tar headers carry the size so the
+// content must match it.
+func (t *tarWriter) File(name string, size int64, mtime time.Time, r io.Reader) error {
+	err := t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  mtime,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(t.w, r, size); err != nil {
+		return errors.Wrap(err, "archiver: size of "+name+" changed")
+	}
+	return nil
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.w.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
@@ -0,0 +1,111 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeArchive(t *testing.T, format string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	aw, err := newArchiveWriter(format, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(1600000000, 0)
+	if err := aw.Dir("folder", mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.File("folder/file.txt", 5, mtime, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestZip(t *testing.T) {
+	buf := writeArchive(t, "zip")
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 || zr.File[0].Name != "folder/" || zr.File[1].Name != "folder/file.txt" {
+		t.Fatalf("unexpected entries: %v", zr.File)
+	}
+	rc, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if b, _ := ioutil.ReadAll(rc); string(b) != "hello" {
+		t.Fatalf("got %q, want hello", b)
+	}
+}
+
+func TestTar(t *testing.T) {
+	buf := writeArchive(t, "tar")
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var names []string
+	var content string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+		if h.Typeflag == tar.TypeReg {
+			b, _ := ioutil.ReadAll(tr)
+			content = string(b)
+		}
+	}
+	if strings.Join(names, ",") != "folder/,folder/file.txt" || content != "hello" {
+		t.Fatalf("unexpected archive: %v %q", names, content)
+	}
+}
+
+func TestTarSizeMismatch(t *testing.T) {
+	aw, _ := newArchiveWriter("tar", ioutil.Discard)
+	if err := aw.File("file.txt", 10, time.Now(), strings.NewReader("short")); err == nil {
+		t.Fatal("expected an error for a short file")
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := newArchiveWriter("rar", ioutil.Discard); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,444 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/internal/http/utils"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/machine"
+	"github.com/cs3org/reva/pkg/auth/scope"
+	"github.com/cs3org/reva/pkg/publicshare"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/trace"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	global.Register("archiver", New)
+}
+
+type config struct {
+	Prefix     string `mapstructure:"prefix"`
+	GatewaySvc string `mapstructure:"gatewaysvc"`
+	// MaxSize is the maximum total size in bytes of the archived files.
+	MaxSize uint64 `mapstructure:"max_size"`
+	// MaxNumFiles is the maximum number of files and folders in an archive.
+	MaxNumFiles int `mapstructure:"max_num_files"`
+	// MachineSecret lets the service read the files of public links on
+	// behalf of their owners, public links are not supported if empty.
+	MachineSecret string `mapstructure:"machine_secret"`
+}
+
+type svc struct {
+	conf    *config
+	handler http.Handler
+	client  *http.Client
+}
+
+// New returns a new archiver service, streaming zip or tar.gz archives of
+// folders and files.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "archiver"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.MaxSize == 0 {
+		conf.MaxSize = 1024 * 1024 * 1024
+	}
+	if conf.MaxNumFiles == 0 {
+		conf.MaxNumFiles = 10000
+	}
+
+	s := &svc{
+		conf: conf,
+		// archives take long to download, no timeout
+		client: &http.Client{Transport: trace.Transport(http.DefaultTransport)},
+	}
+	s.setHandler()
+	return s, nil
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Handler() http.Handler {
+	return s.handler
+}
+
+// Unprotected returns the route of the public links, which are
+// authenticated by their token.
+func (s *svc) Unprotected() []string {
+	return []string{"/public"}
+}
+
+func (s *svc) setHandler() {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var head string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch head {
+		case "":
+			s.doArchive(r.Context(), w, r, "/")
+		case "public":
+			s.doPublicArchive(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+// doPublicArchive serves the archive of the public link whose token
+// follows in the path. Password protected links send the password as basic
+// auth.
+func (s *svc) doPublicArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	tkn, _ := router.ShiftPath(r.URL.Path)
+	if tkn == "" || s.conf.MachineSecret == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting grpc client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	req := &link.GetPublicShareByTokenRequest{Token: tkn}
+	_, password, _ := r.BasicAuth()
+	if password != "" {
+		req.Opaque = &types.Opaque{
+			Map: map[string]*types.OpaqueEntry{
+				"password": {Decoder: "plain", Value: []byte(password)},
+			},
+		}
+	}
+	res, err := client.GetPublicShareByToken(ctx, req)
+	if err != nil {
+		log.Error().Err(err).Msg("error sending grpc get public share request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case rpc.Code_CODE_UNAUTHENTICATED:
+		w.Header().Set("WWW-Authenticate", `Basic realm="public share"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	default:
+		log.Error().Str("code", res.Status.Code.String()).Msg("error requesting public share")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	share := res.Share
+	if perms := share.GetPermissions().GetPermissions(); perms == nil || !perms.InitiateFileDownload {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// the files are read on behalf of the owner, within the shared resource
+	ownerCtx, _, err := machine.AuthenticateWithScope(ctx, client, machine.ClientID(share.Owner), s.conf.MachineSecret, scope.PublicShare)
+	if err != nil {
+		log.Error().Err(err).Msg("archiver: error authenticating public link owner")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sRes, err := client.Stat(ownerCtx, &provider.StatRequest{
+		Ref: &provider.Reference{Spec: &provider.Reference_Id{Id: share.ResourceId}},
+	})
+	if err != nil || sRes.Status.Code != rpc.Code_CODE_OK {
+		log.Error().Err(err).Msg("archiver: error stating shared resource")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	cw := &countingWriter{ResponseWriter: w}
+	s.doArchive(ownerCtx, cw, r, sRes.Info.Path)
+	s.recordTransfer(ctx, client, tkn, password, cw.n)
+}
+
+// countingWriter counts the bytes of the body of a response.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// recordTransfer adds the bytes of the archive to the statistics of the
+// link. The download may have been interrupted by the client, so the request
+// is not bound to its context.
+func (s *svc) recordTransfer(ctx context.Context, client gateway.GatewayAPIClient, tkn, password string, n int64) {
+	if n <= 0 {
+		return
+	}
+	rctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := client.GetPublicShareByToken(rctx, publicshare.TransferRequest(tkn, password, uint64(n)))
+	if err != nil || res.Status.Code != rpc.Code_CODE_OK {
+		appctx.GetLogger(ctx).Warn().Err(err).Msg("archiver: error recording the transfer of the link")
+	}
+}
+
+// entry is a file or folder of the archive.
+type entry struct {
+	info *provider.ResourceInfo
+	name string
+}
+
+// doArchive streams the archive of the files and folders given in the path
+// query parameters, relative to root and defaulting to it. The format
+// parameter selects zip, the default, or tar for a tar.gz archive.
+func (s *svc) doArchive(ctx context.Context, w http.ResponseWriter, r *http.Request, root string) {
+	log := appctx.GetLogger(ctx)
+
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	f, ok := formats[format]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	paths := q["path"]
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting grpc client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var roots []*provider.ResourceInfo
+	for _, p := range paths {
+		fn := path.Join(root, p)
+		if fn != root && !strings.HasPrefix(fn, strings.TrimSuffix(root, "/")+"/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		info, code, err := stat(ctx, client, fn)
+		if err != nil {
+			log.Error().Err(err).Str("path", fn).Msg("archiver: error stating")
+			w.WriteHeader(code)
+			return
+		}
+		roots = append(roots, info)
+	}
+
+	entries, code, err := s.walk(ctx, client, roots)
+	if err != nil {
+		log.Debug().Err(err).Msg("archiver: error collecting files")
+		w.WriteHeader(code)
+		return
+	}
+
+	name := "download"
+	if len(roots) == 1 && path.Base(roots[0].Path) != "/" {
+		name = path.Base(roots[0].Path)
+	}
+	w.Header().Set("Content-Type", f.mime)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + f.ext}))
+	w.WriteHeader(http.StatusOK)
+
+	// the status is sent, a failure can only truncate the archive
+	aw, _ := newArchiveWriter(format, w)
+	for _, e := range entries {
+		if err := s.write(ctx, client, aw, e); err != nil {
+			log.Error().Err(err).Str("path", e.info.Path).Msg("archiver: error writing archive")
+			return
+		}
+	}
+	if err := aw.Close(); err != nil {
+		log.Error().Err(err).Msg("archiver: error writing archive")
+	}
+}
+
+// stat returns the info of the resource and the status code to answer with
+// on errors.
+func stat(ctx context.Context, client gateway.GatewayAPIClient, fn string) (*provider.ResourceInfo, int, error) {
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+	res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		return nil, http.StatusNotFound, errors.New(res.Status.Message)
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return nil, http.StatusForbidden, errors.New(res.Status.Message)
+	default:
+		return nil, http.StatusInternalServerError, status.NewErrorFromCode(res.Status.Code, "archiver")
+	}
+	if res.Info.PermissionSet != nil && !res.Info.PermissionSet.InitiateFileDownload {
+		return nil, http.StatusForbidden, errors.New("download not allowed")
+	}
+	return res.Info, 0, nil
+}
+
+// walk lists the entries below the roots, named after the path relative to
+// the parent of their root. The files the user can not download are left
+// out. It fails if the archive would exceed the limits.
+func (s *svc) walk(ctx context.Context, client gateway.GatewayAPIClient, roots []*provider.ResourceInfo) ([]entry, int, error) {
+	var entries []entry
+	var size uint64
+	add := func(info *provider.ResourceInfo, name string) error {
+		if info.PermissionSet != nil && !info.PermissionSet.InitiateFileDownload {
+			return nil
+		}
+		if info.Type == provider.ResourceType_RESOURCE_TYPE_FILE {
+			size += info.Size
+		}
+		entries = append(entries, entry{info: info, name: name})
+		if len(entries) > s.conf.MaxNumFiles || size > s.conf.MaxSize {
+			return fmt.Errorf("archive exceeds %d files or %d bytes", s.conf.MaxNumFiles, s.conf.MaxSize)
+		}
+		return nil
+	}
+
+	for _, root := range roots {
+		base := path.Dir(root.Path)
+		name := path.Base(root.Path)
+		if name == "/" {
+			base, name = "/", ""
+		}
+		if name != "" || root.Type == provider.ResourceType_RESOURCE_TYPE_FILE {
+			if err := add(root, name); err != nil {
+				return nil, http.StatusRequestEntityTooLarge, err
+			}
+		}
+		if root.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+			continue
+		}
+
+		folders := []string{root.Path}
+		for len(folders) > 0 {
+			fn := folders[len(folders)-1]
+			folders = folders[:len(folders)-1]
+
+			ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+			res, err := client.ListContainer(ctx, &provider.ListContainerRequest{Ref: ref})
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			if res.Status.Code != rpc.Code_CODE_OK {
+				return nil, http.StatusInternalServerError, status.NewErrorFromCode(res.Status.Code, "archiver")
+			}
+			for _, info := range res.Infos {
+				rel := strings.TrimPrefix(strings.TrimPrefix(info.Path, base), "/")
+				if err := add(info, rel); err != nil {
+					return nil, http.StatusRequestEntityTooLarge, err
+				}
+				if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+					folders = append(folders, info.Path)
+				}
+			}
+		}
+	}
+	return entries, 0, nil
+}
+
+// write adds the entry to the archive, downloading files through the
+// datagateway.
+func (s *svc) write(ctx context.Context, client gateway.GatewayAPIClient, aw archiveWriter, e entry) error {
+	var mtime time.Time
+	if e.info.Mtime != nil {
+		mtime = utils.TSToTime(e.info.Mtime)
+	}
+	if e.info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return aw.Dir(e.name, mtime)
+	}
+
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: e.info.Path}}
+	dRes, err := client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{Ref: ref})
+	if err != nil {
+		return errors.Wrap(err, "error initiating file download")
+	}
+	if dRes.Status.Code != rpc.Code_CODE_OK {
+		return errors.New("error initiating file download: " + dRes.Status.Message)
+	}
+
+	httpReq, err := rhttp.NewRequest(ctx, http.MethodGet, dRes.DownloadEndpoint, nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating http request")
+	}
+	httpReq.Header.Set("X-Reva-Transfer", dRes.Token)
+
+	httpRes, err := s.client.Do(httpReq)
+	if err != nil {
+		return errors.Wrap(err, "error downloading file")
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading file: status %d", httpRes.StatusCode)
+	}
+	return aw.File(e.name, int64(e.info.Size), mtime, httpRes.Body)
+}
@@ -0,0 +1,127 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package datagateway
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+	"github.com/pkg/errors"
+)
+
+// doCopy streams the file of the download token in the X-Reva-Copy-Source
+// header to the upload target of the transfer token, so that the copies
+// between storage providers go from data server to data server without
+// passing through the client. The checksum sent in the OC-Checksum header
+// is verified by the target, and the checksums of the data transferred
+// are returned in the OC-Checksum header of the response.
+func (s *svc) doCopy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	dst, err := s.verify(ctx, r.Header.Get(tokenTransportHeader))
+	if err != nil {
+		log.Err(errors.Wrap(err, "datagateway: error validating transfer token")).Msg("invalid token")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	src, err := s.verify(ctx, r.Header.Get(copySourceHeader))
+	if err != nil {
+		log.Err(errors.Wrap(err, "datagateway: error validating copy source token")).Msg("invalid token")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	log.Info().Str("source", src.Target).Str("target", dst.Target).Msg("copying between internal data servers")
+
+	// large files take longer than the default timeout to transfer, the
+	// transfer is bounded by the request
+	httpClient := *rhttp.GetHTTPClient(ctx)
+	httpClient.Timeout = 0
+
+	getReq, err := rhttp.NewRequest(ctx, http.MethodGet, src.Target, nil)
+	if err != nil {
+		log.Err(err).Msg("wrong request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	getRes, err := httpClient.Do(getReq)
+	if err != nil {
+		log.Err(err).Msg("error doing GET request to data service")
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer getRes.Body.Close()
+	if getRes.StatusCode != http.StatusOK {
+		log.Warn().Int("status", getRes.StatusCode).Msg("datagateway: copy source not available")
+		w.WriteHeader(getRes.StatusCode)
+		return
+	}
+
+	h := checksums.NewHasher()
+	var body io.Reader = http.NoBody
+	if getRes.ContentLength != 0 {
+		body = io.TeeReader(s.throttle(r, dst, getRes.Body), h)
+	}
+	putReq, err := rhttp.NewRequest(ctx, http.MethodPut, dst.Target, body)
+	if err != nil {
+		log.Err(err).Msg("wrong request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	putReq.ContentLength = getRes.ContentLength
+	xs := r.Header.Get("OC-Checksum")
+	if xs != "" {
+		putReq.Header.Set("OC-Checksum", xs)
+	}
+	putRes, err := httpClient.Do(putReq)
+	if err != nil {
+		log.Err(err).Msg("error doing PUT request to data service")
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer putRes.Body.Close()
+	if putRes.StatusCode != http.StatusOK {
+		w.WriteHeader(putRes.StatusCode)
+		return
+	}
+
+	// the checksum the target computed on what it stored must match the
+	// one of what was read from the source
+	if stored := putRes.Header.Get("OC-Checksum"); stored != "" {
+		if err := h.Verify(stored); err != nil {
+			log.Error().Err(err).Msg("datagateway: copy corrupted in transit")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}
+	if xs != "" {
+		if err := h.Verify(xs); err != nil {
+			log.Warn().Err(err).Msg("datagateway: copy checksum mismatch")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("OC-Checksum", h.String())
+	w.WriteHeader(http.StatusOK)
+}
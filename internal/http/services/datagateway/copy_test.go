@@ -0,0 +1,97 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package datagateway
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func sign(t *testing.T, secret, target string) string {
+	claims := transferClaims{
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()},
+		Target:         target,
+	}
+	tkn, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tkn
+}
+
+func TestCopy(t *testing.T) {
+	content := []byte("hello world")
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer source.Close()
+
+	var stored []byte
+	corrupt := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stored, _ = ioutil.ReadAll(r.Body)
+		sum := sha1.Sum(stored)
+		if corrupt {
+			sum = sha1.Sum(nil)
+		}
+		w.Header().Set("OC-Checksum", "SHA1:"+hex.EncodeToString(sum[:]))
+	}))
+	defer target.Close()
+
+	s, err := New(map[string]interface{}{"transfer_shared_secret": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyWith := func(srcToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("COPY", "/data", nil)
+		req.Header.Set(tokenTransportHeader, sign(t, "secret", target.URL))
+		req.Header.Set(copySourceHeader, srcToken)
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	w := copyWith(sign(t, "secret", source.URL))
+	if w.Code != http.StatusOK {
+		t.Fatalf("copy answered %d", w.Code)
+	}
+	if string(stored) != string(content) {
+		t.Errorf("stored %q", stored)
+	}
+	if w.Header().Get("OC-Checksum") == "" {
+		t.Error("checksums missing")
+	}
+
+	if w := copyWith(sign(t, "other", source.URL)); w.Code != http.StatusForbidden {
+		t.Errorf("copy with an invalid source token answered %d", w.Code)
+	}
+
+	corrupt = true
+	if w := copyWith(sign(t, "secret", source.URL)); w.Code != http.StatusBadGateway {
+		t.Errorf("corrupted copy answered %d", w.Code)
+	}
+}
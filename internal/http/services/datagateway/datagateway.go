@@ -23,11 +23,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 
 	"github.com/cs3org/reva/pkg/appctx"
 	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ratelimit"
 	"github.com/cs3org/reva/pkg/rhttp"
 	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/user"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
@@ -35,6 +38,9 @@ import (
 
 const (
 	tokenTransportHeader = "X-Reva-Transfer"
+	// copySourceHeader carries the download token of the file copied by
+	// a COPY request to the upload target of the transfer token.
+	copySourceHeader = "X-Reva-Copy-Source"
 )
 
 func init() {
@@ -45,15 +51,31 @@ func init() {
 type transferClaims struct {
 	jwt.StandardClaims
 	Target string `json:"target"`
+	// PublicLink is the id of the public share the transfer is done for,
+	// set by the gateway, its cap applies on top of the others.
+	PublicLink string `json:"public_link,omitempty"`
 }
 type config struct {
 	Prefix               string `mapstructure:"prefix"`
 	TransferSharedSecret string `mapstructure:"transfer_shared_secret"`
+	// Bandwidth caps the transfer rates in bytes per second, 0 means no cap.
+	Bandwidth struct {
+		// Global is shared by all the transfers.
+		Global int64 `mapstructure:"global"`
+		// User is shared by the transfers of a user.
+		User int64 `mapstructure:"user"`
+		// PublicLink is shared by the transfers of a public link.
+		PublicLink int64 `mapstructure:"public_link"`
+	} `mapstructure:"bandwidth"`
 }
 
 type svc struct {
 	conf    *config
 	handler http.Handler
+
+	global     *ratelimit.Bandwidth
+	user       *ratelimit.Bandwidth
+	publicLink *ratelimit.Bandwidth
 }
 
 // New returns a new datagateway
@@ -67,7 +89,12 @@ func New(m map[string]interface{}) (global.Service, error) {
 		conf.Prefix = "data"
 	}
 
-	s := &svc{conf: conf}
+	s := &svc{
+		conf:       conf,
+		global:     ratelimit.NewBandwidth(conf.Bandwidth.Global),
+		user:       ratelimit.NewBandwidth(conf.Bandwidth.User),
+		publicLink: ratelimit.NewBandwidth(conf.Bandwidth.PublicLink),
+	}
 	s.setHandler()
 	return s, nil
 }
@@ -91,6 +118,12 @@ func (s *svc) Unprotected() []string {
 
 func (s *svc) setHandler() {
 	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// tus requests are forwarded as they are to the data server
+		if r.Header.Get("Tus-Resumable") != "" {
+			s.doTus(w, r)
+			return
+		}
+
 		switch r.Method {
 		case "HEAD":
 			addCorsHeader(w)
@@ -102,6 +135,9 @@ func (s *svc) setHandler() {
 		case "PUT":
 			s.doPut(w, r)
 			return
+		case "COPY":
+			s.doCopy(w, r)
+			return
 		default:
 			w.WriteHeader(http.StatusNotImplemented)
 			return
@@ -112,8 +148,25 @@ func (s *svc) setHandler() {
 func addCorsHeader(res http.ResponseWriter) {
 	headers := res.Header()
 	headers.Set("Access-Control-Allow-Origin", "*")
-	headers.Set("Access-Control-Allow-Headers", "Content-Type, Origin, Authorization")
-	headers.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, HEAD")
+	headers.Set("Access-Control-Allow-Headers", "Content-Type, Origin, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Checksum, Range, If-Range, "+tokenTransportHeader)
+	headers.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS, HEAD")
+	headers.Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Upload-Offset, Upload-Length, Accept-Ranges, Content-Range")
+}
+
+// throttle returns r limited by the caps applying to the request: the
+// global one, the one of the user and the one of the public link named in
+// the transfer token. The caps add up, so a transfer can not escape the cap
+// of its user.
+func (s *svc) throttle(r *http.Request, claims *transferClaims, body io.Reader) io.Reader {
+	ctx := r.Context()
+	limits := []ratelimit.Limit{{Bandwidth: s.global}}
+	if u, ok := user.ContextGetUser(ctx); ok && u.Id != nil {
+		limits = append(limits, ratelimit.Limit{Bandwidth: s.user, Key: u.Id.Idp + "!" + u.Id.OpaqueId})
+	}
+	if claims.PublicLink != "" {
+		limits = append(limits, ratelimit.Limit{Bandwidth: s.publicLink, Key: claims.PublicLink})
+	}
+	return ratelimit.NewReader(ctx, body, limits...)
 }
 
 func (s *svc) verify(ctx context.Context, token string) (*transferClaims, error) {
@@ -155,6 +208,7 @@ func (s *svc) doGet(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	copyHeaders(httpReq.Header, r.Header, rangeRequestHeaders)
 
 	httpRes, err := httpClient.Do(httpReq)
 	if err != nil {
@@ -162,15 +216,16 @@ func (s *svc) doGet(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer httpRes.Body.Close()
 
-	if httpRes.StatusCode != http.StatusOK {
+	copyHeaders(w.Header(), httpRes.Header, downloadHeaders)
+	if httpRes.StatusCode != http.StatusOK && httpRes.StatusCode != http.StatusPartialContent {
 		w.WriteHeader(httpRes.StatusCode)
 		return
 	}
 
-	defer httpRes.Body.Close()
-	w.WriteHeader(http.StatusOK)
-	_, err = io.Copy(w, httpRes.Body)
+	w.WriteHeader(httpRes.StatusCode)
+	_, err = io.Copy(w, s.throttle(r, claims, httpRes.Body))
 	if err != nil {
 		log.Err(err).Msg("error writing body after headers were sent")
 	}
@@ -204,7 +259,7 @@ func (s *svc) doPut(w http.ResponseWriter, r *http.Request) {
 	log.Info().Str("target", claims.Target).Msg("sending request to internal data server")
 
 	httpClient := rhttp.GetHTTPClient(ctx)
-	httpReq, err := rhttp.NewRequest(ctx, "PUT", target, r.Body)
+	httpReq, err := rhttp.NewRequest(ctx, "PUT", target, s.throttle(r, claims, r.Body))
 	if err != nil {
 		log.Err(err).Msg("wrong request")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -230,3 +285,106 @@ func (s *svc) doPut(w http.ResponseWriter, r *http.Request) {
 		log.Err(err).Msg("error writing body after header were set")
 	}
 }
+
+// rangeRequestHeaders are the request headers forwarded to the data service
+// for partial downloads.
+var rangeRequestHeaders = []string{
+	"Range",
+	"If-Range",
+}
+
+// downloadHeaders are the response headers of the data service passed on to
+// the client for downloads.
+var downloadHeaders = []string{
+	"Accept-Ranges",
+	"Content-Range",
+	"Content-Length",
+	"ETag",
+	"Last-Modified",
+}
+
+// tusHeaders are the request and response headers relevant for the tus protocol.
+var tusHeaders = []string{
+	"Tus-Resumable",
+	"Tus-Version",
+	"Tus-Extension",
+	"Tus-Checksum-Algorithm",
+	"Upload-Length",
+	"Upload-Offset",
+	"Upload-Metadata",
+	"Upload-Checksum",
+	"Content-Type",
+	"Cache-Control",
+}
+
+func copyHeaders(dst, src http.Header, keys []string) {
+	for _, k := range keys {
+		if v := src.Get(k); v != "" {
+			dst.Set(k, v)
+		}
+	}
+}
+
+// doTus forwards a tus request to the data server pointed by the transfer token.
+// The upload id travels in the query string, so the Location returned by the
+// data server is rewritten to point to the datagateway.
+func (s *svc) doTus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	addCorsHeader(w)
+
+	token := r.Header.Get(tokenTransportHeader)
+	claims, err := s.verify(ctx, token)
+	if err != nil {
+		err = errors.Wrap(err, "datagateway: error validating transfer token")
+		log.Err(err).Msg("invalid token")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	targetURL, err := url.Parse(claims.Target)
+	if err != nil {
+		log.Err(err).Msg("datagateway: error parsing target url")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	targetURL.RawQuery = r.URL.RawQuery
+
+	log.Info().Str("target", targetURL.String()).Str("method", r.Method).Msg("sending tus request to internal data server")
+
+	httpReq, err := rhttp.NewRequest(ctx, r.Method, targetURL.String(), s.throttle(r, claims, r.Body))
+	if err != nil {
+		log.Err(err).Msg("wrong request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	httpReq.ContentLength = r.ContentLength
+	copyHeaders(httpReq.Header, r.Header, tusHeaders)
+
+	httpClient := rhttp.GetHTTPClient(ctx)
+	httpRes, err := httpClient.Do(httpReq)
+	if err != nil {
+		log.Err(err).Msg("error doing tus request to data service")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer httpRes.Body.Close()
+
+	copyHeaders(w.Header(), httpRes.Header, tusHeaders)
+	if loc := httpRes.Header.Get("Location"); loc != "" {
+		locURL, err := url.Parse(loc)
+		if err != nil {
+			log.Err(err).Msg("datagateway: error parsing location returned by data service")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		gwURL := url.URL{Path: path.Join("/", s.conf.Prefix), RawQuery: locURL.RawQuery}
+		w.Header().Set("Location", gwURL.String())
+	}
+
+	w.WriteHeader(httpRes.StatusCode)
+	if _, err := io.Copy(w, httpRes.Body); err != nil {
+		log.Err(err).Msg("error writing body after headers were sent")
+	}
+}
@@ -22,10 +22,20 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path"
 
+	"github.com/cs3org/reva/pkg/antivirus"
+	avregistry "github.com/cs3org/reva/pkg/antivirus/scanner/registry"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/postprocessing/pipeline"
 	"github.com/cs3org/reva/pkg/rhttp/global"
 	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/encryption"
+	"github.com/cs3org/reva/pkg/storage/filetypes"
 	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/storage/janitor"
+	"github.com/cs3org/reva/pkg/storage/spool"
+	"github.com/cs3org/reva/pkg/storage/tracing"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 )
@@ -39,12 +49,60 @@ type config struct {
 	Driver    string                            `mapstructure:"driver"`
 	TmpFolder string                            `mapstructure:"tmp_folder"`
 	Drivers   map[string]map[string]interface{} `mapstructure:"drivers"`
+
+	// Scanner is the antivirus scanner uploads go through, none if empty.
+	Scanner  string                            `mapstructure:"scanner"`
+	Scanners map[string]map[string]interface{} `mapstructure:"scanners"`
+	// InfectedAction is either reject or quarantine, quarantined uploads
+	// are rejected as well but kept in the QuarantineFolder.
+	InfectedAction   string `mapstructure:"infected_action"`
+	QuarantineFolder string `mapstructure:"quarantine_folder"`
+
+	// EventsPublisher publishes the completed uploads, none if empty.
+	EventsPublisher  string                            `mapstructure:"events_publisher"`
+	EventsPublishers map[string]map[string]interface{} `mapstructure:"events_publishers"`
+
+	// Janitor purges the abandoned resumable uploads and the expired trash
+	// items of the drivers supporting it.
+	Janitor struct {
+		Uploads janitor.Config `mapstructure:"uploads"`
+		Recycle janitor.Config `mapstructure:"recycle"`
+	} `mapstructure:"janitor"`
+
+	// Encryption encrypts the content of the files before it reaches the
+	// driver, resumable uploads are not available with it.
+	Encryption encryption.Config `mapstructure:"encryption"`
+
+	// MaxUploadSize is the size in bytes of the largest file accepted, 0
+	// disables the limit.
+	MaxUploadSize int64 `mapstructure:"max_upload_size"`
+
+	// FileTypes are the allow and deny lists of the types of the uploaded
+	// files, the paths of the overrides are relative to the storage.
+	FileTypes filetypes.Config `mapstructure:"file_types"`
+
+	// PostProcessing runs steps, like scans, on the finished uploads in the
+	// background, the uploads do not wait for them.
+	PostProcessing pipeline.Config `mapstructure:"postprocessing"`
+
+	// Spool buffers the uploads for the drivers needing a seekable source,
+	// in memory up to a bounded size and in its tmp folder past it.
+	Spool spool.Config `mapstructure:"spool"`
 }
 
 type svc struct {
-	conf    *config
-	handler http.Handler
-	storage storage.FS
+	conf      *config
+	handler   http.Handler
+	storage   storage.FS
+	scanner   antivirus.Scanner
+	fileTypes *filetypes.Policy
+	publisher events.Publisher
+	pipeline  *pipeline.Pipeline
+	janitor   *janitor.Janitor
+	spooler   *spool.Spooler
+	// seekable tells whether the uploads are spooled before reaching the
+	// driver.
+	seekable bool
 }
 
 // New returns a new datasvc
@@ -66,21 +124,97 @@ func New(m map[string]interface{}) (global.Service, error) {
 		return nil, errors.Wrap(err, "could not create tmp dir")
 	}
 
+	if conf.InfectedAction == "" {
+		conf.InfectedAction = "reject"
+	}
+
+	if conf.InfectedAction != "reject" && conf.InfectedAction != "quarantine" {
+		return nil, fmt.Errorf("invalid infected_action: %s", conf.InfectedAction)
+	}
+
+	if conf.QuarantineFolder == "" {
+		conf.QuarantineFolder = path.Join(conf.TmpFolder, "quarantine")
+	}
+
+	if conf.Spool.TmpFolder == "" {
+		conf.Spool.TmpFolder = conf.TmpFolder
+	}
+
+	if conf.PostProcessing.DeadLetter == "" {
+		conf.PostProcessing.DeadLetter = path.Join(conf.TmpFolder, "postprocessing", "dead-letter.jsonl")
+	}
+
 	fs, err := getFS(conf)
 	if err != nil {
 		return nil, err
 	}
 
+	encFS, err := encryption.Wrap(fs, conf.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner, err := getScanner(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if scanner != nil && conf.InfectedAction == "quarantine" {
+		if err := os.MkdirAll(conf.QuarantineFolder, 0700); err != nil {
+			return nil, errors.Wrap(err, "could not create quarantine dir")
+		}
+	}
+
+	fileTypes, err := filetypes.New(&conf.FileTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	publisher, err := getPublisher(conf)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &svc{
-		storage: fs,
-		conf:    conf,
+		storage:   tracing.New(encFS, conf.Driver),
+		conf:      conf,
+		scanner:   scanner,
+		fileTypes: fileTypes,
+		publisher: publisher,
+		janitor:   janitor.New(),
+	}
+	if s.pipeline, err = pipeline.New(&conf.PostProcessing, s.storage); err != nil {
+		return nil, err
+	}
+	if s.spooler, err = spool.New(&conf.Spool); err != nil {
+		return nil, err
 	}
 	s.setHandler()
+
+	// the tracing wrapper hides the optional interfaces of the driver, the
+	// content the driver gets from the encryption is never seekable
+	if u, ok := fs.(storage.SeekableUploader); ok && encFS == fs {
+		s.seekable = u.NeedsSeekableUpload()
+	}
+	if p, ok := fs.(storage.UploadPurger); ok {
+		s.janitor.Add("uploads", conf.Janitor.Uploads, p.PurgeUploads)
+	}
+	if p, ok := fs.(storage.RecyclePurger); ok {
+		s.janitor.Add("recycle", conf.Janitor.Recycle, p.PurgeRecycle)
+	}
+	s.janitor.Start()
 	return s, nil
 }
 
 // Close performs cleanup.
 func (s *svc) Close() error {
+	s.janitor.Stop()
+	if err := s.pipeline.Close(); err != nil {
+		return err
+	}
+	if s.publisher != nil {
+		return s.publisher.Close()
+	}
 	return nil
 }
 
@@ -95,6 +229,16 @@ func getFS(c *config) (storage.FS, error) {
 	return nil, fmt.Errorf("driver not found: %s", c.Driver)
 }
 
+func getScanner(c *config) (antivirus.Scanner, error) {
+	if c.Scanner == "" {
+		return nil, nil
+	}
+	if f, ok := avregistry.NewFuncs[c.Scanner]; ok {
+		return f(c.Scanners[c.Scanner])
+	}
+	return nil, fmt.Errorf("antivirus scanner not found: %s", c.Scanner)
+}
+
 func (s *svc) Prefix() string {
 	return s.conf.Prefix
 }
@@ -105,6 +249,16 @@ func (s *svc) Handler() http.Handler {
 
 func (s *svc) setHandler() {
 	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "OPTIONS" {
+			s.doTusOptions(w, r)
+			return
+		}
+
+		if isTus(r) {
+			s.doTus(w, r)
+			return
+		}
+
 		switch r.Method {
 		case "HEAD":
 			addCorsHeader(w)
@@ -126,6 +280,7 @@ func (s *svc) setHandler() {
 func addCorsHeader(res http.ResponseWriter) {
 	headers := res.Header()
 	headers.Set("Access-Control-Allow-Origin", "*")
-	headers.Set("Access-Control-Allow-Headers", "Content-Type, Origin, Authorization")
-	headers.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, HEAD")
+	headers.Set("Access-Control-Allow-Headers", "Content-Type, Origin, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Checksum")
+	headers.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS, HEAD")
+	headers.Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Upload-Offset, Upload-Length")
 }
@@ -0,0 +1,60 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package dataprovider
+
+import (
+	"context"
+	"fmt"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/events/publisher/registry"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func getPublisher(c *config) (events.Publisher, error) {
+	if c.EventsPublisher == "" {
+		return nil, nil
+	}
+	if f, ok := registry.NewFuncs[c.EventsPublisher]; ok {
+		return f(c.EventsPublishers[c.EventsPublisher])
+	}
+	return nil, fmt.Errorf("events publisher not found: %s", c.EventsPublisher)
+}
+
+// publishUpload publishes the upload of fn if a publisher is configured.
+func (s *svc) publishUpload(ctx context.Context, fn string, size int64) {
+	if s.publisher == nil {
+		return
+	}
+
+	var id *userpb.UserId
+	if u, ok := user.ContextGetUser(ctx); ok {
+		id = u.Id
+	}
+	e := events.New(events.TypeFileUploaded, id)
+	e.Path = fn
+	if size > 0 {
+		e.Size = uint64(size)
+	}
+	if err := s.publisher.Publish(ctx, e); err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("type", e.Type).Msg("dataprovider: error publishing event")
+	}
+}
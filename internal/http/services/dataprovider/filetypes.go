@@ -0,0 +1,90 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package dataprovider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/storage"
+)
+
+// checkFileType answers 415 Unsupported Media Type with the reason and
+// returns false if the type of the file is refused. The head is the
+// beginning of the content, nil if it is not known yet.
+func (s *svc) checkFileType(ctx context.Context, w http.ResponseWriter, fn string, head []byte) bool {
+	if s.fileTypes == nil {
+		return true
+	}
+	if err := s.fileTypes.Check(fn, head); err != nil {
+		appctx.GetLogger(ctx).Warn().Err(err).Str("path", fn).Msg("dataprovider: upload type refused")
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// sniff reads the beginning of the content to detect its type and returns
+// it, nil for empty content, with a reader of the whole content.
+func sniff(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	if n == 0 {
+		return nil, r, nil
+	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// checkUploadFileType checks the type of a resumable upload before it is
+// finished. Refused uploads are terminated.
+func (s *svc) checkUploadFileType(ctx context.Context, w http.ResponseWriter, uh storage.UploadHandler, id, fn string) bool {
+	if s.fileTypes == nil {
+		return true
+	}
+	log := appctx.GetLogger(ctx)
+
+	rc, err := uh.ReadUpload(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Msg("dataprovider: error reading upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	head, _, err := sniff(rc)
+	rc.Close()
+	if err != nil {
+		log.Error().Err(err).Msg("dataprovider: error reading upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	if !s.checkFileType(ctx, w, fn, head) {
+		if err := uh.TerminateUpload(ctx, id); err != nil {
+			log.Error().Err(err).Msg("dataprovider: error terminating refused upload")
+		}
+		return false
+	}
+	return true
+}
@@ -19,12 +19,17 @@
 package dataprovider
 
 import (
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/internal/http/utils"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
 )
 
 func (s *svc) doGet(w http.ResponseWriter, r *http.Request) {
@@ -41,16 +46,82 @@ func (s *svc) doGet(w http.ResponseWriter, r *http.Request) {
 	fsfn := strings.TrimPrefix(fn, s.conf.Prefix)
 	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fsfn}}
 
-	rc, err := s.storage.Download(ctx, ref)
+	if version := r.URL.Query().Get("version"); version != "" {
+		rc, err := s.storage.DownloadRevision(ctx, ref, version)
+		if err != nil {
+			writeDownloadError(w, r, err)
+			return
+		}
+		defer rc.Close()
+		copyContent(w, r, rc)
+		return
+	}
+
+	md, err := s.storage.GetMD(ctx, ref)
 	if err != nil {
-		log.Err(err).Msg("datasvc: error downloading file")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeDownloadError(w, r, err)
 		return
 	}
 
-	_, err = io.Copy(w, rc)
+	size := int64(md.Size)
+	mtime := utils.TSToTime(md.Mtime)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", md.Etag)
+	w.Header().Set("Last-Modified", mtime.UTC().Format(http.TimeFormat))
+
+	// a single range is served as a partial content, multiple ranges are
+	// ignored and the whole file is sent as allowed by RFC 7233.
+	if rh := r.Header.Get("Range"); rh != "" && utils.IfRangeMatches(r.Header.Get("If-Range"), md.Etag, mtime) {
+		ranges, err := utils.ParseRange(rh, size)
+		if err != nil {
+			log.Debug().Err(err).Str("range", rh).Msg("datasvc: invalid range")
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if len(ranges) == 1 {
+			rng := ranges[0]
+			rc, err := storage.DownloadRange(ctx, s.storage, ref, rng.Start, rng.Length)
+			if err != nil {
+				writeDownloadError(w, r, err)
+				return
+			}
+			defer rc.Close()
+			w.Header().Set("Content-Range", rng.ContentRange(size))
+			w.Header().Set("Content-Length", strconv.FormatInt(rng.Length, 10))
+			w.WriteHeader(http.StatusPartialContent)
+			copyContent(w, r, rc)
+			return
+		}
+	}
+
+	rc, err := s.storage.Download(ctx, ref)
 	if err != nil {
-		log.Error().Err(err).Msg("error copying data to response")
+		writeDownloadError(w, r, err)
 		return
 	}
+	defer rc.Close()
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	copyContent(w, r, rc)
+}
+
+func writeDownloadError(w http.ResponseWriter, r *http.Request, err error) {
+	log := appctx.GetLogger(r.Context())
+	log.Err(err).Msg("datasvc: error downloading file")
+	if _, ok := err.(errtypes.IsNotFound); ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if _, ok := err.(errtypes.IsPermissionDenied); ok {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func copyContent(w http.ResponseWriter, r *http.Request, rc io.Reader) {
+	if _, err := io.Copy(w, rc); err != nil {
+		log := appctx.GetLogger(r.Context())
+		log.Error().Err(err).Msg("error copying data to response")
+	}
 }
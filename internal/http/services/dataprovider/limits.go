@@ -0,0 +1,60 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package dataprovider
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var errUploadTooLarge = errors.New("dataprovider: upload larger than max_upload_size")
+
+// sizeLimiter reads the body of an upload of unknown size and fails once it
+// exceeds the max upload size.
+type sizeLimiter struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *sizeLimiter) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// the limit is reached, the body must be over
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			l.exceeded = true
+			return 0, errUploadTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// tooLarge tells whether an upload of size bytes, -1 if unknown, exceeds the
+// max upload size.
+func (s *svc) tooLarge(size int64) bool {
+	return s.conf.MaxUploadSize > 0 && size > s.conf.MaxUploadSize
+}
@@ -19,28 +19,212 @@
 package dataprovider
 
 import (
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+	"github.com/cs3org/reva/pkg/storage/conditions"
 )
 
 func (s *svc) doPut(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	log := appctx.GetLogger(ctx)
 	fn := r.URL.Path
+	defer r.Body.Close()
 
 	fsfn := strings.TrimPrefix(fn, s.conf.Prefix)
 	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fsfn}}
 
-	err := s.storage.Upload(ctx, ref, r.Body)
+	// the preconditions are checked again by the drivers able to check them
+	// atomically with the upload
+	if p := conditions.FromHeader(r.Header); p != nil {
+		ctx = conditions.ContextSetPreconditions(ctx, p)
+		if err := conditions.Verify(ctx, s.storage, ref); err != nil {
+			if _, ok := err.(errtypes.IsPreconditionFailed); ok {
+				log.Warn().Err(err).Msg("precondition failed")
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			log.Error().Err(err).Msg("error checking preconditions")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if s.tooLarge(r.ContentLength) {
+		log.Warn().Int64("size", r.ContentLength).Msg("upload larger than max upload size")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	var in io.Reader = r.Body
+	var limiter *sizeLimiter
+	if s.conf.MaxUploadSize > 0 && r.ContentLength < 0 {
+		limiter = &sizeLimiter{r: r.Body, n: s.conf.MaxUploadSize}
+		in = limiter
+	}
+
+	if s.fileTypes != nil {
+		head, all, err := sniff(in)
+		if err != nil {
+			log.Error().Err(err).Msg("error receiving data")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !s.checkFileType(ctx, w, fsfn, head) {
+			return
+		}
+		in = all
+	}
+
+	hasher := checksums.NewHasher()
+	var body io.ReadCloser = ioutil.NopCloser(io.TeeReader(in, hasher))
+
+	// a client supplied checksum can only be verified and the content can only be scanned
+	// once all the data has been received, so the data is spooled to a tmp file to keep
+	// corrupted or infected content out of the storage
+	xs := r.Header.Get("OC-Checksum")
+	if xs != "" {
+		if _, _, err := checksums.Parse(xs); err != nil {
+			log.Warn().Err(err).Msg("invalid checksum header")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	size := r.ContentLength
+	if r.ContentLength >= 0 {
+		if status := s.checkQuota(ctx, ref, r.ContentLength); status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	var scanMD map[string]string
+	if xs != "" || s.scanner != nil {
+		tmp, err := ioutil.TempFile(s.conf.TmpFolder, "reva-upload")
+		if err != nil {
+			log.Error().Err(err).Msg("error creating tmp file")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		n, err := io.Copy(tmp, body)
+		if limiter != nil && limiter.exceeded {
+			log.Warn().Msg("upload larger than max upload size")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("error receiving data")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		size = n
+		if r.ContentLength < 0 {
+			if status := s.checkQuota(ctx, ref, n); status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		if xs != "" {
+			if err := hasher.Verify(xs); err != nil {
+				log.Warn().Err(err).Msg("checksum mismatch")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if s.scanner != nil {
+			rewind := func() (io.ReadCloser, error) {
+				_, err := tmp.Seek(0, io.SeekStart)
+				return ioutil.NopCloser(tmp), err
+			}
+			rc, err := rewind()
+			if err != nil {
+				log.Error().Err(err).Msg("error rewinding tmp file")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			var status int
+			scanMD, status = s.scan(ctx, rc, fsfn, rewind)
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			log.Error().Err(err).Msg("error rewinding tmp file")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body = tmp
+	} else if s.seekable {
+		// the driver needs the size of the content before uploading it
+		buf, err := s.spooler.Spool(body)
+		if limiter != nil && limiter.exceeded {
+			log.Warn().Msg("upload larger than max upload size")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("error receiving data")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer buf.Close()
+		size = buf.Size()
+		if r.ContentLength < 0 {
+			if status := s.checkQuota(ctx, ref, size); status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		body = buf
+	}
+
+	err := s.storage.Upload(ctx, ref, body)
 	if err != nil {
+		if limiter != nil && limiter.exceeded {
+			log.Warn().Msg("upload larger than max upload size")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if _, ok := err.(errtypes.IsPermissionDenied); ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if _, ok := err.(errtypes.IsPreconditionFailed); ok {
+			log.Warn().Err(err).Msg("precondition failed")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
 		log.Error().Err(err).Msg("error uploading file")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	r.Body.Close()
+	md := &provider.ArbitraryMetadata{Metadata: map[string]string{checksums.MetadataKey: hasher.String()}}
+	for k, v := range scanMD {
+		md.Metadata[k] = v
+	}
+	if err := s.storage.SetArbitraryMetadata(ctx, ref, md); err != nil {
+		if _, ok := err.(errtypes.IsNotSupported); !ok {
+			log.Error().Err(err).Msg("error storing checksums and scan result")
+		}
+	}
+
+	s.publishUpload(ctx, fsfn, size)
+	s.pipeline.Submit(ctx, fsfn, size)
+
+	w.Header().Set("OC-Checksum", checksums.SHA1+":"+hasher.Sum(checksums.SHA1))
 	w.WriteHeader(http.StatusOK)
 }
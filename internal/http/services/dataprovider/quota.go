@@ -0,0 +1,57 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package dataprovider
+
+import (
+	"context"
+	"net/http"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+// checkQuota returns http.StatusOK when size bytes written to ref fit in the
+// quota of the storage and http.StatusInsufficientStorage when they do not.
+func (s *svc) checkQuota(ctx context.Context, ref *provider.Reference, size int64) int {
+	log := appctx.GetLogger(ctx)
+
+	total, used, err := s.storage.GetQuota(ctx)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotSupported); ok {
+			return http.StatusOK
+		}
+		log.Error().Err(err).Msg("dataprovider: error getting quota")
+		return http.StatusInternalServerError
+	}
+	if total <= 0 {
+		return http.StatusOK
+	}
+
+	// the size of an overwritten file is freed
+	if md, err := s.storage.GetMD(ctx, ref); err == nil && md.Type == provider.ResourceType_RESOURCE_TYPE_FILE {
+		used -= int(md.Size)
+	}
+
+	if int64(used)+size > int64(total) {
+		log.Warn().Int("total", total).Int("used", used).Int64("size", size).Msg("dataprovider: quota exceeded")
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusOK
+}
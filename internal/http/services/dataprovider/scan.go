@@ -0,0 +1,125 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package dataprovider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/antivirus"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// scan streams the content of r to the antivirus scanner. If the content is
+// infected it is quarantined when configured so, and the status to reply is
+// returned together with the scan metadata to record on clean files.
+func (s *svc) scan(ctx context.Context, r io.Reader, fn string, quarantine func() (io.ReadCloser, error)) (map[string]string, int) {
+	log := appctx.GetLogger(ctx)
+
+	res, err := s.scanner.Scan(ctx, r)
+	if err != nil {
+		log.Error().Err(err).Str("scanner", s.scanner.Name()).Msg("dataprovider: error scanning upload")
+		return nil, http.StatusInternalServerError
+	}
+
+	if !res.Infected {
+		return map[string]string{
+			antivirus.MetadataStatusKey:  antivirus.StatusClean,
+			antivirus.MetadataScannerKey: s.scanner.Name(),
+			antivirus.MetadataDateKey:    time.Now().UTC().Format(time.RFC3339),
+		}, http.StatusOK
+	}
+
+	log.Warn().Str("path", fn).Str("virus", res.Virus).Msg("dataprovider: infected upload rejected")
+
+	if s.conf.InfectedAction == "quarantine" {
+		rc, err := quarantine()
+		if err != nil {
+			log.Error().Err(err).Msg("dataprovider: error reading infected upload")
+			return nil, http.StatusForbidden
+		}
+		defer rc.Close()
+		qfn, err := s.quarantine(fn, rc)
+		if err != nil {
+			log.Error().Err(err).Msg("dataprovider: error quarantining infected upload")
+		} else {
+			log.Info().Str("path", fn).Str("quarantine", qfn).Msg("dataprovider: infected upload quarantined")
+		}
+	}
+	return nil, http.StatusForbidden
+}
+
+// quarantine copies infected content to the quarantine folder and returns
+// the name it is stored under.
+func (s *svc) quarantine(fn string, r io.Reader) (string, error) {
+	f, err := ioutil.TempFile(s.conf.QuarantineFolder, fmt.Sprintf("%d-%s.", time.Now().Unix(), path.Base(fn)))
+	if err != nil {
+		return "", errors.Wrap(err, "error creating quarantine file")
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(f.Name())
+		return "", errors.Wrap(err, "error writing quarantine file")
+	}
+	return f.Name(), nil
+}
+
+// scanUpload scans a resumable upload before it is finished. Infected
+// uploads are terminated.
+func (s *svc) scanUpload(ctx context.Context, uh storage.UploadHandler, id, fn string) (map[string]string, int) {
+	log := appctx.GetLogger(ctx)
+
+	rc, err := uh.ReadUpload(ctx, id)
+	if err != nil {
+		log.Error().Err(err).Msg("dataprovider: error reading upload")
+		return nil, http.StatusInternalServerError
+	}
+	defer rc.Close()
+
+	md, status := s.scan(ctx, rc, fn, func() (io.ReadCloser, error) { return uh.ReadUpload(ctx, id) })
+	if status == http.StatusForbidden {
+		if err := uh.TerminateUpload(ctx, id); err != nil {
+			log.Error().Err(err).Msg("dataprovider: error terminating infected upload")
+		}
+	}
+	return md, status
+}
+
+func (s *svc) setScanMetadata(ctx context.Context, ref *provider.Reference, md map[string]string) {
+	if len(md) == 0 {
+		return
+	}
+	if err := s.storage.SetArbitraryMetadata(ctx, ref, &provider.ArbitraryMetadata{Metadata: md}); err != nil {
+		if _, ok := err.(errtypes.IsNotSupported); ok {
+			return
+		}
+		appctx.GetLogger(ctx).Warn().Err(err).Msg("dataprovider: error storing scan result")
+	}
+}
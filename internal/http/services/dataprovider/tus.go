@@ -0,0 +1,425 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package dataprovider
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"hash"
+	"hash/adler32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+)
+
+// Implementation of the tus.io resumable upload protocol, see https://tus.io/protocols/resumable-upload.html
+// Supported extensions are creation, checksum and termination.
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,checksum,termination"
+	tusChecksums  = "md5,sha1,adler32"
+
+	// tusUploadIDParam is the query parameter that identifies an upload,
+	// it is kept in the query so the datagateway can forward it untouched.
+	tusUploadIDParam = "upload_id"
+
+	// statusChecksumMismatch is defined by the tus checksum extension.
+	statusChecksumMismatch = 460
+)
+
+func isTus(r *http.Request) bool {
+	return r.Header.Get("Tus-Resumable") != ""
+}
+
+func setTusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+func (s *svc) uploadHandler() (storage.UploadHandler, bool) {
+	h, ok := s.storage.(storage.UploadHandler)
+	return h, ok
+}
+
+func (s *svc) doTusOptions(w http.ResponseWriter, r *http.Request) {
+	addCorsHeader(w)
+	if _, ok := s.uploadHandler(); !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Checksum-Algorithm", tusChecksums)
+	if s.conf.MaxUploadSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(s.conf.MaxUploadSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *svc) doTus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	addCorsHeader(w)
+	setTusHeaders(w)
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	uh, ok := s.uploadHandler()
+	if !ok {
+		log.Warn().Str("driver", s.conf.Driver).Msg("dataprovider: storage driver does not support resumable uploads")
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	if r.Method == "POST" {
+		s.doTusCreate(w, r, uh)
+		return
+	}
+
+	id := r.URL.Query().Get(tusUploadIDParam)
+	if id == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "HEAD":
+		s.doTusHead(w, r, uh, id)
+	case "PATCH":
+		s.doTusPatch(w, r, uh, id)
+	case "DELETE":
+		s.doTusDelete(w, r, uh, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *svc) doTusCreate(w http.ResponseWriter, r *http.Request, uh storage.UploadHandler) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		log.Warn().Str("upload-length", r.Header.Get("Upload-Length")).Msg("dataprovider: invalid Upload-Length")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.tooLarge(length) {
+		log.Warn().Int64("upload-length", length).Msg("dataprovider: upload larger than max upload size")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		log.Warn().Err(err).Msg("dataprovider: invalid Upload-Metadata")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fn := path.Join("/", strings.TrimPrefix(r.URL.Path, s.conf.Prefix))
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+
+	if !s.checkFileType(ctx, w, fn, nil) {
+		return
+	}
+
+	if status := s.checkQuota(ctx, ref, length); status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	id, err := uh.InitiateUpload(ctx, ref, length, metadata)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if _, ok := err.(errtypes.IsPermissionDenied); ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		log.Error().Err(err).Msg("dataprovider: error initiating upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// empty files are complete right away
+	if length == 0 {
+		if err := uh.FinishUpload(ctx, id); err != nil {
+			log.Error().Err(err).Msg("dataprovider: error finishing upload")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.publishUpload(ctx, fn, 0)
+		s.pipeline.Submit(ctx, fn, 0)
+	}
+
+	w.Header().Set("Location", path.Join("/", s.conf.Prefix, fn)+"?"+tusUploadIDParam+"="+id)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *svc) doTusHead(w http.ResponseWriter, r *http.Request, uh storage.UploadHandler, id string) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	info, err := uh.GetUpload(ctx, id)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Error().Err(err).Msg("dataprovider: error getting upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Size, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *svc) doTusPatch(w http.ResponseWriter, r *http.Request, uh storage.UploadHandler, id string) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	info, err := uh.GetUpload(ctx, id)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Error().Err(err).Msg("dataprovider: error getting upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if offset != info.Offset {
+		log.Warn().Int64("offset", offset).Int64("expected", info.Offset).Msg("dataprovider: upload offset mismatch")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	var body io.Reader = &ctxReader{ctx: ctx, r: r.Body}
+	if xs := r.Header.Get("Upload-Checksum"); xs != "" {
+		// the chunk must be verified before it can be appended to the upload,
+		// so we spool it to a temporary file first.
+		tmp, status := s.verifyTusChunk(r, xs)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		defer closeAndRemove(tmp)
+		body = tmp
+	}
+
+	n, err := uh.WriteUploadChunk(ctx, id, offset, body)
+	if err != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset+n, 10))
+		if ctx.Err() != nil {
+			// the server is shutting down, the client resumes from the
+			// offset persisted by the driver
+			log.Warn().Int64("offset", offset+n).Msg("dataprovider: upload chunk aborted")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		log.Error().Err(err).Msg("dataprovider: error writing upload chunk")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	newOffset := offset + n
+	if newOffset == info.Size {
+		fn := path.Join("/", strings.TrimPrefix(r.URL.Path, s.conf.Prefix))
+
+		if !s.checkUploadFileType(ctx, w, uh, id, fn) {
+			return
+		}
+
+		var scanMD map[string]string
+		if s.scanner != nil {
+			var status int
+			scanMD, status = s.scanUpload(ctx, uh, id, fn)
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+
+		if err := uh.FinishUpload(ctx, id); err != nil {
+			log.Error().Err(err).Msg("dataprovider: error finishing upload")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.setScanMetadata(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, scanMD)
+		s.publishUpload(ctx, fn, info.Size)
+		s.pipeline.Submit(ctx, fn, info.Size)
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *svc) doTusDelete(w http.ResponseWriter, r *http.Request, uh storage.UploadHandler, id string) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	if err := uh.TerminateUpload(ctx, id); err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Error().Err(err).Msg("dataprovider: error terminating upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyTusChunk spools the request body to a temporary file while computing
+// the checksum announced in the Upload-Checksum header. On success the
+// returned file is positioned at the start of the chunk.
+func (s *svc) verifyTusChunk(r *http.Request, header string) (*os.File, int) {
+	log := appctx.GetLogger(r.Context())
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 {
+		return nil, http.StatusBadRequest
+	}
+
+	h := newHash(parts[0])
+	if h == nil {
+		return nil, http.StatusBadRequest
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, http.StatusBadRequest
+	}
+
+	f, err := ioutil.TempFile(s.conf.TmpFolder, "reva-tus-chunk")
+	if err != nil {
+		log.Error().Err(err).Msg("dataprovider: error creating tmp file for chunk")
+		return nil, http.StatusInternalServerError
+	}
+	if _, err := io.Copy(io.MultiWriter(f, h), r.Body); err != nil {
+		closeAndRemove(f)
+		log.Error().Err(err).Msg("dataprovider: error reading chunk")
+		return nil, http.StatusInternalServerError
+	}
+
+	if string(h.Sum(nil)) != string(expected) {
+		closeAndRemove(f)
+		log.Warn().Str("algorithm", parts[0]).Msg("dataprovider: chunk checksum mismatch")
+		return nil, statusChecksumMismatch
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		closeAndRemove(f)
+		log.Error().Err(err).Msg("dataprovider: error rewinding tmp file")
+		return nil, http.StatusInternalServerError
+	}
+	return f, http.StatusOK
+}
+
+// ctxReader stops reading once the context is done, for the driver to
+// persist what it has received before the connection is closed.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "adler32":
+		return adler32.New()
+	default:
+		return nil
+	}
+}
+
+// parseTusMetadata parses the Upload-Metadata header, a comma separated
+// list of keys with optional base64 encoded values.
+func parseTusMetadata(header string) (map[string]string, error) {
+	md := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, " ", 2)
+		if len(kv) == 1 {
+			md[kv[0]] = ""
+			continue
+		}
+		v, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		md[kv[0]] = string(v)
+	}
+	return md, nil
+}
+
+func closeAndRemove(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
@@ -0,0 +1,165 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gdpr
+
+import (
+	"context"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/storage/jobs"
+	"github.com/pkg/errors"
+)
+
+// deletedDisplayName replaces the name of the tombstoned users.
+const deletedDisplayName = "Deleted user"
+
+// delete removes the shares of the user, and with them their grants, its
+// public links, files, trash and preferences, and tombstones its account:
+// it is disabled and loses its name and mail but keeps its id and username,
+// so that they are not given to another user. The progress counts the
+// removed items.
+func (s *svc) delete(ctx context.Context, j *jobs.Job, client gateway.GatewayAPIClient, u *userpb.User) error {
+	log := appctx.GetLogger(ctx)
+
+	shares, err := listShares(ctx, client)
+	if err != nil {
+		return err
+	}
+	links, err := listPublicShares(ctx, client)
+	if err != nil {
+		return err
+	}
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: s.conf.Root}}
+	lsRes, err := client.ListContainer(ctx, &provider.ListContainerRequest{Ref: ref})
+	if err != nil {
+		return errors.Wrap(err, "error listing "+s.conf.Root)
+	}
+	if lsRes.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(lsRes.Status.Code, "gdpr")
+	}
+	var prefs int
+	if s.prefs != nil {
+		list, err := s.prefs.ListKeys(ctx, "")
+		if err != nil {
+			return errors.Wrap(err, "error listing preferences")
+		}
+		prefs = len(list)
+	}
+	// the trash and the account are one item each
+	total := len(shares) + len(links) + len(lsRes.Infos) + prefs + 1
+	if s.prov != nil {
+		total++
+	}
+	j.SetTotal(int64(total))
+
+	for _, share := range shares {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		res, err := client.RemoveShare(ctx, &collaboration.RemoveShareRequest{
+			Ref: &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: share.Id}},
+		})
+		if err != nil {
+			return errors.Wrap(err, "error removing share")
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return status.NewErrorFromCode(res.Status.Code, "gdpr")
+		}
+		j.Progress(1)
+	}
+
+	for _, l := range links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		res, err := client.RemovePublicShare(ctx, &link.RemovePublicShareRequest{
+			Ref: &link.PublicShareReference{Spec: &link.PublicShareReference_Id{Id: l.Id}},
+		})
+		if err != nil {
+			return errors.Wrap(err, "error removing public share")
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return status.NewErrorFromCode(res.Status.Code, "gdpr")
+		}
+		j.Progress(1)
+	}
+
+	for _, info := range lsRes.Infos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		res, err := client.Delete(ctx, &provider.DeleteRequest{
+			Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: info.Path}},
+		})
+		if err != nil {
+			return errors.Wrap(err, "error deleting "+info.Path)
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return status.NewErrorFromCode(res.Status.Code, "gdpr")
+		}
+		j.Progress(1)
+	}
+
+	// the deleted files end up in the trash, which goes last
+	purgeRes, err := client.PurgeRecycle(ctx, &gateway.PurgeRecycleRequest{Ref: ref})
+	if err != nil {
+		return errors.Wrap(err, "error purging trash")
+	}
+	if purgeRes.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(purgeRes.Status.Code, "gdpr")
+	}
+	j.Progress(1)
+
+	if s.prefs != nil {
+		list, err := s.prefs.ListKeys(ctx, "")
+		if err != nil {
+			return errors.Wrap(err, "error listing preferences")
+		}
+		for _, p := range list {
+			if err := s.prefs.DeleteKey(ctx, p.Namespace, p.Key); err != nil {
+				return errors.Wrap(err, "error deleting preference")
+			}
+			j.Progress(1)
+		}
+	}
+
+	if s.prov == nil {
+		log.Warn().Str("user", formatUserID(u.Id)).Msg("gdpr: no user manager configured, the account is not tombstoned")
+		return nil
+	}
+	a, err := s.prov.GetAccount(ctx, u.Id)
+	if err != nil {
+		return errors.Wrap(err, "error getting account")
+	}
+	a.Disabled = true
+	a.User.DisplayName = deletedDisplayName
+	a.User.Mail = ""
+	if err := s.prov.UpdateAccount(ctx, a); err != nil {
+		return errors.Wrap(err, "error tombstoning account")
+	}
+	j.Progress(1)
+	return nil
+}
@@ -0,0 +1,277 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gdpr
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/internal/http/utils"
+	"github.com/cs3org/reva/pkg/preferences"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/storage/jobs"
+	"github.com/pkg/errors"
+)
+
+// export writes the data of the user in a tar.gz archive: user.json,
+// shares.json, public-links.json, preferences.json and its files below
+// files/. The progress counts the bytes of the files.
+func (s *svc) export(ctx context.Context, j *jobs.Job, client gateway.GatewayAPIClient, u *userpb.User) error {
+	infos, total, err := walk(ctx, client, s.conf.Root)
+	if err != nil {
+		return err
+	}
+	j.SetTotal(total)
+
+	shares, err := listShares(ctx, client)
+	if err != nil {
+		return err
+	}
+	links, err := listPublicShares(ctx, client)
+	if err != nil {
+		return err
+	}
+	prefs := []*preferences.Preference{}
+	if s.prefs != nil {
+		if prefs, err = s.prefs.ListKeys(ctx, ""); err != nil {
+			return errors.Wrap(err, "error listing preferences")
+		}
+	}
+
+	// the archive is only served once complete
+	fn := s.archivePath(j.Info().ID)
+	f, err := os.OpenFile(fn+".part", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error creating archive")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	now := time.Now()
+	a := newArchive(f)
+	for _, e := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"user.json", u},
+		{"shares.json", shares},
+		{"public-links.json", links},
+		{"preferences.json", prefs},
+	} {
+		if err := a.json(e.name, now, e.v); err != nil {
+			return errors.Wrap(err, "error writing "+e.name)
+		}
+	}
+
+	root := strings.TrimSuffix(s.conf.Root, "/")
+	for _, info := range infos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := path.Join("files", strings.TrimPrefix(info.Path, root))
+		if err := s.write(ctx, j, client, a, name, info); err != nil {
+			return errors.Wrap(err, "error exporting "+info.Path)
+		}
+	}
+
+	if err := a.Close(); err != nil {
+		return errors.Wrap(err, "error writing archive")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "error writing archive")
+	}
+	return os.Rename(f.Name(), fn)
+}
+
+// write adds the file or folder to the archive, downloading files through
+// the datagateway.
+func (s *svc) write(ctx context.Context, j *jobs.Job, client gateway.GatewayAPIClient, a *archive, name string, info *provider.ResourceInfo) error {
+	var mtime time.Time
+	if info.Mtime != nil {
+		mtime = utils.TSToTime(info.Mtime)
+	}
+	if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return a.dir(name, mtime)
+	}
+
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: info.Path}}
+	dRes, err := client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{Ref: ref})
+	if err != nil {
+		return errors.Wrap(err, "error initiating file download")
+	}
+	if dRes.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(dRes.Status.Code, "gdpr")
+	}
+
+	httpReq, err := rhttp.NewRequest(ctx, http.MethodGet, dRes.DownloadEndpoint, nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating http request")
+	}
+	httpReq.Header.Set("X-Reva-Transfer", dRes.Token)
+
+	httpRes, err := s.client.Do(httpReq)
+	if err != nil {
+		return errors.Wrap(err, "error downloading file")
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading file: status %d", httpRes.StatusCode)
+	}
+	return a.file(name, int64(info.Size), mtime, &progressReader{r: httpRes.Body, j: j})
+}
+
+// walk lists the files and folders below root, parents first, and sums the
+// size of the files. The shares received by the user are left out, they
+// belong to their owners.
+func walk(ctx context.Context, client gateway.GatewayAPIClient, root string) ([]*provider.ResourceInfo, int64, error) {
+	var infos []*provider.ResourceInfo
+	var total int64
+	folders := []string{root}
+	for len(folders) > 0 {
+		fn := folders[0]
+		folders = folders[1:]
+
+		ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+		res, err := client.ListContainer(ctx, &provider.ListContainerRequest{Ref: ref})
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error listing "+fn)
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return nil, 0, status.NewErrorFromCode(res.Status.Code, "gdpr")
+		}
+		for _, info := range res.Infos {
+			switch info.Type {
+			case provider.ResourceType_RESOURCE_TYPE_CONTAINER:
+				folders = append(folders, info.Path)
+			case provider.ResourceType_RESOURCE_TYPE_FILE:
+				total += int64(info.Size)
+			default:
+				continue
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos, total, nil
+}
+
+func listShares(ctx context.Context, client gateway.GatewayAPIClient) ([]*collaboration.Share, error) {
+	res, err := client.ListShares(ctx, &collaboration.ListSharesRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing shares")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return nil, status.NewErrorFromCode(res.Status.Code, "gdpr")
+	}
+	return res.Shares, nil
+}
+
+func listPublicShares(ctx context.Context, client gateway.GatewayAPIClient) ([]*link.PublicShare, error) {
+	res, err := client.ListPublicShares(ctx, &link.ListPublicSharesRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing public shares")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return nil, status.NewErrorFromCode(res.Status.Code, "gdpr")
+	}
+	return res.Share, nil
+}
+
+// progressReader records the bytes read as the progress of the job.
+type progressReader struct {
+	r io.Reader
+	j *jobs.Job
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.j.Progress(int64(n))
+	return n, err
+}
+
+// archive writes the entries of a tar.gz archive.
+type archive struct {
+	gz *gzip.Writer
+	w  *tar.Writer
+}
+
+func newArchive(w io.Writer) *archive {
+	gz := gzip.NewWriter(w)
+	return &archive{gz: gz, w: tar.NewWriter(gz)}
+}
+
+func (a *archive) json(name string, mtime time.Time, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.file(name, int64(len(data)), mtime, strings.NewReader(string(data)))
+}
+
+func (a *archive) dir(name string, mtime time.Time) error {
+	return a.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  mtime,
+	})
+}
+
+// file adds a file, the reader has to provide exactly size bytes.
+func (a *archive) file(name string, size int64, mtime time.Time, r io.Reader) error {
+	if err := a.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  mtime,
+	}); err != nil {
+		return err
+	}
+	n, err := io.Copy(a.w, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("%s has %d bytes, expected %d", name, n, size)
+	}
+	return nil
+}
+
+func (a *archive) Close() error {
+	if err := a.w.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
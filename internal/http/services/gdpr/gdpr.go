@@ -0,0 +1,389 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package gdpr implements the admin jobs exporting the data of a user,
+// its files, shares, public links and preferences, in an archive, and
+// deleting it before tombstoning the account.
+package gdpr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/machine"
+	"github.com/cs3org/reva/pkg/preferences"
+	prefsregistry "github.com/cs3org/reva/pkg/preferences/manager/registry"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/storage/janitor"
+	"github.com/cs3org/reva/pkg/storage/jobs"
+	"github.com/cs3org/reva/pkg/trace"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+	userregistry "github.com/cs3org/reva/pkg/user/manager/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	global.Register("gdpr", New)
+}
+
+// The kinds of jobs, kept in their result.
+const (
+	jobExport = "export"
+	jobDelete = "delete"
+)
+
+type config struct {
+	Prefix     string `mapstructure:"prefix"`
+	GatewaySvc string `mapstructure:"gatewaysvc"`
+	// MachineSecret lets the service act on behalf of the users.
+	MachineSecret string `mapstructure:"machine_secret"`
+	// Root is the folder of the files of the users.
+	Root string `mapstructure:"root"`
+	// ExportDir keeps the archives until the janitor purges their jobs.
+	ExportDir  string `mapstructure:"export_dir"`
+	AdminGroup string `mapstructure:"admin_group"`
+	// The preferences are exported and deleted when a manager is
+	// configured, it has to be the one of the ocs service.
+	PreferencesManager  string                            `mapstructure:"preferences_manager"`
+	PreferencesManagers map[string]map[string]interface{} `mapstructure:"preferences_managers"`
+	// The deleted users are tombstoned when a user manager supporting the
+	// provisioning is configured.
+	UserManager  string                            `mapstructure:"user_manager"`
+	UserManagers map[string]map[string]interface{} `mapstructure:"user_managers"`
+	// Janitor purges the ended jobs and their archives.
+	Janitor janitor.Config `mapstructure:"janitor"`
+}
+
+type svc struct {
+	conf    *config
+	handler http.Handler
+	client  *http.Client
+	jobs    *jobs.Manager
+	janitor *janitor.Janitor
+	prefs   preferences.Manager
+	prov    ctxuser.Provisioner
+}
+
+// New returns a new gdpr service.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "gdpr"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.Root == "" {
+		conf.Root = "/home"
+	}
+	if conf.ExportDir == "" {
+		conf.ExportDir = filepath.Join(os.TempDir(), "reva-gdpr")
+	}
+	if conf.AdminGroup == "" {
+		conf.AdminGroup = "admin"
+	}
+	if conf.Janitor.Expiration == 0 {
+		conf.Janitor.Expiration = 7 * 86400
+	}
+	if conf.MachineSecret == "" {
+		return nil, errors.New("gdpr: machine_secret is required")
+	}
+
+	if err := os.MkdirAll(conf.ExportDir, 0700); err != nil {
+		return nil, errors.Wrap(err, "gdpr: error creating export dir")
+	}
+
+	s := &svc{
+		conf: conf,
+		// exports take long to download, no timeout
+		client: &http.Client{Transport: trace.Transport(http.DefaultTransport)},
+		jobs:   jobs.NewManager(),
+	}
+
+	if conf.PreferencesManager != "" {
+		f, ok := prefsregistry.NewFuncs[conf.PreferencesManager]
+		if !ok {
+			return nil, fmt.Errorf("driver %s not found for preferences manager", conf.PreferencesManager)
+		}
+		mgr, err := f(conf.PreferencesManagers[conf.PreferencesManager])
+		if err != nil {
+			return nil, err
+		}
+		s.prefs = mgr
+	}
+
+	if conf.UserManager != "" {
+		f, ok := userregistry.NewFuncs[conf.UserManager]
+		if !ok {
+			return nil, fmt.Errorf("driver %s not found for user manager", conf.UserManager)
+		}
+		mgr, err := f(conf.UserManagers[conf.UserManager])
+		if err != nil {
+			return nil, err
+		}
+		prov, ok := mgr.(ctxuser.Provisioner)
+		if !ok {
+			return nil, fmt.Errorf("user manager %s does not support provisioning", conf.UserManager)
+		}
+		s.prov = prov
+	}
+
+	s.janitor = janitor.New()
+	s.janitor.Add("gdpr-jobs", conf.Janitor, s.purge)
+	s.janitor.Start()
+
+	s.setHandler()
+	return s, nil
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	s.janitor.Stop()
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Handler() http.Handler {
+	return s.handler
+}
+
+func (s *svc) Unprotected() []string {
+	return []string{}
+}
+
+// setHandler serves POST export/<opaqueid>@<idp> and POST delete/<opaqueid>@<idp>,
+// starting the jobs, GET jobs/<id> with their progress, GET jobs/<id>/archive
+// with the archive of a finished export and DELETE jobs/<id> cancelling them.
+func (s *svc) setHandler() {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := ctxuser.ContextGetUser(r.Context())
+		if !ok || !s.isAdmin(u) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var head, arg string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+		arg, r.URL.Path = router.ShiftPath(r.URL.Path)
+		if arg == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case head == jobExport && r.Method == http.MethodPost:
+			s.start(w, r, jobExport, parseUserID(arg), s.export)
+		case head == jobDelete && r.Method == http.MethodPost:
+			s.start(w, r, jobDelete, parseUserID(arg), s.delete)
+		case head == "jobs" && r.URL.Path == "/archive" && r.Method == http.MethodGet:
+			s.doArchive(w, r, arg)
+		case head == "jobs" && r.URL.Path == "/" && r.Method == http.MethodGet:
+			s.doStatus(w, r, arg)
+		case head == "jobs" && r.URL.Path == "/" && r.Method == http.MethodDelete:
+			if err := s.jobs.Cancel(arg); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case head == jobExport || head == jobDelete || head == "jobs":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func (s *svc) isAdmin(u *userpb.User) bool {
+	for _, g := range u.Groups {
+		if g == s.conf.AdminGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// userFunc is the work of a job on the data of a user, given a context
+// acting on its behalf.
+type userFunc func(ctx context.Context, j *jobs.Job, client gateway.GatewayAPIClient, u *userpb.User) error
+
+// start runs f as a job and answers 202 with the location of its status.
+func (s *svc) start(w http.ResponseWriter, r *http.Request, kind string, uid *userpb.UserId, f userFunc) {
+	log := appctx.GetLogger(r.Context())
+	admin := ctxuser.ContextMustGetUser(r.Context())
+
+	// the job acts as the user, not with the token of the admin
+	ctx := appctx.WithLogger(context.Background(), log)
+	j := s.jobs.Start(ctx, formatUserID(uid), 0, func(ctx context.Context, j *jobs.Job) error {
+		client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+		if err != nil {
+			return err
+		}
+		ctx, u, err := machine.Authenticate(ctx, client, formatUserID(uid), s.conf.MachineSecret)
+		if err != nil {
+			return err
+		}
+		// the managers act on the user in the context
+		ctx = ctxuser.ContextSetUser(ctx, u)
+		return f(ctx, j, client, u)
+	})
+	j.SetResult("type", kind)
+
+	log.Info().Str("admin", admin.Username).Str("user", formatUserID(uid)).Str("job", j.Info().ID).Msgf("gdpr: %s started", kind)
+	w.Header().Set("Location", path.Join("/", s.conf.Prefix, "jobs", j.Info().ID))
+	s.writeStatus(w, r, http.StatusAccepted, j.Info())
+}
+
+// jobJSON is the status of a job. Done and Total count the bytes of the
+// exports and the items removed by the deletions.
+type jobJSON struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	User    string      `json:"user"`
+	Status  jobs.Status `json:"status"`
+	Done    int64       `json:"done"`
+	Total   int64       `json:"total"`
+	Error   string      `json:"error,omitempty"`
+	Created time.Time   `json:"created"`
+	Ended   *time.Time  `json:"ended,omitempty"`
+	Archive string      `json:"archive,omitempty"`
+}
+
+func (s *svc) doStatus(w http.ResponseWriter, r *http.Request, id string) {
+	j, err := s.jobs.Get(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.writeStatus(w, r, http.StatusOK, j.Info())
+}
+
+func (s *svc) writeStatus(w http.ResponseWriter, r *http.Request, code int, info jobs.Info) {
+	log := appctx.GetLogger(r.Context())
+	st := &jobJSON{
+		ID:      info.ID,
+		Type:    info.Result["type"],
+		User:    info.Owner,
+		Status:  info.Status,
+		Done:    info.Done,
+		Total:   info.Total,
+		Error:   info.Error,
+		Created: info.Created.UTC(),
+	}
+	if !info.Ended.IsZero() {
+		ended := info.Ended.UTC()
+		st.Ended = &ended
+	}
+	if st.Type == jobExport && info.Status == jobs.Finished {
+		st.Archive = path.Join("/", s.conf.Prefix, "jobs", info.ID, "archive")
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		log.Error().Err(err).Msg("gdpr: error encoding job status")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(data); err != nil {
+		log.Error().Err(err).Msg("gdpr: error writing response")
+	}
+}
+
+// doArchive serves the archive of a finished export.
+func (s *svc) doArchive(w http.ResponseWriter, r *http.Request, id string) {
+	j, err := s.jobs.Get(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	info := j.Info()
+	if info.Result["type"] != jobExport {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if info.Status != jobs.Finished {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(s.archivePath(id))
+	if err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Str("job", id).Msg("gdpr: error opening archive")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	name := strings.ReplaceAll(info.Owner, "@", "_") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	http.ServeContent(w, r, name, info.Ended, f)
+}
+
+func (s *svc) archivePath(id string) string {
+	return filepath.Join(s.conf.ExportDir, id+".tar.gz")
+}
+
+// purge forgets the jobs ended before the given time and removes their archives.
+func (s *svc) purge(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+	ids, err := s.jobs.Purge(ctx, before, dryRun)
+	if err != nil || dryRun {
+		return ids, err
+	}
+	for _, id := range ids {
+		if err := os.Remove(s.archivePath(id)); err != nil && !os.IsNotExist(err) {
+			appctx.GetLogger(ctx).Error().Err(err).Str("job", id).Msg("gdpr: error removing archive")
+		}
+	}
+	return ids, nil
+}
+
+// parseUserID parses a user given as <opaqueid>@<idp>.
+func parseUserID(s string) *userpb.UserId {
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		return &userpb.UserId{OpaqueId: s[:i], Idp: s[i+1:]}
+	}
+	return &userpb.UserId{OpaqueId: s}
+}
+
+func formatUserID(u *userpb.UserId) string {
+	if u.Idp == "" {
+		return u.OpaqueId
+	}
+	return u.OpaqueId + "@" + u.Idp
+}
@@ -0,0 +1,118 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gdpr
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/preferences"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+func TestArchive(t *testing.T) {
+	buf := &bytes.Buffer{}
+	a := newArchive(buf)
+	mtime := time.Unix(1600000000, 0)
+	if err := a.json("preferences.json", mtime, []*preferences.Preference{{Namespace: "core", Key: "lang", Value: "de"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.dir("files/folder", mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.file("files/folder/file.txt", 5, mtime, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	contents := map[string]string{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[h.Name] = string(data)
+	}
+	if !strings.Contains(contents["preferences.json"], `"lang"`) {
+		t.Errorf("unexpected preferences: %q", contents["preferences.json"])
+	}
+	if _, ok := contents["files/folder/"]; !ok {
+		t.Error("missing folder")
+	}
+	if contents["files/folder/file.txt"] != "hello" {
+		t.Errorf("unexpected file content: %q", contents["files/folder/file.txt"])
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s, err := New(map[string]interface{}{
+		"machine_secret": "secret",
+		"export_dir":     t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		method, url string
+		groups      []string
+		code        int
+	}{
+		{http.MethodPost, "/export/einstein@cernbox", []string{"physics"}, http.StatusForbidden},
+		{http.MethodGet, "/jobs/unknown", []string{"admin"}, http.StatusNotFound},
+		{http.MethodGet, "/jobs/unknown/archive", []string{"admin"}, http.StatusNotFound},
+		{http.MethodDelete, "/jobs/unknown", []string{"admin"}, http.StatusNotFound},
+		{http.MethodGet, "/export/einstein@cernbox", []string{"admin"}, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/unknown/einstein@cernbox", []string{"admin"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.url, nil)
+		u := &userpb.User{Username: "marie", Groups: tt.groups}
+		r = r.WithContext(ctxuser.ContextSetUser(r.Context(), u))
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: got status %d, expected %d", tt.method, tt.url, w.Code, tt.code)
+		}
+	}
+}
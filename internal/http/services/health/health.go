@@ -0,0 +1,258 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/health"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+
+	defaultTimeout = 5
+)
+
+func init() {
+	global.Register("health", New)
+}
+
+type config struct {
+	Prefix string `mapstructure:"prefix"`
+	// Timeout is the number of seconds each check may take.
+	Timeout int `mapstructure:"timeout"`
+	// GRPCChecks maps a check name to the address of a grpc endpoint
+	// the process depends on, e.g. the gateway or a storage provider.
+	GRPCChecks map[string]string `mapstructure:"grpc_checks"`
+	// HTTPChecks maps a check name to an URL that must answer without a server error.
+	HTTPChecks map[string]string `mapstructure:"http_checks"`
+}
+
+type svc struct {
+	conf    *config
+	handler http.Handler
+}
+
+// New returns a new health service exposing liveness and readiness probes.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "health"
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = defaultTimeout
+	}
+	if conf.GRPCChecks == nil {
+		conf.GRPCChecks = map[string]string{}
+	}
+	if _, ok := conf.GRPCChecks["gateway"]; !ok {
+		if gw := sharedconf.GetGatewaySVC(""); gw != "" {
+			conf.GRPCChecks["gateway"] = gw
+		}
+	}
+
+	s := &svc{conf: conf}
+	s.setHandler()
+	return s, nil
+}
+
+func (s *svc) Close() error {
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+// probes must be reachable without credentials.
+func (s *svc) Unprotected() []string {
+	return []string{"/healthz", "/readyz"}
+}
+
+func (s *svc) Handler() http.Handler {
+	return s.handler
+}
+
+type check struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"duration_ms"`
+}
+
+type report struct {
+	Status   string            `json:"status"`
+	Services []health.Service  `json:"services,omitempty"`
+	Checks   map[string]*check `json:"checks,omitempty"`
+}
+
+func (s *svc) setHandler() {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var head string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch head {
+		case "healthz":
+			// liveness only tells whether the process is able to serve requests
+			writeReport(w, r, &report{Status: statusOK, Services: health.Services()})
+		case "readyz":
+			writeReport(w, r, s.ready(r.Context()))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+// ready runs all the checks concurrently, each one bounded by the configured timeout.
+func (s *svc) ready(ctx context.Context) *report {
+	checks := map[string]func(context.Context) error{}
+
+	for _, service := range health.Services() {
+		service := service
+		checks[service.Kind+"/"+service.Name] = func(ctx context.Context) error {
+			if service.Kind == "grpc" {
+				return checkGRPC(ctx, service.Network, service.Address)
+			}
+			return checkListening(ctx, service.Network, service.Address)
+		}
+	}
+	for name, addr := range s.conf.GRPCChecks {
+		addr := addr
+		checks[name] = func(ctx context.Context) error {
+			return checkGRPC(ctx, "tcp", addr)
+		}
+	}
+	for name, u := range s.conf.HTTPChecks {
+		u := u
+		checks[name] = func(ctx context.Context) error {
+			return checkHTTP(ctx, u)
+		}
+	}
+
+	rep := &report{Status: statusOK, Checks: map[string]*check{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, f := range checks {
+		wg.Add(1)
+		go func(name string, f func(context.Context) error) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(s.conf.Timeout)*time.Second)
+			defer cancel()
+
+			start := time.Now()
+			err := f(ctx)
+			c := &check{Status: statusOK, Duration: time.Since(start).Nanoseconds() / int64(time.Millisecond)}
+			if err != nil {
+				c.Status = statusFail
+				c.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			rep.Checks[name] = c
+			if err != nil {
+				rep.Status = statusFail
+			}
+		}(name, f)
+	}
+	wg.Wait()
+
+	return rep
+}
+
+func checkGRPC(ctx context.Context, network, addr string) error {
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}),
+	)
+	if err != nil {
+		return errors.Wrap(err, "error connecting to "+addr)
+	}
+	return conn.Close()
+}
+
+func checkListening(ctx context.Context, network, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return errors.Wrap(err, "error connecting to "+addr)
+	}
+	return conn.Close()
+}
+
+func checkHTTP(ctx context.Context, u string) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "error requesting "+u)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("%s answered with status %d", u, res.StatusCode)
+	}
+	return nil
+}
+
+func writeReport(w http.ResponseWriter, r *http.Request, rep *report) {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("error encoding health report")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if rep.Status != statusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	if _, err := w.Write(data); err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("error writing health report")
+	}
+}
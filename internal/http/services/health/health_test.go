@@ -0,0 +1,76 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package health
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestReadiness(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	go func() { _ = gs.Serve(ln) }()
+	defer gs.Stop()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+
+	s, err := New(map[string]interface{}{
+		"timeout":     1,
+		"grpc_checks": map[string]string{"storage": ln.Addr().String()},
+		"http_checks": map[string]string{"idp": up.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(p string) (int, *report) {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		rep := &report{}
+		if err := json.Unmarshal(w.Body.Bytes(), rep); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, rep
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("expected liveness to succeed, got %d", code)
+	}
+
+	code, rep := get("/readyz")
+	if code != http.StatusOK || rep.Checks["storage"].Status != statusOK || rep.Checks["idp"].Status != statusOK {
+		t.Fatalf("expected readiness to succeed, got %d: %+v", code, rep.Checks)
+	}
+
+	up.Close()
+	code, rep = get("/readyz")
+	if code != http.StatusServiceUnavailable || rep.Checks["idp"].Status != statusFail {
+		t.Fatalf("expected readiness to fail, got %d: %+v", code, rep.Checks)
+	}
+}
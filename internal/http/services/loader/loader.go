@@ -20,14 +20,26 @@ package loader
 
 import (
 	// Load core HTTP services
+	_ "github.com/cs3org/reva/internal/http/services/accounting"
+	_ "github.com/cs3org/reva/internal/http/services/activities"
+	_ "github.com/cs3org/reva/internal/http/services/archiver"
 	_ "github.com/cs3org/reva/internal/http/services/datagateway"
 	_ "github.com/cs3org/reva/internal/http/services/dataprovider"
+	_ "github.com/cs3org/reva/internal/http/services/gdpr"
+	_ "github.com/cs3org/reva/internal/http/services/health"
 	_ "github.com/cs3org/reva/internal/http/services/helloworld"
+	_ "github.com/cs3org/reva/internal/http/services/metadata"
 	_ "github.com/cs3org/reva/internal/http/services/ocmd"
+	_ "github.com/cs3org/reva/internal/http/services/ocmprovider"
 	_ "github.com/cs3org/reva/internal/http/services/oidcprovider"
 	_ "github.com/cs3org/reva/internal/http/services/owncloud/ocdav"
 	_ "github.com/cs3org/reva/internal/http/services/owncloud/ocs"
+	_ "github.com/cs3org/reva/internal/http/services/preview"
 	_ "github.com/cs3org/reva/internal/http/services/prometheus"
+	_ "github.com/cs3org/reva/internal/http/services/publiclinks"
+	_ "github.com/cs3org/reva/internal/http/services/push"
+	_ "github.com/cs3org/reva/internal/http/services/saml"
+	_ "github.com/cs3org/reva/internal/http/services/search"
 	_ "github.com/cs3org/reva/internal/http/services/wellknown"
 	// Add your own service here
 )
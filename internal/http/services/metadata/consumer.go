@@ -0,0 +1,189 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/machine"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/metadata"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// consumer extracts the metadata of the files whose upload events are
+// received on NATS. The events are handled one at a time, in the background
+// of the uploads.
+type consumer struct {
+	extractors []metadata.Extractor
+	conf       *config
+	conn       *nats.Conn
+}
+
+func newConsumer(extractors []metadata.Extractor, c *config) *consumer {
+	return &consumer{extractors: extractors, conf: c}
+}
+
+func (c *consumer) start() error {
+	conn, err := nats.Connect(c.conf.NatsURL, nats.Name("reva-metadata"), nats.MaxReconnects(-1))
+	if err != nil {
+		return errors.Wrap(err, "metadata: error connecting to "+c.conf.NatsURL)
+	}
+	if _, err := conn.Subscribe(c.conf.NatsSubject+"."+events.TypeFileUploaded, c.handleMsg); err != nil {
+		conn.Close()
+		return errors.Wrap(err, "metadata: error subscribing to events")
+	}
+	c.conn = conn
+	return nil
+}
+
+func (c *consumer) stop() {
+	c.conn.Close()
+}
+
+func (c *consumer) handleMsg(msg *nats.Msg) {
+	ctx := appctx.WithLogger(context.Background(), &log.Logger)
+
+	e := &events.Event{}
+	if err := json.Unmarshal(msg.Data, e); err != nil {
+		log.Error().Err(err).Msg("metadata: error decoding event")
+		return
+	}
+	if err := c.handleUpload(ctx, e); err != nil {
+		log.Warn().Err(err).Str("path", e.Path).Msg("metadata: error extracting metadata")
+	}
+}
+
+// handleUpload extracts the metadata of the uploaded file and stores it.
+func (c *consumer) handleUpload(ctx context.Context, e *events.Event) error {
+	if e.User == nil || (e.Path == "" && e.Resource == nil) {
+		return nil
+	}
+	client, err := pool.GetGatewayServiceClient(c.conf.GatewaySvc)
+	if err != nil {
+		return errors.Wrap(err, "error getting grpc client")
+	}
+	u := e.User.OpaqueId
+	if e.User.Idp != "" {
+		u += "@" + e.User.Idp
+	}
+	ctx, _, err = machine.Authenticate(ctx, client, u, c.conf.MachineSecret)
+	if err != nil {
+		return err
+	}
+
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: e.Path}}
+	if e.Resource != nil {
+		ref = &provider.Reference{Spec: &provider.Reference_Id{Id: e.Resource}}
+	}
+	res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil {
+		return errors.Wrap(err, "error sending grpc stat request")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(res.Status.Code, "metadata")
+	}
+	info := res.Info
+
+	var extractors []metadata.Extractor
+	for _, x := range c.extractors {
+		if x.Handles(info) {
+			extractors = append(extractors, x)
+		}
+	}
+	if len(extractors) == 0 || info.Size > c.conf.MaxSize {
+		return nil
+	}
+
+	content, err := c.download(ctx, client, info)
+	if err != nil {
+		return err
+	}
+	md := map[string]string{}
+	for _, x := range extractors {
+		m, err := x.Extract(ctx, content)
+		if err != nil {
+			return err
+		}
+		for k, v := range m {
+			md[k] = v
+		}
+	}
+	if len(md) == 0 {
+		return nil
+	}
+
+	ref = &provider.Reference{Spec: &provider.Reference_Id{Id: info.Id}}
+	sRes, err := client.SetArbitraryMetadata(ctx, &provider.SetArbitraryMetadataRequest{
+		Ref:               ref,
+		ArbitraryMetadata: &provider.ArbitraryMetadata{Metadata: md},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error sending grpc set arbitrary metadata request")
+	}
+	if sRes.Status.Code != rpc.Code_CODE_OK {
+		return status.NewErrorFromCode(sRes.Status.Code, "metadata")
+	}
+	return nil
+}
+
+func (c *consumer) download(ctx context.Context, client gateway.GatewayAPIClient, info *provider.ResourceInfo) ([]byte, error) {
+	ref := &provider.Reference{Spec: &provider.Reference_Id{Id: info.Id}}
+	dRes, err := client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{Ref: ref})
+	if err != nil {
+		return nil, errors.Wrap(err, "error initiating file download")
+	}
+	if dRes.Status.Code != rpc.Code_CODE_OK {
+		return nil, status.NewErrorFromCode(dRes.Status.Code, "metadata")
+	}
+
+	httpReq, err := rhttp.NewRequest(ctx, http.MethodGet, dRes.DownloadEndpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating http request")
+	}
+	httpReq.Header.Set("X-Reva-Transfer", dRes.Token)
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "error downloading file")
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading file: status %d", httpRes.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(httpRes.Body, int64(c.conf.MaxSize)))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading file")
+	}
+	return data, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package metadata implements a service extracting metadata from the
+// uploaded files, like the dimensions and capture date of images, and
+// storing it as arbitrary metadata of the files. The extraction runs in the
+// background when the upload events published on NATS are received.
+package metadata
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cs3org/reva/pkg/metadata"
+	"github.com/cs3org/reva/pkg/metadata/extractor/registry"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	global.Register("metadata", New)
+}
+
+type config struct {
+	Prefix     string `mapstructure:"prefix"`
+	GatewaySvc string `mapstructure:"gatewaysvc"`
+	// MachineSecret lets the service read and annotate the files on behalf of their owners.
+	MachineSecret string `mapstructure:"machine_secret"`
+	// NatsURL is the NATS server the upload events are received from, see the nats events publisher.
+	NatsURL     string `mapstructure:"nats_url"`
+	NatsSubject string `mapstructure:"nats_subject"`
+	// ExtractorChain are the extractors run on every uploaded file.
+	ExtractorChain []string                          `mapstructure:"extractor_chain"`
+	Extractors     map[string]map[string]interface{} `mapstructure:"extractors"`
+	// MaxSize is the size in bytes above which files are not read.
+	MaxSize uint64 `mapstructure:"max_size"`
+}
+
+type svc struct {
+	conf     *config
+	consumer *consumer
+}
+
+// New returns a new metadata extraction service.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "metadata"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.NatsSubject == "" {
+		conf.NatsSubject = "reva.events"
+	}
+	if len(conf.ExtractorChain) == 0 {
+		conf.ExtractorChain = []string{"image"}
+	}
+	if conf.MaxSize == 0 {
+		conf.MaxSize = 64 * 1024 * 1024
+	}
+
+	if conf.NatsURL == "" {
+		return nil, errors.New("metadata: nats_url is required to receive the upload events")
+	}
+	if conf.MachineSecret == "" {
+		return nil, errors.New("metadata: machine_secret is required to read the files")
+	}
+
+	extractors, err := getExtractors(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newConsumer(extractors, conf)
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	return &svc{conf: conf, consumer: c}, nil
+}
+
+func getExtractors(c *config) ([]metadata.Extractor, error) {
+	extractors := make([]metadata.Extractor, 0, len(c.ExtractorChain))
+	for _, name := range c.ExtractorChain {
+		f, ok := registry.NewFuncs[name]
+		if !ok {
+			return nil, fmt.Errorf("metadata extractor not found: %s", name)
+		}
+		e, err := f(c.Extractors[name])
+		if err != nil {
+			return nil, errors.Wrap(err, "metadata: error creating extractor "+name)
+		}
+		extractors = append(extractors, e)
+	}
+	return extractors, nil
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	s.consumer.stop()
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+// Handler serves nothing, the service only reacts to the events.
+func (s *svc) Handler() http.Handler {
+	return http.NotFoundHandler()
+}
+
+func (s *svc) Unprotected() []string {
+	return []string{}
+}
@@ -24,8 +24,10 @@ import (
 	"net/http"
 
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
 )
 
+// configData configures the discovery document of the provider.
 type configData struct {
 	Enabled       bool            `json:"enabled" xml:"enabled"`
 	APIVersion    string          `json:"apiVersion" xml:"apiVersion"`
@@ -46,29 +48,34 @@ type resourceTypesProtocols struct {
 }
 
 type configHandler struct {
-	c configData
+	c *discovery.Document
 }
 
 func (h *configHandler) init(c *Config) {
-	h.c = c.Config
-	if h.c.APIVersion == "" {
-		h.c.APIVersion = "1.0-proposal1"
+	h.c = newDocument(c.Config, c.Prefix)
+	if c.ExposeUsers {
+		h.c.Endpoints[discovery.EndpointUsers] = h.c.Endpoint + "/users"
 	}
-	if h.c.Host == "" {
-		h.c.Host = "localhost"
+}
+
+// newDocument returns the discovery document of the ocmd service exposed
+// at prefix.
+func newDocument(c configData, prefix string) *discovery.Document {
+	if c.Host == "" {
+		c.Host = "localhost"
+	}
+	if c.Provider == "" {
+		c.Provider = "cernbox"
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = fmt.Sprintf("https://%s/%s", c.Host, prefix)
 	}
-	if h.c.Provider == "" {
-		h.c.Provider = "cernbox"
+	d := discovery.NewDocument(c.Host, c.Provider, c.Endpoint, fmt.Sprintf("/%s/ocm_webdav", c.Provider))
+	if c.APIVersion != "" {
+		// the newest version advertised, the older ones are still spoken
+		d.APIVersion = c.APIVersion
 	}
-	h.c.Enabled = true
-	h.c.Endpoint = fmt.Sprintf("https://%s/%s", h.c.Host, c.Prefix)
-	h.c.ResourceTypes = []resourceTypes{resourceTypes{
-		Name:       "file",
-		ShareTypes: []string{"user"},
-		Protocols: resourceTypesProtocols{
-			Webdav: fmt.Sprintf("/%s/ocm_webdav", h.c.Provider),
-		},
-	}}
+	return d
 }
 
 func (h *configHandler) Handler() http.Handler {
@@ -0,0 +1,271 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/invite"
+	"github.com/cs3org/reva/pkg/ocm/provider"
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+type invitesHandler struct {
+	inviteManager invite.Manager
+	authorizer    provider.Authorizer
+	discovery     *discovery.Client
+	// host is the domain of this provider, as seen by the remote ones.
+	host string
+}
+
+func (h *invitesHandler) init(c *Config, im invite.Manager, pa provider.Authorizer, dc *discovery.Client) {
+	h.inviteManager = im
+	h.authorizer = pa
+	h.discovery = dc
+	h.host = c.Config.Host
+	if h.host == "" {
+		h.host = "localhost"
+	}
+}
+
+func (h *invitesHandler) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := appctx.GetLogger(r.Context())
+
+		var head string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+		log.Debug().Str("method", r.Method).Str("head", head).Msg("invitesHandler")
+
+		switch {
+		case head == "" && r.Method == http.MethodPost:
+			h.generateToken(w, r)
+		case head == "forward" && r.Method == http.MethodPost:
+			h.forwardInvite(w, r)
+		case head == "remote-users" && r.Method == http.MethodGet:
+			h.findRemoteUsers(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func (h *invitesHandler) generateToken(w http.ResponseWriter, r *http.Request) {
+	token, err := h.inviteManager.GenerateToken(r.Context())
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "error generating invite token", err)
+		return
+	}
+	writeJSON(w, r, token)
+}
+
+// acceptInvite is called by the provider of the remote user
+// when they accept an invitation generated on this provider.
+func (h *invitesHandler) acceptInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	token, userID, recipientProvider := r.FormValue("token"), r.FormValue("userID"), r.FormValue("recipientProvider")
+	if token == "" || userID == "" || recipientProvider == "" {
+		WriteError(w, r, APIErrorInvalidParameter, "token, userID and recipientProvider are required", nil)
+		return
+	}
+
+	remoteUser := &userpb.User{
+		Id: &userpb.UserId{
+			Idp:      recipientProvider,
+			OpaqueId: userID,
+		},
+		Username:    userID,
+		Mail:        r.FormValue("email"),
+		DisplayName: r.FormValue("name"),
+	}
+
+	if err := h.inviteManager.AcceptInvite(r.Context(), token, remoteUser); err != nil {
+		switch err.(type) {
+		case errtypes.IsNotFound, errtypes.IsInvalidCredentials:
+			WriteError(w, r, APIErrorInvalidParameter, "invalid or expired invite token", nil)
+		default:
+			WriteError(w, r, APIErrorServerError, "error accepting invite", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// forwardInvite accepts on behalf of the user in the context an invite
+// generated on the remote provider, by calling its invite-accepted endpoint.
+func (h *invitesHandler) forwardInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token, domain := r.FormValue("token"), r.FormValue("providerDomain")
+	if token == "" || domain == "" {
+		WriteError(w, r, APIErrorInvalidParameter, "token and providerDomain are required", nil)
+		return
+	}
+
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		WriteError(w, r, APIErrorUnauthenticated, "no user in the context", nil)
+		return
+	}
+
+	p, err := remoteProvider(ctx, h.authorizer, h.discovery, domain)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			WriteError(w, r, APIErrorUntrustedService, "provider not trusted: "+domain, nil)
+			return
+		}
+		WriteError(w, r, APIErrorProviderError, "error looking up the remote provider", err)
+		return
+	}
+	endpoint, err := p.URL(discovery.EndpointInviteAccepted)
+	if err != nil {
+		WriteError(w, r, APIErrorUnimplemented, "the remote provider does not support invites: "+domain, err)
+		return
+	}
+	if !inDomain(endpoint, domain) {
+		WriteError(w, r, APIErrorUntrustedService, "the invite endpoint is outside the domain of the provider: "+domain, nil)
+		return
+	}
+
+	form := url.Values{
+		"token":             {token},
+		"userID":            {u.Id.OpaqueId},
+		"recipientProvider": {h.host},
+		"email":             {u.Mail},
+		"name":              {u.DisplayName},
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "error creating request", err)
+		return
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := rhttp.GetHTTPClient(ctx).Do(req)
+	if err != nil {
+		WriteError(w, r, APIErrorProviderError, "error forwarding invite", err)
+		return
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		w.WriteHeader(http.StatusOK)
+	case http.StatusBadRequest:
+		WriteError(w, r, APIErrorInvalidParameter, "invalid or expired invite token", nil)
+	default:
+		WriteError(w, r, APIErrorProviderError, "error forwarding invite", fmt.Errorf("remote provider answered %s", res.Status))
+	}
+}
+
+// remoteProvider returns the trusted provider of the domain, discovered
+// through its ocm-provider document along with the version of the API to
+// speak with it. Only the providers explicitly listed by the authorizer are
+// contacted, so an authorizer allowing every domain allows none here. A
+// provider that cannot be discovered but whose endpoint is listed by the
+// authorizer is assumed to speak the newest version.
+func remoteProvider(ctx context.Context, authorizer provider.Authorizer, dc *discovery.Client, domain string) (*discovery.Provider, error) {
+	if domain == "" || strings.ContainsAny(domain, "/?#@") {
+		return nil, errtypes.NotFound(domain)
+	}
+	if err := authorizer.IsProviderAllowed(ctx, domain); err != nil {
+		return nil, err
+	}
+	providers, err := authorizer.ListAllProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var listed *ocm.ProviderInfo
+	for _, info := range providers {
+		if info.Domain == domain {
+			listed = info
+			break
+		}
+	}
+	if listed == nil {
+		return nil, errtypes.NotFound(domain)
+	}
+
+	p, err := dc.Discover(ctx, domain)
+	if err == nil {
+		if !inDomain(p.Document.Endpoint, domain) {
+			return nil, fmt.Errorf("ocm endpoint %s of provider %s is outside its domain", p.Document.Endpoint, domain)
+		}
+		return p, nil
+	}
+	if listed.ApiEndpoint != "" {
+		appctx.GetLogger(ctx).Warn().Err(err).Str("domain", domain).Msg("error discovering provider, using the endpoint of the authorizer")
+		return discovery.Assume(domain, listed.ApiEndpoint), nil
+	}
+	return nil, err
+}
+
+// inDomain tells whether the URL is served by the domain or one of its
+// subdomains, over https.
+func inDomain(rawurl, domain string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	domain = strings.ToLower(domain)
+	if i := strings.LastIndex(domain, ":"); i >= 0 {
+		domain = domain[:i]
+	}
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func (h *invitesHandler) findRemoteUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.inviteManager.FindRemoteUsers(r.Context(), r.FormValue("search"))
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "error searching remote users", err)
+		return
+	}
+	writeJSON(w, r, users)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "error encoding response", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("error writing response")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/provider/authorizer/json"
+	"github.com/cs3org/reva/pkg/ocm/provider/authorizer/memory"
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
+)
+
+func TestInDomain(t *testing.T) {
+	tests := []struct {
+		url, domain string
+		want        bool
+	}{
+		{"https://cern.ch/ocm/invite-accepted", "cern.ch", true},
+		{"https://sciencemesh.cern.ch/ocm", "cern.ch", true},
+		{"https://CERN.ch:8443/ocm", "cern.ch:8443", true},
+		{"https://evilcern.ch/ocm", "cern.ch", false},
+		{"https://cern.ch.evil.org/ocm", "cern.ch", false},
+		{"http://cern.ch/ocm", "cern.ch", false},
+		{"https://user@cern.ch/ocm", "cern.ch", false},
+		{"https://10.0.0.1/ocm", "cern.ch", false},
+		{"not a url", "cern.ch", false},
+	}
+	for _, tt := range tests {
+		if got := inDomain(tt.url, tt.domain); got != tt.want {
+			t.Errorf("inDomain(%q, %q) = %v, want %v", tt.url, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteProvider(t *testing.T) {
+	ctx := context.Background()
+	dc := discovery.NewClient(0)
+
+	// the memory authorizer allows every domain but lists none
+	all, _ := memory.New(nil)
+	if _, err := remoteProvider(ctx, all, dc, "example.org"); err == nil {
+		t.Fatal("expected the provider not listed to be refused")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "ocmd-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "providers.json")
+	if err := ioutil.WriteFile(file, []byte(`[{"domain": "localhost:1", "api_endpoint": "https://localhost:1/ocm"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := json.New(map[string]interface{}{"providers": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, domain := range []string{"example.org", "localhost:1/ocm", "user@localhost:1"} {
+		if _, err := remoteProvider(ctx, listed, dc, domain); err == nil {
+			t.Errorf("expected %s to be refused", domain)
+		}
+	}
+
+	// the provider cannot be discovered, its endpoint is the listed one
+	p, err := remoteProvider(ctx, listed, dc, "localhost:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Document.Endpoint != "https://localhost:1/ocm" {
+		t.Fatalf("unexpected endpoint %s", p.Document.Endpoint)
+	}
+}
@@ -19,9 +19,16 @@
 package ocmd
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/ocm/invite"
+	"github.com/cs3org/reva/pkg/ocm/invite/manager/registry"
+	"github.com/cs3org/reva/pkg/ocm/provider"
+	authorizerregistry "github.com/cs3org/reva/pkg/ocm/provider/authorizer/registry"
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
 	"github.com/cs3org/reva/pkg/rhttp/global"
 	"github.com/cs3org/reva/pkg/rhttp/router"
 	"github.com/cs3org/reva/pkg/sharedconf"
@@ -34,13 +41,36 @@ type Config struct {
 	Host       string     `mapstructure:"host"`
 	GatewaySvc string     `mapstructure:"gatewaysvc"`
 	Config     configData `mapstructure:"config"`
+
+	// OCMShareProviderSvc is the ocmshareprovider service storing the
+	// shares received from the remote providers, authenticated with
+	// OCMSecret. It defaults to the gateway address.
+	OCMShareProviderSvc string `mapstructure:"ocmshareprovidersvc"`
+	OCMSecret           string `mapstructure:"ocm_secret"`
+
+	InviteManager  string                            `mapstructure:"invite_manager"`
+	InviteManagers map[string]map[string]interface{} `mapstructure:"invite_managers"`
+
+	// ProviderAuthorizer lists the trusted providers, the only ones invites
+	// are forwarded to.
+	ProviderAuthorizer  string                            `mapstructure:"provider_authorizer"`
+	ProviderAuthorizers map[string]map[string]interface{} `mapstructure:"provider_authorizers"`
+	// AdminGroup is the group whose members can add and remove trusted
+	// providers, with authorizers supporting it.
+	AdminGroup string `mapstructure:"admin_group"`
+	// ExposeUsers lets the trusted providers find the users of this one,
+	// to suggest them as recipients of their shares.
+	ExposeUsers bool `mapstructure:"expose_users"`
 }
 
 type svc struct {
 	Conf                 *Config
+	ProviderAuthorizer   provider.Authorizer
 	SharesHandler        *sharesHandler
 	NotificationsHandler *notificationsHandler
 	ConfigHandler        *configHandler
+	InvitesHandler       *invitesHandler
+	ProvidersHandler     *providersHandler
 }
 
 func init() {
@@ -56,21 +86,69 @@ func New(m map[string]interface{}) (global.Service, error) {
 		return nil, err
 	}
 	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.OCMShareProviderSvc == "" {
+		conf.OCMShareProviderSvc = conf.GatewaySvc
+	}
+	if conf.InviteManager == "" {
+		conf.InviteManager = "json"
+	}
+
+	if conf.ProviderAuthorizer == "" {
+		conf.ProviderAuthorizer = "memory"
+	}
+
+	if conf.AdminGroup == "" {
+		conf.AdminGroup = "admin"
+	}
+
+	im, err := getInviteManager(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	pa, err := getProviderAuthorizer(conf)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &svc{
-		Conf: conf,
+		Conf:               conf,
+		ProviderAuthorizer: pa,
 	}
 	s.SharesHandler = new(sharesHandler)
 	s.NotificationsHandler = new(notificationsHandler)
 	s.ConfigHandler = new(configHandler)
-	s.SharesHandler.init(s.Conf)
+	s.InvitesHandler = new(invitesHandler)
+	s.ProvidersHandler = new(providersHandler)
+	dc := discovery.NewClient(0)
+	s.SharesHandler.init(s.Conf, im, pa, dc)
 	s.NotificationsHandler.init(s.Conf)
 	s.ConfigHandler.init(s.Conf)
+	s.InvitesHandler.init(s.Conf, im, pa, dc)
+	s.ProvidersHandler.init(s.Conf, pa)
 	return s, nil
 }
 
+func getInviteManager(c *Config) (invite.Manager, error) {
+	if f, ok := registry.NewFuncs[c.InviteManager]; ok {
+		return f(c.InviteManagers[c.InviteManager])
+	}
+	return nil, fmt.Errorf("driver %s not found for invite manager", c.InviteManager)
+}
+
+func getProviderAuthorizer(c *Config) (provider.Authorizer, error) {
+	if f, ok := authorizerregistry.NewFuncs[c.ProviderAuthorizer]; ok {
+		return f(c.ProviderAuthorizers[c.ProviderAuthorizer])
+	}
+	return nil, fmt.Errorf("driver %s not found for provider authorizer", c.ProviderAuthorizer)
+}
+
 // Close performs cleanup.
 func (s *svc) Close() error {
+	// some authorizers refresh the providers in the background
+	if c, ok := s.ProviderAuthorizer.(io.Closer); ok {
+		return c.Close()
+	}
 	return nil
 }
 
@@ -79,7 +157,7 @@ func (s *svc) Prefix() string {
 }
 
 func (s *svc) Unprotected() []string {
-	return []string{}
+	return []string{"/ocm-provider", "/invite-accepted", "/remote-shares", "/users"}
 }
 
 func (s *svc) Handler() http.Handler {
@@ -102,6 +180,21 @@ func (s *svc) Handler() http.Handler {
 		case "notifications":
 			s.NotificationsHandler.Handler().ServeHTTP(w, r)
 			return
+		case "providers":
+			s.ProvidersHandler.Handler().ServeHTTP(w, r)
+			return
+		case "invites":
+			s.InvitesHandler.Handler().ServeHTTP(w, r)
+			return
+		case "invite-accepted":
+			s.InvitesHandler.acceptInvite(w, r)
+			return
+		case "remote-shares":
+			s.SharesHandler.receiveShare(w, r)
+			return
+		case "users":
+			s.findUsers(w, r)
+			return
 		}
 
 		log.Warn().Msg("resource not found")
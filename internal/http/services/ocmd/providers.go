@@ -0,0 +1,135 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocmd
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/provider"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+type providersHandler struct {
+	authorizer provider.Authorizer
+	adminGroup string
+}
+
+func (h *providersHandler) init(c *Config, pa provider.Authorizer) {
+	h.authorizer = pa
+	h.adminGroup = c.AdminGroup
+}
+
+func (h *providersHandler) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var head string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+		switch {
+		case head == "" && r.Method == http.MethodGet:
+			h.listProviders(w, r)
+		case head == "" && r.Method == http.MethodPost:
+			h.addProvider(w, r)
+		case head != "" && r.Method == http.MethodDelete:
+			h.removeProvider(w, r, head)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+// listProviders returns the trusted providers, remote users can be invited from.
+func (h *providersHandler) listProviders(w http.ResponseWriter, r *http.Request) {
+	providers, err := h.authorizer.ListAllProviders(r.Context())
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "error listing providers", err)
+		return
+	}
+	writeJSON(w, r, providers)
+}
+
+// manager returns the authorizer if the user in the context can change the
+// trusted providers and the authorizer supports it, writing the error otherwise.
+func (h *providersHandler) manager(w http.ResponseWriter, r *http.Request) (provider.Manager, bool) {
+	u, ok := user.ContextGetUser(r.Context())
+	if !ok {
+		WriteError(w, r, APIErrorUnauthenticated, "no user in the context", nil)
+		return nil, false
+	}
+	admin := false
+	for _, g := range u.Groups {
+		if g == h.adminGroup {
+			admin = true
+			break
+		}
+	}
+	if !admin {
+		WriteError(w, r, APIErrorForbidden, "only admins can manage the trusted providers", nil)
+		return nil, false
+	}
+
+	m, ok := h.authorizer.(provider.Manager)
+	if !ok {
+		WriteError(w, r, APIErrorUnimplemented, "the provider authorizer does not support changing the providers", nil)
+		return nil, false
+	}
+	return m, true
+}
+
+// addProvider trusts the provider in the body, replacing the one with the
+// same domain.
+func (h *providersHandler) addProvider(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	p := &ocm.ProviderInfo{}
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil || p.Domain == "" {
+		WriteError(w, r, APIErrorInvalidParameter, "a provider with a domain is required", err)
+		return
+	}
+
+	if err := m.AddProvider(r.Context(), p); err != nil {
+		WriteError(w, r, APIErrorServerError, "error adding provider", err)
+		return
+	}
+	writeJSON(w, r, p)
+}
+
+// removeProvider stops trusting the provider of the domain.
+func (h *providersHandler) removeProvider(w http.ResponseWriter, r *http.Request, domain string) {
+	m, ok := h.manager(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.RemoveProvider(r.Context(), domain); err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			WriteError(w, r, APIErrorNotFound, "provider not found: "+domain, nil)
+			return
+		}
+		WriteError(w, r, APIErrorServerError, "error removing provider", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
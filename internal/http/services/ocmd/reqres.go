@@ -32,6 +32,7 @@ type APIErrorCode string
 const (
 	APIErrorNotFound         APIErrorCode = "RESOURCE_NOT_FOUND"
 	APIErrorUnauthenticated  APIErrorCode = "UNAUTHENTICATED"
+	APIErrorForbidden        APIErrorCode = "FORBIDDEN"
 	APIErrorUntrustedService APIErrorCode = "UNTRUSTED_SERVICE"
 	APIErrorUnimplemented    APIErrorCode = "FUNCTION_NOT_IMPLEMENTED"
 	APIErrorInvalidParameter APIErrorCode = "INVALID_PARAMETER"
@@ -43,6 +44,7 @@ const (
 var APIErrorCodeMapping = map[APIErrorCode]int{
 	APIErrorNotFound:         http.StatusNotFound,
 	APIErrorUnauthenticated:  http.StatusUnauthorized,
+	APIErrorForbidden:        http.StatusForbidden,
 	APIErrorUntrustedService: http.StatusForbidden,
 	APIErrorUnimplemented:    http.StatusNotImplemented,
 	APIErrorInvalidParameter: http.StatusBadRequest,
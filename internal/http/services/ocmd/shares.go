@@ -20,10 +20,12 @@ package ocmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"path"
 	"strconv"
+	"strings"
 
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
@@ -32,15 +34,30 @@ import (
 	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/internal/http/services/owncloud/ocs/conversions"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/ocm/invite"
+	ocmprovider "github.com/cs3org/reva/pkg/ocm/provider"
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
+	"github.com/cs3org/reva/pkg/ocm/share"
+	"github.com/cs3org/reva/pkg/ocm/share/received"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 )
 
 type sharesHandler struct {
-	gatewayAddr string
+	gatewayAddr   string
+	ocmShareAddr  string
+	ocmSecret     string
+	inviteManager invite.Manager
+	authorizer    ocmprovider.Authorizer
+	discovery     *discovery.Client
 }
 
-func (h *sharesHandler) init(c *Config) {
+func (h *sharesHandler) init(c *Config, im invite.Manager, pa ocmprovider.Authorizer, dc *discovery.Client) {
 	h.gatewayAddr = c.GatewaySvc
+	h.ocmShareAddr = c.OCMShareProviderSvc
+	h.ocmSecret = c.OCMSecret
+	h.inviteManager = im
+	h.authorizer = pa
+	h.discovery = dc
 }
 
 func (h *sharesHandler) Handler() http.Handler {
@@ -70,7 +87,6 @@ func (h *sharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	log := appctx.GetLogger(ctx)
 
-	// TODO (ishank011): Check if the user is allowed to share the file once the invitation workflow has been implemented.
 	// TODO (ishank011): Also check if the provider is authorized or not.
 	gatewayClient, err := pool.GetGatewayServiceClient(h.gatewayAddr)
 	if err != nil {
@@ -91,18 +107,25 @@ func (h *sharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userRes, err := gatewayClient.GetUser(ctx, &userpb.GetUserRequest{
-		UserId: &userpb.UserId{OpaqueId: shareWith},
-	})
-
-	if err != nil {
-		WriteError(w, r, APIErrorInvalidParameter, "error searching recipient", err)
-		return
-	}
+	// remote users that accepted an invitation take precedence over local ones
+	granteeID := &userpb.UserId{Idp: r.FormValue("shareWithProvider"), OpaqueId: shareWith}
+	if remoteUser, err := h.inviteManager.GetRemoteUser(ctx, granteeID); err == nil {
+		granteeID = remoteUser.Id
+	} else {
+		userRes, err := gatewayClient.GetUser(ctx, &userpb.GetUserRequest{
+			UserId: &userpb.UserId{OpaqueId: shareWith},
+		})
+
+		if err != nil {
+			WriteError(w, r, APIErrorInvalidParameter, "error searching recipient", err)
+			return
+		}
 
-	if userRes.Status.Code != rpc.Code_CODE_OK {
-		WriteError(w, r, APIErrorNotFound, "user not found", err)
-		return
+		if userRes.Status.Code != rpc.Code_CODE_OK {
+			WriteError(w, r, APIErrorNotFound, "user not found", err)
+			return
+		}
+		granteeID = userRes.User.GetId()
 	}
 
 	var permissions conversions.Permissions
@@ -178,7 +201,7 @@ func (h *sharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 		Grant: &ocm.ShareGrant{
 			Grantee: &provider.Grantee{
 				Type: provider.GranteeType_GRANTEE_TYPE_USER,
-				Id:   userRes.User.GetId(),
+				Id:   granteeID,
 			},
 			Permissions: &ocm.SharePermissions{
 				Permissions: resourcePermissions,
@@ -203,6 +226,143 @@ func (h *sharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 	log.Info().Msg("Share created.")
 }
 
+// incomingShare is the body of the requests of the remote providers sharing
+// a resource with a user of this provider.
+type incomingShare struct {
+	ShareWith    string `json:"shareWith"`
+	Name         string `json:"name"`
+	ProviderID   string `json:"providerId"`
+	Owner        string `json:"owner"`
+	Sender       string `json:"sender"`
+	ShareType    string `json:"shareType"`
+	ResourceType string `json:"resourceType"`
+	Protocol     struct {
+		Name   string `json:"name"`
+		WebDAV struct {
+			URI          string   `json:"uri"`
+			SharedSecret string   `json:"sharedSecret"`
+			Permissions  []string `json:"permissions"`
+		} `json:"webdav"`
+	} `json:"protocol"`
+}
+
+// splitUser splits a federated user id of the form user@domain.
+func splitUser(s string) *userpb.UserId {
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		return &userpb.UserId{OpaqueId: s[:i], Idp: s[i+1:]}
+	}
+	return &userpb.UserId{OpaqueId: s}
+}
+
+// receiveShare is called by the remote providers, already authorized by the
+// providerauthorizer middleware, to share a resource with a user of this
+// provider. The resource is accessed with the shared secret on the webdav
+// endpoint of the remote provider, which must be served by its domain like
+// the owner of the share must belong to it.
+func (h *sharesHandler) receiveShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	in := &incomingShare{}
+	if err := json.NewDecoder(r.Body).Decode(in); err != nil {
+		WriteError(w, r, APIErrorInvalidParameter, "invalid share", err)
+		return
+	}
+	webdav := in.Protocol.WebDAV
+	if in.ShareWith == "" || in.Name == "" || in.ProviderID == "" || in.Owner == "" {
+		WriteError(w, r, APIErrorInvalidParameter, "shareWith, name, providerId and owner are required", nil)
+		return
+	}
+	if webdav.URI == "" || webdav.SharedSecret == "" {
+		WriteError(w, r, APIErrorUnimplemented, "only the webdav protocol with uri and sharedSecret is supported", nil)
+		return
+	}
+
+	role := conversions.RoleViewer
+	for _, p := range webdav.Permissions {
+		if p == "write" {
+			role = conversions.RoleEditor
+		}
+	}
+	permissions, err := h.role2CS3Permissions(role)
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "unknown role", err)
+		return
+	}
+
+	domain, ok := ocmprovider.ContextGetDomain(ctx)
+	if !ok {
+		WriteError(w, r, APIErrorUnauthenticated, "the remote provider was not authorized", nil)
+		return
+	}
+	owner := splitUser(in.Owner)
+	if !strings.EqualFold(owner.Idp, domain) {
+		WriteError(w, r, APIErrorUntrustedService, "the owner does not belong to the provider: "+domain, nil)
+		return
+	}
+	if !inDomain(webdav.URI, domain) {
+		WriteError(w, r, APIErrorUntrustedService, "the webdav endpoint is outside the domain of the provider: "+domain, nil)
+		return
+	}
+
+	// the sender is notified when the share is accepted or declined
+	var ocmEndpoint string
+	if p, err := remoteProvider(ctx, h.authorizer, h.discovery, owner.Idp); err == nil {
+		ocmEndpoint = p.Document.Endpoint
+	} else {
+		log.Warn().Err(err).Str("domain", owner.Idp).Msg("error discovering the ocm endpoint of the sender, it will not be notified")
+	}
+	remote := &share.RemoteShare{
+		Name:           path.Base(path.Join("/", in.Name)),
+		WebDAVEndpoint: webdav.URI,
+		Token:          webdav.SharedSecret,
+		OCMEndpoint:    ocmEndpoint,
+	}
+
+	client, err := pool.GetOCMReceivedShareClient(h.ocmShareAddr, h.ocmSecret)
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, fmt.Sprintf("error getting ocm share grpc client on addr: %v", h.ocmShareAddr), err)
+		return
+	}
+
+	// the grantee is a user of this provider, whatever the domain given
+	grantee := &userpb.UserId{OpaqueId: splitUser(in.ShareWith).OpaqueId}
+	res, err := client.AddReceivedShare(ctx, &received.AddReceivedShareRequest{
+		Share: &ocm.Share{
+			ResourceId: &provider.ResourceId{StorageId: owner.Idp, OpaqueId: in.ProviderID},
+			Grantee: &provider.Grantee{
+				Type: provider.GranteeType_GRANTEE_TYPE_USER,
+				Id:   grantee,
+			},
+			Permissions: &ocm.SharePermissions{
+				Permissions: permissions,
+			},
+			Owner: owner,
+		},
+		Remote: remote,
+	})
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "error sending a grpc add received share request", err)
+		return
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_INVALID_ARGUMENT, rpc.Code_CODE_ALREADY_EXISTS:
+		WriteError(w, r, APIErrorInvalidParameter, res.Status.Message, nil)
+		return
+	default:
+		WriteError(w, r, APIErrorServerError, "grpc add received share request failed", errors.New(res.Status.Message))
+		return
+	}
+
+	log.Info().Str("share", res.Share.Id.OpaqueId).Str("owner", in.Owner).Msg("share received")
+	w.WriteHeader(http.StatusCreated)
+}
+
 func (h *sharesHandler) getShare(w http.ResponseWriter, r *http.Request, shareID string) {
 
 	// TODO Implement response with HAL schemating
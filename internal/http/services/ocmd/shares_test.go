@@ -0,0 +1,60 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ocmprovider "github.com/cs3org/reva/pkg/ocm/provider"
+)
+
+func TestReceiveShareDomain(t *testing.T) {
+	h := &sharesHandler{}
+	body := func(owner, uri string) string {
+		return `{"shareWith": "einstein", "name": "data", "providerId": "42", "owner": "` + owner + `",
+			"protocol": {"name": "webdav", "webdav": {"uri": "` + uri + `", "sharedSecret": "token"}}}`
+	}
+
+	tests := []struct {
+		name   string
+		domain string
+		body   string
+		code   int
+	}{
+		{"not authorized", "", body("marie@cern.ch", "https://cern.ch/webdav"), http.StatusUnauthorized},
+		{"owner of another provider", "cern.ch", body("marie@example.org", "https://cern.ch/webdav"), http.StatusForbidden},
+		{"endpoint of another host", "cern.ch", body("marie@cern.ch", "https://10.0.0.1/webdav"), http.StatusForbidden},
+		{"endpoint over http", "cern.ch", body("marie@cern.ch", "http://cern.ch/webdav"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/remote-shares", strings.NewReader(tt.body))
+		if tt.domain != "" {
+			r = r.WithContext(ocmprovider.ContextSetDomain(context.Background(), tt.domain))
+		}
+		w := httptest.NewRecorder()
+		h.receiveShare(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocmd
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/ocm/provider/lookup"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+)
+
+// maxLookupResults caps the users returned to the remote providers.
+const maxLookupResults = 50
+
+// findUsers is called by the remote providers, already authorized by the
+// providerauthorizer middleware, to suggest the users of this provider as
+// recipients of their shares.
+func (s *svc) findUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !s.Conf.ExposeUsers {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	ctx := r.Context()
+
+	search := strings.TrimSpace(r.FormValue("search"))
+	if len(search) < lookup.MinSearchLength {
+		WriteError(w, r, APIErrorInvalidParameter, "search must have at least "+strconv.Itoa(lookup.MinSearchLength)+" characters", nil)
+		return
+	}
+	limit := maxLookupResults
+	if l := r.FormValue("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			WriteError(w, r, APIErrorInvalidParameter, "invalid limit", nil)
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+
+	gatewayClient, err := pool.GetGatewayServiceClient(s.Conf.GatewaySvc)
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "error getting gateway client", err)
+		return
+	}
+	res, err := gatewayClient.FindUsers(ctx, &userpb.FindUsersRequest{Filter: search})
+	if err != nil {
+		WriteError(w, r, APIErrorServerError, "error searching users", err)
+		return
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		WriteError(w, r, APIErrorServerError, "error searching users: "+res.Status.Message, nil)
+		return
+	}
+
+	users := []*lookup.User{}
+	for _, u := range res.Users {
+		if len(users) == limit {
+			break
+		}
+		users = append(users, &lookup.User{ID: u.Id.OpaqueId, DisplayName: u.DisplayName})
+	}
+	writeJSON(w, r, users)
+}
@@ -0,0 +1,119 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocmprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/mitchellh/mapstructure"
+)
+
+func init() {
+	global.Register("ocmprovider", New)
+}
+
+type config struct {
+	Prefix string `mapstructure:"prefix"`
+	// OCMPrefix is where the ocmd service is exposed.
+	OCMPrefix  string `mapstructure:"ocm_prefix"`
+	Host       string `mapstructure:"host"`
+	Provider   string `mapstructure:"provider"`
+	Endpoint   string `mapstructure:"endpoint"`
+	WebDAVRoot string `mapstructure:"webdav_root"`
+	APIVersion string `mapstructure:"api_version"`
+}
+
+func (c *config) init() {
+	if c.Prefix == "" {
+		c.Prefix = "ocm-provider"
+	}
+	if c.OCMPrefix == "" {
+		c.OCMPrefix = "ocm"
+	}
+	if c.Host == "" {
+		c.Host = "localhost"
+	}
+	if c.Provider == "" {
+		c.Provider = "cernbox"
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = fmt.Sprintf("https://%s/%s", c.Host, strings.Trim(c.OCMPrefix, "/"))
+	}
+	if c.WebDAVRoot == "" {
+		c.WebDAVRoot = fmt.Sprintf("/%s/ocm_webdav", c.Provider)
+	}
+}
+
+type svc struct {
+	conf *config
+	doc  []byte
+}
+
+// New returns a service serving the OCM discovery document at the root of
+// the provider, where the remote providers look for it.
+func New(m map[string]interface{}) (global.Service, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	c.init()
+
+	d := discovery.NewDocument(c.Host, c.Provider, c.Endpoint, c.WebDAVRoot)
+	if c.APIVersion != "" {
+		d.APIVersion = c.APIVersion
+	}
+	doc, err := json.MarshalIndent(d, "", "   ")
+	if err != nil {
+		return nil, err
+	}
+	return &svc{conf: c, doc: doc}, nil
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Unprotected() []string {
+	return []string{"/"}
+}
+
+func (s *svc) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(s.doc); err != nil {
+			appctx.GetLogger(r.Context()).Err(err).Msg("error writing response")
+		}
+	})
+}
@@ -20,11 +20,14 @@ package oidcprovider
 
 import (
 	"fmt"
+	"html"
 	"net/http"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/mfa"
 	"github.com/cs3org/reva/pkg/rgrpc/status"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 )
@@ -58,25 +61,12 @@ func (s *svc) doAuth(w http.ResponseWriter, r *http.Request) {
 
 	username := r.PostForm.Get("username")
 	password := r.PostForm.Get("password")
+	code := r.PostForm.Get("code")
 
 	// If no username is set we send to the user an HTML form fill.
 	// MVC is dead, long live MCV.
 	if username == "" {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_, err := w.Write([]byte(fmt.Sprintf(`
-			<h1>Login page</h1>
-			<p>Howdy! This is the log in page. For this example, it is enough to supply the username.</p>
-			<form method="post">
-				<p>
-					By logging in, you consent to grant these scopes:
-					<ul>%s</ul>
-				</p>
-				<input type="text" name="username" placeholder="Username" autofocus="autofocus"/><br>
-				<input type="password" name="password" placeholder="Password"/><br>
-				<input type="submit">
-			</form>
-		`, requestedScopes)))
-		if err != nil {
+		if err := writeLoginForm(w, requestedScopes, "", ""); err != nil {
 			log.Error().Err(err).Msg("Error writing response")
 			s.oauth2.WriteAuthorizeError(w, ar, err)
 		}
@@ -96,6 +86,11 @@ func (s *svc) doAuth(w http.ResponseWriter, r *http.Request) {
 		ClientId:     username,
 		ClientSecret: password,
 	}
+	if code != "" {
+		authReq.Opaque = &types.Opaque{Map: map[string]*types.OpaqueEntry{
+			mfa.OpaqueKey: {Decoder: "plain", Value: []byte(code)},
+		}}
+	}
 	authRes, err := c.Authenticate(ctx, authReq)
 	if err != nil {
 		log.Err(err).Msg("error calling Authenticate")
@@ -103,6 +98,16 @@ func (s *svc) doAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the user enrolled a second factor, ask for the code along with the
+	// password again
+	if string(authRes.Opaque.GetMap()[mfa.OpaqueKey].GetValue()) == "required" {
+		if err := writeLoginForm(w, requestedScopes, username, "Enter the code of your authenticator app."); err != nil {
+			log.Error().Err(err).Msg("Error writing response")
+			s.oauth2.WriteAuthorizeError(w, ar, err)
+		}
+		return
+	}
+
 	if authRes.Status.Code != rpc.Code_CODE_OK {
 		err := status.NewErrorFromCode(authRes.Status.Code, "oidcprovider")
 		log.Err(err).Msg("error authenticating client credentials")
@@ -182,3 +187,28 @@ func (s *svc) doAuth(w http.ResponseWriter, r *http.Request) {
 	// Last but not least, send the response!
 	s.oauth2.WriteAuthorizeResponse(w, ar, response)
 }
+
+// writeLoginForm writes the login page, the code of the second factor is
+// only needed by the users who enrolled one.
+func writeLoginForm(w http.ResponseWriter, requestedScopes, username, message string) error {
+	if message != "" {
+		message = "<p>" + html.EscapeString(message) + "</p>"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := w.Write([]byte(fmt.Sprintf(`
+			<h1>Login page</h1>
+			<p>Howdy! This is the log in page. For this example, it is enough to supply the username.</p>
+			%s
+			<form method="post">
+				<p>
+					By logging in, you consent to grant these scopes:
+					<ul>%s</ul>
+				</p>
+				<input type="text" name="username" placeholder="Username" value="%s" autofocus="autofocus"/><br>
+				<input type="password" name="password" placeholder="Password"/><br>
+				<input type="text" name="code" placeholder="Authentication code" autocomplete="one-time-code"/><br>
+				<input type="submit">
+			</form>
+		`, message, requestedScopes, html.EscapeString(username))))
+	return err
+}
@@ -21,16 +21,22 @@ package ocdav
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"sync"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/maintenance"
 	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+	"github.com/cs3org/reva/pkg/storage/jobs"
 )
 
 func (s *svc) handleCopy(w http.ResponseWriter, r *http.Request, ns string) {
@@ -43,7 +49,7 @@ func (s *svc) handleCopy(w http.ResponseWriter, r *http.Request, ns string) {
 	log.Info().Str("source", src).Str("destination", dstHeader).Str("overwrite", overwrite).Msg("copy")
 
 	if dstHeader == "" {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid Destination header")
 		return
 	}
 
@@ -53,7 +59,7 @@ func (s *svc) handleCopy(w http.ResponseWriter, r *http.Request, ns string) {
 	}
 
 	if overwrite != "T" && overwrite != "F" {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid Overwrite header")
 		return
 	}
 
@@ -67,7 +73,7 @@ func (s *svc) handleCopy(w http.ResponseWriter, r *http.Request, ns string) {
 	// strip baseURL from destination
 	dstURL, err := url.ParseRequestURI(dstHeader)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid Destination header")
 		return
 	}
 
@@ -77,7 +83,7 @@ func (s *svc) handleCopy(w http.ResponseWriter, r *http.Request, ns string) {
 	// TODO replace with HasPrefix:
 	i := strings.Index(urlPath, baseURI)
 	if i == -1 {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid Destination header")
 		return
 	}
 
@@ -93,184 +99,331 @@ func (s *svc) handleCopy(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
-	if srcStatRes.Status.Code != rpc.Code_CODE_OK {
-		if srcStatRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
+	if handleUnavailable(w, srcStatRes.Status, srcStatRes.Opaque) {
+		return
+	}
+
+	switch srcStatRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		writeError(w, r, http.StatusNotFound, "Resource not found")
+		return
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		writeError(w, r, http.StatusForbidden, "Copying the resource is not allowed")
+		return
+	default:
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	if !permitted(srcStatRes.Info, canCopy) {
+		writeError(w, r, http.StatusForbidden, "Copying the resource is not allowed")
+		return
+	}
+
 	// TODO check if path is on same storage, return 502 on problems, see https://tools.ietf.org/html/rfc4918#section-9.9.4
 	// prefix to namespace
 	dst := path.Join(ns, urlPath[len(baseURI):])
 
-	// check dst exists
-	ref = &provider.Reference{
-		Spec: &provider.Reference_Path{Path: dst},
+	if !s.checkLocks(w, r, dst, true) {
+		return
 	}
-	dstStatReq := &provider.StatRequest{Ref: ref}
-	dstStatRes, err := client.Stat(ctx, dstStatReq)
+
+	successCode := s.checkDestination(w, r, client, srcStatRes.Info, dst, overwrite, canWrite)
+	if successCode == 0 {
+		return
+	}
+
+	locked, err := lockOpaque(r, nil)
 	if err != nil {
-		log.Error().Err(err).Msg("error sending grpc stat request")
+		log.Error().Err(err).Msg("error encoding lock tokens")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	var successCode int
-	if dstStatRes.Status.Code == rpc.Code_CODE_OK {
-		successCode = http.StatusNoContent // 204 if target already existed, see https://tools.ietf.org/html/rfc4918#section-9.8.5
-
-		if overwrite == "F" {
-			log.Warn().Str("dst", dst).Msg("dst already exists")
-			w.WriteHeader(http.StatusPreconditionFailed) // 412, see https://tools.ietf.org/html/rfc4918#section-9.8.5
-			return
-		}
-
-	} else {
-		successCode = http.StatusCreated // 201 if new resource was created, see https://tools.ietf.org/html/rfc4918#section-9.8.5
-
-		// check if an intermediate path / the parent exists
-		intermediateDir := path.Dir(dst)
-		ref = &provider.Reference{
-			Spec: &provider.Reference_Path{Path: intermediateDir},
-		}
-		intStatReq := &provider.StatRequest{Ref: ref}
-		intStatRes, err := client.Stat(ctx, intStatReq)
-		if err != nil {
-			log.Error().Err(err).Msg("error sending grpc stat request")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		if intStatRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
-			w.WriteHeader(http.StatusConflict) // 409 if intermediate dir is missing, see https://tools.ietf.org/html/rfc4918#section-9.8.5
-			return
+	job := func(ctx context.Context, j *jobs.Job) error {
+		if err := s.descend(ctx, client, srcStatRes.Info, dst, locked, j.Progress); err != nil {
+			return err
 		}
-		// TODO what if intermediate is a file?
+		return setJobResult(ctx, client, j, dst)
+	}
+	if lazyOps(r) && s.startJob(w, r, int64(srcStatRes.Info.Size), job) {
+		return
 	}
 
-	err = descend(ctx, client, srcStatRes.Info, dst)
+	err = s.descend(ctx, client, srcStatRes.Info, dst, locked, nil)
+	if err == errForbidden {
+		writeError(w, r, http.StatusForbidden, "Copying the resource is not allowed")
+		return
+	}
+	if e, ok := err.(*unavailableError); ok {
+		writeUnavailable(w, e.retryAfter)
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("error descending directory")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	setFileIDHeaders(ctx, client, w, dst)
 	w.WriteHeader(successCode)
 }
 
-func descend(ctx context.Context, client gateway.GatewayAPIClient, src *provider.ResourceInfo, dst string) error {
-	log := appctx.GetLogger(ctx)
-	log.Debug().Str("src", src.Path).Str("dst", dst).Msg("descending")
-	if src.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
-		// create dir
-		createReq := &provider.CreateContainerRequest{
-			Ref: &provider.Reference{
-				Spec: &provider.Reference_Path{Path: dst},
-			},
-		}
-		createRes, err := client.CreateContainer(ctx, createReq)
-		if err != nil || createRes.Status.Code != rpc.Code_CODE_OK {
-			return err
-		}
+// descend copies src to dst, reporting the bytes copied to progress if not nil.
+// The folders are created first, parents before children, then the files are
+// copied by CopyWorkers concurrent transfers. The first failure stops the copy.
+// The changes carry the opaque data locked, with the lock tokens of the request.
+func (s *svc) descend(ctx context.Context, client gateway.GatewayAPIClient, src *provider.ResourceInfo, dst string, locked *types.Opaque, progress func(int64)) error {
+	if progress == nil {
+		progress = func(int64) {}
+	}
 
-		// descend for children
-		listReq := &provider.ListContainerRequest{
-			Ref: &provider.Reference{
-				Spec: &provider.Reference_Path{Path: src.Path},
-			},
-		}
-		res, err := client.ListContainer(ctx, listReq)
-		if err != nil {
-			return err
-		}
-		if res.Status.Code != rpc.Code_CODE_OK {
-			return fmt.Errorf("status code %d", res.Status.Code)
-		}
+	var files []*fileCopy
+	if err := walkCopy(ctx, client, src, dst, locked, &files); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
 
-		for i := range res.Infos {
-			childDst := path.Join(dst, path.Base(res.Infos[i].Path))
-			err := descend(ctx, client, res.Infos[i], childDst)
-			if err != nil {
-				return err
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := s.c.CopyWorkers
+	if workers > len(files) {
+		workers = len(files)
+	}
+	todo := make(chan *fileCopy)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for f := range todo {
+				if err := copyFile(ctx, client, f.src, f.dst, locked, progress); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
 			}
+		}()
+	}
+
+feed:
+	for _, f := range files {
+		select {
+		case todo <- f:
+		case <-ctx.Done():
+			break feed
 		}
+	}
+	close(todo)
+	wg.Wait()
+	close(errs)
 
-	} else {
-		// copy file
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
 
-		// 1. get download url
-		dReq := &provider.InitiateFileDownloadRequest{
-			Ref: &provider.Reference{
-				Spec: &provider.Reference_Path{Path: src.Path},
-			},
-		}
+// fileCopy is a file to copy to dst.
+type fileCopy struct {
+	src *provider.ResourceInfo
+	dst string
+}
 
-		dRes, err := client.InitiateFileDownload(ctx, dReq)
-		if err != nil {
-			return err
-		}
+// walkCopy creates the folders of the tree of src at dst and collects the
+// files to copy.
+func walkCopy(ctx context.Context, client gateway.GatewayAPIClient, src *provider.ResourceInfo, dst string, locked *types.Opaque, files *[]*fileCopy) error {
+	log := appctx.GetLogger(ctx)
+	log.Debug().Str("src", src.Path).Str("dst", dst).Msg("descending")
 
-		if dRes.Status.Code != rpc.Code_CODE_OK {
-			return fmt.Errorf("status code %d", dRes.Status.Code)
-		}
+	if src.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		*files = append(*files, &fileCopy{src: src, dst: dst})
+		return nil
+	}
 
-		// 2. get upload url
+	createRes, err := client.CreateContainer(ctx, &provider.CreateContainerRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: dst},
+		},
+		Opaque: locked,
+	})
+	if err != nil {
+		return err
+	}
+	switch createRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_UNAVAILABLE:
+		return &unavailableError{retryAfter: maintenance.RetryAfterFromOpaque(createRes.Opaque)}
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return errForbidden
+	default:
+		return fmt.Errorf("status code %d", createRes.Status.Code)
+	}
 
-		uReq := &provider.InitiateFileUploadRequest{
-			Ref: &provider.Reference{
-				Spec: &provider.Reference_Path{Path: dst},
-			},
-		}
+	res, err := client.ListContainer(ctx, &provider.ListContainerRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: src.Path},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return errForbidden
+	default:
+		return fmt.Errorf("status code %d", res.Status.Code)
+	}
 
-		uRes, err := client.InitiateFileUpload(ctx, uReq)
-		if err != nil {
+	for _, child := range res.Infos {
+		if err := walkCopy(ctx, client, child, path.Join(dst, path.Base(child.Path)), locked, files); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		if uRes.Status.Code != rpc.Code_CODE_OK {
-			return fmt.Errorf("status code %d", uRes.Status.Code)
-		}
+// copyFile copies the content of the file src to dst. When both transfers go
+// through the same data gateway it copies the content from data server to
+// data server, else it streams it through ocdav. The checksum of the source,
+// if known, is verified by the target.
+func copyFile(ctx context.Context, client gateway.GatewayAPIClient, src *provider.ResourceInfo, dst string, locked *types.Opaque, progress func(int64)) error {
+	dRes, err := client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: src.Path},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	switch dRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return errForbidden
+	default:
+		return fmt.Errorf("status code %d", dRes.Status.Code)
+	}
 
-		// 3. do download
+	uRes, err := client.InitiateFileUpload(ctx, &provider.InitiateFileUploadRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: dst},
+		},
+		Opaque: locked,
+	})
+	if err != nil {
+		return err
+	}
+	switch uRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_UNAVAILABLE:
+		return &unavailableError{retryAfter: maintenance.RetryAfterFromOpaque(uRes.Opaque)}
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return errForbidden
+	default:
+		return fmt.Errorf("status code %d", uRes.Status.Code)
+	}
 
-		httpDownloadReq, err := rhttp.NewRequest(ctx, "GET", dRes.DownloadEndpoint, nil)
-		if err != nil {
-			return err
-		}
+	// large files take longer than the default timeout to transfer,
+	// the transfer is bounded by ctx
+	httpClient := *rhttp.GetHTTPClient(ctx)
+	httpClient.Timeout = 0
 
-		httpDownloadClient := rhttp.GetHTTPClient(ctx)
+	checksum := checksums.FromResourceInfo(src)
 
-		httpDownloadRes, err := httpDownloadClient.Do(httpDownloadReq)
+	if sameEndpoint(dRes.DownloadEndpoint, uRes.UploadEndpoint) {
+		copyReq, err := rhttp.NewRequest(ctx, "COPY", uRes.UploadEndpoint, nil)
 		if err != nil {
 			return err
 		}
-		defer httpDownloadRes.Body.Close()
-
-		if httpDownloadRes.StatusCode != http.StatusOK {
-			return fmt.Errorf("status code %d", httpDownloadRes.StatusCode)
+		copyReq.Header.Set("X-Reva-Transfer", uRes.Token)
+		copyReq.Header.Set("X-Reva-Copy-Source", dRes.Token)
+		if checksum != "" {
+			copyReq.Header.Set("OC-Checksum", checksum)
 		}
-
-		// do upload
-		// TODO(jfd): check if large files are really streamed
-
-		httpUploadReq, err := rhttp.NewRequest(ctx, "PUT", uRes.UploadEndpoint, httpDownloadRes.Body)
+		copyRes, err := httpClient.Do(copyReq)
 		if err != nil {
 			return err
 		}
+		copyRes.Body.Close()
+		switch copyRes.StatusCode {
+		case http.StatusOK:
+			progress(int64(src.Size))
+			return nil
+		case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+			// the data gateway does not copy, stream the content
+		default:
+			return fmt.Errorf("status code %d", copyRes.StatusCode)
+		}
+	}
 
-		httpUploadClient := rhttp.GetHTTPClient(ctx)
+	httpDownloadReq, err := rhttp.NewRequest(ctx, "GET", dRes.DownloadEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	httpDownloadReq.Header.Set("X-Reva-Transfer", dRes.Token)
 
-		httpRes, err := httpUploadClient.Do(httpUploadReq)
-		if err != nil {
-			return err
-		}
-		defer httpRes.Body.Close()
+	httpDownloadRes, err := httpClient.Do(httpDownloadReq)
+	if err != nil {
+		return err
+	}
+	defer httpDownloadRes.Body.Close()
 
-		if httpRes.StatusCode != http.StatusOK {
-			return fmt.Errorf("status code %d", httpDownloadRes.StatusCode)
-		}
+	if httpDownloadRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d", httpDownloadRes.StatusCode)
+	}
 
+	var body io.Reader = &progressReader{r: httpDownloadRes.Body, progress: progress}
+	if src.Size == 0 {
+		body = http.NoBody
+	}
+	httpUploadReq, err := rhttp.NewRequest(ctx, "PUT", uRes.UploadEndpoint, body)
+	if err != nil {
+		return err
+	}
+	httpUploadReq.ContentLength = int64(src.Size)
+	httpUploadReq.Header.Set("X-Reva-Transfer", uRes.Token)
+	if checksum != "" {
+		httpUploadReq.Header.Set("OC-Checksum", checksum)
+	}
+
+	httpRes, err := httpClient.Do(httpUploadReq)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d", httpRes.StatusCode)
 	}
 	return nil
 }
+
+// sameEndpoint tells whether the transfers go through the same data gateway.
+func sameEndpoint(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host && path.Clean(ua.Path) == path.Clean(ub.Path)
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	r        io.Reader
+	progress func(int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.progress(int64(n))
+	return n, err
+}
@@ -33,6 +33,7 @@ type DavHandler struct {
 	MetaHandler        *MetaHandler
 	TrashbinHandler    *TrashbinHandler
 	PublicFilesHandler *PublicFilesHandler
+	UploadsHandler     *UploadsHandler
 }
 
 func (h *DavHandler) init(c *Config) error {
@@ -52,6 +53,11 @@ func (h *DavHandler) init(c *Config) error {
 
 	h.PublicFilesHandler = &PublicFilesHandler{}
 
+	h.UploadsHandler = new(UploadsHandler)
+	if err := h.UploadsHandler.init(c); err != nil {
+		return err
+	}
+
 	return h.TrashbinHandler.init(c)
 }
 
@@ -85,8 +91,16 @@ func (h *DavHandler) Handler(s *svc) http.Handler {
 			ctx := context.WithValue(ctx, ctxKeyBaseURI, base)
 			r = r.WithContext(ctx)
 			h.TrashbinHandler.Handler(s).ServeHTTP(w, r)
+		case "uploads":
+			// to build correct href prop urls we need to keep track of the base path
+			base := path.Join(ctx.Value(ctxKeyBaseURI).(string), "uploads")
+			ctx := context.WithValue(ctx, ctxKeyBaseURI, base)
+			r = r.WithContext(ctx)
+			h.UploadsHandler.Handler(s).ServeHTTP(w, r)
 		case "public-files":
 			h.PublicFilesHandler.Handler(s).ServeHTTP(w, r)
+		case "job-status":
+			s.handleJobStatus(w, r)
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
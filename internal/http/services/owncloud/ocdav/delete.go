@@ -32,6 +32,10 @@ func (s *svc) handleDelete(w http.ResponseWriter, r *http.Request, ns string) {
 	log := appctx.GetLogger(ctx)
 	fn := path.Join(ns, r.URL.Path)
 
+	if !s.checkLocks(w, r, fn, true) {
+		return
+	}
+
 	client, err := s.getClient()
 	if err != nil {
 		log.Error().Err(err).Msg("error getting grpc client")
@@ -42,7 +46,16 @@ func (s *svc) handleDelete(w http.ResponseWriter, r *http.Request, ns string) {
 	ref := &provider.Reference{
 		Spec: &provider.Reference_Path{Path: fn},
 	}
-	req := &provider.DeleteRequest{Ref: ref}
+	opaque, err := preconditionsOpaque(r)
+	if err == nil {
+		opaque, err = lockOpaque(r, opaque)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("error encoding preconditions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	req := &provider.DeleteRequest{Ref: ref, Opaque: opaque}
 	res, err := client.Delete(ctx, req)
 	if err != nil {
 		log.Error().Err(err).Msg("error performing delete grpc request")
@@ -50,9 +63,19 @@ func (s *svc) handleDelete(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
+	if handleUnavailable(w, res.Status, res.Opaque) {
+		return
+	}
+
 	if res.Status.Code == rpc.Code_CODE_NOT_FOUND {
 		log.Warn().Str("code", string(res.Status.Code)).Msg("resource not found")
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	if res.Status.Code == rpc.Code_CODE_FAILED_PRECONDITION {
+		log.Warn().Str("code", string(res.Status.Code)).Msg("precondition failed")
+		writeError(w, r, http.StatusPreconditionFailed, "Precondition failed")
 		return
 	}
 
@@ -0,0 +1,76 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/i18n"
+)
+
+// exceptionXML is the error body of sabre/dav, which the clients show to
+// the users.
+type exceptionXML struct {
+	XMLName   xml.Name `xml:"d:error"`
+	XmlnsD    string   `xml:"xmlns:d,attr"`
+	XmlnsS    string   `xml:"xmlns:s,attr"`
+	Exception string   `xml:"s:exception"`
+	Message   string   `xml:"s:message"`
+}
+
+// exceptions are the sabre/dav exceptions raised for the status codes.
+var exceptions = map[int]string{
+	http.StatusBadRequest:           "Sabre\\DAV\\Exception\\BadRequest",
+	http.StatusForbidden:            "Sabre\\DAV\\Exception\\Forbidden",
+	http.StatusNotFound:             "Sabre\\DAV\\Exception\\NotFound",
+	http.StatusMethodNotAllowed:     "Sabre\\DAV\\Exception\\MethodNotAllowed",
+	http.StatusConflict:             "Sabre\\DAV\\Exception\\Conflict",
+	http.StatusPreconditionFailed:   "Sabre\\DAV\\Exception\\PreconditionFailed",
+	http.StatusUnsupportedMediaType: "Sabre\\DAV\\Exception\\UnsupportedMediaType",
+	http.StatusLocked:               "Sabre\\DAV\\Exception\\Locked",
+	http.StatusNotImplemented:       "Sabre\\DAV\\Exception\\NotImplemented",
+	http.StatusInsufficientStorage:  "Sabre\\DAV\\Exception\\InsufficientStorage",
+}
+
+// writeError answers the status code with the message, translated in the
+// language of the request, in a sabre/dav error body.
+func writeError(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	exception, ok := exceptions[code]
+	if !ok {
+		exception = "Sabre\\DAV\\Exception"
+	}
+	body, err := xml.Marshal(&exceptionXML{
+		XmlnsD:    "DAV:",
+		XmlnsS:    "http://sabredav.org/ns",
+		Exception: exception,
+		Message:   i18n.Translate(w, r, msg),
+	})
+	if err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("error encoding error body")
+		w.WriteHeader(code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(code)
+	if _, err := w.Write(append([]byte(xml.Header), body...)); err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("error writing error body")
+	}
+}
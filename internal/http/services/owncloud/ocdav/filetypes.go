@@ -0,0 +1,40 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"net/http"
+
+	"github.com/cs3org/reva/pkg/appctx"
+)
+
+// checkFileType answers 415 Unsupported Media Type and returns false if
+// the name of the file has a type refused by the policy. The content is
+// checked by the data servers.
+func (s *svc) checkFileType(w http.ResponseWriter, r *http.Request, fn string) bool {
+	if s.fileTypes == nil {
+		return true
+	}
+	if err := s.fileTypes.Check(fn, nil); err != nil {
+		appctx.GetLogger(r.Context()).Warn().Err(err).Str("path", fn).Msg("upload type refused")
+		writeError(w, r, http.StatusUnsupportedMediaType, "The file type is not allowed")
+		return false
+	}
+	return true
+}
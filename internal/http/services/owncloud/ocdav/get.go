@@ -22,6 +22,7 @@ import (
 	"io"
 	"net/http"
 	"path"
+	"strings"
 	"time"
 
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
@@ -55,6 +56,10 @@ func (s *svc) handleGet(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
+	if handleUnavailable(w, sRes.Status, sRes.Opaque) {
+		return
+	}
+
 	if sRes.Status.Code != rpc.Code_CODE_OK {
 		log.Warn().Str("code", string(sRes.Status.Code)).Msg("grpc request failed")
 		statusCode := http.StatusInternalServerError
@@ -85,6 +90,10 @@ func (s *svc) handleGet(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
+	if handleUnavailable(w, dRes.Status, dRes.Opaque) {
+		return
+	}
+
 	if dRes.Status.Code != rpc.Code_CODE_OK {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -100,6 +109,11 @@ func (s *svc) handleGet(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 	httpReq.Header.Set("X-Reva-Transfer", dRes.Token)
+	for _, h := range []string{"Range", "If-Range"} {
+		if v := r.Header.Get(h); v != "" {
+			httpReq.Header.Set(h, v)
+		}
+	}
 	httpClient := rhttp.GetHTTPClient(ctx)
 
 	httpRes, err := httpClient.Do(httpReq)
@@ -110,7 +124,13 @@ func (s *svc) handleGet(w http.ResponseWriter, r *http.Request, ns string) {
 	}
 	defer httpRes.Body.Close()
 
-	if httpRes.StatusCode != http.StatusOK {
+	switch httpRes.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		w.Header().Set("Content-Range", httpRes.Header.Get("Content-Range"))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	default:
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -122,11 +142,16 @@ func (s *svc) handleGet(w http.ResponseWriter, r *http.Request, ns string) {
 	t := utils.TSToTime(info.Mtime)
 	lastModifiedString := t.Format(time.RFC1123)
 	w.Header().Set("Last-Modified", lastModifiedString)
-	/*
-		if md.Checksum != "" {
-			w.Header().Set("OC-Checksum", md.Checksum)
+	if xs := checksumsProp(info); xs != "" {
+		// clients only expect a single checksum in the header
+		w.Header().Set("OC-Checksum", strings.Fields(xs)[0])
+	}
+	for _, h := range []string{"Accept-Ranges", "Content-Range", "Content-Length"} {
+		if v := httpRes.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
 		}
-	*/
+	}
+	w.WriteHeader(httpRes.StatusCode)
 	if _, err := io.Copy(w, httpRes.Body); err != nil {
 		log.Error().Err(err).Msg("error finishing copying data to response")
 	}
@@ -52,6 +52,10 @@ func (s *svc) handleHead(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
+	if handleUnavailable(w, res.Status, res.Opaque) {
+		return
+	}
+
 	if res.Status.Code != rpc.Code_CODE_OK {
 		log.Error().Msgf("error calling grpc: %s", res.Status.String())
 		w.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,81 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/storage/chunking"
+	"github.com/pkg/errors"
+)
+
+// purgeChunks removes the chunks of the uploads abandoned before they were
+// complete, both the chunking NG uploads of the chunk store and the folders
+// of the old chunking protocol in the chunk folder.
+func (s *svc) purgeChunks(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+	var purged []string
+	if p, ok := s.davHandler.UploadsHandler.store.(chunking.Purger); ok {
+		ids, err := p.PurgeUploads(ctx, before, dryRun)
+		purged = append(purged, ids...)
+		if err != nil {
+			return purged, err
+		}
+	}
+
+	// the chunk folder defaults to the system temp folder, only the folders
+	// of the chunked uploads are looked at
+	infos, err := ioutil.ReadDir(s.c.ChunkFolder)
+	if err != nil {
+		return purged, errors.Wrap(err, "ocdav: error listing chunk folder")
+	}
+	for _, fi := range infos {
+		if !fi.IsDir() || !strings.HasPrefix(fi.Name(), "chunking-") {
+			continue
+		}
+		dir := filepath.Join(s.c.ChunkFolder, fi.Name())
+		if !lastWrite(dir, fi.ModTime()).Before(before) {
+			continue
+		}
+		purged = append(purged, fi.Name())
+		if dryRun {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return purged, errors.Wrap(err, "ocdav: error removing chunk folder "+fi.Name())
+		}
+	}
+	return purged, nil
+}
+
+// lastWrite returns the most recent modification time of the files in dir,
+// the time of the folder when it is more recent.
+func lastWrite(dir string, t time.Time) time.Time {
+	infos, _ := ioutil.ReadDir(dir)
+	for _, fi := range infos {
+		if fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return t
+}
@@ -0,0 +1,187 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/storage/jobs"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+// jobStatus is the state of an async operation, as polled by the ownCloud
+// clients at the OC-JobStatus-Location.
+type jobStatus struct {
+	Status       jobs.Status `json:"status"`
+	FileID       string      `json:"fileId,omitempty"`
+	ETag         string      `json:"ETag,omitempty"`
+	BytesDone    int64       `json:"bytesDone"`
+	BytesTotal   int64       `json:"bytesTotal"`
+	ErrorMessage string      `json:"errorMessage,omitempty"`
+}
+
+// lazyOps tells if the client accepts the operation to run in the
+// background, see the OC-LazyOps header of the ownCloud async operations.
+func lazyOps(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("OC-LazyOps"), "true")
+}
+
+// jobReportInterval is how often the progress of the jobs is reported to
+// the job manager.
+const jobReportInterval = 2 * time.Second
+
+// startJob runs the operation in the background and answers 202 with the
+// location the client polls for its status. The job is tracked by the job
+// manager behind the gateway, so that any ocdav instance answers the polls.
+// It returns false, without writing the response, if no job manager is
+// configured and the operation has to run synchronously.
+func (s *svc) startJob(w http.ResponseWriter, r *http.Request, total int64, f jobs.Func) bool {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return true
+	}
+
+	client, err := pool.GetJobsClient(s.c.GatewaySvc)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting jobs client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	}
+	info, err := client.CreateJob(ctx, total)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotSupported); ok {
+			log.Debug().Msg("no job manager, running the operation synchronously")
+			return false
+		}
+		log.Error().Err(err).Msg("error creating job")
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	}
+
+	client.Run(ctx, info, jobReportInterval, f)
+	w.Header().Set("OC-JobStatus-Location", path.Join("/", s.c.Prefix, "remote.php/dav/job-status", u.Username, info.ID))
+	w.WriteHeader(http.StatusAccepted)
+	return true
+}
+
+// handleJobStatus returns the status of the job at job-status/{username}/{id},
+// DELETE cancels it.
+func (s *svc) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var username, id string
+	username, r.URL.Path = router.ShiftPath(r.URL.Path)
+	id, r.URL.Path = router.ShiftPath(r.URL.Path)
+	if username != u.Username {
+		log.Warn().Str("username", username).Msg("user tried to access the jobs of another user")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	client, err := pool.GetJobsClient(s.c.GatewaySvc)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting jobs client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var info *jobs.Info
+	switch r.Method {
+	case http.MethodGet:
+		info, err = client.GetJob(ctx, id)
+	case http.MethodDelete:
+		info, err = client.CancelJob(ctx, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Error().Err(err).Str("job", id).Msg("error calling the job manager")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	data, err := json.Marshal(&jobStatus{
+		Status:       info.Status,
+		FileID:       info.Result["fileId"],
+		ETag:         info.Result["ETag"],
+		BytesDone:    info.Done,
+		BytesTotal:   info.Total,
+		ErrorMessage: info.Error,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("error encoding job status")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.Error().Err(err).Msg("error writing response")
+	}
+}
+
+// setJobResult records the id and the etag of the resource created by the job.
+func setJobResult(ctx context.Context, client gateway.GatewayAPIClient, j *jobs.Job, dst string) error {
+	res, err := client.Stat(ctx, &provider.StatRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: dst},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return fmt.Errorf("status code %d", res.Status.Code)
+	}
+	j.SetResult("fileId", wrapResourceID(res.Info.Id))
+	j.SetResult("ETag", res.Info.Etag)
+	return nil
+}
@@ -19,33 +19,332 @@
 package ocdav
 
 import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/locks"
+	"github.com/cs3org/reva/pkg/storage/locks/registry"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 )
 
-// TODO(jfd) implement lock
+// newLockManager returns the configured lock manager.
+func newLockManager(c *Config) (locks.Manager, error) {
+	f, ok := registry.NewFuncs[c.LockManager]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not found for lock manager", c.LockManager)
+	}
+	return f(c.LockManagers[c.LockManager])
+}
+
+// http://www.webdav.org/specs/rfc4918.html#ELEMENT_lockinfo
+type lockInfo struct {
+	XMLName   xml.Name  `xml:"lockinfo"`
+	Exclusive *struct{} `xml:"lockscope>exclusive"`
+	Shared    *struct{} `xml:"lockscope>shared"`
+	Write     *struct{} `xml:"locktype>write"`
+	Owner     struct {
+		InnerXML string `xml:",innerxml"`
+	} `xml:"owner"`
+}
+
+// handleLock creates an exclusive write lock on the resource, or refreshes
+// the lock whose token is sent in the If header when the body is empty.
+// Locking an unmapped URL creates an empty file, see
+// http://www.webdav.org/specs/rfc4918.html#METHOD_LOCK
 func (s *svc) handleLock(w http.ResponseWriter, r *http.Request, ns string) {
-	log := appctx.GetLogger(r.Context())
-	xml := `<?xml version="1.0" encoding="utf-8"?>
-	<prop xmlns="DAV:">
-		<lockdiscovery>
-			<activelock>
-				<allprop/>
-				<timeout>Second-604800</timeout>
-				<depth>Infinity</depth>
-				<locktoken>
-				<href>opaquelocktoken:00000000-0000-0000-0000-000000000000</href>
-				</locktoken>
-			</activelock>
-		</lockdiscovery>
-	</prop>`
-
-	w.Header().Set("Content-Type", "text/xml; charset=\"utf-8\"")
-	w.Header().Set("Lock-Token",
-		"opaquelocktoken:00000000-0000-0000-0000-000000000000")
-	_, err := w.Write([]byte(xml))
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+	fn := path.Join(ns, r.URL.Path)
+
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	timeout, err := parseTimeout(r.Header.Get("Timeout"), s.c.MaxLockTimeout)
 	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid Timeout header")
+		return
+	}
+	expires := time.Now().Add(timeout)
+
+	var li lockInfo
+	if err := xml.NewDecoder(r.Body).Decode(&li); err != nil {
+		if err != io.EOF {
+			log.Debug().Err(err).Msg("error reading lockinfo")
+			writeError(w, r, http.StatusBadRequest, "Invalid lock request")
+			return
+		}
+
+		// refresh
+		tokens := ifTokens(r.Header.Get("If"))
+		if len(tokens) != 1 {
+			writeError(w, r, http.StatusBadRequest, "Invalid If header")
+			return
+		}
+		l, err := s.lockWithToken(ctx, fn, tokens[0])
+		if err == nil && l.UserID != locks.UserID(u.GetId()) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err == nil {
+			l, err = s.locks.Refresh(ctx, l.Token, expires)
+		}
+		if err != nil {
+			if _, ok := err.(errtypes.IsNotFound); ok {
+				writeError(w, r, http.StatusPreconditionFailed, "The lock does not exist")
+				return
+			}
+			log.Error().Err(err).Msg("error refreshing lock")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.writeLock(w, r, ns, l, http.StatusOK)
+		return
+	}
+
+	if li.Exclusive == nil || li.Write == nil {
+		// only exclusive write locks are supported
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	depth := r.Header.Get("Depth")
+	if depth != "" && depth != "0" && strings.ToLower(depth) != "infinity" {
+		writeError(w, r, http.StatusBadRequest, "Invalid Depth header")
+		return
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		log.Error().Err(err).Msg("error getting grpc client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ref := &provider.Reference{
+		Spec: &provider.Reference_Path{Path: fn},
+	}
+	sRes, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil {
+		log.Error().Err(err).Msg("error sending grpc stat request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	created := false
+	switch sRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		if !s.checkLocks(w, r, fn, false) || !s.uploadFile(w, r, fn, strings.NewReader(""), 0) {
+			return
+		}
+		created = true
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Error().Err(err).Msg("error generating lock token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	l := &locks.Lock{
+		Token:    "opaquelocktoken:" + id.String(),
+		Root:     fn,
+		Infinite: depth != "0",
+		Owner:    li.Owner.InnerXML,
+		UserID:   locks.UserID(u.GetId()),
+		Expires:  expires,
+	}
+	if err := s.locks.Lock(ctx, l); err != nil {
+		if _, ok := err.(errtypes.IsLocked); ok {
+			writeError(w, r, http.StatusLocked, "The resource is locked")
+			return
+		}
+		log.Error().Err(err).Msg("error creating lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Lock-Token", "<"+l.Token+">")
+	if created {
+		s.writeLock(w, r, ns, l, http.StatusCreated)
+		return
+	}
+	s.writeLock(w, r, ns, l, http.StatusOK)
+}
+
+// lockWithToken returns the lock with the token covering fn.
+func (s *svc) lockWithToken(ctx context.Context, fn, token string) (*locks.Lock, error) {
+	ls, err := s.locks.Locks(ctx, fn, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range ls {
+		if l.Token == token {
+			return l, nil
+		}
+	}
+	return nil, errtypes.NotFound(token)
+}
+
+// writeLock answers with the lockdiscovery property of the lock.
+func (s *svc) writeLock(w http.ResponseWriter, r *http.Request, ns string, l *locks.Lock, status int) {
+	log := appctx.GetLogger(r.Context())
+	body := `<?xml version="1.0" encoding="utf-8"?><D:prop xmlns:D="DAV:"><D:lockdiscovery>` +
+		activeLock(r.Context(), "D", ns, l) +
+		`</D:lockdiscovery></D:prop>`
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(body)); err != nil {
 		log.Err(err).Msg("error writing response")
 	}
 }
+
+// activeLock renders the lock as an activelock element with the given
+// prefix for the DAV: namespace. The token is only shown to the user who
+// created the lock.
+func activeLock(ctx context.Context, prefix, ns string, l *locks.Lock) string {
+	depth := "0"
+	if l.Infinite {
+		depth = "infinity"
+	}
+	timeout := "Infinite"
+	if !l.Expires.IsZero() {
+		timeout = fmt.Sprintf("Second-%d", int64(time.Until(l.Expires).Seconds()))
+	}
+	root := path.Join(ctx.Value(ctxKeyBaseURI).(string), strings.TrimPrefix(l.Root, ns))
+
+	var b strings.Builder
+	e := func(name, inner string) {
+		fmt.Fprintf(&b, "<%s:%s>%s</%s:%s>", prefix, name, inner, prefix, name)
+	}
+	b.WriteString("<" + prefix + ":activelock>")
+	e("locktype", "<"+prefix+":write/>")
+	e("lockscope", "<"+prefix+":exclusive/>")
+	e("depth", depth)
+	if l.Owner != "" {
+		e("owner", l.Owner)
+	}
+	e("timeout", timeout)
+	if u, ok := ctxuser.ContextGetUser(ctx); ok && locks.UserID(u.GetId()) == l.UserID {
+		e("locktoken", "<"+prefix+":href>"+escapeXML(l.Token)+"</"+prefix+":href>")
+	}
+	e("lockroot", "<"+prefix+":href>"+escapeXML((&url.URL{Path: root}).EscapedPath())+"</"+prefix+":href>")
+	b.WriteString("</" + prefix + ":activelock>")
+	return b.String()
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// checkLocks answers with 423 Locked and returns false if fn, or with
+// children a resource below it, is locked by a lock the user did not create
+// or whose token is not sent in the If header. The storage providers
+// sharing the lock manager check the locks again, see lockOpaque.
+func (s *svc) checkLocks(w http.ResponseWriter, r *http.Request, fn string, children bool) bool {
+	ctx := r.Context()
+	ls, err := s.locks.Locks(ctx, fn, children)
+	if err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("path", fn).Msg("error reading locks")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	if len(ls) == 0 {
+		return true
+	}
+
+	u, _ := ctxuser.ContextGetUser(ctx)
+	if err := locks.Check(ls, locks.UserID(u.GetId()), ifTokens(r.Header.Get("If"))); err != nil {
+		writeError(w, r, http.StatusLocked, "The resource is locked")
+		return false
+	}
+	return true
+}
+
+// lockOpaque returns the opaque data o forwarding the lock tokens sent in
+// the If header of the request to the storage.
+func lockOpaque(r *http.Request, o *types.Opaque) (*types.Opaque, error) {
+	return locks.TokensToOpaque(o, ifTokens(r.Header.Get("If")))
+}
+
+// ifTokens returns the state tokens of the If header, e.g.
+// `<http://example.com/file> (<opaquelocktoken:...>)`, see
+// http://www.webdav.org/specs/rfc4918.html#HEADER_If
+func ifTokens(h string) []string {
+	var tokens []string
+	inList := false
+	for len(h) > 0 {
+		switch h[0] {
+		case '(':
+			inList = true
+		case ')':
+			inList = false
+		case '<':
+			end := strings.IndexByte(h, '>')
+			if end == -1 {
+				return tokens
+			}
+			if inList {
+				tokens = append(tokens, h[1:end])
+			}
+			h = h[end:]
+		case '[':
+			// entity tags
+			end := strings.IndexByte(h, ']')
+			if end == -1 {
+				return tokens
+			}
+			h = h[end:]
+		}
+		h = h[1:]
+	}
+	return tokens
+}
+
+// parseTimeout returns the first timeout of the Timeout header, capped at
+// max seconds, see http://www.webdav.org/specs/rfc4918.html#HEADER_Timeout
+func parseTimeout(h string, max int) (time.Duration, error) {
+	maxTimeout := time.Duration(max) * time.Second
+	if h == "" {
+		return maxTimeout, nil
+	}
+	t := strings.TrimSpace(strings.Split(h, ",")[0])
+	if t == "Infinite" {
+		return maxTimeout, nil
+	}
+	if !strings.HasPrefix(t, "Second-") {
+		return 0, errors.New("invalid timeout " + t)
+	}
+	sec, err := strconv.ParseUint(strings.TrimPrefix(t, "Second-"), 10, 32)
+	if err != nil || sec == 0 {
+		return 0, errors.New("invalid timeout " + t)
+	}
+	if d := time.Duration(sec) * time.Second; d < maxTimeout {
+		return d, nil
+	}
+	return maxTimeout, nil
+}
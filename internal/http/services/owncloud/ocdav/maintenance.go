@@ -0,0 +1,56 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"net/http"
+	"strconv"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/maintenance"
+)
+
+// unavailableError is returned by the copies refused by a storage being
+// read-only or in maintenance.
+type unavailableError struct {
+	retryAfter int
+}
+
+func (e *unavailableError) Error() string {
+	return "storage unavailable"
+}
+
+// handleUnavailable answers 503, with the delay after which to retry, when
+// the storage refused the call for being read-only or in maintenance. It
+// tells whether it did.
+func handleUnavailable(w http.ResponseWriter, st *rpc.Status, o *types.Opaque) bool {
+	if st.GetCode() != rpc.Code_CODE_UNAVAILABLE {
+		return false
+	}
+	writeUnavailable(w, maintenance.RetryAfterFromOpaque(o))
+	return true
+}
+
+func writeUnavailable(w http.ResponseWriter, retryAfter int) {
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
@@ -37,7 +37,11 @@ func (s *svc) handleMkcol(w http.ResponseWriter, r *http.Request, ns string) {
 	_, err := r.Body.Read(buf)
 	if err != io.EOF {
 		log.Error().Err(err).Msg("error reading request body")
-		w.WriteHeader(http.StatusUnsupportedMediaType)
+		writeError(w, r, http.StatusUnsupportedMediaType, "The request body is not supported")
+		return
+	}
+
+	if !s.checkLocks(w, r, fn, false) {
 		return
 	}
 
@@ -60,13 +64,29 @@ func (s *svc) handleMkcol(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
+	if handleUnavailable(w, statRes.Status, statRes.Opaque) {
+		return
+	}
+
+	// the preconditions, e.g. If-None-Match: *, are evaluated before the
+	// existence of the collection, see https://tools.ietf.org/html/rfc7232#section-5
+	if !checkPreconditions(w, r, statRes.Info) {
+		return
+	}
+
 	if statRes.Status.Code == rpc.Code_CODE_OK {
 		log.Warn().Msg("resource already exists")
-		w.WriteHeader(http.StatusMethodNotAllowed) // 405 if it already exists
+		writeError(w, r, http.StatusMethodNotAllowed, "The resource already exists") // 405 if it already exists
 		return
 	}
 
-	req := &provider.CreateContainerRequest{Ref: ref}
+	opaque, err := lockOpaque(r, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("error encoding lock tokens")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	req := &provider.CreateContainerRequest{Ref: ref, Opaque: opaque}
 	res, err := client.CreateContainer(ctx, req)
 	if err != nil {
 		log.Error().Err(err).Msg("error sending create container grpc request")
@@ -74,8 +94,12 @@ func (s *svc) handleMkcol(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
+	if handleUnavailable(w, res.Status, res.Opaque) {
+		return
+	}
+
 	if res.Status.Code == rpc.Code_CODE_NOT_FOUND {
-		w.WriteHeader(http.StatusConflict)
+		writeError(w, r, http.StatusConflict, "The parent folder does not exist")
 		return
 	}
 
@@ -84,5 +108,6 @@ func (s *svc) handleMkcol(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
+	setFileIDHeaders(ctx, client, w, fn)
 	w.WriteHeader(http.StatusCreated)
 }
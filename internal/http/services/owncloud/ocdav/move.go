@@ -19,14 +19,19 @@
 package ocdav
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
 
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/storage/jobs"
 )
 
 func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
@@ -39,7 +44,7 @@ func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
 	log.Info().Str("src", src).Str("dst", dstHeader).Str("overwrite", overwrite).Msg("move")
 
 	if dstHeader == "" {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid Destination header")
 		return
 	}
 
@@ -49,7 +54,7 @@ func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
 	}
 
 	if overwrite != "T" && overwrite != "F" {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid Overwrite header")
 		return
 	}
 
@@ -63,7 +68,7 @@ func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
 	// strip baseURL from destination
 	dstURL, err := url.ParseRequestURI(dstHeader)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid Destination header")
 		return
 	}
 
@@ -73,7 +78,7 @@ func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
 	// TODO replace with HasPrefix:
 	i := strings.Index(urlPath, baseURI)
 	if i == -1 {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid Destination header")
 		return
 	}
 
@@ -90,43 +95,58 @@ func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
-	if srcStatRes.Status.Code != rpc.Code_CODE_OK {
-		if srcStatRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
+	if handleUnavailable(w, srcStatRes.Status, srcStatRes.Opaque) {
+		return
+	}
+
+	switch srcStatRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		writeError(w, r, http.StatusNotFound, "Resource not found")
+		return
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		writeError(w, r, http.StatusForbidden, "Moving the resource is not allowed")
+		return
+	default:
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	// fail before the destination is overwritten
+	if !checkPreconditions(w, r, srcStatRes.Info) {
+		return
+	}
+
+	if !permitted(srcStatRes.Info, canMove) {
+		writeError(w, r, http.StatusForbidden, "Moving the resource is not allowed")
+		return
+	}
+
 	// TODO check if path is on same storage, return 502 on problems, see https://tools.ietf.org/html/rfc4918#section-9.9.4
 	// prefix to namespace
 	dst := path.Join(ns, urlPath[len(baseURI):])
 
-	// check dst exists
-	dstStatRef := &provider.Reference{
+	if !s.checkLocks(w, r, src, true) || !s.checkLocks(w, r, dst, true) {
+		return
+	}
+
+	successCode := s.checkDestination(w, r, client, srcStatRes.Info, dst, overwrite, canDelete)
+	if successCode == 0 {
+		return
+	}
+
+	dstRef := &provider.Reference{
 		Spec: &provider.Reference_Path{Path: dst},
 	}
-	dstStatReq := &provider.StatRequest{Ref: dstStatRef}
-	dstStatRes, err := client.Stat(ctx, dstStatReq)
+	locked, err := lockOpaque(r, nil)
 	if err != nil {
-		log.Error().Err(err).Msg("error getting grpc client")
+		log.Error().Err(err).Msg("error encoding lock tokens")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	var successCode int
-	if dstStatRes.Status.Code == rpc.Code_CODE_OK {
-		successCode = http.StatusNoContent // 204 if target already existed, see https://tools.ietf.org/html/rfc4918#section-9.9.4
-
-		if overwrite == "F" {
-			log.Warn().Str("dst", dst).Msg("dst already exists")
-			w.WriteHeader(http.StatusPreconditionFailed) // 412, see https://tools.ietf.org/html/rfc4918#section-9.9.4
-			return
-		}
-
+	if successCode == http.StatusNoContent {
 		// delete existing tree
-		delReq := &provider.DeleteRequest{Ref: dstStatRef}
+		delReq := &provider.DeleteRequest{Ref: dstRef, Opaque: locked}
 		delRes, err := client.Delete(ctx, delReq)
 		if err != nil {
 			log.Error().Err(err).Msg("error sending grpc delete request")
@@ -134,40 +154,30 @@ func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
 			return
 		}
 
-		// TODO return a forbidden status if read only?
-		if delRes.Status.Code != rpc.Code_CODE_OK {
-			w.WriteHeader(http.StatusInternalServerError)
+		switch delRes.Status.Code {
+		case rpc.Code_CODE_OK:
+		case rpc.Code_CODE_PERMISSION_DENIED:
+			writeError(w, r, http.StatusForbidden, "Writing to the destination is not allowed")
 			return
-		}
-	} else {
-		successCode = http.StatusCreated // 201 if new resource was created, see https://tools.ietf.org/html/rfc4918#section-9.9.4
-
-		// check if an intermediate path / the parent exists
-		intermediateDir := path.Dir(dst)
-		ref2 := &provider.Reference{
-			Spec: &provider.Reference_Path{Path: intermediateDir},
-		}
-		intStatReq := &provider.StatRequest{Ref: ref2}
-		intStatRes, err := client.Stat(ctx, intStatReq)
-		if err != nil {
-			log.Error().Err(err).Msg("error sending grpc stat request")
+		default:
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if intStatRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
-			w.WriteHeader(http.StatusConflict) // 409 if intermediate dir is missing, see https://tools.ietf.org/html/rfc4918#section-9.9.4
-			return
-		}
-		// TODO what if intermediate is a file?
 	}
 
 	sourceRef := &provider.Reference{
 		Spec: &provider.Reference_Path{Path: src},
 	}
-	dstRef := &provider.Reference{
-		Spec: &provider.Reference_Path{Path: dst},
+	opaque, err := preconditionsOpaque(r)
+	if err == nil {
+		opaque, err = lockOpaque(r, opaque)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("error encoding preconditions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
-	mReq := &provider.MoveRequest{Source: sourceRef, Destination: dstRef}
+	mReq := &provider.MoveRequest{Source: sourceRef, Destination: dstRef, Opaque: opaque}
 	mRes, err := client.Move(ctx, mReq)
 	if err != nil {
 		log.Error().Err(err).Msg("error sending move grpc request")
@@ -175,12 +185,50 @@ func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 
-	if mRes.Status.Code != rpc.Code_CODE_OK {
+	if handleUnavailable(w, mRes.Status, mRes.Opaque) {
+		return
+	}
+
+	switch mRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_FAILED_PRECONDITION:
+		writeError(w, r, http.StatusPreconditionFailed, "Precondition failed")
+		return
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		writeError(w, r, http.StatusForbidden, "Moving the resource is not allowed")
+		return
+	case rpc.Code_CODE_UNIMPLEMENTED:
+		// the source and the destination are on different storage providers
+		src := srcStatRes.Info
+		job := func(ctx context.Context, j *jobs.Job) error {
+			if err := s.moveAcross(ctx, client, src, dst, locked, j.Progress); err != nil {
+				return err
+			}
+			return setJobResult(ctx, client, j, dst)
+		}
+		if lazyOps(r) && s.startJob(w, r, int64(src.Size), job) {
+			return
+		}
+		err := s.moveAcross(ctx, client, src, dst, locked, nil)
+		if err == errForbidden {
+			writeError(w, r, http.StatusForbidden, "Moving the resource is not allowed")
+			return
+		}
+		if e, ok := err.(*unavailableError); ok {
+			writeUnavailable(w, e.retryAfter)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("error moving across storage providers")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	default:
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	dstStatRes, err = client.Stat(ctx, dstStatReq)
+	dstStatRes, err := client.Stat(ctx, &provider.StatRequest{Ref: dstRef})
 	if err != nil {
 		log.Error().Err(err).Msg("error sending grpc stat request")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -199,3 +247,30 @@ func (s *svc) handleMove(w http.ResponseWriter, r *http.Request, ns string) {
 	w.Header().Set("OC-ETag", info.Etag)
 	w.WriteHeader(successCode)
 }
+
+// moveAcross copies src to dst on another storage provider and deletes it,
+// reporting the bytes copied to progress if not nil. The changes carry the
+// opaque data locked with the lock tokens of the request.
+func (s *svc) moveAcross(ctx context.Context, client gateway.GatewayAPIClient, src *provider.ResourceInfo, dst string, locked *types.Opaque, progress func(int64)) error {
+	if err := s.descend(ctx, client, src, dst, locked, progress); err != nil {
+		return err
+	}
+
+	res, err := client.Delete(ctx, &provider.DeleteRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: src.Path},
+		},
+		Opaque: locked,
+	})
+	if err != nil {
+		return err
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+		return nil
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return errForbidden
+	default:
+		return fmt.Errorf("status code %d", res.Status.Code)
+	}
+}
@@ -28,12 +28,18 @@ import (
 	"strings"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/i18n"
+	"github.com/cs3org/reva/pkg/storage/filetypes"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 	"github.com/cs3org/reva/pkg/rhttp/global"
 	"github.com/cs3org/reva/pkg/rhttp/router"
 	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/storage/janitor"
+	"github.com/cs3org/reva/pkg/storage/favorite"
+	"github.com/cs3org/reva/pkg/storage/locks"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -54,12 +60,56 @@ type Config struct {
 	WebdavNamespace string `mapstructure:"webdav_namespace"`
 	ChunkFolder     string `mapstructure:"chunk_folder"`
 	GatewaySvc      string `mapstructure:"gatewaysvc"`
+	// ChunkStore keeps the chunks of the chunking NG uploads.
+	ChunkStore  string                            `mapstructure:"chunk_store"`
+	ChunkStores map[string]map[string]interface{} `mapstructure:"chunk_stores"`
+	// SearchEndpoint is the URL of the search service answering the
+	// search-files REPORTs, they are not supported if empty.
+	SearchEndpoint string `mapstructure:"search_endpoint"`
+	// PropfindWorkers bounds the concurrent stat calls made to resolve the
+	// children of a collection listed by a PROPFIND.
+	PropfindWorkers int `mapstructure:"propfind_workers"`
+	// CopyWorkers bounds the concurrent file transfers of the copies and
+	// moves between storage providers.
+	CopyWorkers int `mapstructure:"copy_workers"`
+	// LockManager keeps the WebDAV locks.
+	LockManager  string                            `mapstructure:"lock_manager"`
+	LockManagers map[string]map[string]interface{} `mapstructure:"lock_managers"`
+	// FavoriteManager keeps the favorites of the users, listed by the
+	// filter-files REPORT.
+	FavoriteManager  string                            `mapstructure:"favorite_manager"`
+	FavoriteManagers map[string]map[string]interface{} `mapstructure:"favorite_managers"`
+	// MaxPropfindDepth is the number of levels a PROPFIND lists, 1 by
+	// default for the children of a collection. With more, Depth: infinity
+	// requests list the trees down to that many levels, deeper trees are
+	// refused.
+	MaxPropfindDepth int `mapstructure:"max_propfind_depth"`
+	// MaxPropfindChildren is the number of resources a PROPFIND lists at
+	// most, larger listings are refused. 0 disables the limit.
+	MaxPropfindChildren int `mapstructure:"max_propfind_children"`
+	// MaxLockTimeout caps the lifetime in seconds of the locks requested
+	// by the clients.
+	MaxLockTimeout int `mapstructure:"max_lock_timeout"`
+	// FileTypes are the allow and deny lists of the types of the uploaded
+	// files, the data servers check them again with the content.
+	FileTypes filetypes.Config `mapstructure:"file_types"`
+	// Translations is a directory of <language>.json files translating the
+	// error messages, in addition to the translations shipped with reva.
+	Translations string `mapstructure:"translations"`
+	// Janitor purges the chunks of the abandoned chunked uploads.
+	Janitor struct {
+		Chunks janitor.Config `mapstructure:"chunks"`
+	} `mapstructure:"janitor"`
 }
 
 type svc struct {
 	c             *Config
 	webDavHandler *WebDavHandler
 	davHandler    *DavHandler
+	locks         locks.Manager
+	favorites     favorite.Manager
+	janitor       *janitor.Janitor
+	fileTypes     *filetypes.Policy
 }
 
 // New returns a new ocdav
@@ -79,10 +129,60 @@ func New(m map[string]interface{}) (global.Service, error) {
 		return nil, err
 	}
 
+	if conf.ChunkStore == "" {
+		conf.ChunkStore = "local"
+	}
+
+	if conf.PropfindWorkers <= 0 {
+		conf.PropfindWorkers = 10
+	}
+	if conf.CopyWorkers <= 0 {
+		conf.CopyWorkers = 4
+	}
+	if conf.MaxPropfindDepth <= 0 {
+		conf.MaxPropfindDepth = 1
+	}
+
+	if conf.LockManager == "" {
+		conf.LockManager = "memory"
+	}
+
+	if conf.FavoriteManager == "" {
+		conf.FavoriteManager = "memory"
+	}
+
+	if conf.MaxLockTimeout <= 0 {
+		conf.MaxLockTimeout = 3600
+	}
+
+	if conf.Translations != "" {
+		if err := i18n.Default.LoadDir(conf.Translations); err != nil {
+			return nil, err
+		}
+	}
+
+	lm, err := newLockManager(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	fm, err := newFavoriteManager(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	fileTypes, err := filetypes.New(&conf.FileTypes)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &svc{
 		c:             conf,
 		webDavHandler: new(WebDavHandler),
 		davHandler:    new(DavHandler),
+		locks:         lm,
+		favorites:     fm,
+		fileTypes:     fileTypes,
 	}
 	// initialize handlers and set default configs
 	if err := s.webDavHandler.init(conf.WebdavNamespace); err != nil {
@@ -91,6 +191,10 @@ func New(m map[string]interface{}) (global.Service, error) {
 	if err := s.davHandler.init(conf); err != nil {
 		return nil, err
 	}
+
+	s.janitor = janitor.New()
+	s.janitor.Add("ocdav-chunks", conf.Janitor.Chunks, s.purgeChunks)
+	s.janitor.Start()
 	return s, nil
 }
 
@@ -99,6 +203,7 @@ func (s *svc) Prefix() string {
 }
 
 func (s *svc) Close() error {
+	s.janitor.Stop()
 	return nil
 }
 
@@ -170,6 +275,18 @@ func (s *svc) getClient() (gateway.GatewayAPIClient, error) {
 	return pool.GetGatewayServiceClient(s.c.GatewaySvc)
 }
 
+// setFileIDHeaders sets the OC-FileId and OC-ETag headers of the resource at
+// fn, as the sync clients key their database on the file id.
+func setFileIDHeaders(ctx context.Context, client gateway.GatewayAPIClient, w http.ResponseWriter, fn string) {
+	res, err := client.Stat(ctx, &provider.StatRequest{Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}})
+	if err != nil || res.Status.Code != rpc.Code_CODE_OK {
+		appctx.GetLogger(ctx).Warn().Err(err).Str("path", fn).Msg("error getting the file id")
+		return
+	}
+	w.Header().Set("OC-FileId", wrapResourceID(res.Info.Id))
+	w.Header().Set("OC-ETag", res.Info.Etag)
+}
+
 func wrapResourceID(r *provider.ResourceId) string {
 	return wrap(r.StorageId, r.OpaqueId)
 }
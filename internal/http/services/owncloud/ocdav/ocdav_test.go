@@ -0,0 +1,61 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"google.golang.org/grpc"
+)
+
+// testGateway is a gateway serving the stat of the resources it holds.
+type testGateway struct {
+	gateway.UnimplementedGatewayAPIServer
+	infos []*provider.ResourceInfo
+}
+
+func (g *testGateway) Stat(ctx context.Context, req *provider.StatRequest) (*provider.StatResponse, error) {
+	for _, info := range g.infos {
+		if id := req.Ref.GetId(); id != nil && id.StorageId == info.Id.StorageId && id.OpaqueId == info.Id.OpaqueId {
+			return &provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, Info: info}, nil
+		}
+		if req.Ref.GetPath() != "" && req.Ref.GetPath() == info.Path {
+			return &provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, Info: info}, nil
+		}
+	}
+	return &provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_NOT_FOUND}}, nil
+}
+
+// startGateway serves the gateway and returns its address.
+func startGateway(t *testing.T, g gateway.GatewayAPIServer) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	gateway.RegisterGatewayAPIServer(s, g)
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+	return l.Addr().String()
+}
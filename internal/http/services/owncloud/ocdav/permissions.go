@@ -0,0 +1,155 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/golang/protobuf/proto"
+)
+
+// errForbidden is returned by the copies refused by the permissions of the
+// source or the destination.
+var errForbidden = errors.New("permission denied")
+
+// defaultPermissions is the permission set reported for every resource by the
+// storage drivers that do not resolve the grants. It tells nothing about what
+// the user may do, the storage enforces its own rules.
+var defaultPermissions = &provider.ResourcePermissions{ListContainer: true, CreateContainer: true}
+
+// permitted tells whether the permission set of info grants what allowed
+// checks. The resources without a meaningful permission set are permitted,
+// the storage refuses the calls it does not allow.
+func permitted(info *provider.ResourceInfo, allowed func(*provider.ResourcePermissions) bool) bool {
+	p := info.PermissionSet
+	if p == nil || proto.Equal(p, defaultPermissions) {
+		return true
+	}
+	return allowed(p)
+}
+
+// canMove tells whether a resource can be moved away, either by the storage
+// or by being copied and deleted.
+func canMove(p *provider.ResourcePermissions) bool {
+	return p.Move || p.Delete && p.InitiateFileDownload
+}
+
+// canCopy tells whether a resource can be read to be copied.
+func canCopy(p *provider.ResourcePermissions) bool {
+	return p.InitiateFileDownload
+}
+
+// canDelete tells whether an existing destination can be deleted to be
+// replaced by a move.
+func canDelete(p *provider.ResourcePermissions) bool {
+	return p.Delete
+}
+
+// canWrite tells whether an existing destination can be overwritten by a
+// copy.
+func canWrite(p *provider.ResourcePermissions) bool {
+	return p.InitiateFileUpload
+}
+
+// canCreate returns the check of the permission to create a resource of type
+// t in a folder.
+func canCreate(t provider.ResourceType) func(*provider.ResourcePermissions) bool {
+	if t == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return func(p *provider.ResourcePermissions) bool { return p.CreateContainer }
+	}
+	return func(p *provider.ResourcePermissions) bool { return p.InitiateFileUpload }
+}
+
+// checkDestination checks that src can be written to dst. An existing dst
+// must be allowed to be replaced by overwrite and by the replace check of its
+// permissions, the parent must be a folder src can be created in. It answers
+// the request on failure, 403 when a permission is missing and 409 when the
+// parent is missing, and returns 0. Else it returns the status code to answer
+// on success.
+func (s *svc) checkDestination(w http.ResponseWriter, r *http.Request, client gateway.GatewayAPIClient, src *provider.ResourceInfo, dst, overwrite string, replace func(*provider.ResourcePermissions) bool) int {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	dstStatRes, err := client.Stat(ctx, &provider.StatRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: dst},
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("error sending grpc stat request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return 0
+	}
+
+	successCode := http.StatusCreated // 201 if new resource was created, see https://tools.ietf.org/html/rfc4918#section-9.8.5
+	switch dstStatRes.Status.Code {
+	case rpc.Code_CODE_OK:
+		successCode = http.StatusNoContent // 204 if target already existed, see https://tools.ietf.org/html/rfc4918#section-9.8.5
+
+		if overwrite == "F" {
+			log.Warn().Str("dst", dst).Msg("dst already exists")
+			writeError(w, r, http.StatusPreconditionFailed, "The destination already exists") // 412, see https://tools.ietf.org/html/rfc4918#section-9.8.5
+			return 0
+		}
+		if !permitted(dstStatRes.Info, replace) {
+			writeError(w, r, http.StatusForbidden, "Writing to the destination is not allowed")
+			return 0
+		}
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		writeError(w, r, http.StatusForbidden, "Writing to the destination is not allowed")
+		return 0
+	}
+
+	// check if an intermediate path / the parent exists
+	parentStatRes, err := client.Stat(ctx, &provider.StatRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: path.Dir(dst)},
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("error sending grpc stat request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return 0
+	}
+
+	switch parentStatRes.Status.Code {
+	case rpc.Code_CODE_OK:
+		if parentStatRes.Info.Type == provider.ResourceType_RESOURCE_TYPE_FILE {
+			writeError(w, r, http.StatusConflict, "The parent folder does not exist")
+			return 0
+		}
+		if !permitted(parentStatRes.Info, canCreate(src.Type)) {
+			writeError(w, r, http.StatusForbidden, "Writing to the destination is not allowed")
+			return 0
+		}
+	case rpc.Code_CODE_NOT_FOUND:
+		writeError(w, r, http.StatusConflict, "The parent folder does not exist") // 409 if intermediate dir is missing, see https://tools.ietf.org/html/rfc4918#section-9.8.5
+		return 0
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		writeError(w, r, http.StatusForbidden, "Writing to the destination is not allowed")
+		return 0
+	}
+	return successCode
+}
@@ -0,0 +1,189 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage/locks/memory"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+var (
+	viewerPermissions = &provider.ResourcePermissions{
+		Stat:                 true,
+		ListContainer:        true,
+		InitiateFileDownload: true,
+	}
+	editorPermissions = &provider.ResourcePermissions{
+		Stat:                 true,
+		ListContainer:        true,
+		InitiateFileDownload: true,
+		InitiateFileUpload:   true,
+		CreateContainer:      true,
+		Move:                 true,
+		Delete:               true,
+	}
+	uploaderPermissions = &provider.ResourcePermissions{
+		Stat:               true,
+		InitiateFileUpload: true,
+		CreateContainer:    true,
+	}
+)
+
+// shareGateway holds the received shares of a user, with the permissions of
+// each share, and records the moves it is asked for. The storage behind it
+// refuses the moves to the folders without permission set.
+type shareGateway struct {
+	testGateway
+	mu    sync.Mutex
+	moves []string
+}
+
+func (g *shareGateway) Move(ctx context.Context, req *provider.MoveRequest) (*provider.MoveResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.moves = append(g.moves, req.Source.GetPath()+" -> "+req.Destination.GetPath())
+	if strings.HasPrefix(req.Destination.GetPath(), "/home/Shares/storage/") {
+		return &provider.MoveResponse{Status: &rpc.Status{Code: rpc.Code_CODE_PERMISSION_DENIED}}, nil
+	}
+	for i, info := range g.infos {
+		if info.Path == req.Source.GetPath() {
+			moved := *info
+			moved.Path = req.Destination.GetPath()
+			g.infos[i] = &moved
+		}
+	}
+	return &provider.MoveResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil
+}
+
+func shared(id, p string, t provider.ResourceType, perms *provider.ResourcePermissions) *provider.ResourceInfo {
+	return &provider.ResourceInfo{
+		Id:            &provider.ResourceId{StorageId: "home", OpaqueId: id},
+		Path:          p,
+		Type:          t,
+		PermissionSet: perms,
+	}
+}
+
+func newShareGateway() *shareGateway {
+	folder, file := provider.ResourceType_RESOURCE_TYPE_CONTAINER, provider.ResourceType_RESOURCE_TYPE_FILE
+	return &shareGateway{testGateway: testGateway{infos: []*provider.ResourceInfo{
+		shared("viewer", "/home/Shares/viewer", folder, viewerPermissions),
+		shared("report", "/home/Shares/viewer/report.txt", file, viewerPermissions),
+		shared("editor", "/home/Shares/editor", folder, editorPermissions),
+		shared("draft", "/home/Shares/editor/draft.txt", file, editorPermissions),
+		shared("uploader", "/home/Shares/uploader", folder, uploaderPermissions),
+		shared("upload", "/home/Shares/uploader/upload.txt", file, uploaderPermissions),
+		// the storage enforces its own rules on the resources without permissions
+		shared("storage", "/home/Shares/storage", folder, nil),
+	}}}
+}
+
+// sendDAV sends a MOVE or a COPY of src to dst on behalf of einstein.
+func sendDAV(s *svc, method, src, dst, overwrite string) *httptest.ResponseRecorder {
+	einstein := &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein", Idp: "cernbox.cern.ch"}, Username: "einstein"}
+	ctx := ctxuser.ContextSetUser(context.Background(), einstein)
+	ctx = context.WithValue(ctx, ctxKeyBaseURI, "/remote.php/webdav")
+
+	r := httptest.NewRequest(method, src, nil).WithContext(ctx)
+	r.Header.Set("Destination", "http://localhost/remote.php/webdav"+dst)
+	if overwrite != "" {
+		r.Header.Set("Overwrite", overwrite)
+	}
+	w := httptest.NewRecorder()
+	if method == "MOVE" {
+		s.handleMove(w, r, "")
+	} else {
+		s.handleCopy(w, r, "")
+	}
+	return w
+}
+
+func newShareService(t *testing.T, g *shareGateway) *svc {
+	lm, err := memory.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &svc{c: &Config{GatewaySvc: startGateway(t, g), CopyWorkers: 1}, locks: lm}
+}
+
+func TestMoveAcrossShares(t *testing.T) {
+	g := newShareGateway()
+	s := newShareService(t, g)
+
+	tests := []struct {
+		name      string
+		src, dst  string
+		overwrite string
+		expected  int
+		moved     bool
+	}{
+		{"out of a read-only share", "/home/Shares/viewer/report.txt", "/home/Shares/editor/report.txt", "", http.StatusForbidden, false},
+		{"into a read-only share", "/home/Shares/editor/draft.txt", "/home/Shares/viewer/draft.txt", "", http.StatusForbidden, false},
+		{"over a file of a read-only share", "/home/Shares/editor/draft.txt", "/home/Shares/viewer/report.txt", "T", http.StatusForbidden, false},
+		{"out of an upload-only share", "/home/Shares/uploader/upload.txt", "/home/Shares/editor/upload.txt", "", http.StatusForbidden, false},
+		{"refused by the storage", "/home/Shares/editor/draft.txt", "/home/Shares/storage/draft.txt", "", http.StatusForbidden, true},
+		{"within an editable share", "/home/Shares/editor/draft.txt", "/home/Shares/editor/final.txt", "", http.StatusCreated, true},
+	}
+	for _, tt := range tests {
+		g.moves = nil
+		w := sendDAV(s, "MOVE", tt.src, tt.dst, tt.overwrite)
+		if w.Code != tt.expected {
+			t.Errorf("move %s: got %d, expected %d", tt.name, w.Code, tt.expected)
+		}
+		if moved := len(g.moves) > 0; moved != tt.moved {
+			t.Errorf("move %s: moves sent to the gateway %v", tt.name, g.moves)
+		}
+	}
+}
+
+func TestCopyAcrossShares(t *testing.T) {
+	s := newShareService(t, newShareGateway())
+
+	tests := []struct {
+		name      string
+		src, dst  string
+		overwrite string
+	}{
+		{"into a read-only share", "/home/Shares/editor/draft.txt", "/home/Shares/viewer/draft.txt", ""},
+		{"over a file of a read-only share", "/home/Shares/editor/draft.txt", "/home/Shares/viewer/report.txt", "T"},
+		{"out of an upload-only share", "/home/Shares/uploader/upload.txt", "/home/Shares/editor/upload.txt", ""},
+	}
+	for _, tt := range tests {
+		// the copies are refused before any data is read or written
+		if w := sendDAV(s, "COPY", tt.src, tt.dst, tt.overwrite); w.Code != http.StatusForbidden {
+			t.Errorf("copy %s: got %d, expected %d", tt.name, w.Code, http.StatusForbidden)
+		}
+	}
+
+	// a copy out of a read-only share is allowed, it fails after the checks
+	// as the gateway serves no data
+	if w := sendDAV(s, "COPY", "/home/Shares/viewer/report.txt", "/home/Shares/editor/report.txt", ""); w.Code == http.StatusForbidden {
+		t.Error("expected the copy out of a read-only share to be allowed")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"net/http"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/storage/conditions"
+)
+
+// checkPreconditions answers 412 Precondition Failed and returns false if
+// the resource, nil when it does not exist, does not meet the If-Match,
+// If-None-Match and If-Unmodified-Since headers of the request. This only
+// fails early, the storage checks them again atomically with the change.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, info *provider.ResourceInfo) bool {
+	p := conditions.FromHeader(r.Header)
+	if p == nil {
+		return true
+	}
+	if err := p.Check(info); err != nil {
+		appctx.GetLogger(r.Context()).Warn().Err(err).Msg("precondition failed")
+		writeError(w, r, http.StatusPreconditionFailed, "Precondition failed")
+		return false
+	}
+	return true
+}
+
+// preconditionsOpaque returns the opaque data forwarding the preconditions
+// of the request to the storage, nil if there are none.
+func preconditionsOpaque(r *http.Request) (*types.Opaque, error) {
+	p := conditions.FromHeader(r.Header)
+	if p == nil {
+		return nil, nil
+	}
+	return p.ToOpaque()
+}
@@ -23,21 +23,32 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"go.opencensus.io/trace"
-
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	"github.com/cs3org/reva/internal/http/utils"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/metadata"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/pkg/errors"
 )
 
+const (
+	multistatusStart = `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:" ` +
+		`xmlns:s="http://sabredav.org/ns" xmlns:oc="http://owncloud.org/ns">`
+	multistatusEnd = `</d:multistatus>`
+)
+
 // ns is the namespace that is prefixed to the path in the cs3 namespace
 func (s *svc) handlePropfind(w http.ResponseWriter, r *http.Request, ns string) {
 	ctx := r.Context()
@@ -46,7 +57,23 @@ func (s *svc) handlePropfind(w http.ResponseWriter, r *http.Request, ns string)
 	log := appctx.GetLogger(ctx)
 
 	fn := path.Join(ns, r.URL.Path)
-	listChildren := r.Header.Get("Depth") != "0"
+	depth, err := parseDepth(r.Header.Get("Depth"))
+	if err != nil {
+		log.Warn().Str("depth", r.Header.Get("Depth")).Msg("invalid Depth header")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// an infinite depth lists down to MaxPropfindDepth levels, and is only
+	// accepted when it is more than one.
+	infinite := depth == depthInfinity
+	if infinite && s.c.MaxPropfindDepth > 1 {
+		depth = s.c.MaxPropfindDepth
+	}
+	if depth > s.c.MaxPropfindDepth {
+		log.Warn().Str("depth", r.Header.Get("Depth")).Msg("propfind depth exceeds the limit")
+		writeDAVError(w, http.StatusForbidden, "propfind-finite-depth")
+		return
+	}
 
 	pf, status, err := readPropfind(r.Body)
 	if err != nil {
@@ -73,6 +100,10 @@ func (s *svc) handlePropfind(w http.ResponseWriter, r *http.Request, ns string)
 		return
 	}
 
+	if handleUnavailable(w, res.Status, res.Opaque) {
+		return
+	}
+
 	if res.Status.Code != rpc.Code_CODE_OK {
 		if res.Status.Code == rpc.Code_CODE_NOT_FOUND {
 			log.Warn().Str("path", fn).Msg("resource not found")
@@ -84,37 +115,220 @@ func (s *svc) handlePropfind(w http.ResponseWriter, r *http.Request, ns string)
 	}
 
 	info := res.Info
-	infos := []*provider.ResourceInfo{info}
-	if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER && listChildren {
-		req := &provider.ListContainerRequest{
-			Ref: ref,
-		}
-		res, err := client.ListContainer(ctx, req)
-		if err != nil {
-			log.Error().Err(err).Msg("error sending list container grpc request")
-			w.WriteHeader(http.StatusInternalServerError)
+	var children []*provider.ResourceInfo
+	if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER && depth > 0 {
+		var status int
+		children, status = s.listChildren(ctx, client, info, depth, infinite)
+		if status == http.StatusInsufficientStorage {
+			writeDAVError(w, status, "number-of-matches-within-limits")
 			return
 		}
-		if res.Status.Code != rpc.Code_CODE_OK {
-			log.Err(err).Msg("error calling grpc list container")
-			w.WriteHeader(http.StatusInternalServerError)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
 			return
 		}
-		infos = append(infos, res.Infos...)
 	}
 
-	propRes, err := s.formatPropfind(ctx, &pf, infos, ns)
+	var quota *quotaInfo
+	if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER && wantsQuota(&pf) {
+		quota = s.getQuota(ctx, client, ref)
+	}
+
+	propRes, err := s.mdToPropResponse(ctx, &pf, info, ns, quota)
 	if err != nil {
 		log.Error().Err(err).Msg("error formatting propfind")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
+	// the children are streamed as they are resolved, the status can not
+	// be changed anymore so failing children are only logged.
 	w.Header().Set("DAV", "1, 3, extended-mkcol")
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
 	w.WriteHeader(http.StatusMultiStatus)
-	if _, err := w.Write([]byte(propRes)); err != nil {
-		log.Err(err).Msg("error writing response")
+	mw := &multistatusWriter{w: w}
+	mw.start()
+	mw.write(propRes)
+	for child := range s.statChildren(ctx, client, children) {
+		propRes, err := s.mdToPropResponse(ctx, &pf, child, ns, quota)
+		if err != nil {
+			log.Error().Err(err).Str("path", child.Path).Msg("error formatting propfind")
+			continue
+		}
+		mw.write(propRes)
+	}
+	mw.end()
+	if mw.err != nil {
+		log.Err(mw.err).Msg("error writing response")
+	}
+}
+
+// depthInfinity is the depth of the Depth: infinity requests.
+const depthInfinity = math.MaxInt32
+
+// parseDepth parses the Depth header of a PROPFIND. Without the header the
+// children are listed, like most clients expect.
+func parseDepth(h string) (int, error) {
+	switch strings.ToLower(h) {
+	case "0":
+		return 0, nil
+	case "", "1":
+		return 1, nil
+	case "infinity":
+		return depthInfinity, nil
+	}
+	return 0, errors.New("ocdav: invalid depth " + h)
+}
+
+// listChildren lists the descendants of the container info down to depth
+// levels. The listing fails with http.StatusInsufficientStorage when it has
+// more than MaxPropfindChildren entries, or when it is infinite and the tree
+// is deeper than depth.
+func (s *svc) listChildren(ctx context.Context, client gateway.GatewayAPIClient, info *provider.ResourceInfo, depth int, infinite bool) ([]*provider.ResourceInfo, int) {
+	log := appctx.GetLogger(ctx)
+	var children []*provider.ResourceInfo
+	level := []*provider.ResourceInfo{info}
+	for d := 1; d <= depth && len(level) > 0; d++ {
+		var next []*provider.ResourceInfo
+		for _, c := range level {
+			res, err := client.ListContainer(ctx, &provider.ListContainerRequest{
+				Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: c.Path}},
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("error sending list container grpc request")
+				return nil, http.StatusInternalServerError
+			}
+			if res.Status.Code != rpc.Code_CODE_OK {
+				log.Error().Str("path", c.Path).Str("status", res.Status.Code.String()).Msg("error calling grpc list container")
+				return nil, http.StatusInternalServerError
+			}
+			children = append(children, res.Infos...)
+			if s.c.MaxPropfindChildren > 0 && len(children) > s.c.MaxPropfindChildren {
+				log.Warn().Str("path", info.Path).Int("limit", s.c.MaxPropfindChildren).Msg("propfind lists too many resources")
+				return nil, http.StatusInsufficientStorage
+			}
+			for _, child := range res.Infos {
+				if child.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+
+	// an infinite listing must hold the whole tree
+	if infinite {
+		for _, c := range level {
+			res, err := client.ListContainer(ctx, &provider.ListContainerRequest{
+				Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: c.Path}},
+			})
+			if err == nil && res.Status.Code == rpc.Code_CODE_OK && len(res.Infos) > 0 {
+				log.Warn().Str("path", info.Path).Int("limit", depth).Msg("propfind tree deeper than the depth limit")
+				return nil, http.StatusInsufficientStorage
+			}
+		}
+	}
+	return children, http.StatusOK
+}
+
+// writeDAVError answers with status and a DAV error body naming the failed
+// precondition cond.
+func writeDAVError(w http.ResponseWriter, status int, cond string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><d:error xmlns:d="DAV:"><d:` + cond + `/></d:error>`))
+}
+
+// statChildren resolves the references among the children, which point to
+// the shared resources, with at most PropfindWorkers concurrent stat calls.
+// The children are sent on the returned channel as they are ready, in no
+// particular order, and it is closed when all are sent. The channel must be
+// drained.
+func (s *svc) statChildren(ctx context.Context, client gateway.GatewayAPIClient, infos []*provider.ResourceInfo) <-chan *provider.ResourceInfo {
+	out := make(chan *provider.ResourceInfo)
+	refs := make(chan *provider.ResourceInfo)
+
+	workers := s.c.PropfindWorkers
+	if workers > len(infos) {
+		workers = len(infos)
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for info := range refs {
+				out <- s.resolveReference(ctx, client, info)
+			}
+		}()
 	}
+
+	go func() {
+		for _, info := range infos {
+			if info.Type == provider.ResourceType_RESOURCE_TYPE_REFERENCE {
+				refs <- info
+			} else {
+				out <- info
+			}
+		}
+		close(refs)
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// resolveReference returns the info of the resource the reference points to,
+// under the path of the reference, or the reference itself if it can not be
+// resolved.
+func (s *svc) resolveReference(ctx context.Context, client gateway.GatewayAPIClient, info *provider.ResourceInfo) *provider.ResourceInfo {
+	log := appctx.GetLogger(ctx)
+	ref := &provider.Reference{
+		Spec: &provider.Reference_Path{Path: info.Path},
+	}
+	res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil {
+		log.Error().Err(err).Str("path", info.Path).Msg("error sending a grpc stat request")
+		return info
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		log.Warn().Str("path", info.Path).Str("code", res.Status.Code.String()).Msg("error resolving reference")
+		return info
+	}
+	return res.Info
+}
+
+// multistatusWriter streams the responses of a multistatus, keeping the
+// first error.
+type multistatusWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (mw *multistatusWriter) writeString(s string) {
+	if mw.err == nil {
+		_, mw.err = io.WriteString(mw.w, s)
+	}
+}
+
+func (mw *multistatusWriter) start() {
+	mw.writeString(multistatusStart)
+}
+
+func (mw *multistatusWriter) write(res *responseXML) {
+	if mw.err != nil {
+		return
+	}
+	b, err := xml.Marshal(res)
+	if err != nil {
+		mw.err = err
+		return
+	}
+	_, mw.err = mw.w.Write(b)
+}
+
+func (mw *multistatusWriter) end() {
+	mw.writeString(multistatusEnd)
 }
 
 // from https://github.com/golang/net/blob/e514e69ffb8bc3c76a71ae40de0118d794855992/webdav/xml.go#L178-L205
@@ -148,10 +362,12 @@ func readPropfind(r io.Reader) (pf propfindXML, status int, err error) {
 	return pf, 0, nil
 }
 
-func (s *svc) formatPropfind(ctx context.Context, pf *propfindXML, mds []*provider.ResourceInfo, ns string) (string, error) {
+// formatPropfind renders the propfind response, quota is reported on the
+// collections when it is not nil.
+func (s *svc) formatPropfind(ctx context.Context, pf *propfindXML, mds []*provider.ResourceInfo, ns string, quota *quotaInfo) (string, error) {
 	responses := make([]*responseXML, 0, len(mds))
 	for i := range mds {
-		res, err := s.mdToPropResponse(ctx, pf, mds[i], ns)
+		res, err := s.mdToPropResponse(ctx, pf, mds[i], ns, quota)
 		if err != nil {
 			return "", err
 		}
@@ -162,10 +378,7 @@ func (s *svc) formatPropfind(ctx context.Context, pf *propfindXML, mds []*provid
 		return "", err
 	}
 
-	msg := `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:" `
-	msg += `xmlns:s="http://sabredav.org/ns" xmlns:oc="http://owncloud.org/ns">`
-	msg += string(responsesXML) + `</d:multistatus>`
-	return msg, nil
+	return multistatusStart + string(responsesXML) + multistatusEnd, nil
 }
 
 func (s *svc) newProp(key, val string) *propertyXML {
@@ -179,7 +392,7 @@ func (s *svc) newProp(key, val string) *propertyXML {
 // mdToPropResponse converts the CS3 metadata into a webdav propesponse
 // ns is the CS3 namespace that needs to be removed from the CS3 path before
 // prefixing it with the baseURI
-func (s *svc) mdToPropResponse(ctx context.Context, pf *propfindXML, md *provider.ResourceInfo, ns string) (*responseXML, error) {
+func (s *svc) mdToPropResponse(ctx context.Context, pf *propfindXML, md *provider.ResourceInfo, ns string, quota *quotaInfo) (*responseXML, error) {
 
 	md.Path = strings.TrimPrefix(md.Path, ns)
 
@@ -230,6 +443,12 @@ func (s *svc) mdToPropResponse(ctx context.Context, pf *propfindXML, md *provide
 				s.newProp("d:getcontenttype", "httpd/unix-directory"),
 				s.newProp("oc:size", size),
 			)
+			if quota != nil {
+				response.Propstat[0].Prop = append(response.Propstat[0].Prop,
+					s.newProp("d:quota-used-bytes", quota.usedBytes()),
+					s.newProp("d:quota-available-bytes", quota.availableBytes()),
+				)
+			}
 		} else if md.MimeType != "" {
 			response.Propstat[0].Prop = append(response.Propstat[0].Prop,
 				s.newProp("d:getcontenttype", md.MimeType),
@@ -241,13 +460,13 @@ func (s *svc) mdToPropResponse(ctx context.Context, pf *propfindXML, md *provide
 		lastModifiedString := t.Format(time.RFC1123)
 		response.Propstat[0].Prop = append(response.Propstat[0].Prop, s.newProp("d:getlastmodified", lastModifiedString))
 
-		if md.Checksum != nil {
-			// TODO(jfd): the actual value is an abomination like this:
+		if xs := checksumsProp(md); xs != "" {
+			// the actual value is an abomination like this:
 			// <oc:checksums>
 			//   <oc:checksum>SHA1:9bd253a09d58be107bcb4169ebf338c8df34d086 MD5:d90bcc6bf847403d22a4abba64e79994 ADLER32:fca23ff5</oc:checksum>
 			// </oc:checksums>
 			// yep, correct, space delimited key value pairs inside an oc:checksum tag inside an oc:checksums tag
-			value := fmt.Sprintf("<oc:checksum>%s:%s</oc:checksum>", md.Checksum.Type, md.Checksum.Sum)
+			value := fmt.Sprintf("<oc:checksum>%s</oc:checksum>", xs)
 			response.Propstat[0].Prop = append(response.Propstat[0].Prop, s.newProp("oc:checksums", value))
 		}
 
@@ -261,6 +480,16 @@ func (s *svc) mdToPropResponse(ctx context.Context, pf *propfindXML, md *provide
 		} else {
 			response.Propstat[0].Prop = append(response.Propstat[0].Prop, s.newProp("oc:favorite", "0"))
 		}
+		// metadata extracted from the content, like the dimensions of images
+		extracted := metadata.Extracted(md.GetArbitraryMetadata().GetMetadata())
+		names := make([]string, 0, len(extracted))
+		for name := range extracted {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			response.Propstat[0].Prop = append(response.Propstat[0].Prop, s.newProp("oc:"+name, extracted[name]))
+		}
 		// TODO return other properties ... but how do we put them in a namespace?
 	} else {
 		// otherwise return only the requested properties
@@ -322,13 +551,13 @@ func (s *svc) mdToPropResponse(ctx context.Context, pf *propfindXML, md *provide
 						propstatOK.Prop = append(propstatOK.Prop, s.newProp("oc:favorite", "0"))
 					}
 				case "checksums": // desktop
-					if md.Checksum != nil {
-						// TODO(jfd): the actual value is an abomination like this:
+					if xs := checksumsProp(md); xs != "" {
+						// the actual value is an abomination like this:
 						// <oc:checksums>
 						//   <oc:checksum>SHA1:9bd253a09d58be107bcb4169ebf338c8df34d086 MD5:d90bcc6bf847403d22a4abba64e79994 ADLER32:fca23ff5</oc:checksum>
 						// </oc:checksums>
 						// yep, correct, space delimited key value pairs inside an oc:checksum tag inside an oc:checksums tag
-						value := fmt.Sprintf("<oc:checksum>%s:%s</oc:checksum>", md.Checksum.Type, md.Checksum.Sum)
+						value := fmt.Sprintf("<oc:checksum>%s</oc:checksum>", xs)
 						propstatOK.Prop = append(propstatOK.Prop, s.newProp("oc:checksums", value))
 					} else {
 						propstatNotFound.Prop = append(propstatNotFound.Prop, s.newProp("oc:checksums", ""))
@@ -356,7 +585,12 @@ func (s *svc) mdToPropResponse(ctx context.Context, pf *propfindXML, md *provide
 					// </oc:share-types>
 					fallthrough
 				default:
-					propstatNotFound.Prop = append(propstatNotFound.Prop, s.newProp("oc:"+pf.Prop[i].Local, ""))
+					// metadata extracted from the content, like the dimensions of images
+					if v := extractedProp(md, pf.Prop[i].Local); v != "" {
+						propstatOK.Prop = append(propstatOK.Prop, s.newProp("oc:"+pf.Prop[i].Local, v))
+					} else {
+						propstatNotFound.Prop = append(propstatNotFound.Prop, s.newProp("oc:"+pf.Prop[i].Local, ""))
+					}
 				}
 			case "DAV:":
 				switch pf.Prop[i].Local {
@@ -390,11 +624,33 @@ func (s *svc) mdToPropResponse(ctx context.Context, pf *propfindXML, md *provide
 					} else if md.MimeType != "" {
 						propstatOK.Prop = append(propstatOK.Prop, s.newProp("d:getcontenttype", md.MimeType))
 					}
+				case "quota-used-bytes", "quota-available-bytes": // both
+					// only reported on collections
+					if md.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER || quota == nil {
+						propstatNotFound.Prop = append(propstatNotFound.Prop, s.newProp("d:"+pf.Prop[i].Local, ""))
+					} else if pf.Prop[i].Local == "quota-used-bytes" {
+						propstatOK.Prop = append(propstatOK.Prop, s.newProp("d:quota-used-bytes", quota.usedBytes()))
+					} else {
+						propstatOK.Prop = append(propstatOK.Prop, s.newProp("d:quota-available-bytes", quota.availableBytes()))
+					}
 				case "getlastmodified": // both
 					// TODO we cannot find out if md.Mtime is set or not because ints in go default to 0
 					t := utils.TSToTime(md.Mtime).UTC()
 					lastModifiedString := t.Format(time.RFC1123)
 					propstatOK.Prop = append(propstatOK.Prop, s.newProp("d:getlastmodified", lastModifiedString))
+				case "supportedlock":
+					propstatOK.Prop = append(propstatOK.Prop, s.newProp("d:supportedlock",
+						"<d:lockentry><d:lockscope><d:exclusive/></d:lockscope><d:locktype><d:write/></d:locktype></d:lockentry>"))
+				case "lockdiscovery":
+					ls, err := s.locks.Locks(ctx, path.Join(ns, md.Path), false)
+					if err != nil {
+						return nil, err
+					}
+					var value strings.Builder
+					for _, l := range ls {
+						value.WriteString(activeLock(ctx, "d", ns, l))
+					}
+					propstatOK.Prop = append(propstatOK.Prop, s.newProp("d:lockdiscovery", value.String()))
 				default:
 					propstatNotFound.Prop = append(propstatNotFound.Prop, s.newProp("d:"+pf.Prop[i].Local, ""))
 				}
@@ -513,3 +769,25 @@ type errorXML struct {
 }
 
 var errInvalidPropfind = errors.New("webdav: invalid propfind")
+
+// extractedProp returns the metadata extracted from the content of the
+// resource for the property of the oc namespace, empty if there is none.
+func extractedProp(md *provider.ResourceInfo, local string) string {
+	key := metadata.Namespace + local
+	if !metadata.IsExtracted(key) {
+		return ""
+	}
+	return md.GetArbitraryMetadata().GetMetadata()[key]
+}
+
+// checksumsProp returns the checksums of the resource as space separated TYPE:sum pairs,
+// preferring the ones computed on upload over the one reported by the storage.
+func checksumsProp(md *provider.ResourceInfo) string {
+	if xs := md.GetArbitraryMetadata().GetMetadata()[checksums.MetadataKey]; xs != "" {
+		return xs
+	}
+	if md.Checksum != nil && md.Checksum.Sum != "" {
+		return fmt.Sprintf("%s:%s", strings.ToUpper(strings.TrimPrefix(md.Checksum.Type.String(), "RESOURCE_CHECKSUM_TYPE_")), md.Checksum.Sum)
+	}
+	return ""
+}
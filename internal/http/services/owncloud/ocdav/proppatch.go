@@ -20,6 +20,7 @@ package ocdav
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -27,11 +28,11 @@ import (
 	"path"
 	"strings"
 
-	"go.opencensus.io/trace"
-
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/trace"
+	ctxuser "github.com/cs3org/reva/pkg/user"
 	"github.com/pkg/errors"
 )
 
@@ -50,6 +51,10 @@ func (s *svc) handleProppatch(w http.ResponseWriter, r *http.Request, ns string)
 		return
 	}
 
+	if !s.checkLocks(w, r, fn, false) {
+		return
+	}
+
 	c, err := s.getClient()
 	if err != nil {
 		log.Error().Err(err).Msg("error getting grpc client")
@@ -57,6 +62,13 @@ func (s *svc) handleProppatch(w http.ResponseWriter, r *http.Request, ns string)
 		return
 	}
 
+	opaque, err := lockOpaque(r, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("error encoding lock tokens")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	mkeys := []string{}
 
 	pf := &propfindXML{
@@ -67,6 +79,7 @@ func (s *svc) handleProppatch(w http.ResponseWriter, r *http.Request, ns string)
 			Spec: &provider.Reference_Path{Path: fn},
 		},
 		ArbitraryMetadataKeys: []string{},
+		Opaque:                opaque,
 	}
 	sreq := &provider.SetArbitraryMetadataRequest{
 		Ref: &provider.Reference{
@@ -75,6 +88,7 @@ func (s *svc) handleProppatch(w http.ResponseWriter, r *http.Request, ns string)
 		ArbitraryMetadata: &provider.ArbitraryMetadata{
 			Metadata: map[string]string{},
 		},
+		Opaque: opaque,
 	}
 	for i := range pp {
 		if len(pp[i].Props) < 1 {
@@ -166,7 +180,15 @@ func (s *svc) handleProppatch(w http.ResponseWriter, r *http.Request, ns string)
 	info := res.Info
 	infos := []*provider.ResourceInfo{info}
 
-	propRes, err := s.formatPropfind(ctx, pf, infos, ns)
+	if favorite, ok := favoriteChange(sreq, rreq); ok {
+		if err := s.setFavorite(ctx, info.Id, favorite); err != nil {
+			log.Error().Err(err).Msg("error updating the favorites")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	propRes, err := s.formatPropfind(ctx, pf, infos, ns, nil)
 	if err != nil {
 		log.Error().Err(err).Msg("error formatting propfind")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -180,9 +202,34 @@ func (s *svc) handleProppatch(w http.ResponseWriter, r *http.Request, ns string)
 	}
 }
 
+// favoriteChange tells if the favorite flag is set or removed by the requests.
+func favoriteChange(sreq *provider.SetArbitraryMetadataRequest, rreq *provider.UnsetArbitraryMetadataRequest) (bool, bool) {
+	if _, ok := sreq.ArbitraryMetadata.Metadata[favoriteKey]; ok {
+		return true, true
+	}
+	for _, k := range rreq.ArbitraryMetadataKeys {
+		if k == favoriteKey {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// setFavorite adds the resource to the favorites of the user, or removes it.
+func (s *svc) setFavorite(ctx context.Context, id *provider.ResourceId, favorite bool) error {
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		return errors.New("user not found in context")
+	}
+	if favorite {
+		return s.favorites.SetFavorite(ctx, u.Id, id)
+	}
+	return s.favorites.UnsetFavorite(ctx, u.Id, id)
+}
+
 func (s *svc) isBooleanProperty(prop string) bool {
 	// TODO add other properties we know to be boolean?
-	return prop == "http://owncloud.org/ns/favorite"
+	return prop == favoriteKey
 }
 
 func (s *svc) as0or1(val string) string {
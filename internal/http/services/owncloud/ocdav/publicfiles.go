@@ -23,8 +23,10 @@ import (
 	"strings"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	manager "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/token"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc/metadata"
@@ -84,6 +86,17 @@ func (p *PublicFilesHandler) Handler(s *svc) http.Handler {
 			psRequestByToken := manager.GetPublicShareByTokenRequest{
 				Token: getRequestToken(r.URL.Path),
 			}
+			// password protected shares send the password as basic auth
+			if _, password, ok := r.BasicAuth(); ok {
+				psRequestByToken.Opaque = &types.Opaque{
+					Map: map[string]*types.OpaqueEntry{
+						"password": &types.OpaqueEntry{
+							Decoder: "plain",
+							Value:   []byte(password),
+						},
+					},
+				}
+			}
 
 			publicShareResponse, err := gwClient.GetPublicShareByToken(r.Context(), &psRequestByToken)
 			if err != nil {
@@ -92,6 +105,21 @@ func (p *PublicFilesHandler) Handler(s *svc) http.Handler {
 				return
 			}
 
+			switch publicShareResponse.Status.Code {
+			case rpc.Code_CODE_OK:
+			case rpc.Code_CODE_NOT_FOUND:
+				w.WriteHeader(http.StatusNotFound)
+				return
+			case rpc.Code_CODE_UNAUTHENTICATED:
+				w.Header().Set("WWW-Authenticate", `Basic realm="public share"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			default:
+				log.Error().Str("code", publicShareResponse.Status.Code.String()).Msg("error requesting public share")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
 			// now that we got the share we need to get the resource info
 			statReq := provider.StatRequest{
 				Ref: &provider.Reference{
@@ -112,7 +140,7 @@ func (p *PublicFilesHandler) Handler(s *svc) http.Handler {
 
 			sInfo := []*provider.ResourceInfo{statResponse.GetInfo()}
 			// now prepare the dav response with the resource info
-			propRes, err := s.formatPropfind(ctx, &pf, sInfo, "")
+			propRes, err := s.formatPropfind(ctx, &pf, sInfo, "", nil)
 			if err != nil {
 				log.Error().Err(err).Msg("error formatting propfind")
 				w.WriteHeader(http.StatusInternalServerError)
@@ -19,6 +19,7 @@
 package ocdav
 
 import (
+	"io"
 	"net/http"
 	"path"
 	"regexp"
@@ -30,6 +31,7 @@ import (
 	"github.com/cs3org/reva/internal/http/utils"
 	"github.com/cs3org/reva/pkg/appctx"
 	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/storage/conditions"
 )
 
 func isChunked(fn string) (bool, error) {
@@ -68,7 +70,7 @@ func handleMacOSFinder(w http.ResponseWriter, r *http.Request) error {
 	expectedInt, err := strconv.ParseInt(expected, 10, 64)
 	if err != nil {
 		log.Error().Err(err).Msg("error parsing expected length")
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid X-Expected-Entity-Length header")
 		return err
 	}
 	r.ContentLength = expectedInt
@@ -108,7 +110,7 @@ func (s *svc) handlePut(w http.ResponseWriter, r *http.Request, ns string) {
 
 	if r.Body == nil {
 		log.Warn().Msg("body is nil")
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "The request body is missing")
 		return
 	}
 
@@ -139,11 +141,28 @@ func (s *svc) handlePut(w http.ResponseWriter, r *http.Request, ns string) {
 		}
 	}
 
+	if !s.checkLocks(w, r, fn, false) {
+		return
+	}
+
+	s.uploadFile(w, r, fn, r.Body, r.ContentLength)
+}
+
+// uploadFile uploads the content to fn, checking the preconditions of the
+// request against the existing file. It returns whether the file was stored.
+func (s *svc) uploadFile(w http.ResponseWriter, r *http.Request, fn string, content io.Reader, length int64) bool {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	if !s.checkFileType(w, r, fn) {
+		return false
+	}
+
 	client, err := s.getClient()
 	if err != nil {
 		log.Error().Err(err).Msg("error getting grpc client")
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
 	}
 
 	sReq := &provider.StatRequest{
@@ -155,39 +174,42 @@ func (s *svc) handlePut(w http.ResponseWriter, r *http.Request, ns string) {
 	if err != nil {
 		log.Error().Err(err).Msg("error sending grpc stat request")
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
+	}
+
+	if handleUnavailable(w, sRes.Status, sRes.Opaque) {
+		return false
 	}
 
 	if sRes.Status.Code != rpc.Code_CODE_OK {
 		if sRes.Status.Code != rpc.Code_CODE_NOT_FOUND {
 			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return false
 		}
 	}
 
 	info := sRes.Info
 	if info != nil && info.Type != provider.ResourceType_RESOURCE_TYPE_FILE {
 		log.Warn().Msg("resource is not a file")
-		w.WriteHeader(http.StatusConflict)
-		return
+		writeError(w, r, http.StatusConflict, "The resource is not a file")
+		return false
 	}
 
-	if info != nil {
-		clientETag := r.Header.Get("If-Match")
-		serverETag := info.Etag
-		if clientETag != "" {
-			if clientETag != serverETag {
-				log.Warn().Str("client-etag", clientETag).Str("server-etag", serverETag).Msg("etags mismatch")
-				w.WriteHeader(http.StatusPreconditionFailed)
-				return
-			}
-		}
+	if !checkPreconditions(w, r, info) {
+		return false
 	}
 
+	opaque, err := lockOpaque(r, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("error encoding lock tokens")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
 	uReq := &provider.InitiateFileUploadRequest{
 		Ref: &provider.Reference{
 			Spec: &provider.Reference_Path{Path: fn},
 		},
+		Opaque: opaque,
 	}
 
 	// where to upload the file?
@@ -195,48 +217,71 @@ func (s *svc) handlePut(w http.ResponseWriter, r *http.Request, ns string) {
 	if err != nil {
 		log.Error().Err(err).Msg("error initiating file upload")
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
+	}
+
+	if handleUnavailable(w, uRes.Status, uRes.Opaque) {
+		return false
 	}
 
 	if uRes.Status.Code != rpc.Code_CODE_OK {
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
 	}
 
 	dataServerURL := uRes.UploadEndpoint
 	// TODO(labkode): do a protocol switch
-	httpReq, err := rhttp.NewRequest(ctx, "PUT", dataServerURL, r.Body)
+	httpReq, err := rhttp.NewRequest(ctx, "PUT", dataServerURL, content)
 	if err != nil {
 		log.Error().Err(err).Msg("error creating http request")
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
 	}
+	// the data server checks the quota against the announced length
+	httpReq.ContentLength = length
 	httpReq.Header.Set("X-Reva-Transfer", uRes.Token)
+	if xs := r.Header.Get("OC-Checksum"); xs != "" {
+		httpReq.Header.Set("OC-Checksum", xs)
+	}
+	// the data server checks the preconditions again with the upload
+	if p := conditions.FromHeader(r.Header); p != nil {
+		p.SetHeader(httpReq.Header)
+	}
 
 	httpClient := rhttp.GetHTTPClient(ctx)
 	httpRes, err := httpClient.Do(httpReq)
 	if err != nil {
 		log.Error().Err(err).Msg("error doing http request")
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
 	}
 	defer httpRes.Body.Close()
 
 	if httpRes.StatusCode != http.StatusOK {
+		switch httpRes.StatusCode {
+		case http.StatusBadRequest, http.StatusForbidden, http.StatusPreconditionFailed, http.StatusInsufficientStorage:
+			// the data server rejected the content, e.g. because the checksum did not match,
+			// a virus was found, the file changed meanwhile or the quota is exceeded
+			w.WriteHeader(httpRes.StatusCode)
+			return false
+		case http.StatusUnsupportedMediaType:
+			writeError(w, r, http.StatusUnsupportedMediaType, "The file type is not allowed")
+			return false
+		}
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
 	}
 
 	sRes, err = client.Stat(ctx, sReq)
 	if err != nil {
 		log.Error().Err(err).Msg("error sending grpc stat request")
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
 	}
 
 	if sRes.Status.Code != rpc.Code_CODE_OK {
 		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return false
 	}
 
 	info2 := sRes.Info
@@ -253,9 +298,10 @@ func (s *svc) handlePut(w http.ResponseWriter, r *http.Request, ns string) {
 	// file was new
 	if info == nil {
 		w.WriteHeader(http.StatusCreated)
-		return
+		return true
 	}
 
 	// overwrite
 	w.WriteHeader(http.StatusNoContent)
+	return true
 }
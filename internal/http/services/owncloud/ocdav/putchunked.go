@@ -230,6 +230,11 @@ func (s *svc) handlePutChunked(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// refuse the files before their chunks are stored
+	if chunkInfo, err := getChunkBLOBInfo(fn); err == nil && !s.checkFileType(w, r, chunkInfo.path) {
+		return
+	}
+
 	finish, chunk, err := s.saveChunk(ctx, fn, r.Body)
 	if err != nil {
 		log.Error().Err(err).Msg("error saving chunk")
@@ -291,7 +296,7 @@ func (s *svc) handlePutChunked(w http.ResponseWriter, r *http.Request) {
 			serverETag = fmt.Sprintf(`"%s"`, serverETag)
 			if clientETag != serverETag {
 				log.Warn().Str("client-etag", clientETag).Str("server-etag", serverETag).Msg("etags mismatch")
-				w.WriteHeader(http.StatusPreconditionFailed)
+				writeError(w, r, http.StatusPreconditionFailed, "Precondition failed")
 				return
 			}
 		}
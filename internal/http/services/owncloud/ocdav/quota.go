@@ -0,0 +1,86 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"context"
+	"fmt"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+)
+
+// quotaUnlimited is the value of quota-available-bytes used by ownCloud when
+// there is no quota.
+const quotaUnlimited = -3
+
+// quotaInfo holds the quota properties returned for the collections.
+type quotaInfo struct {
+	used      uint64
+	available int64
+}
+
+// wantsQuota tells if the quota properties are requested by the propfind.
+func wantsQuota(pf *propfindXML) bool {
+	if pf.Allprop != nil {
+		return true
+	}
+	for i := range pf.Prop {
+		if pf.Prop[i].Space == "DAV:" && (pf.Prop[i].Local == "quota-used-bytes" || pf.Prop[i].Local == "quota-available-bytes") {
+			return true
+		}
+	}
+	return false
+}
+
+// getQuota returns the quota of the storage holding ref, or nil when it
+// cannot be determined.
+func (s *svc) getQuota(ctx context.Context, client gateway.GatewayAPIClient, ref *provider.Reference) *quotaInfo {
+	log := appctx.GetLogger(ctx)
+	res, err := client.GetQuota(ctx, &gateway.GetQuotaRequest{Ref: ref})
+	if err != nil {
+		log.Error().Err(err).Msg("error sending a grpc get quota request")
+		return nil
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		if res.Status.Code != rpc.Code_CODE_UNIMPLEMENTED {
+			log.Warn().Str("status", res.Status.Code.String()).Msg("error getting quota")
+		}
+		return nil
+	}
+
+	q := &quotaInfo{used: res.UsedBytes, available: quotaUnlimited}
+	if res.TotalBytes > 0 {
+		q.available = 0
+		if res.TotalBytes > res.UsedBytes {
+			q.available = int64(res.TotalBytes - res.UsedBytes)
+		}
+	}
+	return q
+}
+
+func (q *quotaInfo) usedBytes() string {
+	return fmt.Sprintf("%d", q.used)
+}
+
+func (q *quotaInfo) availableBytes() string {
+	return fmt.Sprintf("%d", q.available)
+}
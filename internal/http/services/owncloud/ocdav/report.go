@@ -19,11 +19,27 @@
 package ocdav
 
 import (
+	"context"
+	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/search"
+	"github.com/cs3org/reva/pkg/storage/favorite"
+	favoriteregistry "github.com/cs3org/reva/pkg/storage/favorite/registry"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+	"github.com/pkg/errors"
 )
 
 func (s *svc) handleReport(w http.ResponseWriter, r *http.Request, ns string) {
@@ -38,7 +54,15 @@ func (s *svc) handleReport(w http.ResponseWriter, r *http.Request, ns string) {
 		return
 	}
 	if rep.SearchFiles != nil {
-		s.doSearchFiles(w, r, rep.SearchFiles)
+		s.doSearchFiles(w, r, ns, rep.SearchFiles)
+		return
+	}
+	if rep.FilterFiles != nil {
+		s.doFilterFiles(w, r, ns, rep.FilterFiles)
+		return
+	}
+	if rep.SyncCollection != nil {
+		s.doSyncCollection(w, r, ns, rep.SyncCollection)
 		return
 	}
 
@@ -47,21 +71,207 @@ func (s *svc) handleReport(w http.ResponseWriter, r *http.Request, ns string) {
 	w.WriteHeader(http.StatusNotImplemented)
 }
 
-func (s *svc) doSearchFiles(w http.ResponseWriter, r *http.Request, sf *reportSearchFiles) {
+// doSearchFiles asks the search service for the matches of the pattern and
+// answers with their properties, restricted to the ones below the namespace.
+func (s *svc) doSearchFiles(w http.ResponseWriter, r *http.Request, ns string, sf *reportSearchFiles) {
 	ctx := r.Context()
 	log := appctx.GetLogger(ctx)
-	_, err := s.getClient()
+
+	if s.c.SearchEndpoint == "" {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	client, err := s.getClient()
 	if err != nil {
 		log.Error().Err(err).Msg("error getting grpc client")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusNotImplemented)
+
+	limit := sf.Search.Limit
+	if limit <= 0 {
+		limit = 30
+	}
+	results, err := s.querySearch(r, sf.Search.Pattern, sf.Search.Offset+limit)
+	if err != nil {
+		log.Error().Err(err).Msg("error querying the search service")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if sf.Search.Offset < len(results) {
+		results = results[sf.Search.Offset:]
+	} else {
+		results = nil
+	}
+
+	infos := make([]*provider.ResourceInfo, 0, len(results))
+	for _, res := range results {
+		if res.Path != ns && !strings.HasPrefix(res.Path, strings.TrimSuffix(ns, "/")+"/") {
+			continue
+		}
+		ref := &provider.Reference{
+			Spec: &provider.Reference_Id{Id: &provider.ResourceId{StorageId: res.StorageID, OpaqueId: res.OpaqueID}},
+		}
+		sRes, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+		if err != nil {
+			log.Error().Err(err).Msg("error sending grpc stat request")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if sRes.Status.Code != rpc.Code_CODE_OK {
+			continue
+		}
+		infos = append(infos, sRes.Info)
+	}
+
+	pf := propfindXML{Prop: sf.Prop}
+	if len(pf.Prop) == 0 {
+		pf.Allprop = new(struct{})
+	}
+	propRes, err := s.formatPropfind(ctx, &pf, infos, ns, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("error formatting search results")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("DAV", "1, 3, extended-mkcol")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := w.Write([]byte(propRes)); err != nil {
+		log.Err(err).Msg("error writing response")
+	}
 }
 
+// doFilterFiles answers with the properties of the resources below the
+// requested folder matching the filter rules. Only the favorite rule is
+// supported, as used by clients to list the favorites of the user.
+func (s *svc) doFilterFiles(w http.ResponseWriter, r *http.Request, ns string, ff *reportFilterFiles) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	if s.as0or1(ff.Rules.Favorite) != "1" {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	infos, err := s.listFavorites(ctx, path.Join(ns, r.URL.Path))
+	if err != nil {
+		log.Error().Err(err).Msg("error listing favorites")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	pf := propfindXML{Prop: ff.Prop}
+	if len(pf.Prop) == 0 {
+		pf.Allprop = new(struct{})
+	}
+	propRes, err := s.formatPropfind(ctx, &pf, infos, ns, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("error formatting filter results")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("DAV", "1, 3, extended-mkcol")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := w.Write([]byte(propRes)); err != nil {
+		log.Err(err).Msg("error writing response")
+	}
+}
+
+// listFavorites returns the favorites of the user below the folder fn. They
+// are stat'ed to get their path and to check the favorite flag, which the
+// favorite manager may not know was removed, e.g. by another client.
+func (s *svc) listFavorites(ctx context.Context, fn string) ([]*provider.ResourceInfo, error) {
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		return nil, errors.New("user not found in context")
+	}
+	ids, err := s.favorites.ListFavorites(ctx, u.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting grpc client")
+	}
+	infos := []*provider.ResourceInfo{}
+	for _, id := range ids {
+		req := &provider.StatRequest{
+			Ref:                   &provider.Reference{Spec: &provider.Reference_Id{Id: id}},
+			ArbitraryMetadataKeys: []string{favoriteKey},
+		}
+		res, err := client.Stat(ctx, req)
+		if err != nil {
+			return nil, errors.Wrap(err, "error sending grpc stat request")
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			continue
+		}
+		if isFavorite(res.Info) && (res.Info.Path == fn || strings.HasPrefix(res.Info.Path, strings.TrimSuffix(fn, "/")+"/")) {
+			infos = append(infos, res.Info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos, nil
+}
+
+// isFavorite tells if the favorite flag of the resource is set.
+func isFavorite(info *provider.ResourceInfo) bool {
+	v := info.GetArbitraryMetadata().GetMetadata()[favoriteKey]
+	return v != "" && v != "0"
+}
+
+// newFavoriteManager returns the configured favorite manager.
+func newFavoriteManager(c *Config) (favorite.Manager, error) {
+	f, ok := favoriteregistry.NewFuncs[c.FavoriteManager]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not found for favorite manager", c.FavoriteManager)
+	}
+	return f(c.FavoriteManagers[c.FavoriteManager])
+}
+
+// querySearch calls the search service on behalf of the user.
+func (s *svc) querySearch(r *http.Request, pattern string, limit int) ([]*search.Result, error) {
+	ctx := r.Context()
+	u, err := url.Parse(s.c.SearchEndpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing search endpoint")
+	}
+	q := u.Query()
+	q.Set("q", pattern)
+	q.Set("limit", strconv.Itoa(limit))
+	u.RawQuery = q.Encode()
+
+	httpReq, err := rhttp.NewRequest(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "error calling the search service")
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search service answered with status %d", httpRes.StatusCode)
+	}
+
+	res := &search.Response{}
+	if err := json.NewDecoder(httpRes.Body).Decode(res); err != nil {
+		return nil, errors.Wrap(err, "error decoding search results")
+	}
+	return res.Results, nil
+}
+
+// favoriteKey is the arbitrary metadata key of the favorite flag.
+const favoriteKey = "http://owncloud.org/ns/favorite"
+
 type report struct {
-	SearchFiles *reportSearchFiles
-	// FilterFiles TODO add this for tag based search
+	SearchFiles    *reportSearchFiles
+	FilterFiles    *reportFilterFiles
+	SyncCollection *reportSyncCollection
 }
 type reportSearchFiles struct {
 	XMLName xml.Name                `xml:"search-files"`
@@ -75,6 +285,16 @@ type reportSearchFilesSearch struct {
 	Offset  int    `xml:"offset"`
 }
 
+type reportFilterFiles struct {
+	XMLName xml.Name               `xml:"filter-files"`
+	Prop    propfindProps          `xml:"DAV: prop"`
+	Rules   reportFilterFilesRules `xml:"filter-rules"`
+}
+type reportFilterFilesRules struct {
+	Favorite string `xml:"favorite"`
+	// SystemTags TODO add this for tag based search
+}
+
 func readReport(r io.Reader) (rep *report, status int, err error) {
 	decoder := xml.NewDecoder(r)
 	rep = &report{}
@@ -97,6 +317,22 @@ func readReport(r io.Reader) (rep *report, status int, err error) {
 				}
 				rep.SearchFiles = &repSF
 			}
+			if v.Name.Local == "filter-files" {
+				var repFF reportFilterFiles
+				err = decoder.DecodeElement(&repFF, &v)
+				if err != nil {
+					return nil, http.StatusBadRequest, err
+				}
+				rep.FilterFiles = &repFF
+			}
+			if v.Name.Local == "sync-collection" {
+				var repSC reportSyncCollection
+				err = decoder.DecodeElement(&repSC, &v)
+				if err != nil {
+					return nil, http.StatusBadRequest, err
+				}
+				rep.SyncCollection = &repSC
+			}
 		}
 	}
 }
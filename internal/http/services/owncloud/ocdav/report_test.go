@@ -0,0 +1,108 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage/favorite/memory"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+func resource(id, p, favorite string) *provider.ResourceInfo {
+	return &provider.ResourceInfo{
+		Id:                &provider.ResourceId{StorageId: "home", OpaqueId: id},
+		Path:              p,
+		ArbitraryMetadata: &provider.ArbitraryMetadata{Metadata: map[string]string{favoriteKey: favorite}},
+	}
+}
+
+func TestListFavorites(t *testing.T) {
+	g := &testGateway{infos: []*provider.ResourceInfo{
+		resource("notes", "/home/docs/notes.txt", "1"),
+		resource("docs", "/home/docs", "1"),
+		resource("photos", "/home/photos", "1"),
+		// unmarked by another client
+		resource("old", "/home/docs/old.txt", ""),
+	}}
+	fm, err := memory.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &svc{c: &Config{GatewaySvc: startGateway(t, g)}, favorites: fm}
+
+	einstein := &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein", Idp: "cernbox.cern.ch"}}
+	ctx := ctxuser.ContextSetUser(context.Background(), einstein)
+	for _, id := range []string{"notes", "docs", "photos", "old", "deleted"} {
+		if err := fm.SetFavorite(ctx, einstein.Id, &provider.ResourceId{StorageId: "home", OpaqueId: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		folder   string
+		expected []string
+	}{
+		{"/home", []string{"/home/docs", "/home/docs/notes.txt", "/home/photos"}},
+		{"/home/docs", []string{"/home/docs", "/home/docs/notes.txt"}},
+		{"/home/doc", nil},
+	}
+	for _, tt := range tests {
+		infos, err := s.listFavorites(ctx, tt.folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, info := range infos {
+			paths = append(paths, info.Path)
+		}
+		if len(paths) != len(tt.expected) {
+			t.Errorf("favorites below %s: got %v, expected %v", tt.folder, paths, tt.expected)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != tt.expected[i] {
+				t.Errorf("favorites below %s: got %v, expected %v", tt.folder, paths, tt.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestFavoriteChange(t *testing.T) {
+	set := &provider.SetArbitraryMetadataRequest{ArbitraryMetadata: &provider.ArbitraryMetadata{Metadata: map[string]string{}}}
+	unset := &provider.UnsetArbitraryMetadataRequest{}
+	if _, ok := favoriteChange(set, unset); ok {
+		t.Error("expected no change of the favorite flag")
+	}
+
+	set.ArbitraryMetadata.Metadata[favoriteKey] = "1"
+	if favorite, ok := favoriteChange(set, unset); !ok || !favorite {
+		t.Error("expected the favorite flag to be set")
+	}
+
+	delete(set.ArbitraryMetadata.Metadata, favoriteKey)
+	unset.ArbitraryMetadataKeys = []string{"http://owncloud.org/ns/tags", favoriteKey}
+	if favorite, ok := favoriteChange(set, unset); !ok || favorite {
+		t.Error("expected the favorite flag to be removed")
+	}
+}
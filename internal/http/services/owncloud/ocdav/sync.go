@@ -0,0 +1,308 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/storage/journal"
+	"github.com/pkg/errors"
+)
+
+// syncTokenPrefix makes URIs of the tokens of the journals, as RFC 6578
+// requires.
+const syncTokenPrefix = "http://owncloud.org/ns/sync/"
+
+// reportSyncCollection is the sync-collection REPORT, see
+// https://tools.ietf.org/html/rfc6578#section-3.2
+type reportSyncCollection struct {
+	XMLName   xml.Name      `xml:"sync-collection"`
+	SyncToken string        `xml:"sync-token"`
+	SyncLevel string        `xml:"sync-level"`
+	Prop      propfindProps `xml:"DAV: prop"`
+}
+
+// doSyncCollection answers with the members of the folder changed since the
+// sync token, with their properties, and the removed ones with a 404, or
+// with all the members without token. The direct members are reported with
+// the sync level 1, the changes below them reporting the member containing
+// them, and all the members below the folder with the level infinite.
+func (s *svc) doSyncCollection(w http.ResponseWriter, r *http.Request, ns string, sc *reportSyncCollection) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+	fn := path.Join(ns, r.URL.Path)
+
+	infinite := false
+	switch sc.SyncLevel {
+	case "", "1":
+	case "infinite":
+		infinite = true
+	default:
+		writeError(w, r, http.StatusBadRequest, "Invalid sync level")
+		return
+	}
+
+	token := strings.TrimSpace(sc.SyncToken)
+	if token != "" && !strings.HasPrefix(token, syncTokenPrefix) {
+		writeSyncTokenError(w, r)
+		return
+	}
+	token = strings.TrimPrefix(token, syncTokenPrefix)
+
+	client, err := s.getClient()
+	if err != nil {
+		log.Error().Err(err).Msg("error getting grpc client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res, err := client.ListContainer(ctx, &provider.ListContainerRequest{
+		Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: fn}},
+		Opaque: &typespb.Opaque{Map: map[string]*typespb.OpaqueEntry{
+			journal.TokenOpaqueKey: {Decoder: "plain", Value: []byte(token)},
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("error sending list container grpc request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		log.Debug().Str("path", fn).Msg("resource not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case rpc.Code_CODE_FAILED_PRECONDITION:
+		log.Debug().Str("path", fn).Str("token", token).Msg("invalid sync token")
+		writeSyncTokenError(w, r)
+		return
+	case rpc.Code_CODE_UNIMPLEMENTED:
+		writeError(w, r, http.StatusNotImplemented, "The changes of this folder are not recorded")
+		return
+	default:
+		log.Error().Str("path", fn).Str("code", res.Status.Code.String()).Msg("error listing changes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	next := string(res.Opaque.GetMap()[journal.TokenOpaqueKey].GetValue())
+	var infos []*provider.ResourceInfo
+	var removed []string
+	if token == "" {
+		infos, err = s.syncMembers(ctx, client, fn, infinite)
+	} else {
+		if e, ok := res.Opaque.GetMap()[journal.RemovedOpaqueKey]; ok {
+			if err := json.Unmarshal(e.Value, &removed); err != nil {
+				log.Error().Err(err).Msg("error decoding removed resources")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		infos, removed, err = s.syncChanges(ctx, client, fn, res.Infos, removed, infinite)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", fn).Msg("error listing changed members")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	pf := propfindXML{Prop: sc.Prop}
+	if len(pf.Prop) == 0 {
+		pf.Allprop = new(struct{})
+	}
+	responses := make([]*responseXML, 0, len(infos)+len(removed))
+	for _, info := range infos {
+		res, err := s.mdToPropResponse(ctx, &pf, info, ns, nil)
+		if err != nil {
+			log.Error().Err(err).Msg("error formatting sync results")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		responses = append(responses, res)
+	}
+	baseURI := ctx.Value(ctxKeyBaseURI).(string)
+	for _, rel := range removed {
+		ref := path.Join(baseURI, strings.TrimPrefix(fn, ns), rel)
+		responses = append(responses, &responseXML{
+			Href:   (&url.URL{Path: ref}).EscapedPath(),
+			Status: "HTTP/1.1 404 Not Found",
+		})
+	}
+	responsesXML, err := xml.Marshal(&responses)
+	if err != nil {
+		log.Error().Err(err).Msg("error encoding sync results")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	tokenXML := &strings.Builder{}
+	if err := xml.EscapeText(tokenXML, []byte(syncTokenPrefix+next)); err != nil {
+		log.Error().Err(err).Msg("error encoding sync token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("DAV", "1, 3, extended-mkcol")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	body := multistatusStart + string(responsesXML) + "<d:sync-token>" + tokenXML.String() + "</d:sync-token>" + multistatusEnd
+	if _, err := w.Write([]byte(body)); err != nil {
+		log.Err(err).Msg("error writing response")
+	}
+}
+
+// writeSyncTokenError refuses the sync tokens which are invalid or too old,
+// the clients then sync again without token.
+func writeSyncTokenError(w http.ResponseWriter, r *http.Request) {
+	body, err := xml.Marshal(&struct {
+		errorXML
+		XmlnsD string `xml:"xmlns:d,attr"`
+	}{errorXML: errorXML{InnerXML: []byte("<d:valid-sync-token/>")}, XmlnsD: "DAV:"})
+	if err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("error encoding error body")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	if _, err := w.Write(append([]byte(xml.Header), body...)); err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("error writing error body")
+	}
+}
+
+// syncMembers returns the members of the folder, or all the resources below
+// it with infinite.
+func (s *svc) syncMembers(ctx context.Context, client gateway.GatewayAPIClient, fn string, infinite bool) ([]*provider.ResourceInfo, error) {
+	infos := []*provider.ResourceInfo{}
+	folders := []string{fn}
+	for len(folders) > 0 {
+		dir := folders[0]
+		folders = folders[1:]
+
+		res, err := client.ListContainer(ctx, &provider.ListContainerRequest{
+			Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: dir}},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error listing "+dir)
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return nil, status.NewErrorFromCode(res.Status.Code, "ocdav")
+		}
+		for _, info := range res.Infos {
+			infos = append(infos, info)
+			// shares are not followed, their changes are not recorded here
+			if infinite && info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+				folders = append(folders, info.Path)
+			}
+		}
+	}
+	return infos, nil
+}
+
+// syncChanges turns the changed and removed resources below the folder into
+// the members to report. With the level 1 the changes below a member are
+// reported as a change of the member. With infinite the folders changed,
+// created or moved there, are reported with their content.
+func (s *svc) syncChanges(ctx context.Context, client gateway.GatewayAPIClient, fn string, changed []*provider.ResourceInfo, removed []string, infinite bool) ([]*provider.ResourceInfo, []string, error) {
+	prefix := strings.TrimSuffix(fn, "/") + "/"
+	infos := map[string]*provider.ResourceInfo{}
+	gone := map[string]bool{}
+
+	if infinite {
+		for _, info := range changed {
+			infos[info.Path] = info
+			if info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+				continue
+			}
+			below, err := s.syncMembers(ctx, client, info.Path, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, b := range below {
+				infos[b.Path] = b
+			}
+		}
+		for _, rel := range removed {
+			gone[rel] = true
+		}
+	} else {
+		// the members containing deeper changes are statted
+		members := map[string]bool{}
+		for _, info := range changed {
+			rel := strings.TrimPrefix(info.Path, prefix)
+			if !strings.Contains(rel, "/") {
+				infos[info.Path] = info
+				continue
+			}
+			members[strings.SplitN(rel, "/", 2)[0]] = true
+		}
+		for _, rel := range removed {
+			if !strings.Contains(rel, "/") {
+				gone[rel] = true
+				continue
+			}
+			members[strings.SplitN(rel, "/", 2)[0]] = true
+		}
+		for m := range members {
+			p := path.Join(fn, m)
+			if _, ok := infos[p]; ok || gone[m] {
+				continue
+			}
+			res, err := client.Stat(ctx, &provider.StatRequest{
+				Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: p}},
+			})
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "error statting "+p)
+			}
+			switch res.Status.Code {
+			case rpc.Code_CODE_OK:
+				infos[p] = res.Info
+			case rpc.Code_CODE_NOT_FOUND:
+				gone[m] = true
+			default:
+				return nil, nil, status.NewErrorFromCode(res.Status.Code, "ocdav")
+			}
+		}
+	}
+
+	list := make([]*provider.ResourceInfo, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	paths := make([]string, 0, len(gone))
+	for rel := range gone {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return list, paths, nil
+}
@@ -20,9 +20,60 @@ package ocdav
 
 import (
 	"net/http"
+	"path"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/locks"
+	ctxuser "github.com/cs3org/reva/pkg/user"
 )
 
-//TODO(jfd): implement unlock
+// handleUnlock removes the lock whose token is sent in the Lock-Token
+// header. Only the user who created a lock may remove it.
 func (s *svc) handleUnlock(w http.ResponseWriter, r *http.Request, ns string) {
-	w.WriteHeader(http.StatusNotImplemented)
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+	fn := path.Join(ns, r.URL.Path)
+
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	token := strings.TrimSpace(r.Header.Get("Lock-Token"))
+	if !strings.HasPrefix(token, "<") || !strings.HasSuffix(token, ">") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	token = token[1 : len(token)-1]
+
+	l, err := s.lockWithToken(ctx, fn, token)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			// the token does not match a lock on the resource, see
+			// http://www.webdav.org/specs/rfc4918.html#METHOD_UNLOCK
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		log.Error().Err(err).Msg("error reading locks")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if l.UserID != locks.UserID(u.GetId()) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if err := s.locks.Unlock(ctx, token); err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		log.Error().Err(err).Msg("error removing lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
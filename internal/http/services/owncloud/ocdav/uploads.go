@@ -0,0 +1,262 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocdav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/storage/chunking"
+	"github.com/cs3org/reva/pkg/storage/chunking/registry"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+// UploadsHandler implements the chunking NG protocol of the ownCloud and
+// Nextcloud clients: the chunks are uploaded to a folder created with MKCOL
+// below /dav/uploads/<user>/ and assembled when the client moves the .file
+// child of that folder to its destination in the files namespace.
+type UploadsHandler struct {
+	store          chunking.Store
+	filesNamespace string
+}
+
+func (h *UploadsHandler) init(c *Config) error {
+	f, ok := registry.NewFuncs[c.ChunkStore]
+	if !ok {
+		return fmt.Errorf("driver %s not found for chunk store", c.ChunkStore)
+	}
+	store, err := f(c.ChunkStores[c.ChunkStore])
+	if err != nil {
+		return err
+	}
+	h.store = store
+	h.filesNamespace = path.Join("/", c.FilesNamespace)
+	return nil
+}
+
+// Handler handles requests
+func (h *UploadsHandler) Handler(s *svc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := appctx.GetLogger(ctx)
+
+		u, ok := ctxuser.ContextGetUser(ctx)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var username, transfer, chunk string
+		username, r.URL.Path = router.ShiftPath(r.URL.Path)
+		transfer, r.URL.Path = router.ShiftPath(r.URL.Path)
+		chunk, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+		if username != u.Username {
+			log.Warn().Str("username", username).Msg("user tried to access the uploads of another user")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if transfer == "" || r.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		id := username + "/" + transfer
+
+		switch {
+		case chunk == "" && r.Method == "MKCOL":
+			h.create(w, r, id)
+		case chunk == "" && r.Method == "PROPFIND":
+			h.list(w, r, id)
+		case chunk == "" && r.Method == http.MethodDelete:
+			h.delete(w, r, id)
+		case chunk != "" && r.Method == http.MethodPut:
+			h.putChunk(w, r, id, chunk)
+		case chunk == ".file" && r.Method == "MOVE":
+			h.assemble(w, r, s, id)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (h *UploadsHandler) create(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	if err := h.store.Create(ctx, id); err != nil {
+		if _, ok := err.(errtypes.IsAlreadyExists); ok {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		appctx.GetLogger(ctx).Error().Err(err).Str("upload", id).Msg("error creating upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *UploadsHandler) putChunk(w http.ResponseWriter, r *http.Request, id, chunk string) {
+	ctx := r.Context()
+	if chunk == ".file" || strings.HasPrefix(chunk, ".") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if _, err := h.store.PutChunk(ctx, id, chunk, r.Body); err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			// the upload folder has to be created first
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		appctx.GetLogger(ctx).Error().Err(err).Str("upload", id).Str("chunk", chunk).Msg("error storing chunk")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *UploadsHandler) delete(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	if err := h.store.Delete(ctx, id); err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		appctx.GetLogger(ctx).Error().Err(err).Str("upload", id).Msg("error deleting upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list lets the clients find out which chunks were already uploaded when resuming an upload.
+func (h *UploadsHandler) list(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	chunks, err := h.store.ListChunks(ctx, id)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Error().Err(err).Str("upload", id).Msg("error listing chunks")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	base := path.Join(ctx.Value(ctxKeyBaseURI).(string), id)
+	responses := []*responseXML{
+		uploadPropResponse(base+"/", "<d:collection/>", "", time.Time{}),
+	}
+	if r.Header.Get("Depth") != "0" {
+		for _, c := range chunks {
+			responses = append(responses, uploadPropResponse(path.Join(base, c.Name), "", strconv.FormatInt(c.Size, 10), c.Mtime))
+		}
+	}
+
+	responsesXML, err := xml.Marshal(&responses)
+	if err != nil {
+		log.Error().Err(err).Msg("error formatting propfind")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("DAV", "1, 3, extended-mkcol")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	msg := `<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:" `
+	msg += `xmlns:s="http://sabredav.org/ns" xmlns:oc="http://owncloud.org/ns">`
+	msg += string(responsesXML) + `</d:multistatus>`
+	if _, err := w.Write([]byte(msg)); err != nil {
+		log.Err(err).Msg("error writing response")
+	}
+}
+
+func uploadPropResponse(href, resourceType, size string, mtime time.Time) *responseXML {
+	props := []*propertyXML{
+		{XMLName: xml.Name{Local: "d:resourcetype"}, InnerXML: []byte(resourceType)},
+	}
+	if size != "" {
+		props = append(props, &propertyXML{XMLName: xml.Name{Local: "d:getcontentlength"}, InnerXML: []byte(size)})
+	}
+	if !mtime.IsZero() {
+		props = append(props, &propertyXML{XMLName: xml.Name{Local: "d:getlastmodified"}, InnerXML: []byte(mtime.UTC().Format(time.RFC1123))})
+	}
+	return &responseXML{
+		Href:     (&url.URL{Path: href}).EscapedPath(),
+		Propstat: []propstatXML{{Status: "HTTP/1.1 200 OK", Prop: props}},
+	}
+}
+
+// assemble uploads the chunks as one file to the destination of the move.
+func (h *UploadsHandler) assemble(w http.ResponseWriter, r *http.Request, s *svc, id string) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	dstURL, err := url.ParseRequestURI(r.Header.Get("Destination"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the destination lives in the files endpoint next to the uploads one
+	filesBase := path.Join(path.Dir(ctx.Value(ctxKeyBaseURI).(string)), "files")
+	if !strings.HasPrefix(dstURL.Path, filesBase+"/") {
+		log.Warn().Str("destination", dstURL.Path).Msg("chunked upload destination is not in the files namespace")
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	dst := path.Join(h.filesNamespace, dstURL.Path[len(filesBase):])
+
+	content, size, err := h.store.Assemble(ctx, id)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Error().Err(err).Str("upload", id).Msg("error assembling chunks")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	if l := r.Header.Get("OC-Total-Length"); l != "" {
+		if total, err := strconv.ParseInt(l, 10, 64); err != nil || total != size {
+			log.Warn().Str("upload", id).Str("total_length", l).Int64("size", size).Msg("chunks do not match the announced length")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !s.uploadFile(w, r, dst, content, size) {
+		// keep the chunks so that the client can retry the move
+		return
+	}
+
+	if err := h.store.Delete(ctx, id); err != nil {
+		log.Warn().Err(err).Str("upload", id).Msg("error deleting assembled upload")
+	}
+}
@@ -20,6 +20,7 @@ package ocdav
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"path"
 
@@ -27,6 +28,7 @@ import (
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rhttp"
 	"github.com/cs3org/reva/pkg/rhttp/router"
 )
 
@@ -60,8 +62,11 @@ func (h *VersionsHandler) Handler(s *svc, rid *provider.ResourceId) http.Handler
 			h.doListVersions(w, r, s, rid)
 			return
 		}
+		if key != "" && r.Method == "GET" {
+			h.doDownload(w, r, s, rid, key)
+			return
+		}
 		if key != "" && r.Method == "COPY" {
-			// TODO(jfd) it seems we cannot directly GET version content with cs3 ...
 			// TODO(jfd) cs3api has no delete file version call
 			// TODO(jfd) restore version to given Destination, but cs3api has no destination
 			h.doRestore(w, r, s, rid, key)
@@ -166,7 +171,7 @@ func (h *VersionsHandler) doListVersions(w http.ResponseWriter, r *http.Request,
 		infos = append(infos, vi)
 	}
 
-	propRes, err := s.formatPropfind(ctx, &pf, infos, "")
+	propRes, err := s.formatPropfind(ctx, &pf, infos, "", nil)
 	if err != nil {
 		log.Error().Err(err).Msg("error formatting propfind")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -207,6 +212,10 @@ func (h *VersionsHandler) doRestore(w http.ResponseWriter, r *http.Request, s *s
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if handleUnavailable(w, res.Status, res.Opaque) {
+		return
+	}
+
 	if res.Status.Code != rpc.Code_CODE_OK {
 		if res.Status.Code == rpc.Code_CODE_NOT_FOUND {
 			w.WriteHeader(http.StatusNotFound)
@@ -217,3 +226,83 @@ func (h *VersionsHandler) doRestore(w http.ResponseWriter, r *http.Request, s *s
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *VersionsHandler) doDownload(w http.ResponseWriter, r *http.Request, s *svc, rid *provider.ResourceId, key string) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	client, err := s.getClient()
+	if err != nil {
+		log.Error().Err(err).Msg("error getting grpc client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sRes, err := client.Stat(ctx, &provider.StatRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Id{Id: rid},
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("error sending a grpc stat request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if sRes.Status.Code != rpc.Code_CODE_OK {
+		if sRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	dRes, err := client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{
+		Opaque: &types.Opaque{
+			Map: map[string]*types.OpaqueEntry{
+				"version": &types.OpaqueEntry{
+					Decoder: "plain",
+					Value:   []byte(key),
+				},
+			},
+		},
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: sRes.Info.Path},
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("error initiating version download")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if dRes.Status.Code != rpc.Code_CODE_OK {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	httpReq, err := rhttp.NewRequest(ctx, "GET", dRes.DownloadEndpoint, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("error creating http request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	httpReq.Header.Set("X-Reva-Transfer", dRes.Token)
+
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(httpReq)
+	if err != nil {
+		log.Error().Err(err).Msg("error performing http request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.StatusCode != http.StatusOK {
+		w.WriteHeader(httpRes.StatusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", sRes.Info.MimeType)
+	if _, err := io.Copy(w, httpRes.Body); err != nil {
+		log.Error().Err(err).Msg("error finishing copying data to response")
+	}
+}
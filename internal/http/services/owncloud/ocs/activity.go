@@ -0,0 +1,187 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocs
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/internal/http/services/owncloud/ocs/conversions"
+	"github.com/cs3org/reva/pkg/activity"
+	"github.com/cs3org/reva/pkg/activity/manager/registry"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 200
+)
+
+// ActivityHandler serves the activities recorded by the activities service,
+// the ones of the user or the history of a file.
+type ActivityHandler struct {
+	gatewayAddr string
+	mgr         activity.Manager
+}
+
+// ActivityData describes an activity, the paths are relative to the home.
+type ActivityData struct {
+	ActivityID int64  `json:"activity_id" xml:"activity_id"`
+	Type       string `json:"type" xml:"type"`
+	User       string `json:"user" xml:"user"`
+	Datetime   string `json:"datetime" xml:"datetime"`
+	ObjectType string `json:"object_type" xml:"object_type"`
+	ObjectID   string `json:"object_id" xml:"object_id"`
+	ObjectName string `json:"object_name" xml:"object_name"`
+	OldName    string `json:"old_name,omitempty" xml:"old_name,omitempty"`
+	Version    string `json:"version,omitempty" xml:"version,omitempty"`
+	ShareWith  string `json:"share_with,omitempty" xml:"share_with,omitempty"`
+}
+
+func (h *ActivityHandler) init(c *Config) error {
+	h.gatewayAddr = c.GatewaySvc
+	if c.ActivityManager == "" {
+		return nil
+	}
+	f, ok := registry.NewFuncs[c.ActivityManager]
+	if !ok {
+		return fmt.Errorf("driver %s not found for activity manager", c.ActivityManager)
+	}
+	mgr, err := f(c.ActivityManagers[c.ActivityManager])
+	if err != nil {
+		return err
+	}
+	h.mgr = mgr
+	return nil
+}
+
+// ServeHTTP lists the activities of the user, or of the file at the path
+// given relative to the home. The activities are paged with since, the id of
+// the last activity received, given in the X-Activity-Last-Given header.
+func (h *ActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.mgr == nil || r.Method != http.MethodGet {
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+		return
+	}
+	ctx := r.Context()
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "missing user in context", nil)
+		return
+	}
+
+	f := &activity.Filter{Limit: defaultActivityLimit}
+	q := r.URL.Query()
+	if v := q.Get("since"); v != "" {
+		since, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || since < 0 {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "since must be an activity id", nil)
+			return
+		}
+		f.Since = since
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "limit must be a positive number", nil)
+			return
+		}
+		if limit > maxActivityLimit {
+			limit = maxActivityLimit
+		}
+		f.Limit = limit
+	}
+
+	client, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting grpc gateway client", err)
+		return
+	}
+	hRes, err := client.GetHome(ctx, &provider.GetHomeRequest{})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc get home request", err)
+		return
+	}
+	home := hRes.GetPath()
+
+	if p := q.Get("path"); p != "" {
+		// the history of a file is shown to whoever can access it
+		ref := &provider.Reference{Spec: &provider.Reference_Path{Path: strings.TrimSuffix(home, "/") + "/" + strings.TrimPrefix(p, "/")}}
+		sRes, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+		if err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc stat request", err)
+			return
+		}
+		if sRes.Status.Code != rpc.Code_CODE_OK {
+			if sRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
+				WriteOCSError(w, r, MetaNotFound.StatusCode, "not found", nil)
+				return
+			}
+			WriteOCSError(w, r, MetaServerError.StatusCode, "grpc stat request failed", nil)
+			return
+		}
+		f.Resource = sRes.Info.Id
+	} else {
+		f.User = u.Id
+	}
+
+	list, err := h.mgr.List(ctx, f)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error listing activities", err)
+		return
+	}
+
+	data := make([]*ActivityData, 0, len(list))
+	for _, a := range list {
+		data = append(data, activityData(a, home))
+	}
+	if len(list) > 0 {
+		w.Header().Set("X-Activity-Last-Given", strconv.FormatInt(list[len(list)-1].ID, 10))
+	}
+	WriteOCSSuccess(w, r, &conversions.Element{Data: data})
+}
+
+func activityData(a *activity.Activity, home string) *ActivityData {
+	return &ActivityData{
+		ActivityID: a.ID,
+		Type:       a.Type,
+		User:       a.Actor.GetOpaqueId(),
+		Datetime:   a.Time.Format(time.RFC3339),
+		ObjectType: "files",
+		ObjectID:   a.Resource.GetOpaqueId(),
+		ObjectName: relativePath(a.Path, home),
+		OldName:    relativePath(a.OldPath, home),
+		Version:    a.Version,
+		ShareWith:  a.ShareWith.GetOpaqueId(),
+	}
+}
+
+// relativePath strips the home from the paths of the files in the home.
+func relativePath(p, home string) string {
+	if home == "" || home == "/" || !strings.HasPrefix(p, home+"/") {
+		return p
+	}
+	return strings.TrimPrefix(p, home)
+}
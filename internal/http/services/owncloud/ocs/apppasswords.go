@@ -0,0 +1,154 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocs
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cs3org/reva/internal/http/services/owncloud/ocs/conversions"
+	"github.com/cs3org/reva/pkg/appauth"
+	"github.com/cs3org/reva/pkg/appauth/manager/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+)
+
+// AppPasswordsHandler lets the users manage their app passwords.
+type AppPasswordsHandler struct {
+	mgr appauth.Manager
+}
+
+// AppPasswordData holds the details of an app password. The password itself
+// is only returned when it is generated.
+type AppPasswordData struct {
+	ID         string `json:"id" xml:"id"`
+	Password   string `json:"password,omitempty" xml:"password,omitempty"`
+	Label      string `json:"label" xml:"label"`
+	Scope      string `json:"scope" xml:"scope"`
+	Expiration int64  `json:"expiration" xml:"expiration"`
+	Ctime      int64  `json:"ctime" xml:"ctime"`
+	Utime      int64  `json:"utime" xml:"utime"`
+}
+
+func (h *AppPasswordsHandler) init(c *Config) error {
+	f, ok := registry.NewFuncs[c.AppPasswordManager]
+	if !ok {
+		return fmt.Errorf("driver %s not found for app password manager", c.AppPasswordManager)
+	}
+	mgr, err := f(c.AppPasswordManagers[c.AppPasswordManager])
+	if err != nil {
+		return err
+	}
+	h.mgr = mgr
+	return nil
+}
+
+func (h *AppPasswordsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var head string
+	head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+	switch {
+	case head == "" && r.Method == http.MethodGet:
+		h.list(w, r)
+	case head == "" && r.Method == http.MethodPost:
+		h.generate(w, r)
+	case head != "" && r.Method == http.MethodDelete:
+		h.invalidate(w, r, head)
+	default:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	}
+}
+
+func (h *AppPasswordsHandler) generate(w http.ResponseWriter, r *http.Request) {
+	scope := r.FormValue("scope")
+	if scope == "" {
+		scope = appauth.ScopeFull
+	}
+	if !appauth.ValidScope(scope) {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "unknown scope: "+scope, nil)
+		return
+	}
+
+	// expiration is given as a unix timestamp, no expiration means the password never expires
+	var expiration time.Time
+	if e := r.FormValue("expiration"); e != "" {
+		secs, err := strconv.ParseInt(e, 10, 64)
+		if err != nil {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "invalid expiration", err)
+			return
+		}
+		expiration = time.Unix(secs, 0)
+		if expiration.Before(time.Now()) {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "expiration must be in the future", nil)
+			return
+		}
+	}
+
+	a, password, err := h.mgr.GenerateAppPassword(r.Context(), r.FormValue("label"), scope, expiration)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error generating app password", err)
+		return
+	}
+
+	data := appPasswordData(a)
+	data.Password = password
+	WriteOCSSuccess(w, r, data)
+}
+
+func (h *AppPasswordsHandler) list(w http.ResponseWriter, r *http.Request) {
+	list, err := h.mgr.ListAppPasswords(r.Context())
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error listing app passwords", err)
+		return
+	}
+
+	passwords := make([]*AppPasswordData, 0, len(list))
+	for _, a := range list {
+		passwords = append(passwords, appPasswordData(a))
+	}
+	WriteOCSSuccess(w, r, &conversions.Element{Data: passwords})
+}
+
+func (h *AppPasswordsHandler) invalidate(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.mgr.InvalidateAppPassword(r.Context(), id); err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			WriteOCSError(w, r, MetaNotFound.StatusCode, "app password not found", nil)
+			return
+		}
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error invalidating app password", err)
+		return
+	}
+	WriteOCSSuccess(w, r, nil)
+}
+
+func appPasswordData(a *appauth.AppPassword) *AppPasswordData {
+	d := &AppPasswordData{
+		ID:    a.ID,
+		Label: a.Label,
+		Scope: a.Scope,
+		Ctime: a.Ctime.Unix(),
+		Utime: a.Utime.Unix(),
+	}
+	if !a.Expiration.IsZero() {
+		d.Expiration = a.Expiration.Unix()
+	}
+	return d
+}
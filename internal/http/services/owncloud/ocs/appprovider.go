@@ -0,0 +1,134 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocs
+
+import (
+	"net/http"
+	"path"
+
+	appproviderpb "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
+	appregistry "github.com/cs3org/go-cs3apis/cs3/app/registry/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/token"
+)
+
+// AppProviderHandler opens files in the application registered for their mime type.
+type AppProviderHandler struct {
+	gatewayAddr string
+}
+
+// OpenData holds the location of the application that opened the file.
+type OpenData struct {
+	URL string `json:"url" xml:"url"`
+}
+
+func (h *AppProviderHandler) init(c *Config) {
+	h.gatewayAddr = c.GatewaySvc
+}
+
+func (h *AppProviderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var head string
+	head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+	if head == "open" && (r.Method == http.MethodGet || r.Method == http.MethodPost) {
+		h.open(w, r)
+		return
+	}
+	WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+}
+
+func (h *AppProviderHandler) open(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	p := r.FormValue("path")
+	if p == "" {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "path must not be empty", nil)
+		return
+	}
+
+	client, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting grpc gateway client", err)
+		return
+	}
+
+	hRes, err := client.GetHome(ctx, &provider.GetHomeRequest{})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc get home request", err)
+		return
+	}
+
+	statRes, err := client.Stat(ctx, &provider.StatRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: path.Join(hRes.GetPath(), p)},
+		},
+	})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc stat request", err)
+		return
+	}
+	if statRes.Status.Code != rpc.Code_CODE_OK {
+		if statRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
+			WriteOCSError(w, r, MetaNotFound.StatusCode, "file not found", nil)
+			return
+		}
+		WriteOCSError(w, r, MetaServerError.StatusCode, statRes.Status.Message, nil)
+		return
+	}
+
+	// the gateway does not proxy Open, so ask it for the app provider and contact it directly
+	appsRes, err := client.GetAppProviders(ctx, &appregistry.GetAppProvidersRequest{ResourceInfo: statRes.Info})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc get app providers request", err)
+		return
+	}
+	if appsRes.Status.Code != rpc.Code_CODE_OK || len(appsRes.Providers) == 0 {
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "no app available to open the file", nil)
+		return
+	}
+
+	appClient, err := pool.GetAppProviderClient(appsRes.Providers[0].Address)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting grpc app provider client", err)
+		return
+	}
+
+	openRes, err := appClient.Open(ctx, &appproviderpb.OpenRequest{
+		ResourceInfo: statRes.Info,
+		AccessToken:  token.ContextMustGetToken(ctx),
+	})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc open request", err)
+		return
+	}
+	switch openRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND, rpc.Code_CODE_UNIMPLEMENTED:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "no app available to open the file", nil)
+		return
+	default:
+		WriteOCSError(w, r, MetaServerError.StatusCode, openRes.Status.Message, nil)
+		return
+	}
+
+	WriteOCSSuccess(w, r, &OpenData{URL: openRes.IframeUrl})
+}
@@ -28,11 +28,24 @@ import (
 type AppsHandler struct {
 	SharesHandler        *SharesHandler
 	NotificationsHandler *NotificationsHandler
+	AppProviderHandler   *AppProviderHandler
+	SpacesHandler        *SpacesHandler
+	ActivityHandler      *ActivityHandler
 }
 
 func (h *AppsHandler) init(c *Config) error {
 	h.SharesHandler = new(SharesHandler)
 	h.NotificationsHandler = new(NotificationsHandler)
+	h.AppProviderHandler = new(AppProviderHandler)
+	h.AppProviderHandler.init(c)
+	h.ActivityHandler = new(ActivityHandler)
+	if err := h.ActivityHandler.init(c); err != nil {
+		return err
+	}
+	h.SpacesHandler = new(SpacesHandler)
+	if err := h.SpacesHandler.init(c); err != nil {
+		return err
+	}
 	return h.SharesHandler.init(c)
 }
 
@@ -61,6 +74,42 @@ func (h *AppsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	case "app_provider":
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+		if head == "api" {
+			head, r.URL.Path = router.ShiftPath(r.URL.Path)
+			if head == "v1" {
+				h.AppProviderHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	case "activity":
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+		if head == "api" {
+			head, r.URL.Path = router.ShiftPath(r.URL.Path)
+			if head == "v2" {
+				head, r.URL.Path = router.ShiftPath(r.URL.Path)
+				if head == "activity" {
+					h.ActivityHandler.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	case "spaces":
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+		if head == "api" {
+			head, r.URL.Path = router.ShiftPath(r.URL.Path)
+			if head == "v1" {
+				head, r.URL.Path = router.ShiftPath(r.URL.Path)
+				if head == "spaces" {
+					h.SpacesHandler.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
 	default:
 		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
 	}
@@ -19,8 +19,19 @@
 package ocs
 
 import (
+	"context"
 	"encoding/xml"
 	"net/http"
+	"sync"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/storage/checksums"
 )
 
 // ocsBool implements the xml/json Marshaler interface. The OCS API inconsistency require us to parse boolean values
@@ -43,13 +54,33 @@ func (c ocsBool) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	return e.EncodeElement("0", start)
 }
 
-// CapabilitiesHandler renders the capability endpoint
+// CapabilitiesHandler renders the capability endpoint. The availability of
+// the trash bin, the versions and the public links is detected from the
+// services behind the gateway unless it is set in the configuration.
 type CapabilitiesHandler struct {
-	c CapabilitiesData
+	c           CapabilitiesData
+	gatewayAddr string
+	configured  map[string]interface{}
+	ttl         time.Duration
+
+	mu       sync.Mutex
+	detected features
+	expires  time.Time
+}
+
+// features holds the detected availability of the optional features, nil
+// meaning unknown.
+type features struct {
+	trash       *bool
+	versions    *bool
+	publicLinks *bool
 }
 
 func (h *CapabilitiesHandler) init(c *Config) {
 	h.c = c.Capabilities
+	h.gatewayAddr = c.GatewaySvc
+	h.configured = c.capabilitiesConfig
+	h.ttl = time.Duration(c.CapabilitiesTTL) * time.Second
 
 	// capabilities
 	if h.c.Capabilities == nil {
@@ -96,7 +127,7 @@ func (h *CapabilitiesHandler) init(c *Config) {
 		h.c.Capabilities.Checksums = &CapabilitiesChecksums{}
 	}
 	if h.c.Capabilities.Checksums.SupportedTypes == nil {
-		h.c.Capabilities.Checksums.SupportedTypes = []string{"SHA256"}
+		h.c.Capabilities.Checksums.SupportedTypes = checksums.Supported()
 	}
 	if h.c.Capabilities.Checksums.PreferredUploadType == "" {
 		h.c.Capabilities.Checksums.PreferredUploadType = "SHA1"
@@ -128,6 +159,9 @@ func (h *CapabilitiesHandler) init(c *Config) {
 	if h.c.Capabilities.Dav.Trashbin == "" {
 		h.c.Capabilities.Dav.Trashbin = "1.0"
 	}
+	if h.c.Capabilities.Async == "" {
+		h.c.Capabilities.Async = "1.0"
+	}
 	if h.c.Capabilities.Dav.Reports == nil {
 		h.c.Capabilities.Dav.Reports = []string{"search-files"}
 	}
@@ -144,8 +178,9 @@ func (h *CapabilitiesHandler) init(c *Config) {
 		h.c.Capabilities.FilesSharing.Public = &CapabilitiesFilesSharingPublic{}
 	}
 
-	// h.c.Capabilities.FilesSharing.Public.Enabled is boolean
-	h.c.Capabilities.FilesSharing.Public.Enabled = true
+	if !h.isConfigured("files_sharing", "public", "enabled") {
+		h.c.Capabilities.FilesSharing.Public.Enabled = true
+	}
 
 	if h.c.Capabilities.FilesSharing.Public.Password == nil {
 		h.c.Capabilities.FilesSharing.Public.Password = &CapabilitiesFilesSharingPublicPassword{}
@@ -232,10 +267,126 @@ func (h *CapabilitiesHandler) init(c *Config) {
 // Handler renders the capabilities
 func (h *CapabilitiesHandler) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		WriteOCSSuccess(w, r, h.c)
+		WriteOCSSuccess(w, r, h.capabilities(r.Context()))
 	})
 }
 
+// capabilities returns the configured capabilities updated with the detected features.
+func (h *CapabilitiesHandler) capabilities(ctx context.Context) *CapabilitiesData {
+	f := h.features(ctx)
+
+	caps := *h.c.Capabilities
+	files := *caps.Files
+	dav := *caps.Dav
+	sharing := *caps.FilesSharing
+	public := *sharing.Public
+	caps.Files, caps.Dav, caps.FilesSharing, sharing.Public = &files, &dav, &sharing, &public
+
+	if f.trash != nil {
+		if !h.isConfigured("files", "undelete") {
+			files.Undelete = ocsBool(*f.trash)
+		}
+		if !h.isConfigured("dav", "trashbin") && !*f.trash {
+			dav.Trashbin = ""
+		}
+	}
+	if f.versions != nil && !h.isConfigured("files", "versioning") {
+		files.Versioning = ocsBool(*f.versions)
+	}
+	if f.publicLinks != nil && !h.isConfigured("files_sharing", "public", "enabled") {
+		public.Enabled = ocsBool(*f.publicLinks)
+	}
+
+	return &CapabilitiesData{Capabilities: &caps, Version: h.c.Version}
+}
+
+// features returns the detected features, they are cached for the configured ttl.
+func (h *CapabilitiesHandler) features(ctx context.Context) features {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if time.Now().Before(h.expires) {
+		return h.detected
+	}
+	f, complete := h.detect(ctx)
+	if complete {
+		h.detected = f
+		h.expires = time.Now().Add(h.ttl)
+	}
+	return f
+}
+
+// detect probes the services behind the gateway for the optional features,
+// it tells whether all of them could be determined.
+func (h *CapabilitiesHandler) detect(ctx context.Context) (features, bool) {
+	log := appctx.GetLogger(ctx)
+	f := features{}
+
+	c, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting gateway client")
+		return f, false
+	}
+
+	complete := true
+	home, err := c.GetHome(ctx, &provider.GetHomeRequest{})
+	if err != nil || home.Status.Code != rpc.Code_CODE_OK {
+		complete = false
+	} else {
+		ref := &provider.Reference{Spec: &provider.Reference_Path{Path: home.Path}}
+
+		recycle, err := c.ListRecycle(ctx, &gateway.ListRecycleRequest{Ref: ref})
+		f.trash = available(recycle.GetStatus(), err)
+
+		versions, err := c.ListFileVersions(ctx, &provider.ListFileVersionsRequest{Ref: ref})
+		f.versions = available(versions.GetStatus(), err)
+	}
+
+	shares, err := c.ListPublicShares(ctx, &link.ListPublicSharesRequest{})
+	f.publicLinks = available(shares.GetStatus(), err)
+
+	complete = complete && f.trash != nil && f.versions != nil && f.publicLinks != nil
+	return f, complete
+}
+
+// available tells if a feature is available from the response of a call
+// using it, nil meaning the call failed for another reason.
+func available(s *rpc.Status, err error) *bool {
+	if err != nil {
+		return nil
+	}
+	var ok bool
+	switch s.GetCode() {
+	case rpc.Code_CODE_OK:
+		ok = true
+	case rpc.Code_CODE_UNIMPLEMENTED:
+		ok = false
+	default:
+		return nil
+	}
+	return &ok
+}
+
+// isConfigured tells if the capability at the given path below capabilities
+// is set in the configuration, e.g. "files", "undelete".
+func (h *CapabilitiesHandler) isConfigured(keys ...string) bool {
+	m, ok := h.configured["capabilities"].(map[string]interface{})
+	for i, k := range keys {
+		if !ok {
+			return false
+		}
+		v, found := m[k]
+		if !found {
+			return false
+		}
+		if i == len(keys)-1 {
+			return true
+		}
+		m, ok = v.(map[string]interface{})
+	}
+	return false
+}
+
 // CapabilitiesData TODO document
 type CapabilitiesData struct {
 	Capabilities *Capabilities `json:"capabilities" xml:"capabilities"`
@@ -250,6 +401,9 @@ type Capabilities struct {
 	Dav           *CapabilitiesDav           `json:"dav" xml:"dav"`
 	FilesSharing  *CapabilitiesFilesSharing  `json:"files_sharing" xml:"files_sharing" mapstructure:"files_sharing"`
 	Notifications *CapabilitiesNotifications `json:"notifications" xml:"notifications"`
+	// Async announces that MOVE and COPY can run in the background when the
+	// client sends the OC-LazyOps header.
+	Async string `json:"async,omitempty" xml:"async,omitempty"`
 }
 
 // CapabilitiesCore holds webdav config
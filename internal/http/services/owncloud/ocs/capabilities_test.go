@@ -19,9 +19,11 @@
 package ocs
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"testing"
+	"time"
 )
 
 func TestMarshal(t *testing.T) {
@@ -54,3 +56,35 @@ func TestMarshal(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestDetectedCapabilities(t *testing.T) {
+	h := &CapabilitiesHandler{}
+	h.init(&Config{
+		capabilitiesConfig: map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"files": map[string]interface{}{"versioning": true},
+			},
+		},
+		Capabilities: CapabilitiesData{
+			Capabilities: &Capabilities{Files: &CapabilitiesFiles{Versioning: true}},
+		},
+	})
+
+	no, yes := false, true
+	h.detected = features{trash: &no, versions: &no, publicLinks: &yes}
+	h.expires = time.Now().Add(time.Minute)
+
+	c := h.capabilities(context.Background())
+	if c.Capabilities.Files.Undelete || c.Capabilities.Dav.Trashbin != "" {
+		t.Errorf("trash bin should be disabled, got undelete=%v trashbin=%q", c.Capabilities.Files.Undelete, c.Capabilities.Dav.Trashbin)
+	}
+	if !c.Capabilities.Files.Versioning {
+		t.Error("configured versioning should not be overridden")
+	}
+	if !c.Capabilities.FilesSharing.Public.Enabled {
+		t.Error("public links should be enabled")
+	}
+	if h.c.Capabilities.Dav.Trashbin != "1.0" {
+		t.Error("the configured capabilities should not be modified")
+	}
+}
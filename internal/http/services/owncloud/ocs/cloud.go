@@ -29,13 +29,24 @@ type CloudHandler struct {
 	UserHandler         *UserHandler
 	UsersHandler        *UsersHandler
 	CapabilitiesHandler *CapabilitiesHandler
+	AppPasswordsHandler *AppPasswordsHandler
+	MFAHandler          *MFAHandler
 }
 
-func (h *CloudHandler) init(c *Config) {
+func (h *CloudHandler) init(c *Config) error {
 	h.UserHandler = new(UserHandler)
 	h.UsersHandler = new(UsersHandler)
+	if err := h.UsersHandler.init(c); err != nil {
+		return err
+	}
 	h.CapabilitiesHandler = new(CapabilitiesHandler)
 	h.CapabilitiesHandler.init(c)
+	h.AppPasswordsHandler = new(AppPasswordsHandler)
+	if err := h.AppPasswordsHandler.init(c); err != nil {
+		return err
+	}
+	h.MFAHandler = new(MFAHandler)
+	return h.MFAHandler.init(c)
 }
 
 // Handler routes the cloud endpoints
@@ -44,8 +55,12 @@ func (h *CloudHandler) Handler() http.Handler {
 		var head string
 		head, r.URL.Path = router.ShiftPath(r.URL.Path)
 		switch head {
+		case "apppasswords":
+			h.AppPasswordsHandler.ServeHTTP(w, r)
 		case "capabilities":
 			h.CapabilitiesHandler.Handler().ServeHTTP(w, r)
+		case "mfa":
+			h.MFAHandler.ServeHTTP(w, r)
 		case "user":
 			h.UserHandler.ServeHTTP(w, r)
 		case "users":
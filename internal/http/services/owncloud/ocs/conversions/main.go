@@ -44,12 +44,34 @@ const (
 	ShareTypePublicLink ShareType = 3
 
 	// ShareTypeGroup represents a group share
-	// ShareTypeGroup shareType = 1
+	ShareTypeGroup ShareType = 1
 
 	// ShareTypeFederatedCloudShare represents a federated share
-	// ShareTypeFederatedCloudShare shareType = 6
+	ShareTypeFederatedCloudShare ShareType = 6
 )
 
+// The states of the received shares in the OCS API.
+const (
+	ShareStateAccepted = 0
+	ShareStatePending  = 1
+	ShareStateRejected = 2
+)
+
+// OCSStateToCS3 returns the CS3 states of the received shares in the given
+// OCS state. The shares never answered have no state and are pending.
+func OCSStateToCS3(state int) ([]collaboration.ShareState, error) {
+	switch state {
+	case ShareStateAccepted:
+		return []collaboration.ShareState{collaboration.ShareState_SHARE_STATE_ACCEPTED}, nil
+	case ShareStatePending:
+		return []collaboration.ShareState{collaboration.ShareState_SHARE_STATE_INVALID, collaboration.ShareState_SHARE_STATE_PENDING}, nil
+	case ShareStateRejected:
+		return []collaboration.ShareState{collaboration.ShareState_SHARE_STATE_REJECTED}, nil
+	default:
+		return nil, fmt.Errorf("unknown share state %d", state)
+	}
+}
+
 // ResourceType indicates the OCS type of the resource
 type ResourceType int
 
@@ -136,6 +158,28 @@ type ShareData struct {
 	Attributes string `json:"attributes,omitempty" xml:"attributes,omitempty"`
 	// PasswordProtected represents a public share is password protected
 	// PasswordProtected bool `json:"password_protected,omitempty" xml:"password_protected,omitempty"`
+	// The number of accesses to a public link.
+	Accesses *uint64 `json:"accesses,omitempty" xml:"accesses,omitempty"`
+	// The UNIX timestamp of the last access to a public link.
+	LastAccess uint64 `json:"last_access,omitempty" xml:"last_access,omitempty"`
+	// The number of bytes downloaded through a public link.
+	Transferred uint64 `json:"bytes_transferred,omitempty" xml:"bytes_transferred,omitempty"`
+}
+
+// ShareStatsData holds the statistics of the accesses to a public link.
+type ShareStatsData struct {
+	ID       string `json:"id" xml:"id"`
+	Name     string `json:"name,omitempty" xml:"name,omitempty"`
+	Token    string `json:"token" xml:"token"`
+	URL      string `json:"url,omitempty" xml:"url,omitempty"`
+	Path     string `json:"path" xml:"path"`
+	ItemType string `json:"item_type" xml:"item_type"`
+	// The number of times the link was opened.
+	Accesses uint64 `json:"accesses" xml:"accesses"`
+	// The UNIX timestamp of the last access, 0 if the link was never opened.
+	LastAccess uint64 `json:"last_access" xml:"last_access"`
+	// The number of bytes downloaded through the link.
+	Transferred uint64 `json:"bytes_transferred" xml:"bytes_transferred"`
 }
 
 // ShareeData holds share recipient search results
@@ -275,7 +319,7 @@ func AsCS3Permissions(p int, rp *provider.ResourcePermissions) *provider.Resourc
 func PublicShare2ShareData(share *link.PublicShare, r *http.Request) *ShareData {
 	var expiration string
 	if share.Expiration != nil {
-		expiration = timestampToExpiration(share.Expiration)
+		expiration = TimestampToExpiration(share.Expiration)
 	} else {
 		expiration = ""
 	}
@@ -372,9 +416,10 @@ func permissions2OCSPermissions(p *provider.ResourcePermissions) Permissions {
 	return permissions
 }
 
-// timestamp is assumed to be UTC ... just human readable ...
+// TimestampToExpiration formats a timestamp as an ocs expiration date.
+// The timestamp is assumed to be UTC ... just human readable ...
 // FIXME and ambiguous / error prone because there is no time zone ...
-func timestampToExpiration(t *types.Timestamp) string {
+func TimestampToExpiration(t *types.Timestamp) string {
 	return time.Unix(int64(t.Seconds), int64(t.Nanos)).Format("2006-01-02 15:05:05")
 }
 
@@ -0,0 +1,131 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocs
+
+import (
+	"net/http"
+
+	"github.com/cs3org/reva/pkg/auth/mfa"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+// MFAHandler lets the users enroll and manage their second factor.
+type MFAHandler struct {
+	mgr *mfa.Manager
+}
+
+// MFAData holds the second factor status of a user.
+type MFAData struct {
+	Enrolled      bool `json:"enrolled" xml:"enrolled"`
+	Required      bool `json:"required" xml:"required"`
+	RecoveryCodes int  `json:"recovery_codes" xml:"recovery_codes"`
+}
+
+// MFASetupData holds the secret to enter in the authenticator app, and the
+// otpauth URI to show as a QR code.
+type MFASetupData struct {
+	Secret string `json:"secret" xml:"secret"`
+	URI    string `json:"uri" xml:"uri"`
+}
+
+// RecoveryCodesData holds the recovery codes, only returned when generated.
+type RecoveryCodesData struct {
+	RecoveryCodes []string `json:"recovery_codes" xml:"recovery_codes>element"`
+}
+
+func (h *MFAHandler) init(c *Config) error {
+	mgr, err := mfa.New(c.MFA)
+	if err != nil {
+		return err
+	}
+	h.mgr = mgr
+	return nil
+}
+
+func (h *MFAHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.mgr == nil {
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+		return
+	}
+	ctx := r.Context()
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "missing user in context", nil)
+		return
+	}
+
+	var head string
+	head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+	switch {
+	case head == "" && r.Method == http.MethodGet:
+		st, err := h.mgr.Status(ctx, u)
+		if err != nil {
+			writeMFAError(w, r, "error getting second factor", err)
+			return
+		}
+		WriteOCSSuccess(w, r, &MFAData{Enrolled: st.Enrolled, Required: st.Required, RecoveryCodes: st.RecoveryCodes})
+	case head == "" && r.Method == http.MethodPost:
+		secret, uri, err := h.mgr.Begin(ctx, u)
+		if err != nil {
+			writeMFAError(w, r, "error enrolling second factor", err)
+			return
+		}
+		WriteOCSSuccess(w, r, &MFASetupData{Secret: secret, URI: uri})
+	case head == "confirm" && r.Method == http.MethodPost:
+		codes, err := h.mgr.Confirm(ctx, u, r.FormValue("code"))
+		if err != nil {
+			writeMFAError(w, r, "error confirming second factor", err)
+			return
+		}
+		WriteOCSSuccess(w, r, &RecoveryCodesData{RecoveryCodes: codes})
+	case head == "recovery" && r.Method == http.MethodPost:
+		codes, err := h.mgr.RegenerateRecoveryCodes(ctx, u, r.FormValue("code"))
+		if err != nil {
+			writeMFAError(w, r, "error generating recovery codes", err)
+			return
+		}
+		WriteOCSSuccess(w, r, &RecoveryCodesData{RecoveryCodes: codes})
+	case head == "" && r.Method == http.MethodDelete:
+		if err := h.mgr.Disable(ctx, u, r.FormValue("code")); err != nil {
+			writeMFAError(w, r, "error disabling second factor", err)
+			return
+		}
+		WriteOCSSuccess(w, r, nil)
+	default:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	}
+}
+
+func writeMFAError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch err.(type) {
+	case errtypes.IsNotFound:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "second factor not enrolled", nil)
+	case errtypes.IsAlreadyExists:
+		WriteOCSError(w, r, http.StatusConflict, "second factor already enrolled", nil)
+	case errtypes.IsInvalidCredentials:
+		WriteOCSError(w, r, http.StatusForbidden, "invalid code", nil)
+	case errtypes.IsPermissionDenied:
+		WriteOCSError(w, r, http.StatusForbidden, "the second factor is required", nil)
+	default:
+		WriteOCSError(w, r, MetaServerError.StatusCode, msg, err)
+	}
+}
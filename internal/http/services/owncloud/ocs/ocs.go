@@ -22,6 +22,8 @@ import (
 	"net/http"
 
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/i18n"
+	"github.com/cs3org/reva/pkg/auth/password"
 	"github.com/cs3org/reva/pkg/rhttp/global"
 	"github.com/cs3org/reva/pkg/rhttp/router"
 	"github.com/cs3org/reva/pkg/sharedconf"
@@ -38,6 +40,52 @@ type Config struct {
 	Config       ConfigData       `mapstructure:"config"`
 	Capabilities CapabilitiesData `mapstructure:"capabilities"`
 	GatewaySvc   string           `mapstructure:"gatewaysvc"`
+	// CapabilitiesTTL is how long the detected capabilities are cached, in seconds.
+	CapabilitiesTTL int `mapstructure:"capabilities_ttl"`
+
+	AppPasswordManager  string                            `mapstructure:"app_password_manager"`
+	AppPasswordManagers map[string]map[string]interface{} `mapstructure:"app_password_managers"`
+
+	// UserProviderSvc enables the user provisioning endpoints, the driver of
+	// the userprovider service must be able to create and change users.
+	UserProviderSvc string `mapstructure:"userprovidersvc"`
+	AdminGroup      string `mapstructure:"admin_group"`
+	// PasswordPolicy is checked when passwords are set through provisioning.
+	PasswordPolicy password.Policy `mapstructure:"password_policy"`
+	// Throttle is the login throttling configuration, to let admins unlock
+	// users. It has to use the same store as the auth middleware.
+	Throttle map[string]interface{} `mapstructure:"throttle"`
+	// EventsPublisher publishes the changes of the group memberships, none
+	// if empty.
+	EventsPublisher  string                            `mapstructure:"events_publisher"`
+	EventsPublishers map[string]map[string]interface{} `mapstructure:"events_publishers"`
+
+	// ActivityManager enables the activity endpoint, it has to use the same
+	// store as the activities service.
+	ActivityManager  string                            `mapstructure:"activity_manager"`
+	ActivityManagers map[string]map[string]interface{} `mapstructure:"activity_managers"`
+
+	// MFA enables the enrollment of a second factor by the users, it has to
+	// use the same store as the gateway.
+	MFA map[string]interface{} `mapstructure:"mfa"`
+
+	// PreferencesManager enables the privatedata endpoints, it has to use
+	// the same store as the preferences service.
+	PreferencesManager  string                            `mapstructure:"preferences_manager"`
+	PreferencesManagers map[string]map[string]interface{} `mapstructure:"preferences_managers"`
+
+	SpacesManager  string                            `mapstructure:"spaces_manager"`
+	SpacesManagers map[string]map[string]interface{} `mapstructure:"spaces_managers"`
+	// SpacesMount is the path the spaces storage provider is mounted at.
+	SpacesMount string `mapstructure:"spaces_mount"`
+
+	// Translations is a directory of <language>.json files translating the
+	// error messages, in addition to the translations shipped with reva.
+	Translations string `mapstructure:"translations"`
+
+	// capabilitiesConfig is the raw capabilities configuration, telling
+	// which capabilities are set explicitly.
+	capabilitiesConfig map[string]interface{}
 }
 
 type svc struct {
@@ -58,6 +106,33 @@ func New(m map[string]interface{}) (global.Service, error) {
 
 	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
 
+	if conf.CapabilitiesTTL == 0 {
+		conf.CapabilitiesTTL = 60
+	}
+	conf.capabilitiesConfig, _ = m["capabilities"].(map[string]interface{})
+
+	if conf.AppPasswordManager == "" {
+		conf.AppPasswordManager = "json"
+	}
+
+	if conf.AdminGroup == "" {
+		conf.AdminGroup = "admin"
+	}
+
+	if conf.SpacesManager == "" {
+		conf.SpacesManager = "json"
+	}
+
+	if conf.SpacesMount == "" {
+		conf.SpacesMount = "/spaces"
+	}
+
+	if conf.Translations != "" {
+		if err := i18n.Default.LoadDir(conf.Translations); err != nil {
+			return nil, err
+		}
+	}
+
 	s := &svc{
 		c:         conf,
 		V1Handler: new(V1Handler),
@@ -76,6 +151,9 @@ func (s *svc) Prefix() string {
 }
 
 func (s *svc) Close() error {
+	if p := s.V1Handler.CloudHandler.UsersHandler.publisher; p != nil {
+		return p.Close()
+	}
 	return nil
 }
 
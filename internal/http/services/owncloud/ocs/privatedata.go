@@ -0,0 +1,131 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocs
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cs3org/reva/internal/http/services/owncloud/ocs/conversions"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/preferences"
+	"github.com/cs3org/reva/pkg/preferences/manager/registry"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+)
+
+// PrivateDataHandler serves the privatedata endpoints of the provisioning
+// api, where the clients keep the settings of the users, one namespace per
+// app.
+type PrivateDataHandler struct {
+	mgr preferences.Manager
+}
+
+// PrivateData holds a key of an app and its value.
+type PrivateData struct {
+	App   string `json:"app" xml:"app"`
+	Key   string `json:"key" xml:"key"`
+	Value string `json:"value" xml:"value"`
+}
+
+func (h *PrivateDataHandler) init(c *Config) error {
+	if c.PreferencesManager == "" {
+		return nil
+	}
+	f, ok := registry.NewFuncs[c.PreferencesManager]
+	if !ok {
+		return fmt.Errorf("driver %s not found for preferences manager", c.PreferencesManager)
+	}
+	mgr, err := f(c.PreferencesManagers[c.PreferencesManager])
+	if err != nil {
+		return err
+	}
+	h.mgr = mgr
+	return nil
+}
+
+func (h *PrivateDataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.mgr == nil {
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+		return
+	}
+
+	var head, app string
+	head, r.URL.Path = router.ShiftPath(r.URL.Path)
+	app, r.URL.Path = router.ShiftPath(r.URL.Path)
+	key := strings.Trim(r.URL.Path, "/")
+
+	switch {
+	case head == "getattribute" && r.Method == http.MethodGet:
+		h.get(w, r, app, key)
+	case head == "setattribute" && r.Method == http.MethodPost && app != "" && key != "":
+		h.set(w, r, app, key)
+	case head == "deleteattribute" && (r.Method == http.MethodPost || r.Method == http.MethodDelete) && app != "" && key != "":
+		h.delete(w, r, app, key)
+	default:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	}
+}
+
+// get lists the keys of all the apps, of an app or a single key.
+func (h *PrivateDataHandler) get(w http.ResponseWriter, r *http.Request, app, key string) {
+	var list []*preferences.Preference
+	if key != "" {
+		value, err := h.mgr.GetKey(r.Context(), app, key)
+		switch err.(type) {
+		case nil:
+			list = []*preferences.Preference{{Namespace: app, Key: key, Value: value}}
+		case errtypes.IsNotFound:
+		default:
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error getting attribute", err)
+			return
+		}
+	} else {
+		var err error
+		if list, err = h.mgr.ListKeys(r.Context(), app); err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error listing attributes", err)
+			return
+		}
+	}
+
+	data := make([]*PrivateData, 0, len(list))
+	for _, p := range list {
+		data = append(data, &PrivateData{App: p.Namespace, Key: p.Key, Value: p.Value})
+	}
+	WriteOCSSuccess(w, r, &conversions.Element{Data: data})
+}
+
+func (h *PrivateDataHandler) set(w http.ResponseWriter, r *http.Request, app, key string) {
+	if err := h.mgr.SetKey(r.Context(), app, key, r.FormValue("value")); err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error setting attribute", err)
+		return
+	}
+	WriteOCSSuccess(w, r, nil)
+}
+
+// delete removes the key, deleting a missing key succeeds.
+func (h *PrivateDataHandler) delete(w http.ResponseWriter, r *http.Request, app, key string) {
+	if err := h.mgr.DeleteKey(r.Context(), app, key); err != nil {
+		if _, ok := err.(errtypes.IsNotFound); !ok {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error deleting attribute", err)
+			return
+		}
+	}
+	WriteOCSSuccess(w, r, nil)
+}
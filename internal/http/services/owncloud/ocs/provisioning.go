@@ -0,0 +1,331 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocs
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/throttle"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+	"github.com/cs3org/reva/pkg/user/provisioning"
+)
+
+// UsersListData holds the usernames returned when searching users
+type UsersListData struct {
+	Users []string `json:"users" xml:"users>element"`
+}
+
+// provision serves the user provisioning endpoints. Admins manage all the
+// users, the other users only see and change their own account.
+func (h *UsersHandler) provision(w http.ResponseWriter, r *http.Request, username string) {
+	ctx := r.Context()
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "missing user in context", nil)
+		return
+	}
+	prov, err := pool.GetUserProvisioningClient(h.userProviderAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting userprovider client", err)
+		return
+	}
+	admin := h.isAdmin(r, u)
+
+	if username == "" {
+		if !admin {
+			WriteOCSError(w, r, http.StatusForbidden, "only admins can manage users", nil)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h.searchUsers(w, r)
+		case http.MethodPost:
+			h.createUser(w, r, prov)
+		default:
+			WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+		}
+		return
+	}
+
+	self := username == u.Username
+	if !self && !admin {
+		WriteOCSError(w, r, http.StatusForbidden, "user id mismatch", nil)
+		return
+	}
+
+	a, err := prov.GetAccountByUsername(ctx, username)
+	if err != nil {
+		writeProvisioningError(w, r, "error getting user", err)
+		return
+	}
+
+	var head string
+	head, r.URL.Path = router.ShiftPath(r.URL.Path)
+	switch {
+	case head == "" && r.Method == http.MethodGet:
+		h.getAccount(w, r, a, self)
+	case head == "" && r.Method == http.MethodPut:
+		h.editAccount(w, r, prov, a, admin)
+	case head == "" && r.Method == http.MethodDelete && admin && !self:
+		if err := prov.DeleteUser(ctx, a.User.Id); err != nil {
+			writeProvisioningError(w, r, "error deleting user", err)
+			return
+		}
+		WriteOCSSuccess(w, r, nil)
+	case (head == "enable" || head == "disable") && r.Method == http.MethodPut && admin && !self:
+		a.Disabled = head == "disable"
+		if err := prov.UpdateAccount(ctx, a); err != nil {
+			writeProvisioningError(w, r, "error updating user", err)
+			return
+		}
+		WriteOCSSuccess(w, r, nil)
+	case head == "throttle" && r.Method == http.MethodDelete && admin:
+		// unlocks a user throttled after failed logins
+		if err := h.throttler.Reset(ctx, throttle.UserKey(a.User.Username)); err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error resetting failed logins", err)
+			return
+		}
+		WriteOCSSuccess(w, r, nil)
+	case head == "groups" && r.Method == http.MethodGet:
+		WriteOCSSuccess(w, r, &GroupsData{Groups: a.User.Groups})
+	case head == "groups" && (r.Method == http.MethodPost || r.Method == http.MethodDelete) && admin:
+		h.editGroups(w, r, prov, a)
+	case head == "" || head == "enable" || head == "disable" || head == "groups" || head == "throttle":
+		WriteOCSError(w, r, http.StatusForbidden, "operation not permitted", nil)
+	default:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	}
+}
+
+// isAdmin tells if the user is a member of the admin group. Users unknown
+// to the userprovider are never admins. The userprovider checks it again on
+// every change.
+func (h *UsersHandler) isAdmin(r *http.Request, u *userpb.User) bool {
+	log := appctx.GetLogger(r.Context())
+	c, err := pool.GetUserProviderServiceClient(h.userProviderAddr)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting userprovider client")
+		return false
+	}
+	res, err := c.IsInGroup(r.Context(), &userpb.IsInGroupRequest{UserId: u.Id, Group: h.adminGroup})
+	if err != nil {
+		log.Error().Err(err).Msg("error checking admin group")
+		return false
+	}
+	return res.Status.Code == rpc.Code_CODE_OK && res.Ok
+}
+
+func (h *UsersHandler) searchUsers(w http.ResponseWriter, r *http.Request) {
+	c, err := pool.GetUserProviderServiceClient(h.userProviderAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting userprovider client", err)
+		return
+	}
+	res, err := c.FindUsers(r.Context(), &userpb.FindUsersRequest{Filter: r.FormValue("search")})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error searching users", err)
+		return
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error searching users", status.NewErrorFromCode(res.Status.Code, "ocs"))
+		return
+	}
+	data := &UsersListData{Users: make([]string, 0, len(res.Users))}
+	for _, u := range res.Users {
+		data.Users = append(data.Users, u.Username)
+	}
+	WriteOCSSuccess(w, r, data)
+}
+
+func (h *UsersHandler) createUser(w http.ResponseWriter, r *http.Request, prov *provisioning.Client) {
+	if err := r.ParseForm(); err != nil {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "could not parse form", err)
+		return
+	}
+	username := r.FormValue("userid")
+	password := r.FormValue("password")
+	if username == "" || password == "" {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "userid and password are required", nil)
+		return
+	}
+	if err := h.policy.Validate(password); err != nil {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, err.Error(), nil)
+		return
+	}
+
+	u := &userpb.User{
+		Username:    username,
+		Mail:        r.FormValue("email"),
+		DisplayName: r.FormValue("displayname"),
+		Groups:      r.Form["groups[]"],
+	}
+	if u.DisplayName == "" {
+		u.DisplayName = username
+	}
+	if err := prov.CreateUser(r.Context(), u, password); err != nil {
+		writeProvisioningError(w, r, "error creating user", err)
+		return
+	}
+	WriteOCSSuccess(w, r, &UsersData{ID: u.Username})
+}
+
+// getAccount returns the details of the account. The quota of the own
+// account includes the used bytes of the home.
+func (h *UsersHandler) getAccount(w http.ResponseWriter, r *http.Request, a *ctxuser.Account, self bool) {
+	quota := accountQuota(a)
+	if self {
+		var err error
+		if quota, err = h.getQuota(r.Context()); err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error getting quota", err)
+			return
+		}
+	}
+	WriteOCSSuccess(w, r, &UsersData{
+		ID:          a.User.Username,
+		Enabled:     strconv.FormatBool(!a.Disabled),
+		Quota:       quota,
+		DisplayName: a.User.DisplayName,
+		Email:       a.User.Mail,
+	})
+}
+
+// editAccount changes the field given as key to value. Users can change
+// their mail, display name and password, only admins change the quota.
+func (h *UsersHandler) editAccount(w http.ResponseWriter, r *http.Request, prov *provisioning.Client, a *ctxuser.Account, admin bool) {
+	ctx := r.Context()
+	value := r.FormValue("value")
+
+	switch key := r.FormValue("key"); key {
+	case "email":
+		a.User.Mail = value
+	case "displayname", "display":
+		a.User.DisplayName = value
+	case "password":
+		if err := h.policy.Validate(value); err != nil {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, err.Error(), nil)
+			return
+		}
+		if err := prov.SetPassword(ctx, a.User.Id, value); err != nil {
+			writeProvisioningError(w, r, "error setting password", err)
+			return
+		}
+		WriteOCSSuccess(w, r, nil)
+		return
+	case "quota":
+		if !admin {
+			WriteOCSError(w, r, http.StatusForbidden, "only admins can change the quota", nil)
+			return
+		}
+		quota, err := parseQuota(value)
+		if err != nil {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "invalid quota", err)
+			return
+		}
+		a.Quota = quota
+	default:
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "unknown key: "+key, nil)
+		return
+	}
+
+	if err := prov.UpdateAccount(ctx, a); err != nil {
+		writeProvisioningError(w, r, "error updating user", err)
+		return
+	}
+	WriteOCSSuccess(w, r, nil)
+}
+
+func (h *UsersHandler) editGroups(w http.ResponseWriter, r *http.Request, prov *provisioning.Client, a *ctxuser.Account) {
+	group := r.FormValue("groupid")
+	if group == "" {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "groupid is required", nil)
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodPost {
+		err = prov.AddToGroup(r.Context(), a.User.Id, group)
+	} else {
+		err = prov.RemoveFromGroup(r.Context(), a.User.Id, group)
+	}
+	if err != nil {
+		writeProvisioningError(w, r, "error changing groups", err)
+		return
+	}
+	h.publishMembership(r.Context(), group, a.User.Id)
+	WriteOCSSuccess(w, r, nil)
+}
+
+// publishMembership publishes the change of the members of the group, so
+// that the services resolving the groups forget the cached ones.
+func (h *UsersHandler) publishMembership(ctx context.Context, group string, member *userpb.UserId) {
+	if h.publisher == nil {
+		return
+	}
+	var id *userpb.UserId
+	if u, ok := ctxuser.ContextGetUser(ctx); ok {
+		id = u.Id
+	}
+	e := events.New(events.TypeGroupMembershipChanged, id)
+	e.Group = group
+	e.Member = member
+	if err := h.publisher.Publish(ctx, e); err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("type", e.Type).Msg("ocs: error publishing event")
+	}
+}
+
+// parseQuota parses the quota in bytes, none and default remove the quota.
+func parseQuota(v string) (uint64, error) {
+	switch strings.ToLower(v) {
+	case "none", "default":
+		return 0, nil
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
+
+// accountQuota returns the quota configured for the account, without usage.
+func accountQuota(a *ctxuser.Account) *QuotaData {
+	if a.Quota == 0 {
+		return &QuotaData{Free: quotaUnlimited, Total: quotaUnlimited, Definition: "none"}
+	}
+	return &QuotaData{Free: int64(a.Quota), Total: int64(a.Quota), Definition: "default"}
+}
+
+func writeProvisioningError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch err.(type) {
+	case errtypes.IsNotFound:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "user not found", nil)
+	case errtypes.IsAlreadyExists:
+		WriteOCSError(w, r, http.StatusConflict, "user already exists", nil)
+	case errtypes.IsPermissionDenied:
+		WriteOCSError(w, r, http.StatusForbidden, "operation not permitted", nil)
+	default:
+		WriteOCSError(w, r, MetaServerError.StatusCode, msg, err)
+	}
+}
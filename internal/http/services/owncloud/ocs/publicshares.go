@@ -0,0 +1,425 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+
+	"github.com/cs3org/reva/internal/http/services/owncloud/ocs/conversions"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/publicshare"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+)
+
+// permissions a public link can be created with: read only, upload only (drop folder),
+// read and upload, and read and write.
+var publicLinkPermissions = []conversions.Permissions{
+	conversions.PermissionRead,
+	conversions.PermissionCreate,
+	conversions.PermissionRead | conversions.PermissionCreate,
+	conversions.PermissionRead | conversions.PermissionWrite | conversions.PermissionCreate | conversions.PermissionDelete,
+}
+
+func (h *SharesHandler) createPublicLinkShare(w http.ResponseWriter, r *http.Request, prefix string) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	// get a connection to the public shares service
+	c, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting a connection to a public shares provider", err)
+		return
+	}
+
+	statReq := provider.StatRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{
+				Path: path.Join(prefix, r.FormValue("path")), // TODO replace path with target
+			},
+		},
+	}
+
+	statRes, err := c.Stat(ctx, &statReq)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc stat request", err)
+		return
+	}
+	if statRes.Status.Code != rpc.Code_CODE_OK {
+		if statRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
+			WriteOCSError(w, r, MetaNotFound.StatusCode, "not found", nil)
+			return
+		}
+		WriteOCSError(w, r, MetaServerError.StatusCode, "grpc stat request failed", nil)
+		return
+	}
+
+	permissions := conversions.PermissionRead
+	if p, ok, err := publicLinkPermissionsFromRequest(r); err != nil {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, err.Error(), nil)
+		return
+	} else if ok {
+		permissions = p
+	}
+	if permissions != conversions.PermissionRead && statRes.Info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "public upload is only possible for folders", nil)
+		return
+	}
+
+	req := link.CreatePublicShareRequest{
+		ResourceInfo: statRes.GetInfo(),
+		Grant: &link.Grant{
+			Permissions: &link.PublicSharePermissions{
+				Permissions: asCS3Permissions(permissions, nil),
+			},
+			Password: r.FormValue("password"),
+		},
+	}
+
+	if expiration, ok, err := expirationFromRequest(r); err != nil {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "invalid date format", err)
+		return
+	} else if ok {
+		req.Grant.Expiration = expiration
+	}
+
+	// set displayname as arbitrary metadata
+	req.ResourceInfo.ArbitraryMetadata = &provider.ArbitraryMetadata{
+		Metadata: map[string]string{
+			"name": r.FormValue("name"),
+		},
+	}
+
+	createRes, err := c.CreatePublicShare(ctx, &req)
+	if err != nil {
+		log.Debug().Err(err).Str("createShare", "shares").Msgf("error creating a public share to resource id: %v", statRes.Info.GetId())
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error creating public share", fmt.Errorf("error creating a public share to resource id: %v", statRes.Info.GetId()))
+		return
+	}
+
+	if createRes.Status.Code != rpc.Code_CODE_OK {
+		log.Debug().Str("shares", "createShare").Msgf("create public share failed with status code: %v", createRes.Status.Code.String())
+		WriteOCSError(w, r, MetaServerError.StatusCode, "grpc create public share request failed", nil)
+		return
+	}
+
+	s := conversions.PublicShare2ShareData(createRes.Share, r)
+	if err := h.addFileInfo(ctx, s, statRes.Info); err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error enhancing response with share data", err)
+		return
+	}
+
+	WriteOCSSuccess(w, r, s)
+}
+
+// getPublicShare returns the public share with the given id, or nil if there is none.
+func (h *SharesHandler) getPublicShare(r *http.Request, shareID string) (*link.PublicShare, error) {
+	c, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.GetPublicShare(r.Context(), &link.GetPublicShareRequest{
+		Ref: &link.PublicShareReference{
+			Spec: &link.PublicShareReference_Id{
+				Id: &link.PublicShareId{
+					OpaqueId: shareID,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+		return res.Share, nil
+	case rpc.Code_CODE_NOT_FOUND:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("grpc get public share request failed with code %s", res.Status.Code)
+	}
+}
+
+// updatePublicShare applies the permissions, password and expiration date present in the request.
+func (h *SharesHandler) updatePublicShare(w http.ResponseWriter, r *http.Request, share *link.PublicShare) {
+	ctx := r.Context()
+
+	c, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting grpc client", err)
+		return
+	}
+
+	updates := []*link.UpdatePublicShareRequest_Update{}
+
+	permissions, ok, err := publicLinkPermissionsFromRequest(r)
+	if err != nil {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, err.Error(), nil)
+		return
+	}
+	if ok {
+		updates = append(updates, &link.UpdatePublicShareRequest_Update{
+			Type: link.UpdatePublicShareRequest_Update_TYPE_PERMISSIONS,
+			Grant: &link.Grant{
+				Permissions: &link.PublicSharePermissions{
+					Permissions: asCS3Permissions(permissions, nil),
+				},
+			},
+		})
+	}
+
+	if _, ok := r.Form["password"]; ok {
+		updates = append(updates, &link.UpdatePublicShareRequest_Update{
+			Type: link.UpdatePublicShareRequest_Update_TYPE_PASSWORD,
+			Grant: &link.Grant{
+				Password: r.FormValue("password"),
+			},
+		})
+	}
+
+	if _, ok := r.Form["expireDate"]; ok {
+		// an empty date removes the expiration
+		expiration, _, err := expirationFromRequest(r)
+		if err != nil {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "invalid date format", err)
+			return
+		}
+		updates = append(updates, &link.UpdatePublicShareRequest_Update{
+			Type: link.UpdatePublicShareRequest_Update_TYPE_EXPIRATION,
+			Grant: &link.Grant{
+				Expiration: expiration,
+			},
+		})
+	}
+
+	opaques := []*types.Opaque{}
+	for _, u := range updates {
+		val, err := json.Marshal(u)
+		if err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error encoding public share update", err)
+			return
+		}
+		opaques = append(opaques, &types.Opaque{
+			Map: map[string]*types.OpaqueEntry{
+				"update": &types.OpaqueEntry{
+					Decoder: "json",
+					Value:   val,
+				},
+			},
+		})
+	}
+
+	// a new token replaces the leaked links without losing the settings and statistics
+	if rotate, _ := strconv.ParseBool(r.FormValue("rotateToken")); rotate {
+		opaques = append(opaques, &types.Opaque{
+			Map: map[string]*types.OpaqueEntry{
+				publicshare.OpaqueRotateToken: &types.OpaqueEntry{
+					Decoder: "plain",
+					Value:   []byte("true"),
+				},
+			},
+		})
+	}
+
+	if len(opaques) == 0 {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "nothing to update", nil)
+		return
+	}
+
+	var stats *types.Opaque
+	for _, o := range opaques {
+		res, err := c.UpdatePublicShare(ctx, &link.UpdatePublicShareRequest{
+			Opaque: o,
+			Ref: &link.PublicShareReference{
+				Spec: &link.PublicShareReference_Id{
+					Id: share.Id,
+				},
+			},
+		})
+		if err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc update public share request", err)
+			return
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			if res.Status.Code == rpc.Code_CODE_NOT_FOUND {
+				WriteOCSError(w, r, MetaNotFound.StatusCode, "not found", nil)
+				return
+			}
+			WriteOCSError(w, r, MetaServerError.StatusCode, "grpc update public share request failed", nil)
+			return
+		}
+		share = res.Share
+		stats = res.Opaque
+	}
+
+	s := conversions.PublicShare2ShareData(share, r)
+	addPublicShareStats(ctx, s, stats)
+	WriteOCSSuccess(w, r, s)
+}
+
+// addPublicShareStats sets the statistics of the public share carried by
+// the opaque data of a response.
+func addPublicShareStats(ctx context.Context, s *conversions.ShareData, o *types.Opaque) {
+	stats, err := publicshare.StatsFromOpaque(o)
+	if err != nil {
+		appctx.GetLogger(ctx).Warn().Err(err).Msg("error decoding public share stats")
+		return
+	}
+	if st, ok := stats[s.ID]; ok {
+		accesses := st.Accesses
+		s.Accesses = &accesses
+		s.LastAccess = st.LastAccess
+		s.Transferred = st.Transferred
+	}
+}
+
+// listPublicShareStats lists the statistics of the public links of the
+// user, the most recently accessed first.
+func (h *SharesHandler) listPublicShareStats(w http.ResponseWriter, r *http.Request) {
+	shares, err := h.listPublicShares(r, nil)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, err.Error(), err)
+		return
+	}
+
+	stats := make([]*conversions.ShareStatsData, 0, len(shares))
+	for _, s := range shares {
+		st := &conversions.ShareStatsData{
+			ID:          s.ID,
+			Name:        s.Name,
+			Token:       s.Token,
+			URL:         s.URL,
+			Path:        s.Path,
+			ItemType:    s.ItemType,
+			LastAccess:  s.LastAccess,
+			Transferred: s.Transferred,
+		}
+		if s.Accesses != nil {
+			st.Accesses = *s.Accesses
+		}
+		stats = append(stats, st)
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].LastAccess > stats[j].LastAccess
+	})
+	WriteOCSSuccess(w, r, &conversions.Element{Data: stats})
+}
+
+func (h *SharesHandler) removePublicShare(w http.ResponseWriter, r *http.Request, share *link.PublicShare) {
+	c, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting grpc client", err)
+		return
+	}
+
+	res, err := c.RemovePublicShare(r.Context(), &link.RemovePublicShareRequest{
+		Ref: &link.PublicShareReference{
+			Spec: &link.PublicShareReference_Id{
+				Id: share.Id,
+			},
+		},
+	})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc remove public share request", err)
+		return
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		if res.Status.Code == rpc.Code_CODE_NOT_FOUND {
+			WriteOCSError(w, r, MetaNotFound.StatusCode, "not found", nil)
+			return
+		}
+		WriteOCSError(w, r, MetaServerError.StatusCode, "grpc remove public share request failed", nil)
+		return
+	}
+
+	WriteOCSSuccess(w, r, nil)
+}
+
+// publicLinkPermissionsFromRequest reads the permissions or publicUpload form values.
+// The boolean tells whether any of them was present.
+func publicLinkPermissionsFromRequest(r *http.Request) (conversions.Permissions, bool, error) {
+	if pval := r.FormValue("permissions"); pval != "" {
+		pint, err := strconv.Atoi(pval)
+		if err != nil {
+			return conversions.PermissionInvalid, false, fmt.Errorf("permissions must be an integer")
+		}
+		p := conversions.Permissions(pint)
+		for _, allowed := range publicLinkPermissions {
+			if p == allowed {
+				return p, true, nil
+			}
+		}
+		return conversions.PermissionInvalid, false, fmt.Errorf("invalid permissions %d for a public link", pint)
+	}
+
+	if pu := r.FormValue("publicUpload"); pu != "" {
+		upload, err := strconv.ParseBool(pu)
+		if err != nil {
+			return conversions.PermissionInvalid, false, fmt.Errorf("publicUpload must be a boolean")
+		}
+		if upload {
+			return publicLinkPermissions[len(publicLinkPermissions)-1], true, nil
+		}
+		return conversions.PermissionRead, true, nil
+	}
+
+	return conversions.PermissionInvalid, false, nil
+}
+
+// expirationFromRequest parses the expireDate form value. It accepts the date
+// formats sent by the ownCloud clients.
+func expirationFromRequest(r *http.Request) (*types.Timestamp, bool, error) {
+	expireDate := r.FormValue("expireDate")
+	if expireDate == "" {
+		return nil, false, nil
+	}
+
+	var t time.Time
+	var err error
+	for _, layout := range []string{"2006-01-02T15:04:05Z0700", time.RFC3339, "2006-01-02"} {
+		if t, err = time.Parse(layout, expireDate); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(expireDate) == len("2006-01-02") {
+		// a date without time expires at the end of the day
+		t = t.Add(24*time.Hour - time.Second)
+	}
+
+	return &types.Timestamp{
+		Seconds: uint64(t.Unix()),
+		Nanos:   uint32(t.Nanosecond()),
+	}, true, nil
+}
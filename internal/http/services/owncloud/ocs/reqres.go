@@ -25,6 +25,7 @@ import (
 
 	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/i18n"
 )
 
 // Response is the top level response structure
@@ -94,6 +95,13 @@ func WriteOCSResponse(w http.ResponseWriter, r *http.Request, res *Response, err
 		appctx.GetLogger(r.Context()).Error().Err(err).Msg(res.OCS.Meta.Message)
 	}
 
+	if res.OCS.Meta.Status == "error" {
+		// copy the meta, the error responses share the Meta* ones
+		m := *res.OCS.Meta
+		m.Message = i18n.Translate(w, r, m.Message)
+		res = &Response{OCS: &Payload{Meta: &m, Data: res.OCS.Data}}
+	}
+
 	if r.URL.Query().Get("format") == "json" {
 		w.Header().Set("Content-Type", "application/json")
 		encoded, err = json.Marshal(res)
@@ -39,8 +39,10 @@ import (
 
 	"github.com/cs3org/reva/internal/http/services/owncloud/ocs/conversions"
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/ocm/provider/lookup"
 	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/share"
 	"github.com/pkg/errors"
 )
 
@@ -69,13 +71,19 @@ func (h *SharesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			return
 		case "GET":
+			if r.URL.Path == "/stats" {
+				h.listPublicShareStats(w, r)
+				return
+			}
 			h.listShares(w, r)
 		case "POST":
 			h.createShare(w, r)
 		case "PUT":
 			h.updateShare(w, r) // TODO PUT is used with incomplete data to update a share 🤦
+		case "DELETE":
+			h.removeShare(w, r)
 		default:
-			WriteOCSError(w, r, MetaBadRequest.StatusCode, "Only GET, POST and PUT are allowed", nil)
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "Only GET, POST, PUT and DELETE are allowed", nil)
 		}
 	case "sharees":
 		h.findSharees(w, r)
@@ -115,16 +123,59 @@ func (h *SharesHandler) findSharees(w http.ResponseWriter, r *http.Request) {
 		matches = append(matches, match)
 	}
 
+	exactRemotes, remotes := h.findRemoteSharees(r.Context(), gatewayProvider, term)
+
 	WriteOCSSuccess(w, r, &conversions.ShareeData{
 		Exact: &conversions.ExactMatchesData{
 			Users:   []*conversions.MatchData{},
 			Groups:  []*conversions.MatchData{},
-			Remotes: []*conversions.MatchData{},
+			Remotes: exactRemotes,
 		},
 		Users:   matches,
 		Groups:  []*conversions.MatchData{},
-		Remotes: []*conversions.MatchData{},
+		Remotes: remotes,
+	})
+}
+
+// findRemoteSharees returns the users of the trusted OCM providers matching
+// the term, the ones whose address is the term first. They are only
+// suggested when the gateway is configured to find them.
+func (h *SharesHandler) findRemoteSharees(ctx context.Context, client gateway.GatewayAPIClient, term string) ([]*conversions.MatchData, []*conversions.MatchData) {
+	log := appctx.GetLogger(ctx)
+	exact, matches := []*conversions.MatchData{}, []*conversions.MatchData{}
+
+	res, err := client.FindUsers(ctx, &userpb.FindUsersRequest{
+		Opaque: &types.Opaque{Map: map[string]*types.OpaqueEntry{
+			lookup.OpaqueKey: {Decoder: "plain", Value: []byte("1")},
+		}},
+		Filter: term,
 	})
+	if err != nil {
+		log.Error().Err(err).Msg("error searching remote users")
+		return exact, matches
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		if res.Status.Code != rpc.Code_CODE_UNIMPLEMENTED {
+			log.Error().Str("message", res.Status.Message).Msg("error searching remote users")
+		}
+		return exact, matches
+	}
+
+	for _, u := range res.Users {
+		match := &conversions.MatchData{
+			Label: fmt.Sprintf("%s (%s)", u.DisplayName, u.Id.Idp),
+			Value: &conversions.MatchValueData{
+				ShareType: int(conversions.ShareTypeFederatedCloudShare),
+				ShareWith: u.Id.OpaqueId + "@" + u.Id.Idp,
+			},
+		}
+		if strings.EqualFold(match.Value.ShareWith, term) {
+			exact = append(exact, match)
+			continue
+		}
+		matches = append(matches, match)
+	}
+	return exact, matches
 }
 
 func (h *SharesHandler) userAsMatch(u *userpb.User) *conversions.MatchData {
@@ -164,7 +215,7 @@ func (h *SharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 	}
 	prefix := hRes.GetPath()
 
-	if shareType == int(conversions.ShareTypeUser) {
+	if shareType == int(conversions.ShareTypeUser) || shareType == int(conversions.ShareTypeGroup) {
 
 		// if user sharing is disabled
 		if h.gatewayAddr == "" {
@@ -184,17 +235,29 @@ func (h *SharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		userRes, err := gatewayClient.GetUser(ctx, &userpb.GetUserRequest{
-			UserId: &userpb.UserId{OpaqueId: shareWith},
-		})
-		if err != nil {
-			WriteOCSError(w, r, MetaServerError.StatusCode, "error searching recipient", err)
-			return
+		// groups are granted as a whole, their members are resolved when
+		// they access the share
+		grantee := &provider.Grantee{
+			Type: provider.GranteeType_GRANTEE_TYPE_GROUP,
+			Id:   &userpb.UserId{OpaqueId: shareWith},
 		}
+		if shareType == int(conversions.ShareTypeUser) {
+			userRes, err := gatewayClient.GetUser(ctx, &userpb.GetUserRequest{
+				UserId: &userpb.UserId{OpaqueId: shareWith},
+			})
+			if err != nil {
+				WriteOCSError(w, r, MetaServerError.StatusCode, "error searching recipient", err)
+				return
+			}
 
-		if userRes.Status.Code != rpc.Code_CODE_OK {
-			WriteOCSError(w, r, MetaNotFound.StatusCode, "user not found", err)
-			return
+			if userRes.Status.Code != rpc.Code_CODE_OK {
+				WriteOCSError(w, r, MetaNotFound.StatusCode, "user not found", err)
+				return
+			}
+			grantee = &provider.Grantee{
+				Type: provider.GranteeType_GRANTEE_TYPE_USER,
+				Id:   userRes.User.GetId(),
+			}
 		}
 
 		var permissions conversions.Permissions
@@ -228,6 +291,16 @@ func (h *SharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 			resourcePermissions = asCS3Permissions(permissions, nil)
 		}
 
+		expiration, _, err := expirationFromRequest(r)
+		if err != nil {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "invalid expireDate", err)
+			return
+		}
+		if expiration != nil && int64(expiration.Seconds) <= time.Now().Unix() {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "expireDate must be in the future", nil)
+			return
+		}
+
 		roleMap := map[string]string{"name": role}
 		val, err := json.Marshal(roleMap)
 		if err != nil {
@@ -258,21 +331,17 @@ func (h *SharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		opaque := share.ExpirationToOpaque(expiration)
+		opaque.Map["role"] = &types.OpaqueEntry{
+			Decoder: "json",
+			Value:   val,
+		}
+
 		createShareReq := &collaboration.CreateShareRequest{
-			Opaque: &types.Opaque{
-				Map: map[string]*types.OpaqueEntry{
-					"role": &types.OpaqueEntry{
-						Decoder: "json",
-						Value:   val,
-					},
-				},
-			},
+			Opaque:       opaque,
 			ResourceInfo: statRes.Info,
 			Grant: &collaboration.ShareGrant{
-				Grantee: &provider.Grantee{
-					Type: provider.GranteeType_GRANTEE_TYPE_USER,
-					Id:   userRes.User.GetId(),
-				},
+				Grantee: grantee,
 				Permissions: &collaboration.SharePermissions{
 					Permissions: resourcePermissions,
 				},
@@ -289,6 +358,10 @@ func (h *SharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 				WriteOCSError(w, r, MetaNotFound.StatusCode, "not found", nil)
 				return
 			}
+			if createShareResponse.Status.Code == rpc.Code_CODE_PERMISSION_DENIED {
+				WriteOCSError(w, r, http.StatusForbidden, createShareResponse.Status.Message, nil)
+				return
+			}
 			WriteOCSError(w, r, MetaServerError.StatusCode, "grpc create share request failed", err)
 			return
 		}
@@ -297,6 +370,10 @@ func (h *SharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 			WriteOCSError(w, r, MetaServerError.StatusCode, "error mapping share data", err)
 			return
 		}
+		if err := setShareExpiration(s, createShareResponse.Opaque); err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error reading share expiration", err)
+			return
+		}
 		s.Path = r.FormValue("path") // use path without user prefix
 		// s.MailSend = "0"
 		WriteOCSSuccess(w, r, s)
@@ -305,87 +382,7 @@ func (h *SharesHandler) createShare(w http.ResponseWriter, r *http.Request) {
 
 	// create a public link share
 	if shareType == int(conversions.ShareTypePublicLink) {
-		// get a connection to the public shares service
-		c, err := pool.GetGatewayServiceClient(h.gatewayAddr)
-		if err != nil {
-			log.Debug().Err(err).Str("createShare", "shares").Msg("error creating public link share")
-			WriteOCSError(w, r, MetaServerError.StatusCode, "missing user in context", fmt.Errorf("error getting a connection to a public shares provider"))
-			return
-		}
-
-		statReq := provider.StatRequest{
-			Ref: &provider.Reference{
-				Spec: &provider.Reference_Path{
-					Path: path.Join(prefix, r.FormValue("path")), // TODO replace path with target
-				},
-			},
-		}
-
-		statRes, err := c.Stat(ctx, &statReq)
-		if err != nil {
-			log.Debug().Err(err).Str("createShare", "shares").Msg("error on stat call")
-			WriteOCSError(w, r, MetaServerError.StatusCode, "missing resource information", fmt.Errorf("error getting resource information"))
-			return
-		}
-
-		// TODO(refs) set permissions to what phoenix sends
-		// TODO(refs) error handling please
-		testPerm, _ := h.role2CS3Permissions(conversions.RoleViewer)
-
-		req := link.CreatePublicShareRequest{
-			ResourceInfo: statRes.GetInfo(),
-			Grant: &link.Grant{
-				Permissions: &link.PublicSharePermissions{
-					Permissions: testPerm,
-				},
-			},
-		}
-
-		var expireTime time.Time
-		expireDate := r.FormValue("expireDate")
-		if expireDate != "" {
-			expireTime, err = time.Parse("2006-01-02T15:04:05Z0700", expireDate)
-			if err != nil {
-				WriteOCSError(w, r, MetaServerError.StatusCode, "invalid date format", err)
-				return
-			}
-			req.Grant.Expiration = &types.Timestamp{
-				Nanos:   uint32(expireTime.UnixNano()),
-				Seconds: uint64(expireTime.Unix()),
-			}
-		}
-
-		// set displayname and password protected as arbitrary metadata
-		req.ResourceInfo.ArbitraryMetadata = &provider.ArbitraryMetadata{
-			Metadata: map[string]string{
-				"name": r.FormValue("name"),
-				// "password": r.FormValue("password"),
-			},
-		}
-
-		createRes, err := c.CreatePublicShare(ctx, &req)
-		if err != nil {
-			log.Debug().Err(err).Str("createShare", "shares").Msgf("error creating a public share to resource id: %v", statRes.Info.GetId())
-			WriteOCSError(w, r, MetaServerError.StatusCode, "error creating public share", fmt.Errorf("error creating a public share to resource id: %v", statRes.Info.GetId()))
-			return
-		}
-
-		if createRes.Status.Code != rpc.Code_CODE_OK {
-			log.Debug().Err(errors.New("create public share failed")).Str("shares", "createShare").Msgf("create public share failed with status code: %v", createRes.Status.Code.String())
-			WriteOCSError(w, r, MetaServerError.StatusCode, "grpc create public share request failed", err)
-			return
-		}
-
-		s := conversions.PublicShare2ShareData(createRes.Share, r)
-		err = h.addFileInfo(ctx, s, statRes.Info)
-
-		if err != nil {
-			WriteOCSError(w, r, MetaServerError.StatusCode, "error enhancing response with share data", err)
-			return
-		}
-
-		WriteOCSSuccess(w, r, s)
-
+		h.createPublicLinkShare(w, r, prefix)
 		return
 	}
 
@@ -499,25 +496,68 @@ func (h *SharesHandler) role2CS3Permissions(r string) (*provider.ResourcePermiss
 
 func (h *SharesHandler) updateShare(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	shareID := strings.TrimLeft(r.URL.Path, "/")
 
-	pval := r.FormValue("permissions")
-	if pval == "" {
-		WriteOCSError(w, r, MetaBadRequest.StatusCode, "permissions missing", nil)
+	if err := r.ParseForm(); err != nil {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "error parsing form", err)
 		return
 	}
 
-	pint, err := strconv.Atoi(pval)
+	publicShare, err := h.getPublicShare(r, shareID)
 	if err != nil {
-		WriteOCSError(w, r, MetaBadRequest.StatusCode, "permissions must be an integer", nil)
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error looking up public share", err)
 		return
 	}
-	permissions, err := conversions.NewPermissions(pint)
-	if err != nil {
-		WriteOCSError(w, r, MetaBadRequest.StatusCode, err.Error(), nil)
+	if publicShare != nil {
+		h.updatePublicShare(w, r, publicShare)
 		return
 	}
 
-	shareID := strings.TrimLeft(r.URL.Path, "/")
+	// the permissions and the expiration can be updated independently
+	_, updateExpiration := r.Form["expireDate"]
+	pval := r.FormValue("permissions")
+	if pval == "" && !updateExpiration {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "permissions missing", nil)
+		return
+	}
+
+	var field *collaboration.UpdateShareRequest_UpdateField
+	if pval != "" {
+		pint, err := strconv.Atoi(pval)
+		if err != nil {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "permissions must be an integer", nil)
+			return
+		}
+		permissions, err := conversions.NewPermissions(pint)
+		if err != nil {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, err.Error(), nil)
+			return
+		}
+		field = &collaboration.UpdateShareRequest_UpdateField{
+			Field: &collaboration.UpdateShareRequest_UpdateField_Permissions{
+				Permissions: &collaboration.SharePermissions{
+					// this completely overwrites the permissions for this user
+					Permissions: asCS3Permissions(permissions, nil),
+				},
+			},
+		}
+	}
+
+	var opaque *types.Opaque
+	if updateExpiration {
+		// an empty date removes the expiration
+		expiration, _, err := expirationFromRequest(r)
+		if err != nil {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "invalid expireDate", err)
+			return
+		}
+		if expiration != nil && int64(expiration.Seconds) <= time.Now().Unix() {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "expireDate must be in the future", nil)
+			return
+		}
+		opaque = share.ExpirationToOpaque(expiration)
+	}
+
 	// TODO we need to lookup the storage that is responsible for this share
 
 	uClient, err := pool.GetGatewayServiceClient(h.gatewayAddr)
@@ -527,6 +567,7 @@ func (h *SharesHandler) updateShare(w http.ResponseWriter, r *http.Request) {
 	}
 
 	uReq := &collaboration.UpdateShareRequest{
+		Opaque: opaque,
 		Ref: &collaboration.ShareReference{
 			Spec: &collaboration.ShareReference_Id{
 				Id: &collaboration.ShareId{
@@ -534,14 +575,7 @@ func (h *SharesHandler) updateShare(w http.ResponseWriter, r *http.Request) {
 				},
 			},
 		},
-		Field: &collaboration.UpdateShareRequest_UpdateField{
-			Field: &collaboration.UpdateShareRequest_UpdateField_Permissions{
-				Permissions: &collaboration.SharePermissions{
-					// this completely overwrites the permissions for this user
-					Permissions: asCS3Permissions(permissions, nil),
-				},
-			},
-		},
+		Field: field,
 	}
 	uRes, err := uClient.UpdateShare(ctx, uReq)
 	if err != nil {
@@ -554,6 +588,10 @@ func (h *SharesHandler) updateShare(w http.ResponseWriter, r *http.Request) {
 			WriteOCSError(w, r, MetaNotFound.StatusCode, "not found", nil)
 			return
 		}
+		if uRes.Status.Code == rpc.Code_CODE_PERMISSION_DENIED {
+			WriteOCSError(w, r, http.StatusForbidden, uRes.Status.Message, nil)
+			return
+		}
 		WriteOCSError(w, r, MetaServerError.StatusCode, "grpc update share request failed", err)
 		return
 	}
@@ -582,20 +620,75 @@ func (h *SharesHandler) updateShare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	share, err := h.userShare2ShareData(ctx, gRes.Share)
+	sd, err := h.userShare2ShareData(ctx, gRes.Share)
 	if err != nil {
 		WriteOCSError(w, r, MetaServerError.StatusCode, "error mapping share data", err)
 		return
 	}
+	if err := setShareExpiration(sd, gRes.Opaque); err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error reading share expiration", err)
+		return
+	}
 
-	WriteOCSSuccess(w, r, share)
+	WriteOCSSuccess(w, r, sd)
+}
+
+func (h *SharesHandler) removeShare(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	shareID := strings.TrimLeft(r.URL.Path, "/")
+
+	publicShare, err := h.getPublicShare(r, shareID)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error looking up public share", err)
+		return
+	}
+	if publicShare != nil {
+		h.removePublicShare(w, r, publicShare)
+		return
+	}
+
+	uClient, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting grpc client", err)
+		return
+	}
+
+	uRes, err := uClient.RemoveShare(ctx, &collaboration.RemoveShareRequest{
+		Ref: &collaboration.ShareReference{
+			Spec: &collaboration.ShareReference_Id{
+				Id: &collaboration.ShareId{
+					OpaqueId: shareID,
+				},
+			},
+		},
+	})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc remove share request", err)
+		return
+	}
+
+	if uRes.Status.Code != rpc.Code_CODE_OK {
+		if uRes.Status.Code == rpc.Code_CODE_NOT_FOUND {
+			WriteOCSError(w, r, MetaNotFound.StatusCode, "not found", nil)
+			return
+		}
+		WriteOCSError(w, r, MetaServerError.StatusCode, "grpc remove share request failed", nil)
+		return
+	}
+
+	WriteOCSSuccess(w, r, nil)
 }
 
 func (h *SharesHandler) listShares(w http.ResponseWriter, r *http.Request) {
 	shares := make([]*conversions.ShareData, 0)
 	filters := []*collaboration.ListSharesRequest_Filter{}
 	linkFilters := []*link.ListPublicSharesRequest_Filter{}
-	var err error
+
+	q, listLinks, err := shareQuery(r)
+	if err != nil {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, err.Error(), nil)
+		return
+	}
 
 	// do shared with me. Please abstract this piece, this reads like hell.
 	if r.FormValue("shared_with_me") != "" {
@@ -605,7 +698,11 @@ func (h *SharesHandler) listShares(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if listSharedWithMe {
-			sharedWithMe := h.listSharedWithMe(r)
+			sharedWithMe, expirations, err := h.listSharedWithMe(r, q)
+			if err != nil {
+				WriteOCSError(w, r, MetaServerError.StatusCode, err.Error(), err)
+				return
+			}
 
 			sClient, err := pool.GetGatewayServiceClient(h.gatewayAddr)
 			if err != nil {
@@ -634,6 +731,9 @@ func (h *SharesHandler) listShares(w http.ResponseWriter, r *http.Request) {
 					WriteOCSError(w, r, MetaServerError.StatusCode, err.Error(), err)
 					return
 				}
+				if exp := expirations[v.Share.GetId().GetOpaqueId()]; exp != nil {
+					data.Expiration = conversions.TimestampToExpiration(exp)
+				}
 
 				err = h.addFileInfo(r.Context(), data, statResponse.Info)
 				if err != nil {
@@ -668,37 +768,108 @@ func (h *SharesHandler) listShares(w http.ResponseWriter, r *http.Request) {
 
 		filters, linkFilters, err = h.addFilters(w, r, hRes.GetPath())
 		if err != nil {
-			WriteOCSError(w, r, MetaServerError.StatusCode, err.Error(), err)
 			return
 		}
 	}
 
-	userShares, err := h.listUserShares(r, filters)
-	if err != nil {
-		WriteOCSError(w, r, MetaServerError.StatusCode, err.Error(), err)
-		return
+	// the user shares come before the links, so only the first
+	// offset+limit user shares can be part of the page
+	userQuery := &share.Query{GranteeTypes: q.GranteeTypes}
+	if !listLinks {
+		userQuery.Offset, userQuery.Limit = q.Offset, q.Limit
+	} else if q.Limit > 0 {
+		userQuery.Limit = q.Offset + q.Limit
+	}
+	if len(q.GranteeTypes) > 0 || !listLinks {
+		userShares, err := h.listUserShares(r, filters, userQuery)
+		if err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, err.Error(), err)
+			return
+		}
+		shares = append(shares, userShares...)
 	}
 
-	publicShares, err := h.listPublicShares(r, linkFilters)
-	if err != nil {
-		WriteOCSError(w, r, MetaServerError.StatusCode, err.Error(), err)
-		return
+	if listLinks {
+		if q.Limit == 0 || len(shares) < q.Offset+q.Limit {
+			publicShares, err := h.listPublicShares(r, linkFilters)
+			if err != nil {
+				WriteOCSError(w, r, MetaServerError.StatusCode, err.Error(), err)
+				return
+			}
+			shares = append(shares, publicShares...)
+		}
+		start, end := q.Page(len(shares))
+		shares = shares[start:end]
 	}
-	shares = append(shares, append(userShares, publicShares...)...)
 
 	WriteOCSSuccess(w, r, &conversions.Element{Data: shares})
 }
 
-func (h *SharesHandler) listSharedWithMe(r *http.Request) []*collaboration.ReceivedShare {
+// shareQuery returns the query of the share_types, state, offset and limit
+// parameters, and whether the public links are listed.
+func shareQuery(r *http.Request) (*share.Query, bool, error) {
+	q := &share.Query{}
+	listLinks := true
+	if v := r.FormValue("share_types"); v != "" {
+		listLinks = false
+		for _, t := range strings.Split(v, ",") {
+			st, err := strconv.Atoi(strings.TrimSpace(t))
+			if err != nil {
+				return nil, false, errors.New("share_types must be a list of integers")
+			}
+			switch conversions.ShareType(st) {
+			case conversions.ShareTypeUser:
+				q.GranteeTypes = append(q.GranteeTypes, provider.GranteeType_GRANTEE_TYPE_USER)
+			case conversions.ShareTypeGroup:
+				q.GranteeTypes = append(q.GranteeTypes, provider.GranteeType_GRANTEE_TYPE_GROUP)
+			case conversions.ShareTypePublicLink:
+				listLinks = true
+			}
+		}
+	}
+
+	if v := r.FormValue("state"); v != "" && v != "all" {
+		st, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, false, errors.New("state must be an integer or all")
+		}
+		states, err := conversions.OCSStateToCS3(st)
+		if err != nil {
+			return nil, false, err
+		}
+		q.States = states
+	}
+
+	for param, dst := range map[string]*int{"offset": &q.Offset, "limit": &q.Limit} {
+		if v := r.FormValue(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, false, errors.New(param + " must be a positive integer")
+			}
+			*dst = n
+		}
+	}
+	return q, listLinks, nil
+}
+
+func (h *SharesHandler) listSharedWithMe(r *http.Request, q *share.Query) ([]*collaboration.ReceivedShare, map[string]*types.Timestamp, error) {
 	c, err := pool.GetUserShareProviderClient(h.gatewayAddr)
 	if err != nil {
 		panic(err)
 	}
 
-	lrs := collaboration.ListReceivedSharesRequest{}
+	opaque, err := share.QueryToOpaque(q)
+	if err != nil {
+		return nil, nil, err
+	}
+	lrs := collaboration.ListReceivedSharesRequest{Opaque: opaque}
 	// TODO(refs) handle error...
 	shares, _ := c.ListReceivedShares(r.Context(), &lrs)
-	return shares.GetShares()
+	expirations, err := share.ExpirationsFromOpaque(shares.GetOpaque())
+	if err != nil {
+		return nil, nil, err
+	}
+	return shares.GetShares(), expirations, nil
 }
 
 func (h *SharesHandler) listPublicShares(r *http.Request, filters []*link.ListPublicSharesRequest_Filter) ([]*conversions.ShareData, error) {
@@ -747,6 +918,7 @@ func (h *SharesHandler) listPublicShares(r *http.Request, filters []*link.ListPu
 			}
 
 			sData.Name = share.DisplayName
+			addPublicShareStats(ctx, sData, res.Opaque)
 
 			if h.addFileInfo(ctx, sData, statResponse.Info) != nil {
 				return nil, err
@@ -804,29 +976,63 @@ func (h *SharesHandler) addFilters(w http.ResponseWriter, r *http.Request, prefi
 
 	info = res.Info
 
-	collaborationFilters = append(collaborationFilters, &collaboration.ListSharesRequest_Filter{
-		Type: collaboration.ListSharesRequest_Filter_TYPE_RESOURCE_ID,
-		Term: &collaboration.ListSharesRequest_Filter_ResourceId{
-			ResourceId: info.Id,
-		},
-	})
+	// with subfiles the shares of the content of the folder are listed
+	ids := []*provider.ResourceId{info.Id}
+	if subfiles, _ := strconv.ParseBool(r.FormValue("subfiles")); subfiles {
+		if info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "subfiles requires a folder", nil)
+			return nil, nil, errors.New("not a folder")
+		}
+		lcRes, err := gwClient.ListContainer(ctx, &provider.ListContainerRequest{Ref: statReq.Ref})
+		if err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc list container request", err)
+			return nil, nil, err
+		}
+		if lcRes.Status.Code != rpc.Code_CODE_OK {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "grpc list container request failed", nil)
+			return nil, nil, errors.New("list container failed")
+		}
+		ids = ids[:0]
+		for _, child := range lcRes.Infos {
+			ids = append(ids, child.Id)
+		}
+		if len(ids) == 0 {
+			// an empty folder has no shared content
+			WriteOCSSuccess(w, r, &conversions.Element{Data: []*conversions.ShareData{}})
+			return nil, nil, errors.New("empty folder")
+		}
+	}
 
-	linkFilters = append(linkFilters, &link.ListPublicSharesRequest_Filter{
-		Type: link.ListPublicSharesRequest_Filter_TYPE_RESOURCE_ID,
-		Term: &link.ListPublicSharesRequest_Filter_ResourceId{
-			ResourceId: info.Id,
-		},
-	})
+	for _, id := range ids {
+		collaborationFilters = append(collaborationFilters, &collaboration.ListSharesRequest_Filter{
+			Type: collaboration.ListSharesRequest_Filter_TYPE_RESOURCE_ID,
+			Term: &collaboration.ListSharesRequest_Filter_ResourceId{
+				ResourceId: id,
+			},
+		})
+
+		linkFilters = append(linkFilters, &link.ListPublicSharesRequest_Filter{
+			Type: link.ListPublicSharesRequest_Filter_TYPE_RESOURCE_ID,
+			Term: &link.ListPublicSharesRequest_Filter_ResourceId{
+				ResourceId: id,
+			},
+		})
+	}
 
 	return collaborationFilters, linkFilters, nil
 }
 
-func (h *SharesHandler) listUserShares(r *http.Request, filters []*collaboration.ListSharesRequest_Filter) ([]*conversions.ShareData, error) {
+func (h *SharesHandler) listUserShares(r *http.Request, filters []*collaboration.ListSharesRequest_Filter, q *share.Query) ([]*conversions.ShareData, error) {
 	var rInfo *provider.ResourceInfo
 	ctx := r.Context()
 	log := appctx.GetLogger(ctx)
 
+	opaque, err := share.QueryToOpaque(q)
+	if err != nil {
+		return nil, err
+	}
 	lsUserSharesRequest := collaboration.ListSharesRequest{
+		Opaque:  opaque,
 		Filters: filters,
 	}
 
@@ -848,12 +1054,20 @@ func (h *SharesHandler) listUserShares(r *http.Request, filters []*collaboration
 			return nil, err
 		}
 
+		expirations, err := share.ExpirationsFromOpaque(lsUserSharesResponse.Opaque)
+		if err != nil {
+			return nil, err
+		}
+
 		// build OCS response payload
 		for _, s := range lsUserSharesResponse.Shares {
-			share, err := h.userShare2ShareData(ctx, s)
+			sd, err := h.userShare2ShareData(ctx, s)
 			if err != nil {
 				return nil, err
 			}
+			if exp := expirations[s.GetId().GetOpaqueId()]; exp != nil {
+				sd.Expiration = conversions.TimestampToExpiration(exp)
+			}
 
 			// check if the resource exists
 			sClient, err := pool.GetGatewayServiceClient(h.gatewayAddr)
@@ -879,12 +1093,12 @@ func (h *SharesHandler) listUserShares(r *http.Request, filters []*collaboration
 				return nil, err
 			}
 
-			if h.addFileInfo(ctx, share, statResponse.Info) != nil {
+			if h.addFileInfo(ctx, sd, statResponse.Info) != nil {
 				return nil, err
 			}
 
-			log.Debug().Interface("share", s).Interface("info", rInfo).Interface("shareData", share).Msg("mapped")
-			ocsDataPayload = append(ocsDataPayload, share)
+			log.Debug().Interface("share", s).Interface("info", rInfo).Interface("shareData", sd).Msg("mapped")
+			ocsDataPayload = append(ocsDataPayload, sd)
 		}
 	}
 
@@ -1044,7 +1258,11 @@ func (h *SharesHandler) userShare2ShareData(ctx context.Context, share *collabor
 			return nil, err
 		}
 	}
-	if share.Grantee.Id != nil {
+	if share.Grantee.GetType() == provider.GranteeType_GRANTEE_TYPE_GROUP {
+		sd.ShareType = conversions.ShareTypeGroup
+		sd.ShareWith = share.Grantee.GetId().GetOpaqueId()
+		sd.ShareWithDisplayname = sd.ShareWith
+	} else if share.Grantee.Id != nil {
 		grantee, err := c.GetUser(ctx, &userpb.GetUserRequest{
 			UserId: share.Grantee.GetId(),
 		})
@@ -1072,10 +1290,21 @@ func (h *SharesHandler) userShare2ShareData(ctx context.Context, share *collabor
 		sd.STime = share.Ctime.Seconds // TODO CS3 api birth time = btime
 	}
 	// actually clients should be able to GET and cache the user info themselves ...
-	// TODO check grantee type for user vs group
 	return sd, nil
 }
 
+// setShareExpiration sets the expiration carried by the opaque data of a share response.
+func setShareExpiration(sd *conversions.ShareData, o *types.Opaque) error {
+	exp, _, err := share.ExpirationFromOpaque(o)
+	if err != nil {
+		return err
+	}
+	if exp != nil {
+		sd.Expiration = conversions.TimestampToExpiration(exp)
+	}
+	return nil
+}
+
 // mustGetGateway returns a client to the gateway service, returns an error otherwise
 func mustGetGateway(addr string, r *http.Request, w http.ResponseWriter) gateway.GatewayAPIClient {
 	client, err := pool.GetGatewayServiceClient(addr)
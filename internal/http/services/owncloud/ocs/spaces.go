@@ -0,0 +1,301 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocs
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/internal/http/services/owncloud/ocs/conversions"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/spaces"
+	"github.com/cs3org/reva/pkg/spaces/manager/registry"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+// SpacesHandler administers the project spaces. Admins create and delete
+// the spaces, the managers of a space administer its members.
+type SpacesHandler struct {
+	mgr         spaces.Manager
+	gatewayAddr string
+	mount       string
+	adminGroup  string
+}
+
+// SpaceData holds the details of a space and the role of the current user.
+type SpaceData struct {
+	ID      string        `json:"id" xml:"id"`
+	Name    string        `json:"name" xml:"name"`
+	Group   string        `json:"group" xml:"group"`
+	Path    string        `json:"path" xml:"path"`
+	Role    string        `json:"role" xml:"role"`
+	Members []*MemberData `json:"members" xml:"members>element"`
+	Ctime   int64         `json:"ctime" xml:"ctime"`
+}
+
+// MemberData holds a member of a space and its role.
+type MemberData struct {
+	Type string `json:"type" xml:"type"`
+	Name string `json:"name" xml:"name"`
+	Role string `json:"role" xml:"role"`
+}
+
+func (h *SpacesHandler) init(c *Config) error {
+	h.gatewayAddr = c.GatewaySvc
+	h.mount = c.SpacesMount
+	h.adminGroup = c.AdminGroup
+
+	f, ok := registry.NewFuncs[c.SpacesManager]
+	if !ok {
+		return fmt.Errorf("driver %s not found for spaces manager", c.SpacesManager)
+	}
+	mgr, err := f(c.SpacesManagers[c.SpacesManager])
+	if err != nil {
+		return err
+	}
+	h.mgr = mgr
+	return nil
+}
+
+func (h *SpacesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := ctxuser.ContextGetUser(r.Context())
+	if !ok {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "missing user in context", nil)
+		return
+	}
+
+	var id string
+	id, r.URL.Path = router.ShiftPath(r.URL.Path)
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, r, u)
+		case http.MethodPost:
+			h.create(w, r, u)
+		default:
+			WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+		}
+		return
+	}
+
+	s, err := h.mgr.GetSpace(r.Context(), id)
+	if err != nil {
+		writeSpacesError(w, r, "error getting space", err)
+		return
+	}
+	role := h.roleOf(s, u)
+	if role == "" {
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "space not found", nil)
+		return
+	}
+
+	var head string
+	head, r.URL.Path = router.ShiftPath(r.URL.Path)
+	switch {
+	case head == "" && r.Method == http.MethodGet:
+		WriteOCSSuccess(w, r, h.spaceData(s, role))
+	case head == "" && r.Method == http.MethodDelete:
+		if !h.isAdmin(u) {
+			WriteOCSError(w, r, http.StatusForbidden, "only admins can delete spaces", nil)
+			return
+		}
+		h.delete(w, r, s)
+	case head == "members" && !spaces.CanManage(role):
+		WriteOCSError(w, r, http.StatusForbidden, "only managers can administer the members", nil)
+	case head == "members":
+		h.members(w, r, s)
+	default:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	}
+}
+
+func (h *SpacesHandler) isAdmin(u *userpb.User) bool {
+	for _, g := range u.Groups {
+		if g == h.adminGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// roleOf returns the role of the user in the space, admins manage every space.
+func (h *SpacesHandler) roleOf(s *spaces.Space, u *userpb.User) string {
+	if h.isAdmin(u) {
+		return spaces.RoleManager
+	}
+	return spaces.RoleOf(s, u)
+}
+
+func (h *SpacesHandler) spaceData(s *spaces.Space, role string) *SpaceData {
+	data := &SpaceData{
+		ID:      s.ID,
+		Name:    s.Name,
+		Group:   s.Group,
+		Path:    path.Join(h.mount, s.ID),
+		Role:    role,
+		Members: make([]*MemberData, 0, len(s.Members)),
+		Ctime:   s.Ctime.Unix(),
+	}
+	for _, m := range s.Members {
+		data.Members = append(data.Members, &MemberData{Type: m.Type, Name: m.Name, Role: m.Role})
+	}
+	return data
+}
+
+func (h *SpacesHandler) list(w http.ResponseWriter, r *http.Request, u *userpb.User) {
+	list, err := h.mgr.ListSpaces(r.Context())
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error listing spaces", err)
+		return
+	}
+
+	data := []*SpaceData{}
+	for _, s := range list {
+		if role := h.roleOf(s, u); role != "" {
+			data = append(data, h.spaceData(s, role))
+		}
+	}
+	WriteOCSSuccess(w, r, &conversions.Element{Data: data})
+}
+
+func (h *SpacesHandler) create(w http.ResponseWriter, r *http.Request, u *userpb.User) {
+	if !h.isAdmin(u) {
+		WriteOCSError(w, r, http.StatusForbidden, "only admins can create spaces", nil)
+		return
+	}
+
+	s := &spaces.Space{
+		ID:    r.FormValue("id"),
+		Name:  r.FormValue("name"),
+		Group: r.FormValue("group"),
+	}
+	if !spaces.ValidID(s.ID) {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "invalid space id", nil)
+		return
+	}
+	if s.Group == "" {
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "missing group", nil)
+		return
+	}
+	if s.Name == "" {
+		s.Name = s.ID
+	}
+
+	if err := h.mgr.CreateSpace(r.Context(), s); err != nil {
+		writeSpacesError(w, r, "error creating space", err)
+		return
+	}
+
+	s, err := h.mgr.GetSpace(r.Context(), s.ID)
+	if err != nil {
+		writeSpacesError(w, r, "error getting space", err)
+		return
+	}
+	WriteOCSSuccess(w, r, h.spaceData(s, spaces.RoleManager))
+}
+
+// delete removes the content of the space before the space itself, the
+// storage only lets the managers of existing spaces delete it.
+func (h *SpacesHandler) delete(w http.ResponseWriter, r *http.Request, s *spaces.Space) {
+	ctx := r.Context()
+	client, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error getting grpc gateway client", err)
+		return
+	}
+
+	res, err := client.Delete(ctx, &provider.DeleteRequest{
+		Ref: &provider.Reference{
+			Spec: &provider.Reference_Path{Path: path.Join(h.mount, s.ID)},
+		},
+	})
+	if err != nil {
+		WriteOCSError(w, r, MetaServerError.StatusCode, "error sending a grpc delete request", err)
+		return
+	}
+	if res.Status.Code != rpc.Code_CODE_OK && res.Status.Code != rpc.Code_CODE_NOT_FOUND {
+		WriteOCSError(w, r, MetaServerError.StatusCode, res.Status.Message, nil)
+		return
+	}
+
+	if err := h.mgr.DeleteSpace(ctx, s.ID); err != nil {
+		writeSpacesError(w, r, "error deleting space", err)
+		return
+	}
+	WriteOCSSuccess(w, r, nil)
+}
+
+func (h *SpacesHandler) members(w http.ResponseWriter, r *http.Request, s *spaces.Space) {
+	ctx := r.Context()
+
+	// /members and /members/{type}/{name}
+	var memberType, name string
+	memberType, r.URL.Path = router.ShiftPath(r.URL.Path)
+	name, r.URL.Path = router.ShiftPath(r.URL.Path)
+	if memberType == "" && r.Method == http.MethodPost {
+		memberType, name = r.FormValue("type"), r.FormValue("name")
+	}
+
+	switch {
+	case memberType == "" && r.Method == http.MethodGet:
+		WriteOCSSuccess(w, r, &conversions.Element{Data: h.spaceData(s, "").Members})
+	case name != "" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		if memberType != spaces.MemberUser && memberType != spaces.MemberGroup {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "unknown member type: "+memberType, nil)
+			return
+		}
+		role := r.FormValue("role")
+		if !spaces.ValidRole(role) {
+			WriteOCSError(w, r, MetaBadRequest.StatusCode, "unknown role: "+role, nil)
+			return
+		}
+		if err := h.mgr.SetMember(ctx, s.ID, &spaces.Member{Type: memberType, Name: name, Role: role}); err != nil {
+			writeSpacesError(w, r, "error setting member", err)
+			return
+		}
+		WriteOCSSuccess(w, r, &MemberData{Type: memberType, Name: name, Role: role})
+	case name != "" && r.Method == http.MethodDelete:
+		if err := h.mgr.RemoveMember(ctx, s.ID, memberType, name); err != nil {
+			writeSpacesError(w, r, "error removing member", err)
+			return
+		}
+		WriteOCSSuccess(w, r, nil)
+	case r.Method == http.MethodPost:
+		WriteOCSError(w, r, MetaBadRequest.StatusCode, "missing member type or name", nil)
+	default:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
+	}
+}
+
+func writeSpacesError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch err.(type) {
+	case errtypes.IsNotFound:
+		WriteOCSError(w, r, MetaNotFound.StatusCode, "not found", nil)
+	case errtypes.IsAlreadyExists:
+		WriteOCSError(w, r, http.StatusConflict, "space already exists", nil)
+	default:
+		WriteOCSError(w, r, MetaServerError.StatusCode, msg, err)
+	}
+}
@@ -19,15 +19,54 @@
 package ocs
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/auth/password"
+	"github.com/cs3org/reva/pkg/auth/throttle"
+	"github.com/cs3org/reva/pkg/events"
+	eventsregistry "github.com/cs3org/reva/pkg/events/publisher/registry"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
 	"github.com/cs3org/reva/pkg/rhttp/router"
 	ctxuser "github.com/cs3org/reva/pkg/user"
+	"github.com/pkg/errors"
 )
 
-// The UsersHandler renders user data for the user id given in the url path
+// The UsersHandler renders user data for the user id given in the url path.
+// When a userprovider service is configured it also lets admins provision
+// users through it.
 type UsersHandler struct {
+	gatewayAddr      string
+	userProviderAddr string
+	adminGroup       string
+	policy           password.Policy
+	throttler        *throttle.Throttler
+	publisher        events.Publisher
+}
+
+func (h *UsersHandler) init(c *Config) error {
+	h.gatewayAddr = c.GatewaySvc
+	h.userProviderAddr = c.UserProviderSvc
+	h.adminGroup = c.AdminGroup
+	h.policy = c.PasswordPolicy
+	throttler, err := throttle.New(c.Throttle)
+	if err != nil {
+		return err
+	}
+	h.throttler = throttler
+	if c.EventsPublisher != "" {
+		f, ok := eventsregistry.NewFuncs[c.EventsPublisher]
+		if !ok {
+			return fmt.Errorf("events publisher not found: %s", c.EventsPublisher)
+		}
+		if h.publisher, err = f(c.EventsPublishers[c.EventsPublisher]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -36,6 +75,11 @@ func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var user string
 	user, r.URL.Path = router.ShiftPath(r.URL.Path)
 
+	if h.userProviderAddr != "" {
+		h.provision(w, r, user)
+		return
+	}
+
 	// FIXME use ldap to fetch user info
 	u, ok := ctxuser.ContextGetUser(ctx)
 	if !ok {
@@ -52,16 +96,13 @@ func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	head, r.URL.Path = router.ShiftPath(r.URL.Path)
 	switch head {
 	case "":
+		quota, err := h.getQuota(ctx)
+		if err != nil {
+			WriteOCSError(w, r, MetaServerError.StatusCode, "error getting quota", err)
+			return
+		}
 		WriteOCSSuccess(w, r, &UsersData{
-			// FIXME query storages? cache a summary?
-			// TODO use list of storages to allow clients to resolve quota status
-			Quota: &QuotaData{
-				Free:       2840756224000,
-				Used:       5059416668,
-				Total:      2845815640668,
-				Relative:   0.18,
-				Definition: "default",
-			},
+			Quota:       quota,
 			DisplayName: u.DisplayName,
 			Email:       u.Mail,
 		})
@@ -76,6 +117,47 @@ func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// getQuota returns the quota of the home of the user in ctx.
+func (h *UsersHandler) getQuota(ctx context.Context) (*QuotaData, error) {
+	c, err := pool.GetGatewayServiceClient(h.gatewayAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting gateway client")
+	}
+
+	res, err := c.GetQuota(ctx, &gateway.GetQuotaRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending get quota grpc request")
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_UNIMPLEMENTED:
+		return &QuotaData{Free: quotaUnlimited, Total: quotaUnlimited, Definition: "none"}, nil
+	default:
+		return nil, errors.New("error getting quota: " + res.Status.Message)
+	}
+
+	used := int64(res.UsedBytes)
+	if res.TotalBytes == 0 {
+		return &QuotaData{Free: quotaUnlimited, Used: used, Total: quotaUnlimited, Definition: "none"}, nil
+	}
+	total := int64(res.TotalBytes)
+	free := total - used
+	if free < 0 {
+		free = 0
+	}
+	return &QuotaData{
+		Free:       free,
+		Used:       used,
+		Total:      total,
+		Relative:   float32(used) * 100 / float32(total),
+		Definition: "default",
+	}, nil
+}
+
+// quotaUnlimited is the value used by ownCloud for the free and total bytes
+// when there is no quota.
+const quotaUnlimited = -3
+
 // QuotaData holds quota information
 type QuotaData struct {
 	Free       int64   `json:"free" xml:"free"`
@@ -87,6 +169,8 @@ type QuotaData struct {
 
 // UsersData holds user data
 type UsersData struct {
+	ID          string     `json:"id,omitempty" xml:"id,omitempty"`
+	Enabled     string     `json:"enabled,omitempty" xml:"enabled,omitempty"`
 	Quota       *QuotaData `json:"quota" xml:"quota"`
 	Email       string     `json:"email" xml:"email"`
 	DisplayName string     `json:"displayname" xml:"displayname"`
@@ -26,9 +26,10 @@ import (
 
 // V1Handler routes to the different sub handlers
 type V1Handler struct {
-	AppsHandler   *AppsHandler
-	CloudHandler  *CloudHandler
-	ConfigHandler *ConfigHandler
+	AppsHandler        *AppsHandler
+	CloudHandler       *CloudHandler
+	ConfigHandler      *ConfigHandler
+	PrivateDataHandler *PrivateDataHandler
 }
 
 func (h *V1Handler) init(c *Config) error {
@@ -37,10 +38,13 @@ func (h *V1Handler) init(c *Config) error {
 		return err
 	}
 	h.CloudHandler = new(CloudHandler)
-	h.CloudHandler.init(c)
+	if err := h.CloudHandler.init(c); err != nil {
+		return err
+	}
 	h.ConfigHandler = new(ConfigHandler)
 	h.ConfigHandler.init(c)
-	return nil
+	h.PrivateDataHandler = new(PrivateDataHandler)
+	return h.PrivateDataHandler.init(c)
 }
 
 // Handler handles requests
@@ -55,6 +59,8 @@ func (h *V1Handler) Handler() http.Handler {
 			h.CloudHandler.Handler().ServeHTTP(w, r)
 		case "config":
 			h.ConfigHandler.Handler().ServeHTTP(w, r)
+		case "privatedata":
+			h.PrivateDataHandler.ServeHTTP(w, r)
 		default:
 			WriteOCSError(w, r, MetaNotFound.StatusCode, "Not found", nil)
 		}
@@ -0,0 +1,303 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package preview
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/preview"
+	"github.com/cs3org/reva/pkg/preview/cache/registry"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	global.Register("preview", New)
+}
+
+type config struct {
+	Prefix     string `mapstructure:"prefix"`
+	GatewaySvc string `mapstructure:"gatewaysvc"`
+	// Cache keeps the generated thumbnails, they are generated on every request if empty.
+	Cache  string                            `mapstructure:"cache"`
+	Caches map[string]map[string]interface{} `mapstructure:"caches"`
+	// DefaultSize is used for the dimensions missing in the request,
+	// MaxSize caps the requested ones.
+	DefaultSize int `mapstructure:"default_size"`
+	MaxSize     int `mapstructure:"max_size"`
+	// MaxFileSize is the size in bytes above which no thumbnail is generated.
+	MaxFileSize uint64 `mapstructure:"max_file_size"`
+	// MaxPixels bounds the size of the decoded images.
+	MaxPixels int `mapstructure:"max_pixels"`
+	// PDFCommand renders the first page of a PDF read from stdin as a PNG on stdout.
+	PDFCommand []string `mapstructure:"pdf_command"`
+}
+
+type svc struct {
+	conf      *config
+	handler   http.Handler
+	cache     preview.Cache
+	generator *preview.Generator
+}
+
+// New returns a new preview service generating thumbnails of images and PDFs.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "preview"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.DefaultSize == 0 {
+		conf.DefaultSize = 32
+	}
+	if conf.MaxSize == 0 {
+		conf.MaxSize = 1024
+	}
+	if conf.MaxFileSize == 0 {
+		conf.MaxFileSize = 50 * 1024 * 1024
+	}
+	if conf.MaxPixels == 0 {
+		conf.MaxPixels = 50 * 1000 * 1000
+	}
+	if conf.PDFCommand == nil {
+		conf.PDFCommand = []string{"pdftoppm", "-png", "-singlefile", "-f", "1", "-l", "1", "-scale-to", strconv.Itoa(conf.MaxSize), "-"}
+	}
+
+	cache, err := getCache(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &svc{
+		conf:  conf,
+		cache: cache,
+		generator: &preview.Generator{
+			MaxPixels:  conf.MaxPixels,
+			PDFCommand: conf.PDFCommand,
+		},
+	}
+	s.setHandler()
+	return s, nil
+}
+
+func getCache(c *config) (preview.Cache, error) {
+	if c.Cache == "" {
+		return nil, nil
+	}
+	if f, ok := registry.NewFuncs[c.Cache]; ok {
+		return f(c.Caches[c.Cache])
+	}
+	return nil, fmt.Errorf("preview cache not found: %s", c.Cache)
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Handler() http.Handler {
+	return s.handler
+}
+
+func (s *svc) Unprotected() []string {
+	return []string{}
+}
+
+func (s *svc) setHandler() {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var head string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch head {
+		// preview.png mimics the ownCloud core/preview.png route
+		case "", "preview.png":
+			s.doPreview(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+// doPreview serves the thumbnail of the file given in the file query parameter,
+// x and y being the maximum dimensions of the thumbnail.
+func (s *svc) doPreview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	q := r.URL.Query()
+	fn := q.Get("file")
+	if fn == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	width, height, err := preview.ParseSize(q.Get("x"), q.Get("y"), s.conf.DefaultSize, s.conf.MaxSize)
+	if err != nil {
+		log.Debug().Err(err).Msg("preview: invalid size")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting grpc client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the stat is done on behalf of the user, so the storage and the share
+	// permissions decide whether the file is visible at all
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+	sRes, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil {
+		log.Error().Err(err).Msg("error sending grpc stat request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch sRes.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		w.WriteHeader(http.StatusForbidden)
+		return
+	default:
+		log.Warn().Str("code", sRes.Status.Code.String()).Msg("grpc stat request failed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	info := sRes.Info
+	// a thumbnail reveals the content, so it needs the same permission as a download
+	if info.PermissionSet != nil && !info.PermissionSet.InitiateFileDownload {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if info.Type != provider.ResourceType_RESOURCE_TYPE_FILE || !preview.Supported(info.MimeType) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if info.Size > s.conf.MaxFileSize {
+		log.Debug().Str("path", fn).Uint64("size", info.Size).Msg("preview: file too large for a thumbnail")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	key := preview.Key(info, width, height)
+	if s.cache != nil {
+		data, err := s.cache.Get(ctx, key)
+		switch {
+		case err == nil:
+			writeThumbnail(w, r, info, data)
+			return
+		case !isNotFound(err):
+			log.Error().Err(err).Msg("preview: error reading the cache")
+		}
+	}
+
+	data, err := s.generate(ctx, client, ref, info, width, height)
+	if err != nil {
+		log.Error().Err(err).Str("path", fn).Msg("preview: error generating thumbnail")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if s.cache != nil {
+		if err := s.cache.Set(ctx, key, data); err != nil {
+			log.Error().Err(err).Msg("preview: error caching thumbnail")
+		}
+	}
+	writeThumbnail(w, r, info, data)
+}
+
+// generate downloads the file through the datagateway and creates its thumbnail.
+func (s *svc) generate(ctx context.Context, client gateway.GatewayAPIClient, ref *provider.Reference, info *provider.ResourceInfo, width, height int) ([]byte, error) {
+	dRes, err := client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{Ref: ref})
+	if err != nil {
+		return nil, errors.Wrap(err, "error initiating file download")
+	}
+	if dRes.Status.Code != rpc.Code_CODE_OK {
+		return nil, errors.New("error initiating file download: " + dRes.Status.Message)
+	}
+
+	httpReq, err := rhttp.NewRequest(ctx, http.MethodGet, dRes.DownloadEndpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating http request")
+	}
+	httpReq.Header.Set("X-Reva-Transfer", dRes.Token)
+
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "error downloading file")
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading file: status %d", httpRes.StatusCode)
+	}
+
+	body := io.LimitReader(httpRes.Body, int64(s.conf.MaxFileSize))
+	return s.generator.Generate(ctx, body, info.MimeType, width, height)
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(errtypes.IsNotFound)
+	return ok
+}
+
+func writeThumbnail(w http.ResponseWriter, r *http.Request, info *provider.ResourceInfo, data []byte) {
+	w.Header().Set("Content-Type", preview.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("ETag", info.Etag)
+	// thumbnails depend on the permissions of the user, shared caches must not keep them
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("error writing thumbnail")
+	}
+}
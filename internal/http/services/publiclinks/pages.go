@@ -0,0 +1,153 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package publiclinks
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/appctx"
+)
+
+// page is rendered with the pageTemplate.
+type page struct {
+	Title string
+	// Base is the URL path of the link.
+	Base     string
+	Error    string
+	Message  string
+	Password bool
+	// File is set when the link shares a single file.
+	File *entry
+	// Entries are listed when the link shares a folder.
+	Entries []*entry
+	Parent  string
+	Listing bool
+	// Upload is the URL files can be uploaded to, if the link allows it.
+	Upload string
+}
+
+type entry struct {
+	Name     string
+	URL      string
+	Download string
+	Size     string
+	Folder   bool
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; padding: 0 1em; color: #222; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: .4em; border-bottom: 1px solid #ddd; }
+td.size { text-align: right; color: #666; }
+.error { color: #b00; }
+.message { color: #070; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Message}}<p class="message">{{.Message}}</p>{{end}}
+{{if .Password}}
+<form method="post" action="{{.Base}}">
+<label for="password">This link is protected, enter its password:</label>
+<input type="password" id="password" name="password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+{{end}}
+{{with .File}}
+<p>{{.Name}} ({{.Size}})</p>
+<p><a href="{{.Download}}">Download</a></p>
+{{end}}
+{{if .Listing}}
+<table>
+{{if .Parent}}<tr><td><a href="{{.Parent}}">..</a></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}
+<tr>
+<td>{{if .Folder}}<a href="{{.URL}}">{{.Name}}/</a>{{else}}{{.Name}}{{end}}</td>
+<td class="size">{{.Size}}</td>
+<td>{{if not .Folder}}<a href="{{.Download}}">Download</a>{{end}}</td>
+</tr>
+{{else}}
+<tr><td>This folder is empty.</td></tr>
+{{end}}
+</table>
+{{end}}
+{{if .Upload}}
+<form method="post" action="{{.Upload}}" enctype="multipart/form-data">
+<label for="file">Upload a file:</label>
+<input type="file" id="file" name="file" required>
+<button type="submit">Upload</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+func (s *svc) render(w http.ResponseWriter, r *http.Request, code int, p *page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(code)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := pageTemplate.Execute(w, p); err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("publiclinks: error rendering page")
+	}
+}
+
+// renderError renders the error as a page, or only writes the status code
+// when the landing page is disabled.
+func (s *svc) renderError(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	if s.conf.DisableLandingPage {
+		w.WriteHeader(code)
+		return
+	}
+	s.render(w, r, code, &page{Title: http.StatusText(code), Error: msg})
+}
+
+// wantsHTML tells whether the request comes from a browser.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// formatSize formats a size in bytes for humans.
+func formatSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return strconv.FormatUint(size, 10) + " B"
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,324 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package publiclinks serves the public links at /s/{token}, so that they
+// work without a separate web frontend: password protected links ask for
+// the password, folders get a landing page listing their content, files
+// are downloaded and drop folders accept uploads.
+package publiclinks
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/machine"
+	"github.com/cs3org/reva/pkg/auth/scope"
+	"github.com/cs3org/reva/pkg/publicshare"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	global.Register("publiclinks", New)
+}
+
+// passwordCookie keeps the password of a protected link once entered, it is
+// scoped to the path of the link.
+const passwordCookie = "reva_public_link_password"
+
+// transferTimeout bounds the recording of the bytes downloaded through a link.
+const transferTimeout = 10 * time.Second
+
+type config struct {
+	Prefix     string `mapstructure:"prefix"`
+	GatewaySvc string `mapstructure:"gatewaysvc"`
+	// MachineSecret lets the service read and write the files of the links
+	// on behalf of their owners.
+	MachineSecret string `mapstructure:"machine_secret"`
+	// DisableLandingPage serves the files of the links directly, without
+	// HTML pages: folders can not be browsed and passwords are asked with
+	// basic auth.
+	DisableLandingPage bool `mapstructure:"disable_landing_page"`
+	// MaxUploadSize is the maximum size in bytes of the files uploaded to
+	// drop folders.
+	MaxUploadSize int64 `mapstructure:"max_upload_size"`
+}
+
+type svc struct {
+	conf    *config
+	handler http.Handler
+}
+
+// New returns a new service serving the public links.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "s"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.MaxUploadSize == 0 {
+		conf.MaxUploadSize = 1024 * 1024 * 1024
+	}
+	if conf.MachineSecret == "" {
+		return nil, errors.New("publiclinks: machine_secret is required to access the files of the links")
+	}
+
+	s := &svc{conf: conf}
+	s.setHandler()
+	return s, nil
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Handler() http.Handler {
+	return s.handler
+}
+
+// Unprotected returns the whole service, the links are authenticated by
+// their token.
+func (s *svc) Unprotected() []string {
+	return []string{"/"}
+}
+
+// request is a request to a public link, resolved to the shared resource.
+type request struct {
+	share *link.PublicShare
+	// ctx acts on behalf of the owner of the share.
+	ctx    context.Context
+	client gateway.GatewayAPIClient
+	// root is the path of the shared resource, as seen by its owner.
+	root string
+	// rel is the path requested below the shared resource.
+	rel string
+	// base is the URL path of the link.
+	base string
+	// password is the password the link was resolved with.
+	password string
+}
+
+func (r *request) perms() *provider.ResourcePermissions {
+	if p := r.share.GetPermissions().GetPermissions(); p != nil {
+		return p
+	}
+	return &provider.ResourcePermissions{}
+}
+
+func (r *request) path() string {
+	return path.Join(r.root, r.rel)
+}
+
+func (r *request) url(rel string) string {
+	return path.Join(r.base, rel)
+}
+
+// linkOpaque names the share in the transfer requests, for the datagateway
+// to apply the bandwidth cap of the link.
+func (r *request) linkOpaque() *types.Opaque {
+	return &types.Opaque{
+		Map: map[string]*types.OpaqueEntry{
+			publicshare.OpaqueLink: {Decoder: "plain", Value: []byte(r.share.GetId().GetOpaqueId())},
+		},
+	}
+}
+
+func (s *svc) setHandler() {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tkn string
+		tkn, r.URL.Path = router.ShiftPath(r.URL.Path)
+		if tkn == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.doGet(w, r, tkn)
+		case http.MethodPost:
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+				s.doUpload(w, r, tkn)
+			} else {
+				s.doPassword(w, r, tkn)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// resolve returns the request to the link, or writes the response when it
+// can not be served: a password challenge, not found or an error.
+func (s *svc) resolve(w http.ResponseWriter, r *http.Request, tkn, password string) (*request, bool) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting grpc client")
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	base := path.Join("/", s.conf.Prefix, tkn)
+	if password == "" {
+		password = s.password(r)
+	}
+	req := &link.GetPublicShareByTokenRequest{Token: tkn}
+	if password != "" {
+		req.Opaque = &types.Opaque{
+			Map: map[string]*types.OpaqueEntry{
+				"password": {Decoder: "plain", Value: []byte(password)},
+			},
+		}
+	}
+	res, err := client.GetPublicShareByToken(ctx, req)
+	if err != nil {
+		log.Error().Err(err).Msg("error sending grpc get public share request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+	case rpc.Code_CODE_NOT_FOUND:
+		s.renderError(w, r, http.StatusNotFound, "This link does not exist or has expired.")
+		return nil, false
+	case rpc.Code_CODE_UNAUTHENTICATED:
+		s.challenge(w, r, base, password != "")
+		return nil, false
+	default:
+		log.Error().Str("code", res.Status.Code.String()).Msg("error requesting public share")
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	ownerCtx, _, err := machine.AuthenticateWithScope(ctx, client, machine.ClientID(res.Share.Owner), s.conf.MachineSecret, scope.PublicShare)
+	if err != nil {
+		log.Error().Err(err).Msg("publiclinks: error authenticating public link owner")
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	sRes, err := client.Stat(ownerCtx, &provider.StatRequest{
+		Ref: &provider.Reference{Spec: &provider.Reference_Id{Id: res.Share.ResourceId}},
+	})
+	if err != nil || sRes.Status.Code != rpc.Code_CODE_OK {
+		log.Error().Err(err).Msg("publiclinks: error stating shared resource")
+		s.renderError(w, r, http.StatusNotFound, "The shared file or folder is not available anymore.")
+		return nil, false
+	}
+
+	rel := path.Clean("/" + r.URL.Path)
+	if sRes.Info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER && rel != "/" {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+	return &request{
+		share:    res.Share,
+		ctx:      ownerCtx,
+		client:   client,
+		root:     sRes.Info.Path,
+		rel:      rel,
+		base:     base,
+		password: password,
+	}, true
+}
+
+// recordTransfer adds the bytes downloaded to the statistics of the link.
+// The download may have been interrupted by the client, so the request is
+// not bound to its context.
+func (s *svc) recordTransfer(req *request, n int64) {
+	if n <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), transferTimeout)
+	defer cancel()
+	res, err := req.client.GetPublicShareByToken(ctx, publicshare.TransferRequest(req.share.Token, req.password, uint64(n)))
+	if err != nil || res.Status.Code != rpc.Code_CODE_OK {
+		appctx.GetLogger(req.ctx).Warn().Err(err).Msg("publiclinks: error recording the transfer of the link")
+	}
+}
+
+// password returns the password sent as basic auth or remembered in the cookie.
+func (s *svc) password(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	if c, err := r.Cookie(passwordCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// challenge asks for the password of a protected link.
+func (s *svc) challenge(w http.ResponseWriter, r *http.Request, base string, wrong bool) {
+	if s.conf.DisableLandingPage {
+		w.Header().Set("WWW-Authenticate", `Basic realm="public share"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	p := &page{Title: "Password required", Base: base, Password: true}
+	if wrong {
+		p.Error = "The password is wrong."
+	}
+	s.render(w, r, http.StatusUnauthorized, p)
+}
+
+// doPassword checks the password posted with the challenge form and
+// remembers it for the following requests.
+func (s *svc) doPassword(w http.ResponseWriter, r *http.Request, tkn string) {
+	password := r.PostFormValue("password")
+	if password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req, ok := s.resolve(w, r, tkn, password)
+	if !ok {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     passwordCookie,
+		Value:    password,
+		Path:     req.base,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, req.url(req.rel), http.StatusSeeOther)
+}
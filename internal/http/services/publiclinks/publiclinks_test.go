@@ -0,0 +1,76 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package publiclinks
+
+import "testing"
+
+func TestCollisionName(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"report.pdf", 1, "report.pdf"},
+		{"report.pdf", 2, "report (2).pdf"},
+		{"archive.tar.gz", 3, "archive.tar (3).gz"},
+		{"README", 2, "README (2)"},
+		{".bashrc", 2, ".bashrc (2)"},
+	}
+	for _, tt := range tests {
+		if got := collisionName(tt.name, tt.n); got != tt.want {
+			t.Errorf("collisionName(%q, %d) = %q, want %q", tt.name, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"photo.jpg", "photo.jpg", true},
+		{"C:\\Users\\einstein\\photo.jpg", "photo.jpg", true},
+		{"../../etc/passwd", "passwd", true},
+		{"..", "", false},
+		{"/", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := sanitizeName(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("sanitizeName(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[uint64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KiB",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+	}
+	for size, want := range tests {
+		if got := formatSize(size); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package publiclinks
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rhttp"
+)
+
+// maxCollisions bounds the names tried for an upload to a folder already
+// containing a file with the same name.
+const maxCollisions = 100
+
+// doGet serves the landing page of the link or downloads its files.
+func (s *svc) doGet(w http.ResponseWriter, r *http.Request, tkn string) {
+	req, ok := s.resolve(w, r, tkn, "")
+	if !ok {
+		return
+	}
+	log := appctx.GetLogger(r.Context())
+
+	info, code := s.stat(req, req.path())
+	if code != 0 {
+		s.renderError(w, r, code, "The file or folder does not exist.")
+		return
+	}
+
+	_, download := r.URL.Query()["download"]
+	if info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		if download || s.conf.DisableLandingPage {
+			s.download(w, r, req, info)
+			return
+		}
+		s.render(w, r, http.StatusOK, &page{
+			Title: path.Base(info.Path),
+			File: &entry{
+				Name:     path.Base(info.Path),
+				Download: req.url(req.rel) + "?download",
+				Size:     formatSize(info.Size),
+			},
+		})
+		return
+	}
+
+	if s.conf.DisableLandingPage {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	perms := req.perms()
+	p := &page{Title: path.Base(req.root)}
+	if req.rel != "/" {
+		p.Title = path.Base(req.rel)
+		p.Parent = req.url(path.Dir(req.rel))
+	}
+	if perms.InitiateFileUpload {
+		p.Upload = req.url(req.rel)
+	}
+	if name := r.URL.Query().Get("uploaded"); name != "" {
+		p.Message = fmt.Sprintf("%s was uploaded.", name)
+	}
+	if perms.ListContainer {
+		res, err := req.client.ListContainer(req.ctx, &provider.ListContainerRequest{
+			Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: info.Path}},
+		})
+		if err != nil || res.Status.Code != rpc.Code_CODE_OK {
+			log.Error().Err(err).Str("path", info.Path).Msg("publiclinks: error listing folder")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		p.Listing = true
+		p.Entries = entries(req, res.Infos)
+	} else if !perms.InitiateFileUpload {
+		s.renderError(w, r, http.StatusForbidden, "The content of this folder is not shared.")
+		return
+	}
+	s.render(w, r, http.StatusOK, p)
+}
+
+// entries returns the entries of the listing of a folder, folders first.
+func entries(req *request, infos []*provider.ResourceInfo) []*entry {
+	var folders, files []*entry
+	for _, info := range infos {
+		name := path.Base(info.Path)
+		u := req.url(path.Join(req.rel, name))
+		if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+			folders = append(folders, &entry{Name: name, URL: u, Folder: true})
+			continue
+		}
+		files = append(files, &entry{Name: name, URL: u, Download: u + "?download", Size: formatSize(info.Size)})
+	}
+	return append(folders, files...)
+}
+
+// stat returns the info of the resource below the link and the status code
+// to answer with on errors.
+func (s *svc) stat(req *request, fn string) (*provider.ResourceInfo, int) {
+	res, err := req.client.Stat(req.ctx, &provider.StatRequest{
+		Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: fn}},
+	})
+	if err != nil {
+		appctx.GetLogger(req.ctx).Error().Err(err).Str("path", fn).Msg("publiclinks: error stating")
+		return nil, http.StatusInternalServerError
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+		return res.Info, 0
+	case rpc.Code_CODE_NOT_FOUND:
+		return nil, http.StatusNotFound
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return nil, http.StatusForbidden
+	default:
+		return nil, http.StatusInternalServerError
+	}
+}
+
+// download streams the file from the datagateway, passing range requests on.
+func (s *svc) download(w http.ResponseWriter, r *http.Request, req *request, info *provider.ResourceInfo) {
+	log := appctx.GetLogger(r.Context())
+
+	if !req.perms().InitiateFileDownload {
+		s.renderError(w, r, http.StatusForbidden, "This file can not be downloaded.")
+		return
+	}
+
+	dRes, err := req.client.InitiateFileDownload(req.ctx, &provider.InitiateFileDownloadRequest{
+		Opaque: req.linkOpaque(),
+		Ref:    &provider.Reference{Spec: &provider.Reference_Path{Path: info.Path}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("error initiating file download")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if dRes.Status.Code != rpc.Code_CODE_OK {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	httpReq, err := rhttp.NewRequest(req.ctx, http.MethodGet, dRes.DownloadEndpoint, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("error creating http request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	httpReq.Header.Set("X-Reva-Transfer", dRes.Token)
+	for _, h := range []string{"Range", "If-Range"} {
+		if v := r.Header.Get(h); v != "" {
+			httpReq.Header.Set(h, v)
+		}
+	}
+	httpRes, err := rhttp.GetHTTPClient(req.ctx).Do(httpReq)
+	if err != nil {
+		log.Error().Err(err).Msg("error performing http request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer httpRes.Body.Close()
+
+	switch httpRes.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		w.Header().Set("Content-Range", httpRes.Header.Get("Content-Range"))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", info.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(info.Path)}))
+	w.Header().Set("ETag", info.Etag)
+	for _, h := range []string{"Accept-Ranges", "Content-Range", "Content-Length"} {
+		if v := httpRes.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(httpRes.StatusCode)
+	if r.Method == http.MethodHead {
+		return
+	}
+	n, err := io.Copy(w, httpRes.Body)
+	if err != nil {
+		log.Error().Err(err).Msg("error finishing copying data to response")
+	}
+	s.recordTransfer(req, n)
+}
+
+// doUpload stores the file posted as multipart form in the folder, renaming
+// it if a file with the same name exists already.
+func (s *svc) doUpload(w http.ResponseWriter, r *http.Request, tkn string) {
+	req, ok := s.resolve(w, r, tkn, "")
+	if !ok {
+		return
+	}
+	log := appctx.GetLogger(r.Context())
+
+	if !req.perms().InitiateFileUpload {
+		s.renderError(w, r, http.StatusForbidden, "Files can not be uploaded to this link.")
+		return
+	}
+	folder, code := s.stat(req, req.path())
+	if code != 0 {
+		s.renderError(w, r, code, "The folder does not exist.")
+		return
+	}
+	if folder.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.conf.MaxUploadSize)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	part, err := nextFile(mr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer part.Close()
+
+	name, ok := sanitizeName(part.FileName())
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	name, code = s.freeName(req, folder.Path, name)
+	if code != 0 {
+		w.WriteHeader(code)
+		return
+	}
+
+	fn := path.Join(folder.Path, name)
+	uRes, err := req.client.InitiateFileUpload(req.ctx, &provider.InitiateFileUploadRequest{
+		Opaque: req.linkOpaque(),
+		Ref:    &provider.Reference{Spec: &provider.Reference_Path{Path: fn}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("error initiating file upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if uRes.Status.Code != rpc.Code_CODE_OK {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	httpReq, err := rhttp.NewRequest(req.ctx, http.MethodPut, uRes.UploadEndpoint, part)
+	if err != nil {
+		log.Error().Err(err).Msg("error creating http request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// the length of a multipart part is not known in advance
+	httpReq.ContentLength = -1
+	httpReq.Header.Set("X-Reva-Transfer", uRes.Token)
+	httpRes, err := rhttp.GetHTTPClient(req.ctx).Do(httpReq)
+	if err != nil {
+		log.Error().Err(err).Msg("error doing http request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer httpRes.Body.Close()
+
+	switch httpRes.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusInsufficientStorage:
+		// the data server rejected the content, e.g. because a virus was
+		// found or the quota is exceeded
+		s.renderError(w, r, httpRes.StatusCode, "The file was rejected.")
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if wantsHTML(r) && !s.conf.DisableLandingPage {
+		http.Redirect(w, r, req.url(req.rel)+"?uploaded="+url.QueryEscape(name), http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// nextFile returns the first part of the form carrying a file.
+func nextFile(mr *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// sanitizeName returns the base name of the uploaded file, browsers may send
+// the full local path.
+func sanitizeName(name string) (string, bool) {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "", false
+	}
+	return name, true
+}
+
+// freeName returns a name not used yet in the folder, derived from name by
+// appending a counter as in "name (2).ext".
+func (s *svc) freeName(req *request, folder, name string) (string, int) {
+	for i := 1; i <= maxCollisions; i++ {
+		candidate := collisionName(name, i)
+		_, code := s.stat(req, path.Join(folder, candidate))
+		switch code {
+		case 0:
+			continue
+		case http.StatusNotFound:
+			return candidate, 0
+		default:
+			return "", code
+		}
+	}
+	return "", http.StatusConflict
+}
+
+// collisionName returns the name for the n-th file uploaded with the same name.
+func collisionName(name string, n int) string {
+	if n == 1 {
+		return name
+	}
+	ext := path.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
@@ -0,0 +1,129 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// accessChecker tells if the user of ctx can access the resource.
+type accessChecker func(ctx context.Context, id *provider.ResourceId) bool
+
+func newGatewayChecker(gatewaySvc string) accessChecker {
+	return func(ctx context.Context, id *provider.ResourceId) bool {
+		client, err := pool.GetGatewayServiceClient(gatewaySvc)
+		if err != nil {
+			return false
+		}
+		res, err := client.Stat(ctx, &provider.StatRequest{Ref: &provider.Reference{Spec: &provider.Reference_Id{Id: id}}})
+		return err == nil && res.Status.Code == rpc.Code_CODE_OK
+	}
+}
+
+type client struct {
+	user   *userpb.User
+	events chan *events.Event
+}
+
+// hub fans the received events out to the connected clients.
+type hub struct {
+	check accessChecker
+
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+}
+
+func newHub(check accessChecker) *hub {
+	return &hub{check: check, clients: map[*client]struct{}{}}
+}
+
+func (h *hub) register(u *userpb.User, buffer int) *client {
+	c := &client{user: u, events: make(chan *events.Event, buffer)}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	return c
+}
+
+func (h *hub) unregister(c *client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+func (h *hub) handleMsg(msg *nats.Msg) {
+	e := &events.Event{}
+	if err := json.Unmarshal(msg.Data, e); err != nil {
+		log.Error().Err(err).Msg("push: error decoding event")
+		return
+	}
+	h.dispatch(e)
+}
+
+// dispatch queues the event for every client, the access is checked by the
+// clients so that a slow check does not hold the others back.
+func (h *hub) dispatch(e *events.Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		select {
+		case c.events <- e:
+		default:
+			log.Debug().Str("user", c.user.Username).Str("event", e.ID).Msg("push: client too slow, dropping event")
+		}
+	}
+}
+
+// allowed tells if the client can see the event.
+func (h *hub) allowed(ctx context.Context, c *client, e *events.Event) bool {
+	if sameUser(e.User, c.user.Id) {
+		return true
+	}
+	if e.Grantee != nil {
+		switch e.Grantee.Type {
+		case provider.GranteeType_GRANTEE_TYPE_USER:
+			return sameUser(e.Grantee.Id, c.user.Id)
+		case provider.GranteeType_GRANTEE_TYPE_GROUP:
+			for _, g := range c.user.Groups {
+				if g == e.Grantee.Id.GetOpaqueId() {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if e.Resource != nil && h.check != nil {
+		return h.check(ctx, e.Resource)
+	}
+	return false
+}
+
+func sameUser(a, b *userpb.UserId) bool {
+	return a != nil && b != nil && a.OpaqueId == b.OpaqueId && a.Idp == b.Idp
+}
@@ -0,0 +1,122 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package push
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/events"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+)
+
+var (
+	einstein = &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein", Idp: "idp"}, Username: "einstein", Groups: []string{"physics"}}
+	marie    = &userpb.UserId{OpaqueId: "marie", Idp: "idp"}
+	shared   = &provider.ResourceId{StorageId: "s", OpaqueId: "shared"}
+	private  = &provider.ResourceId{StorageId: "s", OpaqueId: "private"}
+)
+
+func checker(ctx context.Context, id *provider.ResourceId) bool {
+	return id.OpaqueId == shared.OpaqueId
+}
+
+func TestAllowed(t *testing.T) {
+	h := newHub(checker)
+	c := h.register(einstein, 1)
+
+	event := func(typ string, u *userpb.UserId) *events.Event { return events.New(typ, u) }
+	withResource := func(e *events.Event, id *provider.ResourceId) *events.Event { e.Resource = id; return e }
+	withGrantee := func(e *events.Event, g *provider.Grantee) *events.Event { e.Grantee = g; return e }
+
+	for _, tc := range []struct {
+		name string
+		e    *events.Event
+		want bool
+	}{
+		{"own event", event(events.TypeFileUploaded, einstein.Id), true},
+		{"other user", event(events.TypeFileUploaded, marie), false},
+		{"accessible file", withResource(event(events.TypeFileDeleted, marie), shared), true},
+		{"inaccessible file", withResource(event(events.TypeFileDeleted, marie), private), false},
+		{"shared with user", withGrantee(event(events.TypeShareCreated, marie), &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_USER, Id: einstein.Id}), true},
+		{"shared with group", withGrantee(event(events.TypeShareCreated, marie), &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_GROUP, Id: &userpb.UserId{OpaqueId: "physics"}}), true},
+		{"shared with others", withResource(withGrantee(event(events.TypeShareCreated, marie), &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_USER, Id: &userpb.UserId{OpaqueId: "richard", Idp: "idp"}}), shared), false},
+	} {
+		if got := h.allowed(context.Background(), c, tc.e); got != tc.want {
+			t.Errorf("%s: allowed = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDispatchDropsForSlowClients(t *testing.T) {
+	h := newHub(checker)
+	c := h.register(einstein, 1)
+	h.dispatch(events.New(events.TypeFileUploaded, einstein.Id))
+	h.dispatch(events.New(events.TypeFileUploaded, einstein.Id))
+	if len(c.events) != 1 {
+		t.Fatalf("queued %d events, want 1", len(c.events))
+	}
+	h.unregister(c)
+	h.dispatch(events.New(events.TypeFileUploaded, einstein.Id))
+	if len(c.events) != 1 {
+		t.Fatal("event queued for an unregistered client")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := newHub(checker)
+	s := &svc{conf: &config{Keepalive: 30, Buffer: 8}, hub: h}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Handler().ServeHTTP(w, r.WithContext(ctxuser.ContextSetUser(r.Context(), einstein)))
+	}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %s", ct)
+	}
+
+	hidden := events.New(events.TypeFileUploaded, marie)
+	e := events.New(events.TypeFileUploaded, einstein.Id)
+	h.dispatch(hidden)
+	h.dispatch(e)
+
+	r := bufio.NewReader(res.Body)
+	var lines []string
+	for len(lines) < 3 {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(l))
+	}
+	if lines[0] != "id: "+e.ID || lines[1] != "event: "+events.TypeFileUploaded || !strings.HasPrefix(lines[2], "data: {") {
+		t.Errorf("unexpected event %q", lines)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package push implements a service pushing the events of the events
+// subsystem to the connected clients as server-sent events, so that web UIs
+// can refresh without polling. A client only receives the events it is
+// allowed to see: the ones it triggered, the shares granted to the user or
+// its groups and the changes of the files the user can access.
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	global.Register("push", New)
+}
+
+type config struct {
+	Prefix     string `mapstructure:"prefix"`
+	GatewaySvc string `mapstructure:"gatewaysvc"`
+	// NatsURL is the NATS server the events are received from, see the nats events publisher.
+	NatsURL     string `mapstructure:"nats_url"`
+	NatsSubject string `mapstructure:"nats_subject"`
+	// Keepalive is the number of seconds between two comments sent to keep
+	// the idle connections open through proxies.
+	Keepalive int `mapstructure:"keepalive"`
+	// Buffer is the number of events queued per client, the events are
+	// dropped for the clients not reading them fast enough.
+	Buffer int `mapstructure:"buffer"`
+}
+
+type svc struct {
+	conf *config
+	hub  *hub
+	conn *nats.Conn
+}
+
+// New returns a new push service.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "push"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.NatsSubject == "" {
+		conf.NatsSubject = "reva.events"
+	}
+	if conf.Keepalive == 0 {
+		conf.Keepalive = 30
+	}
+	if conf.Buffer == 0 {
+		conf.Buffer = 64
+	}
+	if conf.NatsURL == "" {
+		return nil, errors.New("push: nats_url is required to receive the events")
+	}
+
+	h := newHub(newGatewayChecker(conf.GatewaySvc))
+	conn, err := nats.Connect(conf.NatsURL, nats.Name("reva-push"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, errors.Wrap(err, "push: error connecting to "+conf.NatsURL)
+	}
+	if _, err := conn.Subscribe(conf.NatsSubject+".*", h.handleMsg); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "push: error subscribing to events")
+	}
+	return &svc{conf: conf, hub: h, conn: conn}, nil
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Unprotected() []string {
+	return []string{}
+}
+
+// Handler streams the events to the client until it disconnects.
+func (s *svc) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := appctx.GetLogger(ctx)
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		u, ok := user.ContextGetUser(ctx)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		c := s.hub.register(u, s.conf.Buffer)
+		defer s.hub.unregister(c)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepalive := time.NewTicker(time.Duration(s.conf.Keepalive) * time.Second)
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case e := <-c.events:
+				if !s.hub.allowed(ctx, c, e) {
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					log.Error().Err(err).Msg("push: error encoding event")
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	})
+}
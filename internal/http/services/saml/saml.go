@@ -0,0 +1,277 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package saml
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	crewjam "github.com/crewjam/saml"
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/saml"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+const (
+	requestCookie  = "reva_saml_request"
+	redirectCookie = "reva_saml_redirect"
+
+	// loginTimeout bounds the time the user has to log in at the identity provider.
+	loginTimeout = 10 * time.Minute
+)
+
+func init() {
+	global.Register("saml", New)
+}
+
+type config struct {
+	saml.Config `mapstructure:",squash"`
+	Prefix      string `mapstructure:"prefix"`
+	GatewaySvc  string `mapstructure:"gatewaysvc"`
+	// AuthType is the type the saml auth manager is registered under in the auth registry.
+	AuthType string `mapstructure:"auth_type"`
+	// AllowedRedirects are the URL prefixes the user may be sent back to
+	// after logging in, with the token in the fragment.
+	AllowedRedirects []string `mapstructure:"allowed_redirects"`
+}
+
+type svc struct {
+	conf    *config
+	sp      *crewjam.ServiceProvider
+	handler http.Handler
+}
+
+// New returns the http endpoints of the SAML service provider: the
+// metadata, the login starting the flow and the assertion consumer service,
+// which authenticates the responses against the saml auth manager.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "saml"
+	}
+	if conf.AuthType == "" {
+		conf.AuthType = "saml"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+
+	sp, err := saml.NewServiceProvider(context.Background(), &conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &svc{conf: conf, sp: sp}
+	s.setHandler()
+	return s, nil
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	return nil
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Handler() http.Handler {
+	return s.handler
+}
+
+// the endpoints are used before the user has a token.
+func (s *svc) Unprotected() []string {
+	return []string{"/"}
+}
+
+func (s *svc) setHandler() {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var head string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+		switch {
+		case head == "metadata" && r.Method == http.MethodGet:
+			s.doMetadata(w, r)
+		case head == "login" && r.Method == http.MethodGet:
+			s.doLogin(w, r)
+		case head == "acs" && r.Method == http.MethodPost:
+			s.doACS(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func (s *svc) doMetadata(w http.ResponseWriter, r *http.Request) {
+	data, err := xml.MarshalIndent(s.sp.Metadata(), "", "  ")
+	if err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("saml: error encoding metadata")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		appctx.GetLogger(r.Context()).Error().Err(err).Msg("saml: error writing metadata")
+	}
+}
+
+// doLogin sends the user to the identity provider. The id of the request is
+// kept in a cookie to check that the response answers it.
+func (s *svc) doLogin(w http.ResponseWriter, r *http.Request) {
+	log := appctx.GetLogger(r.Context())
+
+	redirect := r.URL.Query().Get("redirect_url")
+	if redirect != "" && !s.redirectAllowed(redirect) {
+		log.Warn().Str("redirect_url", redirect).Msg("saml: redirect not allowed")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req, err := s.sp.MakeAuthenticationRequest(s.sp.GetSSOBindingLocation(crewjam.HTTPRedirectBinding), crewjam.HTTPRedirectBinding, crewjam.HTTPPostBinding)
+	if err != nil {
+		log.Error().Err(err).Msg("saml: error creating authentication request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	u, err := req.Redirect("", s.sp)
+	if err != nil {
+		log.Error().Err(err).Msg("saml: error creating authentication request")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	s.setCookie(w, requestCookie, req.ID, loginTimeout)
+	if redirect != "" {
+		s.setCookie(w, redirectCookie, redirect, loginTimeout)
+	}
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// doACS authenticates the response of the identity provider and hands the
+// token to the client, in the fragment of the redirect URL if there is one.
+func (s *svc) doACS(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	response := r.PostForm.Get("SAMLResponse")
+	if response == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var requestID, redirect string
+	if c, err := r.Cookie(requestCookie); err == nil {
+		requestID = c.Value
+	}
+	if c, err := r.Cookie(redirectCookie); err == nil && s.redirectAllowed(c.Value) {
+		redirect = c.Value
+	}
+	s.setCookie(w, requestCookie, "", -1)
+	s.setCookie(w, redirectCookie, "", -1)
+
+	tkn, err := s.authenticate(ctx, requestID, response)
+	if err != nil {
+		log.Warn().Err(err).Msg("saml: authentication failed")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if redirect != "" {
+		http.Redirect(w, r, redirect+"#"+url.Values{"access_token": {tkn}}.Encode(), http.StatusFound)
+		return
+	}
+
+	data, err := json.Marshal(map[string]string{"access_token": tkn})
+	if err != nil {
+		log.Error().Err(err).Msg("saml: error encoding token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		log.Error().Err(err).Msg("saml: error writing token")
+	}
+}
+
+func (s *svc) authenticate(ctx context.Context, requestID, response string) (string, error) {
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		return "", errors.Wrap(err, "error getting gateway client")
+	}
+	res, err := client.Authenticate(ctx, &gateway.AuthenticateRequest{
+		Type:         s.conf.AuthType,
+		ClientId:     requestID,
+		ClientSecret: response,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error calling Authenticate")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return "", errors.New("authentication failed: " + res.Status.Message)
+	}
+	return res.Token, nil
+}
+
+func (s *svc) redirectAllowed(u string) bool {
+	for _, p := range s.conf.AllowedRedirects {
+		if strings.HasPrefix(u, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *svc) setCookie(w http.ResponseWriter, name, value string, maxAge time.Duration) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/" + s.conf.Prefix,
+		HttpOnly: true,
+		Secure:   s.sp.AcsURL.Scheme == "https",
+		// the identity provider posts the response from another site
+		SameSite: http.SameSiteNoneMode,
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	} else {
+		c.MaxAge = int(maxAge.Seconds())
+	}
+	http.SetCookie(w, c)
+}
@@ -0,0 +1,292 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/internal/http/utils"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth/machine"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/search"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// feeder keeps the index up to date. It periodically crawls the homes of the
+// configured users and reacts to the storage events published on NATS.
+// The upload events carry the path in the storage, which the gateway does not
+// always resolve, so the crawler is what guarantees the index converges.
+type feeder struct {
+	index search.Index
+	conf  *config
+	quit  chan struct{}
+	conn  *nats.Conn
+
+	// etags remembers what was indexed to skip downloading unchanged files.
+	mu    sync.Mutex
+	etags map[string]string
+}
+
+func newFeeder(index search.Index, c *config) *feeder {
+	return &feeder{
+		index: index,
+		conf:  c,
+		quit:  make(chan struct{}),
+		etags: map[string]string{},
+	}
+}
+
+func (f *feeder) start() error {
+	if f.conf.NatsURL != "" {
+		conn, err := nats.Connect(f.conf.NatsURL, nats.Name("reva-search"), nats.MaxReconnects(-1))
+		if err != nil {
+			return errors.Wrap(err, "search: error connecting to "+f.conf.NatsURL)
+		}
+		for _, t := range []string{events.TypeFileUploaded, events.TypeFileDeleted} {
+			if _, err := conn.Subscribe(f.conf.NatsSubject+"."+t, f.handleMsg); err != nil {
+				conn.Close()
+				return errors.Wrap(err, "search: error subscribing to events")
+			}
+		}
+		f.conn = conn
+	}
+
+	if len(f.conf.CrawlUsers) > 0 {
+		go f.run()
+	}
+	return nil
+}
+
+func (f *feeder) stop() {
+	close(f.quit)
+	if f.conn != nil {
+		f.conn.Close()
+	}
+}
+
+func (f *feeder) run() {
+	ticker := time.NewTicker(time.Duration(f.conf.CrawlInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		f.crawlAll()
+		select {
+		case <-ticker.C:
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+func (f *feeder) crawlAll() {
+	ctx := appctx.WithLogger(context.Background(), &log.Logger)
+	for _, u := range f.conf.CrawlUsers {
+		if err := f.crawl(ctx, u); err != nil {
+			log.Error().Err(err).Str("user", u).Msg("search: error crawling home")
+		}
+	}
+}
+
+// crawl walks the home of the user and indexes everything below it.
+func (f *feeder) crawl(ctx context.Context, u string) error {
+	client, err := pool.GetGatewayServiceClient(f.conf.GatewaySvc)
+	if err != nil {
+		return errors.Wrap(err, "error getting grpc client")
+	}
+	ctx, owner, err := machine.Authenticate(ctx, client, u, f.conf.MachineSecret)
+	if err != nil {
+		return err
+	}
+
+	folders := []string{f.conf.CrawlRoot}
+	for len(folders) > 0 {
+		select {
+		case <-f.quit:
+			return nil
+		default:
+		}
+
+		fn := folders[len(folders)-1]
+		folders = folders[:len(folders)-1]
+
+		ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+		res, err := client.ListContainer(ctx, &provider.ListContainerRequest{Ref: ref})
+		if err != nil {
+			return errors.Wrap(err, "error listing "+fn)
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			log.Warn().Str("path", fn).Str("code", res.Status.Code.String()).Msg("search: error listing folder")
+			continue
+		}
+		for _, info := range res.Infos {
+			if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+				folders = append(folders, info.Path)
+			}
+			if err := f.indexInfo(ctx, client, info, owner.Id); err != nil {
+				log.Error().Err(err).Str("path", info.Path).Msg("search: error indexing resource")
+			}
+		}
+	}
+	return nil
+}
+
+// indexInfo adds the resource to the index, with its content for text files.
+func (f *feeder) indexInfo(ctx context.Context, client gateway.GatewayAPIClient, info *provider.ResourceInfo, owner *userpb.UserId) error {
+	id := search.DocID(info.Id)
+	f.mu.Lock()
+	unchanged := info.Etag != "" && f.etags[id] == info.Etag
+	f.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	e := &search.Entry{
+		ID:       info.Id,
+		Path:     info.Path,
+		Owner:    owner,
+		MimeType: info.MimeType,
+		Size:     info.Size,
+	}
+	if info.Mtime != nil {
+		e.Mtime = utils.TSToTime(info.Mtime)
+	}
+	if info.Type == provider.ResourceType_RESOURCE_TYPE_FILE && search.IsText(info.MimeType) && info.Size <= f.conf.MaxContentSize {
+		content, err := f.download(ctx, client, info)
+		if err != nil {
+			return err
+		}
+		e.Content = content
+	}
+	if err := f.index.Index(ctx, e); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.etags[id] = info.Etag
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *feeder) download(ctx context.Context, client gateway.GatewayAPIClient, info *provider.ResourceInfo) (string, error) {
+	ref := &provider.Reference{Spec: &provider.Reference_Id{Id: info.Id}}
+	dRes, err := client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{Ref: ref})
+	if err != nil {
+		return "", errors.Wrap(err, "error initiating file download")
+	}
+	if dRes.Status.Code != rpc.Code_CODE_OK {
+		return "", status.NewErrorFromCode(dRes.Status.Code, "search")
+	}
+
+	httpReq, err := rhttp.NewRequest(ctx, http.MethodGet, dRes.DownloadEndpoint, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating http request")
+	}
+	httpReq.Header.Set("X-Reva-Transfer", dRes.Token)
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(httpReq)
+	if err != nil {
+		return "", errors.Wrap(err, "error downloading file")
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading file: status %d", httpRes.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(httpRes.Body, int64(f.conf.MaxContentSize)))
+	if err != nil {
+		return "", errors.Wrap(err, "error reading file")
+	}
+	return string(data), nil
+}
+
+func (f *feeder) handleMsg(msg *nats.Msg) {
+	ctx := appctx.WithLogger(context.Background(), &log.Logger)
+
+	e := &events.Event{}
+	if err := json.Unmarshal(msg.Data, e); err != nil {
+		log.Error().Err(err).Msg("search: error decoding event")
+		return
+	}
+	if err := f.handleEvent(ctx, e); err != nil {
+		log.Warn().Err(err).Str("type", e.Type).Str("path", e.Path).Msg("search: error handling event")
+	}
+}
+
+func (f *feeder) handleEvent(ctx context.Context, e *events.Event) error {
+	switch e.Type {
+	case events.TypeFileDeleted:
+		if e.Resource == nil && e.Path == "" {
+			return nil
+		}
+		id := e.Resource
+		if id == nil {
+			id = &provider.ResourceId{}
+		}
+		f.mu.Lock()
+		delete(f.etags, search.DocID(id))
+		f.mu.Unlock()
+		return f.index.Delete(ctx, id, e.Path)
+
+	case events.TypeFileUploaded:
+		if e.User == nil {
+			return nil
+		}
+		client, err := pool.GetGatewayServiceClient(f.conf.GatewaySvc)
+		if err != nil {
+			return errors.Wrap(err, "error getting grpc client")
+		}
+		u := e.User.OpaqueId
+		if e.User.Idp != "" {
+			u += "@" + e.User.Idp
+		}
+		ctx, owner, err := machine.Authenticate(ctx, client, u, f.conf.MachineSecret)
+		if err != nil {
+			return err
+		}
+
+		ref := &provider.Reference{Spec: &provider.Reference_Path{Path: e.Path}}
+		if e.Resource != nil {
+			ref = &provider.Reference{Spec: &provider.Reference_Id{Id: e.Resource}}
+		}
+		res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+		if err != nil {
+			return errors.Wrap(err, "error sending grpc stat request")
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			return status.NewErrorFromCode(res.Status.Code, "search")
+		}
+		return f.indexInfo(ctx, client, res.Info, owner.Id)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/metadata"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/rhttp/global"
+	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/search"
+	"github.com/cs3org/reva/pkg/search/index/registry"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	ctxuser "github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	global.Register("search", New)
+}
+
+type config struct {
+	Prefix     string                            `mapstructure:"prefix"`
+	GatewaySvc string                            `mapstructure:"gatewaysvc"`
+	Index      string                            `mapstructure:"index"`
+	Indexes    map[string]map[string]interface{} `mapstructure:"indexes"`
+	// MachineSecret lets the service read the files on behalf of their owners to index them.
+	MachineSecret string `mapstructure:"machine_secret"`
+	// MaxContentSize is the size in bytes above which the content of text files is not indexed.
+	MaxContentSize uint64 `mapstructure:"max_content_size"`
+	// CrawlUsers are the users, as <opaqueid>@<idp>, whose home is crawled
+	// every CrawlInterval seconds.
+	CrawlUsers    []string `mapstructure:"crawl_users"`
+	CrawlInterval int      `mapstructure:"crawl_interval"`
+	CrawlRoot     string   `mapstructure:"crawl_root"`
+	// NatsURL is the NATS server the storage events are received from, see the nats events publisher.
+	NatsURL     string `mapstructure:"nats_url"`
+	NatsSubject string `mapstructure:"nats_subject"`
+	// MaxResults caps the number of results of a query.
+	MaxResults int `mapstructure:"max_results"`
+}
+
+type svc struct {
+	conf    *config
+	handler http.Handler
+	index   search.Index
+	feeder  *feeder
+}
+
+// New returns a new search service. It keeps an index of the names and
+// contents of the files, and returns the matches the user has access to.
+func New(m map[string]interface{}) (global.Service, error) {
+	conf := &config{}
+	if err := mapstructure.Decode(m, conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Prefix == "" {
+		conf.Prefix = "search"
+	}
+	conf.GatewaySvc = sharedconf.GetGatewaySVC(conf.GatewaySvc)
+	if conf.Index == "" {
+		conf.Index = "bleve"
+	}
+	if conf.MaxContentSize == 0 {
+		conf.MaxContentSize = 1024 * 1024
+	}
+	if conf.CrawlInterval == 0 {
+		conf.CrawlInterval = 3600
+	}
+	if conf.CrawlRoot == "" {
+		conf.CrawlRoot = "/home"
+	}
+	if conf.NatsSubject == "" {
+		conf.NatsSubject = "reva.events"
+	}
+	if conf.MaxResults == 0 {
+		conf.MaxResults = 50
+	}
+
+	if conf.MachineSecret == "" && (len(conf.CrawlUsers) > 0 || conf.NatsURL != "") {
+		return nil, errors.New("search: machine_secret is required to index the files")
+	}
+
+	index, err := getIndex(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &svc{
+		conf:   conf,
+		index:  index,
+		feeder: newFeeder(index, conf),
+	}
+	if err := s.feeder.start(); err != nil {
+		index.Close()
+		return nil, err
+	}
+	s.setHandler()
+	return s, nil
+}
+
+func getIndex(c *config) (search.Index, error) {
+	if f, ok := registry.NewFuncs[c.Index]; ok {
+		return f(c.Indexes[c.Index])
+	}
+	return nil, fmt.Errorf("search index not found: %s", c.Index)
+}
+
+// Close performs cleanup.
+func (s *svc) Close() error {
+	s.feeder.stop()
+	return s.index.Close()
+}
+
+func (s *svc) Prefix() string {
+	return s.conf.Prefix
+}
+
+func (s *svc) Handler() http.Handler {
+	return s.handler
+}
+
+func (s *svc) Unprotected() []string {
+	return []string{}
+}
+
+func (s *svc) setHandler() {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var head string
+		head, r.URL.Path = router.ShiftPath(r.URL.Path)
+
+		if head != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.doSearch(w, r)
+	})
+}
+
+// doSearch answers GET ?q=<term>&limit=<n>.
+func (s *svc) doSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := appctx.GetLogger(ctx)
+
+	term := r.URL.Query().Get("q")
+	if term == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit := s.conf.MaxResults
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+
+	results, err := s.search(ctx, term, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("search: error searching")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(&search.Response{Results: results})
+	if err != nil {
+		log.Error().Err(err).Msg("search: error encoding results")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		log.Error().Err(err).Msg("search: error writing results")
+	}
+}
+
+// search queries the index in the spaces of the user and stats the matches,
+// which gives the path the user sees them at, e.g. below a received share.
+func (s *svc) search(ctx context.Context, term string, limit int) ([]*search.Result, error) {
+	client, err := pool.GetGatewayServiceClient(s.conf.GatewaySvc)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting grpc client")
+	}
+
+	spaces, err := s.spaces(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := s.index.Search(ctx, term, spaces, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*search.Result{}
+	for _, m := range matches {
+		ref := &provider.Reference{Spec: &provider.Reference_Id{Id: m.ID}}
+		res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+		if err != nil {
+			return nil, errors.Wrap(err, "error sending grpc stat request")
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			continue
+		}
+		info := res.Info
+		r := &search.Result{
+			Path:      info.Path,
+			StorageID: info.Id.StorageId,
+			OpaqueID:  info.Id.OpaqueId,
+			Type:      "file",
+			MimeType:  info.MimeType,
+			Size:      info.Size,
+			Etag:      info.Etag,
+			Score:     m.Score,
+			Metadata:  metadata.Extracted(info.GetArbitraryMetadata().GetMetadata()),
+		}
+		if info.Type == provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+			r.Type = "folder"
+		}
+		if info.Mtime != nil {
+			r.Mtime = info.Mtime.Seconds
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// spaces are the parts of the index the user has access to: the resources
+// they own and the ones below the shares they accepted.
+func (s *svc) spaces(ctx context.Context, client gateway.GatewayAPIClient) ([]*search.Space, error) {
+	u, ok := ctxuser.ContextGetUser(ctx)
+	if !ok {
+		return nil, errors.New("search: user not found in context")
+	}
+	spaces := []*search.Space{{Owner: u.Id}}
+
+	res, err := client.ListReceivedShares(ctx, &collaboration.ListReceivedSharesRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending grpc list received shares request")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return nil, status.NewErrorFromCode(res.Status.Code, "search")
+	}
+	for _, rs := range res.Shares {
+		if rs.State != collaboration.ShareState_SHARE_STATE_ACCEPTED {
+			continue
+		}
+		spaces = append(spaces, &search.Space{Owner: rs.Share.Owner, Root: rs.Share.ResourceId})
+	}
+	return spaces, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRange is returned when a Range header cannot be parsed.
+var ErrInvalidRange = errors.New("invalid range")
+
+// ErrUnsatisfiableRange is returned when none of the requested ranges
+// overlaps the content.
+var ErrUnsatisfiableRange = errors.New("unsatisfiable range")
+
+// Range is a byte range of a content, as requested in a Range header.
+type Range struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange returns the Content-Range header value for the range of a
+// content of the given size.
+func (r Range) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header as defined in RFC 7233 for a content of
+// the given size. Ranges not overlapping the content are dropped, if none is
+// left ErrUnsatisfiableRange is returned.
+func ParseRange(s string, size int64) ([]Range, error) {
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, ErrInvalidRange
+	}
+	var ranges []Range
+	noOverlap := false
+	for _, spec := range strings.Split(s[len(b):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return nil, ErrInvalidRange
+		}
+		start, end := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		var r Range
+		if start == "" {
+			// suffix range, the last n bytes of the content
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || n < 0 {
+				return nil, ErrInvalidRange
+			}
+			if n == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r.Start = size - n
+			r.Length = n
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, ErrInvalidRange
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			r.Start = i
+			if end == "" {
+				r.Length = size - i
+			} else {
+				j, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || j < i {
+					return nil, ErrInvalidRange
+				}
+				if j >= size {
+					j = size - 1
+				}
+				r.Length = j - i + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, ErrUnsatisfiableRange
+		}
+		return nil, ErrInvalidRange
+	}
+	return ranges, nil
+}
+
+// IfRangeMatches reports whether the If-Range header value matches the
+// current etag or modification time of the content. An empty header always
+// matches.
+func IfRangeMatches(ifRange, etag string, mtime time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		// weak validators never match, see RFC 7233 section 3.2
+		return strings.Trim(ifRange, `"`) == strings.Trim(etag, `"`) && !strings.HasPrefix(etag, "W/")
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	return mtime.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,91 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package utils
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		want   []Range
+		err    error
+	}{
+		{"bytes=0-9", 100, []Range{{0, 10}}, nil},
+		{"bytes=90-", 100, []Range{{90, 10}}, nil},
+		{"bytes=-10", 100, []Range{{90, 10}}, nil},
+		{"bytes=-200", 100, []Range{{0, 100}}, nil},
+		{"bytes=50-200", 100, []Range{{50, 50}}, nil},
+		{"bytes=0-0, 10-19", 100, []Range{{0, 1}, {10, 10}}, nil},
+		{"bytes=100-", 100, nil, ErrUnsatisfiableRange},
+		{"bytes=-0", 100, nil, ErrUnsatisfiableRange},
+		{"bytes=200-300, 0-9", 100, []Range{{0, 10}}, nil},
+		{"bytes=9-0", 100, nil, ErrInvalidRange},
+		{"bytes=a-b", 100, nil, ErrInvalidRange},
+		{"items=0-9", 100, nil, ErrInvalidRange},
+		{"bytes=", 100, nil, ErrInvalidRange},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRange(tt.header, tt.size)
+		if err != tt.err {
+			t.Errorf("ParseRange(%q) error = %v, want %v", tt.header, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRange(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestContentRange(t *testing.T) {
+	if got := (Range{Start: 10, Length: 10}).ContentRange(100); got != "bytes 10-19/100" {
+		t.Errorf("ContentRange() = %q", got)
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	mtime := time.Date(2020, 5, 4, 10, 0, 0, 500, time.UTC)
+	date := mtime.Format(http.TimeFormat)
+	tests := []struct {
+		ifRange string
+		etag    string
+		want    bool
+	}{
+		{"", `"abc"`, true},
+		{`"abc"`, `"abc"`, true},
+		{`"abc"`, "abc", true},
+		{`"abc"`, `"def"`, false},
+		{`"abc"`, `W/"abc"`, false},
+		{date, `"abc"`, true},
+		{mtime.Add(-time.Hour).Format(http.TimeFormat), `"abc"`, false},
+		{"garbage", `"abc"`, false},
+	}
+
+	for _, tt := range tests {
+		if got := IfRangeMatches(tt.ifRange, tt.etag, mtime); got != tt.want {
+			t.Errorf("IfRangeMatches(%q, %q) = %v, want %v", tt.ifRange, tt.etag, got, tt.want)
+		}
+	}
+}
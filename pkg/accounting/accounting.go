@@ -0,0 +1,125 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package accounting keeps the history of the usage of the storage, per user
+// and per storage provider, for capacity planning and chargeback. The usage
+// is collected periodically as snapshots.
+package accounting
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+)
+
+// Usage is the usage of a storage provider by a user at a point in time.
+type Usage struct {
+	Time time.Time
+	// User is nil for the usage of all the users of the storage.
+	User       *userpb.UserId
+	StorageID  string
+	Bytes      uint64
+	Files      uint64
+	Folders    uint64
+	TrashBytes uint64
+	TrashItems uint64
+}
+
+// Filter selects the usages to list.
+type Filter struct {
+	User      *userpb.UserId
+	StorageID string
+	// From and To bound the time of the snapshots, they are ignored when zero.
+	From, To time.Time
+}
+
+// Manager stores the usages.
+type Manager interface {
+	// Record stores the usages of a snapshot.
+	Record(ctx context.Context, usages []*Usage) error
+	// List returns the usages matching the filter, oldest first.
+	List(ctx context.Context, f *Filter) ([]*Usage, error)
+}
+
+// Matches tells if the usage is selected by the filter.
+func (f *Filter) Matches(u *Usage) bool {
+	if f.User != nil && (u.User == nil || u.User.OpaqueId != f.User.OpaqueId || u.User.Idp != f.User.Idp) {
+		return false
+	}
+	if f.StorageID != "" && u.StorageID != f.StorageID {
+		return false
+	}
+	if !f.From.IsZero() && u.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && u.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+func userKey(u *userpb.UserId) string {
+	return u.GetIdp() + "!" + u.GetOpaqueId()
+}
+
+// Latest returns the last usage of every user on every storage among the
+// usages, which are in time order.
+func Latest(usages []*Usage) []*Usage {
+	last := map[[2]string]*Usage{}
+	keys := [][2]string{}
+	for _, u := range usages {
+		k := [2]string{userKey(u.User), u.StorageID}
+		if _, ok := last[k]; !ok {
+			keys = append(keys, k)
+		}
+		last[k] = u
+	}
+	out := make([]*Usage, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, last[k])
+	}
+	return out
+}
+
+// ByStorage sums the usages of the users per storage and snapshot time.
+func ByStorage(usages []*Usage) []*Usage {
+	sums := map[string]*Usage{}
+	keys := []string{}
+	for _, u := range usages {
+		k := u.Time.UTC().Format(time.RFC3339Nano) + " " + u.StorageID
+		s, ok := sums[k]
+		if !ok {
+			s = &Usage{Time: u.Time, StorageID: u.StorageID}
+			sums[k] = s
+			keys = append(keys, k)
+		}
+		s.Bytes += u.Bytes
+		s.Files += u.Files
+		s.Folders += u.Folders
+		s.TrashBytes += u.TrashBytes
+		s.TrashItems += u.TrashItems
+	}
+	out := make([]*Usage, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, sums[k])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
@@ -0,0 +1,82 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cs3org/reva/pkg/accounting"
+	"github.com/cs3org/reva/pkg/accounting/manager/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("memory", New)
+}
+
+type config struct {
+	// MaxEntries is the number of usages kept, the oldest are dropped.
+	MaxEntries int `mapstructure:"max_entries"`
+}
+
+type mgr struct {
+	c *config
+
+	sync.Mutex
+	usages []*accounting.Usage // oldest first
+}
+
+// New returns a new accounting manager keeping the usages in memory, they
+// are lost when the service restarts.
+func New(m map[string]interface{}) (accounting.Manager, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "error creating a new manager")
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 100000
+	}
+	return &mgr{c: c}, nil
+}
+
+func (m *mgr) Record(ctx context.Context, usages []*accounting.Usage) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.usages = append(m.usages, usages...)
+	if len(m.usages) > m.c.MaxEntries {
+		m.usages = m.usages[len(m.usages)-m.c.MaxEntries:]
+	}
+	return nil
+}
+
+func (m *mgr) List(ctx context.Context, f *accounting.Filter) ([]*accounting.Usage, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	list := []*accounting.Usage{}
+	for _, u := range m.usages {
+		if f.Matches(u) {
+			list = append(list, u)
+		}
+	}
+	return list, nil
+}
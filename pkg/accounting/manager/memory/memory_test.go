@@ -0,0 +1,80 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/accounting"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	einstein := &userpb.UserId{Idp: "cernbox", OpaqueId: "einstein"}
+	marie := &userpb.UserId{Idp: "cernbox", OpaqueId: "marie"}
+	day1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	snapshots := [][]*accounting.Usage{
+		{
+			{Time: day1, User: einstein, StorageID: "home", Bytes: 100, Files: 1},
+			{Time: day1, User: marie, StorageID: "home", Bytes: 50, Files: 2, TrashBytes: 5, TrashItems: 1},
+		},
+		{
+			{Time: day2, User: einstein, StorageID: "home", Bytes: 300, Files: 3},
+			{Time: day2, User: einstein, StorageID: "eos", Bytes: 10, Files: 1},
+			{Time: day2, User: marie, StorageID: "home", Bytes: 60, Files: 2},
+		},
+	}
+	for _, s := range snapshots {
+		if err := m.Record(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := m.List(ctx, &accounting.Filter{User: einstein})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("got %d usages of einstein", len(list))
+	}
+
+	latest := accounting.Latest(list)
+	if len(latest) != 2 || latest[0].Bytes != 300 || latest[1].StorageID != "eos" {
+		t.Fatalf("unexpected latest usages: %+v", latest)
+	}
+
+	all, err := m.List(ctx, &accounting.Filter{StorageID: "home", To: day1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := accounting.ByStorage(all)
+	if len(sums) != 1 || sums[0].Bytes != 150 || sums[0].Files != 3 || sums[0].TrashItems != 1 || sums[0].User != nil {
+		t.Fatalf("unexpected storage usage: %+v", sums)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements an accounting manager backed by a MySQL or
+// PostgreSQL database.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/accounting"
+	"github.com/cs3org/reva/pkg/accounting/manager/registry"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+}
+
+type mgr struct {
+	c  *config
+	db *sql.DB
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new accounting manager backed by a SQL database.
+func New(m map[string]interface{}) (accounting.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, db: db}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "storage_usage_schema_migrations", migrations); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// migrations contains the schema changes in the order they are applied.
+// The applied version is tracked in the storage_usage_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS storage_usage (
+		ctime BIGINT NOT NULL,
+		user_idp VARCHAR(255) NOT NULL,
+		user_opaque_id VARCHAR(255) NOT NULL,
+		storage_id VARCHAR(255) NOT NULL,
+		bytes BIGINT NOT NULL,
+		files BIGINT NOT NULL,
+		folders BIGINT NOT NULL,
+		trash_bytes BIGINT NOT NULL,
+		trash_items BIGINT NOT NULL,
+		PRIMARY KEY (ctime, user_opaque_id, user_idp, storage_id)
+	)`,
+	"CREATE INDEX storage_usage_user ON storage_usage (user_opaque_id, user_idp)",
+	"CREATE INDEX storage_usage_storage ON storage_usage (storage_id)",
+}
+
+func (m *mgr) Record(ctx context.Context, usages []*accounting.Usage) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "sql: error starting transaction")
+	}
+	query := sqlutil.Rebind(m.c.DBDriver, "INSERT INTO storage_usage (ctime, user_idp, user_opaque_id, storage_id, bytes, files, folders, trash_bytes, trash_items) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	for _, u := range usages {
+		if _, err := tx.ExecContext(ctx, query, u.Time.UnixNano(), u.User.GetIdp(), u.User.GetOpaqueId(), u.StorageID,
+			int64(u.Bytes), int64(u.Files), int64(u.Folders), int64(u.TrashBytes), int64(u.TrashItems)); err != nil {
+			_ = tx.Rollback()
+			return errors.Wrap(err, "sql: error recording usage")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "sql: error recording usage")
+	}
+	return nil
+}
+
+func (m *mgr) List(ctx context.Context, f *accounting.Filter) ([]*accounting.Usage, error) {
+	query := "SELECT ctime, user_idp, user_opaque_id, storage_id, bytes, files, folders, trash_bytes, trash_items FROM storage_usage WHERE 1 = 1"
+	var args []interface{}
+	if f.User != nil {
+		query += " AND user_opaque_id = ? AND user_idp = ?"
+		args = append(args, f.User.OpaqueId, f.User.Idp)
+	}
+	if f.StorageID != "" {
+		query += " AND storage_id = ?"
+		args = append(args, f.StorageID)
+	}
+	if !f.From.IsZero() {
+		query += " AND ctime >= ?"
+		args = append(args, f.From.UnixNano())
+	}
+	if !f.To.IsZero() {
+		query += " AND ctime <= ?"
+		args = append(args, f.To.UnixNano())
+	}
+	query += " ORDER BY ctime"
+
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing usages")
+	}
+	defer rows.Close()
+
+	list := []*accounting.Usage{}
+	for rows.Next() {
+		var (
+			u                                             = &accounting.Usage{}
+			ctime                                         int64
+			idp, opaqueID                                 string
+			bytes, files, folders, trashBytes, trashItems int64
+		)
+		if err := rows.Scan(&ctime, &idp, &opaqueID, &u.StorageID, &bytes, &files, &folders, &trashBytes, &trashItems); err != nil {
+			return nil, errors.Wrap(err, "sql: error listing usages")
+		}
+		u.Time = time.Unix(0, ctime).UTC()
+		if opaqueID != "" {
+			u.User = &userpb.UserId{Idp: idp, OpaqueId: opaqueID}
+		}
+		u.Bytes, u.Files, u.Folders = uint64(bytes), uint64(files), uint64(folders)
+		u.TrashBytes, u.TrashItems = uint64(trashBytes), uint64(trashItems)
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,95 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/accounting"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+)
+
+func newTestManager(t *testing.T) *mgr {
+	m := &mgr{c: &config{Config: sqlutil.Config{DBDriver: sqlitetest.Driver}}, db: sqlitetest.Open(t)}
+	if err := sqlutil.Migrate(context.Background(), m.db, m.c.DBDriver, "storage_usage_schema_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	einstein := &userpb.UserId{Idp: "cernbox", OpaqueId: "einstein"}
+	marie := &userpb.UserId{Idp: "cernbox", OpaqueId: "marie"}
+	day1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	snapshots := [][]*accounting.Usage{
+		{
+			{Time: day1, User: einstein, StorageID: "home", Bytes: 100, Files: 1},
+			{Time: day1, User: marie, StorageID: "home", Bytes: 50, Files: 2, TrashBytes: 5, TrashItems: 1},
+		},
+		{
+			{Time: day2, User: einstein, StorageID: "home", Bytes: 300, Files: 3},
+			{Time: day2, User: einstein, StorageID: "eos", Bytes: 10, Files: 1},
+			{Time: day2, User: marie, StorageID: "home", Bytes: 60, Files: 2},
+			{Time: day2, StorageID: "project", Bytes: 1000, Folders: 4},
+		},
+	}
+	for _, s := range snapshots {
+		if err := m.Record(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a snapshot is recorded once
+	if err := m.Record(ctx, snapshots[0]); err == nil {
+		t.Fatal("expected the same snapshot to be refused")
+	}
+
+	list, err := m.List(ctx, &accounting.Filter{User: einstein})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || !list[0].Time.Equal(day1) || list[0].User.GetOpaqueId() != "einstein" {
+		t.Fatalf("unexpected usages of einstein: %+v", list)
+	}
+
+	all, err := m.List(ctx, &accounting.Filter{StorageID: "home", To: day1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := accounting.ByStorage(all)
+	if len(sums) != 1 || sums[0].Bytes != 150 || sums[0].Files != 3 || sums[0].TrashItems != 1 || sums[0].User != nil {
+		t.Fatalf("unexpected storage usage: %+v", sums)
+	}
+
+	projects, err := m.List(ctx, &accounting.Filter{From: day2, StorageID: "project"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0].User != nil || projects[0].Folders != 4 {
+		t.Fatalf("unexpected usages of the projects: %+v", projects)
+	}
+}
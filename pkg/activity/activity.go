@@ -0,0 +1,119 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package activity records the high-level actions done on the files, like
+// renaming, sharing or restoring a version, to show the history of a file
+// and what happened to the files of a user.
+package activity
+
+import (
+	"context"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/events"
+)
+
+// Types are the types of the events recorded as activities.
+var Types = []string{
+	events.TypeFileUploaded,
+	events.TypeFileDeleted,
+	events.TypeFileRenamed,
+	events.TypeVersionRestored,
+	events.TypeShareCreated,
+}
+
+// Activity is an action done by Actor on a resource.
+type Activity struct {
+	// ID increases with the recording order, it is used to page through the feeds.
+	ID       int64
+	Type     string
+	Time     time.Time
+	Actor    *userpb.UserId
+	Resource *provider.ResourceId
+	Path     string
+	OldPath  string
+	Version  string
+	// ShareWith is the user the resource was shared with, for the user shares.
+	ShareWith *userpb.UserId
+}
+
+// Filter selects the activities to list.
+type Filter struct {
+	// User lists the activities triggered by the user and the shares with
+	// the user.
+	User *userpb.UserId
+	// Resource lists the activities of the resource.
+	Resource *provider.ResourceId
+	// Since lists the activities older than this ID, 0 lists from the newest.
+	Since int64
+	Limit int
+}
+
+// Manager stores the activities.
+type Manager interface {
+	// Add records the activity and sets its ID.
+	Add(ctx context.Context, a *Activity) error
+	// List returns the activities matching the filter, newest first.
+	List(ctx context.Context, f *Filter) ([]*Activity, error)
+}
+
+// FromEvent returns the activity recorded for the event, or nil when the
+// event is not recorded.
+func FromEvent(e *events.Event) *Activity {
+	recorded := false
+	for _, t := range Types {
+		if e.Type == t {
+			recorded = true
+			break
+		}
+	}
+	if !recorded || e.User == nil {
+		return nil
+	}
+
+	a := &Activity{
+		Type:     e.Type,
+		Time:     e.Time,
+		Actor:    e.User,
+		Resource: e.Resource,
+		Path:     e.Path,
+		OldPath:  e.OldPath,
+		Version:  e.Version,
+	}
+	if e.Grantee.GetType() == provider.GranteeType_GRANTEE_TYPE_USER {
+		a.ShareWith = e.Grantee.GetId()
+	}
+	return a
+}
+
+// Matches tells if the activity is selected by the filter, ignoring the paging.
+func (f *Filter) Matches(a *Activity) bool {
+	if f.User != nil && !sameUser(a.Actor, f.User) && !sameUser(a.ShareWith, f.User) {
+		return false
+	}
+	if f.Resource != nil && (a.Resource == nil || a.Resource.StorageId != f.Resource.StorageId || a.Resource.OpaqueId != f.Resource.OpaqueId) {
+		return false
+	}
+	return true
+}
+
+func sameUser(a, b *userpb.UserId) bool {
+	return a != nil && b != nil && a.OpaqueId == b.OpaqueId && a.Idp == b.Idp
+}
@@ -0,0 +1,89 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cs3org/reva/pkg/activity"
+	"github.com/cs3org/reva/pkg/activity/manager/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("memory", New)
+}
+
+type config struct {
+	// MaxEntries is the number of activities kept, the oldest are dropped.
+	MaxEntries int `mapstructure:"max_entries"`
+}
+
+type mgr struct {
+	c *config
+
+	sync.Mutex
+	last       int64
+	activities []*activity.Activity // oldest first
+}
+
+// New returns a new activity manager keeping the activities in memory,
+// they are lost when the service restarts.
+func New(m map[string]interface{}) (activity.Manager, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "error creating a new manager")
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 10000
+	}
+	return &mgr{c: c}, nil
+}
+
+func (m *mgr) Add(ctx context.Context, a *activity.Activity) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.last++
+	a.ID = m.last
+	m.activities = append(m.activities, a)
+	if len(m.activities) > m.c.MaxEntries {
+		m.activities = m.activities[len(m.activities)-m.c.MaxEntries:]
+	}
+	return nil
+}
+
+func (m *mgr) List(ctx context.Context, f *activity.Filter) ([]*activity.Activity, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	list := []*activity.Activity{}
+	for i := len(m.activities) - 1; i >= 0 && (f.Limit <= 0 || len(list) < f.Limit); i-- {
+		a := m.activities[i]
+		if f.Since > 0 && a.ID >= f.Since {
+			continue
+		}
+		if f.Matches(a) {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/activity"
+	"github.com/cs3org/reva/pkg/events"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(map[string]interface{}{"max_entries": 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	einstein := &userpb.UserId{Idp: "cernbox", OpaqueId: "einstein"}
+	marie := &userpb.UserId{Idp: "cernbox", OpaqueId: "marie"}
+	file := &provider.ResourceId{StorageId: "home", OpaqueId: "file"}
+
+	rename := events.New(events.TypeFileRenamed, einstein)
+	rename.Resource = file
+	rename.OldPath, rename.Path = "/home/a.txt", "/home/b.txt"
+	share := events.New(events.TypeShareCreated, einstein)
+	share.Resource = file
+	share.Grantee = &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_USER, Id: marie}
+	restore := events.New(events.TypeVersionRestored, marie)
+	restore.Resource = file
+	restore.Version = "v1"
+	upload := events.New(events.TypeFileUploaded, marie)
+	upload.Path = "/home/c.txt"
+
+	for _, e := range []*events.Event{rename, share, restore, upload} {
+		a := activity.FromEvent(e)
+		if a == nil {
+			t.Fatalf("event %s not recorded", e.Type)
+		}
+		if err := m.Add(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a := activity.FromEvent(events.New(events.TypePublicLinkAccessed, einstein)); a != nil {
+		t.Fatalf("public link access recorded")
+	}
+
+	list, err := m.List(ctx, &activity.Filter{User: marie})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Type != events.TypeFileUploaded || list[2].Type != events.TypeShareCreated {
+		t.Fatalf("unexpected activities of marie: %+v", list)
+	}
+
+	// page through the history of the file
+	page, err := m.List(ctx, &activity.Filter{Resource: file, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Version != "v1" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	page, err = m.List(ctx, &activity.Filter{Resource: file, Limit: 2, Since: page[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].OldPath != "/home/a.txt" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+
+	// the oldest activity is dropped
+	if err := m.Add(ctx, activity.FromEvent(upload)); err != nil {
+		t.Fatal(err)
+	}
+	page, err = m.List(ctx, &activity.Filter{Resource: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 {
+		t.Fatalf("expected 2 activities of the file, got %d", len(page))
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements an activity manager backed by a MySQL or
+// PostgreSQL database.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/activity"
+	"github.com/cs3org/reva/pkg/activity/manager/registry"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+}
+
+type mgr struct {
+	c  *config
+	db *sql.DB
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new activity manager backed by a SQL database.
+func New(m map[string]interface{}) (activity.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, db: db}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "activities_schema_migrations", migrations[c.DBDriver]); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// migrations contains the schema changes in the order they are applied, per
+// driver as they differ in how the ids are generated.
+// The applied version is tracked in the activities_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = map[string][]string{
+	"mysql": {
+		`CREATE TABLE IF NOT EXISTS activities (
+			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			activity_type VARCHAR(64) NOT NULL,
+			ctime BIGINT NOT NULL,
+			actor_idp VARCHAR(255) NOT NULL,
+			actor_opaque_id VARCHAR(255) NOT NULL,
+			storage_id VARCHAR(255) NOT NULL,
+			opaque_id VARCHAR(255) NOT NULL,
+			path TEXT NOT NULL,
+			old_path TEXT NOT NULL,
+			version VARCHAR(255) NOT NULL,
+			share_with_idp VARCHAR(255) NOT NULL,
+			share_with_opaque_id VARCHAR(255) NOT NULL
+		)`,
+		"CREATE INDEX activities_actor ON activities (actor_opaque_id, actor_idp)",
+		"CREATE INDEX activities_share_with ON activities (share_with_opaque_id, share_with_idp)",
+		"CREATE INDEX activities_resource ON activities (opaque_id, storage_id)",
+	},
+	"postgres": {
+		`CREATE TABLE IF NOT EXISTS activities (
+			id BIGSERIAL PRIMARY KEY,
+			activity_type VARCHAR(64) NOT NULL,
+			ctime BIGINT NOT NULL,
+			actor_idp VARCHAR(255) NOT NULL,
+			actor_opaque_id VARCHAR(255) NOT NULL,
+			storage_id VARCHAR(255) NOT NULL,
+			opaque_id VARCHAR(255) NOT NULL,
+			path TEXT NOT NULL,
+			old_path TEXT NOT NULL,
+			version VARCHAR(255) NOT NULL,
+			share_with_idp VARCHAR(255) NOT NULL,
+			share_with_opaque_id VARCHAR(255) NOT NULL
+		)`,
+		"CREATE INDEX activities_actor ON activities (actor_opaque_id, actor_idp)",
+		"CREATE INDEX activities_share_with ON activities (share_with_opaque_id, share_with_idp)",
+		"CREATE INDEX activities_resource ON activities (opaque_id, storage_id)",
+	},
+}
+
+func (m *mgr) Add(ctx context.Context, a *activity.Activity) error {
+	query := "INSERT INTO activities (activity_type, ctime, actor_idp, actor_opaque_id, storage_id, opaque_id, path, old_path, version, share_with_idp, share_with_opaque_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	args := []interface{}{
+		a.Type, a.Time.Unix(),
+		a.Actor.GetIdp(), a.Actor.GetOpaqueId(),
+		a.Resource.GetStorageId(), a.Resource.GetOpaqueId(),
+		a.Path, a.OldPath, a.Version,
+		a.ShareWith.GetIdp(), a.ShareWith.GetOpaqueId(),
+	}
+
+	// postgres does not report the last inserted id
+	if m.c.DBDriver == "postgres" {
+		if err := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, query+" RETURNING id"), args...).Scan(&a.ID); err != nil {
+			return errors.Wrap(err, "sql: error adding activity")
+		}
+		return nil
+	}
+
+	res, err := m.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "sql: error adding activity")
+	}
+	if a.ID, err = res.LastInsertId(); err != nil {
+		return errors.Wrap(err, "sql: error getting the id of the activity")
+	}
+	return nil
+}
+
+func (m *mgr) List(ctx context.Context, f *activity.Filter) ([]*activity.Activity, error) {
+	query := "SELECT id, activity_type, ctime, actor_idp, actor_opaque_id, storage_id, opaque_id, path, old_path, version, share_with_idp, share_with_opaque_id FROM activities WHERE 1 = 1"
+	var args []interface{}
+	if f.User != nil {
+		query += " AND ((actor_opaque_id = ? AND actor_idp = ?) OR (share_with_opaque_id = ? AND share_with_idp = ?))"
+		args = append(args, f.User.OpaqueId, f.User.Idp, f.User.OpaqueId, f.User.Idp)
+	}
+	if f.Resource != nil {
+		query += " AND opaque_id = ? AND storage_id = ?"
+		args = append(args, f.Resource.OpaqueId, f.Resource.StorageId)
+	}
+	if f.Since > 0 {
+		query += " AND id < ?"
+		args = append(args, f.Since)
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing activities")
+	}
+	defer rows.Close()
+
+	list := []*activity.Activity{}
+	for rows.Next() {
+		var (
+			a                          = &activity.Activity{}
+			ctime                      int64
+			actor, resource, shareWith [2]string
+		)
+		if err := rows.Scan(&a.ID, &a.Type, &ctime, &actor[0], &actor[1], &resource[0], &resource[1], &a.Path, &a.OldPath, &a.Version, &shareWith[0], &shareWith[1]); err != nil {
+			return nil, errors.Wrap(err, "sql: error listing activities")
+		}
+		a.Time = time.Unix(ctime, 0).UTC()
+		a.Actor = &userpb.UserId{Idp: actor[0], OpaqueId: actor[1]}
+		if resource[1] != "" {
+			a.Resource = &provider.ResourceId{StorageId: resource[0], OpaqueId: resource[1]}
+		}
+		if shareWith[1] != "" {
+			a.ShareWith = &userpb.UserId{Idp: shareWith[0], OpaqueId: shareWith[1]}
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,107 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/activity"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+)
+
+func init() {
+	// the mysql schema, with the auto increment syntax of sqlite
+	for _, m := range migrations["mysql"] {
+		migrations[sqlitetest.Driver] = append(migrations[sqlitetest.Driver], strings.Replace(m, "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY", "INTEGER PRIMARY KEY AUTOINCREMENT", 1))
+	}
+}
+
+func newTestManager(t *testing.T) *mgr {
+	m := &mgr{c: &config{Config: sqlutil.Config{DBDriver: sqlitetest.Driver}}, db: sqlitetest.Open(t)}
+	if err := sqlutil.Migrate(context.Background(), m.db, m.c.DBDriver, "activities_schema_migrations", migrations[m.c.DBDriver]); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	einstein := &userpb.UserId{Idp: "cernbox", OpaqueId: "einstein"}
+	marie := &userpb.UserId{Idp: "cernbox", OpaqueId: "marie"}
+	file := &provider.ResourceId{StorageId: "home", OpaqueId: "file"}
+
+	rename := events.New(events.TypeFileRenamed, einstein)
+	rename.Resource = file
+	rename.OldPath, rename.Path = "/home/a.txt", "/home/b.txt"
+	share := events.New(events.TypeShareCreated, einstein)
+	share.Resource = file
+	share.Grantee = &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_USER, Id: marie}
+	restore := events.New(events.TypeVersionRestored, marie)
+	restore.Resource = file
+	restore.Version = "v1"
+	upload := events.New(events.TypeFileUploaded, marie)
+	upload.Path = "/home/c.txt"
+
+	var last int64
+	for _, e := range []*events.Event{rename, share, restore, upload} {
+		a := activity.FromEvent(e)
+		if err := m.Add(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+		if a.ID <= last {
+			t.Fatalf("activity id %d not increasing after %d", a.ID, last)
+		}
+		last = a.ID
+	}
+
+	list, err := m.List(ctx, &activity.Filter{User: marie})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Type != events.TypeFileUploaded || list[0].Resource != nil || list[2].Type != events.TypeShareCreated || list[2].ShareWith.GetOpaqueId() != "marie" {
+		t.Fatalf("unexpected activities of marie: %+v", list)
+	}
+	if list, err := m.List(ctx, &activity.Filter{User: einstein}); err != nil || len(list) != 2 {
+		t.Fatalf("unexpected activities of einstein: %+v, %v", list, err)
+	}
+
+	// page through the history of the file
+	page, err := m.List(ctx, &activity.Filter{Resource: file, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Version != "v1" || !page[0].Time.Equal(restore.Time.Truncate(1e9)) {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	page, err = m.List(ctx, &activity.Filter{Resource: file, Limit: 2, Since: page[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].OldPath != "/home/a.txt" || page[0].Path != "/home/b.txt" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package antivirus
+
+import (
+	"context"
+	"io"
+)
+
+// Keys of the arbitrary metadata recording the scan of a file.
+const (
+	MetadataStatusKey  = "reva.antivirus.status"
+	MetadataScannerKey = "reva.antivirus.scanner"
+	MetadataDateKey    = "reva.antivirus.date"
+)
+
+// StatusClean is stored under MetadataStatusKey for files without virus,
+// infected files never make it to the storage.
+const StatusClean = "clean"
+
+// Result is the outcome of a scan.
+type Result struct {
+	Infected bool
+	// Virus is the name of the detected virus, if reported by the scanner.
+	Virus string
+}
+
+// Scanner scans content for viruses.
+type Scanner interface {
+	// Scan streams the content read from r to the scanner.
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+	// Name returns the name used to record which scanner checked a file.
+	Name() string
+}
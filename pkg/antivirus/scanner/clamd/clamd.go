@@ -0,0 +1,164 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package clamd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/antivirus"
+	"github.com/cs3org/reva/pkg/antivirus/scanner/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// chunkSize is the size of the chunks sent with the INSTREAM command, it
+// must stay below the StreamMaxLength configured in clamd.
+const chunkSize = 64 * 1024
+
+func init() {
+	registry.Register("clamd", New)
+}
+
+type config struct {
+	Network string `mapstructure:"network"`
+	Address string `mapstructure:"address"`
+	// Timeout is the maximum duration of a scan in seconds.
+	Timeout int `mapstructure:"timeout"`
+}
+
+type scanner struct {
+	c *config
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a scanner that talks to a clamd daemon using the INSTREAM command.
+func New(m map[string]interface{}) (antivirus.Scanner, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Network == "" {
+		c.Network = "tcp"
+	}
+
+	if c.Address == "" {
+		c.Address = "localhost:3310"
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = 60
+	}
+
+	return &scanner{c: c}, nil
+}
+
+func (s *scanner) Name() string {
+	return "clamd"
+}
+
+func (s *scanner) Scan(ctx context.Context, r io.Reader) (*antivirus.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.c.Timeout)*time.Second)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.c.Network, s.c.Address)
+	if err != nil {
+		return nil, errors.Wrap(err, "clamd: error connecting to "+s.c.Address)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, errors.Wrap(err, "clamd: error setting deadline")
+		}
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, errors.Wrap(err, "clamd: error sending command")
+	}
+
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := conn.Write(size); werr != nil {
+				return nil, errors.Wrap(werr, "clamd: error sending data")
+			}
+			if _, werr := conn.Write(buf[:n]); werr != nil {
+				// clamd closes the connection when the stream is too long,
+				// its reply tells why.
+				return s.readReply(conn)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "clamd: error reading data")
+		}
+	}
+
+	// a zero length chunk ends the stream.
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, errors.Wrap(err, "clamd: error sending data")
+	}
+
+	return s.readReply(conn)
+}
+
+// readReply parses replies like "stream: OK" or "stream: Eicar-Signature FOUND".
+func (s *scanner) readReply(conn net.Conn) (*antivirus.Result, error) {
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "clamd: error reading reply")
+	}
+	return parseReply(reply)
+}
+
+func parseReply(reply string) (*antivirus.Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return &antivirus.Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &antivirus.Result{Infected: true, Virus: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, errors.New("clamd: scan failed: " + reply)
+	}
+}
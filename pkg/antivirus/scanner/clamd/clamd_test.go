@@ -0,0 +1,108 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeClamd reads one INSTREAM request and reports an infection when the
+// stream contains the word virus.
+func fakeClamd(t *testing.T, ln net.Listener) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	cmd, err := r.ReadString('\x00')
+	if err != nil || cmd != "zINSTREAM\x00" {
+		t.Errorf("unexpected command %q: %v", cmd, err)
+		return
+	}
+
+	var data bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			t.Error(err)
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if strings.Contains(data.String(), "virus") {
+		_, _ = conn.Write([]byte("stream: Test-Signature FOUND\x00"))
+		return
+	}
+	_, _ = conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		content  string
+		infected bool
+		virus    string
+	}{
+		{"hello world", false, ""},
+		{strings.Repeat("a", 3*chunkSize) + "virus", true, "Test-Signature"},
+	}
+
+	for _, tt := range tests {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go fakeClamd(t, ln)
+
+		s, err := New(map[string]interface{}{"address": ln.Addr().String()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := s.Scan(context.Background(), strings.NewReader(tt.content))
+		ln.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Infected != tt.infected || res.Virus != tt.virus {
+			t.Errorf("got %+v, want infected=%v virus=%q", res, tt.infected, tt.virus)
+		}
+	}
+}
+
+func TestParseReplyError(t *testing.T) {
+	if _, err := parseReply("INSTREAM size limit exceeded. ERROR\x00"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package icap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/antivirus"
+	"github.com/cs3org/reva/pkg/antivirus/scanner/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("icap", New)
+}
+
+type config struct {
+	// URL of the ICAP service, like icap://localhost:1344/avscan.
+	URL string `mapstructure:"url"`
+	// Timeout is the maximum duration of a scan in seconds.
+	Timeout int `mapstructure:"timeout"`
+}
+
+type scanner struct {
+	c    *config
+	host string
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a scanner that submits the content to an ICAP service with
+// a RESPMOD request, as understood by c-icap, squidclamav or most
+// commercial antivirus gateways.
+func New(m map[string]interface{}) (antivirus.Scanner, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.URL == "" {
+		c.URL = "icap://localhost:1344/avscan"
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = 60
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Scheme != "icap" {
+		return nil, fmt.Errorf("icap: invalid url %q", c.URL)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "1344")
+	}
+
+	return &scanner{c: c, host: host}, nil
+}
+
+func (s *scanner) Name() string {
+	return "icap"
+}
+
+func (s *scanner) Scan(ctx context.Context, r io.Reader) (*antivirus.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.c.Timeout)*time.Second)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.host)
+	if err != nil {
+		return nil, errors.Wrap(err, "icap: error connecting to "+s.host)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, errors.Wrap(err, "icap: error setting deadline")
+		}
+	}
+
+	// the content is encapsulated as the body of an http response.
+	resHdr := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nTransfer-Encoding: chunked\r\n\r\n"
+	req := fmt.Sprintf("RESPMOD %s ICAP/1.0\r\n"+
+		"Host: %s\r\n"+
+		"Allow: 204\r\n"+
+		"Encapsulated: res-hdr=0, res-body=%d\r\n"+
+		"\r\n%s", s.c.URL, s.host, len(resHdr), resHdr)
+
+	w := bufio.NewWriter(conn)
+	if _, err := w.WriteString(req); err != nil {
+		return nil, errors.Wrap(err, "icap: error sending request")
+	}
+	if err := writeChunked(w, r); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, errors.Wrap(err, "icap: error sending request")
+	}
+
+	return readResponse(bufio.NewReader(conn))
+}
+
+func writeChunked(w *bufio.Writer, r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := fmt.Fprintf(w, "%x\r\n", n); werr != nil {
+				return errors.Wrap(werr, "icap: error sending data")
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return errors.Wrap(werr, "icap: error sending data")
+			}
+			if _, werr := w.WriteString("\r\n"); werr != nil {
+				return errors.Wrap(werr, "icap: error sending data")
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "icap: error reading data")
+		}
+	}
+	if _, err := w.WriteString("0\r\n\r\n"); err != nil {
+		return errors.Wrap(err, "icap: error sending data")
+	}
+	return nil
+}
+
+// readResponse interprets the ICAP response: 204 means the content has not
+// been modified hence is clean, 200 means the service replaced the content,
+// which antivirus services do to block infected files.
+func readResponse(br *bufio.Reader) (*antivirus.Result, error) {
+	tp := textproto.NewReader(br)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, errors.Wrap(err, "icap: error reading response")
+	}
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "ICAP/") {
+		return nil, fmt.Errorf("icap: malformed status line %q", line)
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("icap: malformed status line %q", line)
+	}
+
+	hdr, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, errors.Wrap(err, "icap: error reading response headers")
+	}
+
+	switch code {
+	case 204:
+		return &antivirus.Result{}, nil
+	case 200:
+		return &antivirus.Result{Infected: true, Virus: getVirus(hdr)}, nil
+	default:
+		return nil, fmt.Errorf("icap: scan failed: %s", line)
+	}
+}
+
+// getVirus extracts the virus name from the headers used by the different
+// ICAP services, for example X-Infection-Found: Type=0; Resolution=2; Threat=Eicar;
+func getVirus(hdr textproto.MIMEHeader) string {
+	if v := hdr.Get("X-Infection-Found"); v != "" {
+		for _, f := range strings.Split(v, ";") {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "Threat=") {
+				return strings.TrimPrefix(f, "Threat=")
+			}
+		}
+	}
+	if v := hdr.Get("X-Virus-ID"); v != "" {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
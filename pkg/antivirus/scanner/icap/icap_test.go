@@ -0,0 +1,56 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package icap
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadResponse(t *testing.T) {
+	tests := []struct {
+		resp     string
+		infected bool
+		virus    string
+		err      bool
+	}{
+		{"ICAP/1.0 204 No Content\r\nISTag: \"x\"\r\n\r\n", false, "", false},
+		{"ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;\r\n\r\n", true, "Eicar-Test-Signature", false},
+		{"ICAP/1.0 200 OK\r\nX-Virus-ID: Eicar\r\n\r\n", true, "Eicar", false},
+		{"ICAP/1.0 500 Server Error\r\n\r\n", false, "", true},
+		{"HTTP/1.1 200 OK\r\n\r\n", false, "", true},
+	}
+
+	for _, tt := range tests {
+		res, err := readResponse(bufio.NewReader(strings.NewReader(tt.resp)))
+		if tt.err {
+			if err == nil {
+				t.Errorf("expected an error for %q", tt.resp)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Infected != tt.infected || res.Virus != tt.virus {
+			t.Errorf("got %+v, want infected=%v virus=%q", res, tt.infected, tt.virus)
+		}
+	}
+}
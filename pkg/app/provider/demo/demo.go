@@ -32,7 +32,8 @@ type provider struct {
 	iframeUIProvider string
 }
 
-func (p *provider) GetIFrame(ctx context.Context, resID *providerpb.ResourceId, token string) (string, error) {
+func (p *provider) GetIFrame(ctx context.Context, ri *providerpb.ResourceInfo, token string) (string, error) {
+	resID := ri.Id
 	msg := fmt.Sprintf("<iframe src=%s/open/%s?access-token=%s />", p.iframeUIProvider, resID.StorageId+":"+resID.OpaqueId, token)
 	return msg, nil
 }
@@ -0,0 +1,220 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package wopi
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	providerpb "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/app"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+const (
+	viewModeEdit = "edit"
+	viewModeView = "view"
+
+	// WOPI locks expire after 30 minutes unless refreshed
+	defaultTokenExpiration = 1800
+)
+
+type config struct {
+	// WopiURL is the address of the WOPI bridge, which acts as WOPI host for the applications.
+	WopiURL string `mapstructure:"wopi_url"`
+	// Secret signs the access tokens handed to the applications, the bridge must share it.
+	Secret string `mapstructure:"secret"`
+	// TokenExpiration is the number of seconds an access token and an edit lock are valid.
+	TokenExpiration int64                 `mapstructure:"token_expiration"`
+	Apps            map[string]*appConfig `mapstructure:"apps"`
+}
+
+type appConfig struct {
+	// EditURL is the action url of the application to edit a document.
+	EditURL string `mapstructure:"edit_url"`
+	// ViewURL is the action url to view a document, EditURL is used in read only mode if empty.
+	ViewURL   string   `mapstructure:"view_url"`
+	MimeTypes []string `mapstructure:"mime_types"`
+}
+
+// claims are the claims of the access tokens minted for the WOPI bridge.
+type claims struct {
+	jwt.StandardClaims
+	// AccessToken is the reva token the bridge uses to read and write the
+	// file. The gateway limits it to the file, with the app scope.
+	AccessToken string `json:"access_token"`
+	FileID      string `json:"file_id"`
+	App         string `json:"app"`
+	ViewMode    string `json:"view_mode"`
+}
+
+type lock struct {
+	app        string
+	expiration time.Time
+}
+
+type provider struct {
+	c    *config
+	apps []string // sorted names for a stable choice among apps handling the same mime type
+
+	mu    sync.Mutex
+	locks map[string]*lock // map[file id]lock
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "wopi: error decoding conf")
+	}
+	return c, nil
+}
+
+// New returns an app provider that opens documents in online office
+// applications through a WOPI bridge.
+func New(m map[string]interface{}) (app.Provider, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.WopiURL == "" {
+		return nil, errors.New("wopi: wopi_url is not defined in config")
+	}
+	c.Secret = sharedconf.GetJWTSecret(c.Secret)
+	if c.Secret == "" {
+		return nil, errors.New("wopi: secret for signing access tokens is not defined in config")
+	}
+	if c.TokenExpiration == 0 {
+		c.TokenExpiration = defaultTokenExpiration
+	}
+
+	p := &provider{c: c, locks: map[string]*lock{}}
+	for name, a := range c.Apps {
+		if a == nil || a.EditURL == "" {
+			return nil, errors.Errorf("wopi: edit_url is not defined for app %s", name)
+		}
+		p.apps = append(p.apps, name)
+	}
+	sort.Strings(p.apps)
+
+	return p, nil
+}
+
+func (p *provider) GetIFrame(ctx context.Context, ri *providerpb.ResourceInfo, token string) (string, error) {
+	log := appctx.GetLogger(ctx)
+
+	name, a := p.findApp(ri.MimeType)
+	if a == nil {
+		return "", errtypes.NotSupported("wopi: no application configured for mime type " + ri.MimeType)
+	}
+
+	fileID := ri.Id.StorageId + ":" + ri.Id.OpaqueId
+	now := time.Now()
+	expiration := now.Add(time.Duration(p.c.TokenExpiration) * time.Second)
+
+	viewMode := viewModeView
+	if ri.PermissionSet != nil && ri.PermissionSet.InitiateFileUpload {
+		if p.lock(fileID, name, now, expiration) {
+			viewMode = viewModeEdit
+		} else {
+			log.Info().Str("file", fileID).Str("app", name).Msg("wopi: file is being edited in another app, opening read only")
+		}
+	}
+
+	subject := ""
+	if u, ok := user.ContextGetUser(ctx); ok {
+		subject = u.Username
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   subject,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiration.Unix(),
+		},
+		AccessToken: token,
+		FileID:      fileID,
+		App:         name,
+		ViewMode:    viewMode,
+	})
+	accessToken, err := t.SignedString([]byte(p.c.Secret))
+	if err != nil {
+		return "", errors.Wrap(err, "wopi: error signing access token")
+	}
+
+	actionURL := a.EditURL
+	if viewMode == viewModeView && a.ViewURL != "" {
+		actionURL = a.ViewURL
+	}
+
+	q := url.Values{}
+	q.Set("WOPISrc", strings.TrimSuffix(p.c.WopiURL, "/")+"/wopi/files/"+url.PathEscape(fileID))
+	q.Set("access_token", accessToken)
+	// the ttl is the expiration as milliseconds since the epoch, as mandated by WOPI
+	q.Set("access_token_ttl", strconv.FormatInt(expiration.UnixNano()/int64(time.Millisecond), 10))
+
+	sep := "?"
+	if strings.Contains(actionURL, "?") {
+		sep = "&"
+	}
+	return actionURL + sep + q.Encode(), nil
+}
+
+func (p *provider) findApp(mimeType string) (string, *appConfig) {
+	for _, name := range p.apps {
+		for _, m := range p.c.Apps[name].MimeTypes {
+			if m == mimeType {
+				return name, p.c.Apps[name]
+			}
+		}
+	}
+	return "", nil
+}
+
+// lock takes or refreshes the edit lock of the file for the app. Editing the same
+// file concurrently from different applications would corrupt it, so it fails
+// while another application holds a valid lock.
+func (p *provider) lock(fileID, app string, now, expiration time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// drop stale locks so the table does not grow unbounded
+	for k, l := range p.locks {
+		if now.After(l.expiration) {
+			delete(p.locks, k)
+		}
+	}
+
+	if l, ok := p.locks[fileID]; ok && l.app != app {
+		return false
+	}
+	p.locks[fileID] = &lock{app: app, expiration: expiration}
+	return true
+}
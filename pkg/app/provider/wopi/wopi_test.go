@@ -0,0 +1,96 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package wopi
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	providerpb "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestGetIFrame(t *testing.T) {
+	p, err := New(map[string]interface{}{
+		"wopi_url": "https://wopi.example.org/",
+		"secret":   "changeme",
+		"apps": map[string]interface{}{
+			"collabora": map[string]interface{}{
+				"edit_url":   "https://collabora.example.org/loleaflet.html",
+				"mime_types": []string{"application/vnd.oasis.opendocument.text"},
+			},
+			"onlyoffice": map[string]interface{}{
+				"edit_url":   "https://onlyoffice.example.org/edit",
+				"view_url":   "https://onlyoffice.example.org/view",
+				"mime_types": []string{"application/vnd.oasis.opendocument.text"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ri := &providerpb.ResourceInfo{
+		Id:            &providerpb.ResourceId{StorageId: "home", OpaqueId: "42"},
+		MimeType:      "application/vnd.oasis.opendocument.text",
+		PermissionSet: &providerpb.ResourcePermissions{InitiateFileUpload: true},
+	}
+
+	loc, err := p.GetIFrame(context.Background(), ri, "revatoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "collabora.example.org" {
+		t.Fatalf("expected the first app by name to be chosen, got %s", u.Host)
+	}
+	if src := u.Query().Get("WOPISrc"); src != "https://wopi.example.org/wopi/files/home:42" {
+		t.Fatalf("unexpected WOPISrc: %s", src)
+	}
+
+	c := &claims{}
+	_, err = jwt.ParseWithClaims(u.Query().Get("access_token"), c, func(*jwt.Token) (interface{}, error) {
+		return []byte("changeme"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AccessToken != "revatoken" || c.ViewMode != viewModeEdit {
+		t.Fatalf("unexpected claims: %+v", c)
+	}
+
+	// another app cannot edit the file while it is locked
+	wp := p.(*provider)
+	wp.apps = []string{"onlyoffice"}
+	loc, err = p.GetIFrame(context.Background(), ri, "revatoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ = url.Parse(loc); u.Path != "/view" {
+		t.Fatalf("expected the locked file to be opened read only, got %s", loc)
+	}
+
+	if _, err := p.GetIFrame(context.Background(), &providerpb.ResourceInfo{Id: ri.Id, MimeType: "image/png"}, ""); err == nil {
+		t.Fatal("expected error for a mime type without app")
+	}
+}
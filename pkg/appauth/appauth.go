@@ -0,0 +1,87 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package appauth defines the app passwords users generate for clients that
+// cannot go through the regular login flow, like WebDAV sync clients.
+package appauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/auth/scope"
+)
+
+// Scopes an app password can be limited to.
+const (
+	ScopeFull = scope.Full
+	ScopeRead = scope.Read
+)
+
+// AppPassword is a long-lived password of a user. Only the hash of the
+// password is kept.
+type AppPassword struct {
+	ID         string       `json:"id"`
+	Hash       string       `json:"hash"`
+	Label      string       `json:"label"`
+	Scope      string       `json:"scope"`
+	User       *userpb.User `json:"user"`
+	Expiration time.Time    `json:"expiration"` // zero means it never expires
+	Ctime      time.Time    `json:"ctime"`
+	Utime      time.Time    `json:"utime"` // last time it was used
+}
+
+// Expired tells whether the app password can no longer be used.
+func (a *AppPassword) Expired() bool {
+	return !a.Expiration.IsZero() && time.Now().After(a.Expiration)
+}
+
+// Manager is the interface that manipulates the app passwords.
+type Manager interface {
+	// GenerateAppPassword creates an app password for the user in the context
+	// and returns it together with the password in clear text.
+	GenerateAppPassword(ctx context.Context, label, scope string, expiration time.Time) (*AppPassword, string, error)
+
+	// ListAppPasswords returns the app passwords of the user in the context.
+	ListAppPasswords(ctx context.Context) ([]*AppPassword, error)
+
+	// InvalidateAppPassword removes the app password with the given id of the user in the context.
+	InvalidateAppPassword(ctx context.Context, id string) error
+
+	// GetAppPassword returns the app password of the given user matching the password.
+	GetAppPassword(ctx context.Context, username, password string) (*AppPassword, error)
+}
+
+// ValidScope tells whether scope is one of the known scopes.
+func ValidScope(scope string) bool {
+	return scope == ScopeFull || scope == ScopeRead
+}
+
+// GeneratePassword returns a random password of 120 bits, as 24 base32
+// characters grouped like ABCD-EFGH-IJKL-MNOP-QRSTUVWX.
+func GeneratePassword() (string, error) {
+	b := make([]byte, 15)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := base32.StdEncoding.EncodeToString(b)
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + s[20:], nil
+}
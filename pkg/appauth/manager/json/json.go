@@ -0,0 +1,230 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"sync"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appauth"
+	"github.com/cs3org/reva/pkg/appauth/manager/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/jsonfile"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	registry.Register("json", New)
+}
+
+type config struct {
+	File string `mapstructure:"file"`
+}
+
+type appPasswordModel struct {
+	AppPasswords map[string]map[string]*appauth.AppPassword `json:"app_passwords"` // map[user]map[id]app password
+}
+
+type mgr struct {
+	c          *config
+	sync.Mutex // concurrent access to the file and model
+	model      *appPasswordModel
+	file       *jsonfile.File
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new app password manager that persists the app passwords to
+// a json file. The file is reloaded when it changes, so that it can be shared
+// by the services generating and the ones checking the app passwords.
+func New(m map[string]interface{}) (appauth.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	// if file is not set we use temporary file
+	if c.File == "" {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			err = errors.Wrap(err, "error creating temporary directory for storing app passwords")
+			return nil, err
+		}
+		c.File = path.Join(dir, "appauth.json")
+	}
+
+	f, err := jsonfile.Open(c.File)
+	if err != nil {
+		err = errors.Wrap(err, "error opening/creating the file")
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, file: f}
+	if err := mgr.load(); err != nil {
+		err = errors.Wrap(err, "error loading the file containing the app passwords")
+		return nil, err
+	}
+	return mgr, nil
+}
+
+// load refreshes the app passwords when the file changed.
+func (m *mgr) load() error {
+	model := &appPasswordModel{}
+	if ok, err := m.file.Load(model); err != nil || !ok {
+		return err
+	}
+	if model.AppPasswords == nil {
+		model.AppPasswords = map[string]map[string]*appauth.AppPassword{}
+	}
+
+	m.model = model
+	return nil
+}
+
+func (m *mgr) save() error {
+	return m.file.Save(m.model)
+}
+
+func userKey(id *userpb.UserId) string {
+	return id.Idp + "!" + id.OpaqueId
+}
+
+func (m *mgr) GenerateAppPassword(ctx context.Context, label, scope string, expiration time.Time) (*appauth.AppPassword, string, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	password, err := appauth.GeneratePassword()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error generating app password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error hashing app password")
+	}
+
+	now := time.Now()
+	a := &appauth.AppPassword{
+		ID:         uuid.New().String(),
+		Hash:       string(hash),
+		Label:      label,
+		Scope:      scope,
+		User:       u,
+		Expiration: expiration,
+		Ctime:      now,
+		Utime:      now,
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, "", err
+	}
+
+	key := userKey(u.Id)
+	if m.model.AppPasswords[key] == nil {
+		m.model.AppPasswords[key] = map[string]*appauth.AppPassword{}
+	}
+	m.model.AppPasswords[key][a.ID] = a
+
+	if err := m.save(); err != nil {
+		return nil, "", errors.Wrap(err, "error saving model")
+	}
+	return a, password, nil
+}
+
+func (m *mgr) ListAppPasswords(ctx context.Context) ([]*appauth.AppPassword, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	list := []*appauth.AppPassword{}
+	for _, a := range m.model.AppPasswords[userKey(u.Id)] {
+		list = append(list, a)
+	}
+	return list, nil
+}
+
+func (m *mgr) InvalidateAppPassword(ctx context.Context, id string) error {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	key := userKey(u.Id)
+	if _, ok := m.model.AppPasswords[key][id]; !ok {
+		return errtypes.NotFound(id)
+	}
+	delete(m.model.AppPasswords[key], id)
+
+	if err := m.save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
+
+func (m *mgr) GetAppPassword(ctx context.Context, username, password string) (*appauth.AppPassword, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	for _, passwords := range m.model.AppPasswords {
+		for _, a := range passwords {
+			if a.User.Username != username && a.User.Id.OpaqueId != username {
+				break
+			}
+			if a.Expired() || bcrypt.CompareHashAndPassword([]byte(a.Hash), []byte(password)) != nil {
+				continue
+			}
+
+			a.Utime = time.Now()
+			if err := m.save(); err != nil {
+				return nil, errors.Wrap(err, "error saving model")
+			}
+			return a, nil
+		}
+	}
+	return nil, errtypes.NotFound(username)
+}
@@ -0,0 +1,92 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appauth"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func TestAppPasswords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "appauth.json")
+
+	m, err := New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "4c510ada"}, Username: "einstein"}
+	ctx := user.ContextSetUser(context.Background(), einstein)
+
+	a, password, err := m.GenerateAppPassword(ctx, "sync client", appauth.ScopeRead, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Hash == password {
+		t.Fatal("app password stored in clear text")
+	}
+	if _, _, err := m.GenerateAppPassword(ctx, "expired", appauth.ScopeFull, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second manager sharing the file sees the app passwords
+	other, err := New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := other.GetAppPassword(context.Background(), "einstein", password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != a.ID || got.Scope != appauth.ScopeRead {
+		t.Fatalf("unexpected app password: %+v", got)
+	}
+	if _, err := other.GetAppPassword(context.Background(), "einstein", "wrong"); err == nil {
+		t.Fatal("expected error with a wrong password")
+	}
+
+	list, err := m.ListAppPasswords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected two app passwords, got %d", len(list))
+	}
+
+	if err := m.InvalidateAppPassword(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.GetAppPassword(context.Background(), "einstein", password); err == nil {
+		t.Fatal("expected error with an invalidated app password")
+	}
+}
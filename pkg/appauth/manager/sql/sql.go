@@ -0,0 +1,247 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements an app password manager backed by a MySQL or
+// PostgreSQL database.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appauth"
+	"github.com/cs3org/reva/pkg/appauth/manager/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+}
+
+type mgr struct {
+	c  *config
+	db *sql.DB
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new app password manager backed by a SQL database.
+func New(m map[string]interface{}) (appauth.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, db: db}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "app_password_schema_migrations", migrations); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// migrations contains the schema changes in the order they are applied.
+// The applied version is tracked in the app_password_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS app_passwords (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		hash VARCHAR(255) NOT NULL,
+		label VARCHAR(255) NOT NULL,
+		scope VARCHAR(32) NOT NULL,
+		user_idp VARCHAR(255) NOT NULL,
+		user_opaque_id VARCHAR(255) NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		user_info TEXT NOT NULL,
+		expiration BIGINT NOT NULL,
+		ctime BIGINT NOT NULL,
+		utime BIGINT NOT NULL
+	)`,
+	`CREATE INDEX app_passwords_user ON app_passwords (user_idp, user_opaque_id)`,
+	`CREATE INDEX app_passwords_username ON app_passwords (username)`,
+}
+
+const appPasswordColumns = "id, hash, label, scope, user_info, expiration, ctime, utime"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAppPassword(row scanner) (*appauth.AppPassword, error) {
+	var (
+		id, hash, label, scope, info string
+		expiration, ctime, utime     int64
+	)
+	if err := row.Scan(&id, &hash, &label, &scope, &info, &expiration, &ctime, &utime); err != nil {
+		return nil, err
+	}
+
+	u := &userpb.User{}
+	if err := json.Unmarshal([]byte(info), u); err != nil {
+		return nil, errors.Wrap(err, "sql: error decoding user")
+	}
+
+	a := &appauth.AppPassword{
+		ID:    id,
+		Hash:  hash,
+		Label: label,
+		Scope: scope,
+		User:  u,
+		Ctime: time.Unix(0, ctime),
+		Utime: time.Unix(0, utime),
+	}
+	if expiration != 0 {
+		a.Expiration = time.Unix(0, expiration)
+	}
+	return a, nil
+}
+
+func (m *mgr) GenerateAppPassword(ctx context.Context, label, scope string, expiration time.Time) (*appauth.AppPassword, string, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	password, err := appauth.GeneratePassword()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "sql: error generating app password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "sql: error hashing app password")
+	}
+
+	info, err := json.Marshal(u)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "sql: error encoding user")
+	}
+
+	now := time.Now()
+	a := &appauth.AppPassword{
+		ID:         uuid.New().String(),
+		Hash:       string(hash),
+		Label:      label,
+		Scope:      scope,
+		User:       u,
+		Expiration: expiration,
+		Ctime:      now,
+		Utime:      now,
+	}
+
+	var exp int64
+	if !expiration.IsZero() {
+		exp = expiration.UnixNano()
+	}
+
+	query := "INSERT INTO app_passwords (id, hash, label, scope, user_idp, user_opaque_id, username, user_info, expiration, ctime, utime) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), a.ID, a.Hash, label, scope, u.Id.Idp, u.Id.OpaqueId, u.Username, string(info), exp, now.UnixNano(), now.UnixNano()); err != nil {
+		return nil, "", errors.Wrap(err, "sql: error inserting app password")
+	}
+	return a, password, nil
+}
+
+func (m *mgr) ListAppPasswords(ctx context.Context) ([]*appauth.AppPassword, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	query := "SELECT " + appPasswordColumns + " FROM app_passwords WHERE user_idp = ? AND user_opaque_id = ?"
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), u.Id.Idp, u.Id.OpaqueId)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing app passwords")
+	}
+	defer rows.Close()
+
+	list := []*appauth.AppPassword{}
+	for rows.Next() {
+		a, err := scanAppPassword(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (m *mgr) InvalidateAppPassword(ctx context.Context, id string) error {
+	u := user.ContextMustGetUser(ctx)
+
+	query := "DELETE FROM app_passwords WHERE id = ? AND user_idp = ? AND user_opaque_id = ?"
+	res, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), id, u.Id.Idp, u.Id.OpaqueId)
+	if err != nil {
+		return errors.Wrap(err, "sql: error deleting app password")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errtypes.NotFound(id)
+	}
+	return nil
+}
+
+func (m *mgr) GetAppPassword(ctx context.Context, username, password string) (*appauth.AppPassword, error) {
+	query := "SELECT " + appPasswordColumns + " FROM app_passwords WHERE username = ? OR user_opaque_id = ?"
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), username, username)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error querying app passwords")
+	}
+	defer rows.Close()
+
+	var found *appauth.AppPassword
+	for rows.Next() {
+		a, err := scanAppPassword(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !a.Expired() && bcrypt.CompareHashAndPassword([]byte(a.Hash), []byte(password)) == nil {
+			found = a
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql: error querying app passwords")
+	}
+	if found == nil {
+		return nil, errtypes.NotFound(username)
+	}
+	rows.Close()
+
+	found.Utime = time.Now()
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "UPDATE app_passwords SET utime = ? WHERE id = ?"), found.Utime.UnixNano(), found.ID); err != nil {
+		return nil, errors.Wrap(err, "sql: error updating app password")
+	}
+	return found, nil
+}
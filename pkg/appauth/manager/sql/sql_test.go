@@ -0,0 +1,103 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appauth"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func newTestManager(t *testing.T) *mgr {
+	m := &mgr{c: &config{Config: sqlutil.Config{DBDriver: sqlitetest.Driver}}, db: sqlitetest.Open(t)}
+	if err := sqlutil.Migrate(context.Background(), m.db, m.c.DBDriver, "app_password_schema_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestAppPasswords(t *testing.T) {
+	m := newTestManager(t)
+
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "4c510ada"}, Username: "einstein"}
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "f7fbf8c8"}, Username: "marie"}
+	ctx := user.ContextSetUser(context.Background(), einstein)
+
+	a, password, err := m.GenerateAppPassword(ctx, "sync client", appauth.ScopeRead, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Hash == password {
+		t.Fatal("app password stored in clear text")
+	}
+	_, expired, err := m.GenerateAppPassword(ctx, "expired", appauth.ScopeFull, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.GetAppPassword(context.Background(), "einstein", password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != a.ID || got.Scope != appauth.ScopeRead || got.User.Username != "einstein" {
+		t.Fatalf("unexpected app password: %+v", got)
+	}
+	if got, err := m.GetAppPassword(context.Background(), einstein.Id.OpaqueId, password); err != nil || got.ID != a.ID {
+		t.Errorf("GetAppPassword() by user id = %+v, %v", got, err)
+	}
+	if _, err := m.GetAppPassword(context.Background(), "einstein", "wrong"); err == nil {
+		t.Fatal("expected error with a wrong password")
+	}
+	if _, err := m.GetAppPassword(context.Background(), "einstein", expired); err == nil {
+		t.Fatal("expected error with an expired app password")
+	}
+	if _, err := m.GetAppPassword(context.Background(), "marie", password); err == nil {
+		t.Fatal("expected error with the app password of another user")
+	}
+
+	list, err := m.ListAppPasswords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected two app passwords, got %d", len(list))
+	}
+	if list, err := m.ListAppPasswords(user.ContextSetUser(context.Background(), marie)); err != nil || len(list) != 0 {
+		t.Errorf("ListAppPasswords() of another user = %v, %v", list, err)
+	}
+
+	if err := m.InvalidateAppPassword(user.ContextSetUser(context.Background(), marie), a.ID); err == nil {
+		t.Fatal("expected other users not to invalidate the app password")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := m.InvalidateAppPassword(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetAppPassword(context.Background(), "einstein", password); err == nil {
+		t.Fatal("expected error with an invalidated app password")
+	}
+}
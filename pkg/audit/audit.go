@@ -0,0 +1,128 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package audit
+
+import (
+	"net/url"
+	"time"
+)
+
+// Outcomes of the audited actions.
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeFailure = "failure"
+)
+
+// Redacted replaces the redacted values.
+const Redacted = "[redacted]"
+
+// Record tells who did what on which resource, with which outcome.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Protocol is either http or grpc.
+	Protocol string `json:"protocol"`
+	User     string `json:"user,omitempty"`
+	Idp      string `json:"idp,omitempty"`
+	// Impersonator is the user acting as User, if any.
+	Impersonator string `json:"impersonator,omitempty"`
+	// Action is the HTTP method or the gRPC method.
+	Action   string `json:"action"`
+	Resource string `json:"resource,omitempty"`
+	Outcome  string `json:"outcome"`
+	// Status is the HTTP status or the CS3 status code.
+	Status   string `json:"status"`
+	ClientIP string `json:"client_ip,omitempty"`
+}
+
+// Sink stores the audit records.
+type Sink interface {
+	Write(r *Record) error
+	Close() error
+}
+
+// Logger redacts the records before writing them to a sink.
+type Logger struct {
+	sink   Sink
+	fields map[string]bool
+	params map[string]bool
+}
+
+// The query parameters redacted when none are configured, they carry credentials.
+var defaultRedactedParams = []string{"access_token", "password", "signature", "token"}
+
+// NewLogger returns a logger redacting the given record fields, among user,
+// idp, impersonator, resource and client_ip, and the given query parameters
+// of the resources.
+func NewLogger(s Sink, fields, params []string) *Logger {
+	if params == nil {
+		params = defaultRedactedParams
+	}
+	l := &Logger{sink: s, fields: map[string]bool{}, params: map[string]bool{}}
+	for _, f := range fields {
+		l.fields[f] = true
+	}
+	for _, p := range params {
+		l.params[p] = true
+	}
+	return l
+}
+
+// Log writes the redacted record.
+func (l *Logger) Log(r *Record) error {
+	l.redact(r)
+	return l.sink.Write(r)
+}
+
+// Close closes the sink.
+func (l *Logger) Close() error {
+	return l.sink.Close()
+}
+
+func (l *Logger) redact(r *Record) {
+	if l.fields["user"] && r.User != "" {
+		r.User = Redacted
+	}
+	if l.fields["idp"] && r.Idp != "" {
+		r.Idp = Redacted
+	}
+	if l.fields["impersonator"] && r.Impersonator != "" {
+		r.Impersonator = Redacted
+	}
+	if l.fields["client_ip"] && r.ClientIP != "" {
+		r.ClientIP = Redacted
+	}
+	if l.fields["resource"] && r.Resource != "" {
+		r.Resource = Redacted
+		return
+	}
+
+	u, err := url.Parse(r.Resource)
+	if err != nil || u.RawQuery == "" {
+		return
+	}
+	q := u.Query()
+	for p := range q {
+		if l.params[p] {
+			q.Set(p, Redacted)
+		}
+	}
+	u.RawQuery = q.Encode()
+	r.Resource = u.String()
+}
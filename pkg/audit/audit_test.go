@@ -0,0 +1,75 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package audit
+
+import (
+	"testing"
+)
+
+type memorySink struct {
+	records []*Record
+}
+
+func (s *memorySink) Write(r *Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		fields, params []string
+		in, expected   Record
+	}{
+		{
+			in:       Record{User: "einstein", Resource: "/data/file.txt?signature=abc&expiration=10", ClientIP: "10.0.0.1"},
+			expected: Record{User: "einstein", Resource: "/data/file.txt?expiration=10&signature=%5Bredacted%5D", ClientIP: "10.0.0.1"},
+		},
+		{
+			fields:   []string{"user", "client_ip"},
+			params:   []string{},
+			in:       Record{User: "einstein", Idp: "cernbox.cern.ch", Resource: "/data/file.txt?signature=abc", ClientIP: "10.0.0.1"},
+			expected: Record{User: Redacted, Idp: "cernbox.cern.ch", Resource: "/data/file.txt?signature=abc", ClientIP: Redacted},
+		},
+		{
+			fields:   []string{"impersonator"},
+			in:       Record{User: "einstein", Impersonator: "admin"},
+			expected: Record{User: "einstein", Impersonator: Redacted},
+		},
+		{
+			fields:   []string{"resource"},
+			in:       Record{User: "einstein", Resource: "/home/secret.txt"},
+			expected: Record{User: "einstein", Resource: Redacted},
+		},
+	}
+
+	for _, tt := range tests {
+		s := &memorySink{}
+		in := tt.in
+		if err := NewLogger(s, tt.fields, tt.params).Log(&in); err != nil {
+			t.Fatal(err)
+		}
+		if got := *s.records[0]; got != tt.expected {
+			t.Errorf("got %+v, expected %+v", got, tt.expected)
+		}
+	}
+}
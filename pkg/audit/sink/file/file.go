@@ -0,0 +1,93 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package file
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cs3org/reva/pkg/audit"
+	"github.com/cs3org/reva/pkg/audit/sink/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("file", New)
+}
+
+type config struct {
+	File string `mapstructure:"file"`
+}
+
+type sink struct {
+	sync.Mutex
+	f *os.File
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a sink appending the records to a file, one JSON object per line.
+func New(m map[string]interface{}) (audit.Sink, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.File == "" {
+		c.File = "/var/log/revad/audit.log"
+	}
+	if err := os.MkdirAll(filepath.Dir(c.File), 0700); err != nil {
+		return nil, errors.Wrap(err, "file: error creating audit log dir")
+	}
+	f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "file: error opening audit log")
+	}
+
+	return &sink{f: f}, nil
+}
+
+func (s *sink) Write(r *audit.Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "file: error encoding record")
+	}
+	data = append(data, '\n')
+
+	s.Lock()
+	defer s.Unlock()
+	if _, err := s.f.Write(data); err != nil {
+		return errors.Wrap(err, "file: error writing record")
+	}
+	return nil
+}
+
+func (s *sink) Close() error {
+	return s.f.Close()
+}
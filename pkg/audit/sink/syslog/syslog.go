@@ -0,0 +1,109 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package syslog
+
+import (
+	"encoding/json"
+	"log/syslog"
+
+	"github.com/cs3org/reva/pkg/audit"
+	"github.com/cs3org/reva/pkg/audit/sink/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("syslog", New)
+}
+
+type config struct {
+	// Network and Address of the syslog server, the local one if empty.
+	Network  string `mapstructure:"network"`
+	Address  string `mapstructure:"address"`
+	Tag      string `mapstructure:"tag"`
+	Facility string `mapstructure:"facility"`
+}
+
+var facilities = map[string]syslog.Priority{
+	"auth":     syslog.LOG_AUTH,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"daemon":   syslog.LOG_DAEMON,
+	"user":     syslog.LOG_USER,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+type sink struct {
+	w *syslog.Writer
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a sink sending the records as JSON to syslog.
+func New(m map[string]interface{}) (audit.Sink, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Tag == "" {
+		c.Tag = "revad-audit"
+	}
+	if c.Facility == "" {
+		c.Facility = "authpriv"
+	}
+	facility, ok := facilities[c.Facility]
+	if !ok {
+		return nil, errors.New("syslog: unknown facility " + c.Facility)
+	}
+
+	w, err := syslog.Dial(c.Network, c.Address, facility|syslog.LOG_INFO, c.Tag)
+	if err != nil {
+		return nil, errors.Wrap(err, "syslog: error connecting to syslog")
+	}
+	return &sink{w: w}, nil
+}
+
+func (s *sink) Write(r *audit.Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "syslog: error encoding record")
+	}
+	if err := s.w.Info(string(data)); err != nil {
+		return errors.Wrap(err, "syslog: error writing record")
+	}
+	return nil
+}
+
+func (s *sink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,73 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package machine lets the background services act on behalf of the users,
+// authenticating them with the machine auth manager through the gateway.
+package machine
+
+import (
+	"context"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/token"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+// ClientID returns the client id of the user for the machine auth manager.
+func ClientID(u *userpb.UserId) string {
+	return u.GetOpaqueId() + "@" + u.GetIdp()
+}
+
+// Authenticate returns a context acting on behalf of the user given as
+// <opaqueid>@<idp> and the user, authenticated with the machine secret.
+func Authenticate(ctx context.Context, client gateway.GatewayAPIClient, u, secret string) (context.Context, *userpb.User, error) {
+	return AuthenticateWithScope(ctx, client, u, secret, "")
+}
+
+// AuthenticateWithScope is Authenticate restricting the token of the user to
+// the scope, when not empty.
+func AuthenticateWithScope(ctx context.Context, client gateway.GatewayAPIClient, u, secret, scope string) (context.Context, *userpb.User, error) {
+	req := &gateway.AuthenticateRequest{
+		Type:         "machine",
+		ClientId:     u,
+		ClientSecret: secret,
+	}
+	if scope != "" {
+		req.Opaque = &types.Opaque{
+			Map: map[string]*types.OpaqueEntry{
+				"scope": {Decoder: "plain", Value: []byte(scope)},
+			},
+		}
+	}
+
+	res, err := client.Authenticate(ctx, req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error authenticating "+u)
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return nil, nil, status.NewErrorFromCode(res.Status.Code, "machine")
+	}
+	ctx = token.ContextSetToken(ctx, res.Token)
+	ctx = metadata.AppendToOutgoingContext(ctx, token.TokenHeader, res.Token)
+	return ctx, res.User, nil
+}
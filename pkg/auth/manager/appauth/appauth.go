@@ -0,0 +1,108 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package appauth
+
+import (
+	"context"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appauth"
+	appregistry "github.com/cs3org/reva/pkg/appauth/manager/registry"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth"
+	"github.com/cs3org/reva/pkg/auth/manager/registry"
+	"github.com/cs3org/reva/pkg/auth/scope"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("appauth", New)
+}
+
+type config struct {
+	AppPasswordManager  string                            `mapstructure:"app_password_manager"`
+	AppPasswordManagers map[string]map[string]interface{} `mapstructure:"app_password_managers"`
+	// FallbackManager authenticates the credentials that are not an app
+	// password, so that one provider serves both kinds of basic credentials.
+	FallbackManager  string                            `mapstructure:"fallback_manager"`
+	FallbackManagers map[string]map[string]interface{} `mapstructure:"fallback_managers"`
+}
+
+type manager struct {
+	passwords appauth.Manager
+	fallback  auth.Manager
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	if c.AppPasswordManager == "" {
+		c.AppPasswordManager = "json"
+	}
+	return c, nil
+}
+
+// New returns an auth manager that authenticates users with their app passwords.
+func New(m map[string]interface{}) (auth.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := appregistry.NewFuncs[c.AppPasswordManager]
+	if !ok {
+		return nil, errors.New("appauth: app password manager not found: " + c.AppPasswordManager)
+	}
+	passwords, err := f(c.AppPasswordManagers[c.AppPasswordManager])
+	if err != nil {
+		return nil, errors.Wrap(err, "appauth: error creating app password manager")
+	}
+
+	mgr := &manager{passwords: passwords}
+	if c.FallbackManager != "" {
+		g, ok := registry.NewFuncs[c.FallbackManager]
+		if !ok {
+			return nil, errors.New("appauth: fallback auth manager not found: " + c.FallbackManager)
+		}
+		if mgr.fallback, err = g(c.FallbackManagers[c.FallbackManager]); err != nil {
+			return nil, errors.Wrap(err, "appauth: error creating fallback auth manager")
+		}
+	}
+	return mgr, nil
+}
+
+// Authenticate returns the owner of the app password, carrying the scope of the password.
+func (m *manager) Authenticate(ctx context.Context, clientID, clientSecret string) (*user.User, error) {
+	a, err := m.passwords.GetAppPassword(ctx, clientID, clientSecret)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok && m.fallback != nil {
+			return m.fallback.Authenticate(ctx, clientID, clientSecret)
+		}
+		return nil, errtypes.InvalidCredentials(clientID)
+	}
+
+	log := appctx.GetLogger(ctx)
+	log.Info().Str("user", clientID).Str("app_password", a.Label).Msg("appauth: authenticated user with app password")
+	return scope.WithScope(a.User, a.Scope), nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package kerberos
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth"
+	"github.com/cs3org/reva/pkg/auth/manager/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/identity/mapping"
+	usermgr "github.com/cs3org/reva/pkg/user"
+	userregistry "github.com/cs3org/reva/pkg/user/manager/registry"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("kerberos", New)
+}
+
+// ctxCredentials is the context key gokrb5 stores the credentials of the
+// authenticated client under.
+const ctxCredentials = "github.com/jcmturner/gokrb5/v8/ctxCredentials"
+
+type config struct {
+	// Keytab is the path to the keytab holding the keys of the service
+	// principal, e.g. HTTP/cloud.example.org@EXAMPLE.ORG.
+	Keytab string `mapstructure:"keytab"`
+	// ServicePrincipal overrides the principal looked up in the keytab,
+	// which defaults to the one the client requested a ticket for.
+	ServicePrincipal string `mapstructure:"service_principal"`
+	// MaxClockSkew is the tolerated clock skew in seconds.
+	MaxClockSkew int `mapstructure:"max_clock_skew"`
+	// Realms maps the accepted Kerberos realms to the IdP of the users.
+	// The key "*" matches any realm. Principals of other realms are
+	// rejected.
+	Realms       map[string]string                 `mapstructure:"realms"`
+	UserManager  string                            `mapstructure:"user_manager"`
+	UserManagers map[string]map[string]interface{} `mapstructure:"user_managers"`
+	// Mapping maps the principals to the users, from the name, realm,
+	// idp and display_name attributes. It defaults to the name as opaque
+	// id and username, and the IdP configured for the realm.
+	Mapping mapping.Config `mapstructure:"mapping"`
+}
+
+type manager struct {
+	c        *config
+	kt       *keytab.Keytab
+	settings []func(*service.Settings)
+	users    usermgr.Manager
+	mapper   *mapping.Mapper
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *config) init() {
+	if c.MaxClockSkew == 0 {
+		c.MaxClockSkew = 300
+	}
+	// realms are case sensitive but the config keys may have been
+	// lowercased, so compare them in upper case as realms are by convention.
+	realms := make(map[string]string, len(c.Realms))
+	for r, idp := range c.Realms {
+		realms[strings.ToUpper(r)] = idp
+	}
+	c.Realms = realms
+}
+
+// New returns an auth manager verifying the SPNEGO tokens sent by Kerberos
+// clients in the Negotiate authorization header. The client secret is the
+// base64 encoded token. The principal is mapped to a user with the name as
+// opaque id and the IdP configured for its realm. If a user manager is
+// configured the user is looked up there, otherwise only the id and the
+// username are set.
+func New(m map[string]interface{}) (auth.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.init()
+
+	if c.Keytab == "" {
+		return nil, errors.New("kerberos: keytab is not set")
+	}
+	if len(c.Realms) == 0 {
+		return nil, errors.New("kerberos: no realms configured")
+	}
+
+	kt, err := keytab.Load(c.Keytab)
+	if err != nil {
+		return nil, errors.Wrap(err, "kerberos: error loading keytab")
+	}
+
+	settings := []func(*service.Settings){
+		service.MaxClockSkew(time.Duration(c.MaxClockSkew) * time.Second),
+		// the authorization data is not used and only MS-KILE tickets
+		// carry it, so do not fail on other KDCs.
+		service.DecodePAC(false),
+	}
+	if c.ServicePrincipal != "" {
+		settings = append(settings, service.KeytabPrincipal(c.ServicePrincipal))
+	}
+
+	mapper, err := mapping.New(c.Mapping, mapping.Config{
+		Idp:         mapping.Attr("idp"),
+		OpaqueID:    mapping.Attr("name"),
+		Username:    mapping.Attr("name"),
+		DisplayName: mapping.Attr("display_name"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &manager{c: c, kt: kt, settings: settings, mapper: mapper}
+
+	if c.UserManager != "" {
+		f, ok := userregistry.NewFuncs[c.UserManager]
+		if !ok {
+			return nil, errors.New("kerberos: user manager not found: " + c.UserManager)
+		}
+		mgr.users, err = f(c.UserManagers[c.UserManager])
+		if err != nil {
+			return nil, errors.Wrap(err, "kerberos: error creating user manager")
+		}
+	}
+
+	return mgr, nil
+}
+
+func (m *manager) Authenticate(ctx context.Context, clientID, clientSecret string) (*user.User, error) {
+	log := appctx.GetLogger(ctx)
+
+	st, err := parseToken(clientSecret)
+	if err != nil {
+		log.Debug().Err(err).Msg("kerberos: invalid negotiate token")
+		return nil, errtypes.InvalidCredentials("kerberos: invalid negotiate token")
+	}
+
+	authed, kctx, status := spnego.SPNEGOService(m.kt, m.settings...).AcceptSecContext(st)
+	if !authed || status.Code != gssapi.StatusComplete {
+		log.Warn().Str("status", status.Error()).Msg("kerberos: token rejected")
+		return nil, errtypes.InvalidCredentials("kerberos: token rejected")
+	}
+
+	creds, ok := kctx.Value(ctxCredentials).(*credentials.Credentials)
+	if !ok {
+		return nil, errors.New("kerberos: no credentials in the security context")
+	}
+
+	uid, err := m.userID(creds.UserName(), creds.Domain())
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := mapping.Attributes{}
+	attrs.Set("name", uid.OpaqueId)
+	attrs.Set("realm", creds.Domain())
+	attrs.Set("idp", uid.Idp)
+	attrs.Set("display_name", creds.DisplayName())
+
+	if m.users == nil {
+		return m.mapper.User(attrs)
+	}
+
+	uid, err = m.mapper.UserID(attrs)
+	if err != nil {
+		return nil, err
+	}
+	u, err := m.users.GetUser(ctx, uid)
+	if err != nil {
+		return nil, errors.Wrap(err, "kerberos: error getting user")
+	}
+	return u, nil
+}
+
+// userID maps the principal name and realm to a user id, using the IdP
+// configured for the realm.
+func (m *manager) userID(name, realm string) (*user.UserId, error) {
+	idp, ok := m.c.Realms[strings.ToUpper(realm)]
+	if !ok {
+		idp, ok = m.c.Realms["*"]
+	}
+	if !ok {
+		return nil, errtypes.InvalidCredentials("kerberos: realm not allowed: " + realm)
+	}
+	if name == "" {
+		return nil, errtypes.InvalidCredentials("kerberos: principal without name")
+	}
+	return &user.UserId{OpaqueId: name, Idp: idp}, nil
+}
+
+// parseToken decodes a SPNEGO token, wrapping raw KRB5 tokens as sent by
+// some clients into one.
+func parseToken(s string) (*spnego.SPNEGOToken, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var st spnego.SPNEGOToken
+	if err := st.Unmarshal(b); err != nil {
+		var k5t spnego.KRB5Token
+		if k5t.Unmarshal(b) != nil {
+			return nil, err
+		}
+		st.Init = true
+		st.NegTokenInit = spnego.NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{k5t.OID},
+			MechTokenBytes: b,
+		}
+	}
+	return &st, nil
+}
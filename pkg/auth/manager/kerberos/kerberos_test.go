@@ -0,0 +1,81 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package kerberos
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUserID(t *testing.T) {
+	c := &config{Realms: map[string]string{"example.org": "https://idp.example.org"}}
+	c.init()
+	m := &manager{c: c}
+
+	tests := []struct {
+		name, realm string
+		idp         string
+		ok          bool
+	}{
+		{"einstein", "EXAMPLE.ORG", "https://idp.example.org", true},
+		{"einstein", "example.org", "https://idp.example.org", true},
+		{"einstein", "OTHER.ORG", "", false},
+		{"", "EXAMPLE.ORG", "", false},
+	}
+	for _, tt := range tests {
+		uid, err := m.userID(tt.name, tt.realm)
+		if (err == nil) != tt.ok {
+			t.Errorf("userID(%q, %q): unexpected error %v", tt.name, tt.realm, err)
+			continue
+		}
+		if err == nil && (uid.OpaqueId != tt.name || uid.Idp != tt.idp) {
+			t.Errorf("userID(%q, %q) = %v, wanted %s@%s", tt.name, tt.realm, uid, tt.name, tt.idp)
+		}
+	}
+
+	m.c.Realms["*"] = "https://default.example.org"
+	uid, err := m.userID("einstein", "OTHER.ORG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid.Idp != "https://default.example.org" {
+		t.Errorf("%#v, wanted %#v", uid.Idp, "https://default.example.org")
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	m := &manager{c: &config{}}
+	for _, token := range []string{"", "not base64!", "aGVsbG8gd29ybGQ="} {
+		if _, err := m.Authenticate(context.Background(), "", token); err == nil {
+			t.Errorf("expected an error for token %q", token)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(map[string]interface{}{"realms": map[string]string{"EXAMPLE.ORG": "idp"}}); err == nil {
+		t.Error("expected an error without keytab")
+	}
+	if _, err := New(map[string]interface{}{"keytab": "/nonexistent"}); err == nil {
+		t.Error("expected an error without realms")
+	}
+	if _, err := New(map[string]interface{}{"keytab": "/nonexistent", "realms": map[string]string{"EXAMPLE.ORG": "idp"}}); err == nil {
+		t.Error("expected an error for a missing keytab")
+	}
+}
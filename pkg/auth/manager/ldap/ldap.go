@@ -28,6 +28,7 @@ import (
 	"github.com/cs3org/reva/pkg/auth"
 	"github.com/cs3org/reva/pkg/auth/manager/registry"
 	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/identity/mapping"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"gopkg.in/ldap.v2"
@@ -38,7 +39,8 @@ func init() {
 }
 
 type mgr struct {
-	c *config
+	c      *config
+	mapper *mapping.Mapper
 }
 
 type config struct {
@@ -50,6 +52,9 @@ type config struct {
 	BindPassword string     `mapstructure:"bind_password"`
 	Idp          string     `mapstructure:"idp"`
 	Schema       attributes `mapstructure:"schema"`
+	// Mapping maps the attributes of the entries to the users, it defaults
+	// to the attributes of the schema.
+	Mapping mapping.Config `mapstructure:"mapping"`
 }
 
 type attributes struct {
@@ -85,8 +90,20 @@ func New(m map[string]interface{}) (auth.Manager, error) {
 		return nil, err
 	}
 
+	mapper, err := mapping.New(c.Mapping, mapping.Config{
+		Idp:         c.Idp,
+		OpaqueID:    mapping.Attr(c.Schema.UID),
+		Username:    mapping.Attr(c.Schema.UID),
+		Mail:        mapping.Attr(c.Schema.Mail),
+		DisplayName: mapping.Attr(c.Schema.DisplayName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &mgr{
-		c: c,
+		c:      c,
+		mapper: mapper,
 	}, nil
 }
 
@@ -109,9 +126,8 @@ func (am *mgr) Authenticate(ctx context.Context, clientID, clientSecret string)
 	searchRequest := ldap.NewSearchRequest(
 		am.c.BaseDN,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-		fmt.Sprintf(am.c.UserFilter, clientID),
-		// TODO(jfd): objectguid, entryuuid etc ... make configurable
-		[]string{am.c.Schema.DN, am.c.Schema.UID, am.c.Schema.Mail, am.c.Schema.DisplayName},
+		fmt.Sprintf(am.c.UserFilter, am.mapper.NormalizeUsername(clientID)),
+		append([]string{am.c.Schema.DN}, am.mapper.Attributes()...),
 		nil,
 	)
 
@@ -134,19 +150,6 @@ func (am *mgr) Authenticate(ctx context.Context, clientID, clientSecret string)
 		return nil, err
 	}
 
-	u := &user.User{
-		Id: &user.UserId{
-			Idp:      am.c.Idp,
-			OpaqueId: sr.Entries[0].GetAttributeValue(am.c.Schema.UID),
-		},
-		// TODO add more claims from the StandardClaims, eg EmailVerified
-		Username: sr.Entries[0].GetAttributeValue(am.c.Schema.UID),
-		// TODO groups
-		Groups:      []string{},
-		Mail:        sr.Entries[0].GetAttributeValue(am.c.Schema.Mail),
-		DisplayName: sr.Entries[0].GetAttributeValue(am.c.Schema.DisplayName),
-	}
-
-	return u, nil
-
+	// the groups are the ones of the groups attribute of the mapping, if any
+	return am.mapper.User(mapping.FromLDAP(sr.Entries[0]))
 }
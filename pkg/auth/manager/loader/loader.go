@@ -20,10 +20,15 @@ package loader
 
 import (
 	// Load core authentication managers.
+	_ "github.com/cs3org/reva/pkg/auth/manager/appauth"
 	_ "github.com/cs3org/reva/pkg/auth/manager/demo"
 	_ "github.com/cs3org/reva/pkg/auth/manager/impersonator"
 	_ "github.com/cs3org/reva/pkg/auth/manager/json"
+	_ "github.com/cs3org/reva/pkg/auth/manager/kerberos"
 	_ "github.com/cs3org/reva/pkg/auth/manager/ldap"
+	_ "github.com/cs3org/reva/pkg/auth/manager/machine"
 	_ "github.com/cs3org/reva/pkg/auth/manager/oidc"
+	_ "github.com/cs3org/reva/pkg/auth/manager/saml"
+	_ "github.com/cs3org/reva/pkg/auth/manager/sql"
 	// Add your own here
 )
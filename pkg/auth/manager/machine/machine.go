@@ -0,0 +1,108 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package machine
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth"
+	"github.com/cs3org/reva/pkg/auth/manager/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+	usermgr "github.com/cs3org/reva/pkg/user"
+	userregistry "github.com/cs3org/reva/pkg/user/manager/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("machine", New)
+}
+
+type config struct {
+	// MachineSecret is shared with the trusted services allowed to act on
+	// behalf of the users.
+	MachineSecret string                            `mapstructure:"machine_secret"`
+	UserManager   string                            `mapstructure:"user_manager"`
+	UserManagers  map[string]map[string]interface{} `mapstructure:"user_managers"`
+}
+
+type manager struct {
+	secret []byte
+	users  usermgr.Manager
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns an auth manager that authenticates trusted services with a
+// shared machine secret and returns the user they want to act on behalf of.
+func New(m map[string]interface{}) (auth.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.MachineSecret == "" {
+		return nil, errors.New("machine: machine_secret is not set")
+	}
+
+	f, ok := userregistry.NewFuncs[c.UserManager]
+	if !ok {
+		return nil, errors.New("machine: user manager not found: " + c.UserManager)
+	}
+	users, err := f(c.UserManagers[c.UserManager])
+	if err != nil {
+		return nil, errors.Wrap(err, "machine: error creating user manager")
+	}
+
+	return &manager{secret: []byte(c.MachineSecret), users: users}, nil
+}
+
+// Authenticate returns the user identified by clientID, given as
+// <opaqueid>@<idp> or <opaqueid>, when clientSecret is the machine secret.
+func (m *manager) Authenticate(ctx context.Context, clientID, clientSecret string) (*user.User, error) {
+	if subtle.ConstantTimeCompare([]byte(clientSecret), m.secret) != 1 {
+		return nil, errtypes.InvalidCredentials(clientID)
+	}
+
+	uid := &user.UserId{OpaqueId: clientID}
+	if at := strings.LastIndex(clientID, "@"); at >= 0 {
+		uid.OpaqueId = clientID[:at]
+		uid.Idp = clientID[at+1:]
+	}
+
+	u, err := m.users.GetUser(ctx, uid)
+	if err != nil {
+		return nil, errors.Wrap(err, "machine: error getting user")
+	}
+
+	log := appctx.GetLogger(ctx)
+	log.Info().Str("user", clientID).Msg("machine: authenticated service on behalf of user")
+	return u, nil
+}
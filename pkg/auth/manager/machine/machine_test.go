@@ -0,0 +1,55 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package machine
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/cs3org/reva/pkg/user/manager/demo"
+)
+
+func TestMachine(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := New(map[string]interface{}{"user_manager": "demo"}); err == nil {
+		t.Fatal("expected an error without machine secret")
+	}
+
+	m, err := New(map[string]interface{}{"machine_secret": "secret", "user_manager": "demo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := m.Authenticate(ctx, "4c510ada-c86b-4815-8820-42cdf82c3d51", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "einstein" {
+		t.Errorf("%#v, wanted %#v", u.Username, "einstein")
+	}
+
+	if _, err := m.Authenticate(ctx, "4c510ada-c86b-4815-8820-42cdf82c3d51", "wrong"); err == nil {
+		t.Fatal("expected an error with a wrong secret")
+	}
+
+	if _, err := m.Authenticate(ctx, "unknown", "secret"); err == nil {
+		t.Fatal("expected an error for an unknown user")
+	}
+}
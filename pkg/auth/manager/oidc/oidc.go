@@ -23,14 +23,19 @@ package oidc
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	oidc "github.com/coreos/go-oidc"
 	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	"github.com/cs3org/reva/pkg/auth"
 	"github.com/cs3org/reva/pkg/auth/manager/registry"
+	"github.com/cs3org/reva/pkg/identity/mapping"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -42,14 +47,32 @@ func init() {
 }
 
 type mgr struct {
+	c      *config
+	mapper *mapping.Mapper
+
+	sync.Mutex
 	provider *oidc.Provider // cached on first request
-	c        *config
+	verifier *oidc.IDTokenVerifier
+	// introspectionEndpoint is either configured or discovered on first request
+	introspectionEndpoint string
 }
 
 type config struct {
 	Insecure bool   `mapstructure:"insecure"`
 	Issuer   string `mapstructure:"issuer"`
-	IDClaim  string `mapstructure:"id_claim"`
+	// ClientID is used to check the audience of JWT tokens and,
+	// together with ClientSecret, to authenticate against the introspection endpoint.
+	ClientID              string `mapstructure:"client_id"`
+	ClientSecret          string `mapstructure:"client_secret"`
+	IntrospectionEndpoint string `mapstructure:"introspection_endpoint"`
+	IDClaim               string `mapstructure:"id_claim"`
+	UsernameClaim         string `mapstructure:"username_claim"`
+	MailClaim             string `mapstructure:"mail_claim"`
+	DisplayNameClaim      string `mapstructure:"display_name_claim"`
+	GroupsClaim           string `mapstructure:"groups_claim"`
+	// Mapping maps the claims to the users, it defaults to the claims above
+	// and the issuer as identity provider.
+	Mapping mapping.Config `mapstructure:"mapping"`
 }
 
 func (c *config) init() {
@@ -57,6 +80,18 @@ func (c *config) init() {
 		// sub is stable and defined as unique. the user manager needs to take care of the sub to user metadata lookup
 		c.IDClaim = "sub"
 	}
+	if c.UsernameClaim == "" {
+		c.UsernameClaim = "preferred_username"
+	}
+	if c.MailClaim == "" {
+		c.MailClaim = "email"
+	}
+	if c.DisplayNameClaim == "" {
+		c.DisplayNameClaim = "name"
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -76,12 +111,27 @@ func New(m map[string]interface{}) (auth.Manager, error) {
 	}
 	c.init()
 
-	return &mgr{c: c}, nil
+	mapper, err := mapping.New(c.Mapping, mapping.Config{
+		Idp:         mapping.Attr("issuer"),
+		OpaqueID:    mapping.Attr(c.IDClaim),
+		Username:    mapping.Attr(c.UsernameClaim),
+		Mail:        mapping.Attr(c.MailClaim),
+		DisplayName: mapping.Attr(c.DisplayNameClaim),
+		Groups:      c.GroupsClaim,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &mgr{c: c, mapper: mapper, introspectionEndpoint: c.IntrospectionEndpoint}, nil
 }
 
 // the clientID it would be empty as we only need to validate the clientSecret variable
-// which contains the access token that we can use to contact the UserInfo endpoint
-// and get the user claims.
+// which contains the access token.
+// JWT tokens are verified against the keys published by the provider, which are
+// refreshed automatically when the provider rotates them. Opaque tokens are
+// validated using token introspection (RFC 7662) when the provider supports it,
+// otherwise the token is used to contact the UserInfo endpoint.
 func (am *mgr) Authenticate(ctx context.Context, clientID, clientSecret string) (*user.User, error) {
 	ctx = am.getOAuthCtx(ctx)
 
@@ -90,54 +140,196 @@ func (am *mgr) Authenticate(ctx context.Context, clientID, clientSecret string)
 		return nil, fmt.Errorf("error creating oidc provider: +%v", err)
 	}
 
-	oauth2Token := &oauth2.Token{
-		AccessToken: clientSecret,
+	// claims contains the standard OIDC claims like issuer, iat, aud, ... and any other non-standard one.
+	var claims map[string]interface{}
+	if isJWT(clientSecret) {
+		claims, err = am.verifyJWT(ctx, clientSecret)
+	} else if endpoint := am.getIntrospectionEndpoint(provider); endpoint != "" {
+		claims, err = am.introspect(ctx, endpoint, clientSecret)
 	}
-	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(oauth2Token))
 	if err != nil {
-		return nil, fmt.Errorf("oidc: error getting userinfo: +%v", err)
+		return nil, err
 	}
 
-	// claims contains the standard OIDC claims like issuer, iat, aud, ... and any other non-standard one.
-	// TODO(labkode): make claims configuration dynamic from the config file so we can add arbitrary mappings from claims to user struct.
-	var claims map[string]interface{}
-	if err := userInfo.Claims(&claims); err != nil {
-		return nil, fmt.Errorf("oidc: error unmarshaling userinfo claims: %v", err)
+	// access tokens do not always carry the profile claims, fetch them from the userinfo endpoint.
+	if claims == nil || am.missingProfileClaims(claims) {
+		userInfo, err := am.getUserInfo(ctx, provider, clientSecret)
+		if err != nil {
+			return nil, err
+		}
+		if claims == nil {
+			claims = userInfo
+		} else {
+			for k, v := range userInfo {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
 	}
-	log.Debug().Interface("claims", claims).Interface("userInfo", userInfo).Msg("unmarshalled userinfo")
+	log.Debug().Interface("claims", claims).Msg("resolved oidc claims")
+
+	return am.userFromClaims(claims)
+}
 
+func (am *mgr) missingProfileClaims(claims map[string]interface{}) bool {
+	for _, c := range []string{am.c.MailClaim, am.c.UsernameClaim, am.c.DisplayNameClaim} {
+		if claims[c] == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (am *mgr) userFromClaims(claims map[string]interface{}) (*user.User, error) {
 	if claims["issuer"] == nil { //This is not set in simplesamlphp
-		claims["issuer"] = am.c.Issuer
+		if iss, ok := claims["iss"].(string); ok {
+			claims["issuer"] = iss
+		} else {
+			claims["issuer"] = am.c.Issuer
+		}
 	}
 	if claims["email_verified"] == nil { //This is not set in simplesamlphp
 		claims["email_verified"] = false
 	}
 
-	if claims["email"] == nil {
-		return nil, fmt.Errorf("no \"email\" attribute found in userinfo: maybe the client did not request the oidc \"email\"-scope")
+	mailVerified, _ := claims["email_verified"].(bool)
+	claims[am.c.GroupsClaim] = getGroups(claims[am.c.GroupsClaim])
+
+	// the id is stable and non reassignable in the scope of the issuer
+	u, err := am.mapper.User(mapping.FromClaims(claims))
+	if err != nil {
+		return nil, errors.Wrap(err, "oidc: error mapping the claims")
 	}
+	u.MailVerified = mailVerified
 
-	if claims["preferred_username"] == nil || claims["name"] == nil {
-		return nil, fmt.Errorf("no \"preferred_username\" or \"name\" attribute found in userinfo: maybe the client did not request the oidc \"profile\"-scope")
+	return u, nil
+}
+
+// getGroups accepts both a list of groups and a single, space or comma separated, string.
+func getGroups(v interface{}) []string {
+	groups := []string{}
+	switch g := v.(type) {
+	case []interface{}:
+		for _, e := range g {
+			if s, ok := e.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	case []string:
+		groups = append(groups, g...)
+	case string:
+		groups = append(groups, strings.FieldsFunc(g, func(r rune) bool { return r == ',' || r == ' ' })...)
 	}
+	return groups
+}
 
-	u := &user.User{
-		Id: &user.UserId{
-			OpaqueId: claims[am.c.IDClaim].(string), // a stable non reassignable id
-			Idp:      claims["issuer"].(string),     // in the scope of this issuer
-		},
-		Username: claims["preferred_username"].(string),
-		// TODO(labkode) if we can get groups from the claim we need to give the possibility
-		// to the admin to chosse what claim provides the groups.
-		// TODO(labkode) ... use all claims from oidc?
-		// TODO(labkode): do like K8s does it: https://github.com/kubernetes/kubernetes/blob/master/staging/src/k8s.io/apiserver/plugin/pkg/authenticator/token/oidc/oidc.go
-		Groups:       []string{},
-		Mail:         claims["email"].(string),
-		MailVerified: claims["email_verified"].(bool),
-		DisplayName:  claims["name"].(string),
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func (am *mgr) verifyJWT(ctx context.Context, token string) (map[string]interface{}, error) {
+	am.Lock()
+	verifier := am.verifier
+	am.Unlock()
+
+	// the key set behind the verifier fetches new keys when it encounters an unknown key id,
+	// so key rotations on the provider side are picked up automatically.
+	t, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "oidc: error verifying token")
 	}
 
-	return u, nil
+	var claims map[string]interface{}
+	if err := t.Claims(&claims); err != nil {
+		return nil, errors.Wrap(err, "oidc: error unmarshaling token claims")
+	}
+	return claims, nil
+}
+
+func (am *mgr) getIntrospectionEndpoint(provider *oidc.Provider) string {
+	am.Lock()
+	defer am.Unlock()
+	if am.introspectionEndpoint != "" {
+		return am.introspectionEndpoint
+	}
+
+	var discovery struct {
+		IntrospectionEndpoint string `json:"introspection_endpoint"`
+	}
+	if err := provider.Claims(&discovery); err == nil {
+		am.introspectionEndpoint = discovery.IntrospectionEndpoint
+	}
+	return am.introspectionEndpoint
+}
+
+// introspect validates an opaque token following RFC 7662.
+func (am *mgr) introspect(ctx context.Context, endpoint, token string) (map[string]interface{}, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "oidc: error creating introspection request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if am.c.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(am.c.ClientID), url.QueryEscape(am.c.ClientSecret))
+	}
+
+	res, err := am.getHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "oidc: error doing introspection request")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: introspection endpoint returned status %d", res.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&claims); err != nil {
+		return nil, errors.Wrap(err, "oidc: error decoding introspection response")
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, errors.New("oidc: token is not active")
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(time.Now()) {
+		return nil, errors.New("oidc: token is expired")
+	}
+
+	if iss, ok := claims["iss"].(string); ok && iss != am.c.Issuer {
+		return nil, fmt.Errorf("oidc: token issued by %q, expected %q", iss, am.c.Issuer)
+	}
+	return claims, nil
+}
+
+func (am *mgr) getUserInfo(ctx context.Context, provider *oidc.Provider, token string) (map[string]interface{}, error) {
+	oauth2Token := &oauth2.Token{
+		AccessToken: token,
+	}
+	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(oauth2Token))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: error getting userinfo: +%v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := userInfo.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc: error unmarshaling userinfo claims: %v", err)
+	}
+	return claims, nil
+}
+
+func (am *mgr) getHTTPClient(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		return c
+	}
+	return http.DefaultClient
 }
 
 func (am *mgr) getOAuthCtx(ctx context.Context) context.Context {
@@ -157,6 +349,9 @@ func (am *mgr) getOAuthCtx(ctx context.Context) context.Context {
 }
 
 func (am *mgr) getOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
+	am.Lock()
+	defer am.Unlock()
+
 	if am.provider != nil {
 		return am.provider, nil
 	}
@@ -165,11 +360,17 @@ func (am *mgr) getOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
 	// Once initialized is a singleton that is reuser if further requests.
 	// The provider is responsible to verify the token sent by the client
 	// against the security keys oftentimes available in the .well-known endpoint.
-	provider, err := oidc.NewProvider(ctx, am.c.Issuer)
+	// The context is used by the key set to fetch the keys, so it must outlive the request.
+	keyCtx := context.WithValue(context.Background(), oauth2.HTTPClient, am.getHTTPClient(ctx))
+	provider, err := oidc.NewProvider(keyCtx, am.c.Issuer)
 	if err != nil {
 		return nil, fmt.Errorf("error creating a new oidc provider: %+v", err)
 	}
 
 	am.provider = provider
+	am.verifier = provider.Verifier(&oidc.Config{
+		ClientID:          am.c.ClientID,
+		SkipClientIDCheck: am.c.ClientID == "",
+	})
 	return am.provider, nil
 }
@@ -0,0 +1,170 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type testProvider struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys map[string]*rsa.PrivateKey
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	p := &testProvider{keys: map[string]*rsa.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 p.URL,
+			"jwks_uri":               p.URL + "/jwks",
+			"introspection_endpoint": p.URL + "/introspect",
+			"authorization_endpoint": p.URL + "/auth",
+			"token_endpoint":         p.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		keys := []map[string]string{}
+		for kid, k := range p.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "reva" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("token") != "opaque-token" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":             true,
+			"iss":                p.URL,
+			"sub":                "4c510ada-c86b-4815-8820-42cdf82c3d51",
+			"email":              "einstein@example.org",
+			"preferred_username": "einstein",
+			"name":               "Albert Einstein",
+			"roles":              []string{"sailing-lovers", "physics-lovers"},
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+func (p *testProvider) rotateKey(t *testing.T, kid string) {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = map[string]*rsa.PrivateKey{kid: k}
+}
+
+func (p *testProvider) sign(t *testing.T, kid string) string {
+	p.mu.Lock()
+	k := p.keys[kid]
+	p.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                p.URL,
+		"aud":                "reva",
+		"sub":                "f7fbf8c8-139b-4376-b307-cf0a8c2d0d9c",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"email":              "marie@example.org",
+		"preferred_username": "marie",
+		"name":               "Marie Curie",
+		"roles":              "radium-lovers polonium-lovers",
+	})
+	token.Header["kid"] = kid
+	s, err := token.SignedString(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAuthenticate(t *testing.T) {
+	p := newTestProvider(t)
+	defer p.Close()
+	p.rotateKey(t, "key-1")
+
+	m, err := New(map[string]interface{}{
+		"issuer":        p.URL,
+		"client_id":     "reva",
+		"client_secret": "secret",
+		"groups_claim":  "roles",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	u, err := m.Authenticate(ctx, "", p.sign(t, "key-1"))
+	if err != nil {
+		t.Fatalf("error authenticating with jwt: %v", err)
+	}
+	if u.Username != "marie" || u.Id.OpaqueId != "f7fbf8c8-139b-4376-b307-cf0a8c2d0d9c" || u.Id.Idp != p.URL {
+		t.Fatalf("unexpected user: %+v", u)
+	}
+	if len(u.Groups) != 2 || u.Groups[0] != "radium-lovers" {
+		t.Fatalf("unexpected groups: %+v", u.Groups)
+	}
+
+	// tokens signed with a rotated key must be accepted without restarting
+	p.rotateKey(t, "key-2")
+	if _, err = m.Authenticate(ctx, "", p.sign(t, "key-2")); err != nil {
+		t.Fatalf("error authenticating with jwt signed by rotated key: %v", err)
+	}
+
+	u, err = m.Authenticate(ctx, "", "opaque-token")
+	if err != nil {
+		t.Fatalf("error authenticating with opaque token: %v", err)
+	}
+	if u.Username != "einstein" || len(u.Groups) != 2 {
+		t.Fatalf("unexpected user: %+v", u)
+	}
+
+	if _, err = m.Authenticate(ctx, "", "revoked-token"); err == nil {
+		t.Fatal("expected error for inactive token")
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package saml
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	crewjam "github.com/crewjam/saml"
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/auth"
+	"github.com/cs3org/reva/pkg/auth/manager/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/identity/mapping"
+	"github.com/cs3org/reva/pkg/saml"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("saml", New)
+}
+
+// Default attributes, as found in the eduPerson schema used by the
+// Shibboleth federations.
+const (
+	attrPrincipalName = "urn:oid:1.3.6.1.4.1.5923.1.1.1.6"
+	attrUID           = "urn:oid:0.9.2342.19200300.100.1.1"
+	attrMail          = "urn:oid:0.9.2342.19200300.100.1.3"
+	attrDisplayName   = "urn:oid:2.16.840.1.113730.3.1.241"
+	attrIsMemberOf    = "urn:oid:1.3.6.1.4.1.5923.1.5.1.1"
+
+	// the issuer and the name id of the assertions are available to the
+	// mapping as attributes.
+	attrIssuer = "saml:issuer"
+	attrNameID = "saml:name_id"
+)
+
+type config struct {
+	saml.Config `mapstructure:",squash"`
+	// Attributes maps the fields of the CS3 user to the name or friendly
+	// name of the SAML attributes they are taken from.
+	Attributes attributes `mapstructure:"attributes"`
+	// Mapping maps the attributes to the users, it defaults to the
+	// attributes above, the name id when there is no id, and the issuer as
+	// identity provider.
+	Mapping mapping.Config `mapstructure:"mapping"`
+}
+
+type attributes struct {
+	OpaqueID    string `mapstructure:"opaque_id"`
+	Username    string `mapstructure:"username"`
+	Mail        string `mapstructure:"mail"`
+	DisplayName string `mapstructure:"display_name"`
+	Groups      string `mapstructure:"groups"`
+}
+
+type manager struct {
+	c      *config
+	sp     *crewjam.ServiceProvider
+	mapper *mapping.Mapper
+
+	// seen keeps the ids of the consumed assertions until they expire, so
+	// that they can not be replayed.
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *config) init() {
+	if c.Attributes.OpaqueID == "" {
+		c.Attributes.OpaqueID = attrPrincipalName
+	}
+	if c.Attributes.Username == "" {
+		c.Attributes.Username = attrUID
+	}
+	if c.Attributes.Mail == "" {
+		c.Attributes.Mail = attrMail
+	}
+	if c.Attributes.DisplayName == "" {
+		c.Attributes.DisplayName = attrDisplayName
+	}
+	if c.Attributes.Groups == "" {
+		c.Attributes.Groups = attrIsMemberOf
+	}
+}
+
+// New returns an auth manager verifying the SAML responses consumed by the
+// saml http service. The client id is the id of the authentication request
+// the response answers, empty for IdP-initiated logins, and the client
+// secret the base64 encoded response.
+func New(m map[string]interface{}) (auth.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.init()
+
+	sp, err := saml.NewServiceProvider(context.Background(), &c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mapper, err := newMapper(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &manager{c: c, sp: sp, mapper: mapper, seen: map[string]time.Time{}}, nil
+}
+
+func newMapper(c *config) (*mapping.Mapper, error) {
+	return mapping.New(c.Mapping, mapping.Config{
+		Idp:         mapping.Attr(attrIssuer),
+		OpaqueID:    fmt.Sprintf("{{or (attr %q) (attr %q)}}", c.Attributes.OpaqueID, attrNameID),
+		Username:    mapping.Attr(c.Attributes.Username),
+		Mail:        mapping.Attr(c.Attributes.Mail),
+		DisplayName: mapping.Attr(c.Attributes.DisplayName),
+		Groups:      c.Attributes.Groups,
+	})
+}
+
+func (m *manager) Authenticate(ctx context.Context, clientID, clientSecret string) (*user.User, error) {
+	log := appctx.GetLogger(ctx)
+
+	var requestIDs []string
+	if clientID != "" {
+		requestIDs = []string{clientID}
+	} else if !m.c.AllowIDPInitiated {
+		return nil, errtypes.InvalidCredentials("saml: identity provider initiated logins are not allowed")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(clientSecret)
+	if err != nil {
+		return nil, errtypes.InvalidCredentials("saml: response is not base64 encoded")
+	}
+
+	assertion, err := m.sp.ParseXMLResponse(data, requestIDs)
+	if err != nil {
+		if ire, ok := err.(*crewjam.InvalidResponseError); ok {
+			log.Warn().Err(ire.PrivateErr).Msg("saml: invalid response")
+		}
+		return nil, errtypes.InvalidCredentials("saml: invalid response")
+	}
+
+	if err := m.consume(assertion); err != nil {
+		return nil, err
+	}
+
+	return m.toUser(assertion)
+}
+
+// consume records the assertion, failing if it was already used.
+func (m *manager) consume(a *crewjam.Assertion) error {
+	expires := time.Now().Add(crewjam.MaxIssueDelay + crewjam.MaxClockSkew)
+	if a.Conditions != nil && a.Conditions.NotOnOrAfter.After(expires) {
+		expires = a.Conditions.NotOnOrAfter.Add(crewjam.MaxClockSkew)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, t := range m.seen {
+		if now.After(t) {
+			delete(m.seen, id)
+		}
+	}
+	if _, ok := m.seen[a.ID]; ok {
+		return errtypes.InvalidCredentials("saml: assertion already used: " + a.ID)
+	}
+	m.seen[a.ID] = expires
+	return nil
+}
+
+func (m *manager) toUser(a *crewjam.Assertion) (*user.User, error) {
+	attrs := mapping.Attributes{}
+	for _, st := range a.AttributeStatements {
+		for _, attr := range st.Attributes {
+			values := make([]string, 0, len(attr.Values))
+			for _, v := range attr.Values {
+				values = append(values, v.Value)
+			}
+			attrs.Set(attr.Name, values...)
+			if attr.FriendlyName != "" && attr.FriendlyName != attr.Name {
+				attrs.Set(attr.FriendlyName, values...)
+			}
+		}
+	}
+	attrs.Set(attrIssuer, a.Issuer.Value)
+	if a.Subject != nil && a.Subject.NameID != nil {
+		attrs.Set(attrNameID, a.Subject.NameID.Value)
+	}
+
+	u, err := m.mapper.User(attrs)
+	if err != nil {
+		return nil, errtypes.InvalidCredentials("saml: assertion without user id")
+	}
+	return u, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package saml
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	crewjam "github.com/crewjam/saml"
+)
+
+func newAssertion(id string, attrs ...crewjam.Attribute) *crewjam.Assertion {
+	return &crewjam.Assertion{
+		ID:     id,
+		Issuer: crewjam.Issuer{Value: "https://idp.example.org/idp/shibboleth"},
+		Subject: &crewjam.Subject{
+			NameID: &crewjam.NameID{Value: "AAdzZWNyZXQx"},
+		},
+		Conditions:          &crewjam.Conditions{NotOnOrAfter: time.Now().Add(5 * time.Minute)},
+		AttributeStatements: []crewjam.AttributeStatement{{Attributes: attrs}},
+	}
+}
+
+func attr(name, friendly string, values ...string) crewjam.Attribute {
+	a := crewjam.Attribute{Name: name, FriendlyName: friendly}
+	for _, v := range values {
+		a.Values = append(a.Values, crewjam.AttributeValue{Value: v})
+	}
+	return a
+}
+
+func TestToUser(t *testing.T) {
+	c := &config{}
+	c.init()
+	mapper, err := newMapper(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &manager{c: c, mapper: mapper}
+
+	u, err := m.toUser(newAssertion("1",
+		attr(attrPrincipalName, "eduPersonPrincipalName", "einstein@example.org"),
+		attr(attrUID, "uid", "einstein"),
+		attr(attrMail, "mail", "einstein@example.org"),
+		attr(attrDisplayName, "displayName", "Albert Einstein"),
+		attr(attrIsMemberOf, "isMemberOf", "physics", "sailing"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id.OpaqueId != "einstein@example.org" || u.Id.Idp != "https://idp.example.org/idp/shibboleth" {
+		t.Errorf("unexpected id %+v", u.Id)
+	}
+	if u.Username != "einstein" || u.Mail != "einstein@example.org" || u.DisplayName != "Albert Einstein" {
+		t.Errorf("unexpected user %+v", u)
+	}
+	if !reflect.DeepEqual(u.Groups, []string{"physics", "sailing"}) {
+		t.Errorf("got groups %v", u.Groups)
+	}
+
+	// attributes can be mapped by friendly name, the name id is the fallback id
+	c.Attributes.Username = "cn"
+	if m.mapper, err = newMapper(c); err != nil {
+		t.Fatal(err)
+	}
+	u, err = m.toUser(newAssertion("2", attr("urn:oid:2.5.4.3", "cn", "marie")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id.OpaqueId != "AAdzZWNyZXQx" || u.Username != "marie" {
+		t.Errorf("unexpected user %+v", u)
+	}
+}
+
+func TestConsume(t *testing.T) {
+	m := &manager{seen: map[string]time.Time{}}
+	if err := m.consume(newAssertion("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.consume(newAssertion("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.consume(newAssertion("1")); err == nil {
+		t.Error("expected a replayed assertion to be rejected")
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql authenticates the users kept by the sql user manager with
+// their password.
+package sql
+
+import (
+	"github.com/cs3org/reva/pkg/auth"
+	"github.com/cs3org/reva/pkg/auth/manager/registry"
+	usersql "github.com/cs3org/reva/pkg/user/manager/sql"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+// New returns an auth manager checking the passwords of the users of the
+// sql user manager, it takes the same configuration.
+func New(m map[string]interface{}) (auth.Manager, error) {
+	return usersql.NewManager(m)
+}
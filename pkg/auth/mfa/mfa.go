@@ -0,0 +1,432 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package mfa adds a second factor to the password logins: the time-based
+// one-time passwords (TOTP) of the authenticator apps, with recovery codes
+// for the users who lost their device. The secrets are encrypted by a key
+// provider before they are stored.
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/auth/mfa/store"
+	"github.com/cs3org/reva/pkg/auth/mfa/store/registry"
+	"github.com/cs3org/reva/pkg/auth/throttle"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/encryption/keys"
+	keysregistry "github.com/cs3org/reva/pkg/storage/encryption/keys/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Header carries the code of the second factor in the requests with basic
+// auth, and tells in the responses that a code is required.
+const Header = "X-MFA-Code"
+
+// OpaqueKey is the opaque entry of the authenticate requests carrying the
+// code, and of the responses telling that a code is required.
+const OpaqueKey = "mfa"
+
+var (
+	// ErrCodeRequired is returned when the user has to provide a code.
+	ErrCodeRequired = errors.New("mfa: code required")
+	// ErrEnrollmentRequired is returned when the user has to enroll a
+	// second factor, the login only gives access to the enrollment.
+	ErrEnrollmentRequired = errors.New("mfa: enrollment required")
+)
+
+type config struct {
+	Store        string                            `mapstructure:"store"`
+	Stores       map[string]map[string]interface{} `mapstructure:"stores"`
+	KeyProvider  string                            `mapstructure:"key_provider"`
+	KeyProviders map[string]map[string]interface{} `mapstructure:"key_providers"`
+	// Issuer names the service in the authenticator apps.
+	Issuer string `mapstructure:"issuer"`
+	// AuthTypes are the auth types asking for the second factor, the
+	// password ones. The app passwords are meant for the clients that
+	// cannot ask for a code.
+	AuthTypes []string `mapstructure:"auth_types"`
+	// EnforceGroups are the groups whose members have to enroll.
+	EnforceGroups []string `mapstructure:"enforce_groups"`
+	// Skew is the number of time steps of 30 seconds the codes can be off,
+	// for the clocks of the devices.
+	Skew int `mapstructure:"skew"`
+	// RecoveryCodes is the number of recovery codes given at enrollment.
+	RecoveryCodes int `mapstructure:"recovery_codes"`
+	// Throttle limits the invalid codes per user, see the throttle package.
+	// By default a user is locked out for 15 minutes after 5 invalid codes.
+	Throttle map[string]interface{} `mapstructure:"throttle"`
+}
+
+func (c *config) init() {
+	if c.Issuer == "" {
+		c.Issuer = "reva"
+	}
+	if len(c.AuthTypes) == 0 {
+		c.AuthTypes = []string{"basic"}
+	}
+	if c.Skew == 0 {
+		c.Skew = 1
+	}
+	if c.RecoveryCodes == 0 {
+		c.RecoveryCodes = 10
+	}
+	if len(c.Throttle) == 0 {
+		c.Throttle = map[string]interface{}{
+			"store":            "memory",
+			"free_attempts":    5,
+			"lockout_attempts": 5,
+			"lockout_duration": 900,
+		}
+	}
+}
+
+// Manager enrolls the second factors of the users and checks their codes.
+// A nil Manager asks nobody for a second factor.
+type Manager struct {
+	c         *config
+	store     store.Store
+	keys      keys.Provider
+	throttler *throttle.Throttler
+	now       func() time.Time
+}
+
+// New returns a manager configured from m, or nil if no store is
+// configured.
+func New(m map[string]interface{}) (*Manager, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "mfa: error decoding conf")
+	}
+	if c.Store == "" {
+		return nil, nil
+	}
+	c.init()
+
+	f, ok := registry.NewFuncs[c.Store]
+	if !ok {
+		return nil, fmt.Errorf("mfa: store not found: %s", c.Store)
+	}
+	s, err := f(c.Stores[c.Store])
+	if err != nil {
+		return nil, errors.Wrap(err, "mfa: error creating store")
+	}
+
+	if c.KeyProvider == "" {
+		return nil, errors.New("mfa: key_provider is required to encrypt the secrets")
+	}
+	g, ok := keysregistry.NewFuncs[c.KeyProvider]
+	if !ok {
+		return nil, fmt.Errorf("mfa: key provider not found: %s", c.KeyProvider)
+	}
+	p, err := g(c.KeyProviders[c.KeyProvider])
+	if err != nil {
+		return nil, errors.Wrap(err, "mfa: error creating key provider")
+	}
+
+	t, err := throttle.New(c.Throttle)
+	if err != nil {
+		return nil, errors.Wrap(err, "mfa: error creating throttler")
+	}
+
+	return &Manager{c: c, store: s, keys: p, throttler: t, now: time.Now}, nil
+}
+
+func userKey(u *userpb.User) string {
+	return u.Id.Idp + "!" + u.Id.OpaqueId
+}
+
+// throttleKey counts the invalid codes of the user, apart from the failed
+// password logins.
+func throttleKey(u *userpb.User) string {
+	return "mfa:" + userKey(u)
+}
+
+// Applies tells whether the logins of the auth type ask for a second factor.
+func (m *Manager) Applies(authType string) bool {
+	if m == nil {
+		return false
+	}
+	for _, t := range m.c.AuthTypes {
+		if t == authType {
+			return true
+		}
+	}
+	return false
+}
+
+// Required tells whether the user has to enroll a second factor.
+func (m *Manager) Required(u *userpb.User) bool {
+	if m == nil {
+		return false
+	}
+	for _, g := range u.Groups {
+		for _, e := range m.c.EnforceGroups {
+			if g == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Status describes the second factor of a user.
+type Status struct {
+	Enrolled      bool
+	Required      bool
+	RecoveryCodes int
+}
+
+// Status returns the second factor status of the user.
+func (m *Manager) Status(ctx context.Context, u *userpb.User) (*Status, error) {
+	st := &Status{Required: m.Required(u)}
+	if m == nil {
+		return st, nil
+	}
+	e, err := m.enrollment(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && e.Confirmed {
+		st.Enrolled = true
+		st.RecoveryCodes = len(e.RecoveryCodes)
+	}
+	return st, nil
+}
+
+// enrollment returns the enrollment of the user, nil if there is none.
+func (m *Manager) enrollment(ctx context.Context, u *userpb.User) (*store.Enrollment, error) {
+	e, err := m.store.Get(ctx, userKey(u))
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "mfa: error getting enrollment")
+	}
+	return e, nil
+}
+
+// Begin starts the enrollment of the user, it returns the secret to enter in
+// the authenticator app and the URI to show as a QR code. The enrollment
+// is confirmed with a first code.
+func (m *Manager) Begin(ctx context.Context, u *userpb.User) (string, string, error) {
+	e, err := m.enrollment(ctx, u)
+	if err != nil {
+		return "", "", err
+	}
+	if e != nil && e.Confirmed {
+		return "", "", errtypes.AlreadyExists("second factor of " + u.Username)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", "", errors.Wrap(err, "mfa: error generating secret")
+	}
+	wrapped, err := m.keys.Wrap(ctx, secret)
+	if err != nil {
+		return "", "", errors.Wrap(err, "mfa: error encrypting secret")
+	}
+	e = &store.Enrollment{Secret: wrapped, Ctime: m.now()}
+	if err := m.store.Set(ctx, userKey(u), e); err != nil {
+		return "", "", errors.Wrap(err, "mfa: error saving enrollment")
+	}
+	return b32.EncodeToString(secret), keyURI(m.c.Issuer, u.Username, secret), nil
+}
+
+// Confirm completes the enrollment with a code of the authenticator app and
+// returns the recovery codes.
+func (m *Manager) Confirm(ctx context.Context, u *userpb.User, code string) ([]string, error) {
+	e, err := m.enrollment(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, errtypes.NotFound("second factor of " + u.Username)
+	}
+	if e.Confirmed {
+		return nil, errtypes.AlreadyExists("second factor of " + u.Username)
+	}
+	if err := m.verify(ctx, u, e, code, false); err != nil {
+		return nil, err
+	}
+	e.Confirmed = true
+	return m.newRecoveryCodes(ctx, u, e)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, who
+// proves to have the second factor with a code.
+func (m *Manager) RegenerateRecoveryCodes(ctx context.Context, u *userpb.User, code string) ([]string, error) {
+	e, err := m.confirmed(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(ctx, u, e, code, true); err != nil {
+		return nil, err
+	}
+	return m.newRecoveryCodes(ctx, u, e)
+}
+
+// Disable removes the second factor of the user, who proves to have it with
+// a code. The members of the enforced groups cannot disable it.
+func (m *Manager) Disable(ctx context.Context, u *userpb.User, code string) error {
+	if m.Required(u) {
+		return errtypes.PermissionDenied("the second factor is required")
+	}
+	e, err := m.confirmed(ctx, u)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(ctx, u, e, code, true); err != nil {
+		return err
+	}
+	return m.store.Delete(ctx, userKey(u))
+}
+
+// Check checks the code given by the user at login. It returns
+// ErrCodeRequired if the user enrolled and gave no code, and
+// ErrEnrollmentRequired if the user has to enroll first.
+func (m *Manager) Check(ctx context.Context, u *userpb.User, code string) error {
+	if m == nil {
+		return nil
+	}
+	e, err := m.enrollment(ctx, u)
+	if err != nil {
+		return err
+	}
+	if e == nil || !e.Confirmed {
+		if m.Required(u) {
+			return ErrEnrollmentRequired
+		}
+		return nil
+	}
+	if code == "" {
+		return ErrCodeRequired
+	}
+	return m.verify(ctx, u, e, code, true)
+}
+
+func (m *Manager) confirmed(ctx context.Context, u *userpb.User) (*store.Enrollment, error) {
+	e, err := m.enrollment(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil || !e.Confirmed {
+		return nil, errtypes.NotFound("second factor of " + u.Username)
+	}
+	return e, nil
+}
+
+// verify accepts a code of the authenticator app or, with recovery, a
+// recovery code. The codes are used once, even by concurrent logins, and
+// the invalid codes are throttled per user.
+func (m *Manager) verify(ctx context.Context, u *userpb.User, e *store.Enrollment, code string, recovery bool) error {
+	key := throttleKey(u)
+	wait, err := m.throttler.Wait(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "mfa: error checking invalid codes")
+	}
+	if wait > 0 {
+		return errtypes.InvalidCredentials(fmt.Sprintf("too many invalid codes, retry in %s", wait.Round(time.Second)))
+	}
+
+	ok, err := m.use(ctx, u, e, code, recovery)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := m.throttler.Fail(ctx, key); err != nil {
+			return errors.Wrap(err, "mfa: error counting invalid code")
+		}
+		return errtypes.InvalidCredentials("invalid code")
+	}
+	if err := m.throttler.Reset(ctx, key); err != nil {
+		return errors.Wrap(err, "mfa: error resetting invalid codes")
+	}
+	return nil
+}
+
+// use uses up the code if it is valid and was not used yet.
+func (m *Manager) use(ctx context.Context, u *userpb.User, e *store.Enrollment, code string, recovery bool) (bool, error) {
+	secret, err := m.keys.Unwrap(ctx, e.Secret)
+	if err != nil {
+		return false, errors.Wrap(err, "mfa: error decrypting secret")
+	}
+	if s, ok := validate(secret, code, m.now(), m.c.Skew); ok {
+		used, err := m.store.UseStep(ctx, userKey(u), s)
+		if err != nil {
+			return false, errors.Wrap(err, "mfa: error saving enrollment")
+		}
+		if used {
+			e.LastStep = s
+		}
+		return used, nil
+	}
+	if !recovery {
+		return false, nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	for _, h := range e.RecoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(normalized)) == nil {
+			used, err := m.store.UseRecoveryCode(ctx, userKey(u), h)
+			if err != nil {
+				return false, errors.Wrap(err, "mfa: error saving enrollment")
+			}
+			if used {
+				e.RecoveryCodes, _ = store.RemoveCode(e.RecoveryCodes, h)
+			}
+			return used, nil
+		}
+	}
+	return false, nil
+}
+
+// newRecoveryCodes replaces the recovery codes of the enrollment and saves it.
+func (m *Manager) newRecoveryCodes(ctx context.Context, u *userpb.User, e *store.Enrollment) ([]string, error) {
+	codes := make([]string, 0, m.c.RecoveryCodes)
+	hashes := make([]string, 0, m.c.RecoveryCodes)
+	for i := 0; i < m.c.RecoveryCodes; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.Wrap(err, "mfa: error generating recovery code")
+		}
+		c := strings.ToLower(b32.EncodeToString(b))
+		h, err := bcrypt.GenerateFromPassword([]byte(c), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, errors.Wrap(err, "mfa: error hashing recovery code")
+		}
+		codes = append(codes, c[:4]+"-"+c[4:])
+		hashes = append(hashes, string(h))
+	}
+	e.RecoveryCodes = hashes
+	if err := m.store.Set(ctx, userKey(u), e); err != nil {
+		return nil, errors.Wrap(err, "mfa: error saving enrollment")
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(c string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(c))
+}
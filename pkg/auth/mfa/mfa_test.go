@@ -0,0 +1,247 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package mfa
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	_ "github.com/cs3org/reva/pkg/auth/mfa/store/memory"
+	_ "github.com/cs3org/reva/pkg/auth/throttle/store/memory"
+	"github.com/cs3org/reva/pkg/errtypes"
+	_ "github.com/cs3org/reva/pkg/storage/encryption/keys/file"
+)
+
+func TestCode(t *testing.T) {
+	// the SHA1 test vectors of RFC 6238, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	for ts, expected := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1234567890:  "005924",
+		20000000000: "353130",
+	} {
+		if c := code(secret, step(time.Unix(ts, 0))); c != expected {
+			t.Errorf("code at %d: expected %s, got %s", ts, expected, c)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	if _, ok := validate(secret, "081804", now.Add(30*time.Second), 1); !ok {
+		t.Error("expected the code of the previous step to be valid")
+	}
+	if _, ok := validate(secret, "081804", now.Add(90*time.Second), 1); ok {
+		t.Error("expected an old code to be invalid")
+	}
+}
+
+func newTestManager(t *testing.T, dir string) *Manager {
+	keyFile := path.Join(dir, "master.key")
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	if err := ioutil.WriteFile(keyFile, []byte(key), 0600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(map[string]interface{}{
+		"store":          "memory",
+		"key_provider":   "file",
+		"key_providers":  map[string]map[string]interface{}{"file": {"key_file": keyFile}},
+		"enforce_groups": []string{"admins"},
+		"recovery_codes": 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEnrollment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mfa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := newTestManager(t, dir)
+	now := time.Unix(1600000000, 0)
+	m.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "4c510ada"}, Username: "einstein"}
+	admin := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "ddc2004c"}, Username: "admin", Groups: []string{"admins"}}
+
+	if err := m.Check(ctx, einstein, ""); err != nil {
+		t.Fatalf("expected no second factor before enrollment, got %v", err)
+	}
+	if err := m.Check(ctx, admin, ""); err != ErrEnrollmentRequired {
+		t.Fatalf("expected the enrollment to be required, got %v", err)
+	}
+
+	secret, uri, err := m.Begin(ctx, einstein)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Query().Get("secret") != secret {
+		t.Errorf("unexpected key uri %s", uri)
+	}
+	raw, err := b32.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second factor is only asked for once confirmed
+	if err := m.Check(ctx, einstein, ""); err != nil {
+		t.Fatalf("expected no second factor before confirmation, got %v", err)
+	}
+	if _, err := m.Confirm(ctx, einstein, "000000"); err == nil {
+		t.Fatal("expected a wrong code to be refused")
+	}
+	codes, err := m.Confirm(ctx, einstein, code(raw, step(now)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 2 {
+		t.Fatalf("expected 2 recovery codes, got %d", len(codes))
+	}
+
+	if err := m.Check(ctx, einstein, ""); err != ErrCodeRequired {
+		t.Fatalf("expected a code to be required, got %v", err)
+	}
+	// the code used to confirm cannot be used again
+	if err := m.Check(ctx, einstein, code(raw, step(now))); err == nil {
+		t.Fatal("expected a used code to be refused")
+	} else if _, ok := err.(errtypes.IsInvalidCredentials); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	if err := m.Check(ctx, einstein, code(raw, step(now))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the recovery codes are used once
+	if err := m.Check(ctx, einstein, codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(ctx, einstein, codes[0]); err == nil {
+		t.Fatal("expected a used recovery code to be refused")
+	}
+	st, err := m.Status(ctx, einstein)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Enrolled || st.Required || st.RecoveryCodes != 1 {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	if err := m.Disable(ctx, einstein, codes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(ctx, einstein, ""); err != nil {
+		t.Fatalf("expected no second factor after disabling it, got %v", err)
+	}
+}
+
+func TestInvalidCodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mfa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := newTestManager(t, dir)
+	ctx := context.Background()
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "4c510ada"}, Username: "einstein"}
+
+	secret, _, err := m.Begin(ctx, einstein)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := b32.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := m.now()
+	if _, err := m.Confirm(ctx, einstein, code(raw, step(now))); err != nil {
+		t.Fatal(err)
+	}
+
+	// a code is accepted once, even by concurrent logins
+	now = now.Add(30 * time.Second)
+	m.now = func() time.Time { return now }
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m.Check(ctx, einstein, code(raw, step(now))) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Fatalf("expected the code to be accepted once, got %d", accepted)
+	}
+
+	// the user is locked out after 5 invalid codes, even with a valid one
+	for i := 0; i < 4; i++ {
+		if err := m.Check(ctx, einstein, "000000"); err == nil {
+			t.Fatal("expected an invalid code to be refused")
+		}
+	}
+	now = now.Add(30 * time.Second)
+	if err := m.Check(ctx, einstein, code(raw, step(now))); err == nil {
+		t.Fatal("expected the user to be locked out")
+	} else if _, ok := err.(errtypes.IsInvalidCredentials); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// resetting the invalid codes unlocks the user
+	if err := m.throttler.Reset(ctx, throttleKey(einstein)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(ctx, einstein, code(raw, step(now))); err != nil {
+		t.Fatalf("expected the code to be accepted once unlocked, got %v", err)
+	}
+}
+
+func TestNilManager(t *testing.T) {
+	m, err := New(map[string]interface{}{})
+	if err != nil || m != nil {
+		t.Fatalf("expected a nil manager without store, got %v, %v", m, err)
+	}
+	if m.Applies("basic") {
+		t.Error("expected a nil manager to apply to no auth type")
+	}
+	if err := m.Check(context.Background(), &userpb.User{}, ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cs3org/reva/pkg/auth/mfa/store"
+	"github.com/cs3org/reva/pkg/auth/mfa/store/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/jsonfile"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("json", New)
+}
+
+type config struct {
+	File string `mapstructure:"file"`
+}
+
+type enrollmentsModel struct {
+	Enrollments map[string]*store.Enrollment `json:"enrollments"` // map[user]enrollment
+}
+
+type jsonStore struct {
+	c          *config
+	sync.Mutex // concurrent access to the file and model
+	model      *enrollmentsModel
+	file       *jsonfile.File
+}
+
+// New returns a store that persists the enrollments to a json file. The file
+// is reloaded when it changes, so that it can be shared by the gateway
+// checking the codes and the ocs service enrolling the users.
+func New(m map[string]interface{}) (store.Store, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "json: error decoding conf")
+	}
+	if c.File == "" {
+		return nil, errors.New("json: file is required")
+	}
+
+	f, err := jsonfile.Open(c.File)
+	if err != nil {
+		return nil, errors.Wrap(err, "json: error opening the file")
+	}
+
+	s := &jsonStore{c: c, file: f}
+	if err := s.load(); err != nil {
+		return nil, errors.Wrap(err, "json: error loading the file containing the enrollments")
+	}
+	return s, nil
+}
+
+// load picks up the enrollments changed by the other services.
+func (s *jsonStore) load() error {
+	model := &enrollmentsModel{}
+	if ok, err := s.file.Load(model); err != nil || !ok {
+		return err
+	}
+	if model.Enrollments == nil {
+		model.Enrollments = map[string]*store.Enrollment{}
+	}
+
+	s.model = model
+	return nil
+}
+
+func (s *jsonStore) save() error {
+	return s.file.Save(s.model)
+}
+
+func (s *jsonStore) Get(ctx context.Context, user string) (*store.Enrollment, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	e, ok := s.model.Enrollments[user]
+	if !ok {
+		return nil, errtypes.NotFound(user)
+	}
+	c := *e
+	c.RecoveryCodes = append([]string{}, e.RecoveryCodes...)
+	return &c, nil
+}
+
+func (s *jsonStore) Set(ctx context.Context, user string, e *store.Enrollment) error {
+	s.Lock()
+	defer s.Unlock()
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	c := *e
+	c.RecoveryCodes = append([]string{}, e.RecoveryCodes...)
+	if old, ok := s.model.Enrollments[user]; ok && old.LastStep > c.LastStep {
+		c.LastStep = old.LastStep
+	}
+	s.model.Enrollments[user] = &c
+	return s.save()
+}
+
+func (s *jsonStore) UseStep(ctx context.Context, user string, step int64) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	e, ok := s.model.Enrollments[user]
+	if !ok {
+		return false, errtypes.NotFound(user)
+	}
+	if step <= e.LastStep {
+		return false, nil
+	}
+	e.LastStep = step
+	return true, s.save()
+}
+
+func (s *jsonStore) UseRecoveryCode(ctx context.Context, user, hash string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	e, ok := s.model.Enrollments[user]
+	if !ok {
+		return false, errtypes.NotFound(user)
+	}
+	codes, ok := store.RemoveCode(e.RecoveryCodes, hash)
+	if !ok {
+		return false, nil
+	}
+	e.RecoveryCodes = codes
+	return true, s.save()
+}
+
+func (s *jsonStore) Delete(ctx context.Context, user string) error {
+	s.Lock()
+	defer s.Unlock()
+	unlock, err := s.file.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	delete(s.model.Enrollments, user)
+	return s.save()
+}
@@ -0,0 +1,108 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cs3org/reva/pkg/auth/mfa/store"
+	"github.com/cs3org/reva/pkg/auth/mfa/store/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+func init() {
+	registry.Register("memory", New)
+}
+
+type memory struct {
+	mu          sync.Mutex
+	enrollments map[string]store.Enrollment
+}
+
+// New returns a store keeping the enrollments in memory, they are lost when
+// revad restarts and not shared between services, which makes it only
+// useful for tests.
+func New(m map[string]interface{}) (store.Store, error) {
+	return &memory{enrollments: map[string]store.Enrollment{}}, nil
+}
+
+func (s *memory) Get(ctx context.Context, user string) (*store.Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.enrollments[user]
+	if !ok {
+		return nil, errtypes.NotFound(user)
+	}
+	e.RecoveryCodes = append([]string{}, e.RecoveryCodes...)
+	return &e, nil
+}
+
+func (s *memory) Set(ctx context.Context, user string, e *store.Enrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *e
+	c.RecoveryCodes = append([]string{}, e.RecoveryCodes...)
+	if old, ok := s.enrollments[user]; ok && old.LastStep > c.LastStep {
+		c.LastStep = old.LastStep
+	}
+	s.enrollments[user] = c
+	return nil
+}
+
+func (s *memory) UseStep(ctx context.Context, user string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.enrollments[user]
+	if !ok {
+		return false, errtypes.NotFound(user)
+	}
+	if step <= e.LastStep {
+		return false, nil
+	}
+	e.LastStep = step
+	s.enrollments[user] = e
+	return true, nil
+}
+
+func (s *memory) UseRecoveryCode(ctx context.Context, user, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.enrollments[user]
+	if !ok {
+		return false, errtypes.NotFound(user)
+	}
+	codes, ok := store.RemoveCode(e.RecoveryCodes, hash)
+	if !ok {
+		return false, nil
+	}
+	e.RecoveryCodes = codes
+	s.enrollments[user] = e
+	return true, nil
+}
+
+func (s *memory) Delete(ctx context.Context, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.enrollments, user)
+	return nil
+}
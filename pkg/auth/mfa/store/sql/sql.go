@@ -0,0 +1,190 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements a second factor store backed by a MySQL or
+// PostgreSQL database.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/cs3org/reva/pkg/auth/mfa/store"
+	"github.com/cs3org/reva/pkg/auth/mfa/store/registry"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+}
+
+type sqlStore struct {
+	c  *config
+	db *sql.DB
+}
+
+// New returns a second factor store backed by a SQL database.
+func New(m map[string]interface{}) (store.Store, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "sql: error decoding conf")
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqlStore{c: c, db: db}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "mfa_schema_migrations", migrations); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// migrations contains the schema changes in the order they are applied.
+// The applied version is tracked in the mfa_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS mfa_enrollments (
+		user_key VARCHAR(512) NOT NULL PRIMARY KEY,
+		secret TEXT NOT NULL,
+		confirmed BOOLEAN NOT NULL,
+		recovery_codes TEXT NOT NULL,
+		last_step BIGINT NOT NULL,
+		ctime BIGINT NOT NULL
+	)`,
+}
+
+func (s *sqlStore) Get(ctx context.Context, user string) (*store.Enrollment, error) {
+	var (
+		secret, codes   string
+		confirmed       bool
+		lastStep, ctime int64
+	)
+	query := "SELECT secret, confirmed, recovery_codes, last_step, ctime FROM mfa_enrollments WHERE user_key = ?"
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.c.DBDriver, query), user).Scan(&secret, &confirmed, &codes, &lastStep, &ctime)
+	if err == sql.ErrNoRows {
+		return nil, errtypes.NotFound(user)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error getting enrollment")
+	}
+
+	e := &store.Enrollment{
+		Confirmed: confirmed,
+		LastStep:  lastStep,
+		Ctime:     time.Unix(0, ctime),
+	}
+	// the secret is stored as json to keep it base64 encoded
+	if err := json.Unmarshal([]byte(secret), &e.Secret); err != nil {
+		return nil, errors.Wrap(err, "sql: error decoding secret")
+	}
+	if err := json.Unmarshal([]byte(codes), &e.RecoveryCodes); err != nil {
+		return nil, errors.Wrap(err, "sql: error decoding recovery codes")
+	}
+	return e, nil
+}
+
+func (s *sqlStore) Set(ctx context.Context, user string, e *store.Enrollment) error {
+	secret, err := json.Marshal(e.Secret)
+	if err != nil {
+		return errors.Wrap(err, "sql: error encoding secret")
+	}
+	codes, err := json.Marshal(e.RecoveryCodes)
+	if err != nil {
+		return errors.Wrap(err, "sql: error encoding recovery codes")
+	}
+
+	// upsert, with the syntax of the driver
+	query := "INSERT INTO mfa_enrollments (user_key, secret, confirmed, recovery_codes, last_step, ctime) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE secret = VALUES(secret), confirmed = VALUES(confirmed), recovery_codes = VALUES(recovery_codes), last_step = GREATEST(last_step, VALUES(last_step)), ctime = VALUES(ctime)"
+	if s.c.DBDriver == "postgres" {
+		query = "INSERT INTO mfa_enrollments (user_key, secret, confirmed, recovery_codes, last_step, ctime) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (user_key) DO UPDATE SET secret = EXCLUDED.secret, confirmed = EXCLUDED.confirmed, recovery_codes = EXCLUDED.recovery_codes, last_step = GREATEST(mfa_enrollments.last_step, EXCLUDED.last_step), ctime = EXCLUDED.ctime"
+	}
+	if _, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.c.DBDriver, query), user, string(secret), e.Confirmed, string(codes), e.LastStep, e.Ctime.UnixNano()); err != nil {
+		return errors.Wrap(err, "sql: error saving enrollment")
+	}
+	return nil
+}
+
+// UseStep raises last_step in a single statement, so that concurrent
+// logins cannot both use the code of a step.
+func (s *sqlStore) UseStep(ctx context.Context, user string, step int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.c.DBDriver, "UPDATE mfa_enrollments SET last_step = ? WHERE user_key = ? AND last_step < ?"), step, user, step)
+	if err != nil {
+		return false, errors.Wrap(err, "sql: error saving last step")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql: error saving last step")
+	}
+	return n == 1, nil
+}
+
+// UseRecoveryCode replaces the recovery codes only if they did not change
+// since they were read, so that a code is not used by concurrent logins.
+func (s *sqlStore) UseRecoveryCode(ctx context.Context, user, hash string) (bool, error) {
+	var codes string
+	query := "SELECT recovery_codes FROM mfa_enrollments WHERE user_key = ?"
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.c.DBDriver, query), user).Scan(&codes)
+	if err == sql.ErrNoRows {
+		return false, errtypes.NotFound(user)
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "sql: error getting recovery codes")
+	}
+	var hashes []string
+	if err := json.Unmarshal([]byte(codes), &hashes); err != nil {
+		return false, errors.Wrap(err, "sql: error decoding recovery codes")
+	}
+	hashes, ok := store.RemoveCode(hashes, hash)
+	if !ok {
+		return false, nil
+	}
+	updated, err := json.Marshal(hashes)
+	if err != nil {
+		return false, errors.Wrap(err, "sql: error encoding recovery codes")
+	}
+
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.c.DBDriver, "UPDATE mfa_enrollments SET recovery_codes = ? WHERE user_key = ? AND recovery_codes = ?"), string(updated), user, codes)
+	if err != nil {
+		return false, errors.Wrap(err, "sql: error saving recovery codes")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "sql: error saving recovery codes")
+	}
+	return n == 1, nil
+}
+
+func (s *sqlStore) Delete(ctx context.Context, user string) error {
+	if _, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.c.DBDriver, "DELETE FROM mfa_enrollments WHERE user_key = ?"), user); err != nil {
+		return errors.Wrap(err, "sql: error deleting enrollment")
+	}
+	return nil
+}
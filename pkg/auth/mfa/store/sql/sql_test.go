@@ -0,0 +1,99 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cs3org/reva/pkg/auth/mfa/store"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+)
+
+// newTestStore uses the postgres queries, whose upsert sqlite understands.
+func newTestStore(t *testing.T) *sqlStore {
+	s := &sqlStore{c: &config{Config: sqlutil.Config{DBDriver: "postgres"}}, db: sqlitetest.Open(t)}
+	if err := sqlutil.Migrate(context.Background(), s.db, s.c.DBDriver, "mfa_schema_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestEnrollments(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	if _, err := s.Get(ctx, "einstein"); err == nil {
+		t.Fatal("expected no enrollment")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	e := &store.Enrollment{Secret: []byte{0, 1, 2}, RecoveryCodes: []string{"a", "b"}, LastStep: 10, Ctime: time.Now()}
+	if err := s.Set(ctx, "einstein", e); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, "einstein")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Secret) != string(e.Secret) || got.Confirmed || len(got.RecoveryCodes) != 2 || got.LastStep != 10 || !got.Ctime.Equal(e.Ctime) {
+		t.Errorf("Get() = %+v", got)
+	}
+
+	// saving an enrollment never lowers the last step
+	e.Confirmed = true
+	e.LastStep = 5
+	if err := s.Set(ctx, "einstein", e); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, "einstein"); err != nil || !got.Confirmed || got.LastStep != 10 {
+		t.Errorf("Get() after update = %+v, %v", got, err)
+	}
+
+	// the steps and the recovery codes are used once
+	if ok, err := s.UseStep(ctx, "einstein", 10); err != nil || ok {
+		t.Errorf("UseStep() of the last step = %v, %v", ok, err)
+	}
+	if ok, err := s.UseStep(ctx, "einstein", 11); err != nil || !ok {
+		t.Errorf("UseStep() of a new step = %v, %v", ok, err)
+	}
+	if ok, err := s.UseRecoveryCode(ctx, "einstein", "a"); err != nil || !ok {
+		t.Errorf("UseRecoveryCode() = %v, %v", ok, err)
+	}
+	if ok, err := s.UseRecoveryCode(ctx, "einstein", "a"); err != nil || ok {
+		t.Errorf("UseRecoveryCode() of a used code = %v, %v", ok, err)
+	}
+	if got, err := s.Get(ctx, "einstein"); err != nil || got.LastStep != 11 || len(got.RecoveryCodes) != 1 || got.RecoveryCodes[0] != "b" {
+		t.Errorf("Get() after use = %+v, %v", got, err)
+	}
+	if _, err := s.UseRecoveryCode(ctx, "marie", "a"); err == nil {
+		t.Error("expected the recovery codes of a user without enrollment not to be found")
+	}
+
+	if err := s.Delete(ctx, "einstein"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "einstein"); err == nil {
+		t.Error("expected the deleted enrollment not to be found")
+	}
+}
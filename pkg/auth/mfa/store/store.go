@@ -0,0 +1,68 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package store defines where the second factors of the users are kept.
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Enrollment holds the second factor of a user.
+type Enrollment struct {
+	// Secret is the TOTP secret, encrypted by the key provider.
+	Secret []byte `json:"secret"`
+	// Confirmed tells whether the user proved to have the secret, the
+	// second factor is only asked for once confirmed.
+	Confirmed bool `json:"confirmed"`
+	// RecoveryCodes are the hashes of the unused recovery codes.
+	RecoveryCodes []string `json:"recovery_codes"`
+	// LastStep is the time step of the last code used, so that codes are
+	// not used twice.
+	LastStep int64     `json:"last_step"`
+	Ctime    time.Time `json:"ctime"`
+}
+
+// Store keeps the enrollments, by user.
+type Store interface {
+	// Get returns the enrollment of the user, errtypes.NotFound if there
+	// is none.
+	Get(ctx context.Context, user string) (*Enrollment, error)
+	// Set saves the enrollment of the user. The LastStep of a saved
+	// enrollment is never lowered.
+	Set(ctx context.Context, user string, e *Enrollment) error
+	// UseStep atomically raises the LastStep of the user to step, it
+	// returns false if a code of this step or of a later one was used.
+	UseStep(ctx context.Context, user string, step int64) (bool, error)
+	// UseRecoveryCode atomically removes the hash of a recovery code of the
+	// user, it returns false if the code was already used.
+	UseRecoveryCode(ctx context.Context, user, hash string) (bool, error)
+	// Delete removes the enrollment of the user.
+	Delete(ctx context.Context, user string) error
+}
+
+// RemoveCode returns the hashes without hash, and whether it was found.
+func RemoveCode(hashes []string, hash string) ([]string, bool) {
+	for i, h := range hashes {
+		if h == hash {
+			return append(append([]string{}, hashes[:i]...), hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
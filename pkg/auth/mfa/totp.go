@@ -0,0 +1,100 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The parameters of the codes, the defaults of the authenticator apps.
+const (
+	period = 30
+	digits = 6
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newSecret returns a random TOTP secret.
+func newSecret() ([]byte, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// step returns the time step of t.
+func step(t time.Time) int64 {
+	return t.Unix() / period
+}
+
+// code returns the code of the time step, as defined in RFC 6238.
+func code(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	_, _ = mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	n := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, n%1000000)
+}
+
+// validate returns the time step of the code if it is valid at t, allowing
+// the codes of skew steps before and after for the clock drift.
+func validate(secret []byte, c string, t time.Time, skew int) (int64, bool) {
+	c = strings.TrimSpace(c)
+	if len(c) != digits {
+		return 0, false
+	}
+	now := step(t)
+	for i := -int64(skew); i <= int64(skew); i++ {
+		if hmac.Equal([]byte(code(secret, now+i)), []byte(c)) {
+			return now + i, true
+		}
+	}
+	return 0, false
+}
+
+// keyURI returns the otpauth URI the authenticator apps import, usually
+// shown as a QR code.
+func keyURI(issuer, account string, secret []byte) string {
+	q := url.Values{}
+	q.Set("secret", b32.EncodeToString(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(digits))
+	q.Set("period", fmt.Sprint(period))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
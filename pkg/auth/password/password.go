@@ -0,0 +1,80 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package password checks new passwords against a configurable policy.
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Policy is the minimum strength required for new passwords. The zero
+// Policy accepts any password that is not empty.
+type Policy struct {
+	MinLength  int `mapstructure:"min_length"`
+	MinUpper   int `mapstructure:"min_upper"`
+	MinLower   int `mapstructure:"min_lower"`
+	MinDigits  int `mapstructure:"min_digits"`
+	MinSpecial int `mapstructure:"min_special"`
+}
+
+// Validate returns an error telling every requirement of the policy the
+// password does not meet.
+func (p *Policy) Validate(password string) error {
+	if password == "" {
+		return fmt.Errorf("password must not be empty")
+	}
+
+	var length, upper, lower, digits, special int
+	for _, r := range password {
+		length++
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		case unicode.IsDigit(r):
+			digits++
+		case !unicode.IsLetter(r):
+			special++
+		}
+	}
+
+	var missing []string
+	if length < p.MinLength {
+		missing = append(missing, fmt.Sprintf("%d characters", p.MinLength))
+	}
+	if upper < p.MinUpper {
+		missing = append(missing, fmt.Sprintf("%d uppercase letters", p.MinUpper))
+	}
+	if lower < p.MinLower {
+		missing = append(missing, fmt.Sprintf("%d lowercase letters", p.MinLower))
+	}
+	if digits < p.MinDigits {
+		missing = append(missing, fmt.Sprintf("%d digits", p.MinDigits))
+	}
+	if special < p.MinSpecial {
+		missing = append(missing, fmt.Sprintf("%d special characters", p.MinSpecial))
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("password must contain at least %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
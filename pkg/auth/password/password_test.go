@@ -0,0 +1,49 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package password
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	p := &Policy{MinLength: 8, MinUpper: 1, MinLower: 1, MinDigits: 1, MinSpecial: 1}
+
+	tests := map[string]bool{
+		"":                  false,
+		"Sh0rt!":            false,
+		"nouppercase1!":     false,
+		"NOLOWERCASE1!":     false,
+		"NoDigitsHere!":     false,
+		"NoSpecial123":      false,
+		"Relativ1ty!":       true,
+		"Ünïcödé-Pässwörd9": true,
+	}
+	for pw, valid := range tests {
+		err := p.Validate(pw)
+		if valid && err != nil {
+			t.Errorf("expected %q to be valid, got %v", pw, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected %q to be rejected", pw)
+		}
+	}
+
+	if err := (&Policy{}).Validate("a"); err != nil {
+		t.Errorf("expected the zero policy to accept any password, got %v", err)
+	}
+}
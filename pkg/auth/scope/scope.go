@@ -0,0 +1,233 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package scope limits what a token can be used for. The scope is carried
+// by the user the token is minted for and enforced by the auth interceptors.
+package scope
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/golang/protobuf/proto"
+)
+
+// The scopes of the tokens.
+const (
+	// Full gives access to all the methods.
+	Full = "full"
+	// Read limits the token to the methods reading data, it is used by the
+	// read only app passwords and by impersonation.
+	Read = "read"
+	// PublicShare limits the token to serving the resources of public links,
+	// for the services acting on behalf of the owners of the links.
+	PublicShare = "publicshare"
+	// App limits the token to reading and writing files, for the
+	// applications opening a file on behalf of a user.
+	App = "app"
+	// Enroll is the scope of the users who have to enroll a second factor
+	// before they get a full token, it gives access to the enrollment
+	// only. It cannot be requested.
+	Enroll = "mfa-enroll"
+)
+
+// scopeKey is the opaque entry of the user carrying the scope. It is named
+// after the app passwords, the first scoped tokens, so that the tokens minted
+// before keep their scope.
+const scopeKey = "appauth-scope"
+
+// resourceKey is the opaque entry of the user carrying the resource the
+// token is limited to, as storage id:opaque id.
+const resourceKey = "scope-resource"
+
+// Valid tells whether s is one of the known scopes.
+func Valid(s string) bool {
+	switch s {
+	case Full, Read, PublicShare, App:
+		return true
+	}
+	return false
+}
+
+// WithScope returns a copy of the user carrying the scope in its opaque data.
+func WithScope(u *userpb.User, s string) *userpb.User {
+	u = proto.Clone(u).(*userpb.User)
+	if u.Opaque == nil {
+		u.Opaque = &types.Opaque{}
+	}
+	if u.Opaque.Map == nil {
+		u.Opaque.Map = map[string]*types.OpaqueEntry{}
+	}
+	u.Opaque.Map[scopeKey] = &types.OpaqueEntry{Decoder: "plain", Value: []byte(s)}
+	return u
+}
+
+// Get returns the scope of the user, Full if the user is not limited.
+func Get(u *userpb.User) string {
+	if u.Opaque != nil {
+		if e, ok := u.Opaque.Map[scopeKey]; ok && e.Decoder == "plain" {
+			return string(e.Value)
+		}
+	}
+	return Full
+}
+
+// WithResource returns a copy of the user limited to the resource with the
+// given id, like the applications opening a single file.
+func WithResource(u *userpb.User, id *provider.ResourceId) *userpb.User {
+	u = proto.Clone(u).(*userpb.User)
+	if u.Opaque == nil {
+		u.Opaque = &types.Opaque{}
+	}
+	if u.Opaque.Map == nil {
+		u.Opaque.Map = map[string]*types.OpaqueEntry{}
+	}
+	u.Opaque.Map[resourceKey] = &types.OpaqueEntry{Decoder: "plain", Value: []byte(id.GetStorageId() + ":" + id.GetOpaqueId())}
+	return u
+}
+
+// Resource returns the id of the resource the user is limited to, nil if
+// the user is not limited to one.
+func Resource(u *userpb.User) *provider.ResourceId {
+	if u.Opaque != nil {
+		if e, ok := u.Opaque.Map[resourceKey]; ok && e.Decoder == "plain" {
+			parts := strings.SplitN(string(e.Value), ":", 2)
+			if len(parts) == 2 {
+				return &provider.ResourceId{StorageId: parts[0], OpaqueId: parts[1]}
+			}
+			// a malformed entry must not lift the limit
+			return &provider.ResourceId{}
+		}
+	}
+	return nil
+}
+
+// AllowsRequest tells whether the gRPC request can be made by the user. The
+// users limited to a resource can only reference it by id, the requests not
+// referencing any resource, like WhoAmI, are left to the scope.
+func AllowsRequest(u *userpb.User, req interface{}) bool {
+	id := Resource(u)
+	if id == nil {
+		return true
+	}
+	var target *provider.ResourceId
+	switch r := req.(type) {
+	case interface{ GetRef() *provider.Reference }:
+		target = r.GetRef().GetId()
+	case interface{ GetResourceId() *provider.ResourceId }:
+		target = r.GetResourceId()
+	default:
+		return true
+	}
+	return target != nil && id.OpaqueId != "" && target.StorageId == id.StorageId && target.OpaqueId == id.OpaqueId
+}
+
+// Narrow returns the scope of a token requested with the given scope by a
+// user authenticated with the current one. A scope can only be narrowed
+// from Full, never widened nor swapped for another one.
+func Narrow(current, requested string) (string, error) {
+	switch {
+	case requested == "" || requested == current:
+		return current, nil
+	case !Valid(requested):
+		return "", fmt.Errorf("scope: unknown scope %q", requested)
+	case current == Full:
+		return requested, nil
+	}
+	return "", fmt.Errorf("scope: a %s token cannot be turned into a %s one", current, requested)
+}
+
+// common are the methods allowed with any scope. CreateHome is called by
+// the gateway on login.
+var common = []string{"WhoAmI", "CreateHome"}
+
+// readPrefixes are the prefixes of the methods reading data.
+var readPrefixes = []string{"Get", "List", "Stat", "Find", "Is", "InitiateFileDownload"}
+
+// methods are the methods allowed with the scopes limited to a few of them.
+var methods = map[string][]string{
+	PublicShare: {"GetPublicShareByToken", "Stat", "ListContainer", "ListContainerStream", "GetPath", "InitiateFileDownload", "InitiateFileUpload", "CreateContainer"},
+	App:         {"Stat", "GetPath", "GetUser", "InitiateFileDownload", "InitiateFileUpload", "SetArbitraryMetadata", "UnsetArbitraryMetadata"},
+}
+
+// AllowsMethod tells whether the gRPC method, given as
+// /package.Service/Method, can be called with a token of the scope.
+func AllowsMethod(s, fullMethod string) bool {
+	if s == Full {
+		return true
+	}
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, m := range common {
+		if method == m {
+			return true
+		}
+	}
+	switch s {
+	case Read:
+		for _, p := range readPrefixes {
+			if strings.HasPrefix(method, p) {
+				return true
+			}
+		}
+	case PublicShare, App:
+		for _, m := range methods[s] {
+			if method == m {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readHTTPMethods are the HTTP methods that do not modify any data.
+var readHTTPMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+	"REPORT":           true,
+}
+
+// transferHTTPMethods are the HTTP methods of the data transfers, including
+// the POST creating a tus upload.
+var transferHTTPMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodPost:    true,
+}
+
+// AllowsHTTPMethod tells whether an HTTP request with the method can be
+// made with a token of the scope.
+func AllowsHTTPMethod(s, method string) bool {
+	switch s {
+	case Full:
+		return true
+	case Read:
+		return readHTTPMethods[method]
+	case PublicShare, App:
+		return transferHTTPMethods[method]
+	}
+	return false
+}
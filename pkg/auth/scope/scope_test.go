@@ -0,0 +1,133 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package scope
+
+import (
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+func TestAllowsMethod(t *testing.T) {
+	tests := []struct {
+		scope, method string
+		allowed       bool
+	}{
+		{Full, "/cs3.gateway.v1beta1.GatewayAPI/CreateShare", true},
+		{Read, "/cs3.gateway.v1beta1.GatewayAPI/ListContainer", true},
+		{Read, "/cs3.gateway.v1beta1.GatewayAPI/CreateHome", true},
+		{Read, "/cs3.gateway.v1beta1.GatewayAPI/Delete", false},
+		{PublicShare, "/cs3.gateway.v1beta1.GatewayAPI/InitiateFileUpload", true},
+		{PublicShare, "/cs3.gateway.v1beta1.GatewayAPI/ListShares", false},
+		{PublicShare, "/cs3.gateway.v1beta1.GatewayAPI/GetUser", false},
+		{App, "/cs3.storage.provider.v1beta1.ProviderAPI/Stat", true},
+		{App, "/cs3.gateway.v1beta1.GatewayAPI/CreatePublicShare", false},
+		{Enroll, "/cs3.gateway.v1beta1.GatewayAPI/WhoAmI", true},
+		{Enroll, "/cs3.gateway.v1beta1.GatewayAPI/Stat", false},
+		{"unknown", "/cs3.gateway.v1beta1.GatewayAPI/Stat", false},
+	}
+	for _, tt := range tests {
+		if got := AllowsMethod(tt.scope, tt.method); got != tt.allowed {
+			t.Errorf("AllowsMethod(%q, %q) = %v, expected %v", tt.scope, tt.method, got, tt.allowed)
+		}
+	}
+}
+
+func TestNarrow(t *testing.T) {
+	tests := []struct {
+		current, requested, expected string
+		ok                           bool
+	}{
+		{Full, "", Full, true},
+		{Full, PublicShare, PublicShare, true},
+		{Read, Read, Read, true},
+		{Read, "", Read, true},
+		{Read, Full, "", false},
+		{Read, App, "", false},
+		{Full, "admin", "", false},
+	}
+	for _, tt := range tests {
+		got, err := Narrow(tt.current, tt.requested)
+		if (err == nil) != tt.ok || got != tt.expected {
+			t.Errorf("Narrow(%q, %q) = %q, %v", tt.current, tt.requested, got, err)
+		}
+	}
+}
+
+func TestWithScope(t *testing.T) {
+	u := &userpb.User{Username: "einstein"}
+	if s := Get(u); s != Full {
+		t.Errorf("expected the full scope by default, got %q", s)
+	}
+	scoped := WithScope(u, App)
+	if s := Get(scoped); s != App {
+		t.Errorf("expected the app scope, got %q", s)
+	}
+	if u.Opaque != nil {
+		t.Error("WithScope modified the original user")
+	}
+}
+
+func TestWithResource(t *testing.T) {
+	u := &userpb.User{Username: "einstein"}
+	id := &provider.ResourceId{StorageId: "home", OpaqueId: "file"}
+	other := &provider.ResourceId{StorageId: "home", OpaqueId: "other"}
+	byID := func(id *provider.ResourceId) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Id{Id: id}}
+	}
+
+	if !AllowsRequest(u, &provider.StatRequest{Ref: byID(other)}) {
+		t.Error("a user not limited to a resource was limited")
+	}
+
+	limited := WithResource(WithScope(u, App), id)
+	if u.Opaque != nil {
+		t.Error("WithResource modified the original user")
+	}
+	if r := Resource(limited); r == nil || r.StorageId != "home" || r.OpaqueId != "file" {
+		t.Errorf("Resource() = %v", r)
+	}
+
+	tests := []struct {
+		name    string
+		req     interface{}
+		allowed bool
+	}{
+		{"stat of the resource", &provider.StatRequest{Ref: byID(id)}, true},
+		{"download of the resource", &provider.InitiateFileDownloadRequest{Ref: byID(id)}, true},
+		{"path of the resource", &provider.GetPathRequest{ResourceId: id}, true},
+		{"stat of another resource", &provider.StatRequest{Ref: byID(other)}, false},
+		{"upload to another resource", &provider.InitiateFileUploadRequest{Ref: byID(other)}, false},
+		{"reference by path", &provider.StatRequest{Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: "/home/file"}}}, false},
+		{"no reference", &provider.StatRequest{}, false},
+		{"no resource", &userpb.GetUserRequest{}, true},
+	}
+	for _, tt := range tests {
+		if got := AllowsRequest(limited, tt.req); got != tt.allowed {
+			t.Errorf("AllowsRequest(%s) = %v, expected %v", tt.name, got, tt.allowed)
+		}
+	}
+
+	// a token limited to a resource without id can not reach any
+	none := WithResource(u, nil)
+	if AllowsRequest(none, &provider.StatRequest{Ref: byID(&provider.ResourceId{})}) {
+		t.Error("a token limited to a resource without id was allowed")
+	}
+}
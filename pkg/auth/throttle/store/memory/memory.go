@@ -0,0 +1,94 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/auth/throttle/store"
+	"github.com/cs3org/reva/pkg/auth/throttle/store/registry"
+)
+
+func init() {
+	registry.Register("memory", New)
+}
+
+type entry struct {
+	store.Record
+	expires time.Time
+}
+
+type memory struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// New returns a store keeping the failed attempts in memory, they are lost
+// when revad restarts and not shared between instances.
+func New(m map[string]interface{}) (store.Store, error) {
+	return &memory{entries: map[string]*entry{}}, nil
+}
+
+// expire removes the expired entries, the caller must hold the mutex.
+func (s *memory) expire(now time.Time) {
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func (s *memory) Get(ctx context.Context, key string) (*store.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+
+	if e, ok := s.entries[key]; ok {
+		r := e.Record
+		return &r, nil
+	}
+	return &store.Record{}, nil
+}
+
+func (s *memory) Fail(ctx context.Context, key string, ttl time.Duration) (*store.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.expire(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{}
+		s.entries[key] = e
+	}
+	e.Failures++
+	e.Last = now
+	e.expires = now.Add(ttl)
+	r := e.Record
+	return &r, nil
+}
+
+func (s *memory) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	s, _ := New(nil)
+
+	for i := 1; i <= 2; i++ {
+		r, err := s.Fail(ctx, "key", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Failures != i {
+			t.Fatalf("expected %d failures, got %d", i, r.Failures)
+		}
+	}
+
+	if _, err := s.Fail(ctx, "expiring", time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if r, _ := s.Get(ctx, "expiring"); r.Failures != 0 {
+		t.Fatalf("expected the failures to expire, got %d", r.Failures)
+	}
+
+	if err := s.Reset(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := s.Get(ctx, "key"); r.Failures != 0 {
+		t.Fatalf("expected no failures after reset, got %d", r.Failures)
+	}
+}
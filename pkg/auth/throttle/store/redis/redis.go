@@ -0,0 +1,149 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/cs3org/reva/pkg/auth/throttle/store"
+	"github.com/cs3org/reva/pkg/auth/throttle/store/registry"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("redis", New)
+}
+
+type config struct {
+	Address  string `mapstructure:"address"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// Prefix is prepended to the keys, to share a redis between
+	// deployments.
+	Prefix string `mapstructure:"prefix"`
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *config) init() {
+	if c.Address == "" {
+		c.Address = "localhost:6379"
+	}
+	if c.Prefix == "" {
+		c.Prefix = "reva:"
+	}
+}
+
+// redisStore keeps the failed attempts of every key in a hash with the
+// number of failures and the time of the last one, expiring with them.
+type redisStore struct {
+	c    *config
+	pool *redis.Pool
+}
+
+// New returns a store keeping the failed attempts in redis, so they are
+// shared by all the revad instances.
+func New(m map[string]interface{}) (store.Store, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.init()
+
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+
+		Dial: func() (redis.Conn, error) {
+			opts := []redis.DialOption{redis.DialDatabase(c.DB)}
+			if c.Password != "" {
+				opts = append(opts, redis.DialPassword(c.Password))
+			}
+			return redis.Dial("tcp", c.Address, opts...)
+		},
+
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+	return &redisStore{c: c, pool: pool}, nil
+}
+
+func (s *redisStore) key(k string) string {
+	return s.c.Prefix + "throttle:" + k
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (*store.Record, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.Int64Map(conn.Do("HGETALL", s.key(key)))
+	if err != nil {
+		return nil, errors.Wrap(err, "redis: error reading failed attempts")
+	}
+	r := &store.Record{Failures: int(values["failures"])}
+	if last, ok := values["last"]; ok {
+		r.Last = time.Unix(0, last)
+	}
+	return r, nil
+}
+
+func (s *redisStore) Fail(ctx context.Context, key string, ttl time.Duration) (*store.Record, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	now := time.Now()
+	k := s.key(key)
+	if err := conn.Send("MULTI"); err != nil {
+		return nil, errors.Wrap(err, "redis: error counting failed attempt")
+	}
+	_ = conn.Send("HINCRBY", k, "failures", 1)
+	_ = conn.Send("HSET", k, "last", now.UnixNano())
+	_ = conn.Send("PEXPIRE", k, ttl.Milliseconds())
+	res, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, errors.Wrap(err, "redis: error counting failed attempt")
+	}
+	failures, err := redis.Int(res[0], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "redis: error counting failed attempt")
+	}
+	return &store.Record{Failures: failures, Last: now}, nil
+}
+
+func (s *redisStore) Reset(ctx context.Context, key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", s.key(key)); err != nil {
+		return errors.Wrap(err, "redis: error resetting failed attempts")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package store defines where the failed login attempts counted by the
+// throttler are kept.
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Record holds the failed attempts of a key, like a user or a client address.
+type Record struct {
+	Failures int
+	// Last is the time of the last failed attempt.
+	Last time.Time
+}
+
+// Store keeps the failed attempts.
+type Store interface {
+	// Get returns the failed attempts of the key, an empty record if there
+	// are none.
+	Get(ctx context.Context, key string) (*Record, error)
+	// Fail counts a failed attempt of the key and returns the updated
+	// record. The attempts are forgotten after ttl without failures.
+	Fail(ctx context.Context, key string, ttl time.Duration) (*Record, error)
+	// Reset forgets the failed attempts of the key.
+	Reset(ctx context.Context, key string) error
+}
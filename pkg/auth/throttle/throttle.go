@@ -0,0 +1,185 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package throttle slows down brute-force attacks on passwords by delaying
+// the logins that follow failed attempts, per user and per client address.
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cs3org/reva/pkg/auth/throttle/store"
+	"github.com/cs3org/reva/pkg/auth/throttle/store/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+type config struct {
+	Store  string                            `mapstructure:"store"`
+	Stores map[string]map[string]interface{} `mapstructure:"stores"`
+	// FreeAttempts is the number of failed attempts allowed without delay.
+	FreeAttempts int `mapstructure:"free_attempts"`
+	// BaseDelay is the delay in seconds after the first failed attempt
+	// beyond the free ones, it doubles with every further failure.
+	BaseDelay int `mapstructure:"base_delay"`
+	// MaxDelay caps the delay, in seconds.
+	MaxDelay int `mapstructure:"max_delay"`
+	// LockoutAttempts is the number of failed attempts locking the key out
+	// for LockoutDuration seconds. Zero disables the lockout.
+	LockoutAttempts int `mapstructure:"lockout_attempts"`
+	LockoutDuration int `mapstructure:"lockout_duration"`
+	// Window is the time in seconds without failures after which the failed
+	// attempts are forgotten.
+	Window int `mapstructure:"window"`
+}
+
+func (c *config) init() {
+	if c.FreeAttempts == 0 {
+		c.FreeAttempts = 3
+	}
+	if c.BaseDelay == 0 {
+		c.BaseDelay = 1
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = 300
+	}
+	if c.LockoutDuration == 0 {
+		c.LockoutDuration = 900
+	}
+	if c.Window == 0 {
+		c.Window = 3600
+	}
+}
+
+// Throttler counts the failed logins and computes how long the next attempt
+// has to wait. A nil Throttler does not throttle anything.
+type Throttler struct {
+	c     *config
+	store store.Store
+	now   func() time.Time
+}
+
+// New returns a throttler configured from m, or nil if no store is
+// configured.
+func New(m map[string]interface{}) (*Throttler, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "throttle: error decoding conf")
+	}
+	if c.Store == "" {
+		return nil, nil
+	}
+	c.init()
+
+	f, ok := registry.NewFuncs[c.Store]
+	if !ok {
+		return nil, fmt.Errorf("throttle: store not found: %s", c.Store)
+	}
+	s, err := f(c.Stores[c.Store])
+	if err != nil {
+		return nil, errors.Wrap(err, "throttle: error creating store")
+	}
+	return &Throttler{c: c, store: s, now: time.Now}, nil
+}
+
+// UserKey returns the key counting the failed logins of a user.
+func UserKey(username string) string {
+	return "user:" + username
+}
+
+// IPKey returns the key counting the failed logins from a client address.
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// delay returns how long after the last failure the next attempt is allowed.
+func (t *Throttler) delay(failures int) time.Duration {
+	if t.c.LockoutAttempts > 0 && failures >= t.c.LockoutAttempts {
+		return time.Duration(t.c.LockoutDuration) * time.Second
+	}
+	n := failures - t.c.FreeAttempts
+	if n <= 0 {
+		return 0
+	}
+	max := time.Duration(t.c.MaxDelay) * time.Second
+	d := time.Duration(t.c.BaseDelay) * time.Second
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Wait returns how long the caller has to wait before the next login
+// attempt for keys is allowed, zero if it is allowed now.
+func (t *Throttler) Wait(ctx context.Context, keys ...string) (time.Duration, error) {
+	if t == nil {
+		return 0, nil
+	}
+	now := t.now()
+	var wait time.Duration
+	for _, k := range keys {
+		r, err := t.store.Get(ctx, k)
+		if err != nil {
+			return 0, err
+		}
+		d := t.delay(r.Failures)
+		if d == 0 {
+			continue
+		}
+		if w := r.Last.Add(d).Sub(now); w > wait {
+			wait = w
+		}
+	}
+	return wait, nil
+}
+
+// Fail counts a failed login attempt for keys.
+func (t *Throttler) Fail(ctx context.Context, keys ...string) error {
+	if t == nil {
+		return nil
+	}
+	ttl := time.Duration(t.c.Window) * time.Second
+	if t.c.LockoutAttempts > 0 && t.c.LockoutDuration > t.c.Window {
+		ttl = time.Duration(t.c.LockoutDuration) * time.Second
+	}
+	for _, k := range keys {
+		if _, err := t.store.Fail(ctx, k, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset forgets the failed login attempts of keys, after a successful login
+// or to unlock an account.
+func (t *Throttler) Reset(ctx context.Context, keys ...string) error {
+	if t == nil {
+		return nil
+	}
+	for _, k := range keys {
+		if err := t.store.Reset(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	_ "github.com/cs3org/reva/pkg/auth/throttle/store/memory"
+)
+
+func TestNilThrottler(t *testing.T) {
+	th, err := New(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th != nil {
+		t.Fatal("expected a nil throttler without store")
+	}
+	if err := th.Fail(context.Background(), UserKey("einstein")); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := th.Wait(context.Background(), UserKey("einstein")); err != nil || w != 0 {
+		t.Fatalf("expected no wait, got %v, %v", w, err)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	th, err := New(map[string]interface{}{
+		"store":            "memory",
+		"free_attempts":    2,
+		"base_delay":       1,
+		"max_delay":        5,
+		"lockout_attempts": 8,
+		"lockout_duration": 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for failures, expected := range map[int]time.Duration{
+		0: 0,
+		2: 0,
+		3: time.Second,
+		4: 2 * time.Second,
+		5: 4 * time.Second,
+		6: 5 * time.Second,
+		8: time.Minute,
+	} {
+		if d := th.delay(failures); d != expected {
+			t.Errorf("delay(%d): expected %v, got %v", failures, expected, d)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	th, err := New(map[string]interface{}{
+		"store":         "memory",
+		"free_attempts": 1,
+		"base_delay":    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, ip := UserKey("einstein"), IPKey("10.0.0.1")
+	if err := th.Fail(ctx, user, ip); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := th.Wait(ctx, user, ip); w != 0 {
+		t.Fatalf("expected a free attempt, got a wait of %v", w)
+	}
+
+	if err := th.Fail(ctx, ip); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	th.now = func() time.Time { return now }
+	if w, _ := th.Wait(ctx, user); w != 0 {
+		t.Fatalf("expected the user not to wait, got %v", w)
+	}
+	if w, _ := th.Wait(ctx, user, ip); w <= 0 || w > 10*time.Second {
+		t.Fatalf("expected a wait up to 10s, got %v", w)
+	}
+
+	th.now = func() time.Time { return now.Add(11 * time.Second) }
+	if w, _ := th.Wait(ctx, user, ip); w != 0 {
+		t.Fatalf("expected no wait after the delay, got %v", w)
+	}
+
+	th.now = func() time.Time { return now }
+	if err := th.Reset(ctx, ip); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := th.Wait(ctx, user, ip); w != 0 {
+		t.Fatalf("expected no wait after reset, got %v", w)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package discovery registers the grpc services of revad in a service
+// registry and resolves their logical names to the addresses of the healthy
+// instances, so that services can be addressed as discovery:///<name>
+// instead of with static addresses.
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Service is an instance of a service in the registry.
+type Service struct {
+	// ID identifies the instance in the registry.
+	ID string
+	// Name is the logical name the clients resolve, e.g. gateway.
+	Name string
+	// Address is the host:port the instance is reachable at.
+	Address string
+	Tags    []string
+}
+
+// Registry is the interface that service registries implement.
+type Registry interface {
+	// Register adds the instance to the registry, with a health check of its
+	// address. Registering an instance again updates it.
+	Register(ctx context.Context, s *Service) error
+	// Deregister removes the instance with the given id.
+	Deregister(ctx context.Context, id string) error
+	// Resolve returns the addresses of the healthy instances of the service.
+	Resolve(ctx context.Context, name string) ([]string, error)
+}
+
+var (
+	mu              sync.RWMutex
+	registry        Registry
+	resolveInterval = 10 * time.Second
+)
+
+// Init sets the registry the grpc services register to and the
+// discovery:/// endpoints are resolved with, and the interval at which the
+// addresses of a service are resolved again. It must be called before the
+// first connection is made.
+func Init(r Registry, interval time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry = r
+	if interval > 0 {
+		resolveInterval = interval
+	}
+}
+
+// GetRegistry returns the configured registry, nil if there is none.
+func GetRegistry() Registry {
+	mu.RLock()
+	defer mu.RUnlock()
+	return registry
+}
+
+func get() (Registry, time.Duration) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return registry, resolveInterval
+}
@@ -0,0 +1,157 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/cs3org/reva/pkg/discovery"
+	"github.com/cs3org/reva/pkg/discovery/registry/registry"
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("consul", New)
+}
+
+type config struct {
+	// Address is the address of the consul agent.
+	Address    string `mapstructure:"address"`
+	Scheme     string `mapstructure:"scheme"`
+	Token      string `mapstructure:"token"`
+	Datacenter string `mapstructure:"datacenter"`
+	// Tags are added to the registered services.
+	Tags []string `mapstructure:"tags"`
+	// CheckInterval is the time in seconds between the health checks of
+	// the registered services.
+	CheckInterval int `mapstructure:"check_interval"`
+	// DeregisterAfter is the time in seconds after which services failing
+	// their health check are removed, e.g. when revad was killed.
+	DeregisterAfter int `mapstructure:"deregister_after"`
+}
+
+func (c *config) init() {
+	if c.Address == "" {
+		c.Address = "localhost:8500"
+	}
+	if c.Scheme == "" {
+		c.Scheme = "http"
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = 10
+	}
+	if c.DeregisterAfter <= 0 {
+		c.DeregisterAfter = 60
+	}
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "consul: error decoding conf")
+	}
+	return c, nil
+}
+
+type reg struct {
+	c      *config
+	client *api.Client
+}
+
+// New returns a service registry backed by consul. The services are
+// registered to the local consul agent with a tcp health check of their
+// address and resolved to the instances passing their checks.
+func New(m map[string]interface{}) (discovery.Registry, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.init()
+
+	client, err := api.NewClient(&api.Config{
+		Address:    c.Address,
+		Scheme:     c.Scheme,
+		Token:      c.Token,
+		Datacenter: c.Datacenter,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "consul: error creating client")
+	}
+	return &reg{c: c, client: client}, nil
+}
+
+func (r *reg) Register(ctx context.Context, s *discovery.Service) error {
+	host, p, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		return errors.Wrap(err, "consul: error parsing address of service "+s.Name)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return errors.Wrap(err, "consul: error parsing port of service "+s.Name)
+	}
+
+	svc := &api.AgentServiceRegistration{
+		ID:      s.ID,
+		Name:    s.Name,
+		Tags:    append(append([]string(nil), r.c.Tags...), s.Tags...),
+		Address: host,
+		Port:    port,
+		Check: &api.AgentServiceCheck{
+			TCP:                            s.Address,
+			Interval:                       fmt.Sprintf("%ds", r.c.CheckInterval),
+			Timeout:                        fmt.Sprintf("%ds", r.c.CheckInterval),
+			DeregisterCriticalServiceAfter: fmt.Sprintf("%ds", r.c.DeregisterAfter),
+		},
+	}
+	if err := r.client.Agent().ServiceRegisterOpts(svc, api.ServiceRegisterOpts{}.WithContext(ctx)); err != nil {
+		return errors.Wrap(err, "consul: error registering service "+s.Name)
+	}
+	return nil
+}
+
+func (r *reg) Deregister(ctx context.Context, id string) error {
+	q := (&api.QueryOptions{}).WithContext(ctx)
+	if err := r.client.Agent().ServiceDeregisterOpts(id, q); err != nil {
+		return errors.Wrap(err, "consul: error deregistering service "+id)
+	}
+	return nil
+}
+
+func (r *reg) Resolve(ctx context.Context, name string) ([]string, error) {
+	q := (&api.QueryOptions{}).WithContext(ctx)
+	entries, _, err := r.client.Health().Service(name, "", true, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "consul: error querying service "+name)
+	}
+
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	return addrs, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/discovery"
+	"github.com/hashicorp/consul/api"
+)
+
+func newTestRegistry(t *testing.T, h http.HandlerFunc) discovery.Registry {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	r, err := New(map[string]interface{}{
+		"address": strings.TrimPrefix(srv.URL, "http://"),
+		"tags":    []string{"reva"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRegister(t *testing.T) {
+	var got api.AgentServiceRegistration
+	r := newTestRegistry(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/agent/service/register" {
+			t.Errorf("unexpected request to %s", req.URL.Path)
+		}
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	})
+
+	err := r.Register(context.Background(), &discovery.Service{ID: "gateway-host:9142", Name: "gateway", Address: "host:9142"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "gateway-host:9142" || got.Name != "gateway" || got.Address != "host" || got.Port != 9142 {
+		t.Errorf("unexpected registration %+v", got)
+	}
+	if !reflect.DeepEqual(got.Tags, []string{"reva"}) {
+		t.Errorf("tags = %v", got.Tags)
+	}
+	if got.Check == nil || got.Check.TCP != "host:9142" || got.Check.Interval != "10s" || got.Check.DeregisterCriticalServiceAfter != "60s" {
+		t.Errorf("unexpected check %+v", got.Check)
+	}
+
+	if err := r.Register(context.Background(), &discovery.Service{Name: "gateway", Address: "host"}); err == nil {
+		t.Error("expected an error for an address without port")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := newTestRegistry(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/health/service/gateway" || req.URL.Query().Get("passing") != "1" {
+			t.Errorf("unexpected request to %s", req.URL)
+		}
+		_ = json.NewEncoder(w).Encode([]*api.ServiceEntry{
+			{Node: &api.Node{Address: "10.0.0.1"}, Service: &api.AgentService{Address: "host", Port: 9142}},
+			{Node: &api.Node{Address: "10.0.0.2"}, Service: &api.AgentService{Port: 9142}},
+		})
+	})
+
+	addrs, err := r.Resolve(context.Background(), "gateway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"host:9142", "10.0.0.2:9142"}; !reflect.DeepEqual(addrs, want) {
+		t.Errorf("addresses = %v, want %v", addrs, want)
+	}
+}
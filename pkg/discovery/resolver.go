@@ -0,0 +1,150 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package discovery
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the scheme of the grpc targets resolved with the registry.
+const Scheme = "discovery"
+
+// the connections to the instances of a service are balanced round robin.
+const serviceConfig = `{"loadBalancingConfig": [{"round_robin": {}}]}`
+
+func init() {
+	resolver.Register(builder{})
+}
+
+type builder struct{}
+
+func (builder) Scheme() string { return Scheme }
+
+func (builder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	reg, interval := get()
+	if reg == nil {
+		return nil, errors.New("discovery: no service registry configured")
+	}
+	name := target.Endpoint()
+	if name == "" {
+		return nil, errors.New("discovery: missing service name in target")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &serviceResolver{
+		name:     name,
+		reg:      reg,
+		cc:       cc,
+		interval: interval,
+		cancel:   cancel,
+		now:      make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go r.watch(ctx)
+	return r, nil
+}
+
+// serviceResolver resolves a service periodically and whenever grpc asks
+// for it, e.g. after losing a connection.
+type serviceResolver struct {
+	name     string
+	reg      Registry
+	cc       resolver.ClientConn
+	interval time.Duration
+	cancel   context.CancelFunc
+	now      chan struct{}
+	done     chan struct{}
+}
+
+func (r *serviceResolver) watch(ctx context.Context) {
+	defer close(r.done)
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+
+	var last []string
+	for {
+		addrs, err := r.resolve(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			r.cc.ReportError(err)
+			last = nil
+		case !equal(addrs, last):
+			state := resolver.State{ServiceConfig: r.cc.ParseServiceConfig(serviceConfig)}
+			for _, a := range addrs {
+				state.Addresses = append(state.Addresses, resolver.Address{Addr: a})
+			}
+			if err := r.cc.UpdateState(state); err == nil {
+				last = addrs
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-r.now:
+		}
+	}
+}
+
+func (r *serviceResolver) resolve(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.interval)
+	defer cancel()
+	addrs, err := r.reg.Resolve(ctx, r.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "discovery: error resolving service %s", r.name)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.Errorf("discovery: no healthy instance of service %s", r.name)
+	}
+	addrs = append([]string(nil), addrs...)
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+func (r *serviceResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *serviceResolver) Close() {
+	r.cancel()
+	<-r.done
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+type fakeRegistry struct {
+	mu    sync.Mutex
+	addrs map[string][]string
+	err   error
+}
+
+func (r *fakeRegistry) Register(ctx context.Context, s *Service) error { return nil }
+
+func (r *fakeRegistry) Deregister(ctx context.Context, id string) error { return nil }
+
+func (r *fakeRegistry) Resolve(ctx context.Context, name string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addrs[name], r.err
+}
+
+func (r *fakeRegistry) set(name string, addrs []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addrs[name] = addrs
+	r.err = err
+}
+
+type fakeClientConn struct {
+	resolver.ClientConn
+	states chan []string
+	errs   chan error
+}
+
+func (cc *fakeClientConn) UpdateState(s resolver.State) error {
+	var addrs []string
+	for _, a := range s.Addresses {
+		addrs = append(addrs, a.Addr)
+	}
+	cc.states <- addrs
+	return nil
+}
+
+func (cc *fakeClientConn) ReportError(err error) {
+	cc.errs <- err
+}
+
+func (cc *fakeClientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return nil
+}
+
+func TestResolver(t *testing.T) {
+	reg := &fakeRegistry{addrs: map[string][]string{"gateway": {"b:9142", "a:9142"}}}
+	Init(reg, time.Hour)
+	defer Init(nil, 0)
+
+	cc := &fakeClientConn{states: make(chan []string, 10), errs: make(chan error, 10)}
+	target := resolver.Target{URL: url.URL{Scheme: Scheme, Path: "/gateway"}}
+	r, err := builder{}.Build(target, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if got := <-cc.states; !reflect.DeepEqual(got, []string{"a:9142", "b:9142"}) {
+		t.Errorf("addresses = %v", got)
+	}
+
+	reg.set("gateway", nil, errors.New("unreachable"))
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	<-cc.errs
+
+	reg.set("gateway", []string{"a:9142"}, nil)
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	if got := <-cc.states; !reflect.DeepEqual(got, []string{"a:9142"}) {
+		t.Errorf("addresses = %v", got)
+	}
+
+	reg.set("gateway", nil, nil)
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	<-cc.errs
+}
+
+func TestBuildWithoutRegistry(t *testing.T) {
+	target := resolver.Target{URL: url.URL{Scheme: Scheme, Path: "/gateway"}}
+	if _, err := (builder{}).Build(target, &fakeClientConn{}, resolver.BuildOptions{}); err == nil {
+		t.Error("expected an error without registry")
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
 	gouser "os/user"
@@ -35,9 +36,9 @@ import (
 	"github.com/cs3org/reva/pkg/appctx"
 	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/storage/acl"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
-	"go.opencensus.io/trace"
 )
 
 const (
@@ -111,6 +112,12 @@ type Options struct {
 	// Default is root://eos-example.org
 	URL string
 
+	// HTTPURL is the URL of the HTTP endpoint of the EOS MGM, like
+	// https://eos-example.org:8443. When set, the files are streamed from
+	// and to it instead of being copied with xrdcopy through the cache
+	// directory, the other operations keep using the eos binary.
+	HTTPURL string
+
 	// Location on the local fs where to store reads.
 	// Defaults to os.TempDir()
 	CacheDirectory string
@@ -148,7 +155,8 @@ func (opt *Options) init() {
 // Client performs actions against a EOS management node (MGM).
 // It requires the eos-client and xrootd-client packages installed to work.
 type Client struct {
-	opt *Options
+	opt        *Options
+	httpClient *http.Client
 }
 
 // New creates a new client with the given options.
@@ -156,9 +164,19 @@ func New(opt *Options) *Client {
 	opt.init()
 	c := new(Client)
 	c.opt = opt
+	if opt.HTTPURL != "" {
+		c.httpClient = newHTTPClient()
+	}
 	return c
 }
 
+// Close releases the connections kept to the MGM.
+func (c *Client) Close() {
+	if c.httpClient != nil {
+		c.httpClient.CloseIdleConnections()
+	}
+}
+
 func (c *Client) getUnixUser(username string) (*gouser.User, error) {
 	if c.opt.ForceSingleUserMode {
 		username = c.opt.SingleUsername
@@ -227,7 +245,7 @@ func (c *Client) executeEOS(ctx context.Context, cmd *exec.Cmd) (string, string,
 	cmd.Env = []string{
 		"EOS_MGM_URL=" + c.opt.URL,
 	}
-	trace := trace.FromContext(ctx).SpanContext().TraceID.String()
+	trace := trace.GetTraceID(ctx)
 	cmd.Args = append(cmd.Args, "--comment", trace)
 
 	err := cmd.Run()
@@ -264,22 +282,21 @@ func (c *Client) executeEOS(ctx context.Context, cmd *exec.Cmd) (string, string,
 	return outBuf.String(), errBuf.String(), err
 }
 
-// AddACL adds an new acl to EOS with the given aclType.
-func (c *Client) AddACL(ctx context.Context, username, path string, a *acl.Entry) error {
+// AddACL adds an new acl to EOS with the given aclType. A recursive acl is set
+// on the content of the folder too.
+func (c *Client) AddACL(ctx context.Context, username, path string, a *acl.Entry, recursive bool) error {
 	acls, err := c.getACLForPath(ctx, username, path)
 	if err != nil {
 		return err
 	}
 
-	// since EOS Citrine ACLs are is stored with uid, we need to convert username to uid
-	// only for users.
-	if a.Type == acl.TypeUser {
-		a.Qualifier, err = getUID(a.Qualifier)
-		if err != nil {
-			return err
-		}
+	// since EOS Citrine ACLs are is stored with uid and gid, we need to convert
+	// the qualifier to an id.
+	qualifier, err := getQualifierID(a.Type, a.Qualifier)
+	if err != nil {
+		return err
 	}
-	err = acls.SetEntry(a.Type, a.Qualifier, a.Permissions)
+	err = acls.SetEntry(a.Type, qualifier, a.Permissions)
 	if err != nil {
 		return err
 	}
@@ -291,7 +308,12 @@ func (c *Client) AddACL(ctx context.Context, username, path string, a *acl.Entry
 		return err
 	}
 
-	cmd := exec.CommandContext(ctx, c.opt.EosBinary, "-r", unixUser.Uid, unixUser.Gid, "attr", "-r", "set", fmt.Sprintf("sys.acl=%s", sysACL), path)
+	args := []string{"-r", unixUser.Uid, unixUser.Gid, "attr"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, "set", fmt.Sprintf("sys.acl=%s", sysACL), path)
+	cmd := exec.CommandContext(ctx, c.opt.EosBinary, args...)
 	_, _, err = c.executeEOS(ctx, cmd)
 	return err
 
@@ -304,12 +326,11 @@ func (c *Client) RemoveACL(ctx context.Context, username, path string, aclType s
 		return err
 	}
 
-	// since EOS Citrine ACLs are stored with uid, we need to convert username to uid
-	if aclType == acl.TypeUser {
-		recipient, err = getUID(recipient)
-		if err != nil {
-			return err
-		}
+	// since EOS Citrine ACLs are stored with uid and gid, we need to convert
+	// the recipient to an id.
+	recipient, err = getQualifierID(aclType, recipient)
+	if err != nil {
+		return err
 	}
 	acls.DeleteEntry(aclType, recipient)
 	sysACL := acls.Serialize()
@@ -327,8 +348,8 @@ func (c *Client) RemoveACL(ctx context.Context, username, path string, aclType s
 }
 
 // UpdateACL updates the EOS acl.
-func (c *Client) UpdateACL(ctx context.Context, username, path string, a *acl.Entry) error {
-	return c.AddACL(ctx, username, path, a)
+func (c *Client) UpdateACL(ctx context.Context, username, path string, a *acl.Entry, recursive bool) error {
+	return c.AddACL(ctx, username, path, a, recursive)
 }
 
 // GetACL for a file
@@ -362,6 +383,47 @@ func getUID(username string) (string, error) {
 	return user.Uid, nil
 }
 
+func getGroupname(gid string) (string, error) {
+	group, err := gouser.LookupGroupId(gid)
+	if err != nil {
+		return "", err
+	}
+	return group.Name, nil
+}
+
+func getGID(groupname string) (string, error) {
+	group, err := gouser.LookupGroup(groupname)
+	if err != nil {
+		return "", err
+	}
+	return group.Gid, nil
+}
+
+// getQualifierID returns the uid or gid of the qualifier of an acl entry,
+// other qualifiers are returned as they are.
+func getQualifierID(aclType, qualifier string) (string, error) {
+	switch aclType {
+	case acl.TypeUser:
+		return getUID(qualifier)
+	case acl.TypeGroup:
+		return getGID(qualifier)
+	default:
+		return qualifier, nil
+	}
+}
+
+// getQualifierName is the reverse of getQualifierID.
+func getQualifierName(aclType, qualifier string) (string, error) {
+	switch aclType {
+	case acl.TypeUser:
+		return getUsername(qualifier)
+	case acl.TypeGroup:
+		return getGroupname(qualifier)
+	default:
+		return qualifier, nil
+	}
+}
+
 // ListACLs returns the list of ACLs present under the given path.
 // EOS returns uids/gid for Citrine version and usernames for older versions.
 // For Citire we need to convert back the uid back to username.
@@ -375,9 +437,8 @@ func (c *Client) ListACLs(ctx context.Context, username, path string) ([]*acl.En
 
 	acls := []*acl.Entry{}
 	for _, acl := range parsedACLs.Entries {
-		// since EOS Citrine ACLs are is stored with uid, we need to convert uid to userame
-		// TODO map group names as well if acl.Type == "g" ...
-		acl.Qualifier, err = getUsername(acl.Qualifier)
+		// since EOS Citrine ACLs are is stored with uid and gid, we need to convert them back to names
+		acl.Qualifier, err = getQualifierName(acl.Type, acl.Qualifier)
 		if err != nil {
 			log.Warn().Err(err).Str("path", path).Str("username", username).Str("qualifier", acl.Qualifier).Msg("cannot map qualifier to name")
 			continue
@@ -574,6 +635,9 @@ func (c *Client) Read(ctx context.Context, username, path string) (io.ReadCloser
 	if err != nil {
 		return nil, err
 	}
+	if c.opt.HTTPURL != "" {
+		return c.httpRead(ctx, unixUser.Uid, unixUser.Gid, path)
+	}
 	uuid := uuid.Must(uuid.NewV4())
 	rand := "eosread-" + uuid.String()
 	localTarget := fmt.Sprintf("%s/%s", c.opt.CacheDirectory, rand)
@@ -592,6 +656,9 @@ func (c *Client) Write(ctx context.Context, username, path string, stream io.Rea
 	if err != nil {
 		return err
 	}
+	if c.opt.HTTPURL != "" {
+		return c.httpWrite(ctx, unixUser.Uid, unixUser.Gid, path, stream)
+	}
 	fd, err := ioutil.TempFile(c.opt.CacheDirectory, "eoswrite-")
 	if err != nil {
 		return err
@@ -0,0 +1,125 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package eosclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+)
+
+// newHTTPClient returns the client streaming the files from and to the
+// HTTP endpoint of the MGM. Its connections are reused across requests, the
+// redirections of the MGM to the FSTs are followed by hand.
+func newHTTPClient() *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 64
+	// the MGM answers uploads with a redirection before reading the body
+	t.ExpectContinueTimeout = 10 * time.Second
+	return &http.Client{
+		Transport: t,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// httpURL returns the URL of the file on the MGM, accessed with the role
+// of the user like xrdcopy does.
+func (c *Client) httpURL(uid, gid, path string) string {
+	q := url.Values{}
+	q.Set("eos.ruid", uid)
+	q.Set("eos.rgid", gid)
+	return strings.TrimSuffix(c.opt.HTTPURL, "/") + (&url.URL{Path: path}).EscapedPath() + "?" + q.Encode()
+}
+
+// httpDo sends the request to the MGM and follows its redirection to the FST,
+// sending the body obtained from body, if not nil, only to the FST.
+func (c *Client) httpDo(ctx context.Context, method, u string, body io.Reader) (*http.Response, error) {
+	log := appctx.GetLogger(ctx)
+
+	for hops := 0; hops < 10; hops++ {
+		req, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "eosclient: error creating request")
+		}
+		req = req.WithContext(ctx)
+		if body != nil {
+			// the transport closes the body, which belongs to the caller
+			req.Body = ioutil.NopCloser(body)
+			req.Header.Set("Expect", "100-continue")
+		}
+
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "eosclient: error sending %s request", method)
+		}
+		log.Debug().Str("method", method).Str("url", u).Int("status", res.StatusCode).Msg("eos http request")
+
+		switch res.StatusCode {
+		case http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			res.Body.Close()
+			loc, err := res.Location()
+			if err != nil {
+				return nil, errors.Wrap(err, "eosclient: invalid redirection")
+			}
+			u = loc.String()
+			continue
+		case http.StatusNotFound:
+			res.Body.Close()
+			return nil, errtypes.NotFound(u)
+		case http.StatusForbidden, http.StatusUnauthorized:
+			res.Body.Close()
+			return nil, errtypes.PermissionDenied(u)
+		}
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			res.Body.Close()
+			return nil, fmt.Errorf("eosclient: %s %s answered %s", method, u, res.Status)
+		}
+		return res, nil
+	}
+	return nil, errors.New("eosclient: too many redirections for " + u)
+}
+
+// httpRead streams the file from the HTTP endpoint of the MGM.
+func (c *Client) httpRead(ctx context.Context, uid, gid, path string) (io.ReadCloser, error) {
+	res, err := c.httpDo(ctx, http.MethodGet, c.httpURL(uid, gid, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// httpWrite streams the file to the HTTP endpoint of the MGM.
+func (c *Client) httpWrite(ctx context.Context, uid, gid, path string, stream io.Reader) error {
+	res, err := c.httpDo(ctx, http.MethodPut, c.httpURL(uid, gid, path), stream)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
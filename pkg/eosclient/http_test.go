@@ -0,0 +1,83 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package eosclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPStreaming(t *testing.T) {
+	var stored string
+	fst := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write([]byte(stored))
+		case http.MethodPut:
+			data, _ := ioutil.ReadAll(r.Body)
+			stored = string(data)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer fst.Close()
+
+	mgm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/eos/user/e/einstein/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("eos.ruid") != "1000" || r.URL.Query().Get("eos.rgid") != "100" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.Redirect(w, r, fst.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer mgm.Close()
+
+	c := New(&Options{HTTPURL: mgm.URL})
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.httpWrite(ctx, "1000", "100", "/eos/user/e/einstein/file.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if stored != "hello" {
+		t.Fatalf("expected the FST to store the content, got %q", stored)
+	}
+
+	r, err := c.httpRead(ctx, "1000", "100", "/eos/user/e/einstein/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := ioutil.ReadAll(r); string(data) != "hello" {
+		t.Errorf("read %q, expected hello", data)
+	}
+
+	if _, err := c.httpRead(ctx, "1000", "100", "/eos/user/e/einstein/missing"); err == nil {
+		t.Error("expected reading a missing file to fail")
+	}
+	if _, err := c.httpRead(ctx, "0", "0", "/eos/user/e/einstein/file.txt"); err == nil {
+		t.Error("expected reading with another role to fail")
+	}
+}
@@ -70,6 +70,23 @@ func (e NotSupported) Error() string { return "error: not supported: " + string(
 // IsNotSupported implements the IsNotSupported interface.
 func (e NotSupported) IsNotSupported() {}
 
+// Locked is the error to use when a resource is locked by someone else.
+type Locked string
+
+func (e Locked) Error() string { return "error: locked: " + string(e) }
+
+// IsLocked implements the IsLocked interface.
+func (e Locked) IsLocked() {}
+
+// PreconditionFailed is the error to use when a resource does not meet the
+// conditions a change was requested under, e.g. its etag changed.
+type PreconditionFailed string
+
+func (e PreconditionFailed) Error() string { return "error: precondition failed: " + string(e) }
+
+// IsPreconditionFailed implements the IsPreconditionFailed interface.
+func (e PreconditionFailed) IsPreconditionFailed() {}
+
 // IsNotFound is the interface to implement
 // to specify that an a resource is not found.
 type IsNotFound interface {
@@ -105,3 +122,15 @@ type IsNotSupported interface {
 type IsPermissionDenied interface {
 	IsPermissionDenied()
 }
+
+// IsLocked is the interface to implement
+// to specify that a resource is locked.
+type IsLocked interface {
+	IsLocked()
+}
+
+// IsPreconditionFailed is the interface to implement
+// to specify that a precondition of a change failed.
+type IsPreconditionFailed interface {
+	IsPreconditionFailed()
+}
@@ -0,0 +1,91 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package events
+
+import (
+	"context"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/google/uuid"
+)
+
+// Types of the published events.
+const (
+	TypeFileUploaded = "file_uploaded"
+	TypeFileDeleted  = "file_deleted"
+	// TypeFileRenamed tells that the resource at OldPath was moved to Path.
+	TypeFileRenamed = "file_renamed"
+	// TypeVersionRestored tells that Version of the file was restored.
+	TypeVersionRestored    = "version_restored"
+	TypeShareCreated       = "share_created"
+	TypePublicLinkAccessed = "public_link_accessed"
+	// TypeGroupMembershipChanged tells that Member was added to or removed
+	// from Group.
+	TypeGroupMembershipChanged = "group_membership_changed"
+)
+
+// Share types of the share events.
+const (
+	ShareTypeUser       = "user"
+	ShareTypePublicLink = "public_link"
+)
+
+// Event describes an operation that happened, it is published as JSON.
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// User is who triggered the event, if known.
+	User     *userpb.UserId       `json:"user,omitempty"`
+	Resource *provider.ResourceId `json:"resource,omitempty"`
+	Path     string               `json:"path,omitempty"`
+	Size     uint64               `json:"size,omitempty"`
+	// OldPath is the path of the moved resource before the move.
+	OldPath string `json:"old_path,omitempty"`
+	// Version is the key of the restored version.
+	Version string `json:"version,omitempty"`
+	// ShareID, ShareType and Grantee describe the share events. The public
+	// links are only identified by their share id, their token grants
+	// access to the resource.
+	ShareID   string            `json:"share_id,omitempty"`
+	ShareType string            `json:"share_type,omitempty"`
+	Grantee   *provider.Grantee `json:"grantee,omitempty"`
+	// Group and Member describe the membership events.
+	Group  string         `json:"group,omitempty"`
+	Member *userpb.UserId `json:"member,omitempty"`
+}
+
+// New returns an event of the given type happening now.
+func New(t string, u *userpb.UserId) *Event {
+	return &Event{
+		ID:   uuid.New().String(),
+		Type: t,
+		Time: time.Now().UTC(),
+		User: u,
+	}
+}
+
+// Publisher publishes events to a message bus.
+type Publisher interface {
+	// Publish sends the event without waiting for the subscribers.
+	Publish(ctx context.Context, e *Event) error
+	Close() error
+}
@@ -0,0 +1,91 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/events/publisher/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+func init() {
+	registry.Register("kafka", New)
+}
+
+type config struct {
+	Brokers []string `mapstructure:"brokers"`
+	Topic   string   `mapstructure:"topic"`
+}
+
+type publisher struct {
+	w *kafka.Writer
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a publisher writing the events to a Kafka topic. The events
+// are keyed by type, so that the events of a type keep their order.
+func New(m map[string]interface{}) (events.Publisher, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Brokers) == 0 {
+		c.Brokers = []string{"localhost:9092"}
+	}
+	if c.Topic == "" {
+		c.Topic = "reva-events"
+	}
+
+	w := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  c.Brokers,
+		Topic:    c.Topic,
+		Balancer: &kafka.Hash{},
+		Async:    true,
+	})
+	return &publisher{w: w}, nil
+}
+
+func (p *publisher) Publish(ctx context.Context, e *events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "kafka: error encoding event")
+	}
+	if err := p.w.WriteMessages(ctx, kafka.Message{Key: []byte(e.Type), Value: data}); err != nil {
+		return errors.Wrap(err, "kafka: error publishing event")
+	}
+	return nil
+}
+
+func (p *publisher) Close() error {
+	return p.w.Close()
+}
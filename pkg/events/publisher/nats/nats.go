@@ -0,0 +1,103 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/events/publisher/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("nats", New)
+}
+
+type config struct {
+	URL string `mapstructure:"url"`
+	// Subject is the prefix of the subjects, the events are published on
+	// <subject>.<event type>.
+	Subject  string `mapstructure:"subject"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	Token    string `mapstructure:"token"`
+}
+
+type publisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a publisher sending the events to a NATS server.
+func New(m map[string]interface{}) (events.Publisher, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.URL == "" {
+		c.URL = nats.DefaultURL
+	}
+	if c.Subject == "" {
+		c.Subject = "reva.events"
+	}
+
+	opts := []nats.Option{nats.Name("reva"), nats.MaxReconnects(-1)}
+	if c.User != "" {
+		opts = append(opts, nats.UserInfo(c.User, c.Password))
+	}
+	if c.Token != "" {
+		opts = append(opts, nats.Token(c.Token))
+	}
+	conn, err := nats.Connect(c.URL, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "nats: error connecting to "+c.URL)
+	}
+
+	return &publisher{conn: conn, subject: c.Subject}, nil
+}
+
+func (p *publisher) Publish(ctx context.Context, e *events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "nats: error encoding event")
+	}
+	if err := p.conn.Publish(p.subject+"."+e.Type, data); err != nil {
+		return errors.Wrap(err, "nats: error publishing event")
+	}
+	return nil
+}
+
+func (p *publisher) Close() error {
+	p.conn.Close()
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package nats
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/events"
+)
+
+type published struct {
+	subject string
+	data    []byte
+}
+
+// fakeNATS speaks enough of the NATS protocol to accept one connection and
+// report the published messages.
+func fakeNATS(t *testing.T, ln net.Listener, pubs chan<- published) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.1.0\",\"max_payload\":1048576}\r\n"); err != nil {
+		t.Error(err)
+		return
+	}
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			_, _ = io.WriteString(conn, "PONG\r\n")
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				t.Error(err)
+				return
+			}
+			pubs <- published{subject: fields[1], data: data[:size]}
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	pubs := make(chan published, 1)
+	go fakeNATS(t, ln, pubs)
+
+	p, err := New(map[string]interface{}{"url": "nats://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	e := events.New(events.TypeFileDeleted, nil)
+	e.Path = "/home/notes.txt"
+	if err := p.Publish(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-pubs
+	if got.subject != "reva.events.file_deleted" {
+		t.Errorf("got subject %s, expected reva.events.file_deleted", got.subject)
+	}
+	var decoded events.Event
+	if err := json.Unmarshal(got.data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != e.ID || decoded.Path != e.Path {
+		t.Errorf("got event %+v, expected %+v", decoded, e)
+	}
+}
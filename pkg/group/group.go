@@ -0,0 +1,36 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package group
+
+import (
+	"context"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+)
+
+// Manager is the interface to implement to resolve group memberships.
+type Manager interface {
+	// GetUserGroups returns the names of all the groups the user belongs to,
+	// including the ones inherited through nested groups.
+	GetUserGroups(ctx context.Context, uid *userpb.UserId) ([]string, error)
+	// GetMembers returns the users belonging to the group, directly or through nested groups.
+	GetMembers(ctx context.Context, group string) ([]*userpb.UserId, error)
+	// FindGroups returns the names of the groups matching the query.
+	FindGroups(ctx context.Context, query string) ([]string, error)
+}
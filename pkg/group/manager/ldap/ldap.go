@@ -0,0 +1,289 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ldap
+
+import (
+	"context"
+	"fmt"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/group"
+	"github.com/cs3org/reva/pkg/group/manager/registry"
+	"github.com/cs3org/reva/pkg/identity/mapping"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"gopkg.in/ldap.v2"
+)
+
+func init() {
+	registry.Register("ldap", New)
+}
+
+const (
+	// nestedNone only resolves direct memberships.
+	nestedNone = "none"
+	// nestedMemberOf follows the memberOf attribute of each group up to max_depth levels.
+	nestedMemberOf = "memberof"
+	// nestedInChain lets the server resolve the whole chain using the
+	// LDAP_MATCHING_RULE_IN_CHAIN extensible match (Active Directory only).
+	nestedInChain = "in_chain"
+
+	matchingRuleInChain = "1.2.840.113556.1.4.1941"
+)
+
+type config struct {
+	Hostname     string     `mapstructure:"hostname"`
+	Port         int        `mapstructure:"port"`
+	Insecure     bool       `mapstructure:"insecure"`
+	BaseDN       string     `mapstructure:"base_dn"`
+	UserFilter   string     `mapstructure:"userfilter"`
+	GroupFilter  string     `mapstructure:"groupfilter"`
+	BindUsername string     `mapstructure:"bind_username"`
+	BindPassword string     `mapstructure:"bind_password"`
+	Idp          string     `mapstructure:"idp"`
+	Nested       string     `mapstructure:"nested"`
+	MaxDepth     int        `mapstructure:"max_depth"`
+	PoolSize     int        `mapstructure:"pool_size"`
+	Schema       attributes `mapstructure:"schema"`
+	// Mapping maps the attributes of the members to their ids and the
+	// names of the groups, it defaults to the attributes of the schema.
+	Mapping mapping.Config `mapstructure:"mapping"`
+}
+
+type attributes struct {
+	UID      string `mapstructure:"uid"`
+	CN       string `mapstructure:"cn"`
+	Member   string `mapstructure:"member"`
+	MemberOf string `mapstructure:"memberOf"`
+}
+
+// Default attributes (Active Directory)
+var ldapDefaults = attributes{
+	UID:      "objectGUID",
+	CN:       "cn",
+	Member:   "member",
+	MemberOf: "memberOf",
+}
+
+type manager struct {
+	c      *config
+	pool   *pool
+	mapper *mapping.Mapper
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{
+		UserFilter:  "(&(objectClass=user)(objectGUID=%s))",
+		GroupFilter: "(&(objectClass=group)(cn=%s))",
+		Nested:      nestedMemberOf,
+		MaxDepth:    10,
+		PoolSize:    8,
+		Schema:      ldapDefaults,
+	}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+
+	switch c.Nested {
+	case nestedNone, nestedMemberOf, nestedInChain:
+	default:
+		return nil, fmt.Errorf("ldap: unknown nested group resolution %q", c.Nested)
+	}
+	if c.Nested == nestedNone {
+		c.MaxDepth = 1
+	}
+	if c.PoolSize < 0 {
+		c.PoolSize = 0
+	}
+	return c, nil
+}
+
+// New returns a group manager implementation that resolves
+// group memberships, including nested ones, from a LDAP server.
+func New(m map[string]interface{}) (group.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	mapper, err := mapping.New(c.Mapping, mapping.Config{
+		Idp:      c.Idp,
+		OpaqueID: mapping.Attr(c.Schema.UID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &manager{c: c, pool: newPool(c), mapper: mapper}, nil
+}
+
+func (m *manager) GetUserGroups(ctx context.Context, uid *userpb.UserId) ([]string, error) {
+	e, err := m.getEntry(m.c.BaseDN, ldap.ScopeWholeSubtree, fmt.Sprintf(m.c.UserFilter, ldap.EscapeFilter(uid.OpaqueId)), m.c.Schema.MemberOf)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, errtypes.NotFound(uid.OpaqueId)
+	}
+
+	if m.c.Nested == nestedInChain {
+		filter := fmt.Sprintf("(%s:%s:=%s)", m.c.Schema.Member, matchingRuleInChain, ldap.EscapeFilter(e.DN))
+		sr, err := m.pool.search(m.newSearch(m.c.BaseDN, ldap.ScopeWholeSubtree, filter, m.c.Schema.CN))
+		if err != nil {
+			return nil, errors.Wrap(err, "ldap: error searching groups")
+		}
+		names := []string{}
+		for _, g := range sr.Entries {
+			names = append(names, g.GetAttributeValue(m.c.Schema.CN))
+		}
+		return m.mapper.GroupNames(names)
+	}
+
+	// chase the memberOf attribute breadth first, guarding against cycles
+	names := []string{}
+	seen := map[string]bool{}
+	next := e.GetAttributeValues(m.c.Schema.MemberOf)
+	for depth := 0; depth < m.c.MaxDepth && len(next) > 0; depth++ {
+		var parents []string
+		for _, dn := range next {
+			if seen[dn] {
+				continue
+			}
+			seen[dn] = true
+
+			g, err := m.getEntry(dn, ldap.ScopeBaseObject, "(objectClass=*)", m.c.Schema.CN, m.c.Schema.MemberOf)
+			if err != nil {
+				return nil, err
+			}
+			if g == nil {
+				continue
+			}
+			names = append(names, g.GetAttributeValue(m.c.Schema.CN))
+			parents = append(parents, g.GetAttributeValues(m.c.Schema.MemberOf)...)
+		}
+		next = parents
+	}
+	return m.mapper.GroupNames(names)
+}
+
+func (m *manager) GetMembers(ctx context.Context, name string) ([]*userpb.UserId, error) {
+	g, err := m.getEntry(m.c.BaseDN, ldap.ScopeWholeSubtree, fmt.Sprintf(m.c.GroupFilter, ldap.EscapeFilter(name)))
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errtypes.NotFound(name)
+	}
+
+	// the filters with a wildcard match any user or group respectively
+	anyUser := fmt.Sprintf(m.c.UserFilter, "*")
+	anyGroup := fmt.Sprintf(m.c.GroupFilter, "*")
+
+	members := []*userpb.UserId{}
+	if m.c.Nested == nestedInChain {
+		filter := fmt.Sprintf("(&%s(%s:%s:=%s))", anyUser, m.c.Schema.MemberOf, matchingRuleInChain, ldap.EscapeFilter(g.DN))
+		sr, err := m.pool.search(m.newSearch(m.c.BaseDN, ldap.ScopeWholeSubtree, filter, m.mapper.Attributes()...))
+		if err != nil {
+			return nil, errors.Wrap(err, "ldap: error searching group members")
+		}
+		for _, u := range sr.Entries {
+			id, err := m.mapper.UserID(mapping.FromLDAP(u))
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, id)
+		}
+		return members, nil
+	}
+
+	seenGroups := map[string]bool{}
+	seenUsers := map[string]bool{}
+	next := []string{g.DN}
+	for depth := 0; depth < m.c.MaxDepth && len(next) > 0; depth++ {
+		var children []string
+		for _, dn := range next {
+			if seenGroups[dn] {
+				continue
+			}
+			seenGroups[dn] = true
+
+			memberOf := fmt.Sprintf("(%s=%s)", m.c.Schema.MemberOf, ldap.EscapeFilter(dn))
+			sr, err := m.pool.search(m.newSearch(m.c.BaseDN, ldap.ScopeWholeSubtree, "(&"+anyUser+memberOf+")", m.mapper.Attributes()...))
+			if err != nil {
+				return nil, errors.Wrap(err, "ldap: error searching group members")
+			}
+			for _, u := range sr.Entries {
+				if seenUsers[u.DN] {
+					continue
+				}
+				seenUsers[u.DN] = true
+				id, err := m.mapper.UserID(mapping.FromLDAP(u))
+				if err != nil {
+					return nil, err
+				}
+				members = append(members, id)
+			}
+
+			sr, err = m.pool.search(m.newSearch(m.c.BaseDN, ldap.ScopeWholeSubtree, "(&"+anyGroup+memberOf+")"))
+			if err != nil {
+				return nil, errors.Wrap(err, "ldap: error searching nested groups")
+			}
+			for _, c := range sr.Entries {
+				children = append(children, c.DN)
+			}
+		}
+		next = children
+	}
+	return members, nil
+}
+
+func (m *manager) FindGroups(ctx context.Context, query string) ([]string, error) {
+	filter := fmt.Sprintf(m.c.GroupFilter, "*"+ldap.EscapeFilter(query)+"*")
+	sr, err := m.pool.search(m.newSearch(m.c.BaseDN, ldap.ScopeWholeSubtree, filter, m.c.Schema.CN))
+	if err != nil {
+		return nil, errors.Wrap(err, "ldap: error searching groups")
+	}
+
+	names := []string{}
+	for _, g := range sr.Entries {
+		names = append(names, g.GetAttributeValue(m.c.Schema.CN))
+	}
+	return m.mapper.GroupNames(names)
+}
+
+func (m *manager) newSearch(base string, scope int, filter string, attrs ...string) *ldap.SearchRequest {
+	return ldap.NewSearchRequest(base, scope, ldap.NeverDerefAliases, 0, 0, false, filter, append([]string{"dn"}, attrs...), nil)
+}
+
+// getEntry returns the single entry matching the filter, or nil if there is none.
+func (m *manager) getEntry(base string, scope int, filter string, attrs ...string) (*ldap.Entry, error) {
+	sr, err := m.pool.search(m.newSearch(base, scope, filter, attrs...))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "ldap: error searching entry")
+	}
+	if len(sr.Entries) != 1 {
+		return nil, nil
+	}
+	return sr.Entries[0], nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ldap
+
+import (
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	_, err := New(map[string]interface{}{"hostname": 42})
+	if err == nil {
+		t.Fatal("expected error but got none")
+	}
+
+	_, err = New(map[string]interface{}{"nested": "sideways"})
+	if err == nil {
+		t.Fatal("expected error for unknown nested mode but got none")
+	}
+
+	c, err := parseConfig(map[string]interface{}{
+		"nested": "none",
+		"schema": map[string]interface{}{"memberOf": "isMemberOf"},
+	})
+	if err != nil {
+		t.Fatalf("config is invalid: %v", err)
+	}
+	if c.MaxDepth != 1 {
+		t.Fatalf("expected max depth 1 without nesting, got %d", c.MaxDepth)
+	}
+	if c.Schema.MemberOf != "isMemberOf" {
+		t.Fatalf("expected memberOf attribute to be: %v, got %v", "isMemberOf", c.Schema.MemberOf)
+	}
+	// Member not provided in config file. should not modify defaults
+	if c.Schema.Member != ldapDefaults.Member {
+		t.Fatalf("expected member attribute to be: %v, got %v", ldapDefaults.Member, c.Schema.Member)
+	}
+}
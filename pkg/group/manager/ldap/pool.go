@@ -0,0 +1,91 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ldap
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/ldap.v2"
+)
+
+// pool keeps a bounded set of bound connections to the directory
+// so that membership lookups do not pay a TLS handshake and bind each time.
+type pool struct {
+	c     *config
+	conns chan *ldap.Conn
+}
+
+func newPool(c *config) *pool {
+	return &pool{c: c, conns: make(chan *ldap.Conn, c.PoolSize)}
+}
+
+func (p *pool) get() (*ldap.Conn, error) {
+	select {
+	case l := <-p.conns:
+		return l, nil
+	default:
+	}
+
+	l, err := ldap.DialTLS("tcp", fmt.Sprintf("%s:%d", p.c.Hostname, p.c.Port), &tls.Config{InsecureSkipVerify: p.c.Insecure})
+	if err != nil {
+		return nil, errors.Wrap(err, "ldap: error connecting to server")
+	}
+
+	// bind with a read only user
+	if err := l.Bind(p.c.BindUsername, p.c.BindPassword); err != nil {
+		l.Close()
+		return nil, errors.Wrap(err, "ldap: error binding")
+	}
+	return l, nil
+}
+
+// put returns the connection to the pool unless it is broken or the pool is full.
+func (p *pool) put(l *ldap.Conn, err error) {
+	if err != nil && ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		l.Close()
+		return
+	}
+	select {
+	case p.conns <- l:
+	default:
+		l.Close()
+	}
+}
+
+// search runs the request on a pooled connection, retrying once on a fresh
+// connection if the pooled one turned out to be dead.
+func (p *pool) search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	var sr *ldap.SearchResult
+	var err error
+	for i := 0; i < 2; i++ {
+		var l *ldap.Conn
+		l, err = p.get()
+		if err != nil {
+			return nil, err
+		}
+		sr, err = l.Search(req)
+		p.put(l, err)
+		if err == nil || !ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+			break
+		}
+	}
+	return sr, err
+}
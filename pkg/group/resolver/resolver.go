@@ -0,0 +1,203 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package resolver resolves the groups of the users when they access
+// resources, instead of trusting the groups set in their token at login.
+// This way the members added to a group get access to the resources shared
+// with it, and the removed ones lose it, without logging in again.
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/events"
+	"github.com/cs3org/reva/pkg/rgrpc/status"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/golang/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Config configures the resolver.
+type Config struct {
+	GatewaySvc string `mapstructure:"gatewaysvc"`
+	// TTL is how long in seconds the groups of a user are cached.
+	TTL int `mapstructure:"ttl"`
+	// NatsURL is the NATS server the group membership events are received
+	// from, to forget the cached groups of the members right away. See the
+	// nats events publisher.
+	NatsURL     string `mapstructure:"nats_url"`
+	NatsSubject string `mapstructure:"nats_subject"`
+}
+
+func (c *Config) init() {
+	c.GatewaySvc = sharedconf.GetGatewaySVC(c.GatewaySvc)
+	if c.TTL == 0 {
+		c.TTL = 60
+	}
+	if c.NatsSubject == "" {
+		c.NatsSubject = "reva.events"
+	}
+}
+
+type entry struct {
+	groups  []string
+	expires time.Time
+}
+
+// Resolver resolves the groups of the users through the gateway and caches
+// them. A nil Resolver returns the groups of the token.
+type Resolver struct {
+	c      *Config
+	lookup func(ctx context.Context, uid *userpb.UserId) ([]string, error)
+	now    func() time.Time
+	conn   *nats.Conn
+
+	mu    sync.Mutex
+	cache map[string]*entry
+}
+
+// New returns a resolver configured with c. It subscribes to the
+// membership events if a NATS server is configured.
+func New(c *Config) (*Resolver, error) {
+	c.init()
+	r := &Resolver{c: c, now: time.Now, cache: map[string]*entry{}}
+	r.lookup = r.getUserGroups
+
+	if c.NatsURL != "" {
+		conn, err := nats.Connect(c.NatsURL, nats.Name("reva-groups"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, errors.Wrap(err, "resolver: error connecting to "+c.NatsURL)
+		}
+		if _, err := conn.Subscribe(c.NatsSubject+"."+events.TypeGroupMembershipChanged, r.handleMsg); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "resolver: error subscribing to events")
+		}
+		r.conn = conn
+	}
+	return r, nil
+}
+
+// Close stops receiving the membership events.
+func (r *Resolver) Close() error {
+	if r != nil && r.conn != nil {
+		r.conn.Close()
+	}
+	return nil
+}
+
+func key(uid *userpb.UserId) string {
+	return uid.GetIdp() + "!" + uid.GetOpaqueId()
+}
+
+func (r *Resolver) getUserGroups(ctx context.Context, uid *userpb.UserId) ([]string, error) {
+	client, err := pool.GetGatewayServiceClient(r.c.GatewaySvc)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolver: error getting gateway client")
+	}
+	res, err := client.GetUserGroups(ctx, &userpb.GetUserGroupsRequest{UserId: uid})
+	if err != nil {
+		return nil, errors.Wrap(err, "resolver: error calling GetUserGroups")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return nil, status.NewErrorFromCode(res.Status.Code, "resolver")
+	}
+	return res.Groups, nil
+}
+
+// Groups returns the current groups of the user.
+func (r *Resolver) Groups(ctx context.Context, u *userpb.User) ([]string, error) {
+	if r == nil {
+		return u.Groups, nil
+	}
+	k := key(u.Id)
+
+	r.mu.Lock()
+	e, ok := r.cache[k]
+	r.mu.Unlock()
+	if ok && r.now().Before(e.expires) {
+		return e.groups, nil
+	}
+
+	groups, err := r.lookup(ctx, u.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for k, e := range r.cache {
+		if !now.Before(e.expires) {
+			delete(r.cache, k)
+		}
+	}
+	r.cache[k] = &entry{groups: groups, expires: now.Add(time.Duration(r.c.TTL) * time.Second)}
+	return groups, nil
+}
+
+// ContextWithGroups returns ctx with the user set to a copy having its
+// current groups. If they can not be resolved the groups of the token are
+// kept.
+func (r *Resolver) ContextWithGroups(ctx context.Context) context.Context {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok || u.Id == nil {
+		return ctx
+	}
+	groups, err := r.Groups(ctx, u)
+	if err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("user", u.Username).Msg("resolver: error resolving groups, using the ones of the token")
+		return ctx
+	}
+	c := proto.Clone(u).(*userpb.User)
+	c.Groups = groups
+	return user.ContextSetUser(ctx, c)
+}
+
+// Invalidate forgets the cached groups of the user, of all the users if
+// uid is nil.
+func (r *Resolver) Invalidate(uid *userpb.UserId) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if uid == nil {
+		r.cache = map[string]*entry{}
+		return
+	}
+	delete(r.cache, key(uid))
+}
+
+func (r *Resolver) handleMsg(msg *nats.Msg) {
+	e := &events.Event{}
+	if err := json.Unmarshal(msg.Data, e); err != nil {
+		log.Error().Err(err).Msg("resolver: error decoding event")
+		return
+	}
+	r.Invalidate(e.Member)
+}
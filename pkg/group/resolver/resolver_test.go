@@ -0,0 +1,91 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	r, err := New(&Config{TTL: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	groups := []string{"physics"}
+	lookups := 0
+	r.lookup = func(ctx context.Context, uid *userpb.UserId) ([]string, error) {
+		lookups++
+		return groups, nil
+	}
+
+	u := &userpb.User{Id: &userpb.UserId{Idp: "cernbox", OpaqueId: "einstein"}, Groups: []string{"stale"}}
+	ctx = user.ContextSetUser(ctx, u)
+
+	check := func(expected string, expectedLookups int) {
+		t.Helper()
+		got := user.ContextMustGetUser(r.ContextWithGroups(ctx))
+		if len(got.Groups) != 1 || got.Groups[0] != expected {
+			t.Fatalf("expected groups [%s], got %v", expected, got.Groups)
+		}
+		if lookups != expectedLookups {
+			t.Fatalf("expected %d lookups, got %d", expectedLookups, lookups)
+		}
+	}
+
+	check("physics", 1)
+	if u.Groups[0] != "stale" {
+		t.Fatal("the user of the context must not be changed")
+	}
+
+	groups = []string{"sailing"}
+	check("physics", 1)
+
+	r.Invalidate(u.Id)
+	check("sailing", 2)
+
+	groups = []string{"violin"}
+	now = now.Add(11 * time.Second)
+	check("violin", 3)
+
+	r.lookup = func(ctx context.Context, uid *userpb.UserId) ([]string, error) {
+		return nil, errors.New("gateway unavailable")
+	}
+	r.Invalidate(nil)
+	check("stale", 3)
+}
+
+func TestNilResolver(t *testing.T) {
+	var r *Resolver
+	u := &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein"}, Groups: []string{"physics"}}
+	groups, err := r.Groups(context.Background(), u)
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("expected the groups of the token, got %v, %v", groups, err)
+	}
+	r.Invalidate(u.Id)
+}
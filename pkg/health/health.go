@@ -0,0 +1,71 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package health keeps track of the services loaded by this process
+// so that they can be reported by the health probes.
+package health
+
+import "sync"
+
+// Service describes a service loaded by a grpc or http server.
+type Service struct {
+	// Kind is either grpc or http.
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
+
+var (
+	mu       sync.RWMutex
+	services []Service
+)
+
+// RegisterService records a service that has been loaded.
+// Registering the same service twice is a no-op. Safe for concurrent use.
+func RegisterService(kind, name, network, address string) {
+	mu.Lock()
+	defer mu.Unlock()
+	svc := Service{Kind: kind, Name: name, Network: network, Address: address}
+	for _, s := range services {
+		if s == svc {
+			return
+		}
+	}
+	services = append(services, svc)
+}
+
+// UnregisterService forgets a service that has been unloaded.
+func UnregisterService(kind, name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	kept := services[:0]
+	for _, s := range services {
+		if s.Kind != kind || s.Name != name {
+			kept = append(kept, s)
+		}
+	}
+	services = kept
+}
+
+// Services returns the services loaded so far.
+func Services() []Service {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Service(nil), services...)
+}
@@ -0,0 +1,153 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package i18n
+
+// builtin are the translations shipped with reva, the messages missing in a
+// language are returned in English.
+var builtin = map[string]map[string]string{
+	"de": {
+		"Bad Request":                      "Ungültige Anfrage",
+		"Not Found":                        "Nicht gefunden",
+		"Not found":                        "Nicht gefunden",
+		"not found":                        "nicht gefunden",
+		"Server Error":                     "Serverfehler",
+		"Unauthorised":                     "Nicht autorisiert",
+		"Unknown Error":                    "Unbekannter Fehler",
+		"missing user in context":          "Benutzer fehlt",
+		"user not found":                   "Benutzer nicht gefunden",
+		"user already exists":              "Benutzer existiert bereits",
+		"nothing to update":                "Nichts zu aktualisieren",
+		"invalid date format":              "Ungültiges Datumsformat",
+		"invalid expireDate":               "Ungültiges Ablaufdatum",
+		"expireDate must be in the future": "Das Ablaufdatum muss in der Zukunft liegen",
+		"permissions must be an integer":   "Die Berechtigungen müssen eine Ganzzahl sein",
+		"public upload is only possible for folders": "Öffentliches Hochladen ist nur für Ordner möglich",
+		"no app available to open the file":          "Keine App zum Öffnen der Datei verfügbar",
+		"space not found":                            "Space nicht gefunden",
+		"space already exists":                       "Space existiert bereits",
+		"the second factor is required":              "Der zweite Faktor ist erforderlich",
+		"Resource not found":                         "Ressource nicht gefunden",
+		"Precondition failed":                        "Vorbedingung fehlgeschlagen",
+		"The resource is locked":                     "Die Ressource ist gesperrt",
+		"The resource already exists":                "Die Ressource existiert bereits",
+		"The resource is not a file":                 "Die Ressource ist keine Datei",
+		"The destination already exists":             "Das Ziel existiert bereits",
+		"The parent folder does not exist":           "Der übergeordnete Ordner existiert nicht",
+		"Moving the resource is not allowed":         "Das Verschieben der Ressource ist nicht erlaubt",
+		"Copying the resource is not allowed":        "Das Kopieren der Ressource ist nicht erlaubt",
+		"Writing to the destination is not allowed":  "Das Schreiben in das Ziel ist nicht erlaubt",
+		"Invalid Destination header":                 "Ungültiger Destination-Header",
+		"Invalid Overwrite header":                   "Ungültiger Overwrite-Header",
+		"Invalid Depth header":                       "Ungültiger Depth-Header",
+		"Invalid Timeout header":                     "Ungültiger Timeout-Header",
+		"Invalid If header":                          "Ungültiger If-Header",
+		"Invalid X-Expected-Entity-Length header":    "Ungültiger X-Expected-Entity-Length-Header",
+		"Invalid lock request":                       "Ungültige Sperranfrage",
+		"The lock does not exist":                    "Die Sperre existiert nicht",
+		"The request body is missing":                "Der Inhalt der Anfrage fehlt",
+		"The request body is not supported":          "Der Inhalt der Anfrage wird nicht unterstützt",
+		"The file type is not allowed":               "Der Dateityp ist nicht erlaubt",
+	},
+	"es": {
+		"Bad Request":                      "Solicitud incorrecta",
+		"Not Found":                        "No encontrado",
+		"Not found":                        "No encontrado",
+		"not found":                        "no encontrado",
+		"Server Error":                     "Error del servidor",
+		"Unauthorised":                     "No autorizado",
+		"Unknown Error":                    "Error desconocido",
+		"missing user in context":          "Falta el usuario",
+		"user not found":                   "Usuario no encontrado",
+		"user already exists":              "El usuario ya existe",
+		"nothing to update":                "Nada que actualizar",
+		"invalid date format":              "Formato de fecha no válido",
+		"invalid expireDate":               "Fecha de caducidad no válida",
+		"expireDate must be in the future": "La fecha de caducidad debe ser futura",
+		"permissions must be an integer":   "Los permisos deben ser un número entero",
+		"public upload is only possible for folders": "La subida pública solo es posible para carpetas",
+		"no app available to open the file":          "No hay ninguna aplicación para abrir el archivo",
+		"space not found":                            "Espacio no encontrado",
+		"space already exists":                       "El espacio ya existe",
+		"the second factor is required":              "Se requiere el segundo factor",
+		"Resource not found":                         "Recurso no encontrado",
+		"Precondition failed":                        "Falló la condición previa",
+		"The resource is locked":                     "El recurso está bloqueado",
+		"The resource already exists":                "El recurso ya existe",
+		"The resource is not a file":                 "El recurso no es un archivo",
+		"The destination already exists":             "El destino ya existe",
+		"The parent folder does not exist":           "La carpeta superior no existe",
+		"Moving the resource is not allowed":         "No está permitido mover el recurso",
+		"Copying the resource is not allowed":        "No está permitido copiar el recurso",
+		"Writing to the destination is not allowed":  "No está permitido escribir en el destino",
+		"Invalid Destination header":                 "Cabecera Destination no válida",
+		"Invalid Overwrite header":                   "Cabecera Overwrite no válida",
+		"Invalid Depth header":                       "Cabecera Depth no válida",
+		"Invalid Timeout header":                     "Cabecera Timeout no válida",
+		"Invalid If header":                          "Cabecera If no válida",
+		"Invalid X-Expected-Entity-Length header":    "Cabecera X-Expected-Entity-Length no válida",
+		"Invalid lock request":                       "Solicitud de bloqueo no válida",
+		"The lock does not exist":                    "El bloqueo no existe",
+		"The request body is missing":                "Falta el cuerpo de la solicitud",
+		"The request body is not supported":          "El cuerpo de la solicitud no es compatible",
+		"The file type is not allowed":               "El tipo de archivo no está permitido",
+	},
+	"fr": {
+		"Bad Request":                      "Requête invalide",
+		"Not Found":                        "Introuvable",
+		"Not found":                        "Introuvable",
+		"not found":                        "introuvable",
+		"Server Error":                     "Erreur du serveur",
+		"Unauthorised":                     "Non autorisé",
+		"Unknown Error":                    "Erreur inconnue",
+		"missing user in context":          "Utilisateur manquant",
+		"user not found":                   "Utilisateur introuvable",
+		"user already exists":              "L'utilisateur existe déjà",
+		"nothing to update":                "Rien à mettre à jour",
+		"invalid date format":              "Format de date invalide",
+		"invalid expireDate":               "Date d'expiration invalide",
+		"expireDate must be in the future": "La date d'expiration doit être dans le futur",
+		"permissions must be an integer":   "Les permissions doivent être un entier",
+		"public upload is only possible for folders": "Le dépôt public n'est possible que pour les dossiers",
+		"no app available to open the file":          "Aucune application disponible pour ouvrir le fichier",
+		"space not found":                            "Espace introuvable",
+		"space already exists":                       "L'espace existe déjà",
+		"the second factor is required":              "Le second facteur est requis",
+		"Resource not found":                         "Ressource introuvable",
+		"Precondition failed":                        "La précondition a échoué",
+		"The resource is locked":                     "La ressource est verrouillée",
+		"The resource already exists":                "La ressource existe déjà",
+		"The resource is not a file":                 "La ressource n'est pas un fichier",
+		"The destination already exists":             "La destination existe déjà",
+		"The parent folder does not exist":           "Le dossier parent n'existe pas",
+		"Moving the resource is not allowed":         "Le déplacement de la ressource n'est pas autorisé",
+		"Copying the resource is not allowed":        "La copie de la ressource n'est pas autorisée",
+		"Writing to the destination is not allowed":  "L'écriture dans la destination n'est pas autorisée",
+		"Invalid Destination header":                 "En-tête Destination invalide",
+		"Invalid Overwrite header":                   "En-tête Overwrite invalide",
+		"Invalid Depth header":                       "En-tête Depth invalide",
+		"Invalid Timeout header":                     "En-tête Timeout invalide",
+		"Invalid If header":                          "En-tête If invalide",
+		"Invalid X-Expected-Entity-Length header":    "En-tête X-Expected-Entity-Length invalide",
+		"Invalid lock request":                       "Requête de verrouillage invalide",
+		"The lock does not exist":                    "Le verrou n'existe pas",
+		"The request body is missing":                "Le corps de la requête est manquant",
+		"The request body is not supported":          "Le corps de la requête n'est pas pris en charge",
+		"The file type is not allowed":               "Le type de fichier n'est pas autorisé",
+	},
+}
@@ -0,0 +1,157 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package i18n translates the messages returned to the users, like the
+// error messages of the ocs and ocdav services. The messages are written in
+// English and looked up in a catalog in the language the client accepts.
+package i18n
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+)
+
+// Catalog holds the translations of the messages by language.
+type Catalog struct {
+	mu       sync.RWMutex
+	tags     []language.Tag
+	messages map[language.Tag]map[string]string
+	matcher  language.Matcher
+}
+
+// NewCatalog returns a catalog without translations, the messages are
+// returned in English.
+func NewCatalog() *Catalog {
+	c := &Catalog{
+		tags:     []language.Tag{language.English},
+		messages: map[language.Tag]map[string]string{},
+	}
+	c.matcher = language.NewMatcher(c.tags)
+	return c
+}
+
+// Add adds the translations of the messages to the language, overriding
+// the ones already known.
+func (c *Catalog) Add(lang string, messages map[string]string) error {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return errors.Wrapf(err, "i18n: invalid language %q", lang)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.messages[tag]
+	if !ok {
+		m = map[string]string{}
+		c.messages[tag] = m
+		c.tags = append(c.tags, tag)
+		c.matcher = language.NewMatcher(c.tags)
+	}
+	for k, v := range messages {
+		m[k] = v
+	}
+	return nil
+}
+
+// LoadDir adds the translations of the <language>.json files of the
+// directory, each one being an object from the English messages to the
+// translated ones.
+func (c *Catalog) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return errors.Wrap(err, "i18n: error listing the translations")
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "i18n: error reading %s", f)
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return errors.Wrapf(err, "i18n: error decoding %s", f)
+		}
+		if err := c.Add(strings.TrimSuffix(filepath.Base(f), ".json"), messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match returns the language of the catalog preferred by the Accept-Language
+// header, English if none is acceptable.
+func (c *Catalog) Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return language.English.String()
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, i, confidence := c.matcher.Match(tags...)
+	if confidence == language.No {
+		return language.English.String()
+	}
+	return c.tags[i].String()
+}
+
+// Translate returns the message in the language, the message itself if it
+// has no translation.
+func (c *Catalog) Translate(lang, msg string) string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return msg
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if t, ok := c.messages[tag][msg]; ok && t != "" {
+		return t
+	}
+	return msg
+}
+
+// Default is the catalog used by the services, holding the translations
+// shipped with reva.
+var Default = NewCatalog()
+
+func init() {
+	for lang, messages := range builtin {
+		if err := Default.Add(lang, messages); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Language returns the language of the default catalog in which to answer
+// the request.
+func Language(r *http.Request) string {
+	return Default.Match(r.Header.Get("Accept-Language"))
+}
+
+// Translate translates the message with the default catalog in the language
+// of the request and sets the Content-Language header of the response.
+func Translate(w http.ResponseWriter, r *http.Request, msg string) string {
+	lang := Language(r)
+	w.Header().Set("Content-Language", lang)
+	return Default.Translate(lang, msg)
+}
@@ -0,0 +1,97 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package i18n
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	c := NewCatalog()
+	if err := c.Add("de", map[string]string{"Not Found": "Nicht gefunden"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add("pt-BR", map[string]string{"Not Found": "Não encontrado"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"":                       "en",
+		"de":                     "de",
+		"de-CH, en;q=0.5":        "de",
+		"fr, en;q=0.8, de;q=0.5": "en",
+		"pt-BR":                  "pt-BR",
+		"ja":                     "en",
+		"*;q=x":                  "en",
+	}
+	for accept, want := range tests {
+		if got := c.Match(accept); got != want {
+			t.Errorf("Match(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	c := NewCatalog()
+	if err := c.Add("de", map[string]string{"Not Found": "Nicht gefunden"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Translate("de", "Not Found"); got != "Nicht gefunden" {
+		t.Errorf("got %q", got)
+	}
+	if got := c.Translate("de", "Server Error"); got != "Server Error" {
+		t.Errorf("untranslated message got %q", got)
+	}
+	if got := c.Translate("en", "Not Found"); got != "Not Found" {
+		t.Errorf("english got %q", got)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "it.json"), []byte(`{"Not Found": "Non trovato"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCatalog()
+	if err := c.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	lang := c.Match("it-IT,it;q=0.9")
+	if got := c.Translate(lang, "Not Found"); got != "Non trovato" {
+		t.Errorf("got %q in %q", got, lang)
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	for lang, messages := range builtin {
+		for en, msg := range messages {
+			if msg == "" {
+				t.Errorf("empty %s translation of %q", lang, en)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package mapping
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/jsonfile"
+	"github.com/pkg/errors"
+)
+
+// The opaque keys of the numeric ids of the users.
+const (
+	uidNumberKey = "uid_number"
+	gidNumberKey = "gid_number"
+)
+
+// Range is the numeric ids allocated to the users of an identity provider.
+type Range struct {
+	UIDMin uint32 `mapstructure:"uid_min"`
+	UIDMax uint32 `mapstructure:"uid_max"`
+	GIDMin uint32 `mapstructure:"gid_min"`
+	GIDMax uint32 `mapstructure:"gid_max"`
+}
+
+// UIDNumber returns the numeric user id of the user, if mapped.
+func UIDNumber(u *userpb.User) (uint32, bool) {
+	return number(u, uidNumberKey)
+}
+
+// GIDNumber returns the numeric id of the primary group of the user, if
+// mapped.
+func GIDNumber(u *userpb.User) (uint32, bool) {
+	return number(u, gidNumberKey)
+}
+
+func number(u *userpb.User, key string) (uint32, bool) {
+	if u == nil || u.Opaque == nil {
+		return 0, false
+	}
+	e, ok := u.Opaque.Map[key]
+	if !ok || e.Decoder != "plain" {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(e.Value), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+func setNumber(u *userpb.User, key string, n uint32) {
+	if u.Opaque == nil {
+		u.Opaque = &types.Opaque{}
+	}
+	if u.Opaque.Map == nil {
+		u.Opaque.Map = map[string]*types.OpaqueEntry{}
+	}
+	u.Opaque.Map[key] = &types.OpaqueEntry{Decoder: "plain", Value: []byte(strconv.FormatUint(uint64(n), 10))}
+}
+
+// setNumbers sets the numeric ids of the user, the mapped ones or else the
+// ones allocated in the range of its identity provider.
+func (m *Mapper) setNumbers(u *userpb.User, uid, gid string) error {
+	r, ok := m.c.Ranges[u.Id.Idp]
+	if !ok {
+		r = &Range{}
+	}
+	for _, n := range []struct {
+		key      string
+		mapped   string
+		min, max uint32
+	}{
+		{uidNumberKey, uid, r.UIDMin, r.UIDMax},
+		{gidNumberKey, gid, r.GIDMin, r.GIDMax},
+	} {
+		if n.mapped != "" {
+			v, err := strconv.ParseUint(n.mapped, 10, 32)
+			if err != nil {
+				return fmt.Errorf("mapping: invalid %s %q", n.key, n.mapped)
+			}
+			setNumber(u, n.key, uint32(v))
+			continue
+		}
+		if !ok || m.alloc == nil {
+			continue
+		}
+		v, err := m.alloc.allocate(n.key, u.Id, n.min, n.max)
+		if err != nil {
+			return err
+		}
+		setNumber(u, n.key, v)
+	}
+	return nil
+}
+
+// allocations are the ids allocated per kind, identity provider and user.
+type allocations map[string]map[string]map[string]uint32
+
+// allocator keeps the allocated ids in a json file. The file is reloaded
+// when it changes, so that it can be shared by the services mapping the same
+// users.
+type allocator struct {
+	sync.Mutex // concurrent access to the file and model
+	model      allocations
+	file       *jsonfile.File
+}
+
+// allocators are the allocators of the files, shared by the mappers of a
+// process.
+var allocators = struct {
+	sync.Mutex
+	m map[string]*allocator
+}{m: map[string]*allocator{}}
+
+func getAllocator(file string) (*allocator, error) {
+	allocators.Lock()
+	defer allocators.Unlock()
+
+	if a, ok := allocators.m[file]; ok {
+		return a, nil
+	}
+	f, err := jsonfile.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "mapping: error opening the allocation file")
+	}
+	a := &allocator{file: f}
+	if err := a.load(); err != nil {
+		return nil, errors.Wrap(err, "mapping: error loading the allocation file")
+	}
+	allocators.m[file] = a
+	return a, nil
+}
+
+// load picks up the ids allocated by the other services.
+func (a *allocator) load() error {
+	model := allocations{}
+	if ok, err := a.file.Load(&model); err != nil || !ok {
+		return err
+	}
+	a.model = model
+	return nil
+}
+
+func (a *allocator) save() error {
+	return a.file.Save(a.model)
+}
+
+// allocate returns the id of kind allocated to the user, allocating the
+// next one of the range if it has none.
+func (a *allocator) allocate(kind string, id *userpb.UserId, min, max uint32) (uint32, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	if err := a.load(); err != nil {
+		return 0, err
+	}
+	if a.model[kind] == nil {
+		a.model[kind] = map[string]map[string]uint32{}
+	}
+	ids := a.model[kind][id.Idp]
+	if ids == nil {
+		ids = map[string]uint32{}
+		a.model[kind][id.Idp] = ids
+	}
+	if n, ok := ids[id.OpaqueId]; ok {
+		return n, nil
+	}
+
+	next := min
+	for _, n := range ids {
+		if n >= next {
+			next = n + 1
+		}
+	}
+	if next > max || next < min {
+		return 0, fmt.Errorf("mapping: the %s range of %s is exhausted", kind, id.Idp)
+	}
+	ids[id.OpaqueId] = next
+	if err := a.save(); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
@@ -0,0 +1,450 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package mapping maps the attributes of the identity backends, the LDAP
+// entries, OIDC claims, SAML attributes or SQL rows, to the fields of the CS3
+// users. The fields are text/template templates over the attributes, so that
+// the user and group providers and the auth managers map the same identities
+// the same way.
+package mapping
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/pkg/errors"
+	"gopkg.in/ldap.v2"
+)
+
+// Config maps the attributes of a backend to the fields of the users. The
+// fields are templates, in which {{attr "name"}} is the first value of the
+// attribute, and the empty ones take the default of the backend.
+type Config struct {
+	Idp         string `mapstructure:"idp"`
+	OpaqueID    string `mapstructure:"opaque_id"`
+	Username    string `mapstructure:"username"`
+	Mail        string `mapstructure:"mail"`
+	DisplayName string `mapstructure:"display_name"`
+	// Groups is the attribute listing the groups of the user, each value
+	// is mapped with the GroupName template, in which . is the value.
+	Groups    string `mapstructure:"groups"`
+	GroupName string `mapstructure:"group_name"`
+	// Normalize normalizes the usernames after they are mapped.
+	Normalize Normalize `mapstructure:"normalize"`
+	// UIDNumber and GIDNumber map the numeric ids of the user. When they
+	// are empty the ids are allocated from the range of the identity
+	// provider of the user, and kept in the allocation file.
+	UIDNumber      string            `mapstructure:"uid_number"`
+	GIDNumber      string            `mapstructure:"gid_number"`
+	AllocationFile string            `mapstructure:"allocation_file"`
+	Ranges         map[string]*Range `mapstructure:"ranges"`
+}
+
+// Normalize configures the normalization of the usernames.
+type Normalize struct {
+	Lowercase bool `mapstructure:"lowercase"`
+	// StripDomain removes the @domain suffix of the usernames.
+	StripDomain bool `mapstructure:"strip_domain"`
+	// Replace replaces the substrings of the usernames by their values.
+	Replace map[string]string `mapstructure:"replace"`
+}
+
+// Attributes are the attributes of an identity in a backend, most having a
+// single value.
+type Attributes map[string][]string
+
+// Get returns the first value of the attribute.
+func (a Attributes) Get(name string) string {
+	if vs := a[name]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// Set sets the values of the attribute, ignoring the empty ones.
+func (a Attributes) Set(name string, values ...string) {
+	for _, v := range values {
+		if v != "" {
+			a[name] = append(a[name], v)
+		}
+	}
+}
+
+// FromLDAP returns the attributes of the LDAP entry, its DN as dn.
+func FromLDAP(e *ldap.Entry) Attributes {
+	a := Attributes{"dn": {e.DN}}
+	for _, attr := range e.Attributes {
+		a.Set(attr.Name, attr.Values...)
+	}
+	return a
+}
+
+// FromClaims returns the attributes of the OIDC claims, the lists having
+// a value per element.
+func FromClaims(claims map[string]interface{}) Attributes {
+	a := Attributes{}
+	for k, v := range claims {
+		switch v := v.(type) {
+		case nil:
+		case []interface{}:
+			for _, e := range v {
+				a.Set(k, claimString(e))
+			}
+		case []string:
+			a.Set(k, v...)
+		default:
+			a.Set(k, claimString(v))
+		}
+	}
+	return a
+}
+
+func claimString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Attr returns the template of the first value of the attribute, used by
+// the backends to build their default mappings from their settings.
+func Attr(name string) string {
+	return "{{attr " + strconv.Quote(name) + "}}"
+}
+
+// Mapper maps the attributes of a backend to users.
+type Mapper struct {
+	c Config
+
+	idp, opaqueID, username, mail, displayName *template.Template
+	groupName, uidNumber, gidNumber            *template.Template
+	replacer                                   *strings.Replacer
+	alloc                                      *allocator
+}
+
+// New returns the mapper of the configuration, the empty fields taking the
+// value of the defaults of the backend.
+func New(c Config, defaults Config) (*Mapper, error) {
+	fill := func(v *string, d string) {
+		if *v == "" {
+			*v = d
+		}
+	}
+	fill(&c.Idp, defaults.Idp)
+	fill(&c.OpaqueID, defaults.OpaqueID)
+	fill(&c.Username, defaults.Username)
+	fill(&c.Mail, defaults.Mail)
+	fill(&c.DisplayName, defaults.DisplayName)
+	fill(&c.Groups, defaults.Groups)
+	fill(&c.GroupName, defaults.GroupName)
+	fill(&c.GroupName, "{{.}}")
+	fill(&c.UIDNumber, defaults.UIDNumber)
+	fill(&c.GIDNumber, defaults.GIDNumber)
+	if c.OpaqueID == "" {
+		return nil, errors.New("mapping: opaque_id is required")
+	}
+
+	m := &Mapper{c: c}
+	for _, t := range []struct {
+		name string
+		text string
+		dst  **template.Template
+	}{
+		{"idp", c.Idp, &m.idp},
+		{"opaque_id", c.OpaqueID, &m.opaqueID},
+		{"username", c.Username, &m.username},
+		{"mail", c.Mail, &m.mail},
+		{"display_name", c.DisplayName, &m.displayName},
+		{"group_name", c.GroupName, &m.groupName},
+		{"uid_number", c.UIDNumber, &m.uidNumber},
+		{"gid_number", c.GIDNumber, &m.gidNumber},
+	} {
+		tpl, err := template.New(t.name).Option("missingkey=zero").Funcs(funcs).Parse(t.text)
+		if err != nil {
+			return nil, errors.Wrap(err, "mapping: error parsing "+t.name)
+		}
+		*t.dst = tpl
+	}
+
+	if len(c.Normalize.Replace) > 0 {
+		olds := make([]string, 0, len(c.Normalize.Replace))
+		for old := range c.Normalize.Replace {
+			olds = append(olds, old)
+		}
+		sort.Strings(olds)
+		pairs := make([]string, 0, 2*len(olds))
+		for _, old := range olds {
+			pairs = append(pairs, old, c.Normalize.Replace[old])
+		}
+		m.replacer = strings.NewReplacer(pairs...)
+	}
+
+	if len(c.Ranges) > 0 {
+		if c.AllocationFile == "" {
+			return nil, errors.New("mapping: allocation_file is required to allocate the ids")
+		}
+		for idp, r := range c.Ranges {
+			if r == nil || r.UIDMin > r.UIDMax || r.GIDMin > r.GIDMax {
+				return nil, fmt.Errorf("mapping: invalid range of %s", idp)
+			}
+		}
+		alloc, err := getAllocator(c.AllocationFile)
+		if err != nil {
+			return nil, err
+		}
+		m.alloc = alloc
+	}
+	return m, nil
+}
+
+// funcs are the functions available in the templates.
+var funcs = template.FuncMap{
+	"attr":  func(name string) string { return "" },
+	"attrs": func(name string) []string { return nil },
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	// replace replaces old by new in s, {{attr "mail" | replace "@" "_"}}.
+	"replace": func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	// localpart and domain split an address at its @.
+	"localpart": func(s string) string {
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			return s[:i]
+		}
+		return s
+	},
+	"domain": func(s string) string {
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			return s[i+1:]
+		}
+		return ""
+	},
+	// rdn returns the value of the first attribute typ of the LDAP DN,
+	// {{attr "memberOf" | rdn "cn"}}.
+	"rdn": func(typ, dn string) string {
+		d, err := ldap.ParseDN(dn)
+		if err != nil {
+			return ""
+		}
+		for _, r := range d.RDNs {
+			for _, a := range r.Attributes {
+				if strings.EqualFold(a.Type, typ) {
+					return a.Value
+				}
+			}
+		}
+		return ""
+	},
+}
+
+// execute runs the template on the attributes, . being the map of their
+// first values.
+func execute(t *template.Template, a Attributes) (string, error) {
+	data := make(map[string]string, len(a))
+	for k := range a {
+		data[k] = a.Get(k)
+	}
+	t, err := t.Clone()
+	if err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{
+		"attr":  a.Get,
+		"attrs": func(name string) []string { return a[name] },
+	})
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", errors.Wrap(err, "mapping: error mapping "+t.Name())
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// UserID maps the attributes to the id of a user, it fails if the id is
+// empty.
+func (m *Mapper) UserID(a Attributes) (*userpb.UserId, error) {
+	idp, err := execute(m.idp, a)
+	if err != nil {
+		return nil, err
+	}
+	id, err := execute(m.opaqueID, a)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, errors.New("mapping: no user id in the attributes")
+	}
+	return &userpb.UserId{Idp: idp, OpaqueId: id}, nil
+}
+
+// User maps the attributes to a user. The username defaults to the id of
+// the user, the numeric ids are allocated when they are not mapped and the
+// identity provider of the user has a range.
+func (m *Mapper) User(a Attributes) (*userpb.User, error) {
+	id, err := m.UserID(a)
+	if err != nil {
+		return nil, err
+	}
+
+	var username, mail, displayName, uid, gid string
+	for _, f := range []struct {
+		t *template.Template
+		v *string
+	}{
+		{m.username, &username},
+		{m.mail, &mail},
+		{m.displayName, &displayName},
+		{m.uidNumber, &uid},
+		{m.gidNumber, &gid},
+	} {
+		if *f.v, err = execute(f.t, a); err != nil {
+			return nil, err
+		}
+	}
+	if username == "" {
+		username = id.OpaqueId
+	}
+
+	u := &userpb.User{
+		Id:          id,
+		Username:    m.NormalizeUsername(username),
+		Mail:        mail,
+		DisplayName: displayName,
+		Groups:      []string{},
+	}
+	if m.c.Groups != "" {
+		u.Groups, err = m.GroupNames(a[m.c.Groups])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.setNumbers(u, uid, gid); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// GroupNames maps the names or DNs of groups found in a backend to the
+// names of the groups, skipping the ones mapped to nothing.
+func (m *Mapper) GroupNames(values []string) ([]string, error) {
+	groups := []string{}
+	for _, v := range values {
+		var b bytes.Buffer
+		if err := m.groupName.Execute(&b, v); err != nil {
+			return nil, errors.Wrap(err, "mapping: error mapping group_name")
+		}
+		if g := strings.TrimSpace(b.String()); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// NormalizeUsername normalizes the username as configured, the backends
+// normalize the usernames they are given to look the users up.
+func (m *Mapper) NormalizeUsername(username string) string {
+	n := m.c.Normalize
+	if n.StripDomain {
+		if i := strings.LastIndex(username, "@"); i > 0 {
+			username = username[:i]
+		}
+	}
+	if m.replacer != nil {
+		username = m.replacer.Replace(username)
+	}
+	if n.Lowercase {
+		username = strings.ToLower(username)
+	}
+	return username
+}
+
+// Attributes returns the names of the attributes read by the templates, for
+// the backends which have to request them.
+func (m *Mapper) Attributes() []string {
+	names := map[string]bool{}
+	for _, t := range []*template.Template{m.idp, m.opaqueID, m.username, m.mail, m.displayName, m.uidNumber, m.gidNumber} {
+		collect(t.Tree.Root, names)
+	}
+	if m.c.Groups != "" {
+		names[m.c.Groups] = true
+	}
+	list := make([]string, 0, len(names))
+	for n := range names {
+		list = append(list, n)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// collect adds the attributes read by the node, as {{.name}} or with the
+// attr and attrs functions, to names.
+func collect(n parse.Node, names map[string]bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collect(c, names)
+		}
+	case *parse.ActionNode:
+		collect(n.Pipe, names)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			collect(c, names)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) > 1 {
+			if id, ok := n.Args[0].(*parse.IdentifierNode); ok && (id.Ident == "attr" || id.Ident == "attrs") {
+				if s, ok := n.Args[1].(*parse.StringNode); ok {
+					names[s.Text] = true
+				}
+			}
+		}
+		for _, c := range n.Args {
+			collect(c, names)
+		}
+	case *parse.FieldNode:
+		names[n.Ident[0]] = true
+	case *parse.IfNode:
+		collect(&n.BranchNode, names)
+	case *parse.RangeNode:
+		collect(&n.BranchNode, names)
+	case *parse.WithNode:
+		collect(&n.BranchNode, names)
+	case *parse.BranchNode:
+		collect(n.Pipe, names)
+		collect(n.List, names)
+		collect(n.ElseList, names)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package mapping
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestUser(t *testing.T) {
+	m, err := New(Config{
+		Username:  `{{attr "mail" | localpart}}`,
+		Groups:    "memberOf",
+		GroupName: `{{rdn "cn" .}}`,
+		Normalize: Normalize{Lowercase: true, Replace: map[string]string{".": "_"}},
+	}, Config{
+		Idp:         "https://idp.example.org",
+		OpaqueID:    Attr("objectGUID"),
+		Username:    Attr("uid"),
+		Mail:        Attr("mail"),
+		DisplayName: `{{.givenName}} {{.sn}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := m.User(Attributes{
+		"objectGUID": {"4c510ada"},
+		"mail":       {"Albert.Einstein@example.org"},
+		"givenName":  {"Albert"},
+		"sn":         {"Einstein"},
+		"memberOf":   {"cn=physics-lovers,ou=groups,dc=example,dc=org", "ou=nothing,dc=example,dc=org"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id.Idp != "https://idp.example.org" || u.Id.OpaqueId != "4c510ada" {
+		t.Fatalf("unexpected id: %+v", u.Id)
+	}
+	if u.Username != "albert_einstein" || u.DisplayName != "Albert Einstein" || u.Mail != "Albert.Einstein@example.org" {
+		t.Fatalf("unexpected user: %+v", u)
+	}
+	if !reflect.DeepEqual(u.Groups, []string{"physics-lovers"}) {
+		t.Fatalf("unexpected groups: %v", u.Groups)
+	}
+	if _, ok := UIDNumber(u); ok {
+		t.Fatal("expected no uid number without range")
+	}
+
+	if _, err := m.User(Attributes{"mail": {"marie@example.org"}}); err == nil {
+		t.Fatal("expected error for user without id")
+	}
+
+	want := []string{"givenName", "mail", "memberOf", "objectGUID", "sn"}
+	if got := m.Attributes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected attributes %v, got %v", want, got)
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	m, err := New(Config{Normalize: Normalize{Lowercase: true, StripDomain: true}}, Config{OpaqueID: Attr("sub")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.NormalizeUsername("Einstein@CERN.ch"); got != "einstein" {
+		t.Fatalf("expected einstein, got %s", got)
+	}
+}
+
+func TestAllocation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mapping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := Config{
+		Idp:            Attr("iss"),
+		AllocationFile: path.Join(dir, "ids.json"),
+		Ranges: map[string]*Range{
+			"cern":    {UIDMin: 1000, UIDMax: 1001, GIDMin: 5000, GIDMax: 5001},
+			"eduGAIN": {UIDMin: 100000, UIDMax: 199999, GIDMin: 100000, GIDMax: 199999},
+		},
+	}
+	m, err := New(c, Config{OpaqueID: Attr("sub"), GIDNumber: Attr("gid")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numbers := func(iss, sub, gid string) (uint32, uint32) {
+		u, err := m.User(Attributes{"iss": {iss}, "sub": {sub}, "gid": {gid}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		uid, _ := UIDNumber(u)
+		g, _ := GIDNumber(u)
+		return uid, g
+	}
+
+	if uid, gid := numbers("cern", "einstein", ""); uid != 1000 || gid != 5000 {
+		t.Fatalf("unexpected ids %d:%d", uid, gid)
+	}
+	if uid, gid := numbers("cern", "marie", "42"); uid != 1001 || gid != 42 {
+		t.Fatalf("unexpected ids %d:%d", uid, gid)
+	}
+	if uid, _ := numbers("eduGAIN", "einstein", ""); uid != 100000 {
+		t.Fatalf("expected the range of the idp, got %d", uid)
+	}
+
+	// the ids survive a restart
+	allocators.m = map[string]*allocator{}
+	m, err = New(c, Config{OpaqueID: Attr("sub")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, _ := numbers("cern", "einstein", ""); uid != 1000 {
+		t.Fatalf("expected the allocated uid, got %d", uid)
+	}
+	if _, err := m.User(Attributes{"iss": {"cern"}, "sub": {"richard"}}); err == nil {
+		t.Fatal("expected error for exhausted range")
+	}
+	if uid, _ := numbers("elsewhere", "einstein", ""); uid != 0 {
+		t.Fatalf("expected no uid outside the ranges, got %d", uid)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package jsonfile persists the model of the json drivers to a file that is
+// read again when it changes, so that it can be shared by several services.
+// The file is replaced atomically on save, and the services changing it hold
+// a lock shared between the processes, see File.Lock.
+package jsonfile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// File is a json file holding the model of a driver. It is not safe for
+// concurrent use, the drivers guard it with the lock of their model.
+type File struct {
+	path string
+	// info is the file info when the file was last loaded or saved.
+	info os.FileInfo
+}
+
+// Open returns the file at path, created with an empty object if it does
+// not exist.
+func Open(path string) (*File, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(path, []byte("{}"), 0600); err != nil {
+			return nil, errors.Wrap(err, "error creating the file: "+path)
+		}
+	}
+	return &File{path: path}, nil
+}
+
+// Load decodes the file into v if it changed since it was last loaded or
+// saved, and tells if it did. v should be a new model, the decoded one
+// replacing the model of the driver.
+func (f *File) Load(v interface{}) (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, errors.Wrap(err, "error reading the file info")
+	}
+	if f.info != nil && os.SameFile(info, f.info) && info.ModTime().Equal(f.info.ModTime()) {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return false, errors.Wrap(err, "error reading the data")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, errors.Wrap(err, "error decoding data to json")
+	}
+
+	f.info = info
+	return true, nil
+}
+
+// Save encodes v to a temporary file that replaces the file, so that the
+// other services never read a partially written model.
+func (f *File) Save(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "error encoding to json")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), "."+filepath.Base(f.path)+".")
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary file for: "+f.path)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "error writing to file: "+tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "error writing to file: "+tmp.Name())
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "error replacing file: "+f.path)
+	}
+
+	if info, err := os.Stat(f.path); err == nil {
+		f.info = info
+	}
+	return nil
+}
+
+// Lock takes the lock of the file shared by all the processes, and returns
+// the function releasing it. The drivers hold it from the load of the model
+// to its save, so that the changes of concurrent services are not lost.
+func (f *File) Lock() (func(), error) {
+	return lockFile(f.path + ".lock")
+}
@@ -0,0 +1,80 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package jsonfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+type model struct {
+	Values map[string]string `json:"values"`
+}
+
+func TestFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-jsonfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	fn := path.Join(tmp, "model.json")
+
+	f, err := Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &model{}
+	if ok, err := f.Load(m); err != nil || !ok {
+		t.Fatalf("expected the new file to be loaded, got %v, %v", ok, err)
+	}
+	if m.Values != nil {
+		t.Fatalf("expected an empty model, got %v", m.Values)
+	}
+
+	m.Values = map[string]string{"a": "b"}
+	if err := f.Save(m); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := f.Load(&model{}); err != nil || ok {
+		t.Fatalf("expected the saved file not to be loaded again, got %v, %v", ok, err)
+	}
+
+	// another service writes the file
+	other, err := Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Save(&model{Values: map[string]string{"c": "d"}}); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(fn, later, later); err != nil {
+		t.Fatal(err)
+	}
+	m = &model{}
+	if ok, err := f.Load(m); err != nil || !ok {
+		t.Fatalf("expected the changed file to be loaded, got %v, %v", ok, err)
+	}
+	if m.Values["c"] != "d" {
+		t.Fatalf("expected the values of the other service, got %v", m.Values)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package maintenance lets the services be put in read-only or maintenance
+// mode, to migrate their backends safely. The refused calls are answered
+// with CODE_UNAVAILABLE and the number of seconds after which to retry them
+// in the opaque data of the response.
+package maintenance
+
+import (
+	"strconv"
+	"strings"
+
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+)
+
+// The modes of the services.
+const (
+	// ModeReadOnly refuses the calls changing data.
+	ModeReadOnly = "read_only"
+	// ModeMaintenance refuses all the calls but the authentication ones.
+	ModeMaintenance = "maintenance"
+)
+
+// OpaqueRetryAfter holds the number of seconds after which a refused call
+// may be retried.
+const OpaqueRetryAfter = "retry_after"
+
+// DefaultReadMethods are the prefixes of the names of the methods not
+// changing data.
+var DefaultReadMethods = []string{"Get", "List", "Stat", "Find", "WhoAmI", "Authenticate", "InitiateFileDownload"}
+
+// authMethods are still answered in maintenance mode, so that the clients
+// get told to retry rather than to log in again.
+var authMethods = []string{"Authenticate", "WhoAmI"}
+
+// Refused tells whether a call to the method, given by its name, is refused
+// in the mode. reads are the prefixes of the names of the read methods.
+func Refused(mode, method string, reads []string) bool {
+	switch mode {
+	case ModeReadOnly:
+		return !hasPrefix(method, reads)
+	case ModeMaintenance:
+		return !hasPrefix(method, authMethods)
+	default:
+		return false
+	}
+}
+
+func hasPrefix(method string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(method, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAfterToOpaque returns the opaque data carrying the delay after which
+// to retry, in seconds.
+func RetryAfterToOpaque(secs int) *typespb.Opaque {
+	return &typespb.Opaque{
+		Map: map[string]*typespb.OpaqueEntry{
+			OpaqueRetryAfter: {Decoder: "plain", Value: []byte(strconv.Itoa(secs))},
+		},
+	}
+}
+
+// RetryAfterFromOpaque returns the delay after which to retry carried by the
+// opaque data, 0 when there is none.
+func RetryAfterFromOpaque(o *typespb.Opaque) int {
+	e, ok := o.GetMap()[OpaqueRetryAfter]
+	if !ok || e.Decoder != "plain" {
+		return 0
+	}
+	secs, err := strconv.Atoi(string(e.Value))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return secs
+}
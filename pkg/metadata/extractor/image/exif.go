@@ -0,0 +1,153 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package image
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// The EXIF tags read from the TIFF structure.
+const (
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagGPSIFD            = 0x8825
+	tagDateTimeOriginal  = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitude       = 0x0002
+
+	typeASCII = 2
+	typeLong  = 4
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+var errInvalidExif = errors.New("image: invalid exif data")
+
+type exifInfo struct {
+	// taken is the capture date as 2006-01-02T15:04:05, followed by the
+	// offset if known.
+	taken string
+	gps   bool
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	// value is the offset of the value, or the value itself when it fits in
+	// four bytes.
+	value []byte
+}
+
+type tiffReader struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+// parseExif reads the capture date and the presence of GPS coordinates from
+// TIFF structured EXIF data.
+func parseExif(b []byte) (*exifInfo, error) {
+	if len(b) < 8 {
+		return nil, errInvalidExif
+	}
+	t := &tiffReader{b: b}
+	switch string(b[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, errInvalidExif
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(b[4:8]))
+	if err != nil {
+		return nil, err
+	}
+
+	x := &exifInfo{}
+	taken := t.ascii(ifd0[tagDateTime])
+	var offset string
+	if e, ok := ifd0[tagExifIFD]; ok && e.typ == typeLong {
+		exif, err := t.readIFD(t.order.Uint32(e.value))
+		if err != nil {
+			return nil, err
+		}
+		if s := t.ascii(exif[tagDateTimeOriginal]); s != "" {
+			taken = s
+		}
+		offset = t.ascii(exif[tagOffsetTimeOriginal])
+	}
+	if e, ok := ifd0[tagGPSIFD]; ok && e.typ == typeLong {
+		if gps, err := t.readIFD(t.order.Uint32(e.value)); err == nil {
+			_, x.gps = gps[tagGPSLatitude]
+		}
+	}
+
+	if ts, err := time.Parse(exifTimeLayout, taken); err == nil {
+		x.taken = ts.Format("2006-01-02T15:04:05")
+		if _, err := time.Parse("-07:00", offset); err == nil {
+			x.taken += offset
+		}
+	}
+	return x, nil
+}
+
+// readIFD returns the entries of the image file directory at offset, by tag.
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]*ifdEntry, error) {
+	if uint64(offset)+2 > uint64(len(t.b)) {
+		return nil, errInvalidExif
+	}
+	n := int(t.order.Uint16(t.b[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(t.b) {
+		return nil, errInvalidExif
+	}
+
+	entries := make(map[uint16]*ifdEntry, n)
+	for i := 0; i < n; i++ {
+		e := t.b[start+i*12 : start+(i+1)*12]
+		entries[t.order.Uint16(e[0:2])] = &ifdEntry{
+			typ:   t.order.Uint16(e[2:4]),
+			count: t.order.Uint32(e[4:8]),
+			value: e[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// ascii returns the value of an ASCII entry, empty if it is missing or invalid.
+func (t *tiffReader) ascii(e *ifdEntry) string {
+	if e == nil || e.typ != typeASCII {
+		return ""
+	}
+	data := e.value
+	if e.count > 4 {
+		offset := uint64(t.order.Uint32(e.value))
+		if offset+uint64(e.count) > uint64(len(t.b)) {
+			return ""
+		}
+		data = t.b[offset : offset+uint64(e.count)]
+	} else {
+		data = data[:e.count]
+	}
+	return strings.TrimRight(string(data), "\x00 ")
+}
@@ -0,0 +1,349 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package image
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errInvalidHEIC = errors.New("image: invalid heic data")
+
+// the brands of the HEIF files, HEIC being HEIF with HEVC coded images
+var heifBrands = map[string]bool{"heic": true, "heix": true, "heim": true, "heis": true, "hevc": true, "hevx": true, "mif1": true, "msf1": true}
+
+type heicInfo struct {
+	width, height int
+	exif          []byte
+}
+
+// box is an ISO base media file format box.
+type box struct {
+	typ  string
+	data []byte
+}
+
+func isHEIC(b []byte) bool {
+	return len(b) >= 12 && string(b[4:8]) == "ftyp" && heifBrands[string(b[8:12])]
+}
+
+// boxes splits b in the boxes it is made of.
+func boxes(b []byte) ([]*box, error) {
+	var res []*box
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, errInvalidHEIC
+		}
+		size := uint64(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			// the box extends to the end
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return nil, errInvalidHEIC
+			}
+			size = binary.BigEndian.Uint64(b[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(b)) {
+			return nil, errInvalidHEIC
+		}
+		res = append(res, &box{typ: typ, data: b[header:size]})
+		b = b[size:]
+	}
+	return res, nil
+}
+
+func find(bs []*box, typ string) *box {
+	for _, b := range bs {
+		if b.typ == typ {
+			return b
+		}
+	}
+	return nil
+}
+
+// fullBox returns the version of a full box and its content after the
+// version and the flags.
+func fullBox(b *box) (byte, uint32, []byte, error) {
+	if b == nil || len(b.data) < 4 {
+		return 0, 0, nil, errInvalidHEIC
+	}
+	return b.data[0], binary.BigEndian.Uint32(b.data) & 0xffffff, b.data[4:], nil
+}
+
+// reader reads big endian integers from a byte slice, remembering the
+// first read past its end.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) uint(n int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if n > len(r.b) {
+		r.err = errInvalidHEIC
+		return 0
+	}
+	var v uint64
+	for _, c := range r.b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// parseHEIC reads the dimensions of the primary image and the EXIF data of a
+// HEIF file.
+func parseHEIC(b []byte) (*heicInfo, error) {
+	top, err := boxes(b)
+	if err != nil {
+		return nil, err
+	}
+	_, _, meta, err := fullBox(find(top, "meta"))
+	if err != nil {
+		return nil, err
+	}
+	children, err := boxes(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &heicInfo{}
+	primary, err := primaryItem(find(children, "pitm"))
+	if err != nil {
+		return nil, err
+	}
+	if iprp := find(children, "iprp"); iprp != nil {
+		info.width, info.height = dimensions(iprp, primary)
+	}
+
+	exifID, ok := exifItem(find(children, "iinf"))
+	if !ok {
+		return info, nil
+	}
+	data, err := itemData(find(children, "iloc"), exifID, b)
+	if err != nil || len(data) < 4 {
+		return info, nil
+	}
+	// the data starts with the offset of the TIFF header, after the "Exif\0\0" prefix
+	offset := uint64(binary.BigEndian.Uint32(data))
+	if 4+offset < uint64(len(data)) {
+		info.exif = data[4+offset:]
+	}
+	return info, nil
+}
+
+func primaryItem(pitm *box) (uint32, error) {
+	version, _, data, err := fullBox(pitm)
+	if err != nil {
+		return 0, err
+	}
+	r := &reader{b: data}
+	if version == 0 {
+		return uint32(r.uint(2)), r.err
+	}
+	return uint32(r.uint(4)), r.err
+}
+
+// exifItem returns the id of the item holding the EXIF data.
+func exifItem(iinf *box) (uint32, bool) {
+	version, _, data, err := fullBox(iinf)
+	if err != nil {
+		return 0, false
+	}
+	// skip the entry count, the item info boxes follow
+	r := &reader{b: data}
+	if version == 0 {
+		r.uint(2)
+	} else {
+		r.uint(4)
+	}
+	if r.err != nil {
+		return 0, false
+	}
+	infes, err := boxes(r.b)
+	if err != nil {
+		return 0, false
+	}
+	for _, infe := range infes {
+		version, _, data, err := fullBox(infe)
+		if err != nil || version < 2 {
+			continue
+		}
+		r := &reader{b: data}
+		var id uint32
+		if version == 2 {
+			id = uint32(r.uint(2))
+		} else {
+			id = uint32(r.uint(4))
+		}
+		r.uint(2) // protection index
+		typ := r.uint(4)
+		if r.err == nil && typ == 0x45786966 { // "Exif"
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// itemData returns the content of the first extent of the item, stored in
+// the file.
+func itemData(iloc *box, id uint32, file []byte) ([]byte, error) {
+	version, _, data, err := fullBox(iloc)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{b: data}
+	sizes := r.uint(2)
+	offsetSize, lengthSize := int(sizes>>12&0xf), int(sizes>>8&0xf)
+	baseOffsetSize, indexSize := int(sizes>>4&0xf), int(sizes&0xf)
+	if version == 0 {
+		indexSize = 0
+	}
+
+	var count uint64
+	if version < 2 {
+		count = r.uint(2)
+	} else {
+		count = r.uint(4)
+	}
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		var itemID uint32
+		if version < 2 {
+			itemID = uint32(r.uint(2))
+		} else {
+			itemID = uint32(r.uint(4))
+		}
+		method := uint64(0)
+		if version > 0 {
+			method = r.uint(2) & 0xf
+		}
+		r.uint(2) // data reference index
+		base := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+		for j := uint64(0); j < extents && r.err == nil; j++ {
+			r.uint(indexSize)
+			offset := r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			if itemID != id || j > 0 {
+				continue
+			}
+			// only the items stored in the file are read
+			if method != 0 || r.err != nil {
+				return nil, errInvalidHEIC
+			}
+			start, end := base+offset, base+offset+length
+			if length == 0 {
+				end = uint64(len(file))
+			}
+			if start > end || end > uint64(len(file)) {
+				return nil, errInvalidHEIC
+			}
+			return file[start:end], nil
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return nil, errInvalidHEIC
+}
+
+// dimensions returns the size of the item from its image spatial extents
+// property, or the largest one found if the item has none.
+func dimensions(iprp *box, item uint32) (int, int) {
+	children, err := boxes(iprp.data)
+	if err != nil {
+		return 0, 0
+	}
+	ipco := find(children, "ipco")
+	if ipco == nil {
+		return 0, 0
+	}
+	props, err := boxes(ipco.data)
+	if err != nil {
+		return 0, 0
+	}
+
+	size := func(p *box) (int, int) {
+		_, _, data, err := fullBox(p)
+		if err != nil || p.typ != "ispe" {
+			return 0, 0
+		}
+		r := &reader{b: data}
+		w, h := int(r.uint(4)), int(r.uint(4))
+		if r.err != nil {
+			return 0, 0
+		}
+		return w, h
+	}
+
+	for _, idx := range associations(find(children, "ipma"), item) {
+		if idx > 0 && idx <= len(props) {
+			if w, h := size(props[idx-1]); w > 0 {
+				return w, h
+			}
+		}
+	}
+
+	var width, height int
+	for _, p := range props {
+		if w, h := size(p); w*h > width*height {
+			width, height = w, h
+		}
+	}
+	return width, height
+}
+
+// associations returns the 1-based indexes of the properties of the item.
+func associations(ipma *box, item uint32) []int {
+	version, flags, data, err := fullBox(ipma)
+	if err != nil {
+		return nil
+	}
+	r := &reader{b: data}
+	count := r.uint(4)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		var id uint32
+		if version < 1 {
+			id = uint32(r.uint(2))
+		} else {
+			id = uint32(r.uint(4))
+		}
+		n := r.uint(1)
+		var idx []int
+		for j := uint64(0); j < n && r.err == nil; j++ {
+			// the high bit tells whether the property is essential
+			if flags&1 == 1 {
+				idx = append(idx, int(r.uint(2)&0x7fff))
+			} else {
+				idx = append(idx, int(r.uint(1)&0x7f))
+			}
+		}
+		if id == item && r.err == nil {
+			return idx
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package image extracts the dimensions, capture date and GPS presence of
+// JPEG, PNG, GIF and HEIC images.
+package image
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"path"
+	"strconv"
+	"strings"
+
+	// register the decoders read by image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/metadata"
+	"github.com/cs3org/reva/pkg/metadata/extractor/registry"
+)
+
+func init() {
+	registry.Register("image", New)
+}
+
+// the extensions of the images whose mime type is often unknown
+var extensions = map[string]bool{".heic": true, ".heif": true, ".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+type extractor struct{}
+
+// New returns an extractor of the image metadata, it has no configuration.
+func New(m map[string]interface{}) (metadata.Extractor, error) {
+	return &extractor{}, nil
+}
+
+func (e *extractor) Handles(info *provider.ResourceInfo) bool {
+	if info.Type != provider.ResourceType_RESOURCE_TYPE_FILE {
+		return false
+	}
+	return strings.HasPrefix(info.MimeType, "image/") || extensions[strings.ToLower(path.Ext(info.Path))]
+}
+
+func (e *extractor) Extract(ctx context.Context, content []byte) (map[string]string, error) {
+	var width, height int
+	var tiff []byte
+	switch {
+	case isHEIC(content):
+		img, err := parseHEIC(content)
+		if err != nil {
+			return nil, nil
+		}
+		width, height, tiff = img.width, img.height, img.exif
+	default:
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+		if err != nil {
+			return nil, nil
+		}
+		width, height = cfg.Width, cfg.Height
+		if isJPEG(content) {
+			tiff = jpegExif(content)
+		}
+	}
+
+	md := map[string]string{}
+	if width > 0 && height > 0 {
+		md[metadata.KeyImageWidth] = strconv.Itoa(width)
+		md[metadata.KeyImageHeight] = strconv.Itoa(height)
+	}
+	if tiff != nil {
+		// unreadable EXIF data does not make the dimensions wrong
+		if x, err := parseExif(tiff); err == nil {
+			if x.taken != "" {
+				md[metadata.KeyImageTaken] = x.taken
+			}
+			if x.gps {
+				md[metadata.KeyImageGPS] = "1"
+			}
+		}
+	}
+	return md, nil
+}
+
+func isJPEG(b []byte) bool {
+	return len(b) > 3 && b[0] == 0xff && b[1] == 0xd8 && b[2] == 0xff
+}
+
+// jpegExif returns the TIFF structured EXIF data of the APP1 segment of a
+// JPEG, nil if there is none.
+func jpegExif(b []byte) []byte {
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xff {
+			return nil
+		}
+		marker := b[i+1]
+		switch {
+		case marker == 0xff:
+			// fill byte
+			i++
+			continue
+		case marker == 0xd8 || marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// markers without a length
+			i += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// the image data starts, the metadata segments come before it
+			return nil
+		}
+		n := int(b[i+2])<<8 | int(b[i+3])
+		if n < 2 || i+2+n > len(b) {
+			return nil
+		}
+		seg := b[i+4 : i+2+n]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		i += 2 + n
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/metadata"
+)
+
+// testExif returns little endian TIFF structured EXIF data with a capture
+// date, its offset and GPS coordinates.
+func testExif() []byte {
+	le := binary.LittleEndian
+	b := []byte("II*\x00")
+	b = put32(le, b, 8)
+
+	entry := func(b []byte, tag, typ uint16, count, value uint32) []byte {
+		b = put16(le, b, tag)
+		b = put16(le, b, typ)
+		b = put32(le, b, count)
+		return put32(le, b, value)
+	}
+
+	// IFD0 at 8: 2 entries, 2+2*12+4 bytes
+	b = put16(le, b, 2)
+	b = entry(b, tagExifIFD, typeLong, 1, 38)
+	b = entry(b, tagGPSIFD, typeLong, 1, 68)
+	b = put32(le, b, 0)
+
+	// Exif IFD at 38: 2 entries, the values at 86
+	b = put16(le, b, 2)
+	b = entry(b, tagDateTimeOriginal, typeASCII, 20, 86)
+	b = entry(b, tagOffsetTimeOriginal, typeASCII, 7, 106)
+	b = put32(le, b, 0)
+
+	// GPS IFD at 68: 1 entry
+	b = put16(le, b, 1)
+	b = entry(b, tagGPSLatitude, 5, 3, 0)
+	b = put32(le, b, 0)
+
+	b = append(b, "2021:03:04 05:06:07\x00"...)
+	b = append(b, "+02:00\x00"...)
+	return b
+}
+
+func testImage() image.Image {
+	return image.NewRGBA(image.Rect(0, 0, 40, 30))
+}
+
+func testJPEG(t *testing.T, exif []byte) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if exif == nil {
+		return buf.Bytes()
+	}
+	seg := append([]byte("Exif\x00\x00"), exif...)
+	app1 := []byte{0xff, 0xe1, byte((len(seg) + 2) >> 8), byte(len(seg) + 2)}
+	b := append([]byte{}, buf.Bytes()[:2]...)
+	b = append(b, app1...)
+	b = append(b, seg...)
+	return append(b, buf.Bytes()[2:]...)
+}
+
+func heicBox(typ string, data ...[]byte) []byte {
+	content := bytes.Join(data, nil)
+	b := put32(binary.BigEndian, nil, uint32(8+len(content)))
+	b = append(b, typ...)
+	return append(b, content...)
+}
+
+// testHEIC returns a HEIF file whose primary item is 4032x3024 with a
+// thumbnail and EXIF data.
+func testHEIC(exif []byte) []byte {
+	be := binary.BigEndian
+	full := []byte{0, 0, 0, 0}
+
+	ftyp := heicBox("ftyp", []byte("heic"), []byte{0, 0, 0, 0}, []byte("mif1heic"))
+	pitm := heicBox("pitm", full, put16(be, nil, 1))
+	infe := func(id uint16, typ string) []byte {
+		return heicBox("infe", []byte{2, 0, 0, 0}, put16(be, nil, id), []byte{0, 0}, []byte(typ), []byte{0})
+	}
+	iinf := heicBox("iinf", full, put16(be, nil, 2), infe(1, "hvc1"), infe(2, "Exif"))
+	ispe := func(w, h uint32) []byte {
+		return heicBox("ispe", full, put32(be, put32(be, nil, w), h))
+	}
+	ipco := heicBox("ipco", ispe(512, 512), ispe(4032, 3024))
+	// item 1 is associated with the second property
+	ipma := heicBox("ipma", full, put32(be, nil, 1), put16(be, nil, 1), []byte{1, 0x82})
+	iprp := heicBox("iprp", ipco, ipma)
+
+	payload := append(put32(be, nil, 6), "Exif\x00\x00"...)
+	payload = append(payload, exif...)
+
+	// iloc version 0, 4 byte offsets and lengths, one item with one extent
+	iloc := func(offset uint32) []byte {
+		data := []byte{0x44, 0x00}
+		data = put16(be, data, 1)
+		data = put16(be, data, 2)
+		data = put16(be, data, 0)
+		data = put16(be, data, 1)
+		data = put32(be, data, offset)
+		data = put32(be, data, uint32(len(payload)))
+		return heicBox("iloc", full, data)
+	}
+	meta := func(offset uint32) []byte {
+		return heicBox("meta", full, heicBox("hdlr", full, []byte("\x00\x00\x00\x00pict")), pitm, iinf, iloc(offset), iprp)
+	}
+
+	// the payload follows the header of the mdat box after the meta box
+	offset := uint32(len(ftyp) + len(meta(0)) + 8)
+	b := append(ftyp, meta(offset)...)
+	return append(b, heicBox("mdat", payload)...)
+}
+
+func TestExtract(t *testing.T) {
+	var gifBuf, pngBuf bytes.Buffer
+	if err := gif.Encode(&gifBuf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&pngBuf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		md      map[string]string
+	}{
+		{"gif", gifBuf.Bytes(), map[string]string{metadata.KeyImageWidth: "40", metadata.KeyImageHeight: "30"}},
+		{"png", pngBuf.Bytes(), map[string]string{metadata.KeyImageWidth: "40", metadata.KeyImageHeight: "30"}},
+		{"jpeg", testJPEG(t, nil), map[string]string{metadata.KeyImageWidth: "40", metadata.KeyImageHeight: "30"}},
+		{"jpeg with exif", testJPEG(t, testExif()), map[string]string{
+			metadata.KeyImageWidth:  "40",
+			metadata.KeyImageHeight: "30",
+			metadata.KeyImageTaken:  "2021-03-04T05:06:07+02:00",
+			metadata.KeyImageGPS:    "1",
+		}},
+		{"heic", testHEIC(testExif()), map[string]string{
+			metadata.KeyImageWidth:  "4032",
+			metadata.KeyImageHeight: "3024",
+			metadata.KeyImageTaken:  "2021-03-04T05:06:07+02:00",
+			metadata.KeyImageGPS:    "1",
+		}},
+		{"text", []byte("not an image"), nil},
+	}
+
+	e, _ := New(nil)
+	for _, tt := range tests {
+		md, err := e.Extract(context.Background(), tt.content)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(md) != len(tt.md) {
+			t.Errorf("%s: got %v, expected %v", tt.name, md, tt.md)
+			continue
+		}
+		for k, v := range tt.md {
+			if md[k] != v {
+				t.Errorf("%s: %s = %q, expected %q", tt.name, k, md[k], v)
+			}
+		}
+	}
+}
+
+func TestHandles(t *testing.T) {
+	e, _ := New(nil)
+	file := provider.ResourceType_RESOURCE_TYPE_FILE
+	tests := []struct {
+		info    *provider.ResourceInfo
+		handles bool
+	}{
+		{&provider.ResourceInfo{Type: file, Path: "/a.jpg", MimeType: "image/jpeg"}, true},
+		{&provider.ResourceInfo{Type: file, Path: "/IMG_0001.HEIC", MimeType: "application/octet-stream"}, true},
+		{&provider.ResourceInfo{Type: file, Path: "/notes.txt", MimeType: "text/plain"}, false},
+		{&provider.ResourceInfo{Type: provider.ResourceType_RESOURCE_TYPE_CONTAINER, Path: "/photos.jpg"}, false},
+	}
+	for _, tt := range tests {
+		if got := e.Handles(tt.info); got != tt.handles {
+			t.Errorf("Handles(%s) = %v, expected %v", tt.info.Path, got, tt.handles)
+		}
+	}
+}
+
+func put16(o binary.ByteOrder, b []byte, v uint16) []byte {
+	var x [2]byte
+	o.PutUint16(x[:], v)
+	return append(b, x[:]...)
+}
+
+func put32(o binary.ByteOrder, b []byte, v uint32) []byte {
+	var x [4]byte
+	o.PutUint32(x[:], v)
+	return append(b, x[:]...)
+}
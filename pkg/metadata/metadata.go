@@ -0,0 +1,78 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package metadata extracts metadata from the content of the files, which is
+// stored as arbitrary metadata of the resources.
+package metadata
+
+import (
+	"context"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// Namespace is the namespace of the extracted metadata keys, they are
+// returned by PROPFIND as properties of the oc namespace.
+const Namespace = "http://owncloud.org/ns/"
+
+// The arbitrary metadata keys of the image metadata.
+const (
+	// KeyImageWidth and KeyImageHeight are the dimensions in pixels.
+	KeyImageWidth  = Namespace + "image-width"
+	KeyImageHeight = Namespace + "image-height"
+	// KeyImageTaken is the capture date, formatted as 2006-01-02T15:04:05
+	// followed by the UTC offset when the camera recorded it.
+	KeyImageTaken = Namespace + "image-taken"
+	// KeyImageGPS is set to "1" when the image carries GPS coordinates.
+	KeyImageGPS = Namespace + "image-gps"
+)
+
+// KeyClassification holds the comma separated labels of the classification
+// of the content, like confidential, given by the post-processing.
+const KeyClassification = Namespace + "classification"
+
+// Extractor reads metadata from the content of files.
+type Extractor interface {
+	// Handles tells whether the extractor reads metadata from the resource,
+	// the content of the other resources is not downloaded.
+	Handles(info *provider.ResourceInfo) bool
+	// Extract returns the metadata found in the content, keyed by arbitrary
+	// metadata key. Content the extractor does not understand gives no
+	// metadata rather than an error.
+	Extract(ctx context.Context, content []byte) (map[string]string, error)
+}
+
+// IsExtracted tells whether the arbitrary metadata key holds extracted metadata.
+func IsExtracted(key string) bool {
+	return strings.HasPrefix(key, Namespace+"image-") || key == KeyClassification
+}
+
+// Extracted returns the extracted metadata among the arbitrary metadata.
+func Extracted(md map[string]string) map[string]string {
+	var res map[string]string
+	for k, v := range md {
+		if IsExtracted(k) {
+			if res == nil {
+				res = map[string]string{}
+			}
+			res[strings.TrimPrefix(k, Namespace)] = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,37 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package metadata
+
+import "testing"
+
+func TestExtracted(t *testing.T) {
+	md := map[string]string{
+		KeyImageWidth:                     "40",
+		KeyImageGPS:                       "1",
+		KeyClassification:                 "confidential",
+		"http://owncloud.org/ns/favorite": "1",
+	}
+	got := Extracted(md)
+	if len(got) != 3 || got["image-width"] != "40" || got["image-gps"] != "1" || got["classification"] != "confidential" {
+		t.Fatalf("unexpected extracted metadata: %v", got)
+	}
+	if Extracted(map[string]string{"http://owncloud.org/ns/favorite": "1"}) != nil {
+		t.Fatal("expected no extracted metadata")
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package metrics defines the measures and views used to instrument
+// the HTTP and gRPC services. The views are exported in Prometheus format
+// by the prometheus HTTP service.
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Tag keys used to label the measures.
+var (
+	KeyService = tag.MustNewKey("service")
+	KeyMethod  = tag.MustNewKey("method")
+	KeyCode    = tag.MustNewKey("code")
+	// KeyEndpoint and KeyState label the connections of the gRPC client pool.
+	KeyEndpoint = tag.MustNewKey("endpoint")
+	KeyState    = tag.MustNewKey("state")
+)
+
+// Measures recorded by the HTTP and gRPC interceptors.
+var (
+	HTTPLatency  = stats.Float64("revad/http/server/latency", "Latency of HTTP requests", stats.UnitMilliseconds)
+	HTTPInFlight = stats.Int64("revad/http/server/in_flight", "Number of HTTP requests being served", stats.UnitDimensionless)
+	GRPCLatency  = stats.Float64("revad/grpc/server/latency", "Latency of gRPC calls", stats.UnitMilliseconds)
+	GRPCInFlight = stats.Int64("revad/grpc/server/in_flight", "Number of gRPC calls being served", stats.UnitDimensionless)
+)
+
+// Measures recorded by the gRPC client pool.
+var (
+	GRPCPoolConns    = stats.Int64("revad/grpc/client/pool/connections", "Number of pooled gRPC connections", stats.UnitDimensionless)
+	GRPCPoolInFlight = stats.Int64("revad/grpc/client/pool/in_flight", "Number of calls in flight on pooled gRPC connections", stats.UnitDimensionless)
+	GRPCPoolDials    = stats.Int64("revad/grpc/client/pool/dials", "Number of gRPC connections dialed by the pool", stats.UnitDimensionless)
+	GRPCPoolRetries  = stats.Int64("revad/grpc/client/pool/retries", "Number of gRPC calls retried by the pool", stats.UnitDimensionless)
+	GRPCPoolHedges   = stats.Int64("revad/grpc/client/pool/hedges", "Number of hedged gRPC calls sent by the pool", stats.UnitDimensionless)
+)
+
+// latencyBounds are the bucket boundaries of the latency histograms, in milliseconds.
+var latencyBounds = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// DefaultViews are the views of the measures defined in this package.
+var DefaultViews = []*view.View{
+	{
+		Name:        "http/server/requests",
+		Description: "Number of HTTP requests by service, method and status code",
+		Measure:     HTTPLatency,
+		TagKeys:     []tag.Key{KeyService, KeyMethod, KeyCode},
+		Aggregation: view.Count(),
+	},
+	{
+		Name:        "http/server/latency",
+		Description: "Latency distribution of HTTP requests by service and method",
+		Measure:     HTTPLatency,
+		TagKeys:     []tag.Key{KeyService, KeyMethod},
+		Aggregation: view.Distribution(latencyBounds...),
+	},
+	{
+		Name:        "http/server/in_flight",
+		Description: "Number of HTTP requests being served by service and method",
+		Measure:     HTTPInFlight,
+		TagKeys:     []tag.Key{KeyService, KeyMethod},
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "grpc/server/requests",
+		Description: "Number of gRPC calls by service, method and status code",
+		Measure:     GRPCLatency,
+		TagKeys:     []tag.Key{KeyService, KeyMethod, KeyCode},
+		Aggregation: view.Count(),
+	},
+	{
+		Name:        "grpc/server/latency",
+		Description: "Latency distribution of gRPC calls by service and method",
+		Measure:     GRPCLatency,
+		TagKeys:     []tag.Key{KeyService, KeyMethod},
+		Aggregation: view.Distribution(latencyBounds...),
+	},
+	{
+		Name:        "grpc/server/in_flight",
+		Description: "Number of gRPC calls being served by service and method",
+		Measure:     GRPCInFlight,
+		TagKeys:     []tag.Key{KeyService, KeyMethod},
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "grpc/client/pool/connections",
+		Description: "Number of pooled gRPC connections by endpoint and connectivity state",
+		Measure:     GRPCPoolConns,
+		TagKeys:     []tag.Key{KeyEndpoint, KeyState},
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "grpc/client/pool/in_flight",
+		Description: "Number of calls in flight on pooled gRPC connections by endpoint",
+		Measure:     GRPCPoolInFlight,
+		TagKeys:     []tag.Key{KeyEndpoint},
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "grpc/client/pool/dials",
+		Description: "Number of gRPC connections dialed by the pool by endpoint",
+		Measure:     GRPCPoolDials,
+		TagKeys:     []tag.Key{KeyEndpoint},
+		Aggregation: view.Count(),
+	},
+	{
+		Name:        "grpc/client/pool/retries",
+		Description: "Number of gRPC calls retried by the pool by endpoint",
+		Measure:     GRPCPoolRetries,
+		TagKeys:     []tag.Key{KeyEndpoint},
+		Aggregation: view.Count(),
+	},
+	{
+		Name:        "grpc/client/pool/hedges",
+		Description: "Number of hedged gRPC calls sent by the pool by endpoint",
+		Measure:     GRPCPoolHedges,
+		TagKeys:     []tag.Key{KeyEndpoint},
+		Aggregation: view.Count(),
+	},
+}
+
+// Call tracks a call being served.
+type Call struct {
+	ctx      context.Context
+	start    time.Time
+	latency  *stats.Float64Measure
+	inFlight *stats.Int64Measure
+	counter  *int64
+}
+
+// the in-flight gauges are recorded as last values, so we keep the running
+// count per service and method.
+var inFlight sync.Map // map[string]*int64
+
+func counterFor(kind, service, method string) *int64 {
+	v, _ := inFlight.LoadOrStore(kind+"|"+service+"|"+method, new(int64))
+	return v.(*int64)
+}
+
+// StartHTTP records the start of an HTTP request.
+func StartHTTP(ctx context.Context, service, method string) *Call {
+	return start(ctx, "http", service, method, HTTPLatency, HTTPInFlight)
+}
+
+// StartGRPC records the start of a gRPC call.
+func StartGRPC(ctx context.Context, service, method string) *Call {
+	return start(ctx, "grpc", service, method, GRPCLatency, GRPCInFlight)
+}
+
+func start(ctx context.Context, kind, service, method string, latency *stats.Float64Measure, gauge *stats.Int64Measure) *Call {
+	ctx, _ = tag.New(ctx, tag.Upsert(KeyService, service), tag.Upsert(KeyMethod, method))
+	c := &Call{
+		ctx:      ctx,
+		start:    time.Now(),
+		latency:  latency,
+		inFlight: gauge,
+		counter:  counterFor(kind, service, method),
+	}
+	stats.Record(ctx, gauge.M(atomic.AddInt64(c.counter, 1)))
+	return c
+}
+
+// End records the end of the call with the given status code.
+func (c *Call) End(code string) {
+	stats.Record(c.ctx, c.inFlight.M(atomic.AddInt64(c.counter, -1)))
+
+	ms := float64(time.Since(c.start)) / float64(time.Millisecond)
+	ctx, _ := tag.New(c.ctx, tag.Upsert(KeyCode, code))
+	stats.Record(ctx, c.latency.M(ms))
+}
@@ -0,0 +1,62 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package notification
+
+import (
+	"context"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+)
+
+// Events the users are notified of.
+const (
+	// EventShareCreated is sent to the grantee of a new user share.
+	EventShareCreated = "share_created"
+	// EventOCMShareReceived is sent to the local grantee of an OCM share.
+	EventOCMShareReceived = "ocm_share_received"
+	// EventPublicShareExpiring is sent to the owner of a public link about to expire.
+	EventPublicShareExpiring = "public_share_expiring"
+)
+
+// Message is a notification ready to be delivered.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// Data is what the templates of the notifications are rendered with.
+type Data struct {
+	// Recipient is the user being notified.
+	Recipient *userpb.User
+	// Sharer is the display name of the user who shared the resource.
+	Sharer string
+	// Resource is the path or the name of the shared resource.
+	Resource string
+	// Token is the token of a public link.
+	Token string
+	// Expiration is when the share expires, if it does.
+	Expiration time.Time
+}
@@ -0,0 +1,188 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/notification"
+	"github.com/cs3org/reva/pkg/notification/sender/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+type templateConfig struct {
+	Subject string `mapstructure:"subject"`
+	Body    string `mapstructure:"body"`
+}
+
+type config struct {
+	Sender  string                            `mapstructure:"sender"`
+	Senders map[string]map[string]interface{} `mapstructure:"senders"`
+	// Templates override the default templates, keyed by event.
+	Templates map[string]templateConfig `mapstructure:"templates"`
+}
+
+var defaultTemplates = map[string]templateConfig{
+	notification.EventShareCreated: {
+		Subject: `{{.Sharer}} shared {{.Resource}} with you`,
+		Body: `Hello {{.Recipient.DisplayName}},
+
+{{.Sharer}} shared {{.Resource}} with you.
+`,
+	},
+	notification.EventOCMShareReceived: {
+		Subject: `{{.Sharer}} shared {{.Resource}} with you`,
+		Body: `Hello {{.Recipient.DisplayName}},
+
+{{.Sharer}} shared {{.Resource}} with you through the Open Cloud Mesh.
+`,
+	},
+	notification.EventPublicShareExpiring: {
+		Subject: `Your public link to {{.Resource}} expires soon`,
+		Body: `Hello {{.Recipient.DisplayName}},
+
+your public link to {{.Resource}} expires on {{.Expiration.Format "2006-01-02 15:04 MST"}}.
+`,
+	},
+}
+
+type messageTemplate struct {
+	subject, body *template.Template
+}
+
+// Notifier renders the notifications of the events and sends them to the users.
+type Notifier struct {
+	sender    notification.Sender
+	templates map[string]*messageTemplate
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a notifier sending the messages with the configured sender.
+func New(m map[string]interface{}) (*Notifier, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Sender == "" {
+		c.Sender = "smtp"
+	}
+	f, ok := registry.NewFuncs[c.Sender]
+	if !ok {
+		return nil, fmt.Errorf("notifier: sender not found: %s", c.Sender)
+	}
+	s, err := f(c.Senders[c.Sender])
+	if err != nil {
+		return nil, err
+	}
+
+	return newNotifier(s, c.Templates)
+}
+
+func newNotifier(s notification.Sender, overrides map[string]templateConfig) (*Notifier, error) {
+	n := &Notifier{
+		sender:    s,
+		templates: map[string]*messageTemplate{},
+	}
+	for event, tc := range defaultTemplates {
+		if o, ok := overrides[event]; ok {
+			if o.Subject != "" {
+				tc.Subject = o.Subject
+			}
+			if o.Body != "" {
+				tc.Body = o.Body
+			}
+		}
+
+		t := &messageTemplate{}
+		var err error
+		if t.subject, err = template.New(event + "-subject").Parse(tc.Subject); err != nil {
+			return nil, errors.Wrapf(err, "notifier: invalid subject template for %s", event)
+		}
+		if t.body, err = template.New(event + "-body").Parse(tc.Body); err != nil {
+			return nil, errors.Wrapf(err, "notifier: invalid body template for %s", event)
+		}
+		n.templates[event] = t
+	}
+	for event := range overrides {
+		if _, ok := defaultTemplates[event]; !ok {
+			return nil, fmt.Errorf("notifier: unknown event: %s", event)
+		}
+	}
+	return n, nil
+}
+
+// Notify sends the notification of the event to the recipient of d.
+// Recipients without a mail address are not notified.
+func (n *Notifier) Notify(ctx context.Context, event string, d *notification.Data) error {
+	if d.Recipient.GetMail() == "" {
+		return nil
+	}
+
+	m, err := n.render(event, d)
+	if err != nil {
+		return err
+	}
+	return n.sender.Send(ctx, m)
+}
+
+// NotifyInBackground sends the notification without waiting for its delivery,
+// logging the errors.
+func (n *Notifier) NotifyInBackground(ctx context.Context, event string, d *notification.Data) {
+	log := appctx.GetLogger(ctx)
+	go func() {
+		if err := n.Notify(context.Background(), event, d); err != nil {
+			log.Error().Err(err).Str("event", event).Msg("notifier: error sending notification")
+		}
+	}()
+}
+
+func (n *Notifier) render(event string, d *notification.Data) (*notification.Message, error) {
+	t, ok := n.templates[event]
+	if !ok {
+		return nil, fmt.Errorf("notifier: unknown event: %s", event)
+	}
+
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, d); err != nil {
+		return nil, errors.Wrap(err, "notifier: error rendering subject")
+	}
+	if err := t.body.Execute(&body, d); err != nil {
+		return nil, errors.Wrap(err, "notifier: error rendering body")
+	}
+
+	return &notification.Message{
+		To:      d.Recipient.Mail,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package notifier
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/notification"
+)
+
+type fakeSender struct {
+	sent []*notification.Message
+}
+
+func (s *fakeSender) Send(ctx context.Context, m *notification.Message) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	s := &fakeSender{}
+	n, err := newNotifier(s, map[string]templateConfig{
+		notification.EventShareCreated: {Subject: "New share: {{.Resource}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &notification.Data{
+		Recipient: &userpb.User{DisplayName: "Albert Einstein", Mail: "einstein@example.org"},
+		Sharer:    "Marie Curie",
+		Resource:  "notes.txt",
+	}
+	if err := n.Notify(context.Background(), notification.EventShareCreated, d); err != nil {
+		t.Fatal(err)
+	}
+	// users without mail are skipped
+	if err := n.Notify(context.Background(), notification.EventShareCreated, &notification.Data{Recipient: &userpb.User{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.sent) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(s.sent))
+	}
+	m := s.sent[0]
+	if m.To != "einstein@example.org" || m.Subject != "New share: notes.txt" {
+		t.Errorf("unexpected message %+v", m)
+	}
+	if expected := "Hello Albert Einstein,\n\nMarie Curie shared notes.txt with you.\n"; m.Body != expected {
+		t.Errorf("got body %q, expected %q", m.Body, expected)
+	}
+}
+
+func TestUnknownEvent(t *testing.T) {
+	if _, err := newNotifier(&fakeSender{}, map[string]templateConfig{"unknown": {}}); err == nil {
+		t.Error("expected an error for an unknown event")
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/notification"
+	"github.com/cs3org/reva/pkg/notification/sender/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("smtp", New)
+}
+
+type config struct {
+	SMTPServer     string `mapstructure:"smtp_server"`
+	SMTPPort       int    `mapstructure:"smtp_port"`
+	SenderMail     string `mapstructure:"sender_mail"`
+	SenderLogin    string `mapstructure:"sender_login"`
+	SenderPassword string `mapstructure:"sender_password"`
+	// DisableTLS does not upgrade the connection with STARTTLS, even if the server supports it.
+	DisableTLS bool `mapstructure:"disable_tls"`
+	Insecure   bool `mapstructure:"insecure"`
+	// Timeout is the maximum duration of the delivery of a message in seconds.
+	Timeout int `mapstructure:"timeout"`
+}
+
+type sender struct {
+	c    *config
+	from *mail.Address
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a sender that delivers the messages to an SMTP server,
+// authenticating when a login is configured.
+func New(m map[string]interface{}) (notification.Sender, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.SenderMail == "" {
+		return nil, errors.New("smtp: sender_mail is not set")
+	}
+	from, err := parseAddress(c.SenderMail)
+	if err != nil {
+		return nil, errors.Wrap(err, "smtp: invalid sender_mail")
+	}
+	if c.SMTPServer == "" {
+		c.SMTPServer = "localhost"
+	}
+	if c.SMTPPort == 0 {
+		c.SMTPPort = 25
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 30
+	}
+
+	return &sender{c: c, from: from}, nil
+}
+
+// parseAddress parses a single mail address. The line breaks are rejected,
+// they would let the address add headers or recipients to the message.
+func parseAddress(s string) (*mail.Address, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, errors.New("line break in mail address")
+	}
+	return mail.ParseAddress(s)
+}
+
+// header formats the address for the headers of the message.
+func header(a *mail.Address) string {
+	if a.Name == "" {
+		return a.Address
+	}
+	return a.String()
+}
+
+func (s *sender) Send(ctx context.Context, m *notification.Message) error {
+	to, err := parseAddress(m.To)
+	if err != nil {
+		return errors.Wrap(err, "smtp: invalid recipient")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.c.Timeout)*time.Second)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.c.SMTPServer, strconv.Itoa(s.c.SMTPPort))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "smtp: error connecting to server")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.c.SMTPServer)
+	if err != nil {
+		return errors.Wrap(err, "smtp: error greeting server")
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !s.c.DisableTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: s.c.SMTPServer, InsecureSkipVerify: s.c.Insecure}); err != nil {
+			return errors.Wrap(err, "smtp: error starting tls")
+		}
+	}
+	if s.c.SenderLogin != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.c.SenderLogin, s.c.SenderPassword, s.c.SMTPServer)); err != nil {
+			return errors.Wrap(err, "smtp: error authenticating")
+		}
+	}
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return errors.Wrap(err, "smtp: error setting sender")
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return errors.Wrap(err, "smtp: error setting recipient")
+	}
+	w, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "smtp: error starting message")
+	}
+	if _, err := w.Write(s.message(to, m, time.Now())); err != nil {
+		return errors.Wrap(err, "smtp: error writing message")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "smtp: error sending message")
+	}
+	return client.Quit()
+}
+
+// message formats m as a plain text mail to the recipient.
+func (s *sender) message(to *mail.Address, m *notification.Message, t time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", header(s.from))
+	fmt.Fprintf(&b, "To: %s\r\n", header(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", t.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(m.Body)
+	return b.Bytes()
+}
@@ -0,0 +1,142 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/notification"
+)
+
+// fakeSMTP accepts one message and sends its data on the channel.
+func fakeSMTP(t *testing.T, ln net.Listener, data chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	reply := func(s string) {
+		_, _ = w.WriteString(s + "\r\n")
+		_ = w.Flush()
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"), strings.HasPrefix(cmd, "RCPT TO:"):
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			data <- b.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			t.Errorf("unexpected command %q", cmd)
+			reply("500 unknown")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	data := make(chan string, 1)
+	go fakeSMTP(t, ln, data)
+
+	addr := ln.Addr().(*net.TCPAddr)
+	s, err := New(map[string]interface{}{
+		"smtp_server": "127.0.0.1",
+		"smtp_port":   addr.Port,
+		"sender_mail": "reva@example.org",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &notification.Message{To: "einstein@example.org", Subject: "Shared with you", Body: "Hello"}
+	if err := s.Send(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-data
+	for _, expected := range []string{"From: reva@example.org\r\n", "To: einstein@example.org\r\n", "Subject: Shared with you\r\n", "\r\n\r\nHello"} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("message %q does not contain %q", got, expected)
+		}
+	}
+}
+
+func TestInvalidRecipient(t *testing.T) {
+	s, err := New(map[string]interface{}{
+		"smtp_server": "127.0.0.1",
+		"smtp_port":   1,
+		"sender_mail": "reva@example.org",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, to := range []string{
+		"einstein@example.org\r\nBcc: marie@example.org",
+		"einstein@example.org\nSubject: spoofed",
+		"einstein@example.org, marie@example.org",
+		"not an address",
+	} {
+		m := &notification.Message{To: to, Subject: "Shared with you", Body: "Hello"}
+		err := s.Send(context.Background(), m)
+		if err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+			t.Errorf("%q: expected an invalid recipient error, got %v", to, err)
+		}
+	}
+
+	if _, err := New(map[string]interface{}{"sender_mail": "reva@example.org\r\nBcc: x@example.org"}); err == nil {
+		t.Error("expected an error for a sender_mail with a line break")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package invite
+
+import (
+	"context"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+)
+
+// Token is an invitation a local user hands out so that remote users can become their contacts.
+type Token struct {
+	Token      string         `json:"token"`
+	UserID     *userpb.UserId `json:"user_id"`
+	Expiration time.Time      `json:"expiration"`
+}
+
+// Manager is the interface that manipulates the OCM invitations.
+type Manager interface {
+	// GenerateToken creates a new invitation token for the user in the context.
+	GenerateToken(ctx context.Context) (*Token, error)
+
+	// AcceptInvite consumes the token and stores the remote user
+	// as a contact of the user that generated it.
+	AcceptInvite(ctx context.Context, token string, remoteUser *userpb.User) error
+
+	// GetRemoteUser returns the remote user with the given id that accepted
+	// an invitation of the user in the context.
+	GetRemoteUser(ctx context.Context, remoteUserID *userpb.UserId) (*userpb.User, error)
+
+	// FindRemoteUsers returns the remote users of the user in the context matching the query.
+	FindRemoteUsers(ctx context.Context, query string) ([]*userpb.User, error)
+}
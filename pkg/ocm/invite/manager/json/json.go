@@ -0,0 +1,244 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/invite"
+	"github.com/cs3org/reva/pkg/ocm/invite/manager/registry"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+const defaultExpiration = 86400
+
+func init() {
+	registry.Register("json", New)
+}
+
+type config struct {
+	File string `mapstructure:"file"`
+	// Expiration is the number of seconds an invitation token stays valid.
+	Expiration int `mapstructure:"token_expiration"`
+}
+
+type inviteModel struct {
+	file          string
+	Invites       map[string]*invite.Token  `json:"invites"`        // map[token]token
+	AcceptedUsers map[string][]*userpb.User `json:"accepted_users"` // map[local user]remote users
+}
+
+type mgr struct {
+	c          *config
+	sync.Mutex // concurrent access to the file and model
+	model      *inviteModel
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	if c.Expiration == 0 {
+		c.Expiration = defaultExpiration
+	}
+	return c, nil
+}
+
+// New returns a new invite manager that persists the invitations to a json file.
+func New(m map[string]interface{}) (invite.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	// if file is not set we use temporary file
+	if c.File == "" {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			err = errors.Wrap(err, "error creating temporary directory for storing invites")
+			return nil, err
+		}
+		c.File = path.Join(dir, "invites.json")
+	}
+
+	model, err := loadOrCreate(c.File)
+	if err != nil {
+		err = errors.Wrap(err, "error loading the file containing the invites")
+		return nil, err
+	}
+
+	return &mgr{c: c, model: model}, nil
+}
+
+func loadOrCreate(file string) (*inviteModel, error) {
+	_, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		if err := ioutil.WriteFile(file, []byte("{}"), 0700); err != nil {
+			err = errors.Wrap(err, "error opening/creating the file: "+file)
+			return nil, err
+		}
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		err = errors.Wrap(err, "error reading the data")
+		return nil, err
+	}
+
+	m := &inviteModel{}
+	if err := json.Unmarshal(data, m); err != nil {
+		err = errors.Wrap(err, "error decoding data to json")
+		return nil, err
+	}
+
+	if m.Invites == nil {
+		m.Invites = map[string]*invite.Token{}
+	}
+	if m.AcceptedUsers == nil {
+		m.AcceptedUsers = map[string][]*userpb.User{}
+	}
+	m.file = file
+
+	return m, nil
+}
+
+func (m *inviteModel) Save() error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		err = errors.Wrap(err, "error encoding to json")
+		return err
+	}
+
+	if err := ioutil.WriteFile(m.file, data, 0644); err != nil {
+		err = errors.Wrap(err, "error writing to file: "+m.file)
+		return err
+	}
+
+	return nil
+}
+
+func userKey(id *userpb.UserId) string {
+	return id.Idp + "!" + id.OpaqueId
+}
+
+func (m *mgr) GenerateToken(ctx context.Context) (*invite.Token, error) {
+	u := user.ContextMustGetUser(ctx)
+	now := time.Now()
+
+	t := &invite.Token{
+		Token:      uuid.New().String(),
+		UserID:     u.Id,
+		Expiration: now.Add(time.Duration(m.c.Expiration) * time.Second),
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	// drop the tokens that can no longer be accepted
+	for k, v := range m.model.Invites {
+		if now.After(v.Expiration) {
+			delete(m.model.Invites, k)
+		}
+	}
+	m.model.Invites[t.Token] = t
+
+	if err := m.model.Save(); err != nil {
+		return nil, errors.Wrap(err, "error saving model")
+	}
+	return t, nil
+}
+
+func (m *mgr) AcceptInvite(ctx context.Context, token string, remoteUser *userpb.User) error {
+	m.Lock()
+	defer m.Unlock()
+
+	t, ok := m.model.Invites[token]
+	if !ok {
+		return errtypes.NotFound(token)
+	}
+	delete(m.model.Invites, token)
+	if time.Now().After(t.Expiration) {
+		if err := m.model.Save(); err != nil {
+			return errors.Wrap(err, "error saving model")
+		}
+		return errtypes.InvalidCredentials("invite token expired")
+	}
+
+	key := userKey(t.UserID)
+	users := m.model.AcceptedUsers[key]
+	for i, u := range users {
+		// a remote user accepting again refreshes its details
+		if userKey(u.Id) == userKey(remoteUser.Id) {
+			users = append(users[:i], users[i+1:]...)
+			break
+		}
+	}
+	m.model.AcceptedUsers[key] = append(users, remoteUser)
+
+	if err := m.model.Save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
+
+func (m *mgr) GetRemoteUser(ctx context.Context, remoteUserID *userpb.UserId) (*userpb.User, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, r := range m.model.AcceptedUsers[userKey(u.Id)] {
+		if r.Id.OpaqueId == remoteUserID.OpaqueId && (remoteUserID.Idp == "" || r.Id.Idp == remoteUserID.Idp) {
+			return r, nil
+		}
+	}
+	return nil, errtypes.NotFound(remoteUserID.OpaqueId)
+}
+
+func (m *mgr) FindRemoteUsers(ctx context.Context, query string) ([]*userpb.User, error) {
+	u := user.ContextMustGetUser(ctx)
+	query = strings.ToLower(query)
+
+	m.Lock()
+	defer m.Unlock()
+
+	users := []*userpb.User{}
+	for _, r := range m.model.AcceptedUsers[userKey(u.Id)] {
+		if strings.Contains(strings.ToLower(r.Id.OpaqueId), query) ||
+			strings.Contains(strings.ToLower(r.DisplayName), query) ||
+			strings.Contains(strings.ToLower(r.Mail), query) {
+			users = append(users, r)
+		}
+	}
+	return users, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func TestInviteWorkflow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "invites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "invites.json")
+
+	m, err := New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "einstein"}, Username: "einstein"}
+	ctx := user.ContextSetUser(context.Background(), einstein)
+
+	token, err := m.GenerateToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "cesnet.cz", OpaqueId: "marie"}, DisplayName: "Marie Curie"}
+	if err := m.AcceptInvite(context.Background(), token.Token, marie); err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens can only be used once
+	if err := m.AcceptInvite(context.Background(), token.Token, marie); err == nil {
+		t.Fatal("expected error accepting a consumed token")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	// the accepted users survive a restart
+	m, err = New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := m.GetRemoteUser(ctx, &userpb.UserId{OpaqueId: "marie"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id.Idp != "cesnet.cz" {
+		t.Fatalf("unexpected remote user: %+v", u)
+	}
+
+	users, err := m.FindRemoteUsers(ctx, "curie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("expected one remote user, got %d", len(users))
+	}
+
+	// remote users are only visible to the user who invited them
+	other := user.ContextSetUser(context.Background(), &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "richard"}})
+	if _, err := m.GetRemoteUser(other, &userpb.UserId{OpaqueId: "marie"}); err == nil {
+		t.Fatal("expected error getting a remote user of another user")
+	}
+}
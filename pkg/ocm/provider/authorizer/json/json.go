@@ -22,6 +22,10 @@ import (
 	"context"
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
 	"github.com/cs3org/reva/pkg/errtypes"
@@ -43,19 +47,11 @@ func New(m map[string]interface{}) (provider.Authorizer, error) {
 		return nil, err
 	}
 
-	f, err := ioutil.ReadFile(c.Providers)
-	if err != nil {
+	a := &authorizer{file: c.Providers}
+	if err := a.reload(); err != nil {
 		return nil, err
 	}
-	providers := []*ocm.ProviderInfo{}
-	err = json.Unmarshal(f, &providers)
-	if err != nil {
-		return nil, err
-	}
-
-	return &authorizer{
-		providers: providers,
-	}, nil
+	return a, nil
 }
 
 type config struct {
@@ -63,15 +59,132 @@ type config struct {
 	Providers string `mapstructure:"providers"`
 }
 
+// authorizer trusts the providers listed in the file. The file is read
+// again when it changes, so that the providers added or removed by another
+// instance, like the one of the ocmd service, are picked up.
 type authorizer struct {
+	sync.Mutex
+	file      string
 	providers []*ocm.ProviderInfo
+	mtime     time.Time
+	size      int64
+}
+
+// reload reads the providers if the file changed since it was last read.
+// It must be called with the lock held.
+func (a *authorizer) reload() error {
+	fi, err := os.Stat(a.file)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(a.mtime) && fi.Size() == a.size && a.providers != nil {
+		return nil
+	}
+
+	f, err := ioutil.ReadFile(a.file)
+	if err != nil {
+		return err
+	}
+	providers := []*ocm.ProviderInfo{}
+	err = json.Unmarshal(f, &providers)
+	if err != nil {
+		return err
+	}
+	a.providers = providers
+	a.mtime, a.size = fi.ModTime(), fi.Size()
+	return nil
+}
+
+// getProviders returns the providers, keeping the last good list when the
+// file can not be read.
+func (a *authorizer) getProviders() []*ocm.ProviderInfo {
+	a.Lock()
+	defer a.Unlock()
+	_ = a.reload()
+	return a.providers
 }
 
 func (a *authorizer) IsProviderAllowed(ctx context.Context, domain string) error {
-	for _, u := range a.providers {
+	for _, u := range a.getProviders() {
 		if u.Domain == domain {
 			return nil
 		}
 	}
 	return errtypes.NotFound(domain)
 }
+
+func (a *authorizer) ListAllProviders(ctx context.Context) ([]*ocm.ProviderInfo, error) {
+	return a.getProviders(), nil
+}
+
+func (a *authorizer) AddProvider(ctx context.Context, p *ocm.ProviderInfo) error {
+	if p.GetDomain() == "" {
+		return errors.New("json: provider domain is required")
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	if err := a.reload(); err != nil {
+		return errors.Wrap(err, "json: error reading providers")
+	}
+
+	providers := []*ocm.ProviderInfo{}
+	for _, e := range a.providers {
+		if e.Domain != p.Domain {
+			providers = append(providers, e)
+		}
+	}
+	return a.save(append(providers, p))
+}
+
+func (a *authorizer) RemoveProvider(ctx context.Context, domain string) error {
+	a.Lock()
+	defer a.Unlock()
+	if err := a.reload(); err != nil {
+		return errors.Wrap(err, "json: error reading providers")
+	}
+
+	providers := []*ocm.ProviderInfo{}
+	for _, e := range a.providers {
+		if e.Domain != domain {
+			providers = append(providers, e)
+		}
+	}
+	if len(providers) == len(a.providers) {
+		return errtypes.NotFound(domain)
+	}
+	return a.save(providers)
+}
+
+// save atomically replaces the file with the providers.
+// It must be called with the lock held.
+func (a *authorizer) save(providers []*ocm.ProviderInfo) error {
+	data, err := json.MarshalIndent(providers, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "json: error encoding providers")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(a.file), ".providers")
+	if err != nil {
+		return errors.Wrap(err, "json: error creating tmp file")
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "json: error writing providers")
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "json: error writing providers")
+	}
+	if err := os.Rename(tmp.Name(), a.file); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "json: error replacing providers file")
+	}
+
+	a.providers = providers
+	if fi, err := os.Stat(a.file); err == nil {
+		a.mtime, a.size = fi.ModTime(), fi.Size()
+	}
+	return nil
+}
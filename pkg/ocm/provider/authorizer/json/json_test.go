@@ -0,0 +1,83 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/cs3org/reva/pkg/ocm/provider"
+)
+
+func TestManageProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reva-providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "providers.json")
+	if err := ioutil.WriteFile(file, []byte(`[{"name": "cernbox", "domain": "cern.ch"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(map[string]interface{}{"providers": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another instance reading the same file, like the one of the middleware
+	other, err := New(map[string]interface{}{"providers": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	m := a.(provider.Manager)
+	if err := m.AddProvider(ctx, &ocm.ProviderInfo{Domain: "sciencemesh.io"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveProvider(ctx, "cern.ch"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveProvider(ctx, "cern.ch"); err == nil {
+		t.Error("expected removing an unknown provider to fail")
+	}
+
+	for _, auth := range []provider.Authorizer{a, other} {
+		if err := auth.IsProviderAllowed(ctx, "sciencemesh.io"); err != nil {
+			t.Errorf("expected sciencemesh.io to be allowed: %v", err)
+		}
+		if err := auth.IsProviderAllowed(ctx, "cern.ch"); err == nil {
+			t.Error("expected cern.ch not to be allowed anymore")
+		}
+	}
+
+	// the changes survive a restart
+	restarted, err := New(map[string]interface{}{"providers": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if providers, err := restarted.ListAllProviders(ctx); err != nil || len(providers) != 1 || providers[0].Domain != "sciencemesh.io" {
+		t.Errorf("expected only sciencemesh.io to be listed, got %v, %v", providers, err)
+	}
+}
@@ -22,5 +22,6 @@ import (
 	// Load core share manager drivers.
 	_ "github.com/cs3org/reva/pkg/ocm/provider/authorizer/json"
 	_ "github.com/cs3org/reva/pkg/ocm/provider/authorizer/memory"
+	_ "github.com/cs3org/reva/pkg/ocm/provider/authorizer/remote"
 	// Add your own here
 )
@@ -0,0 +1,181 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/provider"
+	"github.com/cs3org/reva/pkg/ocm/provider/authorizer/registry"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	registry.Register("remote", New)
+}
+
+type config struct {
+	// URL returns the json encoded list of trusted providers.
+	URL string `mapstructure:"url"`
+	// RefreshInterval is the number of seconds between the refreshes of the list.
+	RefreshInterval int `mapstructure:"refresh_interval"`
+}
+
+func (c *config) init() {
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = 300
+	}
+}
+
+// New returns an authorizer that trusts the providers listed by a remote discovery service.
+func New(m map[string]interface{}) (provider.Authorizer, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	c.init()
+
+	if c.URL == "" {
+		return nil, errors.New("remote: url is required")
+	}
+
+	a := &authorizer{
+		c:        c,
+		interval: time.Duration(c.RefreshInterval) * time.Second,
+	}
+	ctx, cancel := context.WithCancel(appctx.WithLogger(context.Background(), &log.Logger))
+	a.cancel = cancel
+	go a.run(ctx)
+	return a, nil
+}
+
+type authorizer struct {
+	c        *config
+	interval time.Duration
+	cancel   context.CancelFunc
+
+	mu        sync.RWMutex
+	providers []*ocm.ProviderInfo
+}
+
+func (a *authorizer) IsProviderAllowed(ctx context.Context, domain string) error {
+	providers, err := a.getProviders(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range providers {
+		if p.Domain == domain {
+			return nil
+		}
+	}
+	return errtypes.NotFound(domain)
+}
+
+func (a *authorizer) ListAllProviders(ctx context.Context) ([]*ocm.ProviderInfo, error) {
+	return a.getProviders(ctx)
+}
+
+// Close stops the refresh of the list of providers.
+func (a *authorizer) Close() error {
+	a.cancel()
+	return nil
+}
+
+// getProviders returns the last good list of providers, which is refreshed in
+// the background. The list is only fetched with the request when it was never
+// fetched, e.g. because the service was unreachable at startup.
+func (a *authorizer) getProviders(ctx context.Context) ([]*ocm.ProviderInfo, error) {
+	a.mu.RLock()
+	providers := a.providers
+	a.mu.RUnlock()
+	if providers != nil {
+		return providers, nil
+	}
+	return a.refresh(ctx)
+}
+
+// run refreshes the list of providers every interval, until ctx is canceled.
+func (a *authorizer) run(ctx context.Context) {
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+	for {
+		if _, err := a.refresh(ctx); err != nil && ctx.Err() == nil {
+			appctx.GetLogger(ctx).Warn().Err(err).Str("url", a.c.URL).Msg("remote: using last known list of providers")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// refresh fetches the list of providers and keeps it on success. The lock is
+// not held during the fetch, so that the requests are served meanwhile.
+func (a *authorizer) refresh(ctx context.Context) ([]*ocm.ProviderInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.interval)
+	defer cancel()
+	providers, err := a.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.providers = providers
+	a.mu.Unlock()
+	return providers, nil
+}
+
+func (a *authorizer) fetch(ctx context.Context) ([]*ocm.ProviderInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, a.c.URL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote: error creating request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := rhttp.GetHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote: error fetching providers")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote: error fetching providers: %s", res.Status)
+	}
+
+	providers := []*ocm.ProviderInfo{}
+	if err := json.NewDecoder(res.Body).Decode(&providers); err != nil {
+		return nil, errors.Wrap(err, "remote: error decoding providers")
+	}
+	return providers, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package remote
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsProviderAllowed(t *testing.T) {
+	var fail int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name": "cernbox", "domain": "cern.ch"}]`))
+	}))
+	defer srv.Close()
+
+	a, err := New(map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.(*authorizer).Close()
+	ctx := context.Background()
+
+	if err := a.IsProviderAllowed(ctx, "cern.ch"); err != nil {
+		t.Errorf("expected cern.ch to be allowed: %v", err)
+	}
+	if err := a.IsProviderAllowed(ctx, "example.org"); err == nil {
+		t.Error("expected example.org not to be allowed")
+	}
+	if providers, err := a.ListAllProviders(ctx); err != nil || len(providers) != 1 || providers[0].Domain != "cern.ch" {
+		t.Errorf("expected the cern.ch provider to be listed, got %v, %v", providers, err)
+	}
+
+	// refresh against a failing service, the last good list must be kept
+	atomic.StoreInt32(&fail, 1)
+	if _, err := a.(*authorizer).refresh(ctx); err == nil {
+		t.Error("expected the refresh to fail")
+	}
+	if err := a.IsProviderAllowed(ctx, "cern.ch"); err != nil {
+		t.Errorf("expected the last known list to be used: %v", err)
+	}
+}
+
+func TestUnreachableWithoutCopy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	a, err := New(map[string]interface{}{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.(*authorizer).Close()
+	if err := a.IsProviderAllowed(context.Background(), "cern.ch"); err == nil {
+		t.Error("expected an error when the providers were never fetched")
+	}
+}
+
+func TestBackgroundRefresh(t *testing.T) {
+	var domain atomic.Value
+	domain.Store("cern.ch")
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if domain.Load() == "blocked" {
+			<-block
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name": "provider", "domain": "` + domain.Load().(string) + `"}]`))
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	a := &authorizer{c: &config{URL: srv.URL}, interval: 10 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	go a.run(ctx)
+	defer a.Close()
+
+	waitFor := func(d string) {
+		t.Helper()
+		for i := 0; i < 200; i++ {
+			if a.IsProviderAllowed(context.Background(), d) == nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("%s was not allowed after the refreshes", d)
+	}
+	waitFor("cern.ch")
+	domain.Store("example.org")
+	waitFor("example.org")
+
+	// a refresh hanging on the service does not block the requests
+	domain.Store("blocked")
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() { done <- a.IsProviderAllowed(context.Background(), "example.org") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the last list to be used: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the request waited for the refresh")
+	}
+}
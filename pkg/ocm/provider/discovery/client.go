@@ -0,0 +1,175 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/pkg/errors"
+)
+
+// DefaultTTL is how long the discovered providers are cached by default.
+const DefaultTTL = time.Hour
+
+// paths are where the discovery document is looked for, the second one
+// being the location of the OCM 1.1 specification.
+var paths = []string{"/ocm-provider", "/.well-known/ocm"}
+
+// Provider is a remote provider and the version of the API negotiated with it.
+type Provider struct {
+	Domain   string
+	Version  string
+	Document *Document
+}
+
+// Assume returns a provider that could not be discovered, speaking the
+// newest version of the API at the given endpoint.
+func Assume(domain, endpoint string) *Provider {
+	return &Provider{
+		Domain:   domain,
+		Version:  Versions[0],
+		Document: &Document{Enabled: true, APIVersion: Versions[0], Endpoint: strings.TrimSuffix(endpoint, "/")},
+	}
+}
+
+// URL returns the URL of an endpoint of the provider. Endpoints not
+// advertised by the provider are derived from its API endpoint, as long as
+// they belong to the negotiated version, otherwise a NotSupported error is
+// returned.
+func (p *Provider) URL(endpoint string) (string, error) {
+	if u := p.Document.Endpoints[endpoint]; u != "" {
+		return u, nil
+	}
+	first, ok := since[endpoint]
+	if !ok {
+		return "", errtypes.NotSupported(fmt.Sprintf("ocm endpoint %s", endpoint))
+	}
+	fv, _ := parseVersion(first)
+	nv, err := parseVersion(p.Version)
+	if err != nil {
+		return "", err
+	}
+	if nv.less(fv) {
+		return "", errtypes.NotSupported(fmt.Sprintf("ocm endpoint %s with api version %s of %s", endpoint, p.Version, p.Domain))
+	}
+	return strings.TrimSuffix(p.Document.Endpoint, "/") + "/" + endpoint, nil
+}
+
+// Client discovers the remote providers, caching them for a while.
+type Client struct {
+	ttl   time.Duration
+	mu    sync.Mutex
+	cache map[string]*entry
+}
+
+type entry struct {
+	p       *Provider
+	fetched time.Time
+}
+
+// NewClient returns a client caching the discovered providers for ttl,
+// DefaultTTL if it is zero.
+func NewClient(ttl time.Duration) *Client {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	return &Client{ttl: ttl, cache: map[string]*entry{}}
+}
+
+// Discover returns the provider of the domain, fetching its discovery
+// document unless it is cached, and negotiates the version of the API.
+// The domain may also be the base URL of the provider.
+func (c *Client) Discover(ctx context.Context, domain string) (*Provider, error) {
+	c.mu.Lock()
+	e, ok := c.cache[domain]
+	c.mu.Unlock()
+	if ok && time.Since(e.fetched) < c.ttl {
+		return e.p, nil
+	}
+
+	d, err := fetch(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if d.Endpoint == "" {
+		d.Endpoint = d.EndPoint
+	}
+	if d.Endpoint == "" {
+		return nil, fmt.Errorf("discovery: provider %s does not advertise its ocm endpoint", domain)
+	}
+	v, err := Negotiate(d.APIVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "discovery: error negotiating with provider %s", domain)
+	}
+	p := &Provider{Domain: domain, Version: v, Document: d}
+
+	c.mu.Lock()
+	c.cache[domain] = &entry{p: p, fetched: time.Now()}
+	c.mu.Unlock()
+	return p, nil
+}
+
+func fetch(ctx context.Context, domain string) (*Document, error) {
+	base := domain
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	base = strings.TrimSuffix(base, "/")
+
+	var err error
+	for _, p := range paths {
+		var d *Document
+		if d, err = fetchDocument(ctx, base+p); err == nil {
+			return d, nil
+		}
+	}
+	return nil, err
+}
+
+func fetchDocument(ctx context.Context, url string) (*Document, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "discovery: error creating request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := rhttp.GetHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "discovery: error fetching discovery document")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery: error fetching %s: %s", url, res.Status)
+	}
+
+	d := &Document{}
+	if err := json.NewDecoder(res.Body).Decode(d); err != nil {
+		return nil, errors.Wrap(err, "discovery: error decoding discovery document")
+	}
+	return d, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package discovery implements the OCM discovery document, served by the
+// providers at /ocm-provider, and the negotiation of the version of the OCM
+// API spoken with a remote provider.
+package discovery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+// Versions are the versions of the OCM API this provider speaks, the newest
+// first.
+var Versions = []string{"1.1.0", "1.0.0", "1.0-proposal1"}
+
+// The endpoints of the OCM API, as named in the discovery document.
+const (
+	EndpointShares         = "shares"
+	EndpointNotifications  = "notifications"
+	EndpointInviteAccepted = "invite-accepted"
+	// EndpointUsers finds the users of the provider, it is not part of the
+	// specification and only used when advertised.
+	EndpointUsers = "users"
+)
+
+// since is the first version of the API an endpoint belongs to, for the
+// providers not advertising their endpoints.
+var since = map[string]string{
+	EndpointShares:         "1.0-proposal1",
+	EndpointNotifications:  "1.0-proposal1",
+	EndpointInviteAccepted: "1.1.0",
+}
+
+// Document is the discovery document of a provider.
+type Document struct {
+	Enabled    bool   `json:"enabled"`
+	APIVersion string `json:"apiVersion"`
+	// APIVersions lists all the versions spoken by the provider, APIVersion
+	// being the newest.
+	APIVersions []string `json:"apiVersions,omitempty"`
+	Host        string   `json:"host,omitempty"`
+	Endpoint    string   `json:"endpoint"`
+	// EndPoint is how the OCM 1.0 specification spells Endpoint.
+	EndPoint      string         `json:"endPoint,omitempty"`
+	Provider      string         `json:"provider"`
+	ResourceTypes []ResourceType `json:"resourceTypes"`
+	// Endpoints maps the endpoints of the API to their URLs, when they are
+	// not the default ones under Endpoint.
+	Endpoints map[string]string `json:"endpoints,omitempty"`
+}
+
+// ResourceType is a type of resource that can be shared with the provider.
+type ResourceType struct {
+	Name       string            `json:"name"`
+	ShareTypes []string          `json:"shareTypes"`
+	Protocols  map[string]string `json:"protocols"`
+}
+
+// NewDocument returns the document of a provider speaking all the Versions,
+// whose API is at endpoint and whose shared files are at the webdav path.
+func NewDocument(host, provider, endpoint, webdav string) *Document {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	return &Document{
+		Enabled:     true,
+		APIVersion:  Versions[0],
+		APIVersions: Versions,
+		Host:        host,
+		Endpoint:    endpoint,
+		EndPoint:    endpoint,
+		Provider:    provider,
+		ResourceTypes: []ResourceType{{
+			Name:       "file",
+			ShareTypes: []string{"user"},
+			Protocols:  map[string]string{"webdav": webdav},
+		}},
+		Endpoints: map[string]string{
+			EndpointShares:         endpoint + "/remote-shares",
+			EndpointNotifications:  endpoint + "/notifications",
+			EndpointInviteAccepted: endpoint + "/invite-accepted",
+		},
+	}
+}
+
+// Negotiate returns the newest of the Versions spoken by a provider
+// advertising the remote one, which is also expected to speak the older
+// versions of the same major version. A provider not advertising its
+// version is assumed to speak the oldest one.
+func Negotiate(remote string) (string, error) {
+	if remote == "" {
+		return Versions[len(Versions)-1], nil
+	}
+	rv, err := parseVersion(remote)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range Versions {
+		lv, _ := parseVersion(v)
+		if lv.major == rv.major && !rv.less(lv) {
+			return v, nil
+		}
+	}
+	return "", errtypes.NotSupported("ocm api version " + remote)
+}
+
+// version is a version of the OCM API, like 1.1.0 or 1.0-proposal1.
+type version struct {
+	major, minor, patch int
+	pre                 string
+}
+
+func parseVersion(s string) (version, error) {
+	v := version{}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, v.pre = s[:i], s[i+1:]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("discovery: invalid version %q", s)
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("discovery: invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// less tells whether v is older than o, a pre-release being older than the
+// release.
+func (v version) less(o version) bool {
+	switch {
+	case v.major != o.major:
+		return v.major < o.major
+	case v.minor != o.minor:
+		return v.minor < o.minor
+	case v.patch != o.patch:
+		return v.patch < o.patch
+	case v.pre == "" || o.pre == "":
+		return v.pre != "" && o.pre == ""
+	}
+	return v.pre < o.pre
+}
@@ -0,0 +1,120 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		remote, expected string
+		err              bool
+	}{
+		{"", "1.0-proposal1", false},
+		{"1.0-proposal1", "1.0-proposal1", false},
+		{"1.0.0", "1.0.0", false},
+		{"1.0", "1.0.0", false},
+		{"1.1.0", "1.1.0", false},
+		{"v1.1", "1.1.0", false},
+		{"1.2.0", "1.1.0", false},
+		{"1.1.0-rc1", "1.0.0", false},
+		{"0.9", "", true},
+		{"2.0.0", "", true},
+		{"one", "", true},
+	}
+	for _, tt := range tests {
+		v, err := Negotiate(tt.remote)
+		if (err != nil) != tt.err {
+			t.Errorf("Negotiate(%q): unexpected error %v", tt.remote, err)
+			continue
+		}
+		if v != tt.expected {
+			t.Errorf("Negotiate(%q) = %q, expected %q", tt.remote, v, tt.expected)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	p := &Provider{Domain: "cern.ch", Version: "1.0.0", Document: &Document{Endpoint: "https://cern.ch/ocm/"}}
+	if u, err := p.URL(EndpointNotifications); err != nil || u != "https://cern.ch/ocm/notifications" {
+		t.Errorf("unexpected notifications endpoint %q, %v", u, err)
+	}
+	if _, err := p.URL(EndpointInviteAccepted); err == nil {
+		t.Error("expected invites not to be supported by a 1.0 provider")
+	} else if _, ok := err.(errtypes.IsNotSupported); !ok {
+		t.Errorf("expected a not supported error, got %v", err)
+	}
+
+	p.Version = "1.1.0"
+	if u, err := p.URL(EndpointInviteAccepted); err != nil || u != "https://cern.ch/ocm/invite-accepted" {
+		t.Errorf("unexpected invite-accepted endpoint %q, %v", u, err)
+	}
+
+	p.Document = NewDocument("cern.ch", "cernbox", "https://cern.ch/ocm", "/cernbox/ocm_webdav")
+	if u, err := p.URL(EndpointShares); err != nil || u != "https://cern.ch/ocm/remote-shares" {
+		t.Errorf("expected the advertised shares endpoint, got %q, %v", u, err)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/ocm" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"enabled": true, "apiVersion": "1.0.0", "endPoint": "https://example.org/ocm", "provider": "example"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(0)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		p, err := c.Discover(ctx, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Version != "1.0.0" || p.Document.Endpoint != "https://example.org/ocm" {
+			t.Errorf("unexpected provider %+v", p.Document)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("expected the provider to be cached, fetched %d times", hits)
+	}
+}
+
+func TestDiscoverUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"enabled": true, "apiVersion": "2.0.0", "endpoint": "https://example.org/ocm"}`))
+	}))
+	defer srv.Close()
+
+	if _, err := NewClient(0).Discover(context.Background(), srv.URL); err == nil {
+		t.Error("expected an error with a provider of another major version")
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package lookup finds the users of the trusted remote providers, to suggest
+// the recipients of the OCM shares. The providers are queried at the users
+// endpoint they advertise in their discovery document.
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/ocm/provider"
+	"github.com/cs3org/reva/pkg/ocm/provider/authorizer/registry"
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// MinSearchLength is the length of the shortest query sent to, or answered
+// for, the remote providers, so that they cannot list all the users.
+const MinSearchLength = 3
+
+// OpaqueKey asks the gateway to find the users of the remote providers
+// rather than the local ones, when present in the opaque of FindUsers.
+const OpaqueKey = "ocm_remote_users"
+
+// User is a user as returned by the users endpoint.
+type User struct {
+	// ID is the opaque id of the user, the share recipient with the domain.
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+}
+
+type config struct {
+	// ProviderAuthorizer lists the providers queried.
+	ProviderAuthorizer  string                            `mapstructure:"provider_authorizer"`
+	ProviderAuthorizers map[string]map[string]interface{} `mapstructure:"provider_authorizers"`
+	// Host is the domain of this provider, it is not queried and is given
+	// to the remote providers to authorize the requests.
+	Host string `mapstructure:"host"`
+	// BearerSecrets sign the bearer tokens of the requests to the remote
+	// providers, by domain. The secret of a provider must be the one it
+	// knows this provider by in its providerauthorizer middleware, the
+	// providers without a secret are not queried.
+	BearerSecrets map[string]string `mapstructure:"bearer_secrets"`
+	// Timeout is the number of seconds a provider has to answer.
+	Timeout int `mapstructure:"timeout"`
+	// MaxResults is the number of users asked to every provider.
+	MaxResults int `mapstructure:"max_results"`
+}
+
+func (c *config) init() {
+	if c.Timeout == 0 {
+		c.Timeout = 5
+	}
+	if c.MaxResults == 0 {
+		c.MaxResults = 20
+	}
+}
+
+// Lookup queries the trusted providers.
+type Lookup struct {
+	conf       *config
+	authorizer provider.Authorizer
+	discovery  *discovery.Client
+}
+
+// New returns a lookup querying the providers of the authorizer, or nil if
+// none is configured.
+func New(m map[string]interface{}) (*Lookup, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "lookup: error decoding conf")
+	}
+	if c.ProviderAuthorizer == "" {
+		return nil, nil
+	}
+	c.init()
+	if c.Host == "" {
+		return nil, errors.New("lookup: host is required to query the remote providers")
+	}
+
+	f, ok := registry.NewFuncs[c.ProviderAuthorizer]
+	if !ok {
+		return nil, fmt.Errorf("lookup: provider authorizer not found: %s", c.ProviderAuthorizer)
+	}
+	a, err := f(c.ProviderAuthorizers[c.ProviderAuthorizer])
+	if err != nil {
+		return nil, errors.Wrap(err, "lookup: error creating provider authorizer")
+	}
+	return &Lookup{conf: c, authorizer: a, discovery: discovery.NewClient(0)}, nil
+}
+
+// FindUsers returns the users of the remote providers matching the query,
+// with the domain of their provider as idp. The providers not answering or
+// not advertising the users endpoint are skipped.
+func (l *Lookup) FindUsers(ctx context.Context, query string) ([]*userpb.User, error) {
+	query = strings.TrimSpace(query)
+	if len(query) < MinSearchLength {
+		return []*userpb.User{}, nil
+	}
+	providers, err := l.authorizer.ListAllProviders(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "lookup: error listing providers")
+	}
+
+	log := appctx.GetLogger(ctx)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	users := []*userpb.User{}
+	for _, p := range providers {
+		domain := p.GetDomain()
+		if domain == "" || strings.EqualFold(domain, l.conf.Host) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := l.query(ctx, domain, query)
+			if err != nil {
+				log.Warn().Err(err).Str("domain", domain).Msg("lookup: error finding users of the provider")
+				return
+			}
+			mu.Lock()
+			users = append(users, found...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].DisplayName != users[j].DisplayName {
+			return users[i].DisplayName < users[j].DisplayName
+		}
+		return users[i].Id.Idp+users[i].Id.OpaqueId < users[j].Id.Idp+users[j].Id.OpaqueId
+	})
+	return users, nil
+}
+
+// query asks the provider of the domain for its users matching the query.
+func (l *Lookup) query(ctx context.Context, domain, query string) ([]*userpb.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(l.conf.Timeout)*time.Second)
+	defer cancel()
+
+	p, err := l.discovery.Discover(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := p.URL(discovery.EndpointUsers)
+	if err != nil {
+		// the provider does not expose its users
+		appctx.GetLogger(ctx).Debug().Str("domain", domain).Msg("lookup: provider without users endpoint")
+		return nil, nil
+	}
+
+	q := url.Values{"search": {query}, "limit": {strconv.Itoa(l.conf.MaxResults)}}
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "lookup: error creating request")
+	}
+	req = req.WithContext(ctx)
+	tkn, err := l.token(domain)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tkn)
+
+	res, err := rhttp.GetHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "lookup: error querying provider")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lookup: provider answered %s", res.Status)
+	}
+
+	var found []*User
+	if err := json.NewDecoder(res.Body).Decode(&found); err != nil {
+		return nil, errors.Wrap(err, "lookup: error decoding users")
+	}
+	users := make([]*userpb.User, 0, len(found))
+	for _, u := range found {
+		if u == nil || u.ID == "" {
+			continue
+		}
+		if len(users) == l.conf.MaxResults {
+			break
+		}
+		users = append(users, &userpb.User{
+			Id:          &userpb.UserId{OpaqueId: u.ID, Idp: domain},
+			Username:    u.ID,
+			DisplayName: u.DisplayName,
+		})
+	}
+	return users, nil
+}
+
+// token returns the bearer token of the requests to the provider of the
+// domain, signed with the secret of the provider.
+func (l *Lookup) token(domain string) (string, error) {
+	secret, ok := l.conf.BearerSecrets[domain]
+	if !ok || secret == "" {
+		return "", fmt.Errorf("lookup: no bearer secret for provider %s", domain)
+	}
+	claims := jwt.MapClaims{
+		"provider": l.conf.Host,
+		"iat":      time.Now().Unix(),
+		"exp":      time.Now().Add(time.Minute).Unix(),
+	}
+	tkn, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		return "", errors.Wrap(err, "lookup: error signing bearer token")
+	}
+	return tkn, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/ocm/provider/discovery"
+	"github.com/dgrijalva/jwt-go"
+
+	_ "github.com/cs3org/reva/pkg/ocm/provider/authorizer/json"
+)
+
+// newProvider returns a provider answering the lookups signed with the
+// secret with the users, or without users endpoint if they are nil.
+func newProvider(t *testing.T, secret string, users []*User) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ocm-provider":
+			d := discovery.NewDocument("localhost", "test", srv.URL+"/ocm", "/webdav")
+			if users != nil {
+				d.Endpoints[discovery.EndpointUsers] = srv.URL + "/ocm/users"
+			}
+			_ = json.NewEncoder(w).Encode(d)
+		case "/ocm/users":
+			claims := jwt.MapClaims{}
+			tkn := r.Header.Get("Authorization")[len("Bearer "):]
+			if _, err := jwt.ParseWithClaims(tkn, claims, func(*jwt.Token) (interface{}, error) { return []byte(secret), nil }); err != nil || claims["provider"] != "cernbox.cern.ch" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("search") != "mar" || r.URL.Query().Get("limit") != "2" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(users)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return srv
+}
+
+func TestFindUsers(t *testing.T) {
+	surf := newProvider(t, "surf-secret", []*User{{ID: "marie", DisplayName: "Marie Curie"}, {ID: "mark", DisplayName: "Mark"}, {ID: "martin", DisplayName: "Martin"}})
+	defer surf.Close()
+	cesnet := newProvider(t, "cesnet-secret", []*User{{ID: "m1", DisplayName: "Marco"}})
+	defer cesnet.Close()
+	legacy := newProvider(t, "legacy-secret", nil)
+	defer legacy.Close()
+	// the providers without a secret are not queried
+	unknown := newProvider(t, "", []*User{{ID: "maria", DisplayName: "Maria"}})
+	defer unknown.Close()
+
+	dir, err := ioutil.TempDir("", "lookup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	providers := path.Join(dir, "providers.json")
+	data, _ := json.Marshal([]map[string]string{
+		{"domain": surf.URL}, {"domain": cesnet.URL}, {"domain": legacy.URL}, {"domain": unknown.URL},
+		{"domain": "unreachable.invalid"}, {"domain": "cernbox.cern.ch"},
+	})
+	if err := ioutil.WriteFile(providers, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := New(map[string]interface{}{
+		"provider_authorizer":  "json",
+		"provider_authorizers": map[string]map[string]interface{}{"json": {"providers": providers}},
+		"host":                 "cernbox.cern.ch",
+		"bearer_secrets":       map[string]string{surf.URL: "surf-secret", cesnet.URL: "cesnet-secret", legacy.URL: "legacy-secret"},
+		"max_results":          2,
+		"timeout":              2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every provider returns at most max_results users
+	users, err := l.FindUsers(context.Background(), "mar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct{ name, id, idp string }{
+		{"Marco", "m1", cesnet.URL},
+		{"Marie Curie", "marie", surf.URL},
+		{"Mark", "mark", surf.URL},
+	}
+	if len(users) != len(expected) {
+		t.Fatalf("expected %d users, got %v", len(expected), users)
+	}
+	for i, e := range expected {
+		u := users[i]
+		if u.DisplayName != e.name || u.Id.OpaqueId != e.id || u.Id.Idp != e.idp || u.Username != e.id {
+			t.Errorf("user %d: got %v, expected %v", i, u, e)
+		}
+	}
+
+	users, err = l.FindUsers(context.Background(), "ma")
+	if err != nil || len(users) != 0 {
+		t.Fatalf("expected no users for a short query, got %v, %v", users, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if l, err := New(nil); l != nil || err != nil {
+		t.Fatalf("expected no lookup without authorizer, got %v, %v", l, err)
+	}
+	if _, err := New(map[string]interface{}{"provider_authorizer": "memory"}); err == nil {
+		t.Fatal("expected an error without host")
+	}
+}
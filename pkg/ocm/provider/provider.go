@@ -20,10 +20,42 @@ package provider
 
 import (
 	"context"
+
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
 )
 
 // Authorizer provides provisions to verify and add sync'n'share system providers.
 type Authorizer interface {
 	// IsProviderAllowed checks if a given system provider is integrated into the OCM or not.
 	IsProviderAllowed(ctx context.Context, domain string) error
+
+	// ListAllProviders returns the providers known to the authorizer.
+	ListAllProviders(ctx context.Context) ([]*ocm.ProviderInfo, error)
+}
+
+// Manager is implemented by the authorizers whose trusted providers can be
+// changed at runtime.
+type Manager interface {
+	// AddProvider trusts the provider, replacing the one with the same domain.
+	AddProvider(ctx context.Context, p *ocm.ProviderInfo) error
+
+	// RemoveProvider stops trusting the provider of the given domain.
+	RemoveProvider(ctx context.Context, domain string) error
+}
+
+type key int
+
+const domainKey key = iota
+
+// ContextGetDomain returns the domain of the remote provider the request
+// was authorized for, if set in the given context.
+func ContextGetDomain(ctx context.Context) (string, bool) {
+	d, ok := ctx.Value(domainKey).(string)
+	return d, ok
+}
+
+// ContextSetDomain stores the domain of the remote provider the request was
+// authorized for in the context.
+func ContextSetDomain(ctx context.Context, domain string) context.Context {
+	return context.WithValue(ctx, domainKey, domain)
 }
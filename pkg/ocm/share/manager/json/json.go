@@ -108,6 +108,9 @@ func loadOrCreate(file string) (*shareModel, error) {
 	if m.State == nil {
 		m.State = map[string]map[string]ocm.ShareState{}
 	}
+	if m.Remote == nil {
+		m.Remote = map[string]*share.RemoteShare{}
+	}
 	m.file = file
 
 	return m, nil
@@ -117,6 +120,7 @@ type shareModel struct {
 	file   string
 	State  map[string]map[string]ocm.ShareState `json:"state"` // map[username]map[share_id]boolean
 	Shares []*ocm.Share                         `json:"shares"`
+	Remote map[string]*share.RemoteShare        `json:"remote"` // map[share_id]remote access
 }
 
 type config struct {
@@ -364,7 +368,7 @@ func (m *mgr) ListReceivedShares(ctx context.Context) ([]*ocm.ReceivedShare, err
 			continue
 		}
 		if s.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER {
-			if user.Id.Idp == s.Grantee.Id.Idp && user.Id.OpaqueId == s.Grantee.Id.OpaqueId {
+			if share.GranteeMatches(s.Grantee, user.Id) {
 				rs := m.convert(ctx, s)
 				rss = append(rss, rs)
 			}
@@ -385,6 +389,7 @@ func (m *mgr) ListReceivedShares(ctx context.Context) ([]*ocm.ReceivedShare, err
 func (m *mgr) convert(ctx context.Context, s *ocm.Share) *ocm.ReceivedShare {
 	rs := &ocm.ReceivedShare{
 		Share: s,
+		State: ocm.ShareState_SHARE_STATE_PENDING,
 	}
 	user := user.ContextMustGetUser(ctx)
 	if v, ok := m.model.State[user.Id.String()]; ok {
@@ -405,8 +410,7 @@ func (m *mgr) getReceived(ctx context.Context, ref *ocm.ShareReference) (*ocm.Re
 	user := user.ContextMustGetUser(ctx)
 	for _, s := range m.model.Shares {
 		if equal(ref, s) {
-			if s.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER &&
-				s.Grantee.Id.Idp == user.Id.Idp && s.Grantee.Id.OpaqueId == user.Id.OpaqueId {
+			if share.GranteeMatches(s.Grantee, user.Id) {
 				rs := m.convert(ctx, s)
 				return rs, nil
 			} else if s.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_GROUP {
@@ -447,5 +451,54 @@ func (m *mgr) UpdateReceivedShare(ctx context.Context, ref *ocm.ShareReference,
 		return nil, err
 	}
 
+	rs.State = f.GetState()
 	return rs, nil
 }
+
+func (m *mgr) AddReceivedShare(ctx context.Context, s *ocm.Share, r *share.RemoteShare) (*ocm.Share, error) {
+	key := &ocm.ShareKey{
+		Owner:      s.Owner,
+		ResourceId: s.ResourceId,
+		Grantee:    s.Grantee,
+	}
+	if _, err := m.getByKey(ctx, key); err == nil {
+		return nil, errtypes.AlreadyExists(key.String())
+	}
+
+	now := time.Now().UnixNano()
+	ts := &typespb.Timestamp{
+		Seconds: uint64(now / 1000000000),
+		Nanos:   uint32(now % 1000000000),
+	}
+	s.Id = &ocm.ShareId{OpaqueId: genID()}
+	if s.Ctime == nil {
+		s.Ctime = ts
+	}
+	s.Mtime = ts
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.model.Shares = append(m.model.Shares, s)
+	m.model.Remote[s.Id.OpaqueId] = r
+	if err := m.model.Save(); err != nil {
+		err = errors.Wrap(err, "error saving model")
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *mgr) GetRemoteShare(ctx context.Context, ref *ocm.ShareReference) (*share.RemoteShare, error) {
+	rs, err := m.getReceived(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if r, ok := m.model.Remote[rs.Share.Id.OpaqueId]; ok {
+		return r, nil
+	}
+	return nil, errtypes.NotFound(ref.String())
+}
@@ -54,6 +54,7 @@ func New(c map[string]interface{}) (share.Manager, error) {
 type mgr struct {
 	shares sync.Map
 	state  map[string]map[string]ocm.ShareState
+	remote sync.Map // share id -> *share.RemoteShare
 }
 
 func genID() string {
@@ -142,10 +143,10 @@ func (m *mgr) getByID(ctx context.Context, id *ocm.ShareId) (*ocm.Share, error)
 
 		if s.GetId().OpaqueId == id.OpaqueId {
 			found = v.(*ocm.Share)
-			return true
+			return false
 		}
 
-		return false
+		return true
 	})
 
 	if found != nil {
@@ -167,10 +168,10 @@ func (m *mgr) getByKey(ctx context.Context, key *ocm.ShareKey) (*ocm.Share, erro
 			key.Grantee.Type == s.Grantee.Type && key.Grantee.Id.Idp == s.Grantee.Id.Idp && key.Grantee.Id.OpaqueId == s.Grantee.Id.OpaqueId {
 
 			found = v.(*ocm.Share)
-			return true
+			return false
 		}
 
-		return false
+		return true
 	})
 
 	if found != nil {
@@ -196,10 +197,10 @@ func (m *mgr) Unshare(ctx context.Context, ref *ocm.ShareReference) error {
 					ResourceId: s.ResourceId,
 					Grantee:    s.Grantee,
 				}
-				return true
+				return false
 			}
 		}
-		return false
+		return true
 	})
 
 	if key != nil {
@@ -239,10 +240,10 @@ func (m *mgr) UpdateShare(ctx context.Context, ref *ocm.ShareReference, p *ocm.S
 					ResourceId: s.ResourceId,
 					Grantee:    s.Grantee,
 				}
-				return true
+				return false
 			}
 		}
-		return false
+		return true
 	})
 
 	if key != nil {
@@ -319,7 +320,7 @@ func (m *mgr) ListReceivedShares(ctx context.Context) ([]*ocm.ReceivedShare, err
 			return true
 		}
 		if s.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER {
-			if user.Id.Idp == s.Grantee.Id.Idp && user.Id.OpaqueId == s.Grantee.Id.OpaqueId {
+			if share.GranteeMatches(s.Grantee, user.Id) {
 				rs := m.convert(ctx, s)
 				receivedShares = append(receivedShares, rs)
 			}
@@ -344,6 +345,7 @@ func (m *mgr) ListReceivedShares(ctx context.Context) ([]*ocm.ReceivedShare, err
 func (m *mgr) convert(ctx context.Context, s *ocm.Share) *ocm.ReceivedShare {
 	rs := &ocm.ReceivedShare{
 		Share: s,
+		State: ocm.ShareState_SHARE_STATE_PENDING,
 	}
 	user := user.ContextMustGetUser(ctx)
 	if v, ok := m.state[user.Id.String()]; ok {
@@ -364,21 +366,20 @@ func (m *mgr) GetReceivedShare(ctx context.Context, ref *ocm.ShareReference) (*o
 		s := v.(*ocm.Share)
 
 		if equal(ref, s) {
-			if s.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER &&
-				s.Grantee.Id.Idp == user.Id.Idp && s.Grantee.Id.OpaqueId == user.Id.OpaqueId {
+			if share.GranteeMatches(s.Grantee, user.Id) {
 				found = m.convert(ctx, s)
-				return true
+				return false
 			} else if s.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_GROUP {
 				for _, g := range user.Groups {
 					if s.Grantee.Id.OpaqueId == g {
 						found = m.convert(ctx, s)
-						return true
+						return false
 					}
 				}
 			}
 		}
 
-		return false
+		return true
 	})
 
 	if found != nil {
@@ -407,5 +408,46 @@ func (m *mgr) UpdateReceivedShare(ctx context.Context, ref *ocm.ShareReference,
 		m.state[user.Id.String()] = a
 	}
 
+	rs.State = f.GetState()
 	return rs, nil
 }
+
+func (m *mgr) AddReceivedShare(ctx context.Context, s *ocm.Share, r *share.RemoteShare) (*ocm.Share, error) {
+
+	key := &ocm.ShareKey{
+		Owner:      s.Owner,
+		ResourceId: s.ResourceId,
+		Grantee:    s.Grantee,
+	}
+	if _, err := m.getByKey(ctx, key); err == nil {
+		return nil, errtypes.AlreadyExists(key.String())
+	}
+
+	now := time.Now().UnixNano()
+	ts := &typespb.Timestamp{
+		Seconds: uint64(now / 1000000000),
+		Nanos:   uint32(now % 1000000000),
+	}
+	s.Id = &ocm.ShareId{OpaqueId: genID()}
+	if s.Ctime == nil {
+		s.Ctime = ts
+	}
+	s.Mtime = ts
+
+	m.shares.Store(key, s)
+	m.remote.Store(s.Id.OpaqueId, r)
+	return s, nil
+}
+
+func (m *mgr) GetRemoteShare(ctx context.Context, ref *ocm.ShareReference) (*share.RemoteShare, error) {
+
+	rs, err := m.GetReceivedShare(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if r, ok := m.remote.Load(rs.Share.Id.OpaqueId); ok {
+		return r.(*share.RemoteShare), nil
+	}
+	return nil, errtypes.NotFound(ref.String())
+}
@@ -19,6 +19,7 @@
 package memory
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -27,6 +28,9 @@ import (
 	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/share"
+	"github.com/cs3org/reva/pkg/user"
 )
 
 func Test_mgr_SharesWorkflow(t *testing.T) {
@@ -56,6 +60,53 @@ func Test_mgr_SharesWorkflow(t *testing.T) {
 	}
 }
 
+func Test_mgr_ReceivedShares(t *testing.T) {
+	m := &mgr{state: map[string]map[string]ocm.ShareState{}}
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "cernbox.cern.ch", OpaqueId: "einstein"}}
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "cernbox.cern.ch", OpaqueId: "marie"}}
+
+	s := &ocm.Share{
+		ResourceId: &provider.ResourceId{StorageId: "cesnet.cz", OpaqueId: "42"},
+		Grantee: &provider.Grantee{
+			Type: provider.GranteeType_GRANTEE_TYPE_USER,
+			Id:   &userpb.UserId{OpaqueId: "einstein"},
+		},
+		Owner:   &userpb.UserId{Idp: "cesnet.cz", OpaqueId: "richard"},
+		Creator: &userpb.UserId{Idp: "cesnet.cz", OpaqueId: "richard"},
+	}
+	remote := &share.RemoteShare{Name: "photos", WebDAVEndpoint: "https://cesnet.cz/remote.php/dav/ocm", Token: "secret"}
+	created, err := m.AddReceivedShare(context.Background(), s, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddReceivedShare(context.Background(), s, remote); err == nil {
+		t.Error("AddReceivedShare accepted the same share twice")
+	}
+
+	ctx := user.ContextSetUser(context.Background(), einstein)
+	rss, err := m.ListReceivedShares(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rss) != 1 || rss[0].Share.Id.OpaqueId != created.Id.OpaqueId {
+		t.Fatalf("ListReceivedShares got = %v, want the received share", rss)
+	}
+
+	ref := &ocm.ShareReference{Spec: &ocm.ShareReference_Id{Id: created.Id}}
+	r, err := m.GetRemoteShare(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Token != "secret" {
+		t.Errorf("GetRemoteShare token got = %s, want secret", r.Token)
+	}
+
+	_, err = m.GetRemoteShare(user.ContextSetUser(context.Background(), marie), ref)
+	if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("GetRemoteShare for another user got = %v, want not found", err)
+	}
+}
+
 func createManagerWithData() *mgr {
 	now := time.Now().UnixNano()
 	ts := &typespb.Timestamp{
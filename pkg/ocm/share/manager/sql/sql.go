@@ -0,0 +1,563 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements an OCM share manager backed by a MySQL or PostgreSQL
+// database, storing the shares sent to and received from remote providers.
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/share"
+	"github.com/cs3org/reva/pkg/ocm/share/manager/registry"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+}
+
+type mgr struct {
+	c  *config
+	db *sql.DB
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new OCM share manager backed by a SQL database.
+func New(m map[string]interface{}) (share.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, db: db}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "ocm_share_schema_migrations", migrations); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// migrations contains the schema changes in the order they are applied.
+// The applied version is tracked in the ocm_share_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS ocm_shares (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		share_key VARCHAR(64) NOT NULL UNIQUE,
+		owner_idp VARCHAR(255) NOT NULL,
+		owner_opaque_id VARCHAR(255) NOT NULL,
+		creator_idp VARCHAR(255) NOT NULL,
+		creator_opaque_id VARCHAR(255) NOT NULL,
+		resource_storage_id VARCHAR(255) NOT NULL,
+		resource_opaque_id VARCHAR(255) NOT NULL,
+		grantee_type INTEGER NOT NULL,
+		grantee_idp VARCHAR(255) NOT NULL,
+		grantee_opaque_id VARCHAR(255) NOT NULL,
+		permissions TEXT NOT NULL,
+		ctime BIGINT NOT NULL,
+		mtime BIGINT NOT NULL
+	)`,
+	`CREATE INDEX ocm_shares_owner ON ocm_shares (owner_idp, owner_opaque_id)`,
+	`CREATE INDEX ocm_shares_grantee ON ocm_shares (grantee_type, grantee_opaque_id)`,
+	`CREATE TABLE IF NOT EXISTS ocm_share_states (
+		share_id VARCHAR(64) NOT NULL,
+		user_idp VARCHAR(255) NOT NULL,
+		user_opaque_id VARCHAR(255) NOT NULL,
+		state INTEGER NOT NULL,
+		PRIMARY KEY (share_id, user_idp, user_opaque_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS ocm_remote_shares (
+		share_id VARCHAR(64) NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		webdav_endpoint TEXT NOT NULL,
+		token VARCHAR(255) NOT NULL,
+		ocm_endpoint TEXT NOT NULL
+	)`,
+}
+
+const shareColumns = "id, owner_idp, owner_opaque_id, creator_idp, creator_opaque_id, resource_storage_id, resource_opaque_id, grantee_type, grantee_idp, grantee_opaque_id, permissions, ctime, mtime"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanShare(row scanner) (*ocm.Share, error) {
+	var (
+		id, ownerIdp, ownerID, creatorIdp, creatorID string
+		storageID, opaqueID, granteeIdp, granteeID   string
+		permissions                                  string
+		granteeType                                  int32
+		ctime, mtime                                 int64
+	)
+	if err := row.Scan(&id, &ownerIdp, &ownerID, &creatorIdp, &creatorID, &storageID, &opaqueID, &granteeType, &granteeIdp, &granteeID, &permissions, &ctime, &mtime); err != nil {
+		return nil, err
+	}
+
+	perms := &ocm.SharePermissions{}
+	if err := json.Unmarshal([]byte(permissions), perms); err != nil {
+		return nil, errors.Wrap(err, "sql: error decoding permissions")
+	}
+
+	return &ocm.Share{
+		Id:          &ocm.ShareId{OpaqueId: id},
+		ResourceId:  &provider.ResourceId{StorageId: storageID, OpaqueId: opaqueID},
+		Permissions: perms,
+		Grantee: &provider.Grantee{
+			Type: provider.GranteeType(granteeType),
+			Id:   &userpb.UserId{Idp: granteeIdp, OpaqueId: granteeID},
+		},
+		Owner:   &userpb.UserId{Idp: ownerIdp, OpaqueId: ownerID},
+		Creator: &userpb.UserId{Idp: creatorIdp, OpaqueId: creatorID},
+		Ctime:   toTimestamp(ctime),
+		Mtime:   toTimestamp(mtime),
+	}, nil
+}
+
+func toTimestamp(ns int64) *typespb.Timestamp {
+	return &typespb.Timestamp{
+		Seconds: uint64(ns / 1000000000),
+		Nanos:   uint32(ns % 1000000000),
+	}
+}
+
+// hashKey returns a fixed length representation of the share key
+// that is used to enforce uniqueness at the database level.
+func hashKey(key *ocm.ShareKey) string {
+	h := sha256.New()
+	for _, s := range []string{
+		key.Owner.Idp, key.Owner.OpaqueId,
+		key.ResourceId.StorageId, key.ResourceId.OpaqueId,
+		key.Grantee.Type.String(), key.Grantee.Id.Idp, key.Grantee.Id.OpaqueId,
+	} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func encodePermissions(p *ocm.SharePermissions) (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", errors.Wrap(err, "sql: error encoding permissions")
+	}
+	return string(data), nil
+}
+
+func isOwner(u *userpb.User, s *ocm.Share) bool {
+	return u.Id.Idp == s.Owner.Idp && u.Id.OpaqueId == s.Owner.OpaqueId
+}
+
+func isGrantee(u *userpb.User, s *ocm.Share) bool {
+	switch s.Grantee.Type {
+	case provider.GranteeType_GRANTEE_TYPE_USER:
+		return share.GranteeMatches(s.Grantee, u.Id)
+	case provider.GranteeType_GRANTEE_TYPE_GROUP:
+		for _, g := range u.Groups {
+			if g == s.Grantee.Id.OpaqueId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *mgr) Share(ctx context.Context, md *provider.ResourceId, g *ocm.ShareGrant) (*ocm.Share, error) {
+	user := user.ContextMustGetUser(ctx)
+
+	// do not allow share to myself if share is for a user
+	if g.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER &&
+		g.Grantee.Id.Idp == user.Id.Idp && g.Grantee.Id.OpaqueId == user.Id.OpaqueId {
+		return nil, errors.New("sql: user and grantee are the same")
+	}
+
+	s := &ocm.Share{
+		ResourceId:  md,
+		Permissions: g.Permissions,
+		Grantee:     g.Grantee,
+		Owner:       user.Id,
+		Creator:     user.Id,
+	}
+	if err := m.insert(ctx, s, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// insert stores the share with a new id, along with the access to the
+// remote resource for the shares received from remote providers.
+func (m *mgr) insert(ctx context.Context, s *ocm.Share, r *share.RemoteShare) error {
+	key := &ocm.ShareKey{
+		Owner:      s.Owner,
+		ResourceId: s.ResourceId,
+		Grantee:    s.Grantee,
+	}
+	if _, err := m.getByKey(ctx, key); err == nil {
+		return errtypes.AlreadyExists(key.String())
+	}
+
+	perms, err := encodePermissions(s.Permissions)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano()
+	ctime := now
+	if s.Ctime != nil {
+		ctime = int64(s.Ctime.Seconds)*1000000000 + int64(s.Ctime.Nanos)
+	}
+	s.Id = &ocm.ShareId{OpaqueId: uuid.New().String()}
+	s.Ctime = toTimestamp(ctime)
+	s.Mtime = toTimestamp(now)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "sql: error starting transaction")
+	}
+	query := "INSERT INTO ocm_shares (id, share_key, owner_idp, owner_opaque_id, creator_idp, creator_opaque_id, resource_storage_id, resource_opaque_id, grantee_type, grantee_idp, grantee_opaque_id, permissions, ctime, mtime) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query),
+		s.Id.OpaqueId, hashKey(key),
+		s.Owner.Idp, s.Owner.OpaqueId, s.Creator.Idp, s.Creator.OpaqueId,
+		s.ResourceId.StorageId, s.ResourceId.OpaqueId,
+		int32(s.Grantee.Type), s.Grantee.Id.Idp, s.Grantee.Id.OpaqueId,
+		perms, ctime, now)
+	if err != nil {
+		_ = tx.Rollback()
+		// the unique constraint protects us from concurrent creations on other gateways
+		if _, err := m.getByKey(ctx, key); err == nil {
+			return errtypes.AlreadyExists(key.String())
+		}
+		return errors.Wrap(err, "sql: error inserting share")
+	}
+	if r != nil {
+		query := "INSERT INTO ocm_remote_shares (share_id, name, webdav_endpoint, token, ocm_endpoint) VALUES (?, ?, ?, ?, ?)"
+		if _, err := tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), s.Id.OpaqueId, r.Name, r.WebDAVEndpoint, r.Token, r.OCMEndpoint); err != nil {
+			_ = tx.Rollback()
+			return errors.Wrap(err, "sql: error inserting remote share")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "sql: error committing transaction")
+	}
+	return nil
+}
+
+func (m *mgr) getByID(ctx context.Context, id *ocm.ShareId) (*ocm.Share, error) {
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT "+shareColumns+" FROM ocm_shares WHERE id = ?"), id.OpaqueId)
+	s, err := scanShare(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.NotFound(id.String())
+		}
+		return nil, errors.Wrap(err, "sql: error getting share")
+	}
+	return s, nil
+}
+
+func (m *mgr) getByKey(ctx context.Context, key *ocm.ShareKey) (*ocm.Share, error) {
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT "+shareColumns+" FROM ocm_shares WHERE share_key = ?"), hashKey(key))
+	s, err := scanShare(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.NotFound(key.String())
+		}
+		return nil, errors.Wrap(err, "sql: error getting share")
+	}
+	return s, nil
+}
+
+func (m *mgr) get(ctx context.Context, ref *ocm.ShareReference) (s *ocm.Share, err error) {
+	switch {
+	case ref.GetId() != nil:
+		s, err = m.getByID(ctx, ref.GetId())
+	case ref.GetKey() != nil:
+		s, err = m.getByKey(ctx, ref.GetKey())
+	default:
+		err = errtypes.NotFound(ref.String())
+	}
+	return
+}
+
+func (m *mgr) GetShare(ctx context.Context, ref *ocm.ShareReference) (*ocm.Share, error) {
+	s, err := m.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// we return not found to not disclose information
+	if !isOwner(user.ContextMustGetUser(ctx), s) {
+		return nil, errtypes.NotFound(ref.String())
+	}
+	return s, nil
+}
+
+func (m *mgr) Unshare(ctx context.Context, ref *ocm.ShareReference) error {
+	s, err := m.GetShare(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "sql: error starting transaction")
+	}
+	for _, query := range []string{
+		"DELETE FROM ocm_share_states WHERE share_id = ?",
+		"DELETE FROM ocm_remote_shares WHERE share_id = ?",
+		"DELETE FROM ocm_shares WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), s.Id.OpaqueId); err != nil {
+			_ = tx.Rollback()
+			return errors.Wrap(err, "sql: error deleting share")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "sql: error committing transaction")
+	}
+	return nil
+}
+
+func (m *mgr) UpdateShare(ctx context.Context, ref *ocm.ShareReference, p *ocm.SharePermissions) (*ocm.Share, error) {
+	s, err := m.GetShare(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	perms, err := encodePermissions(p)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "UPDATE ocm_shares SET permissions = ?, mtime = ? WHERE id = ?"), perms, now, s.Id.OpaqueId); err != nil {
+		return nil, errors.Wrap(err, "sql: error updating share")
+	}
+
+	s.Permissions = p
+	s.Mtime = toTimestamp(now)
+	return s, nil
+}
+
+func (m *mgr) ListShares(ctx context.Context, filters []*ocm.ListOCMSharesRequest_Filter) ([]*ocm.Share, error) {
+	user := user.ContextMustGetUser(ctx)
+
+	query := "SELECT " + shareColumns + " FROM ocm_shares WHERE owner_idp = ? AND owner_opaque_id = ?"
+	params := []interface{}{user.Id.Idp, user.Id.OpaqueId}
+
+	conds := []string{}
+	for _, f := range filters {
+		if f.Type == ocm.ListOCMSharesRequest_Filter_TYPE_RESOURCE_ID {
+			conds = append(conds, "(resource_storage_id = ? AND resource_opaque_id = ?)")
+			params = append(params, f.GetResourceId().StorageId, f.GetResourceId().OpaqueId)
+		}
+	}
+	if len(conds) > 0 {
+		query += " AND (" + strings.Join(conds, " OR ") + ")"
+	}
+
+	return m.queryShares(ctx, query, params...)
+}
+
+func (m *mgr) queryShares(ctx context.Context, query string, params ...interface{}) ([]*ocm.Share, error) {
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing shares")
+	}
+	defer rows.Close()
+
+	var ss []*ocm.Share
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "sql: error scanning share")
+		}
+		ss = append(ss, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql: error listing shares")
+	}
+	return ss, nil
+}
+
+// we list the shares that are targeted to the user in context or to the user groups.
+// The grantees of the shares received from remote providers have no idp.
+func (m *mgr) ListReceivedShares(ctx context.Context) ([]*ocm.ReceivedShare, error) {
+	user := user.ContextMustGetUser(ctx)
+
+	// omit shares created by me
+	query := "SELECT " + shareColumns + " FROM ocm_shares WHERE NOT (owner_idp = ? AND owner_opaque_id = ?) AND ((grantee_type = ? AND grantee_idp IN ('', ?) AND grantee_opaque_id = ?)"
+	params := []interface{}{
+		user.Id.Idp, user.Id.OpaqueId,
+		int32(provider.GranteeType_GRANTEE_TYPE_USER), user.Id.Idp, user.Id.OpaqueId,
+	}
+	if len(user.Groups) > 0 {
+		query += " OR (grantee_type = ? AND grantee_opaque_id IN (?" + strings.Repeat(", ?", len(user.Groups)-1) + "))"
+		params = append(params, int32(provider.GranteeType_GRANTEE_TYPE_GROUP))
+		for _, g := range user.Groups {
+			params = append(params, g)
+		}
+	}
+	query += ")"
+
+	ss, err := m.queryShares(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := m.getStates(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	rss := make([]*ocm.ReceivedShare, 0, len(ss))
+	for _, s := range ss {
+		state, ok := states[s.Id.OpaqueId]
+		if !ok {
+			state = ocm.ShareState_SHARE_STATE_PENDING
+		}
+		rss = append(rss, &ocm.ReceivedShare{Share: s, State: state})
+	}
+	return rss, nil
+}
+
+func (m *mgr) getStates(ctx context.Context, u *userpb.User) (map[string]ocm.ShareState, error) {
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT share_id, state FROM ocm_share_states WHERE user_idp = ? AND user_opaque_id = ?"), u.Id.Idp, u.Id.OpaqueId)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing share states")
+	}
+	defer rows.Close()
+
+	states := map[string]ocm.ShareState{}
+	for rows.Next() {
+		var id string
+		var state int32
+		if err := rows.Scan(&id, &state); err != nil {
+			return nil, errors.Wrap(err, "sql: error scanning share state")
+		}
+		states[id] = ocm.ShareState(state)
+	}
+	return states, rows.Err()
+}
+
+func (m *mgr) GetReceivedShare(ctx context.Context, ref *ocm.ShareReference) (*ocm.ReceivedShare, error) {
+	user := user.ContextMustGetUser(ctx)
+	s, err := m.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if isOwner(user, s) || !isGrantee(user, s) {
+		return nil, errtypes.NotFound(ref.String())
+	}
+
+	rs := &ocm.ReceivedShare{Share: s, State: ocm.ShareState_SHARE_STATE_PENDING}
+	var state int32
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT state FROM ocm_share_states WHERE share_id = ? AND user_idp = ? AND user_opaque_id = ?"), s.Id.OpaqueId, user.Id.Idp, user.Id.OpaqueId)
+	switch err := row.Scan(&state); err {
+	case nil:
+		rs.State = ocm.ShareState(state)
+	case sql.ErrNoRows:
+	default:
+		return nil, errors.Wrap(err, "sql: error getting share state")
+	}
+	return rs, nil
+}
+
+func (m *mgr) UpdateReceivedShare(ctx context.Context, ref *ocm.ShareReference, f *ocm.UpdateReceivedOCMShareRequest_UpdateField) (*ocm.ReceivedShare, error) {
+	rs, err := m.GetReceivedShare(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	user := user.ContextMustGetUser(ctx)
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error starting transaction")
+	}
+	// delete and insert instead of an upsert, which is not portable between databases.
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "DELETE FROM ocm_share_states WHERE share_id = ? AND user_idp = ? AND user_opaque_id = ?"), rs.Share.Id.OpaqueId, user.Id.Idp, user.Id.OpaqueId); err != nil {
+		_ = tx.Rollback()
+		return nil, errors.Wrap(err, "sql: error updating share state")
+	}
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "INSERT INTO ocm_share_states (share_id, user_idp, user_opaque_id, state) VALUES (?, ?, ?, ?)"), rs.Share.Id.OpaqueId, user.Id.Idp, user.Id.OpaqueId, int32(f.GetState())); err != nil {
+		_ = tx.Rollback()
+		return nil, errors.Wrap(err, "sql: error updating share state")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "sql: error committing transaction")
+	}
+
+	rs.State = f.GetState()
+	return rs, nil
+}
+
+func (m *mgr) AddReceivedShare(ctx context.Context, s *ocm.Share, r *share.RemoteShare) (*ocm.Share, error) {
+	if err := m.insert(ctx, s, r); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *mgr) GetRemoteShare(ctx context.Context, ref *ocm.ShareReference) (*share.RemoteShare, error) {
+	rs, err := m.GetReceivedShare(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &share.RemoteShare{}
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT name, webdav_endpoint, token, ocm_endpoint FROM ocm_remote_shares WHERE share_id = ?"), rs.Share.Id.OpaqueId)
+	if err := row.Scan(&r.Name, &r.WebDAVEndpoint, &r.Token, &r.OCMEndpoint); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.NotFound(ref.String())
+		}
+		return nil, errors.Wrap(err, "sql: error getting remote share")
+	}
+	return r, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/share"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func newTestManager(t *testing.T) *mgr {
+	m := &mgr{c: &config{Config: sqlutil.Config{DBDriver: sqlitetest.Driver}}, db: sqlitetest.Open(t)}
+	if err := sqlutil.Migrate(context.Background(), m.db, m.c.DBDriver, "ocm_share_schema_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestShares(t *testing.T) {
+	m := newTestManager(t)
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "einstein"}, Username: "einstein"}
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "marie"}, Username: "marie"}
+	owner := user.ContextSetUser(context.Background(), einstein)
+	recipient := user.ContextSetUser(context.Background(), marie)
+
+	resource := &provider.ResourceId{StorageId: "s", OpaqueId: "o"}
+	grant := &ocm.ShareGrant{
+		Grantee:     &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_USER, Id: &userpb.UserId{Idp: "cernbox.cern.ch", OpaqueId: "marie"}},
+		Permissions: &ocm.SharePermissions{Permissions: &provider.ResourcePermissions{Stat: true}},
+	}
+
+	s, err := m.Share(owner, resource, grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Share(owner, resource, grant); err == nil {
+		t.Error("expected the same share to be refused")
+	} else if _, ok := err.(errtypes.IsAlreadyExists); !ok {
+		t.Errorf("expected already exists, got %v", err)
+	}
+	ref := &ocm.ShareReference{Spec: &ocm.ShareReference_Id{Id: s.Id}}
+
+	// get
+	if got, err := m.GetShare(owner, ref); err != nil || got.Grantee.Id.OpaqueId != "marie" || !got.Permissions.Permissions.Stat {
+		t.Errorf("GetShare() = %v, %v", got, err)
+	}
+	if _, err := m.GetShare(recipient, ref); err == nil {
+		t.Error("expected the share to be hidden from other users")
+	}
+	key := &ocm.ShareReference{Spec: &ocm.ShareReference_Key{Key: &ocm.ShareKey{Owner: einstein.Id, ResourceId: resource, Grantee: grant.Grantee}}}
+	if got, err := m.GetShare(owner, key); err != nil || got.Id.OpaqueId != s.Id.OpaqueId {
+		t.Errorf("GetShare() by key = %v, %v", got, err)
+	}
+
+	// list
+	if shares, err := m.ListShares(owner, nil); err != nil || len(shares) != 1 {
+		t.Errorf("ListShares() = %v, %v", shares, err)
+	}
+	filter := &ocm.ListOCMSharesRequest_Filter{
+		Type: ocm.ListOCMSharesRequest_Filter_TYPE_RESOURCE_ID,
+		Term: &ocm.ListOCMSharesRequest_Filter_ResourceId{ResourceId: &provider.ResourceId{StorageId: "s", OpaqueId: "other"}},
+	}
+	if shares, err := m.ListShares(owner, []*ocm.ListOCMSharesRequest_Filter{filter}); err != nil || len(shares) != 0 {
+		t.Errorf("ListShares() of another resource = %v, %v", shares, err)
+	}
+
+	// update
+	perms := &ocm.SharePermissions{Permissions: &provider.ResourcePermissions{Stat: true, InitiateFileDownload: true}}
+	if _, err := m.UpdateShare(recipient, ref, perms); err == nil {
+		t.Error("expected other users not to update the share")
+	}
+	if _, err := m.UpdateShare(owner, ref, perms); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.GetShare(owner, ref); err != nil || !got.Permissions.Permissions.InitiateFileDownload {
+		t.Errorf("GetShare() after update = %v, %v", got, err)
+	}
+
+	// shares received from a remote provider have a grantee without idp
+	received := &ocm.Share{
+		ResourceId:  &provider.ResourceId{StorageId: "remote", OpaqueId: "r"},
+		Permissions: &ocm.SharePermissions{Permissions: &provider.ResourcePermissions{Stat: true}},
+		Grantee:     &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_USER, Id: &userpb.UserId{OpaqueId: "marie"}},
+		Owner:       &userpb.UserId{Idp: "cernbox.cern.ch", OpaqueId: "richard"},
+		Creator:     &userpb.UserId{Idp: "cernbox.cern.ch", OpaqueId: "richard"},
+	}
+	remote := &share.RemoteShare{Name: "file", WebDAVEndpoint: "https://cernbox.cern.ch/remote.php/dav/ocm", Token: "token", OCMEndpoint: "https://cernbox.cern.ch/ocm"}
+	if _, err := m.AddReceivedShare(context.Background(), received, remote); err != nil {
+		t.Fatal(err)
+	}
+	rref := &ocm.ShareReference{Spec: &ocm.ShareReference_Id{Id: received.Id}}
+
+	if rss, err := m.ListReceivedShares(recipient); err != nil || len(rss) != 1 || rss[0].Share.Id.OpaqueId != received.Id.OpaqueId || rss[0].State != ocm.ShareState_SHARE_STATE_PENDING {
+		t.Fatalf("ListReceivedShares() = %v, %v", rss, err)
+	}
+	if rss, err := m.ListReceivedShares(owner); err != nil || len(rss) != 0 {
+		t.Errorf("ListReceivedShares() of another user = %v, %v", rss, err)
+	}
+	if _, err := m.GetReceivedShare(owner, rref); err == nil {
+		t.Error("expected the received share to be hidden from other users")
+	}
+	field := &ocm.UpdateReceivedOCMShareRequest_UpdateField{
+		Field: &ocm.UpdateReceivedOCMShareRequest_UpdateField_State{State: ocm.ShareState_SHARE_STATE_ACCEPTED},
+	}
+	if _, err := m.UpdateReceivedShare(recipient, rref, field); err != nil {
+		t.Fatal(err)
+	}
+	if rs, err := m.GetReceivedShare(recipient, rref); err != nil || rs.State != ocm.ShareState_SHARE_STATE_ACCEPTED {
+		t.Errorf("GetReceivedShare() = %v, %v", rs, err)
+	}
+	if got, err := m.GetRemoteShare(recipient, rref); err != nil || *got != *remote {
+		t.Errorf("GetRemoteShare() = %v, %v", got, err)
+	}
+	if _, err := m.GetRemoteShare(owner, rref); err == nil {
+		t.Error("expected the remote share to be hidden from other users")
+	}
+
+	// delete
+	if err := m.Unshare(recipient, ref); err == nil {
+		t.Error("expected other users not to delete the share")
+	}
+	if err := m.Unshare(owner, ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetShare(owner, ref); err == nil {
+		t.Error("expected the deleted share not to be found")
+	}
+	if shares, err := m.ListShares(owner, nil); err != nil || len(shares) != 0 {
+		t.Errorf("ListShares() after unshare = %v, %v", shares, err)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package received defines the internal API of the ocmshareprovider service
+// through which the ocmd service stores the shares received from the remote
+// providers. No user is behind these calls, so the ocmd service
+// authenticates with a secret shared with the ocmshareprovider service. The
+// API is not part of the CS3 APIs, so its messages are plain structs
+// exchanged as JSON over gRPC.
+package received
+
+import (
+	"context"
+	"crypto/subtle"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	"github.com/cs3org/reva/pkg/ocm/share"
+	"github.com/cs3org/reva/pkg/rgrpc/jsoncodec"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const serviceName = "revad.ocm.v1beta1.ReceivedShareAPI"
+
+// AddReceivedShareMethod is the full name of the method storing a received
+// share, which the ocmshareprovider service lets through without a user.
+const AddReceivedShareMethod = "/" + serviceName + "/AddReceivedShare"
+
+// secretHeader is the metadata carrying the secret of the ocmd service.
+const secretHeader = "x-reva-ocm-secret"
+
+// AddReceivedShareRequest holds the share created on a remote provider,
+// owned by one of its users, and the access to the remote resource.
+type AddReceivedShareRequest struct {
+	Share  *ocm.Share         `json:"share"`
+	Remote *share.RemoteShare `json:"remote"`
+}
+
+// AddReceivedShareResponse holds the stored share with its id.
+type AddReceivedShareResponse struct {
+	Status *rpc.Status `json:"status"`
+	Share  *ocm.Share  `json:"share"`
+}
+
+// APIServer is the server API of the received shares.
+type APIServer interface {
+	AddReceivedShare(context.Context, *AddReceivedShareRequest) (*AddReceivedShareResponse, error)
+}
+
+// RegisterAPIServer registers the received shares API on the gRPC server.
+func RegisterAPIServer(s *grpc.Server, srv APIServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*APIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddReceivedShare",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &AddReceivedShareRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(APIServer).AddReceivedShare(ctx, req.(*AddReceivedShareRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: AddReceivedShareMethod}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// Authenticated tells whether the call was made with the secret, an empty
+// secret authenticating no call.
+func Authenticated(ctx context.Context, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, s := range md.Get(secretHeader) {
+		if subtle.ConstantTimeCompare([]byte(s), []byte(secret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Client calls the received shares API with the secret of the ocmd service.
+type Client struct {
+	cc     *grpc.ClientConn
+	secret string
+}
+
+// NewClient returns a client of the received shares API on the connection.
+func NewClient(cc *grpc.ClientConn, secret string) *Client {
+	return &Client{cc: cc, secret: secret}
+}
+
+// AddReceivedShare stores the share received from a remote provider.
+func (c *Client) AddReceivedShare(ctx context.Context, req *AddReceivedShareRequest) (*AddReceivedShareResponse, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, secretHeader, c.secret)
+	res := &AddReceivedShareResponse{}
+	if err := c.cc.Invoke(ctx, AddReceivedShareMethod, req, res, grpc.CallContentSubtype(jsoncodec.Name)); err != nil {
+		return nil, errors.Wrap(err, "received: error calling AddReceivedShare")
+	}
+	return res, nil
+}
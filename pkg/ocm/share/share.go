@@ -20,7 +20,9 @@ package share
 
 import (
 	"context"
+	"fmt"
 
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 )
@@ -51,4 +53,50 @@ type Manager interface {
 
 	// UpdateReceivedShare updates the received share with share state.
 	UpdateReceivedShare(ctx context.Context, ref *ocm.ShareReference, f *ocm.UpdateReceivedOCMShareRequest_UpdateField) (*ocm.ReceivedShare, error)
+
+	// AddReceivedShare stores a share created on a remote provider for a user
+	// of this one, along with the access to the shared resource.
+	AddReceivedShare(ctx context.Context, s *ocm.Share, r *RemoteShare) (*ocm.Share, error)
+
+	// GetRemoteShare returns the access to the resource of a share received
+	// from a remote provider, it is only disclosed to the grantee.
+	GetRemoteShare(ctx context.Context, ref *ocm.ShareReference) (*RemoteShare, error)
+}
+
+// RemoteShare holds how the resource of a share received from a remote
+// provider is accessed: with the token as basic auth username on the webdav
+// endpoint of the remote provider.
+type RemoteShare struct {
+	// Name is the name of the shared resource.
+	Name           string `json:"name"`
+	WebDAVEndpoint string `json:"webdav_endpoint"`
+	Token          string `json:"token"`
+	// OCMEndpoint is the OCM API of the remote provider, which is notified
+	// when the share is accepted or declined.
+	OCMEndpoint string `json:"ocm_endpoint,omitempty"`
+}
+
+// GranteeMatches tells if the user is the grantee of a user share. Grantees
+// of shares received from remote providers have no idp, they are the local
+// user with that id.
+func GranteeMatches(g *provider.Grantee, u *userpb.UserId) bool {
+	if g.GetType() != provider.GranteeType_GRANTEE_TYPE_USER {
+		return false
+	}
+	return g.Id.OpaqueId == u.OpaqueId && (g.Id.Idp == "" || g.Id.Idp == u.Idp)
+}
+
+// CheckStateTransition tells if a received share can go from one state to
+// the other. Shares are received pending, then accepted or declined, and the
+// grantee can change their mind afterwards but not make them pending again.
+func CheckStateTransition(from, to ocm.ShareState) error {
+	switch to {
+	case ocm.ShareState_SHARE_STATE_ACCEPTED, ocm.ShareState_SHARE_STATE_REJECTED:
+		return nil
+	case ocm.ShareState_SHARE_STATE_PENDING:
+		if from == ocm.ShareState_SHARE_STATE_PENDING {
+			return nil
+		}
+	}
+	return fmt.Errorf("share: invalid state transition from %s to %s", from, to)
 }
@@ -0,0 +1,135 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package policy evaluates the authorization policies written by the sites
+// in Rego, with an embedded Open Policy Agent, against the metadata of the
+// requests.
+package policy
+
+import (
+	"context"
+	"io/ioutil"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/pkg/errors"
+)
+
+// DefaultQuery is the rule deciding if a request is allowed.
+const DefaultQuery = "data.reva.authz.allow"
+
+// The share types found in the input.
+const (
+	ShareTypeUser       = "user"
+	ShareTypeGroup      = "group"
+	ShareTypePublicLink = "public_link"
+	ShareTypeOCM        = "ocm"
+)
+
+// Config configures the policy engine.
+type Config struct {
+	// Policies are the files holding the Rego modules.
+	Policies []string `mapstructure:"policies"`
+	// Query must evaluate to true for a request to be allowed, requests
+	// for which it is undefined are denied.
+	Query string `mapstructure:"query"`
+}
+
+// Input is the metadata of a request the policies are evaluated against.
+type Input struct {
+	// Protocol is grpc or http.
+	Protocol string `json:"protocol"`
+	// Method is the full grpc method or the http method.
+	Method string `json:"method"`
+	// Path is the path of the resource, or the url path for http.
+	Path string `json:"path"`
+	// User is missing for anonymous requests.
+	User *User `json:"user,omitempty"`
+	// ShareType is set when the request creates a share.
+	ShareType string `json:"share_type,omitempty"`
+	// Role is the role given by a share, e.g. viewer or editor.
+	Role string `json:"role,omitempty"`
+}
+
+// User describes the user performing a request.
+type User struct {
+	ID       string   `json:"id"`
+	Idp      string   `json:"idp"`
+	Username string   `json:"username"`
+	Mail     string   `json:"mail"`
+	Groups   []string `json:"groups"`
+}
+
+// NewUser returns the description of u in the input.
+func NewUser(u *userpb.User) *User {
+	groups := u.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	return &User{
+		ID:       u.Id.GetOpaqueId(),
+		Idp:      u.Id.GetIdp(),
+		Username: u.Username,
+		Mail:     u.Mail,
+		Groups:   groups,
+	}
+}
+
+// Engine evaluates the policies.
+type Engine struct {
+	query rego.PreparedEvalQuery
+}
+
+// New compiles the policies of the configuration.
+func New(ctx context.Context, c *Config) (*Engine, error) {
+	if len(c.Policies) == 0 {
+		return nil, errors.New("policy: no policies configured")
+	}
+	if c.Query == "" {
+		c.Query = DefaultQuery
+	}
+
+	opts := []func(*rego.Rego){rego.Query(c.Query)}
+	for _, f := range c.Policies {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "policy: error reading policy")
+		}
+		opts = append(opts, rego.Module(f, string(b)))
+	}
+
+	q, err := rego.New(opts...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "policy: error compiling policies")
+	}
+	return &Engine{query: q}, nil
+}
+
+// Allow tells if the policies allow the request. The query must evaluate
+// to true, any other value denies it.
+func (e *Engine) Allow(ctx context.Context, in *Input) (bool, error) {
+	rs, err := e.query.Eval(ctx, rego.EvalInput(in))
+	if err != nil {
+		return false, errors.Wrap(err, "policy: error evaluating policies")
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return false, nil
+	}
+	allowed, ok := rs[0].Expressions[0].Value.(bool)
+	return ok && allowed, nil
+}
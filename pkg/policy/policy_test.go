@@ -0,0 +1,95 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package policy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+const testPolicy = `package reva.authz
+
+default allow = false
+
+allow {
+	not deny
+}
+
+deny {
+	input.share_type == "public_link"
+	input.user.groups[_] == "students"
+}
+
+deny {
+	not input.user
+	input.method == "DELETE"
+}
+`
+
+func TestEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "authz.rego")
+	if err := ioutil.WriteFile(fn, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	e, err := New(ctx, &Config{Policies: []string{fn}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	student := &User{Username: "marie", Groups: []string{"students"}}
+	staff := &User{Username: "einstein", Groups: []string{"staff"}}
+	tests := []struct {
+		name string
+		in   *Input
+		want bool
+	}{
+		{"public link by staff", &Input{Method: "POST", User: staff, ShareType: ShareTypePublicLink}, true},
+		{"public link by student", &Input{Method: "POST", User: student, ShareType: ShareTypePublicLink}, false},
+		{"user share by student", &Input{Method: "POST", User: student, ShareType: ShareTypeUser}, true},
+		{"anonymous delete", &Input{Method: "DELETE"}, false},
+		{"anonymous get", &Input{Method: "GET"}, true},
+	}
+	for _, tt := range tests {
+		got, err := e.Allow(ctx, tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Allow() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	e, err = New(ctx, &Config{Policies: []string{fn}, Query: "data.reva.authz.missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := e.Allow(ctx, &Input{Method: "GET", User: staff}); ok {
+		t.Error("an undefined query allowed the request")
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package pipeline runs the post-processing steps on the finished uploads,
+// in the background, retrying the failed steps and recording the uploads
+// that could not be processed in a dead letter file.
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/postprocessing"
+	"github.com/cs3org/reva/pkg/postprocessing/step/registry"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// maxRetryDelay caps the delay between the retries of a step.
+const maxRetryDelay = time.Hour
+
+// Config configures the pipeline.
+type Config struct {
+	// Steps are the names of the steps, run in this order.
+	Steps       []string                          `mapstructure:"steps"`
+	StepConfigs map[string]map[string]interface{} `mapstructure:"step_configs"`
+	// Workers is the number of uploads processed at the same time.
+	Workers int `mapstructure:"workers"`
+	// QueueSize is the number of uploads waiting for a worker, the ones
+	// finished when it is full go to the dead letter file.
+	QueueSize int `mapstructure:"queue_size"`
+	// MaxRetries is the number of times a failing step is retried, the
+	// first time after RetryDelay seconds, the delay doubling every time.
+	MaxRetries int `mapstructure:"max_retries"`
+	RetryDelay int `mapstructure:"retry_delay"`
+	// DeadLetter is the file the uploads rejected or failing all their
+	// retries are appended to, as JSON lines, they are only logged if empty.
+	DeadLetter string `mapstructure:"dead_letter"`
+}
+
+func (c *Config) init() {
+	if c.Workers == 0 {
+		c.Workers = 2
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 1000
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 5
+	}
+	if c.RetryDelay == 0 {
+		c.RetryDelay = 10
+	}
+}
+
+type namedStep struct {
+	name string
+	step postprocessing.Step
+}
+
+// item is an upload in the pipeline, next is the index of the step to run.
+type item struct {
+	upload *postprocessing.Upload
+	next   int
+}
+
+// Pipeline processes the uploads. A nil Pipeline is valid, the uploads are
+// then not processed.
+type Pipeline struct {
+	conf  *Config
+	fs    storage.FS
+	steps []namedStep
+	queue chan *item
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	retries map[*item]*time.Timer
+}
+
+// New returns a pipeline running the configured steps on the files of fs,
+// or nil if there are no steps.
+func New(c *Config, fs storage.FS) (*Pipeline, error) {
+	if len(c.Steps) == 0 {
+		return nil, nil
+	}
+	c.init()
+
+	if c.DeadLetter != "" {
+		if err := os.MkdirAll(filepath.Dir(c.DeadLetter), 0700); err != nil {
+			return nil, errors.Wrap(err, "pipeline: could not create dead letter dir")
+		}
+	}
+
+	p := &Pipeline{
+		conf:    c,
+		fs:      fs,
+		queue:   make(chan *item, c.QueueSize),
+		retries: map[*item]*time.Timer{},
+	}
+	for _, name := range c.Steps {
+		f, ok := registry.NewFuncs[name]
+		if !ok {
+			p.closeSteps()
+			return nil, fmt.Errorf("pipeline: step not found: %s", name)
+		}
+		s, err := f(c.StepConfigs[name])
+		if err != nil {
+			p.closeSteps()
+			return nil, errors.Wrapf(err, "pipeline: error creating step %s", name)
+		}
+		p.steps = append(p.steps, namedStep{name: name, step: s})
+	}
+
+	p.ctx, p.cancel = context.WithCancel(appctx.WithLogger(context.Background(), &log.Logger))
+	for i := 0; i < c.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p, nil
+}
+
+// Submit queues the upload of the file fn, made by the user of the context.
+// It does not wait for the processing.
+func (p *Pipeline) Submit(ctx context.Context, fn string, size int64) {
+	if p == nil {
+		return
+	}
+	u := &postprocessing.Upload{
+		ID:   uuid.New().String(),
+		Path: fn,
+		Size: size,
+		Time: time.Now().UTC(),
+	}
+	if usr, ok := user.ContextGetUser(ctx); ok {
+		u.User = usr
+	}
+	if !p.enqueue(&item{upload: u}) {
+		u.Error = "queue full"
+		p.deadLetter(u)
+	}
+}
+
+// enqueue adds the item to the queue, it returns false if the queue is full
+// or the pipeline closed.
+func (p *Pipeline) enqueue(it *item) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.queue <- it:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pipeline) work() {
+	defer p.wg.Done()
+	for it := range p.queue {
+		if p.isClosed() {
+			it.upload.Error = "pipeline stopped"
+			p.deadLetter(it.upload)
+			continue
+		}
+		p.process(it)
+	}
+}
+
+func (p *Pipeline) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// process runs the remaining steps on the upload, until one fails.
+func (p *Pipeline) process(it *item) {
+	u := it.upload
+	ctx := p.ctx
+	if u.User != nil {
+		ctx = user.ContextSetUser(ctx, u.User)
+	}
+	l := appctx.GetLogger(ctx)
+
+	for it.next < len(p.steps) {
+		s := p.steps[it.next]
+		err := s.step.Process(ctx, p.fs, u)
+		if err == nil {
+			it.next++
+			u.Step, u.Attempts, u.Error = "", 0, ""
+			continue
+		}
+
+		u.Step, u.Error = s.name, err.Error()
+		u.Attempts++
+		if postprocessing.IsRejection(err) {
+			u.Rejected = true
+			p.deadLetter(u)
+			return
+		}
+		if _, ok := errors.Cause(err).(errtypes.IsNotFound); ok {
+			l.Debug().Str("path", u.Path).Str("step", s.name).Msg("pipeline: file removed before its processing")
+			return
+		}
+		if u.Attempts > p.conf.MaxRetries {
+			p.deadLetter(u)
+			return
+		}
+		l.Warn().Err(err).Str("path", u.Path).Str("step", s.name).Int("attempts", u.Attempts).Msg("pipeline: step failed, retrying")
+		p.retry(it)
+		return
+	}
+	l.Debug().Str("path", u.Path).Str("id", u.ID).Msg("pipeline: upload processed")
+}
+
+// retry queues the item again after the retry delay of its attempts.
+func (p *Pipeline) retry(it *item) {
+	delay := time.Duration(p.conf.RetryDelay) * time.Second
+	for i := 1; i < it.upload.Attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.deadLetter(it.upload)
+		return
+	}
+	p.retries[it] = time.AfterFunc(delay, func() {
+		p.mu.Lock()
+		delete(p.retries, it)
+		p.mu.Unlock()
+		if !p.enqueue(it) {
+			p.deadLetter(it.upload)
+		}
+	})
+	p.mu.Unlock()
+}
+
+// deadLetter records the upload that could not be processed.
+func (p *Pipeline) deadLetter(u *postprocessing.Upload) {
+	l := log.Warn()
+	if !u.Rejected {
+		l = log.Error()
+	}
+	l.Str("path", u.Path).Str("id", u.ID).Str("step", u.Step).Int("attempts", u.Attempts).Str("error", u.Error).Msg("pipeline: upload not processed")
+
+	if p.conf.DeadLetter == "" {
+		return
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		log.Error().Err(err).Msg("pipeline: error encoding dead letter")
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := os.OpenFile(p.conf.DeadLetter, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Error().Err(err).Msg("pipeline: error opening dead letter file")
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Error().Err(err).Msg("pipeline: error writing dead letter")
+	}
+}
+
+// Close stops the pipeline. The running steps are canceled, and the uploads
+// not processed yet are written to the dead letter file.
+func (p *Pipeline) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	var pending []*item
+	for it, t := range p.retries {
+		if t.Stop() {
+			pending = append(pending, it)
+		}
+	}
+	p.retries = nil
+	close(p.queue)
+	p.mu.Unlock()
+
+	p.cancel()
+	for _, it := range pending {
+		p.deadLetter(it.upload)
+	}
+	p.wg.Wait()
+	p.closeSteps()
+	return nil
+}
+
+// closeSteps closes the steps holding resources, like connections.
+func (p *Pipeline) closeSteps() {
+	for _, s := range p.steps {
+		if c, ok := s.step.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Error().Err(err).Str("step", s.name).Msg("pipeline: error closing step")
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cs3org/reva/pkg/postprocessing"
+	"github.com/cs3org/reva/pkg/postprocessing/step/registry"
+	"github.com/cs3org/reva/pkg/storage"
+)
+
+// recorder records the steps run on the files.
+type recorder struct {
+	mu  sync.Mutex
+	ran map[string][]string
+}
+
+func (r *recorder) add(fn, step string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ran[fn] = append(r.ran[fn], step)
+	return len(r.ran[fn])
+}
+
+func (r *recorder) get(fn string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.ran[fn]...)
+}
+
+type testStep struct {
+	name string
+	rec  *recorder
+}
+
+// Process rejects /infected in the reject step, always fails for /bad and
+// fails the first time for /flaky in the fail step.
+func (s *testStep) Process(ctx context.Context, fs storage.FS, u *postprocessing.Upload) error {
+	n := s.rec.add(u.Path, s.name)
+	switch {
+	case s.name == "reject" && u.Path == "/infected":
+		return postprocessing.Rejection("infected")
+	case s.name == "fail" && (u.Path == "/bad" || (u.Path == "/flaky" && n == 2)):
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func newPipeline(t *testing.T, steps ...string) (*Pipeline, *recorder, string) {
+	rec := &recorder{ran: map[string][]string{}}
+	for _, name := range steps {
+		name := name
+		registry.Register("test-"+name, func(map[string]interface{}) (postprocessing.Step, error) {
+			return &testStep{name: name, rec: rec}, nil
+		})
+	}
+	dir, err := ioutil.TempDir("", "pipeline-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &Config{
+		MaxRetries: 1,
+		RetryDelay: 1,
+		DeadLetter: path.Join(dir, "dead-letter.jsonl"),
+	}
+	for _, name := range steps {
+		conf.Steps = append(conf.Steps, "test-"+name)
+	}
+	p, err := New(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, rec, dir
+}
+
+func deadLetters(t *testing.T, fn string) []*postprocessing.Upload {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var uploads []*postprocessing.Upload
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		u := &postprocessing.Upload{}
+		if err := json.Unmarshal(scanner.Bytes(), u); err != nil {
+			t.Fatal(err)
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the pipeline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSteps(t *testing.T) {
+	p, rec, dir := newPipeline(t, "a", "reject", "b")
+	defer os.RemoveAll(dir)
+
+	p.Submit(context.Background(), "/clean", 10)
+	p.Submit(context.Background(), "/infected", 10)
+	waitFor(t, func() bool { return len(rec.get("/clean")) == 3 && len(rec.get("/infected")) == 2 })
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rec.get("/clean"); !equal(got, []string{"a", "reject", "b"}) {
+		t.Errorf("unexpected steps for the clean file: %v", got)
+	}
+	if got := rec.get("/infected"); !equal(got, []string{"a", "reject"}) {
+		t.Errorf("unexpected steps for the infected file: %v", got)
+	}
+	dead := deadLetters(t, path.Join(dir, "dead-letter.jsonl"))
+	if len(dead) != 1 || dead[0].Path != "/infected" || !dead[0].Rejected || dead[0].Step != "test-reject" || dead[0].Attempts != 1 {
+		t.Fatalf("unexpected dead letters: %+v", dead)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	p, rec, dir := newPipeline(t, "first", "fail", "last")
+	defer os.RemoveAll(dir)
+	dl := path.Join(dir, "dead-letter.jsonl")
+
+	p.Submit(context.Background(), "/flaky", 10)
+	p.Submit(context.Background(), "/bad", 10)
+	waitFor(t, func() bool { return len(rec.get("/flaky")) == 4 && len(deadLetters(t, dl)) == 1 })
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the steps which succeeded are not run again
+	if got := rec.get("/flaky"); !equal(got, []string{"first", "fail", "fail", "last"}) {
+		t.Errorf("unexpected steps for the flaky file: %v", got)
+	}
+	if got := rec.get("/bad"); !equal(got, []string{"first", "fail", "fail"}) {
+		t.Errorf("unexpected steps for the bad file: %v", got)
+	}
+	dead := deadLetters(t, dl)
+	if len(dead) != 1 || dead[0].Path != "/bad" || dead[0].Rejected || dead[0].Step != "test-fail" || dead[0].Attempts != 2 || dead[0].Error != "unavailable" {
+		t.Fatalf("unexpected dead letters: %+v", dead)
+	}
+}
+
+func TestClose(t *testing.T) {
+	p, rec, dir := newPipeline(t, "once", "fail")
+	defer os.RemoveAll(dir)
+	dl := path.Join(dir, "dead-letter.jsonl")
+
+	p.Submit(context.Background(), "/bad", 10)
+	waitFor(t, func() bool { return len(rec.get("/bad")) == 2 })
+	// the upload waiting for its retry is not lost
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p.Submit(context.Background(), "/late", 10)
+
+	dead := deadLetters(t, dl)
+	if len(dead) != 2 || dead[0].Path != "/bad" || dead[0].Step != "test-fail" || dead[1].Path != "/late" {
+		t.Fatalf("unexpected dead letters: %+v", dead)
+	}
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(&Config{}, nil)
+	if err != nil || p != nil {
+		t.Fatalf("expected no pipeline without steps, got %v, %v", p, err)
+	}
+	// a nil pipeline ignores the uploads
+	p.Submit(context.Background(), "/file", 10)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(&Config{Steps: []string{"missing"}}, nil); err == nil {
+		t.Fatal("expected an error for an unknown step")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package postprocessing defines the steps run on the uploaded files once
+// they are in the storage, in the background of the uploads.
+package postprocessing
+
+import (
+	"context"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// Upload is a finished upload going through the steps.
+type Upload struct {
+	ID string `json:"id"`
+	// Path is the path of the file in the storage of the data server.
+	Path string       `json:"path"`
+	Size int64        `json:"size"`
+	User *userpb.User `json:"user,omitempty"`
+	Time time.Time    `json:"time"`
+	// Step is the name of the step that failed or rejected the upload,
+	// Attempts the number of times it ran and Error its last error.
+	Step     string `json:"step,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Rejected tells that a step refused the file, like an infected one,
+	// rather than failed to process it.
+	Rejected bool `json:"rejected,omitempty"`
+}
+
+// Ref returns the reference of the uploaded file.
+func (u *Upload) Ref() *provider.Reference {
+	return &provider.Reference{Spec: &provider.Reference_Path{Path: u.Path}}
+}
+
+// Step processes the uploaded files.
+type Step interface {
+	// Process processes the file of the upload in the storage. The errors
+	// are retried, except the rejections and the errtypes.IsNotFound of
+	// the files removed in the meantime.
+	Process(ctx context.Context, fs storage.FS, u *Upload) error
+}
+
+// Rejection is the error of the steps refusing a file, the following steps
+// do not run and the upload is not retried.
+type Rejection string
+
+func (e Rejection) Error() string { return "postprocessing: file rejected: " + string(e) }
+
+// IsRejection tells whether the cause of the error is a Rejection.
+func IsRejection(err error) bool {
+	_, ok := errors.Cause(err).(Rejection)
+	return ok
+}
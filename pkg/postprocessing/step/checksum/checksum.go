@@ -0,0 +1,58 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package checksum
+
+import (
+	"context"
+	"io"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/postprocessing"
+	"github.com/cs3org/reva/pkg/postprocessing/step/registry"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("checksum", New)
+}
+
+type step struct{}
+
+// New returns a step computing the checksums of the files, like the
+// dataprovider does on the PUT uploads, for the resumable ones.
+func New(m map[string]interface{}) (postprocessing.Step, error) {
+	return &step{}, nil
+}
+
+func (s *step) Process(ctx context.Context, fs storage.FS, u *postprocessing.Upload) error {
+	rc, err := fs.Download(ctx, u.Ref())
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	hasher := checksums.NewHasher()
+	if _, err := io.Copy(hasher, rc); err != nil {
+		return errors.Wrap(err, "checksum: error reading file")
+	}
+	md := &provider.ArbitraryMetadata{Metadata: map[string]string{checksums.MetadataKey: hasher.String()}}
+	return fs.SetArbitraryMetadata(ctx, u.Ref(), md)
+}
@@ -0,0 +1,189 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package classify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/metadata"
+	"github.com/cs3org/reva/pkg/mime"
+	"github.com/cs3org/reva/pkg/postprocessing"
+	"github.com/cs3org/reva/pkg/postprocessing/step/registry"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("classify", New)
+}
+
+// Rule gives its label to the files matching it.
+type Rule struct {
+	Label string `mapstructure:"label"`
+	// Types are extensions, like .pdf, and mime types, like image/* or
+	// application/pdf, any of them matching.
+	Types []string `mapstructure:"types"`
+	// Patterns are regular expressions, any of them matching the content
+	// of the text files, read up to the max size.
+	Patterns []string `mapstructure:"patterns"`
+}
+
+type config struct {
+	Rules []*Rule `mapstructure:"rules"`
+	// MaxSize is the size in bytes of the content read for the patterns.
+	MaxSize int64 `mapstructure:"max_size"`
+}
+
+type rule struct {
+	label    string
+	types    []string
+	patterns []*regexp.Regexp
+}
+
+type step struct {
+	conf  *config
+	rules []*rule
+}
+
+// New returns a step labelling the files matching the rules, the labels are
+// stored in the metadata.KeyClassification metadata.
+func New(m map[string]interface{}) (postprocessing.Step, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "classify: error decoding conf")
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = 1024 * 1024
+	}
+
+	s := &step{conf: c}
+	for _, r := range c.Rules {
+		if r.Label == "" || strings.Contains(r.Label, ",") {
+			return nil, fmt.Errorf("classify: invalid label: %q", r.Label)
+		}
+		if len(r.Types) == 0 && len(r.Patterns) == 0 {
+			return nil, fmt.Errorf("classify: rule %s matches nothing", r.Label)
+		}
+		cr := &rule{label: r.Label}
+		for _, t := range r.Types {
+			cr.types = append(cr.types, strings.ToLower(strings.TrimSpace(t)))
+		}
+		for _, p := range r.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, errors.Wrapf(err, "classify: invalid pattern of %s", r.Label)
+			}
+			cr.patterns = append(cr.patterns, re)
+		}
+		s.rules = append(s.rules, cr)
+	}
+	return s, nil
+}
+
+func (s *step) Process(ctx context.Context, fs storage.FS, u *postprocessing.Upload) error {
+	rc, err := fs.Download(ctx, u.Ref())
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(rc, s.conf.MaxSize))
+	rc.Close()
+	if err != nil {
+		return errors.Wrap(err, "classify: error reading file")
+	}
+
+	labels := s.classify(u.Path, content)
+	if len(labels) == 0 {
+		return nil
+	}
+	return fs.SetArbitraryMetadata(ctx, u.Ref(), &provider.ArbitraryMetadata{Metadata: map[string]string{
+		metadata.KeyClassification: strings.Join(labels, ","),
+	}})
+}
+
+// classify returns the sorted labels of the rules matching the file. A rule
+// with both types and patterns needs both to match.
+func (s *step) classify(fn string, content []byte) []string {
+	ext := strings.ToLower(path.Ext(fn))
+	types := []string{mediaType(http.DetectContentType(content))}
+	if t := mime.Detect(false, fn); t != "" {
+		types = append(types, mediaType(t))
+	}
+	text := strings.HasPrefix(types[0], "text/")
+
+	found := map[string]bool{}
+	for _, r := range s.rules {
+		if len(r.types) > 0 && !matchesType(r.types, ext, types) {
+			continue
+		}
+		if len(r.patterns) > 0 && (!text || !matchesPattern(r.patterns, content)) {
+			continue
+		}
+		found[r.label] = true
+	}
+
+	labels := make([]string, 0, len(found))
+	for l := range found {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func mediaType(t string) string {
+	if i := strings.Index(t, ";"); i >= 0 {
+		t = t[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+func matchesType(entries []string, ext string, types []string) bool {
+	for _, e := range entries {
+		if strings.HasPrefix(e, ".") {
+			if e == ext {
+				return true
+			}
+			continue
+		}
+		for _, t := range types {
+			if e == t || e == "*/*" || (strings.HasSuffix(e, "/*") && strings.HasPrefix(t, strings.TrimSuffix(e, "*"))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesPattern(patterns []*regexp.Regexp, content []byte) bool {
+	for _, re := range patterns {
+		if re.Match(content) {
+			return true
+		}
+	}
+	return false
+}
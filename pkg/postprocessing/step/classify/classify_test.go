@@ -0,0 +1,71 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package classify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	st, err := New(map[string]interface{}{
+		"rules": []map[string]interface{}{
+			{"label": "confidential", "patterns": []string{`(?i)\bconfidential\b`}},
+			{"label": "media", "types": []string{"image/*", ".mp4"}},
+			{"label": "financial", "types": []string{".csv"}, "patterns": []string{`IBAN`}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := st.(*step)
+
+	tests := []struct {
+		fn      string
+		content string
+		labels  string
+	}{
+		{"/notes.txt", "nothing to see", ""},
+		{"/memo.txt", "Strictly Confidential", "confidential"},
+		{"/photo.jpg", "\xff\xd8\xff\xe0 jpeg", "media"},
+		{"/clip.mp4", "", "media"},
+		{"/accounts.csv", "name,IBAN\nconfidential,DE89", "confidential,financial"},
+		{"/accounts.txt", "name,IBAN", ""},
+		// patterns only match the text files
+		{"/blob.bin", "\x00\x01 confidential", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(s.classify(tt.fn, []byte(tt.content)), ","); got != tt.labels {
+			t.Errorf("classify(%s): got %q, expected %q", tt.fn, got, tt.labels)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, r := range []map[string]interface{}{
+		{"label": "", "types": []string{".pdf"}},
+		{"label": "a,b", "types": []string{".pdf"}},
+		{"label": "empty"},
+		{"label": "broken", "patterns": []string{"("}},
+	} {
+		if _, err := New(map[string]interface{}{"rules": []map[string]interface{}{r}}); err == nil {
+			t.Errorf("expected an error for rule %v", r)
+		}
+	}
+}
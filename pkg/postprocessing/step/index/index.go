@@ -0,0 +1,82 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package index
+
+import (
+	"context"
+	"fmt"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/events"
+	pubregistry "github.com/cs3org/reva/pkg/events/publisher/registry"
+	"github.com/cs3org/reva/pkg/postprocessing"
+	"github.com/cs3org/reva/pkg/postprocessing/step/registry"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("index", New)
+}
+
+type config struct {
+	Publisher  string                            `mapstructure:"publisher"`
+	Publishers map[string]map[string]interface{} `mapstructure:"publishers"`
+}
+
+type step struct {
+	publisher events.Publisher
+}
+
+// New returns a step publishing the upload events the search and the
+// metadata services index the files from. Placed after the other steps,
+// the files are only indexed once they are scanned and classified.
+func New(m map[string]interface{}) (postprocessing.Step, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "index: error decoding conf")
+	}
+	f, ok := pubregistry.NewFuncs[c.Publisher]
+	if !ok {
+		return nil, fmt.Errorf("index: events publisher not found: %s", c.Publisher)
+	}
+	publisher, err := f(c.Publishers[c.Publisher])
+	if err != nil {
+		return nil, err
+	}
+	return &step{publisher: publisher}, nil
+}
+
+func (s *step) Process(ctx context.Context, fs storage.FS, u *postprocessing.Upload) error {
+	var id *userpb.UserId
+	if u.User != nil {
+		id = u.User.Id
+	}
+	e := events.New(events.TypeFileUploaded, id)
+	e.Path = u.Path
+	if u.Size > 0 {
+		e.Size = uint64(u.Size)
+	}
+	return s.publisher.Publish(ctx, e)
+}
+
+func (s *step) Close() error {
+	return s.publisher.Close()
+}
@@ -0,0 +1,151 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/antivirus"
+	avregistry "github.com/cs3org/reva/pkg/antivirus/scanner/registry"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/postprocessing"
+	"github.com/cs3org/reva/pkg/postprocessing/step/registry"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("scan", New)
+}
+
+type config struct {
+	Scanner  string                            `mapstructure:"scanner"`
+	Scanners map[string]map[string]interface{} `mapstructure:"scanners"`
+	// InfectedAction is either delete or quarantine, quarantined files are
+	// deleted as well but kept in the QuarantineFolder.
+	InfectedAction   string `mapstructure:"infected_action"`
+	QuarantineFolder string `mapstructure:"quarantine_folder"`
+}
+
+type step struct {
+	conf    *config
+	scanner antivirus.Scanner
+}
+
+// New returns a step scanning the files with an antivirus scanner. Unlike
+// the scans of the dataprovider, the infected files are in the storage
+// until they are scanned, they are then deleted.
+func New(m map[string]interface{}) (postprocessing.Step, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "scan: error decoding conf")
+	}
+	if c.InfectedAction == "" {
+		c.InfectedAction = "delete"
+	}
+	if c.InfectedAction != "delete" && c.InfectedAction != "quarantine" {
+		return nil, fmt.Errorf("scan: invalid infected_action: %s", c.InfectedAction)
+	}
+	if c.InfectedAction == "quarantine" {
+		if c.QuarantineFolder == "" {
+			c.QuarantineFolder = path.Join(os.TempDir(), "quarantine")
+		}
+		if err := os.MkdirAll(c.QuarantineFolder, 0700); err != nil {
+			return nil, errors.Wrap(err, "scan: could not create quarantine dir")
+		}
+	}
+
+	f, ok := avregistry.NewFuncs[c.Scanner]
+	if !ok {
+		return nil, fmt.Errorf("scan: antivirus scanner not found: %s", c.Scanner)
+	}
+	scanner, err := f(c.Scanners[c.Scanner])
+	if err != nil {
+		return nil, err
+	}
+	return &step{conf: c, scanner: scanner}, nil
+}
+
+func (s *step) Process(ctx context.Context, fs storage.FS, u *postprocessing.Upload) error {
+	rc, err := fs.Download(ctx, u.Ref())
+	if err != nil {
+		return err
+	}
+	res, err := s.scanner.Scan(ctx, rc)
+	rc.Close()
+	if err != nil {
+		return errors.Wrap(err, "scan: error scanning file")
+	}
+
+	if !res.Infected {
+		return fs.SetArbitraryMetadata(ctx, u.Ref(), &provider.ArbitraryMetadata{Metadata: map[string]string{
+			antivirus.MetadataStatusKey:  antivirus.StatusClean,
+			antivirus.MetadataScannerKey: s.scanner.Name(),
+			antivirus.MetadataDateKey:    time.Now().UTC().Format(time.RFC3339),
+		}})
+	}
+
+	log := appctx.GetLogger(ctx)
+	log.Warn().Str("path", u.Path).Str("virus", res.Virus).Msg("scan: infected file deleted")
+	if s.conf.InfectedAction == "quarantine" {
+		qfn, err := s.quarantine(ctx, fs, u)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("path", u.Path).Str("quarantine", qfn).Msg("scan: infected file quarantined")
+	}
+	if err := fs.Delete(ctx, u.Ref()); err != nil {
+		return errors.Wrap(err, "scan: error deleting infected file")
+	}
+	virus := res.Virus
+	if virus == "" {
+		virus = "unknown virus"
+	}
+	return postprocessing.Rejection("infected with " + virus)
+}
+
+// quarantine copies the infected file to the quarantine folder and returns
+// the name it is stored under.
+func (s *step) quarantine(ctx context.Context, fs storage.FS, u *postprocessing.Upload) (string, error) {
+	rc, err := fs.Download(ctx, u.Ref())
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	f, err := ioutil.TempFile(s.conf.QuarantineFolder, fmt.Sprintf("%d-%s.", time.Now().Unix(), path.Base(u.Path)))
+	if err != nil {
+		return "", errors.Wrap(err, "scan: error creating quarantine file")
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, rc); err != nil {
+		os.Remove(f.Name())
+		return "", errors.Wrap(err, "scan: error writing quarantine file")
+	}
+	return f.Name(), nil
+}
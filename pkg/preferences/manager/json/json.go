@@ -0,0 +1,208 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"sync"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/jsonfile"
+	"github.com/cs3org/reva/pkg/preferences"
+	"github.com/cs3org/reva/pkg/preferences/manager/registry"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("json", New)
+}
+
+type config struct {
+	File string `mapstructure:"file"`
+}
+
+type preferencesModel struct {
+	Preferences map[string]map[string]map[string]string `json:"preferences"` // map[user]map[namespace]map[key]value
+}
+
+type mgr struct {
+	c          *config
+	sync.Mutex // concurrent access to the file and model
+	model      *preferencesModel
+	file       *jsonfile.File
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new preferences manager that persists the preferences to a
+// json file. The file is reloaded when it changes, so that it can be shared
+// by several services.
+func New(m map[string]interface{}) (preferences.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	// if file is not set we use temporary file
+	if c.File == "" {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			err = errors.Wrap(err, "error creating temporary directory for storing preferences")
+			return nil, err
+		}
+		c.File = path.Join(dir, "preferences.json")
+	}
+
+	f, err := jsonfile.Open(c.File)
+	if err != nil {
+		err = errors.Wrap(err, "error opening/creating the file")
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, file: f}
+	if err := mgr.load(); err != nil {
+		err = errors.Wrap(err, "error loading the file containing the preferences")
+		return nil, err
+	}
+	return mgr, nil
+}
+
+// load replaces the preferences by those of the file when it changed.
+func (m *mgr) load() error {
+	model := &preferencesModel{}
+	if ok, err := m.file.Load(model); err != nil || !ok {
+		return err
+	}
+	if model.Preferences == nil {
+		model.Preferences = map[string]map[string]map[string]string{}
+	}
+
+	m.model = model
+	return nil
+}
+
+func (m *mgr) save() error {
+	return m.file.Save(m.model)
+}
+
+func userKey(id *userpb.UserId) string {
+	return id.Idp + "!" + id.OpaqueId
+}
+
+func (m *mgr) SetKey(ctx context.Context, namespace, key, value string) error {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	uk := userKey(u.Id)
+	if m.model.Preferences[uk] == nil {
+		m.model.Preferences[uk] = map[string]map[string]string{}
+	}
+	if m.model.Preferences[uk][namespace] == nil {
+		m.model.Preferences[uk][namespace] = map[string]string{}
+	}
+	m.model.Preferences[uk][namespace][key] = value
+
+	if err := m.save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
+
+func (m *mgr) GetKey(ctx context.Context, namespace, key string) (string, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return "", err
+	}
+
+	value, ok := m.model.Preferences[userKey(u.Id)][namespace][key]
+	if !ok {
+		return "", errtypes.NotFound(namespace + "/" + key)
+	}
+	return value, nil
+}
+
+func (m *mgr) ListKeys(ctx context.Context, namespace string) ([]*preferences.Preference, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	list := []*preferences.Preference{}
+	for ns, keys := range m.model.Preferences[userKey(u.Id)] {
+		if namespace != "" && ns != namespace {
+			continue
+		}
+		for k, v := range keys {
+			list = append(list, &preferences.Preference{Namespace: ns, Key: k, Value: v})
+		}
+	}
+	preferences.Sort(list)
+	return list, nil
+}
+
+func (m *mgr) DeleteKey(ctx context.Context, namespace, key string) error {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	uk := userKey(u.Id)
+	if _, ok := m.model.Preferences[uk][namespace][key]; !ok {
+		return errtypes.NotFound(namespace + "/" + key)
+	}
+	delete(m.model.Preferences[uk][namespace], key)
+	if len(m.model.Preferences[uk][namespace]) == 0 {
+		delete(m.model.Preferences[uk], namespace)
+	}
+
+	if err := m.save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/preferences"
+	"github.com/cs3org/reva/pkg/preferences/manager/registry"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func init() {
+	registry.Register("memory", New)
+}
+
+type mgr struct {
+	sync.Mutex
+	keys map[string]map[string]map[string]string // map[user]map[namespace]map[key]value
+}
+
+// New returns a new preferences manager keeping the preferences in memory,
+// they are lost when the service restarts.
+func New(m map[string]interface{}) (preferences.Manager, error) {
+	return &mgr{keys: map[string]map[string]map[string]string{}}, nil
+}
+
+func userKey(id *userpb.UserId) string {
+	return id.Idp + "!" + id.OpaqueId
+}
+
+func (m *mgr) SetKey(ctx context.Context, namespace, key, value string) error {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	uk := userKey(u.Id)
+	if m.keys[uk] == nil {
+		m.keys[uk] = map[string]map[string]string{}
+	}
+	if m.keys[uk][namespace] == nil {
+		m.keys[uk][namespace] = map[string]string{}
+	}
+	m.keys[uk][namespace][key] = value
+	return nil
+}
+
+func (m *mgr) GetKey(ctx context.Context, namespace, key string) (string, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	value, ok := m.keys[userKey(u.Id)][namespace][key]
+	if !ok {
+		return "", errtypes.NotFound(namespace + "/" + key)
+	}
+	return value, nil
+}
+
+func (m *mgr) ListKeys(ctx context.Context, namespace string) ([]*preferences.Preference, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	list := []*preferences.Preference{}
+	for ns, keys := range m.keys[userKey(u.Id)] {
+		if namespace != "" && ns != namespace {
+			continue
+		}
+		for k, v := range keys {
+			list = append(list, &preferences.Preference{Namespace: ns, Key: k, Value: v})
+		}
+	}
+	preferences.Sort(list)
+	return list, nil
+}
+
+func (m *mgr) DeleteKey(ctx context.Context, namespace, key string) error {
+	u := user.ContextMustGetUser(ctx)
+
+	m.Lock()
+	defer m.Unlock()
+
+	keys := m.keys[userKey(u.Id)][namespace]
+	if _, ok := keys[key]; !ok {
+		return errtypes.NotFound(namespace + "/" + key)
+	}
+	delete(keys, key)
+	return nil
+}
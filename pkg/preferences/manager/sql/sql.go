@@ -0,0 +1,161 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements a preferences manager backed by a MySQL or
+// PostgreSQL database.
+package sql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/preferences"
+	"github.com/cs3org/reva/pkg/preferences/manager/registry"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+}
+
+type mgr struct {
+	c  *config
+	db *sql.DB
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new preferences manager backed by a SQL database.
+func New(m map[string]interface{}) (preferences.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, db: db}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "preferences_schema_migrations", migrations); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// migrations contains the schema changes in the order they are applied.
+// The applied version is tracked in the preferences_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS preferences (
+		user_idp VARCHAR(255) NOT NULL,
+		user_opaque_id VARCHAR(255) NOT NULL,
+		namespace VARCHAR(255) NOT NULL,
+		pref_key VARCHAR(255) NOT NULL,
+		pref_value TEXT NOT NULL,
+		PRIMARY KEY (user_idp, user_opaque_id, namespace, pref_key)
+	)`,
+}
+
+func (m *mgr) SetKey(ctx context.Context, namespace, key, value string) error {
+	u := user.ContextMustGetUser(ctx)
+
+	// upsert, with the syntax of the driver
+	query := "INSERT INTO preferences (user_idp, user_opaque_id, namespace, pref_key, pref_value) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE pref_value = VALUES(pref_value)"
+	if m.c.DBDriver == "postgres" {
+		query = "INSERT INTO preferences (user_idp, user_opaque_id, namespace, pref_key, pref_value) VALUES (?, ?, ?, ?, ?) ON CONFLICT (user_idp, user_opaque_id, namespace, pref_key) DO UPDATE SET pref_value = EXCLUDED.pref_value"
+	}
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), u.Id.Idp, u.Id.OpaqueId, namespace, key, value); err != nil {
+		return errors.Wrap(err, "sql: error setting preference")
+	}
+	return nil
+}
+
+func (m *mgr) GetKey(ctx context.Context, namespace, key string) (string, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	var value string
+	query := "SELECT pref_value FROM preferences WHERE user_idp = ? AND user_opaque_id = ? AND namespace = ? AND pref_key = ?"
+	err := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), u.Id.Idp, u.Id.OpaqueId, namespace, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", errtypes.NotFound(namespace + "/" + key)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "sql: error getting preference")
+	}
+	return value, nil
+}
+
+func (m *mgr) ListKeys(ctx context.Context, namespace string) ([]*preferences.Preference, error) {
+	u := user.ContextMustGetUser(ctx)
+
+	query := "SELECT namespace, pref_key, pref_value FROM preferences WHERE user_idp = ? AND user_opaque_id = ?"
+	args := []interface{}{u.Id.Idp, u.Id.OpaqueId}
+	if namespace != "" {
+		query += " AND namespace = ?"
+		args = append(args, namespace)
+	}
+	query += " ORDER BY namespace, pref_key"
+
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing preferences")
+	}
+	defer rows.Close()
+
+	list := []*preferences.Preference{}
+	for rows.Next() {
+		p := &preferences.Preference{}
+		if err := rows.Scan(&p.Namespace, &p.Key, &p.Value); err != nil {
+			return nil, errors.Wrap(err, "sql: error listing preferences")
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func (m *mgr) DeleteKey(ctx context.Context, namespace, key string) error {
+	u := user.ContextMustGetUser(ctx)
+
+	query := "DELETE FROM preferences WHERE user_idp = ? AND user_opaque_id = ? AND namespace = ? AND pref_key = ?"
+	res, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), u.Id.Idp, u.Id.OpaqueId, namespace, key)
+	if err != nil {
+		return errors.Wrap(err, "sql: error deleting preference")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errtypes.NotFound(namespace + "/" + key)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+// newTestManager uses the postgres queries, whose upsert sqlite understands.
+func newTestManager(t *testing.T) *mgr {
+	m := &mgr{c: &config{Config: sqlutil.Config{DBDriver: "postgres"}}, db: sqlitetest.Open(t)}
+	if err := sqlutil.Migrate(context.Background(), m.db, m.c.DBDriver, "preferences_schema_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestPreferences(t *testing.T) {
+	m := newTestManager(t)
+
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "4c510ada"}, Username: "einstein"}
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "local", OpaqueId: "f7fbf8c8"}, Username: "marie"}
+	ctx := user.ContextSetUser(context.Background(), einstein)
+
+	for _, p := range [][3]string{{"core", "lang", "de"}, {"files", "show_hidden", "1"}, {"files", "sort", "name"}} {
+		if err := m.SetKey(ctx, p[0], p[1], p[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.SetKey(ctx, "core", "lang", "en"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := m.GetKey(ctx, "core", "lang"); err != nil || v != "en" {
+		t.Errorf("got %q, %v, wanted en", v, err)
+	}
+	if _, err := m.GetKey(user.ContextSetUser(context.Background(), marie), "core", "lang"); err == nil {
+		t.Error("expected the keys of other users to be hidden")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	list, err := m.ListKeys(ctx, "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Key != "show_hidden" || list[1].Key != "sort" {
+		t.Errorf("unexpected keys %+v", list)
+	}
+	if list, _ := m.ListKeys(ctx, ""); len(list) != 3 {
+		t.Errorf("%d keys, wanted 3", len(list))
+	}
+
+	if err := m.DeleteKey(ctx, "files", "sort"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteKey(ctx, "files", "sort"); err == nil {
+		t.Error("expected deleting a missing key to fail")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+	if list, _ := m.ListKeys(ctx, ""); len(list) != 2 {
+		t.Errorf("%d keys after delete, wanted 2", len(list))
+	}
+}
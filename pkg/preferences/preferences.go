@@ -0,0 +1,74 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package preferences defines the settings the users persist, like their
+// language or notification preferences. The keys are grouped in namespaces,
+// usually the name of the app the settings belong to.
+package preferences
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// DefaultNamespace is the namespace of the keys given without one.
+const DefaultNamespace = "core"
+
+// Preference is a key of the user and its value.
+type Preference struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+}
+
+// Manager keeps the preferences of the user in the context.
+type Manager interface {
+	// SetKey sets the value of the key in the namespace.
+	SetKey(ctx context.Context, namespace, key, value string) error
+
+	// GetKey returns the value of the key in the namespace.
+	GetKey(ctx context.Context, namespace, key string) (string, error)
+
+	// ListKeys returns the keys in the namespace, or in all the namespaces
+	// if namespace is empty.
+	ListKeys(ctx context.Context, namespace string) ([]*Preference, error)
+
+	// DeleteKey removes the key from the namespace.
+	DeleteKey(ctx context.Context, namespace, key string) error
+}
+
+// SplitKey splits a namespaced key like app/config/key into its namespace,
+// app/config, and the key. Keys without a namespace are in the default one.
+func SplitKey(key string) (string, string) {
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return DefaultNamespace, key
+	}
+	return key[:i], key[i+1:]
+}
+
+// Sort sorts the preferences by namespace and key.
+func Sort(list []*Preference) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Namespace != list[j].Namespace {
+			return list[i].Namespace < list[j].Namespace
+		}
+		return list[i].Key < list[j].Key
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package preferences
+
+import "testing"
+
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		key, namespace, name string
+	}{
+		{"lang", DefaultNamespace, "lang"},
+		{"files/sort", "files", "sort"},
+		{"app/config/key", "app/config", "key"},
+	}
+	for _, tt := range tests {
+		if ns, name := SplitKey(tt.key); ns != tt.namespace || name != tt.name {
+			t.Errorf("SplitKey(%q) = %q, %q, wanted %q, %q", tt.key, ns, name, tt.namespace, tt.name)
+		}
+	}
+}
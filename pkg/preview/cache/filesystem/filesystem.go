@@ -0,0 +1,118 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package filesystem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/preview"
+	"github.com/cs3org/reva/pkg/preview/cache/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("filesystem", New)
+}
+
+type config struct {
+	Root string `mapstructure:"root"`
+}
+
+type cache struct {
+	root string
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a cache keeping the thumbnails as files below a root folder.
+func New(m map[string]interface{}) (preview.Cache, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Root == "" {
+		c.Root = filepath.Join(os.TempDir(), "reva-previews")
+	}
+	if err := os.MkdirAll(c.Root, 0700); err != nil {
+		return nil, errors.Wrap(err, "filesystem: error creating cache root")
+	}
+
+	return &cache{root: c.Root}, nil
+}
+
+// file hashes the key, which contains arbitrary ids, into a path spread over
+// subfolders to keep the folders small.
+func (c *cache) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	h := hex.EncodeToString(sum[:])
+	return filepath.Join(c.root, h[:2], h[2:4], h)
+}
+
+func (c *cache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(c.file(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errtypes.NotFound(key)
+		}
+		return nil, errors.Wrap(err, "filesystem: error reading thumbnail")
+	}
+	return data, nil
+}
+
+func (c *cache) Set(ctx context.Context, key string, data []byte) error {
+	fn := c.file(key)
+	if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+		return errors.Wrap(err, "filesystem: error creating cache folder")
+	}
+
+	// write to a temporary file first so that readers never see partial thumbnails
+	tmp, err := ioutil.TempFile(filepath.Dir(fn), ".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "filesystem: error creating thumbnail")
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "filesystem: error writing thumbnail")
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "filesystem: error writing thumbnail")
+	}
+	if err := os.Rename(tmp.Name(), fn); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "filesystem: error storing thumbnail")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+func TestCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "reva-preview-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	c, err := New(map[string]interface{}{"root": root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "storage!file!etag!32x32"); err == nil {
+		t.Fatal("expected a miss on an empty cache")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	if err := c.Set(ctx, "storage!file!etag!32x32", []byte("thumbnail")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.Get(ctx, "storage!file!etag!32x32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("thumbnail")) {
+		t.Errorf("got %q, expected %q", data, "thumbnail")
+	}
+
+	if _, err := c.Get(ctx, "storage!file!etag!64x64"); err == nil {
+		t.Error("expected a miss for another size")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/preview"
+	"github.com/cs3org/reva/pkg/preview/cache/registry"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("redis", New)
+}
+
+type config struct {
+	Address  string `mapstructure:"address"`
+	Password string `mapstructure:"password"`
+	// TTL is the number of seconds thumbnails are kept, a week by default.
+	TTL int `mapstructure:"ttl"`
+}
+
+type cache struct {
+	pool *redis.Pool
+	ttl  int
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a cache keeping the thumbnails in redis.
+func New(m map[string]interface{}) (preview.Cache, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Address == "" {
+		c.Address = "localhost:6379"
+	}
+	if c.TTL == 0 {
+		c.TTL = 7 * 24 * 60 * 60
+	}
+
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+
+		Dial: func() (redis.Conn, error) {
+			var opts []redis.DialOption
+			if c.Password != "" {
+				opts = append(opts, redis.DialPassword(c.Password))
+			}
+			return redis.Dial("tcp", c.Address, opts...)
+		},
+
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+
+	return &cache{pool: pool, ttl: c.TTL}, nil
+}
+
+func (c *cache) Get(ctx context.Context, key string) ([]byte, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", "preview:"+key))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, errtypes.NotFound(key)
+		}
+		return nil, errors.Wrap(err, "redis: error reading thumbnail")
+	}
+	return data, nil
+}
+
+func (c *cache) Set(ctx context.Context, key string, data []byte) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", "preview:"+key, data, "EX", c.ttl); err != nil {
+		return errors.Wrap(err, "redis: error storing thumbnail")
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register the gif decoder
+	"image/jpeg"
+	_ "image/png" // register the png decoder
+	"io"
+	"os/exec"
+	"strconv"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/pkg/errors"
+)
+
+// MimeType is the content type of the generated thumbnails.
+const MimeType = "image/jpeg"
+
+// Cache keeps the generated thumbnails.
+type Cache interface {
+	// Get returns the thumbnail stored under key, or an errtypes.NotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, data []byte) error
+}
+
+// Key identifies the thumbnail of a given version of a resource at a given size.
+// The etag changes with the content, so stale thumbnails are never served.
+func Key(info *provider.ResourceInfo, width, height int) string {
+	return fmt.Sprintf("%s!%s!%s!%dx%d", info.Id.StorageId, info.Id.OpaqueId, info.Etag, width, height)
+}
+
+// Supported reports whether a thumbnail can be generated for the mime type.
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "application/pdf":
+		return true
+	}
+	return false
+}
+
+// Generator creates thumbnails.
+type Generator struct {
+	// MaxPixels bounds the size of the decoded images, to protect against
+	// small files expanding to huge bitmaps.
+	MaxPixels int
+	// PDFCommand renders the first page of a PDF read from stdin as a PNG
+	// written to stdout, PDFs are not supported if empty.
+	PDFCommand []string
+}
+
+// Generate reads the content of a file of the given mime type and returns a
+// JPEG thumbnail fitting in width x height, keeping the aspect ratio.
+// Images smaller than the requested size are not enlarged.
+func (g *Generator) Generate(ctx context.Context, r io.Reader, mimeType string, width, height int) ([]byte, error) {
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("preview: invalid thumbnail size")
+	}
+
+	if mimeType == "application/pdf" {
+		png, err := g.renderPDF(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(png)
+	}
+
+	// the config is read first to reject oversized images before decoding them
+	var buf bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &buf))
+	if err != nil {
+		return nil, errors.Wrap(err, "preview: error decoding image header")
+	}
+	if g.MaxPixels > 0 && cfg.Width*cfg.Height > g.MaxPixels {
+		return nil, fmt.Errorf("preview: image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&buf, r))
+	if err != nil {
+		return nil, errors.Wrap(err, "preview: error decoding image")
+	}
+
+	thumb := Resize(img, width, height)
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, thumb, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, errors.Wrap(err, "preview: error encoding thumbnail")
+	}
+	return out.Bytes(), nil
+}
+
+func (g *Generator) renderPDF(ctx context.Context, r io.Reader) ([]byte, error) {
+	if len(g.PDFCommand) == 0 {
+		return nil, errors.New("preview: no pdf renderer configured")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, g.PDFCommand[0], g.PDFCommand[1:]...)
+	cmd.Stdin = r
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrap(err, "preview: error rendering pdf: "+stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// Resize scales img down to fit in width x height, averaging the source
+// pixels covered by each destination pixel.
+func Resize(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 {
+		return img
+	}
+
+	dw, dh := fit(sw, sh, width, height)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*sh/dh, b.Min.Y+(y+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*sw/dw, b.Min.X+(x+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// fit returns the largest size not exceeding width x height nor the source
+// size that keeps the aspect ratio of the source.
+func fit(sw, sh, width, height int) (int, int) {
+	if sw <= width && sh <= height {
+		return sw, sh
+	}
+	dw, dh := width, sh*width/sw
+	if dh > height {
+		dw, dh = sw*height/sh, height
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	return dw, dh
+}
+
+// ParseSize parses the requested thumbnail dimensions, falling back to def
+// and capping them at max.
+func ParseSize(x, y string, def, max int) (int, int, error) {
+	w, err := parseDim(x, def, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := parseDim(y, def, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	return w, h, nil
+}
+
+func parseDim(v string, def, max int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	d, err := strconv.Atoi(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("preview: invalid dimension %q", v)
+	}
+	if d > max {
+		d = max
+	}
+	return d, nil
+}
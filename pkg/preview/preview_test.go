@@ -0,0 +1,109 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package preview
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		sw, sh, w, h int
+		dw, dh       int
+	}{
+		{1000, 500, 100, 100, 100, 50},
+		{500, 1000, 100, 100, 50, 100},
+		{1000, 500, 400, 50, 100, 50},
+		{50, 20, 100, 100, 50, 20},
+		{10000, 1, 10, 10, 10, 1},
+	}
+
+	for _, tt := range tests {
+		if dw, dh := fit(tt.sw, tt.sh, tt.w, tt.h); dw != tt.dw || dh != tt.dh {
+			t.Errorf("fit(%d, %d, %d, %d) = %dx%d, expected %dx%d", tt.sw, tt.sh, tt.w, tt.h, dw, dh, tt.dw, tt.dh)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	if w, h, err := ParseSize("", "64", 32, 1024); err != nil || w != 32 || h != 64 {
+		t.Errorf("got %dx%d %v, expected 32x64", w, h, err)
+	}
+	if w, h, err := ParseSize("4096", "4096", 32, 1024); err != nil || w != 1024 || h != 1024 {
+		t.Errorf("got %dx%d %v, expected 1024x1024", w, h, err)
+	}
+	for _, x := range []string{"-1", "0", "abc"} {
+		if _, _, err := ParseSize(x, "", 32, 1024); err == nil {
+			t.Errorf("expected an error for %q", x)
+		}
+	}
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	g := &Generator{MaxPixels: 1000 * 1000}
+
+	data, err := g.Generate(context.Background(), bytes.NewReader(encodePNG(t, 400, 200)), "image/png", 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("got a %dx%d thumbnail, expected 100x50", b.Dx(), b.Dy())
+	}
+	if r, g, b, _ := thumb.At(50, 25).RGBA(); r>>8 < 240 || g>>8 > 15 || b>>8 > 15 {
+		t.Errorf("expected a red thumbnail, got %d %d %d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestGenerateTooLarge(t *testing.T) {
+	g := &Generator{MaxPixels: 100}
+	if _, err := g.Generate(context.Background(), bytes.NewReader(encodePNG(t, 20, 20)), "image/png", 10, 10); err == nil {
+		t.Error("expected an error for an image above the pixel limit")
+	}
+}
+
+func TestGeneratePDFWithoutRenderer(t *testing.T) {
+	g := &Generator{}
+	if _, err := g.Generate(context.Background(), bytes.NewReader([]byte("%PDF-1.4")), "application/pdf", 10, 10); err == nil {
+		t.Error("expected an error without pdf renderer")
+	}
+}
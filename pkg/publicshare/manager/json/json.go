@@ -0,0 +1,420 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"sync"
+	"time"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/jsonfile"
+	"github.com/cs3org/reva/pkg/publicshare"
+	"github.com/cs3org/reva/pkg/publicshare/manager/registry"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	registry.Register("json", New)
+}
+
+type config struct {
+	File string `mapstructure:"file"`
+}
+
+type publicShareModel struct {
+	Shares map[string]*entry `json:"shares"` // map[share_id]entry
+}
+
+// entry keeps the bcrypt hash of the share password and the statistics
+// next to the share.
+type entry struct {
+	Share    *link.PublicShare `json:"share"`
+	Password string            `json:"password,omitempty"`
+	Stats    publicshare.Stats `json:"stats"`
+}
+
+type mgr struct {
+	c          *config
+	sync.Mutex // concurrent access to the file and model
+	model      *publicShareModel
+	file       *jsonfile.File
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new public share manager that persists the shares to a
+// json file. The file is reloaded when it changes, so that it can be shared
+// by several services.
+func New(m map[string]interface{}) (publicshare.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	// if file is not set we use temporary file
+	if c.File == "" {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			err = errors.Wrap(err, "error creating temporary directory for storing public shares")
+			return nil, err
+		}
+		c.File = path.Join(dir, "publicshares.json")
+	}
+
+	f, err := jsonfile.Open(c.File)
+	if err != nil {
+		err = errors.Wrap(err, "error opening/creating the file")
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, file: f}
+	if err := mgr.load(); err != nil {
+		err = errors.Wrap(err, "error loading the file containing the public shares")
+		return nil, err
+	}
+	return mgr, nil
+}
+
+// load refreshes the shares, a new file having none.
+func (m *mgr) load() error {
+	model := &publicShareModel{}
+	if ok, err := m.file.Load(model); err != nil || !ok {
+		return err
+	}
+	if model.Shares == nil {
+		model.Shares = map[string]*entry{}
+	}
+
+	m.model = model
+	return nil
+}
+
+func (m *mgr) save() error {
+	return m.file.Save(m.model)
+}
+
+func (m *mgr) CreatePublicShare(ctx context.Context, u *user.User, rInfo *provider.ResourceInfo, g *link.Grant) (*link.PublicShare, error) {
+	tkn, err := publicshare.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := tkn
+	if name, ok := rInfo.GetArbitraryMetadata().GetMetadata()["name"]; ok && name != "" {
+		displayName = name
+	}
+
+	e := &entry{}
+	if g.Password != "" {
+		h, err := bcrypt.GenerateFromPassword([]byte(g.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, errors.Wrap(err, "json: error hashing share password")
+		}
+		e.Password = string(h)
+	}
+
+	now := timestamp(time.Now())
+	e.Share = &link.PublicShare{
+		Id:                &link.PublicShareId{OpaqueId: uuid.New().String()},
+		Owner:             rInfo.GetOwner(),
+		Creator:           u.GetId(),
+		ResourceId:        rInfo.GetId(),
+		Token:             tkn,
+		Permissions:       g.Permissions,
+		Ctime:             now,
+		Mtime:             now,
+		PasswordProtected: e.Password != "",
+		Expiration:        g.Expiration,
+		DisplayName:       displayName,
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	m.model.Shares[e.Share.Id.OpaqueId] = e
+	if err := m.save(); err != nil {
+		return nil, errors.Wrap(err, "error saving model")
+	}
+	return clone(e.Share), nil
+}
+
+// UpdatePublicShare updates the permissions, password or expiration date and the Mtime.
+func (m *mgr) UpdatePublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference, req *link.UpdatePublicShareRequest_Update) (*link.PublicShare, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	if !publicshare.IsCreatorOrOwner(u, e.Share) {
+		return nil, errtypes.PermissionDenied("json: user is not allowed to update the share")
+	}
+
+	switch req.GetType() {
+	case link.UpdatePublicShareRequest_Update_TYPE_PERMISSIONS:
+		e.Share.Permissions = req.GetGrant().GetPermissions()
+	case link.UpdatePublicShareRequest_Update_TYPE_EXPIRATION:
+		e.Share.Expiration = req.GetGrant().GetExpiration()
+	case link.UpdatePublicShareRequest_Update_TYPE_PASSWORD:
+		// an empty password removes the protection
+		e.Password = ""
+		if pw := req.GetGrant().GetPassword(); pw != "" {
+			h, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, errors.Wrap(err, "json: error hashing share password")
+			}
+			e.Password = string(h)
+		}
+		e.Share.PasswordProtected = e.Password != ""
+	default:
+		return nil, errtypes.NotSupported("json: invalid update type: " + req.GetType().String())
+	}
+	e.Share.Mtime = timestamp(time.Now())
+
+	if err := m.save(); err != nil {
+		return nil, errors.Wrap(err, "error saving model")
+	}
+	return clone(e.Share), nil
+}
+
+// GetPublicShare returns the share identified by either its token or its id.
+func (m *mgr) GetPublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference) (*link.PublicShare, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	// the shares of the other users are not revealed
+	if !publicshare.IsCreatorOrOwner(u, e.Share) {
+		return nil, errtypes.NotFound("json: there are no shares for the given reference")
+	}
+	return clone(e.Share), nil
+}
+
+// ListPublicShares returns the shares created or owned by the user matching
+// the filters.
+func (m *mgr) ListPublicShares(ctx context.Context, u *user.User, filters []*link.ListPublicSharesRequest_Filter, md *provider.ResourceInfo) ([]*link.PublicShare, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	shares := []*link.PublicShare{}
+	for _, e := range m.model.Shares {
+		if publicshare.IsCreatorOrOwner(u, e.Share) && publicshare.MatchesFilters(e.Share, filters) {
+			shares = append(shares, clone(e.Share))
+		}
+	}
+	return shares, nil
+}
+
+func (m *mgr) RevokePublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference) error {
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.find(ref)
+	if err != nil {
+		return err
+	}
+	if !publicshare.IsCreatorOrOwner(u, e.Share) {
+		return errtypes.PermissionDenied("json: user is not allowed to revoke the share")
+	}
+	delete(m.model.Shares, e.Share.Id.OpaqueId)
+	return m.save()
+}
+
+func (m *mgr) GetPublicShareByToken(ctx context.Context, token, password string) (*link.PublicShare, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.byToken(token, password)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Stats.Accesses++
+	e.Stats.LastAccess = uint64(time.Now().Unix())
+	if err := m.save(); err != nil {
+		return nil, errors.Wrap(err, "error saving model")
+	}
+	return clone(e.Share), nil
+}
+
+func (m *mgr) ListExpiringPublicShares(ctx context.Context, t time.Time) ([]*link.PublicShare, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	shares := []*link.PublicShare{}
+	for _, e := range m.model.Shares {
+		exp := e.Share.Expiration
+		if exp == nil || exp.Seconds == 0 || publicshare.IsExpired(e.Share) {
+			continue
+		}
+		if int64(exp.Seconds) < t.Unix() {
+			shares = append(shares, clone(e.Share))
+		}
+	}
+	return shares, nil
+}
+
+// RotatePublicShareToken gives the share a new token, keeping its settings and statistics.
+func (m *mgr) RotatePublicShareToken(ctx context.Context, u *user.User, ref *link.PublicShareReference) (*link.PublicShare, error) {
+	tkn, err := publicshare.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	if !publicshare.IsCreatorOrOwner(u, e.Share) {
+		return nil, errtypes.PermissionDenied("json: user is not allowed to update the share")
+	}
+
+	// the token is the display name of the unnamed shares
+	if e.Share.DisplayName == e.Share.Token {
+		e.Share.DisplayName = tkn
+	}
+	e.Share.Token = tkn
+	e.Share.Mtime = timestamp(time.Now())
+
+	if err := m.save(); err != nil {
+		return nil, errors.Wrap(err, "error saving model")
+	}
+	return clone(e.Share), nil
+}
+
+func (m *mgr) GetPublicShareStats(ctx context.Context, ids []string) (map[string]*publicshare.Stats, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	stats := map[string]*publicshare.Stats{}
+	for _, id := range ids {
+		if e, ok := m.model.Shares[id]; ok {
+			s := e.Stats
+			stats[id] = &s
+		}
+	}
+	return stats, nil
+}
+
+func (m *mgr) RecordPublicShareTransfer(ctx context.Context, token, password string, n uint64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.byToken(token, password)
+	if err != nil {
+		return err
+	}
+	e.Stats.Transferred += n
+	if err := m.save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
+
+// byToken returns the entry of the share with the token if it has not
+// expired and the password matches. It must be called with the lock held.
+func (m *mgr) byToken(token, password string) (*entry, error) {
+	e, err := m.find(&link.PublicShareReference{Spec: &link.PublicShareReference_Token{Token: token}})
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return nil, errtypes.NotFound("json: invalid token")
+		}
+		return nil, err
+	}
+	if publicshare.IsExpired(e.Share) {
+		return nil, errtypes.NotFound("json: invalid token")
+	}
+	if e.Password != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(e.Password), []byte(password)); err != nil {
+			return nil, errtypes.InvalidCredentials("json: invalid password for share " + e.Share.Id.OpaqueId)
+		}
+	}
+	return e, nil
+}
+
+// find loads the model and returns the entry of the share referenced by
+// either its token or its id. It must be called with the lock held.
+func (m *mgr) find(ref *link.PublicShareReference) (*entry, error) {
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	if tkn := ref.GetToken(); tkn != "" {
+		for _, e := range m.model.Shares {
+			if e.Share.Token == tkn {
+				return e, nil
+			}
+		}
+	} else if id := ref.GetId(); id != nil {
+		if e, ok := m.model.Shares[id.OpaqueId]; ok {
+			return e, nil
+		}
+	}
+	return nil, errtypes.NotFound("json: there are no shares for the given reference")
+}
+
+func timestamp(t time.Time) *typespb.Timestamp {
+	return &typespb.Timestamp{
+		Seconds: uint64(t.Unix()),
+		Nanos:   uint32(t.Nanosecond()),
+	}
+}
+
+func clone(s *link.PublicShare) *link.PublicShare {
+	return proto.Clone(s).(*link.PublicShare)
+}
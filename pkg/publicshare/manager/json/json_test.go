@@ -0,0 +1,150 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reva-publicshares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := map[string]interface{}{"file": path.Join(dir, "publicshares.json")}
+	m, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	u := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "einstein"}}
+	info := &provider.ResourceInfo{Id: &provider.ResourceId{StorageId: "s", OpaqueId: "o"}, Owner: u.Id}
+	s, err := m.CreatePublicShare(ctx, u, info, &link.Grant{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.GetPublicShareByToken(ctx, s.Token, "wrong"); err == nil {
+		t.Fatal("expected a wrong password to be refused")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := m.GetPublicShareByToken(ctx, s.Token, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the shares, their passwords and statistics survive a restart
+	m, err = New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := m.RotatePublicShareToken(ctx, u, &link.PublicShareReference{Spec: &link.PublicShareReference_Id{Id: s.Id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Token == s.Token || rotated.Id.OpaqueId != s.Id.OpaqueId || !rotated.PasswordProtected {
+		t.Fatalf("expected a new token for the same share, got %+v", rotated)
+	}
+	if rotated.DisplayName != rotated.Token {
+		t.Fatalf("expected the display name to follow the token, got %q", rotated.DisplayName)
+	}
+	if _, err := m.GetPublicShareByToken(ctx, s.Token, "secret"); err == nil {
+		t.Fatal("expected the old token to be refused")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := m.GetPublicShareByToken(ctx, rotated.Token, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RecordPublicShareTransfer(ctx, rotated.Token, "wrong", 10); err == nil {
+		t.Fatal("expected a transfer with the wrong password to be refused")
+	}
+	for _, n := range []uint64{1024, 512} {
+		if err := m.RecordPublicShareTransfer(ctx, rotated.Token, "secret", n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the transfers are not counted as accesses
+	stats, err := m.GetPublicShareStats(ctx, []string{s.Id.OpaqueId, "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[s.Id.OpaqueId].Accesses != 3 || stats[s.Id.OpaqueId].LastAccess == 0 {
+		t.Fatalf("expected 3 accesses, got %+v", stats)
+	}
+	if stats[s.Id.OpaqueId].Transferred != 1536 {
+		t.Fatalf("expected 1536 bytes transferred, got %d", stats[s.Id.OpaqueId].Transferred)
+	}
+
+	other := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "marie"}}
+	if _, err := m.RotatePublicShareToken(ctx, other, &link.PublicShareReference{Spec: &link.PublicShareReference_Id{Id: s.Id}}); err == nil {
+		t.Fatal("expected another user not to be able to rotate the token")
+	}
+}
+
+func TestSharesOfOtherUsers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reva-publicshares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := New(map[string]interface{}{"file": path.Join(dir, "publicshares.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "einstein"}}
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "marie"}}
+	info := &provider.ResourceInfo{Id: &provider.ResourceId{StorageId: "s", OpaqueId: "o"}, Owner: einstein.Id}
+	s, err := m.CreatePublicShare(ctx, einstein, info, &link.Grant{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := &link.PublicShareReference{Spec: &link.PublicShareReference_Id{Id: s.Id}}
+
+	if _, err := m.GetPublicShare(ctx, einstein, ref); err != nil {
+		t.Fatalf("expected the creator to get the share, got %v", err)
+	}
+	if _, err := m.GetPublicShare(ctx, marie, ref); err == nil {
+		t.Fatal("expected another user not to get the share")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if shares, err := m.ListPublicShares(ctx, einstein, nil, info); err != nil || len(shares) != 1 {
+		t.Fatalf("expected the creator to list the share, got %v, %v", shares, err)
+	}
+	if shares, err := m.ListPublicShares(ctx, marie, nil, info); err != nil || len(shares) != 0 {
+		t.Fatalf("expected another user not to list the share, got %v, %v", shares, err)
+	}
+}
@@ -20,6 +20,8 @@ package loader
 
 import (
 	// Load core share manager drivers.
+	_ "github.com/cs3org/reva/pkg/publicshare/manager/json"
 	_ "github.com/cs3org/reva/pkg/publicshare/manager/memory"
+	_ "github.com/cs3org/reva/pkg/publicshare/manager/sql"
 	// Add your own here
 )
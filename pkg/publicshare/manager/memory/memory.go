@@ -20,8 +20,8 @@ package memory
 
 import (
 	"context"
-	"errors"
-	"math/rand"
+	"crypto/rand"
+	"math/big"
 	"sync"
 	"time"
 
@@ -29,8 +29,12 @@ import (
 	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/publicshare"
 	"github.com/cs3org/reva/pkg/publicshare/manager/registry"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func init() {
@@ -40,162 +44,295 @@ func init() {
 // New returns a new memory manager.
 func New(c map[string]interface{}) (publicshare.Manager, error) {
 	return &manager{
-		shares: sync.Map{},
+		shares: map[string]*entry{},
 	}, nil
 }
 
 type manager struct {
-	shares sync.Map
+	sync.RWMutex
+	// shares are indexed by token.
+	shares map[string]*entry
 }
 
-// CreatePublicShare safely adds a new entry to manager.shares
+// entry keeps the bcrypt hash of the share password and the statistics
+// next to the share.
+type entry struct {
+	share    *link.PublicShare
+	password []byte
+	stats    publicshare.Stats
+}
+
+// CreatePublicShare adds a new entry to manager.shares
 func (m *manager) CreatePublicShare(ctx context.Context, u *user.User, rInfo *provider.ResourceInfo, g *link.Grant) (*link.PublicShare, error) {
-	// where could this initialization go wrong and early return?
-	id := &link.PublicShareId{
-		OpaqueId: randString(12),
+	id, err := randString(12)
+	if err != nil {
+		return nil, errors.Wrap(err, "memory: error generating share id")
 	}
-
-	tkn := randString(12)
-	now := uint64(time.Now().Unix())
-
-	displayName, ok := rInfo.ArbitraryMetadata.Metadata["name"]
-	if !ok {
-		displayName = tkn
+	tkn, err := publicshare.GenerateToken()
+	if err != nil {
+		return nil, err
 	}
 
-	_, passwdOk := rInfo.ArbitraryMetadata.Metadata["password"]
-
-	ctime := &typespb.Timestamp{
-		Seconds: now,
-		Nanos:   uint32(now % 1000000000),
+	displayName := tkn
+	if name, ok := rInfo.GetArbitraryMetadata().GetMetadata()["name"]; ok && name != "" {
+		displayName = name
 	}
 
-	mtime := &typespb.Timestamp{
-		Seconds: now,
-		Nanos:   uint32(now % 1000000000),
+	e := &entry{}
+	if g.Password != "" {
+		if e.password, err = bcrypt.GenerateFromPassword([]byte(g.Password), bcrypt.DefaultCost); err != nil {
+			return nil, errors.Wrap(err, "memory: error hashing share password")
+		}
 	}
 
-	newShare := link.PublicShare{
-		Id:                id,
+	now := timestamp(time.Now())
+	e.share = &link.PublicShare{
+		Id:                &link.PublicShareId{OpaqueId: id},
 		Owner:             rInfo.GetOwner(),
-		Creator:           u.Id,
-		ResourceId:        rInfo.Id,
+		Creator:           u.GetId(),
+		ResourceId:        rInfo.GetId(),
 		Token:             tkn,
 		Permissions:       g.Permissions,
-		Ctime:             ctime,
-		Mtime:             mtime,
-		PasswordProtected: passwdOk,
+		Ctime:             now,
+		Mtime:             now,
+		PasswordProtected: e.password != nil,
 		Expiration:        g.Expiration,
 		DisplayName:       displayName,
 	}
 
-	m.shares.Store(newShare.Token, &newShare)
-	return &newShare, nil
+	m.Lock()
+	m.shares[tkn] = e
+	m.Unlock()
+
+	return clone(e.share), nil
 }
 
-// UpdatePublicShare updates the expiration date, permissions and Mtime
-func (m *manager) UpdatePublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference, g *link.Grant) (*link.PublicShare, error) {
-	share, err := m.GetPublicShare(ctx, u, ref)
+// UpdatePublicShare updates the permissions, password or expiration date and the Mtime.
+func (m *manager) UpdatePublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference, req *link.UpdatePublicShareRequest_Update) (*link.PublicShare, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.find(ref)
 	if err != nil {
-		return nil, errors.New("ref does not exist")
+		return nil, err
+	}
+	if !publicshare.IsCreatorOrOwner(u, e.share) {
+		return nil, errtypes.PermissionDenied("memory: user is not allowed to update the share")
 	}
 
-	token := share.GetToken()
-
-	// thread unsafe. 2 goroutines can access to the same resource?
-	share.Permissions = g.Permissions
-	share.Expiration = g.Expiration
-	share.Mtime = &typespb.Timestamp{
-		Seconds: uint64(time.Now().Unix()),
-		Nanos:   uint32(time.Now().Unix() % 1000000000),
+	switch req.GetType() {
+	case link.UpdatePublicShareRequest_Update_TYPE_PERMISSIONS:
+		e.share.Permissions = req.GetGrant().GetPermissions()
+	case link.UpdatePublicShareRequest_Update_TYPE_EXPIRATION:
+		e.share.Expiration = req.GetGrant().GetExpiration()
+	case link.UpdatePublicShareRequest_Update_TYPE_PASSWORD:
+		// an empty password removes the protection
+		if pw := req.GetGrant().GetPassword(); pw != "" {
+			h, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, errors.Wrap(err, "memory: error hashing share password")
+			}
+			e.password = h
+		} else {
+			e.password = nil
+		}
+		e.share.PasswordProtected = e.password != nil
+	default:
+		return nil, errtypes.NotSupported("memory: invalid update type: " + req.GetType().String())
 	}
+	e.share.Mtime = timestamp(time.Now())
 
-	m.shares.Store(token, share)
+	return clone(e.share), nil
+}
+
+// GetPublicShare returns the share identified by either its token or its id.
+func (m *manager) GetPublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference) (*link.PublicShare, error) {
+	m.RLock()
+	defer m.RUnlock()
 
-	return &link.PublicShare{}, nil
+	e, err := m.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	// the shares of the other users are not revealed
+	if !publicshare.IsCreatorOrOwner(u, e.share) {
+		return nil, errtypes.NotFound("memory: there are no shares for the given reference")
+	}
+	return clone(e.share), nil
 }
 
-func (m *manager) GetPublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference) (share *link.PublicShare, err error) {
-	// Attempt to fetch public share by token
-	if ref.GetToken() != "" {
-		share, err = m.GetPublicShareByToken(ctx, ref.GetToken())
-		if err != nil {
-			return nil, errors.New("there are no shares for the given reference")
+// ListPublicShares returns the shares created or owned by the user matching
+// the filters.
+func (m *manager) ListPublicShares(ctx context.Context, u *user.User, filters []*link.ListPublicSharesRequest_Filter, md *provider.ResourceInfo) ([]*link.PublicShare, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	shares := []*link.PublicShare{}
+	for _, e := range m.shares {
+		if publicshare.IsCreatorOrOwner(u, e.share) && publicshare.MatchesFilters(e.share, filters) {
+			shares = append(shares, clone(e.share))
 		}
 	}
+	return shares, nil
+}
 
-	// Attempt to fetch public share by Id
-	if ref.GetId() != nil {
-		share, err = m.getPublicShareByTokenID(ctx, *ref.GetId())
-		if err != nil {
-			return nil, errors.New("there are no shares for the given reference")
-		}
+func (m *manager) RevokePublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference) error {
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.find(ref)
+	if err != nil {
+		return err
 	}
+	if !publicshare.IsCreatorOrOwner(u, e.share) {
+		return errtypes.PermissionDenied("memory: user is not allowed to revoke the share")
+	}
+	delete(m.shares, e.share.Token)
+	return nil
+}
+
+func (m *manager) GetPublicShareByToken(ctx context.Context, token, password string) (*link.PublicShare, error) {
+	m.Lock()
+	defer m.Unlock()
 
-	return share, nil
+	e, err := m.byToken(token, password)
+	if err != nil {
+		return nil, err
+	}
+	e.stats.Accesses++
+	e.stats.LastAccess = uint64(time.Now().Unix())
+	return clone(e.share), nil
 }
 
-func (m *manager) ListPublicShares(ctx context.Context, u *user.User, filters []*link.ListPublicSharesRequest_Filter, md *provider.ResourceInfo) ([]*link.PublicShare, error) {
+func (m *manager) ListExpiringPublicShares(ctx context.Context, t time.Time) ([]*link.PublicShare, error) {
+	m.RLock()
+	defer m.RUnlock()
+
 	shares := []*link.PublicShare{}
-	m.shares.Range(func(k, v interface{}) bool {
-		s := v.(*link.PublicShare)
-		if len(filters) == 0 {
-			shares = append(shares, s)
-		} else {
-			for _, f := range filters {
-				if f.Type == link.ListPublicSharesRequest_Filter_TYPE_RESOURCE_ID {
-					if s.ResourceId.StorageId == f.GetResourceId().StorageId && s.ResourceId.OpaqueId == f.GetResourceId().OpaqueId {
-						shares = append(shares, s)
-					}
-				}
-			}
+	for _, e := range m.shares {
+		exp := e.share.Expiration
+		if exp == nil || exp.Seconds == 0 || publicshare.IsExpired(e.share) {
+			continue
 		}
-		return true
-	})
-
+		if int64(exp.Seconds) < t.Unix() {
+			shares = append(shares, clone(e.share))
+		}
+	}
 	return shares, nil
 }
 
-func (m *manager) RevokePublicShare(ctx context.Context, u *user.User, id string) (err error) {
-	// check whether the referente exists
-	if _, err := m.GetPublicShareByToken(ctx, id); err != nil {
-		return errors.New("reference does not exist")
+// RotatePublicShareToken gives the share a new token, keeping its settings and statistics.
+func (m *manager) RotatePublicShareToken(ctx context.Context, u *user.User, ref *link.PublicShareReference) (*link.PublicShare, error) {
+	tkn, err := publicshare.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	if !publicshare.IsCreatorOrOwner(u, e.share) {
+		return nil, errtypes.PermissionDenied("memory: user is not allowed to update the share")
+	}
+
+	delete(m.shares, e.share.Token)
+	// the token is the display name of the unnamed shares
+	if e.share.DisplayName == e.share.Token {
+		e.share.DisplayName = tkn
 	}
-	m.shares.Delete(id)
-	return
+	e.share.Token = tkn
+	e.share.Mtime = timestamp(time.Now())
+	m.shares[tkn] = e
+
+	return clone(e.share), nil
 }
 
-func (m *manager) GetPublicShareByToken(ctx context.Context, token string) (*link.PublicShare, error) {
-	if ps, ok := m.shares.Load(token); ok {
-		return ps.(*link.PublicShare), nil
+func (m *manager) GetPublicShareStats(ctx context.Context, ids []string) (map[string]*publicshare.Stats, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	stats := map[string]*publicshare.Stats{}
+	for _, e := range m.shares {
+		if want[e.share.Id.OpaqueId] {
+			s := e.stats
+			stats[e.share.Id.OpaqueId] = &s
+		}
 	}
-	return nil, errors.New("invalid token")
+	return stats, nil
 }
 
-// Helpers
-func randString(n int) string {
-	var l = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = l[rand.Intn(len(l))]
+func (m *manager) RecordPublicShareTransfer(ctx context.Context, token, password string, n uint64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	e, err := m.byToken(token, password)
+	if err != nil {
+		return err
 	}
-	return string(b)
+	e.stats.Transferred += n
+	return nil
 }
 
-func (m *manager) getPublicShareByTokenID(ctx context.Context, targetID link.PublicShareId) (*link.PublicShare, error) {
-	// iterate over existing shares and return the first one matching the id
-	var found *link.PublicShare
-	m.shares.Range(func(k, v interface{}) bool {
-		id := v.(*link.PublicShare).GetId()
-		if targetID.String() == id.String() {
-			found = v.(*link.PublicShare)
-			return true
+// byToken returns the entry of the share with the token if it has not
+// expired and the password matches. It must be called with the lock held.
+func (m *manager) byToken(token, password string) (*entry, error) {
+	e, ok := m.shares[token]
+	if !ok || publicshare.IsExpired(e.share) {
+		return nil, errtypes.NotFound("memory: invalid token")
+	}
+	if e.password != nil {
+		if err := bcrypt.CompareHashAndPassword(e.password, []byte(password)); err != nil {
+			return nil, errtypes.InvalidCredentials("memory: invalid password for share " + e.share.Id.OpaqueId)
+		}
+	}
+	return e, nil
+}
+
+// find must be called with the lock held.
+func (m *manager) find(ref *link.PublicShareReference) (*entry, error) {
+	if tkn := ref.GetToken(); tkn != "" {
+		if e, ok := m.shares[tkn]; ok {
+			return e, nil
 		}
-		return false
-	})
+	} else if id := ref.GetId(); id != nil {
+		for _, e := range m.shares {
+			if e.share.Id.OpaqueId == id.OpaqueId {
+				return e, nil
+			}
+		}
+	}
+	return nil, errtypes.NotFound("memory: there are no shares for the given reference")
+}
 
-	if found != nil {
-		return found, nil
+func timestamp(t time.Time) *typespb.Timestamp {
+	return &typespb.Timestamp{
+		Seconds: uint64(t.Unix()),
+		Nanos:   uint32(t.Nanosecond()),
+	}
+}
+
+func clone(s *link.PublicShare) *link.PublicShare {
+	return proto.Clone(s).(*link.PublicShare)
+}
+
+func randString(n int) (string, error) {
+	var l = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	max := big.NewInt(int64(len(l)))
+	b := make([]rune, n)
+	for i := range b {
+		r, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = l[r.Int64()]
 	}
-	return nil, errors.New("invalid token")
+	return string(b), nil
 }
@@ -21,6 +21,7 @@ package memory
 import (
 	"context"
 	"testing"
+	"time"
 
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
@@ -70,32 +71,47 @@ func TestMemoryProvider(t *testing.T) {
 		Permissions: &link.PublicSharePermissions{},
 		Expiration:  updatedMtime,
 	}
+	update := link.UpdatePublicShareRequest_Update{
+		Type:  link.UpdatePublicShareRequest_Update_TYPE_EXPIRATION,
+		Grant: &newGrant,
+	}
 
 	// attempt to update an invalid public share. we expect an error
-	_, err = manager.UpdatePublicShare(context.Background(), &user, &nonExistingPublicShareRef, &newGrant)
+	_, err = manager.UpdatePublicShare(context.Background(), &user, &nonExistingPublicShareRef, &update)
 	if err == nil {
 		t.Error(err)
 	}
 
 	// update an existing public share
-	updatedShare, err := manager.UpdatePublicShare(context.Background(), &user, &existingRefToken, &newGrant)
+	updatedShare, err := manager.UpdatePublicShare(context.Background(), &user, &existingRefToken, &update)
 	if err != nil {
 		t.Error(err)
 	}
 
 	// verify the expiration was updated to 01/01/1970 @ 1:00pm (UTC)
-	if updatedShare.Expiration == updatedMtime {
-		t.Error("")
+	if updatedShare.Expiration.Seconds != updatedMtime.Seconds {
+		t.Error("expiration was not updated")
+	}
+
+	// an expired share cannot be accessed by token
+	if _, err = manager.GetPublicShareByToken(context.Background(), shareToken, ""); err == nil {
+		t.Error("expected an error when accessing an expired share")
+	}
+
+	// remove the expiration again
+	update.Grant = &link.Grant{}
+	if _, err = manager.UpdatePublicShare(context.Background(), &user, &existingRefToken, &update); err != nil {
+		t.Error(err)
 	}
 
 	// test getting an invalid token
-	_, err = manager.GetPublicShareByToken(context.Background(), "xxxxxxxx")
+	_, err = manager.GetPublicShareByToken(context.Background(), "xxxxxxxx", "")
 	if err == nil {
 		t.Error(err)
 	}
 
 	// test getting a valid token
-	fetchedPs, err := manager.GetPublicShareByToken(context.Background(), shareToken)
+	fetchedPs, err := manager.GetPublicShareByToken(context.Background(), shareToken, "")
 	if err != nil {
 		t.Error(err)
 	}
@@ -158,14 +174,126 @@ func TestMemoryProvider(t *testing.T) {
 	}
 
 	// attempts to revoke a public share that does not exist, we expect an error
-	err = manager.RevokePublicShare(context.Background(), &user, "ref_does_not_exist")
+	err = manager.RevokePublicShare(context.Background(), &user, &nonExistingPublicShareRef)
 	if err == nil {
 		t.Error("expected a failure when revoking a public share that does not exist")
 	}
 
 	// revoke an existing public share
-	err = manager.RevokePublicShare(context.Background(), &user, fetchedPs.GetToken())
+	err = manager.RevokePublicShare(context.Background(), &user, &publicShareRef)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasswordProtection(t *testing.T) {
+	manager, err := New(make(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	user := userpb.User{Id: &userpb.UserId{Idp: "localhost", OpaqueId: "einstein"}}
+	other := userpb.User{Id: &userpb.UserId{Idp: "localhost", OpaqueId: "marie"}}
+	rInfo := provider.ResourceInfo{Id: &provider.ResourceId{StorageId: "storage", OpaqueId: "file"}}
+
+	share, err := manager.CreatePublicShare(ctx, &user, &rInfo, &link.Grant{Password: "secret"})
 	if err != nil {
+		t.Fatal(err)
+	}
+	if !share.PasswordProtected {
+		t.Error("expected share to be password protected")
+	}
+
+	if _, err := manager.GetPublicShareByToken(ctx, share.Token, "wrong"); err == nil {
+		t.Error("expected an error for a wrong password")
+	}
+	if _, err := manager.GetPublicShareByToken(ctx, share.Token, "secret"); err != nil {
+		t.Error(err)
+	}
+
+	ref := link.PublicShareReference{Spec: &link.PublicShareReference_Id{Id: share.Id}}
+	update := link.UpdatePublicShareRequest_Update{
+		Type:  link.UpdatePublicShareRequest_Update_TYPE_PASSWORD,
+		Grant: &link.Grant{},
+	}
+
+	// only the creator or the owner can change the share
+	if _, err := manager.UpdatePublicShare(ctx, &other, &ref, &update); err == nil {
+		t.Error("expected an error when updating a share of another user")
+	}
+
+	updated, err := manager.UpdatePublicShare(ctx, &user, &ref, &update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.PasswordProtected {
+		t.Error("expected the password protection to be removed")
+	}
+	if _, err := manager.GetPublicShareByToken(ctx, share.Token, ""); err != nil {
 		t.Error(err)
 	}
+
+	if err := manager.RevokePublicShare(ctx, &other, &ref); err == nil {
+		t.Error("expected an error when revoking a share of another user")
+	}
+	if err := manager.RevokePublicShare(ctx, &user, &ref); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListExpiringPublicShares(t *testing.T) {
+	manager, err := New(make(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, exp := range []time.Time{now.Add(-time.Hour), now.Add(time.Hour), now.Add(48 * time.Hour)} {
+		grant := &link.Grant{Expiration: &types.Timestamp{Seconds: uint64(exp.Unix())}}
+		if _, err := manager.CreatePublicShare(context.Background(), &userpb.User{}, &provider.ResourceInfo{}, grant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := manager.CreatePublicShare(context.Background(), &userpb.User{}, &provider.ResourceInfo{}, &link.Grant{}); err != nil {
+		t.Fatal(err)
+	}
+
+	shares, err := manager.ListExpiringPublicShares(context.Background(), now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 1 || int64(shares[0].Expiration.Seconds) != now.Add(time.Hour).Unix() {
+		t.Errorf("expected only the share expiring in one hour, got %v", shares)
+	}
+}
+
+func TestSharesOfOtherUsers(t *testing.T) {
+	manager, err := New(make(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "einstein"}}
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "marie"}}
+	info := &provider.ResourceInfo{Id: &provider.ResourceId{StorageId: "s", OpaqueId: "o"}, Owner: einstein.Id}
+	share, err := manager.CreatePublicShare(ctx, einstein, info, &link.Grant{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := &link.PublicShareReference{Spec: &link.PublicShareReference_Id{Id: share.Id}}
+
+	if _, err := manager.GetPublicShare(ctx, einstein, ref); err != nil {
+		t.Errorf("expected the creator to get the share, got %v", err)
+	}
+	if _, err := manager.GetPublicShare(ctx, marie, ref); err == nil {
+		t.Error("expected another user not to get the share")
+	}
+	if shares, err := manager.ListPublicShares(ctx, einstein, nil, info); err != nil || len(shares) != 1 {
+		t.Errorf("expected the creator to list the share, got %v, %v", shares, err)
+	}
+	if shares, err := manager.ListPublicShares(ctx, marie, nil, info); err != nil || len(shares) != 0 {
+		t.Errorf("expected another user not to list the share, got %v, %v", shares, err)
+	}
 }
@@ -0,0 +1,510 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements a public share manager backed by a MySQL or
+// PostgreSQL database, so that the public links survive restarts and can be
+// used from several gateways at once.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/publicshare"
+	"github.com/cs3org/reva/pkg/publicshare/manager/registry"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+}
+
+type mgr struct {
+	c  *config
+	db *sql.DB
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new public share manager backed by a SQL database.
+func New(m map[string]interface{}) (publicshare.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, db: db}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "public_share_schema_migrations", migrations); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// migrations contains the schema changes in the order they are applied.
+// The applied version is tracked in the public_share_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS public_shares (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		token VARCHAR(64) NOT NULL UNIQUE,
+		owner_idp VARCHAR(255) NOT NULL,
+		owner_opaque_id VARCHAR(255) NOT NULL,
+		creator_idp VARCHAR(255) NOT NULL,
+		creator_opaque_id VARCHAR(255) NOT NULL,
+		resource_storage_id VARCHAR(255) NOT NULL,
+		resource_opaque_id VARCHAR(255) NOT NULL,
+		permissions TEXT NOT NULL,
+		password VARCHAR(255) NOT NULL,
+		expiration BIGINT NOT NULL,
+		display_name VARCHAR(255) NOT NULL,
+		ctime BIGINT NOT NULL,
+		mtime BIGINT NOT NULL,
+		accesses BIGINT NOT NULL DEFAULT 0,
+		last_access BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX public_shares_owner ON public_shares (owner_idp, owner_opaque_id)`,
+	`CREATE INDEX public_shares_creator ON public_shares (creator_idp, creator_opaque_id)`,
+	`CREATE INDEX public_shares_resource ON public_shares (resource_storage_id, resource_opaque_id)`,
+	`ALTER TABLE public_shares ADD COLUMN transferred BIGINT NOT NULL DEFAULT 0`,
+}
+
+const shareColumns = "id, token, owner_idp, owner_opaque_id, creator_idp, creator_opaque_id, resource_storage_id, resource_opaque_id, permissions, password, expiration, display_name, ctime, mtime"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanShare returns the share of the row and the bcrypt hash of its password.
+func scanShare(row scanner) (*link.PublicShare, string, error) {
+	var (
+		id, token, ownerIdp, ownerID, creatorIdp, creatorID string
+		storageID, opaqueID, permissions, password, name    string
+		expiration, ctime, mtime                            int64
+	)
+	if err := row.Scan(&id, &token, &ownerIdp, &ownerID, &creatorIdp, &creatorID, &storageID, &opaqueID, &permissions, &password, &expiration, &name, &ctime, &mtime); err != nil {
+		return nil, "", err
+	}
+
+	perms := &provider.ResourcePermissions{}
+	if err := json.Unmarshal([]byte(permissions), perms); err != nil {
+		return nil, "", errors.Wrap(err, "sql: error decoding permissions")
+	}
+
+	s := &link.PublicShare{
+		Id:                &link.PublicShareId{OpaqueId: id},
+		Token:             token,
+		ResourceId:        &provider.ResourceId{StorageId: storageID, OpaqueId: opaqueID},
+		Permissions:       &link.PublicSharePermissions{Permissions: perms},
+		Owner:             &userpb.UserId{Idp: ownerIdp, OpaqueId: ownerID},
+		Creator:           &userpb.UserId{Idp: creatorIdp, OpaqueId: creatorID},
+		Ctime:             toTimestamp(ctime),
+		Mtime:             toTimestamp(mtime),
+		PasswordProtected: password != "",
+		DisplayName:       name,
+	}
+	if expiration != 0 {
+		s.Expiration = toTimestamp(expiration)
+	}
+	return s, password, nil
+}
+
+func toTimestamp(ns int64) *typespb.Timestamp {
+	return &typespb.Timestamp{
+		Seconds: uint64(ns / 1000000000),
+		Nanos:   uint32(ns % 1000000000),
+	}
+}
+
+// toNanos returns the time of the timestamp in unix nanoseconds, 0 for nil.
+func toNanos(ts *typespb.Timestamp) int64 {
+	if ts == nil {
+		return 0
+	}
+	return int64(ts.Seconds)*1000000000 + int64(ts.Nanos)
+}
+
+func encodePermissions(p *link.PublicSharePermissions) (string, error) {
+	data, err := json.Marshal(p.GetPermissions())
+	if err != nil {
+		return "", errors.Wrap(err, "sql: error encoding permissions")
+	}
+	return string(data), nil
+}
+
+func hashPassword(pw string) (string, error) {
+	if pw == "" {
+		return "", nil
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.Wrap(err, "sql: error hashing share password")
+	}
+	return string(h), nil
+}
+
+func (m *mgr) CreatePublicShare(ctx context.Context, u *userpb.User, rInfo *provider.ResourceInfo, g *link.Grant) (*link.PublicShare, error) {
+	tkn, err := publicshare.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := tkn
+	if name, ok := rInfo.GetArbitraryMetadata().GetMetadata()["name"]; ok && name != "" {
+		displayName = name
+	}
+
+	password, err := hashPassword(g.Password)
+	if err != nil {
+		return nil, err
+	}
+	perms, err := encodePermissions(g.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	s := &link.PublicShare{
+		Id:                &link.PublicShareId{OpaqueId: uuid.New().String()},
+		Owner:             rInfo.GetOwner(),
+		Creator:           u.GetId(),
+		ResourceId:        rInfo.GetId(),
+		Token:             tkn,
+		Permissions:       g.Permissions,
+		Ctime:             toTimestamp(now),
+		Mtime:             toTimestamp(now),
+		PasswordProtected: password != "",
+		Expiration:        g.Expiration,
+		DisplayName:       displayName,
+	}
+
+	query := "INSERT INTO public_shares (" + shareColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query),
+		s.Id.OpaqueId, s.Token,
+		s.Owner.GetIdp(), s.Owner.GetOpaqueId(), s.Creator.GetIdp(), s.Creator.GetOpaqueId(),
+		s.ResourceId.GetStorageId(), s.ResourceId.GetOpaqueId(),
+		perms, password, toNanos(s.Expiration), s.DisplayName, now, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error inserting public share")
+	}
+	return s, nil
+}
+
+// get returns the share referenced by either its token or its id and the
+// bcrypt hash of its password.
+func (m *mgr) get(ctx context.Context, ref *link.PublicShareReference) (*link.PublicShare, string, error) {
+	var row *sql.Row
+	if tkn := ref.GetToken(); tkn != "" {
+		row = m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT "+shareColumns+" FROM public_shares WHERE token = ?"), tkn)
+	} else if id := ref.GetId(); id != nil {
+		row = m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT "+shareColumns+" FROM public_shares WHERE id = ?"), id.OpaqueId)
+	} else {
+		return nil, "", errtypes.NotFound("sql: there are no shares for the given reference")
+	}
+
+	s, password, err := scanShare(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", errtypes.NotFound("sql: there are no shares for the given reference")
+		}
+		return nil, "", errors.Wrap(err, "sql: error reading public share")
+	}
+	return s, password, nil
+}
+
+// UpdatePublicShare updates the permissions, password or expiration date and the Mtime.
+func (m *mgr) UpdatePublicShare(ctx context.Context, u *userpb.User, ref *link.PublicShareReference, req *link.UpdatePublicShareRequest_Update) (*link.PublicShare, error) {
+	s, _, err := m.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !publicshare.IsCreatorOrOwner(u, s) {
+		return nil, errtypes.PermissionDenied("sql: user is not allowed to update the share")
+	}
+
+	now := time.Now().UnixNano()
+	var (
+		query string
+		value interface{}
+	)
+	switch req.GetType() {
+	case link.UpdatePublicShareRequest_Update_TYPE_PERMISSIONS:
+		s.Permissions = req.GetGrant().GetPermissions()
+		if value, err = encodePermissions(s.Permissions); err != nil {
+			return nil, err
+		}
+		query = "UPDATE public_shares SET permissions = ?, mtime = ? WHERE id = ?"
+	case link.UpdatePublicShareRequest_Update_TYPE_EXPIRATION:
+		s.Expiration = req.GetGrant().GetExpiration()
+		value = toNanos(s.Expiration)
+		query = "UPDATE public_shares SET expiration = ?, mtime = ? WHERE id = ?"
+	case link.UpdatePublicShareRequest_Update_TYPE_PASSWORD:
+		// an empty password removes the protection
+		password, err := hashPassword(req.GetGrant().GetPassword())
+		if err != nil {
+			return nil, err
+		}
+		s.PasswordProtected = password != ""
+		value = password
+		query = "UPDATE public_shares SET password = ?, mtime = ? WHERE id = ?"
+	default:
+		return nil, errtypes.NotSupported("sql: invalid update type: " + req.GetType().String())
+	}
+
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), value, now, s.Id.OpaqueId); err != nil {
+		return nil, errors.Wrap(err, "sql: error updating public share")
+	}
+	s.Mtime = toTimestamp(now)
+	return s, nil
+}
+
+// GetPublicShare returns the share identified by either its token or its id.
+func (m *mgr) GetPublicShare(ctx context.Context, u *userpb.User, ref *link.PublicShareReference) (*link.PublicShare, error) {
+	s, _, err := m.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	// the shares of the other users are not revealed
+	if !publicshare.IsCreatorOrOwner(u, s) {
+		return nil, errtypes.NotFound("sql: there are no shares for the given reference")
+	}
+	return s, nil
+}
+
+// filterClause returns the condition matching the shares matching any of
+// the filters, empty if there are none, and its parameters.
+func filterClause(filters []*link.ListPublicSharesRequest_Filter) (string, []interface{}) {
+	var (
+		conds  []string
+		params []interface{}
+	)
+	for _, f := range filters {
+		switch f.Type {
+		case link.ListPublicSharesRequest_Filter_TYPE_RESOURCE_ID:
+			conds = append(conds, "(resource_storage_id = ? AND resource_opaque_id = ?)")
+			params = append(params, f.GetResourceId().GetStorageId(), f.GetResourceId().GetOpaqueId())
+		case link.ListPublicSharesRequest_Filter_TYPE_OWNER:
+			conds = append(conds, "(owner_idp = ? AND owner_opaque_id = ?)")
+			params = append(params, f.GetOwner().GetIdp(), f.GetOwner().GetOpaqueId())
+		case link.ListPublicSharesRequest_Filter_TYPE_CREATOR:
+			conds = append(conds, "(creator_idp = ? AND creator_opaque_id = ?)")
+			params = append(params, f.GetCreator().GetIdp(), f.GetCreator().GetOpaqueId())
+		}
+	}
+	if len(filters) > 0 && len(conds) == 0 {
+		// only filters of unknown types, which match nothing
+		return "1 = 0", nil
+	}
+	return strings.Join(conds, " OR "), params
+}
+
+// ListPublicShares returns the shares created or owned by the user matching
+// the filters.
+func (m *mgr) ListPublicShares(ctx context.Context, u *userpb.User, filters []*link.ListPublicSharesRequest_Filter, md *provider.ResourceInfo) ([]*link.PublicShare, error) {
+	query := "SELECT " + shareColumns + " FROM public_shares WHERE ((creator_idp = ? AND creator_opaque_id = ?) OR (owner_idp = ? AND owner_opaque_id = ?))"
+	id := u.GetId()
+	params := []interface{}{id.GetIdp(), id.GetOpaqueId(), id.GetIdp(), id.GetOpaqueId()}
+	cond, filterParams := filterClause(filters)
+	if cond != "" {
+		query += " AND (" + cond + ")"
+		params = append(params, filterParams...)
+	}
+	return m.list(ctx, query, params...)
+}
+
+func (m *mgr) list(ctx context.Context, query string, params ...interface{}) ([]*link.PublicShare, error) {
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing public shares")
+	}
+	defer rows.Close()
+
+	shares := []*link.PublicShare{}
+	for rows.Next() {
+		s, _, err := scanShare(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "sql: error reading public share")
+		}
+		shares = append(shares, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql: error listing public shares")
+	}
+	return shares, nil
+}
+
+func (m *mgr) RevokePublicShare(ctx context.Context, u *userpb.User, ref *link.PublicShareReference) error {
+	s, _, err := m.get(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if !publicshare.IsCreatorOrOwner(u, s) {
+		return errtypes.PermissionDenied("sql: user is not allowed to revoke the share")
+	}
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "DELETE FROM public_shares WHERE id = ?"), s.Id.OpaqueId); err != nil {
+		return errors.Wrap(err, "sql: error deleting public share")
+	}
+	return nil
+}
+
+func (m *mgr) GetPublicShareByToken(ctx context.Context, token, password string) (*link.PublicShare, error) {
+	s, err := m.byToken(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "UPDATE public_shares SET accesses = accesses + 1, last_access = ? WHERE id = ?"
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), time.Now().Unix(), s.Id.OpaqueId); err != nil {
+		return nil, errors.Wrap(err, "sql: error counting the access to public share")
+	}
+	return s, nil
+}
+
+func (m *mgr) RecordPublicShareTransfer(ctx context.Context, token, password string, n uint64) error {
+	s, err := m.byToken(ctx, token, password)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE public_shares SET transferred = transferred + ? WHERE id = ?"
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), int64(n), s.Id.OpaqueId); err != nil {
+		return errors.Wrap(err, "sql: error recording the transfer of public share")
+	}
+	return nil
+}
+
+// byToken returns the share with the token if it has not expired and the
+// password matches.
+func (m *mgr) byToken(ctx context.Context, token, password string) (*link.PublicShare, error) {
+	s, hash, err := m.get(ctx, &link.PublicShareReference{Spec: &link.PublicShareReference_Token{Token: token}})
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return nil, errtypes.NotFound("sql: invalid token")
+		}
+		return nil, err
+	}
+	if publicshare.IsExpired(s) {
+		return nil, errtypes.NotFound("sql: invalid token")
+	}
+	if hash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return nil, errtypes.InvalidCredentials("sql: invalid password for share " + s.Id.OpaqueId)
+		}
+	}
+	return s, nil
+}
+
+func (m *mgr) ListExpiringPublicShares(ctx context.Context, t time.Time) ([]*link.PublicShare, error) {
+	query := "SELECT " + shareColumns + " FROM public_shares WHERE expiration > ? AND expiration < ?"
+	return m.list(ctx, query, time.Now().UnixNano(), t.UnixNano())
+}
+
+// RotatePublicShareToken gives the share a new token, keeping its settings and statistics.
+func (m *mgr) RotatePublicShareToken(ctx context.Context, u *userpb.User, ref *link.PublicShareReference) (*link.PublicShare, error) {
+	s, _, err := m.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !publicshare.IsCreatorOrOwner(u, s) {
+		return nil, errtypes.PermissionDenied("sql: user is not allowed to update the share")
+	}
+
+	tkn, err := publicshare.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	// the token is the display name of the unnamed shares
+	if s.DisplayName == s.Token {
+		s.DisplayName = tkn
+	}
+
+	now := time.Now().UnixNano()
+	query := "UPDATE public_shares SET token = ?, display_name = ?, mtime = ? WHERE id = ? AND token = ?"
+	res, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), tkn, s.DisplayName, now, s.Id.OpaqueId, s.Token)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error updating public share token")
+	}
+	// the token was rotated concurrently
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, errtypes.NotFound("sql: the share changed while rotating its token")
+	}
+	s.Token = tkn
+	s.Mtime = toTimestamp(now)
+	return s, nil
+}
+
+func (m *mgr) GetPublicShareStats(ctx context.Context, ids []string) (map[string]*publicshare.Stats, error) {
+	stats := map[string]*publicshare.Stats{}
+	if len(ids) == 0 {
+		return stats, nil
+	}
+
+	params := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		params = append(params, id)
+	}
+	query := "SELECT id, accesses, last_access, transferred FROM public_shares WHERE id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error reading public share stats")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id                                string
+			accesses, lastAccess, transferred int64
+		)
+		if err := rows.Scan(&id, &accesses, &lastAccess, &transferred); err != nil {
+			return nil, errors.Wrap(err, "sql: error reading public share stats")
+		}
+		stats[id] = &publicshare.Stats{Accesses: uint64(accesses), LastAccess: uint64(lastAccess), Transferred: uint64(transferred)}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql: error reading public share stats")
+	}
+	return stats, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+)
+
+func newTestManager(t *testing.T) *mgr {
+	m := &mgr{c: &config{Config: sqlutil.Config{DBDriver: sqlitetest.Driver}}, db: sqlitetest.Open(t)}
+	if err := sqlutil.Migrate(context.Background(), m.db, m.c.DBDriver, "public_share_schema_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestFilterClause(t *testing.T) {
+	resource := &link.ListPublicSharesRequest_Filter{
+		Type: link.ListPublicSharesRequest_Filter_TYPE_RESOURCE_ID,
+		Term: &link.ListPublicSharesRequest_Filter_ResourceId{ResourceId: &provider.ResourceId{StorageId: "s", OpaqueId: "o"}},
+	}
+	creator := &link.ListPublicSharesRequest_Filter{
+		Type: link.ListPublicSharesRequest_Filter_TYPE_CREATOR,
+		Term: &link.ListPublicSharesRequest_Filter_Creator{Creator: &userpb.UserId{Idp: "idp", OpaqueId: "einstein"}},
+	}
+	tests := []struct {
+		filters        []*link.ListPublicSharesRequest_Filter
+		expected       string
+		expectedParams []interface{}
+	}{
+		{nil, "", nil},
+		{[]*link.ListPublicSharesRequest_Filter{resource}, "(resource_storage_id = ? AND resource_opaque_id = ?)", []interface{}{"s", "o"}},
+		{[]*link.ListPublicSharesRequest_Filter{resource, creator}, "(resource_storage_id = ? AND resource_opaque_id = ?) OR (creator_idp = ? AND creator_opaque_id = ?)", []interface{}{"s", "o", "idp", "einstein"}},
+		{[]*link.ListPublicSharesRequest_Filter{{Type: link.ListPublicSharesRequest_Filter_TYPE_INVALID}}, "1 = 0", nil},
+	}
+
+	for _, tt := range tests {
+		cond, params := filterClause(tt.filters)
+		if cond != tt.expected || !reflect.DeepEqual(params, tt.expectedParams) {
+			t.Errorf("filterClause(%v): got %q %v, expected %q %v", tt.filters, cond, params, tt.expected, tt.expectedParams)
+		}
+	}
+}
+
+func TestSharesOfOtherUsers(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "einstein"}, Username: "einstein"}
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "marie"}, Username: "marie"}
+	info := &provider.ResourceInfo{
+		Id:    &provider.ResourceId{StorageId: "s", OpaqueId: "o"},
+		Owner: einstein.Id,
+	}
+	s, err := m.CreatePublicShare(ctx, einstein, info, &link.Grant{Permissions: &link.PublicSharePermissions{Permissions: &provider.ResourcePermissions{Stat: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := &link.PublicShareReference{Spec: &link.PublicShareReference_Id{Id: s.Id}}
+
+	if _, err := m.GetPublicShare(ctx, einstein, ref); err != nil {
+		t.Errorf("GetPublicShare() as the creator = %v", err)
+	}
+	if _, err := m.GetPublicShare(ctx, marie, ref); err == nil {
+		t.Error("GetPublicShare() as another user returned the share")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("GetPublicShare() as another user = %v, want not found", err)
+	}
+
+	filters := []*link.ListPublicSharesRequest_Filter{{
+		Type: link.ListPublicSharesRequest_Filter_TYPE_RESOURCE_ID,
+		Term: &link.ListPublicSharesRequest_Filter_ResourceId{ResourceId: info.Id},
+	}}
+	for _, f := range [][]*link.ListPublicSharesRequest_Filter{nil, filters} {
+		if shares, err := m.ListPublicShares(ctx, einstein, f, info); err != nil || len(shares) != 1 {
+			t.Errorf("ListPublicShares(%v) as the creator = %v, %v", f, shares, err)
+		}
+		if shares, err := m.ListPublicShares(ctx, marie, f, info); err != nil || len(shares) != 0 {
+			t.Errorf("ListPublicShares(%v) as another user = %v, %v", f, shares, err)
+		}
+	}
+}
+
+func TestPublicShares(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	u := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "einstein"}}
+	info := &provider.ResourceInfo{Id: &provider.ResourceId{StorageId: "s", OpaqueId: "o"}, Owner: u.Id}
+	read := &link.PublicSharePermissions{Permissions: &provider.ResourcePermissions{Stat: true}}
+
+	// create and get
+	s, err := m.CreatePublicShare(ctx, u, info, &link.Grant{Permissions: read, Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := &link.PublicShareReference{Spec: &link.PublicShareReference_Id{Id: s.Id}}
+	got, err := m.GetPublicShare(ctx, u, &link.PublicShareReference{Spec: &link.PublicShareReference_Token{Token: s.Token}})
+	if err != nil || got.Id.OpaqueId != s.Id.OpaqueId || !got.PasswordProtected || !got.Permissions.Permissions.Stat {
+		t.Fatalf("GetPublicShare() = %v, %v", got, err)
+	}
+	if _, err := m.GetPublicShareByToken(ctx, s.Token, "wrong"); err == nil {
+		t.Error("expected a wrong password to be refused")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := m.GetPublicShareByToken(ctx, s.Token, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.RecordPublicShareTransfer(ctx, s.Token, "secret", 1024); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := m.GetPublicShareStats(ctx, []string{s.Id.OpaqueId, "unknown"})
+	if err != nil || len(stats) != 1 || stats[s.Id.OpaqueId].Accesses != 2 || stats[s.Id.OpaqueId].Transferred != 1024 {
+		t.Errorf("GetPublicShareStats() = %v, %v", stats, err)
+	}
+
+	// update
+	update := func(typ link.UpdatePublicShareRequest_Update_Type, g *link.Grant) *link.PublicShare {
+		t.Helper()
+		s, err := m.UpdatePublicShare(ctx, u, ref, &link.UpdatePublicShareRequest_Update{Type: typ, Grant: g})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	write := &link.PublicSharePermissions{Permissions: &provider.ResourcePermissions{Stat: true, InitiateFileUpload: true}}
+	update(link.UpdatePublicShareRequest_Update_TYPE_PERMISSIONS, &link.Grant{Permissions: write})
+	update(link.UpdatePublicShareRequest_Update_TYPE_PASSWORD, &link.Grant{})
+	if got, err := m.GetPublicShare(ctx, u, ref); err != nil || got.PasswordProtected || !got.Permissions.Permissions.InitiateFileUpload {
+		t.Errorf("GetPublicShare() after update = %v, %v", got, err)
+	}
+	if _, err := m.GetPublicShareByToken(ctx, s.Token, ""); err != nil {
+		t.Errorf("expected the share without password to be accessible, got %v", err)
+	}
+	expiring := &typespb.Timestamp{Seconds: uint64(time.Now().Add(time.Hour).Unix())}
+	update(link.UpdatePublicShareRequest_Update_TYPE_EXPIRATION, &link.Grant{Expiration: expiring})
+	if shares, err := m.ListExpiringPublicShares(ctx, time.Now().Add(2*time.Hour)); err != nil || len(shares) != 1 {
+		t.Errorf("ListExpiringPublicShares() = %v, %v", shares, err)
+	}
+	update(link.UpdatePublicShareRequest_Update_TYPE_EXPIRATION, &link.Grant{Expiration: &typespb.Timestamp{Seconds: uint64(time.Now().Add(-time.Hour).Unix())}})
+	if _, err := m.GetPublicShareByToken(ctx, s.Token, ""); err == nil {
+		t.Error("expected the expired share to be refused")
+	}
+	update(link.UpdatePublicShareRequest_Update_TYPE_EXPIRATION, &link.Grant{})
+
+	// rotate
+	rotated, err := m.RotatePublicShareToken(ctx, u, ref)
+	if err != nil || rotated.Token == s.Token {
+		t.Fatalf("RotatePublicShareToken() = %v, %v", rotated, err)
+	}
+	if _, err := m.GetPublicShareByToken(ctx, s.Token, ""); err == nil {
+		t.Error("expected the old token to be refused")
+	}
+	if _, err := m.GetPublicShareByToken(ctx, rotated.Token, ""); err != nil {
+		t.Error(err)
+	}
+
+	// revoke
+	if err := m.RevokePublicShare(ctx, &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "marie"}}, ref); err == nil {
+		t.Error("expected another user not to revoke the share")
+	}
+	if err := m.RevokePublicShare(ctx, u, ref); err != nil {
+		t.Fatal(err)
+	}
+	if shares, err := m.ListPublicShares(ctx, u, nil, info); err != nil || len(shares) != 0 {
+		t.Errorf("ListPublicShares() after revoke = %v, %v", shares, err)
+	}
+}
@@ -20,18 +20,187 @@ package publicshare
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"time"
 
 	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/pkg/errors"
 )
 
+// The CS3 public shares can neither get a new token nor carry the
+// statistics of their accesses, so they travel in the opaque data of the
+// requests and responses of the link API.
+const (
+	// OpaqueRotateToken in an UpdatePublicShareRequest gives the share a new
+	// token instead of applying an update.
+	OpaqueRotateToken = "rotate_token"
+	// OpaqueStats holds the statistics of the shares of a response as a
+	// json map of share ids to Stats.
+	OpaqueStats = "stats"
+	// OpaqueTransferred in a GetPublicShareByTokenRequest records the
+	// decimal number of bytes downloaded through the share instead of
+	// counting an access.
+	OpaqueTransferred = "transferred"
+	// OpaqueLink in a file transfer request made with a token of the
+	// publicshare scope names the share the transfer is done for, so that
+	// the datagateway applies its bandwidth cap.
+	OpaqueLink = "public_link"
+)
+
+// Stats are the statistics of the accesses to a public share, counted
+// every time its token is resolved with the right password.
+type Stats struct {
+	Accesses uint64 `json:"accesses"`
+	// LastAccess is the time of the last access in unix seconds, 0 if the
+	// share has never been accessed.
+	LastAccess uint64 `json:"last_access,omitempty"`
+	// Transferred is the number of bytes downloaded through the share.
+	Transferred uint64 `json:"transferred,omitempty"`
+}
+
 // Manager manipulates public shares.
 type Manager interface {
 	CreatePublicShare(ctx context.Context, u *user.User, md *provider.ResourceInfo, g *link.Grant) (*link.PublicShare, error)
-	UpdatePublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference, g *link.Grant) (*link.PublicShare, error)
+	UpdatePublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference, req *link.UpdatePublicShareRequest_Update) (*link.PublicShare, error)
 	GetPublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference) (*link.PublicShare, error)
 	ListPublicShares(ctx context.Context, u *user.User, filters []*link.ListPublicSharesRequest_Filter, md *provider.ResourceInfo) ([]*link.PublicShare, error)
-	RevokePublicShare(ctx context.Context, u *user.User, id string) error
-	GetPublicShareByToken(ctx context.Context, token string) (*link.PublicShare, error)
+	RevokePublicShare(ctx context.Context, u *user.User, ref *link.PublicShareReference) error
+	// GetPublicShareByToken returns the share identified by the token if it has not
+	// expired and, for password protected shares, the password matches.
+	GetPublicShareByToken(ctx context.Context, token, password string) (*link.PublicShare, error)
+	// ListExpiringPublicShares returns the shares of all the users that have
+	// not expired yet but expire before t.
+	ListExpiringPublicShares(ctx context.Context, t time.Time) ([]*link.PublicShare, error)
+	// RotatePublicShareToken gives the share a new token, the old one no
+	// longer giving access. The settings and the statistics are kept.
+	RotatePublicShareToken(ctx context.Context, u *user.User, ref *link.PublicShareReference) (*link.PublicShare, error)
+	// GetPublicShareStats returns the statistics of the shares with the
+	// given ids, keyed by id. Unknown ids are omitted.
+	GetPublicShareStats(ctx context.Context, ids []string) (map[string]*Stats, error)
+	// RecordPublicShareTransfer adds n to the bytes downloaded through the
+	// share identified by the token, which is checked like with
+	// GetPublicShareByToken.
+	RecordPublicShareTransfer(ctx context.Context, token, password string, n uint64) error
+}
+
+// IsExpired tells whether the share has an expiration date in the past.
+func IsExpired(s *link.PublicShare) bool {
+	if s.Expiration == nil || s.Expiration.Seconds == 0 {
+		return false
+	}
+	expiration := time.Unix(int64(s.Expiration.Seconds), int64(s.Expiration.Nanos))
+	return expiration.Before(time.Now())
+}
+
+// IsCreatorOrOwner tells whether the user created the share or owns the
+// shared resource, and thus may change it.
+func IsCreatorOrOwner(u *user.User, s *link.PublicShare) bool {
+	return sameUser(u.GetId(), s.Creator) || sameUser(u.GetId(), s.Owner)
+}
+
+// MatchesFilters tells whether the share matches any of the filters, or
+// there are no filters.
+func MatchesFilters(s *link.PublicShare, filters []*link.ListPublicSharesRequest_Filter) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		switch f.Type {
+		case link.ListPublicSharesRequest_Filter_TYPE_RESOURCE_ID:
+			if s.ResourceId.GetStorageId() == f.GetResourceId().GetStorageId() && s.ResourceId.GetOpaqueId() == f.GetResourceId().GetOpaqueId() {
+				return true
+			}
+		case link.ListPublicSharesRequest_Filter_TYPE_OWNER:
+			if sameUser(s.Owner, f.GetOwner()) {
+				return true
+			}
+		case link.ListPublicSharesRequest_Filter_TYPE_CREATOR:
+			if sameUser(s.Creator, f.GetCreator()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameUser(a, b *user.UserId) bool {
+	return a.GetIdp() == b.GetIdp() && a.GetOpaqueId() == b.GetOpaqueId()
+}
+
+// GenerateToken returns a new random token for a share.
+func GenerateToken() (string, error) {
+	var l = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	max := big.NewInt(int64(len(l)))
+	b := make([]rune, 15)
+	for i := range b {
+		r, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errors.Wrap(err, "publicshare: error generating token")
+		}
+		b[i] = l[r.Int64()]
+	}
+	return string(b), nil
+}
+
+// StatsToOpaque returns the opaque data carrying the statistics of a list
+// of shares, keyed by share id.
+func StatsToOpaque(stats map[string]*Stats) (*typespb.Opaque, error) {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, errors.Wrap(err, "publicshare: error encoding stats")
+	}
+	return &typespb.Opaque{
+		Map: map[string]*typespb.OpaqueEntry{
+			OpaqueStats: {Decoder: "json", Value: data},
+		},
+	}, nil
+}
+
+// TransferRequest returns the request recording the n bytes downloaded
+// through the share with the token, the password is needed for the
+// protected shares.
+func TransferRequest(token, password string, n uint64) *link.GetPublicShareByTokenRequest {
+	m := map[string]*typespb.OpaqueEntry{
+		OpaqueTransferred: {Decoder: "plain", Value: []byte(strconv.FormatUint(n, 10))},
+	}
+	if password != "" {
+		m["password"] = &typespb.OpaqueEntry{Decoder: "plain", Value: []byte(password)}
+	}
+	return &link.GetPublicShareByTokenRequest{Token: token, Opaque: &typespb.Opaque{Map: m}}
+}
+
+// TransferFromOpaque returns the bytes recorded by the opaque data of a
+// GetPublicShareByTokenRequest, and whether it records a transfer.
+func TransferFromOpaque(o *typespb.Opaque) (uint64, bool, error) {
+	e, ok := o.GetMap()[OpaqueTransferred]
+	if !ok {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseUint(string(e.Value), 10, 64)
+	if err != nil {
+		return 0, true, errors.Wrap(err, "publicshare: invalid transferred bytes")
+	}
+	return n, true, nil
+}
+
+// StatsFromOpaque returns the statistics carried by the opaque data, keyed by share id.
+func StatsFromOpaque(o *typespb.Opaque) (map[string]*Stats, error) {
+	stats := map[string]*Stats{}
+	e, ok := o.GetMap()[OpaqueStats]
+	if !ok {
+		return stats, nil
+	}
+	if e.Decoder != "json" {
+		return nil, errors.New("publicshare: unsupported stats decoder " + e.Decoder)
+	}
+	if err := json.Unmarshal(e.Value, &stats); err != nil {
+		return nil, errors.Wrap(err, "publicshare: error decoding stats")
+	}
+	return stats, nil
 }
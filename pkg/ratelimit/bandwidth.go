@@ -0,0 +1,156 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxRead bounds the bytes read at once by a throttled reader, so that the
+// transfers sharing a bucket are interleaved.
+const maxRead = 32 * 1024
+
+// Bandwidth shares a rate in bytes per second between the transfers using
+// the same key. A nil Bandwidth does not limit anything.
+type Bandwidth struct {
+	rate float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewBandwidth returns a limiter allowing rate bytes per second per key,
+// with bursts of one second worth of bytes. A rate that is not positive
+// disables limiting and returns nil.
+func NewBandwidth(rate int64) *Bandwidth {
+	if rate <= 0 {
+		return nil
+	}
+	return &Bandwidth{
+		rate:    float64(rate),
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// reserve takes n bytes from the bucket for key and returns how long to
+// wait before they may be transferred. The bucket goes into debt so that
+// concurrent transfers queue up behind each other.
+func (b *Bandwidth) reserve(key string, n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: b.rate, last: now}
+		b.buckets[key] = bk
+	}
+
+	bk.tokens += now.Sub(bk.last).Seconds() * b.rate
+	if bk.tokens > b.rate {
+		bk.tokens = b.rate
+	}
+	bk.last = now
+	bk.tokens -= float64(n)
+
+	if bk.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bk.tokens / b.rate * float64(time.Second))
+}
+
+// sweep drops the buckets that have refilled completely. It must be called
+// with the lock held.
+func (b *Bandwidth) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < sweepInterval {
+		return
+	}
+	b.lastSweep = now
+	for k, bk := range b.buckets {
+		if bk.tokens+now.Sub(bk.last).Seconds()*b.rate >= b.rate {
+			delete(b.buckets, k)
+		}
+	}
+}
+
+// Limit is a bandwidth limiter and the key of the bucket a transfer uses.
+type Limit struct {
+	Bandwidth *Bandwidth
+	Key       string
+}
+
+type reader struct {
+	ctx    context.Context
+	r      io.Reader
+	limits []Limit
+}
+
+// NewReader returns a reader throttled by all the limits, the slowest one
+// setting the pace. Reads fail when the context is done while waiting.
+func NewReader(ctx context.Context, r io.Reader, limits ...Limit) io.Reader {
+	var active []Limit
+	for _, l := range limits {
+		if l.Bandwidth != nil {
+			active = append(active, l)
+		}
+	}
+	if len(active) == 0 {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limits: active}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > maxRead {
+		p = p[:maxRead]
+	}
+	n, err := r.r.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	var wait time.Duration
+	for _, l := range r.limits {
+		if d := l.Bandwidth.reserve(l.Key, n); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		}
+	}
+	return n, err
+}
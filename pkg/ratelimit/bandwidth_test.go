@@ -0,0 +1,78 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ratelimit
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBandwidthReserve(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := NewBandwidth(100)
+	b.now = func() time.Time { return now }
+
+	if d := b.reserve("a", 100); d != 0 {
+		t.Fatalf("the burst should not wait, got %s", d)
+	}
+	if d := b.reserve("a", 50); d != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %s", d)
+	}
+	// concurrent transfers queue up behind each other
+	if d := b.reserve("a", 50); d != time.Second {
+		t.Fatalf("expected to wait 1s, got %s", d)
+	}
+	if d := b.reserve("b", 100); d != 0 {
+		t.Fatal("buckets of different keys must be independent")
+	}
+
+	now = now.Add(2 * time.Second)
+	if d := b.reserve("a", 100); d != 0 {
+		t.Fatalf("the bucket should have been refilled, got %s", d)
+	}
+
+	now = now.Add(time.Hour)
+	b.reserve("c", 1)
+	if _, ok := b.buckets["b"]; ok {
+		t.Fatal("idle buckets should have been swept")
+	}
+}
+
+func TestBandwidthReader(t *testing.T) {
+	if NewBandwidth(0) != nil {
+		t.Fatal("expected nil limiter for non positive rate")
+	}
+	src := strings.NewReader("data")
+	if r := NewReader(context.Background(), src, Limit{Bandwidth: nil, Key: "a"}); r != src {
+		t.Fatal("expected the reader to be returned as is without limits")
+	}
+
+	b := NewBandwidth(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the first byte is within the burst, the next ones wait until the
+	// context is done
+	_, err := ioutil.ReadAll(NewReader(ctx, strings.NewReader("data"), Limit{Bandwidth: b, Key: "a"}))
+	if err != context.Canceled {
+		t.Fatalf("expected the read to be canceled, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("a") {
+			t.Fatalf("request %d should have been allowed within the burst", i)
+		}
+	}
+	if l.Allow("a") {
+		t.Fatal("request should have been limited after the burst")
+	}
+	if !l.Allow("b") {
+		t.Fatal("buckets of different keys must be independent")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow("a") {
+		t.Fatal("a token should have been refilled")
+	}
+	if l.Allow("a") {
+		t.Fatal("only one token should have been refilled")
+	}
+
+	now = now.Add(time.Hour)
+	l.Allow("c")
+	if _, ok := l.buckets["b"]; ok {
+		t.Fatal("idle buckets should have been swept")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	l := New(0, 10)
+	if l != nil {
+		t.Fatal("expected nil limiter for non positive rate")
+	}
+	if !l.Allow("a") {
+		t.Fatal("nil limiter must allow everything")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package rgrpc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cs3org/reva/pkg/discovery"
+)
+
+// registryTimeout bounds the calls to the service registry.
+const registryTimeout = 5 * time.Second
+
+func (s *Server) serviceNames() []string {
+	names := make([]string, 0, len(s.services))
+	for name := range s.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) advertiseAddress() string {
+	if s.conf.AdvertiseAddress != "" {
+		return s.conf.AdvertiseAddress
+	}
+	return s.conf.Address
+}
+
+// serviceID identifies the instance of a service of this server in the
+// service registry.
+func (s *Server) serviceID(name string) string {
+	return name + "-" + s.advertiseAddress()
+}
+
+// advertise registers the services in the service registry, if one is
+// configured. Failures are logged, the services keep being served.
+func (s *Server) advertise(names []string) {
+	reg := discovery.GetRegistry()
+	if reg == nil {
+		return
+	}
+	for _, name := range names {
+		svc := &discovery.Service{ID: s.serviceID(name), Name: name, Address: s.advertiseAddress()}
+		ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+		err := reg.Register(ctx, svc)
+		cancel()
+		if err != nil {
+			s.log.Error().Err(err).Msgf("rgrpc: error registering grpc service %s in the service registry", name)
+			continue
+		}
+		s.log.Info().Msgf("rgrpc: grpc service %s registered as %s", name, svc.ID)
+	}
+}
+
+// withdraw removes the services from the service registry.
+func (s *Server) withdraw(names []string) {
+	reg := discovery.GetRegistry()
+	if reg == nil {
+		return
+	}
+	for _, name := range names {
+		ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+		err := reg.Deregister(ctx, s.serviceID(name))
+		cancel()
+		if err != nil {
+			s.log.Error().Err(err).Msgf("rgrpc: error deregistering grpc service %s from the service registry", name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package rgrpc
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var errListenerClosed = errors.New("rgrpc: listener closed")
+
+// sharedListener accepts connections on a single socket and hands them
+// to whichever grpc server is currently serving, so that a server can be
+// replaced on reload without closing the socket.
+type sharedListener struct {
+	ln      net.Listener
+	conns   chan net.Conn
+	done    chan struct{}
+	err     error
+	once    sync.Once
+	closing chan struct{}
+}
+
+func newSharedListener(ln net.Listener) *sharedListener {
+	l := &sharedListener{
+		ln:      ln,
+		conns:   make(chan net.Conn),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+func (l *sharedListener) run() {
+	for {
+		c, err := l.ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			l.err = err
+			close(l.done)
+			return
+		}
+
+		select {
+		case l.conns <- c:
+		case <-l.closing:
+			c.Close()
+		}
+	}
+}
+
+// Close closes the underlying socket.
+func (l *sharedListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.closing)
+		err = l.ln.Close()
+	})
+	return err
+}
+
+// sub returns a listener for a single grpc server. Closing it only
+// stops that server from accepting new connections.
+func (l *sharedListener) sub() net.Listener {
+	return &subListener{parent: l, closed: make(chan struct{})}
+}
+
+type subListener struct {
+	parent *sharedListener
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (l *subListener) Accept() (net.Conn, error) {
+	// give priority to close so a stopped server gets no new conns.
+	select {
+	case <-l.closed:
+		return nil, errListenerClosed
+	default:
+	}
+
+	select {
+	case c := <-l.parent.conns:
+		return c, nil
+	case <-l.parent.done:
+		return nil, l.parent.err
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *subListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *subListener) Addr() net.Addr {
+	return l.parent.ln.Addr()
+}
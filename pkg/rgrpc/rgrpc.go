@@ -22,19 +22,26 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"reflect"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/cs3org/reva/internal/grpc/interceptors/appctx"
 	"github.com/cs3org/reva/internal/grpc/interceptors/auth"
 	"github.com/cs3org/reva/internal/grpc/interceptors/log"
+	"github.com/cs3org/reva/internal/grpc/interceptors/metrics"
 	"github.com/cs3org/reva/internal/grpc/interceptors/recovery"
 	"github.com/cs3org/reva/internal/grpc/interceptors/token"
+	"github.com/cs3org/reva/pkg/health"
+	"github.com/cs3org/reva/pkg/trace"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"go.opencensus.io/plugin/ocgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -98,15 +105,90 @@ type config struct {
 	Services         map[string]map[string]interface{} `mapstructure:"services"`
 	Interceptors     map[string]map[string]interface{} `mapstructure:"interceptors"`
 	EnableReflection bool                              `mapstructure:"enable_reflection"`
+	// AdvertiseAddress is the address the services are registered with in
+	// the service registry, the address of the server if empty.
+	AdvertiseAddress string `mapstructure:"advertise_address"`
+	// MaxRecvMsgSize and MaxSendMsgSize bound in bytes the messages received
+	// and sent by the server, the grpc defaults are used if 0.
+	MaxRecvMsgSize int `mapstructure:"max_recv_msg_size"`
+	MaxSendMsgSize int `mapstructure:"max_send_msg_size"`
+	// MaxConcurrentStreams limits the concurrent calls of a client
+	// connection, unlimited if 0.
+	MaxConcurrentStreams int             `mapstructure:"max_concurrent_streams"`
+	Keepalive            keepaliveConfig `mapstructure:"keepalive"`
+}
+
+// keepaliveConfig holds the keepalive parameters of the server, in seconds.
+// The grpc defaults are used for the values left to 0.
+type keepaliveConfig struct {
+	// Time is the time without activity after which the server pings the
+	// client, and Timeout how long it waits for the answer.
+	Time    int `mapstructure:"time"`
+	Timeout int `mapstructure:"timeout"`
+	// MaxConnectionIdle closes the connections without calls, and
+	// MaxConnectionAge the older ones after MaxConnectionAgeGrace to
+	// finish their calls, so that the clients spread over new instances.
+	MaxConnectionIdle     int `mapstructure:"max_connection_idle"`
+	MaxConnectionAge      int `mapstructure:"max_connection_age"`
+	MaxConnectionAgeGrace int `mapstructure:"max_connection_age_grace"`
+	// MinTime is the minimum time between the pings of a client, the
+	// clients pinging more often are disconnected. PermitWithoutStream
+	// allows the pings of connections without calls.
+	MinTime             int  `mapstructure:"min_time"`
+	PermitWithoutStream bool `mapstructure:"permit_without_stream"`
+}
+
+func seconds(s int) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+// serverOptions returns the options of the grpc server set in the config.
+func (c *config) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if c.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(c.MaxSendMsgSize))
+	}
+	if c.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(c.MaxConcurrentStreams)))
+	}
+
+	k := c.Keepalive
+	if k != (keepaliveConfig{}) {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:                  seconds(k.Time),
+			Timeout:               seconds(k.Timeout),
+			MaxConnectionIdle:     seconds(k.MaxConnectionIdle),
+			MaxConnectionAge:      seconds(k.MaxConnectionAge),
+			MaxConnectionAgeGrace: seconds(k.MaxConnectionAgeGrace),
+		}))
+	}
+	if k.MinTime > 0 || k.PermitWithoutStream {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             seconds(k.MinTime),
+			PermitWithoutStream: k.PermitWithoutStream,
+		}))
+	}
+	return opts
 }
 
 // Server is a gRPC server.
 type Server struct {
 	s        *grpc.Server
 	conf     *config
-	listener net.Listener
+	listener *sharedListener
 	log      zerolog.Logger
 	services map[string]Service
+
+	mu       sync.Mutex
+	stopOnce sync.Once
+	stopped  chan struct{}
+	// the services are withdrawn and closed once, Stop can be called while
+	// GracefulStop waits for the calls in flight
+	withdrawOnce sync.Once
+	cleanupOnce  sync.Once
 }
 
 // NewServer returns a new Server.
@@ -125,25 +207,124 @@ func NewServer(m interface{}, log zerolog.Logger) (*Server, error) {
 		conf.Address = "localhost:9999"
 	}
 
-	server := &Server{conf: conf, log: log, services: map[string]Service{}}
+	server := &Server{conf: conf, log: log, services: map[string]Service{}, stopped: make(chan struct{})}
 
 	return server, nil
 }
 
 // Start starts the server.
 func (s *Server) Start(ln net.Listener) error {
-	if err := s.registerServices(); err != nil {
+	s.mu.Lock()
+	if err := s.registerServices(nil); err != nil {
+		s.mu.Unlock()
 		err = errors.Wrap(err, "unable to register services")
 		return err
 	}
+	s.listener = newSharedListener(ln)
+	srv := s.s
+	names := s.serviceNames()
+	s.mu.Unlock()
+
+	s.advertise(names)
 
-	s.listener = ln
 	s.log.Info().Msgf("grpc server listening at %s:%s", s.Network(), s.Address())
-	err := s.s.Serve(s.listener)
+	err := srv.Serve(s.listener.sub())
 	if err != nil {
 		err = errors.Wrap(err, "serve failed")
 		return err
 	}
+
+	// the first grpc server may have been replaced by a reload.
+	<-s.stopped
+	return nil
+}
+
+// Reload applies a new configuration to the running server without
+// closing the listener. A new grpc server is built with the new
+// interceptors, reusing the services whose configuration did not change,
+// and takes over accepting connections while the previous one drains.
+// Reload must not be called concurrently.
+func (s *Server) Reload(m interface{}) error {
+	ns, err := NewServer(m, s.log)
+	if err != nil {
+		return errors.Wrap(err, "rgrpc: error decoding config")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return errors.New("rgrpc: server not started")
+	}
+
+	if ns.conf.Network != s.conf.Network || ns.conf.Address != s.conf.Address {
+		return errors.New("rgrpc: changing the network address requires a restart")
+	}
+
+	reuse := map[string]Service{}
+	stale := map[string]Service{}
+	for name, svc := range s.services {
+		if c, ok := ns.conf.Services[name]; ok && reflect.DeepEqual(c, s.conf.Services[name]) {
+			reuse[name] = svc
+			continue
+		}
+		stale[name] = svc
+	}
+
+	if err := ns.registerServices(reuse); err != nil {
+		for name, svc := range ns.services {
+			if _, ok := reuse[name]; !ok {
+				_ = svc.Close()
+			}
+		}
+		return err
+	}
+
+	var added, removed []string
+	for name := range ns.conf.Services {
+		if _, ok := s.conf.Services[name]; !ok {
+			added = append(added, name)
+			s.log.Info().Msgf("rgrpc: grpc service added: %s", name)
+		} else if _, ok := stale[name]; ok {
+			s.log.Info().Msgf("rgrpc: grpc service changed: %s", name)
+		}
+	}
+	for name := range stale {
+		if _, ok := ns.conf.Services[name]; !ok {
+			health.UnregisterService("grpc", name)
+			removed = append(removed, name)
+			s.log.Info().Msgf("rgrpc: grpc service removed: %s", name)
+		}
+	}
+	if ns.advertiseAddress() != s.advertiseAddress() {
+		removed, added = s.serviceNames(), ns.serviceNames()
+	}
+	s.withdraw(removed)
+	ns.advertise(added)
+	if !reflect.DeepEqual(ns.conf.Interceptors, s.conf.Interceptors) {
+		s.log.Info().Msg("rgrpc: grpc interceptors changed")
+	}
+
+	old := s.s
+	s.s = ns.s
+	s.conf = ns.conf
+	s.services = ns.services
+
+	go func(srv *grpc.Server, ln net.Listener) {
+		if err := srv.Serve(ln); err != nil {
+			s.log.Error().Err(err).Msg("rgrpc: reloaded grpc server failed")
+		}
+	}(ns.s, s.listener.sub())
+
+	go func() {
+		old.GracefulStop()
+		for name, svc := range stale {
+			if err := svc.Close(); err != nil {
+				s.log.Error().Err(err).Msgf("error closing replaced service %q", name)
+			} else {
+				s.log.Info().Msgf("replaced service %q drained and closed", name)
+			}
+		}
+	}()
 	return nil
 }
 
@@ -165,15 +346,20 @@ func (s *Server) isServiceEnabled(svcName string) bool {
 	return false
 }
 
-func (s *Server) registerServices() error {
+func (s *Server) registerServices(reuse map[string]Service) error {
 	for svcName := range s.conf.Services {
 		if s.isServiceEnabled(svcName) {
-			newFunc := Services[svcName]
-			svc, err := newFunc(s.conf.Services[svcName], s.s)
-			if err != nil {
-				return errors.Wrapf(err, "rgrpc: grpc service %s could not be started,", svcName)
+			svc, ok := reuse[svcName]
+			if !ok {
+				newFunc := Services[svcName]
+				var err error
+				svc, err = newFunc(s.conf.Services[svcName], s.s)
+				if err != nil {
+					return errors.Wrapf(err, "rgrpc: grpc service %s could not be started,", svcName)
+				}
 			}
 			s.services[svcName] = svc
+			health.RegisterService("grpc", svcName, s.Network(), s.Address())
 			s.log.Info().Msgf("rgrpc: grpc service enabled: %s", svcName)
 		} else {
 			message := fmt.Sprintf("rgrpc: grpc service %s does not exist", svcName)
@@ -192,6 +378,7 @@ func (s *Server) registerServices() error {
 		return err
 	}
 	opts = append(opts, grpc.StatsHandler(&ocgrpc.ServerHandler{}))
+	opts = append(opts, s.conf.serverOptions()...)
 	grpcServer := grpc.NewServer(opts...)
 	if s.conf.EnableReflection {
 		s.log.Info().Msg("rgrpc: grpc server reflection enabled")
@@ -209,29 +396,57 @@ func (s *Server) registerServices() error {
 
 // TODO(labkode): make closing with deadline.
 func (s *Server) cleanupServices() {
-	for name, svc := range s.services {
-		if err := svc.Close(); err != nil {
-			s.log.Error().Err(err).Msgf("error closing service %q", name)
-		} else {
-			s.log.Info().Msgf("service %q correctly closed", name)
+	s.cleanupOnce.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for name, svc := range s.services {
+			if err := svc.Close(); err != nil {
+				s.log.Error().Err(err).Msgf("error closing service %q", name)
+			} else {
+				s.log.Info().Msgf("service %q correctly closed", name)
+			}
 		}
-	}
+	})
 }
 
-// Stop stops the server.
+// shutdown withdraws the services from the service registry and returns the
+// grpc server to stop.
+func (s *Server) shutdown() *grpc.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.withdrawOnce.Do(func() { s.withdraw(s.serviceNames()) })
+	return s.s
+}
+
+// Stop stops the server, aborting the calls and streams in flight. It ends
+// a GracefulStop waiting for them.
 func (s *Server) Stop() error {
+	if srv := s.shutdown(); srv != nil {
+		srv.Stop()
+	}
+	s.closeListener()
 	s.cleanupServices()
-	s.s.Stop()
 	return nil
 }
 
-// GracefulStop gracefully stops the server.
+// GracefulStop stops accepting connections and waits for the calls and
+// streams in flight to end before closing the services.
 func (s *Server) GracefulStop() error {
+	if srv := s.shutdown(); srv != nil {
+		srv.GracefulStop()
+	}
+	s.closeListener()
 	s.cleanupServices()
-	s.s.GracefulStop()
 	return nil
 }
 
+func (s *Server) closeListener() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.stopOnce.Do(func() { close(s.stopped) })
+}
+
 // Network returns the network type.
 func (s *Server) Network() string {
 	return s.conf.Network
@@ -277,9 +492,11 @@ func (s *Server) getInterceptors(unprotected []string) ([]grpc.ServerOption, err
 	}
 
 	unaryInterceptors = append([]grpc.UnaryServerInterceptor{
+		trace.NewUnary(),
 		appctx.NewUnary(s.log),
 		token.NewUnary(),
 		log.NewUnary(),
+		metrics.NewUnary(),
 		recovery.NewUnary(),
 	}, unaryInterceptors...)
 	unaryChain := grpc_middleware.ChainUnaryServer(unaryInterceptors...)
@@ -317,10 +534,12 @@ func (s *Server) getInterceptors(unprotected []string) ([]grpc.ServerOption, err
 	}
 
 	streamInterceptors = append([]grpc.StreamServerInterceptor{
+		trace.NewStream(),
 		authStream,
 		appctx.NewStream(s.log),
 		token.NewStream(),
 		log.NewStream(),
+		metrics.NewStream(),
 		recovery.NewStream(),
 	}, streamInterceptors...)
 	streamChain := grpc_middleware.ChainStreamServer(streamInterceptors...)
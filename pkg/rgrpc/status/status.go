@@ -27,7 +27,8 @@ import (
 
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
-	"go.opencensus.io/trace"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/trace"
 )
 
 // NewOK returns a Status with CODE_OK.
@@ -88,6 +89,39 @@ func NewUnauthenticated(ctx context.Context, err error, msg string) *rpc.Status
 	}
 }
 
+// NewPermissionDenied returns a Status with CODE_PERMISSION_DENIED and logs the msg.
+func NewPermissionDenied(ctx context.Context, err error, msg string) *rpc.Status {
+	log := appctx.GetLogger(ctx).With().CallerWithSkipFrameCount(3).Logger()
+	log.Warn().Err(err).Msg(msg)
+	return &rpc.Status{
+		Code:    rpc.Code_CODE_PERMISSION_DENIED,
+		Message: msg,
+		Trace:   getTrace(ctx),
+	}
+}
+
+// NewResourceExhausted returns a Status with CODE_RESOURCE_EXHAUSTED and logs the msg.
+func NewResourceExhausted(ctx context.Context, err error, msg string) *rpc.Status {
+	log := appctx.GetLogger(ctx).With().CallerWithSkipFrameCount(3).Logger()
+	log.Warn().Err(err).Msg(msg)
+	return &rpc.Status{
+		Code:    rpc.Code_CODE_RESOURCE_EXHAUSTED,
+		Message: msg,
+		Trace:   getTrace(ctx),
+	}
+}
+
+// NewUnavailable returns a Status with CODE_UNAVAILABLE and logs the msg.
+func NewUnavailable(ctx context.Context, msg string) *rpc.Status {
+	log := appctx.GetLogger(ctx).With().CallerWithSkipFrameCount(3).Logger()
+	log.Warn().Msg(msg)
+	return &rpc.Status{
+		Code:    rpc.Code_CODE_UNAVAILABLE,
+		Message: msg,
+		Trace:   getTrace(ctx),
+	}
+}
+
 // NewUnimplemented returns a Status with CODE_UNIMPLEMENTED and logs the msg.
 func NewUnimplemented(ctx context.Context, err error, msg string) *rpc.Status {
 	log := appctx.GetLogger(ctx).With().CallerWithSkipFrameCount(3).Logger()
@@ -107,6 +141,59 @@ func NewInvalidArg(ctx context.Context, msg string) *rpc.Status {
 	}
 }
 
+// NewStatusFromErrType returns a Status with the code matching the type of
+// the error returned by a driver and logs the msg, so that all the services
+// report the same failures with the same codes. The errors wrapped with
+// github.com/pkg/errors are unwrapped, the ones of an unknown type give
+// CODE_INTERNAL.
+func NewStatusFromErrType(ctx context.Context, msg string, err error) *rpc.Status {
+	if err == nil {
+		return NewOK(ctx)
+	}
+
+	code := codeFromErrType(err)
+	log := appctx.GetLogger(ctx).With().CallerWithSkipFrameCount(3).Logger()
+	if code == rpc.Code_CODE_INTERNAL {
+		log.Err(err).Msg(msg)
+	} else {
+		log.Warn().Err(err).Msg(msg)
+	}
+	return &rpc.Status{
+		Code:    code,
+		Message: msg,
+		Trace:   getTrace(ctx),
+	}
+}
+
+func codeFromErrType(err error) rpc.Code {
+	var (
+		notFound           errtypes.IsNotFound
+		permissionDenied   errtypes.IsPermissionDenied
+		alreadyExists      errtypes.IsAlreadyExists
+		notSupported       errtypes.IsNotSupported
+		invalidCredentials errtypes.IsInvalidCredentials
+		userRequired       errtypes.IsUserRequired
+		locked             errtypes.IsLocked
+		preconditionFailed errtypes.IsPreconditionFailed
+	)
+	switch {
+	case errors.As(err, &notFound):
+		return rpc.Code_CODE_NOT_FOUND
+	case errors.As(err, &permissionDenied):
+		return rpc.Code_CODE_PERMISSION_DENIED
+	case errors.As(err, &alreadyExists):
+		return rpc.Code_CODE_ALREADY_EXISTS
+	case errors.As(err, &notSupported):
+		return rpc.Code_CODE_UNIMPLEMENTED
+	case errors.As(err, &invalidCredentials), errors.As(err, &userRequired):
+		return rpc.Code_CODE_UNAUTHENTICATED
+	case errors.As(err, &locked), errors.As(err, &preconditionFailed):
+		return rpc.Code_CODE_FAILED_PRECONDITION
+	default:
+		return rpc.Code_CODE_INTERNAL
+	}
+}
+
 // NewErrorFromCode returns a standardized Error for a given RPC code.
 func NewErrorFromCode(code rpc.Code, pkgname string) error {
 	return errors.New(pkgname + ": grpc failed with code " + code.String())
@@ -114,6 +201,5 @@ func NewErrorFromCode(code rpc.Code, pkgname string) error {
 
 // internal function to attach the trace to a context
 func getTrace(ctx context.Context) string {
-	span := trace.FromContext(ctx)
-	return span.SpanContext().TraceID.String()
+	return trace.GetTraceID(ctx)
 }
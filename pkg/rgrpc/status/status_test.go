@@ -0,0 +1,52 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+)
+
+func TestNewStatusFromErrType(t *testing.T) {
+	tests := []struct {
+		err  error
+		code rpc.Code
+	}{
+		{nil, rpc.Code_CODE_OK},
+		{errtypes.NotFound("file.txt"), rpc.Code_CODE_NOT_FOUND},
+		{errtypes.PermissionDenied("file.txt"), rpc.Code_CODE_PERMISSION_DENIED},
+		{errtypes.AlreadyExists("file.txt"), rpc.Code_CODE_ALREADY_EXISTS},
+		{errtypes.NotSupported("versions"), rpc.Code_CODE_UNIMPLEMENTED},
+		{errtypes.InvalidCredentials("einstein"), rpc.Code_CODE_UNAUTHENTICATED},
+		{errtypes.Locked("file.txt"), rpc.Code_CODE_FAILED_PRECONDITION},
+		{errors.Wrap(errtypes.NotFound("file.txt"), "local: error stating"), rpc.Code_CODE_NOT_FOUND},
+		{fmt.Errorf("eos: %w", errtypes.PermissionDenied("file.txt")), rpc.Code_CODE_PERMISSION_DENIED},
+		{errors.New("disk on fire"), rpc.Code_CODE_INTERNAL},
+	}
+	for _, tt := range tests {
+		if st := NewStatusFromErrType(context.Background(), "error", tt.err); st.Code != tt.code {
+			t.Errorf("NewStatusFromErrType(%v) = %s, want %s", tt.err, st.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,487 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package pool
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/metrics"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+)
+
+// The clients generated for the CS3 APIs take a *grpc.ClientConn, so the
+// clients handed out by the pool are built on a handle connection per
+// endpoint that never connects: its interceptors forward the calls to the
+// pooled connection of the endpoint. This way the pooled connections can be
+// closed when idle, evicted and redialed while the callers keep their
+// clients.
+
+// Config configures the connection pool.
+type Config struct {
+	// MaxConns is the maximum number of open connections, 0 means no
+	// limit. When it is reached the least recently used idle connection is
+	// closed.
+	MaxConns int `mapstructure:"max_conns"`
+	// IdleTimeout is the time in seconds after which connections without
+	// calls are closed, 0 means never.
+	IdleTimeout int `mapstructure:"idle_timeout"`
+	// HealthCheckInterval is the time in seconds between the checks of
+	// the connections, which reconnect the broken ones.
+	HealthCheckInterval int `mapstructure:"health_check_interval"`
+	// BackoffBaseDelay and BackoffMaxDelay bound in seconds the backoff
+	// between reconnection attempts.
+	BackoffBaseDelay int `mapstructure:"backoff_base_delay"`
+	BackoffMaxDelay  int `mapstructure:"backoff_max_delay"`
+	// MaxRecvMsgSize and MaxSendMsgSize bound in bytes the messages
+	// received and sent by the clients. The responses listing large
+	// directories easily exceed the 4MB received by default.
+	MaxRecvMsgSize int `mapstructure:"max_recv_msg_size"`
+	MaxSendMsgSize int `mapstructure:"max_send_msg_size"`
+	// MaxAttempts is the number of times the idempotent methods are
+	// called before giving up, 1 means no retries. The attempts are
+	// separated by an exponential backoff between RetryBaseDelay and
+	// RetryMaxDelay milliseconds.
+	MaxAttempts    int `mapstructure:"max_attempts"`
+	RetryBaseDelay int `mapstructure:"retry_base_delay"`
+	RetryMaxDelay  int `mapstructure:"retry_max_delay"`
+	// RetryCodes are the gRPC codes of the transient failures, which are
+	// retried and counted by the circuit breakers.
+	RetryCodes []string `mapstructure:"retry_codes"`
+	// IdempotentMethods are the names, or prefixes of the names, of the
+	// methods safe to call more than once, like Stat or ListContainer.
+	// Full method names like /cs3.gateway.v1beta1.GatewayAPI/Stat are
+	// matched exactly.
+	IdempotentMethods []string `mapstructure:"idempotent_methods"`
+	// HedgeDelay is the time in milliseconds after which a second call
+	// of an idempotent method is sent if the first one did not complete,
+	// the first response wins. 0 disables hedging.
+	HedgeDelay int `mapstructure:"hedge_delay"`
+	// BreakerThreshold is the number of consecutive transient failures
+	// after which the calls to an endpoint fail immediately for
+	// BreakerTimeout seconds, before a single call probes the endpoint
+	// again. 0 disables the circuit breakers.
+	BreakerThreshold int `mapstructure:"breaker_threshold"`
+	BreakerTimeout   int `mapstructure:"breaker_timeout"`
+
+	retryCodes map[codes.Code]bool
+}
+
+func (c *Config) init() {
+	if c.IdleTimeout < 0 {
+		c.IdleTimeout = 0
+	}
+	if c.HealthCheckInterval <= 0 {
+		c.HealthCheckInterval = 10
+	}
+	if c.BackoffBaseDelay <= 0 {
+		c.BackoffBaseDelay = 1
+	}
+	if c.BackoffMaxDelay <= 0 {
+		c.BackoffMaxDelay = 120
+	}
+	if c.MaxRecvMsgSize <= 0 {
+		c.MaxRecvMsgSize = 64 * 1024 * 1024
+	}
+	if c.MaxSendMsgSize <= 0 {
+		c.MaxSendMsgSize = math.MaxInt32
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 1
+	}
+	if c.RetryBaseDelay <= 0 {
+		c.RetryBaseDelay = 100
+	}
+	if c.RetryMaxDelay <= 0 {
+		c.RetryMaxDelay = 2000
+	}
+	if len(c.RetryCodes) == 0 {
+		c.RetryCodes = []string{"UNAVAILABLE"}
+	}
+	if len(c.IdempotentMethods) == 0 {
+		c.IdempotentMethods = defaultIdempotentMethods
+	}
+	if c.BreakerTimeout <= 0 {
+		c.BreakerTimeout = 30
+	}
+}
+
+var conns = newConnPool()
+
+// Configure sets the configuration of the connection pool. It must be
+// called before the first client is requested.
+func Configure(m map[string]interface{}) error {
+	c := &Config{IdleTimeout: 300}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return errors.Wrap(err, "pool: error decoding conf")
+	}
+	c.init()
+	if err := c.parseRetryCodes(); err != nil {
+		return err
+	}
+
+	conns.mu.Lock()
+	defer conns.mu.Unlock()
+	if len(conns.entries) > 0 {
+		return errors.New("pool: already in use")
+	}
+	conns.c = c
+	return nil
+}
+
+type connPool struct {
+	mu      sync.Mutex
+	c       *Config
+	entries map[string]*entry
+	once    sync.Once
+}
+
+// entry holds the pooled connection of an endpoint.
+type entry struct {
+	p        *connPool
+	endpoint string
+	handle   *grpc.ClientConn
+
+	mu       sync.Mutex
+	cc       *grpc.ClientConn // nil when closed
+	lastUsed time.Time
+	inFlight int64
+
+	breaker breaker
+}
+
+func newConnPool() *connPool {
+	c := &Config{IdleTimeout: 300}
+	c.init()
+	_ = c.parseRetryCodes()
+	return &connPool{c: c, entries: map[string]*entry{}}
+}
+
+// getConn returns the handle connection of the endpoint.
+func (p *connPool) getConn(endpoint string) (*grpc.ClientConn, error) {
+	p.once.Do(func() { go p.check() })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.entries[endpoint]; ok {
+		return e.handle, nil
+	}
+
+	e := &entry{p: p, endpoint: endpoint}
+	handle, err := grpc.Dial(
+		handleScheme+":///"+endpoint,
+		grpc.WithInsecure(),
+		grpc.WithResolvers(handleResolver{}),
+		grpc.WithUnaryInterceptor(e.invoke),
+		grpc.WithStreamInterceptor(e.newStream),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "pool: error creating connection for "+endpoint)
+	}
+	e.handle = handle
+	p.entries[endpoint] = e
+	return handle, nil
+}
+
+// acquire returns the pooled connection, dialing it if needed, and counts a
+// call in flight on it until release is called.
+func (e *entry) acquire() (*grpc.ClientConn, error) {
+	e.mu.Lock()
+	dialed := false
+	if e.cc == nil || e.cc.GetState() == connectivity.Shutdown {
+		cc, err := e.p.dial(e.endpoint)
+		if err != nil {
+			e.mu.Unlock()
+			return nil, err
+		}
+		e.cc = cc
+		dialed = true
+	}
+	cc := e.cc
+	e.inFlight++
+	e.lastUsed = time.Now()
+	e.mu.Unlock()
+
+	if dialed {
+		e.p.evict(e)
+	}
+	return cc, nil
+}
+
+func (e *entry) release() {
+	e.mu.Lock()
+	e.inFlight--
+	e.lastUsed = time.Now()
+	e.mu.Unlock()
+}
+
+func (e *entry) invoke(ctx context.Context, method string, req, reply interface{}, _ *grpc.ClientConn, _ grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c := e.p.config()
+	if !c.idempotent(method) {
+		return e.call(ctx, c, method, req, reply, opts...)
+	}
+	return e.retry(ctx, c, method, req, reply, opts...)
+}
+
+// call invokes the method once on the pooled connection, unless the circuit
+// breaker of the endpoint is open.
+func (e *entry) call(ctx context.Context, c *Config, method string, req, reply interface{}, opts ...grpc.CallOption) error {
+	if !e.breaker.allow(c, time.Now()) {
+		return errBreakerOpen
+	}
+	cc, err := e.acquire()
+	if err != nil {
+		e.breaker.done(c, time.Now(), true)
+		return err
+	}
+	defer e.release()
+	err = cc.Invoke(ctx, method, req, reply, opts...)
+	e.breaker.done(c, time.Now(), c.transient(err))
+	return err
+}
+
+func (e *entry) newStream(ctx context.Context, desc *grpc.StreamDesc, _ *grpc.ClientConn, method string, _ grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	cc, err := e.acquire()
+	if err != nil {
+		return nil, err
+	}
+	s, err := cc.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		e.release()
+		return nil, err
+	}
+	st := &stream{ClientStream: s, e: e, desc: desc, done: make(chan struct{})}
+	// streams abandoned by the caller end with their context
+	go func() {
+		select {
+		case <-ctx.Done():
+			st.end()
+		case <-st.done:
+		}
+	}()
+	return st, nil
+}
+
+// stream releases the connection when the stream ends: when a message
+// cannot be sent or received, when the single response of a stream
+// without server streaming is received, or when its context is done.
+type stream struct {
+	grpc.ClientStream
+	e    *entry
+	desc *grpc.StreamDesc
+	once sync.Once
+	done chan struct{}
+}
+
+func (s *stream) end() {
+	s.once.Do(func() {
+		s.e.release()
+		close(s.done)
+	})
+}
+
+func (s *stream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err != nil {
+		s.end()
+	}
+	return err
+}
+
+func (s *stream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.end()
+	}
+	return err
+}
+
+func (s *stream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.desc.ServerStreams {
+		s.end()
+	}
+	return err
+}
+
+// dial opens a connection to the endpoint.
+func (p *connPool) dial(endpoint string) (*grpc.ClientConn, error) {
+	ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.KeyEndpoint, endpoint))
+	stats.Record(ctx, metrics.GRPCPoolDials.M(1))
+	return NewConn(endpoint)
+}
+
+func (p *connPool) config() *Config {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.c
+}
+
+func (p *connPool) snapshot() []*entry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := make([]*entry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// evict closes the least recently used idle connections, other than the one
+// of keep, while there are more open connections than allowed.
+func (p *connPool) evict(keep *entry) {
+	max := p.config().MaxConns
+	if max <= 0 {
+		return
+	}
+
+	type candidate struct {
+		e        *entry
+		lastUsed time.Time
+	}
+	var open int
+	var idle []candidate
+	for _, e := range p.snapshot() {
+		e.mu.Lock()
+		if e.cc != nil {
+			open++
+			if e != keep && e.inFlight == 0 {
+				idle = append(idle, candidate{e, e.lastUsed})
+			}
+		}
+		e.mu.Unlock()
+	}
+
+	sort.Slice(idle, func(i, j int) bool { return idle[i].lastUsed.Before(idle[j].lastUsed) })
+	for _, c := range idle {
+		if open <= max {
+			return
+		}
+		if c.e.closeIf(func(e *entry) bool { return e.inFlight == 0 }) {
+			open--
+		}
+	}
+}
+
+// closeIf closes the connection if it is open and cond holds.
+func (e *entry) closeIf(cond func(*entry) bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cc == nil || !cond(e) {
+		return false
+	}
+	_ = e.cc.Close()
+	e.cc = nil
+	return true
+}
+
+// check periodically closes the idle connections, reconnects the broken
+// ones and records the state of the pool.
+func (p *connPool) check() {
+	t := time.NewTicker(time.Duration(p.config().HealthCheckInterval) * time.Second)
+	defer t.Stop()
+	for range t.C {
+		p.checkOnce(time.Now())
+	}
+}
+
+func (p *connPool) checkOnce(now time.Time) {
+	idleTimeout := time.Duration(p.config().IdleTimeout) * time.Second
+	for _, e := range p.snapshot() {
+		if idleTimeout > 0 {
+			e.closeIf(func(e *entry) bool {
+				return e.inFlight == 0 && now.Sub(e.lastUsed) > idleTimeout
+			})
+		}
+
+		e.mu.Lock()
+		states := map[connectivity.State]int64{}
+		if e.cc != nil {
+			switch state := e.cc.GetState(); state {
+			case connectivity.Shutdown:
+				e.cc = nil
+			case connectivity.Idle:
+				// the connection was lost, reconnect before the next call
+				e.cc.Connect()
+				states[state]++
+			case connectivity.TransientFailure:
+				// grpc reconnects with backoff, start over if the
+				// endpoint was down for a while
+				e.cc.ResetConnectBackoff()
+				states[state]++
+			default:
+				states[state]++
+			}
+		}
+		inFlight := e.inFlight
+		e.mu.Unlock()
+
+		ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.KeyEndpoint, e.endpoint))
+		for _, state := range []connectivity.State{connectivity.Idle, connectivity.Connecting, connectivity.Ready, connectivity.TransientFailure} {
+			sctx, _ := tag.New(ctx, tag.Upsert(metrics.KeyState, state.String()))
+			stats.Record(sctx, metrics.GRPCPoolConns.M(states[state]))
+		}
+		stats.Record(ctx, metrics.GRPCPoolInFlight.M(inFlight))
+	}
+}
+
+const handleScheme = "reva-pool"
+
+// handleResolver resolves the targets of the handle connections to no
+// address, so they never connect.
+type handleResolver struct{}
+
+func (handleResolver) Build(resolver.Target, resolver.ClientConn, resolver.BuildOptions) (resolver.Resolver, error) {
+	return handleResolver{}, nil
+}
+
+func (handleResolver) Scheme() string                        { return handleScheme }
+func (handleResolver) ResolveNow(resolver.ResolveNowOptions) {}
+func (handleResolver) Close()                                {}
+
+// dialOptions returns the options of the pooled connections.
+func (c *Config) dialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  time.Duration(c.BackoffBaseDelay) * time.Second,
+				Multiplier: backoff.DefaultConfig.Multiplier,
+				Jitter:     backoff.DefaultConfig.Jitter,
+				MaxDelay:   time.Duration(c.BackoffMaxDelay) * time.Second,
+			},
+			MinConnectTimeout: 20 * time.Second,
+		}),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(c.MaxRecvMsgSize),
+			grpc.MaxCallSendMsgSize(c.MaxSendMsgSize),
+		),
+	}
+}
@@ -32,29 +32,27 @@ import (
 	storageprovider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	storageregistry "github.com/cs3org/go-cs3apis/cs3/storage/registry/v1beta1"
 
+	// register the resolver of the discovery:/// endpoints
+	_ "github.com/cs3org/reva/pkg/discovery"
+	"github.com/cs3org/reva/pkg/ocm/share/received"
+	"github.com/cs3org/reva/pkg/storage/jobs"
+	"github.com/cs3org/reva/pkg/trace"
+	"github.com/cs3org/reva/pkg/user/provisioning"
 	"go.opencensus.io/plugin/ocgrpc"
 	"google.golang.org/grpc"
 )
 
-// TODO(labkode): is concurrent access to the maps safe?
-var storageProviders = map[string]storageprovider.ProviderAPIClient{}
-var authProviders = map[string]authprovider.ProviderAPIClient{}
-var authRegistries = map[string]authregistry.RegistryAPIClient{}
-var userShareProviders = map[string]collaboration.CollaborationAPIClient{}
-var ocmShareProviders = map[string]ocm.OcmAPIClient{}
-var publicShareProviders = map[string]link.LinkAPIClient{}
-var preferencesProviders = map[string]preferences.PreferencesAPIClient{}
-var appRegistries = map[string]appregistry.RegistryAPIClient{}
-var appProviders = map[string]appprovider.ProviderAPIClient{}
-var storageRegistries = map[string]storageregistry.RegistryAPIClient{}
-var gatewayProviders = map[string]gateway.GatewayAPIClient{}
-var userProviders = map[string]user.UserAPIClient{}
-
 // NewConn creates a new connection to a grpc server
-// with open census tracing support.
+// with opentelemetry tracing support.
 // TODO(labkode): make grpc tls configurable.
 func NewConn(endpoint string) (*grpc.ClientConn, error) {
-	conn, err := grpc.Dial(endpoint, grpc.WithInsecure(), grpc.WithStatsHandler(&ocgrpc.ClientHandler{}))
+	opts := append([]grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithStatsHandler(&ocgrpc.ClientHandler{}),
+		grpc.WithUnaryInterceptor(trace.NewUnaryClient()),
+		grpc.WithStreamInterceptor(trace.NewStreamClient()),
+	}, conns.config().dialOptions()...)
+	conn, err := grpc.Dial(endpoint, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -64,191 +62,138 @@ func NewConn(endpoint string) (*grpc.ClientConn, error) {
 
 // GetGatewayServiceClient returns a GatewayServiceClient.
 func GetGatewayServiceClient(endpoint string) (gateway.GatewayAPIClient, error) {
-	if val, ok := gatewayProviders[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	gatewayProviders[endpoint] = gateway.NewGatewayAPIClient(conn)
-
-	return gatewayProviders[endpoint], nil
+	return gateway.NewGatewayAPIClient(conn), nil
 }
 
 // GetUserProviderServiceClient returns a UserProviderServiceClient.
 func GetUserProviderServiceClient(endpoint string) (user.UserAPIClient, error) {
-	if val, ok := userProviders[endpoint]; ok {
-		return val, nil
+	conn, err := conns.getConn(endpoint)
+	if err != nil {
+		return nil, err
 	}
+	return user.NewUserAPIClient(conn), nil
+}
 
-	conn, err := NewConn(endpoint)
+// GetUserProvisioningClient returns a client of the provisioning API of the
+// userprovider service.
+func GetUserProvisioningClient(endpoint string) (*provisioning.Client, error) {
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
+	return provisioning.NewClient(conn), nil
+}
 
-	userProviders[endpoint] = user.NewUserAPIClient(conn)
-	return userProviders[endpoint], nil
+// GetJobsClient returns a client of the API of the jobmanager service, also
+// served by the gateway.
+func GetJobsClient(endpoint string) (*jobs.Client, error) {
+	conn, err := conns.getConn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return jobs.NewClient(conn), nil
 }
 
 // GetStorageProviderServiceClient returns a StorageProviderServiceClient.
 func GetStorageProviderServiceClient(endpoint string) (storageprovider.ProviderAPIClient, error) {
-	if val, ok := storageProviders[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	storageProviders[endpoint] = storageprovider.NewProviderAPIClient(conn)
-
-	return storageProviders[endpoint], nil
+	return storageprovider.NewProviderAPIClient(conn), nil
 }
 
 // GetAuthRegistryServiceClient returns a new AuthRegistryServiceClient.
 func GetAuthRegistryServiceClient(endpoint string) (authregistry.RegistryAPIClient, error) {
-	if val, ok := authRegistries[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	authRegistries[endpoint] = authregistry.NewRegistryAPIClient(conn)
-
-	return authRegistries[endpoint], nil
+	return authregistry.NewRegistryAPIClient(conn), nil
 }
 
 // GetAuthProviderServiceClient returns a new AuthProviderServiceClient.
 func GetAuthProviderServiceClient(endpoint string) (authprovider.ProviderAPIClient, error) {
-	if val, ok := authProviders[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	authProviders[endpoint] = authprovider.NewProviderAPIClient(conn)
-
-	return authProviders[endpoint], nil
+	return authprovider.NewProviderAPIClient(conn), nil
 }
 
 // GetUserShareProviderClient returns a new UserShareProviderClient.
 func GetUserShareProviderClient(endpoint string) (collaboration.CollaborationAPIClient, error) {
-	if val, ok := userShareProviders[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	userShareProviders[endpoint] = collaboration.NewCollaborationAPIClient(conn)
-
-	return userShareProviders[endpoint], nil
+	return collaboration.NewCollaborationAPIClient(conn), nil
 }
 
 // GetOCMShareProviderClient returns a new OCMShareProviderClient.
 func GetOCMShareProviderClient(endpoint string) (ocm.OcmAPIClient, error) {
-	if val, ok := ocmShareProviders[endpoint]; ok {
-		return val, nil
+	conn, err := conns.getConn(endpoint)
+	if err != nil {
+		return nil, err
 	}
+	return ocm.NewOcmAPIClient(conn), nil
+}
 
-	conn, err := NewConn(endpoint)
+// GetOCMReceivedShareClient returns a client of the received shares API of
+// the ocmshareprovider service, authenticated with the secret.
+func GetOCMReceivedShareClient(endpoint, secret string) (*received.Client, error) {
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	ocmShareProviders[endpoint] = ocm.NewOcmAPIClient(conn)
-
-	return ocmShareProviders[endpoint], nil
+	return received.NewClient(conn, secret), nil
 }
 
 // GetPublicShareProviderClient returns a new PublicShareProviderClient.
 func GetPublicShareProviderClient(endpoint string) (link.LinkAPIClient, error) {
-	if val, ok := publicShareProviders[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	publicShareProviders[endpoint] = link.NewLinkAPIClient(conn)
-
-	return publicShareProviders[endpoint], nil
+	return link.NewLinkAPIClient(conn), nil
 }
 
 // GetPreferencesClient returns a new PreferencesClient.
 func GetPreferencesClient(endpoint string) (preferences.PreferencesAPIClient, error) {
-	if val, ok := preferencesProviders[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	preferencesProviders[endpoint] = preferences.NewPreferencesAPIClient(conn)
-
-	return preferencesProviders[endpoint], nil
+	return preferences.NewPreferencesAPIClient(conn), nil
 }
 
 // GetAppRegistryClient returns a new AppRegistryClient.
 func GetAppRegistryClient(endpoint string) (appregistry.RegistryAPIClient, error) {
-	if val, ok := appRegistries[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	appRegistries[endpoint] = appregistry.NewRegistryAPIClient(conn)
-
-	return appRegistries[endpoint], nil
+	return appregistry.NewRegistryAPIClient(conn), nil
 }
 
 // GetAppProviderClient returns a new AppRegistryClient.
 func GetAppProviderClient(endpoint string) (appprovider.ProviderAPIClient, error) {
-	if val, ok := appProviders[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	appProviders[endpoint] = appprovider.NewProviderAPIClient(conn)
-
-	return appProviders[endpoint], nil
+	return appprovider.NewProviderAPIClient(conn), nil
 }
 
 // GetStorageRegistryClient returns a new StorageRegistryClient.
 func GetStorageRegistryClient(endpoint string) (storageregistry.RegistryAPIClient, error) {
-	if val, ok := storageRegistries[endpoint]; ok {
-		return val, nil
-	}
-
-	conn, err := NewConn(endpoint)
+	conn, err := conns.getConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
-
-	storageRegistries[endpoint] = storageregistry.NewRegistryAPIClient(conn)
-
-	return storageRegistries[endpoint], nil
+	return storageregistry.NewRegistryAPIClient(conn), nil
 }
@@ -0,0 +1,271 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package pool
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func startServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+	return l.Addr().String()
+}
+
+// call invokes an unknown method, an Unimplemented error means the server
+// was reached.
+func call(t *testing.T, cc *grpc.ClientConn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := cc.Invoke(ctx, "/test.Test/Test", &struct{}{}, &struct{}{}, grpc.ForceCodec(nopCodec{}))
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+type nopCodec struct{}
+
+func (nopCodec) Marshal(v interface{}) ([]byte, error)      { return nil, nil }
+func (nopCodec) Unmarshal(data []byte, v interface{}) error { return nil }
+func (nopCodec) Name() string                               { return "nop" }
+
+func open(p *connPool) int {
+	n := 0
+	for _, e := range p.snapshot() {
+		e.mu.Lock()
+		if e.cc != nil {
+			n++
+		}
+		e.mu.Unlock()
+	}
+	return n
+}
+
+func TestPool(t *testing.T) {
+	c := &Config{MaxConns: 1, IdleTimeout: 60}
+	c.init()
+	p := &connPool{c: c, entries: map[string]*entry{}}
+	p.once.Do(func() {}) // no background checks
+
+	addr1, addr2 := startServer(t), startServer(t)
+
+	h1, err := p.getConn(addr1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := p.getConn(addr1); h != h1 {
+		t.Error("expected the connection to be reused")
+	}
+	call(t, h1)
+
+	h2, err := p.getConn(addr2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call(t, h2)
+	if n := open(p); n != 1 {
+		t.Errorf("%d open connections, wanted 1", n)
+	}
+
+	// the evicted connection is redialed
+	call(t, h1)
+	if n := open(p); n != 1 {
+		t.Errorf("%d open connections, wanted 1", n)
+	}
+
+	p.checkOnce(time.Now())
+	if n := open(p); n != 1 {
+		t.Errorf("%d open connections after check, wanted 1", n)
+	}
+	p.checkOnce(time.Now().Add(2 * time.Minute))
+	if n := open(p); n != 0 {
+		t.Errorf("%d open connections after idle timeout, wanted 0", n)
+	}
+	call(t, h1)
+}
+
+func inFlight(p *connPool) int64 {
+	var n int64
+	for _, e := range p.snapshot() {
+		e.mu.Lock()
+		n += e.inFlight
+		e.mu.Unlock()
+	}
+	return n
+}
+
+func TestStreamRelease(t *testing.T) {
+	p := newTestPool(&Config{})
+	addr, _ := startFlakyServer(t, 0, nil)
+	cc, err := p.getConn(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverStreams := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+
+	// a stream whose response is received
+	s, err := cc.NewStream(context.Background(), &grpc.StreamDesc{ClientStreams: true}, "/test.Test/Test", grpc.ForceCodec(nopCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecvMsg(&struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := inFlight(p); n != 0 {
+		t.Errorf("%d calls in flight after the response, wanted 0", n)
+	}
+
+	// a stream abandoned by the caller
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := cc.NewStream(ctx, serverStreams, "/test.Test/Test", grpc.ForceCodec(nopCodec{})); err != nil {
+		t.Fatal(err)
+	}
+	if n := inFlight(p); n != 1 {
+		t.Errorf("%d calls in flight, wanted 1", n)
+	}
+	cancel()
+	for i := 0; inFlight(p) != 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := inFlight(p); n != 0 {
+		t.Errorf("%d calls in flight after the cancellation, wanted 0", n)
+	}
+}
+
+// startFlakyServer starts a server whose methods fail as unavailable the
+// first failures times, the calls are counted in calls.
+func startFlakyServer(t *testing.T, failures int32, delay func(call int32) time.Duration) (string, *int32) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	s := grpc.NewServer(grpc.ForceServerCodec(nopCodec{}), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		n := atomic.AddInt32(&calls, 1)
+		if delay != nil {
+			time.Sleep(delay(n))
+		}
+		if n <= failures {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return stream.SendMsg(&struct{}{})
+	}))
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+	return l.Addr().String(), &calls
+}
+
+func newTestPool(c *Config) *connPool {
+	c.init()
+	_ = c.parseRetryCodes()
+	p := &connPool{c: c, entries: map[string]*entry{}}
+	p.once.Do(func() {}) // no background checks
+	return p
+}
+
+func invoke(t *testing.T, p *connPool, addr, method string) error {
+	cc, err := p.getConn(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return cc.Invoke(ctx, method, &struct{}{}, &struct{}{}, grpc.ForceCodec(nopCodec{}))
+}
+
+func TestRetry(t *testing.T) {
+	p := newTestPool(&Config{MaxAttempts: 3, RetryBaseDelay: 1})
+
+	addr, calls := startFlakyServer(t, 2, nil)
+	if err := invoke(t, p, addr, "/test.Test/GetTest"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := atomic.LoadInt32(calls); n != 3 {
+		t.Errorf("%d calls, wanted 3", n)
+	}
+
+	// the methods that are not idempotent are called once
+	addr, calls = startFlakyServer(t, 2, nil)
+	if err := invoke(t, p, addr, "/test.Test/CreateTest"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("%d calls, wanted 1", n)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	p := newTestPool(&Config{BreakerThreshold: 2, BreakerTimeout: 60})
+
+	addr, calls := startFlakyServer(t, 100, nil)
+	for i := 0; i < 3; i++ {
+		if err := invoke(t, p, addr, "/test.Test/GetTest"); status.Code(err) != codes.Unavailable {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("%d calls, wanted 2", n)
+	}
+
+	// after the timeout a call probes the endpoint
+	e := p.entries[addr]
+	e.breaker.openUntil = time.Now()
+	_ = invoke(t, p, addr, "/test.Test/GetTest")
+	if n := atomic.LoadInt32(calls); n != 3 {
+		t.Errorf("%d calls, wanted 3", n)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	p := newTestPool(&Config{HedgeDelay: 50})
+
+	// the first call hangs, the hedged one answers
+	addr, calls := startFlakyServer(t, 0, func(n int32) time.Duration {
+		if n == 1 {
+			return 2 * time.Second
+		}
+		return 0
+	})
+	start := time.Now()
+	if err := invoke(t, p, addr, "/test.Test/StatTest"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("hedged call took %s", d)
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("%d calls, wanted 2", n)
+	}
+}
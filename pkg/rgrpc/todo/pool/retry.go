@@ -0,0 +1,210 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package pool
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/metrics"
+	"github.com/pkg/errors"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultIdempotentMethods are the prefixes of the names of the CS3 methods
+// that only read.
+var defaultIdempotentMethods = []string{"Get", "List", "Stat", "Find", "WhoAmI", "InitiateFileDownload"}
+
+// errBreakerOpen is returned by the calls to endpoints whose circuit breaker
+// is open.
+var errBreakerOpen = status.Error(codes.Unavailable, "pool: circuit breaker open")
+
+func (c *Config) parseRetryCodes() error {
+	c.retryCodes = map[codes.Code]bool{}
+	for _, name := range c.RetryCodes {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err != nil {
+			return errors.Wrap(err, "pool: invalid retry code "+name)
+		}
+		c.retryCodes[code] = true
+	}
+	return nil
+}
+
+// idempotent tells whether the method is safe to call more than once.
+func (c *Config) idempotent(method string) bool {
+	name := method[strings.LastIndex(method, "/")+1:]
+	for _, m := range c.IdempotentMethods {
+		if strings.HasPrefix(m, "/") {
+			if m == method {
+				return true
+			}
+		} else if strings.HasPrefix(name, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// transient tells whether the error is a transient failure of the endpoint.
+func (c *Config) transient(err error) bool {
+	return err != nil && err != errBreakerOpen && c.retryCodes[status.Code(err)]
+}
+
+// retryDelay returns the backoff before the attempt, counted from 1.
+func (c *Config) retryDelay(attempt int) time.Duration {
+	d := time.Duration(c.RetryBaseDelay) * time.Millisecond
+	max := time.Duration(c.RetryMaxDelay) * time.Millisecond
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// retry calls an idempotent method until it succeeds, fails with an error
+// that is not transient or runs out of attempts.
+func (e *entry) retry(ctx context.Context, c *Config, method string, req, reply interface{}, opts ...grpc.CallOption) error {
+	var err error
+	for attempt := 0; attempt < c.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(c.retryDelay(attempt))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			case <-t.C:
+			}
+			e.record(metrics.GRPCPoolRetries)
+		}
+		err = e.hedge(ctx, c, method, req, reply, opts...)
+		if !c.transient(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// hedge calls the method and, if it did not complete after the hedge delay,
+// calls it a second time. The first successful response is kept.
+func (e *entry) hedge(ctx context.Context, c *Config, method string, req, reply interface{}, opts ...grpc.CallOption) error {
+	if c.HedgeDelay <= 0 {
+		return e.call(ctx, c, method, req, reply, opts...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	// the calls must not share the reply, each gets its own
+	results := make(chan result, 2)
+	send := func() {
+		r := reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+		results <- result{r, e.call(ctx, c, method, req, r, opts...)}
+	}
+
+	go send()
+	pending := 1
+	t := time.NewTimer(time.Duration(c.HedgeDelay) * time.Millisecond)
+	defer t.Stop()
+	hedge := t.C
+
+	var res result
+	for pending > 0 {
+		select {
+		case <-hedge:
+			hedge = nil
+			pending++
+			e.record(metrics.GRPCPoolHedges)
+			go send()
+		case res = <-results:
+			pending--
+			if res.err == nil {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(res.reply).Elem())
+				return nil
+			}
+			if !c.transient(res.err) {
+				return res.err
+			}
+		}
+	}
+	return res.err
+}
+
+func (e *entry) record(m *stats.Int64Measure) {
+	ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.KeyEndpoint, e.endpoint))
+	stats.Record(ctx, m.M(1))
+}
+
+// breaker is the circuit breaker of an endpoint. It opens after
+// BreakerThreshold consecutive transient failures and rejects the calls
+// until BreakerTimeout has passed, then lets a single call through: the
+// breaker closes if it succeeds and opens again otherwise.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *breaker) allow(c *Config, now time.Time) bool {
+	if c.BreakerThreshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < c.BreakerThreshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) done(c *Config, now time.Time, failed bool) {
+	if c.BreakerThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= c.BreakerThreshold {
+		b.openUntil = now.Add(time.Duration(c.BreakerTimeout) * time.Second)
+	}
+}
@@ -25,17 +25,17 @@ import (
 	"time"
 
 	"github.com/cs3org/reva/pkg/token"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/pkg/errors"
-	"go.opencensus.io/plugin/ochttp"
 )
 
-// GetHTTPClient returns an http client with open census tracing support.
+// GetHTTPClient returns an http client with opentelemetry tracing support.
 // TODO(labkode): harden it.
 // https://medium.com/@nate510/don-t-use-go-s-default-http-client-4804cb19f779
 func GetHTTPClient(ctx context.Context) *http.Client {
 	httpClient := &http.Client{
 		Timeout:   time.Second * 10,
-		Transport: &ochttp.Transport{},
+		Transport: trace.Transport(http.DefaultTransport),
 	}
 	return httpClient
 }
@@ -0,0 +1,45 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package clientip finds the address of the client of an HTTP request, for
+// the middlewares limiting, logging and auditing the requests per client.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Get returns the address of the client of the request. When
+// trustForwardedFor is set, reva runs behind a proxy appending the address
+// of its client to the X-Forwarded-For header: only the last entry is taken,
+// the previous ones are set by the client and can be forged.
+func Get(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		fwd := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+		if ip := strings.TrimSpace(fwd[len(fwd)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,54 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		trust     bool
+		want      string
+	}{
+		{"remote address", nil, false, "192.0.2.1"},
+		{"forwarded for ignored", []string{"198.51.100.7"}, false, "192.0.2.1"},
+		{"no forwarded for", nil, true, "192.0.2.1"},
+		{"single hop", []string{"198.51.100.7"}, true, "198.51.100.7"},
+		{"forged entries", []string{"203.0.113.9, 198.51.100.7"}, true, "198.51.100.7"},
+		{"several headers", []string{"203.0.113.9", "198.51.100.7"}, true, "198.51.100.7"},
+		{"empty last entry", []string{"203.0.113.9,"}, true, "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "192.0.2.1:4242"
+			for _, f := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			if got := Get(r, tt.trust); got != tt.want {
+				t.Errorf("Get() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
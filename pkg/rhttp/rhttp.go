@@ -20,23 +20,31 @@ package rhttp
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"path"
+	"reflect"
 	"sort"
+	"sync"
 	"time"
 
+	"github.com/cs3org/reva/internal/http/interceptors/accesslog"
 	"github.com/cs3org/reva/internal/http/interceptors/appctx"
 	"github.com/cs3org/reva/internal/http/interceptors/auth"
 	"github.com/cs3org/reva/internal/http/interceptors/log"
+	"github.com/cs3org/reva/internal/http/interceptors/metrics"
+	"github.com/cs3org/reva/pkg/health"
 	"github.com/cs3org/reva/pkg/rhttp/global"
 	"github.com/cs3org/reva/pkg/rhttp/router"
+	"github.com/cs3org/reva/pkg/trace"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"go.opencensus.io/plugin/ochttp"
-	"go.opencensus.io/trace"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // New returns a new server
@@ -55,9 +63,14 @@ func New(m interface{}, l zerolog.Logger) (*Server, error) {
 		conf.Address = "localhost:9998"
 	}
 
-	httpServer := &http.Server{}
+	// the requests in flight are canceled when the server is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	httpServer := &http.Server{
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
 	s := &Server{
 		httpServer:  httpServer,
+		cancel:      cancel,
 		conf:        conf,
 		svcs:        map[string]global.Service{},
 		unprotected: []string{},
@@ -72,11 +85,34 @@ type Server struct {
 	httpServer  *http.Server
 	conf        *config
 	listener    net.Listener
-	svcs        map[string]global.Service // map key is svc Prefix
+	svcs        map[string]global.Service // map key is svc name
 	unprotected []string
 	handlers    map[string]http.Handler
 	middlewares []*middlewareTriple
 	log         zerolog.Logger
+	// accessLog is nil if the accesslog middleware is not configured.
+	accessLog *accesslog.Logger
+	// acmeServer serves the http-01 challenges, nil if not configured.
+	acmeServer *http.Server
+
+	mu  sync.RWMutex
+	gen *generation
+
+	// cancel cancels the context of the requests in flight.
+	cancel      context.CancelFunc
+	cleanupOnce sync.Once
+}
+
+// abortTimeout is the time the requests in flight are given to end once
+// they are canceled by Stop, e.g. for the resumable uploads to persist their
+// offset, before their connections are closed.
+const abortTimeout = 5 * time.Second
+
+// generation is the handler chain built from one configuration
+// together with the requests it is still serving.
+type generation struct {
+	handler http.Handler
+	wg      sync.WaitGroup
 }
 
 type config struct {
@@ -84,27 +120,51 @@ type config struct {
 	Address     string                            `mapstructure:"address"`
 	Services    map[string]map[string]interface{} `mapstructure:"services"`
 	Middlewares map[string]map[string]interface{} `mapstructure:"middlewares"`
+	// TLS configures the certificates and the protocols of the server.
+	TLS tlsConf `mapstructure:",squash"`
 }
 
 // Start starts the server
 func (s *Server) Start(ln net.Listener) error {
-	if err := s.registerServices(); err != nil {
+	tc, acm, err := s.conf.TLS.tlsConfig(s.log)
+	if err != nil {
 		return err
 	}
 
-	if err := s.registerMiddlewares(); err != nil {
+	s.mu.Lock()
+	handler, err := s.build(nil)
+	if err != nil {
+		s.mu.Unlock()
 		return err
 	}
+	s.gen = &generation{handler: handler}
+	s.mu.Unlock()
 
-	handler, err := s.getHandler()
-	if err != nil {
-		return errors.Wrap(err, "rhttp: error creating http handler")
+	s.httpServer.Handler = http.HandlerFunc(s.serveHTTP)
+	s.listener = ln
+
+	scheme := "http"
+	if tc != nil {
+		scheme = "https"
+		s.httpServer.TLSConfig = tc
+		if s.conf.TLS.DisableHTTP2 {
+			s.httpServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+		s.listener = tls.NewListener(ln, tc)
+	} else if s.conf.TLS.H2C {
+		s.httpServer.Handler = h2c.NewHandler(s.httpServer.Handler, &http2.Server{})
 	}
 
-	s.httpServer.Handler = handler
-	s.listener = ln
+	if acm != nil && s.conf.TLS.ACME.HTTPAddress != "" {
+		s.acmeServer = &http.Server{Addr: s.conf.TLS.ACME.HTTPAddress, Handler: acm.HTTPHandler(nil)}
+		go func(srv *http.Server) {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.log.Error().Err(err).Msg("rhttp: error serving the acme challenges")
+			}
+		}(s.acmeServer)
+	}
 
-	s.log.Info().Msgf("http server listening at %s://%s", "http", s.conf.Address)
+	s.log.Info().Msgf("http server listening at %s://%s", scheme, s.conf.Address)
 	err = s.httpServer.Serve(s.listener)
 	if err == nil || err == http.ErrServerClosed {
 		return nil
@@ -112,13 +172,143 @@ func (s *Server) Start(ln net.Listener) error {
 	return err
 }
 
-// Stop stops the server.
+// build creates the services, reusing the ones given, and the
+// middlewares and returns the resulting handler chain.
+func (s *Server) build(reuse map[string]global.Service) (http.Handler, error) {
+	if err := s.registerServices(reuse); err != nil {
+		return nil, err
+	}
+
+	if err := s.registerMiddlewares(); err != nil {
+		return nil, err
+	}
+
+	handler, err := s.getHandler()
+	if err != nil {
+		return nil, errors.Wrap(err, "rhttp: error creating http handler")
+	}
+	return handler, nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	g := s.gen
+	g.wg.Add(1)
+	s.mu.RUnlock()
+
+	defer g.wg.Done()
+	g.handler.ServeHTTP(w, r)
+}
+
+// Reload applies a new configuration to the running server without
+// closing the listener. Services whose configuration did not change are
+// kept, the others are created again. Requests in flight finish on the
+// previous handler chain and the replaced services are closed once they
+// have drained. Reload must not be called concurrently.
+func (s *Server) Reload(m interface{}) error {
+	ns, err := New(m, s.log)
+	if err != nil {
+		return errors.Wrap(err, "rhttp: error decoding config")
+	}
+
+	s.mu.RLock()
+	started := s.gen != nil
+	s.mu.RUnlock()
+	if !started {
+		return errors.New("rhttp: server not started")
+	}
+
+	if ns.conf.Network != s.conf.Network || ns.conf.Address != s.conf.Address {
+		return errors.New("rhttp: changing the network address requires a restart")
+	}
+	// the certificates are reloaded when their files change
+	if !reflect.DeepEqual(ns.conf.TLS, s.conf.TLS) {
+		return errors.New("rhttp: changing the tls configuration requires a restart")
+	}
+
+	reuse := map[string]global.Service{}
+	stale := map[string]global.Service{}
+	for name, svc := range s.svcs {
+		if c, ok := ns.conf.Services[name]; ok && reflect.DeepEqual(c, s.conf.Services[name]) {
+			reuse[name] = svc
+			continue
+		}
+		stale[name] = svc
+	}
+
+	handler, err := ns.build(reuse)
+	if err != nil {
+		for name, svc := range ns.svcs {
+			if _, ok := reuse[name]; !ok {
+				_ = svc.Close()
+			}
+		}
+		return err
+	}
+
+	for name := range ns.conf.Services {
+		if _, ok := s.conf.Services[name]; !ok {
+			s.log.Info().Msgf("http service added: %s", name)
+		} else if _, ok := stale[name]; ok {
+			s.log.Info().Msgf("http service changed: %s", name)
+		}
+	}
+	for name := range stale {
+		if _, ok := ns.conf.Services[name]; !ok {
+			health.UnregisterService("http", name)
+			s.log.Info().Msgf("http service removed: %s", name)
+		}
+	}
+	if !reflect.DeepEqual(ns.conf.Middlewares, s.conf.Middlewares) {
+		s.log.Info().Msg("http middlewares changed")
+	}
+
+	s.mu.Lock()
+	old := s.gen
+	oldAccessLog := s.accessLog
+	s.gen = &generation{handler: handler}
+	s.accessLog = ns.accessLog
+	s.conf = ns.conf
+	s.svcs = ns.svcs
+	s.handlers = ns.handlers
+	s.unprotected = ns.unprotected
+	s.middlewares = ns.middlewares
+	s.mu.Unlock()
+
+	go func() {
+		old.wg.Wait()
+		for name, svc := range stale {
+			if err := svc.Close(); err != nil {
+				s.log.Error().Err(err).Msgf("error closing replaced service %q", name)
+			} else {
+				s.log.Info().Msgf("replaced service %q drained and closed", name)
+			}
+		}
+		s.closeAccessLog(oldAccessLog)
+	}()
+	return nil
+}
+
+// Stop stops the server. The requests in flight are canceled and their
+// connections closed once they end or after the abort timeout. It ends a
+// GracefulStop waiting for them.
 func (s *Server) Stop() error {
-	s.closeServices()
-	// TODO(labkode): set ctx deadline to zero
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer s.cleanup()
+	s.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
 	defer cancel()
-	return s.httpServer.Shutdown(ctx)
+	_ = s.httpServer.Shutdown(ctx)
+	return s.httpServer.Close()
+}
+
+// cleanup closes the services, the access log and the acme challenge server
+// once no request uses them anymore.
+func (s *Server) cleanup() {
+	s.cleanupOnce.Do(func() {
+		s.closeServices()
+		s.closeAccessLog(s.accessLog)
+		s.closeACMEServer()
+	})
 }
 
 // TODO(labkode): we can't stop the server shutdown because a service cannot be shutdown.
@@ -134,6 +324,24 @@ func (s *Server) closeServices() {
 	}
 }
 
+func (s *Server) closeAccessLog(l *accesslog.Logger) {
+	if l == nil {
+		return
+	}
+	if err := l.Close(); err != nil {
+		s.log.Error().Err(err).Msg("error closing access log")
+	}
+}
+
+func (s *Server) closeACMEServer() {
+	if s.acmeServer == nil {
+		return
+	}
+	if err := s.acmeServer.Close(); err != nil {
+		s.log.Error().Err(err).Msg("error closing acme challenge server")
+	}
+}
+
 // Network return the network type.
 func (s *Server) Network() string {
 	return s.conf.Network
@@ -144,9 +352,10 @@ func (s *Server) Address() string {
 	return s.conf.Address
 }
 
-// GracefulStop gracefully stops the server.
+// GracefulStop stops accepting connections and waits for the requests in
+// flight to end before closing the services.
 func (s *Server) GracefulStop() error {
-	s.closeServices()
+	defer s.cleanup()
 	return s.httpServer.Shutdown(context.Background())
 }
 
@@ -188,21 +397,26 @@ func (s *Server) isMiddlewareEnabled(name string) bool {
 	return false
 }
 
-func (s *Server) registerServices() error {
+func (s *Server) registerServices(reuse map[string]global.Service) error {
 	for svcName := range s.conf.Services {
 		if s.isServiceEnabled(svcName) {
-			newFunc := global.Services[svcName]
-			svc, err := newFunc(s.conf.Services[svcName])
-			if err != nil {
-				err = errors.Wrapf(err, "http service %s could not be started,", svcName)
-				return err
+			svc, ok := reuse[svcName]
+			if !ok {
+				newFunc := global.Services[svcName]
+				var err error
+				svc, err = newFunc(s.conf.Services[svcName])
+				if err != nil {
+					err = errors.Wrapf(err, "http service %s could not be started,", svcName)
+					return err
+				}
 			}
 
-			// instrument services with opencensus tracing.
-			h := traceHandler(svcName, svc.Handler())
+			// instrument services with opencensus tracing and metrics.
+			h := traceHandler(svcName, metrics.New(svcName)(svc.Handler()))
 			s.handlers[svc.Prefix()] = h
-			s.svcs[svc.Prefix()] = svc
+			s.svcs[svcName] = svc
 			s.unprotected = append(s.unprotected, getUnprotected(svc.Prefix(), svc.Unprotected())...)
+			health.RegisterService("http", svcName, s.conf.Network, s.conf.Address)
 			s.log.Info().Msgf("http service enabled: %s@/%s", svcName, svc.Prefix())
 		} else {
 			message := fmt.Sprintf("http service %s does not exist", svcName)
@@ -224,10 +438,11 @@ func (s *Server) isServiceEnabled(svcName string) bool {
 // TODO(labkode): if the http server is exposed under a basename we need to prepend
 // to prefix.
 func getUnprotected(prefix string, unprotected []string) []string {
-	for i := range unprotected {
-		unprotected[i] = path.Join("/", prefix, unprotected[i])
+	res := make([]string, 0, len(unprotected))
+	for _, u := range unprotected {
+		res = append(res, path.Join("/", prefix, u))
 	}
-	return unprotected
+	return res
 }
 
 func (s *Server) getHandler() (http.Handler, error) {
@@ -259,7 +474,12 @@ func (s *Server) getHandler() (http.Handler, error) {
 
 	handler := http.Handler(h)
 
+	var cors *middlewareTriple
 	for _, triple := range s.middlewares {
+		if triple.Name == "cors" {
+			cors = triple
+			continue
+		}
 		s.log.Info().Msgf("chaining http middleware %s with priority  %d", triple.Name, triple.Priority)
 		handler = triple.Middleware(traceHandler(triple.Name, handler))
 	}
@@ -272,21 +492,41 @@ func (s *Server) getHandler() (http.Handler, error) {
 		return nil, errors.Wrap(err, "rhttp: error creating auth middleware")
 	}
 
+	// the access log wraps the auth middleware to log the rejected requests,
+	// the user is recorded from within.
+	if c, ok := s.conf.Middlewares["accesslog"]; ok {
+		if s.accessLog, err = accesslog.New(c); err != nil {
+			return nil, errors.Wrap(err, "rhttp: error creating accesslog middleware")
+		}
+	}
+
 	// add always the logctx middleware as most priority, this middleware is internal
 	// and cannot be configured from the configuration.
 	coreMiddlewares := []*middlewareTriple{}
+	if s.accessLog != nil {
+		coreMiddlewares = append(coreMiddlewares, &middlewareTriple{Middleware: s.accessLog.UserHandler, Name: "accesslog-user"})
+	}
 	coreMiddlewares = append(coreMiddlewares, &middlewareTriple{Middleware: authMiddle, Name: "auth"})
+	// the cors middleware wraps the auth middleware to answer the preflight
+	// requests, which carry no credentials, and to let browsers read the
+	// responses of the rejected requests.
+	if cors != nil {
+		coreMiddlewares = append(coreMiddlewares, cors)
+	}
 	coreMiddlewares = append(coreMiddlewares, &middlewareTriple{Middleware: log.New(), Name: "log"})
 	coreMiddlewares = append(coreMiddlewares, &middlewareTriple{Middleware: appctx.New(s.log), Name: "appctx"})
+	if s.accessLog != nil {
+		coreMiddlewares = append(coreMiddlewares, &middlewareTriple{Middleware: s.accessLog.Handler, Name: "accesslog"})
+	}
 
 	for _, triple := range coreMiddlewares {
 		handler = triple.Middleware(traceHandler(triple.Name, handler))
 	}
 
-	// use opencensus handler to trace endpoints.
-	// TODO(labkode): enable also opencensus telemetry.
+	// continue the trace of the caller, the opencensus handler is kept
+	// to record the http metrics.
 	handler = &ochttp.Handler{
-		Handler: handler,
+		Handler: trace.Handler(handler),
 		//IsPublicEndpoint: true,
 	}
 
@@ -296,8 +536,8 @@ func (s *Server) getHandler() (http.Handler, error) {
 func traceHandler(name string, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx, span := trace.StartSpan(r.Context(), name)
+		defer span.End()
 		r = r.WithContext(ctx)
 		h.ServeHTTP(w, r)
-		span.End()
 	})
 }
@@ -0,0 +1,94 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package signedurl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+)
+
+func TestSignVerify(t *testing.T) {
+	u := &userpb.User{Id: &userpb.UserId{Idp: "cern.ch", OpaqueId: "einstein"}, Username: "einstein", Groups: []string{"physics"}}
+	signed, err := Sign(http.MethodGet, "http://localhost:19001/data/home/file.txt?version=1", u, "secret", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, signed, nil)
+	if !IsSigned(r) {
+		t.Fatal("expected the request to be signed")
+	}
+	got, err := Verify(r, "secret")
+	if err != nil {
+		t.Fatalf("expected a valid signature: %v", err)
+	}
+	if got.Id.OpaqueId != "einstein" || got.Username != "einstein" || len(got.Groups) != 1 {
+		t.Errorf("unexpected user %+v", got)
+	}
+
+	// the clients can add the checksums
+	r = httptest.NewRequest(http.MethodGet, signed+"&xs=abc&xs_type=md5", nil)
+	if _, err := Verify(r, "secret"); err != nil {
+		t.Errorf("expected the checksums not to be signed: %v", err)
+	}
+
+	invalid := map[string]*http.Request{
+		"method": httptest.NewRequest(http.MethodPut, signed, nil),
+		"secret": httptest.NewRequest(http.MethodGet, signed, nil),
+		"param":  httptest.NewRequest(http.MethodGet, signed+"&filename=/home/other.txt", nil),
+		"path":   httptest.NewRequest(http.MethodGet, replacePath(t, signed, "/data/home/other.txt"), nil),
+	}
+	for name, r := range invalid {
+		secret := "secret"
+		if name == "secret" {
+			secret = "other"
+		}
+		if _, err := Verify(r, secret); err == nil {
+			t.Errorf("expected the signature to be invalid with another %s", name)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	u := &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein"}}
+	signed, err := Sign(http.MethodGet, "http://localhost/data/file.txt", u, "secret", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(httptest.NewRequest(http.MethodGet, signed, nil), "secret"); err == nil {
+		t.Error("expected an expired signature to be invalid")
+	}
+	if IsSigned(httptest.NewRequest(http.MethodGet, "http://localhost/data/file.txt", nil)) {
+		t.Error("expected a request without signature not to be signed")
+	}
+}
+
+func replacePath(t *testing.T, s, p string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = p
+	return u.String()
+}
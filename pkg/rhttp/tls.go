@@ -0,0 +1,266 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package rhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type tlsConf struct {
+	// CertFile and KeyFile make the server speak TLS. The files are read
+	// again when they change, so that renewed certificates are served
+	// without a restart.
+	CertFile string `mapstructure:"certfile"`
+	KeyFile  string `mapstructure:"keyfile"`
+	// CertReloadInterval is the number of seconds between two checks of the
+	// certificate files for changes.
+	CertReloadInterval int `mapstructure:"cert_reload_interval"`
+	// ClientCAFile holds the CAs the client certificates are verified
+	// against. Presenting a certificate is optional unless ClientAuth is
+	// require, the services and middlewares decide whether they need one.
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	ClientAuth   string `mapstructure:"client_auth"`
+	// MinVersion is the oldest TLS version accepted, 1.2 by default.
+	MinVersion string `mapstructure:"tls_min_version"`
+	// CipherSuites are the names of the TLS 1.2 cipher suites accepted, the
+	// ones of TLS 1.3 are not configurable. The defaults of Go when empty.
+	CipherSuites []string `mapstructure:"tls_cipher_suites"`
+	// ACME issues the certificates from an ACME CA instead of reading them
+	// from CertFile and KeyFile.
+	ACME acmeConf `mapstructure:"acme"`
+	// DisableHTTP2 only serves HTTP/1.1 over TLS.
+	DisableHTTP2 bool `mapstructure:"disable_http2"`
+	// H2C serves HTTP/2 without TLS, to the proxies speaking it.
+	H2C bool `mapstructure:"h2c"`
+}
+
+type acmeConf struct {
+	// Domains are the names the certificates are issued for, ACME is
+	// disabled when empty.
+	Domains []string `mapstructure:"domains"`
+	Email   string   `mapstructure:"email"`
+	// CacheDir keeps the account key and the certificates across restarts.
+	CacheDir string `mapstructure:"cache_dir"`
+	// DirectoryURL is the directory of the CA, Let's Encrypt by default.
+	DirectoryURL string `mapstructure:"directory_url"`
+	// HTTPAddress serves the http-01 challenges, and redirects the other
+	// requests to https. Only the tls-alpn-01 challenges, answered by the
+	// server itself on port 443, are solved when empty.
+	HTTPAddress string `mapstructure:"http_address"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func (c *tlsConf) enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || len(c.ACME.Domains) > 0
+}
+
+// tlsConfig returns the TLS configuration of the server, nil if TLS is not
+// enabled, and the ACME manager issuing the certificates if configured.
+func (c *tlsConf) tlsConfig(log zerolog.Logger) (*tls.Config, *autocert.Manager, error) {
+	if !c.enabled() {
+		if c.ClientCAFile != "" {
+			return nil, nil, errors.New("rhttp: client_ca_file requires certfile and keyfile or acme")
+		}
+		return nil, nil, nil
+	}
+
+	var tc *tls.Config
+	var m *autocert.Manager
+	if len(c.ACME.Domains) > 0 {
+		if c.CertFile != "" || c.KeyFile != "" {
+			return nil, nil, errors.New("rhttp: certfile and keyfile can not be used with acme")
+		}
+		if c.ACME.CacheDir == "" {
+			return nil, nil, errors.New("rhttp: acme requires a cache_dir")
+		}
+		m = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.ACME.Domains...),
+			Cache:      autocert.DirCache(c.ACME.CacheDir),
+			Email:      c.ACME.Email,
+		}
+		if c.ACME.DirectoryURL != "" {
+			m.Client = &acme.Client{DirectoryURL: c.ACME.DirectoryURL}
+		}
+		// answers the tls-alpn-01 challenges
+		tc = m.TLSConfig()
+	} else {
+		interval := time.Duration(c.CertReloadInterval) * time.Second
+		if interval == 0 {
+			interval = time.Minute
+		}
+		l, err := newCertLoader(c.CertFile, c.KeyFile, interval, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		tc = &tls.Config{
+			GetCertificate: l.getCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+	}
+
+	tc.MinVersion = tls.VersionTLS12
+	if c.MinVersion != "" {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, nil, errors.New("rhttp: unknown tls version " + c.MinVersion)
+		}
+		tc.MinVersion = v
+	}
+
+	if len(c.CipherSuites) > 0 {
+		suites := map[string]uint16{}
+		for _, s := range tls.CipherSuites() {
+			suites[s.Name] = s.ID
+		}
+		for _, name := range c.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, nil, errors.New("rhttp: unknown or insecure cipher suite " + name)
+			}
+			tc.CipherSuites = append(tc.CipherSuites, id)
+		}
+	}
+
+	if c.DisableHTTP2 {
+		protos := []string{}
+		for _, p := range tc.NextProtos {
+			if p != "h2" {
+				protos = append(protos, p)
+			}
+		}
+		tc.NextProtos = protos
+	}
+
+	switch c.ClientAuth {
+	case "", "verify_if_given":
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, nil, errors.New("rhttp: unknown client_auth " + c.ClientAuth)
+	}
+	if c.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "rhttp: error reading client CAs")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, errors.New("rhttp: no certificate found in " + c.ClientCAFile)
+		}
+		tc.ClientCAs = pool
+	} else if c.ClientAuth == "require" {
+		return nil, nil, errors.New("rhttp: client_auth require needs a client_ca_file")
+	} else {
+		tc.ClientAuth = tls.NoClientCert
+	}
+	return tc, m, nil
+}
+
+// certLoader serves the certificate of a key pair, reading the files again
+// when they changed.
+type certLoader struct {
+	certFile, keyFile string
+	interval          time.Duration
+	log               zerolog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertLoader(certFile, keyFile string, interval time.Duration, log zerolog.Logger) (*certLoader, error) {
+	l := &certLoader{certFile: certFile, keyFile: keyFile, interval: interval, log: log}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// load reads the key pair, it is called with the lock held.
+func (l *certLoader) load() error {
+	modTime, err := l.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "rhttp: error loading certificate")
+	}
+	l.cert = &cert
+	l.modTime = modTime
+	l.checked = time.Now()
+	return nil
+}
+
+// lastModified returns the latest modification time of the files.
+func (l *certLoader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, fn := range []string{l.certFile, l.keyFile} {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "rhttp: error reading certificate")
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// getCertificate returns the certificate, reloaded if the files changed
+// since the last check. The previous certificate is kept if the new one
+// can not be read, for instance while the files are being replaced.
+func (l *certLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.checked) < l.interval {
+		return l.cert, nil
+	}
+	l.checked = time.Now()
+	modTime, err := l.lastModified()
+	if err != nil || !modTime.After(l.modTime) {
+		return l.cert, nil
+	}
+	if err := l.load(); err != nil {
+		l.log.Warn().Err(err).Msg("rhttp: error reloading certificate, serving the previous one")
+		return l.cert, nil
+	}
+	l.log.Info().Str("certfile", l.certFile).Msg("rhttp: certificate reloaded")
+	return l.cert, nil
+}
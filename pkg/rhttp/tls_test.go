@@ -0,0 +1,190 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package rhttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	// The auth middleware is always enabled.
+	_ "github.com/cs3org/reva/internal/http/interceptors/auth/credential/loader"
+	_ "github.com/cs3org/reva/internal/http/interceptors/auth/token/loader"
+	_ "github.com/cs3org/reva/internal/http/interceptors/auth/tokenwriter/loader"
+	_ "github.com/cs3org/reva/pkg/token/manager/loader"
+)
+
+// writeCert writes a self-signed certificate for the common name.
+func writeCert(t *testing.T, dir, cn string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := path.Join(dir, "cert.pem"), path.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rhttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "old")
+	l, err := newCertLoader(certFile, keyFile, 0, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeCert(t, dir, "new")
+	future := time.Now().Add(time.Minute)
+	for _, fn := range []string{certFile, keyFile} {
+		if err := os.Chtimes(fn, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := l.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "new" {
+		t.Errorf("expected the new certificate, got %s", leaf.Subject.CommonName)
+	}
+
+	// a broken file keeps the previous certificate
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Minute)
+	if err := os.Chtimes(certFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := l.getCertificate(nil); err != nil || c != cert {
+		t.Errorf("expected the previous certificate to be kept, got %v", err)
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rhttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCert(t, dir, "localhost")
+
+	for _, tt := range []struct {
+		disable bool
+		proto   int
+	}{{false, 2}, {true, 1}} {
+		ln, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := New(map[string]interface{}{
+			"address":           ln.Addr().String(),
+			"certfile":          certFile,
+			"keyfile":           keyFile,
+			"tls_min_version":   "1.2",
+			"tls_cipher_suites": []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			"disable_http2":     tt.disable,
+			"middlewares": map[string]interface{}{
+				"auth": map[string]interface{}{
+					"token_managers": map[string]interface{}{
+						"jwt": map[string]interface{}{"secret": "changeme"},
+					},
+				},
+			},
+		}, zerolog.Nop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			if err := s.Start(ln); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+			ForceAttemptHTTP2: true,
+		}}
+		// the listener queues the connection until the server is started
+		res, err := client.Get("https://" + ln.Addr().String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.ProtoMajor != tt.proto {
+			t.Errorf("disable_http2=%v: expected HTTP/%d, got %s", tt.disable, tt.proto, res.Proto)
+		}
+		_ = s.Stop()
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	for _, c := range []*tlsConf{
+		{ClientCAFile: "ca.pem"},
+		{ACME: acmeConf{Domains: []string{"reva.example.org"}}},
+		{CertFile: "cert.pem", KeyFile: "key.pem", ACME: acmeConf{Domains: []string{"reva.example.org"}, CacheDir: "/tmp"}},
+	} {
+		if _, _, err := c.tlsConfig(zerolog.Nop()); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package saml
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	crewjam "github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/pkg/errors"
+)
+
+// Config configures the SAML service provider. It is shared by the saml
+// auth manager, which verifies the assertions, and the saml http service,
+// which exposes the metadata and the assertion consumer service.
+type Config struct {
+	// RootURL is the public URL of the saml http service, the metadata is
+	// served at <root_url>/metadata and the assertions consumed at <root_url>/acs.
+	RootURL string `mapstructure:"root_url"`
+	// EntityID defaults to the metadata URL.
+	EntityID string `mapstructure:"entity_id"`
+	// CertFile and KeyFile are used to sign the requests and to decrypt the assertions.
+	CertFile string `mapstructure:"certfile"`
+	KeyFile  string `mapstructure:"keyfile"`
+	// IDPMetadataURL or IDPMetadataFile give the metadata of the identity provider.
+	IDPMetadataURL  string `mapstructure:"idp_metadata_url"`
+	IDPMetadataFile string `mapstructure:"idp_metadata_file"`
+	// AllowIDPInitiated accepts assertions that do not answer a request of ours.
+	AllowIDPInitiated bool `mapstructure:"allow_idp_initiated"`
+}
+
+// NewServiceProvider returns the service provider described by c.
+func NewServiceProvider(ctx context.Context, c *Config) (*crewjam.ServiceProvider, error) {
+	if c.RootURL == "" {
+		return nil, errors.New("saml: root_url is not set")
+	}
+	root, err := url.Parse(strings.TrimSuffix(c.RootURL, "/"))
+	if err != nil {
+		return nil, errors.Wrap(err, "saml: error parsing root_url")
+	}
+	metadataURL := *root
+	metadataURL.Path += "/metadata"
+	acsURL := *root
+	acsURL.Path += "/acs"
+
+	pair, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "saml: error loading the service provider key pair")
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("saml: the service provider key must be an RSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "saml: error parsing the service provider certificate")
+	}
+
+	idp, err := idpMetadata(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	entityID := c.EntityID
+	if entityID == "" {
+		entityID = metadataURL.String()
+	}
+
+	return &crewjam.ServiceProvider{
+		EntityID:          entityID,
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       metadataURL,
+		AcsURL:            acsURL,
+		IDPMetadata:       idp,
+		AllowIDPInitiated: c.AllowIDPInitiated,
+	}, nil
+}
+
+func idpMetadata(ctx context.Context, c *Config) (*crewjam.EntityDescriptor, error) {
+	switch {
+	case c.IDPMetadataFile != "":
+		data, err := ioutil.ReadFile(c.IDPMetadataFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "saml: error reading the identity provider metadata")
+		}
+		md, err := samlsp.ParseMetadata(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "saml: error parsing the identity provider metadata")
+		}
+		return md, nil
+
+	case c.IDPMetadataURL != "":
+		u, err := url.Parse(c.IDPMetadataURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "saml: error parsing idp_metadata_url")
+		}
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		md, err := samlsp.FetchMetadata(ctx, http.DefaultClient, *u)
+		if err != nil {
+			return nil, errors.Wrap(err, "saml: error fetching the identity provider metadata")
+		}
+		return md, nil
+	}
+	return nil, errors.New("saml: idp_metadata_url or idp_metadata_file must be set")
+}
@@ -0,0 +1,276 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package bleve
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/search"
+	"github.com/cs3org/reva/pkg/search/index/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("bleve", New)
+}
+
+type config struct {
+	// Root is the folder keeping the index, the index lives in memory if empty.
+	Root string `mapstructure:"root"`
+}
+
+type index struct {
+	idx bleve.Index
+}
+
+// document is what is stored in bleve for each resource.
+type document struct {
+	StorageID string    `json:"storage_id"`
+	OpaqueID  string    `json:"opaque_id"`
+	Path      string    `json:"path"`
+	Name      string    `json:"name"`
+	LowerName string    `json:"lower_name"`
+	Owner     string    `json:"owner"`
+	MimeType  string    `json:"mime_type"`
+	Size      uint64    `json:"size"`
+	Mtime     time.Time `json:"mtime"`
+	Content   string    `json:"content"`
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns an index backed by bleve.
+func New(m map[string]interface{}) (search.Index, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Root == "" {
+		idx, err := bleve.NewMemOnly(buildMapping())
+		if err != nil {
+			return nil, errors.Wrap(err, "bleve: error creating index")
+		}
+		return &index{idx: idx}, nil
+	}
+
+	fn := filepath.Join(c.Root, "index.bleve")
+	idx, err := bleve.Open(fn)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		if err := os.MkdirAll(c.Root, 0700); err != nil {
+			return nil, errors.Wrap(err, "bleve: error creating index root")
+		}
+		idx, err = bleve.New(fn, buildMapping())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "bleve: error opening index")
+	}
+	return &index{idx: idx}, nil
+}
+
+func buildMapping() mapping.IndexMapping {
+	keywordField := bleve.NewTextFieldMapping()
+	keywordField.Analyzer = keyword.Name
+
+	storedField := bleve.NewTextFieldMapping()
+	storedField.Index = false
+
+	textField := bleve.NewTextFieldMapping()
+	textField.Store = false
+
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("storage_id", storedField)
+	doc.AddFieldMappingsAt("opaque_id", storedField)
+	doc.AddFieldMappingsAt("path", keywordField)
+	doc.AddFieldMappingsAt("name", bleve.NewTextFieldMapping())
+	doc.AddFieldMappingsAt("lower_name", keywordField)
+	doc.AddFieldMappingsAt("owner", keywordField)
+	doc.AddFieldMappingsAt("mime_type", keywordField)
+	doc.AddFieldMappingsAt("size", bleve.NewNumericFieldMapping())
+	doc.AddFieldMappingsAt("mtime", bleve.NewDateTimeFieldMapping())
+	doc.AddFieldMappingsAt("content", textField)
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = doc
+	return m
+}
+
+func (i *index) Index(ctx context.Context, e *search.Entry) error {
+	doc := &document{
+		StorageID: e.ID.StorageId,
+		OpaqueID:  e.ID.OpaqueId,
+		Path:      e.Path,
+		Name:      path.Base(e.Path),
+		LowerName: strings.ToLower(path.Base(e.Path)),
+		MimeType:  e.MimeType,
+		Size:      e.Size,
+		Mtime:     e.Mtime,
+		Content:   e.Content,
+	}
+	if e.Owner != nil {
+		doc.Owner = e.Owner.OpaqueId + "@" + e.Owner.Idp
+	}
+	if err := i.idx.Index(search.DocID(e.ID), doc); err != nil {
+		return errors.Wrap(err, "bleve: error indexing "+e.Path)
+	}
+	return nil
+}
+
+func (i *index) Delete(ctx context.Context, id *provider.ResourceId, p string) error {
+	b := i.idx.NewBatch()
+	b.Delete(search.DocID(id))
+
+	if p != "" {
+		// the children of a folder are found by their path
+		q := bleve.NewPrefixQuery(strings.TrimSuffix(p, "/") + "/")
+		q.SetField("path")
+		for from := 0; ; {
+			req := bleve.NewSearchRequestOptions(q, 1000, from, false)
+			res, err := i.idx.Search(req)
+			if err != nil {
+				return errors.Wrap(err, "bleve: error finding children of "+p)
+			}
+			for _, hit := range res.Hits {
+				b.Delete(hit.ID)
+			}
+			from += len(res.Hits)
+			if len(res.Hits) == 0 || uint64(from) >= res.Total {
+				break
+			}
+		}
+	}
+
+	if err := i.idx.Batch(b); err != nil {
+		return errors.Wrap(err, "bleve: error deleting "+p)
+	}
+	return nil
+}
+
+func (i *index) Search(ctx context.Context, term string, spaces []*search.Space, limit int) ([]*search.Match, error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return []*search.Match{}, nil
+	}
+
+	name := bleve.NewMatchQuery(term)
+	name.SetField("name")
+	name.SetBoost(2)
+	content := bleve.NewMatchQuery(term)
+	content.SetField("content")
+	match := bleve.NewDisjunctionQuery(name, content)
+	// partial names are matched too, users rarely type whole words
+	if t := stripWildcards(strings.ToLower(term)); t != "" {
+		partial := bleve.NewWildcardQuery("*" + t + "*")
+		partial.SetField("lower_name")
+		partial.SetBoost(1.5)
+		match.AddQuery(partial)
+	}
+
+	scope, err := i.scope(ctx, spaces)
+	if err != nil {
+		return nil, err
+	}
+	if len(scope.Disjuncts) == 0 {
+		return []*search.Match{}, nil
+	}
+	q := bleve.NewConjunctionQuery(match, scope)
+
+	req := bleve.NewSearchRequestOptions(q, limit, 0, false)
+	req.Fields = []string{"storage_id", "opaque_id", "path"}
+	res, err := i.idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "bleve: error searching")
+	}
+
+	matches := make([]*search.Match, 0, len(res.Hits))
+	for _, hit := range res.Hits {
+		sid, _ := hit.Fields["storage_id"].(string)
+		oid, _ := hit.Fields["opaque_id"].(string)
+		p, _ := hit.Fields["path"].(string)
+		matches = append(matches, &search.Match{
+			ID:    &provider.ResourceId{StorageId: sid, OpaqueId: oid},
+			Path:  p,
+			Score: hit.Score,
+		})
+	}
+	return matches, nil
+}
+
+// scope matches the documents in the spaces. The path of the root of a space
+// is the one it was indexed under, a root missing from the index scopes
+// nothing.
+func (i *index) scope(ctx context.Context, spaces []*search.Space) (*query.DisjunctionQuery, error) {
+	scope := bleve.NewDisjunctionQuery()
+	for _, sp := range spaces {
+		if sp.Owner == nil {
+			continue
+		}
+		owner := bleve.NewTermQuery(sp.Owner.OpaqueId + "@" + sp.Owner.Idp)
+		owner.SetField("owner")
+		if sp.Root == nil {
+			scope.AddQuery(owner)
+			continue
+		}
+
+		req := bleve.NewSearchRequest(bleve.NewDocIDQuery([]string{search.DocID(sp.Root)}))
+		req.Fields = []string{"path"}
+		res, err := i.idx.SearchInContext(ctx, req)
+		if err != nil {
+			return nil, errors.Wrap(err, "bleve: error finding the root of a space")
+		}
+		if len(res.Hits) == 0 {
+			continue
+		}
+		p, _ := res.Hits[0].Fields["path"].(string)
+		p = strings.TrimSuffix(p, "/")
+		exact := bleve.NewTermQuery(p)
+		exact.SetField("path")
+		below := bleve.NewPrefixQuery(p + "/")
+		below.SetField("path")
+		scope.AddQuery(bleve.NewConjunctionQuery(owner, bleve.NewDisjunctionQuery(exact, below)))
+	}
+	return scope, nil
+}
+
+// stripWildcards drops the wildcards of the term, bleve has no way to escape them.
+func stripWildcards(s string) string {
+	return strings.NewReplacer("*", "", "?", "").Replace(s)
+}
+
+func (i *index) Close() error {
+	return i.idx.Close()
+}
@@ -0,0 +1,106 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package bleve
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/search"
+)
+
+func paths(matches []*search.Match) []string {
+	ps := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ps = append(ps, m.Path)
+	}
+	return ps
+}
+
+func TestSearch(t *testing.T) {
+	idx, err := New(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	ctx := context.Background()
+
+	einstein := &userpb.UserId{OpaqueId: "einstein", Idp: "cernbox.cern.ch"}
+	marie := &userpb.UserId{OpaqueId: "marie", Idp: "cesnet.cz"}
+	everyone := []*search.Space{{Owner: einstein}, {Owner: marie}}
+
+	entries := []*search.Entry{
+		{ID: &provider.ResourceId{StorageId: "s", OpaqueId: "1"}, Path: "/home/einstein/Relativity.pdf", Owner: einstein, MimeType: "application/pdf"},
+		{ID: &provider.ResourceId{StorageId: "s", OpaqueId: "2"}, Path: "/home/einstein/notes.txt", Owner: einstein, MimeType: "text/plain", Content: "the theory of relativity"},
+		{ID: &provider.ResourceId{StorageId: "s", OpaqueId: "3"}, Path: "/home/marie/relativity.txt", Owner: marie, MimeType: "text/plain"},
+		{ID: &provider.ResourceId{StorageId: "s", OpaqueId: "4"}, Path: "/home/einstein/photos/holiday.jpg", Owner: einstein, MimeType: "image/jpeg"},
+		{ID: &provider.ResourceId{StorageId: "s", OpaqueId: "5"}, Path: "/home/einstein/photos", Owner: einstein, MimeType: "httpd/unix-directory"},
+		{ID: &provider.ResourceId{StorageId: "s", OpaqueId: "6"}, Path: "/home/marie/photos/holidays.txt", Owner: marie, MimeType: "text/plain"},
+	}
+	for _, e := range entries {
+		if err := idx.Index(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	photos := &search.Space{Owner: einstein, Root: &provider.ResourceId{StorageId: "s", OpaqueId: "5"}}
+	tests := []struct {
+		name     string
+		term     string
+		spaces   []*search.Space
+		expected int
+	}{
+		{"all", "relativity", everyone, 3},
+		{"owner", "relativity", []*search.Space{{Owner: einstein}}, 2},
+		{"partial", "relat", []*search.Space{{Owner: einstein}}, 1},
+		{"root", "holi", []*search.Space{photos}, 1},
+		{"outside root", "relativity", []*search.Space{photos}, 0},
+		{"other owner", "holiday", []*search.Space{{Owner: marie}}, 1},
+		{"root of other owner", "holidays", []*search.Space{{Owner: marie, Root: photos.Root}}, 0},
+		{"unknown root", "relativity", []*search.Space{{Owner: einstein, Root: &provider.ResourceId{StorageId: "s", OpaqueId: "x"}}}, 0},
+		{"no space", "relativity", nil, 0},
+		{"blank", "  ", everyone, 0},
+	}
+	for _, tt := range tests {
+		matches, err := idx.Search(ctx, tt.term, tt.spaces, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != tt.expected {
+			t.Errorf("%s: search %q got %v, expected %d matches", tt.name, tt.term, paths(matches), tt.expected)
+		}
+	}
+
+	if err := idx.Delete(ctx, &provider.ResourceId{StorageId: "s", OpaqueId: "5"}, "/home/einstein/photos"); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := idx.Search(ctx, "holiday", []*search.Space{{Owner: einstein}}, 10); len(matches) != 0 {
+		t.Errorf("expected the children of a deleted folder to be removed, got %v", paths(matches))
+	}
+
+	matches, err := idx.Search(ctx, "relativity", everyone, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 || matches[0].ID.OpaqueId == "" {
+		t.Fatalf("expected the ids of the matches, got %v", matches)
+	}
+}
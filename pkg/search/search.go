@@ -0,0 +1,106 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package search
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// Entry is a resource as stored in the index.
+type Entry struct {
+	ID       *provider.ResourceId
+	Path     string
+	Owner    *userpb.UserId
+	MimeType string
+	Size     uint64
+	Mtime    time.Time
+	// Content is the text of the file, empty if it is not indexed.
+	Content string
+}
+
+// Match is a resource matching a query. Path is the path the resource
+// was indexed under, which is not necessarily the one the user sees it at.
+type Match struct {
+	ID    *provider.ResourceId
+	Path  string
+	Score float64
+}
+
+// Space is the part of the index a user has access to: the resources of
+// Owner, only the ones below the resource Root when it is set, like the
+// resources received in a share.
+type Space struct {
+	Owner *userpb.UserId
+	Root  *provider.ResourceId
+}
+
+// Result is a match the user has access to, as returned by the search service.
+type Result struct {
+	Path      string  `json:"path"`
+	StorageID string  `json:"storage_id"`
+	OpaqueID  string  `json:"opaque_id"`
+	Type      string  `json:"type"`
+	MimeType  string  `json:"mime_type,omitempty"`
+	Size      uint64  `json:"size"`
+	Etag      string  `json:"etag,omitempty"`
+	Mtime     uint64  `json:"mtime,omitempty"`
+	Score     float64 `json:"score"`
+	// Metadata is the metadata extracted from the content, like the
+	// dimensions of images, keyed by property name.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Response is the body of the replies of the search service.
+type Response struct {
+	Results []*Result `json:"results"`
+}
+
+// Index keeps the entries and finds the ones matching a query.
+type Index interface {
+	// Index adds the entry, replacing the previous version of the resource.
+	Index(ctx context.Context, e *Entry) error
+	// Delete removes the resource, and its children for folders.
+	Delete(ctx context.Context, id *provider.ResourceId, path string) error
+	// Search returns the matches for the term in the names and contents
+	// of the resources in one of the given spaces, best first.
+	Search(ctx context.Context, term string, spaces []*Space, limit int) ([]*Match, error)
+	Close() error
+}
+
+// DocID is the id of a resource in the index.
+func DocID(id *provider.ResourceId) string {
+	return id.StorageId + "!" + id.OpaqueId
+}
+
+// IsText tells whether the content of a file of the mime type is indexed.
+func IsText(mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/javascript", "application/x-sh":
+		return true
+	}
+	return false
+}
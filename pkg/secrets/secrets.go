@@ -0,0 +1,135 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package secrets resolves the secrets referenced in the configuration, so
+// that they do not have to be stored in plain text. A string value like
+// vault:secret/reva/jwt_secret is replaced by the secret the vault store
+// returns for secret/reva/jwt_secret.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/secrets/registry"
+	"github.com/pkg/errors"
+)
+
+// Resolver replaces the references to secrets in the configuration.
+type Resolver struct {
+	stores map[string]registry.Store
+}
+
+// New returns a resolver with a store per entry of m, the secrets section of
+// the configuration, whose keys are the names of the stores.
+func New(m map[string]interface{}) (*Resolver, error) {
+	r := &Resolver{stores: map[string]registry.Store{}}
+	for name, c := range m {
+		f, ok := registry.NewFuncs[name]
+		if !ok {
+			return nil, fmt.Errorf("secrets: store not found: %s", name)
+		}
+		sc, ok := c.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("secrets: invalid config of store %s", name)
+		}
+		s, err := f(sc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "secrets: error creating store %s", name)
+		}
+		r.stores[name] = s
+	}
+	return r, nil
+}
+
+// Resolve replaces in place the references to secrets found in the string
+// values of conf, nested tables and arrays included. The values prefixed
+// with the name of no configured store are left as they are.
+func (r *Resolver) Resolve(ctx context.Context, conf map[string]interface{}) error {
+	if len(r.stores) == 0 {
+		return nil
+	}
+	_, err := r.resolve(ctx, "", conf)
+	return err
+}
+
+// resolve returns v with its references resolved, key is where v is in the
+// configuration.
+func (r *Resolver) resolve(ctx context.Context, key string, v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		i := strings.Index(t, ":")
+		if i < 0 {
+			return t, nil
+		}
+		s, ok := r.stores[t[:i]]
+		if !ok {
+			return t, nil
+		}
+		secret, err := s.Get(ctx, t[i+1:])
+		if err != nil {
+			// the reference is not a secret, the error can include it
+			return nil, errors.Wrapf(err, "secrets: error resolving %s (%s)", key, t)
+		}
+		return secret, nil
+	case map[string]interface{}:
+		for k, e := range t {
+			res, err := r.resolve(ctx, join(key, k), e)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = res
+		}
+	case []map[string]interface{}:
+		for i, e := range t {
+			if _, err := r.resolve(ctx, fmt.Sprintf("%s[%d]", key, i), e); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, e := range t {
+			res, err := r.resolve(ctx, fmt.Sprintf("%s[%d]", key, i), e)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = res
+		}
+	}
+	return v, nil
+}
+
+func join(key, k string) string {
+	if key == "" {
+		return k
+	}
+	return key + "." + k
+}
+
+// Close stops the stores, like the renewal of their credentials.
+func (r *Resolver) Close() error {
+	for _, s := range r.stores {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package secrets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/secrets/registry"
+)
+
+type mapStore map[string]string
+
+func (m mapStore) Get(ctx context.Context, ref string) (string, error) {
+	if v, ok := m[ref]; ok {
+		return v, nil
+	}
+	return "", errors.New("not found")
+}
+
+func TestResolve(t *testing.T) {
+	r := &Resolver{stores: map[string]registry.Store{
+		"vault": mapStore{"secret/reva/jwt_secret": "jwt", "secret/ldap/password": "ldap"},
+	}}
+	conf := map[string]interface{}{
+		"shared": map[string]interface{}{"jwt_secret": "vault:secret/reva/jwt_secret"},
+		"grpc": map[string]interface{}{
+			"services": map[string]interface{}{
+				"authprovider": map[string]interface{}{"bind_password": "vault:secret/ldap/password", "port": int64(389)},
+			},
+		},
+		"http": map[string]interface{}{
+			"endpoints": []interface{}{"https://example.org", "vault:secret/reva/jwt_secret"},
+			"drivers":   []map[string]interface{}{{"secret": "vault:secret/ldap/password"}},
+		},
+	}
+	if err := r.Resolve(context.Background(), conf); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"shared": map[string]interface{}{"jwt_secret": "jwt"},
+		"grpc": map[string]interface{}{
+			"services": map[string]interface{}{
+				"authprovider": map[string]interface{}{"bind_password": "ldap", "port": int64(389)},
+			},
+		},
+		"http": map[string]interface{}{
+			"endpoints": []interface{}{"https://example.org", "jwt"},
+			"drivers":   []map[string]interface{}{{"secret": "ldap"}},
+		},
+	}
+	if !reflect.DeepEqual(conf, want) {
+		t.Errorf("got %v, want %v", conf, want)
+	}
+
+	if err := r.Resolve(context.Background(), map[string]interface{}{"a": "vault:missing/field"}); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+}
+
+func TestNewUnknownStore(t *testing.T) {
+	if _, err := New(map[string]interface{}{"unknown": map[string]interface{}{}}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package vault implements a secret store reading the secrets from the key
+// value engine of HashiCorp Vault. The references are the path of the
+// secret followed by the name of the field, like secret/reva/jwt_secret for
+// the jwt_secret field of the secret/reva secret.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/secrets/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	registry.Register("vault", New)
+}
+
+type config struct {
+	Address string `mapstructure:"address"`
+	// Token authenticates to Vault. When empty, the token is read from
+	// TokenFile, obtained with the AppRole credentials or taken from the
+	// VAULT_TOKEN environment variable, in this order.
+	Token       string `mapstructure:"token"`
+	TokenFile   string `mapstructure:"token_file"`
+	RoleID      string `mapstructure:"role_id"`
+	SecretID    string `mapstructure:"secret_id"`
+	AppRolePath string `mapstructure:"approle_path"`
+	// KVVersion is the version of the key value engine, 1 or 2.
+	KVVersion int `mapstructure:"kv_version"`
+	// RenewInterval is the number of seconds between two renewals of the
+	// token, 0 disables the renewal.
+	RenewInterval int `mapstructure:"renew_interval"`
+}
+
+type store struct {
+	c *config
+
+	mu    sync.RWMutex
+	token string
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// New returns a secret store reading from Vault.
+func New(m map[string]interface{}) (registry.Store, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "vault: error decoding conf")
+	}
+	if c.Address == "" {
+		return nil, errors.New("vault: address is required")
+	}
+	c.Address = strings.TrimSuffix(c.Address, "/")
+	if c.KVVersion == 0 {
+		c.KVVersion = 2
+	}
+	if c.KVVersion != 1 && c.KVVersion != 2 {
+		return nil, fmt.Errorf("vault: invalid kv_version %d", c.KVVersion)
+	}
+	if c.AppRolePath == "" {
+		c.AppRolePath = "approle"
+	}
+
+	s := &store{c: c, stop: make(chan struct{})}
+	if err := s.login(context.Background()); err != nil {
+		return nil, err
+	}
+	if c.RenewInterval > 0 {
+		go s.renew(time.Duration(c.RenewInterval) * time.Second)
+	}
+	return s, nil
+}
+
+func (s *store) login(ctx context.Context) error {
+	token := s.c.Token
+	switch {
+	case token != "":
+	case s.c.TokenFile != "":
+		b, err := ioutil.ReadFile(s.c.TokenFile)
+		if err != nil {
+			return errors.Wrap(err, "vault: error reading token file")
+		}
+		token = strings.TrimSpace(string(b))
+	case s.c.RoleID != "":
+		var res struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+		body := map[string]string{"role_id": s.c.RoleID, "secret_id": s.c.SecretID}
+		if err := s.do(ctx, http.MethodPost, "auth/"+s.c.AppRolePath+"/login", body, &res); err != nil {
+			return errors.Wrap(err, "vault: error logging in with approle")
+		}
+		token = res.Auth.ClientToken
+	default:
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return errors.New("vault: no token configured")
+	}
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+	return nil
+}
+
+// renew renews the token every interval so that it does not expire while
+// the secrets are needed, for example on reloads. An AppRole token that can
+// no longer be renewed is replaced by a new login.
+func (s *store) renew(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			ctx := context.Background()
+			err := s.do(ctx, http.MethodPost, "auth/token/renew-self", map[string]string{}, nil)
+			if err != nil && s.c.RoleID != "" {
+				err = s.login(ctx)
+			}
+			if err != nil {
+				log.Error().Err(err).Msg("vault: error renewing token")
+			}
+		}
+	}
+}
+
+// Get returns the field of the secret, the last element of ref being the
+// field and the rest the path of the secret.
+func (s *store) Get(ctx context.Context, ref string) (string, error) {
+	i := strings.LastIndex(ref, "/")
+	if i <= 0 || i == len(ref)-1 {
+		return "", fmt.Errorf("vault: invalid reference %s, expected path/field", ref)
+	}
+	path, field := ref[:i], ref[i+1:]
+
+	var res struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	p := path
+	if s.c.KVVersion == 2 {
+		// the data of a v2 secret is read under data/ of the mount
+		parts := strings.SplitN(path, "/", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("vault: invalid reference %s, expected mount/path/field", ref)
+		}
+		p = parts[0] + "/data/" + parts[1]
+	}
+	if err := s.do(ctx, http.MethodGet, p, nil, &res); err != nil {
+		return "", err
+	}
+
+	data := res.Data
+	if s.c.KVVersion == 2 {
+		data, _ = data["data"].(map[string]interface{})
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault: field %s not found in %s", field, path)
+	}
+	secret, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("vault: field %s of %s is not a string", field, path)
+	}
+	return secret, nil
+}
+
+// do calls the Vault API at path and decodes the response into res, if not
+// nil.
+func (s *store) do(ctx context.Context, method, path string, body, res interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, s.c.Address+"/v1/"+path, r)
+	if err != nil {
+		return errors.Wrap(err, "vault: error creating request")
+	}
+	req = req.WithContext(ctx)
+	s.mu.RLock()
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	s.mu.RUnlock()
+
+	httpRes, err := rhttp.GetHTTPClient(ctx).Do(req)
+	if err != nil {
+		return errors.Wrap(err, "vault: error calling "+path)
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.StatusCode != http.StatusOK && httpRes.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("vault: error calling %s: %s", path, httpRes.Status)
+	}
+	if res == nil {
+		return nil
+	}
+	if err := json.NewDecoder(httpRes.Body).Decode(res); err != nil {
+		return errors.Wrap(err, "vault: error decoding response")
+	}
+	return nil
+}
+
+// Close stops the renewal of the token.
+func (s *store) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
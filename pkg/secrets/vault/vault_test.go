@@ -0,0 +1,77 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["role_id"] != "role" || body["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.token"}}`))
+		case "/v1/secret/data/reva":
+			if r.Header.Get("X-Vault-Token") != "s.token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":{"data":{"jwt_secret":"changeme","port":1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := New(map[string]interface{}{"address": srv.URL, "role_id": "role", "secret_id": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	got, err := s.Get(ctx, "secret/reva/jwt_secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "changeme" {
+		t.Errorf("got %q", got)
+	}
+
+	for _, ref := range []string{"secret/reva/missing", "secret/reva/port", "secret/other/jwt_secret", "jwt_secret", "secret/reva/"} {
+		if _, err := s.Get(ctx, ref); err == nil {
+			t.Errorf("%s: expected an error", ref)
+		}
+	}
+}
+
+func TestNoToken(t *testing.T) {
+	if _, err := New(map[string]interface{}{"address": "http://localhost:8200", "token_file": "/nonexistent"}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package share
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/pkg/errors"
+)
+
+// The CS3 shares do not carry an expiration, so it travels in the opaque
+// data of the requests and responses of the collaboration API.
+const (
+	// OpaqueExpiration holds the expiration of a single share as unix
+	// seconds, 0 meaning the share never expires.
+	OpaqueExpiration = "expiration"
+	// OpaqueExpirations holds the expirations of a list of shares as a
+	// json map of share ids to unix seconds.
+	OpaqueExpirations = "expirations"
+)
+
+// Expired tells whether a share with the given expiration is expired at t.
+func Expired(exp *typespb.Timestamp, t time.Time) bool {
+	return exp != nil && exp.Seconds != 0 && t.Unix() >= int64(exp.Seconds)
+}
+
+// ExpirationToOpaque returns the opaque data carrying the expiration of a share.
+func ExpirationToOpaque(exp *typespb.Timestamp) *typespb.Opaque {
+	return &typespb.Opaque{
+		Map: map[string]*typespb.OpaqueEntry{
+			OpaqueExpiration: {Decoder: "plain", Value: []byte(strconv.FormatUint(exp.GetSeconds(), 10))},
+		},
+	}
+}
+
+// ExpirationFromOpaque returns the expiration carried by the opaque data and
+// whether there was one. A nil expiration means the share never expires.
+func ExpirationFromOpaque(o *typespb.Opaque) (*typespb.Timestamp, bool, error) {
+	e, ok := o.GetMap()[OpaqueExpiration]
+	if !ok {
+		return nil, false, nil
+	}
+	if e.Decoder != "plain" {
+		return nil, false, errors.New("share: unsupported expiration decoder " + e.Decoder)
+	}
+	secs, err := strconv.ParseUint(string(e.Value), 10, 64)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "share: invalid expiration")
+	}
+	if secs == 0 {
+		return nil, true, nil
+	}
+	return &typespb.Timestamp{Seconds: secs}, true, nil
+}
+
+// ExpirationsToOpaque returns the opaque data carrying the expirations of a
+// list of shares, keyed by share id. Shares without expiration are omitted.
+func ExpirationsToOpaque(exps map[string]*typespb.Timestamp) (*typespb.Opaque, error) {
+	secs := make(map[string]uint64, len(exps))
+	for id, exp := range exps {
+		if exp != nil {
+			secs[id] = exp.Seconds
+		}
+	}
+	data, err := json.Marshal(secs)
+	if err != nil {
+		return nil, errors.Wrap(err, "share: error encoding expirations")
+	}
+	return &typespb.Opaque{
+		Map: map[string]*typespb.OpaqueEntry{
+			OpaqueExpirations: {Decoder: "json", Value: data},
+		},
+	}, nil
+}
+
+// ExpirationsFromOpaque returns the expirations carried by the opaque data, keyed by share id.
+func ExpirationsFromOpaque(o *typespb.Opaque) (map[string]*typespb.Timestamp, error) {
+	exps := map[string]*typespb.Timestamp{}
+	e, ok := o.GetMap()[OpaqueExpirations]
+	if !ok {
+		return exps, nil
+	}
+	if e.Decoder != "json" {
+		return nil, errors.New("share: unsupported expirations decoder " + e.Decoder)
+	}
+	secs := map[string]uint64{}
+	if err := json.Unmarshal(e.Value, &secs); err != nil {
+		return nil, errors.Wrap(err, "share: error decoding expirations")
+	}
+	for id, s := range secs {
+		exps[id] = &typespb.Timestamp{Seconds: s}
+	}
+	return exps, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package share
+
+import (
+	"testing"
+	"time"
+
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+)
+
+func TestExpirationOpaque(t *testing.T) {
+	for _, exp := range []*typespb.Timestamp{nil, {Seconds: 1590000000}} {
+		got, ok, err := ExpirationFromOpaque(ExpirationToOpaque(exp))
+		if err != nil || !ok {
+			t.Fatalf("unexpected result for %v: ok=%v err=%v", exp, ok, err)
+		}
+		if got.GetSeconds() != exp.GetSeconds() {
+			t.Errorf("got %v, expected %v", got, exp)
+		}
+	}
+
+	if _, ok, err := ExpirationFromOpaque(nil); ok || err != nil {
+		t.Errorf("expected no expiration in nil opaque, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Unix(1590000000, 0)
+	tests := []struct {
+		exp      *typespb.Timestamp
+		expected bool
+	}{
+		{nil, false},
+		{&typespb.Timestamp{}, false},
+		{&typespb.Timestamp{Seconds: 1590000001}, false},
+		{&typespb.Timestamp{Seconds: 1590000000}, true},
+		{&typespb.Timestamp{Seconds: 1589999999}, true},
+	}
+
+	for _, tt := range tests {
+		if got := Expired(tt.exp, now); got != tt.expected {
+			t.Errorf("Expired(%v): got %v, expected %v", tt.exp, got, tt.expected)
+		}
+	}
+}
@@ -109,6 +109,12 @@ func loadOrCreate(file string) (*shareModel, error) {
 	if m.State == nil {
 		m.State = map[string]map[string]collaboration.ShareState{}
 	}
+	if m.Expirations == nil {
+		m.Expirations = map[string]*typespb.Timestamp{}
+	}
+	if m.Parents == nil {
+		m.Parents = map[string]string{}
+	}
 
 	m.file = file
 	return m, nil
@@ -118,6 +124,10 @@ type shareModel struct {
 	file   string
 	State  map[string]map[string]collaboration.ShareState `json:"state"` // map[username]map[share_id]boolean
 	Shares []*collaboration.Share                         `json:"shares"`
+	// Expirations contains when the shares expire.
+	Expirations map[string]*typespb.Timestamp `json:"expirations"` // map[share_id]expiration
+	// Parents contains the shares the reshares were created from.
+	Parents map[string]string `json:"parents"` // map[share_id]parent_share_id
 }
 
 func (m *shareModel) Save() error {
@@ -173,13 +183,23 @@ func (m *mgr) Share(ctx context.Context, md *provider.ResourceInfo, g *collabora
 		return nil, errors.New("json: user and grantee are the same")
 	}
 
+	// reshares belong to the owner of the resource
+	owner, err := share.Owner(md)
+	if err != nil {
+		return nil, err
+	}
+	if g.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER &&
+		g.Grantee.Id.Idp == owner.Idp && g.Grantee.Id.OpaqueId == owner.OpaqueId {
+		return nil, errors.New("json: owner and grantee are the same")
+	}
+
 	// check if share already exists.
 	key := &collaboration.ShareKey{
-		Owner:      user.Id,
+		Owner:      owner,
 		ResourceId: md.Id,
 		Grantee:    g.Grantee,
 	}
-	_, err := m.getByKey(ctx, key)
+	_, err = m.getByKey(ctx, key)
 
 	// share already exists
 	if err == nil {
@@ -193,7 +213,7 @@ func (m *mgr) Share(ctx context.Context, md *provider.ResourceInfo, g *collabora
 		ResourceId:  md.Id,
 		Permissions: g.Permissions,
 		Grantee:     g.Grantee,
-		Owner:       user.Id,
+		Owner:       owner,
 		Creator:     user.Id,
 		Ctime:       ts,
 		Mtime:       ts,
@@ -249,10 +269,8 @@ func (m *mgr) get(ctx context.Context, ref *collaboration.ShareReference) (s *co
 		return nil, err
 	}
 
-	// check if we are the owner
-	// TODO(labkode): check for creator also.
-	user := user.ContextMustGetUser(ctx)
-	if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+	// check if we are the owner or the creator
+	if share.IsOwnerOrCreator(user.ContextMustGetUser(ctx), s) {
 		return s, nil
 	}
 
@@ -275,9 +293,11 @@ func (m *mgr) Unshare(ctx context.Context, ref *collaboration.ShareReference) er
 	user := user.ContextMustGetUser(ctx)
 	for i, s := range m.model.Shares {
 		if equal(ref, s) {
-			if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+			if share.IsOwnerOrCreator(user, s) {
 				m.model.Shares[len(m.model.Shares)-1], m.model.Shares[i] = m.model.Shares[i], m.model.Shares[len(m.model.Shares)-1]
 				m.model.Shares = m.model.Shares[:len(m.model.Shares)-1]
+				delete(m.model.Expirations, s.Id.OpaqueId)
+				delete(m.model.Parents, s.Id.OpaqueId)
 				if err := m.model.Save(); err != nil {
 					err = errors.Wrap(err, "error saving model")
 					return err
@@ -309,7 +329,7 @@ func (m *mgr) UpdateShare(ctx context.Context, ref *collaboration.ShareReference
 	user := user.ContextMustGetUser(ctx)
 	for i, s := range m.model.Shares {
 		if equal(ref, s) {
-			if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+			if share.IsOwnerOrCreator(user, s) {
 				now := time.Now().UnixNano()
 				m.model.Shares[i].Permissions = p
 				m.model.Shares[i].Mtime = &typespb.Timestamp{
@@ -333,8 +353,7 @@ func (m *mgr) ListShares(ctx context.Context, filters []*collaboration.ListShare
 	defer m.Unlock()
 	user := user.ContextMustGetUser(ctx)
 	for _, s := range m.model.Shares {
-		// TODO(labkode): add check for creator.
-		if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+		if share.IsOwnerOrCreator(user, s) {
 			// no filter we return earlier
 			if len(filters) == 0 {
 				ss = append(ss, s)
@@ -361,9 +380,8 @@ func (m *mgr) ListReceivedShares(ctx context.Context) ([]*collaboration.Received
 	defer m.Unlock()
 	user := user.ContextMustGetUser(ctx)
 	for _, s := range m.model.Shares {
-		if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+		if share.IsOwnerOrCreator(user, s) {
 			// omit shares created by me
-			// TODO(labkode): apply check for s.Creator also.
 			continue
 		}
 		if s.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER {
@@ -452,3 +470,79 @@ func (m *mgr) UpdateReceivedShare(ctx context.Context, ref *collaboration.ShareR
 
 	return rs, nil
 }
+
+func (m *mgr) SetShareExpiration(ctx context.Context, ref *collaboration.ShareReference, exp *typespb.Timestamp) error {
+	s, err := m.get(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if exp == nil {
+		delete(m.model.Expirations, s.Id.OpaqueId)
+	} else {
+		m.model.Expirations[s.Id.OpaqueId] = exp
+	}
+
+	if err := m.model.Save(); err != nil {
+		err = errors.Wrap(err, "error saving model")
+		return err
+	}
+	return nil
+}
+
+func (m *mgr) GetShareExpiration(ctx context.Context, id *collaboration.ShareId) (*typespb.Timestamp, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.model.Expirations[id.OpaqueId], nil
+}
+
+func (m *mgr) ListExpiredShares(ctx context.Context, t time.Time) ([]*collaboration.Share, error) {
+	m.Lock()
+	defer m.Unlock()
+	var ss []*collaboration.Share
+	for _, s := range m.model.Shares {
+		if share.Expired(m.model.Expirations[s.Id.OpaqueId], t) {
+			ss = append(ss, s)
+		}
+	}
+	return ss, nil
+}
+
+func (m *mgr) SetShareParent(ctx context.Context, ref *collaboration.ShareReference, parent *collaboration.ShareId) error {
+	s, err := m.get(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.model.Parents[s.Id.OpaqueId] = parent.OpaqueId
+	if err := m.model.Save(); err != nil {
+		err = errors.Wrap(err, "error saving model")
+		return err
+	}
+	return nil
+}
+
+func (m *mgr) GetShareParent(ctx context.Context, id *collaboration.ShareId) (*collaboration.ShareId, error) {
+	m.Lock()
+	defer m.Unlock()
+	if p, ok := m.model.Parents[id.OpaqueId]; ok {
+		return &collaboration.ShareId{OpaqueId: p}, nil
+	}
+	return nil, nil
+}
+
+func (m *mgr) ListChildShares(ctx context.Context, id *collaboration.ShareId) ([]*collaboration.Share, error) {
+	m.Lock()
+	defer m.Unlock()
+	var ss []*collaboration.Share
+	for _, s := range m.model.Shares {
+		if m.model.Parents[s.Id.OpaqueId] == id.OpaqueId {
+			ss = append(ss, s)
+		}
+	}
+	return ss, nil
+}
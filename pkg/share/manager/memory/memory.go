@@ -47,8 +47,10 @@ func init() {
 func New(c map[string]interface{}) (share.Manager, error) {
 	state := map[string]map[*collaboration.ShareId]collaboration.ShareState{}
 	return &manager{
-		shareState: state,
-		lock:       &sync.Mutex{},
+		shareState:  state,
+		expirations: map[string]*typespb.Timestamp{},
+		parents:     map[string]string{},
+		lock:        &sync.Mutex{},
 	}, nil
 }
 
@@ -58,6 +60,12 @@ type manager struct {
 	// shareState contains the share state for a user.
 	// map["alice"]["share-id"]state.
 	shareState map[string]map[*collaboration.ShareId]collaboration.ShareState
+	// expirations contains when the shares expire.
+	// map["share-id"]expiration.
+	expirations map[string]*typespb.Timestamp
+	// parents contains the shares the reshares were created from.
+	// map["share-id"]"parent-share-id".
+	parents map[string]string
 }
 
 func (m *manager) add(ctx context.Context, s *collaboration.Share) {
@@ -81,13 +89,23 @@ func (m *manager) Share(ctx context.Context, md *provider.ResourceInfo, g *colla
 		return nil, errors.New("memory: user and grantee are the same")
 	}
 
+	// reshares belong to the owner of the resource
+	owner, err := share.Owner(md)
+	if err != nil {
+		return nil, err
+	}
+	if g.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER &&
+		g.Grantee.Id.Idp == owner.Idp && g.Grantee.Id.OpaqueId == owner.OpaqueId {
+		return nil, errors.New("memory: owner and grantee are the same")
+	}
+
 	// check if share already exists.
 	key := &collaboration.ShareKey{
-		Owner:      user.Id,
+		Owner:      owner,
 		ResourceId: md.Id,
 		Grantee:    g.Grantee,
 	}
-	_, err := m.getByKey(ctx, key)
+	_, err = m.getByKey(ctx, key)
 	// share already exists
 	if err == nil {
 		return nil, errtypes.AlreadyExists(key.String())
@@ -100,7 +118,7 @@ func (m *manager) Share(ctx context.Context, md *provider.ResourceInfo, g *colla
 		ResourceId:  md.Id,
 		Permissions: g.Permissions,
 		Grantee:     g.Grantee,
-		Owner:       user.Id,
+		Owner:       owner,
 		Creator:     user.Id,
 		Ctime:       ts,
 		Mtime:       ts,
@@ -148,10 +166,8 @@ func (m *manager) get(ctx context.Context, ref *collaboration.ShareReference) (s
 		return nil, err
 	}
 
-	// check if we are the owner
-	// TODO(labkode): check for creator also.
-	user := user.ContextMustGetUser(ctx)
-	if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+	// check if we are the owner or the creator
+	if share.IsOwnerOrCreator(user.ContextMustGetUser(ctx), s) {
 		return s, nil
 	}
 
@@ -174,9 +190,11 @@ func (m *manager) Unshare(ctx context.Context, ref *collaboration.ShareReference
 	user := user.ContextMustGetUser(ctx)
 	for i, s := range m.shares {
 		if equal(ref, s) {
-			if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+			if share.IsOwnerOrCreator(user, s) {
 				m.shares[len(m.shares)-1], m.shares[i] = m.shares[i], m.shares[len(m.shares)-1]
 				m.shares = m.shares[:len(m.shares)-1]
+				delete(m.expirations, s.Id.OpaqueId)
+				delete(m.parents, s.Id.OpaqueId)
 				return nil
 			}
 		}
@@ -204,7 +222,7 @@ func (m *manager) UpdateShare(ctx context.Context, ref *collaboration.ShareRefer
 	user := user.ContextMustGetUser(ctx)
 	for i, s := range m.shares {
 		if equal(ref, s) {
-			if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+			if share.IsOwnerOrCreator(user, s) {
 				now := time.Now().UnixNano()
 				m.shares[i].Permissions = p
 				m.shares[i].Mtime = &typespb.Timestamp{
@@ -224,8 +242,7 @@ func (m *manager) ListShares(ctx context.Context, filters []*collaboration.ListS
 	defer m.lock.Unlock()
 	user := user.ContextMustGetUser(ctx)
 	for _, s := range m.shares {
-		// TODO(labkode): add check for creator.
-		if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+		if share.IsOwnerOrCreator(user, s) {
 			// no filter we return earlier
 			if len(filters) == 0 {
 				ss = append(ss, s)
@@ -252,9 +269,8 @@ func (m *manager) ListReceivedShares(ctx context.Context) ([]*collaboration.Rece
 	defer m.lock.Unlock()
 	user := user.ContextMustGetUser(ctx)
 	for _, s := range m.shares {
-		if user.Id.Idp == s.Owner.Idp && user.Id.OpaqueId == s.Owner.OpaqueId {
+		if share.IsOwnerOrCreator(user, s) {
 			// omit shares created by me
-			// TODO(labkode): apply check for s.Creator also.
 			continue
 		}
 		if s.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER {
@@ -337,3 +353,70 @@ func (m *manager) UpdateReceivedShare(ctx context.Context, ref *collaboration.Sh
 	}
 	return rs, nil
 }
+
+func (m *manager) SetShareExpiration(ctx context.Context, ref *collaboration.ShareReference, exp *typespb.Timestamp) error {
+	s, err := m.get(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if exp == nil {
+		delete(m.expirations, s.Id.OpaqueId)
+	} else {
+		m.expirations[s.Id.OpaqueId] = exp
+	}
+	return nil
+}
+
+func (m *manager) GetShareExpiration(ctx context.Context, id *collaboration.ShareId) (*typespb.Timestamp, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.expirations[id.OpaqueId], nil
+}
+
+func (m *manager) ListExpiredShares(ctx context.Context, t time.Time) ([]*collaboration.Share, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var ss []*collaboration.Share
+	for _, s := range m.shares {
+		if share.Expired(m.expirations[s.Id.OpaqueId], t) {
+			ss = append(ss, s)
+		}
+	}
+	return ss, nil
+}
+
+func (m *manager) SetShareParent(ctx context.Context, ref *collaboration.ShareReference, parent *collaboration.ShareId) error {
+	s, err := m.get(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.parents[s.Id.OpaqueId] = parent.OpaqueId
+	return nil
+}
+
+func (m *manager) GetShareParent(ctx context.Context, id *collaboration.ShareId) (*collaboration.ShareId, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if p, ok := m.parents[id.OpaqueId]; ok {
+		return &collaboration.ShareId{OpaqueId: p}, nil
+	}
+	return nil, nil
+}
+
+func (m *manager) ListChildShares(ctx context.Context, id *collaboration.ShareId) ([]*collaboration.Share, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var ss []*collaboration.Share
+	for _, s := range m.shares {
+		if m.parents[s.Id.OpaqueId] == id.OpaqueId {
+			ss = append(ss, s)
+		}
+	}
+	return ss, nil
+}
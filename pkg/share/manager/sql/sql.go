@@ -0,0 +1,639 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements a share manager backed by a MySQL or PostgreSQL database,
+// so that shares survive restarts and can be used from several gateways at once.
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/share"
+	"github.com/cs3org/reva/pkg/share/manager/registry"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+}
+
+type mgr struct {
+	c  *config
+	db *sql.DB
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new share manager backed by a SQL database.
+func New(m map[string]interface{}) (share.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, db: db}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "share_schema_migrations", migrations); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// migrations contains the schema changes in the order they are applied.
+// The applied version is tracked in the share_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS shares (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		share_key VARCHAR(64) NOT NULL UNIQUE,
+		owner_idp VARCHAR(255) NOT NULL,
+		owner_opaque_id VARCHAR(255) NOT NULL,
+		creator_idp VARCHAR(255) NOT NULL,
+		creator_opaque_id VARCHAR(255) NOT NULL,
+		resource_storage_id VARCHAR(255) NOT NULL,
+		resource_opaque_id VARCHAR(255) NOT NULL,
+		grantee_type INTEGER NOT NULL,
+		grantee_idp VARCHAR(255) NOT NULL,
+		grantee_opaque_id VARCHAR(255) NOT NULL,
+		permissions TEXT NOT NULL,
+		ctime BIGINT NOT NULL,
+		mtime BIGINT NOT NULL
+	)`,
+	`CREATE INDEX shares_owner ON shares (owner_idp, owner_opaque_id)`,
+	`CREATE INDEX shares_grantee ON shares (grantee_type, grantee_opaque_id)`,
+	`CREATE TABLE IF NOT EXISTS share_states (
+		share_id VARCHAR(64) NOT NULL,
+		user_idp VARCHAR(255) NOT NULL,
+		user_opaque_id VARCHAR(255) NOT NULL,
+		state INTEGER NOT NULL,
+		PRIMARY KEY (share_id, user_idp, user_opaque_id)
+	)`,
+	`ALTER TABLE shares ADD COLUMN expiration BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE shares ADD COLUMN parent_id VARCHAR(64) NOT NULL DEFAULT ''`,
+	`CREATE INDEX shares_parent ON shares (parent_id)`,
+}
+
+const shareColumns = "id, owner_idp, owner_opaque_id, creator_idp, creator_opaque_id, resource_storage_id, resource_opaque_id, grantee_type, grantee_idp, grantee_opaque_id, permissions, ctime, mtime"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanShare(row scanner) (*collaboration.Share, error) {
+	var (
+		id, ownerIdp, ownerID, creatorIdp, creatorID string
+		storageID, opaqueID, granteeIdp, granteeID   string
+		permissions                                  string
+		granteeType                                  int32
+		ctime, mtime                                 int64
+	)
+	if err := row.Scan(&id, &ownerIdp, &ownerID, &creatorIdp, &creatorID, &storageID, &opaqueID, &granteeType, &granteeIdp, &granteeID, &permissions, &ctime, &mtime); err != nil {
+		return nil, err
+	}
+
+	perms := &provider.ResourcePermissions{}
+	if err := json.Unmarshal([]byte(permissions), perms); err != nil {
+		return nil, errors.Wrap(err, "sql: error decoding permissions")
+	}
+
+	return &collaboration.Share{
+		Id:          &collaboration.ShareId{OpaqueId: id},
+		ResourceId:  &provider.ResourceId{StorageId: storageID, OpaqueId: opaqueID},
+		Permissions: &collaboration.SharePermissions{Permissions: perms},
+		Grantee: &provider.Grantee{
+			Type: provider.GranteeType(granteeType),
+			Id:   &userpb.UserId{Idp: granteeIdp, OpaqueId: granteeID},
+		},
+		Owner:   &userpb.UserId{Idp: ownerIdp, OpaqueId: ownerID},
+		Creator: &userpb.UserId{Idp: creatorIdp, OpaqueId: creatorID},
+		Ctime:   toTimestamp(ctime),
+		Mtime:   toTimestamp(mtime),
+	}, nil
+}
+
+func toTimestamp(ns int64) *typespb.Timestamp {
+	return &typespb.Timestamp{
+		Seconds: uint64(ns / 1000000000),
+		Nanos:   uint32(ns % 1000000000),
+	}
+}
+
+// hashKey returns a fixed length representation of the share key
+// that is used to enforce uniqueness at the database level.
+func hashKey(key *collaboration.ShareKey) string {
+	h := sha256.New()
+	for _, s := range []string{
+		key.Owner.Idp, key.Owner.OpaqueId,
+		key.ResourceId.StorageId, key.ResourceId.OpaqueId,
+		key.Grantee.Type.String(), key.Grantee.Id.Idp, key.Grantee.Id.OpaqueId,
+	} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func encodePermissions(p *collaboration.SharePermissions) (string, error) {
+	data, err := json.Marshal(p.GetPermissions())
+	if err != nil {
+		return "", errors.Wrap(err, "sql: error encoding permissions")
+	}
+	return string(data), nil
+}
+
+func (m *mgr) Share(ctx context.Context, md *provider.ResourceInfo, g *collaboration.ShareGrant) (*collaboration.Share, error) {
+	user := user.ContextMustGetUser(ctx)
+
+	// do not allow share to myself if share is for a user
+	if g.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER &&
+		g.Grantee.Id.Idp == user.Id.Idp && g.Grantee.Id.OpaqueId == user.Id.OpaqueId {
+		return nil, errors.New("sql: user and grantee are the same")
+	}
+
+	// reshares belong to the owner of the resource
+	owner, err := share.Owner(md)
+	if err != nil {
+		return nil, err
+	}
+	if g.Grantee.Type == provider.GranteeType_GRANTEE_TYPE_USER &&
+		g.Grantee.Id.Idp == owner.Idp && g.Grantee.Id.OpaqueId == owner.OpaqueId {
+		return nil, errors.New("sql: owner and grantee are the same")
+	}
+
+	key := &collaboration.ShareKey{
+		Owner:      owner,
+		ResourceId: md.Id,
+		Grantee:    g.Grantee,
+	}
+	if _, err := m.getByKey(ctx, key); err == nil {
+		return nil, errtypes.AlreadyExists(key.String())
+	}
+
+	perms, err := encodePermissions(g.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	s := &collaboration.Share{
+		Id:          &collaboration.ShareId{OpaqueId: uuid.New().String()},
+		ResourceId:  md.Id,
+		Permissions: g.Permissions,
+		Grantee:     g.Grantee,
+		Owner:       owner,
+		Creator:     user.Id,
+		Ctime:       toTimestamp(now),
+		Mtime:       toTimestamp(now),
+	}
+
+	query := "INSERT INTO shares (id, share_key, owner_idp, owner_opaque_id, creator_idp, creator_opaque_id, resource_storage_id, resource_opaque_id, grantee_type, grantee_idp, grantee_opaque_id, permissions, ctime, mtime) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query),
+		s.Id.OpaqueId, hashKey(key),
+		s.Owner.Idp, s.Owner.OpaqueId, s.Creator.Idp, s.Creator.OpaqueId,
+		s.ResourceId.StorageId, s.ResourceId.OpaqueId,
+		int32(s.Grantee.Type), s.Grantee.Id.Idp, s.Grantee.Id.OpaqueId,
+		perms, now, now)
+	if err != nil {
+		// the unique constraint protects us from concurrent creations on other gateways
+		if _, err := m.getByKey(ctx, key); err == nil {
+			return nil, errtypes.AlreadyExists(key.String())
+		}
+		return nil, errors.Wrap(err, "sql: error inserting share")
+	}
+
+	return s, nil
+}
+
+func (m *mgr) getByID(ctx context.Context, id *collaboration.ShareId) (*collaboration.Share, error) {
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT "+shareColumns+" FROM shares WHERE id = ?"), id.OpaqueId)
+	s, err := scanShare(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.NotFound(id.String())
+		}
+		return nil, errors.Wrap(err, "sql: error getting share")
+	}
+	return s, nil
+}
+
+func (m *mgr) getByKey(ctx context.Context, key *collaboration.ShareKey) (*collaboration.Share, error) {
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT "+shareColumns+" FROM shares WHERE share_key = ?"), hashKey(key))
+	s, err := scanShare(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.NotFound(key.String())
+		}
+		return nil, errors.Wrap(err, "sql: error getting share")
+	}
+	return s, nil
+}
+
+func (m *mgr) get(ctx context.Context, ref *collaboration.ShareReference) (s *collaboration.Share, err error) {
+	switch {
+	case ref.GetId() != nil:
+		s, err = m.getByID(ctx, ref.GetId())
+	case ref.GetKey() != nil:
+		s, err = m.getByKey(ctx, ref.GetKey())
+	default:
+		err = errtypes.NotFound(ref.String())
+	}
+	return
+}
+
+func isGrantee(u *userpb.User, s *collaboration.Share) bool {
+	switch s.Grantee.Type {
+	case provider.GranteeType_GRANTEE_TYPE_USER:
+		return u.Id.Idp == s.Grantee.Id.Idp && u.Id.OpaqueId == s.Grantee.Id.OpaqueId
+	case provider.GranteeType_GRANTEE_TYPE_GROUP:
+		for _, g := range u.Groups {
+			if g == s.Grantee.Id.OpaqueId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *mgr) GetShare(ctx context.Context, ref *collaboration.ShareReference) (*collaboration.Share, error) {
+	s, err := m.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// we return not found to not disclose information
+	if !share.IsOwnerOrCreator(user.ContextMustGetUser(ctx), s) {
+		return nil, errtypes.NotFound(ref.String())
+	}
+	return s, nil
+}
+
+func (m *mgr) Unshare(ctx context.Context, ref *collaboration.ShareReference) error {
+	s, err := m.GetShare(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "sql: error starting transaction")
+	}
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "DELETE FROM share_states WHERE share_id = ?"), s.Id.OpaqueId); err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "sql: error deleting share states")
+	}
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "DELETE FROM shares WHERE id = ?"), s.Id.OpaqueId); err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "sql: error deleting share")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "sql: error committing transaction")
+	}
+	return nil
+}
+
+func (m *mgr) UpdateShare(ctx context.Context, ref *collaboration.ShareReference, p *collaboration.SharePermissions) (*collaboration.Share, error) {
+	s, err := m.GetShare(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	perms, err := encodePermissions(p)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "UPDATE shares SET permissions = ?, mtime = ? WHERE id = ?"), perms, now, s.Id.OpaqueId); err != nil {
+		return nil, errors.Wrap(err, "sql: error updating share")
+	}
+
+	s.Permissions = p
+	s.Mtime = toTimestamp(now)
+	return s, nil
+}
+
+func (m *mgr) ListShares(ctx context.Context, filters []*collaboration.ListSharesRequest_Filter) ([]*collaboration.Share, error) {
+	return m.QueryShares(ctx, filters, &share.Query{})
+}
+
+// QueryShares lists the shares created by the user, filtered and paginated
+// in the database.
+func (m *mgr) QueryShares(ctx context.Context, filters []*collaboration.ListSharesRequest_Filter, q *share.Query) ([]*collaboration.Share, error) {
+	user := user.ContextMustGetUser(ctx)
+
+	query := "SELECT " + shareColumns + " FROM shares WHERE ((owner_idp = ? AND owner_opaque_id = ?) OR (creator_idp = ? AND creator_opaque_id = ?))"
+	params := []interface{}{user.Id.Idp, user.Id.OpaqueId, user.Id.Idp, user.Id.OpaqueId}
+
+	// TODO(labkode): add the rest of filters.
+	conds := []string{}
+	for _, f := range filters {
+		if f.Type == collaboration.ListSharesRequest_Filter_TYPE_RESOURCE_ID {
+			conds = append(conds, "(resource_storage_id = ? AND resource_opaque_id = ?)")
+			params = append(params, f.GetResourceId().StorageId, f.GetResourceId().OpaqueId)
+		}
+	}
+	if len(conds) > 0 {
+		query += " AND (" + strings.Join(conds, " OR ") + ")"
+	}
+
+	query, params = m.applyQuery(query, params, q)
+	return m.queryShares(ctx, query, params...)
+}
+
+// applyQuery adds the conditions on the grantee types and the pagination of
+// q to the query selecting shares.
+func (m *mgr) applyQuery(query string, params []interface{}, q *share.Query) (string, []interface{}) {
+	if len(q.GranteeTypes) > 0 {
+		query += " AND grantee_type IN (?" + strings.Repeat(", ?", len(q.GranteeTypes)-1) + ")"
+		for _, t := range q.GranteeTypes {
+			params = append(params, int32(t))
+		}
+	}
+	if q.Offset == 0 && q.Limit == 0 {
+		return query, params
+	}
+
+	// a stable order for the pages
+	query += " ORDER BY ctime, id"
+	switch {
+	case q.Limit > 0:
+		query += " LIMIT ? OFFSET ?"
+		params = append(params, q.Limit, q.Offset)
+	case m.c.DBDriver == "mysql":
+		// mysql has no offset without limit
+		query += " LIMIT 18446744073709551615 OFFSET ?"
+		params = append(params, q.Offset)
+	default:
+		query += " OFFSET ?"
+		params = append(params, q.Offset)
+	}
+	return query, params
+}
+
+func (m *mgr) queryShares(ctx context.Context, query string, params ...interface{}) ([]*collaboration.Share, error) {
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing shares")
+	}
+	defer rows.Close()
+
+	var ss []*collaboration.Share
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "sql: error scanning share")
+		}
+		ss = append(ss, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "sql: error listing shares")
+	}
+	return ss, nil
+}
+
+// we list the shares that are targeted to the user in context or to the user groups.
+func (m *mgr) ListReceivedShares(ctx context.Context) ([]*collaboration.ReceivedShare, error) {
+	return m.QueryReceivedShares(ctx, &share.Query{})
+}
+
+// QueryReceivedShares lists the shares the user has access to, filtered and
+// paginated in the database. The expired shares are hidden until they are
+// cleaned up.
+func (m *mgr) QueryReceivedShares(ctx context.Context, q *share.Query) ([]*collaboration.ReceivedShare, error) {
+	user := user.ContextMustGetUser(ctx)
+
+	// omit shares created by me
+	query := "SELECT " + shareColumns + " FROM shares WHERE NOT (owner_idp = ? AND owner_opaque_id = ?) AND NOT (creator_idp = ? AND creator_opaque_id = ?) AND ((grantee_type = ? AND grantee_idp = ? AND grantee_opaque_id = ?)"
+	params := []interface{}{
+		user.Id.Idp, user.Id.OpaqueId,
+		user.Id.Idp, user.Id.OpaqueId,
+		int32(provider.GranteeType_GRANTEE_TYPE_USER), user.Id.Idp, user.Id.OpaqueId,
+	}
+	if len(user.Groups) > 0 {
+		query += " OR (grantee_type = ? AND grantee_opaque_id IN (?" + strings.Repeat(", ?", len(user.Groups)-1) + "))"
+		params = append(params, int32(provider.GranteeType_GRANTEE_TYPE_GROUP))
+		for _, g := range user.Groups {
+			params = append(params, g)
+		}
+	}
+	query += ")"
+
+	query += " AND (expiration = 0 OR expiration > ?)"
+	params = append(params, time.Now().Unix())
+	if len(q.States) > 0 {
+		// the shares never answered have no state
+		query += " AND COALESCE((SELECT state FROM share_states WHERE share_id = shares.id AND user_idp = ? AND user_opaque_id = ?), 0) IN (?" + strings.Repeat(", ?", len(q.States)-1) + ")"
+		params = append(params, user.Id.Idp, user.Id.OpaqueId)
+		for _, st := range q.States {
+			params = append(params, int32(st))
+		}
+	}
+	query, params = m.applyQuery(query, params, q)
+
+	ss, err := m.queryShares(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := m.getStates(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	rss := make([]*collaboration.ReceivedShare, 0, len(ss))
+	for _, s := range ss {
+		rss = append(rss, &collaboration.ReceivedShare{Share: s, State: states[s.Id.OpaqueId]})
+	}
+	return rss, nil
+}
+
+func (m *mgr) getStates(ctx context.Context, u *userpb.User) (map[string]collaboration.ShareState, error) {
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT share_id, state FROM share_states WHERE user_idp = ? AND user_opaque_id = ?"), u.Id.Idp, u.Id.OpaqueId)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error listing share states")
+	}
+	defer rows.Close()
+
+	states := map[string]collaboration.ShareState{}
+	for rows.Next() {
+		var id string
+		var state int32
+		if err := rows.Scan(&id, &state); err != nil {
+			return nil, errors.Wrap(err, "sql: error scanning share state")
+		}
+		states[id] = collaboration.ShareState(state)
+	}
+	return states, rows.Err()
+}
+
+func (m *mgr) GetReceivedShare(ctx context.Context, ref *collaboration.ShareReference) (*collaboration.ReceivedShare, error) {
+	user := user.ContextMustGetUser(ctx)
+	s, err := m.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isGrantee(user, s) {
+		return nil, errtypes.NotFound(ref.String())
+	}
+	// like in the listings, the expired shares are not found
+	exp, err := m.GetShareExpiration(ctx, s.Id)
+	if err != nil {
+		return nil, err
+	}
+	if share.Expired(exp, time.Now()) {
+		return nil, errtypes.NotFound(ref.String())
+	}
+
+	rs := &collaboration.ReceivedShare{Share: s}
+	var state int32
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT state FROM share_states WHERE share_id = ? AND user_idp = ? AND user_opaque_id = ?"), s.Id.OpaqueId, user.Id.Idp, user.Id.OpaqueId)
+	switch err := row.Scan(&state); err {
+	case nil:
+		rs.State = collaboration.ShareState(state)
+	case sql.ErrNoRows:
+	default:
+		return nil, errors.Wrap(err, "sql: error getting share state")
+	}
+	return rs, nil
+}
+
+func (m *mgr) UpdateReceivedShare(ctx context.Context, ref *collaboration.ShareReference, f *collaboration.UpdateReceivedShareRequest_UpdateField) (*collaboration.ReceivedShare, error) {
+	rs, err := m.GetReceivedShare(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	user := user.ContextMustGetUser(ctx)
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error starting transaction")
+	}
+	// delete and insert instead of an upsert, which is not portable between databases.
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "DELETE FROM share_states WHERE share_id = ? AND user_idp = ? AND user_opaque_id = ?"), rs.Share.Id.OpaqueId, user.Id.Idp, user.Id.OpaqueId); err != nil {
+		_ = tx.Rollback()
+		return nil, errors.Wrap(err, "sql: error updating share state")
+	}
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "INSERT INTO share_states (share_id, user_idp, user_opaque_id, state) VALUES (?, ?, ?, ?)"), rs.Share.Id.OpaqueId, user.Id.Idp, user.Id.OpaqueId, int32(f.GetState())); err != nil {
+		_ = tx.Rollback()
+		return nil, errors.Wrap(err, "sql: error updating share state")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "sql: error committing transaction")
+	}
+
+	rs.State = f.GetState()
+	return rs, nil
+}
+
+func (m *mgr) SetShareExpiration(ctx context.Context, ref *collaboration.ShareReference, exp *typespb.Timestamp) error {
+	s, err := m.GetShare(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	var secs uint64
+	if exp != nil {
+		secs = exp.Seconds
+	}
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "UPDATE shares SET expiration = ? WHERE id = ?"), secs, s.Id.OpaqueId); err != nil {
+		return errors.Wrap(err, "sql: error updating share expiration")
+	}
+	return nil
+}
+
+func (m *mgr) GetShareExpiration(ctx context.Context, id *collaboration.ShareId) (*typespb.Timestamp, error) {
+	var secs uint64
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT expiration FROM shares WHERE id = ?"), id.OpaqueId)
+	if err := row.Scan(&secs); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.NotFound(id.String())
+		}
+		return nil, errors.Wrap(err, "sql: error getting share expiration")
+	}
+	if secs == 0 {
+		return nil, nil
+	}
+	return &typespb.Timestamp{Seconds: secs}, nil
+}
+
+func (m *mgr) ListExpiredShares(ctx context.Context, t time.Time) ([]*collaboration.Share, error) {
+	return m.queryShares(ctx, "SELECT "+shareColumns+" FROM shares WHERE expiration > 0 AND expiration <= ?", t.Unix())
+}
+
+func (m *mgr) SetShareParent(ctx context.Context, ref *collaboration.ShareReference, parent *collaboration.ShareId) error {
+	s, err := m.GetShare(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "UPDATE shares SET parent_id = ? WHERE id = ?"), parent.OpaqueId, s.Id.OpaqueId); err != nil {
+		return errors.Wrap(err, "sql: error updating share parent")
+	}
+	return nil
+}
+
+func (m *mgr) GetShareParent(ctx context.Context, id *collaboration.ShareId) (*collaboration.ShareId, error) {
+	var parent string
+	row := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT parent_id FROM shares WHERE id = ?"), id.OpaqueId)
+	if err := row.Scan(&parent); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.NotFound(id.String())
+		}
+		return nil, errors.Wrap(err, "sql: error getting share parent")
+	}
+	if parent == "" {
+		return nil, nil
+	}
+	return &collaboration.ShareId{OpaqueId: parent}, nil
+}
+
+func (m *mgr) ListChildShares(ctx context.Context, id *collaboration.ShareId) ([]*collaboration.Share, error) {
+	return m.queryShares(ctx, "SELECT "+shareColumns+" FROM shares WHERE parent_id = ?", id.OpaqueId)
+}
@@ -0,0 +1,198 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/share"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func newTestManager(t *testing.T) *mgr {
+	m := &mgr{c: &config{Config: sqlutil.Config{DBDriver: sqlitetest.Driver}}, db: sqlitetest.Open(t)}
+	if err := sqlutil.Migrate(context.Background(), m.db, m.c.DBDriver, "share_schema_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestApplyQuery(t *testing.T) {
+	group := provider.GranteeType_GRANTEE_TYPE_GROUP
+	tests := []struct {
+		driver         string
+		q              *share.Query
+		expected       string
+		expectedParams []interface{}
+	}{
+		{"mysql", &share.Query{}, "SELECT", nil},
+		{"mysql", &share.Query{GranteeTypes: []provider.GranteeType{group}}, "SELECT AND grantee_type IN (?)", []interface{}{int32(group)}},
+		{"mysql", &share.Query{Offset: 10, Limit: 5}, "SELECT ORDER BY ctime, id LIMIT ? OFFSET ?", []interface{}{5, 10}},
+		{"mysql", &share.Query{Offset: 10}, "SELECT ORDER BY ctime, id LIMIT 18446744073709551615 OFFSET ?", []interface{}{10}},
+		{"postgres", &share.Query{Offset: 10}, "SELECT ORDER BY ctime, id OFFSET ?", []interface{}{10}},
+	}
+
+	for _, tt := range tests {
+		m := &mgr{c: &config{Config: sqlutil.Config{DBDriver: tt.driver}}}
+		query, params := m.applyQuery("SELECT", nil, tt.q)
+		if query != tt.expected || !reflect.DeepEqual(params, tt.expectedParams) {
+			t.Errorf("applyQuery(%+v) for %s: got %q %v, expected %q %v", tt.q, tt.driver, query, params, tt.expected, tt.expectedParams)
+		}
+	}
+}
+
+func TestShares(t *testing.T) {
+	m := newTestManager(t)
+	einstein := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "einstein"}, Username: "einstein"}
+	marie := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "marie"}, Username: "marie", Groups: []string{"physics"}}
+	richard := &userpb.User{Id: &userpb.UserId{Idp: "idp", OpaqueId: "richard"}, Username: "richard", Groups: []string{"physics"}}
+	owner := user.ContextSetUser(context.Background(), einstein)
+	recipient := user.ContextSetUser(context.Background(), marie)
+	member := user.ContextSetUser(context.Background(), richard)
+
+	info := &provider.ResourceInfo{Id: &provider.ResourceId{StorageId: "s", OpaqueId: "o"}, Owner: einstein.Id}
+	grant := func(t provider.GranteeType, id string) *collaboration.ShareGrant {
+		return &collaboration.ShareGrant{
+			Grantee:     &provider.Grantee{Type: t, Id: &userpb.UserId{Idp: "idp", OpaqueId: id}},
+			Permissions: &collaboration.SharePermissions{Permissions: &provider.ResourcePermissions{Stat: true}},
+		}
+	}
+
+	s, err := m.Share(owner, info, grant(provider.GranteeType_GRANTEE_TYPE_USER, "marie"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Share(owner, info, grant(provider.GranteeType_GRANTEE_TYPE_USER, "marie")); err == nil {
+		t.Error("expected the same share to be refused")
+	} else if _, ok := err.(errtypes.IsAlreadyExists); !ok {
+		t.Errorf("expected already exists, got %v", err)
+	}
+	g, err := m.Share(owner, info, grant(provider.GranteeType_GRANTEE_TYPE_GROUP, "physics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := &collaboration.ShareReference{Spec: &collaboration.ShareReference_Id{Id: s.Id}}
+
+	// get
+	got, err := m.GetShare(owner, ref)
+	if err != nil || got.Grantee.Id.OpaqueId != "marie" || !got.Permissions.Permissions.Stat {
+		t.Errorf("GetShare() = %v, %v", got, err)
+	}
+	if _, err := m.GetShare(recipient, ref); err == nil {
+		t.Error("expected the share to be hidden from the recipient")
+	}
+	key := &collaboration.ShareReference{Spec: &collaboration.ShareReference_Key{Key: &collaboration.ShareKey{Owner: einstein.Id, ResourceId: info.Id, Grantee: s.Grantee}}}
+	if got, err := m.GetShare(owner, key); err != nil || got.Id.OpaqueId != s.Id.OpaqueId {
+		t.Errorf("GetShare() by key = %v, %v", got, err)
+	}
+
+	// list
+	if shares, err := m.ListShares(owner, nil); err != nil || len(shares) != 2 {
+		t.Errorf("ListShares() = %v, %v", shares, err)
+	}
+	filter := &collaboration.ListSharesRequest_Filter{
+		Type: collaboration.ListSharesRequest_Filter_TYPE_RESOURCE_ID,
+		Term: &collaboration.ListSharesRequest_Filter_ResourceId{ResourceId: &provider.ResourceId{StorageId: "s", OpaqueId: "other"}},
+	}
+	if shares, err := m.ListShares(owner, []*collaboration.ListSharesRequest_Filter{filter}); err != nil || len(shares) != 0 {
+		t.Errorf("ListShares() of another resource = %v, %v", shares, err)
+	}
+	if shares, err := m.ListShares(recipient, nil); err != nil || len(shares) != 0 {
+		t.Errorf("ListShares() of the recipient = %v, %v", shares, err)
+	}
+
+	// update
+	perms := &collaboration.SharePermissions{Permissions: &provider.ResourcePermissions{Stat: true, InitiateFileDownload: true}}
+	if _, err := m.UpdateShare(recipient, ref, perms); err == nil {
+		t.Error("expected the recipient not to update the share")
+	}
+	if _, err := m.UpdateShare(owner, ref, perms); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.GetShare(owner, ref); err != nil || !got.Permissions.Permissions.InitiateFileDownload {
+		t.Errorf("GetShare() after update = %v, %v", got, err)
+	}
+
+	// received shares and their state
+	if rss, err := m.ListReceivedShares(recipient); err != nil || len(rss) != 2 {
+		t.Fatalf("ListReceivedShares() = %v, %v", rss, err)
+	}
+	if rss, err := m.ListReceivedShares(member); err != nil || len(rss) != 1 || rss[0].Share.Id.OpaqueId != g.Id.OpaqueId {
+		t.Errorf("ListReceivedShares() of the group member = %v, %v", rss, err)
+	}
+	if _, err := m.GetReceivedShare(member, ref); err == nil {
+		t.Error("expected the share of another user to be hidden")
+	}
+	field := &collaboration.UpdateReceivedShareRequest_UpdateField{
+		Field: &collaboration.UpdateReceivedShareRequest_UpdateField_State{State: collaboration.ShareState_SHARE_STATE_ACCEPTED},
+	}
+	if _, err := m.UpdateReceivedShare(recipient, ref, field); err != nil {
+		t.Fatal(err)
+	}
+	if rs, err := m.GetReceivedShare(recipient, ref); err != nil || rs.State != collaboration.ShareState_SHARE_STATE_ACCEPTED {
+		t.Errorf("GetReceivedShare() = %v, %v", rs, err)
+	}
+	accepted, err := m.QueryReceivedShares(recipient, &share.Query{States: []collaboration.ShareState{collaboration.ShareState_SHARE_STATE_ACCEPTED}})
+	if err != nil || len(accepted) != 1 || accepted[0].Share.Id.OpaqueId != s.Id.OpaqueId {
+		t.Errorf("QueryReceivedShares() of the accepted shares = %v, %v", accepted, err)
+	}
+
+	// the expired shares are hidden from their recipients
+	if err := m.SetShareExpiration(owner, ref, &typespb.Timestamp{Seconds: uint64(time.Now().Add(-time.Minute).Unix())}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetReceivedShare(recipient, ref); err == nil {
+		t.Error("expected the expired share not to be found")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if rss, err := m.ListReceivedShares(recipient); err != nil || len(rss) != 1 || rss[0].Share.Id.OpaqueId != g.Id.OpaqueId {
+		t.Errorf("ListReceivedShares() with an expired share = %v, %v", rss, err)
+	}
+	if rss, err := m.QueryReceivedShares(recipient, &share.Query{}); err != nil || len(rss) != 1 || rss[0].Share.Id.OpaqueId != g.Id.OpaqueId {
+		t.Errorf("QueryReceivedShares() with an expired share = %v, %v", rss, err)
+	}
+	if expired, err := m.ListExpiredShares(context.Background(), time.Now()); err != nil || len(expired) != 1 {
+		t.Errorf("ListExpiredShares() = %v, %v", expired, err)
+	}
+
+	// delete
+	if err := m.Unshare(recipient, ref); err == nil {
+		t.Error("expected the recipient not to delete the share")
+	}
+	if err := m.Unshare(owner, ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetShare(owner, ref); err == nil {
+		t.Error("expected the deleted share not to be found")
+	}
+	if shares, err := m.ListShares(owner, nil); err != nil || len(shares) != 1 {
+		t.Errorf("ListShares() after unshare = %v, %v", shares, err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package share
+
+import (
+	"context"
+	"encoding/json"
+
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/pkg/errors"
+)
+
+// The CS3 collaboration API only filters the shares by resource, owner and
+// creator, so the other filters and the pagination travel in the opaque
+// data of the list requests.
+const OpaqueQuery = "query"
+
+// Query narrows down and paginates the listed shares. The zero Query
+// matches all the shares.
+type Query struct {
+	// GranteeTypes are the accepted types of grantees, any if empty.
+	GranteeTypes []provider.GranteeType `json:"grantee_types,omitempty"`
+	// States are the accepted states of the received shares, any if empty.
+	States []collaboration.ShareState `json:"states,omitempty"`
+	// Offset is the number of matching shares skipped and Limit the
+	// maximum number returned, 0 meaning no limit.
+	Offset int `json:"offset,omitempty"`
+	Limit  int `json:"limit,omitempty"`
+}
+
+// Querier is implemented by the share managers applying the queries
+// themselves, like the sql one does in the database. The others are
+// filtered and paginated by the share provider.
+type Querier interface {
+	// QueryShares returns the shares created by the user matching the
+	// filters and the query.
+	QueryShares(ctx context.Context, filters []*collaboration.ListSharesRequest_Filter, q *Query) ([]*collaboration.Share, error)
+	// QueryReceivedShares returns the shares the user has access to
+	// matching the query, without the expired ones.
+	QueryReceivedShares(ctx context.Context, q *Query) ([]*collaboration.ReceivedShare, error)
+}
+
+// QueryToOpaque returns the opaque data carrying the query.
+func QueryToOpaque(q *Query) (*typespb.Opaque, error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, errors.Wrap(err, "share: error encoding query")
+	}
+	return &typespb.Opaque{
+		Map: map[string]*typespb.OpaqueEntry{
+			OpaqueQuery: {Decoder: "json", Value: data},
+		},
+	}, nil
+}
+
+// QueryFromOpaque returns the query carried by the opaque data, the zero
+// Query if there is none.
+func QueryFromOpaque(o *typespb.Opaque) (*Query, error) {
+	q := &Query{}
+	e, ok := o.GetMap()[OpaqueQuery]
+	if !ok {
+		return q, nil
+	}
+	if e.Decoder != "json" {
+		return nil, errors.New("share: unsupported query decoder " + e.Decoder)
+	}
+	if err := json.Unmarshal(e.Value, q); err != nil {
+		return nil, errors.Wrap(err, "share: error decoding query")
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return nil, errors.New("share: offset and limit must not be negative")
+	}
+	return q, nil
+}
+
+// MatchShare tells whether the share matches the grantee types of the query.
+func (q *Query) MatchShare(s *collaboration.Share) bool {
+	if len(q.GranteeTypes) == 0 {
+		return true
+	}
+	for _, t := range q.GranteeTypes {
+		if s.GetGrantee().GetType() == t {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchReceivedShare tells whether the received share matches the grantee
+// types and the states of the query.
+func (q *Query) MatchReceivedShare(rs *collaboration.ReceivedShare) bool {
+	if !q.MatchShare(rs.Share) {
+		return false
+	}
+	if len(q.States) == 0 {
+		return true
+	}
+	for _, st := range q.States {
+		if rs.State == st {
+			return true
+		}
+	}
+	return false
+}
+
+// Page returns the bounds of the page of the query in a list of n shares.
+func (q *Query) Page(n int) (int, int) {
+	start := q.Offset
+	if start > n {
+		start = n
+	}
+	end := n
+	if q.Limit > 0 && start+q.Limit < n {
+		end = start + q.Limit
+	}
+	return start, end
+}
@@ -0,0 +1,92 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package share
+
+import (
+	"testing"
+
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+func TestQueryOpaque(t *testing.T) {
+	q := &Query{
+		GranteeTypes: []provider.GranteeType{provider.GranteeType_GRANTEE_TYPE_GROUP},
+		States:       []collaboration.ShareState{collaboration.ShareState_SHARE_STATE_PENDING},
+		Offset:       10,
+		Limit:        5,
+	}
+	o, err := QueryToOpaque(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := QueryFromOpaque(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.GranteeTypes) != 1 || len(got.States) != 1 || got.Offset != 10 || got.Limit != 5 {
+		t.Fatalf("unexpected query %+v", got)
+	}
+
+	if got, err := QueryFromOpaque(nil); err != nil || got.Limit != 0 || len(got.GranteeTypes) != 0 {
+		t.Fatalf("expected the zero query, got %+v, %v", got, err)
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	group := &collaboration.Share{Grantee: &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_GROUP}}
+	user := &collaboration.Share{Grantee: &provider.Grantee{Type: provider.GranteeType_GRANTEE_TYPE_USER}}
+
+	q := &Query{}
+	if !q.MatchShare(group) || !q.MatchShare(user) {
+		t.Fatal("expected the zero query to match every share")
+	}
+
+	q = &Query{
+		GranteeTypes: []provider.GranteeType{provider.GranteeType_GRANTEE_TYPE_GROUP},
+		States:       []collaboration.ShareState{collaboration.ShareState_SHARE_STATE_ACCEPTED},
+	}
+	if !q.MatchShare(group) || q.MatchShare(user) {
+		t.Fatal("expected only the group share to match")
+	}
+	if q.MatchReceivedShare(&collaboration.ReceivedShare{Share: group, State: collaboration.ShareState_SHARE_STATE_PENDING}) {
+		t.Fatal("expected the pending share not to match")
+	}
+	if !q.MatchReceivedShare(&collaboration.ReceivedShare{Share: group, State: collaboration.ShareState_SHARE_STATE_ACCEPTED}) {
+		t.Fatal("expected the accepted share to match")
+	}
+}
+
+func TestQueryPage(t *testing.T) {
+	tests := []struct {
+		offset, limit, n, start, end int
+	}{
+		{0, 0, 7, 0, 7},
+		{2, 0, 7, 2, 7},
+		{2, 3, 7, 2, 5},
+		{5, 3, 7, 5, 7},
+		{9, 3, 7, 7, 7},
+	}
+	for _, tt := range tests {
+		q := &Query{Offset: tt.offset, Limit: tt.limit}
+		if start, end := q.Page(tt.n); start != tt.start || end != tt.end {
+			t.Errorf("page offset=%d limit=%d of %d: got [%d:%d], expected [%d:%d]", tt.offset, tt.limit, tt.n, start, end, tt.start, tt.end)
+		}
+	}
+}
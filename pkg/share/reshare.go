@@ -0,0 +1,115 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package share
+
+import (
+	"encoding/json"
+	"reflect"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+)
+
+// OpaqueShares holds the reshares affected by the removal or update of a
+// share as a json list, so that their storage grants can be changed too.
+const OpaqueShares = "shares"
+
+// Owner returns the owner of the shares of the resource. The resource info
+// must come from the storage, resources whose owner it does not report can
+// not be shared, so that nobody passes for the owner of a received share.
+func Owner(md *provider.ResourceInfo) (*userpb.UserId, error) {
+	if md.GetOwner().GetOpaqueId() == "" {
+		return nil, errtypes.PermissionDenied("share: the owner of the resource is unknown")
+	}
+	return md.Owner, nil
+}
+
+// IsOwnerOrCreator tells if the user owns the shared resource or created the share.
+func IsOwnerOrCreator(u *userpb.User, s *collaboration.Share) bool {
+	return sameUser(u.Id, s.Owner) || sameUser(u.Id, s.Creator)
+}
+
+func sameUser(a, b *userpb.UserId) bool {
+	return a.GetIdp() == b.GetIdp() && a.GetOpaqueId() == b.GetOpaqueId()
+}
+
+// IsSubset tells if all the permissions of p are granted by parent.
+func IsSubset(p, parent *provider.ResourcePermissions) bool {
+	return reflect.DeepEqual(Intersect(p, parent), normalize(p))
+}
+
+// Intersect returns the permissions granted by both p and parent.
+func Intersect(p, parent *provider.ResourcePermissions) *provider.ResourcePermissions {
+	res := normalize(p)
+	rv, pv := reflect.ValueOf(res).Elem(), reflect.ValueOf(normalize(parent)).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		if f := rv.Field(i); f.Kind() == reflect.Bool && f.CanSet() {
+			f.SetBool(f.Bool() && pv.Field(i).Bool())
+		}
+	}
+	return res
+}
+
+// normalize returns a copy of the permissions holding only the bool flags.
+func normalize(p *provider.ResourcePermissions) *provider.ResourcePermissions {
+	res := &provider.ResourcePermissions{}
+	if p == nil {
+		return res
+	}
+	rv, pv := reflect.ValueOf(res).Elem(), reflect.ValueOf(p).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		if f := rv.Field(i); f.Kind() == reflect.Bool && f.CanSet() {
+			f.SetBool(pv.Field(i).Bool())
+		}
+	}
+	return res
+}
+
+// SharesToOpaque returns the opaque data carrying a list of shares.
+func SharesToOpaque(shares []*collaboration.Share) (*typespb.Opaque, error) {
+	data, err := json.Marshal(shares)
+	if err != nil {
+		return nil, errors.Wrap(err, "share: error encoding shares")
+	}
+	return &typespb.Opaque{
+		Map: map[string]*typespb.OpaqueEntry{
+			OpaqueShares: {Decoder: "json", Value: data},
+		},
+	}, nil
+}
+
+// SharesFromOpaque returns the shares carried by the opaque data.
+func SharesFromOpaque(o *typespb.Opaque) ([]*collaboration.Share, error) {
+	e, ok := o.GetMap()[OpaqueShares]
+	if !ok {
+		return nil, nil
+	}
+	if e.Decoder != "json" {
+		return nil, errors.New("share: unsupported shares decoder " + e.Decoder)
+	}
+	var shares []*collaboration.Share
+	if err := json.Unmarshal(e.Value, &shares); err != nil {
+		return nil, errors.Wrap(err, "share: error decoding shares")
+	}
+	return shares, nil
+}
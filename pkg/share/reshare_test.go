@@ -0,0 +1,79 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package share
+
+import (
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+func TestPermissionSubsets(t *testing.T) {
+	viewer := &provider.ResourcePermissions{Stat: true, ListContainer: true, InitiateFileDownload: true}
+	editor := &provider.ResourcePermissions{Stat: true, ListContainer: true, InitiateFileDownload: true, InitiateFileUpload: true, AddGrant: true}
+
+	if !IsSubset(viewer, editor) {
+		t.Error("viewer permissions should be a subset of the editor ones")
+	}
+	if IsSubset(editor, viewer) {
+		t.Error("editor permissions should not be a subset of the viewer ones")
+	}
+	if !IsSubset(nil, viewer) {
+		t.Error("no permissions should be a subset of any")
+	}
+
+	got := Intersect(editor, viewer)
+	if got.InitiateFileUpload || got.AddGrant || !got.Stat || !got.InitiateFileDownload {
+		t.Errorf("unexpected intersection %v", got)
+	}
+}
+
+func TestSharesOpaque(t *testing.T) {
+	shares := []*collaboration.Share{
+		{Id: &collaboration.ShareId{OpaqueId: "1"}},
+		{Id: &collaboration.ShareId{OpaqueId: "2"}},
+	}
+	o, err := SharesToOpaque(shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := SharesFromOpaque(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Id.OpaqueId != "1" || got[1].Id.OpaqueId != "2" {
+		t.Errorf("unexpected shares %v", got)
+	}
+
+	if got, err := SharesFromOpaque(nil); got != nil || err != nil {
+		t.Errorf("expected no shares in nil opaque, got %v, %v", got, err)
+	}
+}
+
+func TestOwner(t *testing.T) {
+	einstein := &userpb.UserId{OpaqueId: "einstein", Idp: "localhost"}
+	if owner, err := Owner(&provider.ResourceInfo{Owner: einstein}); err != nil || owner != einstein {
+		t.Errorf("Owner() = %v, %v", owner, err)
+	}
+	if _, err := Owner(&provider.ResourceInfo{}); err == nil {
+		t.Error("expected an unknown owner to be denied")
+	}
+}
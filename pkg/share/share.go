@@ -20,9 +20,11 @@ package share
 
 import (
 	"context"
+	"time"
 
 	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 )
 
 // Manager is the interface that manipulates shares.
@@ -51,4 +53,22 @@ type Manager interface {
 
 	// UpdateReceivedShare updates the received share with share state.
 	UpdateReceivedShare(ctx context.Context, ref *collaboration.ShareReference, f *collaboration.UpdateReceivedShareRequest_UpdateField) (*collaboration.ReceivedShare, error)
+
+	// SetShareExpiration sets when the share pointed by ref expires, nil meaning it never expires.
+	SetShareExpiration(ctx context.Context, ref *collaboration.ShareReference, exp *typespb.Timestamp) error
+
+	// GetShareExpiration returns when the share expires, nil if it never expires.
+	GetShareExpiration(ctx context.Context, id *collaboration.ShareId) (*typespb.Timestamp, error)
+
+	// ListExpiredShares returns the shares of all the users that expired before t.
+	ListExpiredShares(ctx context.Context, t time.Time) ([]*collaboration.Share, error)
+
+	// SetShareParent records that the share pointed by ref is a reshare of the parent share.
+	SetShareParent(ctx context.Context, ref *collaboration.ShareReference, parent *collaboration.ShareId) error
+
+	// GetShareParent returns the share the given share is a reshare of, nil if it is not a reshare.
+	GetShareParent(ctx context.Context, id *collaboration.ShareId) (*collaboration.ShareId, error)
+
+	// ListChildShares returns the reshares of the given share, whoever created them.
+	ListChildShares(ctx context.Context, id *collaboration.ShareId) ([]*collaboration.Share, error)
 }
@@ -0,0 +1,282 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/jsonfile"
+	"github.com/cs3org/reva/pkg/spaces"
+	"github.com/cs3org/reva/pkg/spaces/manager/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("json", New)
+}
+
+type config struct {
+	File string `mapstructure:"file"`
+}
+
+type spacesModel struct {
+	Spaces map[string]*spaces.Space `json:"spaces"`
+}
+
+type mgr struct {
+	c          *config
+	sync.Mutex // concurrent access to the file and model
+	model      *spacesModel
+	file       *jsonfile.File
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new spaces manager that persists the spaces to a json file.
+// The file is reloaded when it changes, so that it can be shared by the
+// services administering the spaces and the storage providers serving them.
+// The changes are made under the lock of the file, so that they are not lost
+// when several services change the spaces at once.
+func New(m map[string]interface{}) (spaces.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	// if file is not set we use temporary file
+	if c.File == "" {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			err = errors.Wrap(err, "error creating temporary directory for storing spaces")
+			return nil, err
+		}
+		c.File = path.Join(dir, "spaces.json")
+	}
+
+	f, err := jsonfile.Open(c.File)
+	if err != nil {
+		err = errors.Wrap(err, "error opening/creating the file")
+		return nil, err
+	}
+
+	mgr := &mgr{c: c, file: f}
+	if err := mgr.load(); err != nil {
+		err = errors.Wrap(err, "error loading the file containing the spaces")
+		return nil, err
+	}
+	return mgr, nil
+}
+
+// load refreshes the spaces. The changes hold the lock of the file from the
+// load to the save.
+func (m *mgr) load() error {
+	model := &spacesModel{}
+	if ok, err := m.file.Load(model); err != nil || !ok {
+		return err
+	}
+	if model.Spaces == nil {
+		model.Spaces = map[string]*spaces.Space{}
+	}
+
+	m.model = model
+	return nil
+}
+
+func (m *mgr) save() error {
+	return m.file.Save(m.model)
+}
+
+// clone returns a copy of the space, so that callers can not change the model.
+func clone(s *spaces.Space) *spaces.Space {
+	c := *s
+	c.Members = make([]*spaces.Member, 0, len(s.Members))
+	for _, m := range s.Members {
+		mc := *m
+		c.Members = append(c.Members, &mc)
+	}
+	return &c
+}
+
+func (m *mgr) CreateSpace(ctx context.Context, s *spaces.Space) error {
+	m.Lock()
+	defer m.Unlock()
+	unlock, err := m.file.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	if _, ok := m.model.Spaces[s.ID]; ok {
+		return errtypes.AlreadyExists(s.ID)
+	}
+	s = clone(s)
+	if s.Ctime.IsZero() {
+		s.Ctime = time.Now()
+	}
+	m.model.Spaces[s.ID] = s
+
+	if err := m.save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
+
+func (m *mgr) GetSpace(ctx context.Context, id string) (*spaces.Space, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	s, ok := m.model.Spaces[id]
+	if !ok {
+		return nil, errtypes.NotFound(id)
+	}
+	return clone(s), nil
+}
+
+func (m *mgr) ListSpaces(ctx context.Context) ([]*spaces.Space, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	list := make([]*spaces.Space, 0, len(m.model.Spaces))
+	for _, s := range m.model.Spaces {
+		list = append(list, clone(s))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (m *mgr) DeleteSpace(ctx context.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	unlock, err := m.file.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	if _, ok := m.model.Spaces[id]; !ok {
+		return errtypes.NotFound(id)
+	}
+	delete(m.model.Spaces, id)
+
+	if err := m.save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
+
+func (m *mgr) SetMember(ctx context.Context, id string, member *spaces.Member) error {
+	m.Lock()
+	defer m.Unlock()
+	unlock, err := m.file.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	s, ok := m.model.Spaces[id]
+	if !ok {
+		return errtypes.NotFound(id)
+	}
+
+	mc := *member
+	found := false
+	for i, existing := range s.Members {
+		if existing.Type == member.Type && existing.Name == member.Name {
+			s.Members[i] = &mc
+			found = true
+		}
+	}
+	if !found {
+		s.Members = append(s.Members, &mc)
+	}
+
+	if err := m.save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
+
+func (m *mgr) RemoveMember(ctx context.Context, id, memberType, name string) error {
+	m.Lock()
+	defer m.Unlock()
+	unlock, err := m.file.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	s, ok := m.model.Spaces[id]
+	if !ok {
+		return errtypes.NotFound(id)
+	}
+
+	kept := s.Members[:0]
+	for _, existing := range s.Members {
+		if existing.Type != memberType || existing.Name != name {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == len(s.Members) {
+		return errtypes.NotFound(memberType + ":" + name)
+	}
+	s.Members = kept
+
+	if err := m.save(); err != nil {
+		return errors.Wrap(err, "error saving model")
+	}
+	return nil
+}
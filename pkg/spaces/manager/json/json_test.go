@@ -0,0 +1,150 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/spaces"
+)
+
+func TestSpaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "spaces.json")
+
+	m, err := New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := m.CreateSpace(ctx, &spaces.Space{ID: "physics", Name: "Physics", Group: "physics-admins"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateSpace(ctx, &spaces.Space{ID: "physics"}); err == nil {
+		t.Fatal("expected error creating an existing space")
+	}
+	if err := m.SetMember(ctx, "physics", &spaces.Member{Type: spaces.MemberUser, Name: "einstein", Role: spaces.RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetMember(ctx, "physics", &spaces.Member{Type: spaces.MemberUser, Name: "einstein", Role: spaces.RoleEditor}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second manager sharing the file sees the spaces
+	other, err := New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := other.GetSpace(ctx, "physics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Group != "physics-admins" || s.Ctime.IsZero() {
+		t.Fatalf("unexpected space: %+v", s)
+	}
+	if len(s.Members) != 1 || s.Members[0].Role != spaces.RoleEditor {
+		t.Fatalf("unexpected members: %+v", s.Members)
+	}
+
+	if err := m.RemoveMember(ctx, "physics", spaces.MemberUser, "einstein"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveMember(ctx, "physics", spaces.MemberUser, "einstein"); err == nil {
+		t.Fatal("expected error removing a missing member")
+	}
+
+	if err := m.DeleteSpace(ctx, "physics"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.GetSpace(ctx, "physics"); err == nil {
+		t.Fatal("expected error getting a deleted space")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	list, err := other.ListSpaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("expected no spaces, got %d", len(list))
+	}
+}
+
+func TestConcurrentManagers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "spaces.json")
+	ctx := context.Background()
+
+	// the managers stand for services sharing the file, none of the
+	// spaces they create concurrently is lost
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 4; i++ {
+		m, err := New(map[string]interface{}{"file": file})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int, m spaces.Manager) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				errs <- m.CreateSpace(ctx, &spaces.Space{ID: fmt.Sprintf("space-%d-%d", i, j)})
+			}
+		}(i, m)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := m.ListSpaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 40 {
+		t.Fatalf("expected 40 spaces, got %d", len(list))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Fatalf("expected only the file and its lock to be left, got %d files", len(files))
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package spaces defines the project spaces: storage areas owned by a group
+// rather than a user, whose members are given a role.
+package spaces
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// Roles of the members of a space, from the least to the most privileged.
+const (
+	// RoleViewer can read the content of the space.
+	RoleViewer = "viewer"
+	// RoleEditor can read and change the content of the space.
+	RoleEditor = "editor"
+	// RoleManager can also share the content and manage the members.
+	RoleManager = "manager"
+)
+
+// Types of the members of a space.
+const (
+	MemberUser  = "user"
+	MemberGroup = "group"
+)
+
+var ranks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleManager: 3}
+
+// Member is a user, identified by username, or a group with a role in a
+// space.
+type Member struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// Space is a storage area owned by a group, the members of the group are
+// the managers of the space.
+type Space struct {
+	// ID is the name of the root folder of the space.
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Group   string    `json:"group"`
+	Members []*Member `json:"members"`
+	Ctime   time.Time `json:"ctime"`
+}
+
+// Manager is the interface that stores the spaces.
+type Manager interface {
+	CreateSpace(ctx context.Context, s *Space) error
+	GetSpace(ctx context.Context, id string) (*Space, error)
+	ListSpaces(ctx context.Context) ([]*Space, error)
+	DeleteSpace(ctx context.Context, id string) error
+	// SetMember adds the member to the space or changes its role.
+	SetMember(ctx context.Context, id string, m *Member) error
+	RemoveMember(ctx context.Context, id, memberType, name string) error
+}
+
+// ValidRole tells whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := ranks[role]
+	return ok
+}
+
+// ValidID tells whether id can be used as the root folder of a space.
+func ValidID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, "/\\")
+}
+
+// RoleOf returns the highest role the user has in the space, directly, as a
+// member of a group with a role or as a member of the owning group, empty if
+// the user has none.
+func RoleOf(s *Space, u *userpb.User) string {
+	groups := make(map[string]bool, len(u.Groups))
+	for _, g := range u.Groups {
+		groups[g] = true
+	}
+
+	var role string
+	if groups[s.Group] {
+		return RoleManager
+	}
+	for _, m := range s.Members {
+		if (m.Type == MemberUser && m.Name == u.Username) || (m.Type == MemberGroup && groups[m.Name]) {
+			if ranks[m.Role] > ranks[role] {
+				role = m.Role
+			}
+		}
+	}
+	return role
+}
+
+// CanWrite tells whether the role allows changing the content of a space.
+func CanWrite(role string) bool {
+	return ranks[role] >= ranks[RoleEditor]
+}
+
+// CanManage tells whether the role allows sharing the content of a space
+// and managing its members.
+func CanManage(role string) bool {
+	return role == RoleManager
+}
+
+// Permissions returns the permissions the role grants on the resources of a
+// space.
+func Permissions(role string) *provider.ResourcePermissions {
+	p := &provider.ResourcePermissions{}
+	if ranks[role] >= ranks[RoleViewer] {
+		p.GetPath = true
+		p.GetQuota = true
+		p.InitiateFileDownload = true
+		p.ListContainer = true
+		p.ListFileVersions = true
+		p.Stat = true
+	}
+	if CanWrite(role) {
+		p.CreateContainer = true
+		p.Delete = true
+		p.InitiateFileUpload = true
+		p.Move = true
+		p.RestoreFileVersion = true
+	}
+	if CanManage(role) {
+		p.AddGrant = true
+		p.ListGrants = true
+		p.RemoveGrant = true
+		p.UpdateGrant = true
+	}
+	return p
+}
@@ -0,0 +1,78 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package spaces
+
+import (
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+)
+
+func TestRoleOf(t *testing.T) {
+	s := &Space{
+		ID:    "physics",
+		Group: "physics-admins",
+		Members: []*Member{
+			{Type: MemberUser, Name: "einstein", Role: RoleViewer},
+			{Type: MemberGroup, Name: "sailing-lovers", Role: RoleEditor},
+		},
+	}
+
+	tests := []struct {
+		user *userpb.User
+		role string
+	}{
+		{&userpb.User{Username: "einstein"}, RoleViewer},
+		{&userpb.User{Username: "einstein", Groups: []string{"sailing-lovers"}}, RoleEditor},
+		{&userpb.User{Username: "marie", Groups: []string{"physics-admins"}}, RoleManager},
+		{&userpb.User{Username: "richard", Groups: []string{"quantum-lovers"}}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := RoleOf(s, tt.user); got != tt.role {
+			t.Errorf("RoleOf(%s) = %q, expected %q", tt.user.Username, got, tt.role)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	if p := Permissions(""); p.Stat || p.InitiateFileDownload {
+		t.Error("no role must not grant any permission")
+	}
+	if p := Permissions(RoleViewer); !p.Stat || p.InitiateFileUpload {
+		t.Errorf("unexpected viewer permissions: %+v", p)
+	}
+	if p := Permissions(RoleEditor); !p.InitiateFileUpload || p.AddGrant {
+		t.Errorf("unexpected editor permissions: %+v", p)
+	}
+	if p := Permissions(RoleManager); !p.InitiateFileUpload || !p.AddGrant {
+		t.Errorf("unexpected manager permissions: %+v", p)
+	}
+}
+
+func TestValidID(t *testing.T) {
+	for _, id := range []string{"", ".", "..", "a/b", `a\b`} {
+		if ValidID(id) {
+			t.Errorf("ValidID(%q) = true, expected false", id)
+		}
+	}
+	if !ValidID("physics") {
+		t.Error("ValidID(physics) = false, expected true")
+	}
+}
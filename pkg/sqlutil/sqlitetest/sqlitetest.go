@@ -0,0 +1,62 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sqlitetest opens in memory sqlite databases for the tests of the
+// sql drivers, so that they run without a database server.
+package sqlitetest
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Driver is the name of the sqlite driver registered with the functions of
+// mysql and postgres used by the sql drivers.
+const Driver = "sqlite3_reva"
+
+func init() {
+	sql.Register(Driver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("greatest", func(a, b int64) int64 {
+				if a > b {
+					return a
+				}
+				return b
+			}, true)
+		},
+	})
+}
+
+var databases int64
+
+// Open returns a new in memory database, closed at the end of the test. The
+// connections of the pool share the database.
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:reva%d?mode=memory&cache=shared&_busy_timeout=5000", atomic.AddInt64(&databases, 1))
+	db, err := sql.Open(Driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,49 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sqlutil
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	q := "SELECT a FROM t WHERE b = ? AND c IN (?, ?)"
+	if got := Rebind("mysql", q); got != q {
+		t.Errorf("mysql: got %q", got)
+	}
+	if got, want := Rebind("postgres", q), "SELECT a FROM t WHERE b = $1 AND c IN ($2, $3)"; got != want {
+		t.Errorf("postgres: got %q, want %q", got, want)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open(&Config{DBDriver: "sqlite", DSN: "x"}); err == nil {
+		t.Error("expected an error for an unsupported driver")
+	}
+	if _, err := Open(&Config{}); err == nil {
+		t.Error("expected an error without dsn")
+	}
+	c := &Config{DSN: "user:password@tcp(localhost:3306)/reva"}
+	db, err := Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if c.DBDriver != "mysql" {
+		t.Errorf("expected the mysql driver by default, got %q", c.DBDriver)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package checksums computes and verifies the file checksums
+// exchanged with ownCloud clients in the OC-Checksum header.
+package checksums
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"io"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// MetadataKey is the arbitrary metadata key the checksums are stored under,
+// using the space separated TYPE:sum format of the oc:checksum property.
+const MetadataKey = "http://owncloud.org/ns/checksums"
+
+// The supported checksum types, in order of preference.
+const (
+	SHA1    = "SHA1"
+	MD5     = "MD5"
+	ADLER32 = "ADLER32"
+)
+
+var supported = []string{SHA1, MD5, ADLER32}
+
+// Supported returns the supported checksum types, in order of preference.
+func Supported() []string {
+	return append([]string{}, supported...)
+}
+
+// Hasher computes all the supported checksums of the data written to it in a single pass.
+type Hasher struct {
+	hashes map[string]hash.Hash
+	w      io.Writer
+}
+
+// NewHasher returns a new Hasher.
+func NewHasher() *Hasher {
+	h := &Hasher{
+		hashes: map[string]hash.Hash{
+			SHA1:    sha1.New(),
+			MD5:     md5.New(),
+			ADLER32: adler32.New(),
+		},
+	}
+	writers := make([]io.Writer, 0, len(supported))
+	for _, t := range supported {
+		writers = append(writers, h.hashes[t])
+	}
+	h.w = io.MultiWriter(writers...)
+	return h
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	return h.w.Write(p)
+}
+
+// Sum returns the hex encoded checksum of the given type, or an empty string if it is unsupported.
+func (h *Hasher) Sum(t string) string {
+	if s, ok := h.hashes[strings.ToUpper(t)]; ok {
+		return hex.EncodeToString(s.Sum(nil))
+	}
+	return ""
+}
+
+// String returns all the checksums in the TYPE:sum format of the oc:checksum property.
+func (h *Hasher) String() string {
+	sums := make([]string, 0, len(supported))
+	for _, t := range supported {
+		sums = append(sums, t+":"+h.Sum(t))
+	}
+	return strings.Join(sums, " ")
+}
+
+// Verify checks the checksum sent by the client in the OC-Checksum header,
+// e.g. "SHA1:9bd253a09d58be107bcb4169ebf338c8df34d086", against the computed ones.
+func (h *Hasher) Verify(header string) error {
+	t, sum, err := Parse(header)
+	if err != nil {
+		return err
+	}
+	if computed := h.Sum(t); computed != strings.ToLower(sum) {
+		return fmt.Errorf("checksums: %s mismatch, expected %s but computed %s", t, sum, computed)
+	}
+	return nil
+}
+
+// Parse splits a TYPE:sum checksum and validates its type.
+func Parse(s string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("checksums: invalid checksum %q", s)
+	}
+	t := strings.ToUpper(parts[0])
+	for _, st := range supported {
+		if t == st {
+			return t, parts[1], nil
+		}
+	}
+	return "", "", fmt.Errorf("checksums: unsupported checksum type %q", parts[0])
+}
+
+// Get returns the checksum of the given type from a TYPE:sum list as stored in the metadata.
+func Get(list, t string) string {
+	for _, s := range strings.Fields(list) {
+		if st, sum, err := Parse(s); err == nil && st == strings.ToUpper(t) {
+			return sum
+		}
+	}
+	return ""
+}
+
+// FromResourceInfo returns the checksum known for the resource in the
+// TYPE:sum format, preferring the ones computed on upload, or an empty
+// string if there is none.
+func FromResourceInfo(info *provider.ResourceInfo) string {
+	list := info.GetArbitraryMetadata().GetMetadata()[MetadataKey]
+	for _, t := range supported {
+		if sum := Get(list, t); sum != "" {
+			return t + ":" + sum
+		}
+	}
+	if info.GetChecksum().GetSum() != "" {
+		t := strings.TrimPrefix(info.Checksum.Type.String(), "RESOURCE_CHECKSUM_TYPE_")
+		if _, _, err := Parse(t + ":" + info.Checksum.Sum); err == nil {
+			return t + ":" + info.Checksum.Sum
+		}
+	}
+	return ""
+}
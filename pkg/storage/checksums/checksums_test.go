@@ -0,0 +1,51 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package checksums
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHasher(t *testing.T) {
+	h := NewHasher()
+	if _, err := io.Copy(h, strings.NewReader("hello world")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "SHA1:2aae6c35c94fcfb415dbe95f408b9ce91ee846ed MD5:5eb63bbbe01eeed093cb22bb8f5acdc3 ADLER32:1a0b045d"
+	if h.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, h.String())
+	}
+
+	if err := h.Verify("md5:5EB63BBBE01EEED093CB22BB8F5ACDC3"); err != nil {
+		t.Fatalf("expected checksum to match: %v", err)
+	}
+	if err := h.Verify("SHA1:0000"); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if err := h.Verify("CRC32:abcd"); err == nil {
+		t.Fatal("expected unsupported checksum type")
+	}
+
+	if sum := Get(expected, ADLER32); sum != "1a0b045d" {
+		t.Fatalf("unexpected adler32 checksum %s", sum)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package chunking defines where the chunks of the uploads done with the
+// ownCloud chunking NG protocol are kept until they are assembled.
+package chunking
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Chunk describes a stored chunk.
+type Chunk struct {
+	Name  string
+	Size  int64
+	Mtime time.Time
+}
+
+// Store keeps the chunks of the uploads until they are assembled.
+type Store interface {
+	// Create starts the upload with the given id.
+	Create(ctx context.Context, id string) error
+
+	// PutChunk stores the content of the chunk of the upload with the given name
+	// and returns its size.
+	PutChunk(ctx context.Context, id, name string, r io.Reader) (int64, error)
+
+	// ListChunks returns the chunks of the upload ordered by name.
+	ListChunks(ctx context.Context, id string) ([]*Chunk, error)
+
+	// Assemble returns the content of the upload, the chunks being
+	// concatenated in the order of their names, and its size.
+	Assemble(ctx context.Context, id string) (io.ReadCloser, int64, error)
+
+	// Delete removes the upload and its chunks.
+	Delete(ctx context.Context, id string) error
+}
+
+// Purger is the interface that chunk stores able to remove the uploads
+// abandoned before they were assembled implement.
+type Purger interface {
+	// PurgeUploads removes the uploads without chunk stored since before
+	// and returns their ids. With dryRun nothing is removed.
+	PurgeUploads(ctx context.Context, before time.Time, dryRun bool) ([]string, error)
+}
+
+// SortChunks orders the chunks by name. Numeric names, as sent by the
+// clients, are compared by their value.
+func SortChunks(chunks []*Chunk) {
+	sort.Slice(chunks, func(i, j int) bool {
+		a, errA := strconv.ParseUint(chunks[i].Name, 10, 64)
+		b, errB := strconv.ParseUint(chunks[j].Name, 10, 64)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return chunks[i].Name < chunks[j].Name
+	})
+}
@@ -0,0 +1,279 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/chunking"
+	"github.com/cs3org/reva/pkg/storage/chunking/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("local", New)
+}
+
+type config struct {
+	Root string `mapstructure:"root"`
+}
+
+type store struct {
+	root string
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a chunk store that keeps the chunks on the local disk,
+// one folder per upload.
+func New(m map[string]interface{}) (chunking.Store, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Root == "" {
+		c.Root = filepath.Join(os.TempDir(), "reva-chunks")
+	}
+	if err := os.MkdirAll(c.Root, 0700); err != nil {
+		return nil, errors.Wrap(err, "local: error creating chunk folder")
+	}
+	return &store{root: c.Root}, nil
+}
+
+// validName rejects the names that would escape the folder of the upload.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
+
+func (s *store) uploadDir(id string) (string, error) {
+	for _, p := range strings.Split(id, "/") {
+		if !validName(p) {
+			return "", errors.New("local: invalid upload id: " + id)
+		}
+	}
+	return filepath.Join(s.root, filepath.FromSlash(id)), nil
+}
+
+func (s *store) Create(ctx context.Context, id string) error {
+	dir, err := s.uploadDir(id)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return errtypes.AlreadyExists(id)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "local: error creating upload folder")
+	}
+	return nil
+}
+
+func (s *store) PutChunk(ctx context.Context, id, name string, r io.Reader) (int64, error) {
+	dir, err := s.uploadDir(id)
+	if err != nil {
+		return 0, err
+	}
+	if !validName(name) {
+		return 0, errors.New("local: invalid chunk name: " + name)
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return 0, errtypes.NotFound(id)
+	}
+
+	// write to a temporary file first so that a broken transfer never
+	// leaves a partial chunk behind
+	tmp, err := ioutil.TempFile(dir, ".part-")
+	if err != nil {
+		return 0, errors.Wrap(err, "local: error creating chunk")
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, errors.Wrap(err, "local: error writing chunk")
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, errors.Wrap(err, "local: error writing chunk")
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return 0, errors.Wrap(err, "local: error storing chunk")
+	}
+	return n, nil
+}
+
+func (s *store) ListChunks(ctx context.Context, id string) ([]*chunking.Chunk, error) {
+	dir, err := s.uploadDir(id)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errtypes.NotFound(id)
+		}
+		return nil, errors.Wrap(err, "local: error listing chunks")
+	}
+
+	chunks := make([]*chunking.Chunk, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".part-") {
+			continue
+		}
+		chunks = append(chunks, &chunking.Chunk{Name: info.Name(), Size: info.Size(), Mtime: info.ModTime()})
+	}
+	chunking.SortChunks(chunks)
+	return chunks, nil
+}
+
+func (s *store) Assemble(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	chunks, err := s.ListChunks(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	dir, _ := s.uploadDir(id)
+
+	var size int64
+	files := make([]string, 0, len(chunks))
+	for _, c := range chunks {
+		size += c.Size
+		files = append(files, filepath.Join(dir, c.Name))
+	}
+	return &chunkReader{ctx: ctx, files: files}, size, nil
+}
+
+func (s *store) Delete(ctx context.Context, id string) error {
+	dir, err := s.uploadDir(id)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return errtypes.NotFound(id)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "local: error removing upload folder")
+	}
+	return nil
+}
+
+// chunkReader reads the chunks one after the other, keeping only one of
+// them open at a time, as uploads might have hundreds of chunks.
+type chunkReader struct {
+	ctx   context.Context
+	files []string
+	cur   *os.File
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.files) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(r.files[0])
+			if err != nil {
+				return 0, errors.Wrap(err, "local: error opening chunk")
+			}
+			r.cur, r.files = f, r.files[1:]
+		}
+
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			if err := r.cur.Close(); err != nil {
+				log := appctx.GetLogger(r.ctx)
+				log.Warn().Err(err).Str("chunk", r.cur.Name()).Msg("local: error closing chunk")
+			}
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// PurgeUploads removes the upload folders, the folders without sub folder,
+// in which nothing was written since before.
+func (s *store) PurgeUploads(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+	var purged []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return errors.Wrap(err, "local: error listing "+dir)
+		}
+
+		last := time.Time{}
+		if fi, err := os.Stat(dir); err == nil {
+			last = fi.ModTime()
+		}
+		isUpload := true
+		for _, fi := range infos {
+			if fi.IsDir() {
+				isUpload = false
+				if err := walk(filepath.Join(dir, fi.Name())); err != nil {
+					return err
+				}
+			} else if fi.ModTime().After(last) {
+				last = fi.ModTime()
+			}
+		}
+		if !isUpload || dir == s.root || !last.Before(before) {
+			return nil
+		}
+
+		id, _ := filepath.Rel(s.root, dir)
+		purged = append(purged, filepath.ToSlash(id))
+		if dryRun {
+			return nil
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Wrap(err, "local: error removing upload folder")
+		}
+		return nil
+	}
+	err := walk(s.root)
+	return purged, err
+}
@@ -0,0 +1,133 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cs3org/reva/pkg/storage/chunking"
+)
+
+func TestAssemble(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chunks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New(map[string]interface{}{"root": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	id := "einstein/transfer-1"
+	if err := s.Create(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks are assembled by their numeric order, not the upload order
+	for name, content := range map[string]string{"10": "c", "2": "b", "1": "a"} {
+		if _, err := s.PutChunk(ctx, id, name, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.PutChunk(ctx, id, "../escape", strings.NewReader("x")); err == nil {
+		t.Fatal("expected error for a chunk name escaping the upload")
+	}
+
+	r, size, err := s.Assemble(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc" || size != 3 {
+		t.Fatalf("unexpected assembled content %q of size %d", data, size)
+	}
+
+	if err := s.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ListChunks(ctx, id); err == nil {
+		t.Fatal("expected error listing a deleted upload")
+	}
+}
+
+func TestPurgeUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chunks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New(map[string]interface{}{"root": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, id := range []string{"einstein/old", "einstein/recent"} {
+		if err := s.Create(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.PutChunk(ctx, id, "1", strings.NewReader("a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, fn := range []string{"einstein/old/1", "einstein/old"} {
+		if err := os.Chtimes(filepath.Join(dir, fn), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := s.(chunking.Purger)
+	before := time.Now().Add(-time.Hour)
+	purged, err := p.PurgeUploads(ctx, before, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0] != "einstein/old" {
+		t.Fatalf("unexpected purged uploads %v", purged)
+	}
+	if _, err := s.ListChunks(ctx, "einstein/old"); err != nil {
+		t.Fatal("expected the upload to be kept in dry run mode")
+	}
+
+	if _, err := p.PurgeUploads(ctx, before, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ListChunks(ctx, "einstein/old"); err == nil {
+		t.Fatal("expected the old upload to be purged")
+	}
+	if _, err := s.ListChunks(ctx, "einstein/recent"); err != nil {
+		t.Fatal("expected the recent upload to be kept")
+	}
+}
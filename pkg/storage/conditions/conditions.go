@@ -0,0 +1,208 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package conditions implements the conditional requests of HTTP, see
+// https://tools.ietf.org/html/rfc7232, for the changes of the resources, so
+// that concurrent clients do not overwrite the changes of each other.
+package conditions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// OpaqueKey is the key of the opaque data of the CS3 requests the
+// preconditions travel in, as json.
+const OpaqueKey = "preconditions"
+
+// Any matches any etag, in If-Match it requires the resource to exist and in
+// If-None-Match to not exist.
+const Any = "*"
+
+type key int
+
+const preconditionsKey key = iota
+
+// Preconditions are the conditions the state of a resource has to meet for
+// a change of it to be made.
+type Preconditions struct {
+	// IfMatch are the etags of which the resource must have one.
+	IfMatch []string `json:"if_match,omitempty"`
+	// IfNoneMatch are the etags of which the resource must have none.
+	IfNoneMatch []string `json:"if_none_match,omitempty"`
+	// IfUnmodifiedSince is the time the resource must not have been changed
+	// after, ignored when IfMatch is set.
+	IfUnmodifiedSince time.Time `json:"if_unmodified_since,omitempty"`
+}
+
+// FromHeader returns the preconditions of the If-Match, If-None-Match and
+// If-Unmodified-Since headers of a request, nil if there are none. An
+// invalid date is ignored, as the RFC requires.
+func FromHeader(h http.Header) *Preconditions {
+	p := &Preconditions{
+		IfMatch:     etags(h.Get("If-Match")),
+		IfNoneMatch: etags(h.Get("If-None-Match")),
+	}
+	if v := h.Get("If-Unmodified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			p.IfUnmodifiedSince = t
+		}
+	}
+	if p.empty() {
+		return nil
+	}
+	return p
+}
+
+func etags(v string) []string {
+	var tags []string
+	for _, t := range strings.Split(v, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func (p *Preconditions) empty() bool {
+	return len(p.IfMatch) == 0 && len(p.IfNoneMatch) == 0 && p.IfUnmodifiedSince.IsZero()
+}
+
+// SetHeader sets the headers of a request forwarding the preconditions.
+func (p *Preconditions) SetHeader(h http.Header) {
+	if len(p.IfMatch) > 0 {
+		h.Set("If-Match", strings.Join(p.IfMatch, ", "))
+	}
+	if len(p.IfNoneMatch) > 0 {
+		h.Set("If-None-Match", strings.Join(p.IfNoneMatch, ", "))
+	}
+	if !p.IfUnmodifiedSince.IsZero() {
+		h.Set("If-Unmodified-Since", p.IfUnmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+}
+
+// Check returns an errtypes.PreconditionFailed error if the resource, nil
+// when it does not exist, does not meet the preconditions.
+func (p *Preconditions) Check(ri *provider.ResourceInfo) error {
+	if len(p.IfMatch) > 0 {
+		if ri == nil {
+			return errtypes.PreconditionFailed("resource does not exist")
+		}
+		if !matches(p.IfMatch, ri.Etag) {
+			return errtypes.PreconditionFailed("etag " + ri.Etag + " does not match")
+		}
+	}
+	if len(p.IfNoneMatch) > 0 && ri != nil {
+		if matches(p.IfNoneMatch, ri.Etag) {
+			return errtypes.PreconditionFailed("etag " + ri.Etag + " matches")
+		}
+	}
+	if len(p.IfMatch) == 0 && !p.IfUnmodifiedSince.IsZero() && ri != nil && ri.Mtime != nil {
+		// the dates of HTTP have a precision of a second
+		if int64(ri.Mtime.Seconds) > p.IfUnmodifiedSince.Unix() {
+			return errtypes.PreconditionFailed("resource modified since " + p.IfUnmodifiedSince.UTC().Format(http.TimeFormat))
+		}
+	}
+	return nil
+}
+
+// matches tells if the etag is one of the tags, the quotes around the tags
+// being optional as not all the clients send them.
+func matches(tags []string, etag string) bool {
+	etag = strings.Trim(etag, `"`)
+	for _, t := range tags {
+		if t == Any || strings.Trim(t, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ContextSetPreconditions stores the preconditions of the change made with
+// the context, for the storage drivers to check them atomically with the
+// change.
+func ContextSetPreconditions(ctx context.Context, p *Preconditions) context.Context {
+	return context.WithValue(ctx, preconditionsKey, p)
+}
+
+// ContextGetPreconditions returns the preconditions if set in the given context.
+func ContextGetPreconditions(ctx context.Context) (*Preconditions, bool) {
+	p, ok := ctx.Value(preconditionsKey).(*Preconditions)
+	return p, ok && p != nil
+}
+
+// Verify checks the preconditions of the context, if any, against the
+// current state of the resource. The services verify them before calling
+// the storage drivers, to fail early and because not all the drivers can
+// check them atomically.
+func Verify(ctx context.Context, fs storage.FS, ref *provider.Reference) error {
+	p, ok := ContextGetPreconditions(ctx)
+	if !ok {
+		return nil
+	}
+	ri, err := fs.GetMD(ctx, ref)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); !ok {
+			return err
+		}
+		ri = nil
+	}
+	return p.Check(ri)
+}
+
+// ToOpaque returns the opaque data carrying the preconditions.
+func (p *Preconditions) ToOpaque() (*typespb.Opaque, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "conditions: error encoding preconditions")
+	}
+	return &typespb.Opaque{
+		Map: map[string]*typespb.OpaqueEntry{
+			OpaqueKey: {Decoder: "json", Value: data},
+		},
+	}, nil
+}
+
+// FromOpaque returns the preconditions carried by the opaque data, nil if
+// there are none.
+func FromOpaque(o *typespb.Opaque) (*Preconditions, error) {
+	e, ok := o.GetMap()[OpaqueKey]
+	if !ok {
+		return nil, nil
+	}
+	if e.Decoder != "json" {
+		return nil, errors.New("conditions: unsupported preconditions decoder " + e.Decoder)
+	}
+	p := &Preconditions{}
+	if err := json.Unmarshal(e.Value, p); err != nil {
+		return nil, errors.Wrap(err, "conditions: error decoding preconditions")
+	}
+	if p.empty() {
+		return nil, nil
+	}
+	return p, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package conditions
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+)
+
+func TestCheck(t *testing.T) {
+	mtime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	file := &provider.ResourceInfo{
+		Etag:  `"abc"`,
+		Mtime: &typespb.Timestamp{Seconds: uint64(mtime.Unix())},
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		info   *provider.ResourceInfo
+		ok     bool
+	}{
+		{"matching etag", map[string]string{"If-Match": `"abc"`}, file, true},
+		{"unquoted etag", map[string]string{"If-Match": "abc"}, file, true},
+		{"one of the etags", map[string]string{"If-Match": `"xyz", "abc"`}, file, true},
+		{"other etag", map[string]string{"If-Match": `"xyz"`}, file, false},
+		{"any etag", map[string]string{"If-Match": "*"}, file, true},
+		{"any etag of missing", map[string]string{"If-Match": "*"}, nil, false},
+		{"none match", map[string]string{"If-None-Match": `"xyz"`}, file, true},
+		{"none match matching", map[string]string{"If-None-Match": `"abc"`}, file, false},
+		{"none match any", map[string]string{"If-None-Match": "*"}, file, false},
+		{"none match any of missing", map[string]string{"If-None-Match": "*"}, nil, true},
+		{"unmodified", map[string]string{"If-Unmodified-Since": mtime.Format(http.TimeFormat)}, file, true},
+		{"modified", map[string]string{"If-Unmodified-Since": mtime.Add(-time.Second).Format(http.TimeFormat)}, file, false},
+		{"modified but matching", map[string]string{"If-Match": `"abc"`, "If-Unmodified-Since": mtime.Add(-time.Second).Format(http.TimeFormat)}, file, true},
+		{"invalid date", map[string]string{"If-Unmodified-Since": "yesterday"}, file, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			p := FromHeader(h)
+			if p == nil {
+				if !tt.ok {
+					t.Fatal("expected preconditions")
+				}
+				return
+			}
+			if err := p.Check(tt.info); (err == nil) != tt.ok {
+				t.Fatalf("expected ok=%v, got %v", tt.ok, err)
+			}
+		})
+	}
+}
+
+func TestOpaque(t *testing.T) {
+	p := &Preconditions{
+		IfMatch:           []string{`"abc"`},
+		IfUnmodifiedSince: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	o, err := p.ToOpaque()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromOpaque(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.IfMatch) != 1 || got.IfMatch[0] != `"abc"` || !got.IfUnmodifiedSince.Equal(p.IfUnmodifiedSince) {
+		t.Fatalf("expected %+v, got %+v", p, got)
+	}
+
+	if got, err := FromOpaque(nil); got != nil || err != nil {
+		t.Fatalf("expected no preconditions, got %+v, %v", got, err)
+	}
+
+	h := http.Header{}
+	p.SetHeader(h)
+	if got := FromHeader(h); got == nil || got.IfMatch[0] != `"abc"` || !got.IfUnmodifiedSince.Equal(p.IfUnmodifiedSince) {
+		t.Fatalf("expected the headers to carry %+v, got %+v", p, got)
+	}
+}
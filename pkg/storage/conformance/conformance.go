@@ -0,0 +1,435 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package conformance is a test suite checking that a storage driver
+// satisfies the contract of the storage.FS interface. A driver runs it from
+// its tests with a function creating the driver on an empty storage:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(t *testing.T) (storage.FS, context.Context) {
+//			...
+//		})
+//	}
+//
+// The optional operations, like the revisions, the recycle bin or the grants,
+// are skipped for the drivers returning a NotSupported error for them.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// Driver returns the driver under test on an empty storage, and the context
+// of the requests, carrying the user the driver needs. The driver is shut
+// down at the end of each test.
+type Driver func(t *testing.T) (storage.FS, context.Context)
+
+// Run runs the conformance suite against a driver, each group of tests on a
+// new driver.
+func Run(t *testing.T, newDriver Driver) {
+	for _, tc := range []struct {
+		name string
+		test func(t *testing.T, s *suite)
+	}{
+		{"CRUD", testCRUD},
+		{"Move", testMove},
+		{"ID", testID},
+		{"Metadata", testMetadata},
+		{"Revisions", testRevisions},
+		{"Recycle", testRecycle},
+		{"Grants", testGrants},
+		{"Concurrency", testConcurrency},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			fs, ctx := newDriver(t)
+			defer fs.Shutdown(ctx)
+			tc.test(t, &suite{t: t, fs: fs, ctx: ctx})
+		})
+	}
+}
+
+type suite struct {
+	t   *testing.T
+	fs  storage.FS
+	ctx context.Context
+}
+
+func ref(fn string) *provider.Reference {
+	return &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+}
+
+// skipIfNotSupported skips the test when the driver does not support an
+// optional operation.
+func (s *suite) skipIfNotSupported(err error, op string) {
+	s.t.Helper()
+	if _, ok := errors.Cause(err).(errtypes.IsNotSupported); ok {
+		s.t.Skipf("%s not supported by the driver: %v", op, err)
+	}
+}
+
+func (s *suite) must(err error, op string) {
+	s.t.Helper()
+	if err != nil {
+		s.t.Fatalf("%s: %v", op, err)
+	}
+}
+
+func (s *suite) mkdir(fn string) {
+	s.t.Helper()
+	s.must(s.fs.CreateDir(s.ctx, fn), "create dir "+fn)
+}
+
+func (s *suite) upload(fn, content string) {
+	s.t.Helper()
+	s.must(s.fs.Upload(s.ctx, ref(fn), ioutil.NopCloser(strings.NewReader(content))), "upload "+fn)
+}
+
+func (s *suite) stat(fn string) *provider.ResourceInfo {
+	s.t.Helper()
+	info, err := s.fs.GetMD(s.ctx, ref(fn))
+	s.must(err, "stat "+fn)
+	return info
+}
+
+func (s *suite) content(fn string) string {
+	s.t.Helper()
+	rc, err := s.fs.Download(s.ctx, ref(fn))
+	s.must(err, "download "+fn)
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	s.must(err, "read "+fn)
+	return string(data)
+}
+
+func (s *suite) expectContent(fn, content string) {
+	s.t.Helper()
+	if got := s.content(fn); got != content {
+		s.t.Errorf("content of %s is %q, want %q", fn, got, content)
+	}
+}
+
+func (s *suite) expectNotFound(fn string) {
+	s.t.Helper()
+	_, err := s.fs.GetMD(s.ctx, ref(fn))
+	if err == nil {
+		s.t.Errorf("%s still exists", fn)
+		return
+	}
+	if _, ok := errors.Cause(err).(errtypes.IsNotFound); !ok {
+		s.t.Errorf("stat of missing %s: expected a NotFound error, got %v", fn, err)
+	}
+}
+
+func (s *suite) list(fn string) []string {
+	s.t.Helper()
+	infos, err := s.fs.ListFolder(s.ctx, ref(fn))
+	s.must(err, "list "+fn)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, path.Base(info.Path))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *suite) expectList(fn string, names ...string) {
+	s.t.Helper()
+	sort.Strings(names)
+	if got := s.list(fn); strings.Join(got, ",") != strings.Join(names, ",") {
+		s.t.Errorf("%s contains %v, want %v", fn, got, names)
+	}
+}
+
+func testCRUD(t *testing.T, s *suite) {
+	s.mkdir("/docs")
+	info := s.stat("/docs")
+	if info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		t.Errorf("/docs has type %s", info.Type)
+	}
+	if err := s.fs.CreateDir(s.ctx, "/docs"); err == nil {
+		t.Error("creating an existing folder succeeded")
+	}
+
+	s.upload("/docs/a.txt", "hello")
+	info = s.stat("/docs/a.txt")
+	if info.Type != provider.ResourceType_RESOURCE_TYPE_FILE {
+		t.Errorf("/docs/a.txt has type %s", info.Type)
+	}
+	if info.Path != "/docs/a.txt" {
+		t.Errorf("/docs/a.txt has path %s", info.Path)
+	}
+	if info.Size != 5 {
+		t.Errorf("/docs/a.txt has size %d", info.Size)
+	}
+	if info.Id == nil || info.Id.OpaqueId == "" {
+		t.Error("/docs/a.txt has no id")
+	}
+	s.expectContent("/docs/a.txt", "hello")
+
+	s.upload("/docs/a.txt", "hello world")
+	s.expectContent("/docs/a.txt", "hello world")
+	if info := s.stat("/docs/a.txt"); info.Size != 11 {
+		t.Errorf("/docs/a.txt has size %d after the overwrite", info.Size)
+	}
+
+	s.upload("/docs/empty.txt", "")
+	s.expectContent("/docs/empty.txt", "")
+	s.mkdir("/docs/sub")
+	s.expectList("/docs", "a.txt", "empty.txt", "sub")
+	s.expectList("/docs/sub")
+
+	s.must(s.fs.Delete(s.ctx, ref("/docs/a.txt")), "delete /docs/a.txt")
+	s.expectNotFound("/docs/a.txt")
+	s.expectList("/docs", "empty.txt", "sub")
+
+	s.upload("/docs/sub/b.txt", "b")
+	s.must(s.fs.Delete(s.ctx, ref("/docs")), "delete /docs")
+	s.expectNotFound("/docs")
+	s.expectNotFound("/docs/sub/b.txt")
+
+	if _, err := s.fs.Download(s.ctx, ref("/missing")); err == nil {
+		t.Error("downloading a missing file succeeded")
+	}
+}
+
+func testMove(t *testing.T, s *suite) {
+	s.mkdir("/src")
+	s.mkdir("/dst")
+	s.upload("/src/a.txt", "a")
+
+	s.must(s.fs.Move(s.ctx, ref("/src/a.txt"), ref("/dst/b.txt")), "move a file")
+	s.expectNotFound("/src/a.txt")
+	s.expectContent("/dst/b.txt", "a")
+
+	s.upload("/src/c.txt", "c")
+	s.must(s.fs.Move(s.ctx, ref("/src"), ref("/dst/src")), "move a folder")
+	s.expectNotFound("/src")
+	s.expectList("/dst", "b.txt", "src")
+	s.expectContent("/dst/src/c.txt", "c")
+}
+
+func testID(t *testing.T, s *suite) {
+	s.mkdir("/docs")
+	s.upload("/docs/a.txt", "a")
+	id := s.stat("/docs/a.txt").Id
+
+	p, err := s.fs.GetPathByID(s.ctx, id)
+	s.skipIfNotSupported(err, "get path by id")
+	s.must(err, "get path by id")
+	if p != "/docs/a.txt" {
+		t.Errorf("the id of /docs/a.txt resolves to %s", p)
+	}
+
+	info, err := s.fs.GetMD(s.ctx, &provider.Reference{Spec: &provider.Reference_Id{Id: id}})
+	s.must(err, "stat by id")
+	if info.Path != "/docs/a.txt" {
+		t.Errorf("stat by the id of /docs/a.txt returns %s", info.Path)
+	}
+}
+
+func testMetadata(t *testing.T, s *suite) {
+	s.upload("/a.txt", "a")
+	err := s.fs.SetArbitraryMetadata(s.ctx, ref("/a.txt"), &provider.ArbitraryMetadata{
+		Metadata: map[string]string{"color": "blue", "shape": "round"},
+	})
+	s.skipIfNotSupported(err, "arbitrary metadata")
+	s.must(err, "set metadata")
+
+	md := s.stat("/a.txt").GetArbitraryMetadata().GetMetadata()
+	if md["color"] != "blue" || md["shape"] != "round" {
+		t.Errorf("metadata of /a.txt is %v", md)
+	}
+
+	s.must(s.fs.UnsetArbitraryMetadata(s.ctx, ref("/a.txt"), []string{"color"}), "unset metadata")
+	md = s.stat("/a.txt").GetArbitraryMetadata().GetMetadata()
+	if _, ok := md["color"]; ok || md["shape"] != "round" {
+		t.Errorf("metadata of /a.txt is %v after the unset", md)
+	}
+
+	if err := s.fs.SetArbitraryMetadata(s.ctx, ref("/missing"), &provider.ArbitraryMetadata{
+		Metadata: map[string]string{"color": "blue"},
+	}); err == nil {
+		t.Error("setting the metadata of a missing file succeeded")
+	}
+}
+
+func testRevisions(t *testing.T, s *suite) {
+	s.upload("/a.txt", "v1")
+	s.upload("/a.txt", "v2")
+
+	revisions, err := s.fs.ListRevisions(s.ctx, ref("/a.txt"))
+	s.skipIfNotSupported(err, "revisions")
+	s.must(err, "list revisions")
+	if len(revisions) != 1 {
+		t.Fatalf("/a.txt has %d revisions after an overwrite", len(revisions))
+	}
+
+	key := revisions[0].Key
+	rc, err := s.fs.DownloadRevision(s.ctx, ref("/a.txt"), key)
+	s.must(err, "download revision")
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	s.must(err, "read revision")
+	if string(data) != "v1" {
+		t.Errorf("revision of /a.txt contains %q", data)
+	}
+
+	s.must(s.fs.RestoreRevision(s.ctx, ref("/a.txt"), key), "restore revision")
+	s.expectContent("/a.txt", "v1")
+}
+
+func testRecycle(t *testing.T, s *suite) {
+	items, err := s.fs.ListRecycle(s.ctx)
+	s.skipIfNotSupported(err, "recycle")
+	s.must(err, "list recycle")
+	if len(items) != 0 {
+		t.Fatalf("the recycle bin of an empty storage has %d items", len(items))
+	}
+
+	s.mkdir("/docs")
+	s.upload("/docs/a.txt", "a")
+	s.upload("/docs/b.txt", "b")
+	s.must(s.fs.Delete(s.ctx, ref("/docs/a.txt")), "delete /docs/a.txt")
+	s.must(s.fs.Delete(s.ctx, ref("/docs/b.txt")), "delete /docs/b.txt")
+
+	items, err = s.fs.ListRecycle(s.ctx)
+	s.must(err, "list recycle")
+	keys := map[string]string{}
+	for _, item := range items {
+		keys[item.Path] = item.Key
+	}
+	if len(items) != 2 || keys["/docs/a.txt"] == "" || keys["/docs/b.txt"] == "" {
+		t.Fatalf("the recycle bin contains %v", items)
+	}
+
+	s.must(s.fs.RestoreRecycleItem(s.ctx, keys["/docs/a.txt"]), "restore recycle item")
+	s.expectContent("/docs/a.txt", "a")
+
+	s.must(s.fs.PurgeRecycleItem(s.ctx, keys["/docs/b.txt"]), "purge recycle item")
+	items, err = s.fs.ListRecycle(s.ctx)
+	s.must(err, "list recycle")
+	if len(items) != 0 {
+		t.Fatalf("the recycle bin contains %v after the restore and the purge", items)
+	}
+
+	s.must(s.fs.Delete(s.ctx, ref("/docs")), "delete /docs")
+	s.must(s.fs.EmptyRecycle(s.ctx), "empty recycle")
+	items, err = s.fs.ListRecycle(s.ctx)
+	s.must(err, "list recycle")
+	if len(items) != 0 {
+		t.Fatalf("the recycle bin contains %v after it was emptied", items)
+	}
+}
+
+func testGrants(t *testing.T, s *suite) {
+	s.mkdir("/shared")
+	grant := &provider.Grant{
+		Grantee: &provider.Grantee{
+			Type: provider.GranteeType_GRANTEE_TYPE_USER,
+			Id:   &userpb.UserId{OpaqueId: "conformance-grantee"},
+		},
+		Permissions: &provider.ResourcePermissions{Stat: true, ListContainer: true, InitiateFileDownload: true},
+	}
+	err := s.fs.AddGrant(s.ctx, ref("/shared"), grant)
+	s.skipIfNotSupported(err, "grants")
+	s.must(err, "add grant")
+
+	find := func() *provider.Grant {
+		grants, err := s.fs.ListGrants(s.ctx, ref("/shared"))
+		s.must(err, "list grants")
+		for _, g := range grants {
+			if g.Grantee.GetId().GetOpaqueId() == grant.Grantee.Id.OpaqueId {
+				return g
+			}
+		}
+		return nil
+	}
+	if g := find(); g == nil || !g.Permissions.Stat {
+		t.Fatalf("the grant is not listed: %v", g)
+	}
+
+	grant.Permissions.InitiateFileUpload = true
+	grant.Permissions.CreateContainer = true
+	s.must(s.fs.UpdateGrant(s.ctx, ref("/shared"), grant), "update grant")
+	if g := find(); g == nil || !g.Permissions.InitiateFileUpload {
+		t.Errorf("the grant was not updated: %v", g)
+	}
+
+	s.must(s.fs.RemoveGrant(s.ctx, ref("/shared"), grant), "remove grant")
+	if g := find(); g != nil {
+		t.Errorf("the grant was not removed: %v", g)
+	}
+}
+
+// testConcurrency uploads files in the same folder concurrently, and
+// overwrites the same file concurrently, each upload must be complete.
+func testConcurrency(t *testing.T, s *suite) {
+	const n = 8
+	s.mkdir("/docs")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			content := strings.Repeat(fmt.Sprint(i), 1024)
+			errs <- s.fs.Upload(s.ctx, ref(fmt.Sprintf("/docs/%d.txt", i)), ioutil.NopCloser(strings.NewReader(content)))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			content := strings.Repeat(fmt.Sprint(i), 1024)
+			errs <- s.fs.Upload(s.ctx, ref("/docs/shared.txt"), ioutil.NopCloser(strings.NewReader(content)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent upload: %v", err)
+		}
+	}
+
+	names := []string{"shared.txt"}
+	for i := 0; i < n; i++ {
+		fn := fmt.Sprintf("/docs/%d.txt", i)
+		names = append(names, path.Base(fn))
+		s.expectContent(fn, strings.Repeat(fmt.Sprint(i), 1024))
+	}
+	s.expectList("/docs", names...)
+
+	shared := s.content("/docs/shared.txt")
+	if len(shared) != 1024 || !bytes.Equal([]byte(shared), bytes.Repeat([]byte(shared[:1]), 1024)) {
+		t.Errorf("the concurrent overwrites of /docs/shared.txt were mixed: %.32q...", shared)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package encryption wraps a storage driver to encrypt the content of the
+// files before it reaches the storage. Every file is encrypted with its own
+// key, stored in the header of the file wrapped by the master key of a key
+// provider, so the data at rest is protected even on an untrusted storage.
+//
+// The encryption is experimental: the resumable uploads of the driver are
+// not available through the wrapper, and the files written before the
+// encryption was enabled are read as they are.
+package encryption
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/encryption/keys"
+	"github.com/cs3org/reva/pkg/storage/encryption/keys/registry"
+)
+
+// Config configures the encryption of a storage driver.
+type Config struct {
+	// KeyProvider wraps the per-file keys, no encryption if empty.
+	KeyProvider  string                            `mapstructure:"key_provider"`
+	KeyProviders map[string]map[string]interface{} `mapstructure:"key_providers"`
+}
+
+// Wrap returns the driver encrypting the files with the key provider of the
+// config, next as is if none is configured.
+func Wrap(next storage.FS, c Config) (storage.FS, error) {
+	if c.KeyProvider == "" {
+		return next, nil
+	}
+	f, ok := registry.NewFuncs[c.KeyProvider]
+	if !ok {
+		return nil, fmt.Errorf("key provider not found: %s", c.KeyProvider)
+	}
+	p, err := f(c.KeyProviders[c.KeyProvider])
+	if err != nil {
+		return nil, err
+	}
+	return New(next, p), nil
+}
+
+type fs struct {
+	storage.FS
+	keys keys.Provider
+}
+
+// New returns a storage.FS encrypting the files stored in next with per-file
+// keys wrapped by p.
+func New(next storage.FS, p keys.Provider) storage.FS {
+	return &fs{FS: next, keys: p}
+}
+
+func (f *fs) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	ri, err := f.FS.GetMD(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	plainInfo(ri)
+	return ri, nil
+}
+
+func (f *fs) ListFolder(ctx context.Context, ref *provider.Reference) ([]*provider.ResourceInfo, error) {
+	ris, err := f.FS.ListFolder(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, ri := range ris {
+		plainInfo(ri)
+	}
+	return ris, nil
+}
+
+// plainInfo sets the size of the file to the size of its content.
+func plainInfo(ri *provider.ResourceInfo) {
+	if ri.Type == provider.ResourceType_RESOURCE_TYPE_FILE {
+		ri.Size = uint64(PlainSize(int64(ri.Size)))
+	}
+}
+
+func (f *fs) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	e, err := newEncrypter(ctx, f.keys, r)
+	if err != nil {
+		return err
+	}
+	return f.FS.Upload(ctx, ref, e)
+}
+
+func (f *fs) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	rc, err := f.FS.Download(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return f.decrypt(ctx, rc)
+}
+
+func (f *fs) DownloadRevision(ctx context.Context, ref *provider.Reference, key string) (io.ReadCloser, error) {
+	rc, err := f.FS.DownloadRevision(ctx, ref, key)
+	if err != nil {
+		return nil, err
+	}
+	return f.decrypt(ctx, rc)
+}
+
+// decrypt returns the content of the encrypted file read from rc, the file
+// as is if it is not encrypted.
+func (f *fs) decrypt(ctx context.Context, rc io.ReadCloser) (io.ReadCloser, error) {
+	in := bufio.NewReaderSize(rc, sealedChunk)
+	b, err := in.Peek(HeaderSize)
+	if err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	h, err := readHeader(ctx, f.keys, b)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	if h == nil {
+		return struct {
+			io.Reader
+			io.Closer
+		}{in, rc}, nil
+	}
+	if _, err := in.Discard(HeaderSize); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return newDecrypter(h, rc, in, 0, 0)
+}
+
+// DownloadRange only reads and decrypts the chunks holding the range.
+func (f *fs) DownloadRange(ctx context.Context, ref *provider.Reference, offset, length int64) (io.ReadCloser, error) {
+	if length <= 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	hrc, err := storage.DownloadRange(ctx, f.FS, ref, 0, HeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(hrc)
+	hrc.Close()
+	if err != nil {
+		return nil, err
+	}
+	h, err := readHeader(ctx, f.keys, b)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		return storage.DownloadRange(ctx, f.FS, ref, offset, length)
+	}
+
+	first, last := offset/ChunkSize, (offset+length-1)/ChunkSize
+	chunks := last - first + 1
+	// one more byte tells whether the last chunk read is the last one of
+	// the file
+	rc, err := storage.DownloadRange(ctx, f.FS, ref, HeaderSize+first*sealedChunk, chunks*sealedChunk+1)
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDecrypter(h, rc, bufio.NewReaderSize(rc, sealedChunk), uint32(first), chunks)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, d, offset-first*ChunkSize); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return storage.LimitReadCloser(d, length), nil
+}
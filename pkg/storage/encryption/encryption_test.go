@@ -0,0 +1,192 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage"
+)
+
+// xorKeys wraps the keys by flipping their bits.
+type xorKeys struct{}
+
+func (xorKeys) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	w := make([]byte, len(key))
+	for i, b := range key {
+		w[i] = ^b
+	}
+	return w, nil
+}
+
+func (k xorKeys) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return k.Wrap(ctx, wrapped)
+}
+
+// memFS keeps a single file.
+type memFS struct {
+	storage.FS
+	data []byte
+}
+
+func (m *memFS) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	m.data = b
+	return err
+}
+
+func (m *memFS) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(m.data)), nil
+}
+
+func (m *memFS) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	return &provider.ResourceInfo{Type: provider.ResourceType_RESOURCE_TYPE_FILE, Size: uint64(len(m.data))}, nil
+}
+
+func content(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	ref := &provider.Reference{}
+	for _, n := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 100} {
+		m := &memFS{}
+		fs := New(m, xorKeys{})
+		data := content(n)
+		if err := fs.Upload(ctx, ref, ioutil.NopCloser(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(m.data)) != EncryptedSize(int64(n)) {
+			t.Errorf("%d: stored %d bytes, want %d", n, len(m.data), EncryptedSize(int64(n)))
+		}
+		if n > 16 && bytes.Contains(m.data, data[:16]) {
+			t.Errorf("%d: content stored in clear", n)
+		}
+
+		ri, err := fs.GetMD(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ri.Size != uint64(n) {
+			t.Errorf("%d: got size %d", n, ri.Size)
+		}
+
+		rc, err := fs.Download(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("%d: %v", n, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%d: content differs", n)
+		}
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	ctx := context.Background()
+	ref := &provider.Reference{}
+	m := &memFS{}
+	fs := New(m, xorKeys{})
+	data := content(3*ChunkSize + 100)
+	if err := fs.Upload(ctx, ref, ioutil.NopCloser(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	rd := fs.(storage.RangeDownloader)
+	for _, r := range [][2]int64{{0, 10}, {ChunkSize - 5, 10}, {ChunkSize, ChunkSize}, {2*ChunkSize + 10, ChunkSize + 90}, {0, int64(len(data))}} {
+		rc, err := rd.DownloadRange(ctx, ref, r[0], r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("%v: %v", r, err)
+		}
+		if !bytes.Equal(got, data[r[0]:r[0]+r[1]]) {
+			t.Errorf("%v: content differs", r)
+		}
+	}
+}
+
+func TestTampering(t *testing.T) {
+	ctx := context.Background()
+	ref := &provider.Reference{}
+	data := content(2 * ChunkSize)
+
+	for name, tamper := range map[string]func([]byte) []byte{
+		"flipped":   func(b []byte) []byte { b[HeaderSize+10] ^= 1; return b },
+		"truncated": func(b []byte) []byte { return b[:HeaderSize+sealedChunk] },
+		"reordered": func(b []byte) []byte {
+			c := append([]byte{}, b[:HeaderSize]...)
+			c = append(c, b[HeaderSize+sealedChunk:]...)
+			return append(c, b[HeaderSize:HeaderSize+sealedChunk]...)
+		},
+	} {
+		m := &memFS{}
+		fs := New(m, xorKeys{})
+		if err := fs.Upload(ctx, ref, ioutil.NopCloser(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		m.data = tamper(m.data)
+		rc, err := fs.Download(ctx, ref)
+		if err != nil {
+			continue
+		}
+		if _, err := ioutil.ReadAll(rc); err == nil {
+			t.Errorf("%s: tampered content read without error", name)
+		}
+	}
+}
+
+func TestPlainFiles(t *testing.T) {
+	ctx := context.Background()
+	ref := &provider.Reference{}
+	m := &memFS{data: []byte("written before the encryption")}
+	fs := New(m, xorKeys{})
+
+	rc, err := fs.Download(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(rc)
+	if !bytes.Equal(got, m.data) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestPlainSize(t *testing.T) {
+	for _, n := range []int64{0, 1, ChunkSize, ChunkSize + 1, 10*ChunkSize - 1} {
+		if got := PlainSize(EncryptedSize(n)); got != n {
+			t.Errorf("PlainSize(EncryptedSize(%d)) = %d", n, got)
+		}
+	}
+}
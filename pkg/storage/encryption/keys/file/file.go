@@ -0,0 +1,107 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package file implements a key provider wrapping the keys with a master key
+// read from a file.
+package file
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/storage/encryption/keys"
+	"github.com/cs3org/reva/pkg/storage/encryption/keys/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("file", New)
+}
+
+type config struct {
+	// KeyFile holds the base64 encoded 32 bytes master key.
+	KeyFile string `mapstructure:"key_file"`
+}
+
+type provider struct {
+	aead cipher.AEAD
+}
+
+// New returns a key provider wrapping the keys with AES-256-GCM and the
+// master key of the key file.
+func New(m map[string]interface{}) (keys.Provider, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "file: error decoding conf")
+	}
+	if c.KeyFile == "" {
+		return nil, errors.New("file: key_file is required")
+	}
+	data, err := ioutil.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "file: error reading key file")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "file: error decoding key file")
+	}
+	return newProvider(key)
+}
+
+func newProvider(key []byte) (*provider, error) {
+	if len(key) != 32 {
+		return nil, errors.New("file: the master key must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &provider{aead: aead}, nil
+}
+
+// Wrap returns the nonce followed by the sealed key.
+func (p *provider) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return p.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (p *provider) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	n := p.aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, errors.New("file: wrapped key too short")
+	}
+	key, err := p.aead.Open(nil, wrapped[:n], wrapped[n:], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "file: error unwrapping key")
+	}
+	return key, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	p, err := newProvider(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	wrapped, err := p.Wrap(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(wrapped, key) {
+		t.Fatal("wrapped key contains the key")
+	}
+	got, err := p.Unwrap(ctx, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Fatalf("got %x, want %x", got, key)
+	}
+
+	other, _ := newProvider(bytes.Repeat([]byte{2}, 32))
+	if _, err := other.Unwrap(ctx, wrapped); err == nil {
+		t.Fatal("unwrapped with another master key")
+	}
+	wrapped[len(wrapped)-1] ^= 1
+	if _, err := p.Unwrap(ctx, wrapped); err == nil {
+		t.Fatal("unwrapped a tampered key")
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if _, err := newProvider([]byte("short")); err == nil {
+		t.Fatal("expected an error for a short master key")
+	}
+}
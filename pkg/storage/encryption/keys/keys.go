@@ -0,0 +1,32 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package keys defines the providers of the master keys wrapping the keys
+// the files are encrypted with.
+package keys
+
+import "context"
+
+// Provider wraps the per-file keys with a master key it holds, so that the
+// per-file keys can be stored next to the data they encrypt.
+type Provider interface {
+	// Wrap encrypts the key.
+	Wrap(ctx context.Context, key []byte) ([]byte, error)
+	// Unwrap decrypts a key returned by Wrap.
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
@@ -0,0 +1,138 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package vault implements a key provider wrapping the keys with the transit
+// secrets engine of HashiCorp Vault, so that the master key never leaves
+// Vault.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/storage/encryption/keys"
+	"github.com/cs3org/reva/pkg/storage/encryption/keys/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("vault", New)
+}
+
+type config struct {
+	Address string `mapstructure:"address"`
+	// Token authenticates to Vault, the VAULT_TOKEN environment variable is
+	// used if empty.
+	Token string `mapstructure:"token"`
+	// Mount is the path the transit engine is mounted at.
+	Mount string `mapstructure:"mount"`
+	// Key is the name of the transit key.
+	Key string `mapstructure:"key"`
+}
+
+type provider struct {
+	c *config
+}
+
+// New returns a key provider using the transit engine of Vault.
+func New(m map[string]interface{}) (keys.Provider, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "vault: error decoding conf")
+	}
+	if c.Address == "" || c.Key == "" {
+		return nil, errors.New("vault: address and key are required")
+	}
+	if c.Token == "" {
+		c.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if c.Mount == "" {
+		c.Mount = "transit"
+	}
+	c.Address = strings.TrimSuffix(c.Address, "/")
+	return &provider{c: c}, nil
+}
+
+// Wrap returns the Vault ciphertext of the key, like vault:v1:...
+func (p *provider) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	var res struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	req := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}
+	if err := p.do(ctx, "encrypt", req, &res); err != nil {
+		return nil, err
+	}
+	return []byte(res.Ciphertext), nil
+}
+
+func (p *provider) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var res struct {
+		Plaintext string `json:"plaintext"`
+	}
+	req := map[string]string{"ciphertext": string(wrapped)}
+	if err := p.do(ctx, "decrypt", req, &res); err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(res.Plaintext)
+	if err != nil {
+		return nil, errors.Wrap(err, "vault: error decoding key")
+	}
+	return key, nil
+}
+
+// do posts body to the transit operation and decodes the data of the
+// response into data.
+func (p *provider) do(ctx context.Context, op string, body, data interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", p.c.Address, p.c.Mount, op, p.c.Key)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "vault: error creating request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Vault-Token", p.c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := rhttp.GetHTTPClient(ctx).Do(req)
+	if err != nil {
+		return errors.Wrap(err, "vault: error calling "+op)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault: error calling %s: %s", op, res.Status)
+	}
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+		return errors.Wrap(err, "vault: error decoding response")
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/cs3org/reva/pkg/storage/encryption/keys"
+	"github.com/pkg/errors"
+)
+
+// The encrypted files start with a header of HeaderSize bytes made of the
+// magic, the nonce prefix, the length of the wrapped key and the wrapped key,
+// padded with zeros. The content follows in chunks of ChunkSize bytes, each
+// sealed with AES-256-GCM under the per-file key. The nonce of a chunk is
+// the nonce prefix, the big endian chunk number and a byte set to 1 for the
+// last chunk only, so that chunks can neither be reordered nor truncated.
+const (
+	HeaderSize = 512
+	ChunkSize  = 64 * 1024
+
+	magic       = "REVAENC1"
+	prefixSize  = 7
+	overhead    = 16
+	sealedChunk = ChunkSize + overhead
+	keySize     = 32
+)
+
+// maxWrappedKeySize is the room left in the header for the wrapped key.
+const maxWrappedKeySize = HeaderSize - len(magic) - prefixSize - 2
+
+// EncryptedSize returns the size of the encrypted content of size bytes.
+func EncryptedSize(size int64) int64 {
+	chunks := (size + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		// the empty content is an empty last chunk
+		chunks = 1
+	}
+	return HeaderSize + size + chunks*overhead
+}
+
+// PlainSize returns the size of the content encrypted in size bytes. Sizes
+// too small to hold encrypted content are returned as is.
+func PlainSize(size int64) int64 {
+	if size < HeaderSize+overhead {
+		return size
+	}
+	data := size - HeaderSize
+	full, rest := data/sealedChunk, data%sealedChunk
+	if rest == 0 {
+		return full * ChunkSize
+	}
+	return full*ChunkSize + rest - overhead
+}
+
+type header struct {
+	key    []byte
+	prefix []byte
+}
+
+func newHeader(ctx context.Context, p keys.Provider) (*header, []byte, error) {
+	h := &header{key: make([]byte, keySize), prefix: make([]byte, prefixSize)}
+	if _, err := io.ReadFull(rand.Reader, h.key); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, h.prefix); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := p.Wrap(ctx, h.key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encryption: error wrapping key")
+	}
+	if len(wrapped) > maxWrappedKeySize {
+		return nil, nil, errors.New("encryption: wrapped key too long")
+	}
+
+	b := make([]byte, HeaderSize)
+	n := copy(b, magic)
+	n += copy(b[n:], h.prefix)
+	binary.BigEndian.PutUint16(b[n:], uint16(len(wrapped)))
+	copy(b[n+2:], wrapped)
+	return h, b, nil
+}
+
+// readHeader returns the header of the encrypted content, nil if b does not
+// start with the magic.
+func readHeader(ctx context.Context, p keys.Provider, b []byte) (*header, error) {
+	if len(b) < HeaderSize || !bytes.Equal(b[:len(magic)], []byte(magic)) {
+		return nil, nil
+	}
+	n := len(magic)
+	h := &header{prefix: append([]byte{}, b[n:n+prefixSize]...)}
+	n += prefixSize
+	l := int(binary.BigEndian.Uint16(b[n:]))
+	if l > maxWrappedKeySize {
+		return nil, errors.New("encryption: invalid header")
+	}
+	key, err := p.Unwrap(ctx, b[n+2:n+2+l])
+	if err != nil {
+		return nil, errors.Wrap(err, "encryption: error unwrapping key")
+	}
+	h.key = key
+	return h, nil
+}
+
+func (h *header) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(h.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (h *header) nonce(chunk uint32, last bool) []byte {
+	n := make([]byte, 12)
+	copy(n, h.prefix)
+	binary.BigEndian.PutUint32(n[prefixSize:], chunk)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+// encrypter reads the header and the sealed chunks of the content of src.
+type encrypter struct {
+	src   io.ReadCloser
+	in    *bufio.Reader
+	h     *header
+	aead  cipher.AEAD
+	buf   []byte
+	out   []byte
+	chunk uint32
+	done  bool
+}
+
+func newEncrypter(ctx context.Context, p keys.Provider, src io.ReadCloser) (*encrypter, error) {
+	h, hb, err := newHeader(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := h.aead()
+	if err != nil {
+		return nil, err
+	}
+	return &encrypter{
+		src:  src,
+		in:   bufio.NewReaderSize(src, ChunkSize),
+		h:    h,
+		aead: aead,
+		buf:  make([]byte, ChunkSize),
+		out:  hb,
+	}, nil
+}
+
+func (e *encrypter) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// seal seals the next chunk, the last one when no content follows it.
+func (e *encrypter) seal() error {
+	n, err := io.ReadFull(e.in, e.buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := err != nil
+	if !last {
+		if _, err := e.in.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	e.out = e.aead.Seal(e.out[:0], e.h.nonce(e.chunk, last), e.buf[:n], nil)
+	e.chunk++
+	e.done = last
+	return nil
+}
+
+func (e *encrypter) Close() error {
+	return e.src.Close()
+}
+
+// decrypter reads the content of the sealed chunks of src, starting at the
+// given chunk. With a positive limit, only that many chunks are read.
+type decrypter struct {
+	src   io.ReadCloser
+	in    *bufio.Reader
+	h     *header
+	aead  cipher.AEAD
+	buf   []byte
+	out   []byte
+	chunk uint32
+	limit int64
+	done  bool
+}
+
+func newDecrypter(h *header, src io.ReadCloser, in *bufio.Reader, chunk uint32, limit int64) (*decrypter, error) {
+	aead, err := h.aead()
+	if err != nil {
+		return nil, err
+	}
+	return &decrypter{
+		src:   src,
+		in:    in,
+		h:     h,
+		aead:  aead,
+		buf:   make([]byte, sealedChunk),
+		chunk: chunk,
+		limit: limit,
+	}, nil
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// open opens the next chunk, which is the last one when no data follows it.
+func (d *decrypter) open() error {
+	n, err := io.ReadFull(d.in, d.buf)
+	if err == io.EOF {
+		return errors.New("encryption: truncated content")
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := err != nil
+	if !last {
+		if _, err := d.in.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	out, err := d.aead.Open(d.buf[:0], d.h.nonce(d.chunk, last), d.buf[:n], nil)
+	if err != nil {
+		return errors.Wrap(err, "encryption: error decrypting content")
+	}
+	d.out = out
+	d.chunk++
+	if d.limit > 0 {
+		d.limit--
+		if d.limit == 0 {
+			last = true
+		}
+	}
+	d.done = last
+	return nil
+}
+
+func (d *decrypter) Close() error {
+	return d.src.Close()
+}
@@ -0,0 +1,50 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package favorite keeps the resources the users marked as favorite, so that
+// they can be listed without walking the storage.
+package favorite
+
+import (
+	"context"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// Manager keeps the favorites of the users. The favorite flag stored in the
+// metadata of the resources stays the reference, the manager only tells
+// where to look for it.
+type Manager interface {
+	// ListFavorites returns the resources the user marked as favorite.
+	ListFavorites(ctx context.Context, userID *user.UserId) ([]*provider.ResourceId, error)
+	// SetFavorite marks the resource as favorite of the user.
+	SetFavorite(ctx context.Context, userID *user.UserId, resourceID *provider.ResourceId) error
+	// UnsetFavorite removes the resource from the favorites of the user.
+	UnsetFavorite(ctx context.Context, userID *user.UserId, resourceID *provider.ResourceId) error
+}
+
+// UserKey is the key of the favorites of the user in the managers.
+func UserKey(u *user.UserId) string {
+	return u.OpaqueId + "@" + u.Idp
+}
+
+// ResourceKey is the key of the resource among the favorites of a user.
+func ResourceKey(id *provider.ResourceId) string {
+	return id.StorageId + "!" + id.OpaqueId
+}
@@ -0,0 +1,162 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"sync"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/jsonfile"
+	"github.com/cs3org/reva/pkg/storage/favorite"
+	"github.com/cs3org/reva/pkg/storage/favorite/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("json", New)
+}
+
+type config struct {
+	File string `mapstructure:"file"`
+}
+
+type favoritesModel struct {
+	// Favorites holds the resources by resource key, by user key.
+	Favorites map[string]map[string]*provider.ResourceId `json:"favorites"`
+}
+
+type mgr struct {
+	sync.Mutex // concurrent access to the file and model
+	model      *favoritesModel
+	file       *jsonfile.File
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new favorite manager that persists the favorites to a json
+// file, which is reloaded when it changes.
+func New(m map[string]interface{}) (favorite.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	// if file is not set we use temporary file
+	if c.File == "" {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			err = errors.Wrap(err, "error creating temporary directory for storing favorites")
+			return nil, err
+		}
+		c.File = path.Join(dir, "favorites.json")
+	}
+
+	f, err := jsonfile.Open(c.File)
+	if err != nil {
+		err = errors.Wrap(err, "error opening/creating the file")
+		return nil, err
+	}
+
+	mgr := &mgr{file: f}
+	if err := mgr.load(); err != nil {
+		err = errors.Wrap(err, "error loading the file containing the favorites")
+		return nil, err
+	}
+	return mgr, nil
+}
+
+// load picks up the favorites marked through the other services.
+func (m *mgr) load() error {
+	model := &favoritesModel{}
+	if ok, err := m.file.Load(model); err != nil || !ok {
+		return err
+	}
+	if model.Favorites == nil {
+		model.Favorites = map[string]map[string]*provider.ResourceId{}
+	}
+
+	m.model = model
+	return nil
+}
+
+func (m *mgr) save() error {
+	return m.file.Save(m.model)
+}
+
+func (m *mgr) ListFavorites(ctx context.Context, userID *user.UserId) ([]*provider.ResourceId, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]*provider.ResourceId, 0, len(m.model.Favorites[favorite.UserKey(userID)]))
+	for _, id := range m.model.Favorites[favorite.UserKey(userID)] {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (m *mgr) SetFavorite(ctx context.Context, userID *user.UserId, resourceID *provider.ResourceId) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	u := favorite.UserKey(userID)
+	if m.model.Favorites[u] == nil {
+		m.model.Favorites[u] = map[string]*provider.ResourceId{}
+	}
+	m.model.Favorites[u][favorite.ResourceKey(resourceID)] = resourceID
+	return m.save()
+}
+
+func (m *mgr) UnsetFavorite(ctx context.Context, userID *user.UserId, resourceID *provider.ResourceId) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	u := favorite.UserKey(userID)
+	if _, ok := m.model.Favorites[u][favorite.ResourceKey(resourceID)]; !ok {
+		return nil
+	}
+	delete(m.model.Favorites[u], favorite.ResourceKey(resourceID))
+	if len(m.model.Favorites[u]) == 0 {
+		delete(m.model.Favorites, u)
+	}
+	return m.save()
+}
@@ -0,0 +1,80 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package json
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+func TestFavorites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "favorites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "favorites.json")
+
+	m, err := New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	einstein := &user.UserId{OpaqueId: "einstein", Idp: "cernbox.cern.ch"}
+	marie := &user.UserId{OpaqueId: "marie", Idp: "cesnet.cz"}
+	notes := &provider.ResourceId{StorageId: "home", OpaqueId: "notes"}
+	photos := &provider.ResourceId{StorageId: "home", OpaqueId: "photos"}
+
+	for _, id := range []*provider.ResourceId{notes, photos, notes} {
+		if err := m.SetFavorite(ctx, einstein, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.SetFavorite(ctx, marie, photos); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UnsetFavorite(ctx, einstein, photos); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second manager sharing the file sees the favorites
+	other, err := New(map[string]interface{}{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := other.ListFavorites(ctx, einstein)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0].OpaqueId != "notes" {
+		t.Errorf("expected the notes to be the only favorite of einstein, got %v", ids)
+	}
+	if ids, _ := other.ListFavorites(ctx, marie); len(ids) != 1 || ids[0].OpaqueId != "photos" {
+		t.Errorf("expected the photos to be the only favorite of marie, got %v", ids)
+	}
+	if ids, _ := other.ListFavorites(ctx, &user.UserId{OpaqueId: "richard"}); len(ids) != 0 {
+		t.Errorf("expected no favorites, got %v", ids)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage/favorite"
+	"github.com/cs3org/reva/pkg/storage/favorite/registry"
+)
+
+func init() {
+	registry.Register("memory", New)
+}
+
+type manager struct {
+	mu sync.Mutex
+	// favorites holds the resources by resource key, by user key.
+	favorites map[string]map[string]*provider.ResourceId
+}
+
+// New returns a favorite manager keeping the favorites in memory, they are
+// lost when revad restarts and not shared between instances.
+func New(m map[string]interface{}) (favorite.Manager, error) {
+	return &manager{favorites: map[string]map[string]*provider.ResourceId{}}, nil
+}
+
+func (m *manager) ListFavorites(ctx context.Context, userID *user.UserId) ([]*provider.ResourceId, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]*provider.ResourceId, 0, len(m.favorites[favorite.UserKey(userID)]))
+	for _, id := range m.favorites[favorite.UserKey(userID)] {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (m *manager) SetFavorite(ctx context.Context, userID *user.UserId, resourceID *provider.ResourceId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := favorite.UserKey(userID)
+	if m.favorites[u] == nil {
+		m.favorites[u] = map[string]*provider.ResourceId{}
+	}
+	m.favorites[u][favorite.ResourceKey(resourceID)] = resourceID
+	return nil
+}
+
+func (m *manager) UnsetFavorite(ctx context.Context, userID *user.UserId, resourceID *provider.ResourceId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := favorite.UserKey(userID)
+	delete(m.favorites[u], favorite.ResourceKey(resourceID))
+	if len(m.favorites[u]) == 0 {
+		delete(m.favorites, u)
+	}
+	return nil
+}
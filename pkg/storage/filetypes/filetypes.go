@@ -0,0 +1,216 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package filetypes decides which files can be uploaded by their type, for
+// the sites blocking executables or accepting only some kinds of data. The
+// type of a file is its extension, the mime type of the extension and, once
+// the content is received, the mime type detected from the content.
+package filetypes
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/mime"
+)
+
+// Rules are the allow and deny lists of a policy. Their entries are either
+// extensions, like ".exe", or mime types, like "application/pdf" or
+// "image/*".
+type Rules struct {
+	// Allow lists the types accepted, all of them if empty.
+	Allow []string `mapstructure:"allow"`
+	// Deny lists the types refused, even when they are allowed.
+	Deny []string `mapstructure:"deny"`
+}
+
+// Config is the configuration of a policy.
+type Config struct {
+	Allow []string `mapstructure:"allow"`
+	Deny  []string `mapstructure:"deny"`
+	// Overrides replaces the rules for the files below the paths, like the
+	// mount points of the storages. The longest matching path wins.
+	Overrides map[string]Rules `mapstructure:"overrides"`
+}
+
+// Rejected is the error returned for the files refused by a policy, it is
+// the extension or the mime type which got them refused.
+type Rejected string
+
+func (e Rejected) Error() string { return "filetypes: type not allowed: " + string(e) }
+
+// Policy checks the types of the uploaded files.
+type Policy struct {
+	rules     *rules
+	overrides []*override
+}
+
+type override struct {
+	prefix string
+	rules  *rules
+}
+
+type rules struct {
+	allow, deny []string
+	// allowTypes tells whether the allow list has mime types, which only
+	// the content can match
+	allowTypes bool
+}
+
+// New returns the policy of the configuration, nil if it has no rules.
+func New(c *Config) (*Policy, error) {
+	if len(c.Allow) == 0 && len(c.Deny) == 0 && len(c.Overrides) == 0 {
+		return nil, nil
+	}
+	def, err := newRules(Rules{Allow: c.Allow, Deny: c.Deny})
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{rules: def}
+	for prefix, r := range c.Overrides {
+		o, err := newRules(r)
+		if err != nil {
+			return nil, err
+		}
+		p.overrides = append(p.overrides, &override{prefix: path.Clean("/" + prefix), rules: o})
+	}
+	sort.Slice(p.overrides, func(i, j int) bool {
+		return len(p.overrides[i].prefix) > len(p.overrides[j].prefix)
+	})
+	return p, nil
+}
+
+func newRules(r Rules) (*rules, error) {
+	allow, err := normalize(r.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := normalize(r.Deny)
+	if err != nil {
+		return nil, err
+	}
+	rs := &rules{allow: allow, deny: deny}
+	for _, e := range allow {
+		if !isExt(e) {
+			rs.allowTypes = true
+		}
+	}
+	return rs, nil
+}
+
+func normalize(entries []string) ([]string, error) {
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !isExt(e) && !strings.Contains(e, "/") {
+			return nil, fmt.Errorf("filetypes: invalid entry %q, neither an extension nor a mime type", e)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func isExt(e string) bool {
+	return strings.HasPrefix(e, ".")
+}
+
+// Check returns a Rejected error if the file cannot be uploaded. The head is
+// the beginning of the content, at most 512 bytes are used to detect its
+// type. Without the content only the name is checked, and the files are
+// only rejected when their content could not get them accepted.
+func (p *Policy) Check(fn string, head []byte) error {
+	rs := p.rulesFor(fn)
+
+	ext := strings.ToLower(path.Ext(fn))
+	types := []string{}
+	if t := mime.Detect(false, fn); t != "" {
+		types = append(types, mediaType(t))
+	}
+	if head != nil {
+		types = append(types, mediaType(http.DetectContentType(head)))
+	}
+
+	if ext != "" && contains(rs.deny, ext) {
+		return Rejected(ext)
+	}
+	for _, t := range types {
+		if matchesType(rs.deny, t) {
+			return Rejected(t)
+		}
+	}
+
+	if len(rs.allow) == 0 || (ext != "" && contains(rs.allow, ext)) {
+		return nil
+	}
+	for _, t := range types {
+		if matchesType(rs.allow, t) {
+			return nil
+		}
+	}
+	if head == nil && rs.allowTypes {
+		return nil
+	}
+	if len(types) > 0 {
+		return Rejected(types[len(types)-1])
+	}
+	if ext == "" {
+		return Rejected("application/octet-stream")
+	}
+	return Rejected(ext)
+}
+
+func (p *Policy) rulesFor(fn string) *rules {
+	fn = path.Clean("/" + fn)
+	for _, o := range p.overrides {
+		if fn == o.prefix || strings.HasPrefix(fn, strings.TrimSuffix(o.prefix, "/")+"/") {
+			return o.rules
+		}
+	}
+	return p.rules
+}
+
+func mediaType(t string) string {
+	if i := strings.Index(t, ";"); i >= 0 {
+		t = t[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+func contains(entries []string, e string) bool {
+	for _, x := range entries {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(entries []string, t string) bool {
+	for _, e := range entries {
+		if isExt(e) {
+			continue
+		}
+		if e == t || e == "*/*" || (strings.HasSuffix(e, "/*") && strings.HasPrefix(t, strings.TrimSuffix(e, "*"))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package filetypes
+
+import (
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	p, err := New(&Config{
+		Deny: []string{".exe", ".BAT", "text/html"},
+		Overrides: map[string]Rules{
+			"/eos/scans":     {Allow: []string{".pdf", "image/*"}},
+			"/eos/scans/raw": {},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A")
+	pdf := []byte("%PDF-1.4")
+	tests := []struct {
+		fn       string
+		head     []byte
+		rejected bool
+	}{
+		{"/home/setup.exe", nil, true},
+		{"/home/SETUP.EXE", nil, true},
+		{"/home/run.bat", nil, true},
+		{"/home/report.pdf", nil, false},
+		{"/home/notes", []byte("hello"), false},
+		{"/home/page.html", nil, true},
+		{"/home/page", []byte("<html><body></body></html>"), true},
+		{"/eos/scans/a.pdf", pdf, false},
+		{"/eos/scans/a.exe", nil, false},
+		{"/eos/scans/a.txt", nil, false},
+		{"/eos/scans/a.txt", []byte("text"), true},
+		{"/eos/scans/photo", png, false},
+		{"/eos/scansx/a.exe", nil, true},
+		{"/eos/scans/raw/a.exe", nil, false},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.fn, tt.head)
+		if _, ok := err.(Rejected); ok != tt.rejected {
+			t.Errorf("Check(%q) = %v, rejected %v", tt.fn, err, tt.rejected)
+		}
+	}
+}
+
+func TestCheckExtensionsOnly(t *testing.T) {
+	p, err := New(&Config{Allow: []string{".txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check("/a.txt", nil); err != nil {
+		t.Errorf("allowed extension rejected: %v", err)
+	}
+	if err := p.Check("/a.pdf", nil); err == nil {
+		t.Error("extension rejected without the content")
+	}
+	if err := p.Check("/a", nil); err == nil {
+		t.Error("file without extension accepted")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if p, err := New(&Config{}); p != nil || err != nil {
+		t.Errorf("empty config: %v %v", p, err)
+	}
+	if _, err := New(&Config{Deny: []string{"exe"}}); err == nil {
+		t.Error("invalid entry accepted")
+	}
+}
@@ -0,0 +1,468 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/fs/objectstore"
+	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/trace"
+	"github.com/gofrs/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("azure", New)
+}
+
+// apiVersion is the version of the blob service REST API used.
+const apiVersion = "2019-12-12"
+
+type config struct {
+	objectstore.Config `mapstructure:",squash"`
+	AccountName        string `mapstructure:"account_name"`
+	// AccountKey is the base64 encoded shared key of the account.
+	AccountKey string `mapstructure:"account_key"`
+	// SASToken is a shared access signature, used instead of the account
+	// key.
+	SASToken  string `mapstructure:"sas_token"`
+	Container string `mapstructure:"container"`
+	// Endpoint is the url of the blob service, defaults to
+	// https://<account_name>.blob.core.windows.net.
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+type store struct {
+	c        *config
+	endpoint *url.URL
+	key      []byte
+	sas      url.Values
+	client   *http.Client
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns an implementation of the storage.FS interface that stores the
+// files in the blobs of an Azure Blob Storage container, authenticating
+// with the shared key of the account or with a shared access signature.
+func New(m map[string]interface{}) (storage.FS, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.AccountName == "" || c.Container == "" {
+		return nil, errors.New("azure: account_name and container must be set")
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://" + c.AccountName + ".blob.core.windows.net"
+	}
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "azure: invalid endpoint")
+	}
+
+	s := &store{c: c, endpoint: endpoint, client: &http.Client{Transport: trace.Transport(http.DefaultTransport)}}
+	switch {
+	case c.SASToken != "":
+		if s.sas, err = url.ParseQuery(strings.TrimPrefix(c.SASToken, "?")); err != nil {
+			return nil, errors.Wrap(err, "azure: invalid sas_token")
+		}
+	case c.AccountKey != "":
+		if s.key, err = base64.StdEncoding.DecodeString(c.AccountKey); err != nil {
+			return nil, errors.Wrap(err, "azure: invalid account_key")
+		}
+	default:
+		return nil, errors.New("azure: account_key or sas_token must be set")
+	}
+
+	return objectstore.New("azure", s, &c.Config), nil
+}
+
+// url returns the url of the blob with key k, or of the container when k
+// is empty.
+func (s *store) url(k string, q url.Values) *url.URL {
+	u := *s.endpoint
+	u.Path = path.Join("/", u.Path, s.c.Container)
+	if k != "" {
+		// keep the trailing slash of folder markers
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + k
+	}
+	if q == nil {
+		q = url.Values{}
+	}
+	for k, v := range s.sas {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return &u
+}
+
+// do sends a signed request, the body is read size bytes long.
+func (s *store) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, hdr http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "azure: error creating request")
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if s.key != nil {
+		req.Header.Set("Authorization", "SharedKey "+s.c.AccountName+":"+s.sign(req))
+	}
+
+	appctx.GetLogger(ctx).Debug().Str("method", method).Str("path", u.Path).Msg("azure: sending request")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "azure: error sending "+method+" request")
+	}
+	return res, nil
+}
+
+// sign returns the shared key signature of the request, see
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (s *store) sign(req *http.Request) string {
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	h := req.Header
+	lines := []string{
+		req.Method,
+		h.Get("Content-Encoding"),
+		h.Get("Content-Language"),
+		length,
+		h.Get("Content-MD5"),
+		h.Get("Content-Type"),
+		"", // the date is sent in x-ms-date
+		h.Get("If-Modified-Since"),
+		h.Get("If-Match"),
+		h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"),
+		h.Get("Range"),
+	}
+
+	var names []string
+	for name := range h {
+		if n := strings.ToLower(name); strings.HasPrefix(n, "x-ms-") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		lines = append(lines, n+":"+strings.TrimSpace(h.Get(n)))
+	}
+
+	resource := "/" + s.c.AccountName + req.URL.EscapedPath()
+	q := req.URL.Query()
+	var params []string
+	for k := range q {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		v := q[k]
+		sort.Strings(v)
+		resource += "\n" + strings.ToLower(k) + ":" + strings.Join(v, ",")
+	}
+	lines = append(lines, resource)
+
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write([]byte(strings.Join(lines, "\n")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkStatus maps the status of a failed response to an error and closes
+// its body.
+func checkStatus(res *http.Response, k string, ok ...int) error {
+	for _, code := range ok {
+		if res.StatusCode == code {
+			return nil
+		}
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return errtypes.NotFound(k)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errtypes.PermissionDenied(k)
+	}
+	return fmt.Errorf("azure: unexpected status %s for %s: %s", res.Status, k, b)
+}
+
+func (s *store) Stat(ctx context.Context, k string) (*objectstore.Object, error) {
+	res, err := s.do(ctx, http.MethodHead, s.url(k, nil), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(res, k, http.StatusOK); err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	o := &objectstore.Object{Key: k, Size: res.ContentLength, ETag: res.Header.Get("ETag"), Metadata: map[string]string{}}
+	o.Mtime, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+	for name := range res.Header {
+		if n := strings.ToLower(name); strings.HasPrefix(n, "x-ms-meta-") {
+			o.Metadata[strings.TrimPrefix(n, "x-ms-meta-")] = res.Header.Get(name)
+		}
+	}
+	return o, nil
+}
+
+// enumerationResults is the response of the list blobs operation.
+type enumerationResults struct {
+	Blobs struct {
+		Blob []struct {
+			Name       string `xml:"Name"`
+			Properties struct {
+				LastModified  string `xml:"Last-Modified"`
+				Etag          string `xml:"Etag"`
+				ContentLength int64  `xml:"Content-Length"`
+			} `xml:"Properties"`
+		} `xml:"Blob"`
+		BlobPrefix []struct {
+			Name string `xml:"Name"`
+		} `xml:"BlobPrefix"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+func (s *store) List(ctx context.Context, prefix, delimiter string, max int) ([]*objectstore.Object, []string, error) {
+	var objects []*objectstore.Object
+	var prefixes []string
+	marker := ""
+	for {
+		q := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+		if delimiter != "" {
+			q.Set("delimiter", delimiter)
+		}
+		if max > 0 {
+			q.Set("maxresults", strconv.Itoa(max))
+		}
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		res, err := s.do(ctx, http.MethodGet, s.url("", q), nil, 0, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := checkStatus(res, prefix, http.StatusOK); err != nil {
+			return nil, nil, err
+		}
+		var er enumerationResults
+		err = xml.NewDecoder(res.Body).Decode(&er)
+		res.Body.Close()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "azure: error decoding blob list")
+		}
+
+		for _, b := range er.Blobs.Blob {
+			o := &objectstore.Object{Key: b.Name, Size: b.Properties.ContentLength, ETag: b.Properties.Etag}
+			o.Mtime, _ = http.ParseTime(b.Properties.LastModified)
+			objects = append(objects, o)
+		}
+		for _, p := range er.Blobs.BlobPrefix {
+			prefixes = append(prefixes, p.Name)
+		}
+
+		marker = er.NextMarker
+		if marker == "" || (max > 0 && len(objects)+len(prefixes) >= max) {
+			return objects, prefixes, nil
+		}
+	}
+}
+
+func (s *store) Get(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	hdr := http.Header{}
+	if length >= 0 {
+		hdr.Set("x-ms-range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		hdr.Set("x-ms-range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := s.do(ctx, http.MethodGet, s.url(k, nil), nil, 0, hdr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(res, k, http.StatusOK, http.StatusPartialContent); err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *store) Put(ctx context.Context, k string, r io.Reader, size int64) error {
+	hdr := http.Header{}
+	hdr.Set("x-ms-blob-type", "BlockBlob")
+	res, err := s.do(ctx, http.MethodPut, s.url(k, nil), r, size, hdr)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, http.StatusCreated); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Copy starts a server side copy and waits for it to finish, as copies
+// between accounts or of big blobs are asynchronous.
+func (s *store) Copy(ctx context.Context, src, dst string) error {
+	hdr := http.Header{}
+	hdr.Set("x-ms-copy-source", s.url(src, nil).String())
+	res, err := s.do(ctx, http.MethodPut, s.url(dst, nil), nil, 0, hdr)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, src, http.StatusAccepted); err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	for status := res.Header.Get("x-ms-copy-status"); status == "pending"; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+		res, err := s.do(ctx, http.MethodHead, s.url(dst, nil), nil, 0, nil)
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(res, dst, http.StatusOK); err != nil {
+			return err
+		}
+		res.Body.Close()
+		status = res.Header.Get("x-ms-copy-status")
+		if status != "pending" && status != "success" {
+			return fmt.Errorf("azure: copy of %s %s: %s", src, status, res.Header.Get("x-ms-copy-status-description"))
+		}
+	}
+	return nil
+}
+
+func (s *store) Delete(ctx context.Context, k string) error {
+	res, err := s.do(ctx, http.MethodDelete, s.url(k, nil), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, http.StatusAccepted); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (s *store) SetMetadata(ctx context.Context, k string, md map[string]string) error {
+	hdr := http.Header{}
+	for name, v := range md {
+		hdr.Set("x-ms-meta-"+name, v)
+	}
+	res, err := s.do(ctx, http.MethodPut, s.url(k, url.Values{"comp": {"metadata"}}), nil, 0, hdr)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, http.StatusOK); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// InitiateMultipart returns a random id the block ids are derived from,
+// as blocks are staged on the blob itself.
+func (s *store) InitiateMultipart(ctx context.Context, k string) (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", errors.Wrap(err, "azure: error generating upload id")
+	}
+	return id.String(), nil
+}
+
+// UploadPart stages a block, the block ids of a blob must all have the
+// same length.
+func (s *store) UploadPart(ctx context.Context, k, id string, n int, offset int64, data []byte) (string, error) {
+	blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%06d", id, n)))
+	q := url.Values{"comp": {"block"}, "blockid": {blockID}}
+	res, err := s.do(ctx, http.MethodPut, s.url(k, q), bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		return "", err
+	}
+	if err := checkStatus(res, k, http.StatusCreated); err != nil {
+		return "", err
+	}
+	return blockID, res.Body.Close()
+}
+
+// CompleteMultipart commits the staged blocks.
+func (s *store) CompleteMultipart(ctx context.Context, k, id string, parts []string, size int64) error {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + "<BlockList>")
+	for _, p := range parts {
+		b.WriteString("<Latest>" + p + "</Latest>")
+	}
+	b.WriteString("</BlockList>")
+
+	q := url.Values{"comp": {"blocklist"}}
+	res, err := s.do(ctx, http.MethodPut, s.url(k, q), &b, int64(b.Len()), nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, http.StatusCreated); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// AbortMultipart does nothing, uncommitted blocks are garbage collected by
+// the service after a week.
+func (s *store) AbortMultipart(ctx context.Context, k, id string) error {
+	return nil
+}
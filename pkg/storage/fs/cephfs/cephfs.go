@@ -0,0 +1,669 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// +build ceph
+
+package cephfs
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	goceph "github.com/ceph/go-ceph/cephfs"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/mime"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/storage/templates"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// mdPrefix is the prefix of the xattrs holding arbitrary metadata.
+const mdPrefix = "user.reva.md."
+
+func init() {
+	registry.Register("cephfs", New)
+}
+
+type config struct {
+	// Root is the path inside CephFS that is mounted.
+	Root       string `mapstructure:"root"`
+	EnableHome bool   `mapstructure:"enable_home"`
+	UserLayout string `mapstructure:"user_layout"`
+
+	// ClientID is the cephx user used to mount, without the client. prefix.
+	ClientID string `mapstructure:"client_id"`
+	MonHost  string `mapstructure:"mon_host"`
+	Keyring  string `mapstructure:"keyring"`
+
+	// SnapshotDir is the name of the CephFS snapshot directory.
+	SnapshotDir string `mapstructure:"snapshot_dir"`
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+type cephfs struct {
+	conf *config
+
+	mu     sync.Mutex
+	mounts map[string]*goceph.MountInfo // map key is the username
+}
+
+// New returns an implementation of the storage.FS interface that talks to
+// CephFS through libcephfs.
+func New(m map[string]interface{}) (storage.FS, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Root == "" {
+		c.Root = "/"
+	}
+
+	if c.UserLayout == "" {
+		c.UserLayout = "{{.Username}}"
+	}
+
+	if c.SnapshotDir == "" {
+		c.SnapshotDir = ".snap"
+	}
+
+	return &cephfs{conf: c, mounts: map[string]*goceph.MountInfo{}}, nil
+}
+
+func getUser(ctx context.Context) (*userpb.User, error) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		err := errors.Wrap(errtypes.UserRequired(""), "cephfs: error getting user from ctx")
+		return nil, err
+	}
+	return u, nil
+}
+
+// wrap returns the path of p inside the mount.
+func (fs *cephfs) wrap(ctx context.Context, p string) (string, error) {
+	if fs.conf.EnableHome {
+		layout, err := fs.GetHome(ctx)
+		if err != nil {
+			return "", err
+		}
+		return path.Join("/", layout, p), nil
+	}
+	return path.Join("/", p), nil
+}
+
+func (fs *cephfs) unwrap(ctx context.Context, np string) (string, error) {
+	if fs.conf.EnableHome {
+		layout, err := fs.GetHome(ctx)
+		if err != nil {
+			return "", err
+		}
+		np = strings.TrimPrefix(np, path.Join("/", layout))
+	}
+	return path.Join("/", np), nil
+}
+
+func (fs *cephfs) resolve(ctx context.Context, ref *provider.Reference) (string, error) {
+	if ref.GetPath() != "" {
+		return fs.wrap(ctx, ref.GetPath())
+	}
+
+	if ref.GetId() != nil {
+		return fs.wrap(ctx, path.Join("/", strings.TrimPrefix(ref.GetId().OpaqueId, "fileid-")))
+	}
+
+	// reference is invalid
+	return "", fmt.Errorf("cephfs: invalid reference %+v", ref)
+}
+
+// isSnapshotPath reports whether fn is inside a snapshot directory, those
+// are only reachable through the revisions.
+func (fs *cephfs) isSnapshotPath(fn string) bool {
+	for _, p := range strings.Split(fn, "/") {
+		if p == fs.conf.SnapshotDir {
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *cephfs) Shutdown(ctx context.Context) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for name, mount := range fs.mounts {
+		if err := mount.Unmount(); err != nil {
+			return errors.Wrap(err, "cephfs: error unmounting connection of user "+name)
+		}
+		if err := mount.Release(); err != nil {
+			return errors.Wrap(err, "cephfs: error releasing connection of user "+name)
+		}
+		delete(fs.mounts, name)
+	}
+	return nil
+}
+
+func (fs *cephfs) GetHome(ctx context.Context) (string, error) {
+	if !fs.conf.EnableHome {
+		return "", errtypes.NotSupported("cephfs: get home not supported")
+	}
+
+	u, err := getUser(ctx)
+	if err != nil {
+		err = errors.Wrap(err, "cephfs: wrap: no user in ctx and home is enabled")
+		return "", err
+	}
+	return templates.WithUser(u, fs.conf.UserLayout), nil
+}
+
+func (fs *cephfs) CreateHome(ctx context.Context) error {
+	if !fs.conf.EnableHome {
+		return errtypes.NotSupported("cephfs: create home not supported")
+	}
+
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return err
+	}
+
+	home, err := fs.wrap(ctx, "/")
+	if err != nil {
+		return err
+	}
+
+	// create the intermediate directories of the layout as well.
+	p := "/"
+	for _, d := range strings.Split(strings.Trim(home, "/"), "/") {
+		p = path.Join(p, d)
+		if err := mount.MakeDir(p, 0700); err != nil && !isErrno(err, syscall.EEXIST) {
+			return errors.Wrap(err, "cephfs: error creating home dir "+p)
+		}
+	}
+	return nil
+}
+
+func (fs *cephfs) CreateDir(ctx context.Context, fn string) error {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return err
+	}
+
+	fn, err = fs.wrap(ctx, fn)
+	if err != nil {
+		return err
+	}
+
+	if err := mount.MakeDir(fn, 0700); err != nil {
+		return convertError(err, fn, "cephfs: error creating dir "+fn)
+	}
+	return nil
+}
+
+// Delete removes the resource. CephFS has no trash, previous contents
+// can only be recovered from the snapshots.
+func (fs *cephfs) Delete(ctx context.Context, ref *provider.Reference) error {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	if fs.isSnapshotPath(fn) {
+		return errtypes.PermissionDenied(fn)
+	}
+
+	return removeAll(mount, fn)
+}
+
+func removeAll(mount *goceph.MountInfo, fn string) error {
+	stx, err := mount.Statx(fn, goceph.StatxMode, goceph.AtSymlinkNofollow)
+	if err != nil {
+		return convertError(err, fn, "cephfs: error stating "+fn)
+	}
+
+	if !isDir(stx) {
+		if err := mount.Unlink(fn); err != nil {
+			return convertError(err, fn, "cephfs: error removing "+fn)
+		}
+		return nil
+	}
+
+	names, err := readDirNames(mount, fn)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := removeAll(mount, path.Join(fn, name)); err != nil {
+			return err
+		}
+	}
+
+	if err := mount.RemoveDir(fn); err != nil {
+		return convertError(err, fn, "cephfs: error removing dir "+fn)
+	}
+	return nil
+}
+
+func (fs *cephfs) Move(ctx context.Context, oldRef, newRef *provider.Reference) error {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return err
+	}
+
+	oldName, err := fs.resolve(ctx, oldRef)
+	if err != nil {
+		return errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	newName, err := fs.resolve(ctx, newRef)
+	if err != nil {
+		return errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	if err := mount.Rename(oldName, newName); err != nil {
+		return convertError(err, oldName, "cephfs: error moving "+oldName+" to "+newName)
+	}
+	return nil
+}
+
+func (fs *cephfs) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	stx, err := mount.Statx(fn, goceph.StatxBasicStats, 0)
+	if err != nil {
+		return nil, convertError(err, fn, "cephfs: error stating "+fn)
+	}
+
+	return fs.normalize(ctx, mount, stx, fn)
+}
+
+func (fs *cephfs) ListFolder(ctx context.Context, ref *provider.Reference) ([]*provider.ResourceInfo, error) {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	names, err := readDirNames(mount, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	finfos := []*provider.ResourceInfo{}
+	for _, name := range names {
+		// hide the temporary files of ongoing uploads.
+		if strings.HasPrefix(name, tmpPrefix) {
+			continue
+		}
+		p := path.Join(fn, name)
+		stx, err := mount.Statx(p, goceph.StatxBasicStats, 0)
+		if err != nil {
+			// the entry may have been removed in the meantime.
+			if isErrno(err, syscall.ENOENT) {
+				continue
+			}
+			return nil, errors.Wrap(err, "cephfs: error stating "+p)
+		}
+		md, err := fs.normalize(ctx, mount, stx, p)
+		if err != nil {
+			return nil, err
+		}
+		finfos = append(finfos, md)
+	}
+	return finfos, nil
+}
+
+// readDirNames returns the entries of the directory fn without . and ..
+func readDirNames(mount *goceph.MountInfo, fn string) ([]string, error) {
+	dir, err := mount.OpenDir(fn)
+	if err != nil {
+		return nil, convertError(err, fn, "cephfs: error opening dir "+fn)
+	}
+	defer dir.Close()
+
+	names := []string{}
+	for {
+		entry, err := dir.ReadDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "cephfs: error listing "+fn)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+const tmpPrefix = "._reva_atomic_upload"
+
+func (fs *cephfs) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	if fs.isSnapshotPath(fn) {
+		return errtypes.PermissionDenied(fn)
+	}
+
+	return writeAtomic(mount, fn, r)
+}
+
+// writeAtomic writes the content of r to a temporary file next to fn that
+// is renamed to fn once the content has been written.
+func writeAtomic(mount *goceph.MountInfo, fn string, r io.Reader) error {
+	tmp := path.Join(path.Dir(fn), fmt.Sprintf("%s.%s", tmpPrefix, path.Base(fn)))
+	f, err := mount.Open(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return convertError(err, path.Dir(fn), "cephfs: error creating tmp file "+tmp)
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		_ = mount.Unlink(tmp)
+		return errors.Wrap(err, "cephfs: error writing to tmp file "+tmp)
+	}
+
+	if err := f.Close(); err != nil {
+		_ = mount.Unlink(tmp)
+		return errors.Wrap(err, "cephfs: error closing tmp file "+tmp)
+	}
+
+	if err := mount.Rename(tmp, fn); err != nil {
+		return errors.Wrap(err, "cephfs: error renaming from "+tmp+" to "+fn)
+	}
+	return nil
+}
+
+func (fs *cephfs) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	f, err := mount.Open(fn, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, convertError(err, fn, "cephfs: error reading "+fn)
+	}
+	return f, nil
+}
+
+// GetPathByID returns the path pointed by the file id. As in the local
+// driver the file id is the path of the file without the first slash.
+func (fs *cephfs) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
+	return path.Join("/", strings.TrimPrefix(id.OpaqueId, "fileid-")), nil
+}
+
+// GetQuota returns the CephFS quota of the home, or of the root when homes
+// are disabled, and the bytes used below it. Without a quota the size of
+// the file system is returned.
+func (fs *cephfs) GetQuota(ctx context.Context) (int, int, error) {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fn, err := fs.wrap(ctx, "/")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	total, err := getUintXattr(mount, fn, "ceph.quota.max_bytes")
+	if err != nil {
+		return 0, 0, err
+	}
+	used, err := getUintXattr(mount, fn, "ceph.dir.rbytes")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if total == 0 {
+		st, err := mount.StatFS(fn)
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "cephfs: error getting file system stats")
+		}
+		total = st.Blocks * uint64(st.Frsize)
+	}
+	return int(total), int(used), nil
+}
+
+// getUintXattr reads a numeric virtual xattr, a missing xattr is read as 0.
+func getUintXattr(mount *goceph.MountInfo, fn, name string) (uint64, error) {
+	v, err := mount.GetXattr(fn, name)
+	if err != nil {
+		if isErrno(err, syscall.ENODATA) {
+			return 0, nil
+		}
+		return 0, convertError(err, fn, "cephfs: error reading xattr "+name+" of "+fn)
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(v)), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "cephfs: invalid value for xattr "+name)
+	}
+	return n, nil
+}
+
+func (fs *cephfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	for k, v := range md.GetMetadata() {
+		if err := mount.SetXattr(fn, mdPrefix+k, []byte(v), goceph.XattrDefault); err != nil {
+			return convertError(err, fn, "cephfs: error setting xattr "+k+" on "+fn)
+		}
+	}
+	return nil
+}
+
+func (fs *cephfs) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	for _, k := range keys {
+		if err := mount.RemoveXattr(fn, mdPrefix+k); err != nil && !isErrno(err, syscall.ENODATA) {
+			return convertError(err, fn, "cephfs: error removing xattr "+k+" from "+fn)
+		}
+	}
+	return nil
+}
+
+func (fs *cephfs) getArbitraryMetadata(mount *goceph.MountInfo, fn string) (map[string]string, error) {
+	names, err := mount.ListXattr(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "cephfs: error listing xattrs of "+fn)
+	}
+
+	md := map[string]string{}
+	for _, name := range names {
+		if !strings.HasPrefix(name, mdPrefix) {
+			continue
+		}
+		v, err := mount.GetXattr(fn, name)
+		if err != nil {
+			return nil, errors.Wrap(err, "cephfs: error reading xattr "+name+" of "+fn)
+		}
+		md[strings.TrimPrefix(name, mdPrefix)] = string(v)
+	}
+	return md, nil
+}
+
+func (fs *cephfs) normalize(ctx context.Context, mount *goceph.MountInfo, stx *goceph.CephStatx, fn string) (*provider.ResourceInfo, error) {
+	md, err := fs.getArbitraryMetadata(mount, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := fs.unwrap(ctx, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &provider.ResourceInfo{
+		Id:                &provider.ResourceId{OpaqueId: "fileid-" + strings.TrimPrefix(p, "/")},
+		Path:              p,
+		Type:              getResourceType(isDir(stx)),
+		Etag:              calcEtag(stx),
+		MimeType:          mime.Detect(isDir(stx), p),
+		Size:              stx.Size,
+		PermissionSet:     &provider.ResourcePermissions{ListContainer: true, CreateContainer: true},
+		Mtime:             &types.Timestamp{Seconds: uint64(stx.Mtime.Sec), Nanos: uint32(stx.Mtime.Nsec)},
+		ArbitraryMetadata: &provider.ArbitraryMetadata{Metadata: md},
+	}, nil
+}
+
+func isDir(stx *goceph.CephStatx) bool {
+	return stx.Mode&syscall.S_IFMT == syscall.S_IFDIR
+}
+
+func getResourceType(isDir bool) provider.ResourceType {
+	if isDir {
+		return provider.ResourceType_RESOURCE_TYPE_CONTAINER
+	}
+	return provider.ResourceType_RESOURCE_TYPE_FILE
+}
+
+// calcEtag creates an etag based on the md5 of the inode, mtime and size.
+func calcEtag(stx *goceph.CephStatx) string {
+	h := md5.New()
+	_ = binary.Write(h, binary.BigEndian, uint64(stx.Inode))
+	_ = binary.Write(h, binary.BigEndian, stx.Mtime.Sec)
+	_ = binary.Write(h, binary.BigEndian, stx.Mtime.Nsec)
+	_ = binary.Write(h, binary.BigEndian, stx.Size)
+	return fmt.Sprintf(`"%x"`, h.Sum(nil))
+}
+
+// isErrno reports whether err is the libcephfs error for errno.
+func isErrno(err error, errno syscall.Errno) bool {
+	e, ok := errors.Cause(err).(interface{ ErrorCode() int })
+	return ok && e.ErrorCode() == -int(errno)
+}
+
+// convertError maps the libcephfs errors to the reva error types.
+func convertError(err error, fn, msg string) error {
+	switch {
+	case isErrno(err, syscall.ENOENT):
+		return errtypes.NotFound(fn)
+	case isErrno(err, syscall.EEXIST):
+		return errtypes.AlreadyExists(fn)
+	case isErrno(err, syscall.EACCES), isErrno(err, syscall.EPERM):
+		return errtypes.PermissionDenied(fn)
+	}
+	return errors.Wrap(err, msg)
+}
+
+func (fs *cephfs) AddGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("cephfs: operation not supported")
+}
+
+func (fs *cephfs) ListGrants(ctx context.Context, ref *provider.Reference) ([]*provider.Grant, error) {
+	return nil, errtypes.NotSupported("cephfs: operation not supported")
+}
+
+func (fs *cephfs) RemoveGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("cephfs: operation not supported")
+}
+
+func (fs *cephfs) UpdateGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("cephfs: operation not supported")
+}
+
+func (fs *cephfs) CreateReference(ctx context.Context, path string, targetURI *url.URL) error {
+	return errtypes.NotSupported("cephfs: operation not supported")
+}
+
+func (fs *cephfs) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
+	return nil, errtypes.NotSupported("cephfs: operation not supported")
+}
+
+func (fs *cephfs) RestoreRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("cephfs: operation not supported")
+}
+
+func (fs *cephfs) PurgeRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("cephfs: operation not supported")
+}
+
+func (fs *cephfs) EmptyRecycle(ctx context.Context) error {
+	return errtypes.NotSupported("cephfs: operation not supported")
+}
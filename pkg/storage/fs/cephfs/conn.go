@@ -0,0 +1,122 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// +build ceph
+
+package cephfs
+
+import (
+	"context"
+	osuser "os/user"
+	"strconv"
+
+	goceph "github.com/ceph/go-ceph/cephfs"
+	"github.com/pkg/errors"
+)
+
+// getMount returns the connection of the user in the context, creating it
+// on first use. Every user gets its own connection that carries the uid and
+// gid of the user, so that CephFS enforces the permissions itself.
+func (fs *cephfs) getMount(ctx context.Context) (*goceph.MountInfo, error) {
+	u, err := getUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if mount, ok := fs.mounts[u.Username]; ok {
+		return mount, nil
+	}
+
+	uid, gid, err := lookupIDs(u.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	mount, err := fs.newMount(uid, gid)
+	if err != nil {
+		return nil, errors.Wrap(err, "cephfs: error creating connection for user "+u.Username)
+	}
+	fs.mounts[u.Username] = mount
+	return mount, nil
+}
+
+func (fs *cephfs) newMount(uid, gid int) (*goceph.MountInfo, error) {
+	var mount *goceph.MountInfo
+	var err error
+	if fs.conf.ClientID != "" {
+		mount, err = goceph.CreateMountWithId(fs.conf.ClientID)
+	} else {
+		mount, err = goceph.CreateMount()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the options below are enough to connect without a ceph.conf file.
+	if err := mount.ReadDefaultConfigFile(); err != nil && fs.conf.MonHost == "" {
+		_ = mount.Release()
+		return nil, errors.Wrap(err, "error reading ceph config file")
+	}
+
+	opts := map[string]string{
+		"mon_host": fs.conf.MonHost,
+		"keyring":  fs.conf.Keyring,
+	}
+	for k, v := range opts {
+		if v == "" {
+			continue
+		}
+		if err := mount.SetConfigOption(k, v); err != nil {
+			_ = mount.Release()
+			return nil, errors.Wrap(err, "error setting ceph option "+k)
+		}
+	}
+
+	perm := goceph.NewUserPerm(uid, gid, nil)
+	if err := mount.SetMountPerms(perm); err != nil {
+		_ = mount.Release()
+		return nil, errors.Wrap(err, "error setting mount permissions")
+	}
+
+	if err := mount.MountWithRoot(fs.conf.Root); err != nil {
+		_ = mount.Release()
+		return nil, errors.Wrap(err, "error mounting "+fs.conf.Root)
+	}
+	return mount, nil
+}
+
+// lookupIDs returns the uid and gid of the system user with the given name.
+func lookupIDs(username string) (int, int, error) {
+	u, err := osuser.Lookup(username)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "cephfs: error looking up user "+username)
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "cephfs: invalid uid for user "+username)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "cephfs: invalid gid for user "+username)
+	}
+	return uid, gid, nil
+}
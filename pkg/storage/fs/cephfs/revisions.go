@@ -0,0 +1,137 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// +build ceph
+
+package cephfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	goceph "github.com/ceph/go-ceph/cephfs"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+)
+
+// The revisions of a file are the copies of the file kept in the CephFS
+// snapshots. The snapshot directory of the parent lists the snapshots taken
+// on it and on all its ancestors, the revision key is the snapshot name.
+
+func (fs *cephfs) getSnapshotPath(fn, key string) string {
+	return path.Join(path.Dir(fn), fs.conf.SnapshotDir, key, path.Base(fn))
+}
+
+func (fs *cephfs) resolveRevision(ctx context.Context, ref *provider.Reference, key string) (*goceph.MountInfo, string, string, error) {
+	if key == "" || strings.Contains(key, "/") || key == "." || key == ".." {
+		return nil, "", "", errtypes.NotFound(key)
+	}
+
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	rp := fs.getSnapshotPath(fn, key)
+	if _, err := mount.Statx(rp, goceph.StatxMode, 0); err != nil {
+		return nil, "", "", convertError(err, key, "cephfs: error stating revision "+rp)
+	}
+	return mount, fn, rp, nil
+}
+
+func (fs *cephfs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
+	mount, err := fs.getMount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "cephfs: error resolving ref")
+	}
+
+	revisions := []*provider.FileVersion{}
+	snaps, err := readDirNames(mount, path.Join(path.Dir(fn), fs.conf.SnapshotDir))
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return revisions, nil
+		}
+		return nil, err
+	}
+
+	for _, snap := range snaps {
+		rp := fs.getSnapshotPath(fn, snap)
+		stx, err := mount.Statx(rp, goceph.StatxBasicStats, 0)
+		if err != nil {
+			// the file did not exist when the snapshot was taken.
+			if isErrno(err, syscall.ENOENT) {
+				continue
+			}
+			return nil, errors.Wrap(err, "cephfs: error stating revision "+rp)
+		}
+		if isDir(stx) {
+			continue
+		}
+		revisions = append(revisions, &provider.FileVersion{
+			Key:   snap,
+			Size:  stx.Size,
+			Mtime: uint64(stx.Mtime.Sec),
+		})
+	}
+	return revisions, nil
+}
+
+func (fs *cephfs) DownloadRevision(ctx context.Context, ref *provider.Reference, revisionKey string) (io.ReadCloser, error) {
+	mount, _, rp, err := fs.resolveRevision(ctx, ref, revisionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := mount.Open(rp, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, convertError(err, revisionKey, "cephfs: error reading revision "+rp)
+	}
+	return f, nil
+}
+
+// RestoreRevision copies the content of the file in the snapshot over the
+// current content. Snapshots are read-only so the revision stays available.
+func (fs *cephfs) RestoreRevision(ctx context.Context, ref *provider.Reference, revisionKey string) error {
+	mount, fn, rp, err := fs.resolveRevision(ctx, ref, revisionKey)
+	if err != nil {
+		return err
+	}
+
+	f, err := mount.Open(rp, os.O_RDONLY, 0)
+	if err != nil {
+		return convertError(err, revisionKey, "cephfs: error reading revision "+rp)
+	}
+	defer f.Close()
+
+	return writeAtomic(mount, fn, f)
+}
@@ -59,8 +59,9 @@ func init() {
 var hiddenReg = regexp.MustCompile(`\.sys\..#.`)
 
 type eosfs struct {
-	c    *eosclient.Client
-	conf *config
+	c     *eosclient.Client
+	conf  *config
+	roles []*role
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -99,6 +100,11 @@ type config struct {
 	// Default is root://eos-example.org
 	SlaveURL string `mapstructure:"slave_url"`
 
+	// HTTPURL is the URL of the HTTP endpoint of the EOS MGM the files are
+	// streamed from and to, instead of copying them with xrdcopy. The
+	// metadata operations run the eos binary either way.
+	HTTPURL string `mapstructure:"http_url"`
+
 	// Location on the local fs where to store reads.
 	// Defaults to os.TempDir()
 	CacheDirectory string `mapstructure:"cache_directory"`
@@ -134,6 +140,10 @@ type config struct {
 
 	// EnableHome enables the creation of home directories.
 	EnableHome bool `mapstructure:"enable_home"`
+
+	// Roles maps the CS3 permission sets of the grants to EOS acls and back,
+	// on top of the default viewer and editor roles.
+	Roles map[string]*roleConfig `mapstructure:"roles"`
 }
 
 func getUser(ctx context.Context) (*userpb.User, error) {
@@ -205,6 +215,7 @@ func New(m map[string]interface{}) (storage.FS, error) {
 	eosClientOpts := &eosclient.Options{
 		XrdcopyBinary:       c.XrdcopyBinary,
 		URL:                 c.MasterURL,
+		HTTPURL:             c.HTTPURL,
 		EosBinary:           c.EosBinary,
 		CacheDirectory:      c.CacheDirectory,
 		ForceSingleUserMode: c.ForceSingleUserMode,
@@ -214,18 +225,24 @@ func New(m map[string]interface{}) (storage.FS, error) {
 		SecProtocol:         c.SecProtocol,
 	}
 
+	roles, err := newRoles(c.Roles)
+	if err != nil {
+		return nil, err
+	}
+
 	eosClient := eosclient.New(eosClientOpts)
 
 	eosfs := &eosfs{
-		c:    eosClient,
-		conf: c,
+		c:     eosClient,
+		conf:  c,
+		roles: roles,
 	}
 
 	return eosfs, nil
 }
 
 func (fs *eosfs) Shutdown(ctx context.Context) error {
-	// TODO(labkode): in a grpc implementation we can close connections.
+	fs.c.Close()
 	return nil
 }
 
@@ -382,12 +399,12 @@ func (fs *eosfs) AddGrant(ctx context.Context, ref *provider.Reference, g *provi
 
 	fn := fs.wrap(ctx, p)
 
-	eosACL, err := fs.getEosACL(g)
+	eosACL, inherit, err := fs.getEosACL(g)
 	if err != nil {
 		return err
 	}
 
-	err = fs.c.AddACL(ctx, u.Username, fn, eosACL)
+	err = fs.c.AddACL(ctx, u.Username, fn, eosACL, inherit)
 	if err != nil {
 		return errors.Wrap(err, "eos: error adding acl")
 	}
@@ -406,47 +423,20 @@ func getEosACLType(gt provider.GranteeType) (string, error) {
 	}
 }
 
-// TODO(labkode): fine grained permission controls.
-func getEosACLPerm(set *provider.ResourcePermissions) (string, error) {
-	var b strings.Builder
-
-	if set.Stat || set.InitiateFileDownload {
-		b.WriteString("r")
-	}
-	if set.CreateContainer || set.InitiateFileUpload || set.Delete || set.Move {
-		b.WriteString("w")
-	}
-	if set.ListContainer {
-		b.WriteString("x")
-	}
-
-	if set.Delete {
-		b.WriteString("+d")
-	} else {
-		b.WriteString("!d")
-	}
-
-	// TODO sharing
-	// TODO trash
-	// TODO versions
-	return b.String(), nil
-}
-
-func (fs *eosfs) getEosACL(g *provider.Grant) (*acl.Entry, error) {
-	permissions, err := getEosACLPerm(g.Permissions)
-	if err != nil {
-		return nil, err
-	}
+// getEosACL returns the acl entry of the grant, and whether the content of
+// the folder inherits it.
+func (fs *eosfs) getEosACL(g *provider.Grant) (*acl.Entry, bool, error) {
+	permissions, inherit := fs.getEosACLPerm(g.Permissions)
 	t, err := getEosACLType(g.Grantee.Type)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	eosACL := &acl.Entry{
 		Qualifier:   g.Grantee.Id.OpaqueId,
 		Permissions: permissions,
 		Type:        t,
 	}
-	return eosACL, nil
+	return eosACL, inherit, nil
 }
 
 func (fs *eosfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
@@ -488,7 +478,7 @@ func (fs *eosfs) UpdateGrant(ctx context.Context, ref *provider.Reference, g *pr
 		return errors.Wrap(err, "eos: no user in ctx")
 	}
 
-	eosACL, err := fs.getEosACL(g)
+	eosACL, inherit, err := fs.getEosACL(g)
 	if err != nil {
 		return errors.Wrap(err, "eos: error mapping acl")
 	}
@@ -499,7 +489,7 @@ func (fs *eosfs) UpdateGrant(ctx context.Context, ref *provider.Reference, g *pr
 	}
 	fn := fs.wrap(ctx, p)
 
-	err = fs.c.AddACL(ctx, u.Username, fn, eosACL)
+	err = fs.c.AddACL(ctx, u.Username, fn, eosACL, inherit)
 	if err != nil {
 		return errors.Wrap(err, "eos: error updating acl")
 	}
@@ -549,65 +539,6 @@ func (fs *eosfs) getGranteeType(aclType string) provider.GranteeType {
 	}
 }
 
-// TODO(labkode): add more fine grained controls.
-// EOS acls are a mix of ACLs and POSIX permissions. More details can be found in
-// https://github.com/cern-eos/eos/blob/master/doc/configuration/permission.rst
-// TODO we need to evaluate all acls in the list at once to properly forbid (!) and overwrite (+) permissions
-// This is ugly, because those are actually negative permissions ...
-func (fs *eosfs) getGrantPermissionSet(mode string) *provider.ResourcePermissions {
-
-	// TODO also check unix permissions for read access
-	p := &provider.ResourcePermissions{}
-	// r
-	if strings.Contains(mode, "r") {
-		p.Stat = true
-		p.InitiateFileDownload = true
-	}
-	// w
-	if strings.Contains(mode, "w") {
-		p.CreateContainer = true
-		p.InitiateFileUpload = true
-		p.Delete = true
-		if p.InitiateFileDownload {
-			p.Move = true
-		}
-	}
-	if strings.Contains(mode, "wo") {
-		p.CreateContainer = true
-		//	p.InitiateFileUpload = false // TODO only when the file exists
-		p.Delete = false
-	}
-	if strings.Contains(mode, "!d") {
-		p.Delete = false
-	} else if strings.Contains(mode, "+d") {
-		p.Delete = true
-	}
-	// x
-	if strings.Contains(mode, "x") {
-		p.ListContainer = true
-	}
-
-	// sharing
-	// TODO AddGrant
-	// TODO ListGrants
-	// TODO RemoveGrant
-	// TODO UpdateGrant
-
-	// trash
-	// TODO ListRecycle
-	// TODO RestoreRecycleItem
-	// TODO PurgeRecycle
-
-	// versions
-	// TODO ListFileVersions
-	// TODO RestoreFileVersion
-
-	// ?
-	// TODO GetPath
-	// TODO GetQuota
-	return p
-}
-
 func (fs *eosfs) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
 	u, err := getUser(ctx)
 	if err != nil {
@@ -0,0 +1,77 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package eos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/conformance"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+// TestConformance runs against the EOS MGM at REVA_TEST_EOS_MGM, for example
+// the one of pkg/storage/conformance/docker-compose.yml, with the eos binary
+// installed. Each driver gets a new folder of REVA_TEST_EOS_NAMESPACE.
+func TestConformance(t *testing.T) {
+	mgm := os.Getenv("REVA_TEST_EOS_MGM")
+	if mgm == "" {
+		t.Skip("REVA_TEST_EOS_MGM not set")
+	}
+	namespace := os.Getenv("REVA_TEST_EOS_NAMESPACE")
+	if namespace == "" {
+		namespace = "/eos/test"
+	}
+	username := os.Getenv("REVA_TEST_EOS_USER")
+	if username == "" {
+		username = "root"
+	}
+	ctx := user.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{OpaqueId: username},
+		Username: username,
+	})
+
+	newFS := func(t *testing.T, ns string) storage.FS {
+		fs, err := New(map[string]interface{}{
+			"namespace":  ns,
+			"master_url": mgm,
+			"eos_binary": os.Getenv("REVA_TEST_EOS_BINARY"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+
+	parent := newFS(t, namespace)
+	defer parent.Shutdown(ctx)
+	conformance.Run(t, func(t *testing.T) (storage.FS, context.Context) {
+		name := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+		if err := parent.CreateDir(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+		return newFS(t, path.Join(namespace, name)), ctx
+	})
+}
@@ -0,0 +1,239 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package eos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/golang/protobuf/proto"
+)
+
+// EOS acls are a mix of ACLs and POSIX permissions, the letters understood by
+// EOS are described in
+// https://github.com/cern-eos/eos/blob/master/doc/configuration/permission.rst
+// A ! in front of a letter denies the permission, a + overrules a deny coming
+// from another entry.
+
+// roleConfig is the configuration of a role, a named set of CS3 permissions
+// and the EOS acl granting it.
+type roleConfig struct {
+	// ACL is the EOS acl permissions, e.g. "rx" or "rwx+d".
+	ACL string `mapstructure:"acl"`
+	// Permissions are the names of the CS3 permissions granted by the role,
+	// e.g. "stat" or "initiate_file_download".
+	Permissions []string `mapstructure:"permissions"`
+	// NoInherit sets the acl on the shared folder only, its content does not
+	// get it.
+	NoInherit bool `mapstructure:"no_inherit"`
+}
+
+type role struct {
+	name        string
+	acl         string
+	permissions *provider.ResourcePermissions
+	inherit     bool
+}
+
+var permissionFields = map[string]func(p *provider.ResourcePermissions) *bool{
+	"add_grant":              func(p *provider.ResourcePermissions) *bool { return &p.AddGrant },
+	"create_container":       func(p *provider.ResourcePermissions) *bool { return &p.CreateContainer },
+	"delete":                 func(p *provider.ResourcePermissions) *bool { return &p.Delete },
+	"get_path":               func(p *provider.ResourcePermissions) *bool { return &p.GetPath },
+	"get_quota":              func(p *provider.ResourcePermissions) *bool { return &p.GetQuota },
+	"initiate_file_download": func(p *provider.ResourcePermissions) *bool { return &p.InitiateFileDownload },
+	"initiate_file_upload":   func(p *provider.ResourcePermissions) *bool { return &p.InitiateFileUpload },
+	"list_grants":            func(p *provider.ResourcePermissions) *bool { return &p.ListGrants },
+	"list_container":         func(p *provider.ResourcePermissions) *bool { return &p.ListContainer },
+	"list_file_versions":     func(p *provider.ResourcePermissions) *bool { return &p.ListFileVersions },
+	"list_recycle":           func(p *provider.ResourcePermissions) *bool { return &p.ListRecycle },
+	"move":                   func(p *provider.ResourcePermissions) *bool { return &p.Move },
+	"remove_grant":           func(p *provider.ResourcePermissions) *bool { return &p.RemoveGrant },
+	"purge_recycle":          func(p *provider.ResourcePermissions) *bool { return &p.PurgeRecycle },
+	"restore_file_version":   func(p *provider.ResourcePermissions) *bool { return &p.RestoreFileVersion },
+	"restore_recycle_item":   func(p *provider.ResourcePermissions) *bool { return &p.RestoreRecycleItem },
+	"stat":                   func(p *provider.ResourcePermissions) *bool { return &p.Stat },
+	"update_grant":           func(p *provider.ResourcePermissions) *bool { return &p.UpdateGrant },
+}
+
+// defaultRoles are the viewer and editor roles of the sharing UIs, they can
+// be overwritten in the configuration.
+var defaultRoles = map[string]*roleConfig{
+	"viewer": {
+		ACL: "rx",
+		Permissions: []string{
+			"list_container", "list_grants", "list_file_versions", "list_recycle",
+			"stat", "get_path", "get_quota", "initiate_file_download",
+		},
+	},
+	"editor": {
+		ACL: "rwx+d",
+		Permissions: []string{
+			"list_container", "list_grants", "list_file_versions", "list_recycle",
+			"stat", "get_path", "get_quota", "initiate_file_download",
+			"move", "initiate_file_upload", "restore_file_version", "restore_recycle_item",
+			"create_container", "delete", "purge_recycle",
+		},
+	},
+}
+
+// newRoles merges the configured roles with the default ones. The roles are
+// sorted by name so that the first match is always the same one.
+func newRoles(m map[string]*roleConfig) ([]*role, error) {
+	all := map[string]*roleConfig{}
+	for name, c := range defaultRoles {
+		all[name] = c
+	}
+	for name, c := range m {
+		all[name] = c
+	}
+
+	roles := make([]*role, 0, len(all))
+	for name, c := range all {
+		if c == nil || c.ACL == "" {
+			return nil, fmt.Errorf("eos: role %s has no acl", name)
+		}
+		p := &provider.ResourcePermissions{}
+		for _, n := range c.Permissions {
+			field, ok := permissionFields[n]
+			if !ok {
+				return nil, fmt.Errorf("eos: unknown permission %s in role %s", n, name)
+			}
+			*field(p) = true
+		}
+		roles = append(roles, &role{
+			name:        name,
+			acl:         c.ACL,
+			permissions: p,
+			inherit:     !c.NoInherit,
+		})
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].name < roles[j].name })
+	return roles, nil
+}
+
+// splitACLPerm splits EOS acl permissions into their letters, keeping the !
+// and + modifiers and the wo permission together.
+func splitACLPerm(perm string) []string {
+	tokens := []string{}
+	for i := 0; i < len(perm); i++ {
+		switch {
+		case (perm[i] == '!' || perm[i] == '+') && i+1 < len(perm):
+			tokens = append(tokens, perm[i:i+2])
+			i++
+		case perm[i] == 'w' && i+1 < len(perm) && perm[i+1] == 'o':
+			tokens = append(tokens, "wo")
+			i++
+		default:
+			tokens = append(tokens, perm[i:i+1])
+		}
+	}
+	return tokens
+}
+
+func normalizeACLPerm(perm string) string {
+	tokens := splitACLPerm(perm)
+	sort.Strings(tokens)
+	return strings.Join(tokens, "")
+}
+
+// getEosACLPerm translates a CS3 permission set into EOS acl permissions. The
+// set of a role gets the acl of the role, any other set gets the closest acl.
+// A set granting nothing gives a deny entry.
+func (fs *eosfs) getEosACLPerm(set *provider.ResourcePermissions) (perm string, inherit bool) {
+	for _, r := range fs.roles {
+		if proto.Equal(r.permissions, set) {
+			return r.acl, r.inherit
+		}
+	}
+
+	var b strings.Builder
+	read := set.Stat || set.InitiateFileDownload
+	write := set.CreateContainer || set.InitiateFileUpload || set.Delete || set.Move
+	list := set.ListContainer
+
+	if !read && !write && !list {
+		return "!r!w!x", true
+	}
+	if read {
+		b.WriteString("r")
+	}
+	if write {
+		b.WriteString("w")
+	}
+	if list {
+		b.WriteString("x")
+	}
+	if write {
+		if set.Delete {
+			b.WriteString("+d")
+		} else {
+			b.WriteString("!d")
+		}
+		if !set.InitiateFileUpload {
+			b.WriteString("!u")
+		}
+	}
+	return b.String(), true
+}
+
+// getGrantPermissionSet translates EOS acl permissions into a CS3 permission
+// set. The acl of a role gets the set of the role.
+// TODO we need to evaluate all acls in the list at once to properly forbid (!) and overwrite (+) permissions
+func (fs *eosfs) getGrantPermissionSet(mode string) *provider.ResourcePermissions {
+	normalized := normalizeACLPerm(mode)
+	for _, r := range fs.roles {
+		if normalizeACLPerm(r.acl) == normalized {
+			return proto.Clone(r.permissions).(*provider.ResourcePermissions)
+		}
+	}
+
+	has := map[string]bool{}
+	for _, t := range splitACLPerm(mode) {
+		has[t] = true
+	}
+
+	// TODO also check unix permissions for read access
+	p := &provider.ResourcePermissions{}
+	if has["r"] && !has["!r"] {
+		p.Stat = true
+		p.InitiateFileDownload = true
+	}
+	if has["w"] && !has["!w"] {
+		p.CreateContainer = true
+		p.InitiateFileUpload = true
+		p.Delete = true
+		p.Move = p.InitiateFileDownload
+	}
+	if has["wo"] && !has["!w"] {
+		p.CreateContainer = true
+		p.InitiateFileUpload = true
+	}
+	if has["!d"] {
+		p.Delete = false
+	} else if has["+d"] {
+		p.Delete = true
+	}
+	if has["x"] && !has["!x"] {
+		p.ListContainer = true
+	}
+	return p
+}
@@ -0,0 +1,88 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package eos
+
+import (
+	"testing"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestRoles(t *testing.T) {
+	roles, err := newRoles(map[string]*roleConfig{
+		"uploader": {ACL: "wx!d", Permissions: []string{"create_container", "initiate_file_upload", "list_container"}, NoInherit: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &eosfs{roles: roles}
+
+	uploader := &provider.ResourcePermissions{CreateContainer: true, InitiateFileUpload: true, ListContainer: true}
+	if perm, inherit := fs.getEosACLPerm(uploader); perm != "wx!d" || inherit {
+		t.Errorf("uploader acl = %s %v", perm, inherit)
+	}
+	if p := fs.getGrantPermissionSet("x!dw"); !proto.Equal(p, uploader) {
+		t.Errorf("uploader permissions = %v", p)
+	}
+
+	viewer := fs.getGrantPermissionSet("rx")
+	if !viewer.ListGrants || !viewer.GetPath || viewer.InitiateFileUpload {
+		t.Errorf("viewer permissions = %v", viewer)
+	}
+	if perm, inherit := fs.getEosACLPerm(viewer); perm != "rx" || !inherit {
+		t.Errorf("viewer acl = %s %v", perm, inherit)
+	}
+
+	if _, err := newRoles(map[string]*roleConfig{"bad": {ACL: "r", Permissions: []string{"fly"}}}); err == nil {
+		t.Error("unknown permission accepted")
+	}
+}
+
+func TestGenericPermissions(t *testing.T) {
+	roles, err := newRoles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &eosfs{roles: roles}
+
+	for _, tc := range []struct {
+		set  *provider.ResourcePermissions
+		perm string
+	}{
+		{&provider.ResourcePermissions{}, "!r!w!x"},
+		{&provider.ResourcePermissions{Stat: true}, "r"},
+		{&provider.ResourcePermissions{Stat: true, CreateContainer: true, InitiateFileUpload: true}, "rw!d"},
+		{&provider.ResourcePermissions{CreateContainer: true, Delete: true}, "w+d!u"},
+	} {
+		if perm, _ := fs.getEosACLPerm(tc.set); perm != tc.perm {
+			t.Errorf("acl of %v = %s, want %s", tc.set, perm, tc.perm)
+		}
+	}
+
+	if p := fs.getGrantPermissionSet("!r!w!x"); !proto.Equal(p, &provider.ResourcePermissions{}) {
+		t.Errorf("deny entry grants %v", p)
+	}
+	if p := fs.getGrantPermissionSet("rw!d"); p.Delete || !p.Move || !p.InitiateFileUpload {
+		t.Errorf("rw!d grants %v", p)
+	}
+	if p := fs.getGrantPermissionSet("wo"); p.Delete || !p.InitiateFileUpload {
+		t.Errorf("wo grants %v", p)
+	}
+}
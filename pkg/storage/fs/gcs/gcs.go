@@ -0,0 +1,428 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/fs/objectstore"
+	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/trace"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+func init() {
+	registry.Register("gcs", New)
+}
+
+// chunkSize is the granularity of the chunks of resumable uploads.
+const chunkSize = 256 * 1024
+
+type config struct {
+	objectstore.Config `mapstructure:",squash"`
+	Bucket             string `mapstructure:"bucket"`
+	// CredentialsFile is the JSON key file of a service account. When not
+	// set the application default credentials are used.
+	CredentialsFile string `mapstructure:"credentials_file"`
+	// Anonymous sends unauthenticated requests, e.g. to an emulator.
+	Anonymous bool `mapstructure:"anonymous"`
+	// Endpoint is the url of the storage service, defaults to
+	// https://storage.googleapis.com.
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+type store struct {
+	c      *config
+	client *http.Client
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns an implementation of the storage.FS interface that stores the
+// files in the objects of a Google Cloud Storage bucket, using the JSON
+// API. The part size must be a multiple of 256 KiB.
+func New(m map[string]interface{}) (storage.FS, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Bucket == "" {
+		return nil, errors.New("gcs: bucket must be set")
+	}
+	if c.PartSize%chunkSize != 0 {
+		return nil, errors.New("gcs: part_size must be a multiple of 256 KiB")
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://storage.googleapis.com"
+	}
+	c.Endpoint = strings.TrimSuffix(c.Endpoint, "/")
+
+	s := &store{c: c, client: &http.Client{Transport: trace.Transport(http.DefaultTransport)}}
+	if !c.Anonymous {
+		var creds *google.Credentials
+		scope := "https://www.googleapis.com/auth/devstorage.read_write"
+		if c.CredentialsFile != "" {
+			b, err := ioutil.ReadFile(c.CredentialsFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "gcs: error reading credentials file")
+			}
+			creds, err = google.CredentialsFromJSON(context.Background(), b, scope)
+			if err != nil {
+				return nil, errors.Wrap(err, "gcs: error decoding credentials file")
+			}
+		} else {
+			creds, err = google.FindDefaultCredentials(context.Background(), scope)
+			if err != nil {
+				return nil, errors.Wrap(err, "gcs: error finding default credentials")
+			}
+		}
+		s.client.Transport = &oauth2.Transport{Source: creds.TokenSource, Base: s.client.Transport}
+	}
+
+	return objectstore.New("gcs", s, &c.Config), nil
+}
+
+// object is the resource describing an object in the JSON API.
+type object struct {
+	Name     string            `json:"name"`
+	Size     string            `json:"size"`
+	Etag     string            `json:"etag"`
+	Updated  time.Time         `json:"updated"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+func (o *object) object() *objectstore.Object {
+	size, _ := strconv.ParseInt(o.Size, 10, 64)
+	md := map[string]string{}
+	for name, v := range o.Metadata {
+		md[strings.ToLower(name)] = v
+	}
+	return &objectstore.Object{Key: o.Name, Size: size, ETag: o.Etag, Mtime: o.Updated, Metadata: md}
+}
+
+// url returns the url of the object with key k in the bucket, below the
+// api path, which starts with /storage/v1 or /upload/storage/v1. The object
+// is left out when k is empty.
+func (s *store) url(api, k, suffix string, q url.Values) string {
+	u := s.c.Endpoint + api + "/b/" + url.PathEscape(s.c.Bucket) + "/o"
+	if k != "" {
+		u += "/" + url.PathEscape(k)
+	}
+	u += suffix
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+func (s *store) do(ctx context.Context, method, u string, body io.Reader, size int64, hdr http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "gcs: error creating request")
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+
+	appctx.GetLogger(ctx).Debug().Str("method", method).Str("url", u).Msg("gcs: sending request")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "gcs: error sending "+method+" request")
+	}
+	return res, nil
+}
+
+// checkStatus maps the status of a failed response to an error and closes
+// its body.
+func checkStatus(res *http.Response, k string, ok ...int) error {
+	for _, code := range ok {
+		if res.StatusCode == code {
+			return nil
+		}
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return errtypes.NotFound(k)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errtypes.PermissionDenied(k)
+	}
+	return fmt.Errorf("gcs: unexpected status %s for %s: %s", res.Status, k, b)
+}
+
+// decode decodes the JSON body of the response into v and closes it.
+func decode(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return errors.Wrap(err, "gcs: error decoding response")
+	}
+	return nil
+}
+
+func (s *store) Stat(ctx context.Context, k string) (*objectstore.Object, error) {
+	res, err := s.do(ctx, http.MethodGet, s.url("/storage/v1", k, "", nil), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(res, k, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var o object
+	if err := decode(res, &o); err != nil {
+		return nil, err
+	}
+	return o.object(), nil
+}
+
+func (s *store) List(ctx context.Context, prefix, delimiter string, max int) ([]*objectstore.Object, []string, error) {
+	var objects []*objectstore.Object
+	var prefixes []string
+	token := ""
+	for {
+		q := url.Values{"prefix": {prefix}, "fields": {"items(name,size,etag,updated),prefixes,nextPageToken"}}
+		if delimiter != "" {
+			q.Set("delimiter", delimiter)
+		}
+		if max > 0 {
+			q.Set("maxResults", strconv.Itoa(max))
+		}
+		if token != "" {
+			q.Set("pageToken", token)
+		}
+		res, err := s.do(ctx, http.MethodGet, s.url("/storage/v1", "", "", q), nil, 0, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := checkStatus(res, prefix, http.StatusOK); err != nil {
+			return nil, nil, err
+		}
+		var list struct {
+			Items         []*object `json:"items"`
+			Prefixes      []string  `json:"prefixes"`
+			NextPageToken string    `json:"nextPageToken"`
+		}
+		if err := decode(res, &list); err != nil {
+			return nil, nil, err
+		}
+
+		for _, o := range list.Items {
+			objects = append(objects, o.object())
+		}
+		prefixes = append(prefixes, list.Prefixes...)
+
+		token = list.NextPageToken
+		if token == "" || (max > 0 && len(objects)+len(prefixes) >= max) {
+			return objects, prefixes, nil
+		}
+	}
+}
+
+func (s *store) Get(ctx context.Context, k string, offset, length int64) (io.ReadCloser, error) {
+	hdr := http.Header{}
+	if length >= 0 {
+		hdr.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		hdr.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := s.do(ctx, http.MethodGet, s.url("/storage/v1", k, "", url.Values{"alt": {"media"}}), nil, 0, hdr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(res, k, http.StatusOK, http.StatusPartialContent); err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *store) Put(ctx context.Context, k string, r io.Reader, size int64) error {
+	q := url.Values{"uploadType": {"media"}, "name": {k}}
+	res, err := s.do(ctx, http.MethodPost, s.url("/upload/storage/v1", "", "", q), r, size, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, http.StatusOK); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Copy rewrites the object, big objects take several calls.
+func (s *store) Copy(ctx context.Context, src, dst string) error {
+	suffix := "/rewriteTo/b/" + url.PathEscape(s.c.Bucket) + "/o/" + url.PathEscape(dst)
+	q := url.Values{}
+	for {
+		res, err := s.do(ctx, http.MethodPost, s.url("/storage/v1", src, suffix, q), nil, 0, nil)
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(res, src, http.StatusOK); err != nil {
+			return err
+		}
+		var rw struct {
+			Done         bool   `json:"done"`
+			RewriteToken string `json:"rewriteToken"`
+		}
+		if err := decode(res, &rw); err != nil {
+			return err
+		}
+		if rw.Done {
+			return nil
+		}
+		q.Set("rewriteToken", rw.RewriteToken)
+	}
+}
+
+func (s *store) Delete(ctx context.Context, k string) error {
+	res, err := s.do(ctx, http.MethodDelete, s.url("/storage/v1", k, "", nil), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, http.StatusNoContent, http.StatusOK); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// SetMetadata patches the metadata, the names missing from md are removed
+// by patching them to null.
+func (s *store) SetMetadata(ctx context.Context, k string, md map[string]string) error {
+	o, err := s.Stat(ctx, k)
+	if err != nil {
+		return err
+	}
+	patch := map[string]interface{}{}
+	for name := range o.Metadata {
+		patch[name] = nil
+	}
+	for name, v := range md {
+		patch[name] = v
+	}
+	b, err := json.Marshal(map[string]interface{}{"metadata": patch})
+	if err != nil {
+		return errors.Wrap(err, "gcs: error encoding metadata")
+	}
+
+	hdr := http.Header{}
+	hdr.Set("Content-Type", "application/json")
+	res, err := s.do(ctx, http.MethodPatch, s.url("/storage/v1", k, "", nil), bytes.NewReader(b), int64(len(b)), hdr)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, http.StatusOK); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// InitiateMultipart starts a resumable upload, its id is the session url.
+func (s *store) InitiateMultipart(ctx context.Context, k string) (string, error) {
+	q := url.Values{"uploadType": {"resumable"}, "name": {k}}
+	res, err := s.do(ctx, http.MethodPost, s.url("/upload/storage/v1", "", "", q), nil, 0, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := checkStatus(res, k, http.StatusOK); err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	session := res.Header.Get("Location")
+	if session == "" {
+		return "", errors.New("gcs: no session url for the upload of " + k)
+	}
+	return session, nil
+}
+
+// UploadPart sends the part as a chunk of the resumable upload. Only the
+// last part can be shorter than the part size, so a part which is not a
+// multiple of the chunk size ends the upload.
+func (s *store) UploadPart(ctx context.Context, k, id string, n int, offset int64, data []byte) (string, error) {
+	total := "*"
+	if len(data)%chunkSize != 0 {
+		total = strconv.FormatInt(offset+int64(len(data)), 10)
+	}
+	hdr := http.Header{}
+	hdr.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", offset, offset+int64(len(data))-1, total))
+	res, err := s.do(ctx, http.MethodPut, id, bytes.NewReader(data), int64(len(data)), hdr)
+	if err != nil {
+		return "", err
+	}
+	// 308 asks for the next chunk
+	if err := checkStatus(res, k, http.StatusPermanentRedirect, http.StatusOK, http.StatusCreated); err != nil {
+		return "", err
+	}
+	return "", res.Body.Close()
+}
+
+// CompleteMultipart finalizes the upload with its size, which the service
+// acknowledges again when the last chunk already ended it.
+func (s *store) CompleteMultipart(ctx context.Context, k, id string, parts []string, size int64) error {
+	hdr := http.Header{}
+	hdr.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	res, err := s.do(ctx, http.MethodPut, id, nil, 0, hdr)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, http.StatusOK, http.StatusCreated); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// AbortMultipart cancels the resumable upload, the service answers with
+// the non standard status 499.
+func (s *store) AbortMultipart(ctx context.Context, k, id string) error {
+	res, err := s.do(ctx, http.MethodDelete, id, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, k, 499, http.StatusNoContent, http.StatusOK); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
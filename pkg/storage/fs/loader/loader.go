@@ -20,9 +20,15 @@ package loader
 
 import (
 	// Load core storage filesystem backends.
+	_ "github.com/cs3org/reva/pkg/storage/fs/azure"
 	_ "github.com/cs3org/reva/pkg/storage/fs/eos"
+	_ "github.com/cs3org/reva/pkg/storage/fs/gcs"
 	_ "github.com/cs3org/reva/pkg/storage/fs/local"
+	_ "github.com/cs3org/reva/pkg/storage/fs/ocmreceived"
 	_ "github.com/cs3org/reva/pkg/storage/fs/owncloud"
 	_ "github.com/cs3org/reva/pkg/storage/fs/s3"
+	_ "github.com/cs3org/reva/pkg/storage/fs/smb"
+	_ "github.com/cs3org/reva/pkg/storage/fs/spaces"
+	_ "github.com/cs3org/reva/pkg/storage/fs/webdav"
 	// Add your own here
 )
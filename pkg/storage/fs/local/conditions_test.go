@@ -0,0 +1,105 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/conditions"
+)
+
+func TestPreconditions(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := path.Join(tmp, "root")
+
+	fs, err := New(map[string]interface{}{
+		"root":             root,
+		"metadata_backend": "bolt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+
+	ctx := context.Background()
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+	upload := func(ctx context.Context, p, data string) error {
+		return fs.Upload(ctx, ref(p), ioutil.NopCloser(bytes.NewBufferString(data)))
+	}
+	etagOf := func(p string) string {
+		t.Helper()
+		info, err := fs.GetMD(ctx, ref(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Etag
+	}
+	failed := func(err error) bool {
+		_, ok := err.(errtypes.IsPreconditionFailed)
+		return ok
+	}
+	with := func(p *conditions.Preconditions) context.Context {
+		return conditions.ContextSetPreconditions(ctx, p)
+	}
+
+	if err := upload(with(&conditions.Preconditions{IfMatch: []string{conditions.Any}}), "/file", "v1"); !failed(err) {
+		t.Fatalf("expected the upload of a missing file with If-Match to fail, got %v", err)
+	}
+	if err := upload(with(&conditions.Preconditions{IfNoneMatch: []string{conditions.Any}}), "/file", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload(with(&conditions.Preconditions{IfNoneMatch: []string{conditions.Any}}), "/file", "v2"); !failed(err) {
+		t.Fatalf("expected the upload over an existing file with If-None-Match * to fail, got %v", err)
+	}
+
+	stale := etagOf("/file")
+	if err := upload(with(&conditions.Preconditions{IfMatch: []string{stale}}), "/file", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload(with(&conditions.Preconditions{IfMatch: []string{stale}}), "/file", "v3"); !failed(err) {
+		t.Fatalf("expected the upload with a stale etag to fail, got %v", err)
+	}
+	if err := fs.Move(with(&conditions.Preconditions{IfMatch: []string{stale}}), ref("/file"), ref("/moved")); !failed(err) {
+		t.Fatalf("expected the move with a stale etag to fail, got %v", err)
+	}
+	if err := fs.Delete(with(&conditions.Preconditions{IfMatch: []string{stale}}), ref("/file")); !failed(err) {
+		t.Fatalf("expected the delete with a stale etag to fail, got %v", err)
+	}
+
+	current := etagOf("/file")
+	if err := fs.Move(with(&conditions.Preconditions{IfMatch: []string{current}}), ref("/file"), ref("/moved")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Delete(with(&conditions.Preconditions{IfMatch: []string{etagOf("/moved")}}), ref("/moved")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// idAttr holds the id of a file, stored with the other attributes so
+	// that it follows the file when it is renamed or overwritten.
+	idAttr = "user.reva.id"
+	// rootID is the id of the root of the driver.
+	rootID = "root"
+	// legacyIDPrefix prefixes the ids made of the path of the file, which
+	// the driver used before the files had stable ids.
+	legacyIDPrefix = "fileid-"
+	// maxDepth bounds the resolution of an id to a path.
+	maxDepth = 1024
+)
+
+// The ids index maps the id of every file to the id of its parent and its
+// name, so that moving a folder only changes the entry of the folder and
+// not the ones of its children. The entries are symlinks in the ids folder,
+// named after the id and pointing to parent/name, which can be shared by the
+// providers using the same root.
+func (fs *localfs) idPath(id string) string {
+	return path.Join(fs.conf.IDs, id)
+}
+
+// getID returns the id of the file at the internal path fn, assigning one
+// to the file and to its parents if they have none yet.
+func (fs *localfs) getID(fn string) (string, error) {
+	fn = path.Clean(fn)
+	if fn == path.Clean(fs.conf.Root) {
+		return rootID, nil
+	}
+	if v, err := fs.md.Get(fn, idAttr); err == nil {
+		return string(v), nil
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		return "", err
+	}
+
+	fs.idsMu.Lock()
+	defer fs.idsMu.Unlock()
+	return fs.assignID(fn)
+}
+
+// assignID gives fn an id if it has none, to be called with idsMu held.
+func (fs *localfs) assignID(fn string) (string, error) {
+	if fn == path.Clean(fs.conf.Root) {
+		return rootID, nil
+	}
+	if v, err := fs.md.Get(fn, idAttr); err == nil {
+		return string(v), nil
+	}
+	parent, err := fs.assignID(path.Dir(fn))
+	if err != nil {
+		return "", err
+	}
+	id := uuid.New().String()
+	if err := fs.md.Set(fn, idAttr, []byte(id)); err != nil {
+		return "", errors.Wrap(err, "local: error storing id of "+fn)
+	}
+	if err := fs.indexID(id, parent, path.Base(fn)); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (fs *localfs) indexID(id, parent, name string) error {
+	// the entry is replaced atomically
+	tmp := fs.idPath(id + ".tmp-" + uuid.New().String())
+	if err := os.Symlink(parent+"/"+name, tmp); err != nil {
+		return errors.Wrap(err, "local: error indexing id "+id)
+	}
+	if err := os.Rename(tmp, fs.idPath(id)); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "local: error indexing id "+id)
+	}
+	return nil
+}
+
+// moveID updates the index entry of a file moved to the internal path fn.
+func (fs *localfs) moveID(fn string) error {
+	v, err := fs.md.Get(fn, idAttr)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			// neither the file nor its children have an id yet
+			return nil
+		}
+		return err
+	}
+	fs.idsMu.Lock()
+	defer fs.idsMu.Unlock()
+	parent, err := fs.assignID(path.Dir(fn))
+	if err != nil {
+		return err
+	}
+	return fs.indexID(string(v), parent, path.Base(fn))
+}
+
+// carryID gives the file at to the id of the file at from, when new content
+// replaces the one at from.
+func (fs *localfs) carryID(from, to string) error {
+	if from == "" {
+		return nil
+	}
+	v, err := fs.md.Get(from, idAttr)
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return nil
+		}
+		return err
+	}
+	return fs.md.Set(to, idAttr, v)
+}
+
+// pathByID returns the internal path of the file with the given id, which
+// must lie in the home of the user when the homes are enabled.
+func (fs *localfs) pathByID(ctx context.Context, id string) (string, error) {
+	home := path.Clean(fs.conf.Root)
+	if fs.conf.EnableHome {
+		layout, err := fs.GetHome(ctx)
+		if err != nil {
+			return "", err
+		}
+		home = path.Join(home, layout)
+	}
+	if strings.HasPrefix(id, legacyIDPrefix) {
+		return fs.wrap(ctx, path.Join("/", strings.TrimPrefix(id, legacyIDPrefix))), nil
+	}
+	if id == rootID {
+		return home, nil
+	}
+
+	var names []string
+	for cur := id; cur != rootID; {
+		if len(names) == maxDepth {
+			return "", errors.New("local: id loop at " + cur)
+		}
+		// the ids are generated, reject anything that could escape the
+		// ids folder
+		if _, err := uuid.Parse(cur); err != nil {
+			return "", errtypes.NotFound(id)
+		}
+		v, err := os.Readlink(fs.idPath(cur))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", errtypes.NotFound(id)
+			}
+			return "", errors.Wrap(err, "local: error reading id "+cur)
+		}
+		i := strings.IndexByte(v, '/')
+		if i < 0 {
+			return "", errors.New("local: invalid index entry for " + cur)
+		}
+		cur = v[:i]
+		names = append(names, v[i+1:])
+	}
+
+	fn := path.Clean(fs.conf.Root)
+	for i := len(names) - 1; i >= 0; i-- {
+		fn = path.Join(fn, names[i])
+	}
+	// the entry is stale once the file has been deleted
+	if v, err := fs.md.Get(fn, idAttr); err != nil || string(v) != id {
+		return "", errtypes.NotFound(id)
+	}
+	// the ids are shared by all the homes, do not reveal the files of the
+	// other users
+	if !isWithin(home, fn) {
+		return "", errtypes.NotFound(id)
+	}
+	return fn, nil
+}
+
+// resourceID returns the id of fn, the legacy one if it can not be stored.
+func (fs *localfs) resourceID(ctx context.Context, fn string) string {
+	id, err := fs.getID(fn)
+	if err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("path", fn).Msg("local: error getting file id")
+		return legacyIDPrefix + strings.TrimPrefix(fs.unwrap(ctx, fn), "/")
+	}
+	return id
+}
@@ -0,0 +1,194 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/pkg/errors"
+)
+
+func TestStableIDs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := path.Join(tmp, "root")
+
+	fs, err := New(map[string]interface{}{
+		"root":             root,
+		"metadata_backend": "bolt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+
+	ctx := context.Background()
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+	upload := func(p, data string) {
+		t.Helper()
+		if err := fs.Upload(ctx, ref(p), ioutil.NopCloser(bytes.NewBufferString(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idOf := func(p string) *provider.ResourceId {
+		t.Helper()
+		info, err := fs.GetMD(ctx, ref(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Id
+	}
+	pathOf := func(id *provider.ResourceId) string {
+		t.Helper()
+		p, err := fs.GetPathByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	if err := fs.CreateDir(ctx, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	upload("/dir/file", "v1")
+	id := idOf("/dir/file")
+	if p := pathOf(id); p != "/dir/file" {
+		t.Errorf("path of %s = %s", id.OpaqueId, p)
+	}
+
+	// the id survives overwrites and moves of the file and its parents
+	upload("/dir/file", "v2")
+	if got := idOf("/dir/file"); got.OpaqueId != id.OpaqueId {
+		t.Errorf("id after overwrite = %s, want %s", got.OpaqueId, id.OpaqueId)
+	}
+	if err := fs.Move(ctx, ref("/dir"), ref("/moved")); err != nil {
+		t.Fatal(err)
+	}
+	if p := pathOf(id); p != "/moved/file" {
+		t.Errorf("path after move = %s", p)
+	}
+	info, err := fs.GetMD(ctx, &provider.Reference{Spec: &provider.Reference_Id{Id: id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Path != "/moved/file" || info.Id.OpaqueId != id.OpaqueId {
+		t.Errorf("stat by id = %s %s", info.Path, info.Id.OpaqueId)
+	}
+
+	// a trashed file can not be found by id until it is restored
+	if err := fs.Delete(ctx, ref("/moved")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.GetPathByID(ctx, id); err == nil {
+		t.Error("trashed file found by id")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+	items, err := fs.ListRecycle(ctx)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("ListRecycle() = %v, %v", items, err)
+	}
+	if err := fs.RestoreRecycleItem(ctx, items[0].Key); err != nil {
+		t.Fatal(err)
+	}
+	if p := pathOf(id); p != "/moved/file" {
+		t.Errorf("path after restore = %s", p)
+	}
+
+	// the ids made of the path keep working
+	if p := pathOf(&provider.ResourceId{OpaqueId: "fileid-moved/file"}); p != "/moved/file" {
+		t.Errorf("path of legacy id = %s", p)
+	}
+}
+
+func TestIDsConfinedToHome(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fs, err := New(map[string]interface{}{"root": path.Join(tmp, "root"), "enable_home": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+
+	einstein := user.ContextSetUser(context.Background(), &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein"}, Username: "einstein"})
+	marie := user.ContextSetUser(context.Background(), &userpb.User{Id: &userpb.UserId{OpaqueId: "marie"}, Username: "marie"})
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+	byID := func(id string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Id{Id: &provider.ResourceId{OpaqueId: id}}}
+	}
+	for _, ctx := range []context.Context{einstein, marie} {
+		if err := fs.CreateHome(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.CreateDir(einstein, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Upload(einstein, ref("/dir/file"), ioutil.NopCloser(bytes.NewBufferString("data"))); err != nil {
+		t.Fatal(err)
+	}
+	info, err := fs.GetMD(einstein, ref("/dir/file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the root id is the home of the caller
+	for ctx, want := range map[context.Context]int{einstein: 1, marie: 0} {
+		infos, err := fs.ListFolder(ctx, byID(rootID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(infos) != want {
+			t.Errorf("ListFolder(root) = %d entries, want %d", len(infos), want)
+		}
+	}
+
+	// the ids of the other homes are not found
+	for _, id := range []string{info.Id.OpaqueId, "fileid-../einstein/dir/file"} {
+		if _, err := fs.GetMD(marie, byID(id)); !isNotFound(errors.Cause(err)) {
+			t.Errorf("GetMD(%s) as marie = %v, want not found", id, err)
+		}
+	}
+	if _, err := fs.GetPathByID(marie, info.Id); !isNotFound(err) {
+		t.Errorf("GetPathByID() as marie = %v, want not found", err)
+	}
+	if p, err := fs.GetPathByID(einstein, info.Id); err != nil || p != "/dir/file" {
+		t.Errorf("GetPathByID() as einstein = %s, %v", p, err)
+	}
+}
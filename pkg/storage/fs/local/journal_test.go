@@ -0,0 +1,89 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage"
+)
+
+func TestListChanges(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := path.Join(tmp, "root")
+
+	fs, err := New(map[string]interface{}{
+		"root":             root,
+		"metadata_backend": "bolt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+
+	ctx := context.Background()
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+	j := fs.(storage.ChangeJournal)
+
+	if err := fs.CreateDir(ctx, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := j.ListChanges(ctx, ref("/"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Upload(ctx, ref("/a/file.txt"), ioutil.NopCloser(bytes.NewBufferString("data"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Move(ctx, ref("/a/file.txt"), ref("/a/moved.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, next, err := j.ListChanges(ctx, ref("/a"), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*storage.Change{{Path: "file.txt", Removed: true}, {Path: "moved.txt"}}
+	if !reflect.DeepEqual(changes, expected) || next == token {
+		t.Errorf("got changes %+v and token %s, expected %+v", changes, next, expected)
+	}
+
+	// the journal is not listed
+	infos, err := fs.ListFolder(ctx, ref("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Path != "/a" {
+		t.Errorf("unexpected listing of the root: %+v", infos)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
@@ -34,7 +35,10 @@ import (
 	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/mime"
 	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/conditions"
 	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/storage/journal"
+	"github.com/cs3org/reva/pkg/storage/propagator"
 	"github.com/cs3org/reva/pkg/storage/templates"
 	"github.com/cs3org/reva/pkg/user"
 	"github.com/mitchellh/mapstructure"
@@ -49,6 +53,23 @@ type config struct {
 	Root       string `mapstructure:"root"`
 	EnableHome bool   `mapstructure:"enable_home"`
 	UserLayout string `mapstructure:"user_layout"`
+	Uploads    string `mapstructure:"uploads"`
+	Recycle    string `mapstructure:"recycle"`
+	Versions   string `mapstructure:"versions"`
+	// Quota is the default quota in bytes of a home, 0 means no quota.
+	Quota int `mapstructure:"quota"`
+	// MetadataBackend is where the metadata of the files is stored, either
+	// "xattrs" or "bolt" for filesystems without extended attributes.
+	MetadataBackend string `mapstructure:"metadata_backend"`
+	MetadataDB      string `mapstructure:"metadata_db"`
+	// IDs is the folder indexing the ids of the files to find them by id.
+	IDs string `mapstructure:"ids"`
+	// Propagation updates the mtime, and with it the etag, of the
+	// ancestors of the changed files up to the root of the home.
+	Propagation propagator.Config `mapstructure:"propagation"`
+	// Journal records the changes for the sync clients, in the .journal
+	// file next to the root by default.
+	Journal journal.Config `mapstructure:"journal"`
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -77,16 +98,101 @@ func New(m map[string]interface{}) (storage.FS, error) {
 		c.UserLayout = "{{.Username}}"
 	}
 
+	// the state of the driver must not be reachable by path, keep it next
+	// to the root rather than inside it
+	if c.Uploads == "" {
+		c.Uploads = path.Clean(c.Root) + ".uploads"
+	}
+
+	if c.Recycle == "" {
+		c.Recycle = path.Clean(c.Root) + ".trash"
+	}
+
+	if c.Versions == "" {
+		c.Versions = path.Clean(c.Root) + ".versions"
+	}
+
+	if c.MetadataDB == "" {
+		c.MetadataDB = path.Clean(c.Root) + ".metadata.db"
+	}
+
+	if c.IDs == "" {
+		c.IDs = path.Clean(c.Root) + ".ids"
+	}
+
+	if c.Journal.File == "" {
+		c.Journal.File = path.Clean(c.Root) + ".journal"
+	}
+
+	for _, d := range []struct{ name, path string }{
+		{"uploads folder", c.Uploads},
+		{"recycle folder", c.Recycle},
+		{"versions folder", c.Versions},
+		{"metadata db", c.MetadataDB},
+		{"ids folder", c.IDs},
+		{"journal", c.Journal.File},
+	} {
+		if isWithin(c.Root, d.path) {
+			return nil, fmt.Errorf("local: the %s %s must be outside of the root", d.name, d.path)
+		}
+	}
+
 	// create namespace if it does not exist
 	if err = os.MkdirAll(c.Root, 0755); err != nil {
 		return nil, errors.Wrap(err, "local: could not create namespace dir")
 	}
 
-	return &localfs{root: c.Root, conf: c}, nil
+	if err = os.MkdirAll(c.Uploads, 0700); err != nil {
+		return nil, errors.Wrap(err, "local: could not create uploads dir")
+	}
+
+	if err = os.MkdirAll(c.Recycle, 0700); err != nil {
+		return nil, errors.Wrap(err, "local: could not create recycle dir")
+	}
+
+	if err = os.MkdirAll(c.Versions, 0700); err != nil {
+		return nil, errors.Wrap(err, "local: could not create versions dir")
+	}
+
+	if err = os.MkdirAll(c.IDs, 0700); err != nil {
+		return nil, errors.Wrap(err, "local: could not create ids dir")
+	}
+
+	md, err := newMetadataBackend(c)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := journal.New(c.Journal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localfs{root: c.Root, conf: c, md: md, propagator: propagator.New(c.Propagation, propagator.Touch), journal: j}, nil
+}
+
+// isWithin tells if p is the folder dir or lies below it.
+func isWithin(dir, p string) bool {
+	dir, p = path.Clean(dir), path.Clean(p)
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
 }
 
 func (fs *localfs) Shutdown(ctx context.Context) error {
-	return nil
+	fs.propagator.Flush()
+	if err := fs.journal.Close(); err != nil {
+		return err
+	}
+	return fs.md.Close()
+}
+
+// propagate updates the ancestors of the changed file, up to the root of
+// the home of the user or of the storage.
+func (fs *localfs) propagate(ctx context.Context, fn string) {
+	root := fs.conf.Root
+	if home, err := fs.GetHome(ctx); err == nil {
+		root = path.Join(fs.conf.Root, home)
+	}
+	fs.propagator.Propagate(root, fn)
 }
 
 func (fs *localfs) resolve(ctx context.Context, ref *provider.Reference) (string, error) {
@@ -95,9 +201,7 @@ func (fs *localfs) resolve(ctx context.Context, ref *provider.Reference) (string
 	}
 
 	if ref.GetId() != nil {
-		fn := path.Join("/", strings.TrimPrefix(ref.GetId().OpaqueId, "fileid-"))
-		fn = fs.wrap(ctx, fn)
-		return fn, nil
+		return fs.pathByID(ctx, ref.GetId().OpaqueId)
 	}
 
 	// reference is invalid
@@ -114,6 +218,8 @@ func getUser(ctx context.Context) (*userpb.User, error) {
 }
 
 func (fs *localfs) wrap(ctx context.Context, p string) (internal string) {
+	// never resolve above the root, where the state of the driver lies
+	p = path.Clean("/" + p)
 	if fs.conf.EnableHome {
 		layout, err := fs.GetHome(ctx)
 		if err != nil {
@@ -144,14 +250,49 @@ func (fs *localfs) unwrap(ctx context.Context, np string) (external string) {
 }
 
 type localfs struct {
-	root string
-	conf *config
+	root       string
+	conf       *config
+	md         metadataBackend
+	propagator *propagator.Propagator
+	journal    *journal.Journal
+
+	// idsMu serializes the assignment of ids.
+	idsMu sync.Mutex
+	// uploadLocks holds a *sync.Mutex per upload id, serializing the
+	// updates to the persisted state of each upload.
+	uploadLocks sync.Map
+	// writeMu serializes the replacements, moves and deletions of the
+	// files, so that their preconditions are checked atomically with them.
+	writeMu sync.Mutex
+}
+
+// checkPreconditions checks the preconditions of the change made with the
+// context against the current state of fn. The callers hold writeMu.
+func (fs *localfs) checkPreconditions(ctx context.Context, fn string) error {
+	p, ok := conditions.ContextGetPreconditions(ctx)
+	if !ok {
+		return nil
+	}
+	var ri *provider.ResourceInfo
+	fi, err := os.Stat(fn)
+	switch {
+	case err == nil:
+		ri = &provider.ResourceInfo{
+			Etag:  calcEtag(ctx, fi),
+			Mtime: &types.Timestamp{Seconds: uint64(fi.ModTime().Unix())},
+		}
+	case !os.IsNotExist(err):
+		return errors.Wrap(err, "localfs: error stating "+fn)
+	}
+	return p.Check(ri)
 }
 
 func (fs *localfs) normalize(ctx context.Context, fi os.FileInfo, fn string) *provider.ResourceInfo {
+	metadata := fs.readMetadata(ctx, fn)
+	id := fs.resourceID(ctx, fn)
 	fn = fs.unwrap(ctx, path.Join("/", fn))
 	md := &provider.ResourceInfo{
-		Id:            &provider.ResourceId{OpaqueId: "fileid-" + strings.TrimPrefix(fn, "/")},
+		Id:            &provider.ResourceId{OpaqueId: id},
 		Path:          fn,
 		Type:          getResourceType(fi.IsDir()),
 		Etag:          calcEtag(ctx, fi),
@@ -161,12 +302,27 @@ func (fs *localfs) normalize(ctx context.Context, fi os.FileInfo, fn string) *pr
 		Mtime: &types.Timestamp{
 			Seconds: uint64(fi.ModTime().Unix()),
 		},
+		ArbitraryMetadata: &provider.ArbitraryMetadata{
+			Metadata: metadata,
+		},
 	}
 
 	//logger.Println(context.Background(), "normalized: ", md)
 	return md
 }
 
+// isInternal tells if the file holds state of the driver, hidden from the users.
+func (fs *localfs) isInternal(fn string) bool {
+	switch fn {
+	case path.Clean(fs.conf.Uploads), path.Clean(fs.conf.Recycle), path.Clean(fs.conf.Versions), path.Clean(fs.conf.IDs),
+		path.Clean(fs.conf.Journal.File), path.Clean(fs.conf.Journal.File) + ".tmp":
+		return true
+	case path.Clean(fs.conf.MetadataDB):
+		return fs.conf.MetadataBackend == "bolt"
+	}
+	return false
+}
+
 func getResourceType(isDir bool) provider.ResourceType {
 	if isDir {
 		return provider.ResourceType_RESOURCE_TYPE_CONTAINER
@@ -174,11 +330,14 @@ func getResourceType(isDir bool) provider.ResourceType {
 	return provider.ResourceType_RESOURCE_TYPE_FILE
 }
 
-// GetPathByID returns the path pointed by the file id
-// In this implementation the file id is that path of the file without the first slash
-// thus the file id always points to the filename
+// GetPathByID returns the path of the file with the given id. The ids are
+// kept when the files are renamed or overwritten.
 func (fs *localfs) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
-	return path.Join("/", strings.TrimPrefix(id.OpaqueId, "fileid-")), nil
+	fn, err := fs.pathByID(ctx, id.OpaqueId)
+	if err != nil {
+		return "", err
+	}
+	return fs.unwrap(ctx, fn), nil
 }
 
 func (fs *localfs) AddGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
@@ -196,21 +355,10 @@ func (fs *localfs) UpdateGrant(ctx context.Context, ref *provider.Reference, g *
 	return errtypes.NotSupported("local: operation not supported")
 }
 
-func (fs *localfs) GetQuota(ctx context.Context) (int, int, error) {
-	return 0, 0, nil
-}
 func (fs *localfs) CreateReference(ctx context.Context, path string, targetURI *url.URL) error {
 	return errtypes.NotSupported("local: operation not supported")
 }
 
-func (fs *localfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
-	return errtypes.NotSupported("local: operation not supported")
-}
-
-func (fs *localfs) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
-	return errtypes.NotSupported("local: operation not supported")
-}
-
 func (fs *localfs) GetHome(ctx context.Context) (string, error) {
 	if !fs.conf.EnableHome {
 		return "", errtypes.NotSupported("local: get home not supported")
@@ -257,26 +405,43 @@ func (fs *localfs) CreateDir(ctx context.Context, fn string) error {
 		// TODO(jfd): we also need already exists error, webdav expects 405 MethodNotAllowed
 		return errors.Wrap(err, "localfs: error creating dir "+fn)
 	}
+	fs.propagate(ctx, fn)
+	fs.journal.Record(fn, false)
 	return nil
 }
 
+// Delete moves the resource to the trash.
 func (fs *localfs) Delete(ctx context.Context, ref *provider.Reference) error {
 	fn, err := fs.resolve(ctx, ref)
 	if err != nil {
 		return errors.Wrap(err, "error resolving ref")
 	}
 
-	err = os.Remove(fn)
-	if err != nil {
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+
+	if _, err := os.Stat(fn); err != nil {
 		if os.IsNotExist(err) {
 			return errtypes.NotFound(fn)
 		}
-		// try recursive delete
-		err = os.RemoveAll(fn)
-		if err != nil {
-			return errors.Wrap(err, "localfs: error deleting "+fn)
-		}
+		return errors.Wrap(err, "localfs: error stating "+fn)
+	}
+
+	if err := fs.checkPreconditions(ctx, fn); err != nil {
+		return err
 	}
+
+	size, err := fs.treeSize(fn)
+	if err != nil {
+		return errors.Wrap(err, "localfs: error computing size of "+fn)
+	}
+	if err := fs.trash(ctx, fn); err != nil {
+		return err
+	}
+	// the trash does not count in the quota
+	fs.account(ctx, fn, -size)
+	fs.propagate(ctx, fn)
+	fs.journal.Record(fn, true)
 	return nil
 }
 
@@ -291,9 +456,35 @@ func (fs *localfs) Move(ctx context.Context, oldRef, newRef *provider.Reference)
 		return errors.Wrap(err, "error resolving ref")
 	}
 
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+
+	if err := fs.checkPreconditions(ctx, oldName); err != nil {
+		return err
+	}
+
+	// the moves between homes, and over existing files, change the usage
+	moved, err := fs.treeSize(oldName)
+	if err != nil {
+		return errors.Wrap(err, "localfs: error computing size of "+oldName)
+	}
+	replaced := fileSize(newName)
+
 	if err := os.Rename(oldName, newName); err != nil {
 		return errors.Wrap(err, "localfs: error moving "+oldName+" to "+newName)
 	}
+	if err := fs.md.Move(oldName, newName); err != nil {
+		return errors.Wrap(err, "localfs: error moving metadata of "+oldName)
+	}
+	if err := fs.moveID(newName); err != nil {
+		return err
+	}
+	fs.account(ctx, oldName, -moved)
+	fs.account(ctx, newName, moved-replaced)
+	fs.propagate(ctx, oldName)
+	fs.journal.Record(oldName, true)
+	fs.propagate(ctx, newName)
+	fs.journal.Record(newName, false)
 	return nil
 }
 
@@ -330,7 +521,12 @@ func (fs *localfs) ListFolder(ctx context.Context, ref *provider.Reference) ([]*
 
 	finfos := []*provider.ResourceInfo{}
 	for _, md := range mds {
-		finfos = append(finfos, fs.normalize(ctx, md, path.Join(fn, md.Name())))
+		p := path.Join(fn, md.Name())
+		// do not expose the state of ongoing uploads, the trash, the versions nor the metadata
+		if fs.isInternal(p) {
+			continue
+		}
+		finfos = append(finfos, fs.normalize(ctx, md, p))
 	}
 	return finfos, nil
 }
@@ -354,14 +550,44 @@ func (fs *localfs) Upload(ctx context.Context, ref *provider.Reference, r io.Rea
 		return errors.Wrap(err, "localfs: eror writing to tmp file "+tmp.Name())
 	}
 
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+
+	if err := fs.checkPreconditions(ctx, fn); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// keep the overwritten content as a revision
+	previous := fileSize(fn)
+	vp, err := fs.archiveIfExists(fn)
+	if err != nil {
+		return err
+	}
+
 	// TODO(labkode): make sure rename is atomic, missing fsync ...
 	if err := os.Rename(tmp.Name(), fn); err != nil {
 		return errors.Wrap(err, "localfs: error renaming from "+tmp.Name()+" to "+fn)
 	}
 
+	if err := fs.carryID(vp, fn); err != nil {
+		return err
+	}
+	fs.account(ctx, fn, fileSize(fn)-previous)
+	fs.propagate(ctx, fn)
+	fs.journal.Record(fn, false)
 	return nil
 }
 
+// ListChanges returns the changes below the folder recorded in the journal.
+func (fs *localfs) ListChanges(ctx context.Context, ref *provider.Reference, token string) ([]*storage.Change, string, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error resolving ref")
+	}
+	return fs.journal.Changes(fn, token)
+}
+
 func (fs *localfs) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
 	fn, err := fs.resolve(ctx, ref)
 	if err != nil {
@@ -377,31 +603,3 @@ func (fs *localfs) Download(ctx context.Context, ref *provider.Reference) (io.Re
 	}
 	return r, nil
 }
-
-func (fs *localfs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
-	return nil, errtypes.NotSupported("list revisions")
-}
-
-func (fs *localfs) DownloadRevision(ctx context.Context, ref *provider.Reference, revisionKey string) (io.ReadCloser, error) {
-	return nil, errtypes.NotSupported("download revision")
-}
-
-func (fs *localfs) RestoreRevision(ctx context.Context, ref *provider.Reference, revisionKey string) error {
-	return errtypes.NotSupported("restore revision")
-}
-
-func (fs *localfs) PurgeRecycleItem(ctx context.Context, key string) error {
-	return errtypes.NotSupported("purge recycle item")
-}
-
-func (fs *localfs) EmptyRecycle(ctx context.Context) error {
-	return errtypes.NotSupported("empty recycle")
-}
-
-func (fs *localfs) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
-	return nil, errtypes.NotSupported("list recycle")
-}
-
-func (fs *localfs) RestoreRecycleItem(ctx context.Context, restoreKey string) error {
-	return errtypes.NotSupported("restore recycle")
-}
@@ -29,10 +29,11 @@ import (
 	"syscall"
 
 	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/pkg/xattr"
 )
 
 // calcEtag will create an etag based on the md5 of
-// - mtime,
+// - mtime, to the nanosecond for the changes within a second,
 // - inode (if available),
 // - device (if available) and
 // - size.
@@ -40,7 +41,7 @@ import (
 func calcEtag(ctx context.Context, fi os.FileInfo) string {
 	log := appctx.GetLogger(ctx)
 	h := md5.New()
-	err := binary.Write(h, binary.BigEndian, fi.ModTime().Unix())
+	err := binary.Write(h, binary.BigEndian, fi.ModTime().UnixNano())
 	if err != nil {
 		log.Error().Err(err).Msg("error writing mtime")
 	}
@@ -62,3 +63,11 @@ func calcEtag(ctx context.Context, fi os.FileInfo) string {
 	}
 	return fmt.Sprintf(`"%x"`, h.Sum(nil))
 }
+
+// isNoData tells if the error reports a missing extended attribute.
+func isNoData(err error) bool {
+	if xerr, ok := err.(*xattr.Error); ok {
+		return xerr.Err == xattr.ENOATTR
+	}
+	return false
+}
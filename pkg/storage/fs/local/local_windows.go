@@ -31,7 +31,7 @@ import (
 )
 
 // calcEtag will create an etag based on the md5 of
-// - mtime,
+// - mtime, to the nanosecond for the changes within a second,
 // - inode (if available),
 // - device (if available) and
 // - size.
@@ -39,7 +39,7 @@ import (
 func calcEtag(ctx context.Context, fi os.FileInfo) string {
 	log := appctx.GetLogger(ctx)
 	h := md5.New()
-	err := binary.Write(h, binary.BigEndian, fi.ModTime().Unix())
+	err := binary.Write(h, binary.BigEndian, fi.ModTime().UnixNano())
 	if err != nil {
 		log.Error().Err(err).Msg("error writing mtime")
 	}
@@ -50,3 +50,8 @@ func calcEtag(ctx context.Context, fi os.FileInfo) string {
 	}
 	return fmt.Sprintf(`"%x"`, h.Sum(nil))
 }
+
+// isNoData tells if the error reports a missing extended attribute.
+func isNoData(err error) bool {
+	return false
+}
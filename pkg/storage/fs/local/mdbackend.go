@@ -0,0 +1,101 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"strings"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+	"github.com/pkg/xattr"
+)
+
+// metadataBackend persists the attributes of the files: the arbitrary
+// metadata, including the checksums computed on upload and the favorite
+// flags, and the quota of the homes. Etags are derived from the file info
+// and need no storage.
+type metadataBackend interface {
+	// Get returns the value of the attribute, or an errtypes.NotFound
+	// error if it is not set.
+	Get(fn, attr string) ([]byte, error)
+	// List returns the names of the attributes of the file.
+	List(fn string) ([]string, error)
+	Set(fn, attr string, v []byte) error
+	// Remove removes the attribute, missing attributes are ignored.
+	Remove(fn, attr string) error
+	// Move carries the attributes of the file and of its children over
+	// to its new path, to be called once the file has been renamed.
+	Move(oldfn, newfn string) error
+	// Purge removes the attributes of the file and of its children, to be
+	// called once the file has been removed.
+	Purge(fn string) error
+	Close() error
+}
+
+func newMetadataBackend(c *config) (metadataBackend, error) {
+	switch c.MetadataBackend {
+	case "", "xattrs":
+		return xattrsBackend{}, nil
+	case "bolt":
+		return newBoltBackend(c.MetadataDB)
+	default:
+		return nil, errors.New("local: unknown metadata backend " + c.MetadataBackend)
+	}
+}
+
+// xattrsBackend stores the attributes in extended attributes of the files,
+// which follow the files when they are renamed or removed.
+type xattrsBackend struct{}
+
+func (xattrsBackend) Get(fn, attr string) ([]byte, error) {
+	v, err := xattr.Get(fn, attr)
+	if err != nil {
+		if isNoData(err) {
+			return nil, errtypes.NotFound(attr)
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+func (xattrsBackend) List(fn string) ([]string, error) {
+	return xattr.List(fn)
+}
+
+func (xattrsBackend) Set(fn, attr string, v []byte) error {
+	return xattr.Set(fn, attr, v)
+}
+
+func (xattrsBackend) Remove(fn, attr string) error {
+	if err := xattr.Remove(fn, attr); err != nil && !isNoData(err) {
+		return err
+	}
+	return nil
+}
+
+func (xattrsBackend) Move(oldfn, newfn string) error { return nil }
+
+func (xattrsBackend) Purge(fn string) error { return nil }
+
+func (xattrsBackend) Close() error { return nil }
+
+// isChildOf tells if fn is p or lives below it.
+func isChildOf(fn, p string) bool {
+	return fn == p || strings.HasPrefix(fn, strings.TrimSuffix(p, "/")+"/")
+}
@@ -0,0 +1,162 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"bytes"
+	"path"
+	"time"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var attrsBucket = []byte("attributes")
+
+// boltBackend stores the attributes in a bolt database, for filesystems
+// without extended attributes support like NFS exports. Attributes are
+// keyed by the path of the file and the name of the attribute, separated
+// by a NUL byte which can not appear in paths.
+type boltBackend struct {
+	db *bolt.DB
+}
+
+func newBoltBackend(fn string) (*boltBackend, error) {
+	db, err := bolt.Open(fn, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "local: error opening metadata db "+fn)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(attrsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "local: error initializing metadata db "+fn)
+	}
+	return &boltBackend{db: db}, nil
+}
+
+func attrKey(fn, attr string) []byte {
+	return []byte(path.Clean(fn) + "\x00" + attr)
+}
+
+// splitKey returns the path and the attribute name of a key.
+func splitKey(k []byte) (string, string) {
+	i := bytes.IndexByte(k, 0)
+	return string(k[:i]), string(k[i+1:])
+}
+
+func (b *boltBackend) Get(fn, attr string) ([]byte, error) {
+	var v []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(attrsBucket).Get(attrKey(fn, attr)); data != nil {
+			v = append([]byte{}, data...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errtypes.NotFound(attr)
+	}
+	return v, nil
+}
+
+func (b *boltBackend) List(fn string) ([]string, error) {
+	var attrs []string
+	prefix := attrKey(fn, "")
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(attrsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			_, attr := splitKey(k)
+			attrs = append(attrs, attr)
+		}
+		return nil
+	})
+	return attrs, err
+}
+
+func (b *boltBackend) Set(fn, attr string, v []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(attrsBucket).Put(attrKey(fn, attr), v)
+	})
+}
+
+func (b *boltBackend) Remove(fn, attr string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(attrsBucket).Delete(attrKey(fn, attr))
+	})
+}
+
+// keysOf returns the keys of the attributes of the file and of its children.
+func keysOf(bucket *bolt.Bucket, fn string) [][]byte {
+	var keys [][]byte
+	c := bucket.Cursor()
+	prefix := []byte(fn)
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if p, _ := splitKey(k); isChildOf(p, fn) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+	}
+	return keys
+}
+
+func (b *boltBackend) Move(oldfn, newfn string) error {
+	oldfn, newfn = path.Clean(oldfn), path.Clean(newfn)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(attrsBucket)
+		// the rename replaced the target, drop its attributes
+		for _, k := range keysOf(bucket, newfn) {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		for _, k := range keysOf(bucket, oldfn) {
+			p, attr := splitKey(k)
+			v := append([]byte{}, bucket.Get(k)...)
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+			if err := bucket.Put(attrKey(newfn+p[len(oldfn):], attr), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltBackend) Purge(fn string) error {
+	fn = path.Clean(fn)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(attrsBucket)
+		for _, k := range keysOf(bucket, fn) {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltBackend) Close() error {
+	return b.db.Close()
+}
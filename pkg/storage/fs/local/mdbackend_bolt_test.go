@@ -0,0 +1,113 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+func TestBoltMetadataBackend(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := path.Join(tmp, "root")
+
+	fs, err := New(map[string]interface{}{
+		"root":             root,
+		"metadata_backend": "bolt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+
+	ctx := context.Background()
+	if err := fs.CreateDir(ctx, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(root, "dir", "file"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+	md := &provider.ArbitraryMetadata{Metadata: map[string]string{"color": "blue"}}
+	if err := fs.SetArbitraryMetadata(ctx, ref("/dir/file"), md); err != nil {
+		t.Fatal(err)
+	}
+
+	mdOf := func(p string) string {
+		t.Helper()
+		info, err := fs.GetMD(ctx, ref(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.GetArbitraryMetadata().GetMetadata()["color"]
+	}
+
+	// the metadata follows the parent folder when it is moved
+	if err := fs.Move(ctx, ref("/dir"), ref("/moved")); err != nil {
+		t.Fatal(err)
+	}
+	if got := mdOf("/moved/file"); got != "blue" {
+		t.Errorf("metadata after move = %q, want blue", got)
+	}
+
+	// and when it is trashed and restored
+	if err := fs.Delete(ctx, ref("/moved")); err != nil {
+		t.Fatal(err)
+	}
+	items, err := fs.ListRecycle(ctx)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("ListRecycle() = %v, %v", items, err)
+	}
+	if err := fs.RestoreRecycleItem(ctx, items[0].Key); err != nil {
+		t.Fatal(err)
+	}
+	if got := mdOf("/moved/file"); got != "blue" {
+		t.Errorf("metadata after restore = %q, want blue", got)
+	}
+
+	if err := fs.UnsetArbitraryMetadata(ctx, ref("/moved/file"), []string{"color"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := mdOf("/moved/file"); got != "" {
+		t.Errorf("metadata after unset = %q, want none", got)
+	}
+
+	// the database is not exposed
+	infos, err := fs.ListFolder(ctx, ref("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		if info.Path != "/moved" {
+			t.Errorf("unexpected entry %s in root", info.Path)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+)
+
+const (
+	// mdPrefix prefixes the attributes holding arbitrary metadata.
+	mdPrefix = "user.reva.md."
+	// favPrefix prefixes the favorite flags, which are kept per user.
+	favPrefix = "user.reva.fav."
+
+	favoriteKey = "http://owncloud.org/ns/favorite"
+)
+
+// favoriteAttr returns the attribute holding the favorite flag of the user
+// in the context.
+func favoriteAttr(ctx context.Context) (string, error) {
+	u, err := getUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	uid := u.GetId()
+	if uid == nil {
+		return "", errors.Wrap(errtypes.UserRequired("userrequired"), "local: user has no id")
+	}
+	return fmt.Sprintf("%s%s@%s", favPrefix, uid.GetOpaqueId(), uid.GetIdp()), nil
+}
+
+// readMetadata returns the arbitrary metadata of the file, with the
+// favorite flag of the user in the context.
+func (fs *localfs) readMetadata(ctx context.Context, fn string) map[string]string {
+	log := appctx.GetLogger(ctx)
+
+	md := map[string]string{favoriteKey: ""}
+	if fa, err := favoriteAttr(ctx); err == nil {
+		if v, err := fs.md.Get(fn, fa); err == nil {
+			md[favoriteKey] = string(v)
+		}
+	}
+
+	attrs, err := fs.md.List(fn)
+	if err != nil {
+		log.Debug().Err(err).Str("fn", fn).Msg("local: error listing attributes")
+		return md
+	}
+	for _, attr := range attrs {
+		if !strings.HasPrefix(attr, mdPrefix) {
+			continue
+		}
+		if v, err := fs.md.Get(fn, attr); err == nil {
+			md[strings.TrimPrefix(attr, mdPrefix)] = string(v)
+		}
+	}
+	return md
+}
+
+// SetArbitraryMetadata stores the metadata in the attributes of the file. The
+// favorite flag is stored for the user in the context only.
+func (fs *localfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "error resolving ref")
+	}
+	if _, err := os.Stat(fn); err != nil {
+		if os.IsNotExist(err) {
+			return errtypes.NotFound(fn)
+		}
+		return errors.Wrap(err, "localfs: error stating "+fn)
+	}
+
+	for k, v := range md.GetMetadata() {
+		attr := mdPrefix + k
+		if k == favoriteKey {
+			if attr, err = favoriteAttr(ctx); err != nil {
+				return err
+			}
+		}
+		if err := fs.md.Set(fn, attr, []byte(v)); err != nil {
+			return errors.Wrap(err, "localfs: error setting metadata "+k)
+		}
+	}
+	return nil
+}
+
+// UnsetArbitraryMetadata removes the metadata, keys that are not set are
+// ignored.
+func (fs *localfs) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "error resolving ref")
+	}
+	if _, err := os.Stat(fn); err != nil {
+		if os.IsNotExist(err) {
+			return errtypes.NotFound(fn)
+		}
+		return errors.Wrap(err, "localfs: error stating "+fn)
+	}
+
+	for _, k := range keys {
+		attr := mdPrefix + k
+		if k == favoriteKey {
+			if attr, err = favoriteAttr(ctx); err != nil {
+				return err
+			}
+		}
+		if err := fs.md.Remove(fn, attr); err != nil {
+			return errors.Wrap(err, "localfs: error removing metadata "+k)
+		}
+	}
+	return nil
+}
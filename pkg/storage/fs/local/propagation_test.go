@@ -0,0 +1,83 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+func TestPropagation(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := path.Join(tmp, "root")
+
+	fs, err := New(map[string]interface{}{
+		"root":             root,
+		"metadata_backend": "bolt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+
+	ctx := context.Background()
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+	etag := func(p string) string {
+		t.Helper()
+		info, err := fs.GetMD(ctx, ref(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Etag
+	}
+
+	for _, d := range []string{"/a", "/a/b"} {
+		if err := fs.CreateDir(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootEtag, aEtag := etag("/"), etag("/a")
+
+	if err := fs.Upload(ctx, ref("/a/b/file.txt"), ioutil.NopCloser(bytes.NewBufferString("data"))); err != nil {
+		t.Fatal(err)
+	}
+	if etag("/") == rootEtag || etag("/a") == aEtag {
+		t.Error("expected the etags of the ancestors to change with the upload")
+	}
+
+	rootEtag = etag("/")
+	if err := fs.Delete(ctx, ref("/a/b/file.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if etag("/") == rootEtag {
+		t.Error("expected the etag of the root to change with the deletion")
+	}
+}
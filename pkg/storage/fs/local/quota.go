@@ -0,0 +1,207 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/pkg/errors"
+)
+
+// quotaAttr holds the quota in bytes of a home, overriding the configured one.
+const quotaAttr = "user.reva.quota"
+
+// usedAttr holds the bytes used below the root of a home, or of the storage
+// when homes are disabled. It is computed once and then kept up to date on
+// every change, so that the quota checks do not walk the tree.
+const usedAttr = "user.reva.used"
+
+// GetQuota returns the quota of the home of the user, or of the whole storage
+// when homes are disabled. The used bytes are the size of the files in it.
+// The quota of the account of the user overrides the one of the home.
+func (fs *localfs) GetQuota(ctx context.Context) (int, int, error) {
+	root := fs.conf.Root
+	if fs.conf.EnableHome {
+		layout, err := fs.GetHome(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		root = path.Join(fs.conf.Root, layout)
+	}
+
+	total := fs.conf.Quota
+	if v, err := fs.md.Get(root, quotaAttr); err == nil {
+		q, err := strconv.Atoi(string(v))
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "local: invalid quota attribute on %s", root)
+		}
+		total = q
+	}
+	if u, ok := user.ContextGetUser(ctx); ok && fs.conf.EnableHome {
+		if q := user.Quota(u); q > 0 {
+			total = int(q)
+		}
+	}
+
+	used, err := fs.usedBytes(ctx, root)
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, int(used), nil
+}
+
+// usedBytes returns the bytes used below the root. The first time, they are
+// computed while holding writeMu, so that no change is missed or counted twice.
+func (fs *localfs) usedBytes(ctx context.Context, root string) (int64, error) {
+	if used, ok := fs.readUsed(ctx, root); ok {
+		return used, nil
+	}
+
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+	if used, ok := fs.readUsed(ctx, root); ok {
+		return used, nil
+	}
+
+	if _, err := os.Stat(root); err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "local: error stating "+root)
+	}
+	used, err := fs.treeSize(root)
+	if err != nil {
+		return 0, errors.Wrap(err, "local: error computing used bytes")
+	}
+	if err := fs.md.Set(root, usedAttr, []byte(strconv.FormatInt(used, 10))); err != nil {
+		return 0, errors.Wrapf(err, "local: error setting used bytes on %s", root)
+	}
+	return used, nil
+}
+
+func (fs *localfs) readUsed(ctx context.Context, root string) (int64, bool) {
+	v, err := fs.md.Get(root, usedAttr)
+	if err != nil {
+		return 0, false
+	}
+	used, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("root", root).Msg("local: invalid used bytes, computing them again")
+		return 0, false
+	}
+	return used, true
+}
+
+// treeSize returns the size of the regular files below fn, fn included.
+func (fs *localfs) treeSize(fn string) (int64, error) {
+	var size int64
+	err := filepath.Walk(fn, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fs.isInternal(p) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return size, err
+}
+
+// quotaRoot returns the root of the home holding fn, or of the storage when
+// homes are disabled. It is empty if fn lies in no home.
+func (fs *localfs) quotaRoot(ctx context.Context, fn string) string {
+	root := path.Clean(fs.conf.Root)
+	if !fs.conf.EnableHome {
+		return root
+	}
+	home, err := fs.GetHome(ctx)
+	if err != nil {
+		return ""
+	}
+	// the homes of all the users are at the same depth below the root
+	depth := len(strings.Split(strings.Trim(home, "/"), "/"))
+	rel := strings.Split(strings.TrimPrefix(path.Clean(fn), root+"/"), "/")
+	if !isWithin(root, fn) || len(rel) <= depth {
+		return ""
+	}
+	return path.Join(append([]string{root}, rel[:depth]...)...)
+}
+
+// account adds delta to the bytes used in the home holding fn, if they
+// were already computed. The callers hold writeMu.
+func (fs *localfs) account(ctx context.Context, fn string, delta int64) {
+	root := fs.quotaRoot(ctx, fn)
+	if delta == 0 || root == "" {
+		return
+	}
+	used, ok := fs.readUsed(ctx, root)
+	if !ok {
+		return
+	}
+	used += delta
+	if used < 0 {
+		used = 0
+	}
+	if err := fs.md.Set(root, usedAttr, []byte(strconv.FormatInt(used, 10))); err != nil {
+		appctx.GetLogger(ctx).Error().Err(err).Str("root", root).Msg("local: error updating used bytes")
+	}
+}
+
+// fileSize returns the size of the regular file fn, 0 if there is none.
+func fileSize(fn string) int64 {
+	fi, err := os.Stat(fn)
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0
+	}
+	return fi.Size()
+}
+
+// SetHomeQuota stores the quota of the home of the user on its root, where it
+// overrides the quota of the configuration.
+func (fs *localfs) SetHomeQuota(ctx context.Context, bytes int) error {
+	if !fs.conf.EnableHome {
+		return errtypes.NotSupported("local: set home quota not supported")
+	}
+	layout, err := fs.GetHome(ctx)
+	if err != nil {
+		return err
+	}
+	root := path.Join(fs.conf.Root, layout)
+	if err := fs.md.Set(root, quotaAttr, []byte(strconv.Itoa(bytes))); err != nil {
+		return errors.Wrapf(err, "local: error setting quota attribute on %s", root)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func TestQuotaAccounting(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := path.Join(tmp, "root")
+
+	fs, err := New(map[string]interface{}{"root": root, "enable_home": true, "quota": 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+	lfs := fs.(*localfs)
+
+	einstein := user.ContextSetUser(context.Background(), &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein"}, Username: "einstein"})
+	marie := user.ContextSetUser(context.Background(), &userpb.User{Id: &userpb.UserId{OpaqueId: "marie"}, Username: "marie"})
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+	upload := func(ctx context.Context, p, data string) {
+		t.Helper()
+		if err := fs.Upload(ctx, ref(p), ioutil.NopCloser(bytes.NewBufferString(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	used := func(ctx context.Context) int {
+		t.Helper()
+		total, used, err := fs.GetQuota(ctx)
+		if err != nil || total != 1000 {
+			t.Fatalf("GetQuota() = %d, %d, %v", total, used, err)
+		}
+		return used
+	}
+
+	for _, ctx := range []context.Context{einstein, marie} {
+		if err := fs.CreateHome(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload(einstein, "/a", "0123456789")
+	if err := fs.CreateDir(einstein, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	upload(einstein, "/dir/b", "01234")
+
+	// the first call computes the usage
+	if u := used(einstein); u != 15 {
+		t.Fatalf("used = %d, expected 15", u)
+	}
+
+	// then it is only updated by the changes, without walking the tree
+	if err := ioutil.WriteFile(path.Join(root, "einstein", "outside"), []byte("not seen"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if u := used(einstein); u != 15 {
+		t.Errorf("used = %d after a change outside the driver, expected 15", u)
+	}
+
+	steps := []struct {
+		name   string
+		change func() error
+		used   int
+	}{
+		{"overwrite", func() error {
+			return fs.Upload(einstein, ref("/a"), ioutil.NopCloser(strings.NewReader("0123")))
+		}, 9},
+		{"delete folder", func() error { return fs.Delete(einstein, ref("/dir")) }, 4},
+		{"restore folder", func() error {
+			items, err := fs.ListRecycle(einstein)
+			if err != nil || len(items) != 1 {
+				t.Fatalf("ListRecycle() = %v, %v", items, err)
+			}
+			return fs.RestoreRecycleItem(einstein, items[0].Key)
+		}, 9},
+		{"restore revision", func() error {
+			revs, err := fs.ListRevisions(einstein, ref("/a"))
+			if err != nil || len(revs) != 1 {
+				t.Fatalf("ListRevisions() = %v, %v", revs, err)
+			}
+			return fs.RestoreRevision(einstein, ref("/a"), revs[0].Key)
+		}, 15},
+		{"move within the home", func() error { return fs.Move(einstein, ref("/dir/b"), ref("/b")) }, 15},
+		{"resumable upload", func() error {
+			id, err := lfs.InitiateUpload(einstein, ref("/c"), 3, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := lfs.WriteUploadChunk(einstein, id, 0, strings.NewReader("abc")); err != nil {
+				return err
+			}
+			return lfs.FinishUpload(einstein, id)
+		}, 18},
+	}
+	for _, s := range steps {
+		if err := s.change(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if u := used(einstein); u != s.used {
+			t.Errorf("used = %d after %s, expected %d", u, s.name, s.used)
+		}
+	}
+
+	// every home has its own usage
+	if u := used(marie); u != 0 {
+		t.Errorf("used = %d in another home", u)
+	}
+	upload(marie, "/m", "012")
+	if u := used(marie); u != 3 {
+		t.Errorf("used = %d, expected 3", u)
+	}
+	if u := used(einstein); u != 18 {
+		t.Errorf("used = %d after a change in another home, expected 18", u)
+	}
+}
+
+func TestAccountQuota(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fs, err := New(map[string]interface{}{"root": path.Join(tmp, "root"), "enable_home": true, "quota": 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+
+	u := &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein"}, Username: "einstein"}
+	ctx := user.ContextSetUser(context.Background(), u)
+	if err := fs.CreateHome(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.(*localfs).SetHomeQuota(ctx, 500); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		account uint64
+		total   int
+	}{
+		{0, 500},
+		{2000, 2000},
+		{100, 100},
+	} {
+		user.SetQuota(u, tt.account)
+		if total, _, err := fs.GetQuota(ctx); err != nil || total != tt.total {
+			t.Errorf("account quota %d: GetQuota() = %d, %v, expected %d", tt.account, total, err, tt.total)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// recycleInfo is persisted next to every trashed item.
+type recycleInfo struct {
+	// Path is the external path the item was deleted from.
+	Path         string `json:"path"`
+	DeletionTime int64  `json:"deletion_time"`
+}
+
+// getRecyclePath returns the trash folder of the user in context. With homes
+// enabled every user has its own trash, otherwise the trash is shared.
+func (fs *localfs) getRecyclePath(ctx context.Context) (string, error) {
+	if !fs.conf.EnableHome {
+		return fs.conf.Recycle, nil
+	}
+	layout, err := fs.GetHome(ctx)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(fs.conf.Recycle, layout), nil
+}
+
+// resolveRecycleItem returns the paths of the trashed item and its info file.
+func (fs *localfs) resolveRecycleItem(ctx context.Context, key string) (string, string, error) {
+	// keys are generated by us, reject anything that could escape the trash folder
+	if _, err := uuid.Parse(key); err != nil {
+		return "", "", errtypes.NotFound(key)
+	}
+	rp, err := fs.getRecyclePath(ctx)
+	if err != nil {
+		return "", "", errors.Wrap(err, "local: error resolving recycle path")
+	}
+	return path.Join(rp, key), path.Join(rp, key+".info"), nil
+}
+
+// trash moves the item to the trash folder and records where it came from.
+func (fs *localfs) trash(ctx context.Context, fn string) error {
+	rp, err := fs.getRecyclePath(ctx)
+	if err != nil {
+		return errors.Wrap(err, "local: error resolving recycle path")
+	}
+	if err := os.MkdirAll(rp, 0700); err != nil {
+		return errors.Wrap(err, "local: error creating trash dir "+rp)
+	}
+
+	key := uuid.New().String()
+	data, err := json.Marshal(&recycleInfo{
+		Path:         fs.unwrap(ctx, fn),
+		DeletionTime: time.Now().Unix(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "local: error encoding recycle info")
+	}
+	if err := ioutil.WriteFile(path.Join(rp, key+".info"), data, 0600); err != nil {
+		return errors.Wrap(err, "local: error writing recycle info")
+	}
+
+	if err := os.Rename(fn, path.Join(rp, key)); err != nil {
+		os.Remove(path.Join(rp, key+".info"))
+		return errors.Wrap(err, "local: error moving "+fn+" to trash")
+	}
+	if err := fs.md.Move(fn, path.Join(rp, key)); err != nil {
+		return errors.Wrap(err, "local: error moving metadata of "+fn+" to trash")
+	}
+	return nil
+}
+
+func (fs *localfs) readRecycleInfo(fn string) (*recycleInfo, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	info := &recycleInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (fs *localfs) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
+	log := appctx.GetLogger(ctx)
+
+	rp, err := fs.getRecyclePath(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "local: error resolving recycle path")
+	}
+
+	mds, err := ioutil.ReadDir(rp)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*provider.RecycleItem{}, nil
+		}
+		return nil, errors.Wrap(err, "local: error listing trash "+rp)
+	}
+
+	items := []*provider.RecycleItem{}
+	for _, md := range mds {
+		if md.IsDir() || !strings.HasSuffix(md.Name(), ".info") {
+			continue
+		}
+		key := strings.TrimSuffix(md.Name(), ".info")
+
+		info, err := fs.readRecycleInfo(path.Join(rp, md.Name()))
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("local: invalid recycle info")
+			continue
+		}
+		fi, err := os.Stat(path.Join(rp, key))
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("local: recycle item without data")
+			continue
+		}
+
+		items = append(items, &provider.RecycleItem{
+			Type: getResourceType(fi.IsDir()),
+			Key:  key,
+			Path: info.Path,
+			Size: uint64(fi.Size()),
+			DeletionTime: &types.Timestamp{
+				Seconds: uint64(info.DeletionTime),
+			},
+		})
+	}
+	return items, nil
+}
+
+func (fs *localfs) RestoreRecycleItem(ctx context.Context, key string) error {
+	ip, infoPath, err := fs.resolveRecycleItem(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	info, err := fs.readRecycleInfo(infoPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errtypes.NotFound(key)
+		}
+		return errors.Wrap(err, "local: error reading recycle info for "+key)
+	}
+
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+
+	tgt := fs.wrap(ctx, info.Path)
+	if _, err := os.Stat(tgt); err == nil {
+		return errtypes.AlreadyExists(info.Path)
+	}
+	if err := os.MkdirAll(path.Dir(tgt), 0700); err != nil {
+		return errors.Wrap(err, "local: error creating parent of "+tgt)
+	}
+
+	if err := os.Rename(ip, tgt); err != nil {
+		return errors.Wrap(err, "local: error restoring "+key+" to "+tgt)
+	}
+	if err := fs.md.Move(ip, tgt); err != nil {
+		return errors.Wrap(err, "local: error restoring metadata of "+key)
+	}
+	if err := fs.moveID(tgt); err != nil {
+		return err
+	}
+	if err := os.Remove(infoPath); err != nil {
+		return errors.Wrap(err, "local: error removing recycle info for "+key)
+	}
+	if size, err := fs.treeSize(tgt); err == nil {
+		fs.account(ctx, tgt, size)
+	}
+	fs.propagate(ctx, tgt)
+	fs.journal.Record(tgt, false)
+	return nil
+}
+
+func (fs *localfs) PurgeRecycleItem(ctx context.Context, key string) error {
+	ip, infoPath, err := fs.resolveRecycleItem(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(infoPath); err != nil {
+		if os.IsNotExist(err) {
+			return errtypes.NotFound(key)
+		}
+		return errors.Wrap(err, "local: error stating recycle info for "+key)
+	}
+
+	if err := os.RemoveAll(ip); err != nil {
+		return errors.Wrap(err, "local: error purging recycle item "+key)
+	}
+	if err := fs.md.Purge(ip); err != nil {
+		return errors.Wrap(err, "local: error purging metadata of "+key)
+	}
+	if err := os.Remove(infoPath); err != nil {
+		return errors.Wrap(err, "local: error removing recycle info for "+key)
+	}
+	return nil
+}
+
+func (fs *localfs) EmptyRecycle(ctx context.Context) error {
+	rp, err := fs.getRecyclePath(ctx)
+	if err != nil {
+		return errors.Wrap(err, "local: error resolving recycle path")
+	}
+	if err := os.RemoveAll(rp); err != nil {
+		return errors.Wrap(err, "local: error emptying trash "+rp)
+	}
+	if err := fs.md.Purge(rp); err != nil {
+		return errors.Wrap(err, "local: error purging metadata of trash "+rp)
+	}
+	return nil
+}
+
+// PurgeRecycle removes the items trashed before the given time from the
+// trash of every user. The returned keys are prefixed with the path of the
+// trash of the user, relative to the recycle folder.
+func (fs *localfs) PurgeRecycle(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+	log := appctx.GetLogger(ctx)
+
+	var purged []string
+	err := filepath.Walk(fs.conf.Recycle, func(fn string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			// do not look into trashed folders
+			if _, err := uuid.Parse(fi.Name()); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		key := strings.TrimSuffix(fi.Name(), ".info")
+		if _, err := uuid.Parse(key); err != nil || key == fi.Name() {
+			return nil
+		}
+
+		info, err := fs.readRecycleInfo(fn)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("local: invalid recycle info")
+			return nil
+		}
+		if info.DeletionTime >= before.Unix() {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(fs.conf.Recycle, filepath.Join(filepath.Dir(fn), key))
+		purged = append(purged, filepath.ToSlash(rel))
+		if dryRun {
+			return nil
+		}
+		if err := os.RemoveAll(filepath.Join(filepath.Dir(fn), key)); err != nil {
+			return errors.Wrap(err, "local: error purging recycle item "+key)
+		}
+		if err := fs.md.Purge(filepath.Join(filepath.Dir(fn), key)); err != nil {
+			return errors.Wrap(err, "local: error purging metadata of "+key)
+		}
+		if err := os.Remove(fn); err != nil {
+			return errors.Wrap(err, "local: error removing recycle info for "+key)
+		}
+		return nil
+	})
+	if err != nil {
+		return purged, errors.Wrap(err, "local: error purging trash")
+	}
+	return purged, nil
+}
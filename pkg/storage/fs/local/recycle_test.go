@@ -0,0 +1,138 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func TestRecycle(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := path.Join(tmp, "root")
+
+	fs, err := New(map[string]interface{}{"root": root, "enable_home": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+
+	einstein := user.ContextSetUser(context.Background(), &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein"}, Username: "einstein"})
+	marie := user.ContextSetUser(context.Background(), &userpb.User{Id: &userpb.UserId{OpaqueId: "marie"}, Username: "marie"})
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+	for _, ctx := range []context.Context{einstein, marie} {
+		if err := fs.CreateHome(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fs.Upload(einstein, ref("/file"), ioutil.NopCloser(bytes.NewBufferString("data"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Delete(einstein, ref("/file")); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := fs.ListRecycle(einstein)
+	if err != nil || len(items) != 1 || items[0].Path != "/file" {
+		t.Fatalf("ListRecycle() = %v, %v", items, err)
+	}
+	key := items[0].Key
+
+	// every user has its own trash
+	if items, err := fs.ListRecycle(marie); err != nil || len(items) != 0 {
+		t.Errorf("ListRecycle() of another user = %v, %v", items, err)
+	}
+	if err := fs.RestoreRecycleItem(marie, key); err == nil {
+		t.Error("expected an error restoring the item of another user")
+	}
+	if err := fs.RestoreRecycleItem(einstein, "../marie"); err == nil {
+		t.Error("expected an error restoring an invalid key")
+	}
+
+	// the trash is not part of the namespace
+	for _, p := range []string{"/.trash", "/../../root.trash"} {
+		if _, err := fs.GetMD(einstein, ref(p)); !isNotFound(err) {
+			t.Errorf("GetMD(%s) = %v", p, err)
+		}
+	}
+	if err := fs.Upload(einstein, ref("/../../root.trash/einstein/planted"), ioutil.NopCloser(bytes.NewBufferString("data"))); err == nil {
+		t.Error("expected an error writing into the trash by path")
+	}
+	if items, err := fs.ListRecycle(einstein); err != nil || len(items) != 1 {
+		t.Errorf("ListRecycle() = %v, %v", items, err)
+	}
+	if _, err := New(map[string]interface{}{"root": root, "recycle": path.Join(root, "trash")}); err == nil {
+		t.Error("expected an error with the trash inside the root")
+	}
+
+	// the restore does not overwrite
+	if err := fs.Upload(einstein, ref("/file"), ioutil.NopCloser(bytes.NewBufferString("new"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RestoreRecycleItem(einstein, key); err == nil {
+		t.Error("expected an error restoring over an existing file")
+	} else if _, ok := err.(errtypes.IsAlreadyExists); !ok {
+		t.Errorf("RestoreRecycleItem() = %v", err)
+	}
+	if err := fs.Delete(einstein, ref("/file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RestoreRecycleItem(einstein, key); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fs.Download(einstein, ref("/file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "data" {
+		t.Errorf("restored content = %q", data)
+	}
+
+	// the purge only removes the items deleted before the limit
+	purger := fs.(*localfs)
+	if ids, err := purger.PurgeRecycle(context.Background(), time.Now().Add(-time.Hour), false); err != nil || len(ids) != 0 {
+		t.Errorf("PurgeRecycle() = %v, %v", ids, err)
+	}
+	ids, err := purger.PurgeRecycle(context.Background(), time.Now().Add(time.Hour), false)
+	if err != nil || len(ids) != 1 || path.Dir(ids[0]) != "einstein" {
+		t.Errorf("PurgeRecycle() = %v, %v", ids, err)
+	}
+	if items, err := fs.ListRecycle(einstein); err != nil || len(items) != 0 {
+		t.Errorf("ListRecycle() after the purge = %v, %v", items, err)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+)
+
+// getVersionsPath returns the path of the versions of the file fn. Versions are
+// stored in the versions folder mirroring the tree below the root, as
+// <name>.v<mtime>.
+func (fs *localfs) getVersionsPath(fn string) string {
+	return path.Join(fs.conf.Versions, strings.TrimPrefix(fn, fs.conf.Root))
+}
+
+// archiveRevision moves the current content of fn to the versions folder
+// and returns the path of the revision. The revisions made within the same
+// second get the next free seconds, not to overwrite each other.
+func (fs *localfs) archiveRevision(fn string) (string, error) {
+	base := fs.getVersionsPath(fn)
+	if err := os.MkdirAll(path.Dir(base), 0700); err != nil {
+		return "", errors.Wrap(err, "local: error creating versions dir "+path.Dir(base))
+	}
+	mtime := time.Now().Unix()
+	vp := fmt.Sprintf("%s.v%d", base, mtime)
+	for {
+		if _, err := os.Lstat(vp); os.IsNotExist(err) {
+			break
+		}
+		mtime++
+		vp = fmt.Sprintf("%s.v%d", base, mtime)
+	}
+
+	if err := os.Rename(fn, vp); err != nil {
+		return "", errors.Wrap(err, "local: error archiving "+fn+" to "+vp)
+	}
+	if err := fs.md.Move(fn, vp); err != nil {
+		return "", errors.Wrap(err, "local: error archiving metadata of "+fn)
+	}
+	return vp, nil
+}
+
+// archiveIfExists creates a revision of fn if it is an existing file and
+// returns its path, empty if there was none.
+func (fs *localfs) archiveIfExists(fn string) (string, error) {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "local: error stating "+fn)
+	}
+	if !fi.Mode().IsRegular() {
+		return "", nil
+	}
+	return fs.archiveRevision(fn)
+}
+
+func (fs *localfs) resolveRevision(ctx context.Context, ref *provider.Reference, key string) (string, string, error) {
+	// keys are the mtime of the version, reject anything else
+	if _, err := strconv.ParseUint(key, 10, 64); err != nil {
+		return "", "", errtypes.NotFound(key)
+	}
+
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return "", "", errors.Wrap(err, "local: error resolving ref")
+	}
+
+	rp := fs.getVersionsPath(fn) + ".v" + key
+	if _, err := os.Stat(rp); err != nil {
+		if os.IsNotExist(err) {
+			return "", "", errtypes.NotFound(key)
+		}
+		return "", "", errors.Wrap(err, "local: error stating revision "+rp)
+	}
+	return fn, rp, nil
+}
+
+func (fs *localfs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "local: error resolving ref")
+	}
+	vp := fs.getVersionsPath(fn)
+
+	revisions := []*provider.FileVersion{}
+	mds, err := ioutil.ReadDir(path.Dir(vp))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return revisions, nil
+		}
+		return nil, errors.Wrap(err, "local: error reading "+path.Dir(vp))
+	}
+
+	prefix := path.Base(vp) + ".v"
+	for _, md := range mds {
+		if md.IsDir() || !strings.HasPrefix(md.Name(), prefix) {
+			continue
+		}
+		key := strings.TrimPrefix(md.Name(), prefix)
+		mtime, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, &provider.FileVersion{
+			Key:   key,
+			Size:  uint64(md.Size()),
+			Mtime: mtime,
+		})
+	}
+	return revisions, nil
+}
+
+func (fs *localfs) DownloadRevision(ctx context.Context, ref *provider.Reference, revisionKey string) (io.ReadCloser, error) {
+	_, rp, err := fs.resolveRevision(ctx, ref, revisionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := os.Open(rp)
+	if err != nil {
+		return nil, errors.Wrap(err, "local: error reading revision "+rp)
+	}
+	return r, nil
+}
+
+// RestoreRevision makes the revision the current content of the file. The
+// current content is kept as a new revision.
+func (fs *localfs) RestoreRevision(ctx context.Context, ref *provider.Reference, revisionKey string) error {
+	fn, rp, err := fs.resolveRevision(ctx, ref, revisionKey)
+	if err != nil {
+		return err
+	}
+
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+
+	previous := fileSize(fn)
+	if _, err := fs.archiveIfExists(fn); err != nil {
+		return err
+	}
+
+	if err := os.Rename(rp, fn); err != nil {
+		return errors.Wrap(err, "local: error restoring revision "+rp)
+	}
+	if err := fs.md.Move(rp, fn); err != nil {
+		return errors.Wrap(err, "local: error restoring metadata of revision "+rp)
+	}
+	fs.account(ctx, fn, fileSize(fn)-previous)
+	fs.propagate(ctx, fn)
+	fs.journal.Record(fn, false)
+	return nil
+}
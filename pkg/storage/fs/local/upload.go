@@ -0,0 +1,322 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// uploadInfo is the upload state persisted next to the upload binary.
+type uploadInfo struct {
+	storage.UploadInfo
+	// Target is the internal path the upload is moved to once finished.
+	Target string `json:"target"`
+}
+
+func (fs *localfs) uploadBinPath(id string) string {
+	return path.Join(fs.conf.Uploads, id)
+}
+
+func (fs *localfs) uploadInfoPath(id string) string {
+	return path.Join(fs.conf.Uploads, id+".info")
+}
+
+// lockUpload serializes the operations on the upload with the given id and
+// returns the function releasing it. Different uploads do not wait on each other.
+func (fs *localfs) lockUpload(id string) func() {
+	mu, _ := fs.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// forgetUpload drops the lock of an upload that does not exist anymore. The
+// ids are never reused, so callers still waiting on it will not find it.
+func (fs *localfs) forgetUpload(id string) {
+	fs.uploadLocks.Delete(id)
+}
+
+func (fs *localfs) readUploadInfo(id string) (*uploadInfo, error) {
+	// ids are generated by us, reject anything that could escape the uploads folder
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errtypes.NotFound(id)
+	}
+
+	data, err := ioutil.ReadFile(fs.uploadInfoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errtypes.NotFound(id)
+		}
+		return nil, errors.Wrap(err, "local: error reading upload info for "+id)
+	}
+
+	info := &uploadInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, errors.Wrap(err, "local: error decoding upload info for "+id)
+	}
+	return info, nil
+}
+
+func (fs *localfs) writeUploadInfo(info *uploadInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "local: error encoding upload info")
+	}
+
+	tmp, err := ioutil.TempFile(fs.conf.Uploads, "._reva_atomic_upload_info")
+	if err != nil {
+		return errors.Wrap(err, "local: error creating tmp upload info")
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "local: error writing tmp upload info "+tmp.Name())
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "local: error closing tmp upload info "+tmp.Name())
+	}
+
+	if err := os.Rename(tmp.Name(), fs.uploadInfoPath(info.ID)); err != nil {
+		return errors.Wrap(err, "local: error persisting upload info for "+info.ID)
+	}
+	return nil
+}
+
+// InitiateUpload creates a new resumable upload for the given reference.
+func (fs *localfs) InitiateUpload(ctx context.Context, ref *provider.Reference, size int64, metadata map[string]string) (string, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return "", errors.Wrap(err, "local: error resolving ref")
+	}
+
+	if _, err := os.Stat(path.Dir(fn)); err != nil {
+		if os.IsNotExist(err) {
+			return "", errtypes.NotFound(path.Dir(fn))
+		}
+		return "", errors.Wrap(err, "local: error stating "+path.Dir(fn))
+	}
+
+	info := &uploadInfo{
+		UploadInfo: storage.UploadInfo{
+			ID:       uuid.New().String(),
+			Size:     size,
+			MetaData: metadata,
+		},
+		Target: fn,
+	}
+
+	f, err := os.OpenFile(fs.uploadBinPath(info.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", errors.Wrap(err, "local: error creating upload file")
+	}
+	f.Close()
+
+	defer fs.lockUpload(info.ID)()
+	if err := fs.writeUploadInfo(info); err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
+
+// GetUpload returns the state of the upload with the given id.
+func (fs *localfs) GetUpload(ctx context.Context, id string) (*storage.UploadInfo, error) {
+	defer fs.lockUpload(id)()
+
+	info, err := fs.readUploadInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	return &info.UploadInfo, nil
+}
+
+// WriteUploadChunk appends the data read from r to the upload, starting at offset.
+// It returns the number of bytes written.
+func (fs *localfs) WriteUploadChunk(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	defer fs.lockUpload(id)()
+
+	info, err := fs.readUploadInfo(id)
+	if err != nil {
+		return 0, err
+	}
+
+	if offset != info.Offset {
+		return 0, fmt.Errorf("local: offset mismatch for upload %s: got %d, expected %d", id, offset, info.Offset)
+	}
+
+	f, err := os.OpenFile(fs.uploadBinPath(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, errors.Wrap(err, "local: error opening upload file for "+id)
+	}
+	defer f.Close()
+
+	// never write more than announced at creation time
+	n, err := io.Copy(f, io.LimitReader(r, info.Size-info.Offset))
+
+	// persist what we have got so far, even on error, so the client can resume
+	info.Offset += n
+	if werr := fs.writeUploadInfo(info); werr != nil {
+		return n, werr
+	}
+
+	if err != nil {
+		return n, errors.Wrap(err, "local: error writing upload chunk for "+id)
+	}
+	return n, nil
+}
+
+// ReadUpload returns the data received so far for the upload.
+func (fs *localfs) ReadUpload(ctx context.Context, id string) (io.ReadCloser, error) {
+	defer fs.lockUpload(id)()
+
+	if _, err := fs.readUploadInfo(id); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fs.uploadBinPath(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "local: error opening upload file for "+id)
+	}
+	return f, nil
+}
+
+// FinishUpload moves a complete upload to its target location.
+func (fs *localfs) FinishUpload(ctx context.Context, id string) error {
+	defer fs.lockUpload(id)()
+
+	info, err := fs.readUploadInfo(id)
+	if err != nil {
+		return err
+	}
+
+	if info.Offset != info.Size {
+		return fmt.Errorf("local: upload %s is incomplete: %d of %d bytes received", id, info.Offset, info.Size)
+	}
+
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+
+	// keep the overwritten content as a revision
+	previous := fileSize(info.Target)
+	vp, err := fs.archiveIfExists(info.Target)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(fs.uploadBinPath(id), info.Target); err != nil {
+		return errors.Wrap(err, "local: error moving upload "+id+" to "+info.Target)
+	}
+	if err := fs.carryID(vp, info.Target); err != nil {
+		return err
+	}
+	fs.account(ctx, info.Target, info.Size-previous)
+
+	if err := os.Remove(fs.uploadInfoPath(id)); err != nil {
+		return errors.Wrap(err, "local: error removing upload info for "+id)
+	}
+	fs.forgetUpload(id)
+	fs.propagate(ctx, info.Target)
+	fs.journal.Record(info.Target, false)
+	return nil
+}
+
+// TerminateUpload discards an upload and its state.
+func (fs *localfs) TerminateUpload(ctx context.Context, id string) error {
+	defer fs.lockUpload(id)()
+
+	if _, err := fs.readUploadInfo(id); err != nil {
+		return err
+	}
+
+	if err := os.Remove(fs.uploadBinPath(id)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "local: error removing upload file for "+id)
+	}
+
+	if err := os.Remove(fs.uploadInfoPath(id)); err != nil {
+		return errors.Wrap(err, "local: error removing upload info for "+id)
+	}
+	fs.forgetUpload(id)
+	return nil
+}
+
+// PurgeUploads removes the uploads whose state was last written before the
+// given time, as well as upload files left without state.
+func (fs *localfs) PurgeUploads(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+	infos, err := ioutil.ReadDir(fs.conf.Uploads)
+	if err != nil {
+		return nil, errors.Wrap(err, "local: error listing uploads")
+	}
+
+	var purged []string
+	for _, fi := range infos {
+		id := strings.TrimSuffix(fi.Name(), ".info")
+		if _, err := uuid.Parse(id); err != nil || fi.IsDir() || !fi.ModTime().Before(before) {
+			continue
+		}
+		p, err := fs.purgeUpload(id, fi.Name(), before, dryRun)
+		if p {
+			purged = append(purged, fi.Name())
+		}
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// purgeUpload removes the file of the upload if neither it nor its sibling
+// were written after the given time. It tells if the file was purged.
+func (fs *localfs) purgeUpload(id, name string, before time.Time, dryRun bool) (bool, error) {
+	defer fs.lockUpload(id)()
+
+	// a chunk may have been written while we were waiting for the lock
+	for _, fn := range []string{fs.uploadBinPath(id), fs.uploadInfoPath(id)} {
+		if st, err := os.Stat(fn); err == nil && !st.ModTime().Before(before) {
+			return false, nil
+		}
+	}
+	if _, err := os.Stat(path.Join(fs.conf.Uploads, name)); err != nil {
+		return false, nil
+	}
+
+	if dryRun {
+		return true, nil
+	}
+	if err := os.Remove(path.Join(fs.conf.Uploads, name)); err != nil && !os.IsNotExist(err) {
+		return true, errors.Wrap(err, "local: error purging upload "+name)
+	}
+	if name != id {
+		fs.forgetUpload(id)
+	}
+	return true, nil
+}
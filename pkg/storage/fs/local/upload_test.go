@@ -0,0 +1,207 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+func TestUploads(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := path.Join(tmp, "root")
+
+	fs, err := New(map[string]interface{}{"root": root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+	lfs := fs.(*localfs)
+
+	ctx := context.Background()
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+
+	id, err := lfs.InitiateUpload(ctx, ref("/file"), 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := lfs.WriteUploadChunk(ctx, id, 0, strings.NewReader("hello")); err != nil || n != 5 {
+		t.Fatalf("WriteUploadChunk() = %d, %v", n, err)
+	}
+	if _, err := lfs.WriteUploadChunk(ctx, id, 0, strings.NewReader("hello")); err == nil {
+		t.Error("expected an error writing at a wrong offset")
+	}
+	if info, err := lfs.GetUpload(ctx, id); err != nil || info.Offset != 5 {
+		t.Fatalf("GetUpload() = %+v, %v", info, err)
+	}
+	if err := lfs.FinishUpload(ctx, id); err == nil {
+		t.Error("expected an error finishing an incomplete upload")
+	}
+	// never more than announced
+	if n, err := lfs.WriteUploadChunk(ctx, id, 5, strings.NewReader("world and more")); err != nil || n != 5 {
+		t.Fatalf("WriteUploadChunk() = %d, %v", n, err)
+	}
+	if err := lfs.FinishUpload(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fs.Download(ctx, ref("/file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "helloworld" {
+		t.Errorf("Download() = %q", data)
+	}
+	if _, err := lfs.GetUpload(ctx, id); !isNotFound(err) {
+		t.Errorf("GetUpload() of a finished upload = %v", err)
+	}
+
+	// the uploads and the other state of the driver are not part of the
+	// namespace
+	for _, p := range []string{"/.uploads", "/.trash", "/.versions", "/.metadata.db", "/.ids", "/.journal"} {
+		if _, err := fs.GetMD(ctx, ref(p)); !isNotFound(err) {
+			t.Errorf("GetMD(%s) = %v", p, err)
+		}
+	}
+	for _, p := range []string{lfs.conf.Uploads, lfs.conf.Recycle, lfs.conf.Versions, lfs.conf.IDs, lfs.conf.Journal.File} {
+		if _, err := os.Stat(p); err != nil || isWithin(root, p) {
+			t.Errorf("state of the driver %s: %v", p, err)
+		}
+	}
+	if isWithin(root, lfs.conf.MetadataDB) {
+		t.Errorf("metadata db %s inside the root", lfs.conf.MetadataDB)
+	}
+	for _, conf := range []map[string]interface{}{
+		{"uploads": path.Join(root, "uploads")},
+		{"recycle": path.Join(root, "trash")},
+		{"versions": path.Join(root, "versions")},
+		{"metadata_db": path.Join(root, "metadata.db")},
+		{"ids": path.Join(root, "ids")},
+		{"journal": map[string]interface{}{"file": path.Join(root, "journal")}},
+	} {
+		conf["root"] = root
+		if _, err := New(conf); err == nil {
+			t.Errorf("expected an error with %v inside the root", conf)
+		}
+	}
+
+	if _, err := lfs.GetUpload(ctx, "../root/file"); !isNotFound(err) {
+		t.Errorf("GetUpload() with an invalid id = %v", err)
+	}
+}
+
+func TestConcurrentUploads(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reva-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fs, err := New(map[string]interface{}{"root": path.Join(tmp, "root")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Shutdown(context.Background())
+	lfs := fs.(*localfs)
+
+	ctx := context.Background()
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+
+	slow, err := lfs.InitiateUpload(ctx, ref("/slow"), 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := lfs.InitiateUpload(ctx, ref("/fast"), 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a chunk still being received must not hold back the other uploads
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := lfs.WriteUploadChunk(ctx, slow, 0, pr)
+		done <- err
+	}()
+	if _, err := pw.Write([]byte("sl")); err != nil {
+		t.Fatal(err)
+	}
+
+	fastDone := make(chan error)
+	go func() {
+		if _, err := lfs.WriteUploadChunk(ctx, fast, 0, bytes.NewBufferString("fast")); err != nil {
+			fastDone <- err
+			return
+		}
+		fastDone <- lfs.FinishUpload(ctx, fast)
+	}()
+	select {
+	case err := <-fastDone:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload blocked by another upload")
+	}
+
+	// the purge waits for the chunk being written instead of removing it
+	purged := make(chan []string)
+	go func() {
+		ids, _ := lfs.PurgeUploads(ctx, time.Now().Add(time.Hour), false)
+		purged <- ids
+	}()
+	pw.Write([]byte("ow"))
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	<-purged
+
+	// the purge happens after the chunk, which it removes as it is older than the limit
+	if _, err := lfs.GetUpload(ctx, slow); !isNotFound(err) {
+		t.Errorf("GetUpload() of a purged upload = %v", err)
+	}
+	if _, err := fs.GetMD(ctx, ref("/fast")); err != nil {
+		t.Errorf("GetMD(/fast) = %v", err)
+	}
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(errtypes.IsNotFound)
+	return ok
+}
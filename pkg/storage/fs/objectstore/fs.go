@@ -0,0 +1,536 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/mime"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/pkg/errors"
+)
+
+// defaultPartSize is the part size used when none is configured.
+const defaultPartSize = 8 * 1024 * 1024
+
+// Config holds the configuration shared by the object store drivers, to
+// be embedded in their configuration with the squash tag.
+type Config struct {
+	// Prefix is the key prefix the files are stored under.
+	Prefix string `mapstructure:"prefix"`
+	// Quota is the quota in bytes of the prefix, 0 means no quota.
+	Quota int `mapstructure:"quota"`
+	// PartSize is the size in bytes of the parts of multipart uploads, files
+	// up to this size are uploaded at once.
+	PartSize int64 `mapstructure:"part_size"`
+}
+
+type objectFS struct {
+	name  string
+	store Store
+	c     *Config
+}
+
+// New returns an implementation of the storage.FS interface storing the
+// files in the objects of the store. The name of the driver prefixes the
+// error messages. File ids are derived from the paths, versions, trash and
+// grants are not supported.
+func New(name string, store Store, c *Config) storage.FS {
+	if c.PartSize <= 0 {
+		c.PartSize = defaultPartSize
+	}
+	return &objectFS{name: name, store: store, c: c}
+}
+
+func (fs *objectFS) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// key returns the key of the object holding the file at path fn.
+func (fs *objectFS) key(fn string) string {
+	return strings.TrimPrefix(path.Join("/", fs.c.Prefix, fn), "/")
+}
+
+// dirPrefix returns the prefix of the keys of the objects in the folder
+// with key k.
+func dirPrefix(k string) string {
+	if k == "" {
+		return ""
+	}
+	return k + "/"
+}
+
+// path returns the path of the file stored at key k.
+func (fs *objectFS) path(k string) string {
+	root := strings.TrimPrefix(path.Join("/", fs.c.Prefix), "/")
+	return path.Join("/", strings.TrimPrefix(strings.TrimSuffix(k, "/"), root))
+}
+
+func (fs *objectFS) resolve(ctx context.Context, ref *provider.Reference) (string, error) {
+	if ref.GetPath() != "" {
+		return fs.key(ref.GetPath()), nil
+	}
+
+	if ref.GetId() != nil {
+		return fs.key(strings.TrimPrefix(ref.GetId().OpaqueId, "fileid-")), nil
+	}
+
+	// reference is invalid
+	return "", fmt.Errorf("%s: invalid reference %+v", fs.name, ref)
+}
+
+func (fs *objectFS) resourceInfo(k string, isDir bool, o *Object) *provider.ResourceInfo {
+	fn := fs.path(k)
+	ri := &provider.ResourceInfo{
+		Id:                &provider.ResourceId{OpaqueId: "fileid-" + strings.TrimPrefix(fn, "/")},
+		Path:              fn,
+		Type:              getResourceType(isDir),
+		MimeType:          mime.Detect(isDir, fn),
+		PermissionSet:     &provider.ResourcePermissions{ListContainer: true, CreateContainer: true},
+		Mtime:             &types.Timestamp{},
+		ArbitraryMetadata: &provider.ArbitraryMetadata{Metadata: map[string]string{}},
+	}
+	if o != nil {
+		ri.Etag = strings.Trim(o.ETag, `"`)
+		ri.Mtime.Seconds = uint64(o.Mtime.Unix())
+		if !isDir {
+			ri.Size = uint64(o.Size)
+		}
+		ri.ArbitraryMetadata.Metadata = arbitraryMetadata(o.Metadata)
+	}
+	return ri
+}
+
+func getResourceType(isDir bool) provider.ResourceType {
+	if isDir {
+		return provider.ResourceType_RESOURCE_TYPE_CONTAINER
+	}
+	return provider.ResourceType_RESOURCE_TYPE_FILE
+}
+
+// stat returns the object holding the file or the folder marker with key
+// k, the object is nil for folders without marker.
+func (fs *objectFS) stat(ctx context.Context, k string) (o *Object, isDir bool, err error) {
+	if k == "" {
+		return nil, true, nil
+	}
+	if k == strings.TrimPrefix(path.Join("/", fs.c.Prefix), "/") {
+		// the root always exists
+		o, err = fs.store.Stat(ctx, dirPrefix(k))
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return nil, true, nil
+		}
+		return o, true, err
+	}
+
+	o, err = fs.store.Stat(ctx, k)
+	if err == nil {
+		return o, false, nil
+	}
+	if _, ok := err.(errtypes.IsNotFound); !ok {
+		return nil, false, err
+	}
+
+	o, err = fs.store.Stat(ctx, dirPrefix(k))
+	if err == nil {
+		return o, true, nil
+	}
+	if _, ok := err.(errtypes.IsNotFound); !ok {
+		return nil, false, err
+	}
+
+	// folders created outside of reva have no marker
+	objects, prefixes, err := fs.store.List(ctx, dirPrefix(k), "/", 1)
+	if err != nil {
+		return nil, false, errors.Wrap(err, fs.name+": error listing "+k)
+	}
+	if len(objects) == 0 && len(prefixes) == 0 {
+		return nil, false, errtypes.NotFound(fs.path(k))
+	}
+	return nil, true, nil
+}
+
+func (fs *objectFS) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	k, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving ref")
+	}
+	o, isDir, err := fs.stat(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	return fs.resourceInfo(k, isDir, o), nil
+}
+
+func (fs *objectFS) ListFolder(ctx context.Context, ref *provider.Reference) ([]*provider.ResourceInfo, error) {
+	k, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving ref")
+	}
+
+	objects, prefixes, err := fs.store.List(ctx, dirPrefix(k), "/", 0)
+	if err != nil {
+		return nil, errors.Wrap(err, fs.name+": error listing "+k)
+	}
+	if len(objects) == 0 && len(prefixes) == 0 {
+		if _, isDir, err := fs.stat(ctx, k); err != nil {
+			return nil, err
+		} else if !isDir {
+			return nil, errtypes.NotFound(fs.path(k))
+		}
+	}
+
+	finfos := make([]*provider.ResourceInfo, 0, len(objects)+len(prefixes))
+	for _, p := range prefixes {
+		finfos = append(finfos, fs.resourceInfo(p, true, nil))
+	}
+	for _, o := range objects {
+		if o.Key == dirPrefix(k) {
+			// the marker of the folder itself
+			continue
+		}
+		finfos = append(finfos, fs.resourceInfo(o.Key, false, o))
+	}
+	return finfos, nil
+}
+
+func (fs *objectFS) CreateDir(ctx context.Context, fn string) error {
+	k := fs.key(fn)
+	if _, _, err := fs.stat(ctx, k); err == nil {
+		return errtypes.AlreadyExists(fn)
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		return err
+	}
+	if err := fs.store.Put(ctx, dirPrefix(k), strings.NewReader(""), 0); err != nil {
+		return errors.Wrap(err, fs.name+": error creating dir "+fn)
+	}
+	return nil
+}
+
+// walk calls fn for every object stored under the folder with key k,
+// including its marker.
+func (fs *objectFS) walk(ctx context.Context, k string, fn func(o *Object) error) (int, error) {
+	objects, _, err := fs.store.List(ctx, dirPrefix(k), "", 0)
+	if err != nil {
+		return 0, errors.Wrap(err, fs.name+": error listing "+k)
+	}
+	for _, o := range objects {
+		if err := fn(o); err != nil {
+			return 0, err
+		}
+	}
+	return len(objects), nil
+}
+
+func (fs *objectFS) Delete(ctx context.Context, ref *provider.Reference) error {
+	k, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "error resolving ref")
+	}
+
+	err = fs.store.Delete(ctx, k)
+	if _, ok := err.(errtypes.IsNotFound); !ok {
+		return err
+	}
+
+	// it might be a folder, delete everything below it
+	n, err := fs.walk(ctx, k, func(o *Object) error {
+		return fs.store.Delete(ctx, o.Key)
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errtypes.NotFound(fs.path(k))
+	}
+	return nil
+}
+
+// move copies the object to the new key and deletes it, as object stores
+// have no rename.
+func (fs *objectFS) move(ctx context.Context, oldKey, newKey string) error {
+	if err := fs.store.Copy(ctx, oldKey, newKey); err != nil {
+		return errors.Wrap(err, fs.name+": error copying "+oldKey)
+	}
+	return fs.store.Delete(ctx, oldKey)
+}
+
+func (fs *objectFS) Move(ctx context.Context, oldRef, newRef *provider.Reference) error {
+	oldKey, err := fs.resolve(ctx, oldRef)
+	if err != nil {
+		return errors.Wrap(err, "error resolving ref")
+	}
+	newKey, err := fs.resolve(ctx, newRef)
+	if err != nil {
+		return errors.Wrap(err, "error resolving ref")
+	}
+
+	_, isDir, err := fs.stat(ctx, oldKey)
+	if err != nil {
+		return err
+	}
+	if !isDir {
+		return fs.move(ctx, oldKey, newKey)
+	}
+
+	// every object below the folder is moved one by one
+	_, err = fs.walk(ctx, oldKey, func(o *Object) error {
+		return fs.move(ctx, o.Key, dirPrefix(newKey)+strings.TrimPrefix(o.Key, dirPrefix(oldKey)))
+	})
+	return err
+}
+
+// Upload stores small files with a single request and bigger ones with a
+// multipart upload, so they do not need to be buffered in memory.
+func (fs *objectFS) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	defer r.Close()
+
+	k, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "error resolving ref")
+	}
+
+	part, err := readPart(r, fs.c.PartSize)
+	if err != nil {
+		return errors.Wrap(err, fs.name+": error reading upload")
+	}
+	if int64(len(part)) < fs.c.PartSize {
+		if err := fs.store.Put(ctx, k, bytes.NewReader(part), int64(len(part))); err != nil {
+			return errors.Wrap(err, fs.name+": error uploading "+k)
+		}
+		return nil
+	}
+
+	id, err := fs.store.InitiateMultipart(ctx, k)
+	if err != nil {
+		return errors.Wrap(err, fs.name+": error initiating upload of "+k)
+	}
+	if err := fs.uploadParts(ctx, k, id, part, r); err != nil {
+		if aerr := fs.store.AbortMultipart(ctx, k, id); aerr != nil {
+			appctx.GetLogger(ctx).Error().Err(aerr).Str("key", k).Msg(fs.name + ": error aborting upload")
+		}
+		return err
+	}
+	return nil
+}
+
+func (fs *objectFS) uploadParts(ctx context.Context, k, id string, part []byte, r io.Reader) error {
+	var parts []string
+	var offset int64
+	for n := 1; len(part) > 0; n++ {
+		handle, err := fs.store.UploadPart(ctx, k, id, n, offset, part)
+		if err != nil {
+			return errors.Wrap(err, fs.name+": error uploading part of "+k)
+		}
+		parts = append(parts, handle)
+		offset += int64(len(part))
+
+		if int64(len(part)) < fs.c.PartSize {
+			break
+		}
+		if part, err = readPart(r, fs.c.PartSize); err != nil {
+			return errors.Wrap(err, fs.name+": error reading upload")
+		}
+	}
+	if err := fs.store.CompleteMultipart(ctx, k, id, parts, offset); err != nil {
+		return errors.Wrap(err, fs.name+": error completing upload of "+k)
+	}
+	return nil
+}
+
+// readPart reads up to size bytes, less only at the end of r.
+func readPart(r io.Reader, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+func (fs *objectFS) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	return fs.DownloadRange(ctx, ref, 0, -1)
+}
+
+// DownloadRange does a ranged read so only the requested bytes are
+// transferred.
+func (fs *objectFS) DownloadRange(ctx context.Context, ref *provider.Reference, offset, length int64) (io.ReadCloser, error) {
+	k, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving ref")
+	}
+	return fs.store.Get(ctx, k, offset, length)
+}
+
+// metadataKey returns the key of the object holding the metadata of the
+// file or folder with key k, creating the marker of folders without one.
+func (fs *objectFS) metadataKey(ctx context.Context, k string) (*Object, string, error) {
+	o, isDir, err := fs.stat(ctx, k)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isDir {
+		return o, k, nil
+	}
+	if o == nil {
+		if err := fs.store.Put(ctx, dirPrefix(k), strings.NewReader(""), 0); err != nil {
+			return nil, "", errors.Wrap(err, fs.name+": error creating dir marker "+k)
+		}
+		o = &Object{Key: dirPrefix(k)}
+	}
+	return o, dirPrefix(k), nil
+}
+
+// SetArbitraryMetadata stores the metadata in the metadata of the object,
+// for folders in the one of their marker.
+func (fs *objectFS) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
+	k, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "error resolving ref")
+	}
+	o, mk, err := fs.metadataKey(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	omd := map[string]string{}
+	for name, v := range o.Metadata {
+		omd[name] = v
+	}
+	for k, v := range md.GetMetadata() {
+		omd[encodeMetadataKey(k)] = v
+	}
+	return fs.store.SetMetadata(ctx, mk, omd)
+}
+
+// UnsetArbitraryMetadata removes the metadata, keys that are not set are
+// ignored.
+func (fs *objectFS) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
+	k, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "error resolving ref")
+	}
+	o, mk, err := fs.metadataKey(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	omd := map[string]string{}
+	for name, v := range o.Metadata {
+		omd[name] = v
+	}
+	for _, k := range keys {
+		delete(omd, encodeMetadataKey(k))
+	}
+	return fs.store.SetMetadata(ctx, mk, omd)
+}
+
+// GetQuota returns the configured quota, or the quota of the account of the
+// user when it is smaller. The used bytes are the size of the objects under
+// the prefix as object stores have no notion of quota.
+func (fs *objectFS) GetQuota(ctx context.Context) (int, int, error) {
+	used := 0
+	_, err := fs.walk(ctx, fs.key("/"), func(o *Object) error {
+		used += int(o.Size)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	total := fs.c.Quota
+	if u, ok := user.ContextGetUser(ctx); ok {
+		if q := int(user.Quota(u)); q > 0 && (total == 0 || q < total) {
+			total = q
+		}
+	}
+	return total, used, nil
+}
+
+// GetPathByID returns the path pointed by the file id, which is the path of
+// the file without the first slash.
+func (fs *objectFS) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
+	return path.Join("/", strings.TrimPrefix(id.OpaqueId, "fileid-")), nil
+}
+
+func (fs *objectFS) GetHome(ctx context.Context) (string, error) {
+	return "", errtypes.NotSupported(fs.name + ": get home not supported")
+}
+
+func (fs *objectFS) CreateHome(ctx context.Context) error {
+	return errtypes.NotSupported(fs.name + ": create home not supported")
+}
+
+func (fs *objectFS) AddGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported(fs.name + ": operation not supported")
+}
+
+func (fs *objectFS) ListGrants(ctx context.Context, ref *provider.Reference) ([]*provider.Grant, error) {
+	return nil, errtypes.NotSupported(fs.name + ": operation not supported")
+}
+
+func (fs *objectFS) RemoveGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported(fs.name + ": operation not supported")
+}
+
+func (fs *objectFS) UpdateGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported(fs.name + ": operation not supported")
+}
+
+func (fs *objectFS) CreateReference(ctx context.Context, path string, targetURI *url.URL) error {
+	return errtypes.NotSupported(fs.name + ": operation not supported")
+}
+
+func (fs *objectFS) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
+	return nil, errtypes.NotSupported("list revisions")
+}
+
+func (fs *objectFS) DownloadRevision(ctx context.Context, ref *provider.Reference, key string) (io.ReadCloser, error) {
+	return nil, errtypes.NotSupported("download revision")
+}
+
+func (fs *objectFS) RestoreRevision(ctx context.Context, ref *provider.Reference, key string) error {
+	return errtypes.NotSupported("restore revision")
+}
+
+func (fs *objectFS) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
+	return nil, errtypes.NotSupported("list recycle")
+}
+
+func (fs *objectFS) RestoreRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("restore recycle")
+}
+
+func (fs *objectFS) PurgeRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("purge recycle item")
+}
+
+func (fs *objectFS) EmptyRecycle(ctx context.Context) error {
+	return errtypes.NotSupported("empty recycle")
+}
@@ -0,0 +1,121 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package objectstore implements the storage.FS interface on top of object
+// stores like Azure Blob Storage or Google Cloud Storage. The keys of the
+// objects reflect the paths of the files, folders are marked with empty
+// objects whose key ends with a slash and the arbitrary metadata is kept in
+// the metadata of the objects. Drivers only implement the Store interface
+// for their object store.
+package objectstore
+
+import (
+	"context"
+	"encoding/base32"
+	"io"
+	"strings"
+	"time"
+)
+
+// Object describes an object of a store.
+type Object struct {
+	Key   string
+	Size  int64
+	ETag  string
+	Mtime time.Time
+	// Metadata holds the user metadata of the object, with lower case names.
+	// It is only filled by Stat.
+	Metadata map[string]string
+}
+
+// Store is the interface object store drivers implement. Keys are slash
+// separated and have no leading slash. Operations on missing objects return
+// an errtypes.NotFound error.
+type Store interface {
+	// Stat returns the object stored at key.
+	Stat(ctx context.Context, key string) (*Object, error)
+	// List returns the objects whose key starts with prefix. With a
+	// delimiter, the keys containing it after the prefix are grouped and
+	// returned as common prefixes instead, ending with the delimiter. When
+	// max is greater than zero, listing stops after max objects and
+	// prefixes.
+	List(ctx context.Context, prefix, delimiter string, max int) ([]*Object, []string, error)
+	// Get returns length bytes of the object starting at offset. A negative
+	// length reads until the end of the object.
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Put stores the size bytes read from r at key, replacing the object.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Copy copies the object and its metadata.
+	Copy(ctx context.Context, src, dst string) error
+	Delete(ctx context.Context, key string) error
+	// SetMetadata replaces the user metadata of the object.
+	SetMetadata(ctx context.Context, key string, md map[string]string) error
+
+	// InitiateMultipart starts a multipart upload to key and returns its id.
+	InitiateMultipart(ctx context.Context, key string) (string, error)
+	// UploadPart uploads the part n, starting at offset, and returns the
+	// handle of the part to pass to CompleteMultipart. All parts but the
+	// last one are exactly the part size long and they are uploaded in
+	// order.
+	UploadPart(ctx context.Context, key, id string, n int, offset int64, data []byte) (string, error)
+	// CompleteMultipart assembles the parts into the object, size is the
+	// total size of the parts.
+	CompleteMultipart(ctx context.Context, key, id string, parts []string, size int64) error
+	AbortMultipart(ctx context.Context, key, id string) error
+}
+
+// mdPrefix prefixes the names of the object metadata holding arbitrary
+// metadata.
+const mdPrefix = "reva_"
+
+// mdEncoding encodes the arbitrary metadata keys, which can contain any
+// character, to metadata names made of lower case letters and digits, as
+// object stores only allow a few characters and ignore the case.
+var mdEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// encodeMetadataKey returns the object metadata name of the arbitrary
+// metadata key k.
+func encodeMetadataKey(k string) string {
+	return mdPrefix + strings.ToLower(mdEncoding.EncodeToString([]byte(k)))
+}
+
+// decodeMetadataKey returns the arbitrary metadata key stored in the object
+// metadata name, false when the name does not hold arbitrary metadata.
+func decodeMetadataKey(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if !strings.HasPrefix(name, mdPrefix) {
+		return "", false
+	}
+	k, err := mdEncoding.DecodeString(strings.ToUpper(strings.TrimPrefix(name, mdPrefix)))
+	if err != nil {
+		return "", false
+	}
+	return string(k), true
+}
+
+// arbitraryMetadata returns the arbitrary metadata kept in the object
+// metadata md.
+func arbitraryMetadata(md map[string]string) map[string]string {
+	amd := map[string]string{}
+	for name, v := range md {
+		if k, ok := decodeMetadataKey(name); ok {
+			amd[k] = v
+		}
+	}
+	return amd
+}
@@ -0,0 +1,340 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/conformance"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+// memStore is an in memory Store, multipart uploads are kept until they are
+// completed.
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string]*memObject
+	uploads map[string][][]byte
+}
+
+type memObject struct {
+	data []byte
+	md   map[string]string
+}
+
+func newMemStore() *memStore {
+	return &memStore{objects: map[string]*memObject{}, uploads: map[string][][]byte{}}
+}
+
+func (s *memStore) object(key string, o *memObject) *Object {
+	return &Object{Key: key, Size: int64(len(o.data)), ETag: `"etag"`, Mtime: time.Unix(1, 0), Metadata: o.md}
+}
+
+func (s *memStore) Stat(ctx context.Context, key string) (*Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, errtypes.NotFound(key)
+	}
+	return s.object(key, o), nil
+}
+
+func (s *memStore) List(ctx context.Context, prefix, delimiter string, max int) ([]*Object, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var objects []*Object
+	var prefixes []string
+	seen := map[string]bool{}
+	for k, o := range s.objects {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if i := strings.Index(k[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			p := k[:len(prefix)+i+1]
+			if !seen[p] {
+				seen[p] = true
+				prefixes = append(prefixes, p)
+			}
+			continue
+		}
+		objects = append(objects, s.object(k, o))
+	}
+	return objects, prefixes, nil
+}
+
+func (s *memStore) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, errtypes.NotFound(key)
+	}
+	data := o.data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = &memObject{data: data}
+	return nil
+}
+
+func (s *memStore) Copy(ctx context.Context, src, dst string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[src]
+	if !ok {
+		return errtypes.NotFound(src)
+	}
+	s.objects[dst] = &memObject{data: o.data, md: o.md}
+	return nil
+}
+
+func (s *memStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[key]; !ok {
+		return errtypes.NotFound(key)
+	}
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memStore) SetMetadata(ctx context.Context, key string, md map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	if !ok {
+		return errtypes.NotFound(key)
+	}
+	o.md = md
+	return nil
+}
+
+func (s *memStore) InitiateMultipart(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[key] = nil
+	return key, nil
+}
+
+func (s *memStore) UploadPart(ctx context.Context, key, id string, n int, offset int64, data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[id] = append(s.uploads[id], append([]byte{}, data...))
+	return string(rune('0' + n)), nil
+}
+
+func (s *memStore) CompleteMultipart(ctx context.Context, key, id string, parts []string, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = &memObject{data: bytes.Join(s.uploads[id], nil)}
+	delete(s.uploads, id)
+	return nil
+}
+
+func (s *memStore) AbortMultipart(ctx context.Context, key, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, id)
+	return nil
+}
+
+func ref(p string) *provider.Reference {
+	return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+}
+
+func read(t *testing.T, rc io.ReadCloser, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestObjectFS(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	fs := New("mem", s, &Config{Prefix: "data", PartSize: 4})
+
+	if err := fs.CreateDir(ctx, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.CreateDir(ctx, "/docs"); err == nil {
+		t.Fatal("expected an error creating an existing dir")
+	} else if _, ok := err.(errtypes.IsAlreadyExists); !ok {
+		t.Fatalf("expected already exists, got %v", err)
+	}
+	if err := fs.Upload(ctx, ref("/docs/small.txt"), ioutil.NopCloser(strings.NewReader("abc"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Upload(ctx, ref("/docs/big.txt"), ioutil.NopCloser(strings.NewReader("0123456789"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.uploads) != 0 {
+		t.Fatalf("expected no pending uploads, got %d", len(s.uploads))
+	}
+	// a folder created outside of reva, without marker
+	s.objects["data/docs/sub/file"] = &memObject{data: []byte("x")}
+
+	infos, err := fs.ListFolder(ctx, ref("/docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ri := range infos {
+		names = append(names, ri.Path)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "/docs/big.txt,/docs/small.txt,/docs/sub" {
+		t.Fatalf("unexpected listing %v", names)
+	}
+
+	ri, err := fs.GetMD(ctx, ref("/docs/big.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Size != 10 || ri.Type != provider.ResourceType_RESOURCE_TYPE_FILE || ri.Etag != "etag" {
+		t.Fatalf("unexpected metadata %+v", ri)
+	}
+	if ri, err := fs.GetMD(ctx, ref("/docs/sub")); err != nil || ri.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		t.Fatalf("expected a folder, got %+v %v", ri, err)
+	}
+	if _, err := fs.GetMD(ctx, ref("/missing")); err == nil {
+		t.Fatal("expected not found")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	rc, err := fs.Download(ctx, ref("/docs/big.txt"))
+	if got := read(t, rc, err); got != "0123456789" {
+		t.Fatalf("unexpected content %q", got)
+	}
+	rc, err = fs.(*objectFS).DownloadRange(ctx, ref("/docs/big.txt"), 2, 3)
+	if got := read(t, rc, err); got != "234" {
+		t.Fatalf("unexpected range %q", got)
+	}
+
+	md := &provider.ArbitraryMetadata{Metadata: map[string]string{"http://owncloud.org/ns/favorite": "1", "checksums": "sha1:x"}}
+	if err := fs.SetArbitraryMetadata(ctx, ref("/docs/sub"), md); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.UnsetArbitraryMetadata(ctx, ref("/docs/sub"), []string{"checksums"}); err != nil {
+		t.Fatal(err)
+	}
+	ri, err = fs.GetMD(ctx, ref("/docs/sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := ri.ArbitraryMetadata.Metadata; len(m) != 1 || m["http://owncloud.org/ns/favorite"] != "1" {
+		t.Fatalf("unexpected arbitrary metadata %v", m)
+	}
+
+	if err := fs.Move(ctx, ref("/docs"), ref("/moved")); err != nil {
+		t.Fatal(err)
+	}
+	rc, err = fs.Download(ctx, ref("/moved/sub/file"))
+	if got := read(t, rc, err); got != "x" {
+		t.Fatalf("unexpected content %q", got)
+	}
+	if _, err := fs.GetMD(ctx, ref("/docs")); err == nil {
+		t.Fatal("expected the old folder to be gone")
+	}
+
+	if _, used, err := fs.GetQuota(ctx); err != nil || used != 14 {
+		t.Fatalf("unexpected used bytes %d %v", used, err)
+	}
+
+	if err := fs.Delete(ctx, ref("/moved")); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.objects) != 0 {
+		t.Fatalf("expected no objects left, got %d", len(s.objects))
+	}
+	if err := fs.Delete(ctx, ref("/moved")); err == nil {
+		t.Fatal("expected not found")
+	}
+}
+
+func TestAccountQuota(t *testing.T) {
+	fs := New("mem", newMemStore(), &Config{Prefix: "data", Quota: 1000})
+	u := &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein"}}
+	ctx := user.ContextSetUser(context.Background(), u)
+
+	for _, tt := range []struct {
+		account uint64
+		total   int
+	}{
+		{0, 1000},
+		{2000, 1000},
+		{100, 100},
+	} {
+		user.SetQuota(u, tt.account)
+		if total, _, err := fs.GetQuota(ctx); err != nil || total != tt.total {
+			t.Errorf("account quota %d: GetQuota() = %d, %v, expected %d", tt.account, total, err, tt.total)
+		}
+	}
+}
+
+func TestMetadataKeys(t *testing.T) {
+	for _, k := range []string{"checksums", "http://owncloud.org/ns/favorite", "Ünïcode key"} {
+		name := encodeMetadataKey(k)
+		if name != strings.ToLower(name) || strings.ContainsAny(name, "-:/= ") {
+			t.Fatalf("invalid metadata name %q", name)
+		}
+		if got, ok := decodeMetadataKey(strings.ToUpper(name)); !ok || got != k {
+			t.Fatalf("expected %q, got %q", k, got)
+		}
+	}
+	if _, ok := decodeMetadataKey("content_type"); ok {
+		t.Fatal("expected foreign metadata to be ignored")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) (storage.FS, context.Context) {
+		return New("mem", newMemStore(), &Config{Prefix: "data", PartSize: 4}), context.Background()
+	})
+}
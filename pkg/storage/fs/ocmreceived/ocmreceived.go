@@ -0,0 +1,477 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package ocmreceived implements a storage driver serving the shares the
+// users received from remote providers through OCM. Every accepted share is
+// a folder at the root, named after the shared resource, whose operations
+// are proxied to the webdav endpoint of the remote provider with the token
+// of the share.
+package ocmreceived
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/share"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/cs3org/reva/pkg/sharedconf"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/storage/fs/webdav"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("ocmreceived", New)
+}
+
+type config struct {
+	GatewaySvc string `mapstructure:"gatewaysvc"`
+	// Insecure skips the verification of the certificates of the remote
+	// providers.
+	Insecure bool `mapstructure:"insecure"`
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// listFunc returns the received shares of the user in the context, with the
+// access to the remote resources keyed by share id.
+type listFunc func(ctx context.Context) ([]*ocm.ReceivedShare, *types.Opaque, error)
+
+// mount is an accepted share, found at /<name>.
+type mount struct {
+	name   string
+	share  *ocm.Share
+	remote *share.RemoteShare
+	fs     storage.FS
+}
+
+type ocmfs struct {
+	c    *config
+	list listFunc
+
+	sync.Mutex
+	// clients caches the webdav drivers by share id.
+	clients map[string]*cachedFS
+}
+
+type cachedFS struct {
+	remote share.RemoteShare
+	fs     storage.FS
+}
+
+// New returns a storage.FS serving the accepted OCM shares of the user.
+func New(m map[string]interface{}) (storage.FS, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.GatewaySvc = sharedconf.GetGatewaySVC(c.GatewaySvc)
+
+	fs := &ocmfs{c: c, clients: map[string]*cachedFS{}}
+	fs.list = fs.listReceivedShares
+	return fs, nil
+}
+
+func (fs *ocmfs) listReceivedShares(ctx context.Context) ([]*ocm.ReceivedShare, *types.Opaque, error) {
+	client, err := pool.GetGatewayServiceClient(fs.c.GatewaySvc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "ocmreceived: error getting gateway client")
+	}
+	res, err := client.ListReceivedOCMShares(ctx, &ocm.ListReceivedOCMSharesRequest{})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "ocmreceived: error listing received shares")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return nil, nil, errors.New("ocmreceived: error listing received shares: " + res.Status.Message)
+	}
+	return res.Shares, res.Opaque, nil
+}
+
+// webdavFS returns the driver accessing the remote resource of a share.
+func (fs *ocmfs) webdavFS(id string, r *share.RemoteShare) (storage.FS, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	if c, ok := fs.clients[id]; ok && c.remote == *r {
+		return c.fs, nil
+	}
+	wfs, err := webdav.New(map[string]interface{}{
+		"endpoint": r.WebDAVEndpoint,
+		"auth":     "basic",
+		"username": r.Token,
+		"insecure": fs.c.Insecure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fs.clients[id] = &cachedFS{remote: *r, fs: wfs}
+	return wfs, nil
+}
+
+// mounts returns the accepted shares received from remote providers. The
+// names clashing with a previous share get the share id appended.
+func (fs *ocmfs) mounts(ctx context.Context) ([]*mount, error) {
+	shares, opaque, err := fs.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := []*mount{}
+	names := map[string]bool{}
+	for _, rs := range shares {
+		if rs.State != ocm.ShareState_SHARE_STATE_ACCEPTED {
+			continue
+		}
+		e, ok := opaque.GetMap()[rs.Share.Id.OpaqueId]
+		if !ok {
+			continue
+		}
+		r := &share.RemoteShare{}
+		if err := json.Unmarshal(e.Value, r); err != nil {
+			return nil, errors.Wrap(err, "ocmreceived: error decoding remote share")
+		}
+		wfs, err := fs.webdavFS(rs.Share.Id.OpaqueId, r)
+		if err != nil {
+			return nil, err
+		}
+
+		name := r.Name
+		if name == "" || names[name] {
+			name = fmt.Sprintf("%s (%s)", name, rs.Share.Id.OpaqueId)
+		}
+		names[name] = true
+		mounts = append(mounts, &mount{name: strings.TrimSpace(name), share: rs.Share, remote: r, fs: wfs})
+	}
+	return mounts, nil
+}
+
+// resolve returns the mount a reference belongs to, nil for the root, and
+// the path relative to the root of the share.
+func (fs *ocmfs) resolve(ctx context.Context, ref *provider.Reference) (*mount, string, error) {
+	mounts, err := fs.mounts(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case ref.GetPath() != "":
+		fn := strings.TrimPrefix(path.Clean("/"+ref.GetPath()), "/")
+		if fn == "" {
+			return nil, "/", nil
+		}
+		name, rel := fn, "/"
+		if i := strings.Index(fn, "/"); i >= 0 {
+			name, rel = fn[:i], fn[i:]
+		}
+		for _, m := range mounts {
+			if m.name == name {
+				return m, rel, nil
+			}
+		}
+		return nil, "", errtypes.NotFound(ref.GetPath())
+	case ref.GetId() != nil:
+		id := ref.GetId().OpaqueId
+		i := strings.Index(id, ":")
+		if i < 0 {
+			return nil, "/", nil
+		}
+		for _, m := range mounts {
+			if m.share.Id.OpaqueId == id[:i] {
+				return m, path.Join("/", id[i+1:]), nil
+			}
+		}
+		return nil, "", errtypes.NotFound(id)
+	}
+	return nil, "", fmt.Errorf("ocmreceived: invalid reference %+v", ref)
+}
+
+func pathRef(fn string) *provider.Reference {
+	return &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+}
+
+// info turns the resource info of the remote provider into the one of the
+// share, the ids are the share id and the path relative to the share.
+func (m *mount) info(ri *provider.ResourceInfo) *provider.ResourceInfo {
+	rel := path.Join("/", ri.Path)
+	ri.Path = path.Join("/", m.name, rel)
+	ri.Id = &provider.ResourceId{OpaqueId: m.share.Id.OpaqueId + ":" + strings.TrimPrefix(rel, "/")}
+	ri.Owner = m.share.Owner
+	ri.PermissionSet = m.share.Permissions.GetPermissions()
+	return ri
+}
+
+// writable returns an error when the share does not allow to modify its
+// content, or when fn is the root of the share or of the storage.
+func writable(m *mount, rel string) error {
+	if m == nil || rel == "/" {
+		return errtypes.PermissionDenied("ocmreceived: shares are managed through the ocm api")
+	}
+	if !m.share.Permissions.GetPermissions().GetInitiateFileUpload() {
+		return errtypes.PermissionDenied("ocmreceived: share " + m.name + " is read only")
+	}
+	return nil
+}
+
+func (fs *ocmfs) rootInfo(mounts []*mount) *provider.ResourceInfo {
+	h := md5.New()
+	for _, m := range mounts {
+		_, _ = io.WriteString(h, m.share.Id.OpaqueId+m.name)
+	}
+	return &provider.ResourceInfo{
+		Id:            &provider.ResourceId{OpaqueId: "root"},
+		Path:          "/",
+		Type:          provider.ResourceType_RESOURCE_TYPE_CONTAINER,
+		MimeType:      "httpd/unix-directory",
+		Etag:          fmt.Sprintf("%x", h.Sum(nil)),
+		PermissionSet: &provider.ResourcePermissions{GetPath: true, ListContainer: true, Stat: true},
+		Mtime:         &types.Timestamp{},
+	}
+}
+
+func (fs *ocmfs) GetHome(ctx context.Context) (string, error) {
+	return "", errtypes.NotSupported("ocmreceived: received shares have no home")
+}
+
+func (fs *ocmfs) CreateHome(ctx context.Context) error {
+	return errtypes.NotSupported("ocmreceived: received shares have no home")
+}
+
+func (fs *ocmfs) CreateDir(ctx context.Context, fn string) error {
+	m, rel, err := fs.resolve(ctx, pathRef(fn))
+	if err != nil {
+		return err
+	}
+	if err := writable(m, rel); err != nil {
+		return err
+	}
+	return m.fs.CreateDir(ctx, rel)
+}
+
+func (fs *ocmfs) Delete(ctx context.Context, ref *provider.Reference) error {
+	m, rel, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if err := writable(m, rel); err != nil {
+		return err
+	}
+	return m.fs.Delete(ctx, pathRef(rel))
+}
+
+func (fs *ocmfs) Move(ctx context.Context, oldRef, newRef *provider.Reference) error {
+	oldM, oldRel, err := fs.resolve(ctx, oldRef)
+	if err != nil {
+		return err
+	}
+	if err := writable(oldM, oldRel); err != nil {
+		return err
+	}
+	newM, newRel, err := fs.resolve(ctx, newRef)
+	if err != nil {
+		return err
+	}
+	if err := writable(newM, newRel); err != nil {
+		return err
+	}
+	if oldM.share.Id.OpaqueId != newM.share.Id.OpaqueId {
+		return errtypes.NotSupported("ocmreceived: moving across shares")
+	}
+	return oldM.fs.Move(ctx, pathRef(oldRel), pathRef(newRel))
+}
+
+func (fs *ocmfs) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	m, rel, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		mounts, err := fs.mounts(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return fs.rootInfo(mounts), nil
+	}
+
+	ri, err := m.fs.GetMD(ctx, pathRef(rel))
+	if err != nil {
+		return nil, err
+	}
+	return m.info(ri), nil
+}
+
+func (fs *ocmfs) ListFolder(ctx context.Context, ref *provider.Reference) ([]*provider.ResourceInfo, error) {
+	m, rel, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return fs.listShares(ctx)
+	}
+
+	infos, err := m.fs.ListFolder(ctx, pathRef(rel))
+	if err != nil {
+		return nil, err
+	}
+	for _, ri := range infos {
+		m.info(ri)
+	}
+	return infos, nil
+}
+
+// listShares returns the roots of the shares, the ones whose remote provider
+// can not be reached are left out.
+func (fs *ocmfs) listShares(ctx context.Context) ([]*provider.ResourceInfo, error) {
+	log := appctx.GetLogger(ctx)
+	mounts, err := fs.mounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []*provider.ResourceInfo{}
+	for _, m := range mounts {
+		ri, err := m.fs.GetMD(ctx, pathRef("/"))
+		if err != nil {
+			log.Error().Err(err).Str("share", m.share.Id.OpaqueId).Str("endpoint", m.remote.WebDAVEndpoint).Msg("ocmreceived: error reaching the remote share")
+			continue
+		}
+		infos = append(infos, m.info(ri))
+	}
+	return infos, nil
+}
+
+func (fs *ocmfs) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	m, rel, err := fs.resolve(ctx, ref)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	if err := writable(m, rel); err != nil {
+		r.Close()
+		return err
+	}
+	return m.fs.Upload(ctx, pathRef(rel), r)
+}
+
+func (fs *ocmfs) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	m, rel, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errtypes.PermissionDenied("ocmreceived: can not download the root")
+	}
+	return m.fs.Download(ctx, pathRef(rel))
+}
+
+// GetPathByID returns the path of the resource in the share named after the
+// share id of the resource id.
+func (fs *ocmfs) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
+	m, rel, err := fs.resolve(ctx, &provider.Reference{Spec: &provider.Reference_Id{Id: id}})
+	if err != nil {
+		return "", err
+	}
+	if m == nil {
+		return "/", nil
+	}
+	return path.Join("/", m.name, rel), nil
+}
+
+func (fs *ocmfs) GetQuota(ctx context.Context) (int, int, error) {
+	return 0, 0, errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (fs *ocmfs) AddGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) ListGrants(ctx context.Context, ref *provider.Reference) ([]*provider.Grant, error) {
+	return nil, errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) RemoveGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) UpdateGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) CreateReference(ctx context.Context, path string, targetURI *url.URL) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
+	return nil, errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) DownloadRevision(ctx context.Context, ref *provider.Reference, key string) (io.ReadCloser, error) {
+	return nil, errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) RestoreRevision(ctx context.Context, ref *provider.Reference, key string) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
+	return nil, errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) RestoreRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) PurgeRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
+
+func (fs *ocmfs) EmptyRecycle(ctx context.Context) error {
+	return errtypes.NotSupported("ocmreceived: operation not supported")
+}
@@ -0,0 +1,143 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package ocmreceived
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ocm "github.com/cs3org/go-cs3apis/cs3/sharing/ocm/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/ocm/share"
+	"golang.org/x/net/webdav"
+)
+
+func receivedShare(t *testing.T, id string, state ocm.ShareState, write bool, r *share.RemoteShare) (*ocm.ReceivedShare, *types.OpaqueEntry) {
+	val, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &ocm.ReceivedShare{
+		Share: &ocm.Share{
+			Id: &ocm.ShareId{OpaqueId: id},
+			Permissions: &ocm.SharePermissions{
+				Permissions: &provider.ResourcePermissions{Stat: true, InitiateFileUpload: write},
+			},
+		},
+		State: state,
+	}
+	return rs, &types.OpaqueEntry{Decoder: "json", Value: val}
+}
+
+func TestOCMReceivedFS(t *testing.T) {
+	dav := &webdav.Handler{
+		Prefix:     "/dav/ocm",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, _, ok := r.BasicAuth(); !ok || (u != "rw-token" && u != "ro-token") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	rw, rwEntry := receivedShare(t, "s1", ocm.ShareState_SHARE_STATE_ACCEPTED, true,
+		&share.RemoteShare{Name: "photos", WebDAVEndpoint: srv.URL + "/dav/ocm", Token: "rw-token"})
+	ro, roEntry := receivedShare(t, "s2", ocm.ShareState_SHARE_STATE_ACCEPTED, false,
+		&share.RemoteShare{Name: "docs", WebDAVEndpoint: srv.URL + "/dav/ocm", Token: "ro-token"})
+	pending, pendingEntry := receivedShare(t, "s3", ocm.ShareState_SHARE_STATE_PENDING, true,
+		&share.RemoteShare{Name: "pending", WebDAVEndpoint: srv.URL + "/dav/ocm", Token: "rw-token"})
+
+	fs := &ocmfs{c: &config{}, clients: map[string]*cachedFS{}}
+	fs.list = func(ctx context.Context) ([]*ocm.ReceivedShare, *types.Opaque, error) {
+		return []*ocm.ReceivedShare{rw, ro, pending}, &types.Opaque{Map: map[string]*types.OpaqueEntry{
+			"s1": rwEntry, "s2": roEntry, "s3": pendingEntry,
+		}}, nil
+	}
+	ctx := context.Background()
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+
+	infos, err := fs.ListFolder(ctx, ref("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Path != "/photos" || infos[1].Path != "/docs" {
+		t.Fatalf("unexpected shares at the root: %v", infos)
+	}
+
+	if err := fs.CreateDir(ctx, "/photos/2020"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Upload(ctx, ref("/photos/2020/cat.jpg"), ioutil.NopCloser(strings.NewReader("meow"))); err != nil {
+		t.Fatal(err)
+	}
+	ri, err := fs.GetMD(ctx, ref("/photos/2020/cat.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Path != "/photos/2020/cat.jpg" || ri.Size != 4 || ri.Id.OpaqueId != "s1:2020/cat.jpg" {
+		t.Errorf("unexpected resource info: %v", ri)
+	}
+
+	fn, err := fs.GetPathByID(ctx, ri.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn != "/photos/2020/cat.jpg" {
+		t.Errorf("GetPathByID got = %s, want /photos/2020/cat.jpg", fn)
+	}
+
+	rc, err := fs.Download(ctx, &provider.Reference{Spec: &provider.Reference_Id{Id: ri.Id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	if string(data) != "meow" {
+		t.Errorf("Download got = %q, want meow", data)
+	}
+
+	// the read only share and the root can not be modified
+	err = fs.Upload(ctx, ref("/docs/a.txt"), ioutil.NopCloser(strings.NewReader("a")))
+	if _, ok := err.(errtypes.IsPermissionDenied); !ok {
+		t.Errorf("upload to a read only share got = %v, want permission denied", err)
+	}
+	if _, ok := fs.Delete(ctx, ref("/photos")).(errtypes.IsPermissionDenied); !ok {
+		t.Error("the root of a share was deleted")
+	}
+	if _, ok := fs.Move(ctx, ref("/photos/2020"), ref("/docs/2020")).(errtypes.IsPermissionDenied); !ok {
+		t.Error("a folder was moved to a read only share")
+	}
+
+	if _, err := fs.GetMD(ctx, ref("/pending")); err == nil {
+		t.Error("a pending share is mounted")
+	}
+}
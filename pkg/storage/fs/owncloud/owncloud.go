@@ -40,7 +40,10 @@ import (
 	"github.com/cs3org/reva/pkg/logger"
 	"github.com/cs3org/reva/pkg/mime"
 	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/checksums"
 	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/storage/journal"
+	"github.com/cs3org/reva/pkg/storage/propagator"
 	"github.com/cs3org/reva/pkg/storage/templates"
 	"github.com/cs3org/reva/pkg/user"
 	"github.com/gofrs/uuid"
@@ -156,6 +159,11 @@ type config struct {
 	Redis         string `mapstructure:"redis"`
 	EnableHome    bool   `mapstructure:"enable_home"`
 	Scan          bool   `mapstructure:"scan"`
+	// Propagation updates the mtime, and with it the etag, of the
+	// ancestors of the changed files up to the files folder of the user.
+	Propagation propagator.Config `mapstructure:"propagation"`
+	// Journal records the changes for the sync clients.
+	Journal journal.Config `mapstructure:"journal"`
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -219,18 +227,39 @@ func New(m map[string]interface{}) (storage.FS, error) {
 		},
 	}
 
-	return &ocfs{c: c, pool: pool}, nil
+	j, err := journal.New(c.Journal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ocfs{c: c, pool: pool, propagator: propagator.New(c.Propagation, propagator.Touch), journal: j}, nil
 }
 
 type ocfs struct {
-	c    *config
-	pool *redis.Pool
+	c          *config
+	pool       *redis.Pool
+	propagator *propagator.Propagator
+	journal    *journal.Journal
 }
 
 func (fs *ocfs) Shutdown(ctx context.Context) error {
+	fs.propagator.Flush()
+	if err := fs.journal.Close(); err != nil {
+		return err
+	}
 	return fs.pool.Close()
 }
 
+// propagate updates the ancestors of the changed file, up to the files
+// folder of its owner.
+func (fs *ocfs) propagate(ctx context.Context, np string) {
+	root := path.Join(fs.c.DataDirectory, fs.getOwner(np), "files")
+	if u, ok := user.ContextGetUser(ctx); ok && fs.c.EnableHome {
+		root = path.Join(fs.c.DataDirectory, templates.WithUser(u, fs.c.UserLayout), "files")
+	}
+	fs.propagator.Propagate(root, np)
+}
+
 // scan files and add uuid to path mapping to kv store
 func (fs *ocfs) scanFiles(ctx context.Context, conn redis.Conn) {
 	if fs.c.Scan {
@@ -417,6 +446,21 @@ func (fs *ocfs) convertToResourceInfo(ctx context.Context, fi os.FileInfo, np st
 		appctx.GetLogger(ctx).Error().Err(errtypes.UserRequired("userrequired")).Msg("error getting user from ctx")
 	}
 
+	metadata := map[string]string{}
+	if attrs, err := xattr.List(np); err == nil {
+		for _, attr := range attrs {
+			if !strings.HasPrefix(attr, mdPrefix) {
+				continue
+			}
+			if val, err := xattr.Get(np, attr); err == nil {
+				metadata[strings.TrimPrefix(attr, mdPrefix)] = string(val)
+			}
+		}
+	} else {
+		appctx.GetLogger(ctx).Error().Err(err).Str("np", np).Msg("error listing metadata")
+	}
+	metadata["http://owncloud.org/ns/favorite"] = favorite
+
 	return &provider.ResourceInfo{
 		Id:            &provider.ResourceId{OpaqueId: id},
 		Path:          fn,
@@ -431,9 +475,7 @@ func (fs *ocfs) convertToResourceInfo(ctx context.Context, fi os.FileInfo, np st
 			// TODO read nanos from where? Nanos:   fi.MTimeNanos,
 		},
 		ArbitraryMetadata: &provider.ArbitraryMetadata{
-			Metadata: map[string]string{
-				"http://owncloud.org/ns/favorite": favorite,
-			},
+			Metadata: metadata,
 		},
 	}
 }
@@ -488,12 +530,54 @@ func (fs *ocfs) getPath(ctx context.Context, id *provider.ResourceId) (string, e
 	fs.scanFiles(ctx, c)
 	np, err := redis.String(c.Do("GET", id.OpaqueId))
 	if err != nil {
+		if err == redis.ErrNil {
+			return "", errtypes.NotFound(id.OpaqueId)
+		}
 		appctx.GetLogger(ctx).Error().Err(err).Interface("id", id).Msg("error looking up fileid")
 		return "", err
 	}
+	// the cached path is stale once the file has been deleted
+	if readID(np) != id.OpaqueId {
+		return "", errtypes.NotFound(id.OpaqueId)
+	}
 	return np, nil
 }
 
+// readID returns the id of the file at np, empty if it has none.
+func readID(np string) string {
+	v, err := xattr.Get(np, idAttribute)
+	if err != nil {
+		return ""
+	}
+	uid, err := uuid.FromBytes(v)
+	if err != nil {
+		return ""
+	}
+	return uid.String()
+}
+
+// cacheIDs caches the paths of np and of its children after they have been
+// moved, so that they can still be found by id.
+func (fs *ocfs) cacheIDs(ctx context.Context, np string) error {
+	c := fs.pool.Get()
+	defer c.Close()
+	err := filepath.Walk(np, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if id := readID(p); id != "" {
+			return c.Send("SET", id, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "ocfs: error caching ids of "+np)
+	}
+	// flushes the pipeline and receives the pending replies
+	_, err = c.Do("")
+	return err
+}
+
 // GetPathByID returns the fn pointed by the file id, without the internal namespace
 func (fs *ocfs) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
 	np, err := fs.getPath(ctx, id)
@@ -905,6 +989,8 @@ func (fs *ocfs) CreateDir(ctx context.Context, fn string) (err error) {
 		// FIXME we also need already exists error, webdav expects 405 MethodNotAllowed
 		return errors.Wrap(err, "ocfs: error creating dir "+np)
 	}
+	fs.propagate(ctx, np)
+	fs.journal.Record(np, false)
 	return nil
 }
 
@@ -1174,6 +1260,8 @@ func (fs *ocfs) Delete(ctx context.Context, ref *provider.Reference) (err error)
 	if err := os.Rename(np, tgt); err != nil {
 		return errors.Wrap(err, "ocfs: could not restore item")
 	}
+	fs.propagate(ctx, np)
+	fs.journal.Record(np, true)
 
 	// TODO(jfd) move versions to trash
 	return nil
@@ -1191,7 +1279,11 @@ func (fs *ocfs) Move(ctx context.Context, oldRef, newRef *provider.Reference) (e
 	if err = os.Rename(oldName, newName); err != nil {
 		return errors.Wrap(err, "ocfs: error moving "+oldName+" to "+newName)
 	}
-	return nil
+	fs.propagate(ctx, oldName)
+	fs.journal.Record(oldName, true)
+	fs.propagate(ctx, newName)
+	fs.journal.Record(newName, false)
+	return fs.cacheIDs(ctx, newName)
 }
 
 func (fs *ocfs) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
@@ -1277,6 +1369,8 @@ func (fs *ocfs) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCl
 	if err := os.Rename(tmp.Name(), np); err != nil {
 		return errors.Wrap(err, "ocfs: error renaming from "+tmp.Name()+" to "+np)
 	}
+	fs.propagate(ctx, np)
+	fs.journal.Record(np, false)
 
 	return nil
 }
@@ -1302,6 +1396,10 @@ func (fs *ocfs) copyMD(s string, t string) (err error) {
 		return err
 	}
 	for i := range attrs {
+		// the checksums describe the old content
+		if attrs[i] == mdPrefix+checksums.MetadataKey {
+			continue
+		}
 		if strings.HasPrefix(attrs[i], "user.oc.") {
 			var d []byte
 			if d, err = xattr.Get(s, attrs[i]); err != nil {
@@ -1315,6 +1413,15 @@ func (fs *ocfs) copyMD(s string, t string) (err error) {
 	return nil
 }
 
+// ListChanges returns the changes below the folder recorded in the journal.
+func (fs *ocfs) ListChanges(ctx context.Context, ref *provider.Reference, token string) ([]*storage.Change, string, error) {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error resolving ref")
+	}
+	return fs.journal.Changes(np, token)
+}
+
 func (fs *ocfs) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
 	np, err := fs.resolve(ctx, ref)
 	if err != nil {
@@ -1342,6 +1449,9 @@ func (fs *ocfs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*
 	revisions := []*provider.FileVersion{}
 	mds, err := ioutil.ReadDir(path.Dir(vp))
 	if err != nil {
+		if os.IsNotExist(err) {
+			return revisions, nil
+		}
 		return nil, errors.Wrap(err, "ocfs: error reading"+path.Dir(vp))
 	}
 	for i := range mds {
@@ -1355,7 +1465,7 @@ func (fs *ocfs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*
 }
 
 func (fs *ocfs) filterAsRevision(ctx context.Context, bn string, md os.FileInfo) *provider.FileVersion {
-	if strings.HasPrefix(md.Name(), bn) {
+	if strings.HasPrefix(md.Name(), bn+".v") {
 		// versions have filename.ext.v12345678
 		version := md.Name()[len(bn)+2:] // truncate "<base filename>.v" to get version mtime
 		mtime, err := strconv.Atoi(version)
@@ -1374,26 +1484,51 @@ func (fs *ocfs) filterAsRevision(ctx context.Context, bn string, md os.FileInfo)
 	return nil
 }
 
-func (fs *ocfs) DownloadRevision(ctx context.Context, ref *provider.Reference, revisionKey string) (io.ReadCloser, error) {
-	return nil, errtypes.NotSupported("download revision")
-}
+// resolveRevision returns the path of the file and of its revision with the given key.
+func (fs *ocfs) resolveRevision(ctx context.Context, ref *provider.Reference, revisionKey string) (string, string, error) {
+	// versions are identified by their mtime, reject anything else
+	if _, err := strconv.ParseUint(revisionKey, 10, 64); err != nil {
+		return "", "", errtypes.NotFound(revisionKey)
+	}
 
-func (fs *ocfs) RestoreRevision(ctx context.Context, ref *provider.Reference, revisionKey string) error {
 	np, err := fs.resolve(ctx, ref)
 	if err != nil {
-		return errors.Wrap(err, "ocfs: error resolving reference")
+		return "", "", errors.Wrap(err, "ocfs: error resolving reference")
 	}
-	vp := fs.getVersionsPath(ctx, np)
-	rp := vp + ".v" + revisionKey
+	rp := fs.getVersionsPath(ctx, np) + ".v" + revisionKey
 
 	// check revision exists
 	rs, err := os.Stat(rp)
 	if err != nil {
-		return err
+		if os.IsNotExist(err) {
+			return "", "", errtypes.NotFound(revisionKey)
+		}
+		return "", "", errors.Wrap(err, "ocfs: error stating revision "+rp)
 	}
 
 	if !rs.Mode().IsRegular() {
-		return fmt.Errorf("%s is not a regular file", rp)
+		return "", "", fmt.Errorf("%s is not a regular file", rp)
+	}
+	return np, rp, nil
+}
+
+func (fs *ocfs) DownloadRevision(ctx context.Context, ref *provider.Reference, revisionKey string) (io.ReadCloser, error) {
+	_, rp, err := fs.resolveRevision(ctx, ref, revisionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := os.Open(rp)
+	if err != nil {
+		return nil, errors.Wrap(err, "ocfs: error reading revision "+rp)
+	}
+	return r, nil
+}
+
+func (fs *ocfs) RestoreRevision(ctx context.Context, ref *provider.Reference, revisionKey string) error {
+	np, rp, err := fs.resolveRevision(ctx, ref, revisionKey)
+	if err != nil {
+		return err
 	}
 
 	source, err := os.Open(rp)
@@ -1416,7 +1551,12 @@ func (fs *ocfs) RestoreRevision(ctx context.Context, ref *provider.Reference, re
 
 	_, err = io.Copy(destination, source)
 	// TODO(jfd) bring back revision in case sth goes wrong?
-	return err
+	if err != nil {
+		return err
+	}
+	fs.propagate(ctx, np)
+	fs.journal.Record(np, false)
+	return nil
 }
 
 func (fs *ocfs) PurgeRecycleItem(ctx context.Context, key string) error {
@@ -1555,6 +1695,11 @@ func (fs *ocfs) RestoreRecycleItem(ctx context.Context, key string) error {
 		// just a warning, will be overwritten next time it is deleted
 		log.Warn().Err(err).Str("path", tgt).Msg("could not unset origin")
 	}
+	if err := fs.cacheIDs(ctx, tgt); err != nil {
+		log.Error().Err(err).Str("path", tgt).Msg("could not cache ids")
+	}
+	fs.propagate(ctx, tgt)
+	fs.journal.Record(tgt, false)
 	// TODO(jfd) restore versions
 	return nil
 }
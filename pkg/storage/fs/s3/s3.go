@@ -41,6 +41,7 @@ import (
 	"github.com/cs3org/reva/pkg/mime"
 	"github.com/cs3org/reva/pkg/storage"
 	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/user"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 )
@@ -56,6 +57,28 @@ type config struct {
 	Endpoint  string `mapstructure:"endpoint"`
 	Bucket    string `mapstructure:"bucket"`
 	Prefix    string `mapstructure:"prefix"`
+	// Quota is the quota in bytes of the prefix, 0 means no quota.
+	Quota int `mapstructure:"quota"`
+	// SSE is the server-side encryption of the objects written, either
+	// AES256 or aws:kms, none if empty.
+	SSE string `mapstructure:"sse"`
+	// SSEKMSKeyID is the KMS key the objects are encrypted with when SSE is
+	// aws:kms, the default key of the bucket if empty.
+	SSEKMSKeyID string `mapstructure:"sse_kms_key_id"`
+	// SSEKMSContext is the base64 encoded JSON encryption context passed
+	// to KMS.
+	SSEKMSContext string `mapstructure:"sse_kms_context"`
+	// PartSize is the size in bytes of the parts of the multipart uploads,
+	// at least 5 MiB. It is raised for the large files of known size to stay
+	// within the limit of parts.
+	PartSize int64 `mapstructure:"part_size"`
+	// Concurrency is the number of parts uploaded at once, the uploads of
+	// unknown size buffer PartSize bytes in memory for each.
+	Concurrency int `mapstructure:"concurrency"`
+	// QuotaRefresh is the time in seconds after which the used bytes are
+	// listed again, for the changes made by other instances or outside
+	// reva. In between they are updated on every write and deletion.
+	QuotaRefresh int `mapstructure:"quota_refresh"`
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
@@ -64,6 +87,27 @@ func parseConfig(m map[string]interface{}) (*config, error) {
 		err = errors.Wrap(err, "error decoding conf")
 		return nil, err
 	}
+	switch c.SSE {
+	case "", s3.ServerSideEncryptionAes256:
+		if c.SSEKMSKeyID != "" || c.SSEKMSContext != "" {
+			return nil, errors.New("s3fs: sse_kms_key_id and sse_kms_context require sse aws:kms")
+		}
+	case s3.ServerSideEncryptionAwsKms:
+	default:
+		return nil, errors.New("s3fs: invalid sse: " + c.SSE)
+	}
+	if c.PartSize == 0 {
+		c.PartSize = s3manager.DefaultUploadPartSize
+	}
+	if c.PartSize < s3manager.MinUploadPartSize {
+		return nil, errors.New("s3fs: part_size must be at least 5 MiB")
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = s3manager.DefaultUploadConcurrency
+	}
+	if c.QuotaRefresh == 0 {
+		c.QuotaRefresh = 3600
+	}
 	return c, nil
 }
 
@@ -102,7 +146,27 @@ func New(m map[string]interface{}) (storage.FS, error) {
 
 	s3Client := s3.New(sess)
 
-	return &s3FS{client: s3Client, config: c}, nil
+	fs := &s3FS{client: s3Client, config: c}
+	fs.usage = newUsage(time.Duration(c.QuotaRefresh)*time.Second, func(ctx context.Context) (int64, error) {
+		return fs.prefixSize(ctx, strings.TrimSuffix(fs.addRoot("/"), "/")+"/")
+	})
+	return fs, nil
+}
+
+// sse returns the server-side encryption headers of the objects written,
+// nil for the ones not configured.
+func (fs *s3FS) sse() (sse, keyID, encContext *string) {
+	if fs.config.SSE == "" {
+		return nil, nil, nil
+	}
+	sse = aws.String(fs.config.SSE)
+	if fs.config.SSEKMSKeyID != "" {
+		keyID = aws.String(fs.config.SSEKMSKeyID)
+	}
+	if fs.config.SSEKMSContext != "" {
+		encContext = aws.String(fs.config.SSEKMSContext)
+	}
+	return sse, keyID, encContext
 }
 
 func (fs *s3FS) Shutdown(ctx context.Context) error {
@@ -140,6 +204,7 @@ func (fs *s3FS) removeRoot(np string) string {
 type s3FS struct {
 	client *s3.S3
 	config *config
+	usage  *usage
 }
 
 func (fs *s3FS) normalizeObject(ctx context.Context, o *s3.Object, fn string) *provider.ResourceInfo {
@@ -236,8 +301,50 @@ func (fs *s3FS) UpdateGrant(ctx context.Context, ref *provider.Reference, g *pro
 	return errtypes.NotSupported("s3: operation not supported")
 }
 
+// GetQuota returns the configured quota, or the quota of the account of the
+// user when it is smaller. The used bytes are the size of the objects under
+// the prefix as S3 has no notion of quota.
 func (fs *s3FS) GetQuota(ctx context.Context) (int, int, error) {
-	return 0, 0, nil
+	used, err := fs.usage.get(ctx)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "s3FS: error computing used bytes")
+	}
+	total := fs.config.Quota
+	if u, ok := user.ContextGetUser(ctx); ok {
+		if q := int(user.Quota(u)); q > 0 && (total == 0 || q < total) {
+			total = q
+		}
+	}
+	return total, int(used), nil
+}
+
+// prefixSize returns the size of the objects under the prefix.
+func (fs *s3FS) prefixSize(ctx context.Context, prefix string) (int64, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(fs.config.Bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	var size int64
+	err := fs.client.ListObjectsV2PagesWithContext(ctx, input, func(output *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range output.Contents {
+			size += aws.Int64Value(o.Size)
+		}
+		return true
+	})
+	return size, err
+}
+
+// objectSize returns the size of the object, 0 if there is none.
+func (fs *s3FS) objectSize(ctx context.Context, key string) int64 {
+	o, err := fs.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(fs.config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0
+	}
+	return aws.Int64Value(o.ContentLength)
 }
 
 func (fs *s3FS) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
@@ -271,6 +378,7 @@ func (fs *s3FS) CreateDir(ctx context.Context, fn string) error {
 		ContentType:   aws.String("application/octet-stream"),
 		ContentLength: aws.Int64(0),
 	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.SSEKMSEncryptionContext = fs.sse()
 
 	result, err := fs.client.PutObject(input)
 	if err != nil {
@@ -298,7 +406,7 @@ func (fs *s3FS) Delete(ctx context.Context, ref *provider.Reference) error {
 
 	// first we need to find out if fn is a dir or a file
 
-	_, err = fs.client.HeadObject(&s3.HeadObjectInput{
+	head, err := fs.client.HeadObject(&s3.HeadObjectInput{
 		Bucket: aws.String(fs.config.Bucket),
 		Key:    aws.String(fn),
 	})
@@ -312,6 +420,12 @@ func (fs *s3FS) Delete(ctx context.Context, ref *provider.Reference) error {
 			}
 		}
 		// it might be a directory, so we can batch delete the prefix + /
+		var size int64
+		if fs.usage.known() {
+			if size, err = fs.prefixSize(ctx, fn+"/"); err != nil {
+				return errors.Wrap(err, "s3fs: error computing size of "+fn)
+			}
+		}
 		iter := s3manager.NewDeleteListIterator(fs.client, &s3.ListObjectsInput{
 			Bucket: aws.String(fs.config.Bucket),
 			Prefix: aws.String(fn + "/"),
@@ -320,6 +434,7 @@ func (fs *s3FS) Delete(ctx context.Context, ref *provider.Reference) error {
 		if err := batcher.Delete(aws.BackgroundContext(), iter); err != nil {
 			return err
 		}
+		fs.usage.add(-size)
 		// ok, we are done
 		return nil
 	}
@@ -340,6 +455,7 @@ func (fs *s3FS) Delete(ctx context.Context, ref *provider.Reference) error {
 		}
 		return errors.Wrap(err, "s3fs: error deleting "+fn)
 	}
+	fs.usage.add(-aws.Int64Value(head.ContentLength))
 
 	log.Debug().Interface("result", result)
 	return nil
@@ -350,11 +466,15 @@ func (fs *s3FS) moveObject(ctx context.Context, oldKey string, newKey string) er
 	// Copy
 	// TODO double check CopyObject can deal with >5GB files.
 	// Docs say we need to use multipart upload: https://docs.aws.amazon.com/AmazonS3/latest/API/RESTObjectCOPY.html
-	_, err := fs.client.CopyObject(&s3.CopyObjectInput{
+	// the copy is encrypted again, it does not inherit the encryption of
+	// the source object
+	input := &s3.CopyObjectInput{
 		Bucket:     aws.String(fs.config.Bucket),
 		CopySource: aws.String("/" + fs.config.Bucket + oldKey),
 		Key:        aws.String(newKey),
-	})
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.SSEKMSEncryptionContext = fs.sse()
+	_, err := fs.client.CopyObject(input)
 	if aerr, ok := err.(awserr.Error); ok {
 		if aerr.Code() == s3.ErrCodeNoSuchBucket {
 			return errtypes.NotFound(oldKey)
@@ -440,11 +560,16 @@ func (fs *s3FS) Move(ctx context.Context, oldRef, newRef *provider.Reference) er
 		return nil
 	}
 
-	// move single object
+	// move single object, the object it replaces does not count anymore
+	var replaced int64
+	if fs.usage.known() {
+		replaced = fs.objectSize(ctx, newName)
+	}
 	err = fs.moveObject(ctx, fn, newName)
 	if err != nil {
 		return err
 	}
+	fs.usage.add(-replaced)
 	return nil
 }
 
@@ -555,12 +680,24 @@ func (fs *s3FS) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCl
 		return errors.Wrap(err, "error resolving ref")
 	}
 
+	// the overwritten object does not count anymore
+	var previous int64
+	if fs.usage.known() {
+		previous = fs.objectSize(ctx, fn)
+	}
+	body, size := sizedBody(r)
+
 	upParams := &s3manager.UploadInput{
 		Bucket: aws.String(fs.config.Bucket),
 		Key:    aws.String(fn),
-		Body:   r,
+		Body:   body,
 	}
-	uploader := s3manager.NewUploaderWithClient(fs.client)
+	upParams.ServerSideEncryption, upParams.SSEKMSKeyId, upParams.SSEKMSEncryptionContext = fs.sse()
+	// a seekable body is read in place, its size sets the part size
+	uploader := s3manager.NewUploaderWithClient(fs.client, func(u *s3manager.Uploader) {
+		u.PartSize = fs.config.PartSize
+		u.Concurrency = fs.config.Concurrency
+	})
 	result, err := uploader.Upload(upParams)
 
 	if err != nil {
@@ -572,12 +709,56 @@ func (fs *s3FS) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCl
 		}
 		return errors.Wrap(err, "s3fs: error creating object "+fn)
 	}
+	fs.usage.add(size() - previous)
 
 	log.Debug().Interface("result", result) // todo cache etag?
 	return nil
 }
 
+// sizedBody returns the body to upload and a function returning its size
+// once uploaded. The seekable bodies are passed as they are, for the
+// uploader to read them in place.
+func sizedBody(r io.Reader) (io.Reader, func() int64) {
+	if s, ok := r.(io.Seeker); ok {
+		if cur, err := s.Seek(0, io.SeekCurrent); err == nil {
+			if end, err := s.Seek(0, io.SeekEnd); err == nil {
+				if _, err := s.Seek(cur, io.SeekStart); err == nil {
+					return r, func() int64 { return end - cur }
+				}
+			}
+		}
+	}
+	c := &countingReader{r: r}
+	return c, func() int64 { return c.n }
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NeedsSeekableUpload implements storage.SeekableUploader, the multipart
+// uploads of a seekable body are sized after it.
+func (fs *s3FS) NeedsSeekableUpload() bool {
+	return true
+}
+
 func (fs *s3FS) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	return fs.getObject(ctx, ref, nil)
+}
+
+// DownloadRange does a ranged GET so only the requested bytes are transferred.
+func (fs *s3FS) DownloadRange(ctx context.Context, ref *provider.Reference, offset, length int64) (io.ReadCloser, error) {
+	return fs.getObject(ctx, ref, aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)))
+}
+
+func (fs *s3FS) getObject(ctx context.Context, ref *provider.Reference, rng *string) (io.ReadCloser, error) {
 	log := appctx.GetLogger(ctx)
 
 	fn, err := fs.resolve(ctx, ref)
@@ -591,6 +772,7 @@ func (fs *s3FS) Download(ctx context.Context, ref *provider.Reference) (io.ReadC
 	r, err := fs.client.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(fs.config.Bucket),
 		Key:    aws.String(fn),
+		Range:  rng,
 	})
 	if err != nil {
 		log.Error().Err(err)
@@ -606,6 +788,44 @@ func (fs *s3FS) Download(ctx context.Context, ref *provider.Reference) (io.ReadC
 	return r.Body, nil
 }
 
+// DownloadURL presigns a GET of the object.
+func (fs *s3FS) DownloadURL(ctx context.Context, ref *provider.Reference, ttl time.Duration) (string, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return "", errors.Wrap(err, "error resolving ref")
+	}
+	req, _ := fs.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(fs.config.Bucket),
+		Key:    aws.String(fn),
+	})
+	u, err := req.Presign(ttl)
+	if err != nil {
+		return "", errors.Wrap(err, "s3fs: error presigning download of "+fn)
+	}
+	return u, nil
+}
+
+// UploadURL presigns a PUT of the object. The encryption headers would have
+// to be sent by the clients, so the uploads with SSE are not presigned.
+func (fs *s3FS) UploadURL(ctx context.Context, ref *provider.Reference, ttl time.Duration) (string, error) {
+	if fs.config.SSE != "" {
+		return "", errtypes.NotSupported("s3fs: presigned uploads with sse")
+	}
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return "", errors.Wrap(err, "error resolving ref")
+	}
+	req, _ := fs.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(fs.config.Bucket),
+		Key:    aws.String(fn),
+	})
+	u, err := req.Presign(ttl)
+	if err != nil {
+		return "", errors.Wrap(err, "s3fs: error presigning upload of "+fn)
+	}
+	return u, nil
+}
+
 func (fs *s3FS) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
 	return nil, errtypes.NotSupported("list revisions")
 }
@@ -0,0 +1,152 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/conformance"
+)
+
+// TestConformance runs against the S3 server at REVA_TEST_S3_ENDPOINT, for
+// example the minio of pkg/storage/conformance/docker-compose.yml.
+func TestConformance(t *testing.T) {
+	endpoint := os.Getenv("REVA_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("REVA_TEST_S3_ENDPOINT not set")
+	}
+	conformance.Run(t, func(t *testing.T) (storage.FS, context.Context) {
+		fs, err := New(map[string]interface{}{
+			"endpoint":   endpoint,
+			"region":     getenv("REVA_TEST_S3_REGION", "us-east-1"),
+			"bucket":     getenv("REVA_TEST_S3_BUCKET", "reva"),
+			"access_key": getenv("REVA_TEST_S3_ACCESS_KEY", "reva"),
+			"secret_key": getenv("REVA_TEST_S3_SECRET_KEY", "reva-secret"),
+			"prefix":     fmt.Sprintf("conformance-%d", time.Now().UnixNano()),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fs, context.Background()
+	})
+}
+
+func TestPresignedURLs(t *testing.T) {
+	fs, err := New(map[string]interface{}{
+		"endpoint":   "localhost:9000",
+		"bucket":     "reva",
+		"access_key": "reva",
+		"secret_key": "reva-secret",
+		"prefix":     "data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: "/einstein/file.txt"}}
+	signer := fs.(storage.URLSigner)
+
+	u, err := signer.DownloadURL(ctx, ref, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u, "http://localhost:9000/reva/data/einstein/file.txt?") || !strings.Contains(u, "X-Amz-Expires=60") {
+		t.Errorf("unexpected download url %s", u)
+	}
+	if u, err = signer.UploadURL(ctx, ref, time.Minute); err != nil || !strings.Contains(u, "X-Amz-Signature=") {
+		t.Errorf("unexpected upload url %s, %v", u, err)
+	}
+
+	fs.(*s3FS).config.SSE = "AES256"
+	if _, err := signer.UploadURL(ctx, ref, time.Minute); err == nil {
+		t.Error("expected the uploads with sse not to be presigned")
+	}
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func TestUsage(t *testing.T) {
+	listed := int64(100)
+	lists := 0
+	u := newUsage(time.Hour, func(ctx context.Context) (int64, error) {
+		lists++
+		return listed, nil
+	})
+	ctx := context.Background()
+
+	if u.known() {
+		t.Fatal("usage known before listing")
+	}
+	// the updates before the first listing are part of it
+	u.add(50)
+	if used, _ := u.get(ctx); used != 100 {
+		t.Fatalf("expected 100 used bytes, got %d", used)
+	}
+
+	u.add(20)
+	u.add(-200)
+	if used, _ := u.get(ctx); used != 0 {
+		t.Fatalf("expected 0 used bytes, got %d", used)
+	}
+	u.add(30)
+	if used, _ := u.get(ctx); used != 30 {
+		t.Fatalf("expected 30 used bytes, got %d", used)
+	}
+	if lists != 1 {
+		t.Fatalf("expected 1 listing, got %d", lists)
+	}
+
+	u.refresh = 0
+	if used, _ := u.get(ctx); used != 100 || lists != 2 {
+		t.Fatalf("expected 100 used bytes after 2 listings, got %d after %d", used, lists)
+	}
+}
+
+func TestSizedBody(t *testing.T) {
+	r := strings.NewReader("0123456789")
+	if _, err := r.Seek(4, 0); err != nil {
+		t.Fatal(err)
+	}
+	body, size := sizedBody(r)
+	if body != r || size() != 6 {
+		t.Fatalf("expected the seekable reader of 6 bytes, got size %d", size())
+	}
+
+	body, size = sizedBody(bytes.NewBufferString("0123456789"))
+	if _, err := ioutil.ReadAll(body); err != nil {
+		t.Fatal(err)
+	}
+	if size() != 10 {
+		t.Fatalf("expected 10 bytes, got %d", size())
+	}
+}
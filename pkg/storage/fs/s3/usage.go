@@ -0,0 +1,97 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package s3
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// usage keeps the bytes used below the root. They are listed once, then
+// updated on every write and deletion made through this driver, and listed
+// again every refresh to catch up with the changes made by other instances
+// or outside reva.
+type usage struct {
+	refresh time.Duration
+	list    func(ctx context.Context) (int64, error)
+
+	mu      sync.Mutex
+	used    int64
+	listed  time.Time // zero until the first listing
+	listing bool
+	// pending are the updates made while listing, added to its result. The
+	// listing may already include some of them, the error is bounded by
+	// them and fixed by the next listing.
+	pending int64
+}
+
+func newUsage(refresh time.Duration, list func(ctx context.Context) (int64, error)) *usage {
+	return &usage{refresh: refresh, list: list}
+}
+
+// get returns the used bytes, listing them if they are not known or stale.
+// While a listing is running the other callers get the previous value.
+func (u *usage) get(ctx context.Context) (int64, error) {
+	u.mu.Lock()
+	fresh := !u.listed.IsZero() && time.Since(u.listed) < u.refresh
+	if fresh || (u.listing && !u.listed.IsZero()) {
+		used := u.used
+		u.mu.Unlock()
+		return used, nil
+	}
+	u.listing = true
+	u.pending = 0
+	u.mu.Unlock()
+
+	used, err := u.list(ctx)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.listing = false
+	if err != nil {
+		return 0, err
+	}
+	u.used = used + u.pending
+	if u.used < 0 {
+		u.used = 0
+	}
+	u.listed = time.Now()
+	return u.used, nil
+}
+
+// known tells if the used bytes were listed, the updates are lost otherwise.
+func (u *usage) known() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !u.listed.IsZero() || u.listing
+}
+
+// add adds delta to the used bytes.
+func (u *usage) add(delta int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.listing {
+		u.pending += delta
+	}
+	u.used += delta
+	if u.used < 0 {
+		u.used = 0
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package smb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// The access rights of the NT ACLs, see
+// https://docs.microsoft.com/en-us/windows/win32/fileio/file-access-rights-constants
+const (
+	fileReadData        = 0x00000001 // list the folder
+	fileWriteData       = 0x00000002 // add a file to the folder
+	fileAppendData      = 0x00000004 // add a subfolder to the folder
+	fileReadEA          = 0x00000008
+	fileWriteEA         = 0x00000010
+	fileExecute         = 0x00000020 // traverse the folder
+	fileDeleteChild     = 0x00000040
+	fileReadAttributes  = 0x00000080
+	fileWriteAttributes = 0x00000100
+	stdDelete           = 0x00010000
+	stdReadControl      = 0x00020000
+	stdWriteDAC         = 0x00040000
+	stdWriteOwner       = 0x00080000
+	stdSynchronize      = 0x00100000
+
+	rightsRead    = stdReadControl | stdSynchronize | fileReadData | fileReadAttributes | fileReadEA
+	rightsWrite   = stdReadControl | stdSynchronize | fileWriteData | fileAppendData | fileWriteAttributes | fileWriteEA
+	rightsExecute = stdReadControl | stdSynchronize | fileReadAttributes | fileExecute
+	rightsAll     = 0x001f01ff
+)
+
+// masks are the names smbcacls gives to the access masks, the standard
+// permissions and the letters of the special ones.
+var masks = map[string]uint32{
+	"READ":   rightsRead | fileExecute,
+	"CHANGE": rightsRead | fileExecute | rightsWrite | fileDeleteChild | stdDelete,
+	"FULL":   rightsAll,
+	"R":      rightsRead,
+	"W":      rightsWrite,
+	"X":      rightsExecute,
+	"D":      stdDelete,
+	"P":      stdWriteDAC,
+	"O":      stdWriteOwner,
+}
+
+// The flags of the ACEs.
+const (
+	aceObjectInherit    = 0x01
+	aceContainerInherit = 0x02
+	aceInherited        = 0x10
+)
+
+var aceFlags = map[string]uint32{
+	"OI": aceObjectInherit,
+	"CI": aceContainerInherit,
+	"NP": 0x04,
+	"IO": 0x08,
+	"I":  aceInherited,
+}
+
+// ace is an entry of an NT ACL, as printed and parsed by smbcacls:
+// ACL:<principal>:<ALLOWED|DENIED>/<flags>/<mask>.
+type ace struct {
+	principal string
+	denied    bool
+	flags     uint32
+	mask      uint32
+}
+
+// String returns the entry in the format of the arguments of smbcacls, with
+// numeric flags and mask which all the versions of smbcacls understand.
+func (a *ace) String() string {
+	t := "ALLOWED"
+	if a.denied {
+		t = "DENIED"
+	}
+	return fmt.Sprintf("ACL:%s:%s/%d/0x%08x", a.principal, t, a.flags, a.mask)
+}
+
+// parseACL parses the output of smbcacls, the owner and the entries of the
+// ACL.
+func parseACL(out string) (owner string, aces []*ace, err error) {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "OWNER:"):
+			owner = strings.TrimPrefix(line, "OWNER:")
+		case strings.HasPrefix(line, "ACL:"):
+			a, err := parseACE(line)
+			if err != nil {
+				return "", nil, err
+			}
+			aces = append(aces, a)
+		}
+	}
+	return owner, aces, nil
+}
+
+func parseACE(line string) (*ace, error) {
+	// the principal can contain colons, the type, flags and mask can not
+	s := strings.TrimPrefix(line, "ACL:")
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("smb: invalid ace %q", line)
+	}
+	fields := strings.Split(s[i+1:], "/")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("smb: invalid ace %q", line)
+	}
+
+	a := &ace{principal: s[:i]}
+	switch fields[0] {
+	case "ALLOWED", "0":
+	case "DENIED", "1":
+		a.denied = true
+	default:
+		return nil, fmt.Errorf("smb: unsupported ace type in %q", line)
+	}
+
+	for _, f := range strings.Split(fields[1], "|") {
+		if v, ok := aceFlags[f]; ok {
+			a.flags |= v
+			continue
+		}
+		v, err := strconv.ParseUint(f, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("smb: invalid ace flags in %q", line)
+		}
+		a.flags |= uint32(v)
+	}
+
+	mask, err := parseMask(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("smb: invalid ace mask in %q", line)
+	}
+	a.mask = mask
+	return a, nil
+}
+
+// parseMask parses a standard permission, letters of special permissions or
+// a number.
+func parseMask(s string) (uint32, error) {
+	if m, ok := masks[s]; ok {
+		return m, nil
+	}
+	if strings.HasPrefix(s, "0x") {
+		v, err := strconv.ParseUint(s, 0, 32)
+		return uint32(v), err
+	}
+	var mask uint32
+	for _, c := range s {
+		m, ok := masks[string(c)]
+		if !ok {
+			return 0, fmt.Errorf("smb: unknown permission %c", c)
+		}
+		mask |= m
+	}
+	return mask, nil
+}
+
+// getPermissionSet translates NT access rights into a CS3 permission set.
+func getPermissionSet(mask uint32) *provider.ResourcePermissions {
+	read := mask&fileReadData != 0
+	p := &provider.ResourcePermissions{
+		Stat:                 read || mask&fileReadAttributes != 0,
+		GetPath:              read || mask&fileReadAttributes != 0,
+		ListContainer:        read,
+		InitiateFileDownload: read,
+		GetQuota:             read,
+		ListGrants:           mask&stdReadControl != 0,
+		InitiateFileUpload:   mask&fileWriteData != 0,
+		CreateContainer:      mask&fileAppendData != 0,
+		Delete:               mask&stdDelete != 0,
+		Move:                 mask&stdDelete != 0,
+		AddGrant:             mask&stdWriteDAC != 0,
+		UpdateGrant:          mask&stdWriteDAC != 0,
+		RemoveGrant:          mask&stdWriteDAC != 0,
+	}
+	return p
+}
+
+// getMask translates a CS3 permission set into NT access rights, the
+// closest standard permission when there is one.
+func getMask(p *provider.ResourcePermissions) uint32 {
+	var mask uint32
+	if p.Stat || p.GetPath || p.ListContainer || p.InitiateFileDownload {
+		mask |= masks["READ"]
+	}
+	if p.InitiateFileUpload || p.CreateContainer || p.Move {
+		mask |= masks["READ"] | rightsWrite | fileDeleteChild
+	}
+	if p.Delete || p.Move {
+		mask |= stdDelete
+	}
+	if p.ListGrants {
+		mask |= stdReadControl
+	}
+	if p.AddGrant || p.UpdateGrant || p.RemoveGrant {
+		mask |= stdWriteDAC
+	}
+	if p.AddGrant && p.UpdateGrant && p.RemoveGrant && mask&masks["CHANGE"] == masks["CHANGE"] {
+		mask = rightsAll
+	}
+	return mask
+}
+
+// effectiveMask returns the access rights the entries grant to the
+// principals matched by match: the rights of the allowed entries without the
+// denied ones.
+func effectiveMask(aces []*ace, match func(principal string) bool) uint32 {
+	var allowed, denied uint32
+	for _, a := range aces {
+		if !match(a.principal) {
+			continue
+		}
+		if a.denied {
+			denied |= a.mask
+		} else {
+			allowed |= a.mask
+		}
+	}
+	return allowed &^ denied
+}
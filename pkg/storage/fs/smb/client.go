@@ -0,0 +1,321 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package smb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/templates"
+	"github.com/pkg/errors"
+)
+
+// The driver executes the commands of the Samba client tools: smbclient for
+// the files, smbcacls for the NT ACLs and rpcclient to resolve the
+// principals. The tools follow the DFS referrals of the server, so the share
+// can be a DFS namespace spanning several file servers.
+
+var (
+	// ntStatusRegex matches the NT status codes of the errors printed by
+	// the tools, e.g. "NT_STATUS_NO_SUCH_FILE listing \foo" or
+	// "session setup failed: NT_STATUS_LOGON_FAILURE". The entries of
+	// listings are indented, so file names are not matched.
+	ntStatusRegex = regexp.MustCompile(`(?m)(?:^|: )(NT_STATUS_[A-Z0-9_]+)`)
+	// entryRegex matches an entry of a smbclient listing, e.g.
+	// "  report.pdf                          A    41300  Mon Mar  1 10:00:00 2021".
+	entryRegex = regexp.MustCompile(`^  (.+?)\s+([A-Z]*)\s+(\d+)\s+(\w{3} \w{3} [ \d]\d \d\d:\d\d:\d\d \d{4})$`)
+	// diskRegex matches the disk usage printed after a listing.
+	diskRegex = regexp.MustCompile(`(\d+) blocks of size (\d+)\. (\d+) blocks available`)
+	// lookupRegex matches a principal resolved by rpcclient lookupnames, e.g.
+	// "EXAMPLE\einstein S-1-5-21-1-2-3-1104 (User: 1)".
+	lookupRegex = regexp.MustCompile(`^(.+) (S-1-[\d-]+) \(([^:]*): (\d+)\)$`)
+)
+
+// The SID types of the principals that are users or groups.
+const (
+	sidTypeUser     = 1
+	sidTypeDomGroup = 2
+	sidTypeAlias    = 4
+	sidTypeWknGroup = 5
+)
+
+// entry is a file or a folder listed by smbclient.
+type entry struct {
+	name  string
+	isDir bool
+	size  uint64
+	mtime time.Time
+}
+
+// parseListing parses the output of the smbclient ls command, and the disk
+// usage in bytes reported after it.
+func parseListing(out string) (entries []*entry, total, used uint64) {
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if m := entryRegex.FindStringSubmatch(line); m != nil {
+			size, _ := strconv.ParseUint(m[3], 10, 64)
+			mtime, _ := time.ParseInLocation(time.ANSIC, m[4], time.Local)
+			entries = append(entries, &entry{
+				name:  m[1],
+				isDir: strings.Contains(m[2], "D"),
+				size:  size,
+				mtime: mtime,
+			})
+			continue
+		}
+		if m := diskRegex.FindStringSubmatch(line); m != nil {
+			blocks, _ := strconv.ParseUint(m[1], 10, 64)
+			size, _ := strconv.ParseUint(m[2], 10, 64)
+			available, _ := strconv.ParseUint(m[3], 10, 64)
+			total = blocks * size
+			used = (blocks - available) * size
+		}
+	}
+	return entries, total, used
+}
+
+// statusError maps the NT status printed in out to an error, nil if there
+// is none.
+func statusError(out, np string) error {
+	m := ntStatusRegex.FindStringSubmatch(out)
+	if m == nil {
+		return nil
+	}
+	switch m[1] {
+	case "NT_STATUS_OBJECT_NAME_NOT_FOUND", "NT_STATUS_OBJECT_PATH_NOT_FOUND",
+		"NT_STATUS_NO_SUCH_FILE", "NT_STATUS_NOT_FOUND":
+		return errtypes.NotFound(np)
+	case "NT_STATUS_OBJECT_NAME_COLLISION":
+		return errtypes.AlreadyExists(np)
+	case "NT_STATUS_ACCESS_DENIED", "NT_STATUS_LOGON_FAILURE", "NT_STATUS_WRONG_PASSWORD",
+		"NT_STATUS_ACCOUNT_DISABLED", "NT_STATUS_ACCOUNT_LOCKED_OUT":
+		return errtypes.PermissionDenied(np)
+	case "NT_STATUS_SHARING_VIOLATION", "NT_STATUS_FILE_LOCK_CONFLICT":
+		return errtypes.Locked(np)
+	}
+	return fmt.Errorf("smb: %s for %s", m[1], np)
+}
+
+// smbPath returns the path of np in the share, with backslashes. Double
+// quotes are not valid in NT names and would break the quoting of the
+// commands, so they are rejected with the other invalid characters. So are
+// the semicolons, which smbclient and rpcclient take as command separators
+// even inside quotes, the line breaks ending the commands and the
+// exclamation marks, which run a local shell at the start of a command.
+func smbPath(np string) (string, error) {
+	np = path.Join("/", np)
+	if strings.ContainsAny(np, "\"\\:*?<>|;!\r\n") {
+		return "", fmt.Errorf("smb: invalid character in %s", np)
+	}
+	return strings.Replace(np, "/", `\`, -1), nil
+}
+
+// credentials returns the arguments and the environment authenticating the
+// commands as the user in ctx.
+func (fs *smbfs) credentials(ctx context.Context) (args, env []string, err error) {
+	switch fs.c.Auth {
+	case "basic":
+		username := fs.c.Username
+		if strings.Contains(username, "{{") {
+			u, err := getUser(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			username = templates.WithUser(u, username)
+		}
+		return fs.passwordArgs(username), []string{"PASSWD=" + fs.c.Password}, nil
+	case "file":
+		u, err := getUser(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		creds, ok := fs.creds[u.Username]
+		if !ok {
+			return nil, nil, errtypes.PermissionDenied("smb: no credentials for " + u.Username)
+		}
+		return fs.passwordArgs(creds.Username), []string{"PASSWD=" + creds.Password}, nil
+	case "kerberos":
+		u, err := getUser(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		ccache := templates.WithUser(u, fs.c.CCache)
+		if fs.c.Keytab != "" {
+			if err := fs.delegate(ctx, u.Username, ccache); err != nil {
+				return nil, nil, err
+			}
+		}
+		return []string{"--use-kerberos=required"}, []string{"KRB5CCNAME=FILE:" + ccache}, nil
+	}
+	return []string{"--no-pass"}, nil, nil
+}
+
+func (fs *smbfs) passwordArgs(username string) []string {
+	args := []string{"--user=" + username}
+	if fs.c.Domain != "" {
+		args = append(args, "--workgroup="+fs.c.Domain)
+	}
+	return args
+}
+
+// delegate obtains a ticket of the user for the SMB server by Kerberos
+// constrained delegation: a ticket of the user for the reva service is
+// requested with S4U2Self and exchanged for one for the cifs service with
+// S4U2Proxy. The tickets are stored in the credential cache of the user and
+// renewed after delegation_ttl seconds.
+func (fs *smbfs) delegate(ctx context.Context, username, ccache string) error {
+	fs.ticketsMu.Lock()
+	defer fs.ticketsMu.Unlock()
+
+	if t, ok := fs.tickets[username]; ok && time.Since(t) < time.Duration(fs.c.DelegationTTL)*time.Second {
+		return nil
+	}
+
+	env := []string{"KRB5CCNAME=FILE:" + fs.c.ServiceCCache}
+	kinit := exec.CommandContext(ctx, fs.c.KinitBinary, "-f", "-k", "-t", fs.c.Keytab, fs.c.ServicePrincipal)
+	if _, err := fs.execute(ctx, kinit, env, fs.c.ServicePrincipal); err != nil {
+		return errors.Wrap(err, "smb: error getting the ticket of the service")
+	}
+
+	principal := username
+	if fs.c.Realm != "" {
+		principal += "@" + fs.c.Realm
+	}
+	kvno := exec.CommandContext(ctx, fs.c.KvnoBinary, "-U", principal, "-P", "--out-cache", "FILE:"+ccache, "cifs/"+fs.c.Server)
+	if _, err := fs.execute(ctx, kvno, env, principal); err != nil {
+		return errors.Wrap(err, "smb: error delegating the credentials of "+principal)
+	}
+
+	fs.tickets[username] = time.Now()
+	return nil
+}
+
+// smbPrompt is the prompt of smbclient in the root of the share.
+const smbPrompt = `smb: \> `
+
+// execute runs cmd with the environment env and returns its output. The
+// errors printed by the Samba tools are mapped to the error types for np.
+func (fs *smbfs) execute(ctx context.Context, cmd *exec.Cmd, env []string, np string) (string, error) {
+	log := appctx.GetLogger(ctx)
+
+	outBuf := &bytes.Buffer{}
+	cmd.Stdout = outBuf
+	cmd.Stderr = outBuf
+	cmd.Env = append([]string{"LC_ALL=C"}, env...)
+
+	// the environment holds the passwords, it is not logged
+	log.Debug().Str("args", fmt.Sprintf("%s", cmd.Args)).Msg("smb: executing command")
+	err := cmd.Run()
+	// smbclient prints its prompt before reading every command
+	out := strings.Replace(outBuf.String(), smbPrompt, "", -1)
+
+	// smbclient does not always exit with an error when a command fails
+	if serr := statusError(out, np); serr != nil {
+		return out, serr
+	}
+	if err != nil {
+		return out, errors.Wrapf(err, "smb: error executing %s: %s", cmd.Path, strings.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// smbclient runs the smbclient commands in the share as the user in ctx.
+// The commands are written one per line on the standard input, as
+// --command splits them on every semicolon. The commands must not contain
+// line breaks, the paths are checked by smbPath.
+func (fs *smbfs) smbclient(ctx context.Context, np string, commands ...string) (string, error) {
+	for _, c := range commands {
+		if strings.ContainsAny(c, "\r\n") {
+			return "", fmt.Errorf("smb: invalid command for %s", np)
+		}
+	}
+	args, env, err := fs.credentials(ctx)
+	if err != nil {
+		return "", err
+	}
+	args = append(args, fs.protocolArgs()...)
+	args = append(args, fs.service())
+	cmd := exec.CommandContext(ctx, fs.c.SMBClientBinary, args...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	return fs.execute(ctx, cmd, env, np)
+}
+
+// smbcacls runs smbcacls on the file at sp as the user in ctx, with the
+// extra arguments extra.
+func (fs *smbfs) smbcacls(ctx context.Context, np, sp string, extra ...string) (string, error) {
+	args, env, err := fs.credentials(ctx)
+	if err != nil {
+		return "", err
+	}
+	args = append(args, fs.protocolArgs()...)
+	args = append(args, fs.service(), sp)
+	args = append(args, extra...)
+	return fs.execute(ctx, exec.CommandContext(ctx, fs.c.SMBCACLsBinary, args...), env, np)
+}
+
+// lookupTypes returns the SID types of the principals, resolved by the
+// server with rpcclient.
+func (fs *smbfs) lookupTypes(ctx context.Context, principals []string) (map[string]int, error) {
+	args, env, err := fs.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	quoted := make([]string, 0, len(principals))
+	for _, p := range principals {
+		// rpcclient splits the commands on the semicolons, even quoted
+		if strings.ContainsAny(p, "\";\r\n") {
+			return nil, fmt.Errorf("smb: invalid principal %q", p)
+		}
+		quoted = append(quoted, `"`+p+`"`)
+	}
+	args = append(args, fs.c.Server, "--command", "lookupnames "+strings.Join(quoted, " "))
+	out, err := fs.execute(ctx, exec.CommandContext(ctx, fs.c.RPCClientBinary, args...), env, strings.Join(principals, ", "))
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]int, len(principals))
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		if m := lookupRegex.FindStringSubmatch(strings.TrimSpace(s.Text())); m != nil {
+			t, _ := strconv.Atoi(m[4])
+			types[strings.ToLower(m[1])] = t
+		}
+	}
+	return types, nil
+}
+
+func (fs *smbfs) service() string {
+	return "//" + fs.c.Server + "/" + fs.c.Share
+}
+
+func (fs *smbfs) protocolArgs() []string {
+	return []string{"--option=client max protocol=" + fs.c.MaxProtocol}
+}
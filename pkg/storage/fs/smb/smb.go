@@ -0,0 +1,796 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package smb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/mime"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/storage/templates"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("smb", New)
+}
+
+type config struct {
+	// Server is the SMB server, or the domain of a DFS namespace.
+	Server string `mapstructure:"server"`
+	// Share is the share, or the root of the DFS namespace.
+	Share string `mapstructure:"share"`
+	// Domain is the NT domain of the users and of the groups of the
+	// grants.
+	Domain     string `mapstructure:"domain"`
+	EnableHome bool   `mapstructure:"enable_home"`
+	UserLayout string `mapstructure:"user_layout"`
+	// Auth selects the credentials the server is accessed with: "basic"
+	// uses username and password, the username can be a user template,
+	// "file" the credentials of the user found in the credentials file and
+	// "kerberos" the Kerberos tickets of the user in the ccache. Empty
+	// accesses the server as guest.
+	Auth            string `mapstructure:"auth"`
+	Username        string `mapstructure:"username"`
+	Password        string `mapstructure:"password"`
+	CredentialsFile string `mapstructure:"credentials_file"`
+	// CCache is the template of the credential cache of the users, e.g.
+	// /var/lib/reva/krb5cc/{{.Username}}.
+	CCache string `mapstructure:"ccache"`
+	// Keytab holds the keys of the service principal allowed to delegate
+	// to the cifs service of the server. When set, the tickets of the users
+	// are obtained by constrained delegation, otherwise they must be put in
+	// the ccache of the users beforehand.
+	Keytab           string `mapstructure:"keytab"`
+	ServicePrincipal string `mapstructure:"service_principal"`
+	ServiceCCache    string `mapstructure:"service_ccache"`
+	// Realm is the Kerberos realm of the users.
+	Realm string `mapstructure:"realm"`
+	// DelegationTTL is the time in seconds after which the tickets of the
+	// users are delegated again.
+	DelegationTTL int `mapstructure:"delegation_ttl"`
+	// ACLPermissions computes the permissions of the users on the files from
+	// their NT ACLs, which costs a call to the server for every file.
+	// Otherwise the server enforces them but all the operations are shown.
+	ACLPermissions bool `mapstructure:"acl_permissions"`
+	// MaxProtocol is the highest SMB protocol version negotiated.
+	MaxProtocol     string `mapstructure:"max_protocol"`
+	SMBClientBinary string `mapstructure:"smbclient_binary"`
+	SMBCACLsBinary  string `mapstructure:"smbcacls_binary"`
+	RPCClientBinary string `mapstructure:"rpcclient_binary"`
+	KinitBinary     string `mapstructure:"kinit_binary"`
+	KvnoBinary      string `mapstructure:"kvno_binary"`
+}
+
+func (c *config) init() {
+	if c.UserLayout == "" {
+		c.UserLayout = "{{.Username}}"
+	}
+	if c.MaxProtocol == "" {
+		c.MaxProtocol = "SMB3"
+	}
+	if c.ServiceCCache == "" {
+		c.ServiceCCache = path.Join(os.TempDir(), "reva-smb-krb5cc")
+	}
+	if c.DelegationTTL == 0 {
+		c.DelegationTTL = 3600
+	}
+	if c.SMBClientBinary == "" {
+		c.SMBClientBinary = "/usr/bin/smbclient"
+	}
+	if c.SMBCACLsBinary == "" {
+		c.SMBCACLsBinary = "/usr/bin/smbcacls"
+	}
+	if c.RPCClientBinary == "" {
+		c.RPCClientBinary = "/usr/bin/rpcclient"
+	}
+	if c.KinitBinary == "" {
+		c.KinitBinary = "/usr/bin/kinit"
+	}
+	if c.KvnoBinary == "" {
+		c.KvnoBinary = "/usr/bin/kvno"
+	}
+}
+
+// credentials are the SMB credentials of a user in the credentials file,
+// keyed by the reva username.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type smbfs struct {
+	c     *config
+	creds map[string]credentials
+
+	// tickets are the times the tickets of the users were delegated.
+	ticketsMu sync.Mutex
+	tickets   map[string]time.Time
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns an implementation of the storage.FS interface that accesses a
+// share of a Windows or Samba file server with the Samba client tools, as
+// the user logged in to reva. The grants are NT ACLs. File ids are derived
+// from the paths.
+func New(m map[string]interface{}) (storage.FS, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.init()
+
+	if c.Server == "" || c.Share == "" {
+		return nil, errors.New("smb: server and share must be set")
+	}
+
+	fs := &smbfs{c: c, tickets: map[string]time.Time{}}
+
+	switch c.Auth {
+	case "", "basic":
+	case "file":
+		b, err := ioutil.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "smb: error reading credentials file")
+		}
+		if err := json.Unmarshal(b, &fs.creds); err != nil {
+			return nil, errors.Wrap(err, "smb: error decoding credentials file")
+		}
+	case "kerberos":
+		if c.CCache == "" {
+			return nil, errors.New("smb: ccache is not set")
+		}
+		if c.Keytab != "" && c.ServicePrincipal == "" {
+			return nil, errors.New("smb: service_principal is not set")
+		}
+	default:
+		return nil, errors.New("smb: unknown auth: " + c.Auth)
+	}
+
+	return fs, nil
+}
+
+func (fs *smbfs) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func getUser(ctx context.Context) (*userpb.User, error) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		err := errors.Wrap(errtypes.UserRequired(""), "smb: error getting user from ctx")
+		return nil, err
+	}
+	return u, nil
+}
+
+func (fs *smbfs) wrap(ctx context.Context, p string) (string, error) {
+	if fs.c.EnableHome {
+		home, err := fs.GetHome(ctx)
+		if err != nil {
+			return "", err
+		}
+		return path.Join("/", home, p), nil
+	}
+	return path.Join("/", p), nil
+}
+
+func (fs *smbfs) unwrap(ctx context.Context, np string) (string, error) {
+	root, err := fs.wrap(ctx, "/")
+	if err != nil {
+		return "", err
+	}
+	if np != root && !strings.HasPrefix(np, strings.TrimSuffix(root, "/")+"/") {
+		return "", fmt.Errorf("smb: %s is outside of %s", np, root)
+	}
+	return path.Join("/", strings.TrimPrefix(np, root)), nil
+}
+
+func (fs *smbfs) resolve(ctx context.Context, ref *provider.Reference) (string, error) {
+	if ref.GetPath() != "" {
+		return fs.wrap(ctx, ref.GetPath())
+	}
+
+	if ref.GetId() != nil {
+		return fs.wrap(ctx, path.Join("/", strings.TrimPrefix(ref.GetId().OpaqueId, "fileid-")))
+	}
+
+	// reference is invalid
+	return "", fmt.Errorf("smb: invalid reference %+v", ref)
+}
+
+// list lists the entries of the folder np matching mask, a name or * for
+// all of them, and returns the disk usage reported with them.
+func (fs *smbfs) list(ctx context.Context, np, mask string) ([]*entry, uint64, uint64, error) {
+	sp, err := smbPath(np)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if mask != "*" {
+		if _, err := smbPath(mask); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	out, err := fs.smbclient(ctx, np, fmt.Sprintf(`ls "%s"`, strings.TrimSuffix(sp, `\`)+`\`+mask))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	entries, total, used := parseListing(out)
+	return entries, total, used, nil
+}
+
+// stat returns the entry of np. The share root is not listed by its name
+// but as the . entry of its content.
+func (fs *smbfs) stat(ctx context.Context, np string) (*entry, error) {
+	dir, name, mask := path.Dir(np), path.Base(np), path.Base(np)
+	if np == "/" {
+		name, mask = ".", "*"
+	}
+	entries, _, _, err := fs.list(ctx, dir, mask)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.name, name) {
+			return e, nil
+		}
+	}
+	return nil, errtypes.NotFound(np)
+}
+
+func (fs *smbfs) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "smb: error resolving ref")
+	}
+	e, err := fs.stat(ctx, np)
+	if err != nil {
+		return nil, err
+	}
+	return fs.resourceInfo(ctx, np, e)
+}
+
+func (fs *smbfs) ListFolder(ctx context.Context, ref *provider.Reference) ([]*provider.ResourceInfo, error) {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "smb: error resolving ref")
+	}
+	entries, _, _, err := fs.list(ctx, np, "*")
+	if err != nil {
+		return nil, err
+	}
+
+	finfos := []*provider.ResourceInfo{}
+	for _, e := range entries {
+		if e.name == "." || e.name == ".." {
+			continue
+		}
+		ri, err := fs.resourceInfo(ctx, path.Join(np, e.name), e)
+		if err != nil {
+			return nil, err
+		}
+		finfos = append(finfos, ri)
+	}
+	return finfos, nil
+}
+
+func (fs *smbfs) resourceInfo(ctx context.Context, np string, e *entry) (*provider.ResourceInfo, error) {
+	fn, err := fs.unwrap(ctx, np)
+	if err != nil {
+		return nil, err
+	}
+	t := provider.ResourceType_RESOURCE_TYPE_FILE
+	if e.isDir {
+		t = provider.ResourceType_RESOURCE_TYPE_CONTAINER
+	}
+	ri := &provider.ResourceInfo{
+		Id:            &provider.ResourceId{OpaqueId: "fileid-" + strings.TrimPrefix(fn, "/")},
+		Path:          fn,
+		Type:          t,
+		Etag:          fmt.Sprintf("%x-%x", e.mtime.UnixNano(), e.size),
+		MimeType:      mime.Detect(e.isDir, fn),
+		Size:          e.size,
+		PermissionSet: &provider.ResourcePermissions{ListContainer: true, CreateContainer: true},
+		Mtime:         &types.Timestamp{Seconds: uint64(e.mtime.Unix())},
+	}
+	if fs.c.ACLPermissions {
+		if ri.PermissionSet, err = fs.permissions(ctx, np); err != nil {
+			return nil, err
+		}
+	}
+	return ri, nil
+}
+
+// permissions returns the permissions of the user in ctx on np from its
+// NT ACL: the rights granted to the user, to its groups and to everyone.
+// The owner can always read and change the ACL.
+func (fs *smbfs) permissions(ctx context.Context, np string) (*provider.ResourcePermissions, error) {
+	u, err := getUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owner, aces, err := fs.getACL(ctx, np)
+	if err != nil {
+		return nil, err
+	}
+
+	isUser := func(principal string) bool {
+		name, ok := fs.name(principal)
+		return ok && strings.EqualFold(name, u.Username)
+	}
+	mask := effectiveMask(aces, func(principal string) bool {
+		switch strings.ToLower(principal) {
+		case "everyone", `nt authority\authenticated users`:
+			return true
+		}
+		if isUser(principal) {
+			return true
+		}
+		name, ok := fs.name(principal)
+		if !ok {
+			return false
+		}
+		for _, g := range u.Groups {
+			if strings.EqualFold(name, g) {
+				return true
+			}
+		}
+		return false
+	})
+	if isUser(owner) {
+		mask |= stdReadControl | stdWriteDAC
+	}
+	return getPermissionSet(mask), nil
+}
+
+// principal returns the NT principal of a user or a group.
+func (fs *smbfs) principal(name string) string {
+	if fs.c.Domain == "" {
+		return name
+	}
+	return fs.c.Domain + `\` + name
+}
+
+// name returns the name of the user or the group of an NT principal, false
+// for the principals of other domains and the built-in ones.
+func (fs *smbfs) name(principal string) (string, bool) {
+	i := strings.LastIndex(principal, `\`)
+	if i < 0 {
+		// well-known principals like Everyone or CREATOR OWNER
+		return "", false
+	}
+	domain, name := principal[:i], principal[i+1:]
+	if fs.c.Domain != "" {
+		return name, strings.EqualFold(domain, fs.c.Domain)
+	}
+	switch strings.ToUpper(domain) {
+	case "BUILTIN", "NT AUTHORITY":
+		return "", false
+	}
+	return name, true
+}
+
+func (fs *smbfs) CreateDir(ctx context.Context, fn string) error {
+	np, err := fs.wrap(ctx, fn)
+	if err != nil {
+		return err
+	}
+	return fs.mkdir(ctx, np)
+}
+
+func (fs *smbfs) mkdir(ctx context.Context, np string) error {
+	sp, err := smbPath(np)
+	if err != nil {
+		return err
+	}
+	_, err = fs.smbclient(ctx, np, fmt.Sprintf(`mkdir "%s"`, sp))
+	return err
+}
+
+func (fs *smbfs) Delete(ctx context.Context, ref *provider.Reference) error {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "smb: error resolving ref")
+	}
+	sp, err := smbPath(np)
+	if err != nil {
+		return err
+	}
+	// deltree removes files as well as folders with their content
+	_, err = fs.smbclient(ctx, np, fmt.Sprintf(`deltree "%s"`, sp))
+	return err
+}
+
+func (fs *smbfs) Move(ctx context.Context, oldRef, newRef *provider.Reference) error {
+	oldName, err := fs.resolve(ctx, oldRef)
+	if err != nil {
+		return errors.Wrap(err, "smb: error resolving ref")
+	}
+	newName, err := fs.resolve(ctx, newRef)
+	if err != nil {
+		return errors.Wrap(err, "smb: error resolving ref")
+	}
+	oldPath, err := smbPath(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := smbPath(newName)
+	if err != nil {
+		return err
+	}
+	_, err = fs.smbclient(ctx, oldName, fmt.Sprintf(`rename "%s" "%s"`, oldPath, newPath))
+	return err
+}
+
+func (fs *smbfs) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	defer r.Close()
+
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "smb: error resolving ref")
+	}
+	sp, err := smbPath(np)
+	if err != nil {
+		return err
+	}
+
+	// smbclient uploads local files only
+	tmp, err := ioutil.TempFile("", "reva-smb-upload-")
+	if err != nil {
+		return errors.Wrap(err, "smb: error creating tmp file")
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "smb: error writing tmp file")
+	}
+
+	_, err = fs.smbclient(ctx, np, fmt.Sprintf(`put "%s" "%s"`, tmp.Name(), sp))
+	return err
+}
+
+// tmpFile is a downloaded file removed when closed.
+type tmpFile struct {
+	*os.File
+}
+
+func (f *tmpFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+func (fs *smbfs) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "smb: error resolving ref")
+	}
+	sp, err := smbPath(np)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile("", "reva-smb-download-")
+	if err != nil {
+		return nil, errors.Wrap(err, "smb: error creating tmp file")
+	}
+	tmp.Close()
+
+	if _, err := fs.smbclient(ctx, np, fmt.Sprintf(`get "%s" "%s"`, sp, tmp.Name())); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, errors.Wrap(err, "smb: error opening tmp file")
+	}
+	return &tmpFile{f}, nil
+}
+
+func (fs *smbfs) GetHome(ctx context.Context) (string, error) {
+	if !fs.c.EnableHome {
+		return "", errtypes.NotSupported("smb: get home not supported")
+	}
+
+	u, err := getUser(ctx)
+	if err != nil {
+		err = errors.Wrap(err, "smb: wrap: no user in ctx and home is enabled")
+		return "", err
+	}
+	return templates.WithUser(u, fs.c.UserLayout), nil
+}
+
+// CreateHome creates the folders of the home layout missing on the server.
+func (fs *smbfs) CreateHome(ctx context.Context) error {
+	home, err := fs.GetHome(ctx)
+	if err != nil {
+		return err
+	}
+
+	np := "/"
+	for _, seg := range strings.Split(strings.Trim(home, "/"), "/") {
+		np = path.Join(np, seg)
+		err := fs.mkdir(ctx, np)
+		if _, ok := err.(errtypes.IsAlreadyExists); ok {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "smb: error creating home dir "+np)
+		}
+	}
+	return nil
+}
+
+// GetQuota returns the size and the usage of the disk reported by the
+// server, which reflect the quota of the user when the server enforces
+// one.
+func (fs *smbfs) GetQuota(ctx context.Context) (int, int, error) {
+	np, err := fs.wrap(ctx, "/")
+	if err != nil {
+		return 0, 0, err
+	}
+	_, total, used, err := fs.list(ctx, np, "*")
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(total), int(used), nil
+}
+
+// GetPathByID returns the path pointed by the file id
+// In this implementation the file id is that path of the file without the first slash
+// thus the file id always points to the filename
+func (fs *smbfs) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
+	return path.Join("/", strings.TrimPrefix(id.OpaqueId, "fileid-")), nil
+}
+
+// getACL returns the owner and the NT ACL of np.
+func (fs *smbfs) getACL(ctx context.Context, np string) (string, []*ace, error) {
+	sp, err := smbPath(np)
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := fs.smbcacls(ctx, np, sp)
+	if err != nil {
+		return "", nil, err
+	}
+	return parseACL(out)
+}
+
+// getACE returns the entry of the grant, inherited by the content of the
+// folders. A grant without permissions denies all access.
+func (fs *smbfs) getACE(ctx context.Context, np string, g *provider.Grant) (*ace, error) {
+	switch g.Grantee.Type {
+	case provider.GranteeType_GRANTEE_TYPE_USER, provider.GranteeType_GRANTEE_TYPE_GROUP:
+	default:
+		return nil, errors.New("smb: no nt acl for grantee type: " + g.Grantee.Type.String())
+	}
+	a := &ace{principal: fs.principal(g.Grantee.Id.OpaqueId), mask: getMask(g.Permissions)}
+	if a.mask == 0 {
+		a.denied = true
+		a.mask = rightsAll
+	}
+	e, err := fs.stat(ctx, np)
+	if err != nil {
+		return nil, err
+	}
+	if e.isDir {
+		a.flags = aceObjectInherit | aceContainerInherit
+	}
+	return a, nil
+}
+
+func (fs *smbfs) AddGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "smb: error resolving ref")
+	}
+	a, err := fs.getACE(ctx, np, g)
+	if err != nil {
+		return err
+	}
+	sp, err := smbPath(np)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.smbcacls(ctx, np, sp, "--add", a.String()); err != nil {
+		return errors.Wrap(err, "smb: error adding acl")
+	}
+	return nil
+}
+
+// grantAces returns the entries of np set for the grantee, the inherited
+// ones belong to the parent folders.
+func (fs *smbfs) grantAces(ctx context.Context, np string, g *provider.Grantee) ([]*ace, error) {
+	_, aces, err := fs.getACL(ctx, np)
+	if err != nil {
+		return nil, err
+	}
+	var res []*ace
+	for _, a := range aces {
+		name, ok := fs.name(a.principal)
+		if ok && a.flags&aceInherited == 0 && strings.EqualFold(name, g.Id.OpaqueId) {
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+func (fs *smbfs) RemoveGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "smb: error resolving ref")
+	}
+	aces, err := fs.grantAces(ctx, np, g.Grantee)
+	if err != nil {
+		return err
+	}
+	if len(aces) == 0 {
+		return errtypes.NotFound("smb: no acl for " + g.Grantee.Id.OpaqueId)
+	}
+	sp, err := smbPath(np)
+	if err != nil {
+		return err
+	}
+	for _, a := range aces {
+		if _, err := fs.smbcacls(ctx, np, sp, "--delete", a.String()); err != nil {
+			return errors.Wrap(err, "smb: error removing acl")
+		}
+	}
+	return nil
+}
+
+func (fs *smbfs) UpdateGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	if err := fs.RemoveGrant(ctx, ref, g); err != nil {
+		return err
+	}
+	return fs.AddGrant(ctx, ref, g)
+}
+
+// ListGrants returns the grants of the entries set on np for users and
+// groups. The type of the principals is resolved by the server, the entries
+// of the principals it does not know as a user or a group are skipped.
+func (fs *smbfs) ListGrants(ctx context.Context, ref *provider.Reference) ([]*provider.Grant, error) {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "smb: error resolving ref")
+	}
+	_, aces, err := fs.getACL(ctx, np)
+	if err != nil {
+		return nil, err
+	}
+
+	var own []*ace
+	var principals []string
+	seen := map[string]bool{}
+	for _, a := range aces {
+		key := strings.ToLower(a.principal)
+		if _, ok := fs.name(a.principal); !ok || a.flags&aceInherited != 0 {
+			continue
+		}
+		own = append(own, a)
+		if !seen[key] {
+			seen[key] = true
+			principals = append(principals, a.principal)
+		}
+	}
+	if len(own) == 0 {
+		return []*provider.Grant{}, nil
+	}
+
+	sidTypes, err := fs.lookupTypes(ctx, principals)
+	if err != nil {
+		appctx.GetLogger(ctx).Warn().Err(err).Msg("smb: error resolving principals, the grants are listed as user grants")
+	}
+
+	grants := make([]*provider.Grant, 0, len(own))
+	for _, a := range own {
+		t := provider.GranteeType_GRANTEE_TYPE_USER
+		if sidTypes != nil {
+			switch sidTypes[strings.ToLower(a.principal)] {
+			case sidTypeUser:
+			case sidTypeDomGroup, sidTypeAlias, sidTypeWknGroup:
+				t = provider.GranteeType_GRANTEE_TYPE_GROUP
+			default:
+				continue
+			}
+		}
+		p := &provider.ResourcePermissions{}
+		if !a.denied {
+			p = getPermissionSet(a.mask)
+		}
+		name, _ := fs.name(a.principal)
+		grants = append(grants, &provider.Grant{
+			Grantee: &provider.Grantee{
+				Type: t,
+				Id:   &userpb.UserId{OpaqueId: name},
+			},
+			Permissions: p,
+		})
+	}
+	return grants, nil
+}
+
+func (fs *smbfs) CreateReference(ctx context.Context, path string, targetURI *url.URL) error {
+	return errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
+	return errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
+	return errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
+	return nil, errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) DownloadRevision(ctx context.Context, ref *provider.Reference, key string) (io.ReadCloser, error) {
+	return nil, errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) RestoreRevision(ctx context.Context, ref *provider.Reference, key string) error {
+	return errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
+	return nil, errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) RestoreRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) PurgeRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("smb: operation not supported")
+}
+
+func (fs *smbfs) EmptyRecycle(ctx context.Context) error {
+	return errtypes.NotSupported("smb: operation not supported")
+}
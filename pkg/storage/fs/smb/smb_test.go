@@ -0,0 +1,296 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package smb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/conformance"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+const listing = `  .                                   D        0  Mon Mar  1 10:00:00 2021
+  ..                                  D        0  Mon Mar  1 10:00:00 2021
+  Documents                           D        0  Tue Mar  2 11:30:00 2021
+  annual report.pdf                   A    41300  Wed Mar  3 09:15:42 2021
+
+		10485760 blocks of size 1024. 8388608 blocks available
+`
+
+func TestParseListing(t *testing.T) {
+	entries, total, used := parseListing(listing)
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+	if e := entries[2]; e.name != "Documents" || !e.isDir {
+		t.Errorf("got %+v, want the Documents folder", e)
+	}
+	e := entries[3]
+	if e.name != "annual report.pdf" || e.isDir || e.size != 41300 {
+		t.Errorf("got %+v, want the report file", e)
+	}
+	if e.mtime.Day() != 3 || e.mtime.Hour() != 9 || e.mtime.Second() != 42 {
+		t.Errorf("got mtime %v", e.mtime)
+	}
+	if total != 10737418240 || used != 2147483648 {
+		t.Errorf("got total %d and used %d", total, used)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		out   string
+		check func(error) bool
+	}{
+		{"NT_STATUS_NO_SUCH_FILE listing \\foo\n", func(err error) bool { _, ok := err.(errtypes.IsNotFound); return ok }},
+		{"NT_STATUS_OBJECT_NAME_COLLISION making remote directory \\foo\n", func(err error) bool { _, ok := err.(errtypes.IsAlreadyExists); return ok }},
+		{"session setup failed: NT_STATUS_LOGON_FAILURE\n", func(err error) bool { _, ok := err.(errtypes.IsPermissionDenied); return ok }},
+		{"NT_STATUS_SHARING_VIOLATION opening remote file \\foo\n", func(err error) bool { _, ok := err.(errtypes.IsLocked); return ok }},
+		{"NT_STATUS_DISK_FULL\n", func(err error) bool { return err != nil }},
+		{listing + "  NT_STATUS_NOTES.txt                 A       10  Mon Mar  1 10:00:00 2021\n", func(err error) bool { return err == nil }},
+	}
+	for _, tt := range tests {
+		if err := statusError(tt.out, "/foo"); !tt.check(err) {
+			t.Errorf("unexpected error %v for %q", err, tt.out)
+		}
+	}
+}
+
+func TestSMBPath(t *testing.T) {
+	if sp, err := smbPath("/Documents/a b.txt"); err != nil || sp != `\Documents\a b.txt` {
+		t.Errorf("got %q %v", sp, err)
+	}
+	if _, err := smbPath(`/a"; rm b`); err == nil {
+		t.Error("a path with double quotes was accepted")
+	}
+	for _, name := range []string{"/x;!sh -c 'id'", "/x\n!id", "/x\r!id", "/!id"} {
+		if _, err := smbPath(name); err == nil {
+			t.Errorf("the injected name %q was accepted", name)
+		}
+	}
+}
+
+func TestParseACL(t *testing.T) {
+	out := `REVISION:1
+CONTROL:SR|DI|DP
+OWNER:EXAMPLE\einstein
+GROUP:EXAMPLE\Domain Users
+ACL:EXAMPLE\einstein:ALLOWED/OI|CI/FULL
+ACL:EXAMPLE\physics:ALLOWED/OI|CI/CHANGE
+ACL:EXAMPLE\marie:DENIED/0x0/0x001f01ff
+ACL:EXAMPLE\richard:ALLOWED/OI|CI|I/READ
+ACL:Everyone:ALLOWED/0x0/RX
+`
+	owner, aces, err := parseACL(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != `EXAMPLE\einstein` || len(aces) != 5 {
+		t.Fatalf("got owner %q and %d entries", owner, len(aces))
+	}
+	if a := aces[1]; a.principal != `EXAMPLE\physics` || a.denied || a.flags != aceObjectInherit|aceContainerInherit || a.mask != masks["CHANGE"] {
+		t.Errorf("got %+v", a)
+	}
+	if a := aces[2]; !a.denied || a.mask != rightsAll {
+		t.Errorf("got %+v", a)
+	}
+	if a := aces[3]; a.flags&aceInherited == 0 {
+		t.Errorf("got %+v, want an inherited entry", a)
+	}
+	if a := aces[4]; a.mask != rightsRead|rightsExecute {
+		t.Errorf("got mask %x", a.mask)
+	}
+
+	// the entries are given back to smbcacls in the numeric form
+	if s := aces[1].String(); s != `ACL:EXAMPLE\physics:ALLOWED/3/0x001301ff` {
+		t.Errorf("got %q", s)
+	}
+	a, err := parseACE(aces[1].String())
+	if err != nil || *a != *aces[1] {
+		t.Errorf("got %+v %v", a, err)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	viewer := &provider.ResourcePermissions{Stat: true, ListContainer: true, InitiateFileDownload: true}
+	if m := getMask(viewer); m != masks["READ"] {
+		t.Errorf("got viewer mask %x", m)
+	}
+	p := getPermissionSet(masks["READ"])
+	if !p.Stat || !p.ListContainer || !p.InitiateFileDownload || p.InitiateFileUpload || p.Delete {
+		t.Errorf("got read permissions %+v", p)
+	}
+
+	editor := &provider.ResourcePermissions{
+		Stat: true, ListContainer: true, InitiateFileDownload: true,
+		InitiateFileUpload: true, CreateContainer: true, Delete: true, Move: true,
+	}
+	if m := getMask(editor); m != masks["CHANGE"] {
+		t.Errorf("got editor mask %x", m)
+	}
+	p = getPermissionSet(masks["CHANGE"])
+	if !p.InitiateFileUpload || !p.CreateContainer || !p.Delete || !p.Move || p.AddGrant {
+		t.Errorf("got change permissions %+v", p)
+	}
+
+	if m := getMask(getPermissionSet(rightsAll)); m != rightsAll {
+		t.Errorf("got full mask %x", m)
+	}
+
+	aces := []*ace{
+		{principal: `EXAMPLE\physics`, mask: masks["CHANGE"]},
+		{principal: `EXAMPLE\einstein`, denied: true, mask: stdDelete},
+		{principal: `EXAMPLE\marie`, mask: rightsAll},
+	}
+	m := effectiveMask(aces, func(p string) bool { return p != `EXAMPLE\marie` })
+	if m != masks["CHANGE"]&^stdDelete {
+		t.Errorf("got effective mask %x", m)
+	}
+}
+
+// TestFakeClient runs the driver against a script standing in for
+// smbclient, which records its arguments and prints a listing.
+func TestFakeClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reva-smb-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "smbclient")
+	if err := ioutil.WriteFile(filepath.Join(dir, "listing"), []byte(listing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the fake prints the prompt of smbclient like the real one
+	body := "#!/bin/sh\nprintf '%s\\n' \"$@\" \"PASSWD=$PASSWD\" > " + args + "\ncat >> " + args + "\nprintf 'smb: \\\\> '\ncat " + filepath.Join(dir, "listing") + "\nprintf 'smb: \\\\> '\n"
+	if err := ioutil.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := New(map[string]interface{}{
+		"server":           "files.example.org",
+		"share":            "homes",
+		"domain":           "EXAMPLE",
+		"enable_home":      true,
+		"auth":             "basic",
+		"username":         "{{.Username}}",
+		"password":         "secret",
+		"smbclient_binary": script,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := user.ContextSetUser(context.Background(), &userpb.User{Username: "einstein"})
+
+	ri, err := fs.GetMD(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: "/annual report.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Path != "/annual report.pdf" || ri.Size != 41300 || ri.Type != provider.ResourceType_RESOURCE_TYPE_FILE {
+		t.Errorf("got %+v", ri)
+	}
+	b, err := ioutil.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"--user=einstein\n", "--workgroup=EXAMPLE\n", "//files.example.org/homes\n",
+		`ls "\einstein\annual report.pdf"` + "\n", "PASSWD=secret\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in the arguments:\n%s", want, got)
+		}
+	}
+
+	infos, err := fs.ListFolder(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: "/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Path != "/Documents" || infos[0].Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		t.Errorf("got %v", infos)
+	}
+
+	total, used, err := fs.GetQuota(ctx)
+	if err != nil || total != 10737418240 || used != 2147483648 {
+		t.Errorf("got quota %d %d %v", total, used, err)
+	}
+
+	// the names that would inject commands are refused before smbclient runs
+	if err := os.Remove(args); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/x;!touch pwned", "/x\n!touch pwned"} {
+		if err := fs.CreateDir(ctx, name); err == nil {
+			t.Errorf("the injected name %q was accepted", name)
+		}
+	}
+	if _, err := os.Stat(args); !os.IsNotExist(err) {
+		t.Error("smbclient was run for an injected name")
+	}
+}
+
+// TestConformance runs against the share at REVA_TEST_SMB_SERVER, for
+// example the samba of pkg/storage/conformance/docker-compose.yml, with the
+// Samba client tools installed on the host.
+func TestConformance(t *testing.T) {
+	server := os.Getenv("REVA_TEST_SMB_SERVER")
+	if server == "" {
+		t.Skip("REVA_TEST_SMB_SERVER not set")
+	}
+	conformance.Run(t, func(t *testing.T) (storage.FS, context.Context) {
+		// every driver gets its own folder of the share as home
+		fs, err := New(map[string]interface{}{
+			"server":      server,
+			"share":       getenv("REVA_TEST_SMB_SHARE", "reva"),
+			"enable_home": true,
+			"user_layout": fmt.Sprintf("conformance-%d", time.Now().UnixNano()),
+			"auth":        "basic",
+			"username":    getenv("REVA_TEST_SMB_USERNAME", "reva"),
+			"password":    getenv("REVA_TEST_SMB_PASSWORD", "reva-secret"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := user.ContextSetUser(context.Background(), &userpb.User{Username: "reva"})
+		if err := fs.CreateHome(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return fs, ctx
+	})
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,576 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package spaces implements a storage driver serving the project spaces.
+// Every space is a folder at the root of a backing storage driver and the
+// operations are authorized with the role the user has in the space.
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/spaces"
+	spacesregistry "github.com/cs3org/reva/pkg/spaces/manager/registry"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("spaces", New)
+}
+
+type config struct {
+	// Driver is the storage driver holding the content of the spaces.
+	Driver        string                            `mapstructure:"driver"`
+	Drivers       map[string]map[string]interface{} `mapstructure:"drivers"`
+	SpacesManager string                            `mapstructure:"spaces_manager"`
+	// SpacesManagers holds the configuration of the spaces managers, the
+	// services administering the spaces must use the same configuration.
+	SpacesManagers map[string]map[string]interface{} `mapstructure:"spaces_managers"`
+	// AdminGroup is the group whose members manage every space.
+	AdminGroup string `mapstructure:"admin_group"`
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *config) init() {
+	if c.Driver == "" {
+		c.Driver = "local"
+	}
+	if c.SpacesManager == "" {
+		c.SpacesManager = "json"
+	}
+	if c.AdminGroup == "" {
+		c.AdminGroup = "admin"
+	}
+}
+
+type spacesfs struct {
+	c    *config
+	next storage.FS
+	sm   spaces.Manager
+}
+
+// uploadFS is returned when the backing driver supports resumable uploads.
+type uploadFS struct {
+	*spacesfs
+	uh storage.UploadHandler
+}
+
+// New returns a storage.FS serving the project spaces.
+func New(m map[string]interface{}) (storage.FS, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.init()
+
+	f, ok := registry.NewFuncs[c.Driver]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not found for spaces storage", c.Driver)
+	}
+	next, err := f(c.Drivers[c.Driver])
+	if err != nil {
+		return nil, errors.Wrap(err, "spaces: error creating the backing storage")
+	}
+
+	sf, ok := spacesregistry.NewFuncs[c.SpacesManager]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not found for spaces manager", c.SpacesManager)
+	}
+	sm, err := sf(c.SpacesManagers[c.SpacesManager])
+	if err != nil {
+		return nil, errors.Wrap(err, "spaces: error creating the spaces manager")
+	}
+
+	fs := &spacesfs{c: c, next: next, sm: sm}
+	if uh, ok := next.(storage.UploadHandler); ok {
+		return &uploadFS{spacesfs: fs, uh: uh}, nil
+	}
+	return fs, nil
+}
+
+// split returns the id of the space a path belongs to, empty for the root.
+func split(fn string) string {
+	fn = strings.TrimPrefix(path.Clean("/"+fn), "/")
+	if i := strings.Index(fn, "/"); i >= 0 {
+		return fn[:i]
+	}
+	return fn
+}
+
+func isSpaceRoot(fn string) bool {
+	fn = path.Clean("/" + fn)
+	return fn != "/" && path.Dir(fn) == "/"
+}
+
+func (fs *spacesfs) resolve(ctx context.Context, ref *provider.Reference) (string, error) {
+	if ref.GetPath() != "" {
+		return path.Clean("/" + ref.GetPath()), nil
+	}
+	if ref.GetId() != nil {
+		fn, err := fs.next.GetPathByID(ctx, ref.GetId())
+		if err != nil {
+			return "", err
+		}
+		return path.Clean("/" + fn), nil
+	}
+	return "", fmt.Errorf("spaces: invalid reference %+v", ref)
+}
+
+func (fs *spacesfs) isAdmin(u *userpb.User) bool {
+	for _, g := range u.Groups {
+		if g == fs.c.AdminGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// role returns the role of the user in the space the path belongs to.
+// Spaces the user has no role in are reported as not found.
+func (fs *spacesfs) role(ctx context.Context, fn string) (string, error) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		return "", errtypes.UserRequired("spaces: error getting user from ctx")
+	}
+	id := split(fn)
+	if id == "" {
+		return "", errtypes.PermissionDenied("spaces: operation not allowed at the root")
+	}
+
+	s, err := fs.sm.GetSpace(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if fs.isAdmin(u) {
+		return spaces.RoleManager, nil
+	}
+	role := spaces.RoleOf(s, u)
+	if role == "" {
+		return "", errtypes.NotFound(fn)
+	}
+	return role, nil
+}
+
+// authorize checks that the role of the user in the space allows the
+// operation and returns the role.
+func (fs *spacesfs) authorize(ctx context.Context, fn string, allowed func(string) bool) (string, error) {
+	role, err := fs.role(ctx, fn)
+	if err != nil {
+		return "", err
+	}
+	if !allowed(role) {
+		return "", errtypes.PermissionDenied(fn)
+	}
+	return role, nil
+}
+
+func canRead(role string) bool {
+	return spaces.ValidRole(role)
+}
+
+// ensureRoot creates the root folder of a space the first time it is used.
+func (fs *spacesfs) ensureRoot(ctx context.Context, fn string) error {
+	root := "/" + split(fn)
+	_, err := fs.next.GetMD(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: root}})
+	if _, ok := err.(errtypes.IsNotFound); ok {
+		return fs.next.CreateDir(ctx, root)
+	}
+	return err
+}
+
+func (fs *spacesfs) getMD(ctx context.Context, fn, role string) (*provider.ResourceInfo, error) {
+	if err := fs.ensureRoot(ctx, fn); err != nil {
+		return nil, err
+	}
+	ri, err := fs.next.GetMD(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}})
+	if err != nil {
+		return nil, err
+	}
+	ri.PermissionSet = spaces.Permissions(role)
+	return ri, nil
+}
+
+func (fs *spacesfs) GetHome(ctx context.Context) (string, error) {
+	return "", errtypes.NotSupported("spaces: spaces have no home")
+}
+
+func (fs *spacesfs) CreateHome(ctx context.Context) error {
+	return errtypes.NotSupported("spaces: spaces have no home")
+}
+
+func (fs *spacesfs) CreateDir(ctx context.Context, fn string) error {
+	fn = path.Clean("/" + fn)
+	if _, err := fs.authorize(ctx, fn, spaces.CanWrite); err != nil {
+		return err
+	}
+	if isSpaceRoot(fn) {
+		return fs.ensureRoot(ctx, fn)
+	}
+	if err := fs.ensureRoot(ctx, fn); err != nil {
+		return err
+	}
+	return fs.next.CreateDir(ctx, fn)
+}
+
+func (fs *spacesfs) Delete(ctx context.Context, ref *provider.Reference) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	allowed := spaces.CanWrite
+	if isSpaceRoot(fn) {
+		allowed = spaces.CanManage
+	}
+	if _, err := fs.authorize(ctx, fn, allowed); err != nil {
+		return err
+	}
+	return fs.next.Delete(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}})
+}
+
+func (fs *spacesfs) Move(ctx context.Context, oldRef, newRef *provider.Reference) error {
+	oldFn, err := fs.resolve(ctx, oldRef)
+	if err != nil {
+		return err
+	}
+	newFn, err := fs.resolve(ctx, newRef)
+	if err != nil {
+		return err
+	}
+	if isSpaceRoot(oldFn) || isSpaceRoot(newFn) {
+		return errtypes.PermissionDenied("spaces: the root of a space can not be moved")
+	}
+	if _, err := fs.authorize(ctx, oldFn, spaces.CanWrite); err != nil {
+		return err
+	}
+	if _, err := fs.authorize(ctx, newFn, spaces.CanWrite); err != nil {
+		return err
+	}
+	return fs.next.Move(ctx,
+		&provider.Reference{Spec: &provider.Reference_Path{Path: oldFn}},
+		&provider.Reference{Spec: &provider.Reference_Path{Path: newFn}})
+}
+
+func (fs *spacesfs) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if fn == "/" {
+		ri, err := fs.next.GetMD(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}})
+		if err != nil {
+			return nil, err
+		}
+		ri.PermissionSet = &provider.ResourcePermissions{GetPath: true, ListContainer: true, Stat: true}
+		return ri, nil
+	}
+
+	role, err := fs.authorize(ctx, fn, canRead)
+	if err != nil {
+		return nil, err
+	}
+	return fs.getMD(ctx, fn, role)
+}
+
+func (fs *spacesfs) ListFolder(ctx context.Context, ref *provider.Reference) ([]*provider.ResourceInfo, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if fn == "/" {
+		return fs.listSpaces(ctx)
+	}
+
+	role, err := fs.authorize(ctx, fn, canRead)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.ensureRoot(ctx, fn); err != nil {
+		return nil, err
+	}
+	infos, err := fs.next.ListFolder(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}})
+	if err != nil {
+		return nil, err
+	}
+	for _, ri := range infos {
+		ri.PermissionSet = spaces.Permissions(role)
+	}
+	return infos, nil
+}
+
+// listSpaces returns the root folders of the spaces the user has a role in.
+func (fs *spacesfs) listSpaces(ctx context.Context) ([]*provider.ResourceInfo, error) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		return nil, errtypes.UserRequired("spaces: error getting user from ctx")
+	}
+	list, err := fs.sm.ListSpaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []*provider.ResourceInfo{}
+	for _, s := range list {
+		role := spaces.RoleOf(s, u)
+		if fs.isAdmin(u) {
+			role = spaces.RoleManager
+		}
+		if role == "" {
+			continue
+		}
+		ri, err := fs.getMD(ctx, "/"+s.ID, role)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, ri)
+	}
+	return infos, nil
+}
+
+func (fs *spacesfs) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.authorize(ctx, fn, spaces.CanWrite); err != nil {
+		return err
+	}
+	if err := fs.ensureRoot(ctx, fn); err != nil {
+		return err
+	}
+	return fs.next.Upload(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, r)
+}
+
+func (fs *spacesfs) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.authorize(ctx, fn, canRead); err != nil {
+		return nil, err
+	}
+	return fs.next.Download(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}})
+}
+
+func (fs *spacesfs) DownloadRange(ctx context.Context, ref *provider.Reference, offset, length int64) (io.ReadCloser, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.authorize(ctx, fn, canRead); err != nil {
+		return nil, err
+	}
+	return storage.DownloadRange(ctx, fs.next, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, offset, length)
+}
+
+func (fs *spacesfs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.authorize(ctx, fn, canRead); err != nil {
+		return nil, err
+	}
+	return fs.next.ListRevisions(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}})
+}
+
+func (fs *spacesfs) DownloadRevision(ctx context.Context, ref *provider.Reference, key string) (io.ReadCloser, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.authorize(ctx, fn, canRead); err != nil {
+		return nil, err
+	}
+	return fs.next.DownloadRevision(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, key)
+}
+
+func (fs *spacesfs) RestoreRevision(ctx context.Context, ref *provider.Reference, key string) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.authorize(ctx, fn, spaces.CanWrite); err != nil {
+		return err
+	}
+	return fs.next.RestoreRevision(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, key)
+}
+
+func (fs *spacesfs) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
+	return nil, errtypes.NotSupported("spaces: recycle bin not supported")
+}
+
+func (fs *spacesfs) RestoreRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("spaces: recycle bin not supported")
+}
+
+func (fs *spacesfs) PurgeRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("spaces: recycle bin not supported")
+}
+
+func (fs *spacesfs) EmptyRecycle(ctx context.Context) error {
+	return errtypes.NotSupported("spaces: recycle bin not supported")
+}
+
+func (fs *spacesfs) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
+	fn, err := fs.next.GetPathByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	fn = path.Clean("/" + fn)
+	if fn == "/" {
+		return fn, nil
+	}
+	if _, err := fs.authorize(ctx, fn, canRead); err != nil {
+		return "", err
+	}
+	return fn, nil
+}
+
+func (fs *spacesfs) AddGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.authorize(ctx, fn, spaces.CanManage); err != nil {
+		return err
+	}
+	return fs.next.AddGrant(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, g)
+}
+
+func (fs *spacesfs) RemoveGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.authorize(ctx, fn, spaces.CanManage); err != nil {
+		return err
+	}
+	return fs.next.RemoveGrant(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, g)
+}
+
+func (fs *spacesfs) UpdateGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.authorize(ctx, fn, spaces.CanManage); err != nil {
+		return err
+	}
+	return fs.next.UpdateGrant(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, g)
+}
+
+func (fs *spacesfs) ListGrants(ctx context.Context, ref *provider.Reference) ([]*provider.Grant, error) {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.authorize(ctx, fn, spaces.CanManage); err != nil {
+		return nil, err
+	}
+	return fs.next.ListGrants(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}})
+}
+
+func (fs *spacesfs) GetQuota(ctx context.Context) (int, int, error) {
+	return fs.next.GetQuota(ctx)
+}
+
+func (fs *spacesfs) CreateReference(ctx context.Context, path string, targetURI *url.URL) error {
+	return errtypes.NotSupported("spaces: references not supported")
+}
+
+func (fs *spacesfs) Shutdown(ctx context.Context) error {
+	return fs.next.Shutdown(ctx)
+}
+
+func (fs *spacesfs) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.authorize(ctx, fn, spaces.CanWrite); err != nil {
+		return err
+	}
+	return fs.next.SetArbitraryMetadata(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, md)
+}
+
+func (fs *spacesfs) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
+	fn, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.authorize(ctx, fn, spaces.CanWrite); err != nil {
+		return err
+	}
+	return fs.next.UnsetArbitraryMetadata(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, keys)
+}
+
+// InitiateUpload authorizes the upload, the other upload operations are
+// bound to the id it returns.
+func (u *uploadFS) InitiateUpload(ctx context.Context, ref *provider.Reference, size int64, metadata map[string]string) (string, error) {
+	fn, err := u.resolve(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if _, err := u.authorize(ctx, fn, spaces.CanWrite); err != nil {
+		return "", err
+	}
+	if err := u.ensureRoot(ctx, fn); err != nil {
+		return "", err
+	}
+	return u.uh.InitiateUpload(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}, size, metadata)
+}
+
+func (u *uploadFS) GetUpload(ctx context.Context, id string) (*storage.UploadInfo, error) {
+	return u.uh.GetUpload(ctx, id)
+}
+
+func (u *uploadFS) WriteUploadChunk(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	return u.uh.WriteUploadChunk(ctx, id, offset, r)
+}
+
+func (u *uploadFS) ReadUpload(ctx context.Context, id string) (io.ReadCloser, error) {
+	return u.uh.ReadUpload(ctx, id)
+}
+
+func (u *uploadFS) FinishUpload(ctx context.Context, id string) error {
+	return u.uh.FinishUpload(ctx, id)
+}
+
+func (u *uploadFS) TerminateUpload(ctx context.Context, id string) error {
+	return u.uh.TerminateUpload(ctx, id)
+}
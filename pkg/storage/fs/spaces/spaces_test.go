@@ -0,0 +1,114 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package spaces
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/spaces"
+	_ "github.com/cs3org/reva/pkg/spaces/manager/json"
+	_ "github.com/cs3org/reva/pkg/storage/fs/local"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func ref(fn string) *provider.Reference {
+	return &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+}
+
+func TestSpaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := New(map[string]interface{}{
+		"drivers": map[string]map[string]interface{}{
+			"local": {"root": path.Join(dir, "data")},
+		},
+		"spaces_managers": map[string]map[string]interface{}{
+			"json": {"file": path.Join(dir, "spaces.json")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := fs.(*uploadFS).sm
+
+	if err := sm.CreateSpace(context.Background(), &spaces.Space{
+		ID:      "physics",
+		Group:   "physics-admins",
+		Members: []*spaces.Member{{Type: spaces.MemberUser, Name: "einstein", Role: spaces.RoleViewer}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	marie := user.ContextSetUser(context.Background(), &userpb.User{Username: "marie", Groups: []string{"physics-admins"}})
+	einstein := user.ContextSetUser(context.Background(), &userpb.User{Username: "einstein"})
+	richard := user.ContextSetUser(context.Background(), &userpb.User{Username: "richard"})
+
+	if err := fs.CreateDir(marie, "/physics/papers"); err != nil {
+		t.Fatal(err)
+	}
+
+	ri, err := fs.GetMD(einstein, ref("/physics/papers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ri.PermissionSet.Stat || ri.PermissionSet.Delete {
+		t.Fatalf("unexpected viewer permissions: %+v", ri.PermissionSet)
+	}
+
+	if err := fs.CreateDir(einstein, "/physics/drafts"); err == nil {
+		t.Fatal("expected error creating a folder as viewer")
+	} else if _, ok := err.(errtypes.IsPermissionDenied); !ok {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	if _, err := fs.GetMD(richard, ref("/physics")); err == nil {
+		t.Fatal("expected error stating a space as non member")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	list, err := fs.ListFolder(einstein, ref("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected one space, got %d", len(list))
+	}
+	if list, err = fs.ListFolder(richard, ref("/")); err != nil || len(list) != 0 {
+		t.Fatalf("expected no spaces, got %d: %v", len(list), err)
+	}
+
+	if err := fs.Delete(einstein, ref("/physics")); err == nil {
+		t.Fatal("expected error deleting a space as viewer")
+	}
+	if err := fs.Delete(marie, ref("/physics/papers")); err != nil {
+		t.Fatal(err)
+	}
+}
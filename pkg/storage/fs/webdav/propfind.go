@@ -0,0 +1,159 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package webdav
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/mime"
+	"github.com/pkg/errors"
+)
+
+// propfindBody requests the properties mapped to the resource info.
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:resourcetype/>
+    <d:getcontentlength/>
+    <d:getcontenttype/>
+    <d:getlastmodified/>
+    <d:getetag/>
+    <d:quota-used-bytes/>
+    <d:quota-available-bytes/>
+  </d:prop>
+</d:propfind>`
+
+type multistatus struct {
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   prop   `xml:"DAV: prop"`
+}
+
+type prop struct {
+	ResourceType        *resourceType `xml:"DAV: resourcetype"`
+	ContentLength       string        `xml:"DAV: getcontentlength"`
+	ContentType         string        `xml:"DAV: getcontenttype"`
+	LastModified        string        `xml:"DAV: getlastmodified"`
+	Etag                string        `xml:"DAV: getetag"`
+	QuotaUsedBytes      string        `xml:"DAV: quota-used-bytes"`
+	QuotaAvailableBytes string        `xml:"DAV: quota-available-bytes"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"DAV: collection"`
+}
+
+// props returns the properties found for the response, ignoring the
+// propstats of the properties the server does not know.
+func (r *response) props() prop {
+	var p prop
+	for _, ps := range r.Propstats {
+		if !strings.Contains(ps.Status, " 200 ") {
+			continue
+		}
+		if ps.Prop.ResourceType != nil {
+			p.ResourceType = ps.Prop.ResourceType
+		}
+		set(&p.ContentLength, ps.Prop.ContentLength)
+		set(&p.ContentType, ps.Prop.ContentType)
+		set(&p.LastModified, ps.Prop.LastModified)
+		set(&p.Etag, ps.Prop.Etag)
+		set(&p.QuotaUsedBytes, ps.Prop.QuotaUsedBytes)
+		set(&p.QuotaAvailableBytes, ps.Prop.QuotaAvailableBytes)
+	}
+	return p
+}
+
+func set(dst *string, src string) {
+	if src != "" {
+		*dst = src
+	}
+}
+
+func parseMultistatus(r io.Reader) (*multistatus, error) {
+	ms := &multistatus{}
+	if err := xml.NewDecoder(r).Decode(ms); err != nil {
+		return nil, errors.Wrap(err, "webdav: error decoding multistatus")
+	}
+	return ms, nil
+}
+
+// hrefPath returns the unescaped path of an href, which may be absolute or
+// a full url.
+func hrefPath(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", errors.Wrap(err, "webdav: invalid href "+href)
+	}
+	return path.Clean(u.Path), nil
+}
+
+func (p *prop) isCollection() bool {
+	return p.ResourceType != nil && p.ResourceType.Collection != nil
+}
+
+// resourceInfo builds the resource info of fn from its dav properties.
+func (p *prop) resourceInfo(fn string) *provider.ResourceInfo {
+	isDir := p.isCollection()
+	ri := &provider.ResourceInfo{
+		Id:            &provider.ResourceId{OpaqueId: "fileid-" + strings.TrimPrefix(fn, "/")},
+		Path:          fn,
+		Type:          getResourceType(isDir),
+		Etag:          strings.Trim(strings.TrimPrefix(p.Etag, "W/"), `"`),
+		MimeType:      mime.Detect(isDir, fn),
+		PermissionSet: &provider.ResourcePermissions{ListContainer: true, CreateContainer: true},
+		Mtime:         &types.Timestamp{},
+	}
+	if !isDir && p.ContentType != "" {
+		ri.MimeType = strings.TrimSpace(strings.Split(p.ContentType, ";")[0])
+	}
+	if size, err := strconv.ParseUint(p.ContentLength, 10, 64); err == nil {
+		ri.Size = size
+	} else if size, err := strconv.ParseUint(p.QuotaUsedBytes, 10, 64); err == nil && isDir {
+		// servers like ownCloud report the size of folders as used bytes
+		ri.Size = size
+	}
+	if t, err := http.ParseTime(p.LastModified); err == nil {
+		ri.Mtime.Seconds = uint64(t.Unix())
+	}
+	return ri
+}
+
+func getResourceType(isDir bool) provider.ResourceType {
+	if isDir {
+		return provider.ResourceType_RESOURCE_TYPE_CONTAINER
+	}
+	return provider.ResourceType_RESOURCE_TYPE_FILE
+}
@@ -0,0 +1,560 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package webdav
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/fs/registry"
+	"github.com/cs3org/reva/pkg/storage/templates"
+	"github.com/cs3org/reva/pkg/token"
+	"github.com/cs3org/reva/pkg/trace"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("webdav", New)
+}
+
+type config struct {
+	// Endpoint is the url of the remote webdav root, e.g.
+	// https://cloud.example.org/remote.php/dav/files
+	Endpoint   string `mapstructure:"endpoint"`
+	EnableHome bool   `mapstructure:"enable_home"`
+	UserLayout string `mapstructure:"user_layout"`
+	// Auth selects the credentials sent to the remote server: "basic" sends
+	// username and password, the username can be a user template, "file"
+	// the credentials of the user found in the credentials file and
+	// "token" forwards the reva access token, for remote reva instances.
+	// Empty sends no credentials.
+	Auth            string `mapstructure:"auth"`
+	Username        string `mapstructure:"username"`
+	Password        string `mapstructure:"password"`
+	CredentialsFile string `mapstructure:"credentials_file"`
+	// Insecure skips the verification of the server certificate.
+	Insecure bool `mapstructure:"insecure"`
+}
+
+// credentials are the remote credentials of a user in the credentials file,
+// keyed by the reva username.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type webdavFS struct {
+	c        *config
+	endpoint *url.URL
+	client   *http.Client
+	creds    map[string]credentials
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns an implementation of the storage.FS interface that mounts a
+// remote webdav server, like another ownCloud or Nextcloud, translating the
+// operations to webdav requests. File ids are derived from the paths, as
+// the remote ids can not be resolved with plain webdav.
+func New(m map[string]interface{}) (storage.FS, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.UserLayout == "" {
+		c.UserLayout = "{{.Username}}"
+	}
+
+	if c.Endpoint == "" {
+		return nil, errors.New("webdav: endpoint is not set")
+	}
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "webdav: invalid endpoint")
+	}
+
+	fs := &webdavFS{c: c, endpoint: endpoint}
+
+	switch c.Auth {
+	case "", "basic", "token":
+	case "file":
+		b, err := ioutil.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "webdav: error reading credentials file")
+		}
+		if err := json.Unmarshal(b, &fs.creds); err != nil {
+			return nil, errors.Wrap(err, "webdav: error decoding credentials file")
+		}
+	default:
+		return nil, errors.New("webdav: unknown auth: " + c.Auth)
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Insecure {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	fs.client = &http.Client{Transport: trace.Transport(t)}
+
+	return fs, nil
+}
+
+func (fs *webdavFS) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func getUser(ctx context.Context) (*userpb.User, error) {
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		err := errors.Wrap(errtypes.UserRequired(""), "webdav: error getting user from ctx")
+		return nil, err
+	}
+	return u, nil
+}
+
+// wrap returns the remote path of p, relative to the endpoint.
+func (fs *webdavFS) wrap(ctx context.Context, p string) (string, error) {
+	if fs.c.EnableHome {
+		home, err := fs.GetHome(ctx)
+		if err != nil {
+			return "", err
+		}
+		return path.Join("/", home, p), nil
+	}
+	return path.Join("/", p), nil
+}
+
+// unwrap returns the path of the resource found at the remote path np, as
+// reported in the hrefs of the server.
+func (fs *webdavFS) unwrap(ctx context.Context, np string) (string, error) {
+	root, err := fs.wrap(ctx, "/")
+	if err != nil {
+		return "", err
+	}
+	root = path.Join("/", fs.endpoint.Path, root)
+	if np != root && !strings.HasPrefix(np, strings.TrimSuffix(root, "/")+"/") {
+		return "", fmt.Errorf("webdav: %s is outside of %s", np, root)
+	}
+	return path.Join("/", strings.TrimPrefix(np, root)), nil
+}
+
+func (fs *webdavFS) resolve(ctx context.Context, ref *provider.Reference) (string, error) {
+	if ref.GetPath() != "" {
+		return fs.wrap(ctx, ref.GetPath())
+	}
+
+	if ref.GetId() != nil {
+		return fs.wrap(ctx, path.Join("/", strings.TrimPrefix(ref.GetId().OpaqueId, "fileid-")))
+	}
+
+	// reference is invalid
+	return "", fmt.Errorf("webdav: invalid reference %+v", ref)
+}
+
+func (fs *webdavFS) url(np string) string {
+	u := *fs.endpoint
+	u.Path = path.Join("/", u.Path, np)
+	return u.String()
+}
+
+// do sends a request for the remote path np with the credentials of the user.
+func (fs *webdavFS) do(ctx context.Context, method, np string, body io.Reader, hdr http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, fs.url(np), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "webdav: error creating request")
+	}
+	req = req.WithContext(ctx)
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	if err := fs.authenticate(ctx, req); err != nil {
+		return nil, err
+	}
+
+	appctx.GetLogger(ctx).Debug().Str("method", method).Str("url", req.URL.String()).Msg("webdav: sending request")
+	res, err := fs.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "webdav: error sending "+method+" request")
+	}
+	return res, nil
+}
+
+func (fs *webdavFS) authenticate(ctx context.Context, req *http.Request) error {
+	switch fs.c.Auth {
+	case "basic":
+		username := fs.c.Username
+		if strings.Contains(username, "{{") {
+			u, err := getUser(ctx)
+			if err != nil {
+				return err
+			}
+			username = templates.WithUser(u, username)
+		}
+		req.SetBasicAuth(username, fs.c.Password)
+	case "file":
+		u, err := getUser(ctx)
+		if err != nil {
+			return err
+		}
+		creds, ok := fs.creds[u.Username]
+		if !ok {
+			return errtypes.PermissionDenied("webdav: no remote credentials for " + u.Username)
+		}
+		req.SetBasicAuth(creds.Username, creds.Password)
+	case "token":
+		tkn, ok := token.ContextGetToken(ctx)
+		if !ok {
+			return errtypes.UserRequired("webdav: no access token in ctx")
+		}
+		req.Header.Set(token.TokenHeader, tkn)
+	}
+	return nil
+}
+
+// checkStatus maps the status of a failed response to an error and closes
+// its body.
+func checkStatus(res *http.Response, np string, ok ...int) error {
+	for _, code := range ok {
+		if res.StatusCode == code {
+			return nil
+		}
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound, http.StatusConflict:
+		return errtypes.NotFound(np)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errtypes.PermissionDenied(np)
+	case http.StatusMethodNotAllowed, http.StatusPreconditionFailed:
+		return errtypes.AlreadyExists(np)
+	}
+	return fmt.Errorf("webdav: unexpected status %s for %s", res.Status, np)
+}
+
+func (fs *webdavFS) propfind(ctx context.Context, np, depth string) (*multistatus, error) {
+	hdr := http.Header{}
+	hdr.Set("Depth", depth)
+	hdr.Set("Content-Type", "application/xml; charset=utf-8")
+	res, err := fs.do(ctx, "PROPFIND", np, strings.NewReader(propfindBody), hdr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(res, np, http.StatusMultiStatus); err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return parseMultistatus(res.Body)
+}
+
+func (fs *webdavFS) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "webdav: error resolving ref")
+	}
+
+	ms, err := fs.propfind(ctx, np, "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(ms.Responses) == 0 {
+		return nil, errtypes.NotFound(np)
+	}
+	return fs.resourceInfo(ctx, &ms.Responses[0])
+}
+
+func (fs *webdavFS) resourceInfo(ctx context.Context, r *response) (*provider.ResourceInfo, error) {
+	hp, err := hrefPath(r.Href)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := fs.unwrap(ctx, hp)
+	if err != nil {
+		return nil, err
+	}
+	p := r.props()
+	return p.resourceInfo(fn), nil
+}
+
+func (fs *webdavFS) ListFolder(ctx context.Context, ref *provider.Reference) ([]*provider.ResourceInfo, error) {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "webdav: error resolving ref")
+	}
+
+	ms, err := fs.propfind(ctx, np, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	self := path.Join("/", fs.endpoint.Path, np)
+	finfos := []*provider.ResourceInfo{}
+	for i := range ms.Responses {
+		hp, err := hrefPath(ms.Responses[i].Href)
+		if err != nil {
+			return nil, err
+		}
+		if hp == self {
+			continue
+		}
+		ri, err := fs.resourceInfo(ctx, &ms.Responses[i])
+		if err != nil {
+			return nil, err
+		}
+		finfos = append(finfos, ri)
+	}
+	return finfos, nil
+}
+
+func (fs *webdavFS) CreateDir(ctx context.Context, fn string) error {
+	np, err := fs.wrap(ctx, fn)
+	if err != nil {
+		return err
+	}
+	res, err := fs.do(ctx, "MKCOL", np, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, np, http.StatusCreated); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (fs *webdavFS) Delete(ctx context.Context, ref *provider.Reference) error {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "webdav: error resolving ref")
+	}
+	res, err := fs.do(ctx, http.MethodDelete, np, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, np, http.StatusOK, http.StatusNoContent); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (fs *webdavFS) Move(ctx context.Context, oldRef, newRef *provider.Reference) error {
+	oldName, err := fs.resolve(ctx, oldRef)
+	if err != nil {
+		return errors.Wrap(err, "webdav: error resolving ref")
+	}
+	newName, err := fs.resolve(ctx, newRef)
+	if err != nil {
+		return errors.Wrap(err, "webdav: error resolving ref")
+	}
+
+	hdr := http.Header{}
+	hdr.Set("Destination", fs.url(newName))
+	hdr.Set("Overwrite", "T")
+	res, err := fs.do(ctx, "MOVE", oldName, nil, hdr)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, oldName, http.StatusCreated, http.StatusNoContent); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (fs *webdavFS) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	defer r.Close()
+
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return errors.Wrap(err, "webdav: error resolving ref")
+	}
+	res, err := fs.do(ctx, http.MethodPut, np, r, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(res, np, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (fs *webdavFS) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	np, err := fs.resolve(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "webdav: error resolving ref")
+	}
+	res, err := fs.do(ctx, http.MethodGet, np, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(res, np, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (fs *webdavFS) GetHome(ctx context.Context) (string, error) {
+	if !fs.c.EnableHome {
+		return "", errtypes.NotSupported("webdav: get home not supported")
+	}
+
+	u, err := getUser(ctx)
+	if err != nil {
+		err = errors.Wrap(err, "webdav: wrap: no user in ctx and home is enabled")
+		return "", err
+	}
+	return templates.WithUser(u, fs.c.UserLayout), nil
+}
+
+// CreateHome creates the collections of the home layout missing on the
+// remote server.
+func (fs *webdavFS) CreateHome(ctx context.Context) error {
+	home, err := fs.GetHome(ctx)
+	if err != nil {
+		return err
+	}
+
+	np := "/"
+	for _, seg := range strings.Split(strings.Trim(home, "/"), "/") {
+		np = path.Join(np, seg)
+		res, err := fs.do(ctx, "MKCOL", np, nil, nil)
+		if err != nil {
+			return err
+		}
+		err = checkStatus(res, np, http.StatusCreated)
+		if _, ok := err.(errtypes.IsAlreadyExists); ok {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "webdav: error creating home dir "+np)
+		}
+		res.Body.Close()
+	}
+	return nil
+}
+
+// GetQuota returns the quota reported by the remote server, 0 if it is
+// unknown or unlimited.
+func (fs *webdavFS) GetQuota(ctx context.Context) (int, int, error) {
+	np, err := fs.wrap(ctx, "/")
+	if err != nil {
+		return 0, 0, err
+	}
+	ms, err := fs.propfind(ctx, np, "0")
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(ms.Responses) == 0 {
+		return 0, 0, errtypes.NotFound(np)
+	}
+
+	p := ms.Responses[0].props()
+	used, _ := strconv.Atoi(p.QuotaUsedBytes)
+	// negative values mean the quota is not computed or unlimited
+	available, err := strconv.Atoi(p.QuotaAvailableBytes)
+	if err != nil || available < 0 {
+		return 0, used, nil
+	}
+	return used + available, used, nil
+}
+
+// GetPathByID returns the path pointed by the file id
+// In this implementation the file id is that path of the file without the first slash
+// thus the file id always points to the filename
+func (fs *webdavFS) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
+	return path.Join("/", strings.TrimPrefix(id.OpaqueId, "fileid-")), nil
+}
+
+func (fs *webdavFS) AddGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) ListGrants(ctx context.Context, ref *provider.Reference) ([]*provider.Grant, error) {
+	return nil, errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) RemoveGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) UpdateGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) CreateReference(ctx context.Context, path string, targetURI *url.URL) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
+	return nil, errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) DownloadRevision(ctx context.Context, ref *provider.Reference, key string) (io.ReadCloser, error) {
+	return nil, errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) RestoreRevision(ctx context.Context, ref *provider.Reference, key string) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
+	return nil, errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) RestoreRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) PurgeRecycleItem(ctx context.Context, key string) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
+
+func (fs *webdavFS) EmptyRecycle(ctx context.Context) error {
+	return errtypes.NotSupported("webdav: operation not supported")
+}
@@ -0,0 +1,131 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package webdav
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/user"
+	"golang.org/x/net/webdav"
+)
+
+func TestWebdavFS(t *testing.T) {
+	dav := &webdav.Handler{
+		Prefix:     "/dav/files",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "remote-einstein" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	fs, err := New(map[string]interface{}{
+		"endpoint":    srv.URL + "/dav/files",
+		"enable_home": true,
+		"auth":        "basic",
+		"username":    "remote-{{.Username}}",
+		"password":    "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := user.ContextSetUser(context.Background(), &userpb.User{Username: "einstein"})
+	ref := func(p string) *provider.Reference {
+		return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+	}
+
+	if err := fs.CreateHome(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.CreateDir(ctx, "/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.CreateDir(ctx, "/docs"); err == nil {
+		t.Error("expected an error creating an existing dir")
+	}
+	if err := fs.Upload(ctx, ref("/docs/a b.txt"), ioutil.NopCloser(strings.NewReader("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Upload(ctx, ref("/notes.txt"), ioutil.NopCloser(strings.NewReader("notes"))); err != nil {
+		t.Fatal(err)
+	}
+
+	ri, err := fs.GetMD(ctx, ref("/docs/a b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Path != "/docs/a b.txt" || ri.Size != 5 || ri.Type != provider.ResourceType_RESOURCE_TYPE_FILE || ri.Etag == "" {
+		t.Errorf("unexpected resource info %+v", ri)
+	}
+
+	infos, err := fs.ListFolder(ctx, ref("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, ri := range infos {
+		paths = append(paths, ri.Path)
+	}
+	sort.Strings(paths)
+	if strings.Join(paths, ",") != "/docs,/notes.txt" {
+		t.Errorf("unexpected listing %v", paths)
+	}
+
+	if err := fs.Move(ctx, ref("/notes.txt"), ref("/docs/notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fs.Download(ctx, ref("/docs/notes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != "notes" {
+		t.Errorf("%#v, wanted %#v", string(b), "notes")
+	}
+
+	if err := fs.Delete(ctx, ref("/docs/notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.GetMD(ctx, ref("/docs/notes.txt")); err == nil {
+		t.Error("expected an error stating a deleted file")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	other := user.ContextSetUser(context.Background(), &userpb.User{Username: "marie"})
+	if _, err := fs.GetMD(other, ref("/")); err == nil {
+		t.Error("expected an error with the wrong credentials")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package janitor periodically purges the data the storage leaves behind,
+// like abandoned uploads, orphaned chunks or expired trash items.
+package janitor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultInterval is the number of seconds between two runs of a task when
+// none is configured.
+const defaultInterval = 3600
+
+// Config configures a janitor task.
+type Config struct {
+	// Expiration is the age in seconds after which the items are purged,
+	// 0 disables the task.
+	Expiration int `mapstructure:"expiration"`
+	// Interval is the number of seconds between two runs.
+	Interval int `mapstructure:"interval"`
+	// DryRun only logs the items that would be purged.
+	DryRun bool `mapstructure:"dry_run"`
+}
+
+// PurgeFunc removes the items last modified before the given time and
+// returns their names. With dryRun nothing is removed, the items that would
+// be are returned.
+type PurgeFunc func(ctx context.Context, before time.Time, dryRun bool) ([]string, error)
+
+type task struct {
+	name  string
+	conf  Config
+	purge PurgeFunc
+}
+
+// Janitor runs the purge tasks on their schedule.
+type Janitor struct {
+	tasks []*task
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New returns a janitor without tasks.
+func New() *Janitor {
+	return &Janitor{quit: make(chan struct{})}
+}
+
+// Add adds a task, tasks without expiration are ignored. It must be called
+// before Start.
+func (j *Janitor) Add(name string, c Config, f PurgeFunc) {
+	if c.Expiration <= 0 {
+		return
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultInterval
+	}
+	j.tasks = append(j.tasks, &task{name: name, conf: c, purge: f})
+}
+
+// Start runs every task in the background, at its interval.
+func (j *Janitor) Start() {
+	for _, t := range j.tasks {
+		j.wg.Add(1)
+		go j.run(t)
+	}
+}
+
+// Stop stops the tasks and waits for the running ones to finish.
+func (j *Janitor) Stop() {
+	close(j.quit)
+	j.wg.Wait()
+}
+
+func (j *Janitor) run(t *task) {
+	defer j.wg.Done()
+	ticker := time.NewTicker(time.Duration(t.conf.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			Run(t.name, t.conf, t.purge)
+		case <-j.quit:
+			return
+		}
+	}
+}
+
+// Run runs a task once and logs the purged items.
+func Run(name string, c Config, f PurgeFunc) []string {
+	ctx := appctx.WithLogger(context.Background(), &log.Logger)
+	before := time.Now().Add(-time.Duration(c.Expiration) * time.Second)
+	items, err := f(ctx, before, c.DryRun)
+	for _, item := range items {
+		if c.DryRun {
+			log.Info().Str("task", name).Str("item", item).Msg("janitor: would purge")
+		} else {
+			log.Info().Str("task", name).Str("item", item).Msg("janitor: purged")
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Str("task", name).Msg("janitor: error purging")
+	}
+	return items
+}
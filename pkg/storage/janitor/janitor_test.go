@@ -0,0 +1,59 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package janitor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	var gotBefore time.Time
+	var gotDryRun bool
+	f := func(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+		gotBefore, gotDryRun = before, dryRun
+		return []string{"a", "b"}, nil
+	}
+
+	items := Run("test", Config{Expiration: 3600, DryRun: true}, f)
+	if len(items) != 2 {
+		t.Fatalf("unexpected items %v", items)
+	}
+	if !gotDryRun {
+		t.Fatal("expected a dry run")
+	}
+	if d := time.Since(gotBefore); d < time.Hour || d > time.Hour+time.Minute {
+		t.Fatalf("unexpected purge time %s", gotBefore)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	j := New()
+	f := func(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+		return nil, nil
+	}
+	j.Add("disabled", Config{}, f)
+	j.Add("enabled", Config{Expiration: 60}, f)
+	if len(j.tasks) != 1 || j.tasks[0].name != "enabled" || j.tasks[0].conf.Interval != defaultInterval {
+		t.Fatalf("unexpected tasks %+v", j.tasks)
+	}
+	j.Start()
+	j.Stop()
+}
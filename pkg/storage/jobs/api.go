@@ -0,0 +1,207 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package jobs
+
+import (
+	"context"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/appctx"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rgrpc/jsoncodec"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// The API of the jobmanager service, served by the gateway too. It is not
+// part of the CS3 APIs, so its messages are plain structs exchanged as JSON
+// over gRPC. The jobs belong to the user calling CreateJob, the only one
+// who can get, update or cancel them.
+const serviceName = "revad.jobs.v1beta1.JobAPI"
+
+// CreateJobRequest creates a job expected to process Total bytes.
+type CreateJobRequest struct {
+	Total int64 `json:"total"`
+}
+
+// JobRequest selects the job to get or cancel.
+type JobRequest struct {
+	ID string `json:"id"`
+}
+
+// UpdateJobRequest reports the progress of a job, its result and its end
+// when Status is Finished or Failed.
+type UpdateJobRequest struct {
+	ID     string            `json:"id"`
+	Done   int64             `json:"done"`
+	Status Status            `json:"status,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Result map[string]string `json:"result,omitempty"`
+}
+
+// JobResponse holds the state of the job.
+type JobResponse struct {
+	Status *rpc.Status `json:"status"`
+	Job    *Info       `json:"job"`
+}
+
+// APIServer is the server API of the job manager.
+type APIServer interface {
+	CreateJob(context.Context, *CreateJobRequest) (*JobResponse, error)
+	GetJob(context.Context, *JobRequest) (*JobResponse, error)
+	UpdateJob(context.Context, *UpdateJobRequest) (*JobResponse, error)
+	CancelJob(context.Context, *JobRequest) (*JobResponse, error)
+}
+
+// RegisterAPIServer registers the job manager on the gRPC server.
+func RegisterAPIServer(s *grpc.Server, srv APIServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*APIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		method("CreateJob", func() interface{} { return &CreateJobRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CreateJob(ctx, req.(*CreateJobRequest))
+		}),
+		method("GetJob", func() interface{} { return &JobRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetJob(ctx, req.(*JobRequest))
+		}),
+		method("UpdateJob", func() interface{} { return &UpdateJobRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.UpdateJob(ctx, req.(*UpdateJobRequest))
+		}),
+		method("CancelJob", func() interface{} { return &JobRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CancelJob(ctx, req.(*JobRequest))
+		}),
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// method returns the description of the unary method, which decodes a new
+// request and passes it to call through the interceptors.
+func method(name string, newReq func() interface{}, call func(APIServer, context.Context, interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(APIServer), ctx, req)
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + name}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+// Client calls the job manager. Its methods return the errtypes matching
+// the status codes.
+type Client struct {
+	cc *grpc.ClientConn
+}
+
+// NewClient returns a client of the job manager on the connection.
+func NewClient(cc *grpc.ClientConn) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) invoke(ctx context.Context, name string, req interface{}) (*Info, error) {
+	res := &JobResponse{}
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/"+name, req, res, grpc.CallContentSubtype(jsoncodec.Name)); err != nil {
+		return nil, errors.Wrap(err, "jobs: error calling "+name)
+	}
+	switch res.Status.GetCode() {
+	case rpc.Code_CODE_OK:
+		return res.Job, nil
+	case rpc.Code_CODE_NOT_FOUND:
+		return nil, errtypes.NotFound(res.Status.GetMessage())
+	case rpc.Code_CODE_UNIMPLEMENTED:
+		return nil, errtypes.NotSupported(res.Status.GetMessage())
+	default:
+		return nil, errors.New("jobs: " + res.Status.GetCode().String() + ": " + res.Status.GetMessage())
+	}
+}
+
+// CreateJob creates a job of the user in the context, expected to process
+// total bytes.
+func (c *Client) CreateJob(ctx context.Context, total int64) (*Info, error) {
+	return c.invoke(ctx, "CreateJob", &CreateJobRequest{Total: total})
+}
+
+// GetJob returns the state of the job.
+func (c *Client) GetJob(ctx context.Context, id string) (*Info, error) {
+	return c.invoke(ctx, "GetJob", &JobRequest{ID: id})
+}
+
+// UpdateJob reports the progress of the job and returns its state.
+func (c *Client) UpdateJob(ctx context.Context, req *UpdateJobRequest) (*Info, error) {
+	return c.invoke(ctx, "UpdateJob", req)
+}
+
+// CancelJob cancels the job, the service running it stops it when it
+// reports its progress next.
+func (c *Client) CancelJob(ctx context.Context, id string) (*Info, error) {
+	return c.invoke(ctx, "CancelJob", &JobRequest{ID: id})
+}
+
+// Run runs f in the background for the job created with CreateJob, and
+// reports its progress every interval. f is cancelled when the job is
+// cancelled in the job manager. Like the jobs of a Manager, it keeps the
+// values of ctx but not its deadline and cancellation.
+func (c *Client) Run(ctx context.Context, info *Info, interval time.Duration, f Func) {
+	values := detached{Context: context.Background(), values: ctx}
+	jctx, cancel := context.WithCancel(values)
+	j := &Job{info: *info, cancel: cancel}
+	j.info.Result = map[string]string{}
+
+	go func() {
+		defer cancel()
+		done := make(chan error, 1)
+		go func() { done <- f(jctx, j) }()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				current, err := c.UpdateJob(values, &UpdateJobRequest{ID: info.ID, Done: j.Info().Done})
+				if err == nil && current.Status == Cancelled {
+					cancel()
+				}
+			case err := <-done:
+				i := j.Info()
+				req := &UpdateJobRequest{ID: info.ID, Done: i.Done, Status: Finished, Result: i.Result}
+				if err != nil {
+					req.Status, req.Error = Failed, err.Error()
+				}
+				if _, err := c.UpdateJob(values, req); err != nil {
+					appctx.GetLogger(ctx).Error().Err(err).Str("job", info.ID).Msg("jobs: error reporting the end of the job")
+				}
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,321 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package jobs runs the long storage operations, like the copies between
+// storage providers, in the background and tracks their progress. The jobs
+// of the services with several instances are tracked by the jobmanager
+// service instead, through the API of the package, see Client.
+package jobs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Status is the state of a job, named after the states of the ownCloud
+// async operations.
+type Status string
+
+// The states of a job.
+const (
+	Queued    Status = "init"
+	Running   Status = "started"
+	Finished  Status = "finished"
+	Failed    Status = "error"
+	Cancelled Status = "cancelled"
+)
+
+// Info is a snapshot of the state of a job.
+type Info struct {
+	ID string `json:"id"`
+	// Owner identifies the user who started the job.
+	Owner  string `json:"owner"`
+	Status Status `json:"status"`
+	// Total is the number of bytes the job is expected to process, Done
+	// the number processed so far.
+	Total int64  `json:"total"`
+	Done  int64  `json:"done"`
+	Error string `json:"error,omitempty"`
+	// Result holds the values set by the job, like the id of the resource
+	// it created.
+	Result  map[string]string `json:"result,omitempty"`
+	Created time.Time         `json:"created"`
+	// Ended is the time the job finished, failed or was cancelled.
+	Ended time.Time `json:"ended"`
+}
+
+// Job is a running operation.
+type Job struct {
+	done int64 // atomic, first for alignment
+
+	mu     sync.Mutex
+	info   Info
+	cancel context.CancelFunc
+	// remote is set for the jobs run by another service, which last
+	// reported their progress at updated.
+	remote  bool
+	updated time.Time
+}
+
+// Progress records that n more bytes were processed.
+func (j *Job) Progress(n int64) {
+	atomic.AddInt64(&j.done, n)
+}
+
+// SetTotal sets the amount the job is expected to process, for the jobs
+// which only know it once they started.
+func (j *Job) SetTotal(total int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.info.Total = total
+}
+
+// SetResult sets a value of the result of the job.
+func (j *Job) SetResult(key, value string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.info.Result[key] = value
+}
+
+// Info returns the current state of the job.
+func (j *Job) Info() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := j.info
+	info.Done = atomic.LoadInt64(&j.done)
+	info.Result = make(map[string]string, len(j.info.Result))
+	for k, v := range j.info.Result {
+		info.Result[k] = v
+	}
+	return info
+}
+
+func (j *Job) setStatus(s Status, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// a cancelled job keeps its status when the operation returns
+	if j.info.Status == Cancelled {
+		return
+	}
+	j.info.Status = s
+	if err != nil {
+		j.info.Error = err.Error()
+	}
+	if s != Running {
+		j.info.Ended = time.Now()
+	}
+}
+
+// Func is the operation run by a job. It must return when ctx is cancelled.
+type Func func(ctx context.Context, j *Job) error
+
+// Manager runs the jobs and keeps them until they are purged.
+type Manager struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewManager returns a manager without jobs.
+func NewManager() *Manager {
+	return &Manager{jobs: map[string]*Job{}}
+}
+
+// Start runs f in the background as a job of the owner, expected to
+// process total bytes. The job keeps the values of ctx, like the user and
+// its token, but not its deadline and cancellation, so that it outlives the
+// request starting it.
+func (m *Manager) Start(ctx context.Context, owner string, total int64, f Func) *Job {
+	jctx, cancel := context.WithCancel(detached{Context: context.Background(), values: ctx})
+	j := &Job{
+		info: Info{
+			ID:      uuid.New().String(),
+			Owner:   owner,
+			Status:  Queued,
+			Total:   total,
+			Result:  map[string]string{},
+			Created: time.Now(),
+		},
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[j.info.ID] = j
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		j.setStatus(Running, nil)
+		if err := f(jctx, j); err != nil {
+			j.setStatus(Failed, err)
+			return
+		}
+		j.setStatus(Finished, nil)
+	}()
+	return j
+}
+
+// Add tracks a job of the owner run by another service, expected to process
+// total bytes. The service reports its progress with Update.
+func (m *Manager) Add(owner string, total int64) *Job {
+	now := time.Now()
+	j := &Job{
+		info: Info{
+			ID:      uuid.New().String(),
+			Owner:   owner,
+			Status:  Running,
+			Total:   total,
+			Result:  map[string]string{},
+			Created: now,
+		},
+		cancel:  func() {},
+		remote:  true,
+		updated: now,
+	}
+
+	m.mu.Lock()
+	m.jobs[j.info.ID] = j
+	m.mu.Unlock()
+	return j
+}
+
+// Update records the progress reported for a job added with Add: the bytes
+// done, the values of its result and its end, when status is Finished or
+// Failed. The jobs which already ended are left as they are, so a service
+// learns that its job was cancelled from the returned job.
+func (m *Manager) Update(id string, done int64, status Status, errMsg string, result map[string]string) (*Job, error) {
+	j, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !j.remote {
+		return nil, errtypes.NotSupported("jobs: update of a job not run by another service")
+	}
+
+	j.mu.Lock()
+	ended := !j.info.Ended.IsZero()
+	if !ended {
+		atomic.StoreInt64(&j.done, done)
+		for k, v := range result {
+			j.info.Result[k] = v
+		}
+	}
+	j.updated = time.Now()
+	j.mu.Unlock()
+	if ended {
+		return j, nil
+	}
+
+	switch status {
+	case "", Running:
+	case Finished:
+		j.setStatus(Finished, nil)
+	case Failed:
+		j.setStatus(Failed, errors.New(errMsg))
+	default:
+		return nil, errtypes.NotSupported("jobs: status " + string(status))
+	}
+	return j, nil
+}
+
+// Expire fails the running jobs added with Add which did not report their
+// progress since the given time, like the ones of a service that stopped.
+// It can be run by a janitor.
+func (m *Manager) Expire(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []string
+	for id, j := range m.jobs {
+		j.mu.Lock()
+		stale := j.remote && j.info.Ended.IsZero() && j.updated.Before(before)
+		j.mu.Unlock()
+		if !stale {
+			continue
+		}
+		expired = append(expired, id)
+		if !dryRun {
+			j.setStatus(Failed, errors.New("the job stopped reporting its progress"))
+		}
+	}
+	return expired, nil
+}
+
+// Get returns the job with the given id.
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, errtypes.NotFound(id)
+	}
+	return j, nil
+}
+
+// Cancel stops the job, jobs that already ended are left as they are.
+func (m *Manager) Cancel(id string) error {
+	j, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	if j.info.Status == Queued || j.info.Status == Running {
+		j.info.Status = Cancelled
+		j.info.Ended = time.Now()
+	}
+	j.mu.Unlock()
+
+	j.cancel()
+	return nil
+}
+
+// Purge forgets the jobs which ended before the given time. It can be
+// run by a janitor.
+func (m *Manager) Purge(ctx context.Context, before time.Time, dryRun bool) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged []string
+	for id, j := range m.jobs {
+		info := j.Info()
+		if info.Ended.IsZero() || !info.Ended.Before(before) {
+			continue
+		}
+		purged = append(purged, id)
+		if !dryRun {
+			delete(m.jobs, id)
+		}
+	}
+	return purged, nil
+}
+
+// detached is a context with the values of another one.
+type detached struct {
+	context.Context
+	values context.Context
+}
+
+func (d detached) Value(key interface{}) interface{} {
+	return d.values.Value(key)
+}
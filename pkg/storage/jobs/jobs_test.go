@@ -0,0 +1,137 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+// wait polls the job until it ends.
+func wait(t *testing.T, j *Job) Info {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if info := j.Info(); !info.Ended.IsZero() {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job did not end")
+	return Info{}
+}
+
+func TestJobs(t *testing.T) {
+	m := NewManager()
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "token"))
+
+	j := m.Start(ctx, "einstein", 0, func(ctx context.Context, j *Job) error {
+		if ctx.Value(ctxKey{}) != "token" {
+			return errors.New("values of the context not kept")
+		}
+		j.SetTotal(10)
+		j.Progress(4)
+		j.Progress(6)
+		j.SetResult("fileId", "42")
+		return nil
+	})
+	// the job outlives the request
+	cancel()
+
+	info := wait(t, j)
+	if info.Status != Finished || info.Error != "" {
+		t.Fatalf("job ended with %s: %s", info.Status, info.Error)
+	}
+	if info.Owner != "einstein" || info.Done != 10 || info.Total != 10 || info.Result["fileId"] != "42" {
+		t.Errorf("unexpected job info %+v", info)
+	}
+
+	failed := m.Start(context.Background(), "einstein", 0, func(ctx context.Context, j *Job) error {
+		return errors.New("boom")
+	})
+	if info := wait(t, failed); info.Status != Failed || info.Error != "boom" {
+		t.Errorf("expected the job to fail, got %s: %s", info.Status, info.Error)
+	}
+
+	started := make(chan struct{})
+	blocked := m.Start(context.Background(), "einstein", 0, func(ctx context.Context, j *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+	if err := m.Cancel(blocked.Info().ID); err != nil {
+		t.Fatal(err)
+	}
+	if info := wait(t, blocked); info.Status != Cancelled {
+		t.Errorf("expected the job to be cancelled, got %s", info.Status)
+	}
+
+	purged, err := m.Purge(context.Background(), time.Now().Add(time.Minute), false)
+	if err != nil || len(purged) != 3 {
+		t.Errorf("Purge() = %v, %v, expected the 3 jobs", purged, err)
+	}
+	if _, err := m.Get(j.Info().ID); err == nil {
+		t.Error("expected the job to be purged")
+	}
+}
+
+func TestRemoteJobs(t *testing.T) {
+	m := NewManager()
+
+	j := m.Add("einstein", 10)
+	if _, err := m.Update(j.Info().ID, 4, "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if info := j.Info(); info.Status != Running || info.Done != 4 {
+		t.Errorf("unexpected job info %+v", info)
+	}
+	if _, err := m.Update(j.Info().ID, 10, Finished, "", map[string]string{"fileId": "42"}); err != nil {
+		t.Fatal(err)
+	}
+	if info := j.Info(); info.Status != Finished || info.Done != 10 || info.Result["fileId"] != "42" {
+		t.Errorf("unexpected job info %+v", info)
+	}
+
+	cancelled := m.Add("einstein", 10)
+	if err := m.Cancel(cancelled.Info().ID); err != nil {
+		t.Fatal(err)
+	}
+	// the service learns the job was cancelled when it reports its progress
+	if u, err := m.Update(cancelled.Info().ID, 5, "", "", nil); err != nil || u.Info().Status != Cancelled {
+		t.Errorf("Update() of a cancelled job = %v, %v", u, err)
+	}
+
+	local := m.Start(context.Background(), "einstein", 0, func(ctx context.Context, j *Job) error { return nil })
+	if _, err := m.Update(local.Info().ID, 1, "", "", nil); err == nil {
+		t.Error("expected the update of a job run by the manager to fail")
+	}
+
+	stale := m.Add("einstein", 10)
+	expired, err := m.Expire(context.Background(), time.Now().Add(time.Minute), false)
+	if err != nil || len(expired) != 1 || expired[0] != stale.Info().ID {
+		t.Errorf("Expire() = %v, %v, expected the stale job", expired, err)
+	}
+	if info := stale.Info(); info.Status != Failed {
+		t.Errorf("expected the stale job to fail, got %s", info.Status)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package journal records the changes of the files of a storage driver, so
+// that the sync clients can ask for what changed since they last synced
+// instead of walking the whole tree, see the sync-collection REPORT of
+// https://tools.ietf.org/html/rfc6578.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// TokenOpaqueKey is the key of the opaque data of the ListContainer
+// requests asking for the changes since the sync token, and of their
+// responses carrying the token of the last change.
+const TokenOpaqueKey = "sync_token"
+
+// RemovedOpaqueKey is the key of the opaque data of the ListContainer
+// responses listing, as json, the paths of the removed resources relative
+// to the listed folder. The changed ones are returned as the infos.
+const RemovedOpaqueKey = "sync_removed"
+
+// Config configures the journal of a storage driver.
+type Config struct {
+	// File keeps the changes across restarts, no journal is kept if empty.
+	File string `mapstructure:"file"`
+	// MaxEntries is the number of changes kept, the clients whose token is
+	// older have to sync the whole tree again.
+	MaxEntries int `mapstructure:"max_entries"`
+}
+
+type header struct {
+	ID string `json:"id"`
+}
+
+type entry struct {
+	Seq     uint64 `json:"seq"`
+	Path    string `json:"path"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// Journal is the list of the last changes of a storage, numbered in order.
+// The tokens given to the clients identify the journal and the number of
+// the last change, so that the tokens of a journal which was lost are not
+// mistaken for the ones of the new journal.
+type Journal struct {
+	conf Config
+
+	mu      sync.Mutex
+	id      string
+	entries []entry
+	// last is the number of the last change, dropped of the last one
+	// forgotten.
+	last, dropped uint64
+	f             *os.File
+	lines         int
+}
+
+// New returns the journal kept in the file of the config, nil if none is
+// configured. A nil journal records nothing.
+func New(c Config) (*Journal, error) {
+	if c.File == "" {
+		return nil, nil
+	}
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 100000
+	}
+	if err := os.MkdirAll(filepath.Dir(c.File), 0700); err != nil {
+		return nil, errors.Wrap(err, "journal: error creating dir")
+	}
+
+	j := &Journal{conf: c}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if j.id == "" {
+		j.id = uuid.New().String()
+		if err := j.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(c.File, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "journal: error opening file")
+	}
+	j.f = f
+	return j, nil
+}
+
+// load reads the journal file, a header followed by a change per line.
+func (j *Journal) load() error {
+	f, err := os.Open(j.conf.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "journal: error opening file")
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !s.Scan() {
+		return s.Err()
+	}
+	h := &header{}
+	if err := json.Unmarshal(s.Bytes(), h); err != nil || h.ID == "" {
+		log.Warn().Str("file", j.conf.File).Msg("journal: invalid header, starting a new journal")
+		return nil
+	}
+	j.id = h.ID
+	for s.Scan() {
+		e := entry{}
+		// a line cut by a crash is skipped
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil || e.Seq <= j.last {
+			continue
+		}
+		j.entries = append(j.entries, e)
+		j.last = e.Seq
+		j.lines++
+	}
+	if err := s.Err(); err != nil {
+		return errors.Wrap(err, "journal: error reading file")
+	}
+	j.trim()
+	return nil
+}
+
+// trim forgets the changes above the maximum.
+func (j *Journal) trim() {
+	if n := len(j.entries) - j.conf.MaxEntries; n > 0 {
+		j.dropped = j.entries[n-1].Seq
+		j.entries = append([]entry(nil), j.entries[n:]...)
+	}
+}
+
+// rewrite replaces the file with the changes kept, to compact it.
+func (j *Journal) rewrite() error {
+	tmp := j.conf.File + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "journal: error creating file")
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(&header{ID: j.id}); err != nil {
+		f.Close()
+		return err
+	}
+	for i := range j.entries {
+		if err := enc.Encode(&j.entries[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "journal: error writing file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "journal: error writing file")
+	}
+	j.lines = len(j.entries)
+	return os.Rename(tmp, j.conf.File)
+}
+
+// Record adds the change of the file or folder fn, or its removal. Errors
+// are logged, the changes can not be refused once made.
+func (j *Journal) Record(fn string, removed bool) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.last++
+	e := entry{Seq: j.last, Path: path.Clean(fn), Removed: removed}
+	j.entries = append(j.entries, e)
+	j.trim()
+
+	if j.f == nil {
+		return
+	}
+	data, err := json.Marshal(&e)
+	if err != nil {
+		log.Error().Err(err).Msg("journal: error encoding change")
+		return
+	}
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		log.Error().Err(err).Str("file", j.conf.File).Msg("journal: error writing change")
+		return
+	}
+	j.lines++
+
+	// the file is compacted once it holds twice the changes kept
+	if j.lines > 2*j.conf.MaxEntries {
+		j.f.Close()
+		if err := j.rewrite(); err != nil {
+			log.Error().Err(err).Str("file", j.conf.File).Msg("journal: error compacting file")
+		}
+		if j.f, err = os.OpenFile(j.conf.File, os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+			log.Error().Err(err).Str("file", j.conf.File).Msg("journal: error opening file")
+		}
+	}
+}
+
+// Changes returns the changes below the folder dir since the token, with
+// their path relative to dir and the last state of every path, and the
+// token of the last change. An empty token returns no change. It fails
+// with errtypes.PreconditionFailed if the token is not one of this journal
+// or older than the changes kept.
+func (j *Journal) Changes(dir, token string) ([]*storage.Change, string, error) {
+	if j == nil {
+		return nil, "", errtypes.NotSupported("journal: no journal configured")
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	current := fmt.Sprintf("%s_%d", j.id, j.last)
+	if token == "" {
+		return nil, current, nil
+	}
+	i := strings.LastIndex(token, "_")
+	if i < 0 || token[:i] != j.id {
+		return nil, "", errtypes.PreconditionFailed("journal: unknown sync token")
+	}
+	since, err := strconv.ParseUint(token[i+1:], 10, 64)
+	if err != nil || since > j.last {
+		return nil, "", errtypes.PreconditionFailed("journal: unknown sync token")
+	}
+	if since < j.dropped {
+		return nil, "", errtypes.PreconditionFailed("journal: sync token expired")
+	}
+
+	dir = strings.TrimSuffix(path.Clean(dir), "/") + "/"
+	removed := map[string]bool{}
+	first := sort.Search(len(j.entries), func(k int) bool { return j.entries[k].Seq > since })
+	for _, e := range j.entries[first:] {
+		if strings.HasPrefix(e.Path, dir) {
+			removed[strings.TrimPrefix(e.Path, dir)] = e.Removed
+		}
+	}
+
+	changes := make([]*storage.Change, 0, len(removed))
+	for p, r := range removed {
+		changes = append(changes, &storage.Change{Path: p, Removed: r})
+	}
+	sort.Slice(changes, func(a, b int) bool { return changes[a].Path < changes[b].Path })
+	return changes, current, nil
+}
+
+// Close closes the file of the journal.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	return j.f.Close()
+}
@@ -0,0 +1,134 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+)
+
+func changes(t *testing.T, j *Journal, dir, token string) ([]storage.Change, string) {
+	list, next, err := j.Changes(dir, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := []storage.Change{}
+	for _, c := range list {
+		res = append(res, *c)
+	}
+	return res, next
+}
+
+func TestChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "journal")
+	j, err := New(Config{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, start := changes(t, j, "/data/einstein", "")
+	j.Record("/data/einstein/a.txt", false)
+	j.Record("/data/einstein/folder/b.txt", false)
+	j.Record("/data/marie/c.txt", false)
+	j.Record("/data/einstein/a.txt", true)
+
+	got, next := changes(t, j, "/data/einstein", start)
+	expected := []storage.Change{{Path: "a.txt", Removed: true}, {Path: "folder/b.txt"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got changes %+v, expected %+v", got, expected)
+	}
+	if got, _ := changes(t, j, "/data/einstein", next); len(got) != 0 {
+		t.Errorf("expected no change since the last token, got %+v", got)
+	}
+
+	// the changes are kept across restarts
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if j, err = New(Config{File: file}); err != nil {
+		t.Fatal(err)
+	}
+	j.Record("/data/einstein/a.txt", false)
+	got, _ = changes(t, j, "/data/einstein/", next)
+	if expected := []storage.Change{{Path: "a.txt"}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got changes %+v, expected %+v", got, expected)
+	}
+	if got, _ := changes(t, j, "/data/einstein", start); len(got) != 2 {
+		t.Errorf("expected 2 changes since the start, got %+v", got)
+	}
+
+	for _, token := range []string{"unknown_0", start + "9", "x"} {
+		if _, _, err := j.Changes("/data/einstein", token); err == nil {
+			t.Errorf("expected an error for token %s", token)
+		} else if _, ok := err.(errtypes.IsPreconditionFailed); !ok {
+			t.Errorf("expected a precondition failed for token %s, got %v", token, err)
+		}
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "journal")
+	j, err := New(Config{File: file, MaxEntries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, start := changes(t, j, "/", "")
+	for _, fn := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		j.Record(fn, false)
+	}
+	if _, _, err := j.Changes("/", start); err == nil {
+		t.Error("expected the token to be expired")
+	}
+
+	// the compacted file keeps the last changes
+	j.Close()
+	if j, err = New(Config{File: file, MaxEntries: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(j.entries) != 2 || j.entries[1].Path != "/e" || j.last != 5 {
+		t.Errorf("unexpected journal after compaction: %+v", j.entries)
+	}
+}
+
+func TestNoJournal(t *testing.T) {
+	j, err := New(Config{})
+	if err != nil || j != nil {
+		t.Fatalf("expected no journal, got %v %v", j, err)
+	}
+	j.Record("/a", false)
+	if _, _, err := j.Changes("/", ""); err == nil {
+		t.Error("expected an error without journal")
+	}
+}
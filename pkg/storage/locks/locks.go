@@ -0,0 +1,157 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package locks defines where the WebDAV locks on the resources are kept.
+package locks
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/pkg/errors"
+)
+
+// OpaqueKey is the key of the opaque data of the CS3 requests the tokens of
+// the locks submitted by the clients travel in, as json.
+const OpaqueKey = "lock_tokens"
+
+// Lock is an exclusive write lock on a resource.
+type Lock struct {
+	Token string `json:"token"`
+	// Root is the path of the locked resource.
+	Root string `json:"root"`
+	// Infinite locks also lock the resources below the root.
+	Infinite bool `json:"infinite"`
+	// Owner is the owner information sent by the client, as XML.
+	Owner string `json:"owner"`
+	// UserID identifies the user who created the lock, see UserID.
+	UserID string `json:"user_id"`
+	// Expires is the time the lock is released if not refreshed, zero
+	// for locks that never expire.
+	Expires time.Time `json:"expires"`
+}
+
+// Expired tells if the lock has expired at the given time.
+func (l *Lock) Expired(now time.Time) bool {
+	return !l.Expires.IsZero() && !now.Before(l.Expires)
+}
+
+// Covers tells if the lock applies to the resource at path p.
+func (l *Lock) Covers(p string) bool {
+	if l.Root == p {
+		return true
+	}
+	return l.Infinite && IsBelow(p, l.Root)
+}
+
+// Manager keeps the locks.
+type Manager interface {
+	// Lock stores the lock, it fails with errtypes.Locked if the resource or
+	// one below it for infinite locks is already locked.
+	Lock(ctx context.Context, l *Lock) error
+
+	// Refresh sets the expiration of the lock with the token, it fails with
+	// errtypes.NotFound if there is no such lock.
+	Refresh(ctx context.Context, token string, expires time.Time) (*Lock, error)
+
+	// Unlock removes the lock with the token, it fails with
+	// errtypes.NotFound if there is no such lock.
+	Unlock(ctx context.Context, token string) error
+
+	// Locks returns the locks covering the resource at path p and, with
+	// children, the locks on the resources below it.
+	Locks(ctx context.Context, p string, children bool) ([]*Lock, error)
+}
+
+// UserID returns the identifier of the user in the locks.
+func UserID(u *userpb.UserId) string {
+	return u.GetOpaqueId() + "@" + u.GetIdp()
+}
+
+// Check returns an errtypes.Locked error unless the user holds all the
+// locks and submitted their tokens. The token of a lock is only accepted
+// from the user who created it.
+func Check(ls []*Lock, userID string, tokens []string) error {
+	submitted := map[string]bool{}
+	for _, t := range tokens {
+		submitted[t] = true
+	}
+	for _, l := range ls {
+		if !submitted[l.Token] || l.UserID != userID {
+			return errtypes.Locked(l.Root)
+		}
+	}
+	return nil
+}
+
+// TokensToOpaque adds the tokens to the opaque data, which is created if
+// nil, and returns it.
+func TokensToOpaque(o *typespb.Opaque, tokens []string) (*typespb.Opaque, error) {
+	if len(tokens) == 0 {
+		return o, nil
+	}
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return nil, errors.Wrap(err, "locks: error encoding tokens")
+	}
+	if o == nil {
+		o = &typespb.Opaque{}
+	}
+	if o.Map == nil {
+		o.Map = map[string]*typespb.OpaqueEntry{}
+	}
+	o.Map[OpaqueKey] = &typespb.OpaqueEntry{Decoder: "json", Value: data}
+	return o, nil
+}
+
+// TokensFromOpaque returns the tokens carried by the opaque data.
+func TokensFromOpaque(o *typespb.Opaque) ([]string, error) {
+	e, ok := o.GetMap()[OpaqueKey]
+	if !ok {
+		return nil, nil
+	}
+	if e.Decoder != "json" {
+		return nil, errors.New("locks: unsupported tokens decoder " + e.Decoder)
+	}
+	var tokens []string
+	if err := json.Unmarshal(e.Value, &tokens); err != nil {
+		return nil, errors.Wrap(err, "locks: error decoding tokens")
+	}
+	return tokens, nil
+}
+
+// IsBelow tells if the path p is below the path root.
+func IsBelow(p, root string) bool {
+	return p != root && strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/")
+}
+
+// Ancestors returns the paths of the parents of p, up to the root.
+func Ancestors(p string) []string {
+	var parents []string
+	for p != "/" && p != "." && p != "" {
+		p = path.Dir(p)
+		parents = append(parents, p)
+	}
+	return parents
+}
@@ -0,0 +1,82 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package locks
+
+import (
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+func TestCheck(t *testing.T) {
+	einstein := UserID(&userpb.UserId{OpaqueId: "einstein", Idp: "cernbox.cern.ch"})
+	marie := UserID(&userpb.UserId{OpaqueId: "marie", Idp: "cesnet.cz"})
+	ls := []*Lock{
+		{Token: "t1", Root: "/home/docs", Infinite: true, UserID: einstein},
+		{Token: "t2", Root: "/home/docs/notes.txt", UserID: einstein},
+	}
+
+	tests := []struct {
+		name   string
+		user   string
+		tokens []string
+		locked bool
+	}{
+		{"all tokens", einstein, []string{"t2", "t1"}, false},
+		{"missing token", einstein, []string{"t1"}, true},
+		{"no token", einstein, nil, true},
+		{"tokens of another user", marie, []string{"t1", "t2"}, true},
+	}
+	for _, tt := range tests {
+		err := Check(ls, tt.user, tt.tokens)
+		if _, ok := err.(errtypes.IsLocked); ok != tt.locked {
+			t.Errorf("%s: got %v, expected locked %v", tt.name, err, tt.locked)
+		}
+	}
+	if err := Check(nil, marie, nil); err != nil {
+		t.Errorf("expected no error without locks, got %v", err)
+	}
+}
+
+func TestTokensOpaque(t *testing.T) {
+	o := &typespb.Opaque{Map: map[string]*typespb.OpaqueEntry{"preconditions": {Decoder: "json", Value: []byte("{}")}}}
+	o, err := TokensToOpaque(o, []string{"t1", "t2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.Map["preconditions"]; !ok {
+		t.Error("expected the other opaque entries to be kept")
+	}
+	tokens, err := TokensFromOpaque(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[0] != "t1" || tokens[1] != "t2" {
+		t.Errorf("got tokens %v", tokens)
+	}
+
+	if o, _ := TokensToOpaque(nil, nil); o != nil {
+		t.Errorf("expected no opaque without tokens, got %v", o)
+	}
+	if tokens, err := TokensFromOpaque(nil); err != nil || tokens != nil {
+		t.Errorf("expected no tokens, got %v %v", tokens, err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/locks"
+	"github.com/cs3org/reva/pkg/storage/locks/registry"
+)
+
+func init() {
+	registry.Register("memory", New)
+}
+
+type manager struct {
+	mu sync.Mutex
+	// byToken holds the locks by their token.
+	byToken map[string]*locks.Lock
+	// byRoot holds the locks by the path they lock.
+	byRoot map[string]*locks.Lock
+}
+
+// New returns a lock manager keeping the locks in memory, they are lost
+// when revad restarts and not shared between instances.
+func New(m map[string]interface{}) (locks.Manager, error) {
+	return &manager{
+		byToken: map[string]*locks.Lock{},
+		byRoot:  map[string]*locks.Lock{},
+	}, nil
+}
+
+// expire removes the expired locks, the caller must hold the mutex.
+func (m *manager) expire() {
+	now := time.Now()
+	for tkn, l := range m.byToken {
+		if l.Expired(now) {
+			delete(m.byToken, tkn)
+			delete(m.byRoot, l.Root)
+		}
+	}
+}
+
+func (m *manager) Lock(ctx context.Context, l *locks.Lock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+
+	if len(m.find(l.Root, l.Infinite)) > 0 {
+		return errtypes.Locked(l.Root)
+	}
+	c := *l
+	m.byToken[l.Token] = &c
+	m.byRoot[l.Root] = &c
+	return nil
+}
+
+func (m *manager) Refresh(ctx context.Context, token string, expires time.Time) (*locks.Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+
+	l, ok := m.byToken[token]
+	if !ok {
+		return nil, errtypes.NotFound(token)
+	}
+	l.Expires = expires
+	c := *l
+	return &c, nil
+}
+
+func (m *manager) Unlock(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+
+	l, ok := m.byToken[token]
+	if !ok {
+		return errtypes.NotFound(token)
+	}
+	delete(m.byToken, token)
+	delete(m.byRoot, l.Root)
+	return nil
+}
+
+func (m *manager) Locks(ctx context.Context, p string, children bool) ([]*locks.Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+
+	return m.find(p, children), nil
+}
+
+// find returns copies of the locks covering p and, with children, of the
+// ones below it. The caller must hold the mutex.
+func (m *manager) find(p string, children bool) []*locks.Lock {
+	var found []*locks.Lock
+	for _, l := range m.byToken {
+		if l.Covers(p) || (children && locks.IsBelow(l.Root, p)) {
+			c := *l
+			found = append(found, &c)
+		}
+	}
+	return found
+}
@@ -0,0 +1,99 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/locks"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	m, _ := New(nil)
+
+	folder := &locks.Lock{Token: "t1", Root: "/home/folder", Infinite: true, Expires: time.Now().Add(time.Hour)}
+	if err := m.Lock(ctx, folder); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lock   *locks.Lock
+		locked bool
+	}{
+		{&locks.Lock{Token: "t2", Root: "/home/folder"}, true},
+		{&locks.Lock{Token: "t2", Root: "/home/folder/file"}, true},
+		{&locks.Lock{Token: "t2", Root: "/home/folder2"}, false},
+		{&locks.Lock{Token: "t3", Root: "/home", Infinite: true}, true},
+		{&locks.Lock{Token: "t3", Root: "/home"}, false},
+	}
+	for _, tt := range tests {
+		err := m.Lock(ctx, tt.lock)
+		if _, ok := err.(errtypes.IsLocked); ok != tt.locked {
+			t.Errorf("locking %s: got %v, want locked %v", tt.lock.Root, err, tt.locked)
+		}
+	}
+
+	ls, err := m.Locks(ctx, "/home/folder/file", false)
+	if err != nil || len(ls) != 1 || ls[0].Token != "t1" {
+		t.Fatalf("unexpected locks %v, %v", ls, err)
+	}
+	if ls, _ := m.Locks(ctx, "/", true); len(ls) != 3 {
+		t.Fatalf("got %d locks below /, want 3", len(ls))
+	}
+
+	if err := m.Unlock(ctx, "t1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Unlock(ctx, "t1"); err == nil {
+		t.Fatal("expected an error unlocking twice")
+	}
+	if err := m.Lock(ctx, &locks.Lock{Token: "t4", Root: "/home/folder/file"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	m, _ := New(nil)
+
+	l := &locks.Lock{Token: "t1", Root: "/file", Expires: time.Now().Add(-time.Second)}
+	if err := m.Lock(ctx, l); err != nil {
+		t.Fatal(err)
+	}
+	if ls, _ := m.Locks(ctx, "/file", false); len(ls) != 0 {
+		t.Fatal("expected the lock to expire")
+	}
+	if _, err := m.Refresh(ctx, "t1", time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("expected an error refreshing an expired lock")
+	}
+
+	l = &locks.Lock{Token: "t2", Root: "/file", Expires: time.Now().Add(time.Hour)}
+	if err := m.Lock(ctx, l); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(2 * time.Hour)
+	r, err := m.Refresh(ctx, "t2", expires)
+	if err != nil || !r.Expires.Equal(expires) {
+		t.Fatalf("unexpected refresh %v, %v", r, err)
+	}
+}
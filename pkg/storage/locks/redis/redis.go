@@ -0,0 +1,350 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage/locks"
+	"github.com/cs3org/reva/pkg/storage/locks/registry"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registry.Register("redis", New)
+}
+
+type config struct {
+	Address  string `mapstructure:"address"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// Prefix is prepended to the keys, to share a redis between
+	// deployments.
+	Prefix string `mapstructure:"prefix"`
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *config) init() {
+	if c.Address == "" {
+		c.Address = "localhost:6379"
+	}
+	if c.Prefix == "" {
+		c.Prefix = "reva:"
+	}
+}
+
+// manager keeps every lock as JSON under the path it locks, and the path
+// under the token of the lock. Both keys expire with the lock. The paths of
+// the locks are also added to a set under each of their ancestors, so the
+// locks below a path are found without scanning the keys. The sets are
+// cleaned up lazily, their members whose lock is gone are removed when read.
+type manager struct {
+	c    *config
+	pool *redis.Pool
+}
+
+// cleanScript removes the members of the below set in KEYS[1] whose lock is
+// gone and returns the others. ARGV[1] is the prefix of the lock keys.
+var cleanScript = redis.NewScript(1, `
+local roots = {}
+for _, root in ipairs(redis.call("SMEMBERS", KEYS[1])) do
+	if redis.call("EXISTS", ARGV[1] .. root) == 1 then
+		table.insert(roots, root)
+	else
+		redis.call("SREM", KEYS[1], root)
+	end
+end
+return roots
+`)
+
+// lockScript checks the conflicting locks and stores the lock atomically.
+// KEYS are the lock key, the token key and the below set of the root, then
+// the lock key and the below set of each ancestor. ARGV are the lock as
+// JSON, its ttl in milliseconds or 0, 1 for infinite locks, the root and
+// the prefix of the lock keys.
+var lockScript = redis.NewScript(-1, `
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+for i = 4, #KEYS, 2 do
+	local data = redis.call("GET", KEYS[i])
+	if data and cjson.decode(data).infinite then
+		return 0
+	end
+end
+if ARGV[3] == "1" then
+	for _, root in ipairs(redis.call("SMEMBERS", KEYS[3])) do
+		if redis.call("EXISTS", ARGV[5] .. root) == 1 then
+			return 0
+		end
+		redis.call("SREM", KEYS[3], root)
+	end
+end
+if ARGV[2] == "0" then
+	redis.call("SET", KEYS[1], ARGV[1])
+	redis.call("SET", KEYS[2], ARGV[4])
+else
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	redis.call("SET", KEYS[2], ARGV[4], "PX", ARGV[2])
+end
+for i = 5, #KEYS, 2 do
+	redis.call("SADD", KEYS[i], ARGV[4])
+end
+return 1
+`)
+
+// New returns a lock manager keeping the locks in redis, so they are shared
+// by all the revad instances.
+func New(m map[string]interface{}) (locks.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.init()
+
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+
+		Dial: func() (redis.Conn, error) {
+			opts := []redis.DialOption{redis.DialDatabase(c.DB)}
+			if c.Password != "" {
+				opts = append(opts, redis.DialPassword(c.Password))
+			}
+			return redis.Dial("tcp", c.Address, opts...)
+		},
+
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+	return &manager{c: c, pool: pool}, nil
+}
+
+func (m *manager) rootKey(p string) string {
+	return m.c.Prefix + "lock:" + p
+}
+
+func (m *manager) tokenKey(token string) string {
+	return m.c.Prefix + "locktoken:" + token
+}
+
+func (m *manager) belowKey(p string) string {
+	return m.c.Prefix + "lockbelow:" + p
+}
+
+// ttl returns the time to live of the lock in milliseconds, 0 for locks
+// that never expire.
+func ttl(l *locks.Lock) int64 {
+	if l.Expires.IsZero() {
+		return 0
+	}
+	if ms := time.Until(l.Expires).Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+// watch watches the token of the lock and the lock, and returns the lock.
+// The caller must UNWATCH if it does not run a transaction.
+func (m *manager) watch(conn redis.Conn, token string) (*locks.Lock, error) {
+	if _, err := conn.Do("WATCH", m.tokenKey(token)); err != nil {
+		return nil, errors.Wrap(err, "redis: error watching lock token")
+	}
+	root, err := redis.String(conn.Do("GET", m.tokenKey(token)))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, errtypes.NotFound(token)
+		}
+		return nil, errors.Wrap(err, "redis: error reading lock token")
+	}
+	if _, err := conn.Do("WATCH", m.rootKey(root)); err != nil {
+		return nil, errors.Wrap(err, "redis: error watching lock")
+	}
+	data, err := redis.Bytes(conn.Do("GET", m.rootKey(root)))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, errtypes.NotFound(token)
+		}
+		return nil, errors.Wrap(err, "redis: error reading lock")
+	}
+	l := &locks.Lock{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, errors.Wrap(err, "redis: error decoding lock")
+	}
+	if l.Token != token {
+		// the path was locked again after the lock expired
+		return nil, errtypes.NotFound(token)
+	}
+	return l, nil
+}
+
+// update runs fn on the lock with the token and executes the commands it
+// queued in a transaction, which is retried if the lock changed meanwhile.
+func (m *manager) update(conn redis.Conn, token string, fn func(l *locks.Lock) error) (*locks.Lock, error) {
+	for {
+		l, err := m.watch(conn, token)
+		if err != nil {
+			_, _ = conn.Do("UNWATCH")
+			return nil, err
+		}
+		if err := conn.Send("MULTI"); err != nil {
+			return nil, errors.Wrap(err, "redis: error starting transaction")
+		}
+		if err := fn(l); err != nil {
+			_, _ = conn.Do("DISCARD")
+			return nil, err
+		}
+		res, err := conn.Do("EXEC")
+		if err != nil {
+			return nil, errors.Wrap(err, "redis: error updating lock")
+		}
+		if res != nil {
+			return l, nil
+		}
+	}
+}
+
+// Lock stores the lock, the check for conflicting locks and the creation
+// run in a script so they are atomic.
+func (m *manager) Lock(ctx context.Context, l *locks.Lock) error {
+	conn := m.pool.Get()
+	defer conn.Close()
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return errors.Wrap(err, "redis: error encoding lock")
+	}
+	args := []interface{}{m.rootKey(l.Root), m.tokenKey(l.Token), m.belowKey(l.Root)}
+	for _, a := range locks.Ancestors(l.Root) {
+		args = append(args, m.rootKey(a), m.belowKey(a))
+	}
+	infinite := 0
+	if l.Infinite {
+		infinite = 1
+	}
+	args = append(args, data, ttl(l), infinite, l.Root, m.rootKey(""))
+
+	ok, err := redis.Bool(lockScript.Do(conn, append([]interface{}{len(args) - 5}, args...)...))
+	if err != nil {
+		return errors.Wrap(err, "redis: error storing lock")
+	}
+	if !ok {
+		return errtypes.Locked(l.Root)
+	}
+	return nil
+}
+
+func (m *manager) Refresh(ctx context.Context, token string, expires time.Time) (*locks.Lock, error) {
+	conn := m.pool.Get()
+	defer conn.Close()
+
+	return m.update(conn, token, func(l *locks.Lock) error {
+		l.Expires = expires
+		data, err := json.Marshal(l)
+		if err != nil {
+			return errors.Wrap(err, "redis: error encoding lock")
+		}
+		rootArgs := []interface{}{m.rootKey(l.Root), data}
+		tokenArgs := []interface{}{m.tokenKey(token), l.Root}
+		if ms := ttl(l); ms > 0 {
+			rootArgs = append(rootArgs, "PX", ms)
+			tokenArgs = append(tokenArgs, "PX", ms)
+		}
+		if err := conn.Send("SET", rootArgs...); err != nil {
+			return errors.Wrap(err, "redis: error storing lock")
+		}
+		return errors.Wrap(conn.Send("SET", tokenArgs...), "redis: error storing lock token")
+	})
+}
+
+func (m *manager) Unlock(ctx context.Context, token string) error {
+	conn := m.pool.Get()
+	defer conn.Close()
+
+	_, err := m.update(conn, token, func(l *locks.Lock) error {
+		if err := conn.Send("DEL", m.rootKey(l.Root), m.tokenKey(token)); err != nil {
+			return errors.Wrap(err, "redis: error removing lock")
+		}
+		for _, a := range locks.Ancestors(l.Root) {
+			if err := conn.Send("SREM", m.belowKey(a), l.Root); err != nil {
+				return errors.Wrap(err, "redis: error removing lock")
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (m *manager) Locks(ctx context.Context, p string, children bool) ([]*locks.Lock, error) {
+	conn := m.pool.Get()
+	defer conn.Close()
+
+	return m.find(conn, p, children)
+}
+
+// find returns the locks on p and its ancestors covering p and, with
+// children, the ones below it.
+func (m *manager) find(conn redis.Conn, p string, children bool) ([]*locks.Lock, error) {
+	roots := append([]string{p}, locks.Ancestors(p)...)
+	if children {
+		below, err := redis.Strings(cleanScript.Do(conn, m.belowKey(p), m.rootKey("")))
+		if err != nil {
+			return nil, errors.Wrap(err, "redis: error listing locks")
+		}
+		roots = append(roots, below...)
+	}
+	keys := make([]interface{}, 0, len(roots))
+	for _, r := range roots {
+		keys = append(keys, m.rootKey(r))
+	}
+
+	values, err := redis.ByteSlices(conn.Do("MGET", keys...))
+	if err != nil {
+		return nil, errors.Wrap(err, "redis: error reading locks")
+	}
+	var found []*locks.Lock
+	for _, data := range values {
+		if data == nil {
+			continue
+		}
+		l := &locks.Lock{}
+		if err := json.Unmarshal(data, l); err != nil {
+			return nil, errors.Wrap(err, "redis: error decoding lock")
+		}
+		if l.Covers(p) || (children && locks.IsBelow(l.Root, p)) {
+			found = append(found, l)
+		}
+	}
+	return found, nil
+}
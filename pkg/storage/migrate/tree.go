@@ -0,0 +1,553 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/rhttp"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+	"github.com/pkg/errors"
+)
+
+// Options configures the migration of a tree between two storage providers.
+type Options struct {
+	// Source and Target are the paths of the folders in the gateway namespace.
+	Source string
+	Target string
+	// StateFile records the migrated files and links, so that an interrupted
+	// migration can be resumed. Optional.
+	StateFile string
+	Metadata  bool
+	Versions  bool
+	Shares    bool
+}
+
+// Item is a resource that was skipped or could not be migrated.
+type Item struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Link is a public link recreated on the target, with a new token.
+type Link struct {
+	Path     string `json:"path"`
+	OldToken string `json:"old_token"`
+	NewToken string `json:"new_token"`
+}
+
+// Report summarizes a migration.
+type Report struct {
+	Folders  int     `json:"folders"`
+	Files    int     `json:"files"`
+	Resumed  int     `json:"resumed"`
+	Versions int     `json:"versions"`
+	Bytes    int64   `json:"bytes"`
+	Shares   int     `json:"shares"`
+	Links    []*Link `json:"links"`
+	Skipped  []*Item `json:"skipped"`
+	Failed   []*Item `json:"failed"`
+}
+
+func (r *Report) skip(p, reason string) {
+	r.Skipped = append(r.Skipped, &Item{Path: p, Reason: reason})
+}
+
+func (r *Report) fail(p string, err error) {
+	r.Failed = append(r.Failed, &Item{Path: p, Reason: err.Error()})
+}
+
+// stateEntry is a line of the state file, recording either a migrated
+// file and the etag it had on the source or a recreated public link.
+type stateEntry struct {
+	Path string `json:"path,omitempty"`
+	Etag string `json:"etag,omitempty"`
+	Link string `json:"link,omitempty"`
+}
+
+type migration struct {
+	client gateway.GatewayAPIClient
+	opts   *Options
+	report *Report
+
+	// the files and links migrated by a previous run
+	done  map[string]string
+	links map[string]bool
+	state *os.File
+
+	// the relative paths of the source resources, keyed by their id
+	ids map[string]string
+}
+
+// MigrateTree copies the tree below opts.Source to opts.Target through the
+// CS3 APIs, along with the metadata, versions and shares when requested.
+// Failures affecting single resources are collected in the report, an error
+// is only returned if the migration could not be carried out at all.
+func MigrateTree(ctx context.Context, client gateway.GatewayAPIClient, opts *Options) (*Report, error) {
+	m := &migration{
+		client: client,
+		opts:   opts,
+		report: &Report{},
+		done:   map[string]string{},
+		links:  map[string]bool{},
+		ids:    map[string]string{},
+	}
+	if opts.StateFile != "" {
+		if err := m.loadState(); err != nil {
+			return nil, err
+		}
+		defer m.state.Close()
+	}
+
+	root, err := stat(ctx, client, opts.Source)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil || root.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return nil, fmt.Errorf("migrate: %s is not a folder", opts.Source)
+	}
+	if err := ensureContainer(ctx, client, opts.Target); err != nil {
+		return nil, err
+	}
+	m.ids[resourceKey(root.Id)] = ""
+
+	if err := m.copyTree(ctx, root.Path); err != nil {
+		return nil, err
+	}
+	if opts.Shares {
+		if err := m.copyShares(ctx); err != nil {
+			return nil, err
+		}
+		if err := m.copyLinks(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return m.report, nil
+}
+
+func (m *migration) loadState() error {
+	fd, err := os.OpenFile(m.opts.StateFile, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "migrate: error opening state file")
+	}
+	lines := bufio.NewScanner(fd)
+	for lines.Scan() {
+		var e stateEntry
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			// the last line may be truncated if the migration was killed
+			continue
+		}
+		if e.Link != "" {
+			m.links[e.Link] = true
+		} else {
+			m.done[e.Path] = e.Etag
+		}
+	}
+	if err := lines.Err(); err != nil {
+		fd.Close()
+		return errors.Wrap(err, "migrate: error reading state file")
+	}
+	m.state = fd
+	return nil
+}
+
+func (m *migration) record(e *stateEntry) error {
+	if m.state == nil {
+		return nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = m.state.Write(append(b, '\n'))
+	return err
+}
+
+// copyTree walks the source breadth first, creating the folders on the
+// target before the files they contain.
+func (m *migration) copyTree(ctx context.Context, root string) error {
+	folders := []string{root}
+	for len(folders) > 0 {
+		fn := folders[0]
+		folders = folders[1:]
+
+		ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+		res, err := m.client.ListContainer(ctx, &provider.ListContainerRequest{Ref: ref})
+		if err != nil {
+			return err
+		}
+		if res.Status.Code != rpc.Code_CODE_OK {
+			if fn == root {
+				return formatError(res.Status)
+			}
+			m.report.fail(relPath(root, fn), formatError(res.Status))
+			continue
+		}
+		for _, info := range res.Infos {
+			rel := relPath(root, info.Path)
+			m.ids[resourceKey(info.Id)] = rel
+			target := path.Join(m.opts.Target, rel)
+			switch info.Type {
+			case provider.ResourceType_RESOURCE_TYPE_CONTAINER:
+				if err := ensureContainer(ctx, m.client, target); err != nil {
+					m.report.fail(rel, err)
+					continue
+				}
+				m.report.Folders++
+				folders = append(folders, info.Path)
+			case provider.ResourceType_RESOURCE_TYPE_FILE:
+				if err := m.copyFile(ctx, rel, info); err != nil {
+					m.report.fail(rel, err)
+				}
+			default:
+				m.report.skip(rel, fmt.Sprintf("unsupported resource type %s", info.Type))
+			}
+		}
+	}
+	return nil
+}
+
+// copyFile copies the versions of the file, oldest first, then its current
+// content and metadata, and records it in the state file.
+func (m *migration) copyFile(ctx context.Context, rel string, info *provider.ResourceInfo) error {
+	target := path.Join(m.opts.Target, rel)
+	if etag, ok := m.done[rel]; ok && etag == info.Etag {
+		if t, err := stat(ctx, m.client, target); err == nil && t != nil {
+			m.report.Resumed++
+			return nil
+		}
+	}
+
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: info.Path}}
+	if m.opts.Versions {
+		res, err := m.client.ListFileVersions(ctx, &provider.ListFileVersionsRequest{Ref: ref})
+		switch {
+		case err != nil:
+			return err
+		case res.Status.Code != rpc.Code_CODE_OK:
+			m.report.skip(rel, "versions not migrated: "+res.Status.Message)
+		default:
+			versions := res.Versions
+			sort.Slice(versions, func(i, j int) bool { return versions[i].Mtime < versions[j].Mtime })
+			for _, v := range versions {
+				opaque := &types.Opaque{
+					Map: map[string]*types.OpaqueEntry{
+						"version": &types.OpaqueEntry{Decoder: "plain", Value: []byte(v.Key)},
+					},
+				}
+				if _, err := m.copyContent(ctx, ref, opaque, v.Size, "", target); err != nil {
+					return errors.Wrapf(err, "version %s", v.Key)
+				}
+				m.report.Versions++
+			}
+		}
+	}
+
+	h, err := m.copyContent(ctx, ref, nil, info.Size, checksums.FromResourceInfo(info), target)
+	if err != nil {
+		return err
+	}
+	t, err := stat(ctx, m.client, target)
+	if err != nil {
+		return err
+	}
+	if t == nil || t.Size != info.Size {
+		return fmt.Errorf("size mismatch on the target after upload")
+	}
+	if xs := checksums.FromResourceInfo(t); xs != "" {
+		if err := h.Verify(xs); err != nil {
+			return err
+		}
+	}
+
+	if m.opts.Metadata {
+		if err := m.copyMetadata(ctx, info, target); err != nil {
+			m.report.skip(rel, "metadata not migrated: "+err.Error())
+		}
+	}
+
+	m.report.Files++
+	m.report.Bytes += int64(info.Size)
+	return m.record(&stateEntry{Path: rel, Etag: info.Etag})
+}
+
+// copyContent streams the content of the source to the target, sending the
+// source checksum, if known, for the data server to verify. It returns the
+// checksums of the data transferred.
+func (m *migration) copyContent(ctx context.Context, src *provider.Reference, opaque *types.Opaque, size uint64, checksum, target string) (*checksums.Hasher, error) {
+	dRes, err := m.client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{Opaque: opaque, Ref: src})
+	if err != nil {
+		return nil, err
+	}
+	if dRes.Status.Code != rpc.Code_CODE_OK {
+		return nil, formatError(dRes.Status)
+	}
+	getReq, err := rhttp.NewRequest(ctx, http.MethodGet, dRes.DownloadEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	getReq.Header.Set("X-Reva-Transfer", dRes.Token)
+	// large files take longer than the default timeout to transfer
+	httpClient := *rhttp.GetHTTPClient(ctx)
+	httpClient.Timeout = 0
+	getRes, err := httpClient.Do(getReq)
+	if err != nil {
+		return nil, err
+	}
+	defer getRes.Body.Close()
+	if getRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %s", getRes.Status)
+	}
+
+	uRes, err := m.client.InitiateFileUpload(ctx, &provider.InitiateFileUploadRequest{
+		Ref: &provider.Reference{Spec: &provider.Reference_Path{Path: target}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if uRes.Status.Code != rpc.Code_CODE_OK {
+		return nil, formatError(uRes.Status)
+	}
+
+	h := checksums.NewHasher()
+	var body io.Reader = http.NoBody
+	if size > 0 {
+		body = io.TeeReader(getRes.Body, h)
+	}
+	putReq, err := rhttp.NewRequest(ctx, http.MethodPut, uRes.UploadEndpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	putReq.ContentLength = int64(size)
+	putReq.Header.Set("X-Reva-Transfer", uRes.Token)
+	if checksum != "" {
+		putReq.Header.Set("OC-Checksum", checksum)
+	}
+	putRes, err := httpClient.Do(putReq)
+	if err != nil {
+		return nil, err
+	}
+	defer putRes.Body.Close()
+
+	switch putRes.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	case http.StatusBadRequest:
+		return nil, fmt.Errorf("rejected by the data server, the checksum does not match")
+	default:
+		return nil, fmt.Errorf("upload failed: %s", putRes.Status)
+	}
+	if checksum != "" {
+		if err := h.Verify(checksum); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// copyMetadata copies the arbitrary metadata and the modification time of
+// the source file. The checksums are computed by the target on upload.
+func (m *migration) copyMetadata(ctx context.Context, info *provider.ResourceInfo, target string) error {
+	md := map[string]string{}
+	for k, v := range info.GetArbitraryMetadata().GetMetadata() {
+		if k != checksums.MetadataKey {
+			md[k] = v
+		}
+	}
+	if info.Mtime != nil {
+		md["mtime"] = strconv.FormatUint(info.Mtime.Seconds, 10)
+	}
+	res, err := m.client.SetArbitraryMetadata(ctx, &provider.SetArbitraryMetadataRequest{
+		Ref:               &provider.Reference{Spec: &provider.Reference_Path{Path: target}},
+		ArbitraryMetadata: &provider.ArbitraryMetadata{Metadata: md},
+	})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return formatError(res.Status)
+	}
+	return nil
+}
+
+// copyShares recreates the shares of the user on the migrated resources.
+// Shares already present on the target are left untouched.
+func (m *migration) copyShares(ctx context.Context) error {
+	res, err := m.client.ListShares(ctx, &collaboration.ListSharesRequest{})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return formatError(res.Status)
+	}
+	for _, s := range res.Shares {
+		rel, ok := m.ids[resourceKey(s.ResourceId)]
+		if !ok {
+			continue
+		}
+		info, err := m.targetInfo(ctx, rel)
+		if err != nil {
+			m.report.fail(rel, errors.Wrap(err, "share"))
+			continue
+		}
+		cRes, err := m.client.CreateShare(ctx, &collaboration.CreateShareRequest{
+			ResourceInfo: info,
+			Grant: &collaboration.ShareGrant{
+				Grantee:     s.Grantee,
+				Permissions: s.Permissions,
+			},
+		})
+		switch {
+		case err != nil:
+			m.report.fail(rel, errors.Wrap(err, "share"))
+		case cRes.Status.Code == rpc.Code_CODE_ALREADY_EXISTS:
+			m.report.skip(rel, "share already exists on the target")
+		case cRes.Status.Code != rpc.Code_CODE_OK:
+			m.report.fail(rel, errors.Wrap(formatError(cRes.Status), "share"))
+		default:
+			m.report.Shares++
+		}
+	}
+	return nil
+}
+
+// copyLinks recreates the public links of the user on the migrated
+// resources. The links get new tokens, and password protected links are
+// skipped as their passwords cannot be read back.
+func (m *migration) copyLinks(ctx context.Context) error {
+	res, err := m.client.ListPublicShares(ctx, &link.ListPublicSharesRequest{})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return formatError(res.Status)
+	}
+	for _, s := range res.Share {
+		rel, ok := m.ids[resourceKey(s.ResourceId)]
+		if !ok || m.links[s.Token] {
+			continue
+		}
+		if s.PasswordProtected {
+			m.report.skip(rel, "password protected public link "+s.Token)
+			continue
+		}
+		info, err := m.targetInfo(ctx, rel)
+		if err != nil {
+			m.report.fail(rel, errors.Wrap(err, "public link"))
+			continue
+		}
+		cRes, err := m.client.CreatePublicShare(ctx, &link.CreatePublicShareRequest{
+			ResourceInfo: info,
+			Grant: &link.Grant{
+				Permissions: s.Permissions,
+				Expiration:  s.Expiration,
+			},
+		})
+		if err == nil && cRes.Status.Code != rpc.Code_CODE_OK {
+			err = formatError(cRes.Status)
+		}
+		if err != nil {
+			m.report.fail(rel, errors.Wrap(err, "public link"))
+			continue
+		}
+		m.report.Links = append(m.report.Links, &Link{Path: rel, OldToken: s.Token, NewToken: cRes.Share.Token})
+		if err := m.record(&stateEntry{Link: s.Token}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migration) targetInfo(ctx context.Context, rel string) (*provider.ResourceInfo, error) {
+	info, err := stat(ctx, m.client, path.Join(m.opts.Target, rel))
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, fmt.Errorf("not found on the target")
+	}
+	return info, nil
+}
+
+// stat returns the info of the resource, or nil if it does not exist.
+func stat(ctx context.Context, client gateway.GatewayAPIClient, fn string) (*provider.ResourceInfo, error) {
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+	res, err := client.Stat(ctx, &provider.StatRequest{Ref: ref})
+	if err != nil {
+		return nil, err
+	}
+	switch res.Status.Code {
+	case rpc.Code_CODE_OK:
+		return res.Info, nil
+	case rpc.Code_CODE_NOT_FOUND:
+		return nil, nil
+	default:
+		return nil, formatError(res.Status)
+	}
+}
+
+// ensureContainer creates the folder if it does not exist.
+func ensureContainer(ctx context.Context, client gateway.GatewayAPIClient, fn string) error {
+	info, err := stat(ctx, client, fn)
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		if info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
+			return fmt.Errorf("%s exists and is not a folder", fn)
+		}
+		return nil
+	}
+	ref := &provider.Reference{Spec: &provider.Reference_Path{Path: fn}}
+	res, err := client.CreateContainer(ctx, &provider.CreateContainerRequest{Ref: ref})
+	if err != nil {
+		return err
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return formatError(res.Status)
+	}
+	return nil
+}
+
+func relPath(root, fn string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(fn, root), "/")
+}
+
+func resourceKey(id *provider.ResourceId) string {
+	return id.GetStorageId() + ":" + id.GetOpaqueId()
+}
+
+func formatError(s *rpc.Status) error {
+	return fmt.Errorf("%s: %s", s.Code, s.Message)
+}
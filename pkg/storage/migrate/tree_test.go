@@ -0,0 +1,285 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package migrate
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage/checksums"
+	"google.golang.org/grpc"
+)
+
+// fakeGateway serves an in memory tree, keeping the previous contents of
+// overwritten files as versions.
+type fakeGateway struct {
+	gateway.GatewayAPIClient
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	dirs     map[string]bool
+	files    map[string][]byte
+	versions map[string][][]byte
+	metadata map[string]map[string]string
+	shares   []*collaboration.Share
+	links    []*link.PublicShare
+	created  []*collaboration.CreateShareRequest
+	uploads  int
+}
+
+func newFakeGateway() *fakeGateway {
+	g := &fakeGateway{
+		dirs:     map[string]bool{"/": true},
+		files:    map[string][]byte{},
+		versions: map[string][][]byte{},
+		metadata: map[string]map[string]string{},
+	}
+	g.srv = httptest.NewServer(http.HandlerFunc(g.serveData))
+	return g
+}
+
+func (g *fakeGateway) serveData(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fn := r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		content := g.files[fn]
+		if v := r.URL.Query().Get("version"); v != "" {
+			i, _ := strconv.Atoi(v)
+			content = g.versions[fn][i]
+		}
+		_, _ = w.Write(content)
+	case http.MethodPut:
+		h := checksums.NewHasher()
+		b, _ := ioutil.ReadAll(r.Body)
+		_, _ = h.Write(b)
+		if xs := r.Header.Get("OC-Checksum"); xs != "" && h.Verify(xs) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if old, ok := g.files[fn]; ok {
+			g.versions[fn] = append(g.versions[fn], old)
+		}
+		g.files[fn] = b
+		g.uploads++
+	}
+}
+
+func (g *fakeGateway) info(fn string) *provider.ResourceInfo {
+	id := &provider.ResourceId{StorageId: "fake", OpaqueId: fn}
+	if g.dirs[fn] {
+		return &provider.ResourceInfo{Id: id, Path: fn, Type: provider.ResourceType_RESOURCE_TYPE_CONTAINER}
+	}
+	content, ok := g.files[fn]
+	if !ok {
+		return nil
+	}
+	sum := sha1.Sum(content)
+	md := map[string]string{checksums.MetadataKey: "SHA1:" + hex.EncodeToString(sum[:])}
+	for k, v := range g.metadata[fn] {
+		md[k] = v
+	}
+	return &provider.ResourceInfo{
+		Id:                id,
+		Path:              fn,
+		Type:              provider.ResourceType_RESOURCE_TYPE_FILE,
+		Size:              uint64(len(content)),
+		Etag:              hex.EncodeToString(sum[:]),
+		ArbitraryMetadata: &provider.ArbitraryMetadata{Metadata: md},
+	}
+}
+
+func (g *fakeGateway) Stat(ctx context.Context, req *provider.StatRequest, opts ...grpc.CallOption) (*provider.StatResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if info := g.info(req.Ref.GetPath()); info != nil {
+		return &provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, Info: info}, nil
+	}
+	return &provider.StatResponse{Status: &rpc.Status{Code: rpc.Code_CODE_NOT_FOUND}}, nil
+}
+
+func (g *fakeGateway) ListContainer(ctx context.Context, req *provider.ListContainerRequest, opts ...grpc.CallOption) (*provider.ListContainerResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var infos []*provider.ResourceInfo
+	for fn := range g.dirs {
+		if fn != "/" && path.Dir(fn) == req.Ref.GetPath() {
+			infos = append(infos, g.info(fn))
+		}
+	}
+	for fn := range g.files {
+		if path.Dir(fn) == req.Ref.GetPath() {
+			infos = append(infos, g.info(fn))
+		}
+	}
+	return &provider.ListContainerResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, Infos: infos}, nil
+}
+
+func (g *fakeGateway) CreateContainer(ctx context.Context, req *provider.CreateContainerRequest, opts ...grpc.CallOption) (*provider.CreateContainerResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.dirs[req.Ref.GetPath()] = true
+	return &provider.CreateContainerResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil
+}
+
+func (g *fakeGateway) InitiateFileDownload(ctx context.Context, req *provider.InitiateFileDownloadRequest, opts ...grpc.CallOption) (*gateway.InitiateFileDownloadResponse, error) {
+	endpoint := g.srv.URL + req.Ref.GetPath()
+	if e, ok := req.GetOpaque().GetMap()["version"]; ok {
+		endpoint += "?version=" + string(e.Value)
+	}
+	return &gateway.InitiateFileDownloadResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, DownloadEndpoint: endpoint}, nil
+}
+
+func (g *fakeGateway) InitiateFileUpload(ctx context.Context, req *provider.InitiateFileUploadRequest, opts ...grpc.CallOption) (*gateway.InitiateFileUploadResponse, error) {
+	return &gateway.InitiateFileUploadResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, UploadEndpoint: g.srv.URL + req.Ref.GetPath()}, nil
+}
+
+func (g *fakeGateway) ListFileVersions(ctx context.Context, req *provider.ListFileVersionsRequest, opts ...grpc.CallOption) (*provider.ListFileVersionsResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var versions []*provider.FileVersion
+	for i, content := range g.versions[req.Ref.GetPath()] {
+		versions = append(versions, &provider.FileVersion{Key: strconv.Itoa(i), Size: uint64(len(content)), Mtime: uint64(i)})
+	}
+	return &provider.ListFileVersionsResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, Versions: versions}, nil
+}
+
+func (g *fakeGateway) SetArbitraryMetadata(ctx context.Context, req *provider.SetArbitraryMetadataRequest, opts ...grpc.CallOption) (*provider.SetArbitraryMetadataResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.metadata[req.Ref.GetPath()] = req.ArbitraryMetadata.Metadata
+	return &provider.SetArbitraryMetadataResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil
+}
+
+func (g *fakeGateway) ListShares(ctx context.Context, req *collaboration.ListSharesRequest, opts ...grpc.CallOption) (*collaboration.ListSharesResponse, error) {
+	return &collaboration.ListSharesResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, Shares: g.shares}, nil
+}
+
+func (g *fakeGateway) CreateShare(ctx context.Context, req *collaboration.CreateShareRequest, opts ...grpc.CallOption) (*collaboration.CreateShareResponse, error) {
+	g.created = append(g.created, req)
+	return &collaboration.CreateShareResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil
+}
+
+func (g *fakeGateway) ListPublicShares(ctx context.Context, req *link.ListPublicSharesRequest, opts ...grpc.CallOption) (*link.ListPublicSharesResponse, error) {
+	return &link.ListPublicSharesResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}, Share: g.links}, nil
+}
+
+func (g *fakeGateway) CreatePublicShare(ctx context.Context, req *link.CreatePublicShareRequest, opts ...grpc.CallOption) (*link.CreatePublicShareResponse, error) {
+	return &link.CreatePublicShareResponse{
+		Status: &rpc.Status{Code: rpc.Code_CODE_OK},
+		Share:  &link.PublicShare{Token: "new-" + req.ResourceInfo.Id.OpaqueId},
+	}, nil
+}
+
+func TestMigrateTree(t *testing.T) {
+	g := newFakeGateway()
+	defer g.srv.Close()
+	g.dirs["/src"] = true
+	g.dirs["/src/docs"] = true
+	g.files["/src/a.txt"] = []byte("a")
+	g.files["/src/docs/b.txt"] = []byte("b2")
+	g.files["/src/docs/empty"] = []byte{}
+	g.versions["/src/docs/b.txt"] = [][]byte{[]byte("b0"), []byte("b1")}
+	g.metadata["/src/a.txt"] = map[string]string{"color": "red"}
+	g.shares = []*collaboration.Share{
+		{ResourceId: &provider.ResourceId{StorageId: "fake", OpaqueId: "/src/docs"}},
+		{ResourceId: &provider.ResourceId{StorageId: "fake", OpaqueId: "/elsewhere"}},
+	}
+	g.links = []*link.PublicShare{
+		{Token: "open", ResourceId: &provider.ResourceId{StorageId: "fake", OpaqueId: "/src/a.txt"}},
+		{Token: "secret", PasswordProtected: true, ResourceId: &provider.ResourceId{StorageId: "fake", OpaqueId: "/src/a.txt"}},
+	}
+
+	dir, err := ioutil.TempDir("", "reva-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := &Options{
+		Source:    "/src",
+		Target:    "/dst",
+		StateFile: filepath.Join(dir, "state.jsonl"),
+		Metadata:  true,
+		Versions:  true,
+		Shares:    true,
+	}
+	report, err := MigrateTree(context.Background(), g, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failed) > 0 {
+		t.Fatalf("unexpected failures: %+v", report.Failed[0])
+	}
+	if report.Folders != 1 || report.Files != 3 || report.Versions != 2 || report.Bytes != 3 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	for fn, want := range map[string]string{"/dst/a.txt": "a", "/dst/docs/b.txt": "b2", "/dst/docs/empty": ""} {
+		if got := string(g.files[fn]); got != want {
+			t.Errorf("%s: got %q, want %q", fn, got, want)
+		}
+	}
+	if v := g.versions["/dst/docs/b.txt"]; len(v) != 2 || string(v[0]) != "b0" || string(v[1]) != "b1" {
+		t.Errorf("versions not migrated in order: %q", v)
+	}
+	if g.metadata["/dst/a.txt"]["color"] != "red" {
+		t.Errorf("metadata not migrated: %v", g.metadata["/dst/a.txt"])
+	}
+	if len(g.created) != 1 || g.created[0].ResourceInfo.Path != "/dst/docs" {
+		t.Errorf("expected the share on /dst/docs to be recreated, got %v", g.created)
+	}
+	if len(report.Links) != 1 || report.Links[0].OldToken != "open" || report.Links[0].NewToken != "new-/dst/a.txt" {
+		t.Errorf("unexpected links: %+v", report.Links)
+	}
+	if len(report.Skipped) != 1 || !strings.Contains(report.Skipped[0].Reason, "secret") {
+		t.Errorf("expected the password protected link to be skipped, got %+v", report.Skipped)
+	}
+
+	// a second run only migrates what changed since
+	g.files["/src/a.txt"] = []byte("aa")
+	uploads := g.uploads
+	report, err = MigrateTree(context.Background(), g, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 1 || report.Resumed != 2 || len(report.Links) != 0 {
+		t.Errorf("unexpected report on resume: %+v", report)
+	}
+	if g.uploads-uploads != 1 || string(g.files["/dst/a.txt"]) != "aa" {
+		t.Errorf("expected only a.txt to be uploaded again, got %d uploads", g.uploads-uploads)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package propagator propagates the changes of the files to their ancestor
+// folders, so that the etag and the mtime of a folder change whenever
+// something below it does and the sync clients only need to stat the root
+// folder to detect changes.
+package propagator
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Config configures the propagation.
+type Config struct {
+	// Disabled turns the propagation off, only the folders whose entries
+	// change are updated then.
+	Disabled bool `mapstructure:"disabled"`
+	// Depth is the number of ancestors updated, 0 updates all of them up
+	// to the root.
+	Depth int `mapstructure:"depth"`
+	// Delay is the number of milliseconds the changes are collected before
+	// the ancestors are updated, the ancestors shared by the changes being
+	// updated once. With 0 they are updated right away.
+	Delay int `mapstructure:"delay"`
+}
+
+// TouchFunc marks the folder as changed at t.
+type TouchFunc func(dir string, t time.Time) error
+
+// Propagator updates the ancestors of the changed files.
+type Propagator struct {
+	conf  Config
+	touch TouchFunc
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+	timer   *time.Timer
+}
+
+// New returns a propagator updating the folders with touch.
+func New(c Config, touch TouchFunc) *Propagator {
+	return &Propagator{conf: c, touch: touch, pending: map[string]struct{}{}}
+}
+
+// Touch sets the mtime of the folder, the touch of the local filesystems.
+func Touch(dir string, t time.Time) error {
+	return os.Chtimes(dir, t, t)
+}
+
+// Propagate marks the ancestors of fn as changed, up to root included.
+func (p *Propagator) Propagate(root, fn string) {
+	if p == nil || p.conf.Disabled {
+		return
+	}
+	dirs := ancestors(root, fn, p.conf.Depth)
+	if p.conf.Delay <= 0 {
+		now := time.Now()
+		for _, d := range dirs {
+			p.update(d, now)
+		}
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, d := range dirs {
+		p.pending[d] = struct{}{}
+	}
+	if p.timer == nil && len(p.pending) > 0 {
+		p.timer = time.AfterFunc(time.Duration(p.conf.Delay)*time.Millisecond, p.Flush)
+	}
+}
+
+// Flush updates the ancestors of the changes collected so far.
+func (p *Propagator) Flush() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = map[string]struct{}{}
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.mu.Unlock()
+
+	now := time.Now()
+	for d := range pending {
+		p.update(d, now)
+	}
+}
+
+func (p *Propagator) update(dir string, t time.Time) {
+	// the folder may have been removed in the meantime
+	if err := p.touch(dir, t); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Str("dir", dir).Msg("propagator: error updating folder")
+	}
+}
+
+// ancestors returns the folders above fn up to root included, at most depth
+// of them if it is positive.
+func ancestors(root, fn string, depth int) []string {
+	root, fn = path.Clean(root), path.Clean(fn)
+	if fn == root || !strings.HasPrefix(fn, strings.TrimSuffix(root, "/")+"/") {
+		return nil
+	}
+	dirs := []string{}
+	for d := path.Dir(fn); ; d = path.Dir(d) {
+		dirs = append(dirs, d)
+		if d == root || len(dirs) == depth {
+			break
+		}
+	}
+	return dirs
+}
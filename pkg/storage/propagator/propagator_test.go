@@ -0,0 +1,107 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package propagator
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAncestors(t *testing.T) {
+	tests := []struct {
+		root, fn string
+		depth    int
+		expected []string
+	}{
+		{"/data/einstein", "/data/einstein/a/b/file.txt", 0, []string{"/data/einstein/a/b", "/data/einstein/a", "/data/einstein"}},
+		{"/data/einstein/", "/data/einstein/a/b/file.txt", 2, []string{"/data/einstein/a/b", "/data/einstein/a"}},
+		{"/data/einstein", "/data/einstein/file.txt", 5, []string{"/data/einstein"}},
+		{"/", "/a/file.txt", 0, []string{"/a", "/"}},
+		{"/data/einstein", "/data/einstein", 0, nil},
+		{"/data/einstein", "/data/marie/file.txt", 0, nil},
+	}
+	for _, tt := range tests {
+		if got := ancestors(tt.root, tt.fn, tt.depth); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ancestors(%q, %q, %d) = %v, expected %v", tt.root, tt.fn, tt.depth, got, tt.expected)
+		}
+	}
+}
+
+func TestPropagate(t *testing.T) {
+	root, err := ioutil.TempDir("", "propagator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := path.Join(root, "a", "b")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, d := range []string{root, path.Join(root, "a"), dir} {
+		if err := os.Chtimes(d, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	New(Config{Depth: 2}, Touch).Propagate(root, path.Join(dir, "file.txt"))
+	for d, changed := range map[string]bool{dir: true, path.Join(root, "a"): true, root: false} {
+		fi, err := os.Stat(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.ModTime().After(old) != changed {
+			t.Errorf("unexpected mtime %s of %s", fi.ModTime(), d)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var mu sync.Mutex
+	touched := map[string]int{}
+	p := New(Config{Delay: 1000}, func(dir string, t time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		touched[dir]++
+		return nil
+	})
+
+	p.Propagate("/data", "/data/a/file1.txt")
+	p.Propagate("/data", "/data/a/file2.txt")
+	p.Propagate("/data", "/data/b/file3.txt")
+	mu.Lock()
+	if len(touched) != 0 {
+		t.Errorf("expected the changes to be collected, got %v", touched)
+	}
+	mu.Unlock()
+
+	p.Flush()
+	expected := map[string]int{"/data/a": 1, "/data/b": 1, "/data": 1}
+	if !reflect.DeepEqual(touched, expected) {
+		t.Errorf("expected %v, got %v", expected, touched)
+	}
+
+	// a disabled propagator does nothing
+	New(Config{Disabled: true}, nil).Propagate("/data", "/data/a/file1.txt")
+}
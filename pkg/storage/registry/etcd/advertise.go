@@ -0,0 +1,151 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	registrypb "github.com/cs3org/go-cs3apis/cs3/storage/registry/v1beta1"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type advertiser struct {
+	c      *config
+	cli    *clientv3.Client
+	key    string
+	value  string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu    sync.Mutex
+	lease clientv3.LeaseID
+}
+
+// Advertise registers the provider under the etcd prefix read by the etcd
+// registry and keeps it registered, with a lease refreshed in the background,
+// until the returned io.Closer is closed. The address of the configuration
+// is used when info has none.
+func Advertise(m map[string]interface{}, info *registrypb.ProviderInfo) (io.Closer, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	if info.Address == "" {
+		info.Address = c.Address
+	}
+	if info.Address == "" {
+		return nil, errors.New("etcd: the address of the provider to register is missing")
+	}
+
+	value, err := json.Marshal(&entry{
+		Address:      info.Address,
+		ProviderPath: info.ProviderPath,
+		ProviderID:   info.ProviderId,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "etcd: error encoding provider")
+	}
+
+	cli, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &advertiser{
+		c:      c,
+		cli:    cli,
+		key:    c.Prefix + info.Address,
+		value:  string(value),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go a.run(ctx)
+	return a, nil
+}
+
+// run registers the provider again whenever the lease is lost, e.g. when
+// etcd was unreachable for longer than the ttl.
+func (a *advertiser) run(ctx context.Context) {
+	defer close(a.done)
+	for {
+		err := a.register(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Str("key", a.key).Msg("etcd: storage provider registration lost, retrying")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (a *advertiser) register(ctx context.Context) error {
+	lease, err := a.cli.Grant(ctx, int64(a.c.TTL))
+	if err != nil {
+		return errors.Wrap(err, "etcd: error granting lease")
+	}
+	if _, err := a.cli.Put(ctx, a.key, a.value, clientv3.WithLease(lease.ID)); err != nil {
+		return errors.Wrap(err, "etcd: error registering provider")
+	}
+
+	a.mu.Lock()
+	a.lease = lease.ID
+	a.mu.Unlock()
+	log.Info().Str("key", a.key).Msg("etcd: storage provider registered")
+
+	ch, err := a.cli.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		return errors.Wrap(err, "etcd: error refreshing lease")
+	}
+	for range ch {
+	}
+	return errors.New("etcd: lease expired")
+}
+
+// Close unregisters the provider.
+func (a *advertiser) Close() error {
+	a.cancel()
+	<-a.done
+
+	a.mu.Lock()
+	lease := a.lease
+	a.mu.Unlock()
+
+	var err error
+	if lease != 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.c.DialTimeout)*time.Second)
+		defer cancel()
+		if _, err = a.cli.Revoke(ctx, lease); err != nil {
+			err = errors.Wrap(err, "etcd: error unregistering provider")
+		}
+	}
+	if cerr := a.cli.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
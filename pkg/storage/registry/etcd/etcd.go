@@ -0,0 +1,292 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package etcd implements a storage registry where the storage providers
+// register themselves under an etcd prefix.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	registrypb "github.com/cs3org/go-cs3apis/cs3/storage/registry/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/storage/registry/registry"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func init() {
+	registry.Register("etcd", New)
+}
+
+// DefaultPrefix is the etcd prefix the providers are registered under.
+const DefaultPrefix = "/reva/storage-providers/"
+
+type config struct {
+	Endpoints    []string `mapstructure:"endpoints"`
+	Prefix       string   `mapstructure:"prefix"`
+	DialTimeout  int      `mapstructure:"dial_timeout"`
+	Username     string   `mapstructure:"username"`
+	Password     string   `mapstructure:"password"`
+	HomeProvider string   `mapstructure:"home_provider"`
+	// Address is the address a provider is registered with, see Advertise.
+	Address string `mapstructure:"address"`
+	// TTL is the time in seconds after which a provider that stopped
+	// refreshing its registration is removed.
+	TTL int `mapstructure:"ttl"`
+}
+
+func (c *config) init() {
+	if len(c.Endpoints) == 0 {
+		c.Endpoints = []string{"localhost:2379"}
+	}
+	if c.Prefix == "" {
+		c.Prefix = DefaultPrefix
+	}
+	if !strings.HasSuffix(c.Prefix, "/") {
+		c.Prefix += "/"
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = 5
+	}
+	if c.HomeProvider == "" {
+		c.HomeProvider = "/home"
+	}
+	if c.TTL == 0 {
+		c.TTL = 10
+	}
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, errors.Wrap(err, "etcd: error decoding conf")
+	}
+	c.init()
+	return c, nil
+}
+
+func newClient(c *config) (*clientv3.Client, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   c.Endpoints,
+		DialTimeout: time.Duration(c.DialTimeout) * time.Second,
+		Username:    c.Username,
+		Password:    c.Password,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "etcd: error creating client")
+	}
+	return cli, nil
+}
+
+// entry is the value stored for every registered provider.
+type entry struct {
+	Address      string `json:"address"`
+	ProviderPath string `json:"provider_path"`
+	ProviderID   string `json:"provider_id"`
+}
+
+func (e *entry) info() *registrypb.ProviderInfo {
+	return &registrypb.ProviderInfo{
+		Address:      e.Address,
+		ProviderPath: e.ProviderPath,
+		ProviderId:   e.ProviderID,
+	}
+}
+
+type reg struct {
+	c      *config
+	cli    *clientv3.Client
+	cancel context.CancelFunc
+
+	mu        sync.RWMutex
+	providers map[string]*entry // by etcd key
+}
+
+// New returns a storage.Registry that keeps the providers registered under
+// the etcd prefix up to date by watching it.
+func New(m map[string]interface{}) (storage.Registry, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &reg{c: c, cli: cli, cancel: cancel, providers: map[string]*entry{}}
+	rev, err := r.load(ctx)
+	if err != nil {
+		cancel()
+		cli.Close()
+		return nil, err
+	}
+	go r.watch(ctx, rev)
+	return r, nil
+}
+
+// load reads all the registered providers and returns the etcd revision
+// the watch has to start from.
+func (r *reg) load(ctx context.Context) (int64, error) {
+	tctx, cancel := context.WithTimeout(ctx, time.Duration(r.c.DialTimeout)*time.Second)
+	defer cancel()
+	res, err := r.cli.Get(tctx, r.c.Prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, errors.Wrap(err, "etcd: error listing providers")
+	}
+
+	providers := map[string]*entry{}
+	for _, kv := range res.Kvs {
+		if e, ok := decode(string(kv.Key), kv.Value); ok {
+			providers[string(kv.Key)] = e
+		}
+	}
+
+	r.mu.Lock()
+	r.providers = providers
+	r.mu.Unlock()
+	return res.Header.Revision + 1, nil
+}
+
+func (r *reg) watch(ctx context.Context, rev int64) {
+	for ctx.Err() == nil {
+		wch := r.cli.Watch(ctx, r.c.Prefix, clientv3.WithPrefix(), clientv3.WithRev(rev))
+		for res := range wch {
+			if err := res.Err(); err != nil {
+				log.Warn().Err(err).Msg("etcd: error watching providers")
+				break
+			}
+			r.mu.Lock()
+			for _, ev := range res.Events {
+				key := string(ev.Kv.Key)
+				switch ev.Type {
+				case clientv3.EventTypePut:
+					if e, ok := decode(key, ev.Kv.Value); ok {
+						r.providers[key] = e
+						log.Info().Str("address", e.Address).Str("path", e.ProviderPath).Msg("etcd: storage provider registered")
+					}
+				case clientv3.EventTypeDelete:
+					if e, ok := r.providers[key]; ok {
+						delete(r.providers, key)
+						log.Info().Str("address", e.Address).Str("path", e.ProviderPath).Msg("etcd: storage provider unregistered")
+					}
+				}
+			}
+			r.mu.Unlock()
+			rev = res.Header.Revision + 1
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		// the watch was interrupted, e.g. because the revision got compacted,
+		// start over from the current state.
+		time.Sleep(time.Second)
+		if next, err := r.load(ctx); err != nil {
+			log.Warn().Err(err).Msg("etcd: error reloading providers")
+		} else {
+			rev = next
+		}
+	}
+}
+
+func decode(key string, v []byte) (*entry, bool) {
+	e := &entry{}
+	if err := json.Unmarshal(v, e); err != nil || e.Address == "" {
+		log.Warn().Str("key", key).Msg("etcd: ignoring invalid provider entry")
+		return nil, false
+	}
+	return e, true
+}
+
+// Close stops watching the providers.
+func (r *reg) Close() error {
+	r.cancel()
+	return r.cli.Close()
+}
+
+func (r *reg) list() []*entry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := make([]*entry, 0, len(r.providers))
+	for _, e := range r.providers {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (r *reg) ListProviders(ctx context.Context) ([]*registrypb.ProviderInfo, error) {
+	providers := []*registrypb.ProviderInfo{}
+	for _, e := range r.list() {
+		providers = append(providers, e.info())
+	}
+	return providers, nil
+}
+
+func (r *reg) GetHome(ctx context.Context) (*registrypb.ProviderInfo, error) {
+	for _, e := range r.list() {
+		if e.ProviderPath == r.c.HomeProvider {
+			return e.info(), nil
+		}
+	}
+	return nil, errtypes.NotFound("etcd: home provider not registered")
+}
+
+func (r *reg) FindProvider(ctx context.Context, ref *provider.Reference) (*registrypb.ProviderInfo, error) {
+	entries := r.list()
+
+	// find longest match
+	if fn := ref.GetPath(); fn != "" {
+		var match *entry
+		for _, e := range entries {
+			if within(fn, e.ProviderPath) && (match == nil || len(e.ProviderPath) > len(match.ProviderPath)) {
+				match = e
+			}
+		}
+		if match != nil {
+			return match.info(), nil
+		}
+	}
+
+	if id := ref.GetId(); id != nil {
+		for _, e := range entries {
+			if e.ProviderID != "" && id.StorageId == e.ProviderID {
+				return e.info(), nil
+			}
+		}
+	}
+	return nil, errtypes.NotFound("storage provider not found for ref " + ref.String())
+}
+
+// within tells if fn is the provider path or below it, /home does not hold
+// /homework.
+func within(fn, providerPath string) bool {
+	p := strings.TrimSuffix(providerPath, "/")
+	return fn == providerPath || fn == p || strings.HasPrefix(fn, p+"/")
+}
@@ -0,0 +1,70 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+func pathRef(p string) *provider.Reference {
+	return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+}
+
+func TestFindProvider(t *testing.T) {
+	r := &reg{c: &config{}, providers: map[string]*entry{
+		"a": {Address: "root:9000", ProviderPath: "/"},
+		"b": {Address: "home:9000", ProviderPath: "/home"},
+		"c": {Address: "eos:9000", ProviderPath: "/eos/user/", ProviderID: "123e4567"},
+	}}
+
+	for _, tc := range []struct {
+		ref     *provider.Reference
+		address string
+	}{
+		{pathRef("/home"), "home:9000"},
+		{pathRef("/home/docs"), "home:9000"},
+		{pathRef("/homework"), "root:9000"},
+		{pathRef("/homework/docs"), "root:9000"},
+		{pathRef("/eos/user"), "eos:9000"},
+		{pathRef("/eos/user/e/einstein"), "eos:9000"},
+		{pathRef("/eos/users"), "root:9000"},
+		{pathRef("/other"), "root:9000"},
+		{&provider.Reference{Spec: &provider.Reference_Id{Id: &provider.ResourceId{StorageId: "123e4567"}}}, "eos:9000"},
+	} {
+		p, err := r.FindProvider(context.Background(), tc.ref)
+		if err != nil {
+			t.Errorf("%v: %v", tc.ref, err)
+			continue
+		}
+		if p.Address != tc.address {
+			t.Errorf("%v: got %s, want %s", tc.ref, p.Address, tc.address)
+		}
+	}
+
+	delete(r.providers, "a")
+	if _, err := r.FindProvider(context.Background(), pathRef("/homework")); err == nil {
+		t.Error("/homework: expected no provider")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("/homework: expected not found, got %v", err)
+	}
+}
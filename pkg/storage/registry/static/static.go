@@ -20,13 +20,20 @@ package static
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	registrypb "github.com/cs3org/go-cs3apis/cs3/storage/registry/v1beta1"
 	"github.com/cs3org/reva/pkg/errtypes"
 	"github.com/cs3org/reva/pkg/storage"
 	"github.com/cs3org/reva/pkg/storage/registry/registry"
+	"github.com/cs3org/reva/pkg/storage/templates"
+	"github.com/cs3org/reva/pkg/user"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 )
@@ -35,77 +42,242 @@ func init() {
 	registry.Register("static", New)
 }
 
+// rule routes the paths starting with its key, or the ids of the storage
+// named by its key, to a storage provider. The key is a regular expression,
+// and a template evaluated with the user of the request when it contains
+// {{ }}, for example /home/{{substr 0 1 .Username}}. A rule can be given as
+// the address alone.
+type rule struct {
+	Address string `mapstructure:"address"`
+	// Mapping is a template evaluated with the user of the request, the
+	// provider is the one of the first alias, a regular expression, matching
+	// the result. The address is used when no alias matches.
+	Mapping string            `mapstructure:"mapping"`
+	Aliases map[string]string `mapstructure:"aliases"`
+	// Priority decides between the rules matching a path, the longest match
+	// wins between rules of the same priority.
+	Priority int `mapstructure:"priority"`
+}
+
 type config struct {
-	Rules        map[string]string `mapstructure:"rules"`
-	HomeProvider string            `mapstructure:"home_provider"`
+	Rules map[string]rule `mapstructure:"rules"`
+	// HomeProvider is the path of the home of the users, a template
+	// evaluated with the user of the request.
+	HomeProvider string `mapstructure:"home_provider"`
+}
+
+// addressToRule lets a rule be given as the address alone.
+func addressToRule(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() == reflect.String && to == reflect.TypeOf(rule{}) {
+		return map[string]interface{}{"address": data}, nil
+	}
+	return data, nil
 }
 
 func parseConfig(m map[string]interface{}) (*config, error) {
 	c := &config{}
-	if err := mapstructure.Decode(m, c); err != nil {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: addressToRule,
+		Result:     c,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(m); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
-// New returns an implementation to of the storage.FS interface that talk to
-// a local filesystem.
+type alias struct {
+	pattern *regexp.Regexp
+	address string
+}
+
+type compiledRule struct {
+	key string
+	// prefix matches the paths of the rule, nil when the key is a template.
+	prefix  *regexp.Regexp
+	aliases []alias
+	rule
+}
+
+// New returns an implementation of the storage.Registry interface that
+// routes the requests with a static set of rules.
 func New(m map[string]interface{}) (storage.Registry, error) {
 	c, err := parseConfig(m)
 	if err != nil {
 		return nil, err
 	}
-	return &reg{c: c}, nil
+
+	if err := checkTemplate(c.HomeProvider); err != nil {
+		return nil, errors.Wrap(err, "static: invalid home_provider")
+	}
+
+	rules := make([]*compiledRule, 0, len(c.Rules))
+	for key, r := range c.Rules {
+		cr := &compiledRule{key: key, rule: r}
+		if isTemplate(key) {
+			if err := checkTemplate(key); err != nil {
+				return nil, errors.Wrap(err, "static: invalid rule "+key)
+			}
+		} else if cr.prefix, err = regexp.Compile("^" + key); err != nil {
+			return nil, errors.Wrap(err, "static: invalid rule "+key)
+		}
+		if err := checkTemplate(r.Mapping); err != nil {
+			return nil, errors.Wrap(err, "static: invalid mapping of rule "+key)
+		}
+		for pattern, address := range r.Aliases {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return nil, errors.Wrap(err, "static: invalid alias of rule "+key)
+			}
+			cr.aliases = append(cr.aliases, alias{pattern: re, address: address})
+		}
+		sort.Slice(cr.aliases, func(i, j int) bool {
+			return cr.aliases[i].pattern.String() < cr.aliases[j].pattern.String()
+		})
+		rules = append(rules, cr)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].key < rules[j].key })
+
+	return &reg{c: c, rules: rules}, nil
 }
 
 type reg struct {
-	c *config
+	c     *config
+	rules []*compiledRule
+}
+
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// checkTemplate evaluates a template with an empty user, templates.WithUser
+// panics on the invalid ones.
+func checkTemplate(tpl string) (err error) {
+	if !isTemplate(tpl) {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	templates.WithUser(&userpb.User{Id: &userpb.UserId{}}, tpl)
+	return nil
+}
+
+// prefix returns the expression matching the paths of the rule for the user
+// of the request, nil when the key is a template and there is no user.
+func (b *reg) prefix(ctx context.Context, r *compiledRule) *regexp.Regexp {
+	if r.prefix != nil {
+		return r.prefix
+	}
+	u, ok := user.ContextGetUser(ctx)
+	if !ok {
+		return nil
+	}
+	re, err := regexp.Compile("^" + templates.WithUser(u, r.key))
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// address returns the address of the provider of the rule for the user of
+// the request.
+func (b *reg) address(ctx context.Context, r *compiledRule) (string, error) {
+	if r.Mapping != "" {
+		if u, ok := user.ContextGetUser(ctx); ok {
+			m := templates.WithUser(u, r.Mapping)
+			for _, a := range r.aliases {
+				if a.pattern.MatchString(m) {
+					return a.address, nil
+				}
+			}
+		}
+	}
+	if r.Address == "" {
+		return "", errtypes.NotFound("static: no storage provider for rule " + r.key)
+	}
+	return r.Address, nil
 }
 
 func (b *reg) ListProviders(ctx context.Context) ([]*registrypb.ProviderInfo, error) {
 	providers := []*registrypb.ProviderInfo{}
-	for k, v := range b.c.Rules {
-		providers = append(providers, &registrypb.ProviderInfo{
-			Address:      v,
-			ProviderPath: k,
-		})
+	for _, r := range b.rules {
+		seen := map[string]bool{}
+		addresses := []string{}
+		if r.Address != "" {
+			addresses = append(addresses, r.Address)
+		}
+		for _, a := range r.aliases {
+			addresses = append(addresses, a.address)
+		}
+		for _, address := range addresses {
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+			providers = append(providers, &registrypb.ProviderInfo{
+				Address:      address,
+				ProviderPath: r.key,
+			})
+		}
 	}
 	return providers, nil
 }
 
-// returns the the root path of the first provider in the list.
-// TODO(labkode): this is not production ready.
+// GetHome returns the provider of the home_provider path of the user.
 func (b *reg) GetHome(ctx context.Context) (*registrypb.ProviderInfo, error) {
-	for k, v := range b.c.Rules {
-		if k == b.c.HomeProvider {
-			return &registrypb.ProviderInfo{
-				ProviderPath: k,
-				Address:      v,
-			}, nil
+	home := b.c.HomeProvider
+	if isTemplate(home) {
+		u, ok := user.ContextGetUser(ctx)
+		if !ok {
+			return nil, errtypes.UserRequired("static: home_provider needs a user")
+		}
+		home = templates.WithUser(u, home)
+	}
+	p, err := b.FindProvider(ctx, &provider.Reference{Spec: &provider.Reference_Path{Path: home}})
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return nil, errors.New("static: home not found")
 		}
+		return nil, err
 	}
-	return nil, errors.New("static: home not found")
+	return p, nil
 }
 
 func (b *reg) FindProvider(ctx context.Context, ref *provider.Reference) (*registrypb.ProviderInfo, error) {
-	// find longest match
-	var match string
-
 	// we try to find first by path as most storage operations will be done on path.
-	fn := ref.GetPath()
-	if fn != "" {
-		for prefix := range b.c.Rules {
-			if strings.HasPrefix(fn, prefix) && len(prefix) > len(match) {
-				match = prefix
+	if fn := ref.GetPath(); fn != "" {
+		var best *compiledRule
+		var match string
+		for _, r := range b.rules {
+			re := b.prefix(ctx, r)
+			if re == nil {
+				continue
+			}
+			loc := re.FindStringIndex(fn)
+			if loc == nil {
+				continue
+			}
+			m := fn[:loc[1]]
+			if best == nil || r.Priority > best.Priority || (r.Priority == best.Priority && len(m) > len(match)) {
+				best, match = r, m
 			}
 		}
-	}
-
-	if match != "" {
-		return &registrypb.ProviderInfo{
-			ProviderPath: match,
-			Address:      b.c.Rules[match],
-		}, nil
+		if best != nil {
+			address, err := b.address(ctx, best)
+			if err != nil {
+				return nil, err
+			}
+			return &registrypb.ProviderInfo{
+				ProviderPath: match,
+				Address:      address,
+			}, nil
+		}
 	}
 
 	// we try with id
@@ -114,12 +286,16 @@ func (b *reg) FindProvider(ctx context.Context, ref *provider.Reference) (*regis
 		return nil, errtypes.NotFound("storage provider not found for ref " + ref.String())
 	}
 
-	for prefix := range b.c.Rules {
-		if id.StorageId == prefix {
+	for _, r := range b.rules {
+		if id.StorageId == r.key {
 			// TODO(labkode): fill path info based on provider id, if path and storage id points to same id, take that.
+			address, err := b.address(ctx, r)
+			if err != nil {
+				return nil, err
+			}
 			return &registrypb.ProviderInfo{
-				ProviderId: prefix,
-				Address:    b.c.Rules[prefix],
+				ProviderId: r.key,
+				Address:    address,
 			}, nil
 		}
 	}
@@ -0,0 +1,117 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package static
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/user"
+)
+
+func pathRef(p string) *provider.Reference {
+	return &provider.Reference{Spec: &provider.Reference_Path{Path: p}}
+}
+
+func withUser(username string) context.Context {
+	return user.ContextSetUser(context.Background(), &userpb.User{
+		Id:       &userpb.UserId{OpaqueId: username, Idp: "idp"},
+		Username: username,
+	})
+}
+
+func TestFindProvider(t *testing.T) {
+	reg, err := New(map[string]interface{}{
+		"home_provider": "/home",
+		"rules": map[string]interface{}{
+			"/":                             "root:9000",
+			"/home":                         map[string]interface{}{"mapping": "{{substr 0 1 .Username}}", "aliases": map[string]interface{}{"[a-k]": "home-a:9000", "[l-z]": "home-l:9000"}},
+			"/eos/user/.":                   map[string]interface{}{"address": "eos:9000"},
+			"/eos/user/[a-k]/{{.Username}}": map[string]interface{}{"address": "eos-own:9000", "priority": 1},
+			"/public":                       "public:9000",
+			"123e4567":                      "ids:9000",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ctx     context.Context
+		ref     *provider.Reference
+		address string
+		path    string
+	}{
+		{withUser("einstein"), pathRef("/home/docs"), "home-a:9000", "/home"},
+		{withUser("marie"), pathRef("/home/docs"), "home-l:9000", "/home"},
+		{withUser("einstein"), pathRef("/public/abc"), "public:9000", "/public"},
+		{withUser("einstein"), pathRef("/other"), "root:9000", "/"},
+		{withUser("einstein"), pathRef("/eos/user/e/einstein/docs"), "eos-own:9000", "/eos/user/e/einstein"},
+		{withUser("einstein"), pathRef("/eos/user/m/marie/docs"), "eos:9000", "/eos/user/m"},
+		{context.Background(), pathRef("/eos/user/e/einstein/docs"), "eos:9000", "/eos/user/e"},
+		{withUser("einstein"), &provider.Reference{Spec: &provider.Reference_Id{Id: &provider.ResourceId{StorageId: "123e4567"}}}, "ids:9000", ""},
+	} {
+		p, err := reg.FindProvider(tc.ctx, tc.ref)
+		if err != nil {
+			t.Errorf("%v: %v", tc.ref, err)
+			continue
+		}
+		if p.Address != tc.address || p.ProviderPath != tc.path {
+			t.Errorf("%v: got %s at %s, want %s at %s", tc.ref, p.Address, p.ProviderPath, tc.address, tc.path)
+		}
+	}
+
+	// without user the mapping has no alias and the rule no address
+	if _, err := reg.FindProvider(context.Background(), pathRef("/home/docs")); err == nil {
+		t.Error("found a provider for a home without user")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	home, err := reg.GetHome(withUser("marie"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if home.Address != "home-l:9000" {
+		t.Errorf("home of marie at %s", home.Address)
+	}
+
+	providers, err := reg.ListProviders(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 7 {
+		t.Errorf("listed %d providers: %v", len(providers), providers)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	for _, rules := range []map[string]interface{}{
+		{"/home/(": "home:9000"},
+		{"/home": map[string]interface{}{"mapping": "{{.Username", "address": "home:9000"}},
+		{"/home": map[string]interface{}{"aliases": map[string]interface{}{"[a-": "home:9000"}}},
+	} {
+		if _, err := New(map[string]interface{}{"rules": rules}); err == nil {
+			t.Errorf("rules %v accepted", rules)
+		}
+	}
+}
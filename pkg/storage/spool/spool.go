@@ -0,0 +1,188 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package spool buffers the content of the uploads for the storage drivers
+// needing a seekable source of known size. The content is kept in memory up
+// to a bounded size, shared by all the uploads, and spills to disk past it.
+package spool
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Config configures the buffering of the uploads.
+type Config struct {
+	// MemoryBuffer is the size in bytes of the content an upload keeps in
+	// memory before spilling to disk, 4 MiB by default.
+	MemoryBuffer int64 `mapstructure:"memory_buffer"`
+	// MaxMemory is the size in bytes of the memory all the uploads buffer in
+	// at once, the uploads exceeding it go to disk right away. 64 MiB by
+	// default.
+	MaxMemory int64 `mapstructure:"max_memory"`
+	// TmpFolder is the folder the content spills to.
+	TmpFolder string `mapstructure:"tmp_folder"`
+}
+
+// Spooler buffers uploads within a memory budget.
+type Spooler struct {
+	c *Config
+
+	mu   sync.Mutex
+	used int64
+}
+
+// New returns a Spooler, the tmp folder is created if needed.
+func New(c *Config) (*Spooler, error) {
+	if c.MemoryBuffer == 0 {
+		c.MemoryBuffer = 4 * 1024 * 1024
+	}
+	if c.MaxMemory == 0 {
+		c.MaxMemory = 64 * 1024 * 1024
+	}
+	if c.TmpFolder == "" {
+		c.TmpFolder = os.TempDir()
+	}
+	if err := os.MkdirAll(c.TmpFolder, 0755); err != nil {
+		return nil, errors.Wrap(err, "spool: could not create tmp dir")
+	}
+	return &Spooler{c: c}, nil
+}
+
+// reserve takes up to MemoryBuffer bytes from the memory budget.
+func (s *Spooler) reserve() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.c.MemoryBuffer
+	if left := s.c.MaxMemory - s.used; n > left {
+		n = left
+	}
+	if n < 0 {
+		n = 0
+	}
+	s.used += n
+	return n
+}
+
+func (s *Spooler) release(n int64) {
+	s.mu.Lock()
+	s.used -= n
+	s.mu.Unlock()
+}
+
+// Spool reads r until EOF and returns its content. The Buffer must be closed
+// to give its memory back and remove its tmp file.
+func (s *Spooler) Spool(r io.Reader) (*Buffer, error) {
+	reserved := s.reserve()
+	var mem bytes.Buffer
+	// one byte more tells whether the content fits in memory
+	n, err := io.CopyN(&mem, r, reserved+1)
+	if err != nil && err != io.EOF {
+		s.release(reserved)
+		return nil, err
+	}
+	if n <= reserved {
+		// the unused part of the reservation goes back to the budget
+		s.release(reserved - n)
+		return &Buffer{s: s, r: bytes.NewReader(mem.Bytes()), reserved: n, size: n}, nil
+	}
+
+	f, err := ioutil.TempFile(s.c.TmpFolder, "reva-spool")
+	if err != nil {
+		s.release(reserved)
+		return nil, errors.Wrap(err, "spool: error creating tmp file")
+	}
+	b := &Buffer{s: s, r: f, f: f}
+	_, err = mem.WriteTo(f)
+	s.release(reserved)
+	if err == nil {
+		n, err = io.Copy(f, r)
+		b.size = reserved + 1 + n
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+type readerAtSeeker interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// Buffer is the spooled content of an upload.
+type Buffer struct {
+	s        *Spooler
+	r        readerAtSeeker
+	f        *os.File
+	reserved int64
+	size     int64
+	closed   bool
+}
+
+// Size returns the size in bytes of the content.
+func (b *Buffer) Size() int64 {
+	return b.size
+}
+
+// Read implements io.Reader.
+func (b *Buffer) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// ReadAt implements io.ReaderAt.
+func (b *Buffer) ReadAt(p []byte, off int64) (int, error) {
+	return b.r.ReadAt(p, off)
+}
+
+// Seek implements io.Seeker.
+func (b *Buffer) Seek(offset int64, whence int) (int64, error) {
+	return b.r.Seek(offset, whence)
+}
+
+// OnDisk tells whether the content spilled to disk.
+func (b *Buffer) OnDisk() bool {
+	return b.f != nil
+}
+
+// Close releases the memory of the content and removes its tmp file, it can
+// be called more than once.
+func (b *Buffer) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.s.release(b.reserved)
+	if b.f == nil {
+		return nil
+	}
+	err := b.f.Close()
+	if rerr := os.Remove(b.f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
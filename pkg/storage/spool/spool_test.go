@@ -0,0 +1,125 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package spool
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "spool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	s, err := New(&Config{MemoryBuffer: 8, MaxMemory: 12, TmpFolder: tmp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		content string
+		onDisk  bool
+	}{
+		{"", false},
+		{"12345678", false},
+		{"123456789", true},
+		{"a much longer content spilling to disk", true},
+	}
+	for _, tt := range tests {
+		b, err := s.Spool(bytes.NewBufferString(tt.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.OnDisk() != tt.onDisk {
+			t.Errorf("%q: expected on disk %v, got %v", tt.content, tt.onDisk, b.OnDisk())
+		}
+		if b.Size() != int64(len(tt.content)) {
+			t.Errorf("%q: expected size %d, got %d", tt.content, len(tt.content), b.Size())
+		}
+		for i := 0; i < 2; i++ {
+			got, err := ioutil.ReadAll(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.content {
+				t.Errorf("expected %q, got %q", tt.content, got)
+			}
+			if _, err := b.Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected the tmp files to be removed, got %d", len(files))
+	}
+}
+
+func TestSpoolMemoryBudget(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "spool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	s, err := New(&Config{MemoryBuffer: 8, MaxMemory: 12, TmpFolder: tmp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.Spool(bytes.NewBufferString("12345678"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only 4 bytes of the budget are left
+	second, err := s.Spool(bytes.NewBufferString("123456"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if first.OnDisk() || !second.OnDisk() {
+		t.Errorf("expected the second upload only to spill to disk")
+	}
+
+	first.Close()
+	third, err := s.Spool(bytes.NewBufferString("123456"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if third.OnDisk() {
+		t.Errorf("expected the closed upload to give its memory back")
+	}
+}
@@ -21,7 +21,9 @@ package storage
 import (
 	"context"
 	"io"
+	"io/ioutil"
 	"net/url"
+	"time"
 
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	registry "github.com/cs3org/go-cs3apis/cs3/storage/registry/v1beta1"
@@ -57,6 +59,127 @@ type FS interface {
 	UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error
 }
 
+// UploadInfo holds the state of a resumable upload.
+type UploadInfo struct {
+	ID       string            `json:"id"`
+	Size     int64             `json:"size"`
+	Offset   int64             `json:"offset"`
+	MetaData map[string]string `json:"metadata"`
+}
+
+// UploadHandler is the interface that storage drivers supporting resumable
+// uploads implement. The upload state is persisted by the driver so
+// interrupted uploads can be resumed, even after a restart.
+type UploadHandler interface {
+	InitiateUpload(ctx context.Context, ref *provider.Reference, size int64, metadata map[string]string) (string, error)
+	GetUpload(ctx context.Context, id string) (*UploadInfo, error)
+	WriteUploadChunk(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	// ReadUpload returns the data received so far, for example to scan it
+	// before the upload is finished.
+	ReadUpload(ctx context.Context, id string) (io.ReadCloser, error)
+	FinishUpload(ctx context.Context, id string) error
+	TerminateUpload(ctx context.Context, id string) error
+}
+
+// UploadPurger is the interface that storage drivers supporting resumable
+// uploads implement to remove the uploads abandoned before they were
+// finished.
+type UploadPurger interface {
+	// PurgeUploads removes the unfinished uploads not written to since
+	// before and returns their ids. With dryRun nothing is removed.
+	PurgeUploads(ctx context.Context, before time.Time, dryRun bool) ([]string, error)
+}
+
+// RecyclePurger is the interface that storage drivers with a trash
+// implement to enforce a retention on the trash of all the users.
+type RecyclePurger interface {
+	// PurgeRecycle removes the items trashed before the given time and
+	// returns their keys. With dryRun nothing is removed.
+	PurgeRecycle(ctx context.Context, before time.Time, dryRun bool) ([]string, error)
+}
+
+// HomeQuotaSetter is the interface that storage drivers with a quota per
+// home implement to set the quota of the home of the user in the context.
+type HomeQuotaSetter interface {
+	SetHomeQuota(ctx context.Context, bytes int) error
+}
+
+// URLSigner is the interface that storage drivers whose backend can serve
+// the transfers itself implement, to let the clients bypass the data servers.
+type URLSigner interface {
+	// DownloadURL returns a URL to download the file, valid for ttl.
+	DownloadURL(ctx context.Context, ref *provider.Reference, ttl time.Duration) (string, error)
+	// UploadURL returns a URL to upload the file with a PUT, valid for ttl.
+	UploadURL(ctx context.Context, ref *provider.Reference, ttl time.Duration) (string, error)
+}
+
+// RangeDownloader is the interface that storage drivers able to read a part
+// of a file without reading what comes before it implement.
+type RangeDownloader interface {
+	// DownloadRange returns a reader for length bytes of the file starting
+	// at offset.
+	DownloadRange(ctx context.Context, ref *provider.Reference, offset, length int64) (io.ReadCloser, error)
+}
+
+// SeekableUploader is the interface that storage drivers needing the size of
+// the content before uploading it, e.g. to size the parts of a multipart
+// upload, implement.
+type SeekableUploader interface {
+	// NeedsSeekableUpload tells whether the reader passed to Upload should
+	// be an io.ReadSeeker and io.ReaderAt.
+	NeedsSeekableUpload() bool
+}
+
+// Change is a change of a resource, with its path relative to the folder
+// the changes were asked for.
+type Change struct {
+	Path    string
+	Removed bool
+}
+
+// ChangeJournal is the interface that storage drivers recording the changes
+// of the files implement, to let the sync clients get the changes since
+// they last synced.
+type ChangeJournal interface {
+	// ListChanges returns the changes below the folder since the sync
+	// token, and the token of the last change. An empty token returns no
+	// change, only the current token.
+	ListChanges(ctx context.Context, ref *provider.Reference, token string) ([]*Change, string, error)
+}
+
+// DownloadRange returns a reader for length bytes of the file starting at
+// offset. The driver's RangeDownloader implementation is used when available,
+// otherwise the file is downloaded and the content before offset is skipped,
+// with a seek if the reader supports it.
+func DownloadRange(ctx context.Context, fs FS, ref *provider.Reference, offset, length int64) (io.ReadCloser, error) {
+	if rd, ok := fs.(RangeDownloader); ok {
+		return rd.DownloadRange(ctx, ref, offset, length)
+	}
+	rc, err := fs.Download(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := rc.(io.Seeker); ok {
+		_, err = s.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, rc, offset)
+	}
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return LimitReadCloser(rc, length), nil
+}
+
+// LimitReadCloser returns a ReadCloser reading at most n bytes from rc and
+// closing rc when closed.
+func LimitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, n), rc}
+}
+
 // Registry is the interface that storage registries implement
 // for discovering storage providers
 type Registry interface {
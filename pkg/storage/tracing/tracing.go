@@ -0,0 +1,297 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package tracing wraps a storage driver to record a span per operation.
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/storage"
+	"github.com/cs3org/reva/pkg/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+type fs struct {
+	next   storage.FS
+	driver string
+}
+
+// uploadFS is returned for the drivers supporting resumable uploads so that
+// the storage.UploadHandler type assertion keeps working on the wrapped driver.
+type uploadFS struct {
+	*fs
+	uh storage.UploadHandler
+}
+
+// New returns a storage.FS recording a span for every call to the driver.
+func New(next storage.FS, driver string) storage.FS {
+	f := &fs{next: next, driver: driver}
+	if uh, ok := next.(storage.UploadHandler); ok {
+		return &uploadFS{fs: f, uh: uh}
+	}
+	return f
+}
+
+func (f *fs) start(ctx context.Context, name string) (context.Context, oteltrace.Span) {
+	return trace.StartSpan(ctx, "storage."+name, oteltrace.WithAttributes(attribute.String("storage.driver", f.driver)))
+}
+
+func end(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (f *fs) GetHome(ctx context.Context) (string, error) {
+	ctx, span := f.start(ctx, "GetHome")
+	res, err := f.next.GetHome(ctx)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) CreateHome(ctx context.Context) error {
+	ctx, span := f.start(ctx, "CreateHome")
+	err := f.next.CreateHome(ctx)
+	end(span, err)
+	return err
+}
+
+func (f *fs) CreateDir(ctx context.Context, fn string) error {
+	ctx, span := f.start(ctx, "CreateDir")
+	err := f.next.CreateDir(ctx, fn)
+	end(span, err)
+	return err
+}
+
+func (f *fs) Delete(ctx context.Context, ref *provider.Reference) error {
+	ctx, span := f.start(ctx, "Delete")
+	err := f.next.Delete(ctx, ref)
+	end(span, err)
+	return err
+}
+
+func (f *fs) Move(ctx context.Context, oldRef, newRef *provider.Reference) error {
+	ctx, span := f.start(ctx, "Move")
+	err := f.next.Move(ctx, oldRef, newRef)
+	end(span, err)
+	return err
+}
+
+func (f *fs) GetMD(ctx context.Context, ref *provider.Reference) (*provider.ResourceInfo, error) {
+	ctx, span := f.start(ctx, "GetMD")
+	res, err := f.next.GetMD(ctx, ref)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) ListFolder(ctx context.Context, ref *provider.Reference) ([]*provider.ResourceInfo, error) {
+	ctx, span := f.start(ctx, "ListFolder")
+	res, err := f.next.ListFolder(ctx, ref)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) Upload(ctx context.Context, ref *provider.Reference, r io.ReadCloser) error {
+	ctx, span := f.start(ctx, "Upload")
+	err := f.next.Upload(ctx, ref, r)
+	end(span, err)
+	return err
+}
+
+func (f *fs) Download(ctx context.Context, ref *provider.Reference) (io.ReadCloser, error) {
+	ctx, span := f.start(ctx, "Download")
+	res, err := f.next.Download(ctx, ref)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) DownloadRange(ctx context.Context, ref *provider.Reference, offset, length int64) (io.ReadCloser, error) {
+	ctx, span := f.start(ctx, "DownloadRange")
+	res, err := storage.DownloadRange(ctx, f.next, ref, offset, length)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) ListRevisions(ctx context.Context, ref *provider.Reference) ([]*provider.FileVersion, error) {
+	ctx, span := f.start(ctx, "ListRevisions")
+	res, err := f.next.ListRevisions(ctx, ref)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) DownloadRevision(ctx context.Context, ref *provider.Reference, key string) (io.ReadCloser, error) {
+	ctx, span := f.start(ctx, "DownloadRevision")
+	res, err := f.next.DownloadRevision(ctx, ref, key)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) RestoreRevision(ctx context.Context, ref *provider.Reference, key string) error {
+	ctx, span := f.start(ctx, "RestoreRevision")
+	err := f.next.RestoreRevision(ctx, ref, key)
+	end(span, err)
+	return err
+}
+
+func (f *fs) ListRecycle(ctx context.Context) ([]*provider.RecycleItem, error) {
+	ctx, span := f.start(ctx, "ListRecycle")
+	res, err := f.next.ListRecycle(ctx)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) RestoreRecycleItem(ctx context.Context, key string) error {
+	ctx, span := f.start(ctx, "RestoreRecycleItem")
+	err := f.next.RestoreRecycleItem(ctx, key)
+	end(span, err)
+	return err
+}
+
+func (f *fs) PurgeRecycleItem(ctx context.Context, key string) error {
+	ctx, span := f.start(ctx, "PurgeRecycleItem")
+	err := f.next.PurgeRecycleItem(ctx, key)
+	end(span, err)
+	return err
+}
+
+func (f *fs) EmptyRecycle(ctx context.Context) error {
+	ctx, span := f.start(ctx, "EmptyRecycle")
+	err := f.next.EmptyRecycle(ctx)
+	end(span, err)
+	return err
+}
+
+func (f *fs) GetPathByID(ctx context.Context, id *provider.ResourceId) (string, error) {
+	ctx, span := f.start(ctx, "GetPathByID")
+	res, err := f.next.GetPathByID(ctx, id)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) AddGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	ctx, span := f.start(ctx, "AddGrant")
+	err := f.next.AddGrant(ctx, ref, g)
+	end(span, err)
+	return err
+}
+
+func (f *fs) RemoveGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	ctx, span := f.start(ctx, "RemoveGrant")
+	err := f.next.RemoveGrant(ctx, ref, g)
+	end(span, err)
+	return err
+}
+
+func (f *fs) UpdateGrant(ctx context.Context, ref *provider.Reference, g *provider.Grant) error {
+	ctx, span := f.start(ctx, "UpdateGrant")
+	err := f.next.UpdateGrant(ctx, ref, g)
+	end(span, err)
+	return err
+}
+
+func (f *fs) ListGrants(ctx context.Context, ref *provider.Reference) ([]*provider.Grant, error) {
+	ctx, span := f.start(ctx, "ListGrants")
+	res, err := f.next.ListGrants(ctx, ref)
+	end(span, err)
+	return res, err
+}
+
+func (f *fs) GetQuota(ctx context.Context) (int, int, error) {
+	ctx, span := f.start(ctx, "GetQuota")
+	total, used, err := f.next.GetQuota(ctx)
+	end(span, err)
+	return total, used, err
+}
+
+func (f *fs) CreateReference(ctx context.Context, path string, targetURI *url.URL) error {
+	ctx, span := f.start(ctx, "CreateReference")
+	err := f.next.CreateReference(ctx, path, targetURI)
+	end(span, err)
+	return err
+}
+
+func (f *fs) Shutdown(ctx context.Context) error {
+	ctx, span := f.start(ctx, "Shutdown")
+	err := f.next.Shutdown(ctx)
+	end(span, err)
+	return err
+}
+
+func (f *fs) SetArbitraryMetadata(ctx context.Context, ref *provider.Reference, md *provider.ArbitraryMetadata) error {
+	ctx, span := f.start(ctx, "SetArbitraryMetadata")
+	err := f.next.SetArbitraryMetadata(ctx, ref, md)
+	end(span, err)
+	return err
+}
+
+func (f *fs) UnsetArbitraryMetadata(ctx context.Context, ref *provider.Reference, keys []string) error {
+	ctx, span := f.start(ctx, "UnsetArbitraryMetadata")
+	err := f.next.UnsetArbitraryMetadata(ctx, ref, keys)
+	end(span, err)
+	return err
+}
+
+func (u *uploadFS) InitiateUpload(ctx context.Context, ref *provider.Reference, size int64, metadata map[string]string) (string, error) {
+	ctx, span := u.start(ctx, "InitiateUpload")
+	res, err := u.uh.InitiateUpload(ctx, ref, size, metadata)
+	end(span, err)
+	return res, err
+}
+
+func (u *uploadFS) GetUpload(ctx context.Context, id string) (*storage.UploadInfo, error) {
+	ctx, span := u.start(ctx, "GetUpload")
+	res, err := u.uh.GetUpload(ctx, id)
+	end(span, err)
+	return res, err
+}
+
+func (u *uploadFS) WriteUploadChunk(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	ctx, span := u.start(ctx, "WriteUploadChunk")
+	res, err := u.uh.WriteUploadChunk(ctx, id, offset, r)
+	end(span, err)
+	return res, err
+}
+
+func (u *uploadFS) ReadUpload(ctx context.Context, id string) (io.ReadCloser, error) {
+	ctx, span := u.start(ctx, "ReadUpload")
+	res, err := u.uh.ReadUpload(ctx, id)
+	end(span, err)
+	return res, err
+}
+
+func (u *uploadFS) FinishUpload(ctx context.Context, id string) error {
+	ctx, span := u.start(ctx, "FinishUpload")
+	err := u.uh.FinishUpload(ctx, id)
+	end(span, err)
+	return err
+}
+
+func (u *uploadFS) TerminateUpload(ctx context.Context, id string) error {
+	ctx, span := u.start(ctx, "TerminateUpload")
+	err := u.uh.TerminateUpload(ctx, id)
+	end(span, err)
+	return err
+}
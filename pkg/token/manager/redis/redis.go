@@ -0,0 +1,255 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/token"
+	"github.com/cs3org/reva/pkg/token/manager/jwt"
+	"github.com/cs3org/reva/pkg/token/manager/registry"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+const defaultExpiration int64 = 3600 // 1 hour
+
+func init() {
+	registry.Register("redis", New)
+}
+
+type config struct {
+	Address  string `mapstructure:"address"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// Prefix is prepended to the keys, to share a redis between
+	// deployments.
+	Prefix string `mapstructure:"prefix"`
+	// Tokens selects the kind of tokens: "opaque" tokens are random
+	// strings referring to the session kept in redis, "jwt" tokens are
+	// signed JWTs, only their revocation is kept in redis.
+	Tokens string `mapstructure:"tokens"`
+	// Expires is the lifetime of the tokens in seconds.
+	Expires int64 `mapstructure:"expires"`
+	// Secret signs the JWTs, it defaults to the shared jwt secret.
+	Secret string `mapstructure:"secret"`
+}
+
+// store keeps the state shared by the revad instances.
+type store interface {
+	// Get returns errtypes.NotFound if the key does not exist.
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+type manager struct {
+	c     *config
+	store store
+	// jwt mints and verifies the JWTs, nil for opaque tokens.
+	jwt token.Manager
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		err = errors.Wrap(err, "error decoding conf")
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *config) init() {
+	if c.Address == "" {
+		c.Address = "localhost:6379"
+	}
+	if c.Prefix == "" {
+		c.Prefix = "reva:"
+	}
+	if c.Tokens == "" {
+		c.Tokens = "opaque"
+	}
+	if c.Expires == 0 {
+		c.Expires = defaultExpiration
+	}
+}
+
+// New returns a token manager keeping the sessions in redis, so they are
+// shared by all the revad instances and can be revoked.
+func New(m map[string]interface{}) (token.Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	c.init()
+	return newManager(c, newRedisStore(c))
+}
+
+func newManager(c *config, s store) (*manager, error) {
+	mgr := &manager{c: c, store: s}
+	switch c.Tokens {
+	case "opaque":
+	case "jwt":
+		j, err := jwt.New(map[string]interface{}{"secret": c.Secret, "expires": c.Expires})
+		if err != nil {
+			return nil, errors.Wrap(err, "redis: error creating jwt manager")
+		}
+		mgr.jwt = j
+	default:
+		return nil, errors.New("redis: unknown tokens: " + c.Tokens)
+	}
+	return mgr, nil
+}
+
+func (m *manager) expires() time.Duration {
+	return time.Duration(m.c.Expires) * time.Second
+}
+
+// key returns the key of a token, tokens are hashed so that they can not be
+// read from redis.
+func (m *manager) key(kind, tkn string) string {
+	h := sha256.Sum256([]byte(tkn))
+	return m.c.Prefix + kind + ":" + hex.EncodeToString(h[:])
+}
+
+func (m *manager) MintToken(ctx context.Context, u *user.User) (string, error) {
+	if m.jwt != nil {
+		return m.jwt.MintToken(ctx, u)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "redis: error generating token")
+	}
+	tkn := base64.RawURLEncoding.EncodeToString(b)
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		return "", errors.Wrap(err, "redis: error encoding user")
+	}
+	if err := m.store.Set(m.key("session", tkn), data, m.expires()); err != nil {
+		return "", errors.Wrap(err, "redis: error storing session")
+	}
+	return tkn, nil
+}
+
+func (m *manager) DismantleToken(ctx context.Context, tkn string) (*user.User, error) {
+	if m.jwt != nil {
+		_, err := m.store.Get(m.key("revoked", tkn))
+		switch err.(type) {
+		case nil:
+			return nil, errtypes.InvalidCredentials("token revoked")
+		case errtypes.IsNotFound:
+		default:
+			return nil, errors.Wrap(err, "redis: error checking revocation")
+		}
+		return m.jwt.DismantleToken(ctx, tkn)
+	}
+
+	data, err := m.store.Get(m.key("session", tkn))
+	if err != nil {
+		if _, ok := err.(errtypes.IsNotFound); ok {
+			return nil, errtypes.InvalidCredentials("token invalid")
+		}
+		return nil, errors.Wrap(err, "redis: error reading session")
+	}
+	u := &user.User{}
+	if err := json.Unmarshal(data, u); err != nil {
+		return nil, errors.Wrap(err, "redis: error decoding user")
+	}
+	return u, nil
+}
+
+// RevokeToken deletes the session of an opaque token, or adds a JWT to the
+// revoked ones until it expires.
+func (m *manager) RevokeToken(ctx context.Context, tkn string) error {
+	if m.jwt != nil {
+		if err := m.store.Set(m.key("revoked", tkn), []byte{1}, m.expires()); err != nil {
+			return errors.Wrap(err, "redis: error revoking token")
+		}
+		return nil
+	}
+	if err := m.store.Delete(m.key("session", tkn)); err != nil {
+		return errors.Wrap(err, "redis: error revoking token")
+	}
+	return nil
+}
+
+type redisStore struct {
+	pool *redis.Pool
+}
+
+func newRedisStore(c *config) *redisStore {
+	return &redisStore{pool: &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+
+		Dial: func() (redis.Conn, error) {
+			opts := []redis.DialOption{redis.DialDatabase(c.DB)}
+			if c.Password != "" {
+				opts = append(opts, redis.DialPassword(c.Password))
+			}
+			return redis.Dial("tcp", c.Address, opts...)
+		},
+
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}}
+}
+
+func (s *redisStore) Get(key string) ([]byte, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", key))
+	if err != nil {
+		if err == redis.ErrNil {
+			return nil, errtypes.NotFound(key)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *redisStore) Set(key string, value []byte, ttl time.Duration) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", key, value, "PX", ttl.Milliseconds())
+	return err
+}
+
+func (s *redisStore) Delete(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", key)
+	return err
+}
@@ -0,0 +1,101 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	user "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+)
+
+type memStore map[string][]byte
+
+func (s memStore) Get(key string) ([]byte, error) {
+	v, ok := s[key]
+	if !ok {
+		return nil, errtypes.NotFound(key)
+	}
+	return v, nil
+}
+
+func (s memStore) Set(key string, value []byte, ttl time.Duration) error {
+	s[key] = value
+	return nil
+}
+
+func (s memStore) Delete(key string) error {
+	delete(s, key)
+	return nil
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	u := &user.User{Id: &user.UserId{OpaqueId: "einstein", Idp: "http://localhost:9998"}, Username: "einstein"}
+
+	for _, tokens := range []string{"opaque", "jwt"} {
+		c := &config{Tokens: tokens, Secret: "secret"}
+		c.init()
+		s := memStore{}
+		m, err := newManager(c, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tkn, err := m.MintToken(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := range s {
+			if strings.Contains(k, tkn) {
+				t.Errorf("%s: token stored in clear in key %s", tokens, k)
+			}
+		}
+
+		// a second instance sharing the store accepts the token
+		other, _ := newManager(c, s)
+		got, err := other.DismantleToken(ctx, tkn)
+		if err != nil {
+			t.Fatalf("%s: %v", tokens, err)
+		}
+		if got.Username != u.Username || got.Id.OpaqueId != u.Id.OpaqueId {
+			t.Errorf("%s: got user %+v, wanted %+v", tokens, got, u)
+		}
+
+		if err := other.RevokeToken(ctx, tkn); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.DismantleToken(ctx, tkn); err == nil {
+			t.Errorf("%s: expected an error for a revoked token", tokens)
+		}
+
+		if _, err := m.DismantleToken(ctx, "invalid"); err == nil {
+			t.Errorf("%s: expected an error for an invalid token", tokens)
+		}
+	}
+}
+
+func TestUnknownTokens(t *testing.T) {
+	if _, err := New(map[string]interface{}{"tokens": "paseto"}); err == nil {
+		t.Error("expected an error for unknown tokens")
+	}
+}
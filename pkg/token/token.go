@@ -41,6 +41,12 @@ type Manager interface {
 	DismantleToken(ctx context.Context, token string) (*user.User, error)
 }
 
+// Revoker is implemented by the token managers able to invalidate tokens
+// before they expire.
+type Revoker interface {
+	RevokeToken(ctx context.Context, token string) error
+}
+
 // ContextGetToken returns the token if set in the given context.
 func ContextGetToken(ctx context.Context) (string, bool) {
 	u, ok := ctx.Value(tokenKey).(string)
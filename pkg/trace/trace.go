@@ -0,0 +1,121 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package trace sets up OpenTelemetry tracing and provides the helpers used
+// to propagate the trace context between the http and grpc services.
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by reva.
+const instrumentationName = "github.com/cs3org/reva"
+
+// Options configure the export of the traces.
+type Options struct {
+	// Exporter is either jaeger or otlp.
+	Exporter    string
+	ServiceName string
+	// Endpoint is the jaeger agent or the otlp collector host:port.
+	Endpoint string
+	// Collector is the url of the jaeger collector, if set the agent is not used.
+	Collector string
+	// Insecure disables TLS towards the otlp collector.
+	Insecure bool
+}
+
+func init() {
+	// the trace context is propagated even when tracing is disabled here,
+	// so that the traces of the callers are not broken.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Init configures the global tracer provider to export the spans.
+// The returned function flushes the pending spans and stops the export.
+func Init(o *Options) (func(context.Context) error, error) {
+	exp, err := newExporter(o)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(o.ServiceName))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func newExporter(o *Options) (sdktrace.SpanExporter, error) {
+	switch o.Exporter {
+	case "jaeger":
+		if o.Collector != "" {
+			return jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(o.Collector)))
+		}
+		host, port, err := splitHostPort(o.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return jaeger.New(jaeger.WithAgentEndpoint(jaeger.WithAgentHost(host), jaeger.WithAgentPort(port)))
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(o.Endpoint)}
+		if o.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("trace: unknown exporter %q", o.Exporter)
+	}
+}
+
+// Tracer returns the tracer used for the spans created by reva.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// StartSpan starts a span with the given name as a child of the span in ctx.
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// GetTraceID returns the id of the trace in ctx, used to correlate the logs
+// with the traces.
+func GetTraceID(ctx context.Context) string {
+	return trace.SpanContextFromContext(ctx).TraceID().String()
+}
+
+func splitHostPort(hostport string) (string, string, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", "", fmt.Errorf("trace: invalid endpoint %q: %v", hostport, err)
+	}
+	return host, port, nil
+}
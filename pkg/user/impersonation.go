@@ -0,0 +1,63 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package user
+
+import (
+	"encoding/json"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/golang/protobuf/proto"
+)
+
+// impersonatorKey is the opaque key holding the user acting as another one.
+const impersonatorKey = "impersonator"
+
+// WithImpersonator returns a copy of the user carrying the id and username
+// of the user impersonating it in its opaque data, so that they travel in
+// the tokens minted for it.
+func WithImpersonator(u, by *userpb.User) *userpb.User {
+	u = proto.Clone(u).(*userpb.User)
+	if u.Opaque == nil {
+		u.Opaque = &types.Opaque{}
+	}
+	if u.Opaque.Map == nil {
+		u.Opaque.Map = map[string]*types.OpaqueEntry{}
+	}
+	v, _ := json.Marshal(&userpb.User{Id: by.Id, Username: by.Username})
+	u.Opaque.Map[impersonatorKey] = &types.OpaqueEntry{Decoder: "json", Value: v}
+	return u
+}
+
+// Impersonator returns the user impersonating u, with only its id and
+// username set, or nil if u is not impersonated.
+func Impersonator(u *userpb.User) *userpb.User {
+	if u == nil || u.Opaque == nil {
+		return nil
+	}
+	e, ok := u.Opaque.Map[impersonatorKey]
+	if !ok || e.Decoder != "json" {
+		return nil
+	}
+	by := &userpb.User{}
+	if err := json.Unmarshal(e.Value, by); err != nil {
+		return nil
+	}
+	return by
+}
@@ -0,0 +1,46 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package user
+
+import (
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+)
+
+func TestImpersonator(t *testing.T) {
+	u := &userpb.User{Id: &userpb.UserId{OpaqueId: "einstein", Idp: "cernbox"}, Username: "einstein"}
+	admin := &userpb.User{Id: &userpb.UserId{OpaqueId: "admin", Idp: "cernbox"}, Username: "admin", Groups: []string{"admins"}}
+
+	if Impersonator(u) != nil {
+		t.Fatal("user should not be impersonated")
+	}
+
+	iu := WithImpersonator(u, admin)
+	if u.Opaque != nil {
+		t.Error("original user was modified")
+	}
+	by := Impersonator(iu)
+	if by == nil {
+		t.Fatal("impersonator missing")
+	}
+	if by.Username != "admin" || by.Id.OpaqueId != "admin" || by.Id.Idp != "cernbox" || len(by.Groups) != 0 {
+		t.Errorf("unexpected impersonator %+v", by)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	"github.com/cs3org/reva/pkg/appctx"
 	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/identity/mapping"
 	"github.com/cs3org/reva/pkg/user"
 	"github.com/cs3org/reva/pkg/user/manager/registry"
 	"github.com/mitchellh/mapstructure"
@@ -45,8 +46,8 @@ type manager struct {
 	groupfilter  string
 	bindUsername string
 	bindPassword string
-	idp          string
 	schema       attributes
+	mapper       *mapping.Mapper
 }
 
 type config struct {
@@ -59,6 +60,9 @@ type config struct {
 	BindPassword string     `mapstructure:"bind_password"`
 	Idp          string     `mapstructure:"idp"`
 	Schema       attributes `mapstructure:"schema"`
+	// Mapping maps the attributes of the entries to the users, it defaults
+	// to the attributes of the schema.
+	Mapping mapping.Config `mapstructure:"mapping"`
 }
 
 type attributes struct {
@@ -97,6 +101,17 @@ func New(m map[string]interface{}) (user.Manager, error) {
 		return nil, err
 	}
 
+	mapper, err := mapping.New(c.Mapping, mapping.Config{
+		Idp:         c.Idp,
+		OpaqueID:    mapping.Attr(c.Schema.UID),
+		Username:    mapping.Attr(c.Schema.UID),
+		Mail:        mapping.Attr(c.Schema.Mail),
+		DisplayName: mapping.Attr(c.Schema.DisplayName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &manager{
 		hostname:     c.Hostname,
 		port:         c.Port,
@@ -105,8 +120,8 @@ func New(m map[string]interface{}) (user.Manager, error) {
 		groupfilter:  c.GroupFilter,
 		bindUsername: c.BindUsername,
 		bindPassword: c.BindPassword,
-		idp:          c.Idp,
 		schema:       c.Schema,
+		mapper:       mapper,
 	}, nil
 }
 
@@ -129,7 +144,7 @@ func (m *manager) GetUser(ctx context.Context, uid *userpb.UserId) (*userpb.User
 		m.baseDN,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
 		fmt.Sprintf(m.userfilter, uid.OpaqueId), // TODO this is screaming for errors if filter contains >1 %s
-		[]string{m.schema.DN, m.schema.UID, m.schema.Mail, m.schema.DisplayName},
+		append([]string{m.schema.DN}, m.mapper.Attributes()...),
 		nil,
 	)
 
@@ -144,21 +159,20 @@ func (m *manager) GetUser(ctx context.Context, uid *userpb.UserId) (*userpb.User
 
 	log.Debug().Interface("entries", sr.Entries).Msg("entries")
 
-	id := &userpb.UserId{
-		Idp:      m.idp,
-		OpaqueId: sr.Entries[0].GetAttributeValue(m.schema.UID),
-	}
-	groups, err := m.GetUserGroups(ctx, id)
+	return m.toUser(ctx, sr.Entries[0])
+}
+
+// toUser maps the entry to a user, with the groups found by the group filter.
+func (m *manager) toUser(ctx context.Context, e *ldap.Entry) (*userpb.User, error) {
+	u, err := m.mapper.User(mapping.FromLDAP(e))
 	if err != nil {
 		return nil, err
 	}
-	u := &userpb.User{
-		Id:          id,
-		Username:    sr.Entries[0].GetAttributeValue(m.schema.UID),
-		Groups:      groups,
-		Mail:        sr.Entries[0].GetAttributeValue(m.schema.Mail),
-		DisplayName: sr.Entries[0].GetAttributeValue(m.schema.DisplayName),
+	groups, err := m.GetUserGroups(ctx, u.Id)
+	if err != nil {
+		return nil, err
 	}
+	u.Groups = append(u.Groups, groups...)
 
 	return u, nil
 }
@@ -181,7 +195,7 @@ func (m *manager) FindUsers(ctx context.Context, query string) ([]*userpb.User,
 		m.baseDN,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
 		fmt.Sprintf(m.userfilter, query), // TODO this is screaming for errors if filter contains >1 %s
-		[]string{m.schema.DN, m.schema.UID, m.schema.Mail, m.schema.DisplayName},
+		append([]string{m.schema.DN}, m.mapper.Attributes()...),
 		nil,
 	)
 
@@ -193,21 +207,10 @@ func (m *manager) FindUsers(ctx context.Context, query string) ([]*userpb.User,
 	users := []*userpb.User{}
 
 	for _, entry := range sr.Entries {
-		id := &userpb.UserId{
-			Idp:      m.idp,
-			OpaqueId: entry.GetAttributeValue(m.schema.UID),
-		}
-		groups, err := m.GetUserGroups(ctx, id)
+		user, err := m.toUser(ctx, entry)
 		if err != nil {
 			return nil, err
 		}
-		user := &userpb.User{
-			Id:          id,
-			Username:    entry.GetAttributeValue(m.schema.UID),
-			Groups:      groups,
-			Mail:        entry.GetAttributeValue(m.schema.Mail),
-			DisplayName: entry.GetAttributeValue(m.schema.DisplayName),
-		}
 		users = append(users, user)
 	}
 
@@ -241,13 +244,12 @@ func (m *manager) GetUserGroups(ctx context.Context, uid *userpb.UserId) ([]stri
 		return []string{}, err
 	}
 
-	groups := []string{}
-
+	names := []string{}
 	for _, entry := range sr.Entries {
-		groups = append(groups, entry.GetAttributeValue(m.schema.CN))
+		names = append(names, entry.GetAttributeValue(m.schema.CN))
 	}
 
-	return groups, nil
+	return m.mapper.GroupNames(names)
 }
 
 func (m *manager) IsInGroup(ctx context.Context, uid *userpb.UserId, group string) (bool, error) {
@@ -0,0 +1,418 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package sql implements a user manager backed by a MySQL or PostgreSQL
+// database, which can create and change the users.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/identity/mapping"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/cs3org/reva/pkg/user/manager/registry"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	registry.Register("sql", New)
+}
+
+type config struct {
+	sqlutil.Config `mapstructure:",squash"`
+	// Idp is the identity provider of the users.
+	Idp string `mapstructure:"idp"`
+	// Mapping maps the columns of the users table to the users. The
+	// usernames are normalized before being stored and looked up.
+	Mapping mapping.Config `mapstructure:"mapping"`
+}
+
+// Manager is a user manager keeping the users in a SQL database. It also
+// authenticates them with their password.
+type Manager struct {
+	c      *config
+	db     *sql.DB
+	mapper *mapping.Mapper
+}
+
+func parseConfig(m map[string]interface{}) (*config, error) {
+	c := &config{}
+	if err := mapstructure.Decode(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// New returns a new user manager backed by a SQL database.
+func New(m map[string]interface{}) (user.Manager, error) {
+	return NewManager(m)
+}
+
+// NewManager returns a new user manager backed by a SQL database, as used
+// by the sql auth manager.
+func NewManager(m map[string]interface{}) (*Manager, error) {
+	c, err := parseConfig(m)
+	if err != nil {
+		err = errors.Wrap(err, "error creating a new manager")
+		return nil, err
+	}
+
+	mapper, err := newMapper(c)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sqlutil.Open(&c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &Manager{c: c, db: db, mapper: mapper}
+	if err := sqlutil.Migrate(context.Background(), db, c.DBDriver, "user_schema_migrations", migrations); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
+
+// newMapper returns the mapper of the columns of the users table, which
+// defaults to the columns of the same name.
+func newMapper(c *config) (*mapping.Mapper, error) {
+	return mapping.New(c.Mapping, mapping.Config{
+		Idp:         c.Idp,
+		OpaqueID:    mapping.Attr("opaque_id"),
+		Username:    mapping.Attr("username"),
+		Mail:        mapping.Attr("mail"),
+		DisplayName: mapping.Attr("display_name"),
+	})
+}
+
+// migrations contains the schema changes in the order they are applied.
+// The applied version is tracked in the user_schema_migrations table.
+// Never modify an existing migration, always append a new one.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		opaque_id VARCHAR(64) NOT NULL PRIMARY KEY,
+		username VARCHAR(255) NOT NULL UNIQUE,
+		mail VARCHAR(255) NOT NULL,
+		display_name VARCHAR(255) NOT NULL,
+		password_hash VARCHAR(255) NOT NULL,
+		quota BIGINT NOT NULL,
+		disabled INTEGER NOT NULL,
+		ctime BIGINT NOT NULL,
+		utime BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_groups (
+		opaque_id VARCHAR(64) NOT NULL,
+		group_name VARCHAR(255) NOT NULL,
+		PRIMARY KEY (opaque_id, group_name)
+	)`,
+	`CREATE INDEX user_groups_group ON user_groups (group_name)`,
+}
+
+const userColumns = "opaque_id, username, mail, display_name, quota, disabled"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (m *Manager) scanAccount(row scanner) (*user.Account, error) {
+	var (
+		id, username, mail, displayName string
+		quota                           int64
+		disabled                        int
+	)
+	if err := row.Scan(&id, &username, &mail, &displayName, &quota, &disabled); err != nil {
+		return nil, err
+	}
+	u, err := m.mapper.User(mapping.Attributes{
+		"opaque_id":    {id},
+		"username":     {username},
+		"mail":         {mail},
+		"display_name": {displayName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the quota travels with the user to the storage drivers
+	user.SetQuota(u, uint64(quota))
+	return &user.Account{
+		User:     u,
+		Quota:    uint64(quota),
+		Disabled: disabled != 0,
+	}, nil
+}
+
+// getAccount returns the account matching the where clause, with its groups.
+func (m *Manager) getAccount(ctx context.Context, where string, arg interface{}) (*user.Account, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE " + where
+	a, err := m.scanAccount(m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), arg))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.NotFound(fmt.Sprint(arg))
+		}
+		return nil, errors.Wrap(err, "sql: error reading user")
+	}
+	if a.User.Groups, err = m.GetUserGroups(ctx, a.User.Id); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// opaqueID returns the id of the user in the database, it fails if the user
+// belongs to another identity provider.
+func (m *Manager) opaqueID(uid *userpb.UserId) (string, error) {
+	if uid.GetIdp() != "" && uid.GetIdp() != m.c.Idp {
+		return "", errtypes.NotFound(uid.GetOpaqueId())
+	}
+	return uid.GetOpaqueId(), nil
+}
+
+// GetAccount returns the account of the user.
+func (m *Manager) GetAccount(ctx context.Context, uid *userpb.UserId) (*user.Account, error) {
+	id, err := m.opaqueID(uid)
+	if err != nil {
+		return nil, err
+	}
+	return m.getAccount(ctx, "opaque_id = ?", id)
+}
+
+// GetAccountByUsername returns the account of the user with the username.
+func (m *Manager) GetAccountByUsername(ctx context.Context, username string) (*user.Account, error) {
+	return m.getAccount(ctx, "username = ?", m.mapper.NormalizeUsername(username))
+}
+
+// GetUser returns the user.
+func (m *Manager) GetUser(ctx context.Context, uid *userpb.UserId) (*userpb.User, error) {
+	a, err := m.GetAccount(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return a.User, nil
+}
+
+// GetUserGroups returns the groups of the user.
+func (m *Manager) GetUserGroups(ctx context.Context, uid *userpb.UserId) ([]string, error) {
+	id, err := m.opaqueID(uid)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT group_name FROM user_groups WHERE opaque_id = ? ORDER BY group_name"), id)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error reading groups")
+	}
+	defer rows.Close()
+
+	groups := []string{}
+	for rows.Next() {
+		var g string
+		if err := rows.Scan(&g); err != nil {
+			return nil, errors.Wrap(err, "sql: error reading groups")
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// IsInGroup tells if the user is a member of the group.
+func (m *Manager) IsInGroup(ctx context.Context, uid *userpb.UserId, group string) (bool, error) {
+	groups, err := m.GetUserGroups(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	for _, g := range groups {
+		if g == group {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindUsers returns the users whose username, mail or display name contain
+// the query, ignoring the case.
+func (m *Manager) FindUsers(ctx context.Context, query string) ([]*userpb.User, error) {
+	q := "%" + strings.ToLower(query) + "%"
+	rows, err := m.db.QueryContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT "+userColumns+" FROM users WHERE LOWER(username) LIKE ? OR LOWER(mail) LIKE ? OR LOWER(display_name) LIKE ? ORDER BY username"), q, q, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "sql: error searching users")
+	}
+	defer rows.Close()
+
+	users := []*userpb.User{}
+	for rows.Next() {
+		a, err := m.scanAccount(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "sql: error searching users")
+		}
+		users = append(users, a.User)
+	}
+	return users, rows.Err()
+}
+
+// CreateUser creates the user with the password and sets its id.
+func (m *Manager) CreateUser(ctx context.Context, u *userpb.User, password string) error {
+	u.Username = m.mapper.NormalizeUsername(u.Username)
+	if u.Username == "" {
+		return errors.New("sql: username is required")
+	}
+	if _, err := m.GetAccountByUsername(ctx, u.Username); err == nil {
+		return errtypes.AlreadyExists(u.Username)
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "sql: error hashing password")
+	}
+
+	u.Id = &userpb.UserId{OpaqueId: uuid.New().String(), Idp: m.c.Idp}
+	now := time.Now().UnixNano()
+	query := "INSERT INTO users (opaque_id, username, mail, display_name, password_hash, quota, disabled, ctime, utime) VALUES (?, ?, ?, ?, ?, 0, 0, ?, ?)"
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), u.Id.OpaqueId, u.Username, u.Mail, u.DisplayName, string(hash), now, now); err != nil {
+		return errors.Wrap(err, "sql: error inserting user")
+	}
+	for _, g := range u.Groups {
+		if err := m.AddToGroup(ctx, u.Id, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec runs the statement changing the user, it fails with
+// errtypes.NotFound if there is no such user.
+func (m *Manager) exec(ctx context.Context, query string, args ...interface{}) error {
+	res, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, query), args...)
+	if err != nil {
+		return errors.Wrap(err, "sql: error updating user")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errtypes.NotFound(fmt.Sprint(args[len(args)-1]))
+	}
+	return nil
+}
+
+// UpdateAccount stores the mail, display name, quota and state of the account.
+func (m *Manager) UpdateAccount(ctx context.Context, a *user.Account) error {
+	id, err := m.opaqueID(a.User.Id)
+	if err != nil {
+		return err
+	}
+	disabled := 0
+	if a.Disabled {
+		disabled = 1
+	}
+	query := "UPDATE users SET mail = ?, display_name = ?, quota = ?, disabled = ?, utime = ? WHERE opaque_id = ?"
+	return m.exec(ctx, query, a.User.Mail, a.User.DisplayName, int64(a.Quota), disabled, time.Now().UnixNano(), id)
+}
+
+// SetPassword changes the password of the user.
+func (m *Manager) SetPassword(ctx context.Context, uid *userpb.UserId, password string) error {
+	id, err := m.opaqueID(uid)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "sql: error hashing password")
+	}
+	return m.exec(ctx, "UPDATE users SET password_hash = ?, utime = ? WHERE opaque_id = ?", string(hash), time.Now().UnixNano(), id)
+}
+
+// DeleteUser removes the user and its group memberships.
+func (m *Manager) DeleteUser(ctx context.Context, uid *userpb.UserId) error {
+	id, err := m.opaqueID(uid)
+	if err != nil {
+		return err
+	}
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "DELETE FROM user_groups WHERE opaque_id = ?"), id); err != nil {
+		return errors.Wrap(err, "sql: error removing groups")
+	}
+	res, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "DELETE FROM users WHERE opaque_id = ?"), id)
+	if err != nil {
+		return errors.Wrap(err, "sql: error deleting user")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errtypes.NotFound(id)
+	}
+	return nil
+}
+
+// AddToGroup makes the user a member of the group.
+func (m *Manager) AddToGroup(ctx context.Context, uid *userpb.UserId, group string) error {
+	if _, err := m.GetAccount(ctx, uid); err != nil {
+		return err
+	}
+	ok, err := m.IsInGroup(ctx, uid, group)
+	if err != nil || ok {
+		return err
+	}
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "INSERT INTO user_groups (opaque_id, group_name) VALUES (?, ?)"), uid.OpaqueId, group); err != nil {
+		return errors.Wrap(err, "sql: error adding user to group")
+	}
+	return nil
+}
+
+// RemoveFromGroup removes the user from the group.
+func (m *Manager) RemoveFromGroup(ctx context.Context, uid *userpb.UserId, group string) error {
+	id, err := m.opaqueID(uid)
+	if err != nil {
+		return err
+	}
+	if _, err := m.db.ExecContext(ctx, sqlutil.Rebind(m.c.DBDriver, "DELETE FROM user_groups WHERE opaque_id = ? AND group_name = ?"), id, group); err != nil {
+		return errors.Wrap(err, "sql: error removing user from group")
+	}
+	return nil
+}
+
+// Authenticate checks the password of the user, disabled users can not
+// authenticate.
+func (m *Manager) Authenticate(ctx context.Context, username, password string) (*userpb.User, error) {
+	username = m.mapper.NormalizeUsername(username)
+	var hash string
+	err := m.db.QueryRowContext(ctx, sqlutil.Rebind(m.c.DBDriver, "SELECT password_hash FROM users WHERE username = ?"), username).Scan(&hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errtypes.InvalidCredentials(username)
+		}
+		return nil, errors.Wrap(err, "sql: error reading user")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, errtypes.InvalidCredentials(username)
+	}
+
+	a, err := m.GetAccountByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if a.Disabled {
+		return nil, errtypes.InvalidCredentials(username)
+	}
+	return a.User, nil
+}
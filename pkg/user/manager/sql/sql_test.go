@@ -0,0 +1,178 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package sql
+
+import (
+	"context"
+	"testing"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/identity/mapping"
+	"github.com/cs3org/reva/pkg/sqlutil"
+	"github.com/cs3org/reva/pkg/sqlutil/sqlitetest"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	c := &config{
+		Config:  sqlutil.Config{DBDriver: sqlitetest.Driver},
+		Idp:     "local",
+		Mapping: mapping.Config{Normalize: mapping.Normalize{Lowercase: true}},
+	}
+	mapper, err := newMapper(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{c: c, db: sqlitetest.Open(t), mapper: mapper}
+	if err := sqlutil.Migrate(context.Background(), m.db, m.c.DBDriver, "user_schema_migrations", migrations); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	einstein := &userpb.User{Username: "Einstein", Mail: "einstein@example.org", DisplayName: "Albert Einstein", Groups: []string{"physics"}}
+	if err := m.CreateUser(ctx, einstein, "relativity"); err != nil {
+		t.Fatal(err)
+	}
+	if einstein.Id.GetIdp() != "local" || einstein.Id.GetOpaqueId() == "" || einstein.Username != "einstein" {
+		t.Fatalf("unexpected created user %+v", einstein)
+	}
+	if err := m.CreateUser(ctx, &userpb.User{Username: "EINSTEIN"}, "other"); err == nil {
+		t.Error("expected the same username to be refused")
+	} else if _, ok := err.(errtypes.IsAlreadyExists); !ok {
+		t.Errorf("expected already exists, got %v", err)
+	}
+	marie := &userpb.User{Username: "marie", Mail: "marie@example.org", DisplayName: "Marie Curie"}
+	if err := m.CreateUser(ctx, marie, "radioactivity"); err != nil {
+		t.Fatal(err)
+	}
+
+	// get
+	u, err := m.GetUser(ctx, einstein.Id)
+	if err != nil || u.Username != "einstein" || u.Mail != "einstein@example.org" || len(u.Groups) != 1 || u.Groups[0] != "physics" {
+		t.Errorf("GetUser() = %v, %v", u, err)
+	}
+	if _, err := m.GetUser(ctx, &userpb.UserId{Idp: "other", OpaqueId: einstein.Id.OpaqueId}); err == nil {
+		t.Error("expected the users of other identity providers not to be found")
+	}
+	if a, err := m.GetAccountByUsername(ctx, "EINSTEIN"); err != nil || a.User.Id.OpaqueId != einstein.Id.OpaqueId {
+		t.Errorf("GetAccountByUsername() = %v, %v", a, err)
+	}
+	if users, err := m.FindUsers(ctx, "CURIE"); err != nil || len(users) != 1 || users[0].Username != "marie" {
+		t.Errorf("FindUsers() = %v, %v", users, err)
+	}
+	if users, err := m.FindUsers(ctx, "example.org"); err != nil || len(users) != 2 {
+		t.Errorf("FindUsers() by mail = %v, %v", users, err)
+	}
+
+	// groups
+	if err := m.AddToGroup(ctx, marie.Id, "physics"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddToGroup(ctx, marie.Id, "chemistry"); err != nil {
+		t.Fatal(err)
+	}
+	if groups, err := m.GetUserGroups(ctx, marie.Id); err != nil || len(groups) != 2 || groups[0] != "chemistry" {
+		t.Errorf("GetUserGroups() = %v, %v", groups, err)
+	}
+	if err := m.RemoveFromGroup(ctx, marie.Id, "physics"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := m.IsInGroup(ctx, marie.Id, "physics"); err != nil || ok {
+		t.Errorf("IsInGroup() after removal = %v, %v", ok, err)
+	}
+	if err := m.AddToGroup(ctx, &userpb.UserId{Idp: "local", OpaqueId: "missing"}, "physics"); err == nil {
+		t.Error("expected a missing user not to be added to a group")
+	}
+
+	// update
+	a, err := m.GetAccount(ctx, marie.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.User.DisplayName = "Marie Skłodowska Curie"
+	a.Quota = 1 << 30
+	if err := m.UpdateAccount(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := m.GetAccount(ctx, marie.Id); err != nil || a.User.DisplayName != "Marie Skłodowska Curie" || a.Quota != 1<<30 {
+		t.Errorf("GetAccount() after update = %v, %v", a, err)
+	}
+
+	// delete
+	if err := m.DeleteUser(ctx, marie.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetUser(ctx, marie.Id); err == nil {
+		t.Error("expected the deleted user not to be found")
+	} else if _, ok := err.(errtypes.IsNotFound); !ok {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if err := m.DeleteUser(ctx, marie.Id); err == nil {
+		t.Error("expected deleting a missing user to fail")
+	}
+}
+
+// TestAuthenticate covers the sql auth manager, which is this manager.
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	einstein := &userpb.User{Username: "einstein"}
+	if err := m.CreateUser(ctx, einstein, "relativity"); err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := m.Authenticate(ctx, "Einstein", "relativity"); err != nil || u.Id.OpaqueId != einstein.Id.OpaqueId {
+		t.Errorf("Authenticate() = %v, %v", u, err)
+	}
+	for _, c := range [][2]string{{"einstein", "wrong"}, {"marie", "relativity"}} {
+		if _, err := m.Authenticate(ctx, c[0], c[1]); err == nil {
+			t.Errorf("expected %s to fail to authenticate with %s", c[0], c[1])
+		} else if _, ok := err.(errtypes.IsInvalidCredentials); !ok {
+			t.Errorf("expected invalid credentials, got %v", err)
+		}
+	}
+
+	if err := m.SetPassword(ctx, einstein.Id, "photons"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(ctx, "einstein", "relativity"); err == nil {
+		t.Error("expected the old password to be refused")
+	}
+	if _, err := m.Authenticate(ctx, "einstein", "photons"); err != nil {
+		t.Errorf("Authenticate() with the new password: %v", err)
+	}
+
+	a, err := m.GetAccount(ctx, einstein.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Disabled = true
+	if err := m.UpdateAccount(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(ctx, "einstein", "photons"); err == nil {
+		t.Error("expected a disabled user not to authenticate")
+	}
+}
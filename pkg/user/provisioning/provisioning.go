@@ -0,0 +1,253 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+// Package provisioning defines the API of the userprovider service to create
+// and change the users. It is not part of the CS3 APIs, so its messages are
+// plain structs exchanged as JSON over gRPC.
+package provisioning
+
+import (
+	"context"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/cs3org/reva/pkg/errtypes"
+	"github.com/cs3org/reva/pkg/rgrpc/jsoncodec"
+	"github.com/cs3org/reva/pkg/user"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const serviceName = "revad.provisioning.v1beta1.ProvisioningAPI"
+
+// GetAccountRequest selects the account by user id or, if nil, by username.
+type GetAccountRequest struct {
+	UserID   *userpb.UserId `json:"user_id"`
+	Username string         `json:"username"`
+}
+
+// GetAccountResponse holds the account.
+type GetAccountResponse struct {
+	Status  *rpc.Status   `json:"status"`
+	Account *user.Account `json:"account"`
+}
+
+// CreateUserRequest holds the user to create and its password.
+type CreateUserRequest struct {
+	User     *userpb.User `json:"user"`
+	Password string       `json:"password"`
+}
+
+// CreateUserResponse holds the created user with its id.
+type CreateUserResponse struct {
+	Status *rpc.Status  `json:"status"`
+	User   *userpb.User `json:"user"`
+}
+
+// UpdateAccountRequest holds the account to store.
+type UpdateAccountRequest struct {
+	Account *user.Account `json:"account"`
+}
+
+// SetPasswordRequest holds the new password of the user.
+type SetPasswordRequest struct {
+	UserID   *userpb.UserId `json:"user_id"`
+	Password string         `json:"password"`
+}
+
+// DeleteUserRequest selects the user to delete.
+type DeleteUserRequest struct {
+	UserID *userpb.UserId `json:"user_id"`
+}
+
+// GroupRequest selects the user and the group it joins or leaves.
+type GroupRequest struct {
+	UserID *userpb.UserId `json:"user_id"`
+	Group  string         `json:"group"`
+}
+
+// Response is the response of the calls returning nothing but a status.
+type Response struct {
+	Status *rpc.Status `json:"status"`
+}
+
+// APIServer is the server API of the provisioning service.
+type APIServer interface {
+	GetAccount(context.Context, *GetAccountRequest) (*GetAccountResponse, error)
+	CreateUser(context.Context, *CreateUserRequest) (*CreateUserResponse, error)
+	UpdateAccount(context.Context, *UpdateAccountRequest) (*Response, error)
+	SetPassword(context.Context, *SetPasswordRequest) (*Response, error)
+	DeleteUser(context.Context, *DeleteUserRequest) (*Response, error)
+	AddToGroup(context.Context, *GroupRequest) (*Response, error)
+	RemoveFromGroup(context.Context, *GroupRequest) (*Response, error)
+}
+
+// RegisterAPIServer registers the provisioning service on the gRPC server.
+func RegisterAPIServer(s *grpc.Server, srv APIServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*APIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		method("GetAccount", func() interface{} { return &GetAccountRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.GetAccount(ctx, req.(*GetAccountRequest))
+		}),
+		method("CreateUser", func() interface{} { return &CreateUserRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.CreateUser(ctx, req.(*CreateUserRequest))
+		}),
+		method("UpdateAccount", func() interface{} { return &UpdateAccountRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.UpdateAccount(ctx, req.(*UpdateAccountRequest))
+		}),
+		method("SetPassword", func() interface{} { return &SetPasswordRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.SetPassword(ctx, req.(*SetPasswordRequest))
+		}),
+		method("DeleteUser", func() interface{} { return &DeleteUserRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.DeleteUser(ctx, req.(*DeleteUserRequest))
+		}),
+		method("AddToGroup", func() interface{} { return &GroupRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.AddToGroup(ctx, req.(*GroupRequest))
+		}),
+		method("RemoveFromGroup", func() interface{} { return &GroupRequest{} }, func(s APIServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.RemoveFromGroup(ctx, req.(*GroupRequest))
+		}),
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// method returns the description of the unary method, which decodes a new
+// request and passes it to call through the interceptors.
+func method(name string, newReq func() interface{}, call func(APIServer, context.Context, interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(APIServer), ctx, req)
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + name}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+// Client calls the provisioning service. Its methods return the errtypes
+// matching the status codes, like the user managers do.
+type Client struct {
+	cc *grpc.ClientConn
+}
+
+// NewClient returns a client of the provisioning service on the connection.
+func NewClient(cc *grpc.ClientConn) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) invoke(ctx context.Context, name string, req, res interface{}) error {
+	err := c.cc.Invoke(ctx, "/"+serviceName+"/"+name, req, res, grpc.CallContentSubtype(jsoncodec.Name))
+	return errors.Wrap(err, "provisioning: error calling "+name)
+}
+
+// GetAccount returns the account of the user.
+func (c *Client) GetAccount(ctx context.Context, uid *userpb.UserId) (*user.Account, error) {
+	res := &GetAccountResponse{}
+	if err := c.invoke(ctx, "GetAccount", &GetAccountRequest{UserID: uid}, res); err != nil {
+		return nil, err
+	}
+	return res.Account, statusError(res.Status, uid.GetOpaqueId())
+}
+
+// GetAccountByUsername returns the account of the user with the username.
+func (c *Client) GetAccountByUsername(ctx context.Context, username string) (*user.Account, error) {
+	res := &GetAccountResponse{}
+	if err := c.invoke(ctx, "GetAccount", &GetAccountRequest{Username: username}, res); err != nil {
+		return nil, err
+	}
+	return res.Account, statusError(res.Status, username)
+}
+
+// CreateUser creates the user with the password and sets its id.
+func (c *Client) CreateUser(ctx context.Context, u *userpb.User, password string) error {
+	res := &CreateUserResponse{}
+	if err := c.invoke(ctx, "CreateUser", &CreateUserRequest{User: u, Password: password}, res); err != nil {
+		return err
+	}
+	if err := statusError(res.Status, u.Username); err != nil {
+		return err
+	}
+	u.Id = res.User.GetId()
+	return nil
+}
+
+// UpdateAccount stores the mail, display name, quota and state of the account.
+func (c *Client) UpdateAccount(ctx context.Context, a *user.Account) error {
+	return c.call(ctx, "UpdateAccount", &UpdateAccountRequest{Account: a}, a.User.GetUsername())
+}
+
+// SetPassword changes the password of the user.
+func (c *Client) SetPassword(ctx context.Context, uid *userpb.UserId, password string) error {
+	return c.call(ctx, "SetPassword", &SetPasswordRequest{UserID: uid, Password: password}, uid.GetOpaqueId())
+}
+
+// DeleteUser removes the user and its group memberships.
+func (c *Client) DeleteUser(ctx context.Context, uid *userpb.UserId) error {
+	return c.call(ctx, "DeleteUser", &DeleteUserRequest{UserID: uid}, uid.GetOpaqueId())
+}
+
+// AddToGroup makes the user a member of the group.
+func (c *Client) AddToGroup(ctx context.Context, uid *userpb.UserId, group string) error {
+	return c.call(ctx, "AddToGroup", &GroupRequest{UserID: uid, Group: group}, uid.GetOpaqueId())
+}
+
+// RemoveFromGroup removes the user from the group.
+func (c *Client) RemoveFromGroup(ctx context.Context, uid *userpb.UserId, group string) error {
+	return c.call(ctx, "RemoveFromGroup", &GroupRequest{UserID: uid, Group: group}, uid.GetOpaqueId())
+}
+
+func (c *Client) call(ctx context.Context, name string, req interface{}, subject string) error {
+	res := &Response{}
+	if err := c.invoke(ctx, name, req, res); err != nil {
+		return err
+	}
+	return statusError(res.Status, subject)
+}
+
+// statusError returns the errtypes error matching the code of the status,
+// nil if it is OK.
+func statusError(s *rpc.Status, subject string) error {
+	switch s.GetCode() {
+	case rpc.Code_CODE_OK:
+		return nil
+	case rpc.Code_CODE_NOT_FOUND:
+		return errtypes.NotFound(subject)
+	case rpc.Code_CODE_ALREADY_EXISTS:
+		return errtypes.AlreadyExists(subject)
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return errtypes.PermissionDenied(subject)
+	case rpc.Code_CODE_UNIMPLEMENTED:
+		return errtypes.NotSupported(s.GetMessage())
+	default:
+		return errors.New("provisioning: " + s.GetCode().String() + ": " + s.GetMessage())
+	}
+}
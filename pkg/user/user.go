@@ -20,10 +20,16 @@ package user
 
 import (
 	"context"
+	"strconv"
 
 	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	typespb "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 )
 
+// QuotaOpaqueKey is the key of the opaque data of the users holding the
+// quota in bytes of their account, which the storage drivers enforce.
+const QuotaOpaqueKey = "quota"
+
 type key int
 
 const (
@@ -69,3 +75,61 @@ type Manager interface {
 	IsInGroup(ctx context.Context, uid *userpb.UserId, group string) (bool, error)
 	FindUsers(ctx context.Context, query string) ([]*userpb.User, error)
 }
+
+// Account holds the provisioning state of a user.
+type Account struct {
+	User *userpb.User `json:"user"`
+	// Quota is the quota in bytes of the home of the user, 0 for the default one.
+	Quota uint64 `json:"quota"`
+	// Disabled accounts can not log in.
+	Disabled bool `json:"disabled"`
+}
+
+// Quota returns the quota in bytes of the account of the user, 0 if it has
+// none.
+func Quota(u *userpb.User) uint64 {
+	e, ok := u.GetOpaque().GetMap()[QuotaOpaqueKey]
+	if !ok || e.Decoder != "plain" {
+		return 0
+	}
+	q, _ := strconv.ParseUint(string(e.Value), 10, 64)
+	return q
+}
+
+// SetQuota stores the quota in bytes of the account in the opaque data of
+// the user, 0 removes it.
+func SetQuota(u *userpb.User, quota uint64) {
+	if quota == 0 {
+		delete(u.GetOpaque().GetMap(), QuotaOpaqueKey)
+		return
+	}
+	if u.Opaque == nil {
+		u.Opaque = &typespb.Opaque{}
+	}
+	if u.Opaque.Map == nil {
+		u.Opaque.Map = map[string]*typespb.OpaqueEntry{}
+	}
+	u.Opaque.Map[QuotaOpaqueKey] = &typespb.OpaqueEntry{Decoder: "plain", Value: []byte(strconv.FormatUint(quota, 10))}
+}
+
+// Provisioner is implemented by the managers able to create and change users.
+type Provisioner interface {
+	Manager
+	// GetAccount returns the account of the user.
+	GetAccount(ctx context.Context, uid *userpb.UserId) (*Account, error)
+	// GetAccountByUsername returns the account of the user with the username.
+	GetAccountByUsername(ctx context.Context, username string) (*Account, error)
+	// CreateUser creates the user with the password and sets its id, it fails
+	// with errtypes.AlreadyExists if the username is taken.
+	CreateUser(ctx context.Context, u *userpb.User, password string) error
+	// UpdateAccount stores the mail, display name, quota and state of the account.
+	UpdateAccount(ctx context.Context, a *Account) error
+	// SetPassword changes the password of the user.
+	SetPassword(ctx context.Context, uid *userpb.UserId, password string) error
+	// DeleteUser removes the user and its group memberships.
+	DeleteUser(ctx context.Context, uid *userpb.UserId) error
+	// AddToGroup makes the user a member of the group.
+	AddToGroup(ctx context.Context, uid *userpb.UserId, group string) error
+	// RemoveFromGroup removes the user from the group.
+	RemoveFromGroup(ctx context.Context, uid *userpb.UserId, group string) error
+}